@@ -0,0 +1,180 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package acl
+
+import (
+	"strings"
+	"testing"
+
+	"tailscale.com/types/ipproto"
+)
+
+const testPolicy = `{
+	// Comments and trailing commas are allowed.
+	"groups": {
+		"group:eng": ["alice@example.com", "bob@example.com"],
+	},
+	"hosts": {
+		"corp": "10.0.0.0/16",
+		"db": "10.0.1.5",
+	},
+	"tagOwners": {
+		"tag:server": ["group:eng"],
+		"tag:monitor": ["group:eng"],
+	},
+	"acls": [
+		{"action": "accept", "src": ["group:eng"], "dst": ["tag:server:22,80-90"]},
+		{"action": "accept", "src": ["autogroup:member"], "dst": ["autogroup:self:*"]},
+		{"action": "accept", "users": ["carol@example.com"], "proto": "udp", "ports": ["db:53"]},
+	],
+	"grants": [
+		{"src": ["tag:monitor"], "dst": ["tag:server", "corp"], "ip": ["tcp:9100", "icmp:*"]},
+		{"src": ["tag:server"], "dst": ["autogroup:internet"], "ip": ["*"]},
+	],
+	"ssh": [
+		{"action": "check", "src": ["group:eng"], "dst": ["tag:server"], "users": ["root"]},
+		{"action": "accept", "src": ["group:eng"], "dst": ["tag:server"], "users": ["autogroup:nonroot"]},
+		{"action": "accept", "src": ["autogroup:member"], "dst": ["autogroup:self"], "users": ["localpart:*@example.com"]},
+	],
+	"tests": [
+		{"src": "alice@example.com", "accept": ["tag:server:22", "tag:server:85", "alice@example.com:443"], "deny": ["tag:server:443", "db:53"]},
+		{"user": "carol@example.com", "proto": "udp", "allow": ["db:53"]},
+		{"src": "tag:monitor", "accept": ["10.0.2.1:9100"], "deny": ["10.1.0.1:9100"]},
+	],
+	"sshTests": [
+		{"src": "bob@example.com", "dst": ["tag:server"], "accept": ["ubuntu"], "check": ["root"]},
+		{"src": "carol@example.com", "dst": ["carol@example.com"], "accept": ["carol"], "deny": ["root"]},
+	],
+	"nodeAttrs": [],
+}`
+
+func mustParse(t *testing.T, s string) *Policy {
+	t.Helper()
+	p, err := Parse([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestCheck(t *testing.T) {
+	p := mustParse(t, testPolicy)
+	tests := []struct {
+		src, dst string
+		proto    ipproto.Proto
+		port     uint16
+		want     Decision
+	}{
+		{"alice@example.com", "tag:server", ipproto.TCP, 22, Decision{true, "acls[0]"}},
+		{"alice@example.com", "tag:server", ipproto.UDP, 80, Decision{true, "acls[0]"}},
+		{"alice@example.com", "tag:server", ipproto.TCP, 91, Decision{}},
+		{"alice@example.com", "tag:server,tag:monitor", ipproto.TCP, 22, Decision{true, "acls[0]"}},
+		{"alice@example.com", "alice@example.com", ipproto.TCP, 443, Decision{true, "acls[1]"}},
+		{"alice@example.com", "bob@example.com", ipproto.TCP, 443, Decision{}},
+		{"tag:server", "tag:server", ipproto.TCP, 22, Decision{}},
+		{"carol@example.com", "tag:server", ipproto.TCP, 22, Decision{}},
+		{"carol@example.com", "db", ipproto.UDP, 53, Decision{true, "acls[2]"}},
+		{"carol@example.com", "10.0.1.5", ipproto.UDP, 53, Decision{true, "acls[2]"}},
+		{"carol@example.com", "db", ipproto.TCP, 53, Decision{}},
+		{"tag:monitor", "tag:server", ipproto.TCP, 9100, Decision{true, "grants[0]"}},
+		{"tag:monitor", "tag:server", ipproto.ICMPv4, 0, Decision{true, "grants[0]"}},
+		{"tag:monitor", "corp", ipproto.TCP, 9100, Decision{true, "grants[0]"}},
+		{"tag:monitor", "10.0.0.0/8", ipproto.TCP, 9100, Decision{}},
+		{"tag:monitor", "tag:server", ipproto.UDP, 9100, Decision{}},
+		{"tag:server", "8.8.8.8", ipproto.UDP, 53, Decision{true, "grants[1]"}},
+		{"tag:server", "192.168.0.1", ipproto.UDP, 53, Decision{}},
+		{"tag:server", "100.64.0.1", ipproto.UDP, 53, Decision{}},
+	}
+	for _, tt := range tests {
+		src, err := p.ParseNode(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, err := p.ParseNode(tt.dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Check(src, dst, tt.proto, tt.port); got != tt.want {
+			t.Errorf("Check(%s, %s, %v, %d) = %+v, want %+v", tt.src, tt.dst, tt.proto, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSSH(t *testing.T) {
+	p := mustParse(t, testPolicy)
+	tests := []struct {
+		src, dst, user string
+		want           SSHDecision
+	}{
+		{"alice@example.com", "tag:server", "root", SSHDecision{"check", "ssh[0]"}},
+		{"alice@example.com", "tag:server", "ubuntu", SSHDecision{"accept", "ssh[1]"}},
+		{"carol@example.com", "tag:server", "ubuntu", SSHDecision{Action: "deny"}},
+		{"alice@example.com", "alice@example.com", "alice", SSHDecision{"accept", "ssh[2]"}},
+		{"alice@example.com", "alice@example.com", "bob", SSHDecision{Action: "deny"}},
+		{"alice@example.com", "bob@example.com", "alice", SSHDecision{Action: "deny"}},
+	}
+	for _, tt := range tests {
+		src, err := p.ParseNode(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, err := p.ParseNode(tt.dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.CheckSSH(src, dst, tt.user); got != tt.want {
+			t.Errorf("CheckSSH(%s, %s, %s) = %+v, want %+v", tt.src, tt.dst, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	p := mustParse(t, testPolicy)
+	if errs := p.RunTests(); len(errs) > 0 {
+		t.Fatalf("unexpected test failures: %v", errs)
+	}
+
+	p.Tests = []Test{{Src: "bob@example.com", Accept: []string{"db:53"}, Deny: []string{"tag:server:22"}}}
+	p.SSHTests = []SSHTest{{Src: "bob@example.com", Dst: []string{"tag:server"}, Accept: []string{"root"}}}
+	var got []string
+	for _, err := range p.RunTests() {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		"tests[0]: bob@example.com -> db:53: got deny, want accept",
+		"tests[0]: bob@example.com -> tag:server:22: got accept by acls[0], want deny",
+		"sshTests[0]: bob@example.com -> root@tag:server: got check, want accept",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("RunTests errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		want   string
+	}{
+		{"syntax", `{"acls": [}`, "error parsing policy"},
+		{"undefined-group", `{"acls": [{"action": "accept", "src": ["group:nope"], "dst": ["*:*"]}]}`, `group "group:nope" is not defined`},
+		{"undefined-tag", `{"acls": [{"action": "accept", "src": ["*"], "dst": ["tag:nope:22"]}]}`, `tag "tag:nope" is not defined in tagOwners`},
+		{"bad-action", `{"acls": [{"action": "drop", "src": ["*"], "dst": ["*:*"]}]}`, `action "drop" is not supported`},
+		{"bad-ports", `{"acls": [{"action": "accept", "src": ["*"], "dst": ["*:90-80"]}]}`, `invalid port range "90-80"`},
+		{"no-ports", `{"acls": [{"action": "accept", "src": ["*"], "dst": ["10.0.0.1"]}]}`, `is missing ports`},
+		{"self-as-src", `{"acls": [{"action": "accept", "src": ["autogroup:self"], "dst": ["*:*"]}]}`, "autogroup:self can only be used as a destination"},
+		{"unsupported-autogroup", `{"acls": [{"action": "accept", "src": ["autogroup:admin"], "dst": ["*:*"]}]}`, "autogroup:admin is not supported"},
+		{"bad-grant-proto", `{"grants": [{"src": ["*"], "dst": ["*"], "ip": ["nope:80"]}]}`, `proto name "nope" not known`},
+		{"bad-host", `{"hosts": {"db": "nope"}}`, `hosts["db"]`},
+		{"bad-ssh-action", `{"ssh": [{"action": "deny", "src": ["*"], "dst": ["*"], "users": ["root"]}]}`, `action "deny" is not supported`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.policy))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse error = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package acl
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/types/ipproto"
+)
+
+// Node is a device in a tailnet, or a subnet or address reachable through
+// it, as identified by the policy.
+type Node struct {
+	// User is the login name of the device's owner. It is empty for tagged
+	// devices, which are not owned by users for the purposes of the policy.
+	User string
+	// Tags are the device's tags.
+	Tags []string
+	// Addr, if valid, is the device's address or the subnet that a host
+	// alias names. Selectors for IPs and hosts only match a Node if they
+	// contain all of Addr.
+	Addr netip.Prefix
+}
+
+// String returns the Node in the format accepted by ParseNode.
+func (n Node) String() string {
+	switch {
+	case len(n.Tags) > 0:
+		return strings.Join(n.Tags, ",")
+	case n.User != "":
+		return n.User
+	case n.Addr.IsSingleIP():
+		return n.Addr.Addr().String()
+	case n.Addr.IsValid():
+		return n.Addr.String()
+	}
+	return "(none)"
+}
+
+// ParseNode parses a device as it is written in the tests of a policy file:
+// a user, a comma-separated list of tags, a host alias, or an IP address or
+// subnet.
+func (p *Policy) ParseNode(s string) (Node, error) {
+	switch {
+	case strings.HasPrefix(s, "tag:"):
+		tags := strings.Split(s, ",")
+		for _, t := range tags {
+			if err := p.definedTag(t); err != nil {
+				return Node{}, err
+			}
+		}
+		return Node{Tags: tags}, nil
+	case strings.Contains(s, "@"):
+		if strings.ContainsAny(s, ", ") {
+			return Node{}, fmt.Errorf("invalid user %q", s)
+		}
+		return Node{User: s}, nil
+	case strings.HasPrefix(s, "group:"), strings.HasPrefix(s, "autogroup:"), s == "*":
+		return Node{}, fmt.Errorf("%q is not a single device; use a user, tag, host or IP", s)
+	}
+	if pfx, ok := p.hosts[s]; ok {
+		return Node{Addr: pfx}, nil
+	}
+	pfx, err := parsePrefixOrAddr(s)
+	if err != nil {
+		return Node{}, fmt.Errorf("invalid device %q: not a user, tag, host or IP", s)
+	}
+	return Node{Addr: pfx}, nil
+}
+
+// Decision is the result of evaluating an access query.
+type Decision struct {
+	// Allow is whether the access is permitted.
+	Allow bool
+	// Rule names the first rule that permits the access, such as "acls[2]"
+	// or "grants[0]". It is empty if Allow is false.
+	Rule string
+}
+
+// Check reports whether src may connect to dst using the given IP protocol
+// and port. The port is ignored for protocols without ports, such as ICMP.
+func (p *Policy) Check(src, dst Node, proto ipproto.Proto, port uint16) Decision {
+	for _, r := range p.rules {
+		if !slices.ContainsFunc(r.src, func(s string) bool { return p.match(s, src, nil) }) {
+			continue
+		}
+		for _, d := range r.dst {
+			if d.allows(proto, port) && p.match(d.sel, dst, &src) {
+				return Decision{Allow: true, Rule: r.name}
+			}
+		}
+	}
+	return Decision{}
+}
+
+func (d netDst) allows(proto ipproto.Proto, port uint16) bool {
+	protos := d.protos
+	if protos == nil {
+		protos = defaultProtos
+	}
+	if !slices.Contains(protos, proto) {
+		return false
+	}
+	if !hasPorts(proto) {
+		return true
+	}
+	return slices.ContainsFunc(d.ports, func(pr portRange) bool {
+		return pr.first <= port && port <= pr.last
+	})
+}
+
+// hasPorts reports whether proto has ports that rules can restrict.
+func hasPorts(proto ipproto.Proto) bool {
+	switch proto {
+	case ipproto.TCP, ipproto.UDP, ipproto.SCTP:
+		return true
+	}
+	return false
+}
+
+// match reports whether the selector sel matches n. src is the source of the
+// connection when sel is a destination selector, and nil otherwise.
+func (p *Policy) match(sel string, n Node, src *Node) bool {
+	isUser := n.User != "" && len(n.Tags) == 0
+	switch {
+	case sel == "*":
+		return true
+	case strings.HasPrefix(sel, "group:"):
+		return isUser && slices.Contains(p.Groups[sel], n.User)
+	case strings.HasPrefix(sel, "tag:"):
+		return slices.Contains(n.Tags, sel)
+	case sel == "autogroup:member":
+		return isUser
+	case sel == "autogroup:tagged":
+		return len(n.Tags) > 0
+	case sel == "autogroup:self":
+		return src != nil && isUser && src.User == n.User && len(src.Tags) == 0
+	case sel == "autogroup:internet":
+		return n.Addr.IsValid() && isInternet(n.Addr.Addr())
+	case strings.HasPrefix(sel, "autogroup:"):
+		return false
+	case strings.Contains(sel, "@"):
+		return isUser && n.User == sel
+	}
+	pfx, ok := p.hosts[sel]
+	if !ok {
+		var err error
+		if pfx, err = parsePrefixOrAddr(sel); err != nil {
+			return false
+		}
+	}
+	return n.Addr.IsValid() && pfx.Bits() <= n.Addr.Bits() && pfx.Contains(n.Addr.Addr())
+}
+
+// isInternet reports whether ip is an address on the internet, as opposed to
+// a tailnet or private address.
+func isInternet(ip netip.Addr) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !tsaddr.IsTailscaleIP(ip)
+}
+
+// SSHDecision is the result of evaluating an SSH access query.
+type SSHDecision struct {
+	// Action is "accept" if the SSH session is permitted, "check" if it is
+	// permitted after the user re-authenticates, or "deny".
+	Action string
+	// Rule names the SSH rule that determined Action, such as "ssh[1]". It
+	// is empty if Action is "deny".
+	Rule string
+}
+
+// CheckSSH reports whether src may start an SSH session on dst as the given
+// local user. The first matching SSH rule determines the result.
+func (p *Policy) CheckSSH(src, dst Node, user string) SSHDecision {
+	for i, r := range p.SSH {
+		if !slices.ContainsFunc(r.Src, func(s string) bool { return p.match(s, src, nil) }) {
+			continue
+		}
+		if !slices.ContainsFunc(r.Dst, func(s string) bool { return p.match(s, dst, &src) }) {
+			continue
+		}
+		if slices.ContainsFunc(r.Users, func(u string) bool { return matchSSHUser(u, src, user) }) {
+			return SSHDecision{Action: r.Action, Rule: fmt.Sprintf("ssh[%d]", i)}
+		}
+	}
+	return SSHDecision{Action: "deny"}
+}
+
+// matchSSHUser reports whether the entry want of an SSH rule's users permits
+// src to log in as the local user.
+func matchSSHUser(want string, src Node, user string) bool {
+	switch {
+	case want == "autogroup:nonroot":
+		return user != "root"
+	case strings.HasPrefix(want, "localpart:"):
+		// localpart:*@example.com permits users of example.com to log in
+		// as the local part of their login name.
+		domain, ok := strings.CutPrefix(strings.TrimPrefix(want, "localpart:"), "*@")
+		if !ok || src.User == "" || len(src.Tags) > 0 {
+			return false
+		}
+		local, srcDomain, ok := strings.Cut(src.User, "@")
+		return ok && strings.EqualFold(srcDomain, domain) && local == user
+	}
+	return want == user
+}
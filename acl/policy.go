@@ -0,0 +1,390 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package acl parses tailnet policy files and evaluates access queries
+// against them offline.
+//
+// It supports the subset of the policy file syntax that determines network
+// and SSH access between devices: groups, hosts, tag owners, ACLs, grants of
+// IP access, SSH rules, and the tests and sshTests sections. Other sections,
+// such as nodeAttrs or postures, are ignored. Selectors that depend on state
+// only known to the control plane, such as autogroup:admin, are rejected.
+//
+// The evaluation is meant to help policy authors test changes before
+// applying them; the control plane remains the authority on what a policy
+// permits.
+package acl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/tailscale/hujson"
+	"tailscale.com/types/ipproto"
+)
+
+// Policy is a parsed tailnet policy file. Use Parse to create one.
+type Policy struct {
+	Groups    map[string][]string `json:"groups,omitempty"`
+	Hosts     map[string]string   `json:"hosts,omitempty"`
+	TagOwners map[string][]string `json:"tagOwners,omitempty"`
+	ACLs      []ACL               `json:"acls,omitempty"`
+	Grants    []Grant             `json:"grants,omitempty"`
+	SSH       []SSHRule           `json:"ssh,omitempty"`
+	Tests     []Test              `json:"tests,omitempty"`
+	SSHTests  []SSHTest           `json:"sshTests,omitempty"`
+
+	hosts map[string]netip.Prefix // Hosts, parsed
+	rules []netRule               // ACLs and Grants, in evaluation order
+}
+
+// ACL is an entry of the acls section of a policy file.
+type ACL struct {
+	Action string   `json:"action"`          // must be "accept"
+	Src    []string `json:"src,omitempty"`   // selectors
+	Users  []string `json:"users,omitempty"` // legacy name for Src
+	Proto  string   `json:"proto,omitempty"` // IP protocol; empty means TCP, UDP and ICMP
+	Dst    []string `json:"dst,omitempty"`   // "selector:ports"
+	Ports  []string `json:"ports,omitempty"` // legacy name for Dst
+}
+
+// Grant is an entry of the grants section of a policy file. Only IP grants
+// are evaluated; grants of application capabilities do not permit network
+// access and are ignored.
+type Grant struct {
+	Src []string `json:"src"`          // selectors
+	Dst []string `json:"dst"`          // selectors
+	IP  []string `json:"ip,omitempty"` // "*", "ports" or "proto:ports"
+}
+
+// SSHRule is an entry of the ssh section of a policy file.
+type SSHRule struct {
+	Action      string   `json:"action"` // "accept" or "check"
+	Src         []string `json:"src"`    // selectors
+	Dst         []string `json:"dst"`    // selectors
+	Users       []string `json:"users"`  // SSH users to permit
+	CheckPeriod string   `json:"checkPeriod,omitempty"`
+}
+
+// Test is an entry of the tests section of a policy file.
+type Test struct {
+	Src    string   `json:"src"`
+	User   string   `json:"user,omitempty"`  // legacy name for Src
+	Proto  string   `json:"proto,omitempty"` // empty means TCP
+	Accept []string `json:"accept,omitempty"`
+	Allow  []string `json:"allow,omitempty"` // legacy name for Accept
+	Deny   []string `json:"deny,omitempty"`
+}
+
+// SSHTest is an entry of the sshTests section of a policy file.
+type SSHTest struct {
+	Src    string   `json:"src"`
+	Dst    []string `json:"dst"`
+	Accept []string `json:"accept,omitempty"`
+	Check  []string `json:"check,omitempty"`
+	Deny   []string `json:"deny,omitempty"`
+}
+
+// netRule is an ACL or grant, normalized for evaluation.
+type netRule struct {
+	name string // e.g. "acls[0]", for reporting
+	src  []string
+	dst  []netDst
+}
+
+// netDst is a destination of a netRule.
+type netDst struct {
+	sel    string
+	protos []ipproto.Proto // nil means defaultProtos
+	ports  []portRange
+}
+
+// defaultProtos are the protocols that rules without an explicit protocol
+// apply to.
+var defaultProtos = []ipproto.Proto{ipproto.TCP, ipproto.UDP, ipproto.ICMPv4, ipproto.ICMPv6}
+
+type portRange struct {
+	first, last uint16
+}
+
+var allPorts = []portRange{{0, 65535}}
+
+// Parse parses a policy file in HuJSON format and validates the parts of it
+// that this package evaluates.
+func Parse(b []byte) (*Policy, error) {
+	b, err := hujson.Standardize(b)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing policy: %w", err)
+	}
+	p := new(Policy)
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("error parsing policy: %w", err)
+	}
+	if err := p.init(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Policy) init() error {
+	var errs []error
+	addErr := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	p.hosts = make(map[string]netip.Prefix, len(p.Hosts))
+	for name, v := range p.Hosts {
+		if name == "" || strings.ContainsAny(name, ":@,") {
+			addErr("hosts: invalid host name %q", name)
+			continue
+		}
+		pfx, err := parsePrefixOrAddr(v)
+		if err != nil {
+			addErr("hosts[%q]: %v", name, err)
+			continue
+		}
+		p.hosts[name] = pfx
+	}
+	for name, members := range p.Groups {
+		if !strings.HasPrefix(name, "group:") {
+			addErr("groups: group name %q does not start with \"group:\"", name)
+		}
+		for _, m := range members {
+			if !strings.Contains(m, "@") {
+				addErr("groups[%q]: member %q is not a user", name, m)
+			}
+		}
+	}
+	for name := range p.TagOwners {
+		if err := validTag(name); err != nil {
+			addErr("tagOwners: %v", err)
+		}
+	}
+
+	for i, a := range p.ACLs {
+		r := netRule{name: fmt.Sprintf("acls[%d]", i)}
+		if a.Action != "accept" {
+			addErr("%s: action %q is not supported, only \"accept\" is", r.name, a.Action)
+		}
+		var protos []ipproto.Proto
+		if a.Proto != "" {
+			var proto ipproto.Proto
+			if err := proto.UnmarshalText([]byte(a.Proto)); err != nil {
+				addErr("%s: %v", r.name, err)
+			}
+			protos = []ipproto.Proto{proto}
+		}
+		r.src = append(append(r.src, a.Src...), a.Users...)
+		for _, s := range r.src {
+			if err := p.validSelector(s, false); err != nil {
+				addErr("%s: src: %v", r.name, err)
+			}
+		}
+		for _, d := range append(append([]string(nil), a.Dst...), a.Ports...) {
+			sel, ports, err := splitSelectorPorts(d)
+			if err != nil {
+				addErr("%s: dst: %v", r.name, err)
+				continue
+			}
+			if err := p.validSelector(sel, true); err != nil {
+				addErr("%s: dst: %v", r.name, err)
+			}
+			pr, err := parsePorts(ports)
+			if err != nil {
+				addErr("%s: dst %q: %v", r.name, d, err)
+			}
+			r.dst = append(r.dst, netDst{sel: sel, protos: protos, ports: pr})
+		}
+		p.rules = append(p.rules, r)
+	}
+
+	for i, g := range p.Grants {
+		r := netRule{name: fmt.Sprintf("grants[%d]", i), src: g.Src}
+		for _, s := range g.Src {
+			if err := p.validSelector(s, false); err != nil {
+				addErr("%s: src: %v", r.name, err)
+			}
+		}
+		for _, d := range g.Dst {
+			if err := p.validSelector(d, true); err != nil {
+				addErr("%s: dst: %v", r.name, err)
+			}
+			for _, ip := range g.IP {
+				protos, ports, err := parseGrantIP(ip)
+				if err != nil {
+					addErr("%s: ip %q: %v", r.name, ip, err)
+					continue
+				}
+				r.dst = append(r.dst, netDst{sel: d, protos: protos, ports: ports})
+			}
+		}
+		p.rules = append(p.rules, r)
+	}
+
+	for i, r := range p.SSH {
+		name := fmt.Sprintf("ssh[%d]", i)
+		if r.Action != "accept" && r.Action != "check" {
+			addErr("%s: action %q is not supported, must be \"accept\" or \"check\"", name, r.Action)
+		}
+		for _, s := range r.Src {
+			if err := p.validSelector(s, false); err != nil {
+				addErr("%s: src: %v", name, err)
+			}
+		}
+		for _, d := range r.Dst {
+			if err := p.validSelector(d, true); err != nil {
+				addErr("%s: dst: %v", name, err)
+			}
+		}
+		if len(r.Users) == 0 {
+			addErr("%s: no users", name)
+		}
+		for _, u := range r.Users {
+			if strings.HasPrefix(u, "autogroup:") && u != "autogroup:nonroot" {
+				addErr("%s: users: %q is not supported", name, u)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validSelector reports whether sel is a selector that the policy can
+// evaluate. dst is whether sel appears in the destination of a rule, which
+// permits autogroup:self and autogroup:internet.
+func (p *Policy) validSelector(sel string, dst bool) error {
+	switch {
+	case sel == "*":
+		return nil
+	case strings.HasPrefix(sel, "group:"):
+		if _, ok := p.Groups[sel]; !ok {
+			return fmt.Errorf("group %q is not defined", sel)
+		}
+		return nil
+	case strings.HasPrefix(sel, "tag:"):
+		return p.definedTag(sel)
+	case strings.HasPrefix(sel, "autogroup:"):
+		switch sel {
+		case "autogroup:member", "autogroup:tagged":
+			return nil
+		case "autogroup:self", "autogroup:internet":
+			if dst {
+				return nil
+			}
+			return fmt.Errorf("%s can only be used as a destination", sel)
+		}
+		return fmt.Errorf("%s is not supported", sel)
+	case strings.Contains(sel, "@"):
+		return nil
+	}
+	if _, ok := p.hosts[sel]; ok {
+		return nil
+	}
+	if _, err := parsePrefixOrAddr(sel); err != nil {
+		return fmt.Errorf("invalid selector %q: not a user, group, tag, autogroup, host or IP", sel)
+	}
+	return nil
+}
+
+func validTag(tag string) error {
+	name, ok := strings.CutPrefix(tag, "tag:")
+	if !ok || name == "" || strings.ContainsAny(name, ":,@ ") {
+		return fmt.Errorf("invalid tag %q", tag)
+	}
+	return nil
+}
+
+// definedTag returns an error if tag is invalid or not defined in the
+// tagOwners section.
+func (p *Policy) definedTag(tag string) error {
+	if err := validTag(tag); err != nil {
+		return err
+	}
+	if _, ok := p.TagOwners[tag]; !ok {
+		return fmt.Errorf("tag %q is not defined in tagOwners", tag)
+	}
+	return nil
+}
+
+func parsePrefixOrAddr(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		pfx, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return pfx.Masked(), nil
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// splitSelectorPorts splits a destination of the form "selector:ports" into
+// its selector and ports. IPv6 addresses may be written either bracketed, as
+// in "[fd7a:115c:a1e0::1]:22", or not, as the ports always follow the last
+// colon.
+func splitSelectorPorts(s string) (sel, ports string, err error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return "", "", fmt.Errorf("destination %q is missing ports", s)
+	}
+	sel, ports = s[:i], s[i+1:]
+	if strings.HasPrefix(sel, "[") && strings.HasSuffix(sel, "]") {
+		sel = sel[1 : len(sel)-1]
+	}
+	if sel == "" || ports == "" {
+		return "", "", fmt.Errorf("invalid destination %q", s)
+	}
+	return sel, ports, nil
+}
+
+// parsePorts parses a comma-separated list of ports and port ranges, or "*"
+// for all ports.
+func parsePorts(s string) ([]portRange, error) {
+	if s == "*" {
+		return allPorts, nil
+	}
+	var prs []portRange
+	for _, f := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(f, "-")
+		first, err := strconv.ParseUint(lo, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", f)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.ParseUint(hi, 10, 16); err != nil || last < first {
+				return nil, fmt.Errorf("invalid port range %q", f)
+			}
+		}
+		prs = append(prs, portRange{uint16(first), uint16(last)})
+	}
+	return prs, nil
+}
+
+// parseGrantIP parses an entry of a grant's ip field: "*" for all protocols
+// and ports, a list of ports as accepted by parsePorts, or "proto:ports".
+func parseGrantIP(s string) ([]ipproto.Proto, []portRange, error) {
+	if s == "*" {
+		return nil, allPorts, nil
+	}
+	var protos []ipproto.Proto
+	ports := s
+	if name, rest, ok := strings.Cut(s, ":"); ok {
+		var proto ipproto.Proto
+		if err := proto.UnmarshalText([]byte(name)); err != nil {
+			return nil, nil, err
+		}
+		protos, ports = []ipproto.Proto{proto}, rest
+	}
+	prs, err := parsePorts(ports)
+	if err != nil {
+		return nil, nil, err
+	}
+	return protos, prs, nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package acl
+
+import (
+	"fmt"
+	"strconv"
+
+	"tailscale.com/types/ipproto"
+)
+
+// RunTests runs the tests and sshTests of the policy and returns an error
+// for each assertion that fails, or that cannot be evaluated.
+func (p *Policy) RunTests() []error {
+	var errs []error
+	for i, t := range p.Tests {
+		name := fmt.Sprintf("tests[%d]", i)
+		fail := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+		}
+		srcStr := t.Src
+		if srcStr == "" {
+			srcStr = t.User
+		}
+		src, err := p.ParseNode(srcStr)
+		if err != nil {
+			fail("src: %v", err)
+			continue
+		}
+		proto := ipproto.TCP
+		if t.Proto != "" {
+			if err := proto.UnmarshalText([]byte(t.Proto)); err != nil {
+				fail("%v", err)
+				continue
+			}
+		}
+		check := func(dstStr string, wantAllow bool) {
+			dst, port, err := p.ParseDestination(dstStr)
+			if err != nil {
+				fail("%v", err)
+				return
+			}
+			got := p.Check(src, dst, proto, port)
+			if got.Allow == wantAllow {
+				return
+			}
+			if wantAllow {
+				fail("%s -> %s: got deny, want accept", srcStr, dstStr)
+			} else {
+				fail("%s -> %s: got accept by %s, want deny", srcStr, dstStr, got.Rule)
+			}
+		}
+		for _, d := range append(append([]string(nil), t.Accept...), t.Allow...) {
+			check(d, true)
+		}
+		for _, d := range t.Deny {
+			check(d, false)
+		}
+	}
+
+	for i, t := range p.SSHTests {
+		name := fmt.Sprintf("sshTests[%d]", i)
+		fail := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+		}
+		src, err := p.ParseNode(t.Src)
+		if err != nil {
+			fail("src: %v", err)
+			continue
+		}
+		for _, dstStr := range t.Dst {
+			dst, err := p.ParseNode(dstStr)
+			if err != nil {
+				fail("dst: %v", err)
+				continue
+			}
+			for _, want := range []struct {
+				action string
+				users  []string
+			}{
+				{"accept", t.Accept},
+				{"check", t.Check},
+				{"deny", t.Deny},
+			} {
+				for _, u := range want.users {
+					if got := p.CheckSSH(src, dst, u); got.Action != want.action {
+						fail("%s -> %s@%s: got %s, want %s", t.Src, u, dstStr, got.Action, want.action)
+					}
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// ParseDestination parses a destination of a test, of the form "device:port",
+// where device is in a format accepted by ParseNode.
+func (p *Policy) ParseDestination(s string) (Node, uint16, error) {
+	host, portStr, err := splitSelectorPorts(s)
+	if err != nil {
+		return Node{}, 0, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return Node{}, 0, fmt.Errorf("invalid port in destination %q", s)
+	}
+	n, err := p.ParseNode(host)
+	if err != nil {
+		return Node{}, 0, err
+	}
+	return n, uint16(port), nil
+}
@@ -13,9 +13,11 @@
 	"context"
 	"fmt"
 	"net/netip"
+	"regexp"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	xmaps "golang.org/x/exp/maps"
@@ -127,8 +129,61 @@ type RouteInfo struct {
 	// Wildcards are the configured DNS lookup domains to observe. When a DNS query matches Wildcards,
 	// its result is added to Domains.
 	Wildcards []string `json:",omitempty"`
+	// Patterns are the configured glob and regular expression domain
+	// patterns to observe, as supplied to UpdateDomains. When a DNS query
+	// matches Patterns, its result is added to Domains.
+	Patterns []string `json:",omitempty"`
+	// LastSeen records when each address in Domains was last observed in a
+	// DNS response, for domains with a route TTL, so that the addresses
+	// expire on time across restarts.
+	LastSeen map[string]map[netip.Addr]time.Time `json:",omitempty"`
 }
 
+// routeExpirySweepInterval is how often the addresses of domains with a route
+// TTL are checked for expiry, in addition to whenever the domain is looked up,
+// so that routes of domains that are no longer looked up expire too. It is
+// also the most often lastSeen is persisted for such domains.
+const routeExpirySweepInterval = 5 * time.Minute
+
+// domainPattern is a configured domain that matches a set of domain names
+// other than all subdomains of a domain. It is either a glob such as
+// "api-*.example.com", in which each '*' matches any run of characters within
+// a single label, or a regular expression between slashes such as
+// "/[a-z]+[0-9]\.cdn\.example\.com/". Either way, the pattern must match
+// the whole, lower case, domain name without a trailing dot.
+type domainPattern struct {
+	src string // as supplied to UpdateDomains
+	re  *regexp.Regexp
+}
+
+// isRegexpDomainPattern reports whether d is a regular expression domain
+// pattern.
+func isRegexpDomainPattern(d string) bool {
+	return len(d) > 2 && strings.HasPrefix(d, "/") && strings.HasSuffix(d, "/")
+}
+
+// isDomainPattern reports whether d is a domain pattern rather than a domain
+// name or a "*." wildcard.
+func isDomainPattern(d string) bool {
+	return isRegexpDomainPattern(d) || strings.Contains(strings.TrimPrefix(d, "*."), "*")
+}
+
+func parseDomainPattern(src string) (*domainPattern, error) {
+	var expr string
+	if isRegexpDomainPattern(src) {
+		expr = src[1 : len(src)-1]
+	} else {
+		expr = strings.ReplaceAll(regexp.QuoteMeta(src), `\*`, `[^.]*`)
+	}
+	re, err := regexp.Compile(`^(?:` + expr + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid domain pattern %q: %w", src, err)
+	}
+	return &domainPattern{src: src, re: re}, nil
+}
+
+func (p *domainPattern) String() string { return p.src }
+
 // AppConnector is an implementation of an AppConnector that performs
 // its function as a subsystem inside of a tailscale node. At the control plane
 // side App Connector routing is configured in terms of domains rather than IP
@@ -158,11 +213,36 @@ type AppConnector struct {
 	// wildcards is the list of domain strings that match subdomains.
 	wildcards []string
 
+	// patterns is the list of configured domain patterns.
+	patterns []*domainPattern
+
+	// routeTTLs maps configured domains, wildcards and patterns, as supplied
+	// to UpdateDomains, to how long an address learned for a matching domain
+	// is kept once DNS responses for the domain stop including it. Addresses
+	// of domains without a TTL are kept for as long as the domain is
+	// configured.
+	routeTTLs map[string]time.Duration
+
+	// lastSeen records when each address of a routed domain with a route TTL
+	// was last observed in a DNS response. Addresses without an entry, such
+	// as those restored from a RouteInfo stored before lastSeen was, count as
+	// seen when they are first considered for expiry.
+	lastSeen map[string]map[netip.Addr]time.Time
+
+	// lastSeenDirty is whether lastSeen changed since routes were last
+	// stored.
+	lastSeenDirty bool
+
+	now func() time.Time // for tests
+
 	// queue provides ordering for update operations
 	queue execqueue.ExecQueue
 
 	writeRateMinute *rateLogger
 	writeRateDay    *rateLogger
+
+	sweepTimer *time.Timer // runs sweepExpiredRoutes
+	closed     atomic.Bool
 }
 
 // NewAppConnector creates a new AppConnector.
@@ -171,11 +251,18 @@ func NewAppConnector(logf logger.Logf, routeAdvertiser RouteAdvertiser, routeInf
 		logf:            logger.WithPrefix(logf, "appc: "),
 		routeAdvertiser: routeAdvertiser,
 		storeRoutesFunc: storeRoutesFunc,
+		now:             time.Now,
 	}
 	if routeInfo != nil {
 		ac.domains = routeInfo.Domains
 		ac.wildcards = routeInfo.Wildcards
 		ac.controlRoutes = routeInfo.Control
+		ac.lastSeen = routeInfo.LastSeen
+		for _, src := range routeInfo.Patterns {
+			if p, err := parseDomainPattern(src); err == nil {
+				ac.patterns = append(ac.patterns, p)
+			}
+		}
 	}
 	ac.writeRateMinute = newRateLogger(time.Now, time.Minute, func(c int64, s time.Time, l int64) {
 		ac.logf("routeInfo write rate: %d in minute starting at %v (%d routes)", c, s, l)
@@ -184,9 +271,25 @@ func NewAppConnector(logf logger.Logf, routeAdvertiser RouteAdvertiser, routeInf
 	ac.writeRateDay = newRateLogger(time.Now, 24*time.Hour, func(c int64, s time.Time, l int64) {
 		ac.logf("routeInfo write rate: %d in 24 hours starting at %v (%d routes)", c, s, l)
 	})
+	ac.sweepTimer = time.AfterFunc(routeExpirySweepInterval, func() {
+		ac.queue.Add(ac.sweepExpiredRoutes)
+		if !ac.closed.Load() {
+			ac.sweepTimer.Reset(routeExpirySweepInterval)
+		}
+	})
 	return ac
 }
 
+// Close stops the periodic expiry of routes. It must be called once the
+// AppConnector is no longer used, so that it stops changing the routes of its
+// RouteAdvertiser.
+func (e *AppConnector) Close() {
+	if e.closed.Swap(true) {
+		return
+	}
+	e.sweepTimer.Stop()
+}
+
 // ShouldStoreRoutes returns true if the appconnector was created with the controlknob on
 // and is storing its discovered routes persistently.
 func (e *AppConnector) ShouldStoreRoutes() bool {
@@ -207,10 +310,17 @@ func (e *AppConnector) storeRoutesLocked() error {
 	e.writeRateMinute.update(numRoutes)
 	e.writeRateDay.update(numRoutes)
 
+	var patterns []string
+	for _, p := range e.patterns {
+		patterns = append(patterns, p.src)
+	}
+	e.lastSeenDirty = false
 	return e.storeRoutesFunc(&RouteInfo{
 		Control:   e.controlRoutes,
 		Domains:   e.domains,
 		Wildcards: e.wildcards,
+		Patterns:  patterns,
+		LastSeen:  e.lastSeen,
 	})
 }
 
@@ -221,6 +331,8 @@ func (e *AppConnector) ClearRoutes() error {
 	e.controlRoutes = nil
 	e.domains = nil
 	e.wildcards = nil
+	e.patterns = nil
+	e.lastSeen = nil
 	return e.storeRoutesLocked()
 }
 
@@ -237,13 +349,34 @@ func (e *AppConnector) UpdateDomainsAndRoutes(domains []string, routes []netip.P
 // UpdateDomains asynchronously replaces the current set of configured domains
 // with the supplied set of domains. Domains must not contain a trailing dot,
 // and should be lower case. If the domain contains a leading '*' label it
-// matches all subdomains of a domain.
+// matches all subdomains of a domain. Domains may also be globs such as
+// "api-*.example.com", in which each '*' matches within a single label, or
+// regular expressions between slashes, which must match the whole domain.
 func (e *AppConnector) UpdateDomains(domains []string) {
 	e.queue.Add(func() {
 		e.updateDomains(domains)
 	})
 }
 
+// UpdateRouteTTLs asynchronously replaces the current set of route TTLs. The
+// keys of ttls are configured domains, wildcards or patterns as supplied to
+// UpdateDomains. An address learned for a domain matching a key is expired,
+// and its route unadvertised, once DNS responses for the domain have not
+// included it for the TTL, unless it is still routed for another reason.
+func (e *AppConnector) UpdateRouteTTLs(ttls map[string]time.Duration) {
+	e.queue.Add(func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.routeTTLs = make(map[string]time.Duration, len(ttls))
+		for d, ttl := range ttls {
+			if !isRegexpDomainPattern(d) {
+				d = strings.ToLower(d)
+			}
+			e.routeTTLs[d] = ttl
+		}
+	})
+}
+
 // Wait waits for the currently scheduled asynchronous configuration changes to
 // complete.
 func (e *AppConnector) Wait(ctx context.Context) {
@@ -257,11 +390,25 @@ func (e *AppConnector) updateDomains(domains []string) {
 	var oldDomains map[string][]netip.Addr
 	oldDomains, e.domains = e.domains, make(map[string][]netip.Addr, len(domains))
 	e.wildcards = e.wildcards[:0]
+	e.patterns = e.patterns[:0]
 	for _, d := range domains {
-		d = strings.ToLower(d)
+		if !isRegexpDomainPattern(d) {
+			// Regular expressions aren't lower cased, as that would
+			// change the meaning of escapes such as \D.
+			d = strings.ToLower(d)
+		}
 		if len(d) == 0 {
 			continue
 		}
+		if isDomainPattern(d) {
+			p, err := parseDomainPattern(d)
+			if err != nil {
+				e.logf("ignoring domain: %v", err)
+				continue
+			}
+			e.patterns = append(e.patterns, p)
+			continue
+		}
 		if strings.HasPrefix(d, "*.") {
 			e.wildcards = append(e.wildcards, d[2:])
 			continue
@@ -270,16 +417,17 @@ func (e *AppConnector) updateDomains(domains []string) {
 		delete(oldDomains, d)
 	}
 
-	// Ensure that still-live wildcards addresses are preserved as well.
+	// Ensure that still-live wildcards and patterns addresses are preserved
+	// as well.
 	for d, addrs := range oldDomains {
-		for _, wc := range e.wildcards {
-			if dnsname.HasSuffix(d, wc) {
-				e.domains[d] = addrs
-				delete(oldDomains, d)
-				break
-			}
+		if e.matchesWildcardOrPatternLocked(d) {
+			e.domains[d] = addrs
+			delete(oldDomains, d)
 		}
 	}
+	for d := range oldDomains {
+		delete(e.lastSeen, d)
+	}
 
 	// Everything left in oldDomains is a domain we're no longer tracking
 	// and if we are storing route info we can unadvertise the routes
@@ -295,7 +443,24 @@ func (e *AppConnector) updateDomains(domains []string) {
 		}
 	}
 
-	e.logf("handling domains: %v and wildcards: %v", xmaps.Keys(e.domains), e.wildcards)
+	e.logf("handling domains: %v and wildcards: %v and patterns: %v", xmaps.Keys(e.domains), e.wildcards, e.patterns)
+}
+
+// matchesWildcardOrPatternLocked reports whether domain is matched by one of
+// the configured wildcards or patterns.
+// e.mu must be held.
+func (e *AppConnector) matchesWildcardOrPatternLocked(domain string) bool {
+	for _, wc := range e.wildcards {
+		if dnsname.HasSuffix(domain, wc) {
+			return true
+		}
+	}
+	for _, p := range e.patterns {
+		if p.re.MatchString(domain) {
+			return true
+		}
+	}
+	return false
 }
 
 // updateRoutes merges the supplied routes into the currently configured routes. The routes supplied
@@ -464,6 +629,7 @@ func (e *AppConnector) ObserveDNSResponse(res []byte) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	now := e.now()
 	for domain, addrs := range addressRecords {
 		domain, isRouted := e.findRoutedDomainLocked(domain, cnameChain)
 
@@ -472,6 +638,16 @@ func (e *AppConnector) ObserveDNSResponse(res []byte) {
 			continue
 		}
 
+		if ttl := e.routeTTLLocked(domain); ttl > 0 {
+			e.markSeenLocked(domain, addrs, now)
+			has4 := slices.ContainsFunc(addrs, netip.Addr.Is4)
+			has6 := slices.ContainsFunc(addrs, netip.Addr.Is6)
+			if expired := e.expireAddrsLocked(domain, has4, has6, now, ttl); len(expired) > 0 {
+				e.logf("[v2] expired routes for %s: %s", domain, expired)
+				e.scheduleUnadvertisement(domain, expired...)
+			}
+		}
+
 		// advertise each address we have learned for the routed domain, that
 		// was not already known.
 		var toAdvertise []netip.Prefix
@@ -501,13 +677,11 @@ func (e *AppConnector) findRoutedDomainLocked(domain string, cnameChain map[stri
 			break
 		}
 
-		// match wildcard domains
-		for _, wc := range e.wildcards {
-			if dnsname.HasSuffix(domain, wc) {
-				e.domains[domain] = nil
-				isRouted = true
-				break
-			}
+		// match wildcard domains and patterns
+		if e.matchesWildcardOrPatternLocked(domain) {
+			e.domains[domain] = nil
+			isRouted = true
+			break
 		}
 
 		next, ok := cnameChain[domain]
@@ -565,6 +739,147 @@ func (e *AppConnector) scheduleAdvertisement(domain string, routes ...netip.Pref
 	})
 }
 
+// scheduleUnadvertisement schedules the removal of the advertisement of the
+// given routes, which were expired from domain.
+func (e *AppConnector) scheduleUnadvertisement(domain string, routes ...netip.Prefix) {
+	e.queue.Add(func() {
+		if err := e.routeAdvertiser.UnadvertiseRoute(routes...); err != nil {
+			e.logf("failed to unadvertise expired routes for %s: %v: %v", domain, routes, err)
+			return
+		}
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if err := e.storeRoutesLocked(); err != nil {
+			e.logf("failed to store route info: %v", err)
+		}
+	})
+}
+
+// sweepExpiredRoutes expires the addresses of all domains with a route TTL
+// that haven't been seen in a DNS response for the TTL, so that the routes of
+// domains that are no longer looked up expire too, and persists lastSeen if
+// it changed.
+func (e *AppConnector) sweepExpiredRoutes() {
+	if e.closed.Load() {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	for domain := range e.domains {
+		ttl := e.routeTTLLocked(domain)
+		if ttl == 0 {
+			continue
+		}
+		if expired := e.expireAddrsLocked(domain, true, true, now, ttl); len(expired) > 0 {
+			e.logf("[v2] expired routes for %s: %s", domain, expired)
+			e.scheduleUnadvertisement(domain, expired...)
+		}
+	}
+	if e.lastSeenDirty {
+		if err := e.storeRoutesLocked(); err != nil {
+			e.logf("failed to store route info: %v", err)
+		}
+	}
+}
+
+// routeTTLLocked returns the route TTL for domain, or 0 if its routes don't
+// expire. A TTL configured for the domain itself takes precedence over those
+// of matching patterns, which take precedence over those of matching
+// wildcards.
+// e.mu must be held.
+func (e *AppConnector) routeTTLLocked(domain string) time.Duration {
+	if len(e.routeTTLs) == 0 {
+		return 0
+	}
+	if ttl, ok := e.routeTTLs[domain]; ok {
+		return ttl
+	}
+	for _, p := range e.patterns {
+		if ttl, ok := e.routeTTLs[p.src]; ok && p.re.MatchString(domain) {
+			return ttl
+		}
+	}
+	for _, wc := range e.wildcards {
+		if ttl, ok := e.routeTTLs["*."+wc]; ok && dnsname.HasSuffix(domain, wc) {
+			return ttl
+		}
+	}
+	return 0
+}
+
+// markSeenLocked records that addrs were seen in a DNS response for domain at
+// now.
+// e.mu must be held.
+func (e *AppConnector) markSeenLocked(domain string, addrs []netip.Addr, now time.Time) {
+	lastSeen := e.lastSeen[domain]
+	if lastSeen == nil {
+		lastSeen = make(map[netip.Addr]time.Time)
+		mak.Set(&e.lastSeen, domain, lastSeen)
+	}
+	for _, a := range addrs {
+		lastSeen[a] = now
+	}
+	e.lastSeenDirty = true
+}
+
+// expireAddrsLocked removes the addresses of domain that haven't been seen in
+// a DNS response for ttl as of now. Only IPv4 addresses are considered if
+// has4, and IPv6 ones if has6, as A and AAAA records are looked up
+// separately: a response with only one family says nothing about the other.
+// It returns the routes that should be unadvertised as a result: those of the
+// expired addresses that are neither covered by a control route nor known for
+// another domain.
+// e.mu must be held.
+func (e *AppConnector) expireAddrsLocked(domain string, has4, has6 bool, now time.Time, ttl time.Duration) []netip.Prefix {
+	lastSeen := e.lastSeen[domain]
+	if lastSeen == nil {
+		lastSeen = make(map[netip.Addr]time.Time)
+		mak.Set(&e.lastSeen, domain, lastSeen)
+	}
+
+	var expired []netip.Prefix
+	var kept []netip.Addr
+	for _, a := range e.domains[domain] {
+		seen, ok := lastSeen[a]
+		if !ok {
+			lastSeen[a] = now
+			seen = now
+			e.lastSeenDirty = true
+		}
+		if (a.Is4() && !has4) || (a.Is6() && !has6) || now.Sub(seen) < ttl {
+			kept = append(kept, a)
+			continue
+		}
+		delete(lastSeen, a)
+		e.lastSeenDirty = true
+		if !e.isAddrRoutedElsewhereLocked(domain, a) {
+			expired = append(expired, netip.PrefixFrom(a, a.BitLen()))
+		}
+	}
+	if len(kept) != len(e.domains[domain]) {
+		e.domains[domain] = kept
+	}
+	return expired
+}
+
+// isAddrRoutedElsewhereLocked reports whether addr is covered by a control
+// route or known for a domain other than domain.
+// e.mu must be held.
+func (e *AppConnector) isAddrRoutedElsewhereLocked(domain string, addr netip.Addr) bool {
+	for _, route := range e.controlRoutes {
+		if route.Contains(addr) {
+			return true
+		}
+	}
+	for d := range e.domains {
+		if d != domain && e.hasDomainAddrLocked(d, addr) {
+			return true
+		}
+	}
+	return false
+}
+
 // hasDomainAddrLocked returns true if the address has been observed in a
 // resolution of domain.
 func (e *AppConnector) hasDomainAddrLocked(domain string, addr netip.Addr) bool {
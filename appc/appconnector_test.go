@@ -255,6 +255,169 @@ func TestWildcardDomains(t *testing.T) {
 	}
 }
 
+func TestPatternDomains(t *testing.T) {
+	for _, shouldStore := range []bool{false, true} {
+		ctx := context.Background()
+		rc := &appctest.RouteCollector{}
+		var a *AppConnector
+		if shouldStore {
+			a = NewAppConnector(t.Logf, rc, &RouteInfo{}, fakeStoreRoutes)
+		} else {
+			a = NewAppConnector(t.Logf, rc, nil, nil)
+		}
+
+		a.updateDomains([]string{"API-*.example.com", `/edge[0-9]+\.cdn\.example\.net/`, "/[invalid/"})
+		if got, want := len(a.patterns), 2; got != want {
+			t.Fatalf("got %d patterns, want %d: %v", got, want, a.patterns)
+		}
+		for _, d := range []string{"api-eu.example.com", "edge12.cdn.example.net"} {
+			a.ObserveDNSResponse(dnsResponse(d+".", "192.0.0.8"))
+		}
+		for _, d := range []string{"x.api-eu.example.com", "api-eu.example.com.evil", "edge.cdn.example.net", "xedge1.cdn.example.net"} {
+			a.ObserveDNSResponse(dnsResponse(d+".", "192.0.0.9"))
+		}
+		a.Wait(ctx)
+		if got, want := slices.Compact(rc.Routes()), prefixes("192.0.0.8/32"); !slices.Equal(got, want) {
+			t.Errorf("routes: got %v; want %v", got, want)
+		}
+		got := xmaps.Keys(a.domains)
+		slices.Sort(got)
+		if want := []string{"api-eu.example.com", "edge12.cdn.example.net"}; !slices.Equal(got, want) {
+			t.Errorf("domains: got %v; want %v", got, want)
+		}
+
+		// Domains learned from a still-configured pattern are preserved.
+		a.updateDomains([]string{"api-*.example.com"})
+		if _, ok := a.domains["api-eu.example.com"]; !ok {
+			t.Errorf("expected api-eu.example.com to be preserved in domains due to pattern")
+		}
+		if _, ok := a.domains["edge12.cdn.example.net"]; ok {
+			t.Errorf("expected edge12.cdn.example.net to be removed from domains")
+		}
+	}
+}
+
+func TestRouteTTL(t *testing.T) {
+	for _, shouldStore := range []bool{false, true} {
+		ctx := context.Background()
+		rc := &appctest.RouteCollector{}
+		var a *AppConnector
+		if shouldStore {
+			a = NewAppConnector(t.Logf, rc, &RouteInfo{}, fakeStoreRoutes)
+		} else {
+			a = NewAppConnector(t.Logf, rc, nil, nil)
+		}
+		now := time.Now()
+		a.now = func() time.Time { return now }
+		a.updateDomains([]string{"*.example.com", "example.org"})
+		a.UpdateRouteTTLs(map[string]time.Duration{"*.example.com": time.Hour})
+		a.Wait(ctx)
+
+		a.ObserveDNSResponse(dnsResponse("cdn.example.com.", "192.0.2.1"))
+		a.ObserveDNSResponse(dnsResponse("example.org.", "192.0.2.3"))
+		a.Wait(ctx)
+
+		// The answer changes, but the old address hasn't yet been gone
+		// for the TTL.
+		now = now.Add(30 * time.Minute)
+		a.ObserveDNSResponse(dnsResponse("cdn.example.com.", "192.0.2.2"))
+		a.ObserveDNSResponse(dnsResponse("cdn.example.com.", "2001:db8::1"))
+		a.Wait(ctx)
+		if got, want := a.DomainRoutes()["cdn.example.com"], []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2"), netip.MustParseAddr("2001:db8::1")}; !slices.Equal(got, want) {
+			t.Errorf("routes before expiry: got %v; want %v", got, want)
+		}
+
+		// 192.0.2.1 expires, but the IPv6 address doesn't, as only A
+		// records were looked up. 192.0.2.3 is also used by example.org,
+		// which has no TTL, so its route stays.
+		now = now.Add(31 * time.Minute)
+		a.ObserveDNSResponse(dnsResponse("cdn.example.com.", "192.0.2.2"))
+		a.ObserveDNSResponse(dnsResponse("other.example.com.", "192.0.2.3"))
+		a.Wait(ctx)
+		now = now.Add(2 * time.Hour)
+		a.ObserveDNSResponse(dnsResponse("other.example.com.", "192.0.2.4"))
+		a.Wait(ctx)
+		if got, want := a.DomainRoutes()["cdn.example.com"], []netip.Addr{netip.MustParseAddr("192.0.2.2"), netip.MustParseAddr("2001:db8::1")}; !slices.Equal(got, want) {
+			t.Errorf("routes after expiry: got %v; want %v", got, want)
+		}
+		if got, want := a.DomainRoutes()["other.example.com"], []netip.Addr{netip.MustParseAddr("192.0.2.4")}; !slices.Equal(got, want) {
+			t.Errorf("other.example.com routes after expiry: got %v; want %v", got, want)
+		}
+		if got, want := rc.RemovedRoutes(), prefixes("192.0.2.1/32"); !slices.Equal(got, want) {
+			t.Errorf("removed routes: got %v; want %v", got, want)
+		}
+		wantRoutes := prefixes("192.0.2.2/32", "192.0.2.3/32", "192.0.2.4/32", "2001:db8::1/128")
+		gotRoutes := rc.Routes()
+		slices.SortFunc(gotRoutes, prefixCompare)
+		gotRoutes = slices.Compact(gotRoutes)
+		if !slices.Equal(gotRoutes, wantRoutes) {
+			t.Errorf("routes: got %v; want %v", gotRoutes, wantRoutes)
+		}
+	}
+}
+
+func TestRouteTTLSweep(t *testing.T) {
+	ctx := context.Background()
+	rc := &appctest.RouteCollector{}
+	var stored *RouteInfo
+	a := NewAppConnector(t.Logf, rc, &RouteInfo{}, func(ri *RouteInfo) error {
+		stored = ri
+		return nil
+	})
+	defer a.Close()
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	a.updateDomains([]string{"*.example.com"})
+	a.UpdateRouteTTLs(map[string]time.Duration{"*.example.com": time.Hour})
+	a.Wait(ctx)
+
+	a.ObserveDNSResponse(dnsResponse("cdn.example.com.", "192.0.2.1"))
+	a.ObserveDNSResponse(dnsResponse("api.example.com.", "192.0.2.2"))
+	a.Wait(ctx)
+
+	// api.example.com is looked up again, but cdn.example.com never is.
+	now = now.Add(50 * time.Minute)
+	a.ObserveDNSResponse(dnsResponse("api.example.com.", "192.0.2.2"))
+	a.Wait(ctx)
+
+	// lastSeen is persisted by the sweep, and restored with the routes.
+	stored = nil
+	a.sweepExpiredRoutes()
+	a.Wait(ctx)
+	if stored == nil {
+		t.Fatal("lastSeen not stored")
+	}
+	if got := stored.LastSeen["api.example.com"][netip.MustParseAddr("192.0.2.2")]; !got.Equal(now) {
+		t.Errorf("stored lastSeen of api.example.com = %v; want %v", got, now)
+	}
+	a.Close()
+	a = NewAppConnector(t.Logf, rc, stored, fakeStoreRoutes)
+	defer a.Close()
+	a.now = func() time.Time { return now }
+	a.UpdateRouteTTLs(map[string]time.Duration{"*.example.com": time.Hour})
+	a.Wait(ctx)
+
+	// Nothing has been gone for the TTL yet, so a sweep keeps everything.
+	a.sweepExpiredRoutes()
+	a.Wait(ctx)
+	if got := rc.RemovedRoutes(); len(got) != 0 {
+		t.Errorf("removed routes before expiry: %v", got)
+	}
+
+	now = now.Add(20 * time.Minute)
+	a.sweepExpiredRoutes()
+	a.Wait(ctx)
+	if got, want := rc.RemovedRoutes(), prefixes("192.0.2.1/32"); !slices.Equal(got, want) {
+		t.Errorf("removed routes: got %v; want %v", got, want)
+	}
+	if got := a.DomainRoutes()["cdn.example.com"]; len(got) != 0 {
+		t.Errorf("cdn.example.com routes after expiry: %v", got)
+	}
+	if got, want := a.DomainRoutes()["api.example.com"], []netip.Addr{netip.MustParseAddr("192.0.2.2")}; !slices.Equal(got, want) {
+		t.Errorf("api.example.com routes after expiry: got %v; want %v", got, want)
+	}
+}
+
 // dnsResponse is a test helper that creates a DNS response buffer for the given domain and address
 func dnsResponse(domain, address string) []byte {
 	addr := netip.MustParseAddr(address)
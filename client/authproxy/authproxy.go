@@ -0,0 +1,422 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package authproxy is a reverse proxy that identifies its clients by their
+// Tailscale identity and passes it to the backend app in request headers,
+// for apps that support delegating authentication to a proxy, such as
+// Grafana, Kibana and Jenkins.
+//
+// Clients' groups come from grants of the tailscale.com/cap/auth-proxy
+// capability in the tailnet policy file, such as:
+//
+//	"grants": [{
+//		"src": ["group:sre"],
+//		"dst": ["tag:grafana"],
+//		"app": {"tailscale.com/cap/auth-proxy": [{"groups": ["Admin"]}]},
+//	}]
+package authproxy
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/logger"
+)
+
+// Field is a property of a client's identity that can be passed to the
+// backend in a header.
+type Field string
+
+const (
+	FieldLogin   Field = "login"   // login name, like "alice@example.com"
+	FieldUser    Field = "user"    // login name without its domain, like "alice"
+	FieldName    Field = "name"    // display name, like "Alice Smith"
+	FieldPicture Field = "picture" // profile picture URL
+	FieldTailnet Field = "tailnet" // tailnet name, empty for shared nodes
+	FieldNode    Field = "node"    // node name, like "laptop"
+	FieldGroups  Field = "groups"  // groups from auth-proxy grants
+)
+
+var fields = []Field{FieldLogin, FieldUser, FieldName, FieldPicture, FieldTailnet, FieldNode, FieldGroups}
+
+// Header maps a field of the client's identity to a request header.
+type Header struct {
+	Name  string
+	Field Field
+
+	// Sep separates the values of multi-valued fields (groups). If empty,
+	// "," is used.
+	Sep string
+}
+
+// ParseHeader parses a header mapping of the form "Name=field", or
+// "Name=groups:sep" to join groups with sep.
+func ParseHeader(s string) (Header, error) {
+	name, field, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return Header{}, fmt.Errorf("invalid header mapping %q; want Name=field", s)
+	}
+	h := Header{Name: http.CanonicalHeaderKey(name)}
+	field, h.Sep, _ = strings.Cut(field, ":")
+	h.Field = Field(strings.TrimSpace(field))
+	if !slices.Contains(fields, h.Field) {
+		return Header{}, fmt.Errorf("unknown field %q in header mapping %q; want one of %v", h.Field, s, fields)
+	}
+	return h, nil
+}
+
+// Backend types, for BackendHeaders.
+const (
+	BackendGeneric = "generic"
+	BackendGrafana = "grafana"
+	BackendKibana  = "kibana"
+	BackendJenkins = "jenkins"
+)
+
+// BackendHeaders returns the header mappings that the given type of backend
+// expects in its default proxy authentication configuration.
+func BackendHeaders(backend string) ([]Header, error) {
+	switch backend {
+	case BackendGeneric:
+		// As used by cmd/nginx-auth.
+		return []Header{
+			{Name: "Tailscale-User", Field: FieldLogin},
+			{Name: "Tailscale-Login", Field: FieldUser},
+			{Name: "Tailscale-Name", Field: FieldName},
+			{Name: "Tailscale-Profile-Picture", Field: FieldPicture},
+			{Name: "Tailscale-Tailnet", Field: FieldTailnet},
+			{Name: "Tailscale-Groups", Field: FieldGroups},
+		}, nil
+	case BackendGrafana:
+		// https://grafana.com/docs/grafana/latest/setup-grafana/configure-security/configure-authentication/auth-proxy/
+		return []Header{
+			{Name: "X-Webauth-User", Field: FieldLogin},
+			{Name: "X-Webauth-Name", Field: FieldName},
+			{Name: "X-Webauth-Groups", Field: FieldGroups},
+		}, nil
+	case BackendKibana:
+		// Elasticsearch's header-based realms, as set up by oauth2-proxy.
+		return []Header{
+			{Name: "X-Forwarded-User", Field: FieldUser},
+			{Name: "X-Forwarded-Email", Field: FieldLogin},
+			{Name: "X-Forwarded-Preferred-Username", Field: FieldName},
+			{Name: "X-Forwarded-Groups", Field: FieldGroups},
+		}, nil
+	case BackendJenkins:
+		// The Reverse Proxy Auth plugin's defaults.
+		return []Header{
+			{Name: "X-Forwarded-User", Field: FieldLogin},
+			{Name: "X-Forwarded-Groups", Field: FieldGroups, Sep: "|"},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown backend type %q; want %s, %s, %s or %s", backend, BackendGeneric, BackendGrafana, BackendKibana, BackendJenkins)
+}
+
+// Identity is the identity of a client, as passed to the backend.
+type Identity struct {
+	LoginName     string   `json:"login"`
+	DisplayName   string   `json:"name,omitempty"`
+	ProfilePicURL string   `json:"picture,omitempty"`
+	Tailnet       string   `json:"tailnet,omitempty"`
+	Node          string   `json:"node,omitempty"`
+	Groups        []string `json:"groups,omitempty"`
+}
+
+// value returns the value of h's field for id.
+func (id *Identity) value(h Header) string {
+	switch h.Field {
+	case FieldLogin:
+		return id.LoginName
+	case FieldUser:
+		user, _, _ := strings.Cut(id.LoginName, "@")
+		return user
+	case FieldName:
+		return id.DisplayName
+	case FieldPicture:
+		return id.ProfilePicURL
+	case FieldTailnet:
+		return id.Tailnet
+	case FieldNode:
+		return id.Node
+	case FieldGroups:
+		return strings.Join(id.Groups, cmp.Or(h.Sep, ","))
+	}
+	return ""
+}
+
+// capRule is a value of the tailcfg.PeerCapabilityAuthProxy capability.
+type capRule struct {
+	Groups []string `json:"groups,omitempty"`
+}
+
+// errTagged is returned by identityFromWhoIs for clients on tagged nodes.
+var errTagged = errors.New("tagged nodes have no user identity")
+
+// identityFromWhoIs returns the identity of the client described by who.
+func identityFromWhoIs(who *apitype.WhoIsResponse) (*Identity, error) {
+	if who.Node == nil {
+		return nil, errors.New("unknown node")
+	}
+	if who.Node.IsTagged() {
+		return nil, errTagged
+	}
+	if who.UserProfile == nil || who.UserProfile.LoginName == "" {
+		return nil, errors.New("unknown user")
+	}
+	rules, err := tailcfg.UnmarshalCapJSON[capRule](who.CapMap, tailcfg.PeerCapabilityAuthProxy)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s grants: %w", tailcfg.PeerCapabilityAuthProxy, err)
+	}
+	id := &Identity{
+		LoginName:     who.UserProfile.LoginName,
+		DisplayName:   who.UserProfile.DisplayName,
+		ProfilePicURL: who.UserProfile.ProfilePicURL,
+		Node:          who.Node.ComputedName,
+	}
+	// Shared nodes don't reveal their tailnet.
+	if !who.Node.Hostinfo.Valid() || !who.Node.Hostinfo.ShareeNode() {
+		if _, tailnet, ok := strings.Cut(strings.TrimSuffix(who.Node.Name, "."), "."); ok {
+			id.Tailnet = tailnet
+		}
+	}
+	for _, r := range rules {
+		id.Groups = append(id.Groups, r.Groups...)
+	}
+	slices.Sort(id.Groups)
+	id.Groups = slices.Compact(id.Groups)
+	return id, nil
+}
+
+// Config configures a Proxy.
+type Config struct {
+	// Backend is the URL of the app to proxy to.
+	Backend *url.URL
+
+	// WhoIs looks up the Tailscale identity of a client by its IP:port,
+	// typically tailscale.LocalClient.WhoIs.
+	WhoIs func(ctx context.Context, remoteAddr string) (*apitype.WhoIsResponse, error)
+
+	// Headers are the identity headers to set on requests to the backend.
+	// The proxy removes them from clients' requests, so that clients
+	// can't forge them.
+	Headers []Header
+
+	// AllowTagged is whether to proxy requests from tagged nodes, which
+	// have no user identity, without identity headers. If false, they're
+	// rejected.
+	AllowTagged bool
+
+	// AllowUnidentified is whether to proxy requests from clients that
+	// can't be identified, including tagged nodes, without identity
+	// headers, leaving it to the backend to authenticate them. If false,
+	// they're rejected.
+	AllowUnidentified bool
+
+	// Paths, if non-empty, are the only request paths on which clients are
+	// identified. Requests for other paths are proxied without identity
+	// headers. This suits backends that only use the identity to log in
+	// and then keep their own session, such as Grafana with
+	// enable_login_token, as it saves a lookup on every request.
+	Paths []string
+
+	// SessionTTL, if non-zero, is how long a client's identity is cached
+	// in a signed session cookie, bound to the client's IP address, to
+	// avoid looking it up on every request.
+	SessionTTL time.Duration
+
+	// SessionKey is the key that signs session cookies. If empty, a
+	// random key is used, so sessions don't survive restarts.
+	SessionKey []byte
+
+	// Logf, if non-nil, logs requests that fail to authenticate.
+	Logf logger.Logf
+}
+
+// SessionCookie is the name of the proxy's session cookie. It's never
+// passed to the backend.
+const SessionCookie = "tailscale-auth-proxy"
+
+// Proxy is an http.Handler that proxies requests to a backend, adding the
+// identity headers of the client.
+type Proxy struct {
+	c     Config
+	key   []byte
+	proxy *httputil.ReverseProxy
+	now   func() time.Time // for tests
+}
+
+// New returns a new Proxy for c.
+func New(c Config) (*Proxy, error) {
+	if c.Backend == nil {
+		return nil, errors.New("no backend")
+	}
+	if c.WhoIs == nil {
+		return nil, errors.New("no WhoIs func")
+	}
+	if c.Logf == nil {
+		c.Logf = logger.Discard
+	}
+	p := &Proxy{c: c, key: c.SessionKey, now: time.Now}
+	if len(p.key) == 0 {
+		p.key = make([]byte, 32)
+		rand.Read(p.key)
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(c.Backend)
+			r.Out.Host = r.In.Host
+			r.SetXForwarded()
+		},
+	}
+	return p, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "unknown client address", http.StatusBadRequest)
+		return
+	}
+	r = r.Clone(r.Context())
+	for _, h := range p.c.Headers {
+		r.Header.Del(h.Name)
+	}
+	id, fromCookie := p.sessionIdentity(r, ip.Addr())
+	removeCookie(r, SessionCookie)
+	if len(p.c.Paths) > 0 && !slices.Contains(p.c.Paths, r.URL.Path) {
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	if id == nil {
+		who, err := p.c.WhoIs(r.Context(), r.RemoteAddr)
+		if err != nil {
+			p.c.Logf("authproxy: looking up %v: %v", r.RemoteAddr, err)
+			if p.c.AllowUnidentified {
+				p.proxy.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, "failed to identify client", http.StatusUnauthorized)
+			return
+		}
+		id, err = identityFromWhoIs(who)
+		if errors.Is(err, errTagged) && (p.c.AllowTagged || p.c.AllowUnidentified) {
+			p.proxy.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			p.c.Logf("authproxy: identifying %v: %v", r.RemoteAddr, err)
+			if p.c.AllowUnidentified {
+				p.proxy.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, "failed to identify user: "+err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	if !fromCookie && p.c.SessionTTL > 0 {
+		http.SetCookie(w, &http.Cookie{
+			Name:     SessionCookie,
+			Value:    p.newSession(id, ip.Addr()),
+			Path:     "/",
+			MaxAge:   int(p.c.SessionTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	for _, h := range p.c.Headers {
+		if v := id.value(h); v != "" {
+			r.Header.Set(h.Name, v)
+		}
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+// session is the signed content of a session cookie.
+type session struct {
+	Identity *Identity `json:"id"`
+	Addr     string    `json:"addr"`
+	Expires  int64     `json:"exp"`
+}
+
+// newSession returns a session cookie value for id, valid for requests from
+// addr.
+func (p *Proxy) newSession(id *Identity, addr netip.Addr) string {
+	j, _ := json.Marshal(session{
+		Identity: id,
+		Addr:     addr.String(),
+		Expires:  p.now().Add(p.c.SessionTTL).Unix(),
+	})
+	payload := base64.RawURLEncoding.EncodeToString(j)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(p.sign(payload))
+}
+
+// sessionIdentity returns the identity in r's session cookie, if it has a
+// valid one from addr.
+func (p *Proxy) sessionIdentity(r *http.Request, addr netip.Addr) (_ *Identity, ok bool) {
+	if p.c.SessionTTL <= 0 {
+		return nil, false
+	}
+	c, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return nil, false
+	}
+	payload, sig, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return nil, false
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, p.sign(payload)) {
+		return nil, false
+	}
+	j, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, false
+	}
+	var s session
+	if err := json.Unmarshal(j, &s); err != nil || s.Identity == nil {
+		return nil, false
+	}
+	if s.Addr != addr.String() || p.now().Unix() >= s.Expires {
+		return nil, false
+	}
+	return s.Identity, true
+}
+
+func (p *Proxy) sign(payload string) []byte {
+	h := hmac.New(sha256.New, p.key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// removeCookie removes the cookie named name from r.
+func removeCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	if !slices.ContainsFunc(cookies, func(c *http.Cookie) bool { return c.Name == name }) {
+		return
+	}
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			r.AddCookie(c)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package authproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Header
+		wantErr bool
+	}{
+		{in: "X-User=login", want: Header{Name: "X-User", Field: FieldLogin}},
+		{in: "x-webauth-groups=groups:|", want: Header{Name: "X-Webauth-Groups", Field: FieldGroups, Sep: "|"}},
+		{in: "X-User", wantErr: true},
+		{in: "=login", wantErr: true},
+		{in: "X-User=email", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseHeader(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseHeader(%q) = %+v, %v; want %+v, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var gotHeaders http.Header
+	var gotHost string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header.Clone()
+		gotHost = r.Host
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	var whoIsCalls int
+	whois := map[string]*apitype.WhoIsResponse{
+		"100.64.0.1": {
+			Node: &tailcfg.Node{Name: "laptop.example.ts.net.", ComputedName: "laptop"},
+			UserProfile: &tailcfg.UserProfile{
+				LoginName:   "alice@example.com",
+				DisplayName: "Alice Smith",
+			},
+			CapMap: tailcfg.PeerCapMap{
+				tailcfg.PeerCapabilityAuthProxy: {
+					`{"groups":["viewers","admins"]}`,
+					`{"groups":["admins"]}`,
+				},
+			},
+		},
+		"100.64.0.2": {
+			Node: &tailcfg.Node{Name: "server.example.ts.net.", Tags: []string{"tag:server"}},
+		},
+	}
+	headers, err := BackendHeaders(BackendJenkins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers = append(headers, Header{Name: "X-Tailnet", Field: FieldTailnet})
+	p, err := New(Config{
+		Backend: backendURL,
+		WhoIs: func(ctx context.Context, remoteAddr string) (*apitype.WhoIsResponse, error) {
+			whoIsCalls++
+			ip, _, _ := strings.Cut(remoteAddr, ":")
+			if who, ok := whois[ip]; ok {
+				return who, nil
+			}
+			return nil, errors.New("not found")
+		},
+		Headers:    headers,
+		SessionTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	p.now = func() time.Time { return now }
+
+	doPath := func(path, remoteAddr string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		gotHeaders = nil
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-User", "mallory@example.com")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		return rec
+	}
+	do := func(remoteAddr string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		return doPath("/", remoteAddr, cookies...)
+	}
+
+	rec := do("100.64.0.1:1234")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("user: status = %v; want 200", rec.Code)
+	}
+	for h, want := range map[string]string{
+		"X-Forwarded-User":   "alice@example.com",
+		"X-Forwarded-Groups": "admins|viewers",
+		"X-Tailnet":          "example.ts.net",
+	} {
+		if got := gotHeaders.Get(h); got != want {
+			t.Errorf("%s = %q; want %q", h, got, want)
+		}
+	}
+	if gotHost != "example.com" {
+		t.Errorf("backend got Host %q; want the client's", gotHost)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != SessionCookie {
+		t.Fatalf("cookies = %v; want a session cookie", cookies)
+	}
+
+	// The session cookie identifies the client without a WhoIs lookup,
+	// and isn't passed to the backend.
+	whoIsCalls = 0
+	if rec := do("100.64.0.1:5678", cookies[0], &http.Cookie{Name: "app", Value: "x"}); rec.Code != http.StatusOK {
+		t.Fatalf("session: status = %v; want 200", rec.Code)
+	}
+	if whoIsCalls != 0 {
+		t.Errorf("session: %d WhoIs calls; want 0", whoIsCalls)
+	}
+	if got := gotHeaders.Get("Cookie"); got != "app=x" {
+		t.Errorf("session: backend got cookies %q; want only the app's", got)
+	}
+	if got := gotHeaders.Get("X-Forwarded-User"); got != "alice@example.com" {
+		t.Errorf("session: X-Forwarded-User = %q", got)
+	}
+
+	// The session cookie is bound to the client's address.
+	if rec := do("100.64.0.3:1234", cookies[0]); rec.Code != http.StatusUnauthorized {
+		t.Errorf("stolen session: status = %v; want 401", rec.Code)
+	}
+
+	// Expired sessions need a new lookup.
+	now = now.Add(2 * time.Hour)
+	whoIsCalls = 0
+	do("100.64.0.1:1234", cookies[0])
+	if whoIsCalls != 1 {
+		t.Errorf("expired session: %d WhoIs calls; want 1", whoIsCalls)
+	}
+
+	if rec := do("100.64.0.2:1234"); rec.Code != http.StatusForbidden || gotHeaders != nil {
+		t.Errorf("tagged: status = %v; want 403", rec.Code)
+	}
+	p.c.AllowTagged = true
+	if rec := do("100.64.0.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("allowed tagged: status = %v; want 200", rec.Code)
+	}
+	if got := gotHeaders.Get("X-Forwarded-User"); got != "" {
+		t.Errorf("allowed tagged: X-Forwarded-User = %q; want forged header removed", got)
+	}
+	p.c.AllowTagged = false
+
+	// Unidentified clients are let through without identity headers.
+	p.c.AllowUnidentified = true
+	for _, addr := range []string{"100.64.0.2:1234", "100.64.0.3:1234"} {
+		if rec := do(addr); rec.Code != http.StatusOK {
+			t.Errorf("allowed unidentified %v: status = %v; want 200", addr, rec.Code)
+		}
+		if got := gotHeaders.Get("X-Forwarded-User"); got != "" {
+			t.Errorf("allowed unidentified %v: X-Forwarded-User = %q; want forged header removed", addr, got)
+		}
+	}
+
+	// With Paths, clients are only identified on those paths.
+	p.c.Paths = []string{"/login"}
+	whoIsCalls = 0
+	doPath("/dashboards", "100.64.0.1:1234")
+	if whoIsCalls != 0 {
+		t.Errorf("other path: %d WhoIs calls; want 0", whoIsCalls)
+	}
+	if got := gotHeaders.Get("X-Forwarded-User"); got != "" {
+		t.Errorf("other path: X-Forwarded-User = %q; want forged header removed", got)
+	}
+	doPath("/login", "100.64.0.1:1234")
+	if got := gotHeaders.Get("X-Forwarded-User"); got != "alice@example.com" {
+		t.Errorf("login path: X-Forwarded-User = %q", got)
+	}
+}
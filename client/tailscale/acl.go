@@ -12,6 +12,7 @@
 	"fmt"
 	"net/http"
 	"net/netip"
+	"strings"
 )
 
 // ACLRow defines a rule that grants access by a set of users or groups to a set
@@ -519,3 +520,43 @@ func (c *Client) ValidateACLJSON(ctx context.Context, source, dest string) (test
 	}
 	return &res, nil
 }
+
+// ValidateACLHuJSON sends the policy file acl to the control api acl validate
+// endpoint, which checks it and runs its tests without changing the
+// tailnet's policy. It returns a nil ACLTestError pointer if the policy is
+// valid and its tests pass.
+func (c *Client) ValidateACLHuJSON(ctx context.Context, acl string) (testErr *ACLTestError, err error) {
+	// Format return errors to be descriptive.
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("tailscale.ValidateACLHuJSON: %w", err)
+		}
+	}()
+
+	path := fmt.Sprintf("%s/api/v2/tailnet/%s/acl/validate", c.baseURL(), c.tailnet)
+	req, err := http.NewRequestWithContext(ctx, "POST", path, strings.NewReader(acl))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/hujson")
+
+	b, resp, err := c.sendRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var res ACLTestError
+	if len(bytes.TrimSpace(b)) > 0 {
+		if err := json.Unmarshal(b, &res); err != nil {
+			return nil, err
+		}
+	}
+	if res.Message != "" || len(res.Data) > 0 {
+		res.Status = resp.StatusCode
+		return &res, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("control api responded with %d status code", resp.StatusCode)
+	}
+	return nil, nil
+}
@@ -5,6 +5,10 @@
 package apitype
 
 import (
+	"net/netip"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/dnstype"
 )
@@ -23,6 +27,40 @@ type WhoIsResponse struct {
 	CapMap tailcfg.PeerCapMap
 }
 
+// NodeInfo is a node's self-reported state, as returned by its peerapi to
+// peers granted tailscale.com/cap/node-info, and by the LocalAPI's
+// /localapi/v0/peer-info?ip=$IP handler.
+type NodeInfo struct {
+	Hostname     string
+	OS           string
+	Version      string    // long version of tailscaled
+	BackendState string    // e.g. "Running"
+	StartTime    time.Time // when tailscaled started
+
+	// Health are the node's current health warnings.
+	// It is empty if the node is healthy.
+	Health []string `json:",omitempty"`
+
+	// Paths are the ping statistics of the node's paths to the peer
+	// that requested the NodeInfo. The direct path in use comes first.
+	Paths []ipnstate.PathStats `json:",omitempty"`
+}
+
+// UpdateStatus is a node's self-update state, as returned by its peerapi to
+// peers granted tailscale.com/cap/remote-update, and by the LocalAPI's
+// /localapi/v0/peer-update?ip=$IP handler.
+type UpdateStatus struct {
+	Version string // long version of tailscaled
+
+	// C2NUpdateResponse reports whether the node opted in to remote
+	// updates and supports them, and whether an update is running.
+	tailcfg.C2NUpdateResponse
+
+	// LastErr is the error of the node's last update attempt, if it
+	// failed without tailscaled restarting.
+	LastErr string `json:",omitempty"`
+}
+
 // FileTarget is a node to which files can be sent, and the PeerAPI
 // URL base to do so via.
 type FileTarget struct {
@@ -53,6 +91,22 @@ type ReloadConfigResponse struct {
 	Err      string // any error message
 }
 
+// ValidateConfigResponse is the response to a LocalAPI validate-config request.
+//
+// If the config is valid, Err is empty and Changes lists what reloading the
+// config would change, if anything.
+type ValidateConfigResponse struct {
+	Err     string         `json:",omitempty"` // why the config is invalid
+	Changes []ConfigChange `json:",omitempty"`
+}
+
+// ConfigChange is a setting that applying a config file would change.
+type ConfigChange struct {
+	Field string // name of the prefs field, such as "RouteAll", or "StaticEndpoints"
+	Old   string // current value, in JSON
+	New   string // value after applying the config, in JSON
+}
+
 // ExitNodeSuggestionResponse is the response to a LocalAPI suggest-exit-node GET request.
 // It returns the StableNodeID, name, and location of a suggested exit node for the client making the request.
 type ExitNodeSuggestionResponse struct {
@@ -69,10 +123,43 @@ type DNSOSConfig struct {
 	MatchDomains  []string
 }
 
+// FirewallRule is a Windows Filtering Platform filter installed by Tailscale,
+// as returned by the LocalAPI debug-firewall endpoint.
+type FirewallRule struct {
+	ID         string   // the filter's GUID
+	Name       string   // e.g. "Permit inbound DNS (IPv4)"
+	Purpose    string   // the part of Tailscale's firewall that installed it
+	Layer      string   // the WFP layer the filter runs in
+	Action     string   // e.g. "Permit" or "Block"
+	Weight     uint64   // priority within Tailscale's sublayer
+	Conditions []string `json:",omitempty"`
+	Disabled   bool     `json:",omitempty"`
+}
+
+// Flow is a TCP, UDP or SCTP flow let through by the packet filter, as
+// returned by the LocalAPI debug-flows endpoint.
+type Flow struct {
+	ID      uint64         // to kill the flow with the debug-kill-flow endpoint
+	Proto   string         // "tcp", "udp" or "sctp"
+	Src     netip.AddrPort // of the side that started the flow
+	Dst     netip.AddrPort
+	Inbound bool // started by a peer rather than by this node
+	Created time.Time
+	Killed  bool `json:",omitempty"`
+}
+
 // DNSQueryResponse is the response to a DNS query request sent via LocalAPI.
 type DNSQueryResponse struct {
 	// Bytes is the raw DNS response bytes.
 	Bytes []byte
 	// Resolvers is the list of resolvers that the forwarder deemed able to resolve the query.
 	Resolvers []*dnstype.Resolver
+	// Local is whether the query was answered by the internal resolver
+	// itself, because the name is a MagicDNS name or is in a domain it's
+	// authoritative for, rather than forwarded to Resolvers.
+	Local bool `json:",omitempty"`
+	// Route is the suffix of the DNS route that matched the name, such as
+	// "example.com." for a split DNS route or "." for the default resolvers.
+	// It's empty if the query was answered locally, or if no route matched.
+	Route string `json:",omitempty"`
 }
@@ -12,6 +12,7 @@
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"net/url"
 
 	"tailscale.com/types/opt"
@@ -236,27 +237,7 @@ func (c *Client) SetAuthorized(ctx context.Context, deviceID string, authorized
 	params := &struct {
 		Authorized bool `json:"authorized"`
 	}{Authorized: authorized}
-	data, err := json.Marshal(params)
-	if err != nil {
-		return err
-	}
-	path := fmt.Sprintf("%s/api/v2/device/%s/authorized", c.baseURL(), url.PathEscape(deviceID))
-	req, err := http.NewRequestWithContext(ctx, "POST", path, bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-
-	b, resp, err := c.sendRequest(req)
-	if err != nil {
-		return err
-	}
-	// If status code was not successful, return the error.
-	// TODO: Change the check for the StatusCode to include other 2XX success codes.
-	if resp.StatusCode != http.StatusOK {
-		return handleErrorResponse(b, resp)
-	}
-
-	return nil
+	return c.devicePOSTRequest(ctx, deviceID, "authorized", params)
 }
 
 // SetTags updates the ACL tags on a device.
@@ -264,11 +245,44 @@ func (c *Client) SetTags(ctx context.Context, deviceID string, tags []string) er
 	params := &struct {
 		Tags []string `json:"tags"`
 	}{Tags: tags}
+	return c.devicePOSTRequest(ctx, deviceID, "tags", params)
+}
+
+// SetDeviceName sets the MagicDNS name of a device. If name is empty, the
+// name is reset to one derived from the device's hostname.
+func (c *Client) SetDeviceName(ctx context.Context, deviceID, name string) error {
+	params := &struct {
+		Name string `json:"name"`
+	}{Name: name}
+	return c.devicePOSTRequest(ctx, deviceID, "name", params)
+}
+
+// SetKeyExpiryDisabled sets whether the node key of a device is exempt from
+// key expiry.
+func (c *Client) SetKeyExpiryDisabled(ctx context.Context, deviceID string, disabled bool) error {
+	params := &struct {
+		KeyExpiryDisabled bool `json:"keyExpiryDisabled"`
+	}{KeyExpiryDisabled: disabled}
+	return c.devicePOSTRequest(ctx, deviceID, "key", params)
+}
+
+// SetDeviceIPv4 sets the Tailscale IPv4 address of a device, which must be
+// in the tailnet's address range and not in use by another device.
+func (c *Client) SetDeviceIPv4(ctx context.Context, deviceID string, ip netip.Addr) error {
+	params := &struct {
+		IPv4 string `json:"ipv4"`
+	}{IPv4: ip.String()}
+	return c.devicePOSTRequest(ctx, deviceID, "ip", params)
+}
+
+// devicePOSTRequest POSTs params as JSON to the device endpoint of the given
+// device.
+func (c *Client) devicePOSTRequest(ctx context.Context, deviceID, endpoint string, params any) error {
 	data, err := json.Marshal(params)
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/api/v2/device/%s/tags", c.baseURL(), url.PathEscape(deviceID))
+	path := fmt.Sprintf("%s/api/v2/device/%s/%s", c.baseURL(), url.PathEscape(deviceID), endpoint)
 	req, err := http.NewRequestWithContext(ctx, "POST", path, bytes.NewBuffer(data))
 	if err != nil {
 		return err
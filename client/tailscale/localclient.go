@@ -30,8 +30,10 @@
 	"tailscale.com/client/tailscale/apitype"
 	"tailscale.com/drive"
 	"tailscale.com/envknob"
+	"tailscale.com/health"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/logtail/redact"
 	"tailscale.com/net/netutil"
 	"tailscale.com/paths"
 	"tailscale.com/safesocket"
@@ -400,6 +402,89 @@ func (lc *LocalClient) TailDaemonLogs(ctx context.Context) (io.Reader, error) {
 	return res.Body, nil
 }
 
+// StreamBusEvents returns a stream of the events published on the Tailscale
+// daemon's internal event bus as they happen, as newline-delimited JSON
+// objects with Time, Topic and Event fields. Close the context to stop the
+// stream. This is a development tool and subject to change or removal over
+// time.
+func (lc *LocalClient) StreamBusEvents(ctx context.Context) (io.Reader, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+apitype.LocalAPIHost+"/localapi/v0/debug-bus-events", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := lc.doLocalRequestNiceError(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		res.Body.Close()
+		return nil, errors.New(res.Status)
+	}
+	return res.Body, nil
+}
+
+// ExportLocalLogs returns a stream of the logs kept in the Tailscale daemon's
+// local on-disk log buffer, as newline-delimited JSON log entries. If since
+// is positive, only logs from that long ago onward are returned.
+//
+// The caller must close the returned ReadCloser.
+func (lc *LocalClient) ExportLocalLogs(ctx context.Context, since time.Duration) (io.ReadCloser, error) {
+	v := url.Values{}
+	if since > 0 {
+		v.Set("since", since.String())
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+apitype.LocalAPIHost+"/localapi/v0/logs-export?"+v.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := lc.doLocalRequestNiceError(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return nil, errors.New(errorMessageFromBody(body))
+	}
+	return res.Body, nil
+}
+
+// LogRedactionRules returns the rules that redact sensitive data from
+// tailscaled's logs before they're written or uploaded.
+func (lc *LocalClient) LogRedactionRules(ctx context.Context) ([]redact.Rule, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/log-redaction")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]redact.Rule](body)
+}
+
+// SetLogRedactionRules sets the rules that redact sensitive data from
+// tailscaled's logs before they're written or uploaded, replacing any
+// previous ones. Empty rules redact nothing.
+func (lc *LocalClient) SetLogRedactionRules(ctx context.Context, rules []redact.Rule) error {
+	_, err := lc.send(ctx, "POST", "/localapi/v0/log-redaction", http.StatusNoContent, jsonBody(rules))
+	return err
+}
+
+// PowerState returns the power state of the host last reported to the
+// Tailscale daemon.
+func (lc *LocalClient) PowerState(ctx context.Context) (ipn.PowerState, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/power-state")
+	if err != nil {
+		return ipn.PowerState{}, err
+	}
+	return decodeJSON[ipn.PowerState](body)
+}
+
+// SetPowerState reports the power state of the host to the Tailscale
+// daemon, such as when the host's screen turns off or it enters a low-power
+// mode, so it can do less background work while the host is idle.
+func (lc *LocalClient) SetPowerState(ctx context.Context, ps ipn.PowerState) error {
+	_, err := lc.send(ctx, "POST", "/localapi/v0/power-state", http.StatusOK, jsonBody(ps))
+	return err
+}
+
 // Pprof returns a pprof profile of the Tailscale daemon.
 func (lc *LocalClient) Pprof(ctx context.Context, pprofType string, sec int) ([]byte, error) {
 	var secArg string
@@ -882,6 +967,22 @@ func (lc *LocalClient) QueryDNS(ctx context.Context, name string, queryType stri
 	return res.Bytes, res.Resolvers, nil
 }
 
+// QueryDNSRoute is like QueryDNS, but it also reports how the internal DNS
+// resolver routed the query.
+func (lc *LocalClient) QueryDNSRoute(ctx context.Context, name string, queryType string) (*apitype.DNSQueryResponse, error) {
+	body, err := lc.get200(ctx, fmt.Sprintf("/localapi/v0/dns-query?name=%s&type=%s", url.QueryEscape(name), queryType))
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*apitype.DNSQueryResponse](body)
+}
+
+// FlushDNS flushes the DNS caches of the OS, where supported.
+func (lc *LocalClient) FlushDNS(ctx context.Context) error {
+	_, err := lc.send(ctx, "POST", "/localapi/v0/dns-flush", http.StatusNoContent, nil)
+	return err
+}
+
 // StartLoginInteractive starts an interactive login.
 func (lc *LocalClient) StartLoginInteractive(ctx context.Context) error {
 	_, err := lc.send(ctx, "POST", "/localapi/v0/login-interactive", http.StatusNoContent, nil)
@@ -1003,6 +1104,26 @@ func (lc *LocalClient) CurrentDERPMap(ctx context.Context) (*tailcfg.DERPMap, er
 	return &derpMap, nil
 }
 
+// HealthState returns the current health of the local tailscaled: the
+// Warnables that are currently unhealthy, keyed by code.
+func (lc *LocalClient) HealthState(ctx context.Context) (*health.State, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/health")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*health.State](body)
+}
+
+// HealthWarnables returns all the Warnables that the local tailscaled can
+// report, whether or not they're currently unhealthy.
+func (lc *LocalClient) HealthWarnables(ctx context.Context) ([]health.WarnableInfo, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/health/warnables")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]health.WarnableInfo](body)
+}
+
 // CertPair returns a cert and private key for the provided DNS domain.
 //
 // It returns a cached certificate from disk if it's still valid.
@@ -1147,6 +1268,55 @@ func (lc *LocalClient) Ping(ctx context.Context, ip netip.Addr, pingtype tailcfg
 	return lc.PingWithOpts(ctx, ip, pingtype, PingOpts{})
 }
 
+// PathStats returns the latency and loss statistics of the recent disco pings
+// sent on each path to the peer with the provided Tailscale IP.
+func (lc *LocalClient) PathStats(ctx context.Context, ip netip.Addr) ([]ipnstate.PathStats, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/path-stats?ip="+url.QueryEscape(ip.String()))
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]ipnstate.PathStats](body)
+}
+
+// PeerInfo returns the self-reported health, version, uptime and path
+// statistics of the peer with the provided Tailscale IP. The peer must grant
+// this node the tailscale.com/cap/node-info peer capability.
+func (lc *LocalClient) PeerInfo(ctx context.Context, ip netip.Addr) (*apitype.NodeInfo, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/peer-info?ip="+url.QueryEscape(ip.String()))
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*apitype.NodeInfo](body)
+}
+
+// PeerUpdateStatus returns the self-update state of the peer with the
+// provided Tailscale IP. The peer must grant this node the
+// tailscale.com/cap/remote-update peer capability.
+func (lc *LocalClient) PeerUpdateStatus(ctx context.Context, ip netip.Addr) (*apitype.UpdateStatus, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/peer-update?ip="+url.QueryEscape(ip.String()))
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*apitype.UpdateStatus](body)
+}
+
+// StartPeerUpdate asks the peer with the provided Tailscale IP to update
+// itself to the latest version of its release track, and returns its
+// resulting self-update state. If the peer didn't start the update, the
+// state's Err says why. Unless force is set, peers don't update while they
+// have active SSH connections.
+func (lc *LocalClient) StartPeerUpdate(ctx context.Context, ip netip.Addr, force bool) (*apitype.UpdateStatus, error) {
+	v := url.Values{"ip": {ip.String()}}
+	if force {
+		v.Set("force", "true")
+	}
+	body, err := lc.send(ctx, "POST", "/localapi/v0/peer-update?"+v.Encode(), 200, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*apitype.UpdateStatus](body)
+}
+
 // NetworkLockStatus fetches information about the tailnet key authority, if one is configured.
 func (lc *LocalClient) NetworkLockStatus(ctx context.Context) (*ipnstate.NetworkLockStatus, error) {
 	body, err := lc.send(ctx, "GET", "/localapi/v0/tka/status", 200, nil)
@@ -1468,6 +1638,26 @@ func (lc *LocalClient) ReloadConfig(ctx context.Context) (ok bool, err error) {
 	return res.Reloaded, nil
 }
 
+// ValidateConfig reports whether raw, the contents of the config file at path,
+// is a valid config file for the running tailscaled, without applying it. If
+// it is, it returns what reloading the config would change.
+//
+// The path is only used in error messages.
+func (lc *LocalClient) ValidateConfig(ctx context.Context, path string, raw []byte) ([]apitype.ConfigChange, error) {
+	body, err := lc.send(ctx, "POST", "/localapi/v0/validate-config?path="+url.QueryEscape(path), 200, bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	res, err := decodeJSON[apitype.ValidateConfigResponse](body)
+	if err != nil {
+		return nil, err
+	}
+	if res.Err != "" {
+		return nil, errors.New(res.Err)
+	}
+	return res.Changes, nil
+}
+
 // SwitchToEmptyProfile creates and switches to a new unnamed profile. The new
 // profile is not assigned an ID until it is persisted after a successful login.
 // In order to login to the new profile, the user must call LoginInteractive.
@@ -1529,6 +1719,33 @@ func (lc *LocalClient) DebugPacketFilterRules(ctx context.Context) ([]tailcfg.Fi
 	return decodeJSON[[]tailcfg.FilterRule](body)
 }
 
+// DebugFirewallRules returns the Windows Filtering Platform filters
+// installed by Tailscale. It is only implemented on Windows.
+func (lc *LocalClient) DebugFirewallRules(ctx context.Context) ([]apitype.FirewallRule, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/debug-firewall")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]apitype.FirewallRule](body)
+}
+
+// DebugFlows returns the TCP, UDP and SCTP flows most recently let through
+// by the packet filter, newest first.
+func (lc *LocalClient) DebugFlows(ctx context.Context) ([]apitype.Flow, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/debug-flows")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]apitype.Flow](body)
+}
+
+// DebugKillFlow makes the packet filter drop the packets of the flow with
+// the given ID, as returned by DebugFlows, in both directions.
+func (lc *LocalClient) DebugKillFlow(ctx context.Context, id uint64) error {
+	_, err := lc.send(ctx, "POST", "/localapi/v0/debug-kill-flow?id="+strconv.FormatUint(id, 10), http.StatusNoContent, nil)
+	return err
+}
+
 // DebugSetExpireIn marks the current node key to expire in d.
 //
 // This is meant primarily for debug and testing.
@@ -1543,7 +1760,44 @@ func (lc *LocalClient) DebugSetExpireIn(ctx context.Context, d time.Duration) er
 // The provided context does not determine the lifetime of the
 // returned io.ReadCloser.
 func (lc *LocalClient) StreamDebugCapture(ctx context.Context) (io.ReadCloser, error) {
-	req, err := http.NewRequestWithContext(ctx, "POST", "http://"+apitype.LocalAPIHost+"/localapi/v0/debug-capture", nil)
+	return lc.StreamDebugCaptureWithOpts(ctx, nil)
+}
+
+// DebugCaptureOpts contains options for StreamDebugCaptureWithOpts.
+type DebugCaptureOpts struct {
+	// Filter is a tcpdump-style expression selecting the packets to
+	// capture, such as "host 100.101.102.103 and tcp port 22". Disco
+	// frames can be selected with "disco". If empty, all packets are
+	// captured.
+	Filter string
+
+	// Format is the format of the capture stream: "pcap" (the default)
+	// or "pcapng". In pcapng streams, each packet carries a comment
+	// describing its Tailscale metadata, such as the path it was
+	// captured on and the DERP region and node a disco frame came from.
+	Format string
+}
+
+// StreamDebugCaptureWithOpts streams a packet capture of the packets selected
+// by opts, which may be nil.
+//
+// The provided context does not determine the lifetime of the
+// returned io.ReadCloser.
+func (lc *LocalClient) StreamDebugCaptureWithOpts(ctx context.Context, opts *DebugCaptureOpts) (io.ReadCloser, error) {
+	v := url.Values{}
+	if opts != nil {
+		if opts.Filter != "" {
+			v.Set("filter", opts.Filter)
+		}
+		if opts.Format != "" {
+			v.Set("format", opts.Format)
+		}
+	}
+	u := "http://" + apitype.LocalAPIHost + "/localapi/v0/debug-capture"
+	if len(v) > 0 {
+		u += "?" + v.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -1551,6 +1805,11 @@ func (lc *LocalClient) StreamDebugCapture(ctx context.Context) (io.ReadCloser, e
 	if err != nil {
 		return nil, err
 	}
+	if res.StatusCode == http.StatusBadRequest {
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return nil, errors.New(errorMessageFromBody(body))
+	}
 	if res.StatusCode != 200 {
 		res.Body.Close()
 		return nil, errors.New(res.Status)
@@ -1569,8 +1828,28 @@ func (lc *LocalClient) StreamDebugCapture(ctx context.Context) (io.ReadCloser, e
 //
 // A default set of ipn.Notify messages are returned but the set can be modified by mask.
 func (lc *LocalClient) WatchIPNBus(ctx context.Context, mask ipn.NotifyWatchOpt) (*IPNBusWatcher, error) {
+	return lc.WatchIPNBusFrom(ctx, mask, "")
+}
+
+// ErrIPNBusCursorExpired is returned by WatchIPNBusFrom if the watch can't be
+// resumed from the provided cursor, such as because tailscaled restarted or
+// too many notifications were sent since.
+var ErrIPNBusCursorExpired = errors.New("IPN bus cursor expired")
+
+// WatchIPNBusFrom is like WatchIPNBus but, if cursor is non-empty, resumes
+// watching the IPN notification bus after the ipn.Notify with that Cursor,
+// first returning the notifications that were sent since.
+//
+// If the notifications sent since are no longer available, it returns
+// ErrIPNBusCursorExpired, and the caller should start a new watch, requesting
+// the initial state it needs with mask.
+func (lc *LocalClient) WatchIPNBusFrom(ctx context.Context, mask ipn.NotifyWatchOpt, cursor string) (*IPNBusWatcher, error) {
+	q := url.Values{"mask": {fmt.Sprint(mask)}}
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
 	req, err := http.NewRequestWithContext(ctx, "GET",
-		"http://"+apitype.LocalAPIHost+"/localapi/v0/watch-ipn-bus?mask="+fmt.Sprint(mask),
+		"http://"+apitype.LocalAPIHost+"/localapi/v0/watch-ipn-bus?"+q.Encode(),
 		nil)
 	if err != nil {
 		return nil, err
@@ -1579,6 +1858,10 @@ func (lc *LocalClient) WatchIPNBus(ctx context.Context, mask ipn.NotifyWatchOpt)
 	if err != nil {
 		return nil, err
 	}
+	if res.StatusCode == http.StatusGone {
+		res.Body.Close()
+		return nil, ErrIPNBusCursorExpired
+	}
 	if res.StatusCode != 200 {
 		res.Body.Close()
 		return nil, errors.New(res.Status)
@@ -1666,6 +1949,16 @@ func (lc *LocalClient) DriveShareList(ctx context.Context) ([]*drive.Share, erro
 	return shares, err
 }
 
+// DriveStatus returns the status of the shares that drive is serving to
+// remote nodes, including recent accesses to them.
+func (lc *LocalClient) DriveStatus(ctx context.Context) (*drive.Status, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/drive/status")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*drive.Status](body)
+}
+
 // IPNBusWatcher is an active subscription (watch) of the local tailscaled IPN bus.
 // It's returned by LocalClient.WatchIPNBus.
 //
@@ -1711,3 +2004,53 @@ func (lc *LocalClient) SuggestExitNode(ctx context.Context) (apitype.ExitNodeSug
 	}
 	return decodeJSON[apitype.ExitNodeSuggestionResponse](body)
 }
+
+// LocationStatus returns the identity of the network the machine is connected
+// to, and the location profiles of the current profile.
+func (lc *LocalClient) LocationStatus(ctx context.Context) (*ipn.LocationStatus, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/location-profiles")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*ipn.LocationStatus](body)
+}
+
+// SetLocationProfiles replaces the location profiles of the current profile.
+func (lc *LocalClient) SetLocationProfiles(ctx context.Context, profiles []ipn.LocationProfile) error {
+	_, err := lc.send(ctx, "POST", "/localapi/v0/location-profiles", http.StatusNoContent, jsonBody(profiles))
+	return err
+}
+
+// UsageStats returns the bandwidth usage of the current profile.
+func (lc *LocalClient) UsageStats(ctx context.Context) (*ipn.UsageStats, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/usage")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*ipn.UsageStats](body)
+}
+
+// ResetUsageStats deletes the bandwidth usage of the current profile.
+func (lc *LocalClient) ResetUsageStats(ctx context.Context) error {
+	_, err := lc.send(ctx, "DELETE", "/localapi/v0/usage", http.StatusNoContent, nil)
+	return err
+}
+
+// RouteApprovals returns the routes advertised by the current profile, their
+// justification, and the decisions made about them with DecideRoute.
+func (lc *LocalClient) RouteApprovals(ctx context.Context) (*tailcfg.C2NRouteApprovalsResponse, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/route-approvals")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[*tailcfg.C2NRouteApprovalsResponse](body)
+}
+
+// DecideRoute records the decision of an approval agent, such as an
+// integration with a change-management system, about a route advertised by
+// the current profile. Rejected routes are no longer advertised. Decisions
+// are reported to control servers that ask for them.
+func (lc *LocalClient) DecideRoute(ctx context.Context, d ipn.RouteDecision) error {
+	_, err := lc.send(ctx, "POST", "/localapi/v0/route-approvals", http.StatusNoContent, jsonBody(d))
+	return err
+}
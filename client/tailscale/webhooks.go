@@ -0,0 +1,212 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build go1.19
+
+package tailscale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WebhookProviderType is the type of service a webhook endpoint is for,
+// which determines the format of the events posted to it.
+type WebhookProviderType string
+
+const (
+	WebhookEmptyProviderType      WebhookProviderType = "" // generic JSON events
+	WebhookSlackProviderType      WebhookProviderType = "slack"
+	WebhookMattermostProviderType WebhookProviderType = "mattermost"
+	WebhookGoogleChatProviderType WebhookProviderType = "googlechat"
+	WebhookDiscordProviderType    WebhookProviderType = "discord"
+)
+
+// WebhookSubscriptionType is a type of event that a webhook is sent for.
+type WebhookSubscriptionType string
+
+const (
+	WebhookCategoryTailnetManagement       WebhookSubscriptionType = "categoryTailnetManagement"
+	WebhookCategoryDeviceMisconfigurations WebhookSubscriptionType = "categoryDeviceMisconfigurations"
+
+	WebhookNodeCreated                    WebhookSubscriptionType = "nodeCreated"
+	WebhookNodeNeedsApproval              WebhookSubscriptionType = "nodeNeedsApproval"
+	WebhookNodeApproved                   WebhookSubscriptionType = "nodeApproved"
+	WebhookNodeKeyExpiringInOneDay        WebhookSubscriptionType = "nodeKeyExpiringInOneDay"
+	WebhookNodeKeyExpired                 WebhookSubscriptionType = "nodeKeyExpired"
+	WebhookNodeDeleted                    WebhookSubscriptionType = "nodeDeleted"
+	WebhookPolicyUpdate                   WebhookSubscriptionType = "policyUpdate"
+	WebhookUserCreated                    WebhookSubscriptionType = "userCreated"
+	WebhookUserNeedsApproval              WebhookSubscriptionType = "userNeedsApproval"
+	WebhookUserSuspended                  WebhookSubscriptionType = "userSuspended"
+	WebhookUserRestored                   WebhookSubscriptionType = "userRestored"
+	WebhookUserDeleted                    WebhookSubscriptionType = "userDeleted"
+	WebhookUserApproved                   WebhookSubscriptionType = "userApproved"
+	WebhookUserRoleUpdated                WebhookSubscriptionType = "userRoleUpdated"
+	WebhookSubnetIPForwardingNotEnabled   WebhookSubscriptionType = "subnetIPForwardingNotEnabled"
+	WebhookExitNodeIPForwardingNotEnabled WebhookSubscriptionType = "exitNodeIPForwardingNotEnabled"
+)
+
+// Webhook is a webhook endpoint of a tailnet, to which events are posted.
+type Webhook struct {
+	EndpointID       string                    `json:"endpointId"`
+	EndpointURL      string                    `json:"endpointUrl"`
+	ProviderType     WebhookProviderType       `json:"providerType"`
+	CreatorLoginName string                    `json:"creatorLoginName"`
+	Created          time.Time                 `json:"created"`
+	LastModified     time.Time                 `json:"lastModified"`
+	Subscriptions    []WebhookSubscriptionType `json:"subscriptions"`
+
+	// Secret is the secret used to sign the events posted to the
+	// endpoint. It's only returned when the webhook is created or its
+	// secret is rotated.
+	Secret *string `json:"secret,omitempty"`
+}
+
+// CreateWebhookRequest is the request to create a webhook, for
+// Client.CreateWebhook.
+type CreateWebhookRequest struct {
+	EndpointURL   string                    `json:"endpointUrl"`
+	ProviderType  WebhookProviderType       `json:"providerType"`
+	Subscriptions []WebhookSubscriptionType `json:"subscriptions"`
+}
+
+// webhookRequest sends a webhook API request with the JSON encoding of body,
+// if non-nil, and decodes the response into ret, if non-nil.
+func (c *Client) webhookRequest(ctx context.Context, method, path string, body, ret any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	b, resp, err := c.sendRequest(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return handleErrorResponse(b, resp)
+	}
+	if ret == nil {
+		return nil
+	}
+	return json.Unmarshal(b, ret)
+}
+
+func (c *Client) webhookPath(endpointID string) string {
+	return fmt.Sprintf("%s/api/v2/webhooks/%s", c.baseURL(), url.PathEscape(endpointID))
+}
+
+// Webhooks returns the tailnet's webhooks.
+func (c *Client) Webhooks(ctx context.Context) (webhooks []*Webhook, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("tailscale.Webhooks: %w", err)
+		}
+	}()
+	var res struct {
+		Webhooks []*Webhook `json:"webhooks"`
+	}
+	path := fmt.Sprintf("%s/api/v2/tailnet/%s/webhooks", c.baseURL(), url.PathEscape(c.tailnet))
+	if err := c.webhookRequest(ctx, "GET", path, nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Webhooks, nil
+}
+
+// CreateWebhook creates a webhook. The returned Webhook includes its secret,
+// which can't be retrieved again later.
+func (c *Client) CreateWebhook(ctx context.Context, r CreateWebhookRequest) (webhook *Webhook, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("tailscale.CreateWebhook: %w", err)
+		}
+	}()
+	path := fmt.Sprintf("%s/api/v2/tailnet/%s/webhooks", c.baseURL(), url.PathEscape(c.tailnet))
+	if err := c.webhookRequest(ctx, "POST", path, r, &webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// Webhook returns the webhook with the given endpoint ID.
+func (c *Client) Webhook(ctx context.Context, endpointID string) (webhook *Webhook, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("tailscale.Webhook: %w", err)
+		}
+	}()
+	if err := c.webhookRequest(ctx, "GET", c.webhookPath(endpointID), nil, &webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// SetWebhookSubscriptions sets the types of events that the webhook with
+// the given endpoint ID is sent for.
+func (c *Client) SetWebhookSubscriptions(ctx context.Context, endpointID string, subscriptions []WebhookSubscriptionType) (webhook *Webhook, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("tailscale.SetWebhookSubscriptions: %w", err)
+		}
+	}()
+	params := &struct {
+		Subscriptions []WebhookSubscriptionType `json:"subscriptions"`
+	}{Subscriptions: subscriptions}
+	if err := c.webhookRequest(ctx, "PATCH", c.webhookPath(endpointID), params, &webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook deletes the webhook with the given endpoint ID.
+func (c *Client) DeleteWebhook(ctx context.Context, endpointID string) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("tailscale.DeleteWebhook: %w", err)
+		}
+	}()
+	return c.webhookRequest(ctx, "DELETE", c.webhookPath(endpointID), nil, nil)
+}
+
+// TestWebhook asks the server to send a test event to the webhook with the
+// given endpoint ID. The event is sent asynchronously, so a nil error doesn't
+// mean that it was delivered.
+func (c *Client) TestWebhook(ctx context.Context, endpointID string) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("tailscale.TestWebhook: %w", err)
+		}
+	}()
+	return c.webhookRequest(ctx, "POST", c.webhookPath(endpointID)+"/test", nil, nil)
+}
+
+// RotateWebhookSecret replaces the secret of the webhook with the given
+// endpoint ID. The returned Webhook includes the new secret, which can't be
+// retrieved again later.
+func (c *Client) RotateWebhookSecret(ctx context.Context, endpointID string) (webhook *Webhook, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("tailscale.RotateWebhookSecret: %w", err)
+		}
+	}()
+	if err := c.webhookRequest(ctx, "POST", c.webhookPath(endpointID)+"/rotate", nil, &webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
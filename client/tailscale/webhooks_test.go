@@ -0,0 +1,124 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build go1.19
+
+package tailscale
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/tstest"
+)
+
+func TestWebhooks(t *testing.T) {
+	tstest.Replace(t, &I_Acknowledge_This_API_Is_Unstable, true)
+	secret := "s3cret"
+	var gotReqs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotReqs = append(gotReqs, r.Method+" "+r.URL.Path+" "+string(body))
+		if u, _, _ := r.BasicAuth(); u != "tskey-api-xxx" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"message":"unauthorized"}`)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v2/tailnet/example.com/webhooks":
+			json.NewEncoder(w).Encode(map[string]any{"webhooks": []*Webhook{{EndpointID: "ep1"}}})
+		case "POST /api/v2/tailnet/example.com/webhooks", "POST /api/v2/webhooks/ep1/rotate":
+			json.NewEncoder(w).Encode(&Webhook{EndpointID: "ep1", Secret: &secret})
+		case "PATCH /api/v2/webhooks/ep1":
+			json.NewEncoder(w).Encode(&Webhook{EndpointID: "ep1", Subscriptions: []WebhookSubscriptionType{WebhookNodeCreated}})
+		case "DELETE /api/v2/webhooks/ep1", "POST /api/v2/webhooks/ep1/test":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"not found"}`)
+		}
+	}))
+	defer ts.Close()
+	c := NewClient("example.com", APIKey("tskey-api-xxx"))
+	c.BaseURL = ts.URL
+	ctx := context.Background()
+
+	hooks, err := c.Webhooks(ctx)
+	if err != nil || len(hooks) != 1 || hooks[0].EndpointID != "ep1" {
+		t.Errorf("Webhooks = %v, %v", hooks, err)
+	}
+	hook, err := c.CreateWebhook(ctx, CreateWebhookRequest{
+		EndpointURL:   "https://example.com/hook",
+		ProviderType:  WebhookSlackProviderType,
+		Subscriptions: []WebhookSubscriptionType{WebhookNodeCreated},
+	})
+	if err != nil || hook.Secret == nil || *hook.Secret != secret {
+		t.Errorf("CreateWebhook = %+v, %v", hook, err)
+	}
+	if hook, err := c.SetWebhookSubscriptions(ctx, "ep1", []WebhookSubscriptionType{WebhookNodeCreated}); err != nil || len(hook.Subscriptions) != 1 {
+		t.Errorf("SetWebhookSubscriptions = %+v, %v", hook, err)
+	}
+	if hook, err := c.RotateWebhookSecret(ctx, "ep1"); err != nil || hook.Secret == nil {
+		t.Errorf("RotateWebhookSecret = %+v, %v", hook, err)
+	}
+	if err := c.TestWebhook(ctx, "ep1"); err != nil {
+		t.Errorf("TestWebhook: %v", err)
+	}
+	if err := c.DeleteWebhook(ctx, "ep1"); err != nil {
+		t.Errorf("DeleteWebhook: %v", err)
+	}
+	var errResp ErrResponse
+	if _, err := c.Webhook(ctx, "nope"); !errors.As(err, &errResp) || errResp.Status != http.StatusNotFound {
+		t.Errorf("Webhook of unknown ID: %v, want 404 ErrResponse", err)
+	}
+
+	want := []string{
+		"GET /api/v2/tailnet/example.com/webhooks ",
+		`POST /api/v2/tailnet/example.com/webhooks {"endpointUrl":"https://example.com/hook","providerType":"slack","subscriptions":["nodeCreated"]}`,
+		`PATCH /api/v2/webhooks/ep1 {"subscriptions":["nodeCreated"]}`,
+		"POST /api/v2/webhooks/ep1/rotate ",
+		"POST /api/v2/webhooks/ep1/test ",
+		"DELETE /api/v2/webhooks/ep1 ",
+		"GET /api/v2/webhooks/nope ",
+	}
+	if len(gotReqs) != len(want) {
+		t.Fatalf("got requests %q, want %q", gotReqs, want)
+	}
+	for i := range want {
+		if gotReqs[i] != want[i] {
+			t.Errorf("request %d = %q, want %q", i, gotReqs[i], want[i])
+		}
+	}
+}
+
+func TestValidateACLHuJSON(t *testing.T) {
+	tstest.Replace(t, &I_Acknowledge_This_API_Is_Unstable, true)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "application/hujson" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		if string(body) == "bad" {
+			io.WriteString(w, `{"message":"test(s) failed","data":[{"user":"alice@example.com","errors":["not allowed"]}]}`)
+		}
+	}))
+	defer ts.Close()
+	c := NewClient("example.com", nil)
+	c.BaseURL = ts.URL
+
+	if ate, err := c.ValidateACLHuJSON(context.Background(), "{}"); ate != nil || err != nil {
+		t.Errorf("valid policy: %v, %v", ate, err)
+	}
+	ate, err := c.ValidateACLHuJSON(context.Background(), "bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ate == nil || len(ate.Data) != 1 || ate.Data[0].User != "alice@example.com" {
+		t.Errorf("invalid policy: %+v", ate)
+	}
+}
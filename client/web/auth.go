@@ -282,6 +282,8 @@ func (p peerCapabilities) isEmpty() bool {
 	capFeatureSubnets   capFeature = "subnets"   // grants peer subnet routes management
 	capFeatureExitNodes capFeature = "exitnodes" // grants peer ability to advertise-as and use exit nodes
 	capFeatureAccount   capFeature = "account"   // grants peer ability to turn on auto updates and log out of node
+	capFeatureServe     capFeature = "serve"     // grants peer management of serve config, other than funnel
+	capFeatureFunnel    capFeature = "funnel"    // grants peer ability to expose serve config to the internet with funnel
 )
 
 // validCaps contains the list of valid capabilities used in the web client.
@@ -293,10 +295,13 @@ func (p peerCapabilities) isEmpty() bool {
 	capFeatureSubnets,
 	capFeatureExitNodes,
 	capFeatureAccount,
+	capFeatureServe,
+	capFeatureFunnel,
 }
 
 type capRule struct {
 	CanEdit []string `json:"canEdit,omitempty"` // list of features peer is allowed to edit
+	CanView []string `json:"canView,omitempty"` // list of features peer is allowed to view
 }
 
 // toPeerCapabilities parses out the web ui capabilities from the
@@ -337,3 +342,79 @@ func toPeerCapabilities(status *ipnstate.Status, whois *apitype.WhoIsResponse) (
 	}
 	return caps, nil
 }
+
+// viewCapabilities holds information about what a source peer is
+// allowed to view via the web UI, without a browser session and
+// without being able to make any changes.
+//
+// map value is true if the peer can view the given feature.
+// Only viewFeatures included in validViewFeatures will be included.
+type viewCapabilities map[viewFeature]bool
+
+// canView is true if the viewCapabilities grant read access
+// to the given feature.
+func (v viewCapabilities) canView(feature viewFeature) bool {
+	if v == nil {
+		return false
+	}
+	if v[viewFeatureAll] {
+		return true
+	}
+	return v[feature]
+}
+
+type viewFeature string
+
+const (
+	// The following values should not be edited, for the same reason
+	// as the capFeature values above.
+	//
+	// IMPORTANT: When adding a new feature, also update validViewFeatures below.
+
+	viewFeatureAll   viewFeature = "*"     // grants peer read access to all features
+	viewFeaturePeers viewFeature = "peers" // grants peer read access to the list of peers and their connectivity
+	viewFeatureLogs  viewFeature = "logs"  // grants peer read access to the tailscaled logs
+)
+
+// validViewFeatures contains the list of valid view features used in the
+// web client.
+var validViewFeatures []viewFeature = []viewFeature{
+	viewFeatureAll,
+	viewFeaturePeers,
+	viewFeatureLogs,
+}
+
+// toViewCapabilities parses out the web ui read-only capabilities from
+// the given whois response.
+//
+// Unlike edit capabilities, view capabilities may be granted to tagged
+// source nodes, such as a helpdesk kiosk, as viewing requires no login
+// to verify the viewer's identity. Peers that own this node, or that
+// are allowed to edit any feature, can view all features.
+func toViewCapabilities(status *ipnstate.Status, whois *apitype.WhoIsResponse) (viewCapabilities, error) {
+	if whois == nil || status == nil {
+		return viewCapabilities{}, nil
+	}
+	edit, err := toPeerCapabilities(status, whois)
+	if err != nil {
+		return nil, err
+	}
+	if !edit.isEmpty() {
+		return viewCapabilities{viewFeatureAll: true}, nil
+	}
+
+	caps := viewCapabilities{}
+	rules, err := tailcfg.UnmarshalCapJSON[capRule](whois.CapMap, tailcfg.PeerCapabilityWebUI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal capability: %v", err)
+	}
+	for _, c := range rules {
+		for _, f := range c.CanView {
+			feature := viewFeature(strings.ToLower(f))
+			if slices.Contains(validViewFeatures, feature) {
+				caps[feature] = true
+			}
+		}
+	}
+	return caps, nil
+}
@@ -78,6 +78,18 @@ export default function HomeView({
           View device details &rarr;
         </Link>
       </Card>
+      {node.Health && node.Health.length > 0 && (
+        <>
+          <h2 className="mb-3">Health warnings</h2>
+          <Card className="mb-9">
+            <ul className="list-disc pl-5 text-gray-800">
+              {node.Health.map((warning) => (
+                <li key={warning}>{warning}</li>
+              ))}
+            </ul>
+          </Card>
+        </>
+      )}
       <h2 className="mb-3">Settings</h2>
       <div className="grid gap-3">
         {node.Features["advertise-routes"] && (
@@ -5,6 +5,7 @@
 package web
 
 import (
+	"cmp"
 	"context"
 	"crypto/rand"
 	"encoding/json"
@@ -17,6 +18,7 @@
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -31,10 +33,13 @@
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/licenses"
+	"tailscale.com/net/netcheck"
+	"tailscale.com/net/netmon"
 	"tailscale.com/net/netutil"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/logger"
+	"tailscale.com/types/opt"
 	"tailscale.com/types/views"
 	"tailscale.com/util/httpm"
 	"tailscale.com/version"
@@ -405,6 +410,10 @@ func (s *Server) authorizeRequest(w http.ResponseWriter, r *http.Request) (ok bo
 		case r.URL.Path == "/api/device-details-click" && r.Method == httpm.POST:
 			// Special case metric endpoint that is allowed without a browser session.
 			return true
+		case (r.URL.Path == "/api/peers" || r.URL.Path == "/api/logs") && r.Method == httpm.GET:
+			// Readonly endpoints allowed without valid browser session,
+			// subject to the peer's view capabilities, checked by serveAPI.
+			return true
 		case strings.HasPrefix(r.URL.Path, "/api/"):
 			// All other /api/ endpoints require a valid browser session.
 			if err != nil || !session.isAuthorized(s.timeNow()) {
@@ -496,6 +505,37 @@ func (a *apiHandler[data]) getPeer() (peerCapabilities, error) {
 	return peer, nil
 }
 
+// serveView runs the given handler if the source peer's view
+// capabilities grant them read access to feature.
+//
+// It is used for read-only endpoints that are allowed without a
+// browser session, so that the web UI can be opened to peers that may
+// view, but not manage, this node. Access follows the peer's identity
+// and capability grants rather than a separate access token, so that it's
+// managed and revoked in the tailnet policy file like the rest of the UI.
+func (s *Server) serveView(w http.ResponseWriter, r *http.Request, feature viewFeature, h http.HandlerFunc) {
+	status, err := s.lc.StatusWithoutPeers(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	whois, err := s.lc.WhoIs(r.Context(), r.RemoteAddr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	caps, err := toViewCapabilities(status, whois)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !caps.canView(feature) {
+		http.Error(w, "not allowed", http.StatusUnauthorized)
+		return
+	}
+	h(w, r)
+}
+
 type noBodyData any // empty type, for use from serveAPI for endpoints with empty body
 
 // handle runs the given handler if the source peer satisfies the
@@ -557,6 +597,17 @@ func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if r.Method != httpm.GET && r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		// Browsers that send Sec-Fetch-Site tell us when a request was
+		// made by another site. Refuse those as a second line of defense
+		// behind the CSRF token.
+		http.Error(w, "cross-site request refused", http.StatusForbidden)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAPIRequestBody)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+
 	w.Header().Set("X-CSRF-Token", csrf.Token(r))
 	path := strings.TrimPrefix(r.URL.Path, "/api")
 	switch {
@@ -564,6 +615,30 @@ func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
 		newHandler[noBodyData](s, w, r, alwaysAllowed).
 			handle(s.serveGetNodeData)
 		return
+	case path == "/peers" && r.Method == httpm.GET:
+		s.serveView(w, r, viewFeaturePeers, s.serveGetPeers)
+		return
+	case path == "/logs" && r.Method == httpm.GET:
+		s.serveView(w, r, viewFeatureLogs, s.serveGetLogs)
+		return
+	case path == "/serve-config" && r.Method == httpm.GET:
+		newHandler[noBodyData](s, w, r, alwaysAllowed).
+			handle(s.serveGetServeConfig)
+		return
+	case path == "/serve-config" && r.Method == httpm.POST:
+		peerAllowed := func(d serveConfigData, p peerCapabilities) bool {
+			if !p.canEdit(capFeatureServe) {
+				return false
+			}
+			return !d.Config.IsFunnelOn() || p.canEdit(capFeatureFunnel)
+		}
+		newHandler[serveConfigData](s, w, r, peerAllowed).
+			handleJSON(s.servePostServeConfig)
+		return
+	case path == "/netcheck" && r.Method == httpm.POST:
+		newHandler[noBodyData](s, w, r, alwaysAllowed).
+			handle(s.servePostNetcheck)
+		return
 	case path == "/exit-nodes" && r.Method == httpm.GET:
 		newHandler[noBodyData](s, w, r, alwaysAllowed).
 			handle(s.serveGetExitNodes)
@@ -624,6 +699,10 @@ func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "invalid endpoint", http.StatusNotFound)
 }
 
+// maxAPIRequestBody is the maximum size of the body of a request to the web
+// client API.
+const maxAPIRequestBody = 1 << 20
+
 type authResponse struct {
 	ServerMode     ServerMode      `json:"serverMode"`
 	Authorized     bool            `json:"authorized"` // has an authorized management session
@@ -639,6 +718,10 @@ type viewerIdentity struct {
 	NodeIP        string           `json:"nodeIP"`
 	ProfilePicURL string           `json:"profilePicUrl,omitempty"`
 	Capabilities  peerCapabilities `json:"capabilities"` // features peer is allowed to edit
+
+	// ViewCapabilities are the features peer is allowed to view
+	// without a management session.
+	ViewCapabilities viewCapabilities `json:"viewCapabilities,omitempty"`
 }
 
 // serverAPIAuth handles requests to the /api/auth endpoint
@@ -656,11 +739,18 @@ func (s *Server) serveAPIAuth(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, sErr.Error(), http.StatusInternalServerError)
 			return
 		}
+		viewCaps, err := toViewCapabilities(status, whois)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		resp.ViewerIdentity = &viewerIdentity{
 			LoginName:     whois.UserProfile.LoginName,
 			NodeName:      whois.Node.Name,
 			ProfilePicURL: whois.UserProfile.ProfilePicURL,
 			Capabilities:  caps,
+
+			ViewCapabilities: viewCaps,
 		}
 		if addrs := whois.Node.Addresses; len(addrs) > 0 {
 			resp.ViewerIdentity.NodeIP = addrs[0].Addr().String()
@@ -829,6 +919,8 @@ type nodeData struct {
 	AdvertisedRoutes            []subnetRoute // excludes exit node routes
 	RunningSSHServer            bool
 
+	Health []string // health warnings, if any
+
 	ClientVersion *tailcfg.ClientVersion
 
 	// whether tailnet ACLs allow access to port 5252 on this device
@@ -883,6 +975,7 @@ func (s *Server) serveGetNodeData(w http.ResponseWriter, r *http.Request) {
 		ControlAdminURL:  prefs.AdminPageURL(),
 		LicensesURL:      licenses.LicensesURL(),
 		Features:         availableFeatures(),
+		Health:           st.Health,
 
 		ACLAllowsAnyIncomingTraffic: s.aclsAllowAccess(filterRules),
 	}
@@ -1209,6 +1302,185 @@ func (s *Server) serveTailscaleUp(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// serveConfigData is the body of requests to and responses from the
+// /api/serve-config endpoint.
+type serveConfigData struct {
+	Config *ipn.ServeConfig
+	ETag   string // of Config; a POST fails if the config has changed since
+}
+
+func (s *Server) serveGetServeConfig(w http.ResponseWriter, r *http.Request) {
+	sc, err := s.lc.GetServeConfig(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, serveConfigData{Config: sc, ETag: sc.ETag})
+}
+
+// servePostServeConfig replaces the serve config with data.Config, provided
+// it hasn't changed since it was fetched with the given ETag.
+func (s *Server) servePostServeConfig(ctx context.Context, data serveConfigData) error {
+	sc := data.Config
+	if sc == nil {
+		sc = new(ipn.ServeConfig)
+	}
+	sc.ETag = data.ETag
+	return s.lc.SetServeConfig(ctx, sc)
+}
+
+// netcheckData is the response of the /api/netcheck endpoint, summarizing a
+// netcheck.Report.
+type netcheckData struct {
+	UDP                   bool
+	IPv4                  bool
+	IPv6                  bool
+	GlobalV4              string   `json:",omitempty"`
+	GlobalV6              string   `json:",omitempty"`
+	MappingVariesByDestIP opt.Bool `json:",omitempty"`
+	CaptivePortal         opt.Bool `json:",omitempty"`
+	PreferredDERP         string   `json:",omitempty"` // name of the region
+	DERPLatency           []derpLatency
+}
+
+type derpLatency struct {
+	Region  string
+	Latency float64 // in seconds
+}
+
+// servePostNetcheck runs a netcheck from this device, like
+// "tailscale netcheck", and reports its results.
+func (s *Server) servePostNetcheck(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	dm, err := s.lc.CurrentDERPMap(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c := &netcheck.Client{
+		NetMon: netmon.NewStatic(),
+		Logf:   logger.WithPrefix(s.logf, "netcheck: "),
+	}
+	if err := c.Standalone(ctx, ""); err != nil {
+		s.logf("netcheck: UDP test failure: %v", err)
+	}
+	report, err := c.GetReport(ctx, dm, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	regionName := func(id int) string {
+		if r := dm.Regions[id]; r != nil {
+			return r.RegionName
+		}
+		return fmt.Sprint(id)
+	}
+	data := netcheckData{
+		UDP:                   report.UDP,
+		IPv4:                  report.IPv4,
+		IPv6:                  report.IPv6,
+		MappingVariesByDestIP: report.MappingVariesByDestIP,
+		CaptivePortal:         report.CaptivePortal,
+	}
+	if report.GlobalV4.IsValid() {
+		data.GlobalV4 = report.GlobalV4.String()
+	}
+	if report.GlobalV6.IsValid() {
+		data.GlobalV6 = report.GlobalV6.String()
+	}
+	if report.PreferredDERP != 0 {
+		data.PreferredDERP = regionName(report.PreferredDERP)
+	}
+	for id, d := range report.RegionLatency {
+		data.DERPLatency = append(data.DERPLatency, derpLatency{Region: regionName(id), Latency: d.Seconds()})
+	}
+	slices.SortFunc(data.DERPLatency, func(a, b derpLatency) int {
+		return cmp.Compare(a.Latency, b.Latency)
+	})
+	writeJSON(w, data)
+}
+
+// peerData describes a peer of this node, as returned by the
+// /api/peers endpoint.
+type peerData struct {
+	ID           tailcfg.StableNodeID
+	Name         string // DNS name, without the tailnet suffix
+	OS           string
+	TailscaleIPs []netip.Addr
+	Online       bool
+	Active       bool      // has recently exchanged traffic with this node
+	LastSeen     time.Time // only set if offline
+	CurAddr      string    // direct endpoint in use, if any
+	Relay        string    // DERP region used to reach the peer otherwise
+	ExitNode     bool      // the exit node in use by this node
+	RxBytes      int64
+	TxBytes      int64
+}
+
+// serveGetPeers serves the /api/peers endpoint, listing this node's
+// peers and how this node is connected to each of them.
+func (s *Server) serveGetPeers(w http.ResponseWriter, r *http.Request) {
+	st, err := s.lc.Status(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	peers := make([]peerData, 0, len(st.Peer))
+	for _, ps := range st.Peer {
+		peers = append(peers, peerData{
+			ID:           ps.ID,
+			Name:         strings.Split(ps.DNSName, ".")[0],
+			OS:           ps.OS,
+			TailscaleIPs: ps.TailscaleIPs,
+			Online:       ps.Online,
+			Active:       ps.Active,
+			LastSeen:     ps.LastSeen,
+			CurAddr:      ps.CurAddr,
+			Relay:        ps.Relay,
+			ExitNode:     ps.ExitNode,
+			RxBytes:      ps.RxBytes,
+			TxBytes:      ps.TxBytes,
+		})
+	}
+	slices.SortFunc(peers, func(a, b peerData) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+	writeJSON(w, peers)
+}
+
+// serveGetLogs serves the /api/logs endpoint, streaming the tailscaled
+// logs to the client as they're written until the request is canceled.
+func (s *Server) serveGetLogs(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	logs, err := s.lc.TailDaemonLogs(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := logs.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			f.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
 // serveDeviceDetailsClick increments the web_client_device_details_click metric
 // by one.
 //
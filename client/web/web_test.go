@@ -96,6 +96,8 @@ func TestServeAPI(t *testing.T) {
 	remoteUser := &tailcfg.UserProfile{ID: tailcfg.UserID(1)}
 	remoteIPWithAllCapabilities := "100.100.100.101"
 	remoteIPWithNoCapabilities := "100.100.100.102"
+	remoteIPWithViewCapabilities := "100.100.100.103"
+	viewerTags := views.SliceOf([]string{"tag:helpdesk"})
 
 	lal := memnet.Listen("local-tailscaled.sock:80")
 	defer lal.Close()
@@ -110,6 +112,11 @@ func TestServeAPI(t *testing.T) {
 				Node:        &tailcfg.Node{StableID: "node2"},
 				UserProfile: remoteUser,
 			},
+			remoteIPWithViewCapabilities: {
+				Node:        &tailcfg.Node{StableID: "node3", Tags: viewerTags.AsSlice()},
+				UserProfile: remoteUser,
+				CapMap:      tailcfg.PeerCapMap{tailcfg.PeerCapabilityWebUI: []tailcfg.RawMessage{"{\"canView\":[\"peers\"]}"}},
+			},
 		},
 		func() *ipnstate.PeerStatus { return self },
 		func() *ipn.Prefs { return prefs },
@@ -134,6 +141,7 @@ type requestTest struct {
 		reqPath        string
 		reqMethod      string
 		reqContentType string
+		reqFetchSite   string // Sec-Fetch-Site header
 		reqBody        string
 		tests          []requestTest
 	}{{
@@ -209,6 +217,69 @@ type requestTest struct {
 			remoteIP:   remoteIPWithAllCapabilities,
 			wantStatus: http.StatusOK,
 		}},
+	}, {
+		reqPath:   "/peers",
+		reqMethod: httpm.GET,
+		tests: []requestTest{{
+			remoteIP:     remoteIPWithNoCapabilities,
+			wantResponse: "not allowed",
+			wantStatus:   http.StatusUnauthorized,
+		}, {
+			remoteIP:     remoteIPWithViewCapabilities,
+			wantResponse: "[]",
+			wantStatus:   http.StatusOK,
+		}, {
+			remoteIP:     remoteIPWithAllCapabilities,
+			wantResponse: "[]",
+			wantStatus:   http.StatusOK,
+		}},
+	}, {
+		reqPath:   "/logs",
+		reqMethod: httpm.GET,
+		tests: []requestTest{{
+			remoteIP:     remoteIPWithViewCapabilities, // can view peers, but not logs
+			wantResponse: "not allowed",
+			wantStatus:   http.StatusUnauthorized,
+		}},
+	}, {
+		reqPath:   "/routes",
+		reqMethod: httpm.POST,
+		reqBody:   "{\"setExitNode\":true}",
+		tests: []requestTest{{
+			remoteIP:     remoteIPWithViewCapabilities,
+			wantResponse: "not allowed", // viewers can't make changes
+			wantStatus:   http.StatusUnauthorized,
+		}},
+	}, {
+		reqPath:   "/serve-config",
+		reqMethod: httpm.GET,
+		tests: []requestTest{{
+			remoteIP:     remoteIPWithNoCapabilities,
+			wantResponse: `{"Config":{},"ETag":"etag"}`,
+			wantStatus:   http.StatusOK,
+		}},
+	}, {
+		reqPath:   "/serve-config",
+		reqMethod: httpm.POST,
+		reqBody:   `{"Config":{"AllowFunnel":{"foo.test.ts.net:443":true}},"ETag":"etag"}`,
+		tests: []requestTest{{
+			remoteIP:     remoteIPWithNoCapabilities,
+			wantResponse: "not allowed",
+			wantStatus:   http.StatusUnauthorized,
+		}, {
+			remoteIP:   remoteIPWithAllCapabilities,
+			wantStatus: http.StatusOK,
+		}},
+	}, {
+		reqPath:      "/routes",
+		reqMethod:    httpm.POST,
+		reqBody:      "{\"setExitNode\":true}",
+		reqFetchSite: "cross-site",
+		tests: []requestTest{{
+			remoteIP:     remoteIPWithAllCapabilities,
+			wantResponse: "cross-site request refused",
+			wantStatus:   http.StatusForbidden,
+		}},
 	}, {
 		reqPath:        "/local/v0/prefs",
 		reqMethod:      httpm.PATCH,
@@ -235,6 +306,9 @@ type requestTest struct {
 				if tt.reqContentType != "" {
 					r.Header.Add("Content-Type", tt.reqContentType)
 				}
+				if tt.reqFetchSite != "" {
+					r.Header.Add("Sec-Fetch-Site", tt.reqFetchSite)
+				}
 				w := httptest.NewRecorder()
 
 				s.serveAPI(w, r)
@@ -488,6 +562,18 @@ func() *ipnstate.PeerStatus { return self },
 		wantOkNotOverTailscale: false,
 		wantOkWithoutSession:   false,
 		wantOkWithSession:      true,
+	}, {
+		reqPath:                "/api/peers",
+		reqMethod:              httpm.GET,
+		wantOkNotOverTailscale: false,
+		wantOkWithoutSession:   true, // subject to view capabilities
+		wantOkWithSession:      true,
+	}, {
+		reqPath:                "/api/peers",
+		reqMethod:              httpm.POST,
+		wantOkNotOverTailscale: false,
+		wantOkWithoutSession:   false,
+		wantOkWithSession:      true,
 	}, {
 		reqPath:                "/api/somethingelse",
 		reqMethod:              httpm.GET,
@@ -549,6 +635,8 @@ func TestServeAuth(t *testing.T) {
 		NodeIP:        remoteIP,
 		ProfilePicURL: user.ProfilePicURL,
 		Capabilities:  peerCapabilities{capFeatureAll: true},
+
+		ViewCapabilities: viewCapabilities{viewFeatureAll: true},
 	}
 
 	testControlURL := &defaultControlURL
@@ -1356,6 +1444,85 @@ func TestPeerCapabilities(t *testing.T) {
 		})
 	}
 
+	// Testing web.toViewCapabilities
+	toViewCapsTests := []struct {
+		name     string
+		status   *ipnstate.Status
+		whois    *apitype.WhoIsResponse
+		wantCaps viewCapabilities
+	}{
+		{
+			name:     "empty-whois",
+			status:   tagOwnedStatus,
+			whois:    nil,
+			wantCaps: viewCapabilities{},
+		},
+		{
+			name:   "user-owned-node-owner",
+			status: userOwnedStatus,
+			whois: &apitype.WhoIsResponse{
+				UserProfile: &tailcfg.UserProfile{ID: tailcfg.UserID(1)},
+				Node:        &tailcfg.Node{ID: tailcfg.NodeID(1)},
+			},
+			wantCaps: viewCapabilities{viewFeatureAll: true},
+		},
+		{
+			name:   "user-owned-node-non-owner-viewer",
+			status: userOwnedStatus,
+			whois: &apitype.WhoIsResponse{
+				UserProfile: &tailcfg.UserProfile{ID: tailcfg.UserID(2)},
+				Node:        &tailcfg.Node{ID: tailcfg.NodeID(1)},
+				CapMap: tailcfg.PeerCapMap{
+					tailcfg.PeerCapabilityWebUI: []tailcfg.RawMessage{
+						"{\"canEdit\":[\"ssh\"],\"canView\":[\"peers\"]}",
+					},
+				},
+			},
+			wantCaps: viewCapabilities{viewFeaturePeers: true},
+		},
+		{
+			name:   "tag-owned-editor",
+			status: tagOwnedStatus,
+			whois: &apitype.WhoIsResponse{
+				Node: &tailcfg.Node{ID: tailcfg.NodeID(1)},
+				CapMap: tailcfg.PeerCapMap{
+					tailcfg.PeerCapabilityWebUI: []tailcfg.RawMessage{
+						"{\"canEdit\":[\"ssh\"]}",
+					},
+				},
+			},
+			wantCaps: viewCapabilities{viewFeatureAll: true},
+		},
+		{
+			name:   "tagged-viewer-invalid-features-ignored",
+			status: tagOwnedStatus,
+			whois: &apitype.WhoIsResponse{
+				Node: &tailcfg.Node{ID: tailcfg.NodeID(1), Tags: []string{"tag:helpdesk"}},
+				CapMap: tailcfg.PeerCapMap{
+					tailcfg.PeerCapabilityWebUI: []tailcfg.RawMessage{
+						"{\"canView\":[\"Peers\",\"unknown\"]}",
+						"{\"canView\":[\"logs\"]}",
+					},
+				},
+			},
+			wantCaps: viewCapabilities{viewFeaturePeers: true, viewFeatureLogs: true},
+		},
+	}
+	for _, tt := range toViewCapsTests {
+		t.Run("toViewCapabilities-"+tt.name, func(t *testing.T) {
+			got, err := toViewCapabilities(tt.status, tt.whois)
+			if err != nil {
+				t.Fatalf("unexpected: %v", err)
+			}
+			if diff := cmp.Diff(got, tt.wantCaps); diff != "" {
+				t.Errorf("wrong caps; (-got+want):%v", diff)
+			}
+			if got.canView(viewFeatureLogs) != (tt.wantCaps[viewFeatureAll] || tt.wantCaps[viewFeatureLogs]) {
+				t.Errorf("wrong canView(%s)", viewFeatureLogs)
+			}
+		})
+	}
+
 	// Testing web.peerCapabilities.canEdit
 	canEditTests := []struct {
 		name        string
@@ -1456,6 +1623,16 @@ type metricName struct {
 		case "/localapi/v0/logout":
 			fmt.Fprintf(w, "success")
 			return
+		case "/localapi/v0/serve-config":
+			if r.Method == httpm.POST {
+				if r.Header.Get("If-Match") != "etag" {
+					http.Error(w, "etag mismatch", http.StatusPreconditionFailed)
+				}
+				return
+			}
+			w.Header().Set("Etag", "etag")
+			writeJSON(w, ipn.ServeConfig{})
+			return
 		default:
 			t.Fatalf("unhandled localapi test endpoint %q, add to localapi handler func in test", r.URL.Path)
 		}
@@ -6,28 +6,76 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"os/exec"
 	"sync"
+	"time"
 )
 
+// checkCommandTimeout is how long a user-provided health or readiness check
+// command may run before it is considered failed.
+const checkCommandTimeout = 5 * time.Second
+
 // healthz is a simple health check server, if enabled it returns 200 OK if
-// this tailscale node currently has at least one tailnet IP address else
-// returns 503.
+// this tailscale node currently has at least one tailnet IP address and the
+// optional TS_HEALTH_CHECK_COMMAND succeeds, else returns 503.
+//
+// It also serves a readiness check that additionally requires containerboot
+// to have finished its startup tasks (login, routing and proxy rules) and,
+// if TS_SERVE_CONFIG is set, to have applied the serve config, and the
+// optional TS_READY_CHECK_COMMAND to succeed.
 type healthz struct {
+	healthCommand string // or empty
+	readyCommand  string // or empty
+	needsServe    bool   // whether readiness requires an applied serve config
+
 	sync.Mutex
-	hasAddrs bool
+	hasAddrs     bool
+	startupDone  bool
+	serveApplied bool
 }
 
 func (h *healthz) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.Lock()
-	defer h.Unlock()
+	hasAddrs := h.hasAddrs
+	h.Unlock()
 
-	if h.hasAddrs {
-		w.Write([]byte("ok"))
-	} else {
+	if !hasAddrs {
 		http.Error(w, "node currently has no tailscale IPs", http.StatusServiceUnavailable)
+		return
+	}
+	if err := runCheckCommand(r.Context(), h.healthCommand); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
 	}
+	w.Write([]byte("ok"))
+}
+
+func (h *healthz) serveReady(w http.ResponseWriter, r *http.Request) {
+	h.Lock()
+	hasAddrs, startupDone, serveApplied := h.hasAddrs, h.startupDone, h.serveApplied
+	h.Unlock()
+
+	switch {
+	case !hasAddrs:
+		http.Error(w, "node currently has no tailscale IPs", http.StatusServiceUnavailable)
+		return
+	case !startupDone:
+		http.Error(w, "startup tasks not yet complete", http.StatusServiceUnavailable)
+		return
+	case h.needsServe && !serveApplied:
+		http.Error(w, "serve config not yet applied", http.StatusServiceUnavailable)
+		return
+	}
+	if err := runCheckCommand(r.Context(), h.readyCommand); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
 }
 
 func (h *healthz) update(healthy bool) {
@@ -40,11 +88,56 @@ func (h *healthz) update(healthy bool) {
 	h.hasAddrs = healthy
 }
 
-// healthHandlers registers a simple health handler at /healthz.
+// setStartupDone marks containerboot's startup tasks as complete. It is a
+// no-op on a nil healthz.
+func (h *healthz) setStartupDone() {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.startupDone = true
+}
+
+// setServeConfigApplied marks the serve config as applied. It is a no-op on
+// a nil healthz.
+func (h *healthz) setServeConfigApplied() {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.serveApplied = true
+}
+
+// healthHandlers registers a simple health handler at /healthz and a
+// readiness handler at /readyz.
 // A containerized tailscale instance is considered healthy if
-// it has at least one tailnet IP address.
-func healthHandlers(mux *http.ServeMux) *healthz {
-	h := &healthz{}
+// it has at least one tailnet IP address, and ready once its configuration
+// has been fully applied. See [healthz] for details.
+func healthHandlers(mux *http.ServeMux, cfg *settings) *healthz {
+	h := &healthz{
+		healthCommand: cfg.HealthCheckCommand,
+		readyCommand:  cfg.ReadyCheckCommand,
+		needsServe:    cfg.ServeConfigPath != "",
+	}
 	mux.Handle("GET /healthz", h)
+	mux.HandleFunc("GET /readyz", h.serveReady)
 	return h
 }
+
+// runCheckCommand runs the shell command command, returning an error
+// including its output if it fails or doesn't complete within
+// checkCommandTimeout. An empty command always succeeds.
+func runCheckCommand(ctx context.Context, command string) error {
+	if command == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, checkCommandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "/bin/sh", "-c", command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("check command %q failed: %v\n%s", command, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"tailscale.com/client/tailscale"
+	"tailscale.com/ipn"
+	"tailscale.com/types/netmap"
+	"tailscale.com/util/deephash"
+	"tailscale.com/util/linuxfw"
+)
+
+// runInitMode is the steady state of containerboot when
+// TS_EXPERIMENTAL_INIT_MODE is set. It waits for a netmap, programs the
+// netfilter rules for the configured proxy target once, records the
+// device's details in the state Secret, writes cfg.ReadyFile and then only
+// supervises tailscaled.
+//
+// Unlike the main loop, it does not reconfigure anything afterwards. If
+// tailscaled leaves the running state, or the tailnet IPs of this node or
+// the tailnet target change, it exits so that the container runtime
+// restarts it and the rules are programmed afresh. It returns when ctx is
+// done; if tailscaled exits first, containerboot exits with its status.
+func runInitMode(ctx context.Context, cfg *settings, client *tailscale.LocalClient, kc *kubeClient, daemonProcess *os.Process, healthCheck *healthz) {
+	fatalf := func(format string, args ...any) {
+		removeReadyFile(cfg)
+		log.Fatalf(format, args...)
+	}
+
+	w, err := client.WatchIPNBus(ctx, ipn.NotifyInitialNetMap|ipn.NotifyInitialState)
+	if err != nil {
+		fatalf("rewatching tailscaled for updates after auth: %v", err)
+	}
+	defer w.Close()
+
+	var nfr linuxfw.NetfilterRunner
+	if isL3Proxy(cfg) {
+		nfr, err = newNetfilterRunner(log.Printf)
+		if err != nil {
+			fatalf("error creating new netfilter runner: %v", err)
+		}
+	}
+
+	var nm *netmap.NetworkMap
+	for nm == nil {
+		n, err := w.Next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fatalf("failed to read from tailscaled: %v", err)
+		}
+		if n.State != nil && *n.State != ipn.Running {
+			fatalf("tailscaled left running state (now in state %q), exiting", *n.State)
+		}
+		if n.NetMap == nil || n.NetMap.SelfNode.Addresses().Len() == 0 {
+			continue
+		}
+		if cfg.TailnetTargetFQDN != "" {
+			if _, ok := initModeEgressTarget(cfg, n.NetMap); !ok {
+				log.Printf("Tailscale node %q not found; it either does not exist, or not reachable because of ACLs", cfg.TailnetTargetFQDN)
+				continue
+			}
+		}
+		nm = n.NetMap
+	}
+
+	// As in the main loop, store the device ID before setting up any
+	// routing rules so that the operator can clean up the device if the
+	// route setup fails.
+	if hasKubeStateStore(cfg) {
+		if err := kc.storeDeviceID(ctx, nm.SelfNode.StableID()); err != nil {
+			fatalf("storing device ID in Kubernetes Secret: %v", err)
+		}
+	}
+	addrs := nm.SelfNode.Addresses().AsSlice()
+	if err := installInitModeRules(ctx, cfg, nm, addrs, nfr); err != nil {
+		fatalf("%v", err)
+	}
+	if hasKubeStateStore(cfg) {
+		if err := kc.storeDeviceEndpoints(ctx, nm.SelfNode.Name(), addrs); err != nil {
+			fatalf("storing device IPs and FQDN in Kubernetes Secret: %v", err)
+		}
+	}
+	if cfg.ReadyFile != "" {
+		if err := writeReadyFile(cfg.ReadyFile, nm.SelfNode.Name(), addrs); err != nil {
+			fatalf("writing ready file: %v", err)
+		}
+	}
+	if healthCheck != nil {
+		healthCheck.update(true)
+		healthCheck.setStartupDone()
+	}
+	// This log message is used in tests to detect when all post-auth
+	// configuration is done.
+	log.Println("Startup complete, waiting for shutdown signal")
+
+	currentIPs := deephash.Hash(&addrs)
+	var currentEgressIPs deephash.Sum
+	if cfg.TailnetTargetFQDN != "" {
+		egressAddrs, _ := initModeEgressTarget(cfg, nm)
+		currentEgressIPs = deephash.Hash(&egressAddrs)
+	}
+
+	exited := make(chan unix.WaitStatus, 1)
+	go func() {
+		for {
+			var status unix.WaitStatus
+			_, err := unix.Wait4(daemonProcess.Pid, &status, 0, nil)
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			if err != nil {
+				fatalf("Waiting for tailscaled to exit: %v", err)
+			}
+			exited <- status
+			return
+		}
+	}()
+	notifyChan := make(chan ipn.Notify)
+	errChan := make(chan error, 1)
+	go func() {
+		for {
+			n, err := w.Next()
+			if err != nil {
+				errChan <- err
+				return
+			}
+			notifyChan <- n
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			removeReadyFile(cfg)
+			return
+		case status := <-exited:
+			removeReadyFile(cfg)
+			code := status.ExitStatus()
+			if code < 0 {
+				code = 1 // killed by a signal
+			}
+			log.Printf("tailscaled exited: %v", status)
+			os.Exit(code)
+		case err := <-errChan:
+			if ctx.Err() != nil {
+				continue
+			}
+			fatalf("failed to read from tailscaled: %v", err)
+		case n := <-notifyChan:
+			if n.State != nil && *n.State != ipn.Running {
+				fatalf("tailscaled left running state (now in state %q), exiting", *n.State)
+			}
+			if n.NetMap == nil {
+				continue
+			}
+			newAddrs := n.NetMap.SelfNode.Addresses().AsSlice()
+			if deephash.Hash(&newAddrs) != currentIPs {
+				fatalf("tailnet IPs of this node changed from %v to %v, exiting to reprogram proxy rules", addrs, newAddrs)
+			}
+			if cfg.TailnetTargetFQDN != "" {
+				egressAddrs, _ := initModeEgressTarget(cfg, n.NetMap)
+				if deephash.Hash(&egressAddrs) != currentEgressIPs {
+					fatalf("tailnet IPs of %q changed to %v, exiting to reprogram proxy rules", cfg.TailnetTargetFQDN, egressAddrs)
+				}
+			}
+		}
+	}
+}
+
+// initModeEgressTarget returns the tailnet IPs of the peer named by
+// cfg.TailnetTargetFQDN in nm, and whether it was found.
+func initModeEgressTarget(cfg *settings, nm *netmap.NetworkMap) ([]netip.Prefix, bool) {
+	for _, p := range nm.Peers {
+		if strings.EqualFold(p.Name(), cfg.TailnetTargetFQDN) {
+			return p.Addresses().AsSlice(), true
+		}
+	}
+	return nil, false
+}
+
+// installInitModeRules programs the netfilter rules for the proxy target
+// configured in cfg, for a node with the tailnet IPs addrs.
+func installInitModeRules(ctx context.Context, cfg *settings, nm *netmap.NetworkMap, addrs []netip.Prefix, nfr linuxfw.NetfilterRunner) error {
+	if cfg.ProxyTargetIP != "" {
+		log.Printf("Installing proxy rules")
+		if err := installIngressForwardingRule(ctx, cfg.ProxyTargetIP, addrs, nfr); err != nil {
+			return fmt.Errorf("installing ingress proxy rules: %w", err)
+		}
+	}
+	if cfg.TailnetTargetIP != "" {
+		log.Printf("Installing forwarding rules for destination %v", cfg.TailnetTargetIP)
+		if err := installEgressForwardingRule(ctx, cfg.TailnetTargetIP, addrs, nfr); err != nil {
+			return fmt.Errorf("installing egress proxy rules: %w", err)
+		}
+	}
+	if cfg.TailnetTargetFQDN != "" {
+		egressAddrs, _ := initModeEgressTarget(cfg, nm)
+		var rulesInstalled bool
+		for _, egressAddr := range egressAddrs {
+			ea := egressAddr.Addr()
+			if ea.Is4() || (ea.Is6() && nfr.HasIPV6NAT()) {
+				rulesInstalled = true
+				log.Printf("Installing forwarding rules for destination %v", ea.String())
+				if err := installEgressForwardingRule(ctx, ea.String(), addrs, nfr); err != nil {
+					return fmt.Errorf("installing egress proxy rules for destination %s: %w", ea.String(), err)
+				}
+			}
+		}
+		if !rulesInstalled {
+			return fmt.Errorf("no forwarding rules for egress addresses %v, host supports IPv6: %v", egressAddrs, nfr.HasIPV6NAT())
+		}
+	}
+	return nil
+}
+
+// writeReadyFile atomically writes the node's MagicDNS name, followed by
+// its tailnet IPs, one per line, to path.
+func writeReadyFile(path, fqdn string, addrs []netip.Prefix) error {
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSuffix(fqdn, "."))
+	sb.WriteByte('\n')
+	for _, a := range addrs {
+		sb.WriteString(a.Addr().String())
+		sb.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeReadyFile removes cfg.ReadyFile, if any, so that nothing mistakes a
+// stopped proxy for a ready one.
+func removeReadyFile(cfg *settings) {
+	if cfg.ReadyFile == "" {
+		return
+	}
+	if err := os.Remove(cfg.ReadyFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("failed to remove ready file: %v", err)
+	}
+}
@@ -88,6 +88,31 @@ func (kc *kubeClient) storeHTTPSEndpoint(ctx context.Context, ep string) error {
 	return kc.StrategicMergePatchSecret(ctx, kc.stateSecret, s, "tailscale-container")
 }
 
+// storeHTTPSCertDomain writes the domain of the TLS cert that this device has
+// issued for its Funnel endpoint to the client's state Secret.
+func (kc *kubeClient) storeHTTPSCertDomain(ctx context.Context, domain string) error {
+	s := &kubeapi.Secret{
+		Data: map[string][]byte{
+			kubetypes.KeyHTTPSCertDomain: []byte(domain),
+		},
+	}
+	return kc.StrategicMergePatchSecret(ctx, kc.stateSecret, s, "tailscale-container")
+}
+
+// storeProxyStats writes stats to the 'proxy_stats' field of the client's state Secret.
+func (kc *kubeClient) storeProxyStats(ctx context.Context, stats *kubetypes.ProxyStats) error {
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	s := &kubeapi.Secret{
+		Data: map[string][]byte{
+			kubetypes.KeyProxyStats: b,
+		},
+	}
+	return kc.StrategicMergePatchSecret(ctx, kc.stateSecret, s, "tailscale-container")
+}
+
 // deleteAuthKey deletes the 'authkey' field of the given kube
 // secret. No-op if there is no authkey in the secret.
 func (kc *kubeClient) deleteAuthKey(ctx context.Context) error {
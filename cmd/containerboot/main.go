@@ -64,6 +64,13 @@
 //     the address specified by TS_LOCAL_ADDR_PORT. The health endpoint will return 200
 //     OK if this node has at least one tailnet IP address, otherwise returns 503.
 //     NB: the health criteria might change in the future.
+//     A readiness endpoint is also served at /readyz. It only returns 200 OK
+//     once, additionally, containerboot has completed its startup tasks (login,
+//     routes and proxy rules) and applied the TS_SERVE_CONFIG, if set.
+//   - TS_HEALTH_CHECK_COMMAND: if set, a shell command that is run on each
+//     request to /healthz. The health check only passes if it exits
+//     successfully within 5 seconds. Requires TS_ENABLE_HEALTH_CHECK.
+//   - TS_READY_CHECK_COMMAND: like TS_HEALTH_CHECK_COMMAND, but for /readyz.
 //   - TS_EXPERIMENTAL_VERSIONED_CONFIG_DIR: if specified, a path to a
 //     directory that containers tailscaled config in file. The config file needs to be
 //     named cap-<current-tailscaled-cap>.hujson. If this is set, TS_HOSTNAME,
@@ -87,6 +94,20 @@
 //     cluster using the same hostname (in this case, the MagicDNS name of the ingress proxy)
 //     as a non-cluster workload on tailnet.
 //     This is only meant to be configured by the Kubernetes operator.
+//   - TS_EXPERIMENTAL_INIT_MODE: if set to true, containerboot programs the
+//     netfilter rules for TS_DEST_IP, TS_TAILNET_TARGET_IP or
+//     TS_TAILNET_TARGET_FQDN once tailscaled is up, and then only waits on
+//     tailscaled. It does not reconfigure anything at runtime; instead it
+//     exits if tailscaled leaves the running state or the relevant tailnet
+//     IPs change, so that the container runtime restarts it. This lets a
+//     single container act as the proxy for a Pod's network namespace without
+//     a long-running reconciliation loop. Requires kernel networking
+//     (TS_USERSPACE=false), and cannot be combined with TS_SERVE_CONFIG,
+//     TS_EGRESS_SERVICES_CONFIG_PATH or TS_EXPERIMENTAL_DEST_DNS_NAME.
+//     NB: This env var is currently experimental and the logic will likely change!
+//   - TS_READY_FILE: in init mode, the path of a file to write once the proxy
+//     rules are in place. It contains the node's MagicDNS name followed by its
+//     tailnet IPs, one per line, and is removed when containerboot exits.
 //
 // When running on Kubernetes, containerboot defaults to storing state in the
 // "tailscale" kube secret. To store state on local disk instead, set
@@ -195,7 +216,7 @@ func main() {
 		mux := http.NewServeMux()
 
 		log.Printf("Running healthcheck endpoint at %s/healthz", cfg.HealthCheckAddrPort)
-		healthCheck = healthHandlers(mux)
+		healthCheck = healthHandlers(mux, cfg)
 
 		close := runHTTPServer(mux, cfg.HealthCheckAddrPort)
 		defer close()
@@ -211,7 +232,7 @@ func main() {
 
 		if cfg.localHealthEnabled() {
 			log.Printf("Running healthcheck endpoint at %s/healthz", cfg.LocalAddrPort)
-			healthCheck = healthHandlers(mux)
+			healthCheck = healthHandlers(mux, cfg)
 		}
 
 		close := runHTTPServer(mux, cfg.LocalAddrPort)
@@ -352,6 +373,11 @@ func main() {
 		}
 	}
 
+	if cfg.InitMode {
+		runInitMode(ctx, cfg, client, kc, daemonProcess, healthCheck)
+		return
+	}
+
 	w, err = client.WatchIPNBus(ctx, ipn.NotifyInitialNetMap|ipn.NotifyInitialState)
 	if err != nil {
 		log.Fatalf("rewatching tailscaled for updates after auth: %v", err)
@@ -372,7 +398,15 @@ func main() {
 		certDomainChanged = make(chan bool, 1)
 
 		triggerWatchServeConfigChanges sync.Once
+
+		// stats is set for proxies that store state in a Kubernetes
+		// Secret, and once startup is done periodically writes the
+		// proxy's connection stats to it.
+		stats *statsReporter
 	)
+	if hasKubeStateStore(cfg) {
+		stats = &statsReporter{kc: kc, lc: client, root: cfg.Root, pid: daemonProcess.Pid}
+	}
 
 	var nfr linuxfw.NetfilterRunner
 	if isL3Proxy(cfg) {
@@ -460,6 +494,9 @@ func main() {
 				log.Fatalf("tailscaled left running state (now in state %q), exiting", *n.State)
 			}
 			if n.NetMap != nil {
+				if stats != nil {
+					stats.netmapUpdated()
+				}
 				addrs = n.NetMap.SelfNode.Addresses().AsSlice()
 				newCurrentIPs := deephash.Hash(&addrs)
 				ipsHaveChanged := newCurrentIPs != currentIPs
@@ -604,7 +641,7 @@ func main() {
 
 				if cfg.ServeConfigPath != "" {
 					triggerWatchServeConfigChanges.Do(func() {
-						go watchServeConfigChanges(ctx, cfg.ServeConfigPath, certDomainChanged, certDomain, client, kc)
+						go watchServeConfigChanges(ctx, cfg.ServeConfigPath, certDomainChanged, certDomain, client, kc, healthCheck)
 					})
 				}
 
@@ -623,6 +660,11 @@ func main() {
 					// post-auth configuration is done.
 					log.Println("Startup complete, waiting for shutdown signal")
 					startupTasksDone = true
+					healthCheck.setStartupDone()
+
+					if stats != nil {
+						go stats.run(ctx)
+					}
 
 					// Configure egress proxy. Egress proxy will set up firewall rules to proxy
 					// traffic to tailnet targets configured in the provided configuration file. It
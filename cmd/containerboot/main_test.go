@@ -119,6 +119,9 @@ func TestContainerBoot(t *testing.T) {
 	healthURL := func(port int) string {
 		return fmt.Sprintf("http://127.0.0.1:%d/healthz", port)
 	}
+	readyURL := func(port int) string {
+		return fmt.Sprintf("http://127.0.0.1:%d/readyz", port)
+	}
 
 	capver := fmt.Sprintf("%d", tailcfg.CurrentCapabilityVersion)
 
@@ -389,6 +392,46 @@ type phase struct {
 				},
 			},
 		},
+		{
+			Name: "init_mode_egress_proxy",
+			Env: map[string]string{
+				"TS_AUTHKEY":                "tskey-key",
+				"TS_TAILNET_TARGET_IP":      "100.99.99.99",
+				"TS_USERSPACE":              "false",
+				"TS_EXPERIMENTAL_INIT_MODE": "true",
+				"TS_READY_FILE":             filepath.Join(d, "tmp/ready"),
+			},
+			Phases: []phase{
+				{
+					WantCmds: []string{
+						"/usr/bin/tailscaled --socket=/tmp/tailscaled.sock --state=mem: --statedir=/tmp",
+						"/usr/bin/tailscale --socket=/tmp/tailscaled.sock up --accept-dns=false --authkey=tskey-key",
+					},
+					WantFiles: map[string]string{
+						"proc/sys/net/ipv4/ip_forward":          "1",
+						"proc/sys/net/ipv6/conf/all/forwarding": "0",
+					},
+				},
+				{
+					Notify: runningNotify,
+					WantFiles: map[string]string{
+						"tmp/ready": "test-node.test.ts.net\n100.64.0.1",
+					},
+				},
+				{
+					Notify: &ipn.Notify{
+						NetMap: &netmap.NetworkMap{
+							SelfNode: (&tailcfg.Node{
+								StableID:  tailcfg.StableNodeID("myID"),
+								Name:      "test-node.test.ts.net",
+								Addresses: []netip.Prefix{netip.MustParsePrefix("100.64.0.2/32")},
+							}).View(),
+						},
+					},
+					WantFatalLog: "tailnet IPs of this node changed from [100.64.0.1/32] to [100.64.0.2/32], exiting to reprogram proxy rules",
+				},
+			},
+		},
 		{
 			Name: "egress_proxy_fqdn_ipv6_target_on_ipv4_host",
 			Env: map[string]string{
@@ -777,6 +820,52 @@ type phase struct {
 				},
 			},
 		},
+		{
+			Name: "ready_enabled",
+			Env: map[string]string{
+				"TS_LOCAL_ADDR_PORT":     fmt.Sprintf("[::]:%d", localAddrPort),
+				"TS_ENABLE_HEALTH_CHECK": "true",
+			},
+			Phases: []phase{
+				{
+					WantCmds: []string{
+						"/usr/bin/tailscaled --socket=/tmp/tailscaled.sock --state=mem: --statedir=/tmp --tun=userspace-networking",
+						"/usr/bin/tailscale --socket=/tmp/tailscaled.sock up --accept-dns=false",
+					},
+					EndpointStatuses: map[string]int{
+						readyURL(localAddrPort): 503, // Doesn't start passing until the next phase.
+					},
+				}, {
+					Notify: runningNotify,
+					EndpointStatuses: map[string]int{
+						readyURL(localAddrPort): 200,
+					},
+				},
+			},
+		},
+		{
+			Name: "health_and_ready_check_commands",
+			Env: map[string]string{
+				"TS_LOCAL_ADDR_PORT":      fmt.Sprintf("[::]:%d", localAddrPort),
+				"TS_ENABLE_HEALTH_CHECK":  "true",
+				"TS_HEALTH_CHECK_COMMAND": "true",
+				"TS_READY_CHECK_COMMAND":  "echo not yet; exit 1",
+			},
+			Phases: []phase{
+				{
+					WantCmds: []string{
+						"/usr/bin/tailscaled --socket=/tmp/tailscaled.sock --state=mem: --statedir=/tmp --tun=userspace-networking",
+						"/usr/bin/tailscale --socket=/tmp/tailscaled.sock up --accept-dns=false",
+					},
+				}, {
+					Notify: runningNotify,
+					EndpointStatuses: map[string]int{
+						healthURL(localAddrPort): 200,
+						readyURL(localAddrPort):  503, // The ready command fails.
+					},
+				},
+			},
+		},
 		{
 			Name: "metrics_and_health_on_same_port",
 			Env: map[string]string{
@@ -12,7 +12,6 @@
 	"log"
 	"os"
 	"path/filepath"
-	"reflect"
 	"sync/atomic"
 	"time"
 
@@ -20,15 +19,18 @@
 	"tailscale.com/client/tailscale"
 	"tailscale.com/ipn"
 	"tailscale.com/kube/kubetypes"
+	"tailscale.com/logtail/backoff"
 	"tailscale.com/types/netmap"
+	"tailscale.com/util/deephash"
 )
 
 // watchServeConfigChanges watches path for changes, and when it sees one, reads
 // the serve config from it, replacing ${TS_CERT_DOMAIN} with certDomain, and
 // applies it to lc. It exits when ctx is canceled. cdChanged is a channel that
 // is written to when the certDomain changes, causing the serve config to be
-// re-read and applied.
-func watchServeConfigChanges(ctx context.Context, path string, cdChanged <-chan bool, certDomainAtomic *atomic.Pointer[string], lc *tailscale.LocalClient, kc *kubeClient) {
+// re-read and applied. Once the serve config has first been applied, h (if
+// non-nil) is marked as such for readiness checks.
+func watchServeConfigChanges(ctx context.Context, path string, cdChanged <-chan bool, certDomainAtomic *atomic.Pointer[string], lc *tailscale.LocalClient, kc *kubeClient, h *healthz) {
 	if certDomainAtomic == nil {
 		panic("certDomainAtomic must not be nil")
 	}
@@ -48,7 +50,13 @@ func watchServeConfigChanges(ctx context.Context, path string, cdChanged <-chan
 	}
 
 	var certDomain string
-	var prevServeConfig *ipn.ServeConfig
+	var prevServeConfigSum deephash.Sum // zero until first applied
+	var stopIssuingCert func()
+	defer func() {
+		if stopIssuingCert != nil {
+			stopIssuingCert()
+		}
+	}()
 	for {
 		select {
 		case <-ctx.Done():
@@ -65,7 +73,7 @@ func watchServeConfigChanges(ctx context.Context, path string, cdChanged <-chan
 		if err != nil {
 			log.Fatalf("serve proxy: failed to read serve config: %v", err)
 		}
-		if prevServeConfig != nil && reflect.DeepEqual(sc, prevServeConfig) {
+		if !deephash.Update(&prevServeConfigSum, sc) {
 			continue
 		}
 		validateHTTPSServe(certDomain, sc)
@@ -75,7 +83,14 @@ func watchServeConfigChanges(ctx context.Context, path string, cdChanged <-chan
 		if err := kc.storeHTTPSEndpoint(ctx, certDomain); err != nil {
 			log.Fatalf("serve proxy: error storing HTTPS endpoint: %v", err)
 		}
-		prevServeConfig = sc
+		if stopIssuingCert != nil {
+			stopIssuingCert()
+			stopIssuingCert = nil
+		}
+		if kc != nil && hasFunnelEndpoint(sc) && certDomain != "" && certDomain != kubetypes.ValueNoHTTPS {
+			stopIssuingCert = goIssueFunnelCert(ctx, certDomain, lc, kc)
+		}
+		h.setServeConfigApplied()
 	}
 }
 
@@ -115,6 +130,49 @@ func hasHTTPSEndpoint(cfg *ipn.ServeConfig) bool {
 	return false
 }
 
+// hasFunnelEndpoint reports whether cfg exposes any endpoint to the internet
+// via Funnel.
+func hasFunnelEndpoint(cfg *ipn.ServeConfig) bool {
+	for _, allowed := range cfg.AllowFunnel {
+		if allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// goIssueFunnelCert starts issuing the TLS cert for certDomain in the
+// background, see issueFunnelCert. It returns a func to stop doing so.
+func goIssueFunnelCert(ctx context.Context, certDomain string, lc *tailscale.LocalClient, kc *kubeClient) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	go issueFunnelCert(ctx, certDomain, lc, kc)
+	return cancel
+}
+
+// issueFunnelCert gets the TLS cert for certDomain from lc, retrying until it
+// succeeds or ctx is done, so that it's issued before the first connection
+// from the internet rather than during its TLS handshake. Once the cert has
+// been issued, it records certDomain in the state Secret, for the operator to
+// know that the Funnel endpoint is ready.
+func issueFunnelCert(ctx context.Context, certDomain string, lc *tailscale.LocalClient, kc *kubeClient) {
+	bo := backoff.NewBackoff("serve proxy: funnel cert", log.Printf, 5*time.Minute)
+	for {
+		log.Printf("serve proxy: issuing TLS cert for %s", certDomain)
+		_, _, err := lc.CertPair(ctx, certDomain)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			break
+		}
+		log.Printf("serve proxy: error issuing TLS cert for %s: %v", certDomain, err)
+		bo.BackOff(ctx, err)
+	}
+	if err := kc.storeHTTPSCertDomain(ctx, certDomain); err != nil && ctx.Err() == nil {
+		log.Printf("serve proxy: error storing TLS cert domain: %v", err)
+	}
+}
+
 // readServeConfig reads the ipn.ServeConfig from path, replacing
 // ${TS_CERT_DOMAIN} with certDomain.
 func readServeConfig(path, certDomain string) (*ipn.ServeConfig, error) {
@@ -16,6 +16,7 @@
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -23,6 +24,7 @@
 	"tailscale.com/kube/egressservices"
 	"tailscale.com/kube/kubeclient"
 	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
 	"tailscale.com/util/linuxfw"
 	"tailscale.com/util/mak"
 )
@@ -57,6 +59,15 @@ type egressProxy struct {
 
 	// used to configure firewall rules.
 	tailnetAddrs []netip.Prefix
+
+	// userspaceSvcs are the currently running userspace proxies for egress
+	// services that pass on client addresses or resolve their tailnet
+	// target per connection, keyed by service name.
+	userspaceSvcs map[string]*userspaceSvc
+
+	// lastNetmap is the most recent netmap, used by userspace proxies to
+	// resolve tailnet targets per connection.
+	lastNetmap atomic.Pointer[netmap.NetworkMap]
 }
 
 // run configures egress proxy firewall rules and ensures that the firewall rules are reconfigured when:
@@ -81,6 +92,8 @@ func (ep *egressProxy) run(ctx context.Context, n ipn.Notify) error {
 		eventChan = w.Events
 	}
 
+	defer ep.closeUserspaceSvcs()
+	ep.storeNetmap(n)
 	if err := ep.sync(ctx, n); err != nil {
 		return err
 	}
@@ -95,6 +108,7 @@ func (ep *egressProxy) run(ctx context.Context, n ipn.Notify) error {
 			log.Printf("config file change detected, ensuring firewall config is up to date...")
 			err = ep.sync(ctx, n)
 		case n = <-ep.netmapChan:
+			ep.storeNetmap(n)
 			shouldResync := ep.shouldResync(n)
 			if shouldResync {
 				log.Printf("netmap change detected, ensuring firewall config is up to date...")
@@ -107,6 +121,12 @@ func (ep *egressProxy) run(ctx context.Context, n ipn.Notify) error {
 	}
 }
 
+func (ep *egressProxy) storeNetmap(n ipn.Notify) {
+	if n.NetMap != nil {
+		ep.lastNetmap.Store(n.NetMap)
+	}
+}
+
 // sync triggers an egress proxy config resync. The resync calculates the diff between config and status to determine if
 // any firewall rules need to be updated. Currently using status in state Secret as a reference for what is the current
 // firewall configuration is good enough because - the status is keyed by the Pod IP - we crash the Pod on errors such
@@ -138,10 +158,21 @@ func (ep *egressProxy) addrsHaveChanged(n ipn.Notify) bool {
 	return !reflect.DeepEqual(ep.tailnetAddrs, n.NetMap.SelfNode.Addresses())
 }
 
-// syncEgressConfigs adds and deletes firewall rules to match the desired
-// configuration. It uses the provided status to determine what is currently
-// applied and updates the status after a successful sync.
+// syncEgressConfigs adds and deletes firewall rules and userspace proxies to
+// match the desired configuration. It uses the provided status to determine
+// what is currently applied and updates the status after a successful sync.
 func (ep *egressProxy) syncEgressConfigs(cfgs *egressservices.Configs, status *egressservices.Status, n ipn.Notify) (*egressservices.Status, error) {
+	fwCfgs, usCfgs := splitConfigs(cfgs)
+	newStatus, err := ep.syncFirewallConfigs(fwCfgs, firewallStatus(status), n)
+	if err != nil {
+		return nil, err
+	}
+	return ep.syncUserspaceConfigs(usCfgs, newStatus, n)
+}
+
+// syncFirewallConfigs adds and deletes firewall rules to match the desired
+// configuration of the egress services that are proxied with firewall rules.
+func (ep *egressProxy) syncFirewallConfigs(cfgs *egressservices.Configs, status *egressservices.Status, n ipn.Notify) (*egressservices.Status, error) {
 	if !(wantsServicesConfigured(cfgs) || hasServicesConfigured(status)) {
 		return nil, nil
 	}
@@ -550,6 +581,45 @@ type rule struct {
 	protocol      string
 }
 
+// splitConfigs splits cfgs into the configs of services proxied with firewall
+// rules and of services proxied in userspace.
+func splitConfigs(cfgs *egressservices.Configs) (fw, us *egressservices.Configs) {
+	if cfgs == nil {
+		return nil, nil
+	}
+	for name, cfg := range *cfgs {
+		if cfg.ClientIP == "" && !cfg.TailnetTarget.ResolvePerConnection {
+			fw = appendConfig(fw, name, cfg)
+		} else {
+			us = appendConfig(us, name, cfg)
+		}
+	}
+	return fw, us
+}
+
+func appendConfig(cfgs *egressservices.Configs, name string, cfg egressservices.Config) *egressservices.Configs {
+	if cfgs == nil {
+		cfgs = &egressservices.Configs{}
+	}
+	(*cfgs)[name] = cfg
+	return cfgs
+}
+
+// firewallStatus returns the part of status for services proxied with firewall
+// rules.
+func firewallStatus(status *egressservices.Status) *egressservices.Status {
+	if status == nil {
+		return nil
+	}
+	fw := &egressservices.Status{PodIPv4: status.PodIPv4}
+	for name, svc := range status.Services {
+		if svc.ClientIP == "" && !svc.TailnetTarget.ResolvePerConnection {
+			mak.Set(&fw.Services, name, svc)
+		}
+	}
+	return fw
+}
+
 func wantsServicesConfigured(cfgs *egressservices.Configs) bool {
 	return cfgs != nil && len(*cfgs) != 0
 }
@@ -0,0 +1,325 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/kube/egressservices"
+	"tailscale.com/util/mak"
+)
+
+// This file contains the userspace proxying of egress services that pass the
+// addresses of cluster clients on to their tailnet targets. Firewall rules
+// would replace the client address with the proxy's tailnet address, so
+// instead the proxy terminates the cluster client's connection itself and
+// opens its own connection to the tailnet target, carrying the client address
+// in a PROXY protocol header or in HTTP headers.
+//
+// The proxy receives the client's Pod IP, as kube-proxy does not masquerade
+// traffic from Pods to ClusterIP Services.
+//
+// Egress services whose tailnet target is resolved per connection are also
+// proxied in userspace, as the proxy looks up the target's current tailnet IP
+// in the netmap for each new connection.
+
+// dialTimeout is how long the userspace proxy waits for a connection to the
+// tailnet target.
+const dialTimeout = 10 * time.Second
+
+// userspaceSvc is a running userspace proxy for an egress service.
+type userspaceSvc struct {
+	status  egressservices.ServiceStatus // what the proxy was started with
+	closers []io.Closer
+}
+
+func (s *userspaceSvc) close() {
+	for _, c := range s.closers {
+		c.Close()
+	}
+}
+
+// syncUserspaceConfigs starts, restarts and stops userspace proxies to match the
+// desired configuration of the egress services that pass on client addresses.
+// It adds the services' status to status, which may be nil.
+func (ep *egressProxy) syncUserspaceConfigs(cfgs *egressservices.Configs, status *egressservices.Status, n ipn.Notify) (*egressservices.Status, error) {
+	for svcName, svc := range ep.userspaceSvcs {
+		if cfgs != nil {
+			if _, ok := (*cfgs)[svcName]; ok {
+				continue
+			}
+		}
+		log.Printf("service %s is no longer required, stopping its userspace proxy", svcName)
+		svc.close()
+		delete(ep.userspaceSvcs, svcName)
+	}
+	if !wantsServicesConfigured(cfgs) {
+		return status, nil
+	}
+	if status == nil {
+		status = &egressservices.Status{}
+	}
+	for svcName, cfg := range *cfgs {
+		var tailnetTargetIPs []netip.Addr
+		target := ep.resolvePerConnection(cfg.TailnetTarget.FQDN)
+		if !cfg.TailnetTarget.ResolvePerConnection {
+			var err error
+			tailnetTargetIPs, err = ep.tailnetTargetIPsForSvc(cfg, n)
+			if err != nil {
+				return nil, fmt.Errorf("error determining tailnet target IPs: %w", err)
+			}
+			target = staticTarget(tailnetTargetIPs)
+		}
+		want := egressservices.ServiceStatus{
+			Ports:            cfg.Ports,
+			TailnetTargetIPs: tailnetTargetIPs,
+			TailnetTarget:    cfg.TailnetTarget,
+			ClientIP:         cfg.ClientIP,
+		}
+		if svc, ok := ep.userspaceSvcs[svcName]; ok {
+			if reflect.DeepEqual(svc.status, want) {
+				mak.Set(&status.Services, svcName, &want)
+				continue
+			}
+			log.Printf("configuration of service %s has changed, restarting its userspace proxy", svcName)
+			svc.close()
+			delete(ep.userspaceSvcs, svcName)
+		}
+		if !cfg.TailnetTarget.ResolvePerConnection && len(tailnetTargetIPs) == 0 {
+			log.Printf("tailnet target for egress service %s does not have any backend addresses, not proxying", svcName)
+			mak.Set(&status.Services, svcName, &want)
+			continue
+		}
+		svc, err := startUserspaceSvc(ep.podIPv4, want, target)
+		if err != nil {
+			return nil, fmt.Errorf("error starting userspace proxy for service %s: %w", svcName, err)
+		}
+		switch {
+		case cfg.ClientIP != "" && cfg.TailnetTarget.ResolvePerConnection:
+			log.Printf("started userspace proxy for service %s, passing on client addresses with %s and resolving %s per connection", svcName, cfg.ClientIP, cfg.TailnetTarget.FQDN)
+		case cfg.ClientIP != "":
+			log.Printf("started userspace proxy for service %s, passing on client addresses with %s", svcName, cfg.ClientIP)
+		default:
+			log.Printf("started userspace proxy for service %s, resolving %s per connection", svcName, cfg.TailnetTarget.FQDN)
+		}
+		mak.Set(&ep.userspaceSvcs, svcName, svc)
+		mak.Set(&status.Services, svcName, &want)
+	}
+	return status, nil
+}
+
+// closeUserspaceSvcs stops all running userspace proxies.
+func (ep *egressProxy) closeUserspaceSvcs() {
+	for svcName, svc := range ep.userspaceSvcs {
+		svc.close()
+		delete(ep.userspaceSvcs, svcName)
+	}
+}
+
+// targetFunc returns the tailnet IP to proxy a new connection to.
+type targetFunc func() (netip.Addr, error)
+
+// staticTarget returns a targetFunc that always returns the first of ips,
+// preferring IPv4.
+func staticTarget(ips []netip.Addr) targetFunc {
+	return func() (netip.Addr, error) {
+		if len(ips) == 0 {
+			return netip.Addr{}, errors.New("tailnet target has no addresses")
+		}
+		return preferIPv4(ips), nil
+	}
+}
+
+// resolvePerConnection returns a targetFunc that looks up the tailnet IPs of
+// the peer with the given MagicDNS name in the most recent netmap each time
+// it is called, preferring IPv4.
+func (ep *egressProxy) resolvePerConnection(fqdn string) targetFunc {
+	return func() (netip.Addr, error) {
+		nm := ep.lastNetmap.Load()
+		if nm == nil {
+			return netip.Addr{}, fmt.Errorf("netmap is not available, unable to resolve %s", fqdn)
+		}
+		for _, p := range nm.Peers {
+			if !equalFQDNs(p.Name(), fqdn) {
+				continue
+			}
+			var ips []netip.Addr
+			for _, pfx := range p.Addresses().All() {
+				if pfx.IsSingleIP() {
+					ips = append(ips, pfx.Addr())
+				}
+			}
+			if len(ips) == 0 {
+				return netip.Addr{}, fmt.Errorf("tailnet target %s has no addresses", fqdn)
+			}
+			return preferIPv4(ips), nil
+		}
+		return netip.Addr{}, fmt.Errorf("tailnet target %s not found; it either does not exist, or is not reachable because of ACLs", fqdn)
+	}
+}
+
+func preferIPv4(ips []netip.Addr) netip.Addr {
+	for _, ip := range ips {
+		if ip.Is4() {
+			return ip
+		}
+	}
+	return ips[0]
+}
+
+// startUserspaceSvc starts proxying the TCP ports of st received on listenAddr
+// to the tailnet IP returned by target for each new connection or, for HTTP,
+// request.
+func startUserspaceSvc(listenAddr string, st egressservices.ServiceStatus, target targetFunc) (_ *userspaceSvc, err error) {
+	svc := &userspaceSvc{status: st}
+	defer func() {
+		if err != nil {
+			svc.close()
+		}
+	}()
+	for pm := range st.Ports {
+		if !strings.EqualFold(pm.Protocol, "tcp") {
+			log.Printf("only TCP can be proxied in userspace, not proxying %s port %d", pm.Protocol, pm.MatchPort)
+			continue
+		}
+		ln, err := net.Listen("tcp", net.JoinHostPort(listenAddr, strconv.Itoa(int(pm.MatchPort))))
+		if err != nil {
+			return nil, err
+		}
+		dst := func() (netip.AddrPort, error) {
+			ip, err := target()
+			return netip.AddrPortFrom(ip, pm.TargetPort), err
+		}
+		switch st.ClientIP {
+		case "":
+			svc.closers = append(svc.closers, ln)
+			go serveTCP(ln, dst, false)
+		case egressservices.ClientIPProxyProtocol:
+			svc.closers = append(svc.closers, ln)
+			go serveTCP(ln, dst, true)
+		case egressservices.ClientIPHTTP:
+			srv := &http.Server{Handler: forwardedForProxy(dst)}
+			svc.closers = append(svc.closers, srv)
+			go srv.Serve(ln)
+		default:
+			ln.Close()
+			return nil, fmt.Errorf("unknown client IP mode %q", st.ClientIP)
+		}
+	}
+	return svc, nil
+}
+
+// serveTCP proxies the connections accepted on ln to the address returned by
+// dst for each connection, prefixing each with a PROXY protocol v1 header if
+// proxyProtocol is set. It returns when ln is closed.
+func serveTCP(ln net.Listener, dst func() (netip.AddrPort, error), proxyProtocol bool) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("error accepting connection on %v: %v", ln.Addr(), err)
+			}
+			return
+		}
+		go proxyTCP(c, dst, proxyProtocol)
+	}
+}
+
+func proxyTCP(c net.Conn, dstFunc func() (netip.AddrPort, error), proxyProtocol bool) {
+	defer c.Close()
+	dst, err := dstFunc()
+	if err != nil {
+		log.Printf("error resolving tailnet target: %v", err)
+		return
+	}
+	up, err := net.DialTimeout("tcp", dst.String(), dialTimeout)
+	if err != nil {
+		log.Printf("error connecting to tailnet target %v: %v", dst, err)
+		return
+	}
+	defer up.Close()
+	if proxyProtocol {
+		if _, err := io.WriteString(up, proxyProtocolHeader(c.RemoteAddr(), c.LocalAddr())); err != nil {
+			log.Printf("error writing PROXY protocol header to %v: %v", dst, err)
+			return
+		}
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go copyAndCloseWrite(&wg, up, c)
+	go copyAndCloseWrite(&wg, c, up)
+	wg.Wait()
+}
+
+// copyAndCloseWrite copies src to dst, then closes dst for writing so that the
+// other end sees the EOF while the other direction may still be in use.
+func copyAndCloseWrite(wg *sync.WaitGroup, dst, src net.Conn) {
+	defer wg.Done()
+	io.Copy(dst, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
+
+// proxyProtocolHeader returns the PROXY protocol v1 header for a TCP
+// connection from src to dst.
+func proxyProtocolHeader(src, dst net.Addr) string {
+	s, err := netip.ParseAddrPort(src.String())
+	if err != nil {
+		return "PROXY UNKNOWN\r\n"
+	}
+	d, err := netip.ParseAddrPort(dst.String())
+	if err != nil {
+		return "PROXY UNKNOWN\r\n"
+	}
+	s = netip.AddrPortFrom(s.Addr().Unmap(), s.Port())
+	d = netip.AddrPortFrom(d.Addr().Unmap(), d.Port())
+	proto := "TCP4"
+	switch {
+	case s.Addr().Is4() != d.Addr().Is4():
+		return "PROXY UNKNOWN\r\n"
+	case s.Addr().Is6():
+		proto = "TCP6"
+	}
+	return fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, s.Addr(), d.Addr(), s.Port(), d.Port())
+}
+
+// forwardedForProxy returns a handler that proxies HTTP requests to the
+// address returned by dst for each request, adding X-Forwarded-For,
+// X-Forwarded-Host and X-Forwarded-Proto headers.
+func forwardedForProxy(dst func() (netip.AddrPort, error)) http.Handler {
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			target, err := dst()
+			if err != nil {
+				// Leave the outgoing URL without a host, which makes
+				// the transport fail the request and the proxy respond
+				// with a 502.
+				log.Printf("error resolving tailnet target: %v", err)
+				r.Out.URL.Host = ""
+				return
+			}
+			r.SetURL(&url.URL{Scheme: "http", Host: target.String()})
+			r.SetXForwarded()
+		},
+	}
+}
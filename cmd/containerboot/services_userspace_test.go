@@ -0,0 +1,232 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/kube/egressservices"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+)
+
+func TestProxyProtocolHeader(t *testing.T) {
+	tests := []struct {
+		src, dst string
+		want     string
+	}{
+		{"10.0.0.1:43210", "10.0.0.2:10001", "PROXY TCP4 10.0.0.1 10.0.0.2 43210 10001\r\n"},
+		{"[::ffff:10.0.0.1]:43210", "10.0.0.2:10001", "PROXY TCP4 10.0.0.1 10.0.0.2 43210 10001\r\n"},
+		{"[fd00::1]:43210", "[fd00::2]:10001", "PROXY TCP6 fd00::1 fd00::2 43210 10001\r\n"},
+		{"10.0.0.1:43210", "[fd00::2]:10001", "PROXY UNKNOWN\r\n"},
+	}
+	for _, tt := range tests {
+		src := net.TCPAddrFromAddrPort(netip.MustParseAddrPort(tt.src))
+		dst := net.TCPAddrFromAddrPort(netip.MustParseAddrPort(tt.dst))
+		if got := proxyProtocolHeader(src, dst); got != tt.want {
+			t.Errorf("proxyProtocolHeader(%v, %v) = %q; want %q", tt.src, tt.dst, got, tt.want)
+		}
+	}
+}
+
+func TestUserspaceSvc(t *testing.T) {
+	// The tailnet target.
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	targetPort := target.Addr().(*net.TCPAddr).Port
+
+	t.Run("proxy_protocol", func(t *testing.T) {
+		port := freePort(t)
+		svc := startTestUserspaceSvc(t, egressservices.ClientIPProxyProtocol, port, targetPort)
+		defer svc.close()
+
+		c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		up, err := target.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer up.Close()
+		if _, err := io.WriteString(c, "hello"); err != nil {
+			t.Fatal(err)
+		}
+		c.(*net.TCPConn).CloseWrite()
+		got, err := io.ReadAll(up)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := proxyProtocolHeader(c.LocalAddr(), c.RemoteAddr()) + "hello"
+		if string(got) != want {
+			t.Errorf("target got %q; want %q", got, want)
+		}
+	})
+
+	t.Run("http", func(t *testing.T) {
+		port := freePort(t)
+		svc := startTestUserspaceSvc(t, egressservices.ClientIPHTTP, port, targetPort)
+		defer svc.close()
+
+		res := make(chan *http.Request, 1)
+		go func() {
+			up, err := target.Accept()
+			if err != nil {
+				return
+			}
+			defer up.Close()
+			req, err := http.ReadRequest(bufio.NewReader(up))
+			if err != nil {
+				return
+			}
+			io.WriteString(up, "HTTP/1.1 204 No Content\r\n\r\n")
+			res <- req
+		}()
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/foo", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		req := <-res
+		if got := req.Header.Get("X-Forwarded-For"); got != "127.0.0.1" {
+			t.Errorf("X-Forwarded-For = %q; want %q", got, "127.0.0.1")
+		}
+		if !strings.HasPrefix(req.Header.Get("X-Forwarded-Host"), "127.0.0.1:") {
+			t.Errorf("X-Forwarded-Host = %q; want the proxy's address", req.Header.Get("X-Forwarded-Host"))
+		}
+		if req.URL.Path != "/foo" {
+			t.Errorf("path = %q; want /foo", req.URL.Path)
+		}
+	})
+}
+
+func startTestUserspaceSvc(t *testing.T, mode egressservices.ClientIPMode, port, targetPort int) *userspaceSvc {
+	t.Helper()
+	ips := []netip.Addr{netip.MustParseAddr("::1"), netip.MustParseAddr("127.0.0.1")}
+	svc, err := startUserspaceSvc("127.0.0.1", egressservices.ServiceStatus{
+		Ports: egressservices.PortMaps{
+			{Protocol: "TCP", MatchPort: uint16(port), TargetPort: uint16(targetPort)}: {},
+			{Protocol: "UDP", MatchPort: uint16(port), TargetPort: 53}:                 {},
+		},
+		TailnetTargetIPs: ips,
+		ClientIP:         mode,
+	}, staticTarget(ips))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestUserspaceSvcResolvePerConnection(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	targetPort := target.Addr().(*net.TCPAddr).Port
+
+	ep := &egressProxy{}
+	setPeerAddr := func(addr string) {
+		ep.storeNetmap(ipn.Notify{NetMap: &netmap.NetworkMap{
+			Peers: []tailcfg.NodeView{(&tailcfg.Node{
+				Name:      "ephemeral.tailnetxyz.ts.net.",
+				Addresses: []netip.Prefix{netip.MustParsePrefix(addr)},
+			}).View()},
+		}})
+	}
+	resolve := ep.resolvePerConnection("ephemeral.tailnetxyz.ts.net")
+	if _, err := resolve(); err == nil {
+		t.Fatal("resolved tailnet target without a netmap")
+	}
+
+	port := freePort(t)
+	svc, err := startUserspaceSvc("127.0.0.1", egressservices.ServiceStatus{
+		Ports: egressservices.PortMaps{
+			{Protocol: "TCP", MatchPort: uint16(port), TargetPort: uint16(targetPort)}: {},
+		},
+		TailnetTarget: egressservices.TailnetTarget{FQDN: "ephemeral.tailnetxyz.ts.net", ResolvePerConnection: true},
+	}, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer svc.close()
+
+	// The target's address changes after the proxy has been started, and
+	// new connections go to the new address.
+	setPeerAddr("127.0.0.2/32")
+	setPeerAddr("127.0.0.1/32")
+	c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	up, err := target.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer up.Close()
+	if _, err := io.WriteString(c, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	c.(*net.TCPConn).CloseWrite()
+	got, err := io.ReadAll(up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("target got %q; want %q", got, "hello")
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestSplitConfigs(t *testing.T) {
+	cfgs := &egressservices.Configs{
+		"fw":   {TailnetTarget: egressservices.TailnetTarget{IP: "100.64.0.1"}},
+		"us":   {TailnetTarget: egressservices.TailnetTarget{IP: "100.64.0.2"}, ClientIP: egressservices.ClientIPHTTP},
+		"lazy": {TailnetTarget: egressservices.TailnetTarget{FQDN: "foo.tailnetxyz.ts.net", ResolvePerConnection: true}},
+	}
+	fw, us := splitConfigs(cfgs)
+	if fw == nil || len(*fw) != 1 || (*fw)["fw"].TailnetTarget.IP != "100.64.0.1" {
+		t.Errorf("firewall configs = %v; want only fw", fw)
+	}
+	if us == nil || len(*us) != 2 || (*us)["us"].ClientIP != egressservices.ClientIPHTTP || !(*us)["lazy"].TailnetTarget.ResolvePerConnection {
+		t.Errorf("userspace configs = %v; want us and lazy", us)
+	}
+
+	status := &egressservices.Status{
+		PodIPv4: "10.0.0.1",
+		Services: map[string]*egressservices.ServiceStatus{
+			"fw":   {},
+			"us":   {ClientIP: egressservices.ClientIPHTTP},
+			"lazy": {TailnetTarget: egressservices.TailnetTarget{ResolvePerConnection: true}},
+		},
+	}
+	got := firewallStatus(status)
+	if got.PodIPv4 != "10.0.0.1" || len(got.Services) != 1 || got.Services["fw"] == nil {
+		t.Errorf("firewallStatus = %+v; want only fw", got)
+	}
+}
@@ -74,6 +74,18 @@ type settings struct {
 	HealthCheckEnabled  bool
 	DebugAddrPort       string
 	EgressSvcsCfgPath   string
+	// InitMode is whether containerboot should only set up the proxy
+	// rules for the configured targets and then leave tailscaled
+	// running, without doing any further reconfiguration.
+	InitMode bool
+	// ReadyFile, if set, is the path of a file that is written once
+	// startup in init mode is complete.
+	ReadyFile string
+	// HealthCheckCommand and ReadyCheckCommand are optional shell
+	// commands that must succeed for the health and readiness checks,
+	// respectively, to pass.
+	HealthCheckCommand string
+	ReadyCheckCommand  string
 }
 
 func configFromEnv() (*settings, error) {
@@ -109,6 +121,10 @@ func configFromEnv() (*settings, error) {
 		DebugAddrPort:                         defaultEnv("TS_DEBUG_ADDR_PORT", ""),
 		EgressSvcsCfgPath:                     defaultEnv("TS_EGRESS_SERVICES_CONFIG_PATH", ""),
 		PodUID:                                defaultEnv("POD_UID", ""),
+		InitMode:                              defaultBool("TS_EXPERIMENTAL_INIT_MODE", false),
+		ReadyFile:                             defaultEnv("TS_READY_FILE", ""),
+		HealthCheckCommand:                    defaultEnv("TS_HEALTH_CHECK_COMMAND", ""),
+		ReadyCheckCommand:                     defaultEnv("TS_READY_CHECK_COMMAND", ""),
 	}
 	podIPs, ok := os.LookupEnv("POD_IPS")
 	if ok {
@@ -180,6 +196,17 @@ func (s *settings) validate() error {
 	if s.EnableForwardingOptimizations && s.UserspaceMode {
 		return errors.New("TS_EXPERIMENTAL_ENABLE_FORWARDING_OPTIMIZATIONS is not supported in userspace mode")
 	}
+	if s.InitMode {
+		if s.UserspaceMode {
+			return errors.New("TS_EXPERIMENTAL_INIT_MODE is not supported with TS_USERSPACE")
+		}
+		if s.ServeConfigPath != "" || s.EgressSvcsCfgPath != "" || s.ProxyTargetDNSName != "" {
+			return errors.New("TS_EXPERIMENTAL_INIT_MODE cannot be set in combination with TS_SERVE_CONFIG, TS_EGRESS_SERVICES_CONFIG_PATH or TS_EXPERIMENTAL_DEST_DNS_NAME")
+		}
+	}
+	if s.ReadyFile != "" && !s.InitMode {
+		return errors.New("TS_READY_FILE is only supported with TS_EXPERIMENTAL_INIT_MODE")
+	}
 	if s.HealthCheckAddrPort != "" {
 		log.Printf("[warning] TS_HEALTHCHECK_ADDR_PORT is deprecated and will be removed in 1.82.0. Please use TS_ENABLE_HEALTH_CHECK and optionally TS_LOCAL_ADDR_PORT instead.")
 		if _, err := netip.ParseAddrPort(s.HealthCheckAddrPort); err != nil {
@@ -196,6 +223,9 @@ func (s *settings) validate() error {
 			return fmt.Errorf("error parsing TS_DEBUG_ADDR_PORT value %q: %w", s.DebugAddrPort, err)
 		}
 	}
+	if (s.HealthCheckCommand != "" || s.ReadyCheckCommand != "") && !s.localHealthEnabled() && s.HealthCheckAddrPort == "" {
+		return errors.New("TS_HEALTH_CHECK_COMMAND and TS_READY_CHECK_COMMAND require TS_ENABLE_HEALTH_CHECK")
+	}
 	if s.HealthCheckEnabled && s.HealthCheckAddrPort != "" {
 		return errors.New("TS_HEALTHCHECK_ADDR_PORT is deprecated and will be removed in 1.82.0, use TS_ENABLE_HEALTH_CHECK and optionally TS_LOCAL_ADDR_PORT")
 	}
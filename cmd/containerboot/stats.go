@@ -0,0 +1,123 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"tailscale.com/client/tailscale"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/kube/kubetypes"
+	"tailscale.com/types/ptr"
+)
+
+// statsInterval is how often proxy stats are written to the state Secret.
+const statsInterval = time.Minute
+
+// statsReporter periodically writes a snapshot of tailscaled's state to the
+// proxy's state Secret, for the Kubernetes operator to surface in the status
+// of the resource that the proxy belongs to.
+type statsReporter struct {
+	kc   *kubeClient
+	lc   *tailscale.LocalClient
+	root string // root of the filesystem, used to find /proc
+	pid  int    // of tailscaled
+
+	lastNetmap atomic.Pointer[time.Time]
+}
+
+// netmapUpdated records that tailscaled has sent a netmap update.
+func (s *statsReporter) netmapUpdated() {
+	s.lastNetmap.Store(ptr.To(time.Now()))
+}
+
+// run writes stats every statsInterval until ctx is done. Failures are
+// logged, but are not fatal, as the stats are informational only.
+func (s *statsReporter) run(ctx context.Context) {
+	t := time.NewTicker(statsInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.report(ctx); err != nil {
+				log.Printf("error reporting proxy stats: %v", err)
+			}
+		}
+	}
+}
+
+func (s *statsReporter) report(ctx context.Context) error {
+	st, err := s.lc.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting tailscaled status: %w", err)
+	}
+	stats := proxyStatsFromStatus(st)
+	stats.Time = time.Now().UTC()
+	if t := s.lastNetmap.Load(); t != nil {
+		stats.LastNetmapUpdate = ptr.To(t.UTC())
+	}
+	if rss, err := processRSS(s.root, s.pid); err != nil {
+		log.Printf("error reading tailscaled memory usage: %v", err)
+	} else {
+		stats.MemoryBytes = rss
+	}
+	return s.kc.storeProxyStats(ctx, stats)
+}
+
+// proxyStatsFromStatus returns the connection stats of the node with the given
+// status.
+func proxyStatsFromStatus(st *ipnstate.Status) *kubetypes.ProxyStats {
+	stats := &kubetypes.ProxyStats{}
+	if st.Self != nil {
+		stats.DERPHomeRegion = st.Self.Relay
+	}
+	for _, ps := range st.Peer {
+		stats.RxBytes += ps.RxBytes
+		stats.TxBytes += ps.TxBytes
+		if !ps.Active {
+			continue
+		}
+		stats.ActivePeers++
+		if ps.CurAddr != "" {
+			stats.DirectPeers++
+		}
+	}
+	return stats
+}
+
+// processRSS returns the resident set size in bytes of the process with the
+// given PID.
+func processRSS(root string, pid int) (int64, error) {
+	b, err := os.ReadFile(filepath.Join(root, "proc", strconv.Itoa(pid), "statm"))
+	if err != nil {
+		return 0, err
+	}
+	return parseStatm(b, os.Getpagesize())
+}
+
+// parseStatm returns the resident set size in bytes from the contents of a
+// /proc/<pid>/statm file. See proc(5).
+func parseStatm(b []byte, pageSize int) (int64, error) {
+	fields := bytes.Fields(b)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected statm contents %q", b)
+	}
+	pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing resident pages from statm: %w", err)
+	}
+	return pages * int64(pageSize), nil
+}
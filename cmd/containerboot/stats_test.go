@@ -0,0 +1,58 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/kube/kubetypes"
+	"tailscale.com/types/key"
+)
+
+func TestProxyStatsFromStatus(t *testing.T) {
+	st := &ipnstate.Status{
+		Self: &ipnstate.PeerStatus{Relay: "nyc"},
+		Peer: map[key.NodePublic]*ipnstate.PeerStatus{
+			key.NewNode().Public(): {Active: true, CurAddr: "192.0.2.1:41641", RxBytes: 100, TxBytes: 200},
+			key.NewNode().Public(): {Active: true, Relay: "fra", RxBytes: 10, TxBytes: 20},
+			key.NewNode().Public(): {RxBytes: 1, TxBytes: 2},
+		},
+	}
+	want := &kubetypes.ProxyStats{
+		DERPHomeRegion: "nyc",
+		ActivePeers:    2,
+		DirectPeers:    1,
+		RxBytes:        111,
+		TxBytes:        222,
+	}
+	if diff := cmp.Diff(want, proxyStatsFromStatus(st)); diff != "" {
+		t.Errorf("unexpected stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseStatm(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "12345 678 90 1 0 2345 0\n", want: 678 * 4096},
+		{in: "12345\n", wantErr: true},
+		{in: "12345 foo\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseStatm([]byte(tt.in), 4096)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStatm(%q): got error %v, want error %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseStatm(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tailscale.com/derp"
+	"tailscale.com/types/key"
+)
+
+// The admin API lets relay operators inspect and manage the clients of the
+// DERP server, such as to drain it before a restart. It's enabled by the
+// --admin-key-file flag and requires the key as a bearer token:
+//
+//	GET  /admin/clients                    list client connections
+//	POST /admin/disconnect?key=nodekey:... close a client's connections
+//	GET  /admin/drain                      get the drain state
+//	POST /admin/drain?on=true|false        start or stop draining (default true)
+
+// drainStatus is the response of /admin/drain.
+type drainStatus struct {
+	Draining bool
+	Clients  int // number of local client connections, including mesh peers
+}
+
+// adminHandler returns the handler of the admin API of s, for requests
+// with secret as their bearer token.
+func adminHandler(s *derp.Server, secret string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/clients", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.Conns())
+	})
+	mux.HandleFunc("POST /admin/disconnect", func(w http.ResponseWriter, r *http.Request) {
+		var k key.NodePublic
+		if err := k.UnmarshalText([]byte(r.FormValue("key"))); err != nil {
+			http.Error(w, "invalid key: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		n := s.DisconnectClient(k)
+		if n == 0 {
+			http.Error(w, "client not connected", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, struct{ Disconnected int }{n})
+	})
+	mux.HandleFunc("/admin/drain", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+		case "POST":
+			on := true
+			if v := r.FormValue("on"); v != "" {
+				var err error
+				if on, err = strconv.ParseBool(v); err != nil {
+					http.Error(w, "invalid on value", http.StatusBadRequest)
+					return
+				}
+			}
+			s.SetDraining(on)
+		default:
+			http.Error(w, "want GET or POST", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, drainStatus{
+			Draining: s.Draining(),
+			Clients:  len(s.Conns()),
+		})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	enc.Encode(v)
+}
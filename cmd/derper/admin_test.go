@@ -0,0 +1,71 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/derp"
+	"tailscale.com/types/key"
+)
+
+func TestAdminHandler(t *testing.T) {
+	s := derp.NewServer(key.NewNode(), t.Logf)
+	defer s.Close()
+	h := adminHandler(s, "0123456789abcdef")
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	const tok = "0123456789abcdef"
+
+	for _, token := range []string{"", "wrong"} {
+		if rec := do("GET", "/admin/clients", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %v; want 401", token, rec.Code)
+		}
+	}
+	if rec := do("POST", "/admin/drain", "wrong"); rec.Code != http.StatusUnauthorized || s.Draining() {
+		t.Errorf("unauthorized drain: status = %v, draining = %v", rec.Code, s.Draining())
+	}
+
+	if rec := do("GET", "/admin/clients", tok); rec.Code != http.StatusOK || rec.Body.String() != "null\n" {
+		t.Errorf("clients: status = %v, body = %q", rec.Code, rec.Body)
+	}
+	if rec := do("GET", "/admin/disconnect?key=x", tok); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET disconnect: status = %v; want 405", rec.Code)
+	}
+	if rec := do("POST", "/admin/disconnect?key=x", tok); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad key: status = %v; want 400", rec.Code)
+	}
+	k := key.NewNode().Public()
+	if rec := do("POST", "/admin/disconnect?key="+k.String(), tok); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown key: status = %v; want 404", rec.Code)
+	}
+
+	drain := func(method, path string, want bool) {
+		t.Helper()
+		rec := do(method, path, tok)
+		var st drainStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		if st.Draining != want || s.Draining() != want {
+			t.Errorf("%s %s: draining = %v; want %v", method, path, st.Draining, want)
+		}
+	}
+	drain("GET", "/admin/drain", false)
+	drain("POST", "/admin/drain", true)
+	drain("GET", "/admin/drain", true)
+	drain("POST", "/admin/drain?on=false", false)
+}
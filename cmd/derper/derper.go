@@ -13,7 +13,9 @@
 import (
 	"cmp"
 	"context"
+	"crypto/ed25519"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"expvar"
@@ -44,6 +46,7 @@
 	"tailscale.com/net/ktimeout"
 	"tailscale.com/net/stunserver"
 	"tailscale.com/tsweb"
+	"tailscale.com/tsweb/tracing"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
 	"tailscale.com/version"
@@ -60,6 +63,8 @@
 	certDir     = flag.String("certdir", tsweb.DefaultCertDir("derper-certs"), "directory to store LetsEncrypt certs, if addr's port is :443")
 	hostname    = flag.String("hostname", "derp.tailscale.com", "LetsEncrypt host name, if addr's port is :443. When --certmode=manual, this can be an IP address to avoid SNI checks")
 	runSTUN     = flag.Bool("stun", true, "whether to run a STUN server. It will bind to the same IP (if any) as the --addr flag value.")
+	stunLimit   = flag.Float64("stun-rate-limit", 0, "if positive, the maximum number of STUN requests per second answered for each client IP (or IPv6 /64)")
+	stunBurst   = flag.Int("stun-rate-burst", 10, "the maximum burst of STUN requests answered for each client when --stun-rate-limit is set")
 	runDERP     = flag.Bool("derp", true, "whether to run a DERP server. The only reason to set this false is if you're decommissioning a server but want to keep its bootstrap DNS functionality still running.")
 
 	meshPSKFile     = flag.String("mesh-psk-file", defaultMeshPSKFile(), "if non-empty, path to file containing the mesh pre-shared key file. It should contain some hex string; whitespace is trimmed.")
@@ -69,6 +74,10 @@
 	verifyClients   = flag.Bool("verify-clients", false, "verify clients to this DERP server through a local tailscaled instance.")
 	verifyClientURL = flag.String("verify-client-url", "", "if non-empty, an admission controller URL for permitting client connections; see tailcfg.DERPAdmitClientRequest")
 	verifyFailOpen  = flag.Bool("verify-client-url-fail-open", true, "whether we fail open if --verify-client-url is unreachable")
+	verifyTokenKeys = flag.String("verify-client-token-keys", "", "if non-empty, a comma-separated list of hex-encoded ed25519 public keys; clients must present an admission token signed by one of them (see derp.SignAdmitToken)")
+	adminKeyFile    = flag.String("admin-key-file", "", "if non-empty, path to a file containing a secret that enables the admin API under /admin/ for requests with it as their bearer token; whitespace is trimmed")
+
+	otlpTracesEndpoint = flag.String("otlp-traces-endpoint", "", "if non-empty, an OTLP/HTTP URL (such as http://localhost:4318/v1/traces) to export OpenTelemetry traces of HTTP requests to; defaults to the OTEL_EXPORTER_OTLP_TRACES_ENDPOINT and OTEL_EXPORTER_OTLP_ENDPOINT environment variables")
 
 	acceptConnLimit = flag.Float64("accept-connection-limit", math.Inf(+1), "rate limit for accepting new connection")
 	acceptConnBurst = flag.Int("accept-connection-burst", math.MaxInt, "burst limit for accepting new connection")
@@ -149,6 +158,10 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	if t := tracing.ConfigureDefault(*otlpTracesEndpoint, log.Printf); t != nil {
+		defer t.Close()
+	}
+
 	if *dev {
 		*addr = ":3340" // above the keys DERP
 		log.Printf("Running in dev mode.")
@@ -161,7 +174,10 @@ func main() {
 	}
 
 	if *runSTUN {
-		ss := stunserver.New(ctx)
+		ss := stunserver.NewWithConfig(ctx, stunserver.Config{
+			RateLimit: *stunLimit,
+			RateBurst: *stunBurst,
+		})
 		go ss.ListenAndServe(net.JoinHostPort(listenHost, fmt.Sprint(*stunPort)))
 	}
 
@@ -173,6 +189,13 @@ func main() {
 	s.SetVerifyClient(*verifyClients)
 	s.SetVerifyClientURL(*verifyClientURL)
 	s.SetVerifyClientURLFailOpen(*verifyFailOpen)
+	if *verifyTokenKeys != "" {
+		keys, err := parseTokenKeys(*verifyTokenKeys)
+		if err != nil {
+			log.Fatalf("--verify-client-token-keys: %v", err)
+		}
+		s.SetVerifyClientTokenKeys(keys)
+	}
 
 	if *meshPSKFile != "" {
 		b, err := os.ReadFile(*meshPSKFile)
@@ -230,6 +253,18 @@ func main() {
 		io.WriteString(w, "User-agent: *\nDisallow: /\n")
 	}))
 	mux.Handle("/generate_204", http.HandlerFunc(derphttp.ServeNoContent))
+	if *adminKeyFile != "" {
+		b, err := os.ReadFile(*adminKeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		secret := strings.TrimSpace(string(b))
+		if len(secret) < 16 {
+			log.Fatalf("admin key in %s must be at least 16 characters", *adminKeyFile)
+		}
+		mux.Handle("/admin/", adminHandler(s, secret))
+		log.Printf("DERP admin API enabled")
+	}
 	debug := tsweb.Debugger(mux)
 	debug.KV("TLS hostname", *hostname)
 	debug.KV("Mesh key", s.HasMeshKey())
@@ -392,6 +427,23 @@ func defaultMeshPSKFile() string {
 	return ""
 }
 
+// parseTokenKeys parses the comma-separated hex-encoded ed25519 public keys of
+// the --verify-client-token-keys flag.
+func parseTokenKeys(v string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, s := range strings.Split(v, ",") {
+		b, err := hex.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", s, err)
+		}
+		if len(b) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid key %q: got %d bytes, want %d", s, len(b), ed25519.PublicKeySize)
+		}
+		keys = append(keys, ed25519.PublicKey(b))
+	}
+	return keys, nil
+}
+
 func rateLimitedListenAndServeTLS(srv *http.Server, lc *net.ListenConfig) error {
 	ln, err := lc.Listen(context.Background(), "tcp", cmp.Or(srv.Addr, ":https"))
 	if err != nil {
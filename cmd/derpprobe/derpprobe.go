@@ -30,6 +30,14 @@
 	bwInterval   = flag.Duration("bw-interval", 0, "bandwidth probe interval (0 = no bandwidth probing)")
 	bwSize       = flag.Int64("bw-probe-size-bytes", 1_000_000, "bandwidth probe size")
 	regionCode   = flag.String("region-code", "", "probe only this region (e.g. 'lax'); if left blank, all regions will be probed")
+
+	sloAvailability   = flag.Float64("slo-availability", 0.999, "per-region probe availability SLO target (0 = no availability SLO)")
+	sloLatency        = flag.Duration("slo-latency", 500*time.Millisecond, "per-region TLS and STUN probe latency SLO threshold (0 = no latency SLO)")
+	sloLatencyTarget  = flag.Float64("slo-latency-target", 0.99, "fraction of TLS and STUN probes that must complete within --slo-latency")
+	sloWindow         = flag.Duration("slo-window", 7*24*time.Hour, "sliding window over which SLOs are computed")
+	alertWebhook      = flag.String("alert-webhook", "", "if non-empty, URL to POST JSON SLO alerts to")
+	alertPagerDutyKey = flag.String("alert-pagerduty-key", "", "if non-empty, PagerDuty Events API v2 routing key to send SLO alerts to")
+	alertSlackWebhook = flag.String("alert-slack-webhook", "", "if non-empty, Slack incoming webhook URL to send SLO alerts to")
 )
 
 func main() {
@@ -40,6 +48,15 @@ func main() {
 	}
 
 	p := prober.New().WithSpread(*spread).WithOnce(*probeOnce).WithMetricNamespace("derpprobe")
+	var slos *prober.SLOTracker
+	if !*probeOnce {
+		slos = newSLOTracker()
+		if slos != nil {
+			p.WithSLOTracker(slos)
+			slos.Start(time.Minute)
+			defer slos.Close()
+		}
+	}
 	opts := []prober.DERPOpt{
 		prober.WithMeshProbing(*meshInterval),
 		prober.WithSTUNProbing(*stunInterval),
@@ -74,6 +91,9 @@ func main() {
 	mux := http.NewServeMux()
 	d := tsweb.Debugger(mux)
 	d.Handle("probe-run", "Run a probe", tsweb.StdHandler(tsweb.ReturnHandlerFunc(p.RunHandler), tsweb.HandlerOptions{Logf: log.Printf}))
+	if slos != nil {
+		d.Handle("slo", "SLO status", slos)
+	}
 	mux.Handle("/", tsweb.StdHandler(p.StatusHandler(
 		prober.WithTitle("DERP Prober"),
 		prober.WithPageLink("Prober metrics", "/debug/varz"),
@@ -88,6 +108,51 @@ func main() {
 	log.Fatal(http.ListenAndServe(*listen, mux))
 }
 
+// newSLOTracker returns an SLOTracker for the SLOs and alert sinks
+// configured by flags, or nil if no SLOs are configured.
+func newSLOTracker() *prober.SLOTracker {
+	var slos []prober.SLO
+	if *sloAvailability > 0 {
+		if *sloAvailability >= 1 {
+			log.Fatalf("--slo-availability must be less than 1")
+		}
+		slos = append(slos, prober.SLO{
+			Name:    "availability",
+			GroupBy: "region",
+			Target:  *sloAvailability,
+			Window:  *sloWindow,
+		})
+	}
+	if *sloLatency > 0 {
+		if *sloLatencyTarget <= 0 || *sloLatencyTarget >= 1 {
+			log.Fatalf("--slo-latency-target must be between 0 and 1")
+		}
+		slos = append(slos, prober.SLO{
+			Name:             "latency",
+			GroupBy:          "region",
+			Classes:          []string{"tls", "derp_udp"},
+			Target:           *sloLatencyTarget,
+			LatencyThreshold: *sloLatency,
+			Window:           *sloWindow,
+		})
+	}
+	if len(slos) == 0 {
+		return nil
+	}
+
+	var sinks []prober.AlertSink
+	if *alertWebhook != "" {
+		sinks = append(sinks, &prober.WebhookSink{URL: *alertWebhook})
+	}
+	if *alertPagerDutyKey != "" {
+		sinks = append(sinks, &prober.PagerDutySink{RoutingKey: *alertPagerDutyKey})
+	}
+	if *alertSlackWebhook != "" {
+		sinks = append(sinks, &prober.SlackSink{WebhookURL: *alertSlackWebhook})
+	}
+	return prober.NewSLOTracker("derpprobe", slos, nil, sinks...)
+}
+
 type overallStatus struct {
 	good, bad []string
 }
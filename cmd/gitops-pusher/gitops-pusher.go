@@ -7,14 +7,12 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"regexp"
 	"strings"
@@ -24,7 +22,6 @@
 	"github.com/tailscale/hujson"
 	"golang.org/x/oauth2/clientcredentials"
 	"tailscale.com/client/tailscale"
-	"tailscale.com/util/httpm"
 )
 
 var (
@@ -45,9 +42,9 @@ func modifiedExternallyError() error {
 	}
 }
 
-func apply(cache *Cache, client *http.Client, tailnet, apiKey string) func(context.Context, []string) error {
+func apply(cache *Cache, client *tailscale.Client) func(context.Context, []string) error {
 	return func(ctx context.Context, args []string) error {
-		controlEtag, err := getACLETag(ctx, client, tailnet, apiKey)
+		controlEtag, err := getACLETag(ctx, client)
 		if err != nil {
 			return err
 		}
@@ -82,7 +79,7 @@ func apply(cache *Cache, client *http.Client, tailnet, apiKey string) func(conte
 			}
 		}
 
-		if err := applyNewACL(ctx, client, tailnet, apiKey, *policyFname, controlEtag); err != nil {
+		if err := applyNewACL(ctx, client, *policyFname, controlEtag); err != nil {
 			return err
 		}
 
@@ -92,9 +89,9 @@ func apply(cache *Cache, client *http.Client, tailnet, apiKey string) func(conte
 	}
 }
 
-func test(cache *Cache, client *http.Client, tailnet, apiKey string) func(context.Context, []string) error {
+func test(cache *Cache, client *tailscale.Client) func(context.Context, []string) error {
 	return func(ctx context.Context, args []string) error {
-		controlEtag, err := getACLETag(ctx, client, tailnet, apiKey)
+		controlEtag, err := getACLETag(ctx, client)
 		if err != nil {
 			return err
 		}
@@ -128,16 +125,16 @@ func test(cache *Cache, client *http.Client, tailnet, apiKey string) func(contex
 			}
 		}
 
-		if err := testNewACLs(ctx, client, tailnet, apiKey, *policyFname); err != nil {
+		if err := testNewACLs(ctx, client, *policyFname); err != nil {
 			return err
 		}
 		return nil
 	}
 }
 
-func getChecksums(cache *Cache, client *http.Client, tailnet, apiKey string) func(context.Context, []string) error {
+func getChecksums(cache *Cache, client *tailscale.Client) func(context.Context, []string) error {
 	return func(ctx context.Context, args []string) error {
-		controlEtag, err := getACLETag(ctx, client, tailnet, apiKey)
+		controlEtag, err := getACLETag(ctx, client)
 		if err != nil {
 			return err
 		}
@@ -174,7 +171,10 @@ func main() {
 	if apiKey != "" && (oauthId != "" || oauthSecret != "") {
 		log.Fatal("set either the envvar TS_API_KEY or TS_OAUTH_ID and TS_OAUTH_SECRET")
 	}
-	var client *http.Client
+	tailscale.I_Acknowledge_This_API_Is_Unstable = true
+	client := tailscale.NewClient(tailnet, tailscale.APIKey(apiKey))
+	client.BaseURL = "https://" + *apiServer
+	client.UserAgent = "tailscale-gitops-pusher"
 	if oiok && (oauthId != "" || oauthSecret != "") {
 		// Both should ideally be set, but if either are non-empty it means the user had an intent
 		// to set _something_, so they should receive the oauth error flow.
@@ -183,9 +183,7 @@ func main() {
 			ClientSecret: oauthSecret,
 			TokenURL:     fmt.Sprintf("https://%s/api/v2/oauth/token", *apiServer),
 		}
-		client = oauthConfig.Client(context.Background())
-	} else {
-		client = http.DefaultClient
+		client.HTTPClient = oauthConfig.Client(context.Background())
 	}
 	cache, err := LoadCache(*cacheFname)
 	if err != nil {
@@ -202,7 +200,7 @@ func main() {
 		ShortUsage: "gitops-pusher [options] apply",
 		ShortHelp:  "Pushes changes to CONTROL",
 		LongHelp:   `Pushes changes to CONTROL`,
-		Exec:       apply(cache, client, tailnet, apiKey),
+		Exec:       apply(cache, client),
 	}
 
 	testCmd := &ffcli.Command{
@@ -210,7 +208,7 @@ func main() {
 		ShortUsage: "gitops-pusher [options] test",
 		ShortHelp:  "Tests ACL changes",
 		LongHelp:   "Tests ACL changes",
-		Exec:       test(cache, client, tailnet, apiKey),
+		Exec:       test(cache, client),
 	}
 
 	cksumCmd := &ffcli.Command{
@@ -218,7 +216,7 @@ func main() {
 		ShortUsage: "Shows checksums of ACL files",
 		ShortHelp:  "Fetch checksum of CONTROL's ACL and the local ACL for comparison",
 		LongHelp:   "Fetch checksum of CONTROL's ACL and the local ACL for comparison",
-		Exec:       getChecksums(cache, client, tailnet, apiKey),
+		Exec:       getChecksums(cache, client),
 	}
 
 	root := &ffcli.Command{
@@ -261,44 +259,25 @@ func sumFile(fname string) (string, error) {
 	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
-func applyNewACL(ctx context.Context, client *http.Client, tailnet, apiKey, policyFname, oldEtag string) error {
-	fin, err := os.Open(policyFname)
-	if err != nil {
-		return err
-	}
-	defer fin.Close()
-
-	req, err := http.NewRequestWithContext(ctx, httpm.POST, fmt.Sprintf("https://%s/api/v2/tailnet/%s/acl", *apiServer, tailnet), fin)
-	if err != nil {
-		return err
-	}
-
-	req.SetBasicAuth(apiKey, "")
-	req.Header.Set("Content-Type", "application/hujson")
-	req.Header.Set("If-Match", `"`+oldEtag+`"`)
-
-	resp, err := client.Do(req)
+func applyNewACL(ctx context.Context, client *tailscale.Client, policyFname, oldEtag string) error {
+	data, err := os.ReadFile(policyFname)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	got := resp.StatusCode
-	want := http.StatusOK
-	if got != want {
-		var ate ACLGitopsTestError
-		err := json.NewDecoder(resp.Body).Decode(&ate)
-		if err != nil {
-			return err
+	acl := tailscale.ACLHuJSON{ACL: string(data), ETag: `"` + oldEtag + `"`}
+	if _, err := client.SetACLHuJSON(ctx, acl, true); err != nil {
+		var ate tailscale.ACLTestError
+		if errors.As(err, &ate) {
+			return ACLGitopsTestError{ate}
 		}
-
-		return ate
+		return err
 	}
 
 	return nil
 }
 
-func testNewACLs(ctx context.Context, client *http.Client, tailnet, apiKey, policyFname string) error {
+func testNewACLs(ctx context.Context, client *tailscale.Client, policyFname string) error {
 	data, err := os.ReadFile(policyFname)
 	if err != nil {
 		return err
@@ -308,34 +287,12 @@ func testNewACLs(ctx context.Context, client *http.Client, tailnet, apiKey, poli
 		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, httpm.POST, fmt.Sprintf("https://%s/api/v2/tailnet/%s/acl/validate", *apiServer, tailnet), bytes.NewBuffer(data))
+	ate, err := client.ValidateACLHuJSON(ctx, string(data))
 	if err != nil {
 		return err
 	}
-
-	req.SetBasicAuth(apiKey, "")
-	req.Header.Set("Content-Type", "application/hujson")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	var ate ACLGitopsTestError
-	err = json.NewDecoder(resp.Body).Decode(&ate)
-	if err != nil {
-		return err
-	}
-
-	if len(ate.Message) != 0 || len(ate.Data) != 0 {
-		return ate
-	}
-
-	got := resp.StatusCode
-	want := http.StatusOK
-	if got != want {
-		return fmt.Errorf("wanted HTTP status code %d but got %d", want, got)
+	if ate != nil {
+		return ACLGitopsTestError{*ate}
 	}
 
 	return nil
@@ -387,26 +344,10 @@ func (ate ACLGitopsTestError) Error() string {
 	return sb.String()
 }
 
-func getACLETag(ctx context.Context, client *http.Client, tailnet, apiKey string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, httpm.GET, fmt.Sprintf("https://%s/api/v2/tailnet/%s/acl", *apiServer, tailnet), nil)
+func getACLETag(ctx context.Context, client *tailscale.Client) (string, error) {
+	acl, err := client.ACLHuJSON(ctx)
 	if err != nil {
 		return "", err
 	}
-
-	req.SetBasicAuth(apiKey, "")
-	req.Header.Set("Accept", "application/hujson")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	got := resp.StatusCode
-	want := http.StatusOK
-	if got != want {
-		return "", fmt.Errorf("wanted HTTP status code %d but got %d", want, got)
-	}
-
-	return Shuck(resp.Header.Get("ETag")), nil
+	return Shuck(acl.ETag), nil
 }
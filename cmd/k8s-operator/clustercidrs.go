@@ -0,0 +1,160 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go4.org/netipx"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
+)
+
+// serviceCIDRResyncInterval is how often the Service CIDRs advertised by a
+// Connector are re-discovered. Unlike Pod CIDRs, which are set on Nodes, there
+// is no object that the operator can watch for changes to them.
+const serviceCIDRResyncInterval = 10 * time.Minute
+
+// serviceCIDRProbeIPs are the cluster IPs used to discover the Service CIDRs,
+// by family. They are documentation addresses (RFC 5737, RFC 3849), so are
+// not expected to be within a Service CIDR.
+var serviceCIDRProbeIPs = map[corev1.IPFamily]string{
+	corev1.IPv4Protocol: "192.0.2.1",
+	corev1.IPv6Protocol: "2001:db8::1",
+}
+
+// serviceCIDRRangeRe matches the Service CIDRs in the error that the API
+// server returns for a Service with a cluster IP outside of them.
+var serviceCIDRRangeRe = regexp.MustCompile(`The range of valid IPs is (\S+)`)
+
+// clusterCIDRs returns the routes of the cluster that the subnet router should
+// advertise in addition to its static routes, as configured by cc. ns is the
+// namespace in which the dry-run Service used to discover the Service CIDRs is
+// created.
+func clusterCIDRs(ctx context.Context, cl client.Client, ns string, cc *tsapi.ClusterCIDRs) ([]netip.Prefix, error) {
+	if cc == nil {
+		return nil, nil
+	}
+	var pfxs []netip.Prefix
+	if cc.Pods {
+		p, err := podCIDRs(ctx, cl)
+		if err != nil {
+			return nil, err
+		}
+		pfxs = append(pfxs, p...)
+	}
+	if cc.Services {
+		p, err := serviceCIDRs(ctx, cl, ns)
+		if err != nil {
+			return nil, err
+		}
+		pfxs = append(pfxs, p...)
+	}
+	return pfxs, nil
+}
+
+// podCIDRs returns the Pod CIDRs of all Nodes in the cluster, with adjacent
+// CIDRs merged.
+func podCIDRs(ctx context.Context, cl client.Client) ([]netip.Prefix, error) {
+	nodes := &corev1.NodeList{}
+	if err := cl.List(ctx, nodes); err != nil {
+		return nil, fmt.Errorf("error listing Nodes: %w", err)
+	}
+	var b netipx.IPSetBuilder
+	for _, n := range nodes.Items {
+		for _, c := range nodePodCIDRs(&n) {
+			pfx, err := netip.ParsePrefix(c)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Pod CIDR %q on Node %s: %w", c, n.Name, err)
+			}
+			b.AddPrefix(pfx.Masked())
+		}
+	}
+	s, err := b.IPSet()
+	if err != nil {
+		return nil, fmt.Errorf("error building Pod CIDRs: %w", err)
+	}
+	pfxs := s.Prefixes()
+	if len(pfxs) == 0 {
+		return nil, errors.New("no Pod CIDRs found on Nodes; the cluster might not allocate Pod CIDRs to Nodes")
+	}
+	return pfxs, nil
+}
+
+// nodePodCIDRs returns the Pod CIDRs allocated to n.
+func nodePodCIDRs(n *corev1.Node) []string {
+	if len(n.Spec.PodCIDRs) > 0 {
+		return n.Spec.PodCIDRs
+	}
+	if n.Spec.PodCIDR != "" {
+		return []string{n.Spec.PodCIDR}
+	}
+	return nil
+}
+
+// serviceCIDRs returns the cluster's Service CIDRs. Kubernetes does not
+// expose them via the API on all versions, so they are parsed from the error
+// returned for a dry-run create of a Service with a cluster IP outside of
+// them, once for each IP family.
+func serviceCIDRs(ctx context.Context, cl client.Client, ns string) ([]netip.Prefix, error) {
+	var pfxs []netip.Prefix
+	for _, fam := range []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol} {
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "ts-service-cidr-probe-",
+				Namespace:    ns,
+			},
+			Spec: corev1.ServiceSpec{
+				ClusterIP:  serviceCIDRProbeIPs[fam],
+				IPFamilies: []corev1.IPFamily{fam},
+				Ports:      []corev1.ServicePort{{Port: 80}},
+			},
+		}
+		err := cl.Create(ctx, svc, client.DryRunAll)
+		if err == nil {
+			continue
+		}
+		// A cluster that does not support this family returns a different
+		// error, which can be ignored.
+		m := serviceCIDRRangeRe.FindStringSubmatch(err.Error())
+		if m == nil {
+			continue
+		}
+		for _, c := range strings.Split(strings.TrimSuffix(m[1], "."), ",") {
+			pfx, err := netip.ParsePrefix(c)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing Service CIDR %q: %w", c, err)
+			}
+			pfxs = append(pfxs, pfx.Masked())
+		}
+	}
+	if len(pfxs) == 0 {
+		return nil, errors.New("unable to discover Service CIDRs from the API server")
+	}
+	return pfxs, nil
+}
+
+// mergeRoutes returns the union of the static routes and the discovered
+// cluster CIDRs, in the order in which they should be advertised.
+func mergeRoutes(static tsapi.Routes, discovered []netip.Prefix) tsapi.Routes {
+	routes := slices.Clone(static)
+	for _, pfx := range discovered {
+		r := tsapi.Route(pfx.String())
+		if !slices.Contains(routes, r) {
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
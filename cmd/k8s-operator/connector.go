@@ -57,6 +57,10 @@ type ConnectorReconciler struct {
 
 	clock tstime.Clock
 
+	// hostnames tracks the tailnet hostnames of all proxies, to detect
+	// conflicts.
+	hostnames *hostnameIndex
+
 	mu sync.Mutex // protects following
 
 	subnetRouters set.Slice[types.UID] // for subnet routers gauge
@@ -159,7 +163,11 @@ func (a *ConnectorReconciler) Reconcile(ctx context.Context, req reconcile.Reque
 	logger.Info("Connector resources synced")
 	cn.Status.IsExitNode = cn.Spec.ExitNode
 	if cn.Spec.SubnetRouter != nil {
-		cn.Status.SubnetRoutes = cn.Spec.SubnetRouter.AdvertiseRoutes.Stringify()
+		// Status.SubnetRoutes is set by maybeProvisionConnector, as the
+		// routes might include discovered cluster CIDRs.
+		if cc := cn.Spec.SubnetRouter.AdvertiseClusterCIDRs; cc != nil && cc.Services {
+			res.RequeueAfter = serviceCIDRResyncInterval
+		}
 		return setStatus(cn, tsapi.ConnectorReady, metav1.ConditionTrue, reasonConnectorCreated, reasonConnectorCreated)
 	}
 	if cn.Spec.AppConnector != nil {
@@ -176,6 +184,9 @@ func (a *ConnectorReconciler) maybeProvisionConnector(ctx context.Context, logge
 	if cn.Spec.Hostname != "" {
 		hostname = string(cn.Spec.Hostname)
 	}
+	if err := a.hostnames.claim(hostnameOwner("Connector", cn), cn.CreationTimestamp.Time, hostname); err != nil {
+		return err
+	}
 	crl := childResourceLabels(cn.Name, a.tsnamespace, "connector")
 
 	proxyClass := cn.Spec.ProxyClass
@@ -199,10 +210,20 @@ func (a *ConnectorReconciler) maybeProvisionConnector(ctx context.Context, logge
 		},
 		ProxyClassName: proxyClass,
 		proxyType:      proxyTypeConnector,
+		ResyncToken:    cn.Annotations[AnnotationForceResync],
 	}
 
-	if cn.Spec.SubnetRouter != nil && len(cn.Spec.SubnetRouter.AdvertiseRoutes) > 0 {
-		sts.Connector.routes = cn.Spec.SubnetRouter.AdvertiseRoutes.Stringify()
+	if cn.Spec.SubnetRouter != nil {
+		discovered, err := clusterCIDRs(ctx, a.Client, a.ssr.operatorNamespace, cn.Spec.SubnetRouter.AdvertiseClusterCIDRs)
+		if err != nil {
+			return fmt.Errorf("error discovering cluster CIDRs: %w", err)
+		}
+		routes := mergeRoutes(cn.Spec.SubnetRouter.AdvertiseRoutes, discovered).Stringify()
+		if cn.Status.SubnetRoutes != "" && cn.Status.SubnetRoutes != routes {
+			logger.Infof("advertised routes changed from %q to %q", cn.Status.SubnetRoutes, routes)
+		}
+		sts.Connector.routes = routes
+		cn.Status.SubnetRoutes = routes
 	}
 
 	if cn.Spec.AppConnector != nil {
@@ -253,11 +274,13 @@ func (a *ConnectorReconciler) maybeProvisionConnector(ctx context.Context, logge
 		// No hostname yet. Wait for the connector pod to auth.
 		cn.Status.TailnetIPs = nil
 		cn.Status.Hostname = ""
+		cn.Status.Stats = nil
 		return nil
 	}
 
 	cn.Status.TailnetIPs = dev.ips
 	cn.Status.Hostname = dev.hostname
+	cn.Status.Stats = dev.stats
 
 	return nil
 }
@@ -275,6 +298,7 @@ func (a *ConnectorReconciler) maybeCleanupConnector(ctx context.Context, logger
 	// cleanup removes the tailscale finalizer, which will make all future
 	// reconciles exit early.
 	logger.Infof("cleaned up Connector resources")
+	a.hostnames.release(hostnameOwner("Connector", cn))
 	a.mu.Lock()
 	a.subnetRouters.Remove(cn.UID)
 	a.exitNodes.Remove(cn.UID)
@@ -311,7 +335,7 @@ func (a *ConnectorReconciler) validate(cn *tsapi.Connector) error {
 }
 
 func validateSubnetRouter(sb *tsapi.SubnetRouter) error {
-	if len(sb.AdvertiseRoutes) == 0 {
+	if cc := sb.AdvertiseClusterCIDRs; len(sb.AdvertiseRoutes) == 0 && (cc == nil || (!cc.Pods && !cc.Services)) {
 		return errors.New("invalid subnet router spec: no routes defined")
 	}
 	return validateRoutes(sb.AdvertiseRoutes)
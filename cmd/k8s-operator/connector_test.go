@@ -13,10 +13,17 @@
 	"go.uber.org/zap"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
 	"tailscale.com/kube/kubetypes"
 	"tailscale.com/tstest"
@@ -395,3 +402,155 @@ func TestConnectorWithAppConnector(t *testing.T) {
 	}}
 	expectReconciled(t, cr, "", "test")
 }
+
+func TestConnectorWithClusterCIDRs(t *testing.T) {
+	// Setup
+	cn := &tsapi.Connector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+			UID:  types.UID("1234-UID"),
+		},
+		TypeMeta: metav1.TypeMeta{
+			Kind:       tsapi.ConnectorKind,
+			APIVersion: "tailscale.io/v1alpha1",
+		},
+		Spec: tsapi.ConnectorSpec{
+			SubnetRouter: &tsapi.SubnetRouter{
+				AdvertiseRoutes:       []tsapi.Route{"10.40.0.0/14"},
+				AdvertiseClusterCIDRs: &tsapi.ClusterCIDRs{Pods: true},
+			},
+		},
+	}
+	node := func(name string, podCIDRs ...string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.NodeSpec{PodCIDRs: podCIDRs},
+		}
+	}
+	// The API server rejects Services with a cluster IP outside of the
+	// Service CIDRs. This cluster is IPv4 only.
+	var dryRunCreates int
+	fc := fake.NewClientBuilder().
+		WithScheme(tsapi.GlobalScheme).
+		WithObjects(cn, node("node-1", "10.1.0.0/24", "fd00:1::/64"), node("node-2", "10.1.1.0/24", "fd00:1:0:1::/64")).
+		WithStatusSubresource(cn).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				svc, ok := obj.(*corev1.Service)
+				if !ok || len((&client.CreateOptions{}).ApplyOptions(opts).DryRun) == 0 {
+					return c.Create(ctx, obj, opts...)
+				}
+				dryRunCreates++
+				if svc.Spec.IPFamilies[0] == corev1.IPv6Protocol {
+					return apierrors.NewInvalid(schema.GroupKind{Kind: "Service"}, svc.Name, field.ErrorList{
+						field.Invalid(field.NewPath("spec", "ipFamilies"), svc.Spec.IPFamilies, "IPv6 is not configured on this cluster"),
+					})
+				}
+				return apierrors.NewInvalid(schema.GroupKind{Kind: "Service"}, svc.Name, field.ErrorList{
+					field.Invalid(field.NewPath("spec", "clusterIPs"), svc.Spec.ClusterIP, "failed to allocate IP 192.0.2.1: the provided IP (192.0.2.1) is not in the valid range. The range of valid IPs is 10.96.0.0/12"),
+				})
+			},
+		}).
+		Build()
+	ft := &fakeTSClient{}
+	zl, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := tstest.NewClock(tstest.ClockOpts{})
+	cr := &ConnectorReconciler{
+		Client: fc,
+		clock:  cl,
+		ssr: &tailscaleSTSReconciler{
+			Client:            fc,
+			tsClient:          ft,
+			defaultTags:       []string{"tag:k8s"},
+			operatorNamespace: "operator-ns",
+			proxyImage:        "tailscale/tailscale",
+		},
+		logger: zl.Sugar(),
+	}
+
+	// 1. Pod CIDRs of all Nodes are advertised in addition to the static
+	// routes, with adjacent CIDRs merged.
+	expectReconciled(t, cr, "", "test")
+	fullName, shortName := findGenName(t, fc, "", "test", "connector")
+	opts := configOpts{
+		stsName:      shortName,
+		secretName:   fullName,
+		parentType:   "connector",
+		hostname:     "test-connector",
+		subnetRoutes: "10.40.0.0/14,10.1.0.0/23,fd00:1::/63",
+		app:          kubetypes.AppConnector,
+	}
+	expectEqual(t, fc, expectedSecret(t, fc, opts), nil)
+	expectEqual(t, fc, expectedSTS(t, fc, opts), removeHashAnnotation)
+	if dryRunCreates != 0 {
+		t.Errorf("got %d dry-run Service creates, want 0", dryRunCreates)
+	}
+
+	// 2. A Node pool with new Pod CIDRs is added.
+	mustCreate(t, fc, node("node-3", "10.2.0.0/24"))
+	opts.subnetRoutes = "10.40.0.0/14,10.1.0.0/23,10.2.0.0/24,fd00:1::/63"
+	expectReconciled(t, cr, "", "test")
+	expectEqual(t, fc, expectedSTS(t, fc, opts), removeHashAnnotation)
+	cn = &tsapi.Connector{}
+	if err := fc.Get(context.Background(), types.NamespacedName{Name: "test"}, cn); err != nil {
+		t.Fatal(err)
+	}
+	if cn.Status.SubnetRoutes != opts.subnetRoutes {
+		t.Errorf("got status subnet routes %q, want %q", cn.Status.SubnetRoutes, opts.subnetRoutes)
+	}
+
+	// 3. Service CIDRs are discovered and periodically re-checked.
+	mustUpdate[tsapi.Connector](t, fc, "", "test", func(conn *tsapi.Connector) {
+		conn.Spec.SubnetRouter.AdvertiseClusterCIDRs.Services = true
+	})
+	opts.subnetRoutes = "10.40.0.0/14,10.1.0.0/23,10.2.0.0/24,fd00:1::/63,10.96.0.0/12"
+	res, err := cr.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "test"}})
+	if err != nil {
+		t.Fatalf("Reconcile: unexpected error: %v", err)
+	}
+	if res.RequeueAfter != serviceCIDRResyncInterval {
+		t.Errorf("got RequeueAfter %v, want %v", res.RequeueAfter, serviceCIDRResyncInterval)
+	}
+	expectEqual(t, fc, expectedSTS(t, fc, opts), removeHashAnnotation)
+	if dryRunCreates != 2 {
+		t.Errorf("got %d dry-run Service creates, want 2", dryRunCreates)
+	}
+
+	// 4. Only the discovered routes are advertised if there are no static
+	// routes.
+	mustUpdate[tsapi.Connector](t, fc, "", "test", func(conn *tsapi.Connector) {
+		conn.Spec.SubnetRouter.AdvertiseRoutes = nil
+		conn.Spec.SubnetRouter.AdvertiseClusterCIDRs.Services = false
+	})
+	opts.subnetRoutes = "10.1.0.0/23,10.2.0.0/24,fd00:1::/63"
+	expectReconciled(t, cr, "", "test")
+	expectEqual(t, fc, expectedSTS(t, fc, opts), removeHashAnnotation)
+}
+
+func TestPodCIDRsChanged(t *testing.T) {
+	node := func(podCIDRs ...string) *corev1.Node {
+		return &corev1.Node{Spec: corev1.NodeSpec{PodCIDRs: podCIDRs}}
+	}
+	tests := []struct {
+		name     string
+		old, new *corev1.Node
+		want     bool
+	}{
+		{"unchanged", node("10.1.0.0/24"), node("10.1.0.0/24"), false},
+		{"allocated", node(), node("10.1.0.0/24"), true},
+		{"dual_stack", node("10.1.0.0/24"), node("10.1.0.0/24", "fd00::/64"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podCIDRsChanged.Update(event.UpdateEvent{ObjectOld: tt.old, ObjectNew: tt.new}); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !podCIDRsChanged.Create(event.CreateEvent{Object: node()}) {
+		t.Error("Node creation should be let through")
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"tailscale.com/tstime"
+	"tailscale.com/types/ptr"
+)
+
+const (
+	// webhookServiceName is the name of the Service in the operator's
+	// namespace that exposes the operator's webhook server.
+	webhookServiceName = "operator-webhook"
+	// webhookCertSecretName is the name of the Secret in the operator's
+	// namespace that stores the webhook server's serving certificate.
+	webhookCertSecretName = "operator-webhook-tls"
+	webhookPort           = 9443
+	conversionWebhookPath = "/convert"
+
+	webhookCertValidity      = 365 * 24 * time.Hour
+	webhookCertRenewBefore   = 90 * 24 * time.Hour
+	webhookCertCheckInterval = 24 * time.Hour
+
+	// keyCABundle is the key in the webhook certificate Secret that holds
+	// the certificates that the API server should trust. During rotation,
+	// it holds both the new and the previous certificate.
+	keyCABundle = "ca.crt"
+)
+
+// convertedCRDs are the tailscale.com CRDs that serve more than one version
+// and so are converted by the operator's conversion webhook. The webhook
+// handles conversion for all types that implement conversion.Hub or
+// conversion.Convertible, a CRD should be added here when a new version of
+// it is introduced.
+var convertedCRDs = []string{"connectors.tailscale.com"}
+
+// webhookCertDir is where the webhook server reads its serving certificate
+// from.
+var webhookCertDir = filepath.Join(os.TempDir(), "tailscale-operator-webhook")
+
+// conversionWebhook manages the operator's CRD conversion webhook: it issues
+// and renews the webhook server's self-signed serving certificate, configures
+// the converted CRDs to call the webhook and trust the certificate, and
+// migrates stored objects to the CRDs' storage versions.
+type conversionWebhook struct {
+	// cl is a client that reads directly from the API server, as sync is
+	// called before the manager's caches are started.
+	cl      client.Client
+	ns      string // operator's namespace
+	certDir string // where the webhook server reads its certificate from
+	clock   tstime.Clock
+	logger  *zap.SugaredLogger
+}
+
+// sync ensures that the webhook server has a valid serving certificate and
+// that the converted CRDs are configured to use the webhook.
+func (w *conversionWebhook) sync(ctx context.Context) error {
+	sec, err := w.ensureCertSecret(ctx)
+	if err != nil {
+		return fmt.Errorf("error ensuring webhook serving certificate: %w", err)
+	}
+	if err := os.MkdirAll(w.certDir, 0700); err != nil {
+		return err
+	}
+	for name, key := range map[string]string{"tls.crt": corev1.TLSCertKey, "tls.key": corev1.TLSPrivateKeyKey} {
+		p := filepath.Join(w.certDir, name)
+		if old, err := os.ReadFile(p); err == nil && bytes.Equal(old, sec.Data[key]) {
+			continue
+		}
+		if err := os.WriteFile(p, sec.Data[key], 0600); err != nil {
+			return fmt.Errorf("error writing webhook serving certificate: %w", err)
+		}
+	}
+	caBundle := sec.Data[keyCABundle]
+	if len(caBundle) == 0 {
+		caBundle = sec.Data[corev1.TLSCertKey]
+	}
+	for _, name := range convertedCRDs {
+		if err := w.configureCRD(ctx, name, caBundle); err != nil {
+			return fmt.Errorf("error configuring conversion webhook for CRD %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Start implements manager.Runnable. Once the webhook server is running, it
+// migrates the stored objects of the converted CRDs to their storage
+// versions, and then periodically renews the webhook serving certificate.
+func (w *conversionWebhook) Start(ctx context.Context) error {
+	for _, name := range convertedCRDs {
+		go w.migrate(ctx, name)
+	}
+	t, tc := w.clock.NewTicker(webhookCertCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tc:
+			if err := w.sync(ctx); err != nil {
+				w.logger.Errorf("error syncing conversion webhook: %v", err)
+			}
+		}
+	}
+}
+
+// migrate runs the storage version migration for the named CRD, retrying
+// on failures until it succeeds. The first attempts can fail while the API
+// server picks up the conversion webhook configuration.
+func (w *conversionWebhook) migrate(ctx context.Context, crdName string) {
+	backoff := 5 * time.Second
+	for {
+		err := migrateStorageVersion(ctx, w.cl, crdName, w.logger)
+		if err == nil {
+			return
+		}
+		w.logger.Infof("error migrating %s to storage version, retrying in %v: %v", crdName, backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 5*time.Minute)
+	}
+}
+
+// configureCRD configures the named CRD to use the operator's conversion
+// webhook, trusting the certificates in caBundle. CRDs that are not installed
+// or only have a single version, for example because they were installed
+// from an older release, are left as they are.
+func (w *conversionWebhook) configureCRD(ctx context.Context, crdName string, caBundle []byte) error {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := w.cl.Get(ctx, client.ObjectKey{Name: crdName}, crd); apierrors.IsNotFound(err) {
+		w.logger.Infof("CRD %s not found, not configuring conversion webhook", crdName)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(crd.Spec.Versions) < 2 {
+		return nil
+	}
+	want := &apiextensionsv1.CustomResourceConversion{
+		Strategy: apiextensionsv1.WebhookConverter,
+		Webhook: &apiextensionsv1.WebhookConversion{
+			ClientConfig: &apiextensionsv1.WebhookClientConfig{
+				Service: &apiextensionsv1.ServiceReference{
+					Namespace: w.ns,
+					Name:      webhookServiceName,
+					Path:      ptr.To(conversionWebhookPath),
+					Port:      ptr.To[int32](443),
+				},
+				CABundle: caBundle,
+			},
+			ConversionReviewVersions: []string{"v1"},
+		},
+	}
+	if apiequality.Semantic.DeepEqual(crd.Spec.Conversion, want) {
+		return nil
+	}
+	w.logger.Infof("configuring conversion webhook for CRD %s", crdName)
+	crd.Spec.Conversion = want
+	return w.cl.Update(ctx, crd)
+}
+
+// ensureCertSecret returns the Secret with the webhook serving certificate,
+// issuing a new certificate if there is none yet, or the current one expires
+// within webhookCertRenewBefore.
+func (w *conversionWebhook) ensureCertSecret(ctx context.Context) (*corev1.Secret, error) {
+	sec := &corev1.Secret{}
+	err := w.cl.Get(ctx, client.ObjectKey{Namespace: w.ns, Name: webhookCertSecretName}, sec)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	exists := err == nil
+	dnsNames := webhookDNSNames(w.ns)
+	now := w.clock.Now()
+	old, err := parseCertPEM(sec.Data[corev1.TLSCertKey])
+	if err == nil && slices.Equal(old.DNSNames, dnsNames) && now.Add(webhookCertRenewBefore).Before(old.NotAfter) {
+		return sec, nil
+	}
+
+	w.logger.Infof("issuing new webhook serving certificate")
+	certPEM, keyPEM, err := newWebhookCert(dnsNames, now)
+	if err != nil {
+		return nil, err
+	}
+	caBundle := slices.Clone(certPEM)
+	if old != nil && now.Before(old.NotAfter) {
+		// Keep trusting the previous certificate until all webhook
+		// servers have picked up the new one.
+		caBundle = append(caBundle, sec.Data[corev1.TLSCertKey]...)
+	}
+	sec.ObjectMeta = metav1.ObjectMeta{
+		Name:            webhookCertSecretName,
+		Namespace:       w.ns,
+		ResourceVersion: sec.ResourceVersion,
+		Labels:          sec.Labels,
+		Annotations:     sec.Annotations,
+	}
+	sec.Type = corev1.SecretTypeTLS
+	sec.Data = map[string][]byte{
+		corev1.TLSCertKey:       certPEM,
+		corev1.TLSPrivateKeyKey: keyPEM,
+		keyCABundle:             caBundle,
+	}
+	if exists {
+		err = w.cl.Update(ctx, sec)
+	} else {
+		err = w.cl.Create(ctx, sec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sec, nil
+}
+
+// webhookDNSNames returns the DNS names that the webhook serving certificate
+// must be valid for.
+func webhookDNSNames(ns string) []string {
+	return []string{
+		fmt.Sprintf("%s.%s.svc", webhookServiceName, ns),
+		fmt.Sprintf("%s.%s.svc.cluster.local", webhookServiceName, ns),
+	}
+}
+
+// newWebhookCert returns a PEM encoded self-signed certificate and private
+// key for the given DNS names, valid from now for webhookCertValidity. The
+// certificate is its own CA, so that it can be used as the CRDs' caBundle.
+func newWebhookCert(dnsNames []string, now time.Time) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:              dnsNames,
+		NotBefore:             now.Add(-time.Hour), // allow for clock skew
+		NotAfter:              now.Add(webhookCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func parseCertPEM(b []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -0,0 +1,283 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+	tsapiv1 "tailscale.com/k8s-operator/apis/v1"
+	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
+	"tailscale.com/tstest"
+	"tailscale.com/types/ptr"
+)
+
+func connectorsCRD(storedVersions ...string) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "connectors.tailscale.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "tailscale.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Kind:     "Connector",
+				ListKind: "ConnectorList",
+				Plural:   "connectors",
+			},
+			Scope: apiextensionsv1.ClusterScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1", Served: true, Storage: true},
+				{Name: "v1alpha1", Served: true},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			StoredVersions: storedVersions,
+		},
+	}
+}
+
+func TestConversionWebhookSync(t *testing.T) {
+	crd := connectorsCRD("v1alpha1")
+	fc := fake.NewClientBuilder().
+		WithScheme(tsapi.GlobalScheme).
+		WithObjects(crd).
+		Build()
+	zl, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := tstest.NewClock(tstest.ClockOpts{})
+	w := &conversionWebhook{
+		cl:      fc,
+		ns:      "operator-ns",
+		certDir: t.TempDir(),
+		clock:   cl,
+		logger:  zl.Sugar(),
+	}
+
+	getSecret := func() *corev1.Secret {
+		t.Helper()
+		sec := &corev1.Secret{}
+		if err := fc.Get(context.Background(), client.ObjectKey{Namespace: "operator-ns", Name: webhookCertSecretName}, sec); err != nil {
+			t.Fatalf("error getting webhook certificate Secret: %v", err)
+		}
+		return sec
+	}
+	checkConfigured := func(wantCABundle []byte) {
+		t.Helper()
+		for name, key := range map[string]string{"tls.crt": corev1.TLSCertKey, "tls.key": corev1.TLSPrivateKeyKey} {
+			b, err := os.ReadFile(filepath.Join(w.certDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, getSecret().Data[key]) {
+				t.Errorf("%s does not match the Secret", name)
+			}
+		}
+		got := &apiextensionsv1.CustomResourceDefinition{}
+		if err := fc.Get(context.Background(), client.ObjectKey{Name: crd.Name}, got); err != nil {
+			t.Fatal(err)
+		}
+		want := &apiextensionsv1.CustomResourceConversion{
+			Strategy: apiextensionsv1.WebhookConverter,
+			Webhook: &apiextensionsv1.WebhookConversion{
+				ClientConfig: &apiextensionsv1.WebhookClientConfig{
+					Service: &apiextensionsv1.ServiceReference{
+						Namespace: "operator-ns",
+						Name:      "operator-webhook",
+						Path:      ptr.To("/convert"),
+						Port:      ptr.To[int32](443),
+					},
+					CABundle: wantCABundle,
+				},
+				ConversionReviewVersions: []string{"v1"},
+			},
+		}
+		if diff := cmp.Diff(want, got.Spec.Conversion); diff != "" {
+			t.Errorf("unexpected CRD conversion config (-want +got):\n%s", diff)
+		}
+	}
+
+	// 1. A certificate is issued and the CRD configured to trust it.
+	if err := w.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sec := getSecret()
+	cert, err := parseCertPEM(sec.Data[corev1.TLSCertKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"operator-webhook.operator-ns.svc", "operator-webhook.operator-ns.svc.cluster.local"}, cert.DNSNames); diff != "" {
+		t.Errorf("unexpected certificate DNS names (-want +got):\n%s", diff)
+	}
+	checkConfigured(sec.Data[corev1.TLSCertKey])
+
+	// 2. The certificate is reused while it is valid.
+	cl.Advance(webhookCertValidity - webhookCertRenewBefore - 24*time.Hour)
+	if err := w.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(getSecret().Data[corev1.TLSCertKey], sec.Data[corev1.TLSCertKey]) {
+		t.Fatal("certificate was renewed before it was due")
+	}
+
+	// 3. The certificate is renewed when it is about to expire, and the
+	// previous one is still trusted.
+	cl.Advance(48 * time.Hour)
+	if err := w.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	renewed := getSecret()
+	if bytes.Equal(renewed.Data[corev1.TLSCertKey], sec.Data[corev1.TLSCertKey]) {
+		t.Fatal("certificate was not renewed")
+	}
+	wantCABundle := append(bytes.Clone(renewed.Data[corev1.TLSCertKey]), sec.Data[corev1.TLSCertKey]...)
+	checkConfigured(wantCABundle)
+}
+
+func TestConversionWebhookSingleVersionCRD(t *testing.T) {
+	crd := connectorsCRD("v1alpha1")
+	crd.Spec.Versions = []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true, Storage: true}}
+	fc := fake.NewClientBuilder().
+		WithScheme(tsapi.GlobalScheme).
+		WithObjects(crd).
+		Build()
+	w := &conversionWebhook{
+		cl:      fc,
+		ns:      "operator-ns",
+		certDir: t.TempDir(),
+		clock:   tstest.NewClock(tstest.ClockOpts{}),
+		logger:  zap.NewNop().Sugar(),
+	}
+	if err := w.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := &apiextensionsv1.CustomResourceDefinition{}
+	if err := fc.Get(context.Background(), client.ObjectKey{Name: crd.Name}, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Spec.Conversion != nil {
+		t.Errorf("CRD with a single version was configured for conversion: %+v", got.Spec.Conversion)
+	}
+}
+
+func TestConversionWebhookHandler(t *testing.T) {
+	if ok, err := conversion.IsConvertible(tsapi.GlobalScheme, &tsapiv1.Connector{}); err != nil || !ok {
+		t.Fatalf("Connector is not convertible: %v, %v", ok, err)
+	}
+	srv := httptest.NewServer(conversion.NewWebhookHandler(tsapi.GlobalScheme))
+	defer srv.Close()
+
+	cn := &tsapi.Connector{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "tailscale.com/v1alpha1", Kind: "Connector"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec: tsapi.ConnectorSpec{
+			SubnetRouter: &tsapi.SubnetRouter{AdvertiseRoutes: tsapi.Routes{"10.40.0.0/14"}},
+		},
+		Status: tsapi.ConnectorStatus{SubnetRoutes: "10.40.0.0/14"},
+	}
+	raw, err := json.Marshal(cn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	review := &apiextensionsv1.ConversionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apiextensions.k8s.io/v1", Kind: "ConversionReview"},
+		Request: &apiextensionsv1.ConversionRequest{
+			UID:               "1234",
+			DesiredAPIVersion: "tailscale.com/v1",
+			Objects:           []runtime.RawExtension{{Raw: raw}},
+		},
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(srv.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got := &apiextensionsv1.ConversionReview{}
+	if err := json.NewDecoder(resp.Body).Decode(got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Response == nil || got.Response.Result.Status != metav1.StatusSuccess {
+		t.Fatalf("conversion failed: %+v", got.Response)
+	}
+	if len(got.Response.ConvertedObjects) != 1 {
+		t.Fatalf("got %d converted objects, want 1", len(got.Response.ConvertedObjects))
+	}
+	converted := &tsapiv1.Connector{}
+	if err := json.Unmarshal(got.Response.ConvertedObjects[0].Raw, converted); err != nil {
+		t.Fatal(err)
+	}
+	if converted.APIVersion != "tailscale.com/v1" {
+		t.Errorf("got apiVersion %q, want tailscale.com/v1", converted.APIVersion)
+	}
+	if diff := cmp.Diff(tsapiv1.Routes{"10.40.0.0/14"}, converted.Status.SubnetRoutes); diff != "" {
+		t.Errorf("unexpected converted subnet routes (-want +got):\n%s", diff)
+	}
+}
+
+func TestMigrateStorageVersion(t *testing.T) {
+	crd := connectorsCRD("v1alpha1", "v1")
+	cns := []client.Object{
+		&tsapiv1.Connector{ObjectMeta: metav1.ObjectMeta{Name: "foo"}, Spec: tsapiv1.ConnectorSpec{ExitNode: true}},
+		&tsapiv1.Connector{ObjectMeta: metav1.ObjectMeta{Name: "bar"}, Spec: tsapiv1.ConnectorSpec{ExitNode: true}},
+	}
+	var updated []string
+	fc := fake.NewClientBuilder().
+		WithScheme(tsapi.GlobalScheme).
+		WithObjects(crd).
+		WithObjects(cns...).
+		WithStatusSubresource(crd).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				updated = append(updated, obj.GetObjectKind().GroupVersionKind().Version+"/"+obj.GetName())
+				return c.Update(ctx, obj, opts...)
+			},
+		}).
+		Build()
+	zl := zap.NewNop().Sugar()
+
+	if err := migrateStorageVersion(context.Background(), fc, crd.Name, zl); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"v1/bar", "v1/foo"}, updated); diff != "" {
+		t.Errorf("unexpected migrated objects (-want +got):\n%s", diff)
+	}
+	got := &apiextensionsv1.CustomResourceDefinition{}
+	if err := fc.Get(context.Background(), client.ObjectKey{Name: crd.Name}, got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"v1"}, got.Status.StoredVersions); diff != "" {
+		t.Errorf("unexpected stored versions (-want +got):\n%s", diff)
+	}
+
+	// Once migrated, objects are not rewritten again.
+	updated = nil
+	if err := migrateStorageVersion(context.Background(), fc, crd.Name, zl); err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 0 {
+		t.Errorf("objects rewritten after migration: %v", updated)
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"tailscale.com/client/tailscale"
+	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
+	"tailscale.com/kube/kubetypes"
+	"tailscale.com/tstime"
+	"tailscale.com/util/clientmetric"
+)
+
+const (
+	// defaultDriftCheckInterval is how often the drift detector runs unless
+	// OPERATOR_DRIFT_CHECK_INTERVAL is set.
+	defaultDriftCheckInterval = 5 * time.Minute
+
+	reasonProxyDrift       = "ProxyDrift"
+	reasonOrphanedResource = "OrphanedResource"
+)
+
+var (
+	// gaugeDriftedProxies tracks the number of proxies whose resources had
+	// drifted from their desired state in the last drift check.
+	gaugeDriftedProxies = clientmetric.NewGauge(kubetypes.MetricDriftedProxyCount)
+	// gaugeOrphanedResources tracks the number of proxy resources whose
+	// parent resource no longer exists, as of the last drift check.
+	gaugeOrphanedResources = clientmetric.NewGauge(kubetypes.MetricOrphanedResourceCount)
+	// counterDriftRepairs counts the reconciles triggered to repair drift.
+	counterDriftRepairs = clientmetric.NewCounter(kubetypes.MetricDriftRepairCount)
+)
+
+// driftDetector periodically checks that the proxies that the operator
+// manages for Services, Ingresses and Connectors match their desired state,
+// for drift that the operator's watches don't catch, such as child resources
+// deleted while the operator was down or proxy devices deleted from the
+// tailnet.
+//
+// Drift that a reconcile can repair, such as a missing StatefulSet or state
+// Secret, is repaired by sending the parent resource to the reconciler via
+// resync. Other drift, such as a proxy device missing from the tailnet or
+// resources left behind by a parent resource that no longer exists, is
+// reported via events, logs and metrics.
+type driftDetector struct {
+	client.Client
+	tsClient    tsClient
+	tsNamespace string
+	recorder    record.EventRecorder
+	logger      *zap.SugaredLogger
+	clock       tstime.Clock
+	interval    time.Duration
+
+	// resync contains a channel for each parent type ("svc", "ingress" and
+	// "connector"), to which parent resources that need to be reconciled
+	// to repair drift are sent. Each channel is a source for the
+	// reconciler of that type.
+	resync map[string]chan event.GenericEvent
+}
+
+// driftParentTypes are the parent types of the proxies checked for drift.
+var driftParentTypes = []string{"svc", "ingress", "connector"}
+
+func newDriftDetector(cl client.Client, tsc tsClient, tsNamespace string, recorder record.EventRecorder, logger *zap.SugaredLogger, interval time.Duration) *driftDetector {
+	d := &driftDetector{
+		Client:      cl,
+		tsClient:    tsc,
+		tsNamespace: tsNamespace,
+		recorder:    recorder,
+		logger:      logger,
+		clock:       tstime.DefaultClock{},
+		interval:    interval,
+		resync:      make(map[string]chan event.GenericEvent),
+	}
+	for _, typ := range driftParentTypes {
+		d.resync[typ] = make(chan event.GenericEvent)
+	}
+	return d
+}
+
+// Start implements manager.Runnable.
+func (d *driftDetector) Start(ctx context.Context) error {
+	if d.interval <= 0 {
+		d.logger.Infof("drift detection disabled")
+		return nil
+	}
+	t, tc := d.clock.NewTicker(d.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tc:
+			if err := d.check(ctx); err != nil {
+				d.logger.Errorf("error checking proxies for drift: %v", err)
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so that only
+// the leader repairs drift.
+func (d *driftDetector) NeedLeaderElection() bool {
+	return true
+}
+
+// check runs one drift check of all proxies.
+func (d *driftDetector) check(ctx context.Context) error {
+	var drifted int
+	for _, typ := range driftParentTypes {
+		parents, err := d.managedParents(ctx, typ)
+		if err != nil {
+			return fmt.Errorf("error listing %s parents: %w", typ, err)
+		}
+		for _, p := range parents {
+			problems, repair, err := d.checkProxy(ctx, p, typ)
+			if err != nil {
+				return fmt.Errorf("error checking proxy for %s %s: %w", typ, client.ObjectKeyFromObject(p), err)
+			}
+			if len(problems) == 0 {
+				continue
+			}
+			drifted++
+			for _, msg := range problems {
+				d.logger.Infof("proxy for %s %s has drifted: %s", typ, client.ObjectKeyFromObject(p), msg)
+				d.recorder.Event(p, corev1.EventTypeWarning, reasonProxyDrift, msg)
+			}
+			if repair {
+				counterDriftRepairs.Add(1)
+				select {
+				case d.resync[typ] <- event.GenericEvent{Object: p}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	}
+	gaugeDriftedProxies.Set(int64(drifted))
+
+	orphans, err := d.orphanedResources(ctx)
+	if err != nil {
+		return fmt.Errorf("error checking for orphaned resources: %w", err)
+	}
+	for _, o := range orphans {
+		msg := fmt.Sprintf("%s %s was created for %s %s, which no longer exists", o.GetObjectKind().GroupVersionKind().Kind, o.GetName(), o.GetLabels()[LabelParentType], parentFromObjectLabels(o))
+		d.logger.Info(msg)
+		d.recorder.Event(o, corev1.EventTypeWarning, reasonOrphanedResource, msg)
+	}
+	gaugeOrphanedResources.Set(int64(len(orphans)))
+	return nil
+}
+
+// managedParents returns the parent resources of type typ that have proxies,
+// which are those with the operator's finalizer that aren't being deleted.
+func (d *driftDetector) managedParents(ctx context.Context, typ string) ([]client.Object, error) {
+	var objs []client.Object
+	switch typ {
+	case "svc":
+		var l corev1.ServiceList
+		if err := d.List(ctx, &l); err != nil {
+			return nil, err
+		}
+		for i := range l.Items {
+			// Services exposed via ProxyGroups have no proxies of
+			// their own.
+			if _, ok := l.Items[i].Annotations[AnnotationProxyGroup]; !ok {
+				objs = append(objs, &l.Items[i])
+			}
+		}
+	case "ingress":
+		var l networkingv1.IngressList
+		if err := d.List(ctx, &l); err != nil {
+			return nil, err
+		}
+		for i := range l.Items {
+			objs = append(objs, &l.Items[i])
+		}
+	case "connector":
+		var l tsapi.ConnectorList
+		if err := d.List(ctx, &l); err != nil {
+			return nil, err
+		}
+		for i := range l.Items {
+			objs = append(objs, &l.Items[i])
+		}
+	default:
+		return nil, fmt.Errorf("unknown parent type %q", typ)
+	}
+	return slices.DeleteFunc(objs, func(o client.Object) bool {
+		return !o.GetDeletionTimestamp().IsZero() || !slices.Contains(o.GetFinalizers(), FinalizerName)
+	}), nil
+}
+
+// checkProxy checks the proxy for parent p of type typ, returning a message
+// for each problem found, and whether reconciling p will repair them.
+func (d *driftDetector) checkProxy(ctx context.Context, p client.Object, typ string) (problems []string, repair bool, _ error) {
+	labels := childResourceLabels(p.GetName(), p.GetNamespace(), typ)
+	sts, err := getSingleObject[appsv1.StatefulSet](ctx, d.Client, d.tsNamespace, labels)
+	if err != nil {
+		return nil, false, err
+	}
+	sec, err := getSingleObject[corev1.Secret](ctx, d.Client, d.tsNamespace, labels)
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case sts == nil && sec == nil:
+		return []string{"proxy StatefulSet and state Secret are missing; recreating them"}, true, nil
+	case sts == nil:
+		problems = append(problems, "proxy StatefulSet is missing; recreating it")
+		repair = true
+	case sec == nil:
+		// The StatefulSet is only ever created after its state Secret,
+		// so reconciling doesn't recreate the Secret while it exists.
+		if err := d.Delete(ctx, sts); err != nil && !apierrors.IsNotFound(err) {
+			return nil, false, fmt.Errorf("error deleting StatefulSet %s: %w", sts.Name, err)
+		}
+		return []string{"proxy state Secret is missing; recreating the proxy"}, true, nil
+	}
+
+	id := string(sec.Data[kubetypes.KeyDeviceID])
+	if id == "" || d.tsClient == nil {
+		return problems, repair, nil
+	}
+	if _, err := d.tsClient.Device(ctx, id, nil); err != nil {
+		errResp := &tailscale.ErrResponse{}
+		if !errors.As(err, errResp) || errResp.Status != http.StatusNotFound {
+			return nil, false, fmt.Errorf("error getting device %s: %w", id, err)
+		}
+		problems = append(problems, fmt.Sprintf("proxy device %s no longer exists in the tailnet; set or change the %s annotation to log the proxy in as a new device", id, AnnotationForceResync))
+	}
+	return problems, repair, nil
+}
+
+// orphanedResources returns the resources in the operator's namespace that
+// were created for a parent Service, Ingress or Connector that no longer
+// exists.
+func (d *driftDetector) orphanedResources(ctx context.Context) ([]client.Object, error) {
+	var children []client.Object
+	sel := client.MatchingLabels{LabelManaged: "true"}
+	var stsList appsv1.StatefulSetList
+	if err := d.List(ctx, &stsList, client.InNamespace(d.tsNamespace), sel); err != nil {
+		return nil, err
+	}
+	for i := range stsList.Items {
+		stsList.Items[i].SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("StatefulSet"))
+		children = append(children, &stsList.Items[i])
+	}
+	var secList corev1.SecretList
+	if err := d.List(ctx, &secList, client.InNamespace(d.tsNamespace), sel); err != nil {
+		return nil, err
+	}
+	for i := range secList.Items {
+		secList.Items[i].SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+		children = append(children, &secList.Items[i])
+	}
+	var epsList discoveryv1.EndpointSliceList
+	if err := d.List(ctx, &epsList, client.InNamespace(d.tsNamespace), sel); err != nil {
+		return nil, err
+	}
+	for i := range epsList.Items {
+		epsList.Items[i].SetGroupVersionKind(discoveryv1.SchemeGroupVersion.WithKind("EndpointSlice"))
+		children = append(children, &epsList.Items[i])
+	}
+
+	var orphans []client.Object
+	exists := map[string]bool{} // parent type + key => exists
+	for _, c := range children {
+		typ := c.GetLabels()[LabelParentType]
+		var parent client.Object
+		switch typ {
+		case "svc":
+			parent = new(corev1.Service)
+		case "ingress":
+			parent = new(networkingv1.Ingress)
+		case "connector":
+			parent = new(tsapi.Connector)
+		default:
+			continue
+		}
+		key := parentFromObjectLabels(c)
+		k := typ + "/" + key.String()
+		ok, seen := exists[k]
+		if !seen {
+			var err error
+			ok, err = d.parentExists(ctx, key, parent)
+			if err != nil {
+				return nil, err
+			}
+			exists[k] = ok
+		}
+		if !ok {
+			orphans = append(orphans, c)
+		}
+	}
+	return orphans, nil
+}
+
+func (d *driftDetector) parentExists(ctx context.Context, key types.NamespacedName, parent client.Object) (bool, error) {
+	err := d.Get(ctx, key, parent)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
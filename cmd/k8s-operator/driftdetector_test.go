@@ -0,0 +1,163 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
+	"tailscale.com/kube/kubetypes"
+	"tailscale.com/tstest"
+	"tailscale.com/types/ptr"
+	"tailscale.com/util/mak"
+)
+
+func TestDriftDetector(t *testing.T) {
+	fc := fake.NewClientBuilder().
+		WithScheme(tsapi.GlobalScheme).
+		Build()
+	ft := &fakeTSClient{}
+	zl, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr := &ServiceReconciler{
+		Client: fc,
+		ssr: &tailscaleSTSReconciler{
+			Client:            fc,
+			tsClient:          ft,
+			defaultTags:       []string{"tag:k8s"},
+			operatorNamespace: "operator-ns",
+			proxyImage:        "tailscale/tailscale",
+		},
+		logger:   zl.Sugar(),
+		clock:    tstest.NewClock(tstest.ClockOpts{}),
+		recorder: record.NewFakeRecorder(100),
+	}
+	rec := record.NewFakeRecorder(100)
+	dd := newDriftDetector(fc, ft, "operator-ns", rec, zl.Sugar(), time.Minute)
+	for typ := range dd.resync {
+		dd.resync[typ] = make(chan event.GenericEvent, 10)
+	}
+	check := func() {
+		t.Helper()
+		if err := dd.check(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectResync := func(want ...string) {
+		t.Helper()
+		var got []string
+		for len(dd.resync["svc"]) > 0 {
+			got = append(got, (<-dd.resync["svc"]).Object.GetName())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("resynced Services = %q, want %q", got, want)
+		}
+	}
+
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+			UID:       types.UID("1234-UID"),
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:         "10.20.30.40",
+			Type:              corev1.ServiceTypeLoadBalancer,
+			LoadBalancerClass: ptr.To("tailscale"),
+		},
+	})
+	expectReconciled(t, sr, "default", "test")
+	fullName, shortName := findGenName(t, fc, "default", "test", "svc")
+	mustUpdate(t, fc, "operator-ns", fullName, func(s *corev1.Secret) {
+		s.Data = map[string][]byte{kubetypes.KeyDeviceID: []byte("ts-id-1234")}
+	})
+
+	// A proxy in its desired state is left alone.
+	check()
+	expectResync()
+	if got := gaugeDriftedProxies.Value(); got != 0 {
+		t.Errorf("drifted proxies = %d, want 0", got)
+	}
+
+	// A missing StatefulSet is repaired by reconciling the Service.
+	if err := fc.Delete(context.Background(), &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: shortName, Namespace: "operator-ns"}}); err != nil {
+		t.Fatal(err)
+	}
+	check()
+	expectEvents(t, rec, []string{"Warning ProxyDrift proxy StatefulSet is missing; recreating it"})
+	expectResync("test")
+	if got := gaugeDriftedProxies.Value(); got != 1 {
+		t.Errorf("drifted proxies = %d, want 1", got)
+	}
+	expectReconciled(t, sr, "default", "test")
+	check()
+	expectResync()
+
+	// A proxy device missing from the tailnet is only reported.
+	ft.Lock()
+	ft.missing = []string{"ts-id-1234"}
+	ft.Unlock()
+	check()
+	expectEvents(t, rec, []string{"Warning ProxyDrift proxy device ts-id-1234 no longer exists in the tailnet; set or change the tailscale.com/force-resync annotation to log the proxy in as a new device"})
+	expectResync()
+
+	// Forcing a resync logs the proxy in as a new device.
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		mak.Set(&s.Annotations, AnnotationForceResync, "1")
+	})
+	expectReconciled(t, sr, "default", "test")
+	if got := len(ft.KeyRequests()); got != 2 {
+		t.Errorf("auth key requests = %d, want 2", got)
+	}
+	sec := new(corev1.Secret)
+	if err := fc.Get(context.Background(), client.ObjectKey{Namespace: "operator-ns", Name: fullName}, sec); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sec.Data[kubetypes.KeyDeviceID]; ok {
+		t.Errorf("proxy state not reset after forced resync: %v", sec.Data)
+	}
+	sts := new(appsv1.StatefulSet)
+	if err := fc.Get(context.Background(), client.ObjectKey{Namespace: "operator-ns", Name: shortName}, sts); err != nil {
+		t.Fatal(err)
+	}
+	if got := sts.Spec.Template.Annotations[podAnnotationLastResync]; got != "1" {
+		t.Errorf("%s annotation = %q, want %q", podAnnotationLastResync, got, "1")
+	}
+
+	// A resync already done isn't repeated.
+	expectReconciled(t, sr, "default", "test")
+	if got := len(ft.KeyRequests()); got != 2 {
+		t.Errorf("auth key requests = %d, want 2", got)
+	}
+
+	// Resources whose parent no longer exists are reported.
+	mustCreate(t, fc, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "orphan",
+			Namespace: "operator-ns",
+			Labels:    childResourceLabels("gone", "default", "svc"),
+		},
+	})
+	check()
+	expectEvents(t, rec, []string{"Warning OrphanedResource Secret orphan was created for svc default/gone, which no longer exists"})
+	if got := gaugeOrphanedResources.Value(); got != 1 {
+		t.Errorf("orphaned resources = %d, want 1", got)
+	}
+}
@@ -11,6 +11,7 @@
 	"fmt"
 	"net/netip"
 	"reflect"
+	"slices"
 	"strings"
 
 	"go.uber.org/zap"
@@ -21,6 +22,7 @@
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	tsoperator "tailscale.com/k8s-operator"
+	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
 	"tailscale.com/kube/egressservices"
 	"tailscale.com/types/ptr"
 )
@@ -33,7 +35,8 @@ type egressEpsReconciler struct {
 }
 
 // Reconcile reconciles an EndpointSlice for a tailnet service. It updates the EndpointSlice with the endpoints of
-// those ProxyGroup Pods that are ready to route traffic to the tailnet service.
+// those ProxyGroup Pods that are ready to route traffic to the tailnet service. During a BlueGreen upgrade of the
+// ProxyGroup, it gradually shifts the endpoints from the old proxies to the new ones.
 // It compares tailnet service state stored in egress proxy state Secrets by containerboot with the desired
 // configuration stored in proxy-cfg ConfigMap to determine if the endpoint is ready.
 func (er *egressEpsReconciler) Reconcile(ctx context.Context, req reconcile.Request) (res reconcile.Result, err error) {
@@ -96,14 +99,28 @@ func (er *egressEpsReconciler) Reconcile(ctx context.Context, req reconcile.Requ
 		return res, nil
 	}
 
+	// The ProxyGroup determines which of its sets of proxies should serve
+	// traffic, and how to split it between them during a BlueGreen upgrade.
+	pg := &tsapi.ProxyGroup{ObjectMeta: metav1.ObjectMeta{Name: proxyGroupName}}
+	if err := er.Get(ctx, client.ObjectKeyFromObject(pg), pg); err != nil && !apierrors.IsNotFound(err) {
+		return res, fmt.Errorf("error retrieving ProxyGroup %s: %w", proxyGroupName, err)
+	}
+
 	// Check which Pods in ProxyGroup are ready to route traffic to this
 	// egress service.
 	podList := &corev1.PodList{}
 	if err := er.List(ctx, podList, client.MatchingLabels(pgLabels(proxyGroupName, nil))); err != nil {
 		return res, fmt.Errorf("error listing Pods for ProxyGroup %s: %w", proxyGroupName, err)
 	}
-	newEndpoints := make([]discoveryv1.Endpoint, 0)
+	slices.SortFunc(podList.Items, func(a, b corev1.Pod) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	var activePods, targetPods []corev1.Pod
 	for _, pod := range podList.Items {
+		set := pgPodSet(&pod)
+		if !slices.Contains(pgSets(pg), set) {
+			continue // proxy of a retired set, draining
+		}
 		ready, err := er.podIsReadyToRouteTraffic(ctx, pod, &cfg, tailnetSvc, l)
 		if err != nil {
 			return res, fmt.Errorf("error verifying if Pod is ready to route traffic: %w", err)
@@ -111,6 +128,18 @@ func (er *egressEpsReconciler) Reconcile(ctx context.Context, req reconcile.Requ
 		if !ready {
 			continue // maybe next time
 		}
+		if set == pgActiveSet(pg) {
+			activePods = append(activePods, pod)
+		} else {
+			targetPods = append(targetPods, pod)
+		}
+	}
+	var step int32
+	if pg.Status.Upgrade != nil {
+		step = pg.Status.Upgrade.Step
+	}
+	newEndpoints := make([]discoveryv1.Endpoint, 0)
+	for _, pod := range shiftTraffic(activePods, targetPods, step, pgUpgradeSteps(pg)) {
 		podIP, err := podIPv4(&pod) // we currently only support IPv4
 		if err != nil {
 			return res, fmt.Errorf("error determining IPv4 address for Pod: %w", err)
@@ -137,6 +166,28 @@ func (er *egressEpsReconciler) Reconcile(ctx context.Context, req reconcile.Requ
 	return res, nil
 }
 
+// shiftTraffic returns the Pods to use as endpoints out of the ready proxies
+// of a ProxyGroup's active set and of the target set of its BlueGreen upgrade,
+// if any, after step of steps traffic shifting steps. Traffic is weighted by
+// the share of endpoints from each set, so at step n the target set gets
+// about n/steps of the traffic, limited by the number of ready proxies. If
+// that would leave no endpoints, all ready proxies are used, so that traffic
+// is never dropped while some proxy can route it.
+func shiftTraffic(active, target []corev1.Pod, step, steps int32) []corev1.Pod {
+	step = min(step, steps)
+	nActive := ceilDiv(len(active)*int(steps-step), int(steps))
+	nTarget := ceilDiv(len(target)*int(step), int(steps))
+	pods := append(slices.Clip(active[:nActive]), target[:nTarget]...)
+	if len(pods) == 0 {
+		return append(slices.Clip(active), target...)
+	}
+	return pods
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
 func podIPv4(pod *corev1.Pod) (string, error) {
 	for _, ip := range pod.Status.PodIPs {
 		parsed, err := netip.ParseAddr(ip.IP)
@@ -208,6 +259,10 @@ func (er *egressEpsReconciler) podIsReadyToRouteTraffic(ctx context.Context, pod
 		l.Debugf("proxy has configured egress service for ports %#+v, wants ports %#+v, waiting for proxy to reconfigure", st.Ports, cfg.Ports)
 		return false, nil
 	}
+	if cfg.ClientIP != st.ClientIP {
+		l.Debugf("proxy has configured egress service with client IP mode %q, wants %q, waiting for proxy to reconfigure", st.ClientIP, cfg.ClientIP)
+		return false, nil
+	}
 	l.Debugf("proxy is ready to route traffic to egress service")
 	return true, nil
 }
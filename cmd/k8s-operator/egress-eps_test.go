@@ -9,6 +9,7 @@
 	"encoding/json"
 	"fmt"
 	"math/rand/v2"
+	"reflect"
 	"testing"
 
 	"github.com/AlekSi/pointer"
@@ -126,6 +127,45 @@ func TestTailscaleEgressEndpointSlices(t *testing.T) {
 	})
 }
 
+func TestShiftTraffic(t *testing.T) {
+	pods := func(names ...string) (pods []corev1.Pod) {
+		for _, n := range names {
+			pods = append(pods, corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: n}})
+		}
+		return pods
+	}
+	blue := pods("pg-0", "pg-1")
+	green := pods("pg-green-0", "pg-green-1")
+	tests := []struct {
+		name          string
+		active        []corev1.Pod
+		target        []corev1.Pod
+		step, steps   int32
+		wantEndpoints []string
+	}{
+		{name: "no_upgrade", active: blue, steps: 4, wantEndpoints: []string{"pg-0", "pg-1"}},
+		{name: "upgrade_started", active: blue, target: green, steps: 4, wantEndpoints: []string{"pg-0", "pg-1"}},
+		{name: "step_1", active: blue, target: green, step: 1, steps: 4, wantEndpoints: []string{"pg-0", "pg-1", "pg-green-0"}},
+		{name: "step_2", active: blue, target: green, step: 2, steps: 4, wantEndpoints: []string{"pg-0", "pg-green-0"}},
+		{name: "step_3", active: blue, target: green, step: 3, steps: 4, wantEndpoints: []string{"pg-0", "pg-green-0", "pg-green-1"}},
+		{name: "shifted", active: blue, target: green, step: 4, steps: 4, wantEndpoints: []string{"pg-green-0", "pg-green-1"}},
+		{name: "shifted_target_not_ready", active: blue, step: 4, steps: 4, wantEndpoints: []string{"pg-0", "pg-1"}},
+		{name: "started_active_not_ready", target: green, steps: 4, wantEndpoints: []string{"pg-green-0", "pg-green-1"}},
+		{name: "none_ready", steps: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, p := range shiftTraffic(tt.active, tt.target, tt.step, tt.steps) {
+				got = append(got, p.Name)
+			}
+			if !reflect.DeepEqual(got, tt.wantEndpoints) {
+				t.Errorf("got endpoints %v; want %v", got, tt.wantEndpoints)
+			}
+		})
+	}
+}
+
 func configMapForSvc(t *testing.T, svc *corev1.Service, p uint16) *corev1.ConfigMap {
 	t.Helper()
 	ports := make(map[egressservices.PortMap]struct{})
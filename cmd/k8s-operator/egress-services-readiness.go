@@ -9,6 +9,7 @@
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"go.uber.org/zap"
@@ -118,29 +119,37 @@ func (esrr *egressSvcsReadinessReconciler) Reconcile(ctx context.Context, req re
 	podLabels := pgLabels(pg.Name, nil)
 	var readyReplicas int32
 	for i := range replicas {
+		// During a BlueGreen upgrade, each replica has a Pod in both the
+		// active and the target set, and is ready if either of them is.
 		podLabels[appsv1.PodIndexLabel] = fmt.Sprintf("%d", i)
-		pod, err := getSingleObject[corev1.Pod](ctx, esrr.Client, esrr.tsNamespace, podLabels)
-		if err != nil {
+		pods := new(corev1.PodList)
+		if err := esrr.List(ctx, pods, client.InNamespace(esrr.tsNamespace), client.MatchingLabels(podLabels)); err != nil {
 			err = fmt.Errorf("error retrieving ProxyGroup Pod: %w", err)
 			reason = reasonReadinessCheckFailed
 			msg = err.Error()
 			return res, err
 		}
-		if pod == nil {
+		found, ready := false, false
+		for _, pod := range pods.Items {
+			if !slices.Contains(pgSets(pg), pgPodSet(&pod)) {
+				continue
+			}
+			found = true
+			l.Infof("looking at Pod with IPs %v", pod.Status.PodIPs)
+			for _, ep := range eps.Endpoints {
+				l.Infof("looking at endpoint with addresses %v", ep.Addresses)
+				if endpointReadyForPod(&ep, &pod, l) {
+					l.Infof("endpoint is ready for Pod")
+					ready = true
+					break
+				}
+			}
+		}
+		if !found {
 			l.Infof("[unexpected] ProxyGroup is ready, but replica %d was not found", i)
 			reason, msg = reasonClusterResourcesNotReady, reasonClusterResourcesNotReady
 			return res, nil
 		}
-		l.Infof("looking at Pod with IPs %v", pod.Status.PodIPs)
-		ready := false
-		for _, ep := range eps.Endpoints {
-			l.Infof("looking at endpoint with addresses %v", ep.Addresses)
-			if endpointReadyForPod(&ep, pod, l) {
-				l.Infof("endpoint is ready for Pod")
-				ready = true
-				break
-			}
-		}
 		if ready {
 			readyReplicas++
 		}
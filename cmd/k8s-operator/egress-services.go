@@ -531,6 +531,35 @@ func validateEgressService(svc *corev1.Service, pg *tsapi.ProxyGroup) []string {
 	if pg.Spec.Type != tsapi.ProxyGroupTypeEgress {
 		violations = append(violations, fmt.Sprintf("egress Service references ProxyGroup of type %s, must be type %s", pg.Spec.Type, tsapi.ProxyGroupTypeEgress))
 	}
+	if mode, ok := svc.Annotations[AnnotationPreserveClientIP]; ok {
+		switch egressservices.ClientIPMode(mode) {
+		case egressservices.ClientIPProxyProtocol, egressservices.ClientIPHTTP:
+		default:
+			violations = append(violations, fmt.Sprintf("invalid value %q for %s annotation, must be one of %q, %q", mode, AnnotationPreserveClientIP, egressservices.ClientIPProxyProtocol, egressservices.ClientIPHTTP))
+		}
+		violations = append(violations, validateTCPOnly(svc, AnnotationPreserveClientIP)...)
+	}
+	if resolution, ok := svc.Annotations[AnnotationTailnetTargetFQDNResolution]; ok {
+		if resolution != tailnetFQDNResolutionPerConnection {
+			violations = append(violations, fmt.Sprintf("invalid value %q for %s annotation, must be %q", resolution, AnnotationTailnetTargetFQDNResolution, tailnetFQDNResolutionPerConnection))
+		}
+		if svc.Annotations[AnnotationTailnetTargetFQDN] == "" {
+			violations = append(violations, fmt.Sprintf("egress Service with %s annotation must also have %s annotation set", AnnotationTailnetTargetFQDNResolution, AnnotationTailnetTargetFQDN))
+		}
+		violations = append(violations, validateTCPOnly(svc, AnnotationTailnetTargetFQDNResolution)...)
+	}
+	return violations
+}
+
+// validateTCPOnly returns violations for any non-TCP ports of an egress
+// Service with the given annotation, which requires it to be proxied in
+// userspace.
+func validateTCPOnly(svc *corev1.Service, annotation string) (violations []string) {
+	for _, p := range svc.Spec.Ports {
+		if p.Protocol != "" && p.Protocol != corev1.ProtocolTCP {
+			violations = append(violations, fmt.Sprintf("egress Service with %s annotation can only have TCP ports, port %d is %s", annotation, p.Port, p.Protocol))
+		}
+	}
 	return violations
 }
 
@@ -576,7 +605,8 @@ func unusedPort(usedPorts sets.Set[int32]) int32 {
 func tailnetTargetFromSvc(svc *corev1.Service) egressservices.TailnetTarget {
 	if fqdn := svc.Annotations[AnnotationTailnetTargetFQDN]; fqdn != "" {
 		return egressservices.TailnetTarget{
-			FQDN: fqdn,
+			FQDN:                 fqdn,
+			ResolvePerConnection: svc.Annotations[AnnotationTailnetTargetFQDNResolution] == tailnetFQDNResolutionPerConnection,
 		}
 	}
 	return egressservices.TailnetTarget{
@@ -586,7 +616,10 @@ func tailnetTargetFromSvc(svc *corev1.Service) egressservices.TailnetTarget {
 
 func egressSvcCfg(externalNameSvc, clusterIPSvc *corev1.Service) egressservices.Config {
 	tt := tailnetTargetFromSvc(externalNameSvc)
-	cfg := egressservices.Config{TailnetTarget: tt}
+	cfg := egressservices.Config{
+		TailnetTarget: tt,
+		ClientIP:      egressservices.ClientIPMode(externalNameSvc.Annotations[AnnotationPreserveClientIP]),
+	}
 	for _, svcPort := range clusterIPSvc.Spec.Ports {
 		pm := portMap(svcPort)
 		mak.Set(&cfg.Ports, pm, struct{}{})
@@ -692,6 +725,7 @@ type cfg struct {
 	Ports         []corev1.ServicePort         `json:"ports"`
 	TailnetTarget egressservices.TailnetTarget `json:"tailnetTarget"`
 	ProxyGroup    string                       `json:"proxyGroup"`
+	ClientIP      string                       `json:"clientIP,omitempty"`
 }
 
 func svcConfiguredReason(svc *corev1.Service, configured bool, l *zap.SugaredLogger) string {
@@ -707,6 +741,7 @@ func svcConfiguredReason(svc *corev1.Service, configured bool, l *zap.SugaredLog
 		Ports:         svc.Spec.Ports,
 		TailnetTarget: tt,
 		ProxyGroup:    svc.Annotations[AnnotationProxyGroup],
+		ClientIP:      svc.Annotations[AnnotationPreserveClientIP],
 	}
 	r += fmt.Sprintf(":Config:%s", cfgHash(s, l))
 	return r
@@ -140,6 +140,25 @@ func TestTailscaleEgressServices(t *testing.T) {
 		expectReconciled(t, esr, "default", "test")
 		validateReadyService(t, fc, esr, svc, clock, zl, cm)
 	})
+	t.Run("service_preserve_client_ip", func(t *testing.T) {
+		svc.Annotations[AnnotationPreserveClientIP] = string(egressservices.ClientIPProxyProtocol)
+		mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+			s.Annotations[AnnotationPreserveClientIP] = string(egressservices.ClientIPProxyProtocol)
+		})
+		expectReconciled(t, esr, "default", "test")
+		validateReadyService(t, fc, esr, svc, clock, zl, cm)
+	})
+	t.Run("service_resolve_fqdn_per_connection", func(t *testing.T) {
+		svc.Annotations[AnnotationTailnetTargetFQDNResolution] = tailnetFQDNResolutionPerConnection
+		mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+			s.Annotations[AnnotationTailnetTargetFQDNResolution] = tailnetFQDNResolutionPerConnection
+		})
+		expectReconciled(t, esr, "default", "test")
+		validateReadyService(t, fc, esr, svc, clock, zl, cm)
+		if cfg := configFromCM(t, cm, tailnetSvcName(svc)); !cfg.TailnetTarget.ResolvePerConnection {
+			t.Errorf("expected tailnet target to be resolved per connection, got %+v", cfg.TailnetTarget)
+		}
+	})
 
 	t.Run("delete_external_name_service", func(t *testing.T) {
 		name := findGenNameForEgressSvcResources(t, fc, svc)
@@ -301,3 +320,87 @@ func configFromCM(t *testing.T, cm *corev1.ConfigMap, svcName string) *egressser
 	}
 	return nil
 }
+
+func TestValidateEgressServicePreserveClientIP(t *testing.T) {
+	pg := &tsapi.ProxyGroup{Spec: tsapi.ProxyGroupSpec{Type: tsapi.ProxyGroupTypeEgress}}
+	svc := func(mode string, ports ...corev1.ServicePort) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "default",
+				Annotations: map[string]string{
+					AnnotationTailnetTargetFQDN: "foo.bar.ts.net.",
+					AnnotationProxyGroup:        "foo",
+					AnnotationPreserveClientIP:  mode,
+				},
+			},
+			Spec: corev1.ServiceSpec{
+				ExternalName: "placeholder",
+				Type:         corev1.ServiceTypeExternalName,
+				Ports:        ports,
+			},
+		}
+	}
+	tcp := corev1.ServicePort{Name: "http", Protocol: "TCP", Port: 80}
+	udp := corev1.ServicePort{Name: "dns", Protocol: "UDP", Port: 53}
+	tests := []struct {
+		name    string
+		svc     *corev1.Service
+		wantErr bool
+	}{
+		{"proxy_protocol", svc("proxy-protocol", tcp), false},
+		{"http", svc("http", tcp), false},
+		{"unknown_mode", svc("socks", tcp), true},
+		{"udp_port", svc("proxy-protocol", tcp, udp), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := validateEgressService(tt.svc, pg)
+			if gotErr := len(violations) > 0; gotErr != tt.wantErr {
+				t.Errorf("validateEgressService() = %v; want violations: %v", violations, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEgressServiceTailnetFQDNResolution(t *testing.T) {
+	pg := &tsapi.ProxyGroup{Spec: tsapi.ProxyGroupSpec{Type: tsapi.ProxyGroupTypeEgress}}
+	svc := func(target, resolution string, ports ...corev1.ServicePort) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "default",
+				Annotations: map[string]string{
+					target:                                "foo.bar.ts.net.",
+					AnnotationProxyGroup:                  "foo",
+					AnnotationTailnetTargetFQDNResolution: resolution,
+				},
+			},
+			Spec: corev1.ServiceSpec{
+				ExternalName: "placeholder",
+				Type:         corev1.ServiceTypeExternalName,
+				Ports:        ports,
+			},
+		}
+	}
+	tcp := corev1.ServicePort{Name: "http", Protocol: "TCP", Port: 80}
+	udp := corev1.ServicePort{Name: "dns", Protocol: "UDP", Port: 53}
+	tests := []struct {
+		name    string
+		svc     *corev1.Service
+		wantErr bool
+	}{
+		{"per_connection", svc(AnnotationTailnetTargetFQDN, "per-connection", tcp), false},
+		{"unknown_resolution", svc(AnnotationTailnetTargetFQDN, "lazy", tcp), true},
+		{"tailnet_ip", svc(AnnotationTailnetTargetIP, "per-connection", tcp), true},
+		{"udp_port", svc(AnnotationTailnetTargetFQDN, "per-connection", tcp, udp), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := validateEgressService(tt.svc, pg)
+			if gotErr := len(violations) > 0; gotErr != tt.wantErr {
+				t.Errorf("validateEgressService() = %v; want violations: %v", violations, tt.wantErr)
+			}
+		})
+	}
+}
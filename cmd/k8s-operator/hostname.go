@@ -0,0 +1,155 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"tailscale.com/util/dnsname"
+)
+
+// hostnameTemplateVarRe matches the variables in a hostname template.
+var hostnameTemplateVarRe = regexp.MustCompile(`{{\s*([a-z]*)\s*}}`)
+
+// hostnameTemplateVars are the values that the variables of a hostname
+// template expand to for a proxy.
+type hostnameTemplateVars struct {
+	name      string // name of the resource that the proxy is for
+	namespace string // its namespace, if namespaced
+	ordinal   int32  // ordinal of the proxy, 0 for single replica proxies
+}
+
+// renderHostnameTemplate returns the tailnet hostname that tmpl expands to.
+// Supported variables are {{name}} (also available as {{svc}}), {{namespace}}
+// and {{ordinal}}. It returns an error if tmpl references an unknown or unset
+// variable, or does not expand to a valid hostname.
+func renderHostnameTemplate(tmpl string, vars hostnameTemplateVars) (string, error) {
+	var errs []string
+	hostname := hostnameTemplateVarRe.ReplaceAllStringFunc(tmpl, func(v string) string {
+		switch name := hostnameTemplateVarRe.FindStringSubmatch(v)[1]; name {
+		case "name", "svc":
+			return vars.name
+		case "namespace":
+			if vars.namespace == "" {
+				errs = append(errs, fmt.Sprintf("%s is not set for cluster-scoped resources", v))
+			}
+			return vars.namespace
+		case "ordinal":
+			return strconv.Itoa(int(vars.ordinal))
+		default:
+			errs = append(errs, fmt.Sprintf("unknown variable %s", v))
+			return v
+		}
+	})
+	if len(errs) > 0 {
+		return "", fmt.Errorf("invalid hostname template %q: %s", tmpl, strings.Join(errs, ", "))
+	}
+	if strings.Contains(hostname, "{{") || strings.Contains(hostname, "}}") {
+		return "", fmt.Errorf("invalid hostname template %q: unterminated variable", tmpl)
+	}
+	if err := dnsname.ValidLabel(hostname); err != nil {
+		return "", fmt.Errorf("hostname template %q expands to invalid hostname %q: %w", tmpl, hostname, err)
+	}
+	return hostname, nil
+}
+
+// hostnameIndex tracks which tailnet hostnames are in use by the proxies of
+// the resources that the operator manages, so that resources that would
+// otherwise end up with devices with the same hostname get an error, rather
+// than the control plane assigning a numeric suffix to some of the devices.
+// It is shared between all reconcilers. The zero value is not usable, use
+// newHostnameIndex. A nil *hostnameIndex accepts all claims.
+type hostnameIndex struct {
+	mu      sync.Mutex
+	claims  map[string]hostnameClaim // by hostname
+	byOwner map[string][]string      // hostnames by owner
+}
+
+type hostnameClaim struct {
+	owner   string
+	created time.Time
+}
+
+// hostnameOwner returns the key that identifies obj, of the given kind, as the
+// owner of hostname claims.
+func hostnameOwner(kind string, obj metav1.Object) string {
+	return path.Join(kind, obj.GetNamespace(), obj.GetName())
+}
+
+func newHostnameIndex() *hostnameIndex {
+	return &hostnameIndex{
+		claims:  make(map[string]hostnameClaim),
+		byOwner: make(map[string][]string),
+	}
+}
+
+// claim records that owner's proxies use the given hostnames, replacing any
+// hostnames it previously claimed. owner identifies the resource that the
+// proxies are for, e.g. "Service/default/foo", and created is its creation
+// time. If another resource already claimed one of the hostnames, the oldest
+// of the two resources keeps it, and claim returns an error if that is the
+// other resource. This keeps the outcome independent of the order in which
+// resources are reconciled.
+func (x *hostnameIndex) claim(owner string, created time.Time, hostnames ...string) error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, h := range hostnames {
+		c, ok := x.claims[strings.ToLower(h)]
+		if !ok || c.owner == owner {
+			continue
+		}
+		if c.created.Before(created) || (c.created.Equal(created) && c.owner < owner) {
+			return fmt.Errorf("tailnet hostname %q is already in use by %s", h, c.owner)
+		}
+	}
+	x.releaseLocked(owner)
+	for _, h := range hostnames {
+		h = strings.ToLower(h)
+		if c, ok := x.claims[h]; ok && c.owner != owner {
+			// Taking over the hostname from a newer resource, which will
+			// get an error the next time it claims it.
+			prev := x.byOwner[c.owner]
+			for i, ph := range prev {
+				if ph == h {
+					x.byOwner[c.owner] = append(prev[:i:i], prev[i+1:]...)
+					break
+				}
+			}
+		}
+		x.claims[h] = hostnameClaim{owner: owner, created: created}
+		x.byOwner[owner] = append(x.byOwner[owner], h)
+	}
+	return nil
+}
+
+// release removes all of owner's claims.
+func (x *hostnameIndex) release(owner string) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.releaseLocked(owner)
+}
+
+func (x *hostnameIndex) releaseLocked(owner string) {
+	for _, h := range x.byOwner[owner] {
+		if x.claims[h].owner == owner {
+			delete(x.claims, h)
+		}
+	}
+	delete(x.byOwner, owner)
+}
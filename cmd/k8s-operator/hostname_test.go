@@ -0,0 +1,94 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderHostnameTemplate(t *testing.T) {
+	vars := hostnameTemplateVars{name: "web", namespace: "prod", ordinal: 2}
+	tests := []struct {
+		tmpl    string
+		vars    hostnameTemplateVars
+		want    string
+		wantErr string
+	}{
+		{tmpl: "{{svc}}-{{namespace}}-{{ordinal}}", vars: vars, want: "web-prod-2"},
+		{tmpl: "{{ name }}-{{ordinal}}", vars: vars, want: "web-2"},
+		{tmpl: "static", vars: vars, want: "static"},
+		{tmpl: "{{name}}-{{namespace}}", vars: hostnameTemplateVars{name: "pg"}, wantErr: "not set for cluster-scoped resources"},
+		{tmpl: "{{name}}-{{cluster}}", vars: vars, wantErr: "unknown variable {{cluster}}"},
+		{tmpl: "{{name}}-{{ordinal", vars: vars, wantErr: "unterminated variable"},
+		{tmpl: "{{name}}_{{ordinal}}", vars: vars, wantErr: "invalid hostname"},
+		{tmpl: strings.Repeat("a", 62) + "-{{ordinal}}", vars: vars, wantErr: "invalid hostname"},
+	}
+	for _, tt := range tests {
+		got, err := renderHostnameTemplate(tt.tmpl, tt.vars)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("renderHostnameTemplate(%q): got error %v, want error containing %q", tt.tmpl, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("renderHostnameTemplate(%q): unexpected error: %v", tt.tmpl, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("renderHostnameTemplate(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestHostnameIndex(t *testing.T) {
+	x := newHostnameIndex()
+	older := time.Unix(1000, 0)
+	newer := older.Add(time.Hour)
+
+	if err := x.claim("ProxyGroup/a", newer, "a-0", "a-1"); err != nil {
+		t.Fatalf("claiming unused hostnames: %v", err)
+	}
+	// Re-claiming is a no-op, and hostnames are case insensitive.
+	if err := x.claim("ProxyGroup/a", newer, "A-0", "a-1"); err != nil {
+		t.Fatalf("re-claiming own hostnames: %v", err)
+	}
+	// A newer resource can't take a hostname from an older one.
+	if err := x.claim("Service/default/b", newer.Add(time.Minute), "a-1"); err == nil {
+		t.Fatal("newer resource claimed hostname in use")
+	}
+	// An older resource can, and the newer one then loses it.
+	if err := x.claim("Connector/c", older, "a-1"); err != nil {
+		t.Fatalf("older resource claiming hostname: %v", err)
+	}
+	if err := x.claim("ProxyGroup/a", newer, "a-0", "a-1"); err == nil {
+		t.Fatal("resource kept hostname taken over by older resource")
+	}
+	// Scaling down releases the hostnames no longer claimed.
+	if err := x.claim("ProxyGroup/a", newer, "a-0"); err != nil {
+		t.Fatalf("claiming subset of hostnames: %v", err)
+	}
+	if err := x.claim("Service/default/b", newer.Add(time.Minute), "A-0"); err == nil {
+		t.Fatal("newer resource claimed hostname in use")
+	}
+	x.release("ProxyGroup/a")
+	if err := x.claim("Service/default/b", newer.Add(time.Minute), "a-0"); err != nil {
+		t.Fatalf("claiming released hostname: %v", err)
+	}
+	x.release("Connector/c")
+	if err := x.claim("ProxyGroup/a", newer, "a-1"); err != nil {
+		t.Fatalf("claiming released hostname: %v", err)
+	}
+
+	// A nil index accepts all claims.
+	var nilIndex *hostnameIndex
+	if err := nilIndex.claim("ProxyGroup/a", newer, "a-0"); err != nil {
+		t.Fatalf("nil index: %v", err)
+	}
+	nilIndex.release("ProxyGroup/a")
+}
@@ -49,6 +49,10 @@ type IngressReconciler struct {
 	managedIngresses set.Slice[types.UID]
 
 	defaultProxyClass string
+
+	// hostnames tracks the tailnet hostnames of all proxies, to detect
+	// conflicts.
+	hostnames *hostnameIndex
 }
 
 var (
@@ -57,6 +61,10 @@ type IngressReconciler struct {
 	gaugeIngressResources = clientmetric.NewGauge(kubetypes.MetricIngressResourceCount)
 )
 
+// magic443 is a fake hostname that we can use to tell containerboot to swap
+// out with the real hostname once it's known.
+const magic443 = "${TS_CERT_DOMAIN}:443"
+
 func (a *IngressReconciler) Reconcile(ctx context.Context, req reconcile.Request) (_ reconcile.Result, err error) {
 	logger := a.logger.With("ingress-ns", req.Namespace, "ingress-name", req.Name)
 	logger.Debugf("starting reconcile")
@@ -91,6 +99,7 @@ func (a *IngressReconciler) maybeCleanup(ctx context.Context, logger *zap.Sugare
 	ix := slices.Index(ing.Finalizers, FinalizerName)
 	if ix < 0 {
 		logger.Debugf("no finalizer, nothing to do")
+		a.hostnames.release(hostnameOwner("Ingress", ing))
 		a.mu.Lock()
 		defer a.mu.Unlock()
 		a.managedIngresses.Remove(ing.UID)
@@ -115,6 +124,7 @@ func (a *IngressReconciler) maybeCleanup(ctx context.Context, logger *zap.Sugare
 	// cleanup removes the tailscale finalizer, which will make all future
 	// reconciles exit early.
 	logger.Infof("unexposed ingress from tailnet")
+	a.hostnames.release(hostnameOwner("Ingress", ing))
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	a.managedIngresses.Remove(ing.UID)
@@ -163,9 +173,6 @@ func (a *IngressReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 		a.recorder.Event(ing, corev1.EventTypeWarning, "HTTPSNotEnabled", "HTTPS is not enabled on the tailnet; ingress may not work")
 	}
 
-	// magic443 is a fake hostname that we can use to tell containerboot to swap
-	// out with the real hostname once it's known.
-	const magic443 = "${TS_CERT_DOMAIN}:443"
 	sc := &ipn.ServeConfig{
 		TCP: map[uint16]*ipn.TCPPortHandler{
 			443: {
@@ -266,6 +273,18 @@ func (a *IngressReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 	hostname := ing.Namespace + "-" + ing.Name + "-ingress"
 	if tlsHost != "" {
 		hostname, _, _ = strings.Cut(tlsHost, ".")
+	} else if tmpl, ok := ing.Annotations[AnnotationHostnameTemplate]; ok {
+		h, err := renderHostnameTemplate(tmpl, hostnameTemplateVars{name: ing.Name, namespace: ing.Namespace})
+		if err != nil {
+			logger.Warnf("invalid %s annotation: %v", AnnotationHostnameTemplate, err)
+			a.recorder.Eventf(ing, corev1.EventTypeWarning, "InvalidHostnameTemplate", err.Error())
+			return nil
+		}
+		hostname = h
+	}
+	if err := a.hostnames.claim(hostnameOwner("Ingress", ing), ing.CreationTimestamp.Time, hostname); err != nil {
+		a.recorder.Eventf(ing, corev1.EventTypeWarning, reasonHostnameConflict, err.Error())
+		return fmt.Errorf("error provisioning Ingress: %w", err)
 	}
 
 	sts := &tailscaleSTSConfig{
@@ -277,6 +296,7 @@ func (a *IngressReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 		ChildResourceLabels: crl,
 		ProxyClassName:      proxyClass,
 		proxyType:           proxyTypeIngressResource,
+		ResyncToken:         ing.Annotations[AnnotationForceResync],
 	}
 
 	if val := ing.GetAnnotations()[AnnotationExperimentalForwardClusterTrafficViaL7IngresProxy]; val == "true" {
@@ -11,11 +11,11 @@
 
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
 )
@@ -30,6 +30,7 @@
 	labelPromJob                  = "ts_prom_job"
 
 	serviceMonitorCRD = "servicemonitors.monitoring.coreos.com"
+	podMonitorCRD     = "podmonitors.monitoring.coreos.com"
 )
 
 // ServiceMonitor contains a subset of fields of servicemonitors.monitoring.coreos.com Custom Resource Definition.
@@ -74,6 +75,43 @@ type ServiceMonitorEndpoint struct {
 	Port string `json:"port,omitempty"`
 }
 
+// PodMonitor contains a subset of fields of podmonitors.monitoring.coreos.com Custom Resource Definition.
+// https://github.com/prometheus-operator/prometheus-operator/blob/bb4514e0d5d69f20270e29cfd4ad39b87865ccdf/pkg/apis/monitoring/v1/podmonitor_types.go#L38
+type PodMonitor struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              PodMonitorSpec `json:"spec"`
+}
+
+// https://github.com/prometheus-operator/prometheus-operator/blob/bb4514e0d5d69f20270e29cfd4ad39b87865ccdf/pkg/apis/monitoring/v1/podmonitor_types.go#L53
+type PodMonitorSpec struct {
+	// PodMetricsEndpoints defines the endpoints to be scraped on the selected Pods.
+	PodMetricsEndpoints []PodMetricsEndpoint `json:"podMetricsEndpoints"`
+	// NamespaceSelector selects the namespace of Pods that this PodMonitor allows to scrape.
+	NamespaceSelector ServiceMonitorNamespaceSelector `json:"namespaceSelector,omitempty"`
+	// Selector is the label selector for Pods that this PodMonitor allows to scrape.
+	Selector metav1.LabelSelector `json:"selector"`
+}
+
+// PodMetricsEndpoint defines an endpoint of Pods to scrape.
+// https://github.com/prometheus-operator/prometheus-operator/blob/bb4514e0d5d69f20270e29cfd4ad39b87865ccdf/pkg/apis/monitoring/v1/podmonitor_types.go#L176
+type PodMetricsEndpoint struct {
+	// Port is the name of the Pod port that Prometheus will scrape.
+	Port string `json:"port,omitempty"`
+	// Relabelings are applied to the scraped targets before ingestion.
+	// Unlike ServiceMonitors, PodMonitors can't take target labels from a
+	// Service, so we use these to set the proxy's labels.
+	Relabelings []RelabelConfig `json:"relabelings,omitempty"`
+}
+
+// RelabelConfig is a Prometheus relabeling step.
+// https://github.com/prometheus-operator/prometheus-operator/blob/bb4514e0d5d69f20270e29cfd4ad39b87865ccdf/pkg/apis/monitoring/v1/types.go#L519
+type RelabelConfig struct {
+	Action      string `json:"action,omitempty"`
+	TargetLabel string `json:"targetLabel,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
 func reconcileMetricsResources(ctx context.Context, logger *zap.SugaredLogger, opts *metricsOpts, pc *tsapi.ProxyClass, cl client.Client) error {
 	if opts.proxyType == proxyTypeEgress {
 		// Metrics are currently not being enabled for standalone egress proxies.
@@ -103,39 +141,83 @@ func reconcileMetricsResources(ctx context.Context, logger *zap.SugaredLogger, o
 		return fmt.Errorf("error ensuring metrics Service: %w", err)
 	}
 
-	crdExists, err := hasServiceMonitorCRD(ctx, cl)
+	if err := reconcileServiceMonitor(ctx, logger, cl, metricsSvc, pc.Spec.Metrics.ServiceMonitor); err != nil {
+		return err
+	}
+	return reconcilePodMonitor(ctx, logger, cl, metricsSvc, opts, pc.Spec.Metrics.PodMonitor)
+}
+
+// reconcileServiceMonitor ensures that a ServiceMonitor for metricsSvc exists
+// if sm is enabled, and does not exist otherwise. It does nothing if the
+// cluster does not have the ServiceMonitor CRD.
+func reconcileServiceMonitor(ctx context.Context, logger *zap.SugaredLogger, cl client.Client, metricsSvc *corev1.Service, sm *tsapi.ServiceMonitor) error {
+	crdExists, err := hasCRD(ctx, cl, serviceMonitorCRD)
 	if err != nil {
 		return fmt.Errorf("error verifying that %q CRD exists: %w", serviceMonitorCRD, err)
 	}
 	if !crdExists {
 		return nil
 	}
-
-	if pc.Spec.Metrics.ServiceMonitor == nil || !pc.Spec.Metrics.ServiceMonitor.Enable {
-		return maybeCleanupServiceMonitor(ctx, cl, opts.proxyStsName, opts.tsNamespace)
+	if sm == nil || !sm.Enable {
+		return maybeCleanupServiceMonitor(ctx, cl, metricsSvc.Name, metricsSvc.Namespace)
 	}
-
-	logger.Info("ensuring ServiceMonitor for metrics Service %s/%s", metricsSvc.Namespace, metricsSvc.Name)
-	svcMonitor, err := newServiceMonitor(metricsSvc)
+	logger.Infof("ensuring ServiceMonitor for metrics Service %s/%s", metricsSvc.Namespace, metricsSvc.Name)
+	svcMonitor, err := newServiceMonitor(metricsSvc, sm.Labels)
 	if err != nil {
 		return fmt.Errorf("error creating ServiceMonitor: %w", err)
 	}
-	// We don't use createOrUpdate here because that does not work with unstructured types. We also do not update
-	// the ServiceMonitor because it is not expected that any of its fields would change. Currently this is good
-	// enough, but in future we might want to add logic to create-or-update unstructured types.
-	err = cl.Get(ctx, client.ObjectKeyFromObject(metricsSvc), svcMonitor.DeepCopy())
-	if apierrors.IsNotFound(err) {
-		if err := cl.Create(ctx, svcMonitor); err != nil {
-			return fmt.Errorf("error creating ServiceMonitor: %w", err)
-		}
+	if err := createOrUpdateMonitor(ctx, cl, svcMonitor); err != nil {
+		return fmt.Errorf("error ensuring ServiceMonitor: %w", err)
+	}
+	return nil
+}
+
+// reconcilePodMonitor ensures that a PodMonitor for the Pods of the proxy
+// exists if pm is enabled, and does not exist otherwise. It does nothing if
+// the cluster does not have the PodMonitor CRD.
+func reconcilePodMonitor(ctx context.Context, logger *zap.SugaredLogger, cl client.Client, metricsSvc *corev1.Service, opts *metricsOpts, pm *tsapi.PodMonitor) error {
+	crdExists, err := hasCRD(ctx, cl, podMonitorCRD)
+	if err != nil {
+		return fmt.Errorf("error verifying that %q CRD exists: %w", podMonitorCRD, err)
+	}
+	if !crdExists {
 		return nil
 	}
+	if pm == nil || !pm.Enable {
+		return maybeCleanupPodMonitor(ctx, cl, metricsSvc.Name, metricsSvc.Namespace)
+	}
+	logger.Infof("ensuring PodMonitor for proxy %s/%s", opts.tsNamespace, opts.proxyStsName)
+	podMonitor, err := newPodMonitor(metricsSvc, opts.proxyLabels, pm.Labels)
 	if err != nil {
-		return fmt.Errorf("error getting ServiceMonitor: %w", err)
+		return fmt.Errorf("error creating PodMonitor: %w", err)
+	}
+	if err := createOrUpdateMonitor(ctx, cl, podMonitor); err != nil {
+		return fmt.Errorf("error ensuring PodMonitor: %w", err)
 	}
 	return nil
 }
 
+// createOrUpdateMonitor creates the Prometheus operator resource u, or updates
+// the labels and spec of an existing one if they have changed. We don't use
+// createOrUpdate here because that does not work with unstructured types.
+func createOrUpdateMonitor(ctx context.Context, cl client.Client, u *unstructured.Unstructured) error {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(u.GroupVersionKind())
+	err := cl.Get(ctx, client.ObjectKeyFromObject(u), existing)
+	if apierrors.IsNotFound(err) {
+		return cl.Create(ctx, u)
+	}
+	if err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(existing.GetLabels(), u.GetLabels()) && equality.Semantic.DeepEqual(existing.Object["spec"], u.Object["spec"]) {
+		return nil
+	}
+	existing.SetLabels(u.GetLabels())
+	existing.Object["spec"] = u.Object["spec"]
+	return cl.Update(ctx, existing)
+}
+
 // maybeCleanupMetricsResources ensures that any metrics resources created for a proxy are deleted. Only metrics Service
 // gets deleted explicitly because the ServiceMonitor has Service's owner reference, so gets garbage collected
 // automatically.
@@ -144,20 +226,33 @@ func maybeCleanupMetricsResources(ctx context.Context, opts *metricsOpts, cl cli
 	return cl.DeleteAllOf(ctx, &corev1.Service{}, client.InNamespace(opts.tsNamespace), client.MatchingLabels(sel))
 }
 
-// maybeCleanupServiceMonitor cleans up any ServiceMonitor created for the named proxy StatefulSet.
-func maybeCleanupServiceMonitor(ctx context.Context, cl client.Client, stsName, ns string) error {
-	smName := metricsResourceName(stsName)
-	sm := serviceMonitorTemplate(smName, ns)
-	u, err := serviceMonitorToUnstructured(sm)
+// maybeCleanupServiceMonitor cleans up any ServiceMonitor with the given name.
+func maybeCleanupServiceMonitor(ctx context.Context, cl client.Client, name, ns string) error {
+	u, err := serviceMonitorToUnstructured(serviceMonitorTemplate(name, ns))
 	if err != nil {
 		return fmt.Errorf("error building ServiceMonitor: %w", err)
 	}
-	err = cl.Get(ctx, types.NamespacedName{Name: smName, Namespace: ns}, u)
+	return maybeCleanupMonitor(ctx, cl, u)
+}
+
+// maybeCleanupPodMonitor cleans up any PodMonitor with the given name.
+func maybeCleanupPodMonitor(ctx context.Context, cl client.Client, name, ns string) error {
+	u, err := podMonitorToUnstructured(podMonitorTemplate(name, ns))
+	if err != nil {
+		return fmt.Errorf("error building PodMonitor: %w", err)
+	}
+	return maybeCleanupMonitor(ctx, cl, u)
+}
+
+// maybeCleanupMonitor deletes the Prometheus operator resource with the kind
+// and name of u, if it exists.
+func maybeCleanupMonitor(ctx context.Context, cl client.Client, u *unstructured.Unstructured) error {
+	err := cl.Get(ctx, client.ObjectKeyFromObject(u), u)
 	if apierrors.IsNotFound(err) {
 		return nil // nothing to do
 	}
 	if err != nil {
-		return fmt.Errorf("error verifying if ServiceMonitor %s/%s exists: %w", ns, stsName, err)
+		return fmt.Errorf("error verifying if %s %s/%s exists: %w", u.GetKind(), u.GetNamespace(), u.GetName(), err)
 	}
 	return cl.Delete(ctx, u)
 }
@@ -165,9 +260,10 @@ func maybeCleanupServiceMonitor(ctx context.Context, cl client.Client, stsName,
 // newServiceMonitor takes a metrics Service created for a proxy and constructs and returns a ServiceMonitor for that
 // proxy that can be applied to the kube API server.
 // The ServiceMonitor is returned as Unstructured type - this allows us to avoid importing prometheus-operator API server client/schema.
-func newServiceMonitor(metricsSvc *corev1.Service) (*unstructured.Unstructured, error) {
+// Any user-provided labels are added to the ServiceMonitor's own labels.
+func newServiceMonitor(metricsSvc *corev1.Service, userLabels map[string]string) (*unstructured.Unstructured, error) {
 	sm := serviceMonitorTemplate(metricsSvc.Name, metricsSvc.Namespace)
-	sm.ObjectMeta.Labels = metricsSvc.Labels
+	sm.ObjectMeta.Labels = monitorLabels(metricsSvc.Labels, userLabels)
 	sm.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(metricsSvc, corev1.SchemeGroupVersion.WithKind("Service"))}
 	sm.Spec = ServiceMonitorSpec{
 		Selector: metav1.LabelSelector{MatchLabels: metricsSvc.Labels},
@@ -187,6 +283,50 @@ func newServiceMonitor(metricsSvc *corev1.Service) (*unstructured.Unstructured,
 	return serviceMonitorToUnstructured(sm)
 }
 
+// newPodMonitor constructs a PodMonitor for the proxy Pods with podLabels, owned
+// by the proxy's metrics Service, that applies the same Prometheus labels to the
+// ingested metrics as the ServiceMonitor. Any user-provided labels are added to
+// the PodMonitor's own labels.
+func newPodMonitor(metricsSvc *corev1.Service, podLabels, userLabels map[string]string) (*unstructured.Unstructured, error) {
+	pm := podMonitorTemplate(metricsSvc.Name, metricsSvc.Namespace)
+	pm.ObjectMeta.Labels = monitorLabels(metricsSvc.Labels, userLabels)
+	pm.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(metricsSvc, corev1.SchemeGroupVersion.WithKind("Service"))}
+	var relabelings []RelabelConfig
+	for _, l := range []string{labelPromProxyParentName, labelPromProxyParentNamespace, labelPromProxyType} {
+		if v, ok := metricsSvc.Labels[l]; ok {
+			relabelings = append(relabelings, RelabelConfig{Action: "replace", TargetLabel: l, Replacement: v})
+		}
+	}
+	relabelings = append(relabelings, RelabelConfig{Action: "replace", TargetLabel: "job", Replacement: metricsSvc.Labels[labelPromJob]})
+	pm.Spec = PodMonitorSpec{
+		Selector: metav1.LabelSelector{MatchLabels: podLabels},
+		PodMetricsEndpoints: []PodMetricsEndpoint{{
+			Port:        "metrics",
+			Relabelings: relabelings,
+		}},
+		NamespaceSelector: ServiceMonitorNamespaceSelector{
+			MatchNames: []string{metricsSvc.Namespace},
+		},
+	}
+	return podMonitorToUnstructured(pm)
+}
+
+// monitorLabels returns the labels for a ServiceMonitor or PodMonitor: the
+// labels of the metrics Service merged over any user-provided labels.
+func monitorLabels(metricsSvcLabels, userLabels map[string]string) map[string]string {
+	if len(userLabels) == 0 {
+		return metricsSvcLabels
+	}
+	lbls := make(map[string]string, len(metricsSvcLabels)+len(userLabels))
+	for k, v := range userLabels {
+		lbls[k] = v
+	}
+	for k, v := range metricsSvcLabels {
+		lbls[k] = v
+	}
+	return lbls
+}
+
 // serviceMonitorToUnstructured takes a ServiceMonitor and converts it to Unstructured type that can be used by the c/r
 // client in Kubernetes API server calls.
 func serviceMonitorToUnstructured(sm *ServiceMonitor) (*unstructured.Unstructured, error) {
@@ -200,7 +340,20 @@ func serviceMonitorToUnstructured(sm *ServiceMonitor) (*unstructured.Unstructure
 	return u, nil
 }
 
-// metricsResourceName returns name for metrics Service and ServiceMonitor for a proxy StatefulSet.
+// podMonitorToUnstructured takes a PodMonitor and converts it to Unstructured type that can be used by the c/r
+// client in Kubernetes API server calls.
+func podMonitorToUnstructured(pm *PodMonitor) (*unstructured.Unstructured, error) {
+	contents, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pm)
+	if err != nil {
+		return nil, fmt.Errorf("error converting PodMonitor to Unstructured: %w", err)
+	}
+	u := &unstructured.Unstructured{}
+	u.SetUnstructuredContent(contents)
+	u.SetGroupVersionKind(pm.GroupVersionKind())
+	return u, nil
+}
+
+// metricsResourceName returns name for metrics Service, ServiceMonitor and PodMonitor for a proxy StatefulSet.
 func metricsResourceName(stsName string) string {
 	// Maximum length of StatefulSet name if 52 chars, so this is fine.
 	return fmt.Sprintf("%s-metrics", stsName)
@@ -260,6 +413,21 @@ func serviceMonitorTemplate(name, ns string) *ServiceMonitor {
 	}
 }
 
+// podMonitorTemplate returns a base PodMonitor type that, when converted to Unstructured, is a valid type that
+// can be used in kube API server calls via the c/r client.
+func podMonitorTemplate(name, ns string) *PodMonitor {
+	return &PodMonitor{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodMonitor",
+			APIVersion: "monitoring.coreos.com/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+		},
+	}
+}
+
 type metricsOpts struct {
 	proxyStsName string            // name of StatefulSet for proxy
 	tsNamespace  string            // namespace in which Tailscale is installed
@@ -11,6 +11,7 @@
 	"context"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -33,16 +34,22 @@
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	kzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"tailscale.com/client/tailscale"
 	"tailscale.com/hostinfo"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/store/kubestore"
+	"tailscale.com/k8s-operator/apiproxy"
+	tsapiv1 "tailscale.com/k8s-operator/apis/v1"
 	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
 	"tailscale.com/kube/kubetypes"
 	"tailscale.com/tsnet"
@@ -74,6 +81,8 @@ func main() {
 		tsFirewallMode        = defaultEnv("PROXY_FIREWALL_MODE", "")
 		defaultProxyClass     = defaultEnv("PROXY_DEFAULT_CLASS", "")
 		isDefaultLoadBalancer = defaultBool("OPERATOR_DEFAULT_LOAD_BALANCER", false)
+		watchNamespaces       = defaultEnv("OPERATOR_WATCH_NAMESPACES", "")
+		driftCheckInterval    = defaultDuration("OPERATOR_DRIFT_CHECK_INTERVAL", defaultDriftCheckInterval)
 	)
 
 	var opts []kzap.Opts
@@ -92,7 +101,7 @@ func main() {
 	// additionally act as api-server proxy
 	// https://tailscale.com/kb/1236/kubernetes-operator/?q=kubernetes#accessing-the-kubernetes-control-plane-using-an-api-server-proxy.
 	mode := parseAPIProxyMode()
-	if mode == apiserverProxyModeDisabled {
+	if mode == apiproxy.ModeDisabled {
 		hostinfo.SetApp(kubetypes.AppOperator)
 	} else {
 		hostinfo.SetApp(kubetypes.AppAPIServerProxy)
@@ -101,7 +110,7 @@ func main() {
 	s, tsClient := initTSNet(zlog)
 	defer s.Close()
 	restConfig := config.GetConfigOrDie()
-	maybeLaunchAPIServerProxy(zlog, restConfig, s, mode)
+	apiproxy.MaybeLaunchAPIServerProxy(zlog, restConfig, s, mode)
 	rOpts := reconcilerOpts{
 		log:                           zlog,
 		tsServer:                      s,
@@ -114,6 +123,8 @@ func main() {
 		proxyTags:                     tags,
 		proxyFirewallMode:             tsFirewallMode,
 		defaultProxyClass:             defaultProxyClass,
+		watchNamespaces:               parseWatchNamespaces(watchNamespaces),
+		driftCheckInterval:            driftCheckInterval,
 	}
 	runReconcilers(rOpts)
 }
@@ -242,6 +253,15 @@ func runReconcilers(opts reconcilerOpts) {
 	nsFilter := cache.ByObject{
 		Field: client.InNamespace(opts.tailscaleNamespace).AsSelector(),
 	}
+	// In namespace-scoped mode, the operator only has permissions to watch
+	// resources in the namespaces it has been configured to watch and its
+	// own namespace, so the cache must not start any cluster-wide watches.
+	var defaultNamespaces map[string]cache.Config
+	if len(opts.watchNamespaces) > 0 {
+		startlog.Infof("watching namespaces %v", opts.watchNamespaces)
+		defaultNamespaces = cacheNamespaces(opts.watchNamespaces, opts.tailscaleNamespace)
+		nsFilter.Namespaces = map[string]cache.Config{opts.tailscaleNamespace: {}}
+	}
 	// We watch the ServiceMonitor CRD to ensure that reconcilers are re-triggered if user's workflows result in the
 	// ServiceMonitor CRD applied after some of our resources that define ServiceMonitor creation. This selector
 	// ensures that we only watch the ServiceMonitor CRD and that we don't cache full contents of it.
@@ -254,6 +274,7 @@ func runReconcilers(opts reconcilerOpts) {
 		// reconcilers on. c/r by default starts a watch on any
 		// resources that we GET via the controller manager's client.
 		Cache: cache.Options{
+			DefaultNamespaces: defaultNamespaces,
 			ByObject: map[client.Object]cache.ByObject{
 				&corev1.Secret{}:                            nsFilter,
 				&corev1.ServiceAccount{}:                    nsFilter,
@@ -267,7 +288,21 @@ func runReconcilers(opts reconcilerOpts) {
 				&apiextensionsv1.CustomResourceDefinition{}: serviceMonitorSelector,
 			},
 		},
+		// CRDs are read directly from the API server: the cache only
+		// watches the ServiceMonitor CRD, but reconcilers also need to
+		// check whether the PodMonitor CRD exists.
+		Client: client.Options{
+			Cache: &client.CacheOptions{
+				DisableFor: []client.Object{&apiextensionsv1.CustomResourceDefinition{}},
+			},
+		},
 		Scheme: tsapi.GlobalScheme,
+		// The webhook server serves the conversion webhook for CRDs
+		// with more than one version.
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    webhookPort,
+			CertDir: webhookCertDir,
+		}),
 	}
 	mgr, err := manager.New(opts.restConfig, mgrOpts)
 	if err != nil {
@@ -291,6 +326,12 @@ func runReconcilers(opts reconcilerOpts) {
 		proxyPriorityClassName: opts.proxyPriorityClassName,
 		tsFirewallMode:         opts.proxyFirewallMode,
 	}
+	// dd checks the proxies of Services, Ingresses and Connectors for drift,
+	// sending those that need repairing to their reconcilers.
+	dd := newDriftDetector(mgr.GetClient(), opts.tsClient, opts.tailscaleNamespace, eventRecorder, opts.log.Named("drift-detector"), opts.driftCheckInterval)
+	// hostnames is shared by all reconcilers that create tailnet devices
+	// with user-visible hostnames, to detect hostname conflicts.
+	hostnames := newHostnameIndex()
 	err = builder.
 		ControllerManagedBy(mgr).
 		Named("service-reconciler").
@@ -298,6 +339,7 @@ func runReconcilers(opts reconcilerOpts) {
 		Watches(&appsv1.StatefulSet{}, svcChildFilter).
 		Watches(&corev1.Secret{}, svcChildFilter).
 		Watches(&tsapi.ProxyClass{}, proxyClassFilterForSvc).
+		WatchesRawSource(source.Channel(dd.resync["svc"], &handler.EnqueueRequestForObject{})).
 		Complete(&ServiceReconciler{
 			ssr:                   ssr,
 			Client:                mgr.GetClient(),
@@ -307,6 +349,7 @@ func runReconcilers(opts reconcilerOpts) {
 			tsNamespace:           opts.tailscaleNamespace,
 			clock:                 tstime.DefaultClock{},
 			defaultProxyClass:     opts.defaultProxyClass,
+			hostnames:             hostnames,
 		})
 	if err != nil {
 		startlog.Fatalf("could not create service reconciler: %v", err)
@@ -324,12 +367,14 @@ func runReconcilers(opts reconcilerOpts) {
 		Watches(&corev1.Secret{}, ingressChildFilter).
 		Watches(&corev1.Service{}, svcHandlerForIngress).
 		Watches(&tsapi.ProxyClass{}, proxyClassFilterForIngress).
+		WatchesRawSource(source.Channel(dd.resync["ingress"], &handler.EnqueueRequestForObject{})).
 		Complete(&IngressReconciler{
 			ssr:               ssr,
 			recorder:          eventRecorder,
 			Client:            mgr.GetClient(),
 			logger:            opts.log.Named("ingress-reconciler"),
 			defaultProxyClass: opts.defaultProxyClass,
+			hostnames:         hostnames,
 		})
 	if err != nil {
 		startlog.Fatalf("could not create ingress reconciler: %v", err)
@@ -339,17 +384,23 @@ func runReconcilers(opts reconcilerOpts) {
 	// If a ProxyClassChanges, enqueue all Connectors that have
 	// .spec.proxyClass set to the name of this ProxyClass.
 	proxyClassFilterForConnector := handler.EnqueueRequestsFromMapFunc(proxyClassHandlerForConnector(mgr.GetClient(), startlog))
+	// If a Node's Pod CIDRs change, enqueue all Connectors that advertise
+	// the cluster's Pod CIDRs.
+	nodeFilterForConnector := handler.EnqueueRequestsFromMapFunc(nodeHandlerForConnector(mgr.GetClient(), startlog))
 	err = builder.ControllerManagedBy(mgr).
 		For(&tsapi.Connector{}).
 		Watches(&appsv1.StatefulSet{}, connectorFilter).
 		Watches(&corev1.Secret{}, connectorFilter).
 		Watches(&tsapi.ProxyClass{}, proxyClassFilterForConnector).
+		Watches(&corev1.Node{}, nodeFilterForConnector, builder.WithPredicates(podCIDRsChanged)).
+		WatchesRawSource(source.Channel(dd.resync["connector"], &handler.EnqueueRequestForObject{})).
 		Complete(&ConnectorReconciler{
-			ssr:      ssr,
-			recorder: eventRecorder,
-			Client:   mgr.GetClient(),
-			logger:   opts.log.Named("connector-reconciler"),
-			clock:    tstime.DefaultClock{},
+			ssr:       ssr,
+			recorder:  eventRecorder,
+			Client:    mgr.GetClient(),
+			logger:    opts.log.Named("connector-reconciler"),
+			clock:     tstime.DefaultClock{},
+			hostnames: hostnames,
 		})
 	if err != nil {
 		startlog.Fatalf("could not create connector reconciler: %v", err)
@@ -415,6 +466,7 @@ func runReconcilers(opts reconcilerOpts) {
 	epsFilter := handler.EnqueueRequestsFromMapFunc(egressEpsHandler)
 	podsFilter := handler.EnqueueRequestsFromMapFunc(egressEpsFromPGPods(mgr.GetClient(), opts.tailscaleNamespace))
 	secretsFilter := handler.EnqueueRequestsFromMapFunc(egressEpsFromPGStateSecrets(mgr.GetClient(), opts.tailscaleNamespace))
+	proxyGroupsFilter := handler.EnqueueRequestsFromMapFunc(egressEpsFromProxyGroup(mgr.GetClient(), opts.tailscaleNamespace))
 	epsFromExtNSvcFilter := handler.EnqueueRequestsFromMapFunc(epsFromExternalNameService(mgr.GetClient(), opts.log, opts.tailscaleNamespace))
 
 	err = builder.
@@ -423,6 +475,7 @@ func runReconcilers(opts reconcilerOpts) {
 		Watches(&discoveryv1.EndpointSlice{}, epsFilter).
 		Watches(&corev1.Pod{}, podsFilter).
 		Watches(&corev1.Secret{}, secretsFilter).
+		Watches(&tsapi.ProxyGroup{}, proxyGroupsFilter).
 		Watches(&corev1.Service{}, epsFromExtNSvcFilter).
 		Complete(&egressEpsReconciler{
 			Client:      mgr.GetClient(),
@@ -488,12 +541,13 @@ func runReconcilers(opts reconcilerOpts) {
 		Watches(&rbacv1.Role{}, recorderFilter).
 		Watches(&rbacv1.RoleBinding{}, recorderFilter).
 		Complete(&RecorderReconciler{
-			recorder:    eventRecorder,
-			tsNamespace: opts.tailscaleNamespace,
-			Client:      mgr.GetClient(),
-			l:           opts.log.Named("recorder-reconciler"),
-			clock:       tstime.DefaultClock{},
-			tsClient:    opts.tsClient,
+			recorder:          eventRecorder,
+			tsNamespace:       opts.tailscaleNamespace,
+			Client:            mgr.GetClient(),
+			l:                 opts.log.Named("recorder-reconciler"),
+			clock:             tstime.DefaultClock{},
+			tsClient:          opts.tsClient,
+			newRecordingStore: newS3RecordingStore,
 		})
 	if err != nil {
 		startlog.Fatalf("could not create Recorder reconciler: %v", err)
@@ -522,11 +576,38 @@ func runReconcilers(opts reconcilerOpts) {
 			defaultTags:       strings.Split(opts.proxyTags, ","),
 			tsFirewallMode:    opts.proxyFirewallMode,
 			defaultProxyClass: opts.defaultProxyClass,
+			hostnames:         hostnames,
 		})
 	if err != nil {
 		startlog.Fatalf("could not create ProxyGroup reconciler: %v", err)
 	}
 
+	// The conversion webhook must have a serving certificate before the
+	// manager starts the webhook server.
+	directClient, err := client.New(opts.restConfig, client.Options{Scheme: tsapi.GlobalScheme})
+	if err != nil {
+		startlog.Fatalf("could not create client: %v", err)
+	}
+	cw := &conversionWebhook{
+		cl:      directClient,
+		ns:      opts.tailscaleNamespace,
+		certDir: webhookCertDir,
+		clock:   tstime.DefaultClock{},
+		logger:  opts.log.Named("conversion-webhook"),
+	}
+	if err := cw.sync(context.Background()); err != nil {
+		startlog.Fatalf("could not set up conversion webhook: %v", err)
+	}
+	if err := builder.WebhookManagedBy(mgr).For(&tsapiv1.Connector{}).Complete(); err != nil {
+		startlog.Fatalf("could not create conversion webhook: %v", err)
+	}
+	if err := mgr.Add(cw); err != nil {
+		startlog.Fatalf("could not add conversion webhook: %v", err)
+	}
+	if err := mgr.Add(dd); err != nil {
+		startlog.Fatalf("could not add drift detector: %v", err)
+	}
+
 	startlog.Infof("Startup complete, operator running, version: %s", version.Long())
 	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
 		startlog.Fatalf("could not start manager: %v", err)
@@ -571,6 +652,39 @@ type reconcilerOpts struct {
 	// class for proxies that do not have a ProxyClass set.
 	// this is defined by an operator env variable.
 	defaultProxyClass string
+	// watchNamespaces, if set, are the only namespaces, in addition to
+	// tailscaleNamespace, in which the operator watches Services, Ingresses
+	// and other namespaced resources. This allows running the operator
+	// without cluster-wide permissions for those resources.
+	watchNamespaces []string
+	// driftCheckInterval is how often the proxies of Services, Ingresses
+	// and Connectors are checked for drift from their desired state. Zero
+	// or less disables drift detection.
+	driftCheckInterval time.Duration
+}
+
+// parseWatchNamespaces parses the comma-separated list of namespaces set via
+// OPERATOR_WATCH_NAMESPACES.
+func parseWatchNamespaces(s string) []string {
+	var nss []string
+	for _, ns := range strings.Split(s, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" && !slices.Contains(nss, ns) {
+			nss = append(nss, ns)
+		}
+	}
+	return nss
+}
+
+// cacheNamespaces returns the namespaces that the cache of an operator
+// configured to watch the given namespaces should be restricted to. The
+// operator's own namespace, which contains the proxies' resources, is always
+// included.
+func cacheNamespaces(watchNamespaces []string, tsNamespace string) map[string]cache.Config {
+	nss := map[string]cache.Config{tsNamespace: {}}
+	for _, ns := range watchNamespaces {
+		nss[ns] = cache.Config{}
+	}
+	return nss
 }
 
 // enqueueAllIngressEgressProxySvcsinNS returns a reconcile request for each
@@ -759,6 +873,44 @@ func proxyClassHandlerForConnector(cl client.Client, logger *zap.SugaredLogger)
 	}
 }
 
+// nodeHandlerForConnector returns a handler that, for a given Node, returns a
+// list of reconcile requests for all Connectors that advertise the cluster's
+// Pod CIDRs.
+func nodeHandlerForConnector(cl client.Client, logger *zap.SugaredLogger) handler.MapFunc {
+	return func(ctx context.Context, _ client.Object) []reconcile.Request {
+		connList := new(tsapi.ConnectorList)
+		if err := cl.List(ctx, connList); err != nil {
+			logger.Debugf("error listing Connectors for Node: %v", err)
+			return nil
+		}
+		reqs := make([]reconcile.Request, 0)
+		for _, conn := range connList.Items {
+			if sr := conn.Spec.SubnetRouter; sr != nil && sr.AdvertiseClusterCIDRs != nil && sr.AdvertiseClusterCIDRs.Pods {
+				reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&conn)})
+			}
+		}
+		return reqs
+	}
+}
+
+// podCIDRsChanged filters Node events down to those that can change the
+// cluster's Pod CIDRs, so that Connectors are not reconciled on every Node
+// status update.
+var podCIDRsChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNode, ok := e.ObjectOld.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		newNode, ok := e.ObjectNew.(*corev1.Node)
+		if !ok {
+			return false
+		}
+		return !slices.Equal(nodePodCIDRs(oldNode), nodePodCIDRs(newNode))
+	},
+	GenericFunc: func(event.GenericEvent) bool { return false },
+}
+
 // proxyClassHandlerForConnector returns a handler that, for a given ProxyClass,
 // returns a list of reconcile requests for all Connectors that have
 // .spec.proxyClass set.
@@ -927,6 +1079,17 @@ func egressEpsFromPGStateSecrets(cl client.Client, ns string) handler.MapFunc {
 	}
 }
 
+// egressEpsFromProxyGroup returns a ProxyGroup event handler that returns reconciler requests for all egress
+// EndpointSlices for the ProxyGroup, so that they follow the traffic shifting steps of BlueGreen upgrades.
+func egressEpsFromProxyGroup(cl client.Client, ns string) handler.MapFunc {
+	return func(_ context.Context, o client.Object) []reconcile.Request {
+		if pg, ok := o.(*tsapi.ProxyGroup); !ok || pg.Spec.Type != tsapi.ProxyGroupTypeEgress {
+			return nil
+		}
+		return reconcileRequestsForPG(o.GetName(), cl, ns)
+	}
+}
+
 // egressSvcFromEps is an event handler for EndpointSlices. If an EndpointSlice is for an egress ExternalName Service
 // meant to be exposed on a ProxyGroup, returns a reconcile request for the Service.
 func egressSvcFromEps(_ context.Context, o client.Object) []reconcile.Request {
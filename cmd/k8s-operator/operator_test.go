@@ -19,8 +19,12 @@
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"tailscale.com/ipn"
+	tsoperator "tailscale.com/k8s-operator"
 	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
 	"tailscale.com/kube/kubetypes"
 	"tailscale.com/net/dns/resolvconffile"
@@ -680,6 +684,152 @@ func TestAnnotations(t *testing.T) {
 	expectEqual(t, fc, want, nil)
 }
 
+func TestFunnelAnnotation(t *testing.T) {
+	fc := fake.NewFakeClient()
+	ft := &fakeTSClient{}
+	zl, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	sr := &ServiceReconciler{
+		Client: fc,
+		ssr: &tailscaleSTSReconciler{
+			Client:            fc,
+			tsClient:          ft,
+			defaultTags:       []string{"tag:k8s"},
+			operatorNamespace: "operator-ns",
+			proxyImage:        "tailscale/tailscale",
+		},
+		logger: zl.Sugar(),
+		clock:  clock,
+	}
+
+	// 1. A ClusterIP Service with the funnel annotation gets a proxy that
+	// serves its HTTP port over HTTPS via Funnel.
+	mustCreate(t, fc, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+			UID:       types.UID("1234-UID"),
+			Annotations: map[string]string{
+				"tailscale.com/funnel": "true",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.20.30.40",
+			Type:      corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{Name: "metrics", Port: 9001},
+				{Name: "http", Port: 8080},
+			},
+		},
+	})
+	expectReconciled(t, sr, "default", "test")
+
+	fullName, shortName := findGenName(t, fc, "default", "test", "svc")
+	opts := configOpts{
+		stsName:    shortName,
+		secretName: fullName,
+		namespace:  "default",
+		parentType: "svc",
+		hostname:   "default-test",
+		app:        kubetypes.AppIngressResource,
+		serveConfig: &ipn.ServeConfig{
+			TCP:         map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web:         map[ipn.HostPort]*ipn.WebServerConfig{"${TS_CERT_DOMAIN}:443": {Handlers: map[string]*ipn.HTTPHandler{"/": {Proxy: "http://10.20.30.40:8080"}}}},
+			AllowFunnel: map[ipn.HostPort]bool{"${TS_CERT_DOMAIN}:443": true},
+		},
+	}
+	expectEqual(t, fc, expectedSecret(t, fc, opts), nil)
+	expectEqual(t, fc, expectedSTSUserspace(t, fc, opts), removeHashAnnotation)
+
+	want := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test",
+			Namespace:  "default",
+			Finalizers: []string{"tailscale.com/finalizer"},
+			UID:        types.UID("1234-UID"),
+			Annotations: map[string]string{
+				"tailscale.com/funnel": "true",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.20.30.40",
+			Type:      corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{Name: "metrics", Port: 9001},
+				{Name: "http", Port: 8080},
+			},
+		},
+		Status: corev1.ServiceStatus{
+			Conditions: []metav1.Condition{{
+				Type:               string(tsapi.ProxyReady),
+				Status:             metav1.ConditionFalse,
+				LastTransitionTime: conditionTime(clock),
+				Reason:             reasonProxyPending,
+				Message:            "no Funnel DNS name known yet, waiting for proxy Pod to start serving",
+			}},
+		},
+	}
+	expectEqual(t, fc, want, nil)
+
+	// 2. Once the proxy is serving, the operator waits for its TLS cert.
+	mustUpdate(t, fc, "operator-ns", fullName, func(s *corev1.Secret) {
+		mak.Set(&s.Data, "device_id", []byte("ts-id-1234"))
+		mak.Set(&s.Data, "device_fqdn", []byte("default-test.tailnetxyz.ts.net."))
+	})
+	expectReconciled(t, sr, "default", "test")
+	want.Status.Conditions[0].Message = "waiting for proxy to issue a TLS cert for default-test.tailnetxyz.ts.net"
+	expectEqual(t, fc, want, nil)
+
+	// 3. Once it has a cert, the public URL is written to the Service.
+	mustUpdate(t, fc, "operator-ns", fullName, func(s *corev1.Secret) {
+		mak.Set(&s.Data, "https_cert_domain", []byte("default-test.tailnetxyz.ts.net"))
+	})
+	expectReconciled(t, sr, "default", "test")
+	want.Annotations["tailscale.com/funnel-url"] = "https://default-test.tailnetxyz.ts.net"
+	want.Status.Conditions = proxyCreatedCondition(clock)
+	expectEqual(t, fc, want, nil)
+
+	// 4. Removing the funnel annotation unexposes the Service and removes
+	// the URL.
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		delete(s.Annotations, "tailscale.com/funnel")
+	})
+	expectReconciled(t, sr, "default", "test")
+	expectReconciled(t, sr, "default", "test")
+	expectMissing[appsv1.StatefulSet](t, fc, "operator-ns", shortName)
+	expectMissing[corev1.Secret](t, fc, "operator-ns", fullName)
+	want.Finalizers = nil
+	want.Annotations = nil
+	want.Status = corev1.ServiceStatus{}
+	expectEqual(t, fc, want, nil)
+}
+
+func TestFunnelTargetPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		ports    []corev1.ServicePort
+		wantPort int32
+		wantOK   bool
+	}{
+		{"none", nil, 0, false},
+		{"udp-only", []corev1.ServicePort{{Port: 53, Protocol: corev1.ProtocolUDP}}, 0, false},
+		{"first", []corev1.ServicePort{{Port: 53, Protocol: corev1.ProtocolUDP}, {Port: 80}, {Port: 81}}, 80, true},
+		{"named-http", []corev1.ServicePort{{Port: 9001}, {Name: "http", Port: 8080}}, 8080, true},
+		{"named-https", []corev1.ServicePort{{Name: "https", Port: 8443}, {Name: "http", Port: 8080}}, 8443, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := funnelTargetPort(&corev1.Service{Spec: corev1.ServiceSpec{Ports: tt.ports}})
+			if ok != tt.wantOK || p.Port != tt.wantPort {
+				t.Errorf("funnelTargetPort = %d, %v; want %d, %v", p.Port, ok, tt.wantPort, tt.wantOK)
+			}
+		})
+	}
+}
+
 func TestAnnotationIntoLB(t *testing.T) {
 	fc := fake.NewFakeClient()
 	ft := &fakeTSClient{}
@@ -1060,6 +1210,99 @@ func TestCustomHostname(t *testing.T) {
 	expectEqual(t, fc, want, nil)
 }
 
+func TestHostnameTemplate(t *testing.T) {
+	fc := fake.NewFakeClient()
+	ft := &fakeTSClient{}
+	zl, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	sr := &ServiceReconciler{
+		Client: fc,
+		ssr: &tailscaleSTSReconciler{
+			Client:            fc,
+			tsClient:          ft,
+			defaultTags:       []string{"tag:k8s"},
+			operatorNamespace: "operator-ns",
+			proxyImage:        "tailscale/tailscale",
+		},
+		logger:    zl.Sugar(),
+		clock:     clock,
+		recorder:  record.NewFakeRecorder(100),
+		hostnames: newHostnameIndex(),
+	}
+	created := metav1.NewTime(time.Unix(1000, 0))
+	newSvc := func(ns string, created metav1.Time) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test",
+				Namespace:         ns,
+				UID:               types.UID(ns + "-UID"),
+				CreationTimestamp: created,
+				Annotations: map[string]string{
+					"tailscale.com/expose":            "true",
+					"tailscale.com/hostname-template": "{{svc}}-{{ordinal}}",
+				},
+			},
+			Spec: corev1.ServiceSpec{
+				ClusterIP: "10.20.30.40",
+				Type:      corev1.ServiceTypeClusterIP,
+			},
+		}
+	}
+	mustCreate(t, fc, newSvc("default", created))
+	expectReconciled(t, sr, "default", "test")
+
+	fullName, shortName := findGenName(t, fc, "default", "test", "svc")
+	o := configOpts{
+		stsName:         shortName,
+		secretName:      fullName,
+		namespace:       "default",
+		parentType:      "svc",
+		hostname:        "test-0",
+		clusterTargetIP: "10.20.30.40",
+		app:             kubetypes.AppIngressProxy,
+	}
+	expectEqual(t, fc, expectedSecret(t, fc, o), nil)
+
+	// A newer Service in another namespace whose template expands to the
+	// same hostname does not get a proxy.
+	mustCreate(t, fc, newSvc("other", metav1.NewTime(created.Add(time.Hour))))
+	if _, err := sr.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "other", Name: "test"}}); err == nil {
+		t.Fatal("expected hostname conflict error")
+	}
+	svc := &corev1.Service{}
+	if err := fc.Get(context.Background(), types.NamespacedName{Namespace: "other", Name: "test"}, svc); err != nil {
+		t.Fatal(err)
+	}
+	if cond := tsoperator.GetServiceCondition(svc, tsapi.ProxyReady); cond == nil || cond.Reason != reasonHostnameConflict {
+		t.Fatalf("unexpected ProxyReady condition %+v, want reason %s", cond, reasonHostnameConflict)
+	}
+	stsList := &appsv1.StatefulSetList{}
+	if err := fc.List(context.Background(), stsList, client.InNamespace("operator-ns")); err != nil {
+		t.Fatal(err)
+	}
+	if len(stsList.Items) != 1 {
+		t.Fatalf("got %d proxy StatefulSets, want 1", len(stsList.Items))
+	}
+
+	// Once the first Service is no longer exposed, the second one gets
+	// the hostname.
+	mustUpdate(t, fc, "default", "test", func(s *corev1.Service) {
+		delete(s.Annotations, "tailscale.com/expose")
+	})
+	expectReconciled(t, sr, "default", "test")
+	expectReconciled(t, sr, "default", "test")
+	expectReconciled(t, sr, "other", "test")
+	if err := fc.Get(context.Background(), types.NamespacedName{Namespace: "other", Name: "test"}, svc); err != nil {
+		t.Fatal(err)
+	}
+	if cond := tsoperator.GetServiceCondition(svc, tsapi.ProxyReady); cond == nil || cond.Reason != reasonProxyCreated {
+		t.Fatalf("unexpected ProxyReady condition %+v, want reason %s", cond, reasonProxyCreated)
+	}
+}
+
 func TestCustomPriorityClassName(t *testing.T) {
 	fc := fake.NewFakeClient()
 	ft := &fakeTSClient{}
@@ -1766,6 +2009,29 @@ func Test_externalNameService(t *testing.T) {
 	expectEqual(t, fc, expectedSTS(t, fc, opts), removeHashAnnotation)
 }
 
+func TestWatchNamespaces(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"default", []string{"default"}},
+		{" default, prod ,,default", []string{"default", "prod"}},
+	}
+	for _, tt := range tests {
+		got := parseWatchNamespaces(tt.in)
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("parseWatchNamespaces(%q) mismatch (-want +got):\n%s", tt.in, diff)
+		}
+	}
+
+	got := cacheNamespaces([]string{"default", "tailscale"}, "tailscale")
+	want := map[string]cache.Config{"default": {}, "tailscale": {}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("cacheNamespaces mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func toFQDN(t *testing.T, s string) dnsname.FQDN {
 	t.Helper()
 	fqdn, err := dnsname.ToFQDN(s)
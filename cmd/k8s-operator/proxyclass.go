@@ -168,14 +168,26 @@ func (pcr *ProxyClassReconciler) validate(ctx context.Context, pc *tsapi.ProxyCl
 			}
 		}
 	}
-	if pc.Spec.Metrics != nil && pc.Spec.Metrics.ServiceMonitor != nil && pc.Spec.Metrics.ServiceMonitor.Enable {
-		found, err := hasServiceMonitorCRD(ctx, pcr.Client)
-		if err != nil {
-			pcr.logger.Infof("[unexpected]: error retrieving %q CRD: %v", serviceMonitorCRD, err)
-			// best effort validation - don't error out here
-		} else if !found {
-			msg := fmt.Sprintf("ProxyClass defines that a ServiceMonitor custom resource should be created, but %q CRD was not found", serviceMonitorCRD)
-			violations = append(violations, field.TypeInvalid(field.NewPath("spec", "metrics", "serviceMonitor"), "enable", msg))
+	if m := pc.Spec.Metrics; m != nil {
+		if sm := m.ServiceMonitor; sm != nil {
+			if sm.Enable {
+				violations = append(violations, pcr.validateMonitorCRD(ctx, serviceMonitorCRD, "ServiceMonitor", field.NewPath("spec", "metrics", "serviceMonitor"))...)
+			}
+			if len(sm.Labels) > 0 {
+				if errs := metavalidation.ValidateLabels(sm.Labels, field.NewPath(".spec.metrics.serviceMonitor.labels")); errs != nil {
+					violations = append(violations, errs...)
+				}
+			}
+		}
+		if pm := m.PodMonitor; pm != nil {
+			if pm.Enable {
+				violations = append(violations, pcr.validateMonitorCRD(ctx, podMonitorCRD, "PodMonitor", field.NewPath("spec", "metrics", "podMonitor"))...)
+			}
+			if len(pm.Labels) > 0 {
+				if errs := metavalidation.ValidateLabels(pm.Labels, field.NewPath(".spec.metrics.podMonitor.labels")); errs != nil {
+					violations = append(violations, errs...)
+				}
+			}
 		}
 	}
 	// We do not validate embedded fields (security context, resource
@@ -185,9 +197,26 @@ func (pcr *ProxyClassReconciler) validate(ctx context.Context, pc *tsapi.ProxyCl
 	return violations
 }
 
-func hasServiceMonitorCRD(ctx context.Context, cl client.Client) (bool, error) {
-	sm := &apiextensionsv1.CustomResourceDefinition{}
-	if err := cl.Get(ctx, types.NamespacedName{Name: serviceMonitorCRD}, sm); apierrors.IsNotFound(err) {
+// validateMonitorCRD checks that the named Prometheus operator CRD exists in
+// the cluster, as a ProxyClass at path wants resources of kind created.
+func (pcr *ProxyClassReconciler) validateMonitorCRD(ctx context.Context, crd, kind string, path *field.Path) field.ErrorList {
+	found, err := hasCRD(ctx, pcr.Client, crd)
+	if err != nil {
+		pcr.logger.Infof("[unexpected]: error retrieving %q CRD: %v", crd, err)
+		// best effort validation - don't error out here
+		return nil
+	}
+	if !found {
+		msg := fmt.Sprintf("ProxyClass defines that a %s custom resource should be created, but %q CRD was not found", kind, crd)
+		return field.ErrorList{field.TypeInvalid(path, "enable", msg)}
+	}
+	return nil
+}
+
+// hasCRD reports whether the named CustomResourceDefinition exists in the cluster.
+func hasCRD(ctx context.Context, cl client.Client, name string) (bool, error) {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := cl.Get(ctx, types.NamespacedName{Name: name}, crd); apierrors.IsNotFound(err) {
 		return false, nil
 	} else if err != nil {
 		return false, err
@@ -14,6 +14,7 @@
 	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -46,6 +47,11 @@
 	reasonProxyGroupReady          = "ProxyGroupReady"
 	reasonProxyGroupCreating       = "ProxyGroupCreating"
 	reasonProxyGroupInvalid        = "ProxyGroupInvalid"
+	reasonProxyGroupUpgrading      = "ProxyGroupUpgrading"
+
+	// labelProxyGroupSet is set on the resources of the green set of a
+	// ProxyGroup's proxies.
+	labelProxyGroupSet = "tailscale.com/proxy-group-set"
 
 	// Copied from k8s.io/apiserver/pkg/registry/generic/registry/store.go@cccad306d649184bf2a0e319ba830c53f65c445c
 	optimisticLockErrorMsg = "the object has been modified; please apply your changes to the latest version and try again"
@@ -68,6 +74,10 @@ type ProxyGroupReconciler struct {
 	tsFirewallMode    string
 	defaultProxyClass string
 
+	// hostnames tracks the tailnet hostnames of all proxies, to detect
+	// conflicts.
+	hostnames *hostnameIndex
+
 	mu          sync.Mutex           // protects following
 	proxyGroups set.Slice[types.UID] // for proxygroups gauge
 }
@@ -142,6 +152,17 @@ func (r *ProxyGroupReconciler) Reconcile(ctx context.Context, req reconcile.Requ
 		return setStatusReady(pg, metav1.ConditionFalse, reasonProxyGroupInvalid, message)
 	}
 
+	var hostnames []string
+	for _, set := range pgSets(pg) {
+		for i := range pgReplicas(pg) {
+			hostnames = append(hostnames, pgHostname(pg, set, i))
+		}
+	}
+	if err = r.hostnames.claim(hostnameOwner("ProxyGroup", pg), pg.CreationTimestamp.Time, hostnames...); err != nil {
+		r.recorder.Eventf(pg, corev1.EventTypeWarning, reasonHostnameConflict, err.Error())
+		return setStatusReady(pg, metav1.ConditionFalse, reasonHostnameConflict, err.Error())
+	}
+
 	proxyClassName := r.defaultProxyClass
 	if pg.Spec.ProxyClass != "" {
 		proxyClassName = pg.Spec.ProxyClass
@@ -183,6 +204,17 @@ func (r *ProxyGroupReconciler) Reconcile(ctx context.Context, req reconcile.Requ
 		return setStatusReady(pg, metav1.ConditionFalse, reason, msg)
 	}
 
+	if u := pg.Status.Upgrade; u != nil {
+		message := fmt.Sprintf("upgrading to %s: %d/%d traffic shifting steps taken", u.Image, u.Step, pgUpgradeSteps(pg))
+		logger.Debug(message)
+		if _, err := setStatusReady(pg, metav1.ConditionTrue, reasonProxyGroupUpgrading, message); err != nil {
+			return reconcile.Result{}, err
+		}
+		// Requeue to take the next step once it's due. Changes to the
+		// new proxies' readiness trigger reconciles via their StatefulSet.
+		return reconcile.Result{RequeueAfter: r.untilNextUpgradeStep(pg)}, nil
+	}
+
 	desiredReplicas := int(pgReplicas(pg))
 	if len(pg.Status.Devices) < desiredReplicas {
 		message := fmt.Sprintf("%d/%d ProxyGroup pods running", len(pg.Status.Devices), desiredReplicas)
@@ -207,19 +239,45 @@ func (r *ProxyGroupReconciler) maybeProvision(ctx context.Context, pg *tsapi.Pro
 	gaugeProxyGroupResources.Set(int64(r.proxyGroups.Len()))
 	r.mu.Unlock()
 
-	cfgHash, err := r.ensureConfigSecretsCreated(ctx, pg, proxyClass)
+	// Work out which sets of proxies should run, starting a BlueGreen
+	// upgrade if the proxy image of the active set is changing.
+	active := pgActiveSet(pg)
+	cfgHash, err := r.ensureConfigSecretsCreated(ctx, pg, active, proxyClass)
 	if err != nil {
 		return fmt.Errorf("error provisioning config Secrets: %w", err)
 	}
+	ss, err := r.pgStatefulSet(pg, active, cfgHash, proxyClass)
+	if err != nil {
+		return err
+	}
+	if err := r.maybeStartUpgrade(ctx, pg, ss); err != nil {
+		return fmt.Errorf("error checking for proxy image upgrade: %w", err)
+	}
+	statefulSets := []*appsv1.StatefulSet{ss}
+	if u := pg.Status.Upgrade; u != nil {
+		// The active set is left as is until the upgrade is done, so that
+		// it keeps serving while traffic is shifted to the target set.
+		cfgHash, err := r.ensureConfigSecretsCreated(ctx, pg, u.Target, proxyClass)
+		if err != nil {
+			return fmt.Errorf("error provisioning config Secrets: %w", err)
+		}
+		ss, err := r.pgStatefulSet(pg, u.Target, cfgHash, proxyClass)
+		if err != nil {
+			return err
+		}
+		statefulSets = []*appsv1.StatefulSet{ss}
+	}
+
 	// State secrets are precreated so we can use the ProxyGroup CR as their owner ref.
-	stateSecrets := pgStateSecrets(pg, r.tsNamespace)
-	for _, sec := range stateSecrets {
-		if _, err := createOrUpdate(ctx, r.Client, r.tsNamespace, sec, func(s *corev1.Secret) {
-			s.ObjectMeta.Labels = sec.ObjectMeta.Labels
-			s.ObjectMeta.Annotations = sec.ObjectMeta.Annotations
-			s.ObjectMeta.OwnerReferences = sec.ObjectMeta.OwnerReferences
-		}); err != nil {
-			return fmt.Errorf("error provisioning state Secrets: %w", err)
+	for _, set := range pgSets(pg) {
+		for _, sec := range pgStateSecrets(pg, set, r.tsNamespace) {
+			if _, err := createOrUpdate(ctx, r.Client, r.tsNamespace, sec, func(s *corev1.Secret) {
+				s.ObjectMeta.Labels = sec.ObjectMeta.Labels
+				s.ObjectMeta.Annotations = sec.ObjectMeta.Annotations
+				s.ObjectMeta.OwnerReferences = sec.ObjectMeta.OwnerReferences
+			}); err != nil {
+				return fmt.Errorf("error provisioning state Secrets: %w", err)
+			}
 		}
 	}
 	sa := pgServiceAccount(pg, r.tsNamespace)
@@ -258,18 +316,15 @@ func (r *ProxyGroupReconciler) maybeProvision(ctx context.Context, pg *tsapi.Pro
 			return fmt.Errorf("error provisioning ConfigMap: %w", err)
 		}
 	}
-	ss, err := pgStatefulSet(pg, r.tsNamespace, r.proxyImage, r.tsFirewallMode, cfgHash)
-	if err != nil {
-		return fmt.Errorf("error generating StatefulSet spec: %w", err)
-	}
-	ss = applyProxyClassToStatefulSet(proxyClass, ss, nil, logger)
-	if _, err := createOrUpdate(ctx, r.Client, r.tsNamespace, ss, func(s *appsv1.StatefulSet) {
-		s.ObjectMeta.Labels = ss.ObjectMeta.Labels
-		s.ObjectMeta.Annotations = ss.ObjectMeta.Annotations
-		s.ObjectMeta.OwnerReferences = ss.ObjectMeta.OwnerReferences
-		s.Spec = ss.Spec
-	}); err != nil {
-		return fmt.Errorf("error provisioning StatefulSet: %w", err)
+	for _, ss := range statefulSets {
+		if _, err := createOrUpdate(ctx, r.Client, r.tsNamespace, ss, func(s *appsv1.StatefulSet) {
+			s.ObjectMeta.Labels = ss.ObjectMeta.Labels
+			s.ObjectMeta.Annotations = ss.ObjectMeta.Annotations
+			s.ObjectMeta.OwnerReferences = ss.ObjectMeta.OwnerReferences
+			s.Spec = ss.Spec
+		}); err != nil {
+			return fmt.Errorf("error provisioning StatefulSet: %w", err)
+		}
 	}
 	mo := &metricsOpts{
 		tsNamespace:  r.tsNamespace,
@@ -281,6 +336,10 @@ func (r *ProxyGroupReconciler) maybeProvision(ctx context.Context, pg *tsapi.Pro
 		return fmt.Errorf("error reconciling metrics resources: %w", err)
 	}
 
+	if err := r.maybeAdvanceUpgrade(ctx, pg); err != nil {
+		return fmt.Errorf("error advancing proxy image upgrade: %w", err)
+	}
+
 	if err := r.cleanupDanglingResources(ctx, pg); err != nil {
 		return fmt.Errorf("error cleaning up dangling resources: %w", err)
 	}
@@ -295,17 +354,162 @@ func (r *ProxyGroupReconciler) maybeProvision(ctx context.Context, pg *tsapi.Pro
 	return nil
 }
 
+// pgStatefulSet returns the StatefulSet for the given set of the ProxyGroup's
+// proxies, with the ProxyClass applied.
+func (r *ProxyGroupReconciler) pgStatefulSet(pg *tsapi.ProxyGroup, set tsapi.ProxyGroupSet, cfgHash string, proxyClass *tsapi.ProxyClass) (*appsv1.StatefulSet, error) {
+	ss, err := pgStatefulSet(pg, set, r.tsNamespace, r.proxyImage, r.tsFirewallMode, cfgHash)
+	if err != nil {
+		return nil, fmt.Errorf("error generating StatefulSet spec: %w", err)
+	}
+	return applyProxyClassToStatefulSet(proxyClass, ss, nil, r.logger(pg.Name)), nil
+}
+
+// maybeStartUpgrade starts a BlueGreen upgrade of the ProxyGroup if it uses
+// the BlueGreen upgrade strategy and the proxy image of its active set's
+// existing StatefulSet differs from that of desired. If an upgrade is already
+// underway, it retargets it to the image of desired.
+func (r *ProxyGroupReconciler) maybeStartUpgrade(ctx context.Context, pg *tsapi.ProxyGroup, desired *appsv1.StatefulSet) error {
+	image := desired.Spec.Template.Spec.Containers[0].Image
+	if u := pg.Status.Upgrade; u != nil {
+		u.Image = image
+		return nil
+	}
+	if !pgBlueGreen(pg) {
+		return nil
+	}
+	existing := new(appsv1.StatefulSet)
+	err := r.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if apierrors.IsNotFound(err) {
+		return nil // nothing to upgrade from
+	}
+	if err != nil {
+		return err
+	}
+	if len(existing.Spec.Template.Spec.Containers) == 0 || existing.Spec.Template.Spec.Containers[0].Image == image {
+		return nil
+	}
+	target := pgOtherSet(pgActiveSet(pg))
+	r.logger(pg.Name).Infof("starting BlueGreen upgrade to %s with the %s set of proxies", image, target)
+	pg.Status.Upgrade = &tsapi.ProxyGroupUpgradeStatus{
+		Target:       target,
+		Image:        image,
+		LastStepTime: metav1.NewTime(r.clock.Now()),
+	}
+	return nil
+}
+
+// maybeAdvanceUpgrade takes the next step of the BlueGreen upgrade underway,
+// if any, once it is due. Each step shifts more egress traffic to the target
+// set of proxies, see egressEpsReconciler. Steps are only taken while all the
+// target set's proxies are ready. Once all traffic has been shifted and the
+// old proxies have drained, it makes the target set the active set, after
+// which cleanupDanglingResources removes the old proxies.
+func (r *ProxyGroupReconciler) maybeAdvanceUpgrade(ctx context.Context, pg *tsapi.ProxyGroup) error {
+	u := pg.Status.Upgrade
+	if u == nil {
+		return nil
+	}
+	logger := r.logger(pg.Name)
+	now := r.clock.Now()
+	elapsed := now.Sub(u.LastStepTime.Time)
+	if u.Step >= pgUpgradeSteps(pg) {
+		if elapsed < pgUpgradeDrainPeriod(pg) {
+			return nil
+		}
+		logger.Infof("BlueGreen upgrade to %s done, switching to the %s set of proxies", u.Image, u.Target)
+		pg.Status.ActiveSet = u.Target
+		pg.Status.Upgrade = nil
+		return nil
+	}
+	if elapsed < pgUpgradeStepInterval(pg) {
+		return nil
+	}
+	ready, err := r.setIsReady(ctx, pg, u.Target)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		logger.Debugf("waiting for the %s set of proxies to be ready", u.Target)
+		return nil
+	}
+	u.Step++
+	u.LastStepTime = metav1.NewTime(now)
+	logger.Infof("BlueGreen upgrade to %s: took traffic shifting step %d/%d", u.Image, u.Step, pgUpgradeSteps(pg))
+	return nil
+}
+
+// setIsReady reports whether all the Pods of the given set of the
+// ProxyGroup's proxies are ready and logged in to the tailnet.
+func (r *ProxyGroupReconciler) setIsReady(ctx context.Context, pg *tsapi.ProxyGroup, set tsapi.ProxyGroupSet) (bool, error) {
+	ss := new(appsv1.StatefulSet)
+	err := r.Get(ctx, types.NamespacedName{Namespace: r.tsNamespace, Name: pgSetName(pg.Name, set)}, ss)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if ss.Status.ObservedGeneration < ss.Generation || ss.Status.ReadyReplicas < pgReplicas(pg) {
+		return false, nil
+	}
+	metadata, err := r.getNodeMetadata(ctx, pg)
+	if err != nil {
+		return false, err
+	}
+	var loggedIn int32
+	for _, m := range metadata {
+		if m.set == set && m.ordinal < int(pgReplicas(pg)) {
+			loggedIn++
+		}
+	}
+	return loggedIn == pgReplicas(pg), nil
+}
+
+// untilNextUpgradeStep returns how long until the next step of the BlueGreen
+// upgrade underway is due.
+func (r *ProxyGroupReconciler) untilNextUpgradeStep(pg *tsapi.ProxyGroup) time.Duration {
+	wait := pgUpgradeStepInterval(pg)
+	if pg.Status.Upgrade.Step >= pgUpgradeSteps(pg) {
+		wait = pgUpgradeDrainPeriod(pg)
+	}
+	wait -= r.clock.Since(pg.Status.Upgrade.LastStepTime.Time)
+	return max(wait, shortRequeue)
+}
+
 // cleanupDanglingResources ensures we don't leak config secrets, state secrets, and
-// tailnet devices when the number of replicas specified is reduced.
+// tailnet devices when the number of replicas specified is reduced, or when a
+// BlueGreen upgrade retires a set of proxies.
 func (r *ProxyGroupReconciler) cleanupDanglingResources(ctx context.Context, pg *tsapi.ProxyGroup) error {
 	logger := r.logger(pg.Name)
+	sets := pgSets(pg)
+
+	// Delete the StatefulSet of a retired set first, so that its proxies
+	// are shut down before their devices are deleted.
+	for _, set := range []tsapi.ProxyGroupSet{tsapi.ProxyGroupSetBlue, tsapi.ProxyGroupSetGreen} {
+		if slices.Contains(sets, set) {
+			continue
+		}
+		ss := new(appsv1.StatefulSet)
+		err := r.Get(ctx, types.NamespacedName{Namespace: r.tsNamespace, Name: pgSetName(pg.Name, set)}, ss)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error getting StatefulSet %s: %w", pgSetName(pg.Name, set), err)
+		}
+		logger.Infof("deleting StatefulSet %s of the retired %s set of proxies", ss.Name, set)
+		if err := r.Delete(ctx, ss); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error deleting StatefulSet %s: %w", ss.Name, err)
+		}
+	}
+
 	metadata, err := r.getNodeMetadata(ctx, pg)
 	if err != nil {
 		return err
 	}
 
 	for _, m := range metadata {
-		if m.ordinal+1 <= int(pgReplicas(pg)) {
+		if slices.Contains(sets, m.set) && m.ordinal+1 <= int(pgReplicas(pg)) {
 			continue
 		}
 
@@ -357,6 +561,7 @@ func (r *ProxyGroupReconciler) maybeCleanup(ctx context.Context, pg *tsapi.Proxy
 	}
 
 	logger.Infof("cleaned up ProxyGroup resources")
+	r.hostnames.release(hostnameOwner("ProxyGroup", pg))
 	r.mu.Lock()
 	r.proxyGroups.Remove(pg.UID)
 	gaugeProxyGroupResources.Set(int64(r.proxyGroups.Len()))
@@ -380,13 +585,13 @@ func (r *ProxyGroupReconciler) deleteTailnetDevice(ctx context.Context, id tailc
 	return nil
 }
 
-func (r *ProxyGroupReconciler) ensureConfigSecretsCreated(ctx context.Context, pg *tsapi.ProxyGroup, proxyClass *tsapi.ProxyClass) (hash string, err error) {
+func (r *ProxyGroupReconciler) ensureConfigSecretsCreated(ctx context.Context, pg *tsapi.ProxyGroup, set tsapi.ProxyGroupSet, proxyClass *tsapi.ProxyClass) (hash string, err error) {
 	logger := r.logger(pg.Name)
 	var configSHA256Sum string
 	for i := range pgReplicas(pg) {
 		cfgSecret := &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:            fmt.Sprintf("%s-%d-config", pg.Name, i),
+				Name:            fmt.Sprintf("%s-%d-config", pgSetName(pg.Name, set), i),
 				Namespace:       r.tsNamespace,
 				Labels:          pgSecretLabels(pg.Name, "config"),
 				OwnerReferences: pgOwnerReference(pg),
@@ -414,7 +619,7 @@ func (r *ProxyGroupReconciler) ensureConfigSecretsCreated(ctx context.Context, p
 			}
 		}
 
-		configs, err := pgTailscaledConfig(pg, proxyClass, i, authKey, existingCfgSecret)
+		configs, err := pgTailscaledConfig(pg, set, proxyClass, i, authKey, existingCfgSecret)
 		if err != nil {
 			return "", fmt.Errorf("error creating tailscaled config: %w", err)
 		}
@@ -469,17 +674,13 @@ func (r *ProxyGroupReconciler) ensureConfigSecretsCreated(ctx context.Context, p
 	return configSHA256Sum, nil
 }
 
-func pgTailscaledConfig(pg *tsapi.ProxyGroup, class *tsapi.ProxyClass, idx int32, authKey string, oldSecret *corev1.Secret) (tailscaledConfigs, error) {
+func pgTailscaledConfig(pg *tsapi.ProxyGroup, set tsapi.ProxyGroupSet, class *tsapi.ProxyClass, idx int32, authKey string, oldSecret *corev1.Secret) (tailscaledConfigs, error) {
 	conf := &ipn.ConfigVAlpha{
 		Version:      "alpha0",
 		AcceptDNS:    "false",
 		AcceptRoutes: "false", // AcceptRoutes defaults to true
 		Locked:       "false",
-		Hostname:     ptr.To(fmt.Sprintf("%s-%d", pg.Name, idx)),
-	}
-
-	if pg.Spec.HostnamePrefix != "" {
-		conf.Hostname = ptr.To(fmt.Sprintf("%s%d", pg.Spec.HostnamePrefix, idx))
+		Hostname:     ptr.To(pgHostname(pg, set, idx)),
 	}
 
 	if shouldAcceptRoutes(class) {
@@ -508,7 +709,27 @@ func pgTailscaledConfig(pg *tsapi.ProxyGroup, class *tsapi.ProxyClass, idx int32
 	return capVerConfigs, nil
 }
 
-func (r *ProxyGroupReconciler) validate(_ *tsapi.ProxyGroup) error {
+func (r *ProxyGroupReconciler) validate(pg *tsapi.ProxyGroup) error {
+	if tmpl := pg.Spec.HostnameTemplate; tmpl != "" {
+		if pg.Spec.HostnamePrefix != "" {
+			return errors.New("hostnamePrefix and hostnameTemplate are mutually exclusive")
+		}
+		first, err := renderHostnameTemplate(tmpl, hostnameTemplateVars{name: pg.Name, ordinal: 0})
+		if err != nil {
+			return err
+		}
+		// Rendering is the same for all ordinals other than the number
+		// of digits, so checking two is enough to catch templates that
+		// would give all devices the same hostname. The last one is the
+		// longest.
+		last, err := renderHostnameTemplate(tmpl, hostnameTemplateVars{name: pg.Name, ordinal: max(pgReplicas(pg)-1, 1)})
+		if err != nil {
+			return err
+		}
+		if first == last {
+			return fmt.Errorf("hostname template %q must include {{ordinal}}", tmpl)
+		}
+	}
 	return nil
 }
 
@@ -523,8 +744,12 @@ func (r *ProxyGroupReconciler) getNodeMetadata(ctx context.Context, pg *tsapi.Pr
 		return nil, fmt.Errorf("failed to list state Secrets: %w", err)
 	}
 	for _, secret := range secrets.Items {
+		set := tsapi.ProxyGroupSetBlue
+		if strings.HasPrefix(secret.Name, pgSetName(pg.Name, tsapi.ProxyGroupSetGreen)+"-") {
+			set = tsapi.ProxyGroupSetGreen
+		}
 		var ordinal int
-		if _, err := fmt.Sscanf(secret.Name, pg.Name+"-%d", &ordinal); err != nil {
+		if _, err := fmt.Sscanf(secret.Name, pgSetName(pg.Name, set)+"-%d", &ordinal); err != nil {
 			return nil, fmt.Errorf("unexpected secret %s was labelled as owned by the ProxyGroup %s: %w", secret.Name, pg.Name, err)
 		}
 
@@ -537,6 +762,7 @@ func (r *ProxyGroupReconciler) getNodeMetadata(ctx context.Context, pg *tsapi.Pr
 		}
 
 		metadata = append(metadata, nodeMetadata{
+			set:         set,
 			ordinal:     ordinal,
 			stateSecret: &secret,
 			tsID:        id,
@@ -564,6 +790,7 @@ func (r *ProxyGroupReconciler) getDeviceInfo(ctx context.Context, pg *tsapi.Prox
 		devices = append(devices, tsapi.TailnetDevice{
 			Hostname:   device.Hostname,
 			TailnetIPs: device.TailnetIPs,
+			Stats:      proxyStats(m.stateSecret, r.logger(pg.Name)),
 		})
 	}
 
@@ -571,6 +798,7 @@ func (r *ProxyGroupReconciler) getDeviceInfo(ctx context.Context, pg *tsapi.Prox
 }
 
 type nodeMetadata struct {
+	set         tsapi.ProxyGroupSet
 	ordinal     int
 	stateSecret *corev1.Secret
 	tsID        tailcfg.StableNodeID
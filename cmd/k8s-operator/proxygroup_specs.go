@@ -7,6 +7,7 @@
 
 import (
 	"fmt"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -19,9 +20,9 @@
 	"tailscale.com/types/ptr"
 )
 
-// Returns the base StatefulSet definition for a ProxyGroup. A ProxyClass may be
-// applied over the top after.
-func pgStatefulSet(pg *tsapi.ProxyGroup, namespace, image, tsFirewallMode, cfgHash string) (*appsv1.StatefulSet, error) {
+// Returns the base StatefulSet definition for the given set of a ProxyGroup's
+// proxies. A ProxyClass may be applied over the top after.
+func pgStatefulSet(pg *tsapi.ProxyGroup, set tsapi.ProxyGroupSet, namespace, image, tsFirewallMode, cfgHash string) (*appsv1.StatefulSet, error) {
 	ss := new(appsv1.StatefulSet)
 	if err := yaml.Unmarshal(proxyYaml, &ss); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal proxy spec: %w", err)
@@ -35,23 +36,24 @@ func pgStatefulSet(pg *tsapi.ProxyGroup, namespace, image, tsFirewallMode, cfgHa
 	}
 
 	// StatefulSet config.
+	name := pgSetName(pg.Name, set)
 	ss.ObjectMeta = metav1.ObjectMeta{
-		Name:            pg.Name,
+		Name:            name,
 		Namespace:       namespace,
-		Labels:          pgLabels(pg.Name, nil),
+		Labels:          pgLabels(pg.Name, pgSetLabels(set)),
 		OwnerReferences: pgOwnerReference(pg),
 	}
 	ss.Spec.Replicas = ptr.To(pgReplicas(pg))
 	ss.Spec.Selector = &metav1.LabelSelector{
-		MatchLabels: pgLabels(pg.Name, nil),
+		MatchLabels: pgLabels(pg.Name, pgSetLabels(set)),
 	}
 
 	// Template config.
 	tmpl := &ss.Spec.Template
 	tmpl.ObjectMeta = metav1.ObjectMeta{
-		Name:                       pg.Name,
+		Name:                       name,
 		Namespace:                  namespace,
-		Labels:                     pgLabels(pg.Name, nil),
+		Labels:                     pgLabels(pg.Name, pgSetLabels(set)),
 		DeletionGracePeriodSeconds: ptr.To[int64](10),
 		Annotations: map[string]string{
 			podAnnotationLastSetConfigFileHash: cfgHash,
@@ -66,7 +68,7 @@ func pgStatefulSet(pg *tsapi.ProxyGroup, namespace, image, tsFirewallMode, cfgHa
 				Name: fmt.Sprintf("tailscaledconfig-%d", i),
 				VolumeSource: corev1.VolumeSource{
 					Secret: &corev1.SecretVolumeSource{
-						SecretName: fmt.Sprintf("%s-%d-config", pg.Name, i),
+						SecretName: fmt.Sprintf("%s-%d-config", name, i),
 					},
 				},
 			})
@@ -101,7 +103,7 @@ func pgStatefulSet(pg *tsapi.ProxyGroup, namespace, image, tsFirewallMode, cfgHa
 			mounts = append(mounts, corev1.VolumeMount{
 				Name:      fmt.Sprintf("tailscaledconfig-%d", i),
 				ReadOnly:  true,
-				MountPath: fmt.Sprintf("/etc/tsconfig/%s-%d", pg.Name, i),
+				MountPath: fmt.Sprintf("/etc/tsconfig/%s-%d", name, i),
 			})
 		}
 
@@ -193,11 +195,14 @@ func pgRole(pg *tsapi.ProxyGroup, namespace string) *rbacv1.Role {
 					"update",
 				},
 				ResourceNames: func() (secrets []string) {
-					for i := range pgReplicas(pg) {
-						secrets = append(secrets,
-							fmt.Sprintf("%s-%d-config", pg.Name, i), // Config with auth key.
-							fmt.Sprintf("%s-%d", pg.Name, i),        // State.
-						)
+					for _, set := range pgSets(pg) {
+						name := pgSetName(pg.Name, set)
+						for i := range pgReplicas(pg) {
+							secrets = append(secrets,
+								fmt.Sprintf("%s-%d-config", name, i), // Config with auth key.
+								fmt.Sprintf("%s-%d", name, i),        // State.
+							)
+						}
 					}
 					return secrets
 				}(),
@@ -237,11 +242,11 @@ func pgRoleBinding(pg *tsapi.ProxyGroup, namespace string) *rbacv1.RoleBinding {
 	}
 }
 
-func pgStateSecrets(pg *tsapi.ProxyGroup, namespace string) (secrets []*corev1.Secret) {
+func pgStateSecrets(pg *tsapi.ProxyGroup, set tsapi.ProxyGroupSet, namespace string) (secrets []*corev1.Secret) {
 	for i := range pgReplicas(pg) {
 		secrets = append(secrets, &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:            fmt.Sprintf("%s-%d", pg.Name, i),
+				Name:            fmt.Sprintf("%s-%d", pgSetName(pg.Name, set), i),
 				Namespace:       namespace,
 				Labels:          pgSecretLabels(pg.Name, "state"),
 				OwnerReferences: pgOwnerReference(pg),
@@ -297,3 +302,108 @@ func pgReplicas(pg *tsapi.ProxyGroup) int32 {
 func pgEgressCMName(pg string) string {
 	return fmt.Sprintf("%s-egress-config", pg)
 }
+
+// pgSetName returns the name of the StatefulSet of the given set of a
+// ProxyGroup's proxies, which is also the prefix of the names of its Pods and
+// their Secrets. The blue set keeps the names the operator used before there
+// were sets, so that existing ProxyGroups are their blue set.
+func pgSetName(pgName string, set tsapi.ProxyGroupSet) string {
+	if set == tsapi.ProxyGroupSetGreen {
+		return pgName + "-green"
+	}
+	return pgName
+}
+
+// pgSetLabels returns the labels that identify the resources of the given set
+// of a ProxyGroup's proxies. The blue set has none, as the selector of an
+// existing StatefulSet can't be changed; blue Pods are those without the label.
+func pgSetLabels(set tsapi.ProxyGroupSet) map[string]string {
+	if set == tsapi.ProxyGroupSetGreen {
+		return map[string]string{labelProxyGroupSet: string(set)}
+	}
+	return nil
+}
+
+// pgPodSet returns the set of a ProxyGroup's proxies that pod belongs to.
+func pgPodSet(pod *corev1.Pod) tsapi.ProxyGroupSet {
+	if pod.Labels[labelProxyGroupSet] == string(tsapi.ProxyGroupSetGreen) {
+		return tsapi.ProxyGroupSetGreen
+	}
+	return tsapi.ProxyGroupSetBlue
+}
+
+// pgActiveSet returns the set of proxies currently serving the ProxyGroup.
+func pgActiveSet(pg *tsapi.ProxyGroup) tsapi.ProxyGroupSet {
+	if pg.Status.ActiveSet != "" {
+		return pg.Status.ActiveSet
+	}
+	return tsapi.ProxyGroupSetBlue
+}
+
+// pgOtherSet returns the set that a BlueGreen upgrade from set brings up.
+func pgOtherSet(set tsapi.ProxyGroupSet) tsapi.ProxyGroupSet {
+	if set == tsapi.ProxyGroupSetGreen {
+		return tsapi.ProxyGroupSetBlue
+	}
+	return tsapi.ProxyGroupSetGreen
+}
+
+// pgSets returns the sets of proxies the ProxyGroup should currently run: the
+// active set, followed by the target set of the upgrade underway, if any.
+// pgHostname returns the tailnet hostname of the proxy with the given ordinal
+// in the given set of the ProxyGroup's proxies.
+func pgHostname(pg *tsapi.ProxyGroup, set tsapi.ProxyGroupSet, ordinal int32) string {
+	hostname := fmt.Sprintf("%s-%d", pg.Name, ordinal)
+	if pg.Spec.HostnamePrefix != "" {
+		hostname = fmt.Sprintf("%s%d", pg.Spec.HostnamePrefix, ordinal)
+	} else if pg.Spec.HostnameTemplate != "" {
+		// The template is validated before any proxies are
+		// provisioned.
+		hostname, _ = renderHostnameTemplate(pg.Spec.HostnameTemplate, hostnameTemplateVars{name: pg.Name, ordinal: ordinal})
+	}
+	if set == tsapi.ProxyGroupSetGreen {
+		// Keep the devices of both sets apart while they run side by side.
+		hostname += "-green"
+	}
+	return hostname
+}
+
+func pgSets(pg *tsapi.ProxyGroup) []tsapi.ProxyGroupSet {
+	sets := []tsapi.ProxyGroupSet{pgActiveSet(pg)}
+	if pg.Status.Upgrade != nil {
+		sets = append(sets, pg.Status.Upgrade.Target)
+	}
+	return sets
+}
+
+func pgBlueGreen(pg *tsapi.ProxyGroup) bool {
+	return pg.Spec.UpgradeStrategy != nil && pg.Spec.UpgradeStrategy.Type == tsapi.ProxyGroupUpgradeStrategyBlueGreen
+}
+
+func pgBlueGreenConfig(pg *tsapi.ProxyGroup) *tsapi.BlueGreenUpgrade {
+	if pg.Spec.UpgradeStrategy != nil && pg.Spec.UpgradeStrategy.BlueGreen != nil {
+		return pg.Spec.UpgradeStrategy.BlueGreen
+	}
+	return &tsapi.BlueGreenUpgrade{}
+}
+
+func pgUpgradeSteps(pg *tsapi.ProxyGroup) int32 {
+	if s := pgBlueGreenConfig(pg).Steps; s != nil && *s > 0 {
+		return *s
+	}
+	return 4
+}
+
+func pgUpgradeStepInterval(pg *tsapi.ProxyGroup) time.Duration {
+	if d := pgBlueGreenConfig(pg).StepInterval; d != nil {
+		return d.Duration
+	}
+	return time.Minute
+}
+
+func pgUpgradeDrainPeriod(pg *tsapi.ProxyGroup) time.Duration {
+	if d := pgBlueGreenConfig(pg).DrainPeriod; d != nil {
+		return d.Duration
+	}
+	return 5 * time.Minute
+}
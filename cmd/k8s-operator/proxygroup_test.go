@@ -9,6 +9,7 @@
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -18,6 +19,7 @@
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -25,6 +27,7 @@
 	"tailscale.com/client/tailscale"
 	tsoperator "tailscale.com/k8s-operator"
 	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
+	"tailscale.com/kube/kubetypes"
 	"tailscale.com/tstest"
 	"tailscale.com/types/ptr"
 )
@@ -184,6 +187,40 @@ func TestProxyGroup(t *testing.T) {
 		expectProxyGroupResources(t, fc, pg, true, initialCfgHash)
 	})
 
+	t.Run("observe_proxy_stats", func(t *testing.T) {
+		now := time.Now().UTC().Truncate(time.Second)
+		stats, err := json.Marshal(kubetypes.ProxyStats{
+			Time:             now,
+			DERPHomeRegion:   "nyc",
+			ActivePeers:      4,
+			DirectPeers:      3,
+			LastNetmapUpdate: ptr.To(now.Add(-time.Minute)),
+			RxBytes:          1000,
+			TxBytes:          2000,
+			MemoryBytes:      64 << 20,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustUpdate(t, fc, tsNamespace, pgSetName(pg.Name, tsapi.ProxyGroupSetBlue)+"-0", func(s *corev1.Secret) {
+			s.Data[kubetypes.KeyProxyStats] = stats
+		})
+		expectReconciled(t, reconciler, "", pg.Name)
+
+		pg.Status.Devices[0].Stats = &tsapi.ProxyStats{
+			LastUpdated:           metav1.NewTime(now),
+			DERPHomeRegion:        "nyc",
+			ActivePeers:           4,
+			DirectPeers:           3,
+			DirectConnectionRatio: "75%",
+			LastNetmapUpdate:      ptr.To(metav1.NewTime(now.Add(-time.Minute))),
+			RxBytes:               1000,
+			TxBytes:               2000,
+			MemoryBytes:           64 << 20,
+		}
+		expectEqual(t, fc, pg, nil)
+	})
+
 	t.Run("trigger_config_change_and_observe_new_config_hash", func(t *testing.T) {
 		pc.Spec.TailscaleConfig = &tsapi.TailscaleConfig{
 			AcceptRoutes: true,
@@ -218,6 +255,41 @@ func TestProxyGroup(t *testing.T) {
 		expectReconciled(t, reconciler, "", pg.Name)
 		expectEqualUnstructured(t, fc, expectedServiceMonitor(t, opts))
 	})
+	t.Run("add_service_monitor_labels", func(t *testing.T) {
+		pc.Spec.Metrics.ServiceMonitor.Labels = map[string]string{"release": "prometheus"}
+		mustUpdate(t, fc, "", pc.Name, func(p *tsapi.ProxyClass) {
+			p.Spec.Metrics = pc.Spec.Metrics
+		})
+		expectReconciled(t, reconciler, "", pg.Name)
+		sm := expectedServiceMonitor(t, opts)
+		sm.SetLabels(monitorLabels(metricsLabels(opts), pc.Spec.Metrics.ServiceMonitor.Labels))
+		sm.SetResourceVersion("2")
+		expectEqualUnstructured(t, fc, sm)
+	})
+	t.Run("create_crd_expect_pod_monitor", func(t *testing.T) {
+		pc.Spec.Metrics.PodMonitor = &tsapi.PodMonitor{Enable: true}
+		mustUpdate(t, fc, "", pc.Name, func(p *tsapi.ProxyClass) {
+			p.Spec.Metrics = pc.Spec.Metrics
+		})
+		expectReconciled(t, reconciler, "", pg.Name)
+		mustCreate(t, fc, &apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: podMonitorCRD}})
+		expectReconciled(t, reconciler, "", pg.Name)
+		expectEqualUnstructured(t, fc, expectedPodMonitor(t, opts))
+	})
+	t.Run("disable_pod_monitor", func(t *testing.T) {
+		pc.Spec.Metrics.PodMonitor = nil
+		mustUpdate(t, fc, "", pc.Name, func(p *tsapi.ProxyClass) {
+			p.Spec.Metrics = pc.Spec.Metrics
+		})
+		expectReconciled(t, reconciler, "", pg.Name)
+		u, err := podMonitorToUnstructured(podMonitorTemplate(metricsResourceName(pg.Name), "tailscale"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fc.Get(context.Background(), client.ObjectKeyFromObject(u), u); !apierrors.IsNotFound(err) {
+			t.Fatalf("expected PodMonitor to be deleted, got err %v", err)
+		}
+	})
 
 	t.Run("delete_and_cleanup", func(t *testing.T) {
 		if err := fc.Delete(context.Background(), pg); err != nil {
@@ -241,13 +313,203 @@ func TestProxyGroup(t *testing.T) {
 	})
 }
 
+func TestProxyGroupBlueGreenUpgrade(t *testing.T) {
+	const newProxyImage = "tailscale/tailscale:new"
+
+	pg := &tsapi.ProxyGroup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test",
+			Finalizers: []string{"tailscale.com/finalizer"},
+		},
+		Spec: tsapi.ProxyGroupSpec{
+			Type: tsapi.ProxyGroupTypeEgress,
+			UpgradeStrategy: &tsapi.ProxyGroupUpgradeStrategy{
+				Type: tsapi.ProxyGroupUpgradeStrategyBlueGreen,
+				BlueGreen: &tsapi.BlueGreenUpgrade{
+					Steps:        ptr.To[int32](2),
+					StepInterval: &metav1.Duration{Duration: time.Minute},
+					DrainPeriod:  &metav1.Duration{Duration: 5 * time.Minute},
+				},
+			},
+		},
+	}
+	fc := fake.NewClientBuilder().
+		WithScheme(tsapi.GlobalScheme).
+		WithObjects(pg).
+		WithStatusSubresource(pg, &appsv1.StatefulSet{}).
+		Build()
+	tsClient := &fakeTSClient{}
+	zl, _ := zap.NewDevelopment()
+	cl := tstest.NewClock(tstest.ClockOpts{})
+	reconciler := &ProxyGroupReconciler{
+		tsNamespace:    tsNamespace,
+		proxyImage:     testProxyImage,
+		defaultTags:    []string{"tag:test-tag"},
+		tsFirewallMode: "auto",
+
+		Client:   fc,
+		tsClient: tsClient,
+		recorder: record.NewFakeRecorder(10),
+		l:        zl.Sugar(),
+		clock:    cl,
+	}
+	getPG := func() *tsapi.ProxyGroup {
+		t.Helper()
+		pg := new(tsapi.ProxyGroup)
+		if err := fc.Get(context.Background(), client.ObjectKey{Name: "test"}, pg); err != nil {
+			t.Fatal(err)
+		}
+		return pg
+	}
+	expectImage := func(name, image string) {
+		t.Helper()
+		ss := new(appsv1.StatefulSet)
+		if err := fc.Get(context.Background(), client.ObjectKey{Namespace: tsNamespace, Name: name}, ss); err != nil {
+			t.Fatal(err)
+		}
+		if got := ss.Spec.Template.Spec.Containers[0].Image; got != image {
+			t.Errorf("StatefulSet %s image = %q; want %q", name, got, image)
+		}
+	}
+	expectStep := func(step int32) {
+		t.Helper()
+		u := getPG().Status.Upgrade
+		if u == nil {
+			t.Fatalf("no upgrade underway; want step %d", step)
+		}
+		want := tsapi.ProxyGroupUpgradeStatus{
+			Target: tsapi.ProxyGroupSetGreen,
+			Image:  newProxyImage,
+			Step:   step,
+		}
+		u.LastStepTime = metav1.Time{}
+		if diff := cmp.Diff(want, *u); diff != "" {
+			t.Errorf("unexpected upgrade status (-want +got):\n%s", diff)
+		}
+	}
+
+	// Bring up the blue set.
+	expectReconciled(t, reconciler, "", pg.Name)
+	addNodeIDToStateSecrets(t, fc, getPG())
+	expectReconciled(t, reconciler, "", pg.Name)
+	if !tsoperator.ProxyGroupIsReady(getPG()) {
+		t.Fatal("ProxyGroup not ready")
+	}
+
+	// Changing the image starts an upgrade instead of updating the blue set.
+	reconciler.proxyImage = newProxyImage
+	expectRequeue(t, reconciler, "", pg.Name)
+	expectStep(0)
+	expectImage("test", testProxyImage)
+	expectImage("test-green", newProxyImage)
+	expectSecrets(t, fc, []string{
+		"test-0", "test-0-config", "test-1", "test-1-config",
+		"test-green-0", "test-green-0-config", "test-green-1", "test-green-1-config",
+	})
+	if !tsoperator.ProxyGroupIsReady(getPG()) {
+		t.Error("ProxyGroup not ready during upgrade")
+	}
+
+	// No step is taken until the green set is ready.
+	cl.Advance(time.Minute)
+	expectRequeue(t, reconciler, "", pg.Name)
+	expectStep(0)
+
+	addNodeIDToStateSecrets(t, fc, getPG())
+	mustUpdateStatus(t, fc, tsNamespace, "test-green", func(ss *appsv1.StatefulSet) {
+		ss.Status.ReadyReplicas = 2
+	})
+	expectRequeue(t, reconciler, "", pg.Name)
+	expectStep(1)
+
+	// Steps are taken at most once per step interval.
+	cl.Advance(30 * time.Second)
+	expectRequeue(t, reconciler, "", pg.Name)
+	expectStep(1)
+	cl.Advance(30 * time.Second)
+	expectRequeue(t, reconciler, "", pg.Name)
+	expectStep(2)
+
+	// The blue set is removed after the drain period.
+	cl.Advance(4 * time.Minute)
+	expectRequeue(t, reconciler, "", pg.Name)
+	expectStep(2)
+	cl.Advance(time.Minute)
+	expectReconciled(t, reconciler, "", pg.Name)
+	if got := getPG().Status; got.Upgrade != nil || got.ActiveSet != tsapi.ProxyGroupSetGreen {
+		t.Fatalf("upgrade = %+v, active set = %q; want no upgrade and green active", got.Upgrade, got.ActiveSet)
+	}
+	expectMissing[appsv1.StatefulSet](t, fc, tsNamespace, "test")
+	expectImage("test-green", newProxyImage)
+	expectSecrets(t, fc, []string{"test-green-0", "test-green-0-config", "test-green-1", "test-green-1-config"})
+	if diff := cmp.Diff([]string{"nodeid-0", "nodeid-1"}, tsClient.Deleted()); diff != "" {
+		t.Errorf("unexpected deleted devices (-want +got):\n%s", diff)
+	}
+	wantDevices := []tsapi.TailnetDevice{
+		{Hostname: "hostname-nodeid-green-0", TailnetIPs: []string{"1.2.3.4", "::1"}},
+		{Hostname: "hostname-nodeid-green-1", TailnetIPs: []string{"1.2.3.4", "::1"}},
+	}
+	if diff := cmp.Diff(wantDevices, getPG().Status.Devices); diff != "" {
+		t.Errorf("unexpected devices (-want +got):\n%s", diff)
+	}
+}
+
+func TestProxyGroupHostnames(t *testing.T) {
+	pg := func(prefix tsapi.HostnamePrefix, tmpl string) *tsapi.ProxyGroup {
+		return &tsapi.ProxyGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "egress"},
+			Spec: tsapi.ProxyGroupSpec{
+				Replicas:         ptr.To[int32](3),
+				HostnamePrefix:   prefix,
+				HostnameTemplate: tmpl,
+			},
+		}
+	}
+	for _, tt := range []struct {
+		name    string
+		pg      *tsapi.ProxyGroup
+		set     tsapi.ProxyGroupSet
+		want    string
+		wantErr bool
+	}{
+		{name: "default", pg: pg("", ""), want: "egress-2"},
+		{name: "prefix", pg: pg("proxy-", ""), want: "proxy-2"},
+		{name: "template", pg: pg("", "{{name}}-prod-{{ordinal}}"), want: "egress-prod-2"},
+		{name: "template_green", pg: pg("", "{{name}}-prod-{{ordinal}}"), set: tsapi.ProxyGroupSetGreen, want: "egress-prod-2-green"},
+		{name: "template_without_ordinal", pg: pg("", "{{name}}-prod"), wantErr: true},
+		{name: "template_with_namespace", pg: pg("", "{{name}}-{{namespace}}-{{ordinal}}"), wantErr: true},
+		{name: "prefix_and_template", pg: pg("proxy-", "{{name}}-{{ordinal}}"), wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ProxyGroupReconciler{}
+			err := r.validate(tt.pg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected validation error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected validation error: %v", err)
+			}
+			set := tt.set
+			if set == "" {
+				set = tsapi.ProxyGroupSetBlue
+			}
+			if got := pgHostname(tt.pg, set, 2); got != tt.want {
+				t.Errorf("pgHostname() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func expectProxyGroupResources(t *testing.T, fc client.WithWatch, pg *tsapi.ProxyGroup, shouldExist bool, cfgHash string) {
 	t.Helper()
 
 	role := pgRole(pg, tsNamespace)
 	roleBinding := pgRoleBinding(pg, tsNamespace)
 	serviceAccount := pgServiceAccount(pg, tsNamespace)
-	statefulSet, err := pgStatefulSet(pg, tsNamespace, testProxyImage, "auto", cfgHash)
+	statefulSet, err := pgStatefulSet(pg, tsapi.ProxyGroupSetBlue, tsNamespace, testProxyImage, "auto", cfgHash)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -297,21 +559,24 @@ func expectSecrets(t *testing.T, fc client.WithWatch, expected []string) {
 
 func addNodeIDToStateSecrets(t *testing.T, fc client.WithWatch, pg *tsapi.ProxyGroup) {
 	const key = "profile-abc"
-	for i := range pgReplicas(pg) {
-		bytes, err := json.Marshal(map[string]any{
-			"Config": map[string]any{
-				"NodeID": fmt.Sprintf("nodeid-%d", i),
-			},
-		})
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		mustUpdate(t, fc, tsNamespace, fmt.Sprintf("test-%d", i), func(s *corev1.Secret) {
-			s.Data = map[string][]byte{
-				currentProfileKey: []byte(key),
-				key:               bytes,
+	for _, set := range pgSets(pg) {
+		for i := range pgReplicas(pg) {
+			name := fmt.Sprintf("%s-%d", pgSetName(pg.Name, set), i)
+			bytes, err := json.Marshal(map[string]any{
+				"Config": map[string]any{
+					"NodeID": strings.Replace(name, pg.Name, "nodeid", 1),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
 			}
-		})
+
+			mustUpdate(t, fc, tsNamespace, name, func(s *corev1.Secret) {
+				s.Data = map[string][]byte{
+					currentProfileKey: []byte(key),
+					key:               bytes,
+				}
+			})
+		}
 	}
 }
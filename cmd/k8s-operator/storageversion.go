@@ -0,0 +1,69 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// migrateStorageVersion ensures that all objects of the named CRD are stored
+// in etcd in the CRD's current storage version, and then removes the older
+// versions from the CRD's status.storedVersions, so that they can eventually
+// be removed from the CRD. This is the same migration that
+// kube-storage-version-migrator does: writing an object back unchanged makes
+// the API server re-encode it in the storage version.
+func migrateStorageVersion(ctx context.Context, cl client.Client, crdName string, logger *zap.SugaredLogger) error {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := cl.Get(ctx, client.ObjectKey{Name: crdName}, crd); apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error getting CRD: %w", err)
+	}
+	storageVersion := ""
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			storageVersion = v.Name
+		}
+	}
+	if storageVersion == "" {
+		return fmt.Errorf("CRD %s has no storage version", crdName)
+	}
+	if sv := crd.Status.StoredVersions; len(sv) == 1 && sv[0] == storageVersion {
+		return nil
+	}
+
+	logger.Infof("migrating stored %s from versions %v to %s", crd.Spec.Names.Plural, crd.Status.StoredVersions, storageVersion)
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   crd.Spec.Group,
+		Version: storageVersion,
+		Kind:    crd.Spec.Names.ListKind,
+	})
+	if err := cl.List(ctx, list); err != nil {
+		return fmt.Errorf("error listing %s: %w", crd.Spec.Names.Plural, err)
+	}
+	for _, obj := range list.Items {
+		// A conflict or not found means that the object has been
+		// written or deleted since it was listed, which migrates it too.
+		if err := cl.Update(ctx, &obj); err != nil && !apierrors.IsConflict(err) && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error migrating %s %s: %w", crd.Spec.Names.Kind, client.ObjectKeyFromObject(&obj), err)
+		}
+	}
+	crd.Status.StoredVersions = []string{storageVersion}
+	if err := cl.Status().Update(ctx, crd); err != nil {
+		return fmt.Errorf("error updating CRD stored versions: %w", err)
+	}
+	logger.Infof("migrated %d %s to %s", len(list.Items), crd.Spec.Names.Plural, storageVersion)
+	return nil
+}
@@ -17,6 +17,7 @@
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	appsv1 "k8s.io/api/apps/v1"
@@ -66,10 +67,41 @@
 	//MagicDNS name of tailnet node.
 	AnnotationTailnetTargetFQDN = "tailscale.com/tailnet-fqdn"
 
+	// AnnotationHostnameTemplate can be set on Services and Ingresses to a
+	// template for the proxy's tailnet hostname, such as
+	// "{{svc}}-{{namespace}}", see renderHostnameTemplate. It must not be
+	// set together with AnnotationHostname.
+	AnnotationHostnameTemplate = "tailscale.com/hostname-template"
+
 	AnnotationProxyGroup = "tailscale.com/proxy-group"
+	// AnnotationPreserveClientIP can be set on egress Services for
+	// ProxyGroups to pass the Pod IPs of cluster clients on to the tailnet
+	// target, either in a PROXY protocol header ("proxy-protocol") or in
+	// X-Forwarded-For headers ("http"). Only TCP ports are supported.
+	AnnotationPreserveClientIP = "tailscale.com/preserve-client-ip"
+	// AnnotationTailnetTargetFQDNResolution can be set to "per-connection"
+	// on egress Services for ProxyGroups that have a tailnet-fqdn
+	// annotation, to make the proxies resolve the MagicDNS name for each
+	// new connection instead of pinning the tailnet IPs it resolved to.
+	// This keeps working when the target's IPs change, e.g. for ephemeral
+	// nodes. Only TCP ports are supported.
+	AnnotationTailnetTargetFQDNResolution = "tailscale.com/tailnet-fqdn-resolution"
+	tailnetFQDNResolutionPerConnection    = "per-connection"
 
 	// Annotations settable by users on ingresses.
+	// AnnotationFunnel can also be set on Services to expose them to the
+	// internet via Funnel, see funnelServeConfig.
 	AnnotationFunnel = "tailscale.com/funnel"
+	// AnnotationFunnelURL is set by the operator on Services exposed via
+	// Funnel to their public URL, once the proxy has a TLS cert for it.
+	AnnotationFunnelURL = "tailscale.com/funnel-url"
+
+	// AnnotationForceResync can be set on Services, Ingresses and
+	// Connectors to force a full resync of their proxy: each time its value
+	// changes, the proxy's resources are re-applied and its Pods restarted,
+	// and if the proxy's device no longer exists in the tailnet, the proxy's
+	// state is reset so that it logs in as a new device.
+	AnnotationForceResync = "tailscale.com/force-resync"
 
 	// If set to true, set up iptables/nftables rules in the proxy forward
 	// cluster traffic to the tailnet IP of that proxy. This can only be set
@@ -95,6 +127,9 @@
 	podAnnotationLastSetTailnetTargetFQDN = "tailscale.com/operator-last-set-ts-tailnet-target-fqdn"
 	// podAnnotationLastSetConfigFileHash is sha256 hash of the current tailscaled configuration contents.
 	podAnnotationLastSetConfigFileHash = "tailscale.com/operator-last-set-config-file-hash"
+	// podAnnotationLastResync is the value of AnnotationForceResync on the
+	// proxy's parent resource as of the proxy's last forced resync.
+	podAnnotationLastResync = "tailscale.com/operator-last-resync"
 
 	proxyTypeEgress          = "egress_service"
 	proxyTypeIngressService  = "ingress_service"
@@ -107,7 +142,7 @@
 	// tailscaleManagedLabels are label keys that tailscale operator sets on StatefulSets and Pods.
 	tailscaleManagedLabels = []string{LabelManaged, LabelParentType, LabelParentName, LabelParentNamespace, "app"}
 	// tailscaleManagedAnnotations are annotation keys that tailscale operator sets on StatefulSets and Pods.
-	tailscaleManagedAnnotations = []string{podAnnotationLastSetClusterIP, podAnnotationLastSetTailnetTargetIP, podAnnotationLastSetTailnetTargetFQDN, podAnnotationLastSetConfigFileHash}
+	tailscaleManagedAnnotations = []string{podAnnotationLastSetClusterIP, podAnnotationLastSetTailnetTargetIP, podAnnotationLastSetTailnetTargetFQDN, podAnnotationLastSetConfigFileHash, podAnnotationLastResync}
 )
 
 type tailscaleSTSConfig struct {
@@ -138,6 +173,8 @@ type tailscaleSTSConfig struct {
 	ProxyClassName string // name of ProxyClass if one needs to be applied to the proxy
 
 	ProxyClass *tsapi.ProxyClass // ProxyClass that needs to be applied to the proxy (if there is one)
+
+	ResyncToken string // value of AnnotationForceResync on the parent resource, if any
 }
 
 type connector struct {
@@ -352,6 +389,7 @@ func (a *tailscaleSTSReconciler) createOrGetSecret(ctx context.Context, logger *
 	}
 
 	var authKey string
+	var reauth bool
 	if orig == nil {
 		// Initially it contains only tailscaled config, but when the
 		// proxy starts, it will also store there the state, certs and
@@ -366,6 +404,18 @@ func (a *tailscaleSTSReconciler) createOrGetSecret(ctx context.Context, logger *
 			logger.Errorf("Tailscale proxy secret doesn't exist, but the corresponding StatefulSet %s/%s already does. Something is wrong, please delete the StatefulSet.", sts.GetNamespace(), sts.GetName())
 			return "", "", nil, nil
 		}
+	} else {
+		var err error
+		if reauth, err = a.needsReauth(ctx, logger, stsC, orig); err != nil {
+			return "", "", nil, err
+		}
+		if reauth {
+			// Drop the proxy's state, so that it logs in again with
+			// the new auth key when its Pod restarts.
+			secret.Data = nil
+		}
+	}
+	if orig == nil || reauth {
 		// Create API Key secret which is going to be used by the statefulset
 		// to authenticate with Tailscale.
 		logger.Debugf("creating authkey for new tailscale proxy")
@@ -373,6 +423,7 @@ func (a *tailscaleSTSReconciler) createOrGetSecret(ctx context.Context, logger *
 		if len(tags) == 0 {
 			tags = a.defaultTags
 		}
+		var err error
 		authKey, err = newAuthKey(ctx, a.tsClient, tags)
 		if err != nil {
 			return "", "", nil, err
@@ -424,6 +475,36 @@ func (a *tailscaleSTSReconciler) createOrGetSecret(ctx context.Context, logger *
 	return secret.Name, hash, configs, nil
 }
 
+// needsReauth reports whether the proxy configured by stsC, whose existing
+// state Secret is sec, must log in as a new device as part of a forced resync.
+// That is the case if stsC requests a resync that the proxy hasn't had yet,
+// and the proxy's device no longer exists in the tailnet.
+func (a *tailscaleSTSReconciler) needsReauth(ctx context.Context, logger *zap.SugaredLogger, stsC *tailscaleSTSConfig, sec *corev1.Secret) (bool, error) {
+	if stsC.ResyncToken == "" {
+		return false, nil
+	}
+	ss, err := getSingleObject[appsv1.StatefulSet](ctx, a.Client, a.operatorNamespace, stsC.ChildResourceLabels)
+	if err != nil {
+		return false, err
+	}
+	if ss == nil || ss.Spec.Template.Annotations[podAnnotationLastResync] == stsC.ResyncToken {
+		return false, nil
+	}
+	id := string(sec.Data[kubetypes.KeyDeviceID])
+	if id == "" {
+		return false, nil
+	}
+	if _, err := a.tsClient.Device(ctx, id, nil); err != nil {
+		errResp := &tailscale.ErrResponse{}
+		if ok := errors.As(err, errResp); ok && errResp.Status == http.StatusNotFound {
+			logger.Infof("forced resync: device %s no longer exists in the tailnet, resetting proxy state", id)
+			return true, nil
+		}
+		return false, fmt.Errorf("error getting device %s: %w", id, err)
+	}
+	return false, nil
+}
+
 // sanitizeConfigBytes returns ipn.ConfigVAlpha in string form with redacted
 // auth key.
 func sanitizeConfigBytes(c ipn.ConfigVAlpha) string {
@@ -465,6 +546,10 @@ type device struct {
 	// ingressDNSName is the L7 Ingress DNS name. In practice this will be the same value as hostname, but only set
 	// when the device has been configured to serve traffic on it via 'tailscale serve'.
 	ingressDNSName string
+	// httpsCertDomain is the domain of the TLS cert that the device has issued for an endpoint exposed via
+	// Funnel, if any.
+	httpsCertDomain string
+	stats           *tsapi.ProxyStats // stats reported by the proxy, if any
 }
 
 func deviceInfo(sec *corev1.Secret, pod *corev1.Pod, log *zap.SugaredLogger) (dev *device, err error) {
@@ -493,6 +578,7 @@ func deviceInfo(sec *corev1.Secret, pod *corev1.Pod, log *zap.SugaredLogger) (de
 			dev.ingressDNSName = ""
 		}
 	}
+	dev.httpsCertDomain = strings.TrimSuffix(string(sec.Data[kubetypes.KeyHTTPSCertDomain]), ".")
 	if rawDeviceIPs, ok := sec.Data[kubetypes.KeyDeviceIPs]; ok {
 		ips := make([]string, 0)
 		if err := json.Unmarshal(rawDeviceIPs, &ips); err != nil {
@@ -500,14 +586,52 @@ func deviceInfo(sec *corev1.Secret, pod *corev1.Pod, log *zap.SugaredLogger) (de
 		}
 		dev.ips = ips
 	}
+	dev.stats = proxyStats(sec, log)
 	return dev, nil
 }
 
+// proxyStats returns the stats that a proxy has reported in its state Secret,
+// or nil if it has not reported any. The stats are informational only, so
+// malformed stats are logged and ignored.
+func proxyStats(sec *corev1.Secret, log *zap.SugaredLogger) *tsapi.ProxyStats {
+	b := sec.Data[kubetypes.KeyProxyStats]
+	if len(b) == 0 {
+		return nil
+	}
+	var ps kubetypes.ProxyStats
+	if err := json.Unmarshal(b, &ps); err != nil {
+		log.Infof("[unexpected] error unmarshalling proxy stats from Secret %s: %v", sec.Name, err)
+		return nil
+	}
+	stats := &tsapi.ProxyStats{
+		LastUpdated:    metav1.NewTime(ps.Time),
+		DERPHomeRegion: ps.DERPHomeRegion,
+		ActivePeers:    int32(ps.ActivePeers),
+		DirectPeers:    int32(ps.DirectPeers),
+		RxBytes:        ps.RxBytes,
+		TxBytes:        ps.TxBytes,
+		MemoryBytes:    ps.MemoryBytes,
+	}
+	if ps.ActivePeers > 0 {
+		stats.DirectConnectionRatio = fmt.Sprintf("%d%%", ps.DirectPeers*100/ps.ActivePeers)
+	}
+	if ps.LastNetmapUpdate != nil {
+		stats.LastNetmapUpdate = ptr.To(metav1.NewTime(*ps.LastNetmapUpdate))
+	}
+	return stats
+}
+
 func newAuthKey(ctx context.Context, tsClient tsClient, tags []string) (string, error) {
+	return createAuthKey(ctx, tsClient, tags, false)
+}
+
+// createAuthKey creates a pre-authorized auth key with the given tags, which
+// can be used to authenticate more than one device if reusable is true.
+func createAuthKey(ctx context.Context, tsClient tsClient, tags []string, reusable bool) (string, error) {
 	caps := tailscale.KeyCapabilities{
 		Devices: tailscale.KeyDeviceCapabilities{
 			Create: tailscale.KeyDeviceCreateCapabilities{
-				Reusable:      false,
+				Reusable:      reusable,
 				Preauthorized: true,
 				Tags:          tags,
 			},
@@ -586,6 +710,10 @@ func (a *tailscaleSTSReconciler) reconcileSTS(ctx context.Context, logger *zap.S
 	}
 	// Configure containeboot to run tailscaled with a configfile read from the state Secret.
 	mak.Set(&ss.Spec.Template.Annotations, podAnnotationLastSetConfigFileHash, tsConfigHash)
+	if sts.ResyncToken != "" {
+		// Restarts the proxy Pods each time a resync is forced.
+		mak.Set(&ss.Spec.Template.Annotations, podAnnotationLastResync, sts.ResyncToken)
+	}
 
 	configVolume := corev1.Volume{
 		Name: "tailscaledconfig",
@@ -1093,6 +1221,16 @@ func defaultBool(envName string, defVal bool) bool {
 	return v
 }
 
+// defaultDuration returns the duration in the environment variable envName,
+// or defVal if it's unset or not a valid duration.
+func defaultDuration(envName string, defVal time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(envName))
+	if err != nil {
+		return defVal
+	}
+	return d
+}
+
 func defaultEnv(envName, defVal string) string {
 	v := os.Getenv(envName)
 	if v == "" {
@@ -1105,6 +1243,11 @@ func nameForService(svc *corev1.Service) string {
 	if h, ok := svc.Annotations[AnnotationHostname]; ok {
 		return h
 	}
+	if tmpl, ok := svc.Annotations[AnnotationHostnameTemplate]; ok {
+		// Errors are surfaced by validateService.
+		h, _ := renderHostnameTemplate(tmpl, hostnameTemplateVars{name: svc.Name, namespace: svc.Namespace})
+		return h
+	}
 	return svc.Namespace + "-" + svc.Name
 }
 
@@ -9,6 +9,7 @@
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/netip"
 	"slices"
 	"strings"
@@ -23,13 +24,16 @@
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"tailscale.com/ipn"
 	tsoperator "tailscale.com/k8s-operator"
 	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
 	"tailscale.com/kube/kubetypes"
 	"tailscale.com/net/dns/resolvconffile"
 	"tailscale.com/tstime"
+	"tailscale.com/types/opt"
 	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/dnsname"
+	"tailscale.com/util/mak"
 	"tailscale.com/util/set"
 )
 
@@ -41,6 +45,8 @@
 	reasonProxyInvalid = "ProxyInvalid"
 	reasonProxyFailed  = "ProxyFailed"
 	reasonProxyPending = "ProxyPending"
+
+	reasonHostnameConflict = "HostnameConflict"
 )
 
 type ServiceReconciler struct {
@@ -65,6 +71,10 @@ type ServiceReconciler struct {
 	clock tstime.Clock
 
 	defaultProxyClass string
+
+	// hostnames tracks the tailnet hostnames of all proxies, to detect
+	// conflicts.
+	hostnames *hostnameIndex
 }
 
 var (
@@ -147,6 +157,7 @@ func (a *ServiceReconciler) maybeCleanup(ctx context.Context, logger *zap.Sugare
 	ix := slices.Index(svc.Finalizers, FinalizerName)
 	if ix < 0 {
 		logger.Debugf("no finalizer, nothing to do")
+		a.hostnames.release(hostnameOwner("Service", svc))
 		a.mu.Lock()
 		defer a.mu.Unlock()
 		a.managedIngressProxies.Remove(svc.UID)
@@ -157,7 +168,7 @@ func (a *ServiceReconciler) maybeCleanup(ctx context.Context, logger *zap.Sugare
 		if !a.isTailscaleService(svc) {
 			tsoperator.RemoveServiceCondition(svc, tsapi.ProxyReady)
 		}
-		return nil
+		return a.removeFunnelURL(ctx, svc)
 	}
 
 	proxyTyp := proxyTypeEgress
@@ -173,6 +184,7 @@ func (a *ServiceReconciler) maybeCleanup(ctx context.Context, logger *zap.Sugare
 	}
 
 	svc.Finalizers = append(svc.Finalizers[:ix], svc.Finalizers[ix+1:]...)
+	delete(svc.Annotations, AnnotationFunnelURL)
 	if err := a.Update(ctx, svc); err != nil {
 		return fmt.Errorf("failed to remove finalizer: %w", err)
 	}
@@ -183,6 +195,7 @@ func (a *ServiceReconciler) maybeCleanup(ctx context.Context, logger *zap.Sugare
 	// reconciles exit early.
 	logger.Infof("unexposed Service from tailnet")
 
+	a.hostnames.release(hostnameOwner("Service", svc))
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	a.managedIngressProxies.Remove(svc.UID)
@@ -255,6 +268,14 @@ func (a *ServiceReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 			return errMsg
 		}
 	}
+	hostname := nameForService(svc)
+	if err := a.hostnames.claim(hostnameOwner("Service", svc), svc.CreationTimestamp.Time, hostname); err != nil {
+		errMsg := fmt.Errorf("unable to provision proxy resources: %w", err)
+		a.recorder.Event(svc, corev1.EventTypeWarning, reasonHostnameConflict, errMsg.Error())
+		tsoperator.SetServiceCondition(svc, tsapi.ProxyReady, metav1.ConditionFalse, reasonHostnameConflict, errMsg.Error(), a.clock, logger)
+		return errMsg
+	}
+
 	crl := childResourceLabels(svc.Name, svc.Namespace, "svc")
 	var tags []string
 	if tstr, ok := svc.Annotations[AnnotationTags]; ok {
@@ -264,10 +285,11 @@ func (a *ServiceReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 	sts := &tailscaleSTSConfig{
 		ParentResourceName:  svc.Name,
 		ParentResourceUID:   string(svc.UID),
-		Hostname:            nameForService(svc),
+		Hostname:            hostname,
 		Tags:                tags,
 		ChildResourceLabels: crl,
 		ProxyClassName:      proxyClass,
+		ResyncToken:         svc.Annotations[AnnotationForceResync],
 	}
 	sts.proxyType = proxyTypeEgress
 	if a.shouldExpose(svc) {
@@ -275,7 +297,11 @@ func (a *ServiceReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 	}
 
 	a.mu.Lock()
-	if a.shouldExposeClusterIP(svc) {
+	if a.shouldExposeFunnel(svc) {
+		sts.ServeConfig = funnelServeConfig(svc)
+		a.managedIngressProxies.Add(svc.UID)
+		gaugeIngressProxies.Set(int64(a.managedIngressProxies.Len()))
+	} else if a.shouldExposeClusterIP(svc) {
 		sts.ClusterTargetIP = svc.Spec.ClusterIP
 		a.managedIngressProxies.Add(svc.UID)
 		gaugeIngressProxies.Set(int64(a.managedIngressProxies.Len()))
@@ -322,6 +348,15 @@ func (a *ServiceReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 		return nil
 	}
 
+	if sts.ServeConfig != nil { // if a Funnel proxy
+		return a.updateFunnelStatus(ctx, logger, svc, crl)
+	}
+	if err := a.removeFunnelURL(ctx, svc); err != nil {
+		errMsg := fmt.Errorf("failed to update service: %w", err)
+		tsoperator.SetServiceCondition(svc, tsapi.ProxyReady, metav1.ConditionFalse, reasonProxyFailed, errMsg.Error(), a.clock, logger)
+		return errMsg
+	}
+
 	if !isTailscaleLoadBalancerService(svc, a.isDefaultLoadBalancer) {
 		logger.Debugf("service is not a LoadBalancer, so not updating ingress")
 		tsoperator.SetServiceCondition(svc, tsapi.ProxyReady, metav1.ConditionTrue, reasonProxyCreated, reasonProxyCreated, a.clock, logger)
@@ -365,6 +400,110 @@ func (a *ServiceReconciler) maybeProvision(ctx context.Context, logger *zap.Suga
 	return nil
 }
 
+// updateFunnelStatus updates the status of svc, which is exposed via Funnel by
+// the proxy with child resource labels crl. Once the proxy has issued a TLS cert
+// for its DNS name, svc's AnnotationFunnelURL is set to its public URL.
+func (a *ServiceReconciler) updateFunnelStatus(ctx context.Context, logger *zap.SugaredLogger, svc *corev1.Service, crl map[string]string) error {
+	isLB := isTailscaleLoadBalancerService(svc, a.isDefaultLoadBalancer)
+	dev, err := a.ssr.DeviceInfo(ctx, crl, logger)
+	if err != nil {
+		return fmt.Errorf("failed to get device ID: %w", err)
+	}
+	if dev == nil || dev.ingressDNSName == "" {
+		msg := "no Funnel DNS name known yet, waiting for proxy Pod to start serving"
+		logger.Debug(msg)
+		if isLB {
+			svc.Status.LoadBalancer.Ingress = nil
+		}
+		tsoperator.SetServiceCondition(svc, tsapi.ProxyReady, metav1.ConditionFalse, reasonProxyPending, msg, a.clock, logger)
+		return nil
+	}
+	if !strings.EqualFold(dev.httpsCertDomain, dev.ingressDNSName) {
+		msg := fmt.Sprintf("waiting for proxy to issue a TLS cert for %s", dev.ingressDNSName)
+		logger.Debug(msg)
+		tsoperator.SetServiceCondition(svc, tsapi.ProxyReady, metav1.ConditionFalse, reasonProxyPending, msg, a.clock, logger)
+		return nil
+	}
+
+	url := "https://" + dev.ingressDNSName
+	if svc.Annotations[AnnotationFunnelURL] != url {
+		logger.Infof("Service exposed via Funnel at %s", url)
+		mak.Set(&svc.Annotations, AnnotationFunnelURL, url)
+		if err := a.Update(ctx, svc); err != nil {
+			errMsg := fmt.Errorf("failed to update service: %w", err)
+			tsoperator.SetServiceCondition(svc, tsapi.ProxyReady, metav1.ConditionFalse, reasonProxyFailed, errMsg.Error(), a.clock, logger)
+			return errMsg
+		}
+	}
+	if isLB {
+		svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{
+			Hostname: dev.ingressDNSName,
+			Ports:    []corev1.PortStatus{{Port: 443, Protocol: corev1.ProtocolTCP}},
+		}}
+	}
+	tsoperator.SetServiceCondition(svc, tsapi.ProxyReady, metav1.ConditionTrue, reasonProxyCreated, reasonProxyCreated, a.clock, logger)
+	return nil
+}
+
+// removeFunnelURL removes the AnnotationFunnelURL that the operator set on svc
+// when it was exposed via Funnel, if any.
+func (a *ServiceReconciler) removeFunnelURL(ctx context.Context, svc *corev1.Service) error {
+	if _, ok := svc.Annotations[AnnotationFunnelURL]; !ok {
+		return nil
+	}
+	delete(svc.Annotations, AnnotationFunnelURL)
+	return a.Update(ctx, svc)
+}
+
+// funnelServeConfig returns the serve config for a proxy that exposes svc to
+// the internet via Funnel. It serves HTTPS on port 443 at the proxy's MagicDNS
+// name, both to the internet and to the tailnet, reverse proxying to the
+// Service's port picked by funnelTargetPort.
+func funnelServeConfig(svc *corev1.Service) *ipn.ServeConfig {
+	port, _ := funnelTargetPort(svc)
+	proto := "http://"
+	if port.Port == 443 || port.Name == "https" {
+		proto = "https+insecure://"
+	}
+	return &ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{
+			443: {HTTPS: true},
+		},
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			magic443: {
+				Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Proxy: proto + net.JoinHostPort(svc.Spec.ClusterIP, fmt.Sprint(port.Port))},
+				},
+			},
+		},
+		AllowFunnel: map[ipn.HostPort]bool{
+			magic443: true,
+		},
+	}
+}
+
+// funnelTargetPort returns the port of svc that Funnel traffic is proxied to:
+// its TCP port named "https" or "http" if it has one, or else its first TCP
+// port. It reports false if svc has no TCP ports.
+func funnelTargetPort(svc *corev1.Service) (_ corev1.ServicePort, ok bool) {
+	var first *corev1.ServicePort
+	for i, p := range svc.Spec.Ports {
+		if p.Protocol != "" && p.Protocol != corev1.ProtocolTCP {
+			continue
+		}
+		if p.Name == "https" || p.Name == "http" {
+			return p, true
+		}
+		if first == nil {
+			first = &svc.Spec.Ports[i]
+		}
+	}
+	if first == nil {
+		return corev1.ServicePort{}, false
+	}
+	return *first, true
+}
+
 func validateService(svc *corev1.Service) []string {
 	violations := make([]string, 0)
 	if svc.Annotations[AnnotationTailnetTargetFQDN] != "" && svc.Annotations[AnnotationTailnetTargetIP] != "" {
@@ -383,6 +522,22 @@ func validateService(svc *corev1.Service) []string {
 			violations = append(violations, fmt.Sprintf("parsed IP address in annotation %s: %q is not valid", AnnotationTailnetTargetIP, ipStr))
 		}
 	}
+	if hasFunnelAnnotation(svc) {
+		if tailnetTargetAnnotation(svc) != "" || svc.Annotations[AnnotationTailnetTargetFQDN] != "" {
+			violations = append(violations, fmt.Sprintf("annotation %s cannot be set on egress Services", AnnotationFunnel))
+		} else if _, ok := funnelTargetPort(svc); !ok {
+			violations = append(violations, fmt.Sprintf("Service with annotation %s must have a TCP port", AnnotationFunnel))
+		}
+	}
+
+	if tmpl, ok := svc.Annotations[AnnotationHostnameTemplate]; ok {
+		if _, ok := svc.Annotations[AnnotationHostname]; ok {
+			violations = append(violations, fmt.Sprintf("only one of annotations %s and %s can be set", AnnotationHostname, AnnotationHostnameTemplate))
+		} else if _, err := renderHostnameTemplate(tmpl, hostnameTemplateVars{name: svc.Name, namespace: svc.Namespace}); err != nil {
+			violations = append(violations, err.Error())
+		}
+		return violations
+	}
 
 	svcName := nameForService(svc)
 	if err := dnsname.ValidLabel(svcName); err != nil {
@@ -399,6 +554,12 @@ func (a *ServiceReconciler) shouldExpose(svc *corev1.Service) bool {
 	return a.shouldExposeClusterIP(svc) || a.shouldExposeDNSName(svc)
 }
 
+// shouldExposeFunnel reports whether svc should be exposed to the internet via
+// Funnel, rather than only to the tailnet.
+func (a *ServiceReconciler) shouldExposeFunnel(svc *corev1.Service) bool {
+	return hasFunnelAnnotation(svc) && a.shouldExposeClusterIP(svc)
+}
+
 func (a *ServiceReconciler) shouldExposeDNSName(svc *corev1.Service) bool {
 	return hasExposeAnnotation(svc) && svc.Spec.Type == corev1.ServiceTypeExternalName && svc.Spec.ExternalName != ""
 }
@@ -407,7 +568,7 @@ func (a *ServiceReconciler) shouldExposeClusterIP(svc *corev1.Service) bool {
 	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == "None" {
 		return false
 	}
-	return isTailscaleLoadBalancerService(svc, a.isDefaultLoadBalancer) || hasExposeAnnotation(svc)
+	return isTailscaleLoadBalancerService(svc, a.isDefaultLoadBalancer) || hasExposeAnnotation(svc) || hasFunnelAnnotation(svc)
 }
 
 func isTailscaleLoadBalancerService(svc *corev1.Service, isDefaultLoadBalancer bool) bool {
@@ -423,6 +584,12 @@ func hasExposeAnnotation(svc *corev1.Service) bool {
 	return svc != nil && svc.Annotations[AnnotationExpose] == "true"
 }
 
+// hasFunnelAnnotation reports whether Service has the tailscale.com/funnel
+// annotation set.
+func hasFunnelAnnotation(svc *corev1.Service) bool {
+	return svc != nil && opt.Bool(svc.Annotations[AnnotationFunnel]).EqualBool(true)
+}
+
 // tailnetTargetAnnotation returns the value of tailscale.com/tailnet-ip
 // annotation or of the deprecated tailscale.com/ts-tailnet-target-ip
 // annotation. If neither is set, it returns an empty string. If both are set,
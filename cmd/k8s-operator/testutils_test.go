@@ -9,8 +9,10 @@
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/netip"
 	"reflect"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -468,6 +470,48 @@ func expectedServiceMonitor(t *testing.T, opts configOpts) *unstructured.Unstruc
 	return u
 }
 
+func expectedPodMonitor(t *testing.T, opts configOpts) *unstructured.Unstructured {
+	t.Helper()
+	labels := metricsLabels(opts)
+	name := metricsResourceName(opts.stsName)
+	relabelings := []RelabelConfig{{Action: "replace", TargetLabel: "ts_proxy_parent_name", Replacement: "test"}}
+	if opts.namespaced {
+		relabelings = append(relabelings, RelabelConfig{Action: "replace", TargetLabel: "ts_proxy_parent_namespace", Replacement: "default"})
+	}
+	relabelings = append(relabelings,
+		RelabelConfig{Action: "replace", TargetLabel: "ts_proxy_type", Replacement: opts.proxyType},
+		RelabelConfig{Action: "replace", TargetLabel: "job", Replacement: labels["ts_prom_job"]},
+	)
+	pm := &PodMonitor{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       opts.tailscaleNamespace,
+			Labels:          labels,
+			ResourceVersion: "1",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "Service", Name: name, BlockOwnerDeletion: ptr.To(true), Controller: ptr.To(true)}},
+		},
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodMonitor",
+			APIVersion: "monitoring.coreos.com/v1",
+		},
+		Spec: PodMonitorSpec{
+			Selector: metav1.LabelSelector{MatchLabels: expectedMetricsService(opts).Spec.Selector},
+			PodMetricsEndpoints: []PodMetricsEndpoint{{
+				Port:        "metrics",
+				Relabelings: relabelings,
+			}},
+			NamespaceSelector: ServiceMonitorNamespaceSelector{
+				MatchNames: []string{opts.tailscaleNamespace},
+			},
+		},
+	}
+	u, err := podMonitorToUnstructured(pm)
+	if err != nil {
+		t.Fatalf("error converting PodMonitor to unstructured: %v", err)
+	}
+	return u
+}
+
 func expectedSecret(t *testing.T, cl client.Client, opts configOpts) *corev1.Secret {
 	t.Helper()
 	s := &corev1.Secret{
@@ -730,6 +774,7 @@ type fakeTSClient struct {
 	sync.Mutex
 	keyRequests []tailscale.KeyCapabilities
 	deleted     []string
+	missing     []string // IDs of devices that Device reports as not found
 }
 type fakeTSNetServer struct {
 	certDomains []string
@@ -752,6 +797,11 @@ func (c *fakeTSClient) CreateKey(ctx context.Context, caps tailscale.KeyCapabili
 }
 
 func (c *fakeTSClient) Device(ctx context.Context, deviceID string, fields *tailscale.DeviceFieldsOpts) (*tailscale.Device, error) {
+	c.Lock()
+	defer c.Unlock()
+	if slices.Contains(c.missing, deviceID) {
+		return nil, tailscale.ErrResponse{Status: http.StatusNotFound, Message: "not found"}
+	}
 	return &tailscale.Device{
 		DeviceID: deviceID,
 		Hostname: "hostname-" + deviceID,
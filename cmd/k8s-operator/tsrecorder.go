@@ -13,6 +13,7 @@
 	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -38,12 +39,22 @@
 )
 
 const (
-	reasonRecorderCreationFailed = "RecorderCreationFailed"
-	reasonRecorderCreating       = "RecorderCreating"
-	reasonRecorderCreated        = "RecorderCreated"
-	reasonRecorderInvalid        = "RecorderInvalid"
+	reasonRecorderCreationFailed  = "RecorderCreationFailed"
+	reasonRecorderCreating        = "RecorderCreating"
+	reasonRecorderCreated         = "RecorderCreated"
+	reasonRecorderInvalid         = "RecorderInvalid"
+	reasonRecorderRetentionFailed = "RecorderRetentionFailed"
 
 	currentProfileKey = "_current-profile"
+
+	// annotationReusableAuthKey is set on a Recorder's auth Secret if the
+	// auth key it contains is reusable, so that it can be used by multiple
+	// replicas.
+	annotationReusableAuthKey = "tailscale.com/reusable-auth-key"
+
+	// recorderRetentionInterval is how often the operator enforces the
+	// retention policy of a Recorder's S3 storage.
+	recorderRetentionInterval = time.Hour
 )
 
 var gaugeRecorderResources = clientmetric.NewGauge(kubetypes.MetricRecorderCount)
@@ -58,6 +69,10 @@ type RecorderReconciler struct {
 	tsNamespace string
 	tsClient    tsClient
 
+	// newRecordingStore returns the storage backend for a Recorder's S3
+	// storage spec and the data of its credentials Secret.
+	newRecordingStore func(context.Context, *tsapi.S3, map[string][]byte) (recordingStore, error)
+
 	mu        sync.Mutex           // protects following
 	recorders set.Slice[types.UID] // for recorders gauge
 }
@@ -145,8 +160,12 @@ func (r *RecorderReconciler) Reconcile(ctx context.Context, req reconcile.Reques
 		return setStatusReady(tsr, metav1.ConditionFalse, reason, message)
 	}
 
+	requeueAfter := r.maybeEnforceRetention(ctx, tsr)
+
 	logger.Info("Recorder resources synced")
-	return setStatusReady(tsr, metav1.ConditionTrue, reasonRecorderCreated, reasonRecorderCreated)
+	res, err := setStatusReady(tsr, metav1.ConditionTrue, reasonRecorderCreated, reasonRecorderCreated)
+	res.RequeueAfter = requeueAfter
+	return res, err
 }
 
 func (r *RecorderReconciler) maybeProvision(ctx context.Context, tsr *tsapi.Recorder) error {
@@ -160,14 +179,15 @@ func (r *RecorderReconciler) maybeProvision(ctx context.Context, tsr *tsapi.Reco
 	if err := r.ensureAuthSecretCreated(ctx, tsr); err != nil {
 		return fmt.Errorf("error creating secrets: %w", err)
 	}
-	// State secret is precreated so we can use the Recorder CR as its owner ref.
-	sec := tsrStateSecret(tsr, r.tsNamespace)
-	if _, err := createOrUpdate(ctx, r.Client, r.tsNamespace, sec, func(s *corev1.Secret) {
-		s.ObjectMeta.Labels = sec.ObjectMeta.Labels
-		s.ObjectMeta.Annotations = sec.ObjectMeta.Annotations
-		s.ObjectMeta.OwnerReferences = sec.ObjectMeta.OwnerReferences
-	}); err != nil {
-		return fmt.Errorf("error creating state Secret: %w", err)
+	// State secrets are precreated so we can use the Recorder CR as their owner ref.
+	for _, sec := range tsrStateSecrets(tsr, r.tsNamespace) {
+		if _, err := createOrUpdate(ctx, r.Client, r.tsNamespace, sec, func(s *corev1.Secret) {
+			s.ObjectMeta.Labels = sec.ObjectMeta.Labels
+			s.ObjectMeta.Annotations = sec.ObjectMeta.Annotations
+			s.ObjectMeta.OwnerReferences = sec.ObjectMeta.OwnerReferences
+		}); err != nil {
+			return fmt.Errorf("error creating state Secret: %w", err)
+		}
 	}
 	sa := tsrServiceAccount(tsr, r.tsNamespace)
 	if _, err := createOrUpdate(ctx, r.Client, r.tsNamespace, sa, func(s *corev1.ServiceAccount) {
@@ -206,53 +226,59 @@ func (r *RecorderReconciler) maybeProvision(ctx context.Context, tsr *tsapi.Reco
 		return fmt.Errorf("error creating StatefulSet: %w", err)
 	}
 
-	var devices []tsapi.RecorderTailnetDevice
+	if err := r.cleanupDanglingResources(ctx, tsr); err != nil {
+		return fmt.Errorf("error cleaning up dangling resources: %w", err)
+	}
 
-	device, ok, err := r.getDeviceInfo(ctx, tsr.Name)
+	devices, err := r.getDeviceInfo(ctx, tsr)
 	if err != nil {
 		return fmt.Errorf("failed to get device info: %w", err)
 	}
-	if !ok {
-		logger.Debugf("no Tailscale hostname known yet, waiting for Recorder pod to finish auth")
-		return nil
+	if len(devices) == 0 {
+		logger.Debugf("no Tailscale hostname known yet, waiting for Recorder pods to finish auth")
 	}
-
-	devices = append(devices, device)
-
 	tsr.Status.Devices = devices
 
 	return nil
 }
 
-// maybeCleanup just deletes the device from the tailnet. All the kubernetes
+// cleanupDanglingResources deletes the devices and state Secrets of replicas
+// that no longer exist after the Recorder has been scaled down.
+func (r *RecorderReconciler) cleanupDanglingResources(ctx context.Context, tsr *tsapi.Recorder) error {
+	logger := r.logger(tsr.Name)
+	secrets, err := r.getStateSecrets(ctx, tsr)
+	if err != nil {
+		return err
+	}
+	for ordinal, secret := range secrets {
+		if ordinal < int(tsrReplicas(tsr)) {
+			continue
+		}
+		if err := r.deleteDevice(ctx, secret, logger); err != nil {
+			return err
+		}
+		logger.Infof("deleting state Secret %s of scaled down replica", secret.Name)
+		if err := r.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error deleting state Secret %s: %w", secret.Name, err)
+		}
+	}
+	return nil
+}
+
+// maybeCleanup just deletes the devices from the tailnet. All the kubernetes
 // resources linked to a Recorder will get cleaned up via owner references
 // (which we can use because they are all in the same namespace).
 func (r *RecorderReconciler) maybeCleanup(ctx context.Context, tsr *tsapi.Recorder) (bool, error) {
 	logger := r.logger(tsr.Name)
 
-	id, _, ok, err := r.getNodeMetadata(ctx, tsr.Name)
+	secrets, err := r.getStateSecrets(ctx, tsr)
 	if err != nil {
 		return false, err
 	}
-	if !ok {
-		logger.Debugf("state Secret %s-0 not found or does not contain node ID, continuing cleanup", tsr.Name)
-		r.mu.Lock()
-		r.recorders.Remove(tsr.UID)
-		gaugeRecorderResources.Set(int64(r.recorders.Len()))
-		r.mu.Unlock()
-		return true, nil
-	}
-
-	logger.Debugf("deleting device %s from control", string(id))
-	if err := r.tsClient.DeleteDevice(ctx, string(id)); err != nil {
-		errResp := &tailscale.ErrResponse{}
-		if ok := errors.As(err, errResp); ok && errResp.Status == http.StatusNotFound {
-			logger.Debugf("device %s not found, likely because it has already been deleted from control", string(id))
-		} else {
-			return false, fmt.Errorf("error deleting device: %w", err)
+	for _, secret := range secrets {
+		if err := r.deleteDevice(ctx, secret, logger); err != nil {
+			return false, err
 		}
-	} else {
-		logger.Debugf("device %s deleted from control", string(id))
 	}
 
 	// Unlike most log entries in the reconcile loop, this will get printed
@@ -267,73 +293,198 @@ func (r *RecorderReconciler) maybeCleanup(ctx context.Context, tsr *tsapi.Record
 	return true, nil
 }
 
+// deleteDevice deletes the device whose node state is stored in the given
+// state Secret from the tailnet, if any.
+func (r *RecorderReconciler) deleteDevice(ctx context.Context, secret *corev1.Secret, logger *zap.SugaredLogger) error {
+	id, _, ok, err := getNodeMetadata(ctx, secret)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		logger.Debugf("state Secret %s does not contain node ID, nothing to delete", secret.Name)
+		return nil
+	}
+
+	logger.Debugf("deleting device %s from control", string(id))
+	if err := r.tsClient.DeleteDevice(ctx, string(id)); err != nil {
+		errResp := &tailscale.ErrResponse{}
+		if ok := errors.As(err, errResp); ok && errResp.Status == http.StatusNotFound {
+			logger.Debugf("device %s not found, likely because it has already been deleted from control", string(id))
+		} else {
+			return fmt.Errorf("error deleting device: %w", err)
+		}
+	} else {
+		logger.Debugf("device %s deleted from control", string(id))
+	}
+	return nil
+}
+
 func (r *RecorderReconciler) ensureAuthSecretCreated(ctx context.Context, tsr *tsapi.Recorder) error {
 	logger := r.logger(tsr.Name)
 	key := types.NamespacedName{
 		Namespace: r.tsNamespace,
 		Name:      tsr.Name,
 	}
-	if err := r.Get(ctx, key, &corev1.Secret{}); err == nil {
-		// No updates, already created the auth key.
-		logger.Debugf("auth Secret %s already exists", key.Name)
-		return nil
+	// A single-use auth key can only be used by one replica, so a Recorder
+	// with more than one replica needs a reusable key.
+	reusable := tsrReplicas(tsr) > 1
+	existing := &corev1.Secret{}
+	if err := r.Get(ctx, key, existing); err == nil {
+		if !reusable || existing.Annotations[annotationReusableAuthKey] == "true" {
+			// No updates, already created the auth key.
+			logger.Debugf("auth Secret %s already exists", key.Name)
+			return nil
+		}
 	} else if !apierrors.IsNotFound(err) {
 		return err
+	} else {
+		existing = nil
 	}
 
 	// Create the auth key Secret which is going to be used by the StatefulSet
 	// to authenticate with Tailscale.
-	logger.Debugf("creating authkey for new Recorder")
+	logger.Debugf("creating authkey for Recorder")
 	tags := tsr.Spec.Tags
 	if len(tags) == 0 {
 		tags = tsapi.Tags{"tag:k8s"}
 	}
-	authKey, err := newAuthKey(ctx, r.tsClient, tags.Stringify())
+	authKey, err := createAuthKey(ctx, r.tsClient, tags.Stringify(), reusable)
 	if err != nil {
 		return err
 	}
 
+	secret := tsrAuthSecret(tsr, r.tsNamespace, authKey, reusable)
+	if existing != nil {
+		logger.Debug("replacing the Recorder's auth key with a reusable one")
+		existing.Annotations = secret.Annotations
+		existing.StringData = secret.StringData
+		return r.Update(ctx, existing)
+	}
 	logger.Debug("creating a new Secret for the Recorder")
-	if err := r.Create(ctx, tsrAuthSecret(tsr, r.tsNamespace, authKey)); err != nil {
+	if err := r.Create(ctx, secret); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (r *RecorderReconciler) validate(tsr *tsapi.Recorder) error {
-	if !tsr.Spec.EnableUI && tsr.Spec.Storage.S3 == nil {
-		return errors.New("must either enable UI or use S3 storage to ensure recordings are accessible")
+// maybeEnforceRetention deletes the recordings that are past the retention
+// period of the Recorder's S3 storage, if one is configured, and updates the
+// Recorder's storage status. It does so at most once every
+// recorderRetentionInterval and returns the time after which it should be
+// called again. Errors are surfaced as events and in the storage status
+// rather than failing the reconcile, as the Recorder itself is unaffected.
+func (r *RecorderReconciler) maybeEnforceRetention(ctx context.Context, tsr *tsapi.Recorder) time.Duration {
+	logger := r.logger(tsr.Name)
+	s3 := tsr.Spec.Storage.S3
+	if s3 == nil || s3.Retention == nil {
+		tsr.Status.Storage = nil
+		return 0
+	}
+	now := r.clock.Now()
+	if st := tsr.Status.Storage; st != nil && st.LastRetentionTime != nil {
+		if next := st.LastRetentionTime.Add(recorderRetentionInterval); now.Before(next) {
+			return next.Sub(now)
+		}
 	}
 
-	return nil
+	st, err := r.enforceRetention(ctx, tsr, now)
+	if err != nil {
+		message := fmt.Sprintf("failed to enforce recording retention policy: %s", err)
+		logger.Info(message)
+		r.recorder.Eventf(tsr, corev1.EventTypeWarning, reasonRecorderRetentionFailed, message)
+	}
+	if st != nil {
+		tsr.Status.Storage = st
+	}
+	return recorderRetentionInterval
 }
 
-func (r *RecorderReconciler) getStateSecret(ctx context.Context, tsrName string) (*corev1.Secret, error) {
-	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: r.tsNamespace,
-			Name:      fmt.Sprintf("%s-0", tsrName),
-		},
-	}
-	if err := r.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
-		if apierrors.IsNotFound(err) {
-			return nil, nil
+func (r *RecorderReconciler) enforceRetention(ctx context.Context, tsr *tsapi.Recorder, now time.Time) (*tsapi.RecorderStorageStatus, error) {
+	s3 := tsr.Spec.Storage.S3
+	var creds map[string][]byte
+	if name := s3.Credentials.Secret.Name; name != "" {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: r.tsNamespace, Name: name}, secret); err != nil {
+			return nil, fmt.Errorf("error getting S3 credentials Secret %s: %w", name, err)
 		}
+		creds = secret.Data
+	}
+	store, err := r.newRecordingStore(ctx, s3, creds)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := store.listRecordings(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		return nil, fmt.Errorf("error getting state Secret: %w", err)
+	cutoff := now.Add(-time.Duration(s3.Retention.Days) * 24 * time.Hour)
+	st := &tsapi.RecorderStorageStatus{LastRetentionTime: &metav1.Time{Time: now}}
+	var expired []recording
+	for _, rec := range recs {
+		if rec.lastModified.Before(cutoff) {
+			expired = append(expired, rec)
+			continue
+		}
+		addRecording(st, rec)
+	}
+	if len(expired) == 0 {
+		return st, nil
+	}
+	keys := make([]string, 0, len(expired))
+	for _, rec := range expired {
+		keys = append(keys, rec.key)
+	}
+	if err := store.deleteRecordings(ctx, keys); err != nil {
+		// Some recordings may have been deleted, but they'll be accounted
+		// for on the next run.
+		for _, rec := range expired {
+			addRecording(st, rec)
+		}
+		st.Backlog = int64(len(expired))
+		return st, err
 	}
+	r.logger(tsr.Name).Infof("deleted %d recordings older than %d days", len(expired), s3.Retention.Days)
+	return st, nil
+}
 
-	return secret, nil
+func addRecording(st *tsapi.RecorderStorageStatus, rec recording) {
+	st.Recordings++
+	st.Bytes += rec.size
+	if st.OldestRecordingTime == nil || rec.lastModified.Before(st.OldestRecordingTime.Time) {
+		st.OldestRecordingTime = &metav1.Time{Time: rec.lastModified}
+	}
 }
 
-func (r *RecorderReconciler) getNodeMetadata(ctx context.Context, tsrName string) (id tailcfg.StableNodeID, dnsName string, ok bool, err error) {
-	secret, err := r.getStateSecret(ctx, tsrName)
-	if err != nil || secret == nil {
-		return "", "", false, err
+func (r *RecorderReconciler) validate(tsr *tsapi.Recorder) error {
+	if !tsr.Spec.EnableUI && tsr.Spec.Storage.S3 == nil {
+		return errors.New("must either enable UI or use S3 storage to ensure recordings are accessible")
+	}
+	if s3 := tsr.Spec.Storage.S3; s3 != nil && s3.Retention != nil && s3.Retention.Days < 1 {
+		return errors.New("S3 retention period must be at least 1 day")
 	}
 
-	return getNodeMetadata(ctx, secret)
+	return nil
+}
+
+// getStateSecrets returns the state Secrets of the Recorder's replicas,
+// keyed by replica ordinal. This includes the Secrets of replicas that no
+// longer exist if the Recorder has been scaled down.
+func (r *RecorderReconciler) getStateSecrets(ctx context.Context, tsr *tsapi.Recorder) (map[int]*corev1.Secret, error) {
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.InNamespace(r.tsNamespace), client.MatchingLabels(labels("recorder", tsr.Name, nil))); err != nil {
+		return nil, fmt.Errorf("failed to list state Secrets: %w", err)
+	}
+	m := make(map[int]*corev1.Secret)
+	for i, secret := range secrets.Items {
+		ordinal, ok := tsrStateSecretOrdinal(tsr.Name, secret.Name)
+		if !ok {
+			continue // the auth Secret
+		}
+		m[ordinal] = &secrets.Items[i]
+	}
+	return m, nil
 }
 
 // getNodeMetadata returns 'ok == true' iff the node ID is found. The dnsName
@@ -357,13 +508,29 @@ func getNodeMetadata(ctx context.Context, secret *corev1.Secret) (id tailcfg.Sta
 	return tailcfg.StableNodeID(profile.Config.NodeID), profile.Config.UserProfile.LoginName, ok, nil
 }
 
-func (r *RecorderReconciler) getDeviceInfo(ctx context.Context, tsrName string) (d tsapi.RecorderTailnetDevice, ok bool, err error) {
-	secret, err := r.getStateSecret(ctx, tsrName)
-	if err != nil || secret == nil {
-		return tsapi.RecorderTailnetDevice{}, false, err
+// getDeviceInfo returns the tailnet devices of the Recorder's replicas that
+// have finished auth, ordered by replica ordinal.
+func (r *RecorderReconciler) getDeviceInfo(ctx context.Context, tsr *tsapi.Recorder) (devices []tsapi.RecorderTailnetDevice, _ error) {
+	secrets, err := r.getStateSecrets(ctx, tsr)
+	if err != nil {
+		return nil, err
+	}
+	for ordinal := range int(tsrReplicas(tsr)) {
+		secret, ok := secrets[ordinal]
+		if !ok {
+			continue
+		}
+		device, ok, err := getDeviceInfo(ctx, r.tsClient, secret)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		devices = append(devices, device)
 	}
 
-	return getDeviceInfo(ctx, r.tsClient, secret)
+	return devices, nil
 }
 
 func getDeviceInfo(ctx context.Context, tsClient tsClient, secret *corev1.Secret) (d tsapi.RecorderTailnetDevice, ok bool, err error) {
@@ -7,6 +7,8 @@
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -27,7 +29,7 @@ func tsrStatefulSet(tsr *tsapi.Recorder, namespace string) *appsv1.StatefulSet {
 			Annotations:     tsr.Spec.StatefulSet.Annotations,
 		},
 		Spec: appsv1.StatefulSetSpec{
-			Replicas: ptr.To[int32](1),
+			Replicas: ptr.To(tsrReplicas(tsr)),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels("recorder", tsr.Name, tsr.Spec.StatefulSet.Pod.Labels),
 			},
@@ -125,10 +127,13 @@ func tsrRole(tsr *tsapi.Recorder, namespace string) *rbacv1.Role {
 					"patch",
 					"update",
 				},
-				ResourceNames: []string{
-					tsr.Name,                      // Contains the auth key.
-					fmt.Sprintf("%s-0", tsr.Name), // Contains the node state.
-				},
+				ResourceNames: func() []string {
+					names := []string{tsr.Name} // Contains the auth key.
+					for _, s := range tsrStateSecrets(tsr, namespace) {
+						names = append(names, s.Name) // Contains the node state.
+					}
+					return names
+				}(),
 			},
 			{
 				APIGroups: []string{""},
@@ -165,12 +170,17 @@ func tsrRoleBinding(tsr *tsapi.Recorder, namespace string) *rbacv1.RoleBinding {
 	}
 }
 
-func tsrAuthSecret(tsr *tsapi.Recorder, namespace string, authKey string) *corev1.Secret {
+func tsrAuthSecret(tsr *tsapi.Recorder, namespace string, authKey string, reusable bool) *corev1.Secret {
+	var annotations map[string]string
+	if reusable {
+		annotations = map[string]string{annotationReusableAuthKey: "true"}
+	}
 	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace:       namespace,
 			Name:            tsr.Name,
 			Labels:          labels("recorder", tsr.Name, nil),
+			Annotations:     annotations,
 			OwnerReferences: tsrOwnerReference(tsr),
 		},
 		StringData: map[string]string{
@@ -179,15 +189,42 @@ func tsrAuthSecret(tsr *tsapi.Recorder, namespace string, authKey string) *corev
 	}
 }
 
-func tsrStateSecret(tsr *tsapi.Recorder, namespace string) *corev1.Secret {
-	return &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:            fmt.Sprintf("%s-0", tsr.Name),
-			Namespace:       namespace,
-			Labels:          labels("recorder", tsr.Name, nil),
-			OwnerReferences: tsrOwnerReference(tsr),
-		},
+// tsrStateSecrets returns the state Secrets for each of the Recorder's
+// replicas. They are named after the replicas' Pods.
+func tsrStateSecrets(tsr *tsapi.Recorder, namespace string) (secrets []*corev1.Secret) {
+	for i := range tsrReplicas(tsr) {
+		secrets = append(secrets, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            fmt.Sprintf("%s-%d", tsr.Name, i),
+				Namespace:       namespace,
+				Labels:          labels("recorder", tsr.Name, nil),
+				OwnerReferences: tsrOwnerReference(tsr),
+			},
+		})
+	}
+	return secrets
+}
+
+// tsrStateSecretOrdinal returns the replica ordinal of the Recorder's state
+// Secret with the given name. It returns false if the name is not that of a
+// state Secret.
+func tsrStateSecretOrdinal(tsrName, secretName string) (int, bool) {
+	suffix, ok := strings.CutPrefix(secretName, tsrName+"-")
+	if !ok {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(suffix)
+	if err != nil || ordinal < 0 || strconv.Itoa(ordinal) != suffix {
+		return 0, false
+	}
+	return ordinal, true
+}
+
+func tsrReplicas(tsr *tsapi.Recorder) int32 {
+	if tsr.Spec.Replicas == nil {
+		return 1
 	}
+	return *tsr.Spec.Replicas
 }
 
 func env(tsr *tsapi.Recorder) []corev1.EnvVar {
@@ -141,3 +141,25 @@ func TestRecorderSpecs(t *testing.T) {
 		}
 	})
 }
+
+func TestRecorderStateSecretOrdinal(t *testing.T) {
+	tests := []struct {
+		name    string
+		ordinal int
+		ok      bool
+	}{
+		{"test-0", 0, true},
+		{"test-12", 12, true},
+		{"test", 0, false},
+		{"test-", 0, false},
+		{"test-01", 0, false},
+		{"test-foo-0", 0, false},
+		{"other-0", 0, false},
+	}
+	for _, tt := range tests {
+		ordinal, ok := tsrStateSecretOrdinal("test", tt.name)
+		if ordinal != tt.ordinal || ok != tt.ok {
+			t.Errorf("tsrStateSecretOrdinal(%q) = %d, %t; want %d, %t", tt.name, ordinal, ok, tt.ordinal, tt.ok)
+		}
+	}
+}
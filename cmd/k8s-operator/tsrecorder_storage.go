@@ -0,0 +1,132 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
+)
+
+// s3DeleteBatchSize is the maximum number of objects that can be deleted
+// with a single DeleteObjects request.
+const s3DeleteBatchSize = 1000
+
+// recording is a session recording stored by a Recorder.
+type recording struct {
+	key          string
+	size         int64
+	lastModified time.Time
+}
+
+// recordingStore is the storage backend of a Recorder, used by the operator
+// to enforce retention policies.
+type recordingStore interface {
+	// listRecordings returns all recordings in the store.
+	listRecordings(context.Context) ([]recording, error)
+	// deleteRecordings deletes the recordings with the given keys.
+	deleteRecordings(ctx context.Context, keys []string) error
+}
+
+// newS3RecordingStore returns a recordingStore for the bucket configured in
+// the Recorder's S3 storage spec. creds is the data of the Recorder's S3
+// credentials Secret, if any. Static credentials and region are read from
+// the same environment variable names that tsrecorder uses; without them,
+// the operator's own AWS credentials are used.
+func newS3RecordingStore(ctx context.Context, spec *tsapi.S3, creds map[string][]byte) (recordingStore, error) {
+	var opts []func(*config.LoadOptions) error
+	if region := string(creds["AWS_REGION"]); region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	if id := string(creds["AWS_ACCESS_KEY_ID"]); id != "" {
+		staticCreds := aws.Credentials{
+			AccessKeyID:     id,
+			SecretAccessKey: string(creds["AWS_SECRET_ACCESS_KEY"]),
+			SessionToken:    string(creds["AWS_SESSION_TOKEN"]),
+			Source:          "RecorderCredentialsSecret",
+		}
+		opts = append(opts, config.WithCredentialsProvider(aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return staticCreds, nil
+		})))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		// S3-compatible APIs generally ignore the region, but the SDK
+		// requires one to sign requests.
+		cfg.Region = "us-east-1"
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if spec.Endpoint == "" {
+			return
+		}
+		endpoint := spec.Endpoint
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "https://" + endpoint
+		}
+		o.EndpointResolver = s3.EndpointResolverFromURL(endpoint)
+		o.UsePathStyle = true
+	})
+	return &s3RecordingStore{client: client, bucket: spec.Bucket}, nil
+}
+
+type s3RecordingStore struct {
+	client *s3.Client
+	bucket string
+}
+
+func (s *s3RecordingStore) listRecordings(ctx context.Context) ([]recording, error) {
+	var recs []recording
+	p := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing objects in bucket %q: %w", s.bucket, err)
+		}
+		for _, obj := range page.Contents {
+			recs = append(recs, recording{
+				key:          aws.ToString(obj.Key),
+				size:         obj.Size,
+				lastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return recs, nil
+}
+
+func (s *s3RecordingStore) deleteRecordings(ctx context.Context, keys []string) error {
+	for len(keys) > 0 {
+		batch := keys[:min(len(keys), s3DeleteBatchSize)]
+		keys = keys[len(batch):]
+		objs := make([]s3types.ObjectIdentifier, 0, len(batch))
+		for _, k := range batch {
+			objs = append(objs, s3types.ObjectIdentifier{Key: aws.String(k)})
+		}
+		out, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &s3types.Delete{Objects: objs, Quiet: true},
+		})
+		if err != nil {
+			return fmt.Errorf("error deleting objects from bucket %q: %w", s.bucket, err)
+		}
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("error deleting %d objects from bucket %q, first error for %q: %s: %s", len(out.Errors), s.bucket, aws.ToString(e.Key), aws.ToString(e.Code), aws.ToString(e.Message))
+		}
+	}
+	return nil
+}
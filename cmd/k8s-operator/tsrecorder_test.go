@@ -8,7 +8,10 @@
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"go.uber.org/zap"
@@ -16,12 +19,15 @@
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	tsoperator "tailscale.com/k8s-operator"
 	tsapi "tailscale.com/k8s-operator/apis/v1alpha1"
 	"tailscale.com/tstest"
+	"tailscale.com/types/ptr"
 )
 
 const tsNamespace = "tailscale"
@@ -84,26 +90,35 @@ func TestRecorder(t *testing.T) {
 	})
 
 	t.Run("populate node info in state secret, and see it appear in status", func(t *testing.T) {
-		bytes, err := json.Marshal(map[string]any{
-			"Config": map[string]any{
-				"NodeID": "nodeid-123",
-				"UserProfile": map[string]any{
-					"LoginName": "test-0.example.ts.net",
-				},
+		setRecorderNodeState(t, fc, "test-0", "nodeid-123")
+
+		expectReconciled(t, reconciler, "", tsr.Name)
+		tsr.Status.Devices = []tsapi.RecorderTailnetDevice{
+			{
+				Hostname:   "hostname-nodeid-123",
+				TailnetIPs: []string{"1.2.3.4", "::1"},
+				URL:        "https://test-0.example.ts.net",
 			},
-		})
-		if err != nil {
-			t.Fatal(err)
 		}
+		expectEqual(t, fc, tsr, nil)
+	})
 
-		const key = "profile-abc"
-		mustUpdate(t, fc, tsNamespace, "test-0", func(s *corev1.Secret) {
-			s.Data = map[string][]byte{
-				currentProfileKey: []byte(key),
-				key:               bytes,
-			}
+	t.Run("scale up and observe a reusable auth key and devices for all replicas", func(t *testing.T) {
+		tsr.Spec.Replicas = ptr.To[int32](2)
+		mustUpdate(t, fc, "", "test", func(t *tsapi.Recorder) {
+			t.Spec = tsr.Spec
 		})
 
+		expectReconciled(t, reconciler, "", tsr.Name)
+		expectEqual(t, fc, tsrAuthSecret(tsr, tsNamespace, "secret-authkey", true), nil)
+		expectEqual(t, fc, tsrStateSecrets(tsr, tsNamespace)[1], nil)
+		expectEqual(t, fc, tsrRole(tsr, tsNamespace), nil)
+		expectEqual(t, fc, tsrStatefulSet(tsr, tsNamespace), nil)
+		if keyReq := tsClient.KeyRequests(); len(keyReq) != 2 || !keyReq[1].Devices.Create.Reusable {
+			t.Fatalf("expected a second, reusable auth key to be created, got key requests %+v", keyReq)
+		}
+
+		setRecorderNodeState(t, fc, "test-1", "nodeid-456")
 		expectReconciled(t, reconciler, "", tsr.Name)
 		tsr.Status.Devices = []tsapi.RecorderTailnetDevice{
 			{
@@ -111,10 +126,30 @@ func TestRecorder(t *testing.T) {
 				TailnetIPs: []string{"1.2.3.4", "::1"},
 				URL:        "https://test-0.example.ts.net",
 			},
+			{
+				Hostname:   "hostname-nodeid-456",
+				TailnetIPs: []string{"1.2.3.4", "::1"},
+				URL:        "https://test-1.example.ts.net",
+			},
 		}
 		expectEqual(t, fc, tsr, nil)
 	})
 
+	t.Run("scale down and observe the removed replica's device cleaned up", func(t *testing.T) {
+		tsr.Spec.Replicas = ptr.To[int32](1)
+		mustUpdate(t, fc, "", "test", func(t *tsapi.Recorder) {
+			t.Spec = tsr.Spec
+		})
+
+		expectReconciled(t, reconciler, "", tsr.Name)
+		expectMissing[corev1.Secret](t, fc, tsNamespace, "test-1")
+		if diff := cmp.Diff(tsClient.deleted, []string{"nodeid-456"}); diff != "" {
+			t.Fatalf("unexpected deleted devices (-got +want):\n%s", diff)
+		}
+		tsr.Status.Devices = tsr.Status.Devices[:1]
+		expectEqual(t, fc, tsr, nil)
+	})
+
 	t.Run("delete the Recorder and observe cleanup", func(t *testing.T) {
 		if err := fc.Delete(context.Background(), tsr); err != nil {
 			t.Fatal(err)
@@ -126,7 +161,7 @@ func TestRecorder(t *testing.T) {
 		if expected := 0; reconciler.recorders.Len() != expected {
 			t.Fatalf("expected %d recorders, got %d", expected, reconciler.recorders.Len())
 		}
-		if diff := cmp.Diff(tsClient.deleted, []string{"nodeid-123"}); diff != "" {
+		if diff := cmp.Diff(tsClient.deleted, []string{"nodeid-456", "nodeid-123"}); diff != "" {
 			t.Fatalf("unexpected deleted devices (-got +want):\n%s", diff)
 		}
 		// The fake client does not clean up objects whose owner has been
@@ -137,8 +172,8 @@ func TestRecorder(t *testing.T) {
 func expectRecorderResources(t *testing.T, fc client.WithWatch, tsr *tsapi.Recorder, shouldExist bool) {
 	t.Helper()
 
-	auth := tsrAuthSecret(tsr, tsNamespace, "secret-authkey")
-	state := tsrStateSecret(tsr, tsNamespace)
+	auth := tsrAuthSecret(tsr, tsNamespace, "secret-authkey", tsrReplicas(tsr) > 1)
+	states := tsrStateSecrets(tsr, tsNamespace)
 	role := tsrRole(tsr, tsNamespace)
 	roleBinding := tsrRoleBinding(tsr, tsNamespace)
 	serviceAccount := tsrServiceAccount(tsr, tsNamespace)
@@ -146,17 +181,192 @@ func expectRecorderResources(t *testing.T, fc client.WithWatch, tsr *tsapi.Recor
 
 	if shouldExist {
 		expectEqual(t, fc, auth, nil)
-		expectEqual(t, fc, state, nil)
+		for _, state := range states {
+			expectEqual(t, fc, state, nil)
+		}
 		expectEqual(t, fc, role, nil)
 		expectEqual(t, fc, roleBinding, nil)
 		expectEqual(t, fc, serviceAccount, nil)
 		expectEqual(t, fc, statefulSet, nil)
 	} else {
 		expectMissing[corev1.Secret](t, fc, auth.Namespace, auth.Name)
-		expectMissing[corev1.Secret](t, fc, state.Namespace, state.Name)
+		for _, state := range states {
+			expectMissing[corev1.Secret](t, fc, state.Namespace, state.Name)
+		}
 		expectMissing[rbacv1.Role](t, fc, role.Namespace, role.Name)
 		expectMissing[rbacv1.RoleBinding](t, fc, roleBinding.Namespace, roleBinding.Name)
 		expectMissing[corev1.ServiceAccount](t, fc, serviceAccount.Namespace, serviceAccount.Name)
 		expectMissing[appsv1.StatefulSet](t, fc, statefulSet.Namespace, statefulSet.Name)
 	}
 }
+
+// setRecorderNodeState writes the node state a Recorder replica would write
+// after auth to its state Secret.
+func setRecorderNodeState(t *testing.T, fc client.Client, secretName, nodeID string) {
+	t.Helper()
+	bytes, err := json.Marshal(map[string]any{
+		"Config": map[string]any{
+			"NodeID": nodeID,
+			"UserProfile": map[string]any{
+				"LoginName": secretName + ".example.ts.net",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const key = "profile-abc"
+	mustUpdate(t, fc, tsNamespace, secretName, func(s *corev1.Secret) {
+		s.Data = map[string][]byte{
+			currentProfileKey: []byte(key),
+			key:               bytes,
+		}
+	})
+}
+
+func TestRecorderRetention(t *testing.T) {
+	tsr := &tsapi.Recorder{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test",
+			Finalizers: []string{"tailscale.com/finalizer"},
+		},
+		Spec: tsapi.RecorderSpec{
+			Storage: tsapi.Storage{
+				S3: &tsapi.S3{
+					Endpoint: "minio.example.com",
+					Bucket:   "recordings",
+					Credentials: tsapi.S3Credentials{
+						Secret: tsapi.S3Secret{Name: "s3-creds"},
+					},
+					Retention: &tsapi.S3Retention{Days: 7},
+				},
+			},
+		},
+	}
+	creds := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3-creds", Namespace: tsNamespace},
+		Data:       map[string][]byte{"AWS_ACCESS_KEY_ID": []byte("foo")},
+	}
+	fc := fake.NewClientBuilder().
+		WithScheme(tsapi.GlobalScheme).
+		WithObjects(tsr, creds).
+		WithStatusSubresource(tsr).
+		Build()
+	zl, _ := zap.NewDevelopment()
+	fr := record.NewFakeRecorder(1)
+	// Status timestamps are serialized with second precision.
+	cl := tstest.NewClock(tstest.ClockOpts{Start: time.Now().Truncate(time.Second)})
+	now := cl.Now()
+	store := &fakeRecordingStore{
+		recs: []recording{
+			{key: "old", size: 100, lastModified: now.Add(-8 * 24 * time.Hour)},
+			{key: "older", size: 200, lastModified: now.Add(-30 * 24 * time.Hour)},
+			{key: "new", size: 300, lastModified: now.Add(-time.Hour)},
+			{key: "newer", size: 400, lastModified: now.Add(-time.Minute)},
+		},
+	}
+	reconciler := &RecorderReconciler{
+		tsNamespace: tsNamespace,
+		Client:      fc,
+		tsClient:    &fakeTSClient{},
+		recorder:    fr,
+		l:           zl.Sugar(),
+		clock:       cl,
+		newRecordingStore: func(_ context.Context, s3 *tsapi.S3, gotCreds map[string][]byte) (recordingStore, error) {
+			if s3.Bucket != "recordings" {
+				t.Errorf("unexpected bucket %q", s3.Bucket)
+			}
+			if diff := cmp.Diff(gotCreds, creds.Data); diff != "" {
+				t.Errorf("unexpected credentials (-got +want):\n%s", diff)
+			}
+			return store, nil
+		},
+	}
+
+	reconcileRequeueAfter := func(t *testing.T) time.Duration {
+		t.Helper()
+		res, err := reconciler.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: tsr.Name}})
+		if err != nil {
+			t.Fatalf("Reconcile: unexpected error: %v", err)
+		}
+		return res.RequeueAfter
+	}
+
+	t.Run("expired recordings are deleted", func(t *testing.T) {
+		if got := reconcileRequeueAfter(t); got != recorderRetentionInterval {
+			t.Errorf("expected requeue after %v, got %v", recorderRetentionInterval, got)
+		}
+		if diff := cmp.Diff(store.keys(), []string{"new", "newer"}); diff != "" {
+			t.Fatalf("unexpected remaining recordings (-got +want):\n%s", diff)
+		}
+		mustGetStorageStatus(t, fc, &tsapi.RecorderStorageStatus{
+			Recordings:          2,
+			Bytes:               700,
+			OldestRecordingTime: &metav1.Time{Time: now.Add(-time.Hour)},
+			LastRetentionTime:   &metav1.Time{Time: now},
+		})
+	})
+
+	t.Run("retention is not enforced again within the interval", func(t *testing.T) {
+		store.recs = append(store.recs, recording{key: "expired", lastModified: now.Add(-10 * 24 * time.Hour)})
+		cl.Advance(time.Minute)
+		if got, want := reconcileRequeueAfter(t), recorderRetentionInterval-time.Minute; got != want {
+			t.Errorf("expected requeue after %v, got %v", want, got)
+		}
+		if diff := cmp.Diff(store.keys(), []string{"new", "newer", "expired"}); diff != "" {
+			t.Fatalf("unexpected remaining recordings (-got +want):\n%s", diff)
+		}
+	})
+
+	t.Run("failed deletions are reported as backlog", func(t *testing.T) {
+		store.deleteErr = errors.New("access denied")
+		cl.Advance(recorderRetentionInterval)
+		reconcileRequeueAfter(t)
+		mustGetStorageStatus(t, fc, &tsapi.RecorderStorageStatus{
+			Recordings:          3,
+			Bytes:               700,
+			Backlog:             1,
+			OldestRecordingTime: &metav1.Time{Time: now.Add(-10 * 24 * time.Hour)},
+			LastRetentionTime:   &metav1.Time{Time: cl.Now()},
+		})
+		expectEvents(t, fr, []string{"Warning RecorderRetentionFailed failed to enforce recording retention policy: access denied"})
+	})
+}
+
+func mustGetStorageStatus(t *testing.T, fc client.Client, want *tsapi.RecorderStorageStatus) {
+	t.Helper()
+	tsr := &tsapi.Recorder{}
+	if err := fc.Get(context.Background(), client.ObjectKey{Name: "test"}, tsr); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(tsr.Status.Storage, want); diff != "" {
+		t.Fatalf("unexpected storage status (-got +want):\n%s", diff)
+	}
+}
+
+type fakeRecordingStore struct {
+	recs      []recording
+	deleteErr error
+}
+
+func (s *fakeRecordingStore) listRecordings(context.Context) ([]recording, error) {
+	return slices.Clone(s.recs), nil
+}
+
+func (s *fakeRecordingStore) deleteRecordings(_ context.Context, keys []string) error {
+	if s.deleteErr != nil {
+		return s.deleteErr
+	}
+	s.recs = slices.DeleteFunc(s.recs, func(r recording) bool {
+		return slices.Contains(keys, r.key)
+	})
+	return nil
+}
+
+func (s *fakeRecordingStore) keys() (keys []string) {
+	for _, r := range s.recs {
+		keys = append(keys, r.key)
+	}
+	return keys
+}
@@ -0,0 +1,179 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+// The k8s-proxy binary is a standalone Kubernetes API server proxy. It joins
+// the tailnet as a node of its own and proxies requests from the tailnet to
+// the API servers of one or more clusters, impersonating the callers' tailnet
+// identities, just like the API server proxy of the Tailscale Kubernetes
+// Operator but without needing the operator.
+//
+// It's configured by a HuJSON file of kubetypes.K8sProxyConfig. Requests are
+// routed to clusters by their TLS server name (SNI). The node authenticates
+// with the auth key in the TS_AUTHKEY environment variable, if it's not
+// already logged in.
+package main
+
+import (
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/tailscale/hujson"
+	"go.uber.org/zap"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"tailscale.com/hostinfo"
+	"tailscale.com/ipn/store/kubestore"
+	"tailscale.com/k8s-operator/apiproxy"
+	"tailscale.com/kube/kubetypes"
+	"tailscale.com/tsnet"
+	"tailscale.com/types/logger"
+)
+
+var (
+	flagConfig     = flag.String("config", "", "path of the HuJSON configuration file")
+	flagStateDir   = flag.String("state-dir", "", "tsnet state directory; a default one will be created if not provided")
+	flagKubeSecret = flag.String("kube-secret", "", "if non-empty, the name of a Kubernetes Secret in the proxy's namespace to store the node state in, instead of the state directory")
+	flagVerbose    = flag.Bool("verbose", false, "be verbose")
+)
+
+func main() {
+	flag.Parse()
+	if *flagConfig == "" {
+		log.Fatal("--config is required")
+	}
+	cfg, err := readConfig(*flagConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mode, err := parseMode(cfg.AuthMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	clusters, err := loadClusters(cfg.Clusters)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	zcfg := zap.NewProductionConfig()
+	if *flagVerbose {
+		zcfg.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
+	}
+	zlog := must(zcfg.Build()).Sugar()
+	defer zlog.Sync()
+
+	hostinfo.SetApp(kubetypes.AppK8sProxy)
+	s := &tsnet.Server{
+		Hostname: cmp.Or(cfg.Hostname, "k8s-proxy"),
+		Dir:      *flagStateDir,
+		Logf:     zlog.Named("tailscaled").Debugf,
+	}
+	if *flagKubeSecret != "" {
+		st, err := kubestore.New(logger.Discard, *flagKubeSecret)
+		if err != nil {
+			zlog.Fatalf("creating kube store: %v", err)
+		}
+		s.Store = st
+	}
+	defer s.Close()
+	if err := apiproxy.Run(s, zlog.Named("apiserver-proxy"), mode, clusters); err != nil {
+		zlog.Fatal(err)
+	}
+}
+
+// readConfig reads and validates the configuration file at path.
+func readConfig(path string) (*kubetypes.K8sProxyConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err = hujson.Standardize(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config %q: %w", path, err)
+	}
+	var cfg kubetypes.K8sProxyConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %q: %w", path, err)
+	}
+	if cfg.Version != kubetypes.K8sProxyConfigVersion {
+		return nil, fmt.Errorf("config %q has version %q; want %q", path, cfg.Version, kubetypes.K8sProxyConfigVersion)
+	}
+	if len(cfg.Clusters) == 0 {
+		return nil, fmt.Errorf("config %q has no clusters", path)
+	}
+	return &cfg, nil
+}
+
+func parseMode(s string) (apiproxy.Mode, error) {
+	switch s {
+	case "", "auth":
+		return apiproxy.ModeEnabled, nil
+	case "noauth":
+		return apiproxy.ModeNoAuth, nil
+	}
+	return apiproxy.ModeDisabled, fmt.Errorf("unknown authMode %q; want \"auth\" or \"noauth\"", s)
+}
+
+// loadClusters loads the REST configurations and certificates of the clusters
+// in cfgs.
+func loadClusters(cfgs []kubetypes.K8sProxyCluster) ([]apiproxy.Cluster, error) {
+	var clusters []apiproxy.Cluster
+	for _, c := range cfgs {
+		if c.Name == "" {
+			return nil, errors.New("cluster with no name")
+		}
+		rc, err := restConfig(c)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %q: %w", c.Name, err)
+		}
+		ac := apiproxy.Cluster{
+			Name:             c.Name,
+			ServerNames:      c.ServerNames,
+			RestConfig:       rc,
+			Impersonation:    c.Impersonation,
+			AuditAnnotations: c.AuditAnnotations,
+		}
+		switch {
+		case c.CertFile != "" && c.KeyFile != "":
+			if len(c.ServerNames) == 0 {
+				return nil, fmt.Errorf("cluster %q: certFile requires serverNames", c.Name)
+			}
+			cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %q: %w", c.Name, err)
+			}
+			ac.Cert = &cert
+		case c.CertFile != "" || c.KeyFile != "":
+			return nil, fmt.Errorf("cluster %q: certFile and keyFile must be set together", c.Name)
+		}
+		clusters = append(clusters, ac)
+	}
+	return clusters, nil
+}
+
+// restConfig returns the configuration for reaching the API server of c: the
+// in-cluster one if c has no kubeconfig or context, or else the one of its
+// kubeconfig context.
+func restConfig(c kubetypes.K8sProxyCluster) (*rest.Config, error) {
+	if c.Kubeconfig == "" && c.Context == "" {
+		return rest.InClusterConfig()
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = c.Kubeconfig
+	cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: c.Context})
+	return cc.ClientConfig()
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		log.Fatal(err)
+	}
+	return v
+}
@@ -0,0 +1,108 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tailscale.com/kube/kubetypes"
+)
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+- name: dev
+  cluster:
+    server: https://dev.example.com:6443
+contexts:
+- name: prod
+  context: {cluster: prod, user: proxy}
+- name: dev
+  context: {cluster: dev, user: proxy}
+current-context: prod
+users:
+- name: proxy
+  user: {token: secret}
+`
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.hujson")
+	conf := `{
+		"version": "v1alpha1",
+		"hostname": "kube",
+		"clusters": [
+			{
+				"name": "prod",
+				"kubeconfig": "` + kubeconfig + `",
+				"impersonation": [{"src": ["tag:ci"], "user": "ci"}],
+				"auditAnnotations": true,
+			},
+			{
+				"name": "dev",
+				"serverNames": ["dev.example.com"],
+				"kubeconfig": "` + kubeconfig + `",
+				"context": "dev",
+			},
+		],
+	}`
+	if err := os.WriteFile(path, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := readConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusters, err := loadClusters(cfg.Clusters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 2 {
+		t.Fatalf("got %d clusters, want 2", len(clusters))
+	}
+	if got, want := clusters[0].RestConfig.Host, "https://prod.example.com:6443"; got != want {
+		t.Errorf("prod host = %q, want %q", got, want)
+	}
+	if got, want := clusters[1].RestConfig.Host, "https://dev.example.com:6443"; got != want {
+		t.Errorf("dev host = %q, want %q", got, want)
+	}
+	if !clusters[0].AuditAnnotations || len(clusters[0].Impersonation) != 1 {
+		t.Errorf("prod cluster = %+v, want audit annotations and an impersonation mapping", clusters[0])
+	}
+
+	for _, tc := range []struct {
+		conf    string
+		wantErr string
+	}{
+		{`{"clusters": [{"name": "x"}]}`, "version"},
+		{`{"version": "v1alpha1"}`, "no clusters"},
+	} {
+		if err := os.WriteFile(path, []byte(tc.conf), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readConfig(path); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("readConfig(%s) = %v, want error containing %q", tc.conf, err, tc.wantErr)
+		}
+	}
+
+	if _, err := loadClusters([]kubetypes.K8sProxyCluster{{Name: "x", Kubeconfig: kubeconfig, CertFile: "cert.pem"}}); err == nil {
+		t.Error("loadClusters with certFile but no keyFile succeeded")
+	}
+	if _, err := parseMode("sometimes"); err == nil {
+		t.Error("parseMode(sometimes) succeeded")
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// The kubectl-tailscale command is a kubectl plugin to inspect the proxies
+// managed by the Tailscale Kubernetes operator.
+//
+// Install it on your $PATH to run it as "kubectl tailscale":
+//
+//	go install tailscale.com/cmd/kubectl-tailscale
+//	kubectl tailscale proxies
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"tailscale.com/types/ptr"
+)
+
+var rootArgs struct {
+	kubeconfig        string
+	context           string
+	namespace         string
+	operatorNamespace string
+}
+
+func main() {
+	rootfs := flag.NewFlagSet("kubectl-tailscale", flag.ExitOnError)
+	rootfs.StringVar(&rootArgs.kubeconfig, "kubeconfig", "", "path to the kubeconfig file; defaults to $KUBECONFIG or ~/.kube/config")
+	rootfs.StringVar(&rootArgs.context, "context", "", "kubeconfig context to use")
+	rootfs.StringVar(&rootArgs.namespace, "n", "", "namespace of the Services and Ingresses named by proxy references; defaults to the context's namespace")
+	rootfs.StringVar(&rootArgs.operatorNamespace, "operator-namespace", "tailscale", "namespace the Tailscale operator runs its proxies in")
+
+	root := &ffcli.Command{
+		Name:       "kubectl tailscale",
+		ShortUsage: "kubectl tailscale [flags] <subcommand> [flags]",
+		ShortHelp:  "Inspect the proxies managed by the Tailscale Kubernetes operator",
+		LongHelp: strings.TrimSpace(`
+Subcommands that operate on a single proxy take a proxy reference: either
+the name of a proxy Pod in the operator namespace, as shown by
+'kubectl tailscale proxies', or the resource the proxy was created for, as
+svc/<name>, ingress/<name>, connector/<name> or proxygroup/<name>.
+`),
+		FlagSet: rootfs,
+		Subcommands: []*ffcli.Command{
+			proxiesCmd,
+			logsCmd,
+			netcheckCmd,
+		},
+		Exec: func(ctx context.Context, args []string) error {
+			return flag.ErrHelp
+		},
+	}
+	if err := root.ParseAndRun(context.Background(), os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// kubeClient returns a client for the cluster of the configured kubeconfig
+// context, and the namespace of proxy references.
+func kubeClient() (kubernetes.Interface, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = rootArgs.kubeconfig
+	cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: rootArgs.context})
+	ns := rootArgs.namespace
+	if ns == "" {
+		var err error
+		if ns, _, err = cc.Namespace(); err != nil {
+			return nil, "", err
+		}
+	}
+	cfg, err := cc.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	return cs, ns, nil
+}
+
+var proxiesCmd = &ffcli.Command{
+	Name:       "proxies",
+	ShortUsage: "kubectl tailscale proxies [<proxy>]",
+	ShortHelp:  "List proxies with their tailnet names, IPs and status",
+	LongHelp: strings.TrimSpace(`
+'kubectl tailscale proxies' lists the proxies managed by the operator, with
+the resource each was created for and the tailnet device it runs. With a
+proxy reference, it lists only the matching proxies.
+`),
+	Exec: runProxies,
+}
+
+func runProxies(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("too many arguments")
+	}
+	cs, ns, err := kubeClient()
+	if err != nil {
+		return err
+	}
+	proxies, err := listProxies(ctx, cs, rootArgs.operatorNamespace)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		if proxies, err = matchProxies(proxies, args[0], ns); err != nil {
+			return err
+		}
+	}
+	printProxies(os.Stdout, proxies)
+	return nil
+}
+
+func printProxies(w io.Writer, proxies []proxy) {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "PROXY\tTYPE\tPARENT\tHOSTNAME\tIPS\tSTATUS")
+	for _, p := range proxies {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", p.pod, p.parentType, p.parent(), orDash(p.hostname), orDash(strings.Join(p.ips, ",")), p.status)
+	}
+	tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+var logsArgs struct {
+	follow bool
+	tail   int
+}
+
+var logsCmd = &ffcli.Command{
+	Name:       "logs",
+	ShortUsage: "kubectl tailscale logs [-f] [--tail=N] <proxy>",
+	ShortHelp:  "Print the logs of a proxy",
+	Exec:       runLogs,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("logs", flag.ExitOnError)
+		fs.BoolVar(&logsArgs.follow, "f", false, "follow the logs")
+		fs.IntVar(&logsArgs.tail, "tail", -1, "number of recent lines to print; -1 for all")
+		return fs
+	})(),
+}
+
+func runLogs(ctx context.Context, args []string) error {
+	cs, p, err := resolveProxy(ctx, args)
+	if err != nil {
+		return err
+	}
+	opts := &corev1.PodLogOptions{
+		Container: proxyContainer,
+		Follow:    logsArgs.follow,
+	}
+	if logsArgs.tail >= 0 {
+		opts.TailLines = ptr.To(int64(logsArgs.tail))
+	}
+	rc, err := cs.CoreV1().Pods(rootArgs.operatorNamespace).GetLogs(p.pod, opts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(os.Stdout, rc)
+	return err
+}
+
+var netcheckCmd = &ffcli.Command{
+	Name:       "netcheck",
+	ShortUsage: "kubectl tailscale netcheck <proxy>",
+	ShortHelp:  "Run 'tailscale netcheck' in a proxy",
+	Exec:       runNetcheck,
+}
+
+func runNetcheck(ctx context.Context, args []string) error {
+	_, p, err := resolveProxy(ctx, args)
+	if err != nil {
+		return err
+	}
+	// Run the command with kubectl itself, which is always present for a
+	// kubectl plugin and implements the streaming protocols of exec.
+	kargs := []string{"exec", "--namespace", rootArgs.operatorNamespace, p.pod, "--container", proxyContainer}
+	if rootArgs.kubeconfig != "" {
+		kargs = append(kargs, "--kubeconfig", rootArgs.kubeconfig)
+	}
+	if rootArgs.context != "" {
+		kargs = append(kargs, "--context", rootArgs.context)
+	}
+	kargs = append(kargs, "--", "tailscale", "--socket="+p.socket, "netcheck")
+	cmd := exec.CommandContext(ctx, "kubectl", kargs...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// resolveProxy returns the single proxy named by the proxy reference that
+// must be the only element of args.
+func resolveProxy(ctx context.Context, args []string) (kubernetes.Interface, proxy, error) {
+	if len(args) != 1 {
+		return nil, proxy{}, errors.New("expected exactly one proxy argument")
+	}
+	cs, ns, err := kubeClient()
+	if err != nil {
+		return nil, proxy{}, err
+	}
+	proxies, err := listProxies(ctx, cs, rootArgs.operatorNamespace)
+	if err != nil {
+		return nil, proxy{}, err
+	}
+	matches, err := matchProxies(proxies, args[0], ns)
+	if err != nil {
+		return nil, proxy{}, err
+	}
+	if len(matches) > 1 {
+		var pods []string
+		for _, p := range matches {
+			pods = append(pods, p.pod)
+		}
+		return nil, proxy{}, fmt.Errorf("%s has %d proxies; name one of them: %s", args[0], len(matches), strings.Join(pods, ", "))
+	}
+	return cs, matches[0], nil
+}
@@ -0,0 +1,195 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"tailscale.com/kube/kubetypes"
+)
+
+// Labels set by the operator on the resources of the proxies it manages. They
+// mirror those in cmd/k8s-operator.
+const (
+	labelManaged         = "tailscale.com/managed"
+	labelParentType      = "tailscale.com/parent-resource-type"
+	labelParentName      = "tailscale.com/parent-resource"
+	labelParentNamespace = "tailscale.com/parent-resource-ns"
+	labelSecretType      = "tailscale.com/secret-type"
+)
+
+const (
+	// proxyContainer is the name of the container running tailscale in
+	// proxy Pods.
+	proxyContainer = "tailscale"
+	// defaultSocket is the tailscaled socket path used by containerboot if
+	// TS_SOCKET isn't set.
+	defaultSocket = "/tmp/tailscaled.sock"
+)
+
+// parentTypes maps the resource type names accepted in proxy references to
+// the parent resource types of the operator's labels.
+var parentTypes = map[string]string{
+	"svc":        "svc",
+	"service":    "svc",
+	"ing":        "ingress",
+	"ingress":    "ingress",
+	"connector":  "connector",
+	"pg":         "proxygroup",
+	"proxygroup": "proxygroup",
+}
+
+// clusterScoped reports whether resources of the parent type typ aren't
+// namespaced.
+func clusterScoped(typ string) bool {
+	return typ == "connector" || typ == "proxygroup"
+}
+
+// proxy is a tailnet device run by the operator for a Kubernetes resource.
+type proxy struct {
+	pod             string // name of the proxy Pod and its state Secret
+	parentType      string // "svc", "ingress", "connector" or "proxygroup"
+	parentName      string
+	parentNamespace string // empty for cluster-scoped parents
+
+	hostname string   // MagicDNS name of the device, or empty if not logged in yet
+	ips      []string // tailnet IPs of the device
+	status   string   // status of the Pod
+	socket   string   // tailscaled socket path in the Pod
+}
+
+// parent returns the namespaced name of the resource p was created for.
+func (p proxy) parent() string {
+	if p.parentNamespace == "" {
+		return p.parentName
+	}
+	return p.parentNamespace + "/" + p.parentName
+}
+
+// listProxies returns the proxies in the operator namespace ns, found from the
+// state Secrets of their Pods, sorted by parent.
+func listProxies(ctx context.Context, cs kubernetes.Interface, ns string) ([]proxy, error) {
+	secrets, err := cs.CoreV1().Secrets(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: labelManaged + "=true," + labelSecretType + "!=config",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing proxy Secrets: %w", err)
+	}
+	pods, err := cs.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing proxy Pods: %w", err)
+	}
+	podsByName := make(map[string]*corev1.Pod)
+	for i := range pods.Items {
+		podsByName[pods.Items[i].Name] = &pods.Items[i]
+	}
+
+	var proxies []proxy
+	for _, sec := range secrets.Items {
+		pod := podsByName[sec.Name]
+		typ := sec.Labels[labelParentType]
+		if typ == "" || (pod == nil && len(sec.Data[kubetypes.KeyDeviceID]) == 0) {
+			// Not the state Secret of a proxy.
+			continue
+		}
+		p := proxy{
+			pod:        sec.Name,
+			parentType: typ,
+			parentName: sec.Labels[labelParentName],
+			hostname:   strings.TrimSuffix(string(sec.Data[kubetypes.KeyDeviceFQDN]), "."),
+			status:     podStatus(pod),
+			socket:     podSocket(pod),
+		}
+		if !clusterScoped(typ) {
+			p.parentNamespace = sec.Labels[labelParentNamespace]
+		}
+		if raw := sec.Data[kubetypes.KeyDeviceIPs]; len(raw) > 0 {
+			if err := json.Unmarshal(raw, &p.ips); err != nil {
+				return nil, fmt.Errorf("parsing device IPs in Secret %s/%s: %w", ns, sec.Name, err)
+			}
+		}
+		proxies = append(proxies, p)
+	}
+	slices.SortFunc(proxies, func(a, b proxy) int {
+		return cmp.Or(
+			cmp.Compare(a.parentType, b.parentType),
+			cmp.Compare(a.parent(), b.parent()),
+			cmp.Compare(a.pod, b.pod),
+		)
+	})
+	return proxies, nil
+}
+
+// podStatus returns a short description of the status of pod, which may be
+// nil if it doesn't exist.
+func podStatus(pod *corev1.Pod) string {
+	switch {
+	case pod == nil:
+		return "NoPod"
+	case pod.DeletionTimestamp != nil:
+		return "Terminating"
+	case pod.Status.Phase != corev1.PodRunning:
+		return string(pod.Status.Phase)
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+			return "Ready"
+		}
+	}
+	return "NotReady"
+}
+
+// podSocket returns the tailscaled socket path of the proxy container of pod.
+func podSocket(pod *corev1.Pod) string {
+	if pod == nil {
+		return defaultSocket
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name != proxyContainer {
+			continue
+		}
+		for _, e := range c.Env {
+			if e.Name == "TS_SOCKET" && e.Value != "" {
+				return e.Value
+			}
+		}
+	}
+	return defaultSocket
+}
+
+// matchProxies returns the proxies named by the proxy reference ref, which is
+// either a proxy Pod name or a parent resource as "<type>/<name>". Namespaced
+// parents are looked up in namespace ns.
+func matchProxies(proxies []proxy, ref, ns string) ([]proxy, error) {
+	var match func(proxy) bool
+	if t, name, ok := strings.Cut(ref, "/"); ok {
+		typ, ok := parentTypes[strings.ToLower(t)]
+		if !ok {
+			return nil, fmt.Errorf("unknown resource type %q in %q; want svc, ingress, connector or proxygroup", t, ref)
+		}
+		match = func(p proxy) bool {
+			return p.parentType == typ && p.parentName == name && (clusterScoped(typ) || p.parentNamespace == ns)
+		}
+	} else {
+		match = func(p proxy) bool { return p.pod == ref }
+	}
+	var matches []proxy
+	for _, p := range proxies {
+		if match(p) {
+			matches = append(matches, p)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no proxy found for %q", ref)
+	}
+	return matches, nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestListProxies(t *testing.T) {
+	secret := func(name string, labels map[string]string, data map[string]string) *corev1.Secret {
+		s := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "tailscale", Labels: labels},
+			Data:       make(map[string][]byte),
+		}
+		for k, v := range data {
+			s.Data[k] = []byte(v)
+		}
+		return s
+	}
+	pod := func(name string, ready bool) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "tailscale"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		if ready {
+			p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		}
+		return p
+	}
+	svcLabels := map[string]string{
+		labelManaged:         "true",
+		labelParentType:      "svc",
+		labelParentName:      "web",
+		labelParentNamespace: "prod",
+	}
+	pgLabels := func(typ string) map[string]string {
+		return map[string]string{
+			labelManaged:    "true",
+			labelParentType: "proxygroup",
+			labelParentName: "egress",
+			labelSecretType: typ,
+		}
+	}
+	objs := []runtime.Object{
+		secret("ts-web-abcde-0", svcLabels, map[string]string{
+			"device_id":   "nXYZ",
+			"device_fqdn": "prod-web.tails.ts.net.",
+			"device_ips":  `["100.64.0.1","fd7a:115c:a1e0::1"]`,
+		}),
+		pod("ts-web-abcde-0", true),
+		secret("egress-0", pgLabels("state"), map[string]string{"device_id": "n1", "device_fqdn": "egress-0.tails.ts.net."}),
+		pod("egress-0", false),
+		secret("egress-1", pgLabels("state"), nil), // not logged in yet
+		pod("egress-1", true),
+		secret("egress-0-config", pgLabels("config"), map[string]string{"cap-107.hujson": "{}"}),
+		secret("unmanaged", nil, map[string]string{"device_id": "n2"}),
+	}
+	cs := fake.NewSimpleClientset(objs...)
+
+	proxies, err := listProxies(context.Background(), cs, "tailscale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	printProxies(&buf, proxies)
+	want := strings.TrimLeft(`
+PROXY            TYPE         PARENT     HOSTNAME                IPS                            STATUS
+egress-0         proxygroup   egress     egress-0.tails.ts.net   -                              NotReady
+egress-1         proxygroup   egress     -                       -                              Ready
+ts-web-abcde-0   svc          prod/web   prod-web.tails.ts.net   100.64.0.1,fd7a:115c:a1e0::1   Ready
+`, "\n")
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("printProxies mismatch (-want +got):\n%s", diff)
+	}
+
+	tests := []struct {
+		ref      string
+		ns       string
+		wantPods []string
+		wantErr  bool
+	}{
+		{ref: "svc/web", ns: "prod", wantPods: []string{"ts-web-abcde-0"}},
+		{ref: "service/web", ns: "default", wantErr: true},
+		{ref: "ts-web-abcde-0", wantPods: []string{"ts-web-abcde-0"}},
+		{ref: "pg/egress", ns: "any", wantPods: []string{"egress-0", "egress-1"}},
+		{ref: "deployment/web", wantErr: true},
+	}
+	for _, tt := range tests {
+		matches, err := matchProxies(proxies, tt.ref, tt.ns)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("matchProxies(%q, %q): err = %v; want error: %v", tt.ref, tt.ns, err, tt.wantErr)
+			continue
+		}
+		var pods []string
+		for _, p := range matches {
+			pods = append(pods, p.pod)
+		}
+		if diff := cmp.Diff(tt.wantPods, pods); diff != "" {
+			t.Errorf("matchProxies(%q, %q) mismatch (-want +got):\n%s", tt.ref, tt.ns, diff)
+		}
+	}
+}
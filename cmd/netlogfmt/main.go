@@ -26,14 +26,12 @@
 
 import (
 	"cmp"
-	"encoding/base64"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"math"
-	"net/http"
 	"net/netip"
 	"os"
 	"slices"
@@ -44,9 +42,9 @@
 	"github.com/dsnet/try"
 	jsonv2 "github.com/go-json-experiment/json"
 	"github.com/go-json-experiment/json/jsontext"
+	"tailscale.com/client/tailscale"
 	"tailscale.com/types/logid"
 	"tailscale.com/types/netlogtype"
-	"tailscale.com/util/must"
 )
 
 var (
@@ -288,25 +286,13 @@ func mustMakeNamesByAddr() map[netip.Addr]string {
 	}
 
 	// Query the Tailscale API for a list of devices in the tailnet.
-	const apiURL = "https://api.tailscale.com/api/v2"
-	req := must.Get(http.NewRequest("GET", apiURL+"/tailnet/"+*tailnetName+"/devices", nil))
-	req.Header.Add("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(*apiKey+":")))
-	resp := must.Get(http.DefaultClient.Do(req))
-	defer resp.Body.Close()
-	b := must.Get(io.ReadAll(resp.Body))
-	if resp.StatusCode != 200 {
-		log.Fatalf("http: %v: %s", http.StatusText(resp.StatusCode), b)
+	tailscale.I_Acknowledge_This_API_Is_Unstable = true
+	client := tailscale.NewClient(*tailnetName, tailscale.APIKey(*apiKey))
+	devices, err := client.Devices(context.Background(), nil)
+	if err != nil {
+		log.Fatalf("listing devices: %v", err)
 	}
 
-	// Unmarshal the API response.
-	var m struct {
-		Devices []struct {
-			Name  string       `json:"name"`
-			Addrs []netip.Addr `json:"addresses"`
-		} `json:"devices"`
-	}
-	must.Do(json.Unmarshal(b, &m))
-
 	// Construct a unique mapping of Tailscale IP addresses to hostnames.
 	// For brevity, we start with the first segment of the name and
 	// use more segments until we find the shortest prefix that is unique
@@ -317,14 +303,16 @@ func mustMakeNamesByAddr() map[netip.Addr]string {
 	for i := range 10 {
 		clear(seen)
 		clear(namesByAddr)
-		for _, d := range m.Devices {
+		for _, d := range devices {
 			name := fieldPrefix(d.Name, i)
 			if seen[name] {
 				continue retry
 			}
 			seen[name] = true
-			for _, a := range d.Addrs {
-				namesByAddr[a] = name
+			for _, a := range d.Addresses {
+				if ip, err := netip.ParseAddr(a); err == nil {
+					namesByAddr[ip] = name
+				}
 			}
 		}
 		return namesByAddr
@@ -3,7 +3,8 @@
 
 // proxy-to-grafana is a reverse proxy which identifies users based on their
 // originating Tailscale identity and maps them to corresponding Grafana
-// users, creating them if needed.
+// users, creating them if needed. It's tailscale-auth-proxy with Grafana's
+// headers; see the tailscale.com/client/authproxy package.
 //
 // It uses Grafana's AuthProxy feature:
 // https://grafana.com/docs/grafana/latest/auth/auth-proxy/
@@ -19,7 +20,7 @@
 //	header_property = username
 //	auto_sign_up = true
 //	whitelist = 127.0.0.1
-//	headers = Name:X-WEBAUTH-NAME
+//	headers = Name:X-WEBAUTH-NAME, Groups:X-WEBAUTH-GROUPS
 //	enable_login_token = true
 package main
 
@@ -31,13 +32,11 @@
 	"log"
 	"net"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"strings"
 	"time"
 
-	"tailscale.com/client/tailscale"
-	"tailscale.com/tailcfg"
+	"tailscale.com/client/authproxy"
 	"tailscale.com/tsnet"
 )
 
@@ -74,11 +73,21 @@ func main() {
 		log.Fatalf("couldn't parse backend address: %v", err)
 	}
 
-	proxy := httputil.NewSingleHostReverseProxy(url)
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-		modifyRequest(req, localClient)
+	headers, _ := authproxy.BackendHeaders(authproxy.BackendGrafana)
+	proxy, err := authproxy.New(authproxy.Config{
+		Backend: url,
+		WhoIs:   localClient.WhoIs,
+		Headers: headers,
+		// With enable_login_token, Grafana keeps its own session cookie
+		// once logged in, so clients only need identifying on /login.
+		Paths: []string{"/login"},
+		// Let clients that can't be identified, such as tagged nodes,
+		// through to Grafana's own login page.
+		AllowUnidentified: true,
+		Logf:              log.Printf,
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	var ln net.Listener
@@ -126,35 +135,3 @@ func main() {
 	log.Printf("proxy-to-grafana running at %v, proxying to %v", ln.Addr(), *backendAddr)
 	log.Fatal(http.Serve(ln, proxy))
 }
-
-func modifyRequest(req *http.Request, localClient *tailscale.LocalClient) {
-	// with enable_login_token set to true, we get a cookie that handles
-	// auth for paths that are not /login
-	if req.URL.Path != "/login" {
-		return
-	}
-
-	user, err := getTailscaleUser(req.Context(), localClient, req.RemoteAddr)
-	if err != nil {
-		log.Printf("error getting Tailscale user: %v", err)
-		return
-	}
-
-	req.Header.Set("X-Webauth-User", user.LoginName)
-	req.Header.Set("X-Webauth-Name", user.DisplayName)
-}
-
-func getTailscaleUser(ctx context.Context, localClient *tailscale.LocalClient, ipPort string) (*tailcfg.UserProfile, error) {
-	whois, err := localClient.WhoIs(ctx, ipPort)
-	if err != nil {
-		return nil, fmt.Errorf("failed to identify remote host: %w", err)
-	}
-	if whois.Node.IsTagged() {
-		return nil, fmt.Errorf("tagged nodes are not users")
-	}
-	if whois.UserProfile == nil || whois.UserProfile.LoginName == "" {
-		return nil, fmt.Errorf("failed to identify remote user")
-	}
-
-	return whois.UserProfile, nil
-}
@@ -0,0 +1,208 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/tailscale/hujson"
+)
+
+// policyAction is what the sniproxy does with connections for a domain.
+type policyAction string
+
+const (
+	actionAllow    policyAction = "allow"     // proxy directly to the internet
+	actionDeny     policyAction = "deny"      // drop the connection
+	actionExitNode policyAction = "exit-node" // proxy via the tailnet's exit node
+)
+
+// policyConfig is the config file passed to --config, in HuJSON. For example:
+//
+//	{
+//		"Domains": [
+//			{"Match": "*.corp.example.com", "Action": "deny"},
+//			{"Match": "*.example.com"},
+//			{"Match": "ifconfig.me", "Action": "exit-node"},
+//		],
+//		"Default": "deny",
+//		"ExitNode": "100.101.102.103",
+//	}
+type policyConfig struct {
+	// Domains are the policies for SNI names. The first one matching a
+	// name applies to it.
+	Domains []domainPolicy `json:",omitempty"`
+
+	// Default is the action for names that match none of Domains.
+	// Empty means actionAllow.
+	Default policyAction `json:",omitempty"`
+
+	// ExitNode is the Tailscale IP of the exit node to proxy connections
+	// via for domains with actionExitNode.
+	ExitNode netip.Addr `json:",omitempty"`
+}
+
+// domainPolicy is the policy for the SNI names matching a pattern.
+type domainPolicy struct {
+	// Match is either a domain name, matching only that name, or a
+	// domain name prefixed by "*.", matching only its subdomains.
+	Match string
+
+	// Action is what to do with connections for the matching names.
+	// Empty means actionAllow.
+	Action policyAction `json:",omitempty"`
+}
+
+// matches reports whether name, which must be lowercase without a trailing
+// dot, matches p.
+func (p *domainPolicy) matches(name string) bool {
+	if suffix, ok := strings.CutPrefix(p.Match, "*"); ok {
+		return strings.HasSuffix(name, suffix)
+	}
+	return name == p.Match
+}
+
+func validAction(a policyAction) bool {
+	switch a {
+	case "", actionAllow, actionDeny, actionExitNode:
+		return true
+	}
+	return false
+}
+
+// parsePolicyConfig parses and validates a config file.
+func parsePolicyConfig(b []byte) (*policyConfig, error) {
+	b, err := hujson.Standardize(b)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(policyConfig)
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, err
+	}
+	if !validAction(cfg.Default) {
+		return nil, fmt.Errorf("invalid Default action %q", cfg.Default)
+	}
+	needExit := cfg.Default == actionExitNode
+	for i, d := range cfg.Domains {
+		m := strings.ToLower(strings.TrimSuffix(d.Match, "."))
+		if m == "" || strings.Contains(strings.TrimPrefix(m, "*."), "*") {
+			return nil, fmt.Errorf("Domains[%d]: invalid Match %q", i, d.Match)
+		}
+		cfg.Domains[i].Match = m
+		if !validAction(d.Action) {
+			return nil, fmt.Errorf("Domains[%d]: invalid Action %q", i, d.Action)
+		}
+		needExit = needExit || d.Action == actionExitNode
+	}
+	if needExit && !cfg.ExitNode.IsValid() {
+		return nil, fmt.Errorf("action %q used without ExitNode", actionExitNode)
+	}
+	return cfg, nil
+}
+
+// readPolicyConfig reads and parses the config file at path.
+func readPolicyConfig(path string) (*policyConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parsePolicyConfig(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// policy is the policy from a config file, as applied to connections.
+type policy struct {
+	cfg *policyConfig
+
+	// exitDialContext dials connections via the exit node.
+	exitDialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// defaultPolicyLabel is the metrics label for names matching no domain
+// policy.
+const defaultPolicyLabel = "default"
+
+// lookup returns the action for the SNI name sniName, and the label of the
+// domain policy that matched it, for metrics. Labels are the Match patterns
+// rather than the names themselves, to bound the number of metrics.
+func (p *policy) lookup(sniName string) (_ policyAction, label string) {
+	name := strings.ToLower(strings.TrimSuffix(sniName, "."))
+	for _, d := range p.cfg.Domains {
+		if d.matches(name) {
+			return orAllow(d.Action), d.Match
+		}
+	}
+	return orAllow(p.cfg.Default), defaultPolicyLabel
+}
+
+func orAllow(a policyAction) policyAction {
+	if a == "" {
+		return actionAllow
+	}
+	return a
+}
+
+// watchPolicyConfig watches the config file at path for changes, calling
+// apply with the new config each time it changes, until ctx is done. A
+// config that fails to parse is logged and otherwise ignored, so the
+// previous one stays in effect.
+func watchPolicyConfig(ctx context.Context, path string, prev *policyConfig, apply func(*policyConfig)) {
+	var tickChan <-chan time.Time
+	var eventChan <-chan fsnotify.Event
+	if w, err := fsnotify.NewWatcher(); err != nil {
+		log.Printf("config: failed to create fsnotify watcher, timer-only mode: %v", err)
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		tickChan = ticker.C
+	} else {
+		defer w.Close()
+		// Watch the directory rather than the file, so that the file
+		// being replaced rather than written to is noticed too.
+		if err := w.Add(filepath.Dir(path)); err != nil {
+			log.Printf("config: failed to add fsnotify watch, timer-only mode: %v", err)
+			ticker := time.NewTicker(5 * time.Second)
+			defer ticker.Stop()
+			tickChan = ticker.C
+		} else {
+			eventChan = w.Events
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickChan:
+		case <-eventChan:
+		}
+		cfg, err := readPolicyConfig(path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Printf("config: %v; keeping previous config", err)
+			}
+			continue
+		}
+		if reflect.DeepEqual(cfg, prev) {
+			continue
+		}
+		log.Printf("config: reloaded %s", path)
+		apply(cfg)
+		prev = cfg
+	}
+}
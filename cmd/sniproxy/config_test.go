@@ -0,0 +1,70 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParsePolicyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"empty", `{}`, false},
+		{"comments", `{
+			// Block the intranet.
+			"Domains": [{"Match": "*.corp.example.com", "Action": "deny"}],
+		}`, false},
+		{"bad-default", `{"Default": "maybe"}`, true},
+		{"bad-action", `{"Domains": [{"Match": "example.com", "Action": "maybe"}]}`, true},
+		{"empty-match", `{"Domains": [{"Match": ""}]}`, true},
+		{"inner-wildcard", `{"Domains": [{"Match": "foo.*.example.com"}]}`, true},
+		{"exit-node-without-exit-node", `{"Domains": [{"Match": "example.com", "Action": "exit-node"}]}`, true},
+		{"exit-node", `{"Default": "exit-node", "ExitNode": "100.64.0.9"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parsePolicyConfig([]byte(tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyLookup(t *testing.T) {
+	cfg, err := parsePolicyConfig([]byte(`{
+		"Domains": [
+			{"Match": "*.corp.example.com", "Action": "deny"},
+			{"Match": "*.example.com"},
+			{"Match": "Example.com.", "Action": "exit-node"},
+		],
+		"Default": "deny",
+		"ExitNode": "100.64.0.9",
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &policy{cfg: cfg}
+	tests := []struct {
+		name       string
+		wantAction policyAction
+		wantLabel  string
+	}{
+		{"wiki.corp.example.com", actionDeny, "*.corp.example.com"},
+		{"www.example.com", actionAllow, "*.example.com"},
+		{"WWW.Example.COM.", actionAllow, "*.example.com"},
+		{"example.com", actionExitNode, "example.com"},
+		{"notexample.com", actionDeny, defaultPolicyLabel},
+		{"tailscale.com", actionDeny, defaultPolicyLabel},
+	}
+	for _, tt := range tests {
+		action, label := p.lookup(tt.name)
+		if action != tt.wantAction || label != tt.wantLabel {
+			t.Errorf("lookup(%q) = %q, %q; want %q, %q", tt.name, action, label, tt.wantAction, tt.wantLabel)
+		}
+	}
+}
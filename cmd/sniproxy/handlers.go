@@ -62,6 +62,10 @@ type tcpSNIHandler struct {
 	// empty slice means all domains are permitted.
 	Allowlist []string
 
+	// Policy, if non-nil, returns the policy from the config file for
+	// the FQDNs allowed by Allowlist, or nil if there's none.
+	Policy func() *policy
+
 	// DialContext is used to make the outgoing TCP connection.
 	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
 
@@ -95,9 +99,24 @@ func (h *tcpSNIHandler) Handle(c net.Conn) {
 			}
 		}
 
+		dial := h.DialContext
+		if h.Policy != nil {
+			if pol := h.Policy(); pol != nil {
+				m := getMetrics()
+				action, label := pol.lookup(sniName)
+				switch action {
+				case actionDeny:
+					m.domainDenied.Add(label, 1)
+					return nil, false
+				case actionExitNode:
+					dial = pol.exitDialContext
+				}
+				m.domainConns.Add(label, 1)
+			}
+		}
 		return &tcpproxy.DialProxy{
 			Addr:        net.JoinHostPort(sniName, port),
-			DialContext: h.DialContext,
+			DialContext: dial,
 		}, true
 	})
 	p.Start()
@@ -7,6 +7,7 @@
 	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"io"
 	"net"
 	"net/netip"
@@ -157,3 +158,52 @@ func TestTCPSNIHandler(t *testing.T) {
 		t.Errorf("got %q, want %q", got, want)
 	}
 }
+
+func TestTCPSNIHandlerPolicy(t *testing.T) {
+	cfg, err := parsePolicyConfig([]byte(`{
+		"Domains": [
+			{"Match": "*.tailscale.com", "Action": "exit-node"},
+		],
+		"Default": "deny",
+		"ExitNode": "100.64.0.9",
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pol := &policy{
+		cfg: cfg,
+		exitDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if addr != "pkgs.tailscale.com:443" {
+				t.Errorf("addr = %s, want %s", addr, "pkgs.tailscale.com:443")
+			}
+			c, s := memnet.NewConn("outbound", 1024)
+			go echoConnOnce(s)
+			return c, nil
+		},
+	}
+	h := tcpSNIHandler{
+		Policy: func() *policy { return pol },
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			t.Errorf("dialed %s directly rather than via the exit node", addr)
+			return nil, errors.New("unexpected dial")
+		},
+	}
+	m := getMetrics()
+	before := m.domainConns.Get("*.tailscale.com").Value()
+
+	cSock, sSock := memnet.NewTCPConn(netip.MustParseAddrPort("10.64.1.2:22"), netip.MustParseAddrPort("10.64.1.2:443"), 1024)
+	h.Handle(sSock)
+	if _, err := cSock.Write(fakeSNIHeader()); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 5)
+	if _, err := io.ReadAtLeast(cSock, got, len(got)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, fakeSNIHeader()[:5]) {
+		t.Errorf("got %q, want %q", got, fakeSNIHeader()[:5])
+	}
+	if n := m.domainConns.Get("*.tailscale.com").Value() - before; n != 1 {
+		t.Errorf("domain_conns for *.tailscale.com increased by %d, want 1", n)
+	}
+}
@@ -9,6 +9,7 @@
 	"net"
 	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/dns/dnsmessage"
@@ -32,6 +33,8 @@ type target struct {
 
 // Server implements an App Connector as expressed in sniproxy.
 type Server struct {
+	policy atomic.Pointer[policy] // or nil for no config file
+
 	mu         sync.RWMutex // mu guards following fields
 	connectors map[appctype.ConfigID]connector
 }
@@ -42,10 +45,17 @@ type appcMetrics struct {
 	tcpConns       expvar.Int
 	sniConns       expvar.Int
 	unhandledConns expvar.Int
+
+	// Per domain policy, by the label of the policy.
+	domainConns  metrics.LabelMap // proxied connections
+	domainDenied metrics.LabelMap // connections denied by the policy
 }
 
 var getMetrics = sync.OnceValue[*appcMetrics](func() *appcMetrics {
-	m := appcMetrics{}
+	m := appcMetrics{
+		domainConns:  metrics.LabelMap{Label: "domain"},
+		domainDenied: metrics.LabelMap{Label: "domain"},
+	}
 
 	stats := new(metrics.Set)
 	stats.Set("tls_sessions", &m.sniConns)
@@ -56,6 +66,8 @@ type appcMetrics struct {
 	clientmetric.NewCounterFunc("sniproxy_dns_responses", m.dnsResponses.Value)
 	stats.Set("dns_failed", &m.dnsFailures)
 	clientmetric.NewCounterFunc("sniproxy_dns_failed", m.dnsFailures.Value)
+	stats.Set("domain_conns", &m.domainConns)
+	stats.Set("domain_denied", &m.domainDenied)
 	expvar.Publish("sniproxy", stats)
 
 	return &m
@@ -65,10 +77,16 @@ type appcMetrics struct {
 func (s *Server) Configure(cfg *appctype.AppConnectorConfig) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.connectors = makeConnectorsFromConfig(cfg)
+	s.connectors = makeConnectorsFromConfig(cfg, s.policy.Load)
 	log.Printf("installed app connector config: %+v", s.connectors)
 }
 
+// SetPolicy sets the policy for SNI names from the config file, replacing
+// any previous one. A nil p removes the policy.
+func (s *Server) SetPolicy(p *policy) {
+	s.policy.Store(p)
+}
+
 // HandleTCPFlow implements tsnet.FallbackTCPHandler.
 func (s *Server) HandleTCPFlow(src, dst netip.AddrPort) (handler func(net.Conn), intercept bool) {
 	m := getMetrics()
@@ -288,11 +306,12 @@ func installDNATHandler(d *appctype.DNATConfig, out *connector) {
 	}
 }
 
-func installSNIHandler(c *appctype.SNIProxyConfig, out *connector) {
+func installSNIHandler(c *appctype.SNIProxyConfig, out *connector, pol func() *policy) {
 	var dialer net.Dialer
 	dialer.Timeout = 5 * time.Second
 	h := tcpSNIHandler{
 		Allowlist:    c.AllowedDomains,
+		Policy:       pol,
 		DialContext:  dialer.DialContext,
 		ReachableIPs: c.Addrs,
 	}
@@ -309,7 +328,9 @@ func installSNIHandler(c *appctype.SNIProxyConfig, out *connector) {
 	}
 }
 
-func makeConnectorsFromConfig(cfg *appctype.AppConnectorConfig) map[appctype.ConfigID]connector {
+// makeConnectorsFromConfig returns the connectors for cfg. The SNI proxy
+// connectors apply the policy returned by pol, if non-nil.
+func makeConnectorsFromConfig(cfg *appctype.AppConnectorConfig, pol func() *policy) map[appctype.ConfigID]connector {
 	var connectors map[appctype.ConfigID]connector
 
 	for cID, d := range cfg.DNAT {
@@ -319,7 +340,7 @@ func makeConnectorsFromConfig(cfg *appctype.AppConnectorConfig) map[appctype.Con
 	}
 	for cID, d := range cfg.SNIProxy {
 		c := connectors[cID]
-		installSNIHandler(&d, &c)
+		installSNIHandler(&d, &c, pol)
 		mak.Set(&connectors, cID, c)
 	}
 
@@ -5,6 +5,10 @@
 // Tailscale on one or more TCP ports and sends them out to the same SNI
 // hostname & port on the internet. It can optionally forward one or more
 // TCP ports to a specific destination. It only does TCP.
+//
+// With --config, it reads a config file of per-domain policies for the SNI
+// names it proxies, allowing or denying them or proxying them via an exit
+// node, and reloads it when it changes. See policyConfig.
 package main
 
 import (
@@ -77,6 +81,7 @@ func main() {
 		promoteHTTPS = fs.Bool("promote-https", true, "promote HTTP to HTTPS")
 		debugPort    = fs.Int("debug-port", 8893, "Listening port for debug/metrics endpoint")
 		hostname     = fs.String("hostname", "", "Hostname to register the service under")
+		configPath   = fs.String("config", "", "path to a HuJSON config file of per-domain policies; reloaded on changes")
 	)
 	err := ff.Parse(fs, os.Args[1:], ff.WithEnvVarPrefix("TS_APPC"))
 	if err != nil {
@@ -88,11 +93,11 @@ func main() {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	run(ctx, &ts, *wgPort, *hostname, *promoteHTTPS, *debugPort, *ports, *forwards)
+	run(ctx, &ts, *wgPort, *hostname, *promoteHTTPS, *debugPort, *ports, *forwards, *configPath)
 }
 
 // run actually runs the sniproxy. Its separate from main() to assist in testing.
-func run(ctx context.Context, ts *tsnet.Server, wgPort int, hostname string, promoteHTTPS bool, debugPort int, ports, forwards string) {
+func run(ctx context.Context, ts *tsnet.Server, wgPort int, hostname string, promoteHTTPS bool, debugPort int, ports, forwards, configPath string) {
 	// Wire up Tailscale node + app connector server
 	hostinfo.SetApp("sniproxy")
 	var s sniproxy
@@ -108,6 +113,17 @@ func run(ctx context.Context, ts *tsnet.Server, wgPort int, hostname string, pro
 	s.lc = lc
 	s.ts.RegisterFallbackTCPHandler(s.srv.HandleTCPFlow)
 
+	if configPath != "" {
+		cfg, err := readPolicyConfig(configPath)
+		if err != nil {
+			log.Fatalf("reading config: %v", err)
+		}
+		s.applyPolicyConfig(ctx, cfg)
+		go watchPolicyConfig(ctx, configPath, cfg, func(cfg *policyConfig) {
+			s.applyPolicyConfig(ctx, cfg)
+		})
+	}
+
 	// Start special-purpose listeners: dns, http promotion, debug server
 	ln, err := s.ts.Listen("udp", ":53")
 	if err != nil {
@@ -220,6 +236,22 @@ func (s *sniproxy) advertiseRoutesFromConfig(ctx context.Context, c *appctype.Ap
 	return err
 }
 
+// applyPolicyConfig starts applying the policies of cfg to new connections,
+// and makes the node use the exit node cfg names, if any.
+func (s *sniproxy) applyPolicyConfig(ctx context.Context, cfg *policyConfig) {
+	_, err := s.lc.EditPrefs(ctx, &ipn.MaskedPrefs{
+		Prefs: ipn.Prefs{
+			ExitNodeIP: cfg.ExitNode,
+		},
+		ExitNodeIDSet: true,
+		ExitNodeIPSet: true,
+	})
+	if err != nil {
+		log.Printf("config: failed to set exit node %v: %v", cfg.ExitNode, err)
+	}
+	s.srv.SetPolicy(&policy{cfg: cfg, exitDialContext: s.ts.Dial})
+}
+
 func (s *sniproxy) mergeConfigFromFlags(out *appctype.AppConnectorConfig, ports, forwards string) {
 	ip4, ip6 := s.ts.TailscaleIPs()
 
@@ -18,8 +18,12 @@
 )
 
 var (
-	stunAddr = flag.String("stun", ":3478", "UDP address on which to start the STUN server")
-	httpAddr = flag.String("http", ":3479", "address on which to start the debug http server")
+	stunAddr       = flag.String("stun", ":3478", "UDP address on which to start the STUN server")
+	httpAddr       = flag.String("http", ":3479", "address on which to start the debug http server")
+	rateLimit      = flag.Float64("rate-limit", 0, "if positive, the maximum number of requests per second answered for each client IP (or IPv6 /64)")
+	rateBurst      = flag.Int("rate-burst", 10, "the maximum burst of requests answered for each client when --rate-limit is set")
+	altAddr        = flag.String("alt-addr", "", "if non-empty, an alternate \"ip:port\" for RFC 5780 NAT behavior discovery; its IP and port must both differ from those of --stun, which must then have a specific IP")
+	allowAnyClient = flag.Bool("allow-any-client", false, "answer binding requests from any STUN client, not only from Tailscale")
 )
 
 func main() {
@@ -31,7 +35,12 @@ func main() {
 	log.Printf("HTTP server listening on %s", *httpAddr)
 	go http.ListenAndServe(*httpAddr, mux())
 
-	s := stunserver.New(ctx)
+	s := stunserver.NewWithConfig(ctx, stunserver.Config{
+		RateLimit:      *rateLimit,
+		RateBurst:      *rateBurst,
+		AltAddr:        *altAddr,
+		AllowAnyClient: *allowAnyClient,
+	})
 	if err := s.ListenAndServe(*stunAddr); err != nil {
 		log.Fatal(err)
 	}
@@ -44,5 +53,8 @@ func mux() *http.ServeMux {
 	})
 	debug := tsweb.Debugger(mux)
 	debug.KV("stun_addr", *stunAddr)
+	if *altAddr != "" {
+		debug.KV("stun_alt_addr", *altAddr)
+	}
 	return mux
 }
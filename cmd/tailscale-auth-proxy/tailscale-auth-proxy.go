@@ -0,0 +1,174 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// tailscale-auth-proxy is a reverse proxy that joins a tailnet and fronts a
+// web app with Tailscale single sign-on: it identifies users by their
+// Tailscale identity and passes it to the app in request headers, for apps
+// that support proxy authentication, such as Grafana, Kibana and Jenkins.
+//
+// The --backend-type flag selects the headers that the type of app expects
+// by default, which --header adds to or overrides. For example:
+//
+//	tailscale-auth-proxy --hostname=jenkins --backend-addr=localhost:8080 \
+//		--backend-type=jenkins --header=X-Forwarded-Name=name
+//
+// Users' groups come from grants of the tailscale.com/cap/auth-proxy
+// capability, as described in the tailscale.com/client/authproxy package.
+//
+// Set the TS_AUTHKEY environment variable to have this server automatically
+// join your tailnet, or look for the logged auth link on first start.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"tailscale.com/client/authproxy"
+	"tailscale.com/tsnet"
+)
+
+var (
+	hostname     = flag.String("hostname", "", "Tailscale hostname to serve on, used as the base name for MagicDNS or subdomain in your domain alias for HTTPS.")
+	backendAddr  = flag.String("backend-addr", "", "Address of the app, in host:port format or as an http:// or https:// URL. Typically localhost:nnnn.")
+	backendType  = flag.String("backend-type", authproxy.BackendGeneric, "Type of app, which sets the default identity headers: generic, grafana, kibana or jenkins.")
+	tailscaleDir = flag.String("state-dir", "./", "Alternate directory to use for Tailscale state storage. If empty, a default is used.")
+	useHTTPS     = flag.Bool("use-https", false, "Serve over HTTPS via your *.ts.net subdomain if enabled in Tailscale admin.")
+	loginServer  = flag.String("login-server", "", "URL to alternative control server. If empty, the default Tailscale control is used.")
+	allowTagged  = flag.Bool("allow-tagged", false, "Proxy requests from tagged nodes, without identity headers. If false, they're rejected.")
+	sessionTTL   = flag.Duration("session-ttl", 0, "If non-zero, how long to remember users' identities in a session cookie, bound to their Tailscale IP.")
+	sessionKey   = flag.String("session-key-file", "", "File with a hex-encoded key that signs session cookies, so sessions survive restarts. If empty, a random key is used.")
+	headers      []authproxy.Header
+)
+
+func init() {
+	flag.Func("header", "Identity header to set, as Name=field, or Name=groups:sep to join groups with sep. The fields are login, user, name, picture, tailnet, node and groups. Repeatable.", func(s string) error {
+		h, err := authproxy.ParseHeader(s)
+		if err != nil {
+			return err
+		}
+		headers = append(headers, h)
+		return nil
+	})
+}
+
+func main() {
+	flag.Parse()
+	if *hostname == "" || strings.Contains(*hostname, ".") {
+		log.Fatal("missing or invalid --hostname")
+	}
+	if *backendAddr == "" {
+		log.Fatal("missing --backend-addr")
+	}
+	backend, err := parseBackend(*backendAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hh, err := authproxy.BackendHeaders(*backendType)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var key []byte
+	if *sessionKey != "" {
+		b, err := os.ReadFile(*sessionKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if key, err = hex.DecodeString(strings.TrimSpace(string(b))); err != nil {
+			log.Fatalf("invalid --session-key-file: %v", err)
+		}
+	}
+
+	ts := &tsnet.Server{
+		Dir:        *tailscaleDir,
+		Hostname:   *hostname,
+		ControlURL: *loginServer,
+	}
+	if err := ts.Start(); err != nil {
+		log.Fatalf("Error starting tsnet.Server: %v", err)
+	}
+	localClient, _ := ts.LocalClient()
+
+	proxy, err := authproxy.New(authproxy.Config{
+		Backend:     backend,
+		WhoIs:       localClient.WhoIs,
+		Headers:     mergeHeaders(hh, headers),
+		AllowTagged: *allowTagged,
+		SessionTTL:  *sessionTTL,
+		SessionKey:  key,
+		Logf:        log.Printf,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var ln net.Listener
+	if *useHTTPS {
+		ln, err = ts.Listen("tcp", ":443")
+		ln = tls.NewListener(ln, &tls.Config{
+			GetCertificate: localClient.GetCertificate,
+		})
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if _, err := ts.Up(ctx); err != nil {
+				log.Fatalf("waiting for tailscale to start: %v", err)
+			}
+			name, ok := localClient.ExpandSNIName(context.Background(), *hostname)
+			if !ok {
+				log.Fatalf("can't get hostname for https redirect")
+			}
+			l80, err := ts.Listen("tcp", ":80")
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Fatal(http.Serve(l80, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, fmt.Sprintf("https://%s%s", name, r.URL.RequestURI()), http.StatusMovedPermanently)
+			})))
+		}()
+	} else {
+		ln, err = ts.Listen("tcp", ":80")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("tailscale-auth-proxy running at %v, proxying to %v", ln.Addr(), backend)
+	log.Fatal(http.Serve(ln, proxy))
+}
+
+// parseBackend parses the --backend-addr flag.
+func parseBackend(addr string) (*url.URL, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid --backend-addr %q", addr)
+	}
+	return u, nil
+}
+
+// mergeHeaders returns the headers of base with those of extra added,
+// replacing any of base with the same names.
+func mergeHeaders(base, extra []authproxy.Header) []authproxy.Header {
+	var ret []authproxy.Header
+	for _, h := range base {
+		overridden := false
+		for _, e := range extra {
+			overridden = overridden || e.Name == h.Name
+		}
+		if !overridden {
+			ret = append(ret, h)
+		}
+	}
+	return append(ret, extra...)
+}
@@ -0,0 +1,161 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// The tailscale-netsim binary runs a simulated network, described by a YAML
+// scenario file, for VMs running tailscaled (such as the natlab gokrazy
+// image) to connect to. It's used to reproduce connectivity problems, and to
+// test tailscaled and tsnet apps under hostile network conditions: hard NATs,
+// latency, packet loss, blocked IPv4 and unavailable DERP servers.
+//
+// See the docs of vnet.Scenario for the scenario file format, and the
+// scenarios directory for examples. For each node in the scenario,
+// tailscale-netsim prints the MAC address and kernel command line arguments
+// for its VM, which should use a qemu "stream" netdev connected to --listen.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"tailscale.com/tstest/natlab/vnet"
+)
+
+var (
+	scenario = flag.String("scenario", "", "path to the YAML scenario file to simulate")
+	listen   = flag.String("listen", "/tmp/qemu.sock", "path of the Unix socket for VMs to connect to")
+	dgram    = flag.Bool("dgram", false, "enable datagram mode; for use with macOS Hypervisor.Framework and VZFileHandleNetworkDeviceAttachment")
+	blend    = flag.Bool("blend", false, "blend reality (controlplane.tailscale.com and DERPs) into the virtual network")
+	pcapFile = flag.String("pcap", "", "if non-empty, filename to write pcap to, overriding the scenario's pcapFile")
+	check    = flag.Bool("check", false, "only check the scenario file for errors, and print its nodes")
+)
+
+func main() {
+	flag.Parse()
+	if *scenario == "" {
+		log.Fatalf("--scenario is required")
+	}
+	sc, err := vnet.ReadScenario(*scenario)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *pcapFile != "" {
+		sc.PCAPFile = *pcapFile
+	}
+	c, err := sc.Config()
+	if err != nil {
+		log.Fatalf("%s: %v", *scenario, err)
+	}
+	c.SetBlendReality(*blend)
+	if *check {
+		// Don't create the pcap file.
+		c.SetPCAPFile("")
+	}
+
+	s, err := vnet.New(c)
+	if err != nil {
+		log.Fatalf("%s: %v", *scenario, err)
+	}
+	defer s.Close()
+	printNodes(sc, c)
+	if *check {
+		return
+	}
+	if *blend {
+		if err := s.PopulateDERPMapIPs(); err != nil {
+			log.Printf("warning: ignoring failure to populate DERP map: %v", err)
+		}
+	}
+
+	if _, err := os.Stat(*listen); err == nil {
+		os.Remove(*listen)
+	}
+	var srv net.Listener
+	var conn *net.UnixConn
+	if *dgram {
+		addr, err := net.ResolveUnixAddr("unixgram", *listen)
+		if err != nil {
+			log.Fatalf("ResolveUnixAddr: %v", err)
+		}
+		conn, err = net.ListenUnixgram("unixgram", addr)
+		if err != nil {
+			log.Fatalf("ListenUnixgram: %v", err)
+		}
+		defer conn.Close()
+	} else {
+		srv, err = net.Listen("unix", *listen)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for i, n := range c.Nodes() {
+		go watchNode(s, sc.Nodes[i].Name, n)
+	}
+
+	if conn != nil {
+		s.ServeUnixConn(conn, vnet.ProtocolUnixDGRAM)
+		return
+	}
+	for {
+		c, err := srv.Accept()
+		if err != nil {
+			log.Printf("Accept: %v", err)
+			continue
+		}
+		go s.ServeUnixConn(c.(*net.UnixConn), vnet.ProtocolQEMU)
+	}
+}
+
+// printNodes prints what's needed to start the VM of each node in sc, whose
+// Config is c.
+func printNodes(sc *vnet.Scenario, c *vnet.Config) {
+	fmt.Printf("scenario %s: %d networks, %d nodes\n", *scenario, len(sc.Networks), c.NumNodes())
+	for i, n := range c.Nodes() {
+		sn := sc.Nodes[i]
+		args := []string{"tailscale-tta=1"}
+		for _, e := range n.Env() {
+			args = append(args, fmt.Sprintf("tailscaled.env=%s=%s", e.Key, e.Value))
+		}
+		if n.IsV6Only() {
+			args = append(args, "tta.nameserver="+vnet.FakeDNSIPv6().String())
+		}
+		fmt.Printf("  %-12s network=%s mac=%v\n", sn.Name, sn.Network, n.MAC())
+		fmt.Printf("  %-12s kernel args: %s\n", "", strings.Join(args, " "))
+	}
+}
+
+// watchNode configures the node n, named name, once its VM's test agent
+// connects, and then logs changes to its tailscaled backend state.
+func watchNode(s *vnet.Server, name string, n *vnet.Node) {
+	nc := s.NodeAgentClient(n)
+	if n.HostFirewall() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			err := nc.EnableHostFirewall(ctx)
+			cancel()
+			if err == nil {
+				log.Printf("%s: host firewall enabled", name)
+				break
+			}
+			log.Printf("%s: enabling host firewall: %v", name, err)
+			time.Sleep(5 * time.Second)
+		}
+	}
+	var last string
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		st, err := nc.Status(ctx)
+		cancel()
+		if err == nil && st.BackendState != last {
+			last = st.BackendState
+			log.Printf("%s: backend state %s, Tailscale IPs %v", name, st.BackendState, st.TailscaleIPs)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
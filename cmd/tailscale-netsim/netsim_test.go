@@ -0,0 +1,38 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"tailscale.com/tstest/natlab/vnet"
+)
+
+func TestScenarios(t *testing.T) {
+	files, err := filepath.Glob("scenarios/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no scenarios found")
+	}
+	for _, f := range files {
+		t.Run(filepath.Base(f), func(t *testing.T) {
+			sc, err := vnet.ReadScenario(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := sc.Config()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := vnet.New(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/acl"
+	"tailscale.com/client/tailscale"
+	"tailscale.com/types/ipproto"
+)
+
+var aclArgs struct {
+	policy  string // path to a local policy file, "-" for stdin
+	apiKey  string // API access token to fetch the tailnet policy with
+	tailnet string // tailnet to fetch the policy of
+	apiBase string // control plane API server
+	proto   string // IP protocol for "acl check"
+}
+
+func newACLFlagSet(name string) *flag.FlagSet {
+	fs := newFlagSet(name)
+	fs.StringVar(&aclArgs.policy, "policy", "", `path to a policy file to evaluate, or "-" to read it from stdin; if empty, the tailnet's current policy is fetched using the API`)
+	fs.StringVar(&aclArgs.apiKey, "api-key", "", "API access token used to fetch the tailnet policy (default $TS_API_KEY)")
+	fs.StringVar(&aclArgs.tailnet, "tailnet", "-", `tailnet to fetch the policy of; "-" is the tailnet of the API access token`)
+	fs.StringVar(&aclArgs.apiBase, "api-base", "", "base URL of the API server (default https://api.tailscale.com)")
+	return fs
+}
+
+var aclCmd = &ffcli.Command{
+	Name:       "acl",
+	ShortHelp:  "Test the tailnet policy file",
+	ShortUsage: "tailscale acl <subcommand> [flags]",
+	LongHelp: strings.TrimSpace(`
+The 'tailscale acl' command evaluates a tailnet policy file locally, without
+applying it, to check which access it permits before it is shipped.
+
+The policy is read from a file with --policy, or fetched from the control
+plane using an API access token. Devices are written as in the tests of a
+policy file: a user (alice@example.com), a comma-separated list of tags
+(tag:server,tag:prod), a host alias from the policy's hosts, or an IP
+address.
+
+The evaluation covers groups, hosts, tags, ACLs, IP grants and SSH rules. The
+control plane remains the authority on what a policy permits; state that only
+it knows about, such as device postures or autogroup:admin, is not evaluated.
+`),
+	UsageFunc: usageFuncNoDefaultValues,
+	Subcommands: []*ffcli.Command{
+		{
+			Name:       "check",
+			ShortUsage: "tailscale acl check [flags] <src> <dst>:<port>",
+			ShortHelp:  "Check whether a device can connect to another",
+			Exec:       runACLCheck,
+			FlagSet: (func() *flag.FlagSet {
+				fs := newACLFlagSet("check")
+				fs.StringVar(&aclArgs.proto, "proto", "tcp", "IP protocol of the connection, by name or number")
+				return fs
+			})(),
+		},
+		{
+			Name:       "ssh",
+			ShortUsage: "tailscale acl ssh [flags] <src> <user>@<dst>",
+			ShortHelp:  "Check whether a device can SSH to another as a user",
+			Exec:       runACLSSH,
+			FlagSet:    newACLFlagSet("ssh"),
+		},
+		{
+			Name:       "test",
+			ShortUsage: "tailscale acl test [flags]",
+			ShortHelp:  "Run the tests and sshTests of the policy",
+			Exec:       runACLTest,
+			FlagSet:    newACLFlagSet("test"),
+		},
+	},
+	Exec: func(ctx context.Context, args []string) error {
+		return flag.ErrHelp
+	},
+}
+
+// loadPolicy reads and parses the policy selected by aclArgs.
+func loadPolicy(ctx context.Context) (*acl.Policy, error) {
+	var b []byte
+	var err error
+	switch aclArgs.policy {
+	case "":
+		b, err = fetchPolicy(ctx)
+	case "-":
+		b, err = io.ReadAll(os.Stdin)
+	default:
+		b, err = os.ReadFile(aclArgs.policy)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return acl.Parse(b)
+}
+
+// fetchPolicy fetches the current policy file of the tailnet from the
+// control plane API.
+func fetchPolicy(ctx context.Context) ([]byte, error) {
+	key := aclArgs.apiKey
+	if key == "" {
+		key = os.Getenv("TS_API_KEY")
+	}
+	if key == "" {
+		return nil, errors.New("no policy file given with --policy, and no API access token to fetch the tailnet policy with; set --api-key or $TS_API_KEY")
+	}
+	c := tailscale.NewClient(aclArgs.tailnet, tailscale.APIKey(key))
+	c.BaseURL = aclArgs.apiBase
+	c.UserAgent = "tailscale-cli"
+	p, err := c.ACLHuJSON(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tailnet policy: %w", err)
+	}
+	return []byte(p.ACL), nil
+}
+
+func runACLCheck(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: tailscale acl check [flags] <src> <dst>:<port>")
+	}
+	var proto ipproto.Proto
+	if err := proto.UnmarshalText([]byte(aclArgs.proto)); err != nil {
+		return err
+	}
+	p, err := loadPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	src, err := p.ParseNode(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+	dst, port, err := p.ParseDestination(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+	d := p.Check(src, dst, proto, port)
+	if !d.Allow {
+		return fmt.Errorf("deny: no rule permits %s to connect to %s over %v", args[0], args[1], proto)
+	}
+	outln("accept: permitted by", d.Rule)
+	return nil
+}
+
+func runACLSSH(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: tailscale acl ssh [flags] <src> <user>@<dst>")
+	}
+	user, dstStr, ok := strings.Cut(args[1], "@")
+	if !ok || user == "" || dstStr == "" {
+		return fmt.Errorf("invalid destination %q, want <user>@<dst>", args[1])
+	}
+	p, err := loadPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	src, err := p.ParseNode(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+	dst, err := p.ParseNode(dstStr)
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+	d := p.CheckSSH(src, dst, user)
+	switch d.Action {
+	case "accept":
+		outln("accept: permitted by", d.Rule)
+	case "check":
+		outln("check: permitted after re-authentication by", d.Rule)
+	default:
+		return fmt.Errorf("deny: no SSH rule permits %s to connect to %s as %q", args[0], dstStr, user)
+	}
+	return nil
+}
+
+func runACLTest(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	p, err := loadPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	errs := p.RunTests()
+	for _, err := range errs {
+		outln(err)
+	}
+	n := len(p.Tests) + len(p.SSHTests)
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of the policy's test assertions failed", len(errs))
+	}
+	printf("All %d policy tests passed.\n", n)
+	return nil
+}
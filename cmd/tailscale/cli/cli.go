@@ -191,12 +191,15 @@ func newRootCmd() *ffcli.Command {
 			switchCmd,
 			configureCmd,
 			syspolicyCmd,
+			configCmd,
 			netcheckCmd,
 			ipCmd,
 			dnsCmd,
 			statusCmd,
 			metricsCmd,
+			aclCmd,
 			pingCmd,
+			peerCmd,
 			ncCmd,
 			sshCmd,
 			funnelCmd(),
@@ -209,6 +212,8 @@ func newRootCmd() *ffcli.Command {
 			netlockCmd,
 			licensesCmd,
 			exitNodeCmd(),
+			locationCmd,
+			statsCmd,
 			updateCmd,
 			whoisCmd,
 			debugCmd,
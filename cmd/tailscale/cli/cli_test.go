@@ -723,6 +723,30 @@ func TestPrefsFromUpArgs(t *testing.T) {
 			},
 			wantErr: `invalid value "foo" for --exit-node; must be IP or unique node name`,
 		},
+		{
+			name: "error_exit_node_auto_bad_policy",
+			args: upArgsT{
+				exitNodeIP: "auto:fastest",
+			},
+			wantErr: `invalid --exit-node: invalid exit node expression term "fastest"`,
+		},
+		{
+			name: "auto_exit_node",
+			args: upArgsT{
+				exitNodeIP:    "auto:country=SE,hours=22:00-06:00",
+				netfilterMode: "off",
+			},
+			want: &ipn.Prefs{
+				WantRunning:         true,
+				AutoExitNode:        "country=SE,hours=22:00-06:00",
+				NetfilterMode:       preftype.NetfilterOff,
+				NoSNAT:              true,
+				NoStatefulFiltering: "true",
+				AutoUpdate: ipn.AutoUpdatePrefs{
+					Check: true,
+				},
+			},
+		},
 		{
 			name: "error_exit_node_allow_lan_without_exit_node",
 			args: upArgsT{
@@ -1035,6 +1059,7 @@ func TestUpdatePrefs(t *testing.T) {
 				AdvertiseRoutesSet:        true,
 				AdvertiseTagsSet:          true,
 				AppConnectorSet:           true,
+				AutoExitNodeSet:           true,
 				ControlURLSet:             true,
 				CorpDNSSet:                true,
 				ExitNodeAllowLANAccessSet: true,
@@ -1511,3 +1536,30 @@ func TestHelpAlias(t *testing.T) {
 		t.Fatalf("Run: %v", err)
 	}
 }
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "1234", want: 1234},
+		{in: "10K", want: 10 << 10},
+		{in: "10k", want: 10 << 10},
+		{in: "5MB", want: 5 << 20},
+		{in: "2GiB", want: 2 << 30},
+		{in: "1T", want: 1 << 40},
+		{in: "", wantErr: true},
+		{in: "G", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "1.5G", wantErr: true},
+		{in: "10000000T", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %v, %v; want %v, wantErr=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
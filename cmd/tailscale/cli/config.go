@@ -0,0 +1,125 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/client/tailscale/apitype"
+)
+
+var configCmd = &ffcli.Command{
+	Name:       "config",
+	ShortUsage: "tailscale config [validate|diff] <file>",
+	ShortHelp:  "Check a tailscaled config file without applying it",
+	LongHelp: strings.TrimSpace(`
+The 'tailscale config' commands check a tailscaled config file, as used
+with 'tailscaled --config', against the running tailscaled without
+applying it. The file is validated by tailscaled itself, so it's checked
+against the config file format of the version of tailscaled that would
+load it.
+
+A file of "-" reads the config from standard input.
+`),
+	Exec: func(ctx context.Context, args []string) error {
+		return flag.ErrHelp
+	},
+	Subcommands: []*ffcli.Command{
+		{
+			Name:       "validate",
+			ShortUsage: "tailscale config validate <file>",
+			ShortHelp:  "Check that a config file is valid",
+			Exec:       runConfigValidate,
+		},
+		{
+			Name:       "diff",
+			ShortUsage: "tailscale config diff [--json] <file>",
+			ShortHelp:  "Show what reloading a config file would change",
+			LongHelp: strings.TrimSpace(`
+The 'tailscale config diff' command shows the preferences that reloading
+the config file would change, without changing them. Preferences not set
+in the file are left as they are.
+`),
+			Exec: runConfigDiff,
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("diff")
+				fs.BoolVar(&configDiffArgs.json, "json", false, "output in JSON format")
+				return fs
+			})(),
+		},
+	},
+}
+
+var configDiffArgs struct {
+	json bool // JSON output mode
+}
+
+// validateConfigFile asks tailscaled to validate the config file named by the
+// only element of args, returning the changes applying it would make.
+func validateConfigFile(ctx context.Context, args []string) ([]apitype.ConfigChange, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected exactly one config file argument")
+	}
+	path := args[0]
+	var raw []byte
+	var err error
+	if path == "-" {
+		path = "stdin"
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return localClient.ValidateConfig(ctx, path, raw)
+}
+
+func runConfigValidate(ctx context.Context, args []string) error {
+	if _, err := validateConfigFile(ctx, args); err != nil {
+		return err
+	}
+	printf("config file is valid\n")
+	return nil
+}
+
+func runConfigDiff(ctx context.Context, args []string) error {
+	changes, err := validateConfigFile(ctx, args)
+	if err != nil {
+		return err
+	}
+	if configDiffArgs.json {
+		j, err := json.MarshalIndent(changes, "", "\t")
+		if err != nil {
+			return err
+		}
+		outln(string(j))
+		return nil
+	}
+	if len(changes) == 0 {
+		printf("no changes\n")
+		return nil
+	}
+	outln(formatConfigChanges(changes))
+	return nil
+}
+
+// formatConfigChanges formats changes as a diff of the fields' current and
+// new values.
+func formatConfigChanges(changes []apitype.ConfigChange) string {
+	var sb strings.Builder
+	for _, c := range changes {
+		fmt.Fprintf(&sb, "- %s: %s\n", c.Field, c.Old)
+		fmt.Fprintf(&sb, "+ %s: %s\n", c.Field, c.New)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
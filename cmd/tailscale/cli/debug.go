@@ -7,6 +7,8 @@
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -23,8 +25,10 @@
 	"os/exec"
 	"runtime"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
@@ -33,9 +37,11 @@
 	"tailscale.com/client/tailscale"
 	"tailscale.com/client/tailscale/apitype"
 	"tailscale.com/control/controlhttp"
+	"tailscale.com/control/netmapbundle"
 	"tailscale.com/hostinfo"
 	"tailscale.com/internal/noiseconn"
 	"tailscale.com/ipn"
+	"tailscale.com/logtail/redact"
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/net/tshttpproxy"
@@ -44,6 +50,7 @@
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
+	"tailscale.com/types/netmap"
 	"tailscale.com/util/must"
 	"tailscale.com/wgengine/capture"
 )
@@ -98,6 +105,66 @@
 				return fs
 			})(),
 		},
+		{
+			Name:       "logs",
+			ShortUsage: "tailscale debug logs <subcommand>",
+			ShortHelp:  "Access tailscaled's local on-disk logs",
+			Exec: func(ctx context.Context, args []string) error {
+				if len(args) > 0 {
+					return fmt.Errorf("unknown subcommand: %s", args[0])
+				}
+				return flag.ErrHelp
+			},
+			Subcommands: []*ffcli.Command{
+				{
+					Name:       "export",
+					ShortUsage: "tailscale debug logs export [--since=<duration>]",
+					Exec:       runDebugLogsExport,
+					ShortHelp:  "Print logs from tailscaled's local log buffer",
+					LongHelp: strings.TrimSpace(`
+Prints the logs kept in tailscaled's local, size-capped log buffer as
+newline-delimited JSON log entries. The buffer is kept even if log uploads
+are disabled, but only if tailscaled was started with --local-logs.
+`),
+					FlagSet: (func() *flag.FlagSet {
+						fs := newFlagSet("export")
+						fs.DurationVar(&debugLogsExportArgs.since, "since", 0, "only print logs from this long ago onward (e.g. 1h); zero means all buffered logs")
+						fs.StringVar(&debugLogsExportArgs.out, "o", "", "if non-empty, write logs to this file instead of stdout")
+						return fs
+					})(),
+				},
+			},
+		},
+		{
+			Name:       "log-redaction",
+			ShortUsage: "tailscale debug log-redaction [--add-regexp=<re> | --add-prefix=<cidr> | --add-field=<name>] [--replacement=<text>]\n  tailscale debug log-redaction [--set=<file> | --clear | --test=<text>]",
+			Exec:       runDebugLogRedaction,
+			ShortHelp:  "Print or change the rules that redact sensitive data from logs",
+			LongHelp: strings.TrimSpace(`
+Log redaction rules remove sensitive data, such as internal hostnames and IP
+ranges, from tailscaled's log entries before they're written to stderr, local
+logs or log sinks, or uploaded. Matches are replaced with "[redacted]", or
+the --replacement text.
+
+A rule redacts matches of a regular expression (--add-regexp), IP addresses
+in a range (--add-prefix), or the values of a field of structured log entries
+(--add-field). Rules are saved in tailscaled's state.
+
+With no flags, the command prints the rules as JSON, in the format that
+--set reads.
+`),
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("log-redaction")
+				fs.StringVar(&debugLogRedactionArgs.addRegexp, "add-regexp", "", "add a rule that redacts matches of this RE2 regular expression")
+				fs.StringVar(&debugLogRedactionArgs.addPrefix, "add-prefix", "", "add a rule that redacts IP addresses in this CIDR range")
+				fs.StringVar(&debugLogRedactionArgs.addField, "add-field", "", "add a rule that redacts the values of this field of structured log entries")
+				fs.StringVar(&debugLogRedactionArgs.replacement, "replacement", "", "text to replace the added rule's matches with; empty means "+redact.DefaultReplacement)
+				fs.StringVar(&debugLogRedactionArgs.set, "set", "", "replace all rules with those in this JSON file, or stdin if \"-\"")
+				fs.BoolVar(&debugLogRedactionArgs.clear, "clear", false, "remove all rules")
+				fs.StringVar(&debugLogRedactionArgs.test, "test", "", "print this text as the current rules would redact it, without logging it")
+				return fs
+			})(),
+		},
 		{
 			Name:       "metrics",
 			ShortUsage: "tailscale debug metrics",
@@ -194,6 +261,17 @@
 			Exec:       reloadConfig,
 			ShortHelp:  "Reload config",
 		},
+		{
+			Name:       "events",
+			ShortUsage: "tailscale debug events [--topics]",
+			Exec:       runDebugEvents,
+			ShortHelp:  "Print the events published on the internal event bus",
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("events")
+				fs.BoolVar(&debugEventsArgs.topics, "topics", false, "print the delivery statistics of each topic instead of streaming events")
+				return fs
+			})(),
+		},
 		{
 			Name:       "control-knobs",
 			ShortUsage: "tailscale debug control-knobs",
@@ -211,6 +289,23 @@
 				return fs
 			})(),
 		},
+		{
+			Name:       "policy",
+			ShortUsage: "tailscale debug policy [--json]",
+			Exec:       runSysPolicyList,
+			ShortHelp:  "Print effective policy settings and their sources",
+			LongHelp: strings.TrimSpace(`
+The 'tailscale debug policy' command prints the effective policy settings
+and where each came from, such as MDM, the Windows registry, or on Linux,
+the JSON files in /etc/tailscale/policy.d. It is the same as
+'tailscale syspolicy list'.
+`),
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("policy")
+				fs.BoolVar(&syspolicyArgs.json, "json", false, "output in JSON format")
+				return fs
+			})(),
+		},
 		{
 			Name:       "watch-ipn",
 			ShortUsage: "tailscale debug watch-ipn",
@@ -228,12 +323,38 @@
 		},
 		{
 			Name:       "netmap",
-			ShortUsage: "tailscale debug netmap",
+			ShortUsage: "tailscale debug netmap [--watch [--diff]]",
 			Exec:       runNetmap,
 			ShortHelp:  "Print the current network map",
 			FlagSet: (func() *flag.FlagSet {
 				fs := newFlagSet("netmap")
 				fs.BoolVar(&netmapArgs.showPrivateKey, "show-private-key", false, "include node private key in printed netmap")
+				fs.BoolVar(&netmapArgs.watch, "watch", false, "keep printing the network map as it changes")
+				fs.BoolVar(&netmapArgs.diff, "diff", false, "with --watch, print a summary of the changes to the network map instead of the whole network map")
+				return fs
+			})(),
+		},
+		{
+			Name: "netmap-bundle",
+			ShortUsage: "tailscale debug netmap-bundle --key=<private-key.pem> [--out=<file>]\n" +
+				"tailscale debug netmap-bundle --generate-key=<private-key.pem>",
+			Exec:      runNetmapBundle,
+			ShortHelp: "Write a signed bundle of the current network map, for use offline",
+			LongHelp: strings.TrimSpace(`
+Writes a signed bundle of this node's current network map. When tailscaled
+is run with TS_STATIC_NETMAP set to the bundle's path, and
+TS_STATIC_NETMAP_KEY set to the path of the signing key's public key, it uses
+the bundle's network map instead of contacting the control server, such as in
+an air-gapped lab. The bundle is only usable by this node.
+
+The signing key is a PEM-encoded ed25519 private key. Use --generate-key to
+create one, along with its public key in a file named with an added ".pub".
+`),
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("netmap-bundle")
+				fs.StringVar(&netmapBundleArgs.key, "key", "", "path of the PEM-encoded ed25519 private key to sign the bundle with")
+				fs.StringVar(&netmapBundleArgs.out, "out", "", "path to write the bundle to, rather than stdout")
+				fs.StringVar(&netmapBundleArgs.generateKey, "generate-key", "", "generate a new signing key, writing it to the given path and its public key to the path with an added \".pub\"")
 				return fs
 			})(),
 		},
@@ -287,12 +408,26 @@
 		},
 		{
 			Name:       "capture",
-			ShortUsage: "tailscale debug capture",
+			ShortUsage: "tailscale debug capture [flags] [filter expression]",
 			Exec:       runCapture,
 			ShortHelp:  "Streams pcaps for debugging",
+			LongHelp: strings.TrimSpace(`
+The 'tailscale debug capture' command streams a capture of the packets
+traversing tailscaled, along with the disco frames it receives.
+
+The capture can be limited to the packets matching a tcpdump-style filter
+expression made of the primitives "[src|dst] host ADDR", "[src|dst] net
+PREFIX", "[src|dst] port N", "proto NAME", "tcp", "udp", "icmp", "icmp6",
+"tsmp", "sctp", "disco", "inbound" and "outbound", combined with "and", "or",
+"not" and parentheses. For example:
+
+  tailscale debug capture --peer=myserver tcp port 22 or disco
+`),
 			FlagSet: (func() *flag.FlagSet {
 				fs := newFlagSet("capture")
 				fs.StringVar(&captureArgs.outFile, "o", "", "path to stream the pcap (or - for stdout), leave empty to start wireshark")
+				fs.StringVar(&captureArgs.peer, "peer", "", "only capture packets to and from this peer, by hostname or Tailscale IP")
+				fs.StringVar(&captureArgs.format, "format", "pcap", `capture file format: "pcap" or "pcapng"; pcapng annotates each packet with its Tailscale metadata`)
 				return fs
 			})(),
 		},
@@ -339,6 +474,43 @@
 				return fs
 			})(),
 		},
+		{
+			Name:       "firewall",
+			ShortUsage: "tailscale debug firewall [--json]",
+			Exec:       runDebugFirewall,
+			ShortHelp:  "Prints the Windows firewall filters installed by Tailscale",
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("firewall")
+				fs.BoolVar(&debugFirewallArgs.json, "json", false, "output in JSON format, including each filter's conditions")
+				return fs
+			})(),
+		},
+		{
+			Name:       "flows",
+			ShortUsage: "tailscale debug flows [--json]",
+			Exec:       runDebugFlows,
+			ShortHelp:  "Prints the connections most recently let through by the packet filter",
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("flows")
+				fs.BoolVar(&debugFlowsArgs.json, "json", false, "output in JSON format")
+				return fs
+			})(),
+		},
+		{
+			Name:       "kill-flow",
+			ShortUsage: "tailscale debug kill-flow <id>",
+			Exec:       runDebugKillFlow,
+			ShortHelp:  "Drops the packets of a connection listed by 'tailscale debug flows'",
+			LongHelp: strings.TrimSpace(`
+The 'tailscale debug kill-flow' command makes the packet filter drop the
+packets of a connection in both directions, such as to cut off a peer whose
+access was revoked mid-session or to clear a wedged long-lived connection.
+
+The endpoints aren't told, so the connection stalls until they time it out.
+Packets are dropped for 10 minutes, or for TCP until the side that started
+the connection starts a new one from the same port.
+`),
+		},
 		{
 			Name:       "go-buildinfo",
 			ShortUsage: "tailscale debug go-buildinfo",
@@ -545,11 +717,19 @@ func runWatchIPN(ctx context.Context, args []string) error {
 
 var netmapArgs struct {
 	showPrivateKey bool
+	watch          bool
+	diff           bool
 }
 
 func runNetmap(ctx context.Context, args []string) error {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+	if netmapArgs.diff && !netmapArgs.watch {
+		return errors.New("--diff requires --watch")
+	}
+	if !netmapArgs.watch {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+	}
 
 	var mask ipn.NotifyWatchOpt = ipn.NotifyInitialNetMap
 	if !netmapArgs.showPrivateKey {
@@ -561,12 +741,100 @@ func runNetmap(ctx context.Context, args []string) error {
 	}
 	defer watcher.Close()
 
-	n, err := watcher.Next()
+	var last *netmap.NetworkMap
+	for {
+		n, err := watcher.Next()
+		if err != nil {
+			return err
+		}
+		if n.NetMap == nil {
+			continue
+		}
+		if netmapArgs.diff {
+			// The first netmap is diffed against none, listing all peers.
+			for _, c := range netmap.Diff(last, n.NetMap) {
+				fmt.Printf("%s %v\n", time.Now().Format(time.TimeOnly), c)
+			}
+		} else {
+			j, _ := json.MarshalIndent(n.NetMap, "", "\t")
+			fmt.Printf("%s\n", j)
+		}
+		if !netmapArgs.watch {
+			return nil
+		}
+		last = n.NetMap
+	}
+}
+
+var netmapBundleArgs struct {
+	key         string
+	out         string
+	generateKey string
+}
+
+func runNetmapBundle(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	if path := netmapBundleArgs.generateKey; path != "" {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		privPEM, pubPEM, err := netmapbundle.EncodeKeys(priv)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, privPEM, 0600); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path+".pub", pubPEM, 0644); err != nil {
+			return err
+		}
+		printf("Wrote private key to %s and public key to %s.pub\n", path, path)
+		return nil
+	}
+	if netmapBundleArgs.key == "" {
+		return errors.New("--key is required")
+	}
+	priv, err := netmapbundle.ReadPrivateKey(netmapBundleArgs.key)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	watcher, err := localClient.WatchIPNBus(ctx, ipn.NotifyInitialNetMap|ipn.NotifyNoPrivateKeys)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	var nm *netmap.NetworkMap
+	for nm == nil {
+		n, err := watcher.Next()
+		if err != nil {
+			return fmt.Errorf("waiting for network map: %w", err)
+		}
+		nm = n.NetMap
+	}
+
+	bundle, err := netmapbundle.Sign(netmapbundle.FromNetmap(nm), priv)
 	if err != nil {
 		return err
 	}
-	j, _ := json.MarshalIndent(n.NetMap, "", "\t")
-	fmt.Printf("%s\n", j)
+	j, err := json.MarshalIndent(bundle, "", "\t")
+	if err != nil {
+		return err
+	}
+	j = append(j, '\n')
+	if netmapBundleArgs.out == "" {
+		Stdout.Write(j)
+		return nil
+	}
+	if err := os.WriteFile(netmapBundleArgs.out, j, 0644); err != nil {
+		return err
+	}
+	printf("Wrote bundle of network map with %d peers to %s\n", len(nm.Peers), netmapBundleArgs.out)
 	return nil
 }
 
@@ -703,6 +971,164 @@ func runDaemonLogs(ctx context.Context, args []string) error {
 	}
 }
 
+var debugEventsArgs struct {
+	topics bool
+}
+
+func runDebugEvents(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	if debugEventsArgs.topics {
+		v, err := localClient.DebugResultJSON(ctx, "bus-topics")
+		if err != nil {
+			return err
+		}
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	}
+	events, err := localClient.StreamBusEvents(ctx)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(events)
+	for {
+		var ev struct {
+			Time  time.Time
+			Topic string
+			Event json.RawMessage
+		}
+		if err := d.Decode(&ev); err != nil {
+			return err
+		}
+		fmt.Printf("%s %s: %s\n", ev.Time.Format("15:04:05.000"), ev.Topic, ev.Event)
+	}
+}
+
+var debugLogsExportArgs struct {
+	since time.Duration
+	out   string
+}
+
+func runDebugLogsExport(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	logs, err := localClient.ExportLocalLogs(ctx, debugLogsExportArgs.since)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+	if debugLogsExportArgs.out == "" {
+		_, err = io.Copy(Stdout, logs)
+		return err
+	}
+	f, err := os.Create(debugLogsExportArgs.out)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, logs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var debugLogRedactionArgs struct {
+	addRegexp   string
+	addPrefix   string
+	addField    string
+	replacement string
+	set         string
+	clear       bool
+	test        string
+}
+
+func runDebugLogRedaction(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	a := &debugLogRedactionArgs
+	var add *redact.Rule
+	nAdd := 0
+	if a.addRegexp != "" {
+		nAdd++
+		add = &redact.Rule{Regexp: a.addRegexp}
+	}
+	if a.addPrefix != "" {
+		nAdd++
+		pfx, err := netip.ParsePrefix(a.addPrefix)
+		if err != nil {
+			return fmt.Errorf("invalid --add-prefix: %w", err)
+		}
+		add = &redact.Rule{Prefix: pfx.Masked()}
+	}
+	if a.addField != "" {
+		nAdd++
+		add = &redact.Rule{Field: a.addField}
+	}
+	nActions := nAdd
+	for _, set := range []bool{a.set != "", a.clear, a.test != ""} {
+		if set {
+			nActions++
+		}
+	}
+	if nActions > 1 {
+		return errors.New("at most one of --add-regexp, --add-prefix, --add-field, --set, --clear and --test may be used")
+	}
+	if a.replacement != "" && add == nil {
+		return errors.New("--replacement requires --add-regexp, --add-prefix or --add-field")
+	}
+
+	switch {
+	case add != nil:
+		add.Replacement = a.replacement
+		rules, err := localClient.LogRedactionRules(ctx)
+		if err != nil {
+			return err
+		}
+		return localClient.SetLogRedactionRules(ctx, append(rules, *add))
+	case a.set != "":
+		var j []byte
+		var err error
+		if a.set == "-" {
+			j, err = io.ReadAll(os.Stdin)
+		} else {
+			j, err = os.ReadFile(a.set)
+		}
+		if err != nil {
+			return err
+		}
+		var rules []redact.Rule
+		if err := json.Unmarshal(j, &rules); err != nil {
+			return fmt.Errorf("parsing rules: %w", err)
+		}
+		return localClient.SetLogRedactionRules(ctx, rules)
+	case a.clear:
+		return localClient.SetLogRedactionRules(ctx, nil)
+	}
+
+	rules, err := localClient.LogRedactionRules(ctx)
+	if err != nil {
+		return err
+	}
+	if a.test != "" {
+		r, err := redact.New(rules)
+		if err != nil {
+			return err
+		}
+		outln(string(r.Redact([]byte(a.test))))
+		return nil
+	}
+	if rules == nil {
+		rules = []redact.Rule{}
+	}
+	e := json.NewEncoder(Stdout)
+	e.SetIndent("", "\t")
+	return e.Encode(rules)
+}
+
 var metricsArgs struct {
 	watch bool
 }
@@ -1038,10 +1464,27 @@ func runSetExpire(ctx context.Context, args []string) error {
 
 var captureArgs struct {
 	outFile string
+	peer    string
+	format  string
 }
 
 func runCapture(ctx context.Context, args []string) error {
-	stream, err := localClient.StreamDebugCapture(ctx)
+	filter := strings.Join(args, " ")
+	if captureArgs.peer != "" {
+		pf, err := capturePeerFilter(ctx, captureArgs.peer)
+		if err != nil {
+			return err
+		}
+		if filter != "" {
+			filter = pf + " and (" + filter + ")"
+		} else {
+			filter = pf
+		}
+	}
+	stream, err := localClient.StreamDebugCaptureWithOpts(ctx, &tailscale.DebugCaptureOpts{
+		Filter: filter,
+		Format: captureArgs.format,
+	})
 	if err != nil {
 		return err
 	}
@@ -1080,6 +1523,31 @@ func runCapture(ctx context.Context, args []string) error {
 	return err
 }
 
+// capturePeerFilter returns a capture filter expression matching the
+// Tailscale IPs of peer, which is a peer's hostname, MagicDNS name or one of
+// its Tailscale IPs.
+func capturePeerFilter(ctx context.Context, peer string) (string, error) {
+	st, err := localClient.Status(ctx)
+	if err != nil {
+		return "", err
+	}
+	ip, _ := netip.ParseAddr(peer)
+	for _, ps := range st.Peer {
+		if !strings.EqualFold(peer, dnsOrQuoteHostname(st, ps)) && peer != ps.DNSName && !slices.Contains(ps.TailscaleIPs, ip) {
+			continue
+		}
+		if len(ps.TailscaleIPs) == 0 {
+			return "", fmt.Errorf("peer %q has no Tailscale IPs", peer)
+		}
+		hosts := make([]string, len(ps.TailscaleIPs))
+		for i, ip := range ps.TailscaleIPs {
+			hosts[i] = "host " + ip.String()
+		}
+		return "(" + strings.Join(hosts, " or ") + ")", nil
+	}
+	return "", fmt.Errorf("no peer found matching %q", peer)
+}
+
 var debugPortmapArgs struct {
 	duration    time.Duration
 	gatewayAddr string
@@ -1270,3 +1738,84 @@ func runDebugResolve(ctx context.Context, args []string) error {
 	}
 	return nil
 }
+
+var debugFirewallArgs struct {
+	json bool
+}
+
+var debugFlowsArgs struct {
+	json bool
+}
+
+func runDebugFlows(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	flows, err := localClient.DebugFlows(ctx)
+	if err != nil {
+		return err
+	}
+	if debugFlowsArgs.json {
+		e := json.NewEncoder(Stdout)
+		e.SetIndent("", "\t")
+		return e.Encode(flows)
+	}
+	if len(flows) == 0 {
+		outln("No flows.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(Stdout, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPROTO\tDIR\tSRC\tDST\tAGE")
+	for _, f := range flows {
+		dir := "out"
+		if f.Inbound {
+			dir = "in"
+		}
+		age := time.Since(f.Created).Round(time.Second).String()
+		if f.Killed {
+			age += " (killed)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", f.ID, f.Proto, dir, f.Src, f.Dst, age)
+	}
+	return tw.Flush()
+}
+
+func runDebugKillFlow(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tailscale debug kill-flow <id>")
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid flow ID %q", args[0])
+	}
+	return localClient.DebugKillFlow(ctx, id)
+}
+
+func runDebugFirewall(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	rules, err := localClient.DebugFirewallRules(ctx)
+	if err != nil {
+		return err
+	}
+	if debugFirewallArgs.json {
+		e := json.NewEncoder(Stdout)
+		e.SetIndent("", "\t")
+		return e.Encode(rules)
+	}
+	if len(rules) == 0 {
+		outln("No Tailscale firewall filters are installed.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(Stdout, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "WEIGHT\tNAME\tPURPOSE\tID")
+	for _, r := range rules {
+		name := r.Name
+		if r.Disabled {
+			name += " (disabled)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", r.Weight, name, r.Purpose, r.ID)
+	}
+	return tw.Flush()
+}
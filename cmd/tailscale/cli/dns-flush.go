@@ -0,0 +1,20 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+func runDNSFlush(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected non-flag arguments to 'tailscale dns flush'")
+	}
+	if err := localClient.FlushDNS(ctx); err != nil {
+		return fmt.Errorf("failed to flush DNS caches: %w", err)
+	}
+	return nil
+}
@@ -26,15 +26,28 @@ func runDNSQuery(ctx context.Context, args []string) error {
 	}
 	fmt.Printf("DNS query for %q (%s) using internal resolver:\n", name, queryType)
 	fmt.Println()
-	bytes, resolvers, err := localClient.QueryDNS(ctx, name, queryType)
+	res, err := localClient.QueryDNSRoute(ctx, name, queryType)
 	if err != nil {
 		fmt.Printf("failed to query DNS: %v\n", err)
 		return nil
 	}
 
+	resolvers := res.Resolvers
+	switch {
+	case res.Local:
+		fmt.Println("Answered by the internal resolver (MagicDNS name or authoritative domain)")
+	case res.Route == ".":
+		fmt.Println("Matched the default route")
+	case res.Route != "":
+		fmt.Printf("Matched split DNS route: %s\n", res.Route)
+	case len(resolvers) > 0:
+		fmt.Println("Matched no route; using the fallback resolvers")
+	default:
+		fmt.Println("Matched no route, and there are no fallback resolvers")
+	}
 	if len(resolvers) == 1 {
 		fmt.Printf("Forwarding to resolver: %v\n", makeResolverString(*resolvers[0]))
-	} else {
+	} else if len(resolvers) > 1 {
 		fmt.Println("Multiple resolvers available:")
 		for _, r := range resolvers {
 			fmt.Printf("  - %v\n", makeResolverString(*r))
@@ -42,7 +55,7 @@ func runDNSQuery(ctx context.Context, args []string) error {
 	}
 	fmt.Println()
 	var p dnsmessage.Parser
-	header, err := p.Start(bytes)
+	header, err := p.Start(res.Bytes)
 	if err != nil {
 		fmt.Printf("failed to parse DNS response: %v\n", err)
 		return err
@@ -33,7 +33,14 @@
 			ShortUsage: "tailscale dns query <name> [a|aaaa|cname|mx|ns|opt|ptr|srv|txt]",
 			Exec:       runDNSQuery,
 			ShortHelp:  "Perform a DNS query",
-			LongHelp:   "The 'tailscale dns query' subcommand performs a DNS query for the specified name using the internal DNS forwarder (100.100.100.100).\n\nIt also provides information about the resolver(s) used to resolve the query.",
+			LongHelp:   "The 'tailscale dns query' subcommand performs a DNS query for the specified name using the internal DNS forwarder (100.100.100.100).\n\nIt also reports whether the query was answered locally or which DNS route matched it, and the resolver(s) used to resolve the query.",
+		},
+		{
+			Name:       "flush",
+			ShortUsage: "tailscale dns flush",
+			Exec:       runDNSFlush,
+			ShortHelp:  "Flushes the operating system's DNS cache",
+			LongHelp:   "The 'tailscale dns flush' subcommand flushes the DNS cache of the operating system's resolver, where Tailscale knows how to (Windows and systemd-resolved), so that changes to DNS records or routes take effect immediately.",
 		},
 
 		// TODO: implement `tailscale log` here
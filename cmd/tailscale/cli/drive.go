@@ -5,21 +5,31 @@
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/drive"
 )
 
 const (
-	driveShareUsage   = "tailscale drive share <name> <path>"
+	driveShareUsage   = "tailscale drive share [--read-only] [--max-size=<size>] <name> <path>"
 	driveRenameUsage  = "tailscale drive rename <oldname> <newname>"
 	driveUnshareUsage = "tailscale drive unshare <name>"
 	driveListUsage    = "tailscale drive list"
+	driveStatusUsage  = "tailscale drive status"
 )
 
+var driveShareArgs struct {
+	readOnly bool
+	maxSize  string
+}
+
 var driveCmd = &ffcli.Command{
 	Name:      "drive",
 	ShortHelp: "Share a directory with your tailnet",
@@ -28,6 +38,7 @@
 		driveRenameUsage,
 		driveUnshareUsage,
 		driveListUsage,
+		driveStatusUsage,
 	}, "\n"),
 	LongHelp:  buildShareLongHelp(),
 	UsageFunc: usageFuncNoDefaultValues,
@@ -37,6 +48,12 @@
 			ShortUsage: driveShareUsage,
 			Exec:       runDriveShare,
 			ShortHelp:  "[ALPHA] Create or modify a share",
+			FlagSet: (func() *flag.FlagSet {
+				fs := newFlagSet("share")
+				fs.BoolVar(&driveShareArgs.readOnly, "read-only", false, "prevent remote nodes from modifying the share, whatever access ACLs grant them")
+				fs.StringVar(&driveShareArgs.maxSize, "max-size", "", "maximum total size of the files in the share, in bytes or with a K, M, G or T suffix (such as 10G); empty means no limit")
+				return fs
+			})(),
 		},
 		{
 			Name:       "rename",
@@ -56,6 +73,12 @@
 			ShortHelp:  "[ALPHA] List current shares",
 			Exec:       runDriveList,
 		},
+		{
+			Name:       "status",
+			ShortUsage: driveStatusUsage,
+			ShortHelp:  "[ALPHA] Show shares with their limits and recent accesses by remote nodes",
+			Exec:       runDriveStatus,
+		},
 	},
 }
 
@@ -71,10 +94,19 @@ func runDriveShare(ctx context.Context, args []string) error {
 	if err != nil {
 		return err
 	}
+	var maxSize int64
+	if driveShareArgs.maxSize != "" {
+		maxSize, err = parseByteSize(driveShareArgs.maxSize)
+		if err != nil {
+			return fmt.Errorf("invalid --max-size: %w", err)
+		}
+	}
 
 	err = localClient.DriveShareSet(ctx, &drive.Share{
-		Name: name,
-		Path: absolutePath,
+		Name:     name,
+		Path:     absolutePath,
+		ReadOnly: driveShareArgs.readOnly,
+		MaxSize:  maxSize,
 	})
 	if err == nil {
 		fmt.Printf("Sharing %q as %q\n", path, name)
@@ -146,6 +178,73 @@ func runDriveList(ctx context.Context, args []string) error {
 	return nil
 }
 
+// runDriveStatus is the entry point for the "tailscale drive status" command.
+func runDriveStatus(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s", driveStatusUsage)
+	}
+
+	st, err := localClient.DriveStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(w, "name\tlimits\taccesses\tsent\treceived\tlast access")
+	fmt.Fprintln(w, "----\t------\t--------\t----\t--------\t-----------")
+	for _, ss := range st.Shares {
+		var limits []string
+		if ss.Share.ReadOnly {
+			limits = append(limits, "read-only")
+		}
+		if ss.Share.MaxSize > 0 {
+			limits = append(limits, "max "+formatIEC(float64(ss.Share.MaxSize), "B"))
+		}
+		lastAccess := "-"
+		if !ss.LastAccess.IsZero() {
+			lastAccess = ss.LastAccess.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", ss.Share.Name, strings.Join(limits, ", "), ss.Accesses,
+			formatIEC(float64(ss.BytesSent), "B"), formatIEC(float64(ss.BytesReceived), "B"), lastAccess)
+	}
+	w.Flush()
+
+	if len(st.RecentAccesses) > 0 {
+		fmt.Println()
+		fmt.Println("Recent accesses:")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, ev := range st.RecentAccesses {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t%s\t%s\n", ev.Time.Local().Format("2006-01-02 15:04:05"), ev.Node, ev.User, ev.Status, ev.Method, ev.Share+ev.Path)
+		}
+		w.Flush()
+	}
+	if st.AuditLogPath != "" {
+		fmt.Printf("\nAll accesses are logged to %s\n", st.AuditLogPath)
+	}
+	return nil
+}
+
+// parseByteSize parses a size in bytes, optionally with a K, M, G or T suffix
+// for a power of 1024 bytes, optionally followed by "B" or "iB".
+func parseByteSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	shift := 0
+	if i := len(num) - 1; i >= 0 {
+		if j := strings.IndexByte("KMGT", num[i]); j >= 0 {
+			shift = 10 * (j + 1)
+			num = num[:i]
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n > (1<<63-1)>>shift {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n << shift, nil
+}
+
 func buildShareLongHelp() string {
 	longHelpAs := ""
 	if drive.AllowShareAs() {
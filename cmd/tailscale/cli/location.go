@@ -0,0 +1,262 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/ipn"
+)
+
+var locationCmd = &ffcli.Command{
+	Name:       "location",
+	ShortUsage: "tailscale location [status|add|remove] ...",
+	ShortHelp:  "Manage preferences that apply on particular networks",
+	LongHelp: strings.TrimSpace(`
+Location profiles override preferences while this machine is connected to
+particular networks, such as not accepting routes at the office or using
+an exit node on public Wi-Fi. A network is identified by any combination
+of its Wi-Fi SSID, the MAC address of its default gateway, and its DNS
+search domain. When the machine leaves the network, the preferences are
+restored to their previous values.
+
+'tailscale location status' shows the identity of the current network.
+`),
+	Exec: runLocationStatus,
+	Subcommands: []*ffcli.Command{
+		{
+			Name:       "status",
+			ShortUsage: "tailscale location status",
+			ShortHelp:  "Show the current network and the location profiles",
+			Exec:       runLocationStatus,
+		},
+		{
+			Name:       "add",
+			ShortUsage: "tailscale location add [flags] <name>",
+			ShortHelp:  "Add a location profile",
+			Exec:       runLocationAdd,
+			FlagSet:    locationAddFlagSet,
+		},
+		{
+			Name:       "remove",
+			ShortUsage: "tailscale location remove <name>",
+			ShortHelp:  "Remove a location profile",
+			Exec:       runLocationRemove,
+		},
+	},
+}
+
+var locationAddArgs struct {
+	current    bool
+	ssid       string
+	gatewayMAC string
+	domain     string
+
+	acceptRoutes     bool
+	acceptDNS        bool
+	shieldsUp        bool
+	exitNode         string
+	exitNodeAllowLAN bool
+}
+
+var locationAddFlagSet = (func() *flag.FlagSet {
+	fs := newFlagSet("add")
+	fs.BoolVar(&locationAddArgs.current, "current", false, "match the network this machine is currently connected to")
+	fs.StringVar(&locationAddArgs.ssid, "ssid", "", "match networks with this Wi-Fi SSID")
+	fs.StringVar(&locationAddArgs.gatewayMAC, "gateway-mac", "", "match networks whose default gateway has this MAC address")
+	fs.StringVar(&locationAddArgs.domain, "domain", "", "match networks with this DNS search domain")
+	fs.BoolVar(&locationAddArgs.acceptRoutes, "accept-routes", false, "accept routes advertised by other Tailscale nodes on this network")
+	fs.BoolVar(&locationAddArgs.acceptDNS, "accept-dns", false, "accept DNS configuration from the admin panel on this network")
+	fs.BoolVar(&locationAddArgs.shieldsUp, "shields-up", false, "don't allow incoming connections on this network")
+	fs.StringVar(&locationAddArgs.exitNode, "exit-node", "", "Tailscale exit node (IP, base name, or auto:<policy>) to use on this network; empty to use none")
+	fs.BoolVar(&locationAddArgs.exitNodeAllowLAN, "exit-node-allow-lan-access", false, "allow direct access to the local network when routing traffic via an exit node on this network")
+	return fs
+})()
+
+func runLocationStatus(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected non-flag arguments to 'tailscale location status'")
+	}
+	st, err := localClient.LocationStatus(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	printf("Current network:\n")
+	if st.Network.IsZero() {
+		printf("  (not identified)\n")
+	}
+	if st.Network.SSID != "" {
+		printf("  SSID:        %s\n", st.Network.SSID)
+	}
+	if st.Network.GatewayMAC != "" {
+		printf("  Gateway MAC: %s\n", st.Network.GatewayMAC)
+	}
+	if st.Network.Domain != "" {
+		printf("  Domain:      %s\n", st.Network.Domain)
+	}
+	if len(st.Profiles) == 0 {
+		printf("\nNo location profiles. Add one with 'tailscale location add'.\n")
+		return nil
+	}
+	printf("\n")
+	w := tabwriter.NewWriter(Stdout, 10, 5, 5, ' ', 0)
+	fmt.Fprintf(w, "NAME\tMATCH\tOVERRIDES\tACTIVE\n")
+	for _, p := range st.Profiles {
+		var active string
+		if p.Name == st.Active {
+			active = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, p.Match, locationPrefsString(p.Prefs), active)
+	}
+	return w.Flush()
+}
+
+// locationPrefsString returns the overrides of p in the form of the flags
+// of 'tailscale location add'.
+func locationPrefsString(p ipn.LocationPrefs) string {
+	var terms []string
+	if p.RouteAll != nil {
+		terms = append(terms, fmt.Sprintf("accept-routes=%v", *p.RouteAll))
+	}
+	if p.CorpDNS != nil {
+		terms = append(terms, fmt.Sprintf("accept-dns=%v", *p.CorpDNS))
+	}
+	if p.ShieldsUp != nil {
+		terms = append(terms, fmt.Sprintf("shields-up=%v", *p.ShieldsUp))
+	}
+	if e := p.ExitNode; e != nil {
+		var v string
+		switch {
+		case e.Auto != "":
+			v = e.Auto.String()
+		case e.IP.IsValid():
+			v = e.IP.String()
+		case !e.ID.IsZero():
+			v = string(e.ID)
+		}
+		terms = append(terms, fmt.Sprintf("exit-node=%q", v))
+	}
+	if p.ExitNodeAllowLANAccess != nil {
+		terms = append(terms, fmt.Sprintf("exit-node-allow-lan-access=%v", *p.ExitNodeAllowLANAccess))
+	}
+	if len(terms) == 0 {
+		return "-"
+	}
+	return strings.Join(terms, " ")
+}
+
+func runLocationAdd(ctx context.Context, args []string) error {
+	if len(args) != 1 || args[0] == "" {
+		return errors.New("usage: tailscale location add [flags] <name>")
+	}
+	prof := ipn.LocationProfile{
+		Name: args[0],
+		Match: ipn.LocationMatch{
+			SSID:   locationAddArgs.ssid,
+			Domain: strings.ToLower(strings.TrimSuffix(locationAddArgs.domain, ".")),
+		},
+	}
+	if locationAddArgs.gatewayMAC != "" {
+		mac, err := net.ParseMAC(locationAddArgs.gatewayMAC)
+		if err != nil {
+			return fmt.Errorf("invalid --gateway-mac: %w", err)
+		}
+		prof.Match.GatewayMAC = mac.String()
+	}
+
+	st, err := localClient.LocationStatus(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	if slices.ContainsFunc(st.Profiles, func(p ipn.LocationProfile) bool { return p.Name == prof.Name }) {
+		return fmt.Errorf("location profile %q already exists; remove it first", prof.Name)
+	}
+	if locationAddArgs.current {
+		if st.Network.IsZero() {
+			return errors.New("the current network could not be identified; use --ssid, --gateway-mac or --domain")
+		}
+		if prof.Match.SSID == "" {
+			prof.Match.SSID = st.Network.SSID
+		}
+		if prof.Match.GatewayMAC == "" {
+			prof.Match.GatewayMAC = st.Network.GatewayMAC
+		}
+		if prof.Match.Domain == "" {
+			prof.Match.Domain = st.Network.Domain
+		}
+	}
+	if prof.Match.IsZero() {
+		return errors.New("no network to match; use --current, --ssid, --gateway-mac or --domain")
+	}
+
+	var visitErr error
+	locationAddFlagSet.Visit(func(f *flag.Flag) {
+		a := &locationAddArgs
+		switch f.Name {
+		case "accept-routes":
+			prof.Prefs.RouteAll = &a.acceptRoutes
+		case "accept-dns":
+			prof.Prefs.CorpDNS = &a.acceptDNS
+		case "shields-up":
+			prof.Prefs.ShieldsUp = &a.shieldsUp
+		case "exit-node-allow-lan-access":
+			prof.Prefs.ExitNodeAllowLANAccess = &a.exitNodeAllowLAN
+		case "exit-node":
+			prof.Prefs.ExitNode, visitErr = locationExitNode(ctx, a.exitNode)
+		}
+	})
+	if visitErr != nil {
+		return visitErr
+	}
+	if prof.Prefs.IsZero() {
+		return errors.New("no preferences to override; see 'tailscale location add --help'")
+	}
+	return localClient.SetLocationProfiles(ctx, append(st.Profiles, prof))
+}
+
+// locationExitNode returns the exit node selection for the --exit-node flag
+// value s of 'tailscale location add'.
+func locationExitNode(ctx context.Context, s string) (*ipn.LocationExitNode, error) {
+	if s == "" {
+		return new(ipn.LocationExitNode), nil
+	}
+	if expr, ok := ipn.ParseAutoExitNodeString(s); ok {
+		if _, err := expr.Policy(); err != nil {
+			return nil, fmt.Errorf("invalid --exit-node: %w", err)
+		}
+		return &ipn.LocationExitNode{Auto: expr}, nil
+	}
+	st, err := localClient.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var p ipn.Prefs
+	if err := p.SetExitNodeIP(s, st); err != nil {
+		return nil, fmt.Errorf("invalid --exit-node: %w", err)
+	}
+	return &ipn.LocationExitNode{IP: p.ExitNodeIP}, nil
+}
+
+func runLocationRemove(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tailscale location remove <name>")
+	}
+	st, err := localClient.LocationStatus(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	profiles := slices.DeleteFunc(st.Profiles, func(p ipn.LocationProfile) bool { return p.Name == args[0] })
+	if len(profiles) == len(st.Profiles) {
+		return fmt.Errorf("no location profile %q", args[0])
+	}
+	return localClient.SetLocationProfiles(ctx, profiles)
+}
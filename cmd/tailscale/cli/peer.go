@@ -0,0 +1,94 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+var peerCmd = &ffcli.Command{
+	Name:       "peer",
+	ShortUsage: "tailscale peer info [--json] <hostname-or-IP>",
+	ShortHelp:  "Show information reported by other nodes",
+	LongHelp: strings.TrimSpace(`
+'tailscale peer info' shows the version, uptime, health warnings and path
+statistics that a node reports about itself. The node must grant this node
+the tailscale.com/cap/node-info peer capability in the tailnet policy file.
+`),
+	Subcommands: []*ffcli.Command{
+		{
+			Name:       "info",
+			ShortUsage: "tailscale peer info [--json] <hostname-or-IP>",
+			ShortHelp:  "Show a node's self-reported version, health and path statistics",
+			Exec:       runPeerInfo,
+			FlagSet: func() *flag.FlagSet {
+				fs := newFlagSet("info")
+				fs.BoolVar(&peerInfoArgs.json, "json", false, "output in JSON format")
+				return fs
+			}(),
+		},
+	},
+}
+
+var peerInfoArgs struct {
+	json bool // output in JSON format
+}
+
+func runPeerInfo(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("too many arguments, expected at most one peer")
+	} else if len(args) == 0 {
+		return errors.New("missing argument, expected one peer")
+	}
+	ipStr, _, err := tailscaleIPFromArg(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(ipStr)
+	if err != nil {
+		return err
+	}
+	ni, err := localClient.PeerInfo(ctx, ip)
+	if err != nil {
+		return err
+	}
+	if peerInfoArgs.json {
+		ec := json.NewEncoder(Stdout)
+		ec.SetIndent("", "  ")
+		ec.Encode(ni)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(Stdout, 10, 5, 5, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", ni.Hostname)
+	fmt.Fprintf(w, "OS:\t%s\n", ni.OS)
+	fmt.Fprintf(w, "Version:\t%s\n", ni.Version)
+	fmt.Fprintf(w, "State:\t%s\n", ni.BackendState)
+	if !ni.StartTime.IsZero() {
+		fmt.Fprintf(w, "Uptime:\t%v\n", time.Since(ni.StartTime).Round(time.Second))
+	}
+	w.Flush()
+
+	if len(ni.Health) > 0 {
+		printf("Health:\n")
+		for _, h := range ni.Health {
+			printf("  - %s\n", h)
+		}
+	}
+	if len(ni.Paths) > 0 {
+		printf("\nPaths from the peer to this node:\n")
+		writePathStats(ni.Paths)
+	}
+	return nil
+}
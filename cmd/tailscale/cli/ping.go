@@ -4,6 +4,7 @@
 package cli
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"flag"
@@ -12,7 +13,10 @@
 	"net"
 	"net/netip"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
@@ -40,6 +44,10 @@
 By default, 'tailscale ping' stops after 10 pings or once a direct
 (non-DERP) path has been established, whichever comes first.
 
+With --verbose, pongs via DERP are followed by the likely reasons that
+there's no direct path yet, such as both sides being behind hard NATs or
+UDP being blocked, derived from the NAT traversal state of both nodes.
+
 The provided hostname must resolve to or be a Tailscale IP
 (e.g. 100.x.y.z) or a subnet IP advertised by a Tailscale
 relay node.
@@ -56,6 +64,7 @@
 		fs.IntVar(&pingArgs.num, "c", 10, "max number of pings to send. 0 for infinity.")
 		fs.DurationVar(&pingArgs.timeout, "timeout", 5*time.Second, "timeout before giving up on a ping")
 		fs.IntVar(&pingArgs.size, "size", 0, "size of the ping message (disco pings only). 0 for minimum size.")
+		fs.BoolVar(&pingArgs.stats, "stats", false, "print the recent latency and loss statistics of each path to the peer after pinging (disco pings only)")
 		return fs
 	})(),
 }
@@ -77,6 +86,7 @@ func init() {
 	tsmp        bool
 	icmp        bool
 	peerAPI     bool
+	stats       bool
 	timeout     time.Duration
 }
 
@@ -122,9 +132,13 @@ func runPing(ctx context.Context, args []string) error {
 	if pingArgs.verbose && ip != hostOrIP {
 		log.Printf("lookup %q => %q", hostOrIP, ip)
 	}
+	if pingArgs.stats && pingType() == tailcfg.PingDisco {
+		defer printPathStats(ctx, netip.MustParseAddr(ip))
+	}
 
 	n := 0
 	anyPong := false
+	var lastDiags []ipnstate.NATDiagnostic
 	for {
 		n++
 		ctx, cancel := context.WithTimeout(ctx, pingArgs.timeout)
@@ -170,6 +184,12 @@ func runPing(ctx context.Context, args []string) error {
 			extra = fmt.Sprintf(", %d", pr.PeerAPIPort)
 		}
 		printf("pong from %s (%s%s) via %v in %v\n", pr.NodeName, pr.NodeIP, extra, via, latency)
+		if pingArgs.verbose && !slices.Equal(pr.NATDiagnostics, lastDiags) {
+			for _, d := range pr.NATDiagnostics {
+				printf("  no direct path (%s): %s\n", d.Code, d.Message)
+			}
+			lastDiags = pr.NATDiagnostics
+		}
 		if pingArgs.tsmp || pingArgs.icmp {
 			return nil
 		}
@@ -190,6 +210,47 @@ func runPing(ctx context.Context, args []string) error {
 	}
 }
 
+// printPathStats prints the latency and loss statistics of the paths to the
+// peer with the Tailscale IP ip.
+func printPathStats(ctx context.Context, ip netip.Addr) {
+	stats, err := localClient.PathStats(ctx, ip)
+	if err != nil {
+		printf("error getting path statistics: %v\n", err)
+		return
+	}
+	if len(stats) == 0 {
+		printf("\nno path statistics yet\n")
+		return
+	}
+	printf("\n")
+	writePathStats(stats)
+}
+
+// writePathStats writes a table of the path statistics stats to Stdout.
+func writePathStats(stats []ipnstate.PathStats) {
+	ms := func(sec float64) string {
+		return time.Duration(sec * float64(time.Second)).Round(100 * time.Microsecond).String()
+	}
+	w := tabwriter.NewWriter(Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tPINGS\tLOSS\tMIN\tAVG\tMAX\tJITTER\t")
+	for _, s := range stats {
+		path := s.Endpoint
+		if s.DERPRegionID != 0 {
+			path = fmt.Sprintf("DERP(%s)", cmp.Or(s.DERPRegionCode, strconv.Itoa(s.DERPRegionID)))
+		}
+		if s.Active {
+			path += " (active)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.0f%%\t", path, s.Pings, 100*float64(s.Lost)/float64(s.Pings))
+		if s.Lost == s.Pings {
+			fmt.Fprintln(w, "-\t-\t-\t-\t")
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", ms(s.MinLatencySeconds), ms(s.AvgLatencySeconds), ms(s.MaxLatencySeconds), ms(s.JitterSeconds))
+	}
+	w.Flush()
+}
+
 func tailscaleIPFromArg(ctx context.Context, hostOrIP string) (ip string, self bool, err error) {
 	// If the argument is an IP address, use it directly without any resolution.
 	if net.ParseIP(hostOrIP) != nil {
@@ -12,6 +12,7 @@
 	"os/exec"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/client/web"
@@ -45,13 +46,16 @@ type setArgsT struct {
 	acceptDNS              bool
 	exitNodeIP             string
 	exitNodeAllowLANAccess bool
+	exitNodeFailClosed     bool
 	shieldsUp              bool
 	runSSH                 bool
 	runWebClient           bool
+	runMetricsServer       bool
 	hostname               string
 	advertiseRoutes        string
 	advertiseDefaultRoute  bool
 	advertiseConnector     bool
+	routeJustification     string
 	opUser                 string
 	acceptedRisks          string
 	profileName            string
@@ -59,6 +63,10 @@ type setArgsT struct {
 	updateCheck            bool
 	updateApply            bool
 	postureChecking        bool
+	keepalive              string
+	ephemeralIdleTimeout   time.Duration
+	lanDNSResponder        bool
+	certIssuer             string
 	snat                   bool
 	statefulFiltering      bool
 	netfilterMode          string
@@ -70,18 +78,25 @@ func newSetFlagSet(goos string, setArgs *setArgsT) *flag.FlagSet {
 	setf.StringVar(&setArgs.profileName, "nickname", "", "nickname for the current account")
 	setf.BoolVar(&setArgs.acceptRoutes, "accept-routes", false, "accept routes advertised by other Tailscale nodes")
 	setf.BoolVar(&setArgs.acceptDNS, "accept-dns", false, "accept DNS configuration from the admin panel")
-	setf.StringVar(&setArgs.exitNodeIP, "exit-node", "", "Tailscale exit node (IP or base name) for internet traffic, or empty string to not use an exit node")
+	setf.StringVar(&setArgs.exitNodeIP, "exit-node", "", "Tailscale exit node (IP, base name, or auto:<policy> to pick one automatically) for internet traffic, or empty string to not use an exit node")
 	setf.BoolVar(&setArgs.exitNodeAllowLANAccess, "exit-node-allow-lan-access", false, "Allow direct access to the local network when routing traffic via an exit node")
+	setf.BoolVar(&setArgs.exitNodeFailClosed, "exit-node-fail-closed", false, "Block all non-Tailscale traffic, including DNS and local network access, while the exit node is unreachable")
 	setf.BoolVar(&setArgs.shieldsUp, "shields-up", false, "don't allow incoming connections")
 	setf.BoolVar(&setArgs.runSSH, "ssh", false, "run an SSH server, permitting access per tailnet admin's declared policy")
 	setf.StringVar(&setArgs.hostname, "hostname", "", "hostname to use instead of the one provided by the OS")
 	setf.StringVar(&setArgs.advertiseRoutes, "advertise-routes", "", "routes to advertise to other nodes (comma-separated, e.g. \"10.0.0.0/8,192.168.0.0/24\") or empty string to not advertise routes")
 	setf.BoolVar(&setArgs.advertiseDefaultRoute, "advertise-exit-node", false, "offer to be an exit node for internet traffic for the tailnet")
 	setf.BoolVar(&setArgs.advertiseConnector, "advertise-connector", false, "offer to be an app connector for domain specific internet traffic for the tailnet")
+	setf.StringVar(&setArgs.routeJustification, "route-justification", "", "metadata describing why routes are advertised, such as a change ticket ID, for control servers that let an agent on this node approve routes")
 	setf.BoolVar(&setArgs.updateCheck, "update-check", true, "notify about available Tailscale updates")
 	setf.BoolVar(&setArgs.updateApply, "auto-update", false, "automatically update to the latest available version")
 	setf.BoolVar(&setArgs.postureChecking, "posture-checking", false, hidden+"allow management plane to gather device posture information")
 	setf.BoolVar(&setArgs.runWebClient, "webclient", false, "expose the web interface for managing this node over Tailscale at port 5252")
+	setf.BoolVar(&setArgs.runMetricsServer, "metrics-server", false, "expose this node's client metrics in Prometheus format over Tailscale at port 5253")
+	setf.StringVar(&setArgs.keepalive, "keepalive", "", `keepalive intervals per peer class, as comma-separated CLASS:HEARTBEAT[:WIREGUARD] with classes default, mobile, server and idle, and intervals like "30s" or "off" (e.g. "mobile:30s:25s,idle:2m"), or empty string to use the tailnet's intervals`)
+	setf.DurationVar(&setArgs.ephemeralIdleTimeout, "ephemeral-idle-timeout", 0, "if positive, make this node ephemeral: register it as such and log it out, deleting its state, once it has had no peer traffic, SSH sessions or console logins for this long (e.g. \"30m\"); an already registered node is only marked ephemeral when it next registers; 0 to disable")
+	setf.BoolVar(&setArgs.lanDNSResponder, "lan-dns-responder", false, "answer mDNS and LLMNR queries on the local network for this node's MagicDNS name with its Tailscale IPs")
+	setf.StringVar(&setArgs.certIssuer, "cert-issuer", "", `where to get TLS certs for "tailscale cert" and serve from: "acme:" followed by an ACME directory URL, "vault:" followed by the URL of a Vault PKI role's sign endpoint (using tailscaled's $VAULT_TOKEN), or empty string for Let's Encrypt`)
 
 	ffcomplete.Flag(setf, "exit-node", func(args []string) ([]string, ffcomplete.ShellCompDirective, error) {
 		st, err := localClient.Status(context.Background())
@@ -138,10 +153,13 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 			RouteAll:               setArgs.acceptRoutes,
 			CorpDNS:                setArgs.acceptDNS,
 			ExitNodeAllowLANAccess: setArgs.exitNodeAllowLANAccess,
+			ExitNodeFailClosed:     setArgs.exitNodeFailClosed,
 			ShieldsUp:              setArgs.shieldsUp,
 			RunSSH:                 setArgs.runSSH,
 			RunWebClient:           setArgs.runWebClient,
+			RunMetricsServer:       setArgs.runMetricsServer,
 			Hostname:               setArgs.hostname,
+			RouteJustification:     setArgs.routeJustification,
 			OperatorUser:           setArgs.opUser,
 			NoSNAT:                 !setArgs.snat,
 			ForceDaemon:            setArgs.forceDaemon,
@@ -152,8 +170,11 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 			AppConnector: ipn.AppConnectorPrefs{
 				Advertise: setArgs.advertiseConnector,
 			},
-			PostureChecking:     setArgs.postureChecking,
-			NoStatefulFiltering: opt.NewBool(!setArgs.statefulFiltering),
+			PostureChecking:      setArgs.postureChecking,
+			EphemeralIdleTimeout: setArgs.ephemeralIdleTimeout,
+			LANDNSResponder:      setArgs.lanDNSResponder,
+			CertIssuer:           setArgs.certIssuer,
+			NoStatefulFiltering:  opt.NewBool(!setArgs.statefulFiltering),
 		},
 	}
 
@@ -168,7 +189,22 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 		maskedPrefs.Prefs.NetfilterMode = nfMode
 	}
 
-	if setArgs.exitNodeIP != "" {
+	if maskedPrefs.Prefs.KeepaliveIntervals, err = ipn.ParseKeepaliveIntervals(setArgs.keepalive); err != nil {
+		return fmt.Errorf("invalid --keepalive: %w", err)
+	}
+	if _, _, err := ipn.ParseCertIssuer(setArgs.certIssuer); err != nil {
+		return fmt.Errorf("invalid --cert-issuer: %w", err)
+	}
+	if setArgs.ephemeralIdleTimeout < 0 {
+		return errors.New("invalid --ephemeral-idle-timeout: must not be negative")
+	}
+
+	if expr, ok := ipn.ParseAutoExitNodeString(setArgs.exitNodeIP); ok {
+		if _, err := expr.Policy(); err != nil {
+			return fmt.Errorf("invalid --exit-node: %w", err)
+		}
+		maskedPrefs.Prefs.AutoExitNode = expr
+	} else if setArgs.exitNodeIP != "" {
 		if err := maskedPrefs.Prefs.SetExitNodeIP(setArgs.exitNodeIP, st); err != nil {
 			var e ipn.ExitNodeLocalIPError
 			if errors.As(err, &e) {
@@ -247,6 +283,9 @@ func runSet(ctx context.Context, args []string) (retErr error) {
 	if setArgs.runWebClient && len(st.TailscaleIPs) > 0 {
 		printf("\nWeb interface now running at %s:%d", st.TailscaleIPs[0], web.ListenPort)
 	}
+	if setArgs.runMetricsServer && len(st.TailscaleIPs) > 0 {
+		printf("\nMetrics now served at http://%s/metrics\n", netip.AddrPortFrom(st.TailscaleIPs[0], ipn.MetricsServerPort))
+	}
 
 	return nil
 }
@@ -7,6 +7,7 @@
 	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/netip"
@@ -24,9 +25,15 @@
 	"tailscale.com/version"
 )
 
+var sshArgs struct {
+	jump      string // -J
+	forward   string // -W; hidden, used when jumping
+	multiplex bool
+}
+
 var sshCmd = &ffcli.Command{
 	Name:       "ssh",
-	ShortUsage: "tailscale ssh [user@]<host> [args...]",
+	ShortUsage: "tailscale ssh [-J [user@]<jump>[,...]] [user@]<host> [args...]",
 	ShortHelp:  "SSH to a Tailscale machine",
 	LongHelp: strings.TrimSpace(`
 
@@ -43,7 +50,20 @@
   system 'ssh' command that connects via a pipe through tailscaled.
 * It automatically checks the destination server's SSH host key against the
   node's SSH host key as advertised via the Tailscale coordination server.
+  The first host keys seen for each node are pinned in the Tailscale config
+  directory, and connecting fails if they later change entirely.
+* It reuses one connection for repeated sessions to the same host, by
+  running the system 'ssh' as an OpenSSH control master (except on Windows).
+* It can jump through other tailnet nodes to reach the destination with -J,
+  like 'ssh -J', checking each jump host's key the same way.
 `),
+	FlagSet: (func() *flag.FlagSet {
+		fs := newFlagSet("ssh")
+		fs.StringVar(&sshArgs.jump, "J", "", "comma-separated tailnet nodes, as [user@]host, to jump through to reach the destination")
+		fs.StringVar(&sshArgs.forward, "W", "", hidden+"forward stdin and stdout to host:port through the destination, for jumps")
+		fs.BoolVar(&sshArgs.multiplex, "multiplex", runtime.GOOS != "windows", "reuse a shared connection for repeated sessions to the same host")
+		return fs
+	})(),
 	Exec: runSSH,
 }
 
@@ -77,6 +97,13 @@ func runSSH(ctx context.Context, args []string) error {
 	if v, ok := nodeDNSNameFromArg(st, host); ok {
 		hostForSSH = v
 	}
+	tsConfDir, err := cliConfDir()
+	if err != nil {
+		return err
+	}
+	if err := checkHostKeyPins(filepath.Join(tsConfDir, "ssh_pinned_host_keys"), st, hostForSSH); err != nil {
+		return err
+	}
 
 	ssh, err := findSSH()
 	if err != nil {
@@ -88,7 +115,7 @@ func runSSH(ctx context.Context, args []string) error {
 	if err != nil {
 		return err
 	}
-	knownHostsFile, err := writeKnownHosts(st)
+	knownHostsFile, err := writeKnownHosts(tsConfDir, st)
 	if err != nil {
 		return err
 	}
@@ -106,20 +133,55 @@ func runSSH(ctx context.Context, args []string) error {
 		"-o", "CanonicalizeHostname no", // https://github.com/tailscale/tailscale/issues/10348
 	)
 
-	// MagicDNS is usually working on macOS anyway and they're not in userspace
-	// mode, so 'nc' isn't very useful.
-	if runtime.GOOS != "darwin" {
-		socketArg := ""
-		if localClient.Socket != "" && localClient.Socket != paths.DefaultTailscaledSocket() {
-			socketArg = fmt.Sprintf("--socket=%q", localClient.Socket)
+	if sshArgs.multiplex {
+		muxDir := filepath.Join(tsConfDir, "ssh-mux")
+		if err := os.MkdirAll(muxDir, 0700); err != nil {
+			return err
 		}
+		argv = append(argv,
+			"-o", "ControlMaster auto",
+			"-o", fmt.Sprintf("ControlPath %q", filepath.Join(muxDir, "%C")),
+			"-o", "ControlPersist 10m",
+		)
+	}
 
+	socketArg := ""
+	if localClient.Socket != "" && localClient.Socket != paths.DefaultTailscaledSocket() {
+		socketArg = fmt.Sprintf("--socket=%q", localClient.Socket)
+	}
+	if sshArgs.jump != "" {
+		// Reach the destination through the last jump host, which in
+		// turn is reached through the ones before it, by running this
+		// command again as the ProxyCommand.
+		jumps := strings.Split(sshArgs.jump, ",")
+		last := jumps[len(jumps)-1]
+		if last == "" {
+			return errors.New("invalid -J: empty jump host")
+		}
+		var jumpArg string
+		if len(jumps) > 1 {
+			jumpArg = fmt.Sprintf("-J %q", strings.Join(jumps[:len(jumps)-1], ","))
+		}
+		argv = append(argv,
+			"-o", fmt.Sprintf("ProxyCommand %q %s ssh --multiplex=%v %s -W %%h:%%p %q",
+				tailscaleBin,
+				socketArg,
+				sshArgs.multiplex,
+				jumpArg,
+				last,
+			))
+	} else if runtime.GOOS != "darwin" {
+		// MagicDNS is usually working on macOS anyway and they're not in
+		// userspace mode, so 'nc' isn't very useful.
 		argv = append(argv,
 			"-o", fmt.Sprintf("ProxyCommand %q %s nc %%h %%p",
 				tailscaleBin,
 				socketArg,
 			))
 	}
+	if sshArgs.forward != "" {
+		argv = append(argv, "-W", sshArgs.forward)
+	}
 
 	// Explicitly rebuild the user@host argument rather than
 	// passing it through.  In general, the use of OpenSSH's ssh
@@ -142,7 +204,10 @@ func runSSH(ctx context.Context, args []string) error {
 	return execSSH(ssh, argv)
 }
 
-func writeKnownHosts(st *ipnstate.Status) (knownHostsFile string, err error) {
+// cliConfDir returns the per-user directory in which the CLI keeps its files,
+// such as those of 'tailscale ssh' and 'tailscale switch', creating it if
+// needed.
+func cliConfDir() (string, error) {
 	confDir, err := os.UserConfigDir()
 	if err != nil {
 		return "", err
@@ -151,6 +216,10 @@ func writeKnownHosts(st *ipnstate.Status) (knownHostsFile string, err error) {
 	if err := os.MkdirAll(tsConfDir, 0700); err != nil {
 		return "", err
 	}
+	return tsConfDir, nil
+}
+
+func writeKnownHosts(tsConfDir string, st *ipnstate.Status) (knownHostsFile string, err error) {
 	knownHostsFile = filepath.Join(tsConfDir, "ssh_known_hosts")
 	want := genKnownHosts(st)
 	if cur, err := os.ReadFile(knownHostsFile); err != nil || !bytes.Equal(cur, want) {
@@ -0,0 +1,114 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"tailscale.com/ipn/ipnstate"
+)
+
+// hostKeyPins are the SSH host keys of tailnet nodes, keyed by DNS name, as
+// first seen by 'tailscale ssh'. They're stored in known_hosts format.
+type hostKeyPins map[string][]string
+
+// normalizeHostKey returns the "type base64" part of an SSH host key, without
+// any comment, or "" if it's malformed.
+func normalizeHostKey(k string) string {
+	f := strings.Fields(k)
+	if len(f) < 2 {
+		return ""
+	}
+	return f[0] + " " + f[1]
+}
+
+func parseHostKeyPins(b []byte) hostKeyPins {
+	pins := hostKeyPins{}
+	for _, line := range strings.Split(string(b), "\n") {
+		name, key, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok || strings.HasPrefix(name, "#") {
+			continue
+		}
+		if key = normalizeHostKey(key); key != "" {
+			pins[name] = append(pins[name], key)
+		}
+	}
+	return pins
+}
+
+func (p hostKeyPins) marshal() []byte {
+	var buf bytes.Buffer
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, key := range p[name] {
+			fmt.Fprintf(&buf, "%s %s\n", name, key)
+		}
+	}
+	return buf.Bytes()
+}
+
+// update checks the host keys that the tailnet advertises for the node named
+// dnsName against the pinned ones, and reports whether the pins changed.
+//
+// Advertised keys are trusted on first use. After that, they must include at
+// least one of the pinned keys, which lets hosts rotate their keys, and the
+// pins are replaced with them.
+func (p hostKeyPins) update(dnsName string, advertised []string) (changed bool, err error) {
+	var keys []string
+	for _, k := range advertised {
+		if k = normalizeHostKey(k); k != "" && !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return false, nil
+	}
+	pinned, ok := p[dnsName]
+	if ok && !slices.ContainsFunc(keys, func(k string) bool { return slices.Contains(pinned, k) }) {
+		return false, fmt.Errorf("none of the SSH host keys of %s advertised by the tailnet were seen before", dnsName)
+	}
+	if slices.Equal(pinned, keys) {
+		return false, nil
+	}
+	p[dnsName] = keys
+	return true, nil
+}
+
+// checkHostKeyPins checks the host keys of the node named dnsName in st
+// against the pins in the file at path, pinning them if they're new.
+// It does nothing if dnsName isn't a node in st.
+func checkHostKeyPins(path string, st *ipnstate.Status, dnsName string) error {
+	var advertised []string
+	found := false
+	for _, ps := range st.Peer {
+		if ps.DNSName == dnsName {
+			advertised, found = ps.SSH_HostKeys, true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	pins := parseHostKeyPins(b)
+	changed, err := pins.update(dnsName, advertised)
+	if err != nil {
+		return fmt.Errorf("%w; if the host was reinstalled, remove its lines from %s and try again", err, path)
+	}
+	if !changed {
+		return nil
+	}
+	return os.WriteFile(path, pins.marshal(), 0600)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/types/key"
+)
+
+func TestCheckHostKeyPins(t *testing.T) {
+	const (
+		keyA = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAAA"
+		keyB = "ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYBBB"
+		keyC = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABgQCCC"
+	)
+	peer := &ipnstate.PeerStatus{DNSName: "server.tail-scale.ts.net."}
+	st := &ipnstate.Status{Peer: map[key.NodePublic]*ipnstate.PeerStatus{key.NewNode().Public(): peer}}
+	path := filepath.Join(t.TempDir(), "ssh_pinned_host_keys")
+
+	steps := []struct {
+		advertised []string
+		wantErr    bool
+		wantFile   string
+	}{
+		// No keys advertised, nothing to pin.
+		{advertised: nil, wantFile: ""},
+		// Trusted on first use, without comments.
+		{advertised: []string{keyA + " root@server"}, wantFile: "server.tail-scale.ts.net. " + keyA + "\n"},
+		// A rotation that keeps one known key is accepted.
+		{advertised: []string{keyA, keyB}, wantFile: "server.tail-scale.ts.net. " + keyA + "\nserver.tail-scale.ts.net. " + keyB + "\n"},
+		{advertised: []string{keyB}, wantFile: "server.tail-scale.ts.net. " + keyB + "\n"},
+		// Entirely new keys are refused.
+		{advertised: []string{keyC}, wantErr: true, wantFile: "server.tail-scale.ts.net. " + keyB + "\n"},
+	}
+	for i, s := range steps {
+		peer.SSH_HostKeys = s.advertised
+		err := checkHostKeyPins(path, st, peer.DNSName)
+		if (err != nil) != s.wantErr {
+			t.Fatalf("step %d: err = %v, want error %v", i, err, s.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), path) {
+			t.Errorf("step %d: error %q doesn't mention %s", i, err, path)
+		}
+		got, _ := os.ReadFile(path)
+		if string(got) != s.wantFile {
+			t.Errorf("step %d: pins file = %q, want %q", i, got, s.wantFile)
+		}
+	}
+
+	// Hosts that aren't tailnet nodes aren't checked.
+	if err := checkHostKeyPins(path, st, "example.com"); err != nil {
+		t.Errorf("non-tailnet host: %v", err)
+	}
+}
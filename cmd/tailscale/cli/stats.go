@@ -0,0 +1,127 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"tailscale.com/ipn"
+)
+
+var statsCmd = &ffcli.Command{
+	Name:       "stats",
+	ShortUsage: "tailscale stats [--month=YYYY-MM] [--peers=N] [--json]\n  tailscale stats reset",
+	ShortHelp:  "Show bandwidth usage with the tailnet",
+	LongHelp: strings.TrimSpace(`
+'tailscale stats' shows how many bytes this machine has exchanged with its
+peers in a calendar month, in total, by category and by peer, such as to
+see what the tailnet costs on a metered connection. The counts include the
+overhead of WireGuard encryption but not of DERP or UDP framing.
+
+Traffic with the exit node in use at the time is counted as exit node
+traffic, and traffic with other subnet routers while accepting routes as
+subnet route traffic. Traffic is counted as direct or DERP by the path to
+the peer at the time.
+
+Usage is kept for each account for 12 months, across restarts.
+`),
+	Exec: runStats,
+	FlagSet: (func() *flag.FlagSet {
+		fs := newFlagSet("stats")
+		fs.StringVar(&statsArgs.month, "month", "", "month to show, as YYYY-MM; defaults to the current month")
+		fs.IntVar(&statsArgs.peers, "peers", 10, "number of peers with the highest usage to show; 0 to show all")
+		fs.BoolVar(&statsArgs.json, "json", false, "output the usage of all months in JSON format")
+		return fs
+	})(),
+	Subcommands: []*ffcli.Command{
+		{
+			Name:       "reset",
+			ShortUsage: "tailscale stats reset",
+			ShortHelp:  "Delete the bandwidth usage of the current account",
+			Exec:       runStatsReset,
+		},
+	},
+}
+
+var statsArgs struct {
+	month string
+	peers int
+	json  bool
+}
+
+func runStats(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected non-flag arguments to 'tailscale stats'")
+	}
+	month := statsArgs.month
+	if month == "" {
+		month = time.Now().Format(ipn.UsageMonthFormat)
+	} else if _, err := time.Parse(ipn.UsageMonthFormat, month); err != nil {
+		return fmt.Errorf("invalid --month %q; want YYYY-MM", month)
+	}
+	st, err := localClient.UsageStats(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	if statsArgs.json {
+		ec := json.NewEncoder(Stdout)
+		ec.SetIndent("", "  ")
+		return ec.Encode(st)
+	}
+
+	var m *ipn.MonthUsage
+	for _, mu := range st.Months {
+		if mu.Month == month {
+			m = mu
+		}
+	}
+	if m == nil {
+		printf("No usage in %s.\n", month)
+		return nil
+	}
+	w := tabwriter.NewWriter(Stdout, 10, 5, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tRECEIVED\tSENT\tTOTAL\n", month)
+	row := func(name string, c ipn.ByteCounts) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, formatIEC(float64(c.RxBytes), "B"), formatIEC(float64(c.TxBytes), "B"), formatIEC(float64(c.Total()), "B"))
+	}
+	row("Total", m.Total)
+	row("Exit node", m.ExitNode)
+	row("Subnet routes", m.SubnetRoutes)
+	row("Direct", m.Direct)
+	row("DERP", m.DERP)
+	fmt.Fprintf(w, "\t\t\t\n")
+	ids := m.SortedPeers()
+	if statsArgs.peers > 0 && len(ids) > statsArgs.peers {
+		ids = ids[:statsArgs.peers]
+	}
+	fmt.Fprintf(w, "PEER\t\t\t\n")
+	for _, id := range ids {
+		p := m.Peers[id]
+		row(cmp.Or(strings.TrimSuffix(p.Name, "."), string(id)), p.ByteCounts)
+	}
+	if more := len(m.Peers) - len(ids); more > 0 {
+		fmt.Fprintf(w, "(%d more; see --peers)\t\t\t\n", more)
+	}
+	return w.Flush()
+}
+
+func runStatsReset(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments to 'tailscale stats reset'")
+	}
+	if err := localClient.ResetUsageStats(ctx); err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	printf("Bandwidth usage deleted.\n")
+	return nil
+}
@@ -4,10 +4,18 @@
 package cli
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
+	"maps"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -18,19 +26,46 @@
 )
 
 var switchCmd = &ffcli.Command{
-	Name:       "switch",
-	ShortUsage: "tailscale switch <id>",
-	ShortHelp:  "Switches to a different Tailscale account",
+	Name: "switch",
+	ShortUsage: strings.Join([]string{
+		"tailscale switch <id>",
+		"tailscale switch --list",
+		"tailscale switch --alias=<alias> [--color=<color>] <id>",
+		"tailscale switch --unalias=<alias>",
+		"tailscale switch --prompt",
+		"tailscale switch --exec <id> <command> [args...]",
+	}, "\n"),
+	ShortHelp: "Switches to a different Tailscale account",
 	LongHelp: `"tailscale switch" switches between logged in accounts. You can
 use the ID that's returned from 'tailnet switch -list'
 to pick which profile you want to switch to. Alternatively, you
 can use the Tailnet or the account names to switch as well.
 
+Profiles can also be given aliases, which are kept per user, with
+'tailscale switch --alias'. An alias can have a color, used when
+listing profiles and by 'tailscale switch --prompt', which prints
+the current profile's alias (or tailnet name) for use in shell
+prompts. For example, in bash:
+
+  PS1='[$(tailscale switch --prompt)] \w\$ '
+
+'tailscale switch --exec' runs a command while switched to a profile,
+and then switches back. The command's environment has TS_PROFILE_ID,
+TS_PROFILE_TAILNET and TS_PROFILE_ACCOUNT set to the profile's ID,
+tailnet name and account name. While it runs, the profile is active for
+all users of this Tailscale instance, as only one profile can be
+active at a time.
+
 This command is currently in alpha and may change in the future.`,
 
 	FlagSet: func() *flag.FlagSet {
 		fs := flag.NewFlagSet("switch", flag.ExitOnError)
 		fs.BoolVar(&switchArgs.list, "list", false, "list available accounts")
+		fs.StringVar(&switchArgs.alias, "alias", "", "give the account the alias `name`, instead of switching to it")
+		fs.StringVar(&switchArgs.color, "color", "", "with --alias, the color of the alias; one of "+strings.Join(slices.Sorted(maps.Keys(aliasColors)), ", "))
+		fs.StringVar(&switchArgs.unalias, "unalias", "", "remove the alias `name`")
+		fs.BoolVar(&switchArgs.prompt, "prompt", false, "print the current account's alias or tailnet name, for shell prompts")
+		fs.BoolVar(&switchArgs.exec, "exec", false, "run a command while switched to the account, then switch back")
 		return fs
 	}(),
 	Exec: switchProfile,
@@ -50,6 +85,12 @@ func(prof ipn.LoginProfile) string { return prof.NetworkProfile.DomainName },
 			func(prof ipn.LoginProfile) string { return prof.Name },
 		}
 
+		if aliases, err := loadProfileAliases(); err == nil {
+			for _, name := range slices.Sorted(maps.Keys(aliases)) {
+				seen[name] = true
+				words = append(words, fmt.Sprintf("%s\talias for id: %s", name, aliases[name].ProfileID))
+			}
+		}
 		for _, wordfn := range wordfns {
 			for _, prof := range all {
 				word := wordfn(prof)
@@ -65,7 +106,12 @@ func(prof ipn.LoginProfile) string { return prof.Name },
 }
 
 var switchArgs struct {
-	list bool
+	list    bool
+	alias   string
+	color   string
+	unalias string
+	prompt  bool
+	exec    bool
 }
 
 func listProfiles(ctx context.Context) error {
@@ -73,29 +119,58 @@ func listProfiles(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	tw := tabwriter.NewWriter(Stdout, 2, 2, 2, ' ', 0)
+	aliases, err := loadProfileAliases()
+	if err != nil {
+		return err
+	}
+	out, color := colorableOutput()
+	tw := tabwriter.NewWriter(out, 2, 2, 2, ' ', 0)
 	defer tw.Flush()
 	printRow := func(vals ...string) {
 		fmt.Fprintln(tw, strings.Join(vals, "\t"))
 	}
-	printRow("ID", "Tailnet", "Account")
+	printRow("ID", "Tailnet", "Account", "Alias")
 	for _, prof := range all {
 		name := prof.Name
 		if prof.ID == curP.ID {
 			name += "*"
 		}
+		var alias string
+		if a, pa, ok := aliases.aliasFor(prof.ID); ok {
+			// The escape codes are zero width, but tabwriter counts
+			// them, so only color the last column.
+			alias = colorize(a, pa.Color, color)
+		}
 		printRow(
 			string(prof.ID),
 			prof.NetworkProfile.DomainName,
 			name,
+			alias,
 		)
 	}
 	return nil
 }
 
 func switchProfile(ctx context.Context, args []string) error {
-	if switchArgs.list {
+	switch {
+	case switchArgs.list:
 		return listProfiles(ctx)
+	case switchArgs.prompt:
+		return printPromptSegment(ctx)
+	case switchArgs.unalias != "":
+		return unaliasProfile(switchArgs.unalias)
+	case switchArgs.alias != "":
+		if len(args) != 1 {
+			return errors.New("usage: tailscale switch --alias=<alias> [--color=<color>] <id>")
+		}
+		return aliasProfile(ctx, switchArgs.alias, switchArgs.color, args[0])
+	case switchArgs.color != "":
+		return errors.New("--color requires --alias")
+	case switchArgs.exec:
+		if len(args) < 2 {
+			return errors.New("usage: tailscale switch --exec <id> <command> [args...]")
+		}
+		return execWithProfile(ctx, args[0], args[1:])
 	}
 	if len(args) != 1 {
 		outln("usage: tailscale switch NAME")
@@ -106,40 +181,21 @@ func switchProfile(ctx context.Context, args []string) error {
 		errf("Failed to switch to account: %v\n", err)
 		os.Exit(1)
 	}
-	var profID ipn.ProfileID
-	// Allow matching by ID, Tailnet, or Account
-	// in that order.
-	for _, p := range all {
-		if p.ID == ipn.ProfileID(args[0]) {
-			profID = p.ID
-			break
-		}
-	}
-	if profID == "" {
-		for _, p := range all {
-			if p.NetworkProfile.DomainName == args[0] {
-				profID = p.ID
-				break
-			}
-		}
-	}
-	if profID == "" {
-		for _, p := range all {
-			if p.Name == args[0] {
-				profID = p.ID
-				break
-			}
-		}
+	aliases, err := loadProfileAliases()
+	if err != nil {
+		errf("Failed to switch to account: %v\n", err)
+		os.Exit(1)
 	}
-	if profID == "" {
+	prof, ok := findProfile(all, aliases, args[0])
+	if !ok {
 		errf("No profile named %q\n", args[0])
 		os.Exit(1)
 	}
-	if profID == cp.ID {
+	if prof.ID == cp.ID {
 		printf("Already on account %q\n", args[0])
 		os.Exit(0)
 	}
-	if err := localClient.SwitchProfile(ctx, profID); err != nil {
+	if err := localClient.SwitchProfile(ctx, prof.ID); err != nil {
 		errf("Failed to switch to account: %v\n", err)
 		os.Exit(1)
 	}
@@ -178,3 +234,235 @@ func switchProfile(ctx context.Context, args []string) error {
 		}
 	}
 }
+
+// findProfile returns the profile in all named name, which may be one of
+// aliases, or a profile ID, tailnet name or account name, matched in that
+// order.
+func findProfile(all []ipn.LoginProfile, aliases profileAliases, name string) (_ ipn.LoginProfile, ok bool) {
+	if a, ok := aliases[name]; ok {
+		for _, p := range all {
+			if p.ID == a.ProfileID {
+				return p, true
+			}
+		}
+	}
+	matchers := []func(ipn.LoginProfile) bool{
+		func(p ipn.LoginProfile) bool { return p.ID == ipn.ProfileID(name) },
+		func(p ipn.LoginProfile) bool { return p.NetworkProfile.DomainName == name },
+		func(p ipn.LoginProfile) bool { return p.Name == name },
+	}
+	for _, match := range matchers {
+		for _, p := range all {
+			if match(p) {
+				return p, true
+			}
+		}
+	}
+	return ipn.LoginProfile{}, false
+}
+
+// profileAlias is a user-defined alias for a profile.
+type profileAlias struct {
+	ProfileID ipn.ProfileID
+	Color     string `json:",omitempty"` // one of aliasColors' keys, or empty
+}
+
+// profileAliases are the user's profile aliases, keyed by alias. They're
+// stored per user, rather than by tailscaled, so that each user of a shared
+// Tailscale instance has their own.
+type profileAliases map[string]profileAlias
+
+// aliasColors are the ANSI escape codes of the colors aliases can have.
+var aliasColors = map[string]string{
+	"red":     "\x1b[31m",
+	"green":   "\x1b[32m",
+	"yellow":  "\x1b[33m",
+	"blue":    "\x1b[34m",
+	"magenta": "\x1b[35m",
+	"cyan":    "\x1b[36m",
+}
+
+// colorize returns s in the given color from aliasColors, if useColor is
+// set and color is valid.
+func colorize(s, color string, useColor bool) string {
+	if code, ok := aliasColors[color]; ok && useColor {
+		return code + s + "\x1b[0m"
+	}
+	return s
+}
+
+func profileAliasesPath() (string, error) {
+	dir, err := cliConfDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "profile-aliases.json"), nil
+}
+
+// loadProfileAliases returns the user's profile aliases. It returns no
+// aliases, rather than an error, if the user has none.
+func loadProfileAliases() (profileAliases, error) {
+	path, err := profileAliasesPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return profileAliases{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var aliases profileAliases
+	if err := json.Unmarshal(b, &aliases); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if aliases == nil {
+		aliases = profileAliases{}
+	}
+	return aliases, nil
+}
+
+func (aliases profileAliases) save() error {
+	path, err := profileAliasesPath()
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(aliases, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
+
+// aliasFor returns the alias of the profile with the given ID, if it has any.
+// If it has more than one, the first in sorted order is returned.
+func (aliases profileAliases) aliasFor(id ipn.ProfileID) (alias string, _ profileAlias, ok bool) {
+	for _, a := range slices.Sorted(maps.Keys(aliases)) {
+		if aliases[a].ProfileID == id {
+			return a, aliases[a], true
+		}
+	}
+	return "", profileAlias{}, false
+}
+
+// aliasProfile gives the profile named name the alias alias.
+func aliasProfile(ctx context.Context, alias, color, name string) error {
+	if color != "" {
+		if _, ok := aliasColors[color]; !ok {
+			return fmt.Errorf("unknown color %q; must be one of %s", color, strings.Join(slices.Sorted(maps.Keys(aliasColors)), ", "))
+		}
+	}
+	_, all, err := localClient.ProfileStatus(ctx)
+	if err != nil {
+		return err
+	}
+	aliases, err := loadProfileAliases()
+	if err != nil {
+		return err
+	}
+	prof, ok := findProfile(all, aliases, name)
+	if !ok {
+		return fmt.Errorf("no profile named %q", name)
+	}
+	// Don't let an alias shadow another profile's ID, tailnet or account
+	// name, which would then be impossible to switch to by that name.
+	if other, ok := findProfile(all, nil, alias); ok && other.ID != prof.ID {
+		return fmt.Errorf("alias %q is already the ID or a name of profile %s", alias, other.ID)
+	}
+	aliases[alias] = profileAlias{ProfileID: prof.ID, Color: color}
+	if err := aliases.save(); err != nil {
+		return err
+	}
+	printf("%q is now an alias for account %s (%s)\n", alias, prof.Name, prof.NetworkProfile.DomainName)
+	return nil
+}
+
+func unaliasProfile(alias string) error {
+	aliases, err := loadProfileAliases()
+	if err != nil {
+		return err
+	}
+	if _, ok := aliases[alias]; !ok {
+		return fmt.Errorf("no alias named %q", alias)
+	}
+	delete(aliases, alias)
+	return aliases.save()
+}
+
+// promptSegment returns the label of the profile prof for shell prompts: its
+// alias, tailnet name or account name, whichever it has first.
+func promptSegment(prof ipn.LoginProfile, aliases profileAliases, useColor bool) string {
+	if a, pa, ok := aliases.aliasFor(prof.ID); ok {
+		return colorize(a, pa.Color, useColor)
+	}
+	return cmp.Or(prof.NetworkProfile.DomainName, prof.Name)
+}
+
+// printPromptSegment prints the current profile's label for shell prompts.
+// It prints nothing, rather than failing, if tailscaled isn't running or no
+// profile is active, so as not to break prompts.
+func printPromptSegment(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	cur, _, err := localClient.ProfileStatus(ctx)
+	if err != nil || cur.ID == "" {
+		return nil
+	}
+	aliases, err := loadProfileAliases()
+	if err != nil {
+		aliases = nil
+	}
+	// Prompts capture the output rather than writing it to a terminal,
+	// so only NO_COLOR disables colors.
+	outln(promptSegment(cur, aliases, os.Getenv("NO_COLOR") == ""))
+	return nil
+}
+
+// execWithProfile runs the command argv while switched to the profile named
+// name, then switches back to the current profile. It exits with the
+// command's exit code.
+func execWithProfile(ctx context.Context, name string, argv []string) error {
+	cur, all, err := localClient.ProfileStatus(ctx)
+	if err != nil {
+		return err
+	}
+	aliases, err := loadProfileAliases()
+	if err != nil {
+		return err
+	}
+	prof, ok := findProfile(all, aliases, name)
+	if !ok {
+		return fmt.Errorf("no profile named %q", name)
+	}
+	switched := prof.ID != cur.ID
+	if switched {
+		if err := localClient.SwitchProfile(ctx, prof.ID); err != nil {
+			return fmt.Errorf("switching to account %q: %w", name, err)
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = Stdout
+	cmd.Stderr = Stderr
+	cmd.Env = append(os.Environ(),
+		"TS_PROFILE_ID="+string(prof.ID),
+		"TS_PROFILE_TAILNET="+prof.NetworkProfile.DomainName,
+		"TS_PROFILE_ACCOUNT="+prof.Name,
+	)
+	err = cmd.Run()
+
+	// Switch back even if ctx is done. There's nothing to switch back to
+	// if no profile was active.
+	if switched && cur.ID != "" {
+		if err := localClient.SwitchProfile(context.Background(), cur.ID); err != nil {
+			errf("Failed to switch back to account %q: %v\n", cur.Name, err)
+		}
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	return err
+}
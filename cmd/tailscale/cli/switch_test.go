@@ -0,0 +1,96 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"tailscale.com/ipn"
+)
+
+func TestFindProfile(t *testing.T) {
+	all := []ipn.LoginProfile{
+		{ID: "1a2b", Name: "alice@example.com", NetworkProfile: ipn.NetworkProfile{DomainName: "example.com"}},
+		{ID: "3c4d", Name: "bob@corp.com", NetworkProfile: ipn.NetworkProfile{DomainName: "corp.com"}},
+		{ID: "5e6f", Name: "1a2b", NetworkProfile: ipn.NetworkProfile{DomainName: "alice@example.com"}},
+	}
+	aliases := profileAliases{
+		"work":     {ProfileID: "3c4d"},
+		"example":  {ProfileID: "5e6f"},
+		"dangling": {ProfileID: "gone"},
+	}
+	tests := []struct {
+		name   string
+		wantID ipn.ProfileID // empty for no match
+	}{
+		{"work", "3c4d"},
+		{"example", "5e6f"},           // alias
+		{"1a2b", "1a2b"},              // IDs win over account names
+		{"alice@example.com", "5e6f"}, // tailnet names win over account names
+		{"corp.com", "3c4d"},          // tailnet name
+		{"bob@corp.com", "3c4d"},      // account name
+		{"dangling", ""},              // alias of a deleted profile
+		{"nope", ""},
+	}
+	for _, tt := range tests {
+		got, ok := findProfile(all, aliases, tt.name)
+		if ok != (tt.wantID != "") || got.ID != tt.wantID {
+			t.Errorf("findProfile(%q) = %q, %v; want %q", tt.name, got.ID, ok, tt.wantID)
+		}
+	}
+}
+
+func TestPromptSegment(t *testing.T) {
+	aliases := profileAliases{
+		"zz":   {ProfileID: "1a2b"},
+		"work": {ProfileID: "1a2b", Color: "green"},
+		"home": {ProfileID: "3c4d", Color: "bogus"},
+	}
+	tests := []struct {
+		prof     ipn.LoginProfile
+		useColor bool
+		want     string
+	}{
+		{ipn.LoginProfile{ID: "1a2b"}, true, "\x1b[32mwork\x1b[0m"},
+		{ipn.LoginProfile{ID: "1a2b"}, false, "work"},
+		{ipn.LoginProfile{ID: "3c4d"}, true, "home"},
+		{ipn.LoginProfile{ID: "5e6f", Name: "bob@corp.com", NetworkProfile: ipn.NetworkProfile{DomainName: "corp.com"}}, true, "corp.com"},
+		{ipn.LoginProfile{ID: "5e6f", Name: "bob@corp.com"}, true, "bob@corp.com"},
+	}
+	for _, tt := range tests {
+		if got := promptSegment(tt.prof, aliases, tt.useColor); got != tt.want {
+			t.Errorf("promptSegment(%q, %v) = %q; want %q", tt.prof.ID, tt.useColor, got, tt.want)
+		}
+	}
+}
+
+func TestProfileAliasesFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+
+	got, err := loadProfileAliases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("got %v; want no aliases", got)
+	}
+	want := profileAliases{
+		"work": {ProfileID: "1a2b", Color: "green"},
+		"home": {ProfileID: "3c4d"},
+	}
+	if err := want.save(); err != nil {
+		t.Fatal(err)
+	}
+	got, err = loadProfileAliases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
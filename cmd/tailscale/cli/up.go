@@ -107,7 +107,7 @@ func newUpFlagSet(goos string, upArgs *upArgsT, cmd string) *flag.FlagSet {
 	upf.BoolVar(&upArgs.acceptRoutes, "accept-routes", acceptRouteDefault(goos), "accept routes advertised by other Tailscale nodes")
 	upf.BoolVar(&upArgs.acceptDNS, "accept-dns", true, "accept DNS configuration from the admin panel")
 	upf.Var(notFalseVar{}, "host-routes", hidden+"install host routes to other Tailscale nodes (must be true as of Tailscale 1.67+)")
-	upf.StringVar(&upArgs.exitNodeIP, "exit-node", "", "Tailscale exit node (IP or base name) for internet traffic, or empty string to not use an exit node")
+	upf.StringVar(&upArgs.exitNodeIP, "exit-node", "", "Tailscale exit node (IP, base name, or auto:<policy> to pick one automatically) for internet traffic, or empty string to not use an exit node")
 	upf.BoolVar(&upArgs.exitNodeAllowLANAccess, "exit-node-allow-lan-access", false, "Allow direct access to the local network when routing traffic via an exit node")
 	upf.BoolVar(&upArgs.shieldsUp, "shields-up", false, "don't allow incoming connections")
 	upf.BoolVar(&upArgs.runSSH, "ssh", false, "run an SSH server, permitting access per tailnet admin's declared policy")
@@ -282,7 +282,12 @@ func prefsFromUpArgs(upArgs upArgsT, warnf logger.Logf, st *ipnstate.Status, goo
 		// supports "off" mode.
 		prefs.NetfilterMode = preftype.NetfilterOff
 	}
-	if upArgs.exitNodeIP != "" {
+	if expr, ok := ipn.ParseAutoExitNodeString(upArgs.exitNodeIP); ok {
+		if _, err := expr.Policy(); err != nil {
+			return nil, fmt.Errorf("invalid --exit-node: %w", err)
+		}
+		prefs.AutoExitNode = expr
+	} else if upArgs.exitNodeIP != "" {
 		if err := prefs.SetExitNodeIP(upArgs.exitNodeIP, st); err != nil {
 			var e ipn.ExitNodeLocalIPError
 			if errors.As(err, &e) {
@@ -755,7 +760,7 @@ func init() {
 	addPrefFlagMapping("advertise-routes", "AdvertiseRoutes")
 
 	// And this flag has two ipn.Prefs:
-	addPrefFlagMapping("exit-node", "ExitNodeIP", "ExitNodeID")
+	addPrefFlagMapping("exit-node", "ExitNodeIP", "ExitNodeID", "AutoExitNode")
 
 	// The rest are 1:1:
 	addPrefFlagMapping("accept-dns", "CorpDNS")
@@ -768,15 +773,22 @@ func init() {
 	addPrefFlagMapping("snat-subnet-routes", "NoSNAT")
 	addPrefFlagMapping("stateful-filtering", "NoStatefulFiltering")
 	addPrefFlagMapping("exit-node-allow-lan-access", "ExitNodeAllowLANAccess")
+	addPrefFlagMapping("exit-node-fail-closed", "ExitNodeFailClosed")
 	addPrefFlagMapping("unattended", "ForceDaemon")
 	addPrefFlagMapping("operator", "OperatorUser")
 	addPrefFlagMapping("ssh", "RunSSH")
 	addPrefFlagMapping("webclient", "RunWebClient")
+	addPrefFlagMapping("metrics-server", "RunMetricsServer")
 	addPrefFlagMapping("nickname", "ProfileName")
 	addPrefFlagMapping("update-check", "AutoUpdate.Check")
 	addPrefFlagMapping("auto-update", "AutoUpdate.Apply")
 	addPrefFlagMapping("advertise-connector", "AppConnector")
 	addPrefFlagMapping("posture-checking", "PostureChecking")
+	addPrefFlagMapping("keepalive", "KeepaliveIntervals")
+	addPrefFlagMapping("ephemeral-idle-timeout", "EphemeralIdleTimeout")
+	addPrefFlagMapping("lan-dns-responder", "LANDNSResponder")
+	addPrefFlagMapping("cert-issuer", "CertIssuer")
+	addPrefFlagMapping("route-justification", "RouteJustification")
 }
 
 func addPrefFlagMapping(flagName string, prefNames ...string) {
@@ -978,6 +990,9 @@ func prefsToFlags(env upCheckEnv, prefs *ipn.Prefs) (flagVal map[string]any) {
 	ret := make(map[string]any)
 
 	exitNodeIPStr := func() string {
+		if prefs.AutoExitNode != "" {
+			return prefs.AutoExitNode.String()
+		}
 		if prefs.ExitNodeIP.IsValid() {
 			return prefs.ExitNodeIP.String()
 		}
@@ -10,6 +10,7 @@
 	"fmt"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/clientupdate"
@@ -19,13 +20,28 @@
 
 var updateCmd = &ffcli.Command{
 	Name:       "update",
-	ShortUsage: "tailscale update",
+	ShortUsage: "tailscale update\n  tailscale update --fleet [--tag=<tags>] [--batch=N]",
 	ShortHelp:  "Update Tailscale to the latest/different version",
-	Exec:       runUpdate,
+	LongHelp: strings.TrimSpace(`
+'tailscale update' updates Tailscale on this machine.
+
+With --fleet, it instead updates other nodes of the tailnet, such as all
+nodes with a given tag, to the latest version of their release track. It
+updates --batch nodes at a time, waits for each to finish updating and
+stops at the first batch with a failure. Nodes must grant this node the
+tailscale.com/cap/remote-update peer capability in the tailnet policy file,
+and opt in to remote updates with 'tailscale set --auto-update'.
+`),
+	Exec: runUpdate,
 	FlagSet: (func() *flag.FlagSet {
 		fs := newFlagSet("update")
 		fs.BoolVar(&updateArgs.yes, "yes", false, "update without interactive prompts")
 		fs.BoolVar(&updateArgs.dryRun, "dry-run", false, "print what update would do without doing it, or prompts")
+		fs.BoolVar(&updateArgs.fleet, "fleet", false, "update other nodes of the tailnet instead of this one")
+		fs.StringVar(&updateArgs.tag, "tag", "", `with --fleet, only update nodes with one of these comma-separated tags (e.g. "prod,tag:db"); empty means all nodes`)
+		fs.IntVar(&updateArgs.batch, "batch", 1, "with --fleet, number of nodes to update at a time")
+		fs.DurationVar(&updateArgs.timeout, "timeout", 15*time.Minute, "with --fleet, how long to wait for each node to finish updating")
+		fs.BoolVar(&updateArgs.force, "force", false, "with --fleet, update nodes even while they have active SSH connections")
 		// These flags are not supported on several systems that only provide
 		// the latest version of Tailscale:
 		//
@@ -52,12 +68,24 @@
 	dryRun  bool
 	track   string // explicit track; empty means same as current
 	version string // explicit version; empty means auto
+
+	fleet   bool          // update other nodes instead of this one
+	tag     string        // comma-separated tags of nodes to update with --fleet
+	batch   int           // number of nodes to update at a time with --fleet
+	timeout time.Duration // how long to wait for each node with --fleet
+	force   bool          // update nodes with active SSH connections with --fleet
 }
 
 func runUpdate(ctx context.Context, args []string) error {
 	if len(args) > 0 {
 		return flag.ErrHelp
 	}
+	if updateArgs.fleet {
+		return runUpdateFleet(ctx)
+	}
+	if updateArgs.tag != "" || updateArgs.force {
+		return errors.New("--tag and --force can only be used with --fleet")
+	}
 	if updateArgs.version != "" && updateArgs.track != "" {
 		return errors.New("cannot specify both --version and --track")
 	}
@@ -0,0 +1,194 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+// fleetPollInterval is how often 'tailscale update --fleet' checks whether a
+// node finished updating.
+const fleetPollInterval = 5 * time.Second
+
+// fleetNode is a node updated by 'tailscale update --fleet'.
+type fleetNode struct {
+	name    string
+	ip      netip.Addr
+	version string // before the update
+}
+
+// fleetTags returns the tags in the comma-separated list s, adding the "tag:"
+// prefix where missing.
+func fleetTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !strings.HasPrefix(t, "tag:") {
+			t = "tag:" + t
+		}
+		tags = append(tags, t)
+	}
+	return tags
+}
+
+// fleetNodes returns the peers in st to update, those with any of tags or
+// all of them if tags is empty, sorted by name.
+func fleetNodes(st *ipnstate.Status, tags []string) []*fleetNode {
+	var nodes []*fleetNode
+	for _, ps := range st.Peer {
+		if len(ps.TailscaleIPs) == 0 || ps.ShareeNode {
+			continue
+		}
+		if len(tags) > 0 && (ps.Tags == nil || !ps.Tags.ContainsFunc(func(t string) bool { return slices.Contains(tags, t) })) {
+			continue
+		}
+		nodes = append(nodes, &fleetNode{
+			name: dnsOrQuoteHostname(st, ps),
+			ip:   ps.TailscaleIPs[0],
+		})
+	}
+	slices.SortFunc(nodes, func(a, b *fleetNode) int { return cmp.Compare(a.name, b.name) })
+	return nodes
+}
+
+func runUpdateFleet(ctx context.Context) error {
+	if updateArgs.version != "" || updateArgs.track != "" {
+		return errors.New("--fleet updates nodes to the latest version of their own track; cannot specify --version or --track")
+	}
+	if updateArgs.batch < 1 {
+		return errors.New("--batch must be at least 1")
+	}
+	st, err := localClient.Status(ctx)
+	if err != nil {
+		return fixTailscaledConnectError(err)
+	}
+	nodes := fleetNodes(st, fleetTags(updateArgs.tag))
+	if len(nodes) == 0 {
+		return errors.New("no matching nodes")
+	}
+
+	printf("Checking %d nodes...\n", len(nodes))
+	var ready []*fleetNode
+	for _, n := range nodes {
+		us, err := localClient.PeerUpdateStatus(ctx, n.ip)
+		switch {
+		case err != nil:
+			printf("%s: skipping: %v\n", n.name, err)
+		case !us.Enabled:
+			printf("%s: skipping: remote updates are not enabled on the node; see 'tailscale set --auto-update'\n", n.name)
+		case !us.Supported:
+			printf("%s: skipping: remote updates are not supported on the node's platform\n", n.name)
+		case us.Started:
+			printf("%s: skipping: already updating\n", n.name)
+		default:
+			printf("%s: %s\n", n.name, us.Version)
+			n.version = us.Version
+			ready = append(ready, n)
+		}
+	}
+	if len(ready) == 0 {
+		return fmt.Errorf("none of the nodes can be updated; they need to grant this node %s", tailcfg.PeerCapabilityRemoteUpdate)
+	}
+	batch := min(updateArgs.batch, len(ready))
+	if updateArgs.dryRun {
+		printf("Would update %d nodes, %d at a time.\n", len(ready), batch)
+		return nil
+	}
+	if !updateArgs.yes && !promptYesNo(fmt.Sprintf("Update %d nodes, %d at a time?", len(ready), batch)) {
+		return errors.New("aborted")
+	}
+
+	var updated, unchanged int
+	for i := 0; i < len(ready); i += batch {
+		stage := ready[i:min(i+batch, len(ready))]
+		changed := make([]bool, len(stage))
+		errs := make([]error, len(stage))
+		var wg sync.WaitGroup
+		for j, n := range stage {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				changed[j], errs[j] = updateFleetNode(ctx, n)
+			}()
+		}
+		wg.Wait()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var failed int
+		for j, n := range stage {
+			if errs[j] != nil {
+				printf("%s: FAILED: %v\n", n.name, errs[j])
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d nodes failed to update; not updating the remaining %d", failed, len(stage), len(ready)-i-len(stage))
+		}
+		for _, c := range changed {
+			if c {
+				updated++
+			} else {
+				unchanged++
+			}
+		}
+	}
+	printf("Done: %d nodes updated, %d already up to date.\n", updated, unchanged)
+	return nil
+}
+
+// updateFleetNode starts the update of n and waits for it to finish. It
+// reports whether n's version changed, rather than it being up to date.
+func updateFleetNode(ctx context.Context, n *fleetNode) (changed bool, err error) {
+	us, err := localClient.StartPeerUpdate(ctx, n.ip, updateArgs.force)
+	if err != nil {
+		return false, err
+	}
+	if us.Err != "" {
+		return false, errors.New(us.Err)
+	}
+	printf("%s: update started\n", n.name)
+
+	timer := time.NewTimer(updateArgs.timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(fleetPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-timer.C:
+			return false, fmt.Errorf("timed out after %v waiting for the update to finish", updateArgs.timeout)
+		case <-ticker.C:
+		}
+		us, err := localClient.PeerUpdateStatus(ctx, n.ip)
+		if err != nil || us.Started {
+			// Still updating, or restarting tailscaled.
+			continue
+		}
+		if us.LastErr != "" {
+			return false, errors.New(us.LastErr)
+		}
+		if us.Version == n.version {
+			printf("%s: already up to date\n", n.name)
+			return false, nil
+		}
+		printf("%s: updated from %s to %s\n", n.name, n.version, us.Version)
+		return true, nil
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package cli
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/types/key"
+	"tailscale.com/types/views"
+)
+
+func TestFleetNodes(t *testing.T) {
+	tags := func(tt ...string) *views.Slice[string] {
+		v := views.SliceOf(tt)
+		return &v
+	}
+	peer := func(name string, tags *views.Slice[string]) *ipnstate.PeerStatus {
+		return &ipnstate.PeerStatus{
+			DNSName:      name + ".foo.ts.net.",
+			TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.1")},
+			Tags:         tags,
+		}
+	}
+	st := &ipnstate.Status{
+		MagicDNSSuffix: "foo.ts.net",
+		Peer: map[key.NodePublic]*ipnstate.PeerStatus{
+			key.NewNode().Public(): peer("db1", tags("tag:prod", "tag:db")),
+			key.NewNode().Public(): peer("web1", tags("tag:prod")),
+			key.NewNode().Public(): peer("web2", tags("tag:staging")),
+			key.NewNode().Public(): peer("laptop", nil),
+		},
+	}
+	names := func(nodes []*fleetNode) []string {
+		var ret []string
+		for _, n := range nodes {
+			ret = append(ret, n.name)
+		}
+		return ret
+	}
+
+	tests := []struct {
+		tags string
+		want []string
+	}{
+		{"", []string{"db1", "laptop", "web1", "web2"}},
+		{"prod", []string{"db1", "web1"}},
+		{"tag:db, staging", []string{"db1", "web2"}},
+		{"dev", nil},
+	}
+	for _, tt := range tests {
+		if got := names(fleetNodes(st, fleetTags(tt.tags))); !slices.Equal(got, tt.want) {
+			t.Errorf("fleetNodes(%q) = %q; want %q", tt.tags, got, tt.want)
+		}
+	}
+}
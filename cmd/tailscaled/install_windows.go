@@ -18,6 +18,7 @@
 	"tailscale.com/logtail/backoff"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/osshare"
+	"tailscale.com/wf"
 )
 
 func init() {
@@ -120,5 +121,13 @@ func uninstallSystemDaemonWindows(args []string) (ret error) {
 		service.Close()
 		bo.BackOff(context.Background(), errors.New("service not deleted"))
 	}
+
+	// The service's firewall filters normally go away with it, but remove
+	// any that outlived it.
+	if n, err := wf.Cleanup(); err != nil {
+		fmt.Printf("failed to remove Tailscale firewall filters: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("removed %d Tailscale firewall filters\n", n)
+	}
 	return nil
 }
@@ -8,17 +8,169 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/netip"
+	"os"
+	"os/user"
+	"strconv"
 	"strings"
+
+	"tailscale.com/net/socks5"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/set"
 )
 
+// proxyAuth is the authentication policy of the SOCKS5 and HTTP proxies, as
+// configured by --proxy-users-file and --proxy-local-users. A nil *proxyAuth
+// accepts all clients.
+type proxyAuth struct {
+	logf logger.Logf
+
+	users map[string]string // username => password
+
+	// localUIDs are the UIDs of the local users allowed without a
+	// password, or nil. If anyLocalUser, all local users are.
+	localUIDs    set.Set[uint32]
+	anyLocalUser bool
+}
+
+// newProxyAuth returns the proxy authentication policy for the given flag
+// values, or nil if both are empty.
+func newProxyAuth(logf logger.Logf, usersFile, localUsers string) (*proxyAuth, error) {
+	if usersFile == "" && localUsers == "" {
+		return nil, nil
+	}
+	a := &proxyAuth{logf: logf}
+	if usersFile != "" {
+		f, err := os.Open(usersFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		a.users = make(map[string]string)
+		bs := bufio.NewScanner(f)
+		for lineNum := 1; bs.Scan(); lineNum++ {
+			line := strings.TrimSpace(bs.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			name, pass, ok := strings.Cut(line, ":")
+			if !ok || name == "" {
+				return nil, fmt.Errorf("%s:%d: want \"username:password\"", usersFile, lineNum)
+			}
+			a.users[name] = pass
+		}
+		if err := bs.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if localUsers != "" {
+		a.localUIDs = make(set.Set[uint32])
+		for _, name := range strings.Split(localUsers, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				a.anyLocalUser = true
+				continue
+			}
+			uid, err := strconv.ParseUint(name, 10, 32)
+			if err != nil {
+				u, err := user.Lookup(name)
+				if err != nil {
+					return nil, fmt.Errorf("proxy local user: %w", err)
+				}
+				if uid, err = strconv.ParseUint(u.Uid, 10, 32); err != nil {
+					return nil, fmt.Errorf("proxy local user %q has non-numeric UID %q", name, u.Uid)
+				}
+			}
+			a.localUIDs.Add(uint32(uid))
+		}
+	}
+	return a, nil
+}
+
+// checkPassword reports whether username and password are valid proxy
+// credentials, and returns the client's identity for logs.
+func (a *proxyAuth) checkPassword(username, password string) (identity string, ok bool) {
+	want, ok := a.users[username]
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(want)) != 1 {
+		return "", false
+	}
+	return "proxy user " + strconv.Quote(username), true
+}
+
+// checkLocal reports whether the client connected from clientAddr to
+// serverAddr is an allowed local user, and returns its identity for logs.
+func (a *proxyAuth) checkLocal(clientAddr, serverAddr net.Addr) (identity string, ok bool) {
+	if a.localUIDs == nil {
+		return "", false
+	}
+	client, err1 := netip.ParseAddrPort(clientAddr.String())
+	server, err2 := netip.ParseAddrPort(serverAddr.String())
+	if err := errors.Join(err1, err2); err != nil || !client.Addr().IsLoopback() {
+		return "", false
+	}
+	uid, err := localConnUID(netip.AddrPortFrom(client.Addr().Unmap(), client.Port()), netip.AddrPortFrom(server.Addr().Unmap(), server.Port()))
+	if err != nil {
+		a.logf("identifying local proxy client %v: %v", client, err)
+		return "", false
+	}
+	if !a.anyLocalUser && !a.localUIDs.Contains(uid) {
+		return "", false
+	}
+	identity = fmt.Sprintf("local uid %d", uid)
+	if u, err := user.LookupId(fmt.Sprint(uid)); err == nil {
+		identity = fmt.Sprintf("local user %q (uid %d)", u.Username, uid)
+	}
+	return identity, true
+}
+
+// checkHTTP authenticates the client of the HTTP proxy request r, by its
+// Proxy-Authorization header or else as a local user.
+func (a *proxyAuth) checkHTTP(r *http.Request) (identity string, ok bool) {
+	if v, found := strings.CutPrefix(r.Header.Get("Proxy-Authorization"), "Basic "); found && a.users != nil {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			return "", false
+		}
+		username, password, _ := strings.Cut(string(b), ":")
+		return a.checkPassword(username, password)
+	}
+	serverAddr, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	clientAddr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if serverAddr == nil || err != nil {
+		return "", false
+	}
+	return a.checkLocal(clientAddr, serverAddr)
+}
+
+// configureSOCKS5 makes s use a's policy, and logs the flows of its clients.
+func (a *proxyAuth) configureSOCKS5(s *socks5.Server) {
+	if a.users != nil {
+		s.PasswordAuth = a.checkPassword
+	}
+	s.NoAuth = func(c net.Conn) (string, bool) {
+		return a.checkLocal(c.RemoteAddr(), c.LocalAddr())
+	}
+	dial := s.Dialer
+	s.Dialer = func(ctx context.Context, netw, addr string) (net.Conn, error) {
+		a.logf("SOCKS5 proxy: %s: %s %s", socks5.ClientIdentity(ctx), netw, addr)
+		return dial(ctx, netw, addr)
+	}
+}
+
 // httpProxyHandler returns an HTTP proxy http.Handler using the
-// provided backend dialer.
-func httpProxyHandler(dialer func(ctx context.Context, netw, addr string) (net.Conn, error)) http.Handler {
+// provided backend dialer. If auth is non-nil, clients must
+// authenticate, and their requests are logged.
+func httpProxyHandler(dialer func(ctx context.Context, netw, addr string) (net.Conn, error), auth *proxyAuth) http.Handler {
 	rp := &httputil.ReverseProxy{
 		Director: func(r *http.Request) {}, // no change
 		Transport: &http.Transport{
@@ -26,6 +178,17 @@ func httpProxyHandler(dialer func(ctx context.Context, netw, addr string) (net.C
 		},
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth != nil {
+			identity, ok := auth.checkHTTP(r)
+			if !ok {
+				if auth.users != nil {
+					w.Header().Set("Proxy-Authenticate", `Basic realm="tailscale"`)
+				}
+				http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+				return
+			}
+			auth.logf("HTTP proxy: %s: %s %s", identity, r.Method, r.Host)
+		}
 		if r.Method != "CONNECT" {
 			backURL := r.RequestURI
 			if strings.HasPrefix(backURL, "/") || backURL == "*" {
@@ -0,0 +1,26 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"fmt"
+	"net/netip"
+
+	"tailscale.com/net/netstat"
+)
+
+// localConnUID returns the UID of the owner of the local TCP connection from
+// client to server.
+func localConnUID(client, server netip.AddrPort) (uint32, error) {
+	tab, err := netstat.Get()
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range tab.Entries {
+		if e.Local == client && e.Remote == server {
+			return e.OSMetadata.UID, nil
+		}
+	}
+	return 0, fmt.Errorf("no TCP connection from %v to %v", client, server)
+}
@@ -0,0 +1,18 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net/netip"
+	"runtime"
+)
+
+// localConnUID returns the UID of the owner of the local TCP connection from
+// client to server.
+func localConnUID(client, server netip.AddrPort) (uint32, error) {
+	return 0, errors.New("identifying local proxy clients is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestProxyAuthPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	if err := os.WriteFile(path, []byte("# comment\nalice:s3cr:et\n\nbob:\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := newProxyAuth(t.Logf, path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		user, pass string
+		want       bool
+	}{
+		{"alice", "s3cr:et", true},
+		{"alice", "s3cr", false},
+		{"bob", "", true},
+		{"carol", "", false},
+	}
+	for _, tt := range tests {
+		if _, got := a.checkPassword(tt.user, tt.pass); got != tt.want {
+			t.Errorf("checkPassword(%q, %q) = %v, want %v", tt.user, tt.pass, got, tt.want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("alice\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newProxyAuth(t.Logf, path, ""); err == nil {
+		t.Error("newProxyAuth accepted a line without a password")
+	}
+	if a, err := newProxyAuth(t.Logf, "", ""); a != nil || err != nil {
+		t.Errorf("newProxyAuth without flags = %v, %v; want nil, nil", a, err)
+	}
+}
+
+func TestHTTPProxyAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	if err := os.WriteFile(path, []byte("alice:secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := newProxyAuth(t.Logf, path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logged []string
+	a.logf = func(format string, args ...any) { logged = append(logged, fmt.Sprintf(format, args...)) }
+	dial := func(ctx context.Context, netw, addr string) (net.Conn, error) {
+		return nil, errors.New("no backend")
+	}
+	ts := httptest.NewServer(httpProxyHandler(dial, a))
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		user     *url.Userinfo
+		wantCode int
+	}{
+		{nil, http.StatusProxyAuthRequired},
+		{url.UserPassword("alice", "wrong"), http.StatusProxyAuthRequired},
+		{url.UserPassword("alice", "secret"), http.StatusBadGateway},
+	} {
+		proxyURL, _ := url.Parse(ts.URL)
+		proxyURL.User = tt.user
+		c := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+		res, err := c.Get("http://example.com/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.wantCode {
+			t.Errorf("with user %v: status %v, want %v", tt.user, res.StatusCode, tt.wantCode)
+		}
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], `proxy user "alice": GET example.com`) {
+		t.Errorf("logged %q, want one request by alice", logged)
+	}
+}
+
+func TestProxyAuthLocal(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("local users are only identified on Linux")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	sc, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	for _, tt := range []struct {
+		localUsers string
+		want       bool
+	}{
+		{fmt.Sprint(os.Getuid()), true},
+		{"*", true},
+		{fmt.Sprint(os.Getuid() + 1), false},
+	} {
+		a, err := newProxyAuth(t.Logf, "", tt.localUsers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identity, ok := a.checkLocal(sc.RemoteAddr(), sc.LocalAddr())
+		if ok != tt.want {
+			t.Errorf("checkLocal with %q = %v, want %v", tt.localUsers, ok, tt.want)
+		}
+		if ok && !strings.Contains(identity, fmt.Sprintf("uid %d", os.Getuid())) {
+			t.Errorf("identity = %q, want uid %d", identity, os.Getuid())
+		}
+	}
+}
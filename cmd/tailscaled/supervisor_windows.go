@@ -0,0 +1,243 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.zx2c4.com/wireguard/windows/tunnel/winipcfg"
+	"tailscale.com/envknob"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/mak"
+)
+
+var disableDataPlaneSupervisor = envknob.RegisterBool("TS_DEBUG_DISABLE_DATAPLANE_SUPERVISOR")
+
+// Power event types, from winuser.h, as delivered in the EventType of
+// svc.PowerEvent change requests.
+const (
+	pbtAPMSuspend         = 0x4
+	pbtAPMResumeSuspend   = 0x7
+	pbtAPMResumeAutomatic = 0x12
+)
+
+const (
+	// supervisorCheckInterval is how often the supervisor checks on the
+	// Tailscale adapter.
+	supervisorCheckInterval = 30 * time.Second
+	// adapterMissingChecks is how many consecutive checks must find the
+	// adapter missing before the subprocess is restarted, so that the
+	// subprocess recreating the adapter itself isn't mistaken for its loss.
+	adapterMissingChecks = 2
+	// resumeCheckDelay is how long after resuming from sleep the adapter
+	// is checked, giving Windows time to bring the network back up.
+	resumeCheckDelay = 15 * time.Second
+
+	// maxMetricRestores is how many times within metricRestoreWindow the
+	// supervisor restores the interface metric before it stops fighting
+	// whichever program keeps changing it.
+	maxMetricRestores   = 5
+	metricRestoreWindow = 10 * time.Minute
+)
+
+// dataPlaneSupervisor runs in the Windows service process and recovers
+// from ways in which the tailscaled subprocess's data plane breaks without
+// the subprocess noticing, which previously required restarting the service:
+//
+//   - The wintun adapter disappearing, for instance because another VPN
+//     client or a driver update removed it. The subprocess is restarted so
+//     that it recreates the adapter.
+//   - Another program resetting the metric of the Tailscale interface. The
+//     subprocess pins it to 0 while using an exit node and never unpins it,
+//     so any other change is restored, up to maxMetricRestores times per
+//     metricRestoreWindow.
+//   - Resuming from sleep, after which the adapter is checked right away
+//     rather than at the next periodic check.
+//
+// Each recovery is logged and written to the Windows event log.
+type dataPlaneSupervisor struct {
+	logf    logger.Logf
+	eventf  logger.Logf // writes to the Windows event log
+	tunName string
+	restart func() // restarts the tailscaled subprocess
+
+	powerEvents chan uint32
+
+	// The following fields are only accessed by the run goroutine.
+	luid           winipcfg.LUID // of the adapter last found, or 0 if none
+	missing        int           // consecutive checks with the adapter missing
+	pinned         map[winipcfg.AddressFamily]bool
+	metricRestores []time.Time
+}
+
+func newDataPlaneSupervisor(logf, eventf logger.Logf, tunName string, restart func()) *dataPlaneSupervisor {
+	return &dataPlaneSupervisor{
+		logf:        logger.WithPrefix(logf, "supervisor: "),
+		eventf:      eventf,
+		tunName:     tunName,
+		restart:     restart,
+		powerEvents: make(chan uint32, 4),
+	}
+}
+
+// powerEvent notifies the supervisor of a svc.PowerEvent change request with
+// the given event type.
+func (s *dataPlaneSupervisor) powerEvent(eventType uint32) {
+	select {
+	case s.powerEvents <- eventType:
+	default:
+	}
+}
+
+// run supervises the data plane until ctx is done.
+func (s *dataPlaneSupervisor) run(ctx context.Context) {
+	t := time.NewTicker(supervisorCheckInterval)
+	defer t.Stop()
+	var (
+		suspended   bool
+		resumeCheck <-chan time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-s.powerEvents:
+			switch ev {
+			case pbtAPMSuspend:
+				s.logf("system suspending")
+				suspended = true
+			case pbtAPMResumeAutomatic, pbtAPMResumeSuspend:
+				// Both are delivered on a user-initiated resume.
+				if resumeCheck == nil {
+					s.eventf("System resumed from sleep; checking the %q adapter in %v", s.tunName, resumeCheckDelay)
+					resumeCheck = time.After(resumeCheckDelay)
+				}
+				suspended = false
+			}
+		case <-resumeCheck:
+			resumeCheck = nil
+			s.check(true)
+		case <-t.C:
+			if !suspended {
+				s.check(false)
+			}
+		}
+	}
+}
+
+// check checks on the Tailscale adapter, recovering it if needed.
+// afterResume is whether this is the check after resuming from sleep, in
+// which case a missing adapter is recovered right away.
+func (s *dataPlaneSupervisor) check(afterResume bool) {
+	luid, ok, err := findAdapter(s.tunName)
+	if err != nil {
+		s.logf("finding adapter: %v", err)
+		return
+	}
+	if !ok {
+		if s.luid == 0 {
+			// The subprocess hasn't created it (yet), which isn't
+			// something restarting it would fix.
+			return
+		}
+		s.missing++
+		if s.missing < adapterMissingChecks && !afterResume {
+			return
+		}
+		s.eventf("The %q adapter disappeared; restarting tailscaled to recreate it", s.tunName)
+		s.forget()
+		s.restart()
+		return
+	}
+	if luid != s.luid {
+		s.forget()
+		s.luid = luid
+	}
+	s.missing = 0
+	s.checkMetrics()
+}
+
+// forget resets the supervisor's state about the adapter.
+func (s *dataPlaneSupervisor) forget() {
+	s.luid = 0
+	s.missing = 0
+	s.pinned = nil
+	s.metricRestores = nil
+}
+
+// checkMetrics restores the metric of the adapter's IP interfaces that
+// the subprocess pinned to 0, if another program changed it.
+func (s *dataPlaneSupervisor) checkMetrics() {
+	for _, family := range []winipcfg.AddressFamily{windows.AF_INET, windows.AF_INET6} {
+		ipif, err := s.luid.IPInterface(family)
+		if err != nil {
+			continue
+		}
+		if !ipif.UseAutomaticMetric && ipif.Metric == 0 {
+			mak.Set(&s.pinned, family, true)
+			continue
+		}
+		if !s.pinned[family] {
+			continue
+		}
+		if !s.allowMetricRestore(time.Now()) {
+			s.eventf("Another program keeps changing the metric of the %q adapter (%v); no longer restoring it until tailscaled sets it again", s.tunName, familyName(family))
+			delete(s.pinned, family)
+			continue
+		}
+		metric, automatic := ipif.Metric, ipif.UseAutomaticMetric
+		ipif.UseAutomaticMetric = false
+		ipif.Metric = 0
+		if err := ipif.Set(); err != nil {
+			s.logf("restoring %v metric: %v", familyName(family), err)
+			continue
+		}
+		s.eventf("Restored the metric of the %q adapter (%v) after another program changed it to %d (automatic: %v)", s.tunName, familyName(family), metric, automatic)
+	}
+}
+
+// allowMetricRestore reports whether the interface metric may be restored
+// at now, recording the restore if so.
+func (s *dataPlaneSupervisor) allowMetricRestore(now time.Time) bool {
+	recent := s.metricRestores[:0]
+	for _, t := range s.metricRestores {
+		if now.Sub(t) < metricRestoreWindow {
+			recent = append(recent, t)
+		}
+	}
+	s.metricRestores = recent
+	if len(recent) >= maxMetricRestores {
+		return false
+	}
+	s.metricRestores = append(s.metricRestores, now)
+	return true
+}
+
+// findAdapter returns the LUID of the network adapter named name, and
+// whether it exists.
+func findAdapter(name string) (_ winipcfg.LUID, ok bool, _ error) {
+	ifs, err := winipcfg.GetAdaptersAddresses(windows.AF_UNSPEC, winipcfg.GAAFlagIncludeAllInterfaces)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, a := range ifs {
+		if a.FriendlyName() == name {
+			return a.LUID, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func familyName(family winipcfg.AddressFamily) string {
+	switch family {
+	case windows.AF_INET:
+		return "IPv4"
+	case windows.AF_INET6:
+		return "IPv6"
+	}
+	return fmt.Sprintf("family %d", family)
+}
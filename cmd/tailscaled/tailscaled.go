@@ -35,6 +35,7 @@
 	"tailscale.com/control/controlclient"
 	"tailscale.com/drive/driveimpl"
 	"tailscale.com/envknob"
+	"tailscale.com/health"
 	"tailscale.com/hostinfo"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/conffile"
@@ -63,6 +64,7 @@
 	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/multierr"
 	"tailscale.com/util/osshare"
+	"tailscale.com/util/systemd"
 	"tailscale.com/version"
 	"tailscale.com/version/distro"
 	"tailscale.com/wgengine"
@@ -129,7 +131,12 @@ func defaultPort() uint16 {
 	verbose        int
 	socksAddr      string // listen address for SOCKS5 server
 	httpProxyAddr  string // listen address for HTTP proxy server
+	proxyUsers     string // path of file of "username:password" lines for the proxies
+	proxyLocal     string // comma-separated local users allowed to use the proxies
 	disableLogs    bool
+	localLogs      bool
+	logSinks       []string
+	healthProbes   []health.ProbeConfig
 }
 
 var (
@@ -164,6 +171,8 @@ func main() {
 	flag.StringVar(&args.debug, "debug", "", "listen address ([ip]:port) of optional debug server")
 	flag.StringVar(&args.socksAddr, "socks5-server", "", `optional [ip]:port to run a SOCK5 server (e.g. "localhost:1080")`)
 	flag.StringVar(&args.httpProxyAddr, "outbound-http-proxy-listen", "", `optional [ip]:port to run an outbound HTTP proxy (e.g. "localhost:8080")`)
+	flag.StringVar(&args.proxyUsers, "proxy-users-file", "", `optional path of a file of "username:password" lines; if set, clients of the SOCKS5 server and HTTP proxy must authenticate with one of these, or as a --proxy-local-users user`)
+	flag.StringVar(&args.proxyLocal, "proxy-local-users", "", `optional comma-separated local user names or UIDs, or "*" for any local user, allowed to use the SOCKS5 server and HTTP proxy over loopback without a password (Linux only); proxied flows are logged with the user's identity`)
 	flag.StringVar(&args.tunname, "tun", defaultTunName(), `tunnel interface name; use "userspace-networking" (beta) to not use TUN`)
 	flag.Var(flagtype.PortValue(&args.port, defaultPort()), "port", "UDP port to listen on for WireGuard and peer-to-peer traffic; 0 means automatically select")
 	flag.StringVar(&args.statepath, "state", "", "absolute path of state file; use 'kube:<secret-name>' to use Kubernetes secrets or 'arn:aws:ssm:...' to store in AWS SSM; use 'mem:' to not store state and register as an ephemeral node. If empty and --statedir is provided, the default is <statedir>/tailscaled.state. Default: "+paths.DefaultTailscaledStateFile())
@@ -172,7 +181,20 @@ func main() {
 	flag.StringVar(&args.birdSocketPath, "bird-socket", "", "path of the bird unix socket")
 	flag.BoolVar(&printVersion, "version", false, "print version information and exit")
 	flag.BoolVar(&args.disableLogs, "no-logs-no-support", false, "disable log uploads; this also disables any technical support")
+	flag.BoolVar(&args.localLogs, "local-logs", false, "also keep logs in a size-capped, compressed local ring buffer, even if log uploads are disabled; export them with 'tailscale debug logs export'")
 	flag.StringVar(&args.confFile, "config", "", "path to config file, or 'vm:user-data' to use the VM's user-data (EC2)")
+	flag.Func("log-sink", `additional destination to send logs to: "syslog://HOST:PORT", "syslog+tcp://HOST:PORT", "syslog+unix:///dev/log", "loki+https://HOST[/PATH]", or "file:///PATH"; the query parameters "level", "match", and "exclude" filter which logs are sent; may be repeated; combine with --no-logs-no-support to keep logs in-house`, func(s string) error {
+		args.logSinks = append(args.logSinks, s)
+		return nil
+	})
+	flag.Func("health-probe", `local health probe to run periodically, reported in health status while failing; "NAME=URL" for an HTTP check or "NAME=exec:COMMAND [ARGS...]" for a command; may be repeated`, func(s string) error {
+		cfg, err := health.ParseProbeSpec(s)
+		if err != nil {
+			return err
+		}
+		args.healthProbes = append(args.healthProbes, cfg)
+		return nil
+	})
 
 	if len(os.Args) > 0 && filepath.Base(os.Args[0]) == "tailscale" && beCLI != nil {
 		beCLI()
@@ -235,6 +257,9 @@ func main() {
 	if args.disableLogs {
 		envknob.SetNoLogsNoSupport()
 	}
+	if args.localLogs {
+		envknob.SetLocalLogs()
+	}
 
 	if beWindowsSubprocess() {
 		return
@@ -362,7 +387,12 @@ func run() (err error) {
 		sys.Set(netMon)
 	}
 
-	pol := logpolicy.New(logtail.CollectionNode, netMon, sys.HealthTracker(), nil /* use log.Printf */)
+	pol := logpolicy.Options{
+		Collection: logtail.CollectionNode,
+		NetMon:     netMon,
+		Health:     sys.HealthTracker(),
+		LogSinks:   args.logSinks,
+	}.New()
 	pol.SetVerbosityLevel(args.verbose)
 	logPol = pol
 	defer func() {
@@ -411,6 +441,12 @@ func run() (err error) {
 		log.Printf("error in synology migration: %v", err)
 	}
 
+	for _, cfg := range args.healthProbes {
+		if _, err := sys.HealthTracker().AddProbe(cfg); err != nil {
+			return fmt.Errorf("adding health probe: %w", err)
+		}
+	}
+
 	if args.debug != "" {
 		debugMux = newDebugMux()
 	}
@@ -499,6 +535,7 @@ func startIPNServer(ctx context.Context, logf logger.Logf, logID logid.PublicID,
 			}
 			srv.SetLocalBackend(lb)
 			close(wgEngineCreated)
+			go runSystemdWatchdog(ctx, logf, lb)
 			return
 		}
 		lbErr.Store(err) // before the following cancel
@@ -519,11 +556,39 @@ func startIPNServer(ctx context.Context, logf logger.Logf, logID logid.PublicID,
 	return nil
 }
 
+// runSystemdWatchdog pets the systemd watchdog, if enabled, until ctx is
+// done. Before each pet it gets the backend status, which needs the
+// LocalBackend, wgengine and magicsock locks, so if any of them hangs, systemd
+// stops hearing from us and restarts tailscaled.
+func runSystemdWatchdog(ctx context.Context, logf logger.Logf, lb *ipnlocal.LocalBackend) {
+	interval := systemd.WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	logf("systemd watchdog enabled with timeout %v", interval)
+	// Pet twice per interval, as sd_watchdog_enabled(3) recommends.
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	for {
+		lb.StatusWithoutPeers()
+		systemd.Watchdog()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func getLocalBackend(ctx context.Context, logf logger.Logf, logID logid.PublicID, sys *tsd.System) (_ *ipnlocal.LocalBackend, retErr error) {
 	if logPol != nil {
 		logPol.Logtail.SetNetMon(sys.NetMon.Get())
 	}
 
+	pauth, err := newProxyAuth(logger.WithPrefix(logf, "proxyauth: "), args.proxyUsers, args.proxyLocal)
+	if err != nil {
+		return nil, fmt.Errorf("proxy authentication: %w", err)
+	}
 	socksListener, httpProxyListener := mustStartProxyListeners(args.socksAddr, args.httpProxyAddr)
 
 	dialer := &tsdial.Dialer{Logf: logf} // mutated below (before used)
@@ -574,11 +639,12 @@ func getLocalBackend(ctx context.Context, logf logger.Logf, logID logid.PublicID
 			}
 			return udpConn, nil
 		}
+		dialer.MagicDNSDialUDP = ns.DialContextMagicDNS
 	}
 	if socksListener != nil || httpProxyListener != nil {
 		var addrs []string
 		if httpProxyListener != nil {
-			hs := &http.Server{Handler: httpProxyHandler(dialer.UserDial)}
+			hs := &http.Server{Handler: httpProxyHandler(dialer.UserDial, pauth)}
 			go func() {
 				log.Fatalf("HTTP proxy exited: %v", hs.Serve(httpProxyListener))
 			}()
@@ -589,6 +655,9 @@ func getLocalBackend(ctx context.Context, logf logger.Logf, logID logid.PublicID
 				Logf:   logger.WithPrefix(logf, "socks5: "),
 				Dialer: dialer.UserDial,
 			}
+			if pauth != nil {
+				pauth.configureSOCKS5(ss)
+			}
 			go func() {
 				log.Fatalf("SOCKS5 server exited: %v", ss.Serve(socksListener))
 			}()
@@ -616,6 +685,9 @@ func getLocalBackend(ctx context.Context, logf logger.Logf, logID logid.PublicID
 	lb.SetVarRoot(opts.VarRoot)
 	if logPol != nil {
 		lb.SetLogFlusher(logPol.Logtail.StartFlush)
+		if logPol.LocalLog != nil {
+			lb.SetLocalLogExporter(logPol.LocalLog.Export)
+		}
 	}
 	if root := lb.TailscaleVarRoot(); root != "" {
 		dnsfallback.SetCachePath(filepath.Join(root, "derpmap.cached.json"), logf)
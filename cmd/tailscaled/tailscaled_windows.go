@@ -124,6 +124,11 @@ func isWindowsService() bool {
 // lifetime (such as slow shutdowns).
 var syslogf logger.Logf = logger.Discard
 
+// eventlogf is like syslogf, but always writes to the Windows event log, as
+// warnings. It is used for events worth an administrator's attention, such
+// as the data plane supervisor recovering from a failure.
+var eventlogf logger.Logf = logger.Discard
+
 // runWindowsService starts running Tailscale under the Windows
 // Service environment.
 //
@@ -140,6 +145,9 @@ func runWindowsService(pol *logpolicy.Policy) error {
 				syslog.Info(0, fmt.Sprintf(format, args...))
 			}
 		}
+		eventlogf = func(format string, args ...any) {
+			syslog.Warning(1, fmt.Sprintf(format, args...))
+		}
 		defer syslog.Close()
 	}
 
@@ -159,10 +167,25 @@ func (service *ipnService) Execute(args []string, r <-chan svc.ChangeRequest, ch
 	changes <- svc.Status{State: svc.StartPending}
 	syslogf("Service start pending")
 
-	svcAccepts := svc.AcceptStop | svc.AcceptSessionChange
+	svcAccepts := svc.AcceptStop | svc.AcceptSessionChange | svc.AcceptPowerEvent
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+
+	restartCh := make(chan struct{}, 1)
+	supervisor := newDataPlaneSupervisor(log.Printf, func(format string, args ...any) {
+		log.Printf("supervisor: "+format, args...)
+		eventlogf(format, args...)
+	}, defaultTunName(), func() {
+		select {
+		case restartCh <- struct{}{}:
+		default:
+		}
+	})
+	if !disableDataPlaneSupervisor() {
+		go supervisor.run(ctx)
+	}
+
 	doneCh := make(chan struct{})
 	go func() {
 		defer close(doneCh)
@@ -174,7 +197,7 @@ func (service *ipnService) Execute(args []string, r <-chan svc.ChangeRequest, ch
 		// writer that logpolicy already installed as the global
 		// output.
 		logger := log.New(log.Default().Writer(), "", 0)
-		babysitProc(ctx, args, logger.Printf)
+		babysitProc(ctx, args, logger.Printf, restartCh)
 	}()
 
 	changes <- svc.Status{State: svc.Running, Accepts: svcAccepts}
@@ -198,6 +221,9 @@ func (service *ipnService) Execute(args []string, r <-chan svc.ChangeRequest, ch
 				syslogf("Service session change notification")
 				handleSessionChange(cmd)
 				changes <- cmd.CurrentStatus
+			case svc.PowerEvent:
+				supervisor.powerEvent(cmd.EventType)
+				changes <- cmd.CurrentStatus
 			case cmdUninstallWinTun:
 				syslogf("Stopping tailscaled child process and uninstalling WinTun")
 				// At this point, doneCh is the channel which will be closed when the
@@ -341,7 +367,7 @@ func beFirewallKillswitch() bool {
 	}
 
 	start := time.Now()
-	fw, err := wf.New(uint64(luid))
+	fw, err := wf.New(uint64(luid), log.Printf)
 	if err != nil {
 		log.Fatalf("failed to enable firewall: %v", err)
 	}
@@ -354,6 +380,13 @@ func beFirewallKillswitch() bool {
 	for {
 		var routes []netip.Prefix
 		if err := dcd.Decode(&routes); err != nil {
+			// Remove the filters explicitly rather than relying on
+			// the dynamic session going away with the process, so
+			// that they are gone by the time the parent's Wait
+			// returns.
+			if err := fw.Close(); err != nil {
+				log.Printf("failed to remove firewall filters: %v", err)
+			}
 			log.Fatalf("parent process died or requested exit, exiting (%v)", err)
 		}
 		if err := fw.UpdatePermittedRoutes(routes); err != nil {
@@ -390,8 +423,9 @@ func windowsUptime() time.Duration {
 
 // babysitProc runs the current executable as a child process with the
 // provided args, capturing its output, writing it to files, and
-// restarting the process on any crashes.
-func babysitProc(ctx context.Context, args []string, logf logger.Logf) {
+// restarting the process on any crashes. A receive from restart
+// gracefully restarts the process.
+func babysitProc(ctx context.Context, args []string, logf logger.Logf, restart <-chan struct{}) {
 
 	executable, err := os.Executable()
 	if err != nil {
@@ -399,9 +433,10 @@ func babysitProc(ctx context.Context, args []string, logf logger.Logf) {
 	}
 
 	var proc struct {
-		mu     sync.Mutex
-		p      *os.Process
-		wStdin *os.File
+		mu         sync.Mutex
+		p          *os.Process
+		wStdin     *os.File
+		restarting bool // whether the running subprocess was asked to restart
 	}
 
 	done := make(chan struct{})
@@ -426,6 +461,22 @@ func babysitProc(ctx context.Context, args []string, logf logger.Logf) {
 			proc.mu.Unlock()
 		}
 	}()
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-restart:
+				proc.mu.Lock()
+				if proc.wStdin != nil && !proc.restarting {
+					logf("babysitProc: restarting subprocess")
+					proc.restarting = true
+					proc.wStdin.Close()
+				}
+				proc.mu.Unlock()
+			}
+		}
+	}()
 
 	bo := backoff.NewBackoff("babysitProc", logf, 30*time.Second)
 
@@ -490,11 +541,15 @@ func babysitProc(ctx context.Context, args []string, logf logger.Logf) {
 			proc.mu.Lock()
 			proc.p = cmd.Process
 			proc.wStdin = wStdin
+			proc.restarting = false
 			proc.mu.Unlock()
 
 			err = cmd.Wait()
 			log.Printf("subprocess exited: %v", err)
 		}
+		proc.mu.Lock()
+		restarted := proc.restarting
+		proc.mu.Unlock()
 
 		// If the process finishes, clean up the write side of the
 		// pipe. We'll make a new one when we restart the subproc.
@@ -504,7 +559,7 @@ func babysitProc(ctx context.Context, args []string, logf logger.Logf) {
 			log.Fatalf("Process ended.")
 		}
 
-		if time.Since(startTime) < 60*time.Second {
+		if time.Since(startTime) < 60*time.Second && !restarted {
 			bo.BackOff(ctx, fmt.Errorf("subproc early exit: %v", err))
 		} else {
 			// Reset the timeout, since the process ran for a while.
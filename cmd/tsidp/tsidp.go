@@ -11,6 +11,8 @@
 	"context"
 	crand "crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
@@ -28,6 +30,7 @@
 	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -42,12 +45,14 @@
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tsnet"
+	"tailscale.com/tsweb/tracing"
 	"tailscale.com/types/key"
 	"tailscale.com/types/lazy"
 	"tailscale.com/types/views"
 	"tailscale.com/util/mak"
 	"tailscale.com/util/must"
 	"tailscale.com/util/rands"
+	"tailscale.com/util/set"
 	"tailscale.com/version"
 )
 
@@ -65,6 +70,8 @@ type ctxConn struct{
 	flagUseLocalTailscaled = flag.Bool("use-local-tailscaled", false, "use local tailscaled instead of tsnet")
 	flagFunnel             = flag.Bool("funnel", false, "use Tailscale Funnel to make tsidp available on the public internet")
 	flagDir                = flag.String("dir", "", "tsnet state directory; a default one will be created if not provided")
+	flagTagClaims          = flag.String("tag-claims", "", "if non-empty, a JSON file mapping tags (such as \"tag:ci\") to extra claims to include in tokens for nodes with those tags; tagged nodes can only sign in if one of their tags is mapped")
+	flagOTLPTraces         = flag.String("otlp-traces-endpoint", "", "if non-empty, an OTLP/HTTP URL (such as http://localhost:4318/v1/traces) to export OpenTelemetry traces of HTTP requests to; defaults to the OTEL_EXPORTER_OTLP_TRACES_ENDPOINT and OTEL_EXPORTER_OTLP_ENDPOINT environment variables")
 )
 
 func main() {
@@ -73,6 +80,9 @@ func main() {
 	if !envknob.UseWIPCode() {
 		log.Fatal("cmd/tsidp is a work in progress and has not been security reviewed;\nits use requires TAILSCALE_USE_WIP_CODE=1 be set in the environment for now.")
 	}
+	if t := tracing.ConfigureDefault(*flagOTLPTraces, log.Printf); t != nil {
+		defer t.Close()
+	}
 
 	var (
 		lc          *tailscale.LocalClient
@@ -159,15 +169,27 @@ func main() {
 	} else {
 		srv.serverURL = fmt.Sprintf("https://%s", strings.TrimSuffix(st.Self.DNSName, "."))
 	}
-	if *flagFunnel {
-		f, err := os.Open(funnelClientsFile)
-		if err == nil {
-			srv.funnelClients = make(map[string]*funnelClient)
-			if err := json.NewDecoder(f).Decode(&srv.funnelClients); err != nil {
-				log.Fatalf("could not parse %s: %v", funnelClientsFile, err)
-			}
-		} else if !errors.Is(err, os.ErrNotExist) {
-			log.Fatalf("could not open %s: %v", funnelClientsFile, err)
+	// Clients registered with /clients/new or /register are persisted
+	// regardless of -funnel, since dynamically registered clients may also
+	// be used by relying parties within the tailnet.
+	f, err := os.Open(funnelClientsFile)
+	if err == nil {
+		srv.funnelClients = make(map[string]*funnelClient)
+		if err := json.NewDecoder(f).Decode(&srv.funnelClients); err != nil {
+			log.Fatalf("could not parse %s: %v", funnelClientsFile, err)
+		}
+		f.Close()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("could not open %s: %v", funnelClientsFile, err)
+	}
+	if *flagTagClaims != "" {
+		b, err := os.ReadFile(*flagTagClaims)
+		if err != nil {
+			log.Fatalf("could not read -tag-claims: %v", err)
+		}
+		srv.tagClaims, err = parseTagClaims(b)
+		if err != nil {
+			log.Fatalf("could not parse -tag-claims file %s: %v", *flagTagClaims, err)
 		}
 	}
 
@@ -185,7 +207,9 @@ func main() {
 
 	for _, ln := range lns {
 		server := http.Server{
-			Handler: srv,
+			Handler: tracing.Handler(srv, func(r *http.Request) string {
+				return r.Method + " " + r.URL.Path
+			}),
 			ConnContext: func(ctx context.Context, c net.Conn) context.Context {
 				return context.WithValue(ctx, ctxConn{}, c)
 			},
@@ -281,6 +305,10 @@ type idpServer struct {
 	funnel      bool
 	localTSMode bool
 
+	// tagClaims maps tags to extra claims for tagged nodes. Tagged nodes
+	// without any mapped tag can't sign in.
+	tagClaims map[string]map[string]any
+
 	lazyMux        lazy.SyncValue[*http.ServeMux]
 	lazySigningKey lazy.SyncValue[*signingKey]
 	lazySigner     lazy.SyncValue[jose.Signer]
@@ -288,6 +316,7 @@ type idpServer struct {
 	mu            sync.Mutex               // guards the fields below
 	code          map[string]*authRequest  // keyed by random hex
 	accessToken   map[string]*authRequest  // keyed by random hex
+	refreshToken  map[string]*authRequest  // keyed by random hex
 	funnelClients map[string]*funnelClient // keyed by client ID
 }
 
@@ -316,6 +345,11 @@ type authRequest struct {
 	// redirectURI is the redirect_uri presented in the request.
 	redirectURI string
 
+	// codeChallenge and codeChallengeMethod are the PKCE (RFC 7636)
+	// parameters presented in the request, if any.
+	codeChallenge       string
+	codeChallengeMethod string // "S256" or "plain"
+
 	// remoteUser is the user who is being authenticated.
 	remoteUser *apitype.WhoIsResponse
 
@@ -345,6 +379,14 @@ func (ar *authRequest) allowRelyingParty(r *http.Request, lc *tailscale.LocalCli
 			clientID = r.FormValue("client_id")
 			clientSecret = r.FormValue("client_secret")
 		}
+		if ar.funnelRP.Public {
+			// Public clients can't keep a secret; they're authenticated
+			// by the PKCE code verifier instead.
+			if ar.funnelRP.ID != clientID {
+				return fmt.Errorf("tsidp: invalid client ID")
+			}
+			return nil
+		}
 		if ar.funnelRP.ID != clientID || ar.funnelRP.Secret != clientSecret {
 			return fmt.Errorf("tsidp: invalid client credentials")
 		}
@@ -360,6 +402,33 @@ func (ar *authRequest) allowRelyingParty(r *http.Request, lc *tailscale.LocalCli
 	return nil
 }
 
+// verifyCodeVerifier checks the PKCE code_verifier presented when
+// exchanging the authorization code against the code challenge presented
+// in the authorization request, per RFC 7636 section 4.6.
+func (ar *authRequest) verifyCodeVerifier(verifier string) error {
+	if ar.codeChallenge == "" {
+		if verifier != "" {
+			return errors.New("tsidp: code_verifier provided without code_challenge")
+		}
+		return nil
+	}
+	if verifier == "" {
+		return errors.New("tsidp: code_verifier is required")
+	}
+	var want string
+	switch ar.codeChallengeMethod {
+	case "S256":
+		h := sha256.Sum256([]byte(verifier))
+		want = base64.RawURLEncoding.EncodeToString(h[:])
+	case "plain":
+		want = verifier
+	}
+	if subtle.ConstantTimeCompare([]byte(want), []byte(ar.codeChallenge)) != 1 {
+		return errors.New("tsidp: invalid code_verifier")
+	}
+	return nil
+}
+
 func (s *idpServer) authorize(w http.ResponseWriter, r *http.Request) {
 	// This URL is visited by the user who is being authenticated. If they are
 	// visiting the URL over Funnel, that means they are not part of the
@@ -395,22 +464,39 @@ func (s *idpServer) authorize(w http.ResponseWriter, r *http.Request) {
 
 	code := rands.HexString(32)
 	ar := &authRequest{
-		nonce:       uq.Get("nonce"),
-		remoteUser:  who,
-		redirectURI: redirectURI,
-		clientID:    uq.Get("client_id"),
+		nonce:               uq.Get("nonce"),
+		remoteUser:          who,
+		redirectURI:         redirectURI,
+		clientID:            uq.Get("client_id"),
+		codeChallenge:       uq.Get("code_challenge"),
+		codeChallengeMethod: uq.Get("code_challenge_method"),
+	}
+	if ar.codeChallenge != "" {
+		switch ar.codeChallengeMethod {
+		case "":
+			ar.codeChallengeMethod = "plain"
+		case "S256", "plain":
+		default:
+			http.Error(w, "tsidp: unsupported code_challenge_method", http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	c, registered := s.funnelClients[ar.clientID]
+	s.mu.Unlock()
+	if registered && !c.allowsRedirectURI(ar.redirectURI) {
+		http.Error(w, "tsidp: redirect_uri mismatch", http.StatusBadRequest)
+		return
 	}
 
 	if r.URL.Path == "/authorize/funnel" {
-		s.mu.Lock()
-		c, ok := s.funnelClients[ar.clientID]
-		s.mu.Unlock()
-		if !ok {
+		if !registered {
 			http.Error(w, "tsidp: invalid client ID", http.StatusBadRequest)
 			return
 		}
-		if ar.redirectURI != c.RedirectURI {
-			http.Error(w, "tsidp: redirect_uri mismatch", http.StatusBadRequest)
+		if c.Public && ar.codeChallenge == "" {
+			http.Error(w, "tsidp: public clients must use PKCE", http.StatusBadRequest)
 			return
 		}
 		ar.funnelRP = c
@@ -448,6 +534,7 @@ func (s *idpServer) newMux() *http.ServeMux {
 	mux.HandleFunc("/userinfo", s.serveUserInfo)
 	mux.HandleFunc("/token", s.serveToken)
 	mux.HandleFunc("/clients/", s.serveClients)
+	mux.HandleFunc("/register", s.serveRegister)
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/" {
 			io.WriteString(w, "<html><body><h1>Tailscale OIDC IdP</h1>")
@@ -487,33 +574,61 @@ func (s *idpServer) serveUserInfo(w http.ResponseWriter, r *http.Request) {
 		s.mu.Lock()
 		delete(s.accessToken, tk)
 		s.mu.Unlock()
+		return
 	}
 
-	ui := userInfo{}
-	if ar.remoteUser.Node.IsTagged() {
-		http.Error(w, "tsidp: tagged nodes not supported", http.StatusBadRequest)
+	n := ar.remoteUser.Node.View()
+	extraClaims, err := s.claimsForNode(n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	ui.Sub = ar.remoteUser.Node.User.String()
-	ui.Name = ar.remoteUser.UserProfile.DisplayName
-	ui.Email = ar.remoteUser.UserProfile.LoginName
-	ui.Picture = ar.remoteUser.UserProfile.ProfilePicURL
+	ui := userInfo{}
+	if n.IsTagged() {
+		ui.Sub = string(n.StableID())
+		ui.Name = n.ComputedName()
+		ui.Tags = n.Tags().AsSlice()
+	} else {
+		ui.Sub = ar.remoteUser.Node.User.String()
+		ui.Name = ar.remoteUser.UserProfile.DisplayName
+		ui.Email = ar.remoteUser.UserProfile.LoginName
+		ui.Picture = ar.remoteUser.UserProfile.ProfilePicURL
 
-	// TODO(maisem): not sure if this is the right thing to do
-	ui.UserName, _, _ = strings.Cut(ar.remoteUser.UserProfile.LoginName, "@")
+		// TODO(maisem): not sure if this is the right thing to do
+		ui.UserName, _, _ = strings.Cut(ar.remoteUser.UserProfile.LoginName, "@")
+	}
+
+	var resp any = ui
+	if len(extraClaims) > 0 {
+		m := make(map[string]any, len(extraClaims)+6)
+		for k, v := range extraClaims {
+			m[k] = v
+		}
+		b, err := json.Marshal(ui)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.Unmarshal(b, &m); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp = m
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(ui); err != nil {
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
 type userInfo struct {
-	Sub      string `json:"sub"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Picture  string `json:"picture"`
-	UserName string `json:"username"`
+	Sub      string   `json:"sub"`
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Picture  string   `json:"picture"`
+	UserName string   `json:"username"`
+	Tags     []string `json:"tags,omitempty"`
 }
 
 func (s *idpServer) serveToken(w http.ResponseWriter, r *http.Request) {
@@ -521,10 +636,18 @@ func (s *idpServer) serveToken(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "tsidp: method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if r.FormValue("grant_type") != "authorization_code" {
+	switch r.FormValue("grant_type") {
+	case "authorization_code":
+		s.serveTokenAuthorizationCode(w, r)
+	case "refresh_token":
+		s.serveTokenRefresh(w, r)
+	default:
 		http.Error(w, "tsidp: grant_type not supported", http.StatusBadRequest)
-		return
 	}
+}
+
+// serveTokenAuthorizationCode exchanges an authorization code for tokens.
+func (s *idpServer) serveTokenAuthorizationCode(w http.ResponseWriter, r *http.Request) {
 	code := r.FormValue("code")
 	if code == "" {
 		http.Error(w, "tsidp: code is required", http.StatusBadRequest)
@@ -549,6 +672,64 @@ func (s *idpServer) serveToken(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "tsidp: redirect_uri mismatch", http.StatusBadRequest)
 		return
 	}
+	if err := ar.verifyCodeVerifier(r.FormValue("code_verifier")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.issueTokens(w, ar)
+}
+
+// serveTokenRefresh exchanges a refresh token for new tokens. The refresh
+// token is rotated: the presented one is invalidated and a new one is
+// issued.
+func (s *idpServer) serveTokenRefresh(w http.ResponseWriter, r *http.Request) {
+	rt := r.FormValue("refresh_token")
+	if rt == "" {
+		http.Error(w, "tsidp: refresh_token is required", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	ar, ok := s.refreshToken[rt]
+	if ok {
+		delete(s.refreshToken, rt)
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "tsidp: invalid refresh token", http.StatusBadRequest)
+		return
+	}
+	if ar.validTill.Before(time.Now()) {
+		http.Error(w, "tsidp: refresh token expired", http.StatusBadRequest)
+		return
+	}
+	if err := ar.allowRelyingParty(r, s.lc); err != nil {
+		log.Printf("Error allowing relying party: %v", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if clientID := r.FormValue("client_id"); clientID != "" && clientID != ar.clientID {
+		http.Error(w, "tsidp: refresh token issued to a different client", http.StatusBadRequest)
+		return
+	}
+
+	// Look up the node again, so that tokens stop being refreshed once
+	// the node is removed from the tailnet, and claims reflect any changes
+	// to the node (such as its tags) since the initial sign-in.
+	who, err := s.lc.WhoIsNodeKey(r.Context(), ar.remoteUser.Node.Key)
+	if err != nil {
+		log.Printf("Error getting WhoIs for refresh: %v", err)
+		http.Error(w, "tsidp: node no longer in tailnet", http.StatusBadRequest)
+		return
+	}
+	nar := *ar
+	nar.remoteUser = who
+	nar.nonce = "" // only included in the ID token from the initial sign-in
+	s.issueTokens(w, &nar)
+}
+
+// issueTokens writes a token response with a new ID token, access token,
+// and refresh token for the (already authorized) request ar.
+func (s *idpServer) issueTokens(w http.ResponseWriter, ar *authRequest) {
 	signer, err := s.oidcSigner()
 	if err != nil {
 		log.Printf("Error getting signer: %v", err)
@@ -558,11 +739,10 @@ func (s *idpServer) serveToken(w http.ResponseWriter, r *http.Request) {
 	jti := rands.HexString(32)
 	who := ar.remoteUser
 
-	// TODO(maisem): not sure if this is the right thing to do
-	userName, _, _ := strings.Cut(ar.remoteUser.UserProfile.LoginName, "@")
 	n := who.Node.View()
-	if n.IsTagged() {
-		http.Error(w, "tsidp: tagged nodes not supported", http.StatusBadRequest)
+	extraClaims, err := s.claimsForNode(n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -576,7 +756,6 @@ func (s *idpServer) serveToken(w http.ResponseWriter, r *http.Request) {
 			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    s.serverURL,
 			NotBefore: jwt.NewNumericDate(now),
-			Subject:   n.User().String(),
 		},
 		Nonce:     ar.nonce,
 		Key:       n.Key(),
@@ -584,16 +763,25 @@ func (s *idpServer) serveToken(w http.ResponseWriter, r *http.Request) {
 		NodeID:    n.ID(),
 		NodeName:  n.Name(),
 		Tailnet:   tcd,
-		UserID:    n.User(),
-		Email:     who.UserProfile.LoginName,
-		UserName:  userName,
+	}
+	if n.IsTagged() {
+		// Tagged nodes have no user identity, so they're identified by
+		// their stable node ID.
+		tsClaims.Subject = string(n.StableID())
+		tsClaims.Tags = n.Tags().AsSlice()
+	} else {
+		tsClaims.Subject = n.User().String()
+		tsClaims.UserID = n.User()
+		tsClaims.Email = who.UserProfile.LoginName
+		// TODO(maisem): not sure if this is the right thing to do
+		tsClaims.UserName, _, _ = strings.Cut(who.UserProfile.LoginName, "@")
 	}
 	if ar.localRP {
 		tsClaims.Issuer = s.loopbackURL
 	}
 
 	// Create an OIDC token using this issuer's signer.
-	token, err := jwt.Signed(signer).Claims(tsClaims).CompactSerialize()
+	token, err := jwt.Signed(signer).Claims(tsClaims).Claims(extraClaims).CompactSerialize()
 	if err != nil {
 		log.Printf("Error getting token: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -601,22 +789,35 @@ func (s *idpServer) serveToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	at := rands.HexString(32)
+	rt := rands.HexString(32)
+	atReq, rtReq := *ar, *ar
+	atReq.validTill = now.Add(5 * time.Minute)
+	rtReq.validTill = now.Add(refreshTokenLifetime)
 	s.mu.Lock()
-	ar.validTill = now.Add(5 * time.Minute)
-	mak.Set(&s.accessToken, at, ar)
+	mak.Set(&s.accessToken, at, &atReq)
+	mak.Set(&s.refreshToken, rt, &rtReq)
 	s.mu.Unlock()
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
 	if err := json.NewEncoder(w).Encode(oidcTokenResponse{
-		AccessToken: at,
-		TokenType:   "Bearer",
-		ExpiresIn:   5 * 60,
-		IDToken:     token,
+		AccessToken:  at,
+		TokenType:    "Bearer",
+		ExpiresIn:    5 * 60,
+		IDToken:      token,
+		RefreshToken: rt,
 	}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
+// refreshTokenLifetime is how long a refresh token can be used for. Each
+// use issues a new refresh token with a new lifetime.
+//
+// Refresh tokens are only kept in memory, so restarting tsidp requires
+// all relying parties to sign in again.
+const refreshTokenLifetime = 30 * 24 * time.Hour
+
 type oidcTokenResponse struct {
 	IDToken      string `json:"id_token"`
 	TokenType    string `json:"token_type"`
@@ -716,6 +917,12 @@ type openIDProviderMetadata struct {
 	IDTokenSigningAlgValuesSupported views.Slice[string] `json:"id_token_signing_alg_values_supported"`
 	// TODO(maisem): maybe add other fields?
 	// Currently we fill out the REQUIRED fields, scopes_supported and claims_supported.
+
+	// OAuth 2.0 features beyond the basic authorization code flow.
+	RegistrationEndpoint              string              `json:"registration_endpoint,omitempty"`
+	GrantTypesSupported               views.Slice[string] `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported     views.Slice[string] `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported views.Slice[string] `json:"token_endpoint_auth_methods_supported"`
 }
 
 type tailscaleClaims struct {
@@ -735,6 +942,79 @@ type tailscaleClaims struct {
 	// It is a temporary (2023-11-15) hack during development.
 	// We should probably let this be configured via grants.
 	UserName string `json:"username,omitempty"`
+
+	// Tags are the ACL tags of the node, if it's tagged. Tagged nodes
+	// have no user, so Email, UserID, and UserName are empty.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// reservedClaims are the claims that tsidp sets itself, which can't be
+// overridden by -tag-claims.
+var reservedClaims = set.Of(
+	"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "nonce", "azp", "at_hash",
+	"key", "addresses", "nid", "node", "tailnet", "email", "uid", "username", "tags",
+	"name", "picture",
+)
+
+// parseTagClaims parses the -tag-claims file, a JSON object mapping tags
+// to objects of extra claims.
+func parseTagClaims(b []byte) (map[string]map[string]any, error) {
+	var m map[string]map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for tag, claims := range m {
+		if !strings.HasPrefix(tag, "tag:") {
+			return nil, fmt.Errorf("%q is not a tag", tag)
+		}
+		for k := range claims {
+			if reservedClaims.Contains(k) {
+				return nil, fmt.Errorf("claim %q for %s is reserved", k, tag)
+			}
+		}
+	}
+	return m, nil
+}
+
+// claimsForNode returns the extra claims to include in tokens for n.
+//
+// Tagged nodes get the claims of each of their tags that's in s.tagClaims.
+// List-valued claims are merged across tags; for other claims, later tags
+// override earlier ones. Tagged nodes without any mapped tag can't sign
+// in, and an error is returned.
+func (s *idpServer) claimsForNode(n tailcfg.NodeView) (map[string]any, error) {
+	if !n.IsTagged() {
+		return nil, nil
+	}
+	var out map[string]any
+	mapped := false
+	for _, tag := range n.Tags().All() {
+		claims, ok := s.tagClaims[tag]
+		if !ok {
+			continue
+		}
+		mapped = true
+		for k, v := range claims {
+			if list, ok := v.([]any); ok {
+				prev, _ := out[k].([]any)
+				for _, e := range list {
+					switch e.(type) {
+					case string, float64, bool, nil:
+						if slices.Contains(prev, e) {
+							continue
+						}
+					}
+					prev = append(prev, e)
+				}
+				v = prev
+			}
+			mak.Set(&out, k, v)
+		}
+	}
+	if !mapped {
+		return nil, errors.New("tsidp: tagged nodes not supported")
+	}
+	return out, nil
 }
 
 var (
@@ -747,7 +1027,16 @@ type tailscaleClaims struct {
 	})
 
 	// As defined in the OpenID spec this should be "openid".
-	openIDSupportedScopes = views.SliceOf([]string{"openid", "email", "profile"})
+	openIDSupportedScopes = views.SliceOf([]string{"openid", "email", "profile", "offline_access"})
+
+	// Refresh tokens are issued with every ID token.
+	openIDSupportedGrantTypes = views.SliceOf([]string{"authorization_code", "refresh_token"})
+
+	// PKCE (RFC 7636) code challenge methods. Public clients must use PKCE.
+	openIDSupportedCodeChallengeMethods = views.SliceOf([]string{"S256", "plain"})
+
+	// "none" is for public clients, which are authenticated with PKCE.
+	openIDSupportedTokenAuthMethods = views.SliceOf([]string{"client_secret_basic", "client_secret_post", "none"})
 
 	// We only support getting the id_token.
 	openIDSupportedReponseTypes = views.SliceOf([]string{"id_token", "code"})
@@ -771,15 +1060,17 @@ func (s *idpServer) serveOpenIDConfig(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error parsing remote addr: %v", err)
 		return
 	}
-	var authorizeEndpoint string
+	var authorizeEndpoint, registrationEndpoint string
 	rpEndpoint := s.serverURL
 	if isFunnelRequest(r) {
 		authorizeEndpoint = fmt.Sprintf("%s/authorize/funnel", s.serverURL)
 	} else if who, err := s.lc.WhoIs(r.Context(), r.RemoteAddr); err == nil {
 		authorizeEndpoint = fmt.Sprintf("%s/authorize/%d", s.serverURL, who.Node.ID)
+		registrationEndpoint = s.serverURL + "/register"
 	} else if ap.Addr().IsLoopback() {
 		rpEndpoint = s.loopbackURL
 		authorizeEndpoint = fmt.Sprintf("%s/authorize/localhost", s.serverURL)
+		registrationEndpoint = s.loopbackURL + "/register"
 	} else {
 		log.Printf("Error getting WhoIs: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -800,18 +1091,45 @@ func (s *idpServer) serveOpenIDConfig(w http.ResponseWriter, r *http.Request) {
 		SubjectTypesSupported:            openIDSupportedSubjectTypes,
 		ClaimsSupported:                  openIDSupportedClaims,
 		IDTokenSigningAlgValuesSupported: openIDSupportedSigningAlgos,
+
+		RegistrationEndpoint:              registrationEndpoint,
+		GrantTypesSupported:               openIDSupportedGrantTypes,
+		CodeChallengeMethodsSupported:     openIDSupportedCodeChallengeMethods,
+		TokenEndpointAuthMethodsSupported: openIDSupportedTokenAuthMethods,
 	}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
 // funnelClient represents an OIDC client/relying party that is accessing the
-// IDP over Funnel.
+// IDP over Funnel, or one that was registered dynamically.
 type funnelClient struct {
 	ID          string `json:"client_id"`
 	Secret      string `json:"client_secret,omitempty"`
 	Name        string `json:"name,omitempty"`
 	RedirectURI string `json:"redirect_uri"`
+
+	// RedirectURIs are the allowed redirect URIs of a dynamically
+	// registered client, which may have more than one. RedirectURI is
+	// always the first of them.
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+
+	// Public is whether the client is a public client (such as a native
+	// or single-page app) that can't keep a secret. Public clients have
+	// no Secret and must use PKCE.
+	Public bool `json:"public,omitempty"`
+}
+
+// allowsRedirectURI reports whether u is one of c's redirect URIs.
+func (c *funnelClient) allowsRedirectURI(u string) bool {
+	return u == c.RedirectURI || slices.Contains(c.RedirectURIs, u)
+}
+
+// redacted returns a copy of c without its secret.
+func (c *funnelClient) redacted() funnelClient {
+	rc := *c
+	rc.Secret = ""
+	return rc
 }
 
 // /clients is a privileged endpoint that allows the visitor to create new
@@ -846,12 +1164,8 @@ func (s *idpServer) serveClients(w http.ResponseWriter, r *http.Request) {
 	case "DELETE":
 		s.serveDeleteClient(w, r, path)
 	case "GET":
-		json.NewEncoder(w).Encode(&funnelClient{
-			ID:          c.ID,
-			Name:        c.Name,
-			Secret:      "",
-			RedirectURI: c.RedirectURI,
-		})
+		rc := c.redacted()
+		json.NewEncoder(w).Encode(&rc)
 	default:
 		http.Error(w, "tsidp: method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -897,12 +1211,7 @@ func (s *idpServer) serveGetClientsList(w http.ResponseWriter, r *http.Request)
 	s.mu.Lock()
 	redactedClients := make([]funnelClient, 0, len(s.funnelClients))
 	for _, c := range s.funnelClients {
-		redactedClients = append(redactedClients, funnelClient{
-			ID:          c.ID,
-			Name:        c.Name,
-			Secret:      "",
-			RedirectURI: c.RedirectURI,
-		})
+		redactedClients = append(redactedClients, c.redacted())
 	}
 	s.mu.Unlock()
 	json.NewEncoder(w).Encode(redactedClients)
@@ -936,6 +1245,133 @@ func (s *idpServer) serveDeleteClient(w http.ResponseWriter, r *http.Request, cl
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// clientRegistrationRequest is the subset of RFC 7591 client metadata
+// supported by the /register endpoint.
+type clientRegistrationRequest struct {
+	RedirectURIs            []string `json:"redirect_uris"`
+	ClientName              string   `json:"client_name,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+}
+
+// clientRegistrationResponse is the RFC 7591 client information response.
+type clientRegistrationResponse struct {
+	ClientID                string   `json:"client_id"`
+	ClientSecret            string   `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64    `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   int64    `json:"client_secret_expires_at"` // 0 means never
+	ClientName              string   `json:"client_name,omitempty"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+}
+
+// validate checks req and fills in defaults for unset fields, returning
+// an RFC 7591 error code and description if req is invalid.
+func (req *clientRegistrationRequest) validate() (errCode, desc string) {
+	if len(req.RedirectURIs) == 0 {
+		return "invalid_redirect_uri", "redirect_uris is required"
+	}
+	for _, ru := range req.RedirectURIs {
+		u, err := url.Parse(ru)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return "invalid_redirect_uri", fmt.Sprintf("invalid redirect URI %q", ru)
+		}
+	}
+	switch req.TokenEndpointAuthMethod {
+	case "":
+		req.TokenEndpointAuthMethod = "client_secret_basic"
+	case "client_secret_basic", "client_secret_post", "none":
+	default:
+		return "invalid_client_metadata", fmt.Sprintf("unsupported token_endpoint_auth_method %q", req.TokenEndpointAuthMethod)
+	}
+	if len(req.GrantTypes) == 0 {
+		req.GrantTypes = []string{"authorization_code"}
+	}
+	for _, gt := range req.GrantTypes {
+		if !views.SliceContains(openIDSupportedGrantTypes, gt) {
+			return "invalid_client_metadata", fmt.Sprintf("unsupported grant type %q", gt)
+		}
+	}
+	if len(req.ResponseTypes) == 0 {
+		req.ResponseTypes = []string{"code"}
+	}
+	for _, rt := range req.ResponseTypes {
+		if rt != "code" {
+			return "invalid_client_metadata", fmt.Sprintf("unsupported response type %q", rt)
+		}
+	}
+	return "", ""
+}
+
+// /register is the RFC 7591 dynamic client registration endpoint. Like
+// /clients, registering clients is privileged, so it is only accessible
+// over the tailnet.
+func (s *idpServer) serveRegister(w http.ResponseWriter, r *http.Request) {
+	if isFunnelRequest(r) {
+		http.Error(w, "tsidp: not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "tsidp: method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeErr := func(code int, errCode, desc string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":             errCode,
+			"error_description": desc,
+		})
+	}
+	var req clientRegistrationRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+		writeErr(http.StatusBadRequest, "invalid_client_metadata", "invalid JSON: "+err.Error())
+		return
+	}
+	if errCode, desc := req.validate(); errCode != "" {
+		writeErr(http.StatusBadRequest, errCode, desc)
+		return
+	}
+
+	c := &funnelClient{
+		ID:           rands.HexString(32),
+		Name:         req.ClientName,
+		RedirectURI:  req.RedirectURIs[0],
+		RedirectURIs: req.RedirectURIs,
+		Public:       req.TokenEndpointAuthMethod == "none",
+	}
+	if !c.Public {
+		c.Secret = rands.HexString(64)
+	}
+	s.mu.Lock()
+	mak.Set(&s.funnelClients, c.ID, c)
+	if err := s.storeFunnelClientsLocked(); err != nil {
+		delete(s.funnelClients, c.ID)
+		s.mu.Unlock()
+		log.Printf("could not write funnel clients db: %v", err)
+		writeErr(http.StatusInternalServerError, "server_error", "could not write clients to db")
+		return
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(clientRegistrationResponse{
+		ClientID:                c.ID,
+		ClientSecret:            c.Secret,
+		ClientIDIssuedAt:        time.Now().Unix(),
+		ClientName:              c.Name,
+		RedirectURIs:            c.RedirectURIs,
+		TokenEndpointAuthMethod: req.TokenEndpointAuthMethod,
+		GrantTypes:              req.GrantTypes,
+		ResponseTypes:           req.ResponseTypes,
+	})
+}
+
 // storeFunnelClientsLocked writes the current mapping of OIDC client ID/secret
 // pairs for RPs that access the IDP over funnel. s.mu must be held while
 // calling this.
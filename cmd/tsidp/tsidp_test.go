@@ -0,0 +1,229 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+// chdirTemp changes into a temporary directory for the duration of the
+// test, as tsidp keeps its state in the current directory.
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	old, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(old) })
+}
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	// From RFC 7636, Appendix B.
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name     string
+		ar       authRequest
+		verifier string
+		wantErr  bool
+	}{
+		{"no-pkce", authRequest{}, "", false},
+		{"unexpected-verifier", authRequest{}, verifier, true},
+		{"s256", authRequest{codeChallenge: challenge, codeChallengeMethod: "S256"}, verifier, false},
+		{"s256-wrong", authRequest{codeChallenge: challenge, codeChallengeMethod: "S256"}, verifier + "x", true},
+		{"s256-missing", authRequest{codeChallenge: challenge, codeChallengeMethod: "S256"}, "", true},
+		{"plain", authRequest{codeChallenge: verifier, codeChallengeMethod: "plain"}, verifier, false},
+		{"plain-wrong", authRequest{codeChallenge: verifier, codeChallengeMethod: "plain"}, challenge, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ar.verifyCodeVerifier(tt.verifier)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyCodeVerifier = %v; wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClaimsForNode(t *testing.T) {
+	tagClaims, err := parseTagClaims([]byte(`{
+		"tag:ci": {"groups": ["ci", "builders"], "role": "builder"},
+		"tag:prod": {"groups": ["prod", "builders"], "role": "deployer"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &idpServer{tagClaims: tagClaims}
+
+	got, err := s.claimsForNode((&tailcfg.Node{Tags: []string{"tag:ci", "tag:other", "tag:prod"}}).View())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"groups": []any{"ci", "builders", "prod"},
+		"role":   "deployer",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("claimsForNode = %v; want %v", got, want)
+	}
+
+	if _, err := s.claimsForNode((&tailcfg.Node{Tags: []string{"tag:other"}}).View()); err == nil {
+		t.Errorf("claimsForNode of node without mapped tags succeeded")
+	}
+	if got, err := s.claimsForNode((&tailcfg.Node{User: 1}).View()); err != nil || got != nil {
+		t.Errorf("claimsForNode of user node = %v, %v; want nil, nil", got, err)
+	}
+
+	for _, bad := range []string{
+		`{"ci": {"role": "builder"}}`,
+		`{"tag:ci": {"sub": "root"}}`,
+		`{"tag:ci": "role"}`,
+	} {
+		if _, err := parseTagClaims([]byte(bad)); err == nil {
+			t.Errorf("parseTagClaims(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestServeRegister(t *testing.T) {
+	chdirTemp(t)
+	s := &idpServer{}
+
+	register := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.serveRegister(rec, httptest.NewRequest("POST", "/register", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := register(`{"redirect_uris": ["https://app.example.com/cb", "http://localhost:8080/cb"], "client_name": "app", "token_endpoint_auth_method": "none"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register: %v %s", rec.Code, rec.Body)
+	}
+	var resp clientRegistrationResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ClientID == "" || resp.ClientSecret != "" || resp.TokenEndpointAuthMethod != "none" ||
+		!reflect.DeepEqual(resp.GrantTypes, []string{"authorization_code"}) {
+		t.Errorf("unexpected registration response: %+v", resp)
+	}
+	c := s.funnelClients[resp.ClientID]
+	if c == nil || !c.Public || !c.allowsRedirectURI("http://localhost:8080/cb") || c.allowsRedirectURI("https://evil.example.com/cb") {
+		t.Errorf("unexpected registered client: %+v", c)
+	}
+	if _, err := os.Stat(funnelClientsFile); err != nil {
+		t.Errorf("registered clients not persisted: %v", err)
+	}
+
+	rec = register(`{"redirect_uris": ["https://app.example.com/cb"], "grant_types": ["authorization_code", "refresh_token"]}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusCreated || resp.ClientSecret == "" || resp.TokenEndpointAuthMethod != "client_secret_basic" {
+		t.Errorf("confidential registration: %v %+v", rec.Code, resp)
+	}
+
+	for _, bad := range []string{
+		`{}`,
+		`{"redirect_uris": ["/relative"]}`,
+		`{"redirect_uris": ["https://app.example.com/cb#frag"]}`,
+		`{"redirect_uris": ["https://app.example.com/cb"], "grant_types": ["implicit"]}`,
+		`{"redirect_uris": ["https://app.example.com/cb"], "token_endpoint_auth_method": "private_key_jwt"}`,
+	} {
+		if rec := register(bad); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"error":"invalid_`) {
+			t.Errorf("register(%s) = %v %s; want 400 RFC 7591 error", bad, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestServeTokenPKCEAndRefreshToken(t *testing.T) {
+	chdirTemp(t)
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	s := &idpServer{serverURL: "https://idp.example.ts.net", loopbackURL: "http://localhost:8080"}
+	newCode := func() string {
+		code := "code-" + verifier[:8]
+		s.code = map[string]*authRequest{code: {
+			localRP:             true,
+			clientID:            "client",
+			redirectURI:         "http://localhost:9000/cb",
+			codeChallenge:       challenge,
+			codeChallengeMethod: "S256",
+			remoteUser: &apitype.WhoIsResponse{
+				Node:        &tailcfg.Node{ID: 1, StableID: "n1", Name: "laptop.example.ts.net.", User: 2},
+				UserProfile: &tailcfg.UserProfile{LoginName: "alice@example.com"},
+			},
+		}}
+		return code
+	}
+	exchange := func(code, verifier string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {"http://localhost:9000/cb"},
+			"code_verifier": {verifier},
+		}
+		req := httptest.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = "127.0.0.1:12345"
+		rec := httptest.NewRecorder()
+		s.serveToken(rec, req)
+		return rec
+	}
+
+	if rec := exchange(newCode(), "wrong"); rec.Code != http.StatusBadRequest {
+		t.Errorf("exchange with wrong verifier = %v %s; want 400", rec.Code, rec.Body)
+	}
+
+	rec := exchange(newCode(), verifier)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("exchange = %v %s", rec.Code, rec.Body)
+	}
+	var resp oidcTokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.RefreshToken == "" || s.refreshToken[resp.RefreshToken] == nil {
+		t.Fatalf("no refresh token issued: %+v", resp)
+	}
+	if s.refreshToken[resp.RefreshToken].validTill.Sub(s.accessToken[resp.AccessToken].validTill) < refreshTokenLifetime/2 {
+		t.Errorf("refresh token doesn't outlive access token")
+	}
+	tok, err := jwt.ParseSigned(resp.IDToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims tailscaleClaims
+	if err := tok.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "userid:2" || claims.Email != "alice@example.com" || claims.Issuer != s.loopbackURL {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"bogus"}}
+	req := httptest.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	s.serveToken(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("refresh with bogus token = %v; want 400", rec.Code)
+	}
+}
@@ -9,6 +9,8 @@
 	"encoding/json"
 	"errors"
 	"net/netip"
+	"reflect"
+	"slices"
 
 	"golang.org/x/exp/constraints"
 	"tailscale.com/types/views"
@@ -88,6 +90,79 @@ func (v StructWithPtrsView) Equal(v2 StructWithPtrsView) bool { return v.ж.Equa
 	NoCloneValue *StructWithoutPtrs
 }{})
 
+// StructWithPtrsPatch is a set of changes to the exported fields of a StructWithPtrs, as
+// returned by [StructWithPtrsView.Diff] and applied by [StructWithPtrsView.ApplyPatch].
+//
+// Each non-nil field points to the new value of the StructWithPtrs field of the
+// same name. Fields that are nil are unchanged.
+type StructWithPtrsPatch struct {
+	Value        **StructWithoutPtrs `json:",omitempty"`
+	Int          **int               `json:",omitempty"`
+	NoCloneValue **StructWithoutPtrs `json:",omitempty"`
+}
+
+// Diff returns the changes to the exported fields of StructWithPtrs from v to v2,
+// or nil if there are none. An invalid view is treated as the zero StructWithPtrs.
+// The returned patch does not alias the memory of v2.
+func (v StructWithPtrsView) Diff(v2 StructWithPtrsView) *StructWithPtrsPatch {
+	a, b := v.ж, v2.ж
+	if a == nil {
+		a = new(StructWithPtrs)
+	}
+	if b == nil {
+		b = new(StructWithPtrs)
+	}
+	// Find the changed fields first, and only copy v2 if there are any.
+	var changed StructWithPtrsPatch
+	if (a.Value == nil) != (b.Value == nil) || a.Value != nil && *a.Value != *b.Value {
+		changed.Value = &b.Value
+	}
+	if (a.Int == nil) != (b.Int == nil) || a.Int != nil && *a.Int != *b.Int {
+		changed.Int = &b.Int
+	}
+	if (a.NoCloneValue == nil) != (b.NoCloneValue == nil) || a.NoCloneValue != nil && *a.NoCloneValue != *b.NoCloneValue {
+		changed.NoCloneValue = &b.NoCloneValue
+	}
+	if changed == (StructWithPtrsPatch{}) {
+		return nil
+	}
+	c := b.Clone()
+	p := new(StructWithPtrsPatch)
+	if changed.Value != nil {
+		p.Value = &c.Value
+	}
+	if changed.Int != nil {
+		p.Int = &c.Int
+	}
+	if changed.NoCloneValue != nil {
+		p.NoCloneValue = &c.NoCloneValue
+	}
+	return p
+}
+
+// ApplyPatch returns a view of a copy of v with the changes in p applied.
+// An invalid view is treated as the zero StructWithPtrs. The result may alias
+// the memory of p, which must not be modified afterwards.
+func (v StructWithPtrsView) ApplyPatch(p *StructWithPtrsPatch) StructWithPtrsView {
+	if p == nil {
+		return v
+	}
+	x := v.AsStruct()
+	if x == nil {
+		x = new(StructWithPtrs)
+	}
+	if p.Value != nil {
+		x.Value = *p.Value
+	}
+	if p.Int != nil {
+		x.Int = *p.Int
+	}
+	if p.NoCloneValue != nil {
+		x.NoCloneValue = *p.NoCloneValue
+	}
+	return x.View()
+}
+
 // View returns a readonly view of StructWithoutPtrs.
 func (p *StructWithoutPtrs) View() StructWithoutPtrsView {
 	return StructWithoutPtrsView{ж: p}
@@ -322,6 +397,129 @@ func (v StructWithSlicesView) Ints() *int                    { panic("unsupporte
 	Ints           []*int
 }{})
 
+// StructWithSlicesPatch is a set of changes to the exported fields of a StructWithSlices, as
+// returned by [StructWithSlicesView.Diff] and applied by [StructWithSlicesView.ApplyPatch].
+//
+// Each non-nil field points to the new value of the StructWithSlices field of the
+// same name. Fields that are nil are unchanged.
+type StructWithSlicesPatch struct {
+	Values         *[]StructWithoutPtrs  `json:",omitempty"`
+	ValuePointers  *[]*StructWithoutPtrs `json:",omitempty"`
+	StructPointers *[]*StructWithPtrs    `json:",omitempty"`
+	Slice          *[]string             `json:",omitempty"`
+	Prefixes       *[]netip.Prefix       `json:",omitempty"`
+	Data           *[]byte               `json:",omitempty"`
+	Structs        *[]StructWithPtrs     `json:",omitempty"`
+	Ints           *[]*int               `json:",omitempty"`
+}
+
+// Diff returns the changes to the exported fields of StructWithSlices from v to v2,
+// or nil if there are none. An invalid view is treated as the zero StructWithSlices.
+// The returned patch does not alias the memory of v2.
+func (v StructWithSlicesView) Diff(v2 StructWithSlicesView) *StructWithSlicesPatch {
+	a, b := v.ж, v2.ж
+	if a == nil {
+		a = new(StructWithSlices)
+	}
+	if b == nil {
+		b = new(StructWithSlices)
+	}
+	// Find the changed fields first, and only copy v2 if there are any.
+	var changed StructWithSlicesPatch
+	if !slices.Equal(a.Values, b.Values) {
+		changed.Values = &b.Values
+	}
+	if !reflect.DeepEqual(a.ValuePointers, b.ValuePointers) {
+		changed.ValuePointers = &b.ValuePointers
+	}
+	if !slices.EqualFunc(a.StructPointers, b.StructPointers, (*StructWithPtrs).Equal) {
+		changed.StructPointers = &b.StructPointers
+	}
+	if !slices.Equal(a.Slice, b.Slice) {
+		changed.Slice = &b.Slice
+	}
+	if !slices.Equal(a.Prefixes, b.Prefixes) {
+		changed.Prefixes = &b.Prefixes
+	}
+	if !slices.Equal(a.Data, b.Data) {
+		changed.Data = &b.Data
+	}
+	if !reflect.DeepEqual(a.Structs, b.Structs) {
+		changed.Structs = &b.Structs
+	}
+	if !reflect.DeepEqual(a.Ints, b.Ints) {
+		changed.Ints = &b.Ints
+	}
+	if changed == (StructWithSlicesPatch{}) {
+		return nil
+	}
+	c := b.Clone()
+	p := new(StructWithSlicesPatch)
+	if changed.Values != nil {
+		p.Values = &c.Values
+	}
+	if changed.ValuePointers != nil {
+		p.ValuePointers = &c.ValuePointers
+	}
+	if changed.StructPointers != nil {
+		p.StructPointers = &c.StructPointers
+	}
+	if changed.Slice != nil {
+		p.Slice = &c.Slice
+	}
+	if changed.Prefixes != nil {
+		p.Prefixes = &c.Prefixes
+	}
+	if changed.Data != nil {
+		p.Data = &c.Data
+	}
+	if changed.Structs != nil {
+		p.Structs = &c.Structs
+	}
+	if changed.Ints != nil {
+		p.Ints = &c.Ints
+	}
+	return p
+}
+
+// ApplyPatch returns a view of a copy of v with the changes in p applied.
+// An invalid view is treated as the zero StructWithSlices. The result may alias
+// the memory of p, which must not be modified afterwards.
+func (v StructWithSlicesView) ApplyPatch(p *StructWithSlicesPatch) StructWithSlicesView {
+	if p == nil {
+		return v
+	}
+	x := v.AsStruct()
+	if x == nil {
+		x = new(StructWithSlices)
+	}
+	if p.Values != nil {
+		x.Values = *p.Values
+	}
+	if p.ValuePointers != nil {
+		x.ValuePointers = *p.ValuePointers
+	}
+	if p.StructPointers != nil {
+		x.StructPointers = *p.StructPointers
+	}
+	if p.Slice != nil {
+		x.Slice = *p.Slice
+	}
+	if p.Prefixes != nil {
+		x.Prefixes = *p.Prefixes
+	}
+	if p.Data != nil {
+		x.Data = *p.Data
+	}
+	if p.Structs != nil {
+		x.Structs = *p.Structs
+	}
+	if p.Ints != nil {
+		x.Ints = *p.Ints
+	}
+	return x.View()
+}
+
 // View returns a readonly view of StructWithEmbedded.
 func (p *StructWithEmbedded) View() StructWithEmbeddedView {
 	return StructWithEmbeddedView{ж: p}
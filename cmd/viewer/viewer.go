@@ -107,10 +107,107 @@ func(v {{.ViewName}}{{.TypeParamNames}}) {{.FieldName}}() views.MapSlice[{{.MapK
 {{end}}
 `
 
-var viewTemplate *template.Template
+const diffTemplateStr = `{{define "patchType"}}
+// {{.PatchName}} is a set of changes to the exported fields of a {{.StructName}}, as
+// returned by [{{.ViewName}}.Diff] and applied by [{{.ViewName}}.ApplyPatch].
+//
+// Each non-nil field points to the new value of the {{.StructName}} field of the
+// same name. Fields that are nil are unchanged.
+type {{.PatchName}} struct {
+{{end}}
+{{define "patchField"}}	{{.FieldName}} *{{.FieldType}} ` + "`json:\",omitempty\"`" + `
+{{end}}
+{{define "diffFunc"}}}
+
+// Diff returns the changes to the exported fields of {{.StructName}} from v to v2,
+// or nil if there are none. An invalid view is treated as the zero {{.StructName}}.
+// The returned patch does not alias the memory of v2.
+func (v {{.ViewName}}) Diff(v2 {{.ViewName}}) *{{.PatchName}} {
+	a, b := v.ж, v2.ж
+	if a == nil {
+		a = new({{.StructName}})
+	}
+	if b == nil {
+		b = new({{.StructName}})
+	}
+	// Find the changed fields first, and only copy v2 if there are any.
+	var changed {{.PatchName}}
+{{end}}
+{{define "diffValueField"}}	if a.{{.FieldName}} != b.{{.FieldName}} {
+		changed.{{.FieldName}} = &b.{{.FieldName}}
+	}
+{{end}}
+{{define "diffEqualField"}}	if !a.{{.FieldName}}.Equal(b.{{.FieldName}}) {
+		changed.{{.FieldName}} = &b.{{.FieldName}}
+	}
+{{end}}
+{{define "diffPtrValueField"}}	if (a.{{.FieldName}} == nil) != (b.{{.FieldName}} == nil) || a.{{.FieldName}} != nil && *a.{{.FieldName}} != *b.{{.FieldName}} {
+		changed.{{.FieldName}} = &b.{{.FieldName}}
+	}
+{{end}}
+{{define "diffPtrEqualField"}}	if (a.{{.FieldName}} == nil) != (b.{{.FieldName}} == nil) || a.{{.FieldName}} != nil && !a.{{.FieldName}}.Equal(*b.{{.FieldName}}) {
+		changed.{{.FieldName}} = &b.{{.FieldName}}
+	}
+{{end}}
+{{define "diffSliceField"}}	if !slices.Equal(a.{{.FieldName}}, b.{{.FieldName}}) {
+		changed.{{.FieldName}} = &b.{{.FieldName}}
+	}
+{{end}}
+{{define "diffSliceEqualField"}}	if !slices.EqualFunc(a.{{.FieldName}}, b.{{.FieldName}}, {{.ElemType}}.Equal) {
+		changed.{{.FieldName}} = &b.{{.FieldName}}
+	}
+{{end}}
+{{define "diffMapField"}}	if !maps.Equal(a.{{.FieldName}}, b.{{.FieldName}}) {
+		changed.{{.FieldName}} = &b.{{.FieldName}}
+	}
+{{end}}
+{{define "diffMapSliceField"}}	if !maps.EqualFunc(a.{{.FieldName}}, b.{{.FieldName}}, slices.Equal[{{.ElemType}}]) {
+		changed.{{.FieldName}} = &b.{{.FieldName}}
+	}
+{{end}}
+{{define "diffDeepField"}}	if !reflect.DeepEqual(a.{{.FieldName}}, b.{{.FieldName}}) {
+		changed.{{.FieldName}} = &b.{{.FieldName}}
+	}
+{{end}}
+{{define "diffCopy"}}	if changed == ({{.PatchName}}{}) {
+		return nil
+	}
+	c := b.Clone()
+	p := new({{.PatchName}})
+{{end}}
+{{define "copyField"}}	if changed.{{.FieldName}} != nil {
+		p.{{.FieldName}} = &c.{{.FieldName}}
+	}
+{{end}}
+{{define "applyFunc"}}	return p
+}
+
+// ApplyPatch returns a view of a copy of v with the changes in p applied.
+// An invalid view is treated as the zero {{.StructName}}. The result may alias
+// the memory of p, which must not be modified afterwards.
+func (v {{.ViewName}}) ApplyPatch(p *{{.PatchName}}) {{.ViewName}} {
+	if p == nil {
+		return v
+	}
+	x := v.AsStruct()
+	if x == nil {
+		x = new({{.StructName}})
+	}
+{{end}}
+{{define "applyField"}}	if p.{{.FieldName}} != nil {
+		x.{{.FieldName}} = *p.{{.FieldName}}
+	}
+{{end}}
+{{define "applyEnd"}}	return x.View()
+}
+{{end}}
+`
+
+var viewTemplate, diffTemplate *template.Template
 
 func init() {
 	viewTemplate = template.Must(template.New("view").Parse(viewTemplateStr))
+	diffTemplate = template.Must(template.New("diff").Parse(diffTemplateStr))
 }
 
 func requiresCloning(t types.Type) (shallow, deep bool, base types.Type) {
@@ -397,6 +494,135 @@ func genView(buf *bytes.Buffer, it *codegen.ImportTracker, typ *types.Named, thi
 	buf.Write(codegen.AssertStructUnchanged(t, args.StructName, typeParams, "View", it))
 }
 
+// genDiff generates a {Type}Patch type for typ, along with Diff and ApplyPatch
+// methods on its view type to compute and apply one.
+func genDiff(buf *bytes.Buffer, it *codegen.ImportTracker, typ *types.Named) {
+	t, ok := typ.Underlying().(*types.Struct)
+	if !ok || codegen.IsViewType(t) {
+		return
+	}
+	if typ.Origin().TypeParams().Len() > 0 {
+		log.Fatalf("%s: diffs of generic types are not supported", typ.Obj().Name())
+	}
+	args := struct {
+		StructName string
+		ViewName   string
+		PatchName  string
+		FieldName  string
+		FieldType  string
+		ElemType   string
+	}{
+		StructName: typ.Obj().Name(),
+		ViewName:   typ.Obj().Name() + "View",
+		PatchName:  typ.Obj().Name() + "Patch",
+	}
+	writeTemplate := func(name string) {
+		if err := diffTemplate.ExecuteTemplate(buf, name, args); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var fields []*types.Var
+	for i := range t.NumFields() {
+		f := t.Field(i)
+		if f.Exported() && !codegen.IsInvalid(f.Type()) {
+			fields = append(fields, f)
+		}
+	}
+
+	writeTemplate("patchType")
+	for _, f := range fields {
+		args.FieldName = f.Name()
+		args.FieldType = it.QualifiedName(f.Type())
+		writeTemplate("patchField")
+	}
+	writeTemplate("diffFunc")
+	for _, f := range fields {
+		args.FieldName = f.Name()
+		writeTemplate(diffFieldTemplate(it, f.Type(), &args.ElemType))
+	}
+	writeTemplate("diffCopy")
+	for _, f := range fields {
+		args.FieldName = f.Name()
+		writeTemplate("copyField")
+	}
+	writeTemplate("applyFunc")
+	for _, f := range fields {
+		args.FieldName = f.Name()
+		writeTemplate("applyField")
+	}
+	writeTemplate("applyEnd")
+}
+
+// diffFieldTemplate returns the name of the template that compares two
+// values of a field of type typ, setting elemType if the template needs it.
+func diffFieldTemplate(it *codegen.ImportTracker, typ types.Type, elemType *string) string {
+	isValue := func(t types.Type) bool {
+		return types.Comparable(t) && !codegen.ContainsPointers(t)
+	}
+	switch {
+	case hasEqualMethod(typ):
+		return "diffEqualField"
+	case isValue(typ):
+		return "diffValueField"
+	}
+	switch u := typ.Underlying().(type) {
+	case *types.Pointer:
+		if hasEqualMethod(u.Elem()) {
+			return "diffPtrEqualField"
+		}
+		if isValue(u.Elem()) {
+			return "diffPtrValueField"
+		}
+	case *types.Slice:
+		if hasEqualMethod(u.Elem()) {
+			it.Import("slices")
+			*elemType = it.QualifiedName(u.Elem())
+			if _, ok := u.Elem().(*types.Pointer); ok {
+				*elemType = "(" + *elemType + ")"
+			}
+			return "diffSliceEqualField"
+		}
+		if isValue(u.Elem()) {
+			it.Import("slices")
+			return "diffSliceField"
+		}
+	case *types.Map:
+		if isValue(u.Elem()) {
+			it.Import("maps")
+			return "diffMapField"
+		}
+		if s, ok := u.Elem().Underlying().(*types.Slice); ok && isValue(s.Elem()) {
+			it.Import("maps")
+			it.Import("slices")
+			*elemType = it.QualifiedName(u.Elem())
+			return "diffMapSliceField"
+		}
+	}
+	it.Import("reflect")
+	return "diffDeepField"
+}
+
+// hasEqualMethod reports whether values of typ have an Equal(typ) bool method
+// that can be used to compare them.
+func hasEqualMethod(typ types.Type) bool {
+	m := codegen.LookupMethod(typ, "Equal")
+	if m == nil {
+		return false
+	}
+	sig, ok := m.Type().(*types.Signature)
+	if !ok || sig.Params().Len() != 1 || sig.Results().Len() != 1 {
+		return false
+	}
+	if _, isPtr := typ.(*types.Pointer); !isPtr {
+		if _, isPtrRecv := sig.Recv().Type().(*types.Pointer); isPtrRecv {
+			// Not in the method set of typ.
+			return false
+		}
+	}
+	return types.Identical(sig.Params().At(0).Type(), typ) &&
+		types.Identical(sig.Results().At(0).Type(), types.Typ[types.Bool])
+}
+
 func appendNameSuffix(name, suffix string) string {
 	if idx := strings.IndexRune(name, '['); idx != -1 {
 		// Insert suffix after the type name, but before type parameters.
@@ -528,6 +754,7 @@ func collectTypeParams(list *types.TypeParamList) []*types.TypeParam {
 	flagCloneFunc = flag.Bool("clonefunc", false, "add a top-level Clone func")
 
 	flagCloneOnlyTypes = flag.String("clone-only-type", "", "comma-separated list of types (a subset of --type) that should only generate a go:generate clone line and not actual views")
+	flagDiffTypes      = flag.String("diff-type", "", "comma-separated list of types (a subset of --type) that should also generate a patch type and Diff and ApplyPatch view methods")
 
 	typeNames []string
 )
@@ -561,6 +788,11 @@ func main() {
 		cloneOnlyType[t] = true
 	}
 
+	diffType := map[string]bool{}
+	for _, t := range strings.Split(*flagDiffTypes, ",") {
+		diffType[t] = true
+	}
+
 	buf := new(bytes.Buffer)
 	fmt.Fprintf(buf, "//go:generate go run tailscale.com/cmd/cloner  %s\n\n", strings.Join(flagArgs, " "))
 	runCloner := false
@@ -583,6 +815,9 @@ func main() {
 			runCloner = true
 		}
 		genView(buf, it, typ, pkg.Types)
+		if diffType[typeName] {
+			genDiff(buf, it, typ)
+		}
 	}
 	out := pkg.Name + "_view"
 	if *flagBuildTags == "test" {
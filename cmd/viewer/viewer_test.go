@@ -76,3 +76,69 @@ func TestViewerImports(t *testing.T) {
 		})
 	}
 }
+
+func TestDiffFieldTemplate(t *testing.T) {
+	const content = `package test
+
+type Eq struct{ X int }
+
+func (e Eq) Equal(e2 Eq) bool { return e == e2 }
+
+type PtrEq struct{ X *int }
+
+func (e *PtrEq) Equal(e2 *PtrEq) bool { return e == e2 }
+
+type Test struct {
+	Int      int
+	Eq       Eq
+	PtrEq    *PtrEq
+	PtrEqVal PtrEq
+	IntPtr   *int
+	EqPtr    *Eq
+	Slice    []string
+	EqSlice  []*PtrEq
+	Map      map[string]int
+	MapSlice map[string][]int
+	Any      any
+}
+`
+	want := map[string]struct{ template, elemType string }{
+		"Int":      {"diffValueField", ""},
+		"Eq":       {"diffEqualField", ""},
+		"PtrEq":    {"diffEqualField", ""},
+		"PtrEqVal": {"diffDeepField", ""}, // Equal is not in the method set of PtrEq
+		"IntPtr":   {"diffPtrValueField", ""},
+		"EqPtr":    {"diffPtrEqualField", ""},
+		"Slice":    {"diffSliceField", ""},
+		"EqSlice":  {"diffSliceEqualField", "(*PtrEq)"},
+		"Map":      {"diffMapField", ""},
+		"MapSlice": {"diffMapSliceField", "[]int"},
+		"Any":      {"diffDeepField", ""},
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "test.go", content, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := new(types.Config).Check("test", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := codegen.NewImportTracker(pkg)
+	st := pkg.Scope().Lookup("Test").Type().Underlying().(*types.Struct)
+	for i := range st.NumFields() {
+		field := st.Field(i)
+		var elemType string
+		got := diffFieldTemplate(it, field.Type(), &elemType)
+		if w := want[field.Name()]; got != w.template || elemType != w.elemType {
+			t.Errorf("%s: got (%q, %q), want (%q, %q)", field.Name(), got, elemType, w.template, w.elemType)
+		}
+	}
+
+	var buf bytes.Buffer
+	genDiff(&buf, it, pkg.Scope().Lookup("Test").Type().(*types.Named))
+	if _, err := parser.ParseFile(fset, "test_view.go", "package test\n"+buf.String(), 0); err != nil {
+		t.Errorf("generated code does not parse: %v\n%s", err, buf.Bytes())
+	}
+}
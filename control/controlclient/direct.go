@@ -103,6 +103,13 @@ type Direct struct {
 	endpoints    []tailcfg.Endpoint
 	tkaHead      string
 	lastPingURL  string // last PingRequest.URL received, for dup suppression
+
+	// resumable, if non-nil, is the map session of the last streaming map
+	// poll, kept after the poll ended so the next poll can ask control to
+	// resume the session rather than send the whole netmap again. It's
+	// only used until resumableUntil.
+	resumable      *mapSession
+	resumableUntil time.Time
 }
 
 // Observer is implemented by users of the control client (such as LocalBackend)
@@ -487,6 +494,7 @@ func (c *Direct) hostInfoLocked() *tailcfg.Hostinfo {
 		return "macOS Screen Time seems to be blocking Tailscale. Try disabling Screen Time in System Settings > Screen Time > Content & Privacy > Access to Web Content."
 	},
 	ImpactsConnectivity: true,
+	Component:           health.ComponentNetwork,
 })
 
 func (c *Direct) doLogin(ctx context.Context, opt loginOpt) (mustRegen bool, newURL string, nks tkatype.MarshaledSignature, err error) {
@@ -811,6 +819,33 @@ func (c *Direct) SendUpdate(ctx context.Context) error {
 	return c.sendMapRequest(ctx, false, nil)
 }
 
+// mapSessionResumeWindow is how long after a streaming map poll ends that the
+// next one asks control to resume its map session, sending only what changed
+// since, rather than start a new one.
+const mapSessionResumeWindow = 2 * time.Minute
+
+// setResumableMapSession sets the map session for the next streaming map poll
+// to resume to ms, a session whose poll just ended, or clears it if ms is nil.
+func (c *Direct) setResumableMapSession(ms *mapSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resumable = ms
+	c.resumableUntil = c.clock.Now().Add(mapSessionResumeWindow)
+}
+
+// resumableMapSession returns the map session for the next streaming map poll
+// of node key k to resume, or nil if there's none: if none was set, it's too
+// old, or it was for another node key.
+func (c *Direct) resumableMapSession(k key.NodePublic) *mapSession {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ms := c.resumable
+	if ms == nil || ms.publicNodeKey != k || c.clock.Now().After(c.resumableUntil) {
+		return nil
+	}
+	return ms
+}
+
 // If we go more than watchdogTimeout without hearing from the server,
 // end the long poll. We should be receiving a keep alive ping
 // every minute.
@@ -915,6 +950,16 @@ func (c *Direct) sendMapRequest(ctx context.Context, isStreaming bool, nu Netmap
 	}
 	request.Compress = "zstd"
 
+	// resume is the map session of the previous poll to ask control to
+	// resume, if any, so it only sends what changed since.
+	var resume *mapSession
+	if isStreaming {
+		if resume = c.resumableMapSession(nodeKey); resume != nil {
+			request.MapSessionHandle = resume.handle
+			request.MapSessionSeq = resume.seq
+		}
+	}
+
 	bodyData, err := encode(request)
 	if err != nil {
 		vlogf("netmap: encode: %v", err)
@@ -994,6 +1039,15 @@ func (c *Direct) sendMapRequest(ctx context.Context, isStreaming bool, nu Netmap
 	sess.altClock = c.clock
 	sess.machinePubKey = machinePubKey
 	sess.onDebug = c.handleDebugMessage
+	if isStreaming {
+		defer func() {
+			// Let the next poll resume the session if control named it
+			// and sent at least the full netmap to resume from.
+			if sess.handle != "" && sess.lastNode.Valid() {
+				c.setResumableMapSession(sess)
+			}
+		}()
+	}
 	sess.onSelfNodeChanged = func(nm *netmap.NetworkMap) {
 		c.mu.Lock()
 		defer c.mu.Unlock()
@@ -1015,6 +1069,9 @@ func (c *Direct) sendMapRequest(ctx context.Context, isStreaming bool, nu Netmap
 	// KeepAlive set.
 	var gotNonKeepAliveMessage bool
 
+	// resumed is whether control resumed the map session of resume.
+	var resumed bool
+
 	// If allowStream, then the server will use an HTTP long poll to
 	// return incremental results. There is always one response right
 	// away, followed by a delay, and eventually others.
@@ -1047,6 +1104,22 @@ func (c *Direct) sendMapRequest(ctx context.Context, isStreaming bool, nu Netmap
 		watchdogTimer.Stop()
 
 		metricMapResponseMessages.Add(1)
+		metricMapResponseBytes.Add(int64(size))
+
+		if mapResIdx == 0 && isStreaming {
+			// The previous session is superseded, whether it's resumed
+			// here or not.
+			c.setResumableMapSession(nil)
+			if resume != nil && resp.MapSessionHandle == resume.handle {
+				resumed = true
+				metricMapSessionsResumed.Add(1)
+				c.logf("netmap: resumed map session after seq %v", resume.seq)
+				sess.resumeFrom(resume)
+				sess.netmapUpdater.UpdateFullNetmap(sess.netmap())
+			} else {
+				sess.handle = resp.MapSessionHandle
+			}
+		}
 
 		if isStreaming {
 			c.health.GotStreamedMapResponse()
@@ -1089,6 +1162,7 @@ func (c *Direct) sendMapRequest(ctx context.Context, isStreaming bool, nu Netmap
 		}
 		if resp.KeepAlive {
 			metricMapResponseKeepAlives.Add(1)
+			sess.noteSeq(resp.Seq)
 			continue
 		}
 		if au, ok := resp.DefaultAutoUpdate.Get(); ok {
@@ -1101,16 +1175,20 @@ func (c *Direct) sendMapRequest(ctx context.Context, isStreaming bool, nu Netmap
 		if gotNonKeepAliveMessage {
 			// If we've already seen a non-keep-alive message, this is a delta update.
 			metricMapResponseMapDelta.Add(1)
-		} else if resp.Node == nil {
-			// The very first non-keep-alive message should have Node populated.
+		} else if resp.Node == nil && !resumed {
+			// The very first non-keep-alive message should have Node populated,
+			// unless it continues a resumed session.
 			c.logf("initial MapResponse lacked Node")
 			return errors.New("initial MapResponse lacked node")
 		}
 		gotNonKeepAliveMessage = true
 
 		if err := sess.HandleNonKeepAliveMapResponse(ctx, &resp); err != nil {
+			// The session's state may be partly updated; don't resume it.
+			sess.handle = ""
 			return err
 		}
+		sess.noteSeq(resp.Seq)
 	}
 	if ctx.Err() != nil {
 		return ctx.Err()
@@ -1693,6 +1771,8 @@ func isTCPLoopback(a net.Addr) bool {
 	metricMapResponseKeepAlives = clientmetric.NewCounter("controlclient_map_response_keepalive")
 	metricMapResponseMap        = clientmetric.NewCounter("controlclient_map_response_map")       // any non-keepalive map response
 	metricMapResponseMapDelta   = clientmetric.NewCounter("controlclient_map_response_map_delta") // 2nd+ non-keepalive map response
+	metricMapResponseBytes      = clientmetric.NewCounter("controlclient_map_response_bytes")     // compressed size of all messages
+	metricMapSessionsResumed    = clientmetric.NewCounter("controlclient_map_sessions_resumed")
 
 	metricSetDNS      = clientmetric.NewCounter("controlclient_setdns")
 	metricSetDNSError = clientmetric.NewCounter("controlclient_setdns_error")
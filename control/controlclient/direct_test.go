@@ -16,6 +16,7 @@
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/tsdial"
 	"tailscale.com/tailcfg"
+	"tailscale.com/tstest"
 	"tailscale.com/types/key"
 )
 
@@ -95,6 +96,45 @@ func fakeEndpoints(ports ...uint16) (ret []tailcfg.Endpoint) {
 	return
 }
 
+func TestResumableMapSession(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	c, err := NewDirect(Options{
+		ServerURL: "https://example.com",
+		Clock:     clock,
+		GetMachinePrivateKey: func() (key.MachinePrivate, error) {
+			return key.NewMachine(), nil
+		},
+		Dialer: tsdial.NewDialer(netmon.NewStatic()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := newMapSession(key.NewNode(), nil, nil)
+	defer ms.Close()
+	k := ms.publicNodeKey
+
+	if got := c.resumableMapSession(k); got != nil {
+		t.Fatal("got a session to resume before one was set")
+	}
+	c.setResumableMapSession(ms)
+	if got := c.resumableMapSession(k); got != ms {
+		t.Errorf("resumableMapSession = %p; want %p", got, ms)
+	}
+	if got := c.resumableMapSession(key.NewNode().Public()); got != nil {
+		t.Error("got a session to resume for another node key")
+	}
+	clock.Advance(mapSessionResumeWindow + time.Second)
+	if got := c.resumableMapSession(k); got != nil {
+		t.Error("got a session to resume after the resume window")
+	}
+
+	c.setResumableMapSession(ms)
+	c.setResumableMapSession(nil)
+	if got := c.resumableMapSession(k); got != nil {
+		t.Error("got a session to resume after it was cleared")
+	}
+}
+
 func TestTsmpPing(t *testing.T) {
 	hi := hostinfo.New()
 	ni := tailcfg.NetInfo{LinkType: "wired"}
@@ -10,13 +10,11 @@
 	"fmt"
 	"maps"
 	"net"
-	"reflect"
 	"runtime"
 	"runtime/debug"
 	"slices"
 	"sort"
 	"strconv"
-	"sync"
 	"time"
 
 	"tailscale.com/control/controlknobs"
@@ -29,6 +27,7 @@
 	"tailscale.com/types/ptr"
 	"tailscale.com/types/views"
 	"tailscale.com/util/clientmetric"
+	"tailscale.com/util/deephash"
 	"tailscale.com/util/mak"
 	"tailscale.com/util/set"
 	"tailscale.com/wgengine/filter"
@@ -71,12 +70,25 @@ type mapSession struct {
 	// changed.
 	onSelfNodeChanged func(*netmap.NetworkMap)
 
-	// Fields storing state over the course of multiple MapResponses.
+	mapSessionState
+}
+
+// mapSessionState is the state of a mapSession accumulated over the course of
+// multiple MapResponses. It's kept separately so that a later mapSession can
+// resume the server's session where an interrupted one left off.
+type mapSessionState struct {
+	// handle and seq are the MapResponse.MapSessionHandle of the session
+	// and the MapResponse.Seq of the last message processed, to resume the
+	// session with. handle is empty if the server didn't send one.
+	handle string
+	seq    int64
+
 	lastPrintMap           time.Time
 	lastNode               tailcfg.NodeView
 	lastCapSet             set.Set[tailcfg.NodeCapability]
-	peers                  map[tailcfg.NodeID]*tailcfg.NodeView // pointer to view (oddly). same pointers as sortedPeers.
-	sortedPeers            []*tailcfg.NodeView                  // same pointers as peers, but sorted by Node.ID
+	peers                  map[tailcfg.NodeID]*tailcfg.NodeView                    // pointer to view (oddly). same pointers as sortedPeers.
+	sortedPeers            []*tailcfg.NodeView                                     // same pointers as peers, but sorted by Node.ID
+	peersSum               *deephash.Incremental[tailcfg.NodeID, tailcfg.NodeView] // of peers
 	lastDNSConfig          *tailcfg.DNSConfig
 	lastDERPMap            *tailcfg.DERPMap
 	lastUserProfile        map[tailcfg.UserID]tailcfg.UserProfile
@@ -92,6 +104,11 @@ type mapSession struct {
 	lastTKAInfo            *tailcfg.TKAInfo
 	lastNetmapSummary      string // from NetworkMap.VeryConcise
 	lastMaxExpiry          time.Duration
+
+	// lastNetmapSum is the netmapSum of the last full netmap passed to
+	// the NetmapUpdater, or zero if it has since been updated
+	// incrementally.
+	lastNetmapSum deephash.Sum
 }
 
 // newMapSession returns a mostly unconfigured new mapSession.
@@ -101,12 +118,15 @@ type mapSession struct {
 // It must have its Close method called to release resources.
 func newMapSession(privateNodeKey key.NodePrivate, nu NetmapUpdater, controlKnobs *controlknobs.Knobs) *mapSession {
 	ms := &mapSession{
-		netmapUpdater:   nu,
-		controlKnobs:    controlKnobs,
-		privateNodeKey:  privateNodeKey,
-		publicNodeKey:   privateNodeKey.Public(),
-		lastDNSConfig:   new(tailcfg.DNSConfig),
-		lastUserProfile: map[tailcfg.UserID]tailcfg.UserProfile{},
+		netmapUpdater:  nu,
+		controlKnobs:   controlKnobs,
+		privateNodeKey: privateNodeKey,
+		publicNodeKey:  privateNodeKey.Public(),
+		mapSessionState: mapSessionState{
+			lastDNSConfig:   new(tailcfg.DNSConfig),
+			lastUserProfile: map[tailcfg.UserID]tailcfg.UserProfile{},
+			peersSum:        deephash.NewIncremental[tailcfg.NodeID, tailcfg.NodeView](),
+		},
 
 		// Non-nil no-op defaults, to be optionally overridden by the caller.
 		logf:              logger.Discard,
@@ -141,6 +161,22 @@ func (ms *mapSession) Close() {
 	ms.sessionAliveCtxClose()
 }
 
+// resumeFrom makes ms continue where prev, an earlier session of the same node
+// key, left off, for when control resumed prev's session (see
+// tailcfg.MapRequest.MapSessionHandle).
+func (ms *mapSession) resumeFrom(prev *mapSession) {
+	ms.mapSessionState = prev.mapSessionState
+}
+
+// noteSeq records that the MapResponse with sequence number seq has been
+// processed. A zero seq, as sent with messages that don't change the state
+// of the session, is ignored.
+func (ms *mapSession) noteSeq(seq int64) {
+	if seq != 0 {
+		ms.seq = seq
+	}
+}
+
 // HandleNonKeepAliveMapResponse handles a non-KeepAlive MapResponse (full or
 // incremental).
 //
@@ -190,9 +226,21 @@ func (ms *mapSession) HandleNonKeepAliveMapResponse(ctx context.Context, resp *t
 	ms.updateStateFromResponse(resp)
 
 	if ms.tryHandleIncrementally(resp) {
+		ms.lastNetmapSum = deephash.Sum{}
+		ms.occasionallyPrintSummary(ms.lastNetmapSummary)
+		return nil
+	}
+
+	// Control often resends parts of the state, such as the self node or
+	// DNS config, unchanged. Don't rebuild the netmap if nothing in it
+	// changed.
+	sum := ms.netmapSum()
+	if sum == ms.lastNetmapSum {
+		netmapUnchanged.Add(1)
 		ms.occasionallyPrintSummary(ms.lastNetmapSummary)
 		return nil
 	}
+	ms.lastNetmapSum = sum
 
 	// We have to rebuild the whole netmap (lots of garbage & work downstream of
 	// our UpdateFullNetmap call). This is the part we tried to avoid but
@@ -217,6 +265,31 @@ func (ms *mapSession) HandleNonKeepAliveMapResponse(ctx context.Context, resp *t
 	return nil
 }
 
+// netmapSum returns the hash of the state that ms.netmap builds a netmap from.
+// The peers are hashed incrementally, as they change, so the cost doesn't grow
+// with the size of the tailnet.
+func (ms *mapSession) netmapSum() deephash.Sum {
+	var d deephash.Digest
+	peersSum := ms.peersSum.Sum()
+	deephash.Add(&d, &peersSum)
+	deephash.Add(&d, &ms.lastNode)
+	deephash.Add(&d, &ms.lastCapSet)
+	deephash.Add(&d, &ms.lastUserProfile)
+	deephash.Add(&d, ms.lastDNSConfig)
+	deephash.Add(&d, ms.lastDERPMap)
+	deephash.Add(&d, &ms.lastPacketFilterRules) // lastParsedPacketFilter is derived from it
+	deephash.Add(&d, ms.lastSSHPolicy)
+	deephash.Add(&d, &ms.collectServices)
+	deephash.Add(&d, &ms.lastDomain)
+	deephash.Add(&d, &ms.lastDomainAuditLogID)
+	deephash.Add(&d, &ms.lastHealth)
+	deephash.Add(&d, ms.lastTKAInfo)
+	deephash.Add(&d, &ms.lastMaxExpiry)
+	forceProxyDNS := DevKnob.ForceProxyDNS()
+	deephash.Add(&d, &forceProxyDNS)
+	return d.Sum()
+}
+
 func (ms *mapSession) tryHandleIncrementally(res *tailcfg.MapResponse) bool {
 	if ms.controlKnobs != nil && ms.controlKnobs.DisableDeltaUpdates.Load() {
 		return false
@@ -364,6 +437,8 @@ func (ms *mapSession) updateStateFromResponse(resp *tailcfg.MapResponse) {
 
 	patchifiedPeer      = clientmetric.NewCounter("controlclient_patchified_peer")
 	patchifiedPeerEqual = clientmetric.NewCounter("controlclient_patchified_peer_equal")
+
+	netmapUnchanged = clientmetric.NewCounter("controlclient_netmap_unchanged")
 )
 
 // updatePeersStateFromResponseres updates ms.peers and ms.sortedPeers from res. It takes ownership of res.
@@ -391,11 +466,13 @@ func (ms *mapSession) updatePeersStateFromResponse(resp *tailcfg.MapResponse) (s
 				stats.added++
 				ms.peers[n.ID] = ptr.To(n.View())
 			}
+			ms.peersSum.Set(n.ID, ms.peers[n.ID])
 		}
 		for id := range ms.peers {
 			if !keep[id] {
 				stats.removed++
 				delete(ms.peers, id)
+				ms.peersSum.Delete(id)
 			}
 		}
 		// Peers precludes all other delta operations so just return.
@@ -405,6 +482,7 @@ func (ms *mapSession) updatePeersStateFromResponse(resp *tailcfg.MapResponse) (s
 	for _, id := range resp.PeersRemoved {
 		if _, ok := ms.peers[id]; ok {
 			delete(ms.peers, id)
+			ms.peersSum.Delete(id)
 			stats.removed++
 		}
 	}
@@ -417,6 +495,7 @@ func (ms *mapSession) updatePeersStateFromResponse(resp *tailcfg.MapResponse) (s
 			stats.added++
 			ms.peers[n.ID] = ptr.To(n.View())
 		}
+		ms.peersSum.Set(n.ID, ms.peers[n.ID])
 	}
 
 	for nodeID, seen := range resp.PeerSeenChange {
@@ -428,6 +507,7 @@ func (ms *mapSession) updatePeersStateFromResponse(resp *tailcfg.MapResponse) (s
 				mut.LastSeen = nil
 			}
 			*vp = mut.View()
+			ms.peersSum.Set(nodeID, vp)
 			stats.changed++
 		}
 	}
@@ -437,6 +517,7 @@ func (ms *mapSession) updatePeersStateFromResponse(resp *tailcfg.MapResponse) (s
 			mut := vp.AsStruct()
 			mut.Online = ptr.To(online)
 			*vp = mut.View()
+			ms.peersSum.Set(nodeID, vp)
 			stats.changed++
 		}
 	}
@@ -447,48 +528,8 @@ func (ms *mapSession) updatePeersStateFromResponse(resp *tailcfg.MapResponse) (s
 			continue
 		}
 		stats.changed++
-		mut := vp.AsStruct()
-		if pc.DERPRegion != 0 {
-			mut.DERP = fmt.Sprintf("%s:%v", tailcfg.DerpMagicIP, pc.DERPRegion)
-			patchDERPRegion.Add(1)
-		}
-		if pc.Cap != 0 {
-			mut.Cap = pc.Cap
-			patchCap.Add(1)
-		}
-		if pc.Endpoints != nil {
-			mut.Endpoints = pc.Endpoints
-			patchEndpoints.Add(1)
-		}
-		if pc.Key != nil {
-			mut.Key = *pc.Key
-			patchKey.Add(1)
-		}
-		if pc.DiscoKey != nil {
-			mut.DiscoKey = *pc.DiscoKey
-			patchDiscoKey.Add(1)
-		}
-		if v := pc.Online; v != nil {
-			mut.Online = ptr.To(*v)
-			patchOnline.Add(1)
-		}
-		if v := pc.LastSeen; v != nil {
-			mut.LastSeen = ptr.To(*v)
-			patchLastSeen.Add(1)
-		}
-		if v := pc.KeyExpiry; v != nil {
-			mut.KeyExpiry = *v
-			patchKeyExpiry.Add(1)
-		}
-		if v := pc.KeySignature; v != nil {
-			mut.KeySignature = v
-			patchKeySignature.Add(1)
-		}
-		if v := pc.CapMap; v != nil {
-			mut.CapMap = v
-			patchCapMap.Add(1)
-		}
-		*vp = mut.View()
+		*vp = vp.ApplyPatch(nodePatchOfPeerChange(pc))
+		ms.peersSum.Set(pc.NodeID, vp)
 	}
 
 	return
@@ -554,18 +595,6 @@ func (ms *mapSession) patchifyPeersChanged(resp *tailcfg.MapResponse) {
 	}
 }
 
-var nodeFields = sync.OnceValue(getNodeFields)
-
-// getNodeFields returns the fails of tailcfg.Node.
-func getNodeFields() []string {
-	rt := reflect.TypeFor[tailcfg.Node]()
-	ret := make([]string, rt.NumField())
-	for i := range rt.NumField() {
-		ret[i] = rt.Field(i).Name
-	}
-	return ret
-}
-
 // patchifyPeer returns a *tailcfg.PeerChange of the session's existing copy of
 // the n.ID Node to n.
 //
@@ -579,10 +608,71 @@ func (ms *mapSession) patchifyPeer(n *tailcfg.Node) (_ *tailcfg.PeerChange, ok b
 	return peerChangeDiff(*was, n)
 }
 
+// nodePatchOfPeerChange returns the changes in pc as a patch to its node.
+func nodePatchOfPeerChange(pc *tailcfg.PeerChange) *tailcfg.NodePatch {
+	p := new(tailcfg.NodePatch)
+	if pc.DERPRegion != 0 {
+		p.DERP = ptr.To(fmt.Sprintf("%s:%v", tailcfg.DerpMagicIP, pc.DERPRegion))
+		patchDERPRegion.Add(1)
+	}
+	if pc.Cap != 0 {
+		p.Cap = &pc.Cap
+		patchCap.Add(1)
+	}
+	if pc.Endpoints != nil {
+		p.Endpoints = &pc.Endpoints
+		patchEndpoints.Add(1)
+	}
+	if pc.Key != nil {
+		p.Key = pc.Key
+		patchKey.Add(1)
+	}
+	if pc.DiscoKey != nil {
+		p.DiscoKey = pc.DiscoKey
+		patchDiscoKey.Add(1)
+	}
+	if v := pc.Online; v != nil {
+		p.Online = ptr.To(ptr.To(*v))
+		patchOnline.Add(1)
+	}
+	if v := pc.LastSeen; v != nil {
+		p.LastSeen = ptr.To(ptr.To(*v))
+		patchLastSeen.Add(1)
+	}
+	if v := pc.KeyExpiry; v != nil {
+		p.KeyExpiry = v
+		patchKeyExpiry.Add(1)
+	}
+	if pc.KeySignature != nil {
+		p.KeySignature = &pc.KeySignature
+		patchKeySignature.Add(1)
+	}
+	if pc.CapMap != nil {
+		p.CapMap = &pc.CapMap
+		patchCapMap.Add(1)
+	}
+	return p
+}
+
 // peerChangeDiff returns the difference from 'was' to 'n', if possible.
 //
 // It returns (nil, true) if the fields were identical.
 func peerChangeDiff(was tailcfg.NodeView, n *tailcfg.Node) (_ *tailcfg.PeerChange, ok bool) {
+	d := was.Diff(n.View())
+	if d == nil {
+		return nil, true
+	}
+
+	// The caller is responsible for populating the computed names, and
+	// DataPlaneAuditLogID is not sent for peers. Capabilities is
+	// deprecated (see https://github.com/tailscale/tailscale/issues/11508)
+	// and was never sent by any known control server.
+	d.ComputedName, d.ComputedNameWithHost = nil, nil
+	d.DataPlaneAuditLogID, d.Capabilities = nil, nil
+
+	// Move the changes that a PeerChange can express from d to ret. Any
+	// changes that remain in d, including to fields added later, require
+	// the whole node to be sent.
 	var ret *tailcfg.PeerChange
 	pc := func() *tailcfg.PeerChange {
 		if ret == nil {
@@ -590,187 +680,60 @@ func peerChangeDiff(was tailcfg.NodeView, n *tailcfg.Node) (_ *tailcfg.PeerChang
 		}
 		return ret
 	}
-	for _, field := range nodeFields() {
-		switch field {
-		default:
-			// The whole point of using reflect in this function is to panic
-			// here in tests if we forget to handle a new field.
-			panic("unhandled field: " + field)
-		case "computedHostIfDifferent", "ComputedName", "ComputedNameWithHost":
-			// Caller's responsibility to have populated these.
-			continue
-		case "DataPlaneAuditLogID":
-			//  Not sent for peers.
-		case "Capabilities":
-			// Deprecated; see https://github.com/tailscale/tailscale/issues/11508
-			// And it was never sent by any known control server.
-		case "ID":
-			if was.ID() != n.ID {
-				return nil, false
-			}
-		case "StableID":
-			if was.StableID() != n.StableID {
-				return nil, false
-			}
-		case "Name":
-			if was.Name() != n.Name {
-				return nil, false
-			}
-		case "User":
-			if was.User() != n.User {
-				return nil, false
-			}
-		case "Sharer":
-			if was.Sharer() != n.Sharer {
-				return nil, false
-			}
-		case "Key":
-			if was.Key() != n.Key {
-				pc().Key = ptr.To(n.Key)
-			}
-		case "KeyExpiry":
-			if !was.KeyExpiry().Equal(n.KeyExpiry) {
-				pc().KeyExpiry = ptr.To(n.KeyExpiry)
-			}
-		case "KeySignature":
-			if !was.KeySignature().Equal(n.KeySignature) {
-				pc().KeySignature = slices.Clone(n.KeySignature)
-			}
-		case "Machine":
-			if was.Machine() != n.Machine {
-				return nil, false
-			}
-		case "DiscoKey":
-			if was.DiscoKey() != n.DiscoKey {
-				pc().DiscoKey = ptr.To(n.DiscoKey)
-			}
-		case "Addresses":
-			if !views.SliceEqual(was.Addresses(), views.SliceOf(n.Addresses)) {
-				return nil, false
-			}
-		case "AllowedIPs":
-			if !views.SliceEqual(was.AllowedIPs(), views.SliceOf(n.AllowedIPs)) {
-				return nil, false
-			}
-		case "Endpoints":
-			if !views.SliceEqual(was.Endpoints(), views.SliceOf(n.Endpoints)) {
-				pc().Endpoints = slices.Clone(n.Endpoints)
-			}
-		case "DERP":
-			if was.DERP() != n.DERP {
-				ip, portStr, err := net.SplitHostPort(n.DERP)
-				if err != nil || ip != "127.3.3.40" {
-					return nil, false
-				}
-				port, err := strconv.Atoi(portStr)
-				if err != nil || port < 1 || port > 65535 {
-					return nil, false
-				}
-				pc().DERPRegion = port
-			}
-		case "Hostinfo":
-			if !was.Hostinfo().Valid() && !n.Hostinfo.Valid() {
-				continue
-			}
-			if !was.Hostinfo().Valid() || !n.Hostinfo.Valid() {
-				return nil, false
-			}
-			if !was.Hostinfo().Equal(n.Hostinfo) {
-				return nil, false
-			}
-		case "Created":
-			if !was.Created().Equal(n.Created) {
-				return nil, false
-			}
-		case "Cap":
-			if was.Cap() != n.Cap {
-				pc().Cap = n.Cap
-			}
-		case "CapMap":
-			if len(n.CapMap) != was.CapMap().Len() {
-				if n.CapMap == nil {
-					pc().CapMap = make(tailcfg.NodeCapMap)
-				} else {
-					pc().CapMap = maps.Clone(n.CapMap)
-				}
-				break
-			}
-			was.CapMap().Range(func(k tailcfg.NodeCapability, v views.Slice[tailcfg.RawMessage]) bool {
-				nv, ok := n.CapMap[k]
-				if !ok || !views.SliceEqual(v, views.SliceOf(nv)) {
-					pc().CapMap = maps.Clone(n.CapMap)
-					return false
-				}
-				return true
-			})
-		case "Tags":
-			if !views.SliceEqual(was.Tags(), views.SliceOf(n.Tags)) {
-				return nil, false
-			}
-		case "PrimaryRoutes":
-			if !views.SliceEqual(was.PrimaryRoutes(), views.SliceOf(n.PrimaryRoutes)) {
-				return nil, false
-			}
-		case "Online":
-			wasOnline := was.Online()
-			if n.Online != nil && wasOnline != nil && *n.Online != *wasOnline {
-				pc().Online = ptr.To(*n.Online)
-			}
-		case "LastSeen":
-			wasSeen := was.LastSeen()
-			if n.LastSeen != nil && wasSeen != nil && !wasSeen.Equal(*n.LastSeen) {
-				pc().LastSeen = ptr.To(*n.LastSeen)
-			}
-		case "MachineAuthorized":
-			if was.MachineAuthorized() != n.MachineAuthorized {
-				return nil, false
-			}
-		case "UnsignedPeerAPIOnly":
-			if was.UnsignedPeerAPIOnly() != n.UnsignedPeerAPIOnly {
-				return nil, false
-			}
-		case "IsWireGuardOnly":
-			if was.IsWireGuardOnly() != n.IsWireGuardOnly {
-				return nil, false
-			}
-		case "IsJailed":
-			if was.IsJailed() != n.IsJailed {
-				return nil, false
-			}
-		case "Expired":
-			if was.Expired() != n.Expired {
-				return nil, false
-			}
-		case "SelfNodeV4MasqAddrForThisPeer":
-			va, vb := was.SelfNodeV4MasqAddrForThisPeer(), n.SelfNodeV4MasqAddrForThisPeer
-			if va == nil && vb == nil {
-				continue
-			}
-			if va == nil || vb == nil || *va != *vb {
-				return nil, false
-			}
-		case "SelfNodeV6MasqAddrForThisPeer":
-			va, vb := was.SelfNodeV6MasqAddrForThisPeer(), n.SelfNodeV6MasqAddrForThisPeer
-			if va == nil && vb == nil {
-				continue
-			}
-			if va == nil || vb == nil || *va != *vb {
-				return nil, false
-			}
-		case "ExitNodeDNSResolvers":
-			va, vb := was.ExitNodeDNSResolvers(), views.SliceOfViews(n.ExitNodeDNSResolvers)
-
-			if va.Len() != vb.Len() {
-				return nil, false
-			}
-
-			for i := range va.Len() {
-				if !va.At(i).Equal(vb.At(i)) {
-					return nil, false
-				}
-			}
-
+	if d.Key != nil {
+		pc().Key, d.Key = d.Key, nil
+	}
+	if d.KeyExpiry != nil {
+		pc().KeyExpiry, d.KeyExpiry = d.KeyExpiry, nil
+	}
+	if d.KeySignature != nil {
+		pc().KeySignature, d.KeySignature = *d.KeySignature, nil
+	}
+	if d.DiscoKey != nil {
+		pc().DiscoKey, d.DiscoKey = d.DiscoKey, nil
+	}
+	if d.Endpoints != nil {
+		pc().Endpoints, d.Endpoints = *d.Endpoints, nil
+	}
+	if d.DERP != nil {
+		ip, portStr, err := net.SplitHostPort(*d.DERP)
+		if err != nil || ip != tailcfg.DerpMagicIP {
+			return nil, false
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, false
+		}
+		pc().DERPRegion, d.DERP = port, nil
+	}
+	if d.Cap != nil {
+		pc().Cap, d.Cap = *d.Cap, nil
+	}
+	if d.CapMap != nil {
+		if n.CapMap == nil {
+			// A nil CapMap in a PeerChange means no change.
+			pc().CapMap = make(tailcfg.NodeCapMap)
+		} else {
+			pc().CapMap = maps.Clone(n.CapMap)
 		}
+		d.CapMap = nil
+	}
+	// Online and LastSeen are only patched between known values; a change
+	// from or to unknown is ignored.
+	if d.Online != nil {
+		if *d.Online != nil && was.Online() != nil {
+			pc().Online = *d.Online
+		}
+		d.Online = nil
+	}
+	if d.LastSeen != nil {
+		if *d.LastSeen != nil && was.LastSeen() != nil {
+			pc().LastSeen = *d.LastSeen
+		}
+		d.LastSeen = nil
+	}
+	if *d != (tailcfg.NodePatch{}) {
+		return nil, false
 	}
 	if ret != nil {
 		ret.NodeID = n.ID
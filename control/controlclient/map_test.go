@@ -1058,3 +1058,85 @@ func BenchmarkMapSessionDelta(b *testing.B) {
 		})
 	}
 }
+
+func TestMapSessionResume(t *testing.T) {
+	ms1 := newTestMapSession(t, nil)
+	ms1.handle = "session1"
+	ms1.netmapForResponse(&tailcfg.MapResponse{
+		Node:      &tailcfg.Node{Name: "self.example.ts.net."},
+		Peers:     []*tailcfg.Node{{ID: 1, Name: "a"}},
+		DNSConfig: &tailcfg.DNSConfig{Domains: []string{"example.ts.net"}},
+	})
+	ms1.noteSeq(5)
+	ms1.noteSeq(0) // e.g. a KeepAlive
+	if ms1.seq != 5 {
+		t.Errorf("seq = %v; want 5", ms1.seq)
+	}
+
+	ms2 := newMapSession(ms1.privateNodeKey, nil, new(controlknobs.Knobs))
+	defer ms2.Close()
+	ms2.resumeFrom(ms1)
+	if ms2.handle != "session1" || ms2.seq != 5 {
+		t.Errorf("resumed handle, seq = %q, %v; want session1, 5", ms2.handle, ms2.seq)
+	}
+	nm := ms2.netmapForResponse(&tailcfg.MapResponse{
+		PeersChanged: []*tailcfg.Node{{ID: 2, Name: "b"}},
+	})
+	if got := nm.SelfNode.Name(); got != "self.example.ts.net." {
+		t.Errorf("self node = %q; want it from the resumed session", got)
+	}
+	if len(nm.Peers) != 2 {
+		t.Errorf("got %d peers; want 2", len(nm.Peers))
+	}
+	if !reflect.DeepEqual(nm.DNS.Domains, []string{"example.ts.net"}) {
+		t.Errorf("DNS domains = %q; want them from the resumed session", nm.DNS.Domains)
+	}
+}
+
+func TestUnchangedNetmapNotUpdated(t *testing.T) {
+	nu := &countingNetmapUpdater{}
+	ms := newTestMapSession(t, nu)
+	ctx := context.Background()
+	handle := func(resp *tailcfg.MapResponse) {
+		t.Helper()
+		if err := ms.HandleNonKeepAliveMapResponse(ctx, resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkUpdates := func(want int64) {
+		t.Helper()
+		if got := nu.full.Load(); got != want {
+			t.Errorf("got %d full netmap updates; want %d", got, want)
+		}
+	}
+
+	handle(&tailcfg.MapResponse{
+		Node:  &tailcfg.Node{Name: "self.example.ts.net."},
+		Peers: []*tailcfg.Node{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}},
+	})
+	checkUpdates(1)
+
+	// Resending the same state doesn't rebuild the netmap.
+	handle(&tailcfg.MapResponse{
+		Node:      &tailcfg.Node{Name: "self.example.ts.net."},
+		DNSConfig: &tailcfg.DNSConfig{},
+	})
+	checkUpdates(1)
+	handle(&tailcfg.MapResponse{
+		Peers: []*tailcfg.Node{{ID: 2, Name: "b"}, {ID: 1, Name: "a"}},
+	})
+	checkUpdates(1)
+
+	// Any change does.
+	for _, resp := range []*tailcfg.MapResponse{
+		{PeersChanged: []*tailcfg.Node{{ID: 2, Name: "b2"}}},
+		{PeersRemoved: []tailcfg.NodeID{1}},
+		{OnlineChange: map[tailcfg.NodeID]bool{2: true}},
+		{DNSConfig: &tailcfg.DNSConfig{Domains: []string{"example.ts.net"}}},
+		{Node: &tailcfg.Node{Name: "self2.example.ts.net."}},
+	} {
+		n := nu.full.Load()
+		handle(resp)
+		checkUpdates(n + 1)
+	}
+}
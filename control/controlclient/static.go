@@ -0,0 +1,132 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controlclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	"tailscale.com/control/netmapbundle"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/logger"
+	"tailscale.com/types/netmap"
+	"tailscale.com/types/persist"
+	"tailscale.com/util/execqueue"
+)
+
+// Static is a Client that never contacts a control server. Instead, it
+// reports a fixed network map, loaded from a signed netmap bundle, so that a
+// node that has logged in before can keep working without any control
+// connectivity, such as in an air-gapped lab.
+type Static struct {
+	logf          logger.Logf
+	observer      Observer
+	observerQueue execqueue.ExecQueue
+	persist       persist.PersistView
+	nm            *netmap.NetworkMap
+}
+
+var _ Client = (*Static)(nil)
+
+// NewStatic returns a new Static client reporting the network map in bundle,
+// which must be signed by pub and be for the node identified by opts.Persist.
+// Only opts.Persist, opts.Observer, opts.Logf and opts.ControlKnobs are used.
+//
+// The network map is reported to opts.Observer right away.
+func NewStatic(opts Options, bundle *netmapbundle.Bundle, pub ed25519.PublicKey) (*Static, error) {
+	if opts.Observer == nil {
+		return nil, errors.New("missing required Options.Observer")
+	}
+	resp, err := bundle.Verify(pub)
+	if err != nil {
+		return nil, err
+	}
+	p := opts.Persist
+	if p.PrivateNodeKey.IsZero() {
+		return nil, errors.New("static netmap requires a node that has logged in before")
+	}
+	if nodeKey := p.PrivateNodeKey.Public(); resp.Node.Key != nodeKey {
+		return nil, fmt.Errorf("netmap bundle is for node key %v, not this node's %v", resp.Node.Key.ShortString(), nodeKey.ShortString())
+	}
+
+	var nu rememberLastNetmapUpdater
+	ms := newMapSession(p.PrivateNodeKey, &nu, opts.ControlKnobs)
+	defer ms.Close()
+	if err := ms.HandleNonKeepAliveMapResponse(context.Background(), resp); err != nil {
+		return nil, fmt.Errorf("processing netmap bundle: %w", err)
+	}
+	if nu.last == nil {
+		return nil, errors.New("[unexpected] netmap bundle produced no netmap")
+	}
+
+	logf := opts.Logf
+	if logf == nil {
+		logf = logger.Discard
+	}
+	c := &Static{
+		logf:     logf,
+		observer: opts.Observer,
+		persist:  p.View(),
+		nm:       nu.last,
+	}
+	c.logf("using static netmap with %d peers, created by node %v", len(c.nm.Peers), c.nm.SelfNode.StableID())
+	c.sendStatus()
+	return c, nil
+}
+
+// sendStatus reports to the observer that the node is logged in, and then
+// its static network map, like an Auto client does after logging in and
+// receiving the first map response.
+func (c *Static) sendStatus() {
+	login := Status{
+		Persist: c.persist,
+		state:   StateAuthenticated,
+	}
+	synced := Status{
+		NetMap:  c.nm,
+		Persist: c.persist,
+		state:   StateSynchronized,
+	}
+	c.observerQueue.Add(func() {
+		c.observer.SetControlClientStatus(c, login)
+		c.observer.SetControlClientStatus(c, synced)
+	})
+}
+
+// Shutdown implements Client.
+func (c *Static) Shutdown() {
+	c.observerQueue.Shutdown()
+}
+
+// Login implements Client. The node is always logged in, so it reports the
+// static network map again.
+func (c *Static) Login(LoginFlags) {
+	c.sendStatus()
+}
+
+// Logout implements Client. Logging out isn't possible without a control
+// server, so it always fails.
+func (c *Static) Logout(context.Context) error {
+	return UserVisibleError("can't log out while using a static netmap")
+}
+
+// AuthCantContinue implements Client. It always reports false.
+func (c *Static) AuthCantContinue() bool { return false }
+
+// SetPaused implements Client. It does nothing.
+func (c *Static) SetPaused(bool) {}
+
+// SetHostinfo implements Client. It does nothing.
+func (c *Static) SetHostinfo(*tailcfg.Hostinfo) {}
+
+// SetNetInfo implements Client. It does nothing.
+func (c *Static) SetNetInfo(*tailcfg.NetInfo) {}
+
+// SetTKAHead implements Client. It does nothing.
+func (c *Static) SetTKAHead(string) {}
+
+// UpdateEndpoints implements Client. It does nothing.
+func (c *Static) UpdateEndpoints([]tailcfg.Endpoint) {}
@@ -0,0 +1,94 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package controlclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"tailscale.com/control/netmapbundle"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/persist"
+)
+
+type statusChan chan Status
+
+func (c statusChan) SetControlClientStatus(_ Client, st Status) { c <- st }
+
+func TestStatic(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodePriv := key.NewNode()
+	self := &tailcfg.Node{
+		ID:       1,
+		StableID: "self",
+		Key:      nodePriv.Public(),
+		Name:     "self.ts.net.",
+	}
+	resp := &tailcfg.MapResponse{
+		Node: self,
+		Peers: []*tailcfg.Node{
+			{ID: 2, Key: key.NewNode().Public(), Name: "peer.ts.net."},
+		},
+		Domain: "example.com",
+	}
+	bundle, err := netmapbundle.Sign(resp, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(statusChan, 2)
+	c, err := NewStatic(Options{
+		Persist:  persist.Persist{PrivateNodeKey: nodePriv},
+		Observer: statuses,
+	}, bundle, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	recv := func() Status {
+		t.Helper()
+		select {
+		case st := <-statuses:
+			return st
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for status")
+		}
+		panic("unreachable")
+	}
+	if st := recv(); !st.LoginFinished() || st.NetMap != nil {
+		t.Errorf("first status: LoginFinished=%v NetMap=%v; want login without netmap", st.LoginFinished(), st.NetMap)
+	}
+	st := recv()
+	if st.NetMap == nil {
+		t.Fatal("second status has no netmap")
+	}
+	if got := st.NetMap.NodeKey; got != nodePriv.Public() {
+		t.Errorf("NodeKey = %v, want %v", got, nodePriv.Public())
+	}
+	if len(st.NetMap.Peers) != 1 || st.NetMap.Domain != "example.com" {
+		t.Errorf("unexpected netmap: %v", st.NetMap)
+	}
+	if err := c.Logout(context.Background()); err == nil {
+		t.Error("Logout succeeded")
+	}
+
+	// The bundle is only usable by the node it's for.
+	if _, err := NewStatic(Options{
+		Persist:  persist.Persist{PrivateNodeKey: key.NewNode()},
+		Observer: statuses,
+	}, bundle, pub); err == nil {
+		t.Error("NewStatic with another node's key succeeded")
+	}
+	// Or by a node that's never logged in.
+	if _, err := NewStatic(Options{Observer: statuses}, bundle, pub); err == nil {
+		t.Error("NewStatic without node key succeeded")
+	}
+}
@@ -452,6 +452,7 @@ func isLoopback(a net.Addr) bool {
 		return "macOS Screen Time seems to be blocking Tailscale. Try disabling Screen Time in System Settings > Screen Time > Content & Privacy > Access to Web Content."
 	},
 	ImpactsConnectivity: true,
+	Component:           health.ComponentNetwork,
 })
 
 // tryURLUpgrade connects to u, and tries to upgrade it to a net.Conn.
@@ -508,8 +509,6 @@ func (a *Dialer) tryURLUpgrade(ctx context.Context, u *url.URL, optAddr netip.Ad
 
 	tr := http.DefaultTransport.(*http.Transport).Clone()
 	defer tr.CloseIdleConnections()
-	tr.Proxy = a.getProxyFunc()
-	tshttpproxy.SetTransportGetProxyConnectHeader(tr)
 	tr.DialContext = dnscache.Dialer(dialer, dns)
 	// Disable HTTP2, since h2 can't do protocol switching.
 	tr.TLSClientConfig.NextProtos = []string{}
@@ -533,7 +532,13 @@ func (a *Dialer) tryURLUpgrade(ctx context.Context, u *url.URL, optAddr netip.Ad
 		return nil // regardless
 	}
 
-	tr.DialTLSContext = dnscache.TLSDialer(dialer, dns, tr.TLSClientConfig)
+	// SetTransportProxy tunnels HTTPS connections through proxies itself
+	// with DialTLSContext on some platforms, dialing with the DialContext
+	// above; only set ours if it didn't.
+	tshttpproxy.SetTransportProxy(tr, a.getProxyFunc())
+	if tr.DialTLSContext == nil {
+		tr.DialTLSContext = dnscache.TLSDialer(dialer, dns, tr.TLSClientConfig)
+	}
 	tr.DisableCompression = true
 
 	// (mis)use httptrace to extract the underlying net.Conn from the
@@ -30,6 +30,7 @@
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/socks5"
 	"tailscale.com/net/tsdial"
+	"tailscale.com/net/tshttpproxy"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tstest"
 	"tailscale.com/tstest/deptest"
@@ -49,6 +50,11 @@ type httpTestParam struct {
 	doEarlyWrite bool
 
 	httpInDial bool
+
+	// sysProxyAuth makes HTTPS connections be tunneled through the proxy
+	// as on platforms with connection-based proxy authentication, such
+	// as Windows.
+	sysProxyAuth bool
 }
 
 func TestControlHTTP(t *testing.T) {
@@ -87,6 +93,16 @@ func TestControlHTTP(t *testing.T) {
 				allowHTTP:    false,
 			},
 		},
+		// HTTP->HTTPS, tunneled by tshttpproxy
+		{
+			name: "http_to_https_sys_auth",
+			proxy: &httpProxy{
+				useTLS:       false,
+				allowConnect: true,
+				allowHTTP:    false,
+			},
+			sysProxyAuth: true,
+		},
 		// HTTP->any (will pick HTTP)
 		{
 			name: "http_to_any",
@@ -145,6 +161,9 @@ func TestControlHTTP(t *testing.T) {
 
 func testControlHTTP(t *testing.T, param httpTestParam) {
 	proxy := param.proxy
+	if param.sysProxyAuth {
+		defer tshttpproxy.SetSysAuthSessionForTest()()
+	}
 	client, server := key.NewMachine(), key.NewMachine()
 
 	const testProtocolVersion = 1
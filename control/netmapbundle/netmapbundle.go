@@ -0,0 +1,185 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package netmapbundle contains the signed, pre-generated network map bundles
+// with which a node can run without any connectivity to a control server,
+// such as in an air-gapped lab.
+//
+// A bundle is generated with "tailscale debug netmap-bundle" on the node
+// while it's online, and signed with an ed25519 key whose public half is
+// then given to the node's tailscaled. Keys are PEM files, as generated by
+// "openssl genpkey -algorithm ed25519" and "openssl pkey -pubout".
+package netmapbundle
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+	"tailscale.com/types/opt"
+)
+
+// Bundle is a signed network map.
+type Bundle struct {
+	// Created is when the bundle was generated. It's informational
+	// only; it's not covered by the signature.
+	Created time.Time
+
+	// MapResponse is the JSON encoding of the tailcfg.MapResponse that
+	// describes the node's network map, as a full (non-delta) response.
+	MapResponse json.RawMessage
+
+	// Signature is the ed25519 signature of sigPrefix followed by
+	// MapResponse.
+	Signature []byte
+}
+
+// sigPrefix is prepended to the signed message, so that a signature of a
+// bundle can't be mistaken for a signature of anything else by the same key.
+const sigPrefix = "tailscale-netmap-bundle-v1\x00"
+
+func signedMessage(mapResponse []byte) []byte {
+	return append([]byte(sigPrefix), mapResponse...)
+}
+
+// Sign returns a new bundle of resp, signed by priv.
+func Sign(resp *tailcfg.MapResponse, priv ed25519.PrivateKey) (*Bundle, error) {
+	if resp.Node == nil {
+		return nil, errors.New("map response has no self node")
+	}
+	bs, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{
+		Created:     time.Now().UTC(),
+		MapResponse: bs,
+		Signature:   ed25519.Sign(priv, signedMessage(bs)),
+	}, nil
+}
+
+// Verify verifies that b was signed by pub and returns its map response.
+func (b *Bundle) Verify(pub ed25519.PublicKey) (*tailcfg.MapResponse, error) {
+	if !ed25519.Verify(pub, signedMessage(b.MapResponse), b.Signature) {
+		return nil, errors.New("invalid netmap bundle signature")
+	}
+	resp := new(tailcfg.MapResponse)
+	if err := json.Unmarshal(b.MapResponse, resp); err != nil {
+		return nil, fmt.Errorf("decoding netmap bundle: %w", err)
+	}
+	if resp.Node == nil {
+		return nil, errors.New("netmap bundle has no self node")
+	}
+	return resp, nil
+}
+
+// Read reads and decodes the bundle in the named file.
+// It doesn't verify its signature.
+func Read(path string) (*Bundle, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := new(Bundle)
+	if err := json.Unmarshal(bs, b); err != nil {
+		return nil, fmt.Errorf("decoding netmap bundle %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// FromNetmap returns a full map response describing nm, such that
+// processing it as the first response of a map session results in an
+// equivalent network map.
+func FromNetmap(nm *netmap.NetworkMap) *tailcfg.MapResponse {
+	resp := &tailcfg.MapResponse{
+		Node:                      nm.SelfNode.AsStruct(),
+		DERPMap:                   nm.DERPMap,
+		DNSConfig:                 nm.DNS.Clone(),
+		Domain:                    nm.Domain,
+		CollectServices:           opt.NewBool(nm.CollectServices),
+		PacketFilter:              nm.PacketFilterRules.AsSlice(),
+		SSHPolicy:                 nm.SSHPolicy,
+		Health:                    nm.ControlHealth,
+		DomainDataPlaneAuditLogID: nm.DomainAuditLogID,
+		MaxKeyDuration:            nm.MaxKeyDuration,
+	}
+	for _, p := range nm.Peers {
+		resp.Peers = append(resp.Peers, p.AsStruct())
+	}
+	for _, id := range slices.Sorted(maps.Keys(nm.UserProfiles)) {
+		resp.UserProfiles = append(resp.UserProfiles, nm.UserProfiles[id])
+	}
+	return resp
+}
+
+// ReadPrivateKey reads the PEM-encoded PKCS #8 ed25519 private key in the
+// named file.
+func ReadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	k, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	priv, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %T is not an ed25519 private key", path, k)
+	}
+	return priv, nil
+}
+
+// ReadPublicKey reads the PEM-encoded PKIX ed25519 public key in the named
+// file.
+func ReadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	k, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	pub, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %T is not an ed25519 public key", path, k)
+	}
+	return pub, nil
+}
+
+func readPEM(path, typ string) ([]byte, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(bs)
+	if block == nil || block.Type != typ {
+		return nil, fmt.Errorf("%s: no PEM %q block found", path, typ)
+	}
+	return block.Bytes, nil
+}
+
+// EncodeKeys returns the PEM encodings of priv, and of its public key.
+func EncodeKeys(priv ed25519.PrivateKey) (privPEM, pubPEM []byte, err error) {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	privPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	pubPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	return privPEM, pubPEM, nil
+}
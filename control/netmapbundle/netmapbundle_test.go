@@ -0,0 +1,122 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netmapbundle
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/netmap"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeKey := key.NewNode().Public()
+	nm := &netmap.NetworkMap{
+		SelfNode: (&tailcfg.Node{ID: 1, Key: nodeKey, Name: "self.ts.net."}).View(),
+		Peers: []tailcfg.NodeView{
+			(&tailcfg.Node{ID: 2, Name: "peer2.ts.net."}).View(),
+			(&tailcfg.Node{ID: 3, Name: "peer3.ts.net."}).View(),
+		},
+		Domain: "example.com",
+		UserProfiles: map[tailcfg.UserID]tailcfg.UserProfile{
+			2: {ID: 2, LoginName: "b@example.com"},
+			1: {ID: 1, LoginName: "a@example.com"},
+		},
+	}
+	b, err := Sign(FromNetmap(nm), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Round trip through a file.
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	j, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, j, 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err = Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.Verify(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Key != nodeKey || resp.Domain != "example.com" || len(resp.Peers) != 2 {
+		t.Errorf("unexpected map response: %+v", resp)
+	}
+	if got, want := []tailcfg.UserID{resp.UserProfiles[0].ID, resp.UserProfiles[1].ID}, []tailcfg.UserID{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("user profiles = %v, want %v", got, want)
+	}
+
+	if _, err := b.Verify(otherPub); err == nil {
+		t.Error("Verify with wrong key succeeded")
+	}
+	b.MapResponse = append(b.MapResponse[:len(b.MapResponse)-1], ' ', '}')
+	if _, err := b.Verify(pub); err == nil {
+		t.Error("Verify of modified bundle succeeded")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPEM, pubPEM, err := EncodeKeys(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	privPath := filepath.Join(dir, "key.pem")
+	pubPath := filepath.Join(dir, "key.pem.pub")
+	if err := os.WriteFile(privPath, privPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pubPath, pubPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gotPriv, err := ReadPrivateKey(privPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotPriv.Equal(priv) {
+		t.Error("private key changed in round trip")
+	}
+	gotPub, err := ReadPublicKey(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotPub.Equal(pub) {
+		t.Error("public key changed in round trip")
+	}
+
+	// The keys aren't interchangeable.
+	if _, err := ReadPublicKey(privPath); err == nil {
+		t.Error("ReadPublicKey of private key succeeded")
+	}
+	if _, err := ReadPrivateKey(pubPath); err == nil {
+		t.Error("ReadPrivateKey of public key succeeded")
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package derp
+
+import (
+	"cmp"
+	"errors"
+	"net/netip"
+	"slices"
+	"time"
+
+	"tailscale.com/types/key"
+)
+
+// errDraining is returned by Server.accept for clients that connect while
+// the server is draining.
+var errDraining = errors.New("server draining")
+
+// ConnInfo describes a client connection to a Server.
+type ConnInfo struct {
+	Key        key.NodePublic
+	ConnNum    int64          // unique per connection to the process
+	RemoteAddr netip.AddrPort `json:",omitzero,omitempty"`
+
+	// Mesh is whether the client is a mesh peer.
+	Mesh bool `json:",omitempty"`
+	// Prober is whether the client is a prober.
+	Prober bool `json:",omitempty"`
+	// Dup is whether the client's key has other connections, in which
+	// case at most one of them is Active.
+	Dup bool `json:",omitempty"`
+	// Active is whether the connection receives packets for Key.
+	Active bool
+
+	ConnectedAt time.Time
+	BytesRecv   int64     // packet bytes received from the client
+	BytesSent   int64     // packet bytes sent to the client
+	LastRecv    time.Time `json:",omitzero,omitempty"` // when the last packet was received from the client
+	LastSend    time.Time `json:",omitzero,omitempty"` // when the last packet sent to the client was queued
+
+	// Idle is how long it's been since the client last sent a packet, or
+	// since it connected if it hasn't.
+	Idle time.Duration
+}
+
+// noteRecv records that the client sent a packet of n bytes at now, as
+// already read for the packet's queueing, so as not to read the clock for
+// every packet again.
+func (c *sclient) noteRecv(n int, now time.Time) {
+	c.bytesRecv.Add(int64(n))
+	c.lastRecv.Store(now.UnixNano())
+}
+
+// Conns returns the client connections to s, ordered by ConnNum.
+func (s *Server) Conns() []ConnInfo {
+	now := s.clock.Now()
+	unixTime := func(ns int64) time.Time {
+		if ns == 0 {
+			return time.Time{}
+		}
+		return time.Unix(0, ns)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []ConnInfo
+	for _, cs := range s.clients {
+		active := cs.activeClient.Load()
+		cs.ForeachClient(func(c *sclient) {
+			ci := ConnInfo{
+				Key:         c.key,
+				ConnNum:     c.connNum,
+				RemoteAddr:  c.remoteIPPort,
+				Mesh:        c.canMesh,
+				Prober:      c.info.IsProber,
+				Dup:         c.isDup.Load(),
+				Active:      c == active,
+				ConnectedAt: c.connectedAt,
+				BytesRecv:   c.bytesRecv.Load(),
+				BytesSent:   c.bytesSent.Load(),
+				LastRecv:    unixTime(c.lastRecv.Load()),
+				LastSend:    unixTime(c.lastSend.Load()),
+			}
+			ci.Idle = now.Sub(ci.ConnectedAt)
+			if !ci.LastRecv.IsZero() {
+				ci.Idle = now.Sub(ci.LastRecv)
+			}
+			ret = append(ret, ci)
+		})
+	}
+	slices.SortFunc(ret, func(a, b ConnInfo) int {
+		return cmp.Compare(a.ConnNum, b.ConnNum)
+	})
+	return ret
+}
+
+// DisconnectClient closes all connections from the client with key k and
+// returns how many it closed. The client may reconnect unless it's
+// rejected, such as while s is draining.
+func (s *Server) DisconnectClient(k key.NodePublic) int {
+	var conns []Conn
+	s.mu.Lock()
+	if cs, ok := s.clients[k]; ok {
+		cs.ForeachClient(func(c *sclient) {
+			conns = append(conns, c.nc)
+		})
+	}
+	s.mu.Unlock()
+
+	for _, nc := range conns {
+		nc.Close()
+	}
+	if len(conns) > 0 {
+		s.logf("derp: disconnected %d connection(s) of client %v", len(conns), k.ShortString())
+	}
+	return len(conns)
+}
+
+// SetDraining sets whether s is draining. While draining, s keeps serving
+// its current clients but rejects new ones, other than mesh peers, so that
+// they connect elsewhere before s is taken down for maintenance.
+func (s *Server) SetDraining(v bool) {
+	if s.draining.Swap(v) != v {
+		s.logf("derp: draining = %v", v)
+	}
+}
+
+// Draining reports whether s is draining. See SetDraining.
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
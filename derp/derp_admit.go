@@ -0,0 +1,86 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package derp
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// SignAdmitToken returns a DERP admission token for claims, signed by priv.
+//
+// Servers configured with SetVerifyClientTokenKeys to trust the public half of
+// priv admit the client with claims.NodePublic when it presents the token with
+// the AdmitToken ClientOpt, until the token expires. Claims must have both a
+// node key and an expiry, so that a leaked token only admits that node.
+//
+// The token is the base64url-encoded JSON of claims, a dot, and the
+// base64url-encoded ed25519 signature of the first part.
+func SignAdmitToken(priv ed25519.PrivateKey, claims tailcfg.DERPAdmitTokenClaims) (string, error) {
+	if claims.NodePublic.IsZero() {
+		return "", errors.New("admit token claims must have a node key")
+	}
+	if claims.Expires.IsZero() {
+		return "", errors.New("admit token claims must have an expiry")
+	}
+	j, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(j)
+	sig := ed25519.Sign(priv, []byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// verifyAdmitToken reports an error if token isn't signed by any of keys, has
+// expired as of now, or isn't bound to clientKey.
+func verifyAdmitToken(keys []ed25519.PublicKey, token string, clientKey key.NodePublic, now time.Time) error {
+	if token == "" {
+		return errors.New("no admit token")
+	}
+	payload, sig64, ok := strings.Cut(token, ".")
+	if !ok {
+		return errors.New("malformed admit token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sig64)
+	if err != nil {
+		return fmt.Errorf("malformed admit token signature: %w", err)
+	}
+	signed := false
+	for _, k := range keys {
+		if ed25519.Verify(k, []byte(payload), sig) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return errors.New("admit token not signed by a trusted key")
+	}
+	j, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return fmt.Errorf("malformed admit token claims: %w", err)
+	}
+	var claims tailcfg.DERPAdmitTokenClaims
+	if err := json.Unmarshal(j, &claims); err != nil {
+		return fmt.Errorf("malformed admit token claims: %w", err)
+	}
+	if claims.Expires.IsZero() || !now.Before(claims.Expires) {
+		return errors.New("admit token expired")
+	}
+	if claims.NodePublic.IsZero() {
+		return errors.New("admit token isn't bound to a node key")
+	}
+	if claims.NodePublic != clientKey {
+		return fmt.Errorf("admit token is for %v", claims.NodePublic.ShortString())
+	}
+	return nil
+}
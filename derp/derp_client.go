@@ -33,6 +33,7 @@ type Client struct {
 	meshKey     string
 	canAckPings bool
 	isProber    bool
+	admitToken  string
 
 	wmu  sync.Mutex // hold while writing to bw
 	bw   *bufio.Writer
@@ -60,6 +61,7 @@ type clientOpt struct {
 	ServerPub   key.NodePublic
 	CanAckPings bool
 	IsProber    bool
+	AdmitToken  string
 }
 
 // MeshKey returns a ClientOpt to pass to the DERP server during connect to get
@@ -72,6 +74,15 @@ func MeshKey(key string) ClientOpt { return clientOptFunc(func(o *clientOpt) { o
 // declare that this client is a a prober.
 func IsProber(v bool) ClientOpt { return clientOptFunc(func(o *clientOpt) { o.IsProber = v }) }
 
+// AdmitToken returns a ClientOpt to pass an admission token to the DERP server
+// during connect, for servers that admit clients by tokens from SignAdmitToken
+// or by an admission controller.
+//
+// An empty token means to not send one.
+func AdmitToken(token string) ClientOpt {
+	return clientOptFunc(func(o *clientOpt) { o.AdmitToken = token })
+}
+
 // ServerPublicKey returns a ClientOpt to declare that the server's DERP public key is known.
 // If key is the zero value, the returned ClientOpt is a no-op.
 func ServerPublicKey(key key.NodePublic) ClientOpt {
@@ -106,6 +117,7 @@ func newClient(privateKey key.NodePrivate, nc Conn, brw *bufio.ReadWriter, logf
 		meshKey:     opt.MeshKey,
 		canAckPings: opt.CanAckPings,
 		isProber:    opt.IsProber,
+		admitToken:  opt.AdmitToken,
 		clock:       tstime.StdClock{},
 	}
 	if opt.ServerPub.IsZero() {
@@ -177,6 +189,10 @@ type clientInfo struct {
 
 	// IsProber is whether this client is a prober.
 	IsProber bool `json:",omitempty"`
+
+	// AdmitToken optionally specifies a token for servers that
+	// verify clients by admission tokens. See SignAdmitToken.
+	AdmitToken string `json:",omitempty"`
 }
 
 func (c *Client) sendClientKey() error {
@@ -185,6 +201,7 @@ func (c *Client) sendClientKey() error {
 		MeshKey:     c.meshKey,
 		CanAckPings: c.canAckPings,
 		IsProber:    c.isProber,
+		AdmitToken:  c.admitToken,
 	})
 	if err != nil {
 		return err
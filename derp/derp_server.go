@@ -164,6 +164,7 @@ type Server struct {
 	multiForwarderDeleted        expvar.Int
 	removePktForwardOther        expvar.Int
 	sclientWriteTimeouts         expvar.Int
+	drainingRejects              expvar.Int       // connections rejected while draining
 	avgQueueDuration             *uint64          // In milliseconds; accessed atomically
 	tcpRtt                       metrics.LabelMap // histogram
 	meshUpdateBatchSize          *metrics.Histogram
@@ -178,6 +179,14 @@ type Server struct {
 	verifyClientsURL         string
 	verifyClientsURLFailOpen bool
 
+	// verifyClientsTokenKeys, if non-empty, only accepts client connections
+	// presenting an admission token signed by one of these keys.
+	verifyClientsTokenKeys []ed25519.PublicKey
+
+	// draining is whether new clients, other than mesh peers, are
+	// rejected. See SetDraining.
+	draining atomic.Bool
+
 	mu       sync.Mutex
 	closed   bool
 	netConns map[Conn]chan struct{} // chan is closed when conn closes
@@ -443,6 +452,16 @@ func (s *Server) SetVerifyClientURLFailOpen(v bool) {
 	s.verifyClientsURLFailOpen = v
 }
 
+// SetVerifyClientTokenKeys sets the keys whose admission tokens (see
+// SignAdmitToken) are accepted from clients. If non-empty, clients without a
+// valid token signed by one of them are rejected, in addition to any checks
+// by SetVerifyClient or SetVerifyClientURL.
+//
+// It must be called before serving begins.
+func (s *Server) SetVerifyClientTokenKeys(keys []ed25519.PublicKey) {
+	s.verifyClientsTokenKeys = keys
+}
+
 // HasMeshKey reports whether the server is configured with a mesh key.
 func (s *Server) HasMeshKey() bool { return s.meshKey != "" }
 
@@ -524,7 +543,7 @@ func (s *Server) Accept(ctx context.Context, nc Conn, brw *bufio.ReadWriter, rem
 		s.mu.Unlock()
 	}()
 
-	if err := s.accept(ctx, nc, brw, remoteAddr, connNum); err != nil && !s.isClosed() {
+	if err := s.accept(ctx, nc, brw, remoteAddr, connNum); err != nil && !s.isClosed() && !errors.Is(err, errDraining) {
 		s.logf("derp: %s: %v", remoteAddr, err)
 	}
 }
@@ -839,6 +858,10 @@ func (s *Server) accept(ctx context.Context, nc Conn, brw *bufio.ReadWriter, rem
 	if err != nil {
 		return fmt.Errorf("receive client key: %v", err)
 	}
+	if s.draining.Load() && !s.isMeshPeer(clientInfo) {
+		s.drainingRejects.Add(1)
+		return errDraining
+	}
 
 	remoteIPPort, _ := netip.ParseAddrPort(remoteAddr)
 	if err := s.verifyClient(ctx, clientKey, clientInfo, remoteIPPort.Addr()); err != nil {
@@ -1060,6 +1083,8 @@ func (c *sclient) handleFrameForwardPacket(ft frameType, fl uint32) error {
 	if err != nil {
 		return fmt.Errorf("client %v: recvForwardPacket: %v", c.key, err)
 	}
+	now := c.s.clock.Now()
+	c.noteRecv(len(contents), now)
 	s.packetsForwardedIn.Add(1)
 
 	var dstLen int
@@ -1087,7 +1112,7 @@ func (c *sclient) handleFrameForwardPacket(ft frameType, fl uint32) error {
 
 	return c.sendPkt(dst, pkt{
 		bs:         contents,
-		enqueuedAt: c.s.clock.Now(),
+		enqueuedAt: now,
 		src:        srcKey,
 	})
 }
@@ -1100,6 +1125,8 @@ func (c *sclient) handleFrameSendPacket(ft frameType, fl uint32) error {
 	if err != nil {
 		return fmt.Errorf("client %v: recvPacket: %v", c.key, err)
 	}
+	now := c.s.clock.Now()
+	c.noteRecv(len(contents), now)
 
 	var fwd PacketForwarder
 	var dstLen int
@@ -1140,7 +1167,7 @@ func (c *sclient) handleFrameSendPacket(ft frameType, fl uint32) error {
 
 	p := pkt{
 		bs:         contents,
-		enqueuedAt: c.s.clock.Now(),
+		enqueuedAt: now,
 		src:        c.key,
 	}
 	return c.sendPkt(dst, p)
@@ -1283,6 +1310,17 @@ func (s *Server) verifyClient(ctx context.Context, clientKey key.NodePublic, inf
 		return nil
 	}
 
+	// token-based verification:
+	if len(s.verifyClientsTokenKeys) > 0 {
+		var token string
+		if info != nil {
+			token = info.AdmitToken
+		}
+		if err := verifyAdmitToken(s.verifyClientsTokenKeys, token, clientKey, s.clock.Now()); err != nil {
+			return fmt.Errorf("peer %v not authorized: %w", clientKey, err)
+		}
+	}
+
 	// tailscaled-based verification:
 	if s.verifyClientsLocalTailscaled {
 		_, err := localClient.WhoIsNodeKey(ctx, clientKey)
@@ -1303,10 +1341,14 @@ func (s *Server) verifyClient(ctx context.Context, clientKey key.NodePublic, inf
 		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 		defer cancel()
 
-		jreq, err := json.Marshal(&tailcfg.DERPAdmitClientRequest{
+		areq := &tailcfg.DERPAdmitClientRequest{
 			NodePublic: clientKey,
 			Source:     clientIP,
-		})
+		}
+		if info != nil {
+			areq.Token = info.AdmitToken
+		}
+		jreq, err := json.Marshal(areq)
 		if err != nil {
 			return err
 		}
@@ -1546,6 +1588,12 @@ type sclient struct {
 	isDisabled     atomic.Bool      // whether sends to this peer are disabled due to active/active dups
 	debug          bool             // turn on for verbose logging
 
+	// Packet stats, for Server.Conns.
+	bytesRecv atomic.Int64
+	bytesSent atomic.Int64
+	lastRecv  atomic.Int64 // unix nanos of the last packet from the client, or 0
+	lastSend  atomic.Int64 // unix nanos the last packet to the client was queued, or 0
+
 	// Owned by run, not thread-safe.
 	br          *bufio.Reader
 	connectedAt time.Time
@@ -1713,12 +1761,10 @@ func (c *sclient) sendLoop(ctx context.Context) error {
 			werr = c.sendMeshUpdates()
 			continue
 		case msg := <-c.sendQueue:
-			werr = c.sendPacket(msg.src, msg.bs)
-			c.recordQueueTime(msg.enqueuedAt)
+			werr = c.sendQueuedPacket(msg)
 			continue
 		case msg := <-c.discoSendQueue:
-			werr = c.sendPacket(msg.src, msg.bs)
-			c.recordQueueTime(msg.enqueuedAt)
+			werr = c.sendQueuedPacket(msg)
 			continue
 		case msg := <-c.sendPongCh:
 			werr = c.sendPong(msg)
@@ -1747,11 +1793,9 @@ func (c *sclient) sendLoop(ctx context.Context) error {
 		case <-c.meshUpdate:
 			werr = c.sendMeshUpdates()
 		case msg := <-c.sendQueue:
-			werr = c.sendPacket(msg.src, msg.bs)
-			c.recordQueueTime(msg.enqueuedAt)
+			werr = c.sendQueuedPacket(msg)
 		case msg := <-c.discoSendQueue:
-			werr = c.sendPacket(msg.src, msg.bs)
-			c.recordQueueTime(msg.enqueuedAt)
+			werr = c.sendQueuedPacket(msg)
 		case msg := <-c.sendPongCh:
 			werr = c.sendPong(msg)
 		case <-keepAliveTickChannel:
@@ -1877,6 +1921,19 @@ func (c *sclient) sendMeshUpdates() error {
 	}
 }
 
+// sendQueuedPacket writes the packet msg from the client's send queue to the
+// client, and records how long it was queued. The time it was queued stands
+// in for when it was sent in the client's stats, so that sending doesn't
+// read the clock again.
+func (c *sclient) sendQueuedPacket(msg pkt) error {
+	err := c.sendPacket(msg.src, msg.bs)
+	c.recordQueueTime(msg.enqueuedAt)
+	if err == nil {
+		c.lastSend.Store(msg.enqueuedAt.UnixNano())
+	}
+	return err
+}
+
 // sendPacket writes contents to the client in a RecvPacket frame. If
 // srcKey.IsZero, uses the old DERPv1 framing format, otherwise uses
 // DERPv2. The bytes of contents are only valid until this function
@@ -1890,6 +1947,7 @@ func (c *sclient) sendPacket(srcKey key.NodePublic, contents []byte) (err error)
 		} else {
 			c.s.packetsSent.Add(1)
 			c.s.bytesSent.Add(int64(len(contents)))
+			c.bytesSent.Add(int64(len(contents)))
 		}
 		c.debugLogf("sendPacket from %s: %v", srcKey.ShortString(), err)
 	}()
@@ -2114,6 +2172,13 @@ func (s *Server) ExpVar() expvar.Var {
 	m.Set("multiforwarder_deleted", &s.multiForwarderDeleted)
 	m.Set("packet_forwarder_delete_other_value", &s.removePktForwardOther)
 	m.Set("sclient_write_timeouts", &s.sclientWriteTimeouts)
+	m.Set("gauge_draining", expvar.Func(func() any {
+		if s.draining.Load() {
+			return 1
+		}
+		return 0
+	}))
+	m.Set("counter_draining_rejects", &s.drainingRejects)
 	m.Set("average_queue_duration_ms", expvar.Func(func() any {
 		return math.Float64frombits(atomic.LoadUint64(s.avgQueueDuration))
 	}))
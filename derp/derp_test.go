@@ -8,8 +8,11 @@
 	"bytes"
 	"cmp"
 	"context"
+	"crypto/ed25519"
+	crand "crypto/rand"
 	"crypto/x509"
 	"encoding/asn1"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"expvar"
@@ -20,6 +23,7 @@
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -29,6 +33,7 @@
 	"golang.org/x/time/rate"
 	"tailscale.com/disco"
 	"tailscale.com/net/memnet"
+	"tailscale.com/tailcfg"
 	"tailscale.com/tstest"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
@@ -50,6 +55,66 @@ func TestClientInfoUnmarshal(t *testing.T) {
 	}
 }
 
+func TestVerifyAdmitToken(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, otherPriv, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	client := key.NewNode().Public()
+	sign := func(priv ed25519.PrivateKey, claims tailcfg.DERPAdmitTokenClaims) string {
+		t.Helper()
+		token, err := SignAdmitToken(priv, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := sign(priv, tailcfg.DERPAdmitTokenClaims{NodePublic: client, Expires: now.Add(time.Hour)})
+	unbound, err := json.Marshal(tailcfg.DERPAdmitTokenClaims{Expires: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unboundPayload := base64.RawURLEncoding.EncodeToString(unbound)
+	unboundToken := unboundPayload + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(priv, []byte(unboundPayload)))
+
+	tests := []struct {
+		name    string
+		keys    []ed25519.PublicKey
+		token   string
+		wantErr bool
+	}{
+		{"valid", []ed25519.PublicKey{pub}, valid, false},
+		{"second-key", []ed25519.PublicKey{otherPub, pub}, valid, false},
+		{"other-client", []ed25519.PublicKey{pub}, sign(priv, tailcfg.DERPAdmitTokenClaims{NodePublic: key.NewNode().Public(), Expires: now.Add(time.Hour)}), true},
+		{"unbound", []ed25519.PublicKey{pub}, unboundToken, true},
+		{"expired", []ed25519.PublicKey{pub}, sign(priv, tailcfg.DERPAdmitTokenClaims{NodePublic: client, Expires: now}), true},
+		{"untrusted-key", []ed25519.PublicKey{pub}, sign(otherPriv, tailcfg.DERPAdmitTokenClaims{NodePublic: client, Expires: now.Add(time.Hour)}), true},
+		{"tampered", []ed25519.PublicKey{pub}, "e30" + valid[strings.Index(valid, "."):], true},
+		{"malformed", []ed25519.PublicKey{pub}, "garbage", true},
+		{"missing", []ed25519.PublicKey{pub}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyAdmitToken(tt.keys, tt.token, client, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyAdmitToken = %v; wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := SignAdmitToken(priv, tailcfg.DERPAdmitTokenClaims{NodePublic: client}); err == nil {
+		t.Error("SignAdmitToken without expiry succeeded")
+	}
+	if _, err := SignAdmitToken(priv, tailcfg.DERPAdmitTokenClaims{Expires: now.Add(time.Hour)}); err == nil {
+		t.Error("SignAdmitToken without node key succeeded")
+	}
+}
+
 func TestSendRecv(t *testing.T) {
 	serverPrivateKey := key.NewNode()
 	s := NewServer(serverPrivateKey, t.Logf)
@@ -1626,3 +1691,70 @@ func TestGetPerClientSendQueueDepth(t *testing.T) {
 		})
 	}
 }
+
+func TestServerAdmin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ts := newTestServer(t, ctx)
+	defer ts.close(t)
+
+	a := newRegularClient(t, ts, "a")
+	b := newRegularClient(t, ts, "b")
+	if err := a.c.Send(b.pub, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := b.c.recvTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	} else if _, ok := m.(ReceivedPacket); !ok {
+		t.Fatalf("got %T; want ReceivedPacket", m)
+	}
+
+	byKey := map[key.NodePublic]ConnInfo{}
+	for _, ci := range ts.s.Conns() {
+		byKey[ci.Key] = ci
+	}
+	if len(byKey) != 2 {
+		t.Fatalf("got %d conns; want 2", len(byKey))
+	}
+	if ci := byKey[a.pub]; ci.BytesRecv != 5 || ci.LastRecv.IsZero() || !ci.Active {
+		t.Errorf("a: got %+v; want 5 bytes received", ci)
+	}
+	if ci := byKey[b.pub]; ci.BytesSent != 5 || ci.BytesRecv != 0 || ci.Idle <= 0 {
+		t.Errorf("b: got %+v; want 5 bytes sent and idle", ci)
+	}
+
+	ts.s.SetDraining(true)
+	nc, err := net.Dial("tcp", ts.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	c, err := NewClient(key.NewNode(), nc, bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)), t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.recvTimeout(time.Second); err == nil {
+		t.Error("new client connected while draining")
+	}
+	if got := ts.s.drainingRejects.Value(); got != 1 {
+		t.Errorf("got %d draining rejects; want 1", got)
+	}
+	newTestWatcher(t, ts, "mesh-peer") // mesh peers are still accepted
+	ts.s.SetDraining(false)
+
+	if n := ts.s.DisconnectClient(a.pub); n != 1 {
+		t.Errorf("DisconnectClient = %d; want 1", n)
+	}
+	if _, err := a.c.recvTimeout(time.Second); err == nil {
+		t.Error("disconnected client can still receive")
+	}
+	for deadline := time.Now().Add(5 * time.Second); ts.s.IsClientConnectedForTest(a.pub); {
+		if time.Now().After(deadline) {
+			t.Fatal("disconnected client is still registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := ts.s.DisconnectClient(a.pub); n != 0 {
+		t.Errorf("second DisconnectClient = %d; want 0", n)
+	}
+}
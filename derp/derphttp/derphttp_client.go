@@ -58,6 +58,12 @@ type Client struct {
 	MeshKey       string             // optional; for trusted clients
 	IsProber      bool               // optional; for probers to optional declare themselves as such
 
+	// AdmitToken optionally returns the admission token to present to the
+	// DERP server with the given host name, or the empty string to present
+	// none, for servers that verify clients by admission tokens. It's called
+	// on each connect, so tokens can be renewed while the client runs.
+	AdmitToken func(host string) string
+
 	// WatchConnectionChanges is whether the client wishes to subscribe to
 	// notifications about clients connecting & disconnecting.
 	//
@@ -272,6 +278,15 @@ func (c *Client) tlsServerName(node *tailcfg.DERPNode) string {
 	return node.HostName
 }
 
+// admitToken returns the admission token to present to the DERP server at
+// node, which is nil when dialing c.url.
+func (c *Client) admitToken(node *tailcfg.DERPNode) string {
+	if c.AdmitToken == nil {
+		return ""
+	}
+	return c.AdmitToken(c.tlsServerName(node))
+}
+
 func (c *Client) urlString(node *tailcfg.DERPNode) string {
 	if c.url != nil {
 		return c.url.String()
@@ -391,7 +406,8 @@ func (c *Client) connect(ctx context.Context, caller string) (client *derp.Clien
 		if c.url != nil {
 			urlStr = c.url.String()
 		} else {
-			urlStr = c.urlString(reg.Nodes[0])
+			node = reg.Nodes[0]
+			urlStr = c.urlString(node)
 		}
 		c.logf("%s: connecting websocket to %v", caller, urlStr)
 		conn, err := dialWebsocketFunc(ctx, urlStr)
@@ -404,6 +420,7 @@ func (c *Client) connect(ctx context.Context, caller string) (client *derp.Clien
 			derp.MeshKey(c.MeshKey),
 			derp.CanAckPings(c.canAckPings),
 			derp.IsProber(c.IsProber),
+			derp.AdmitToken(c.admitToken(node)),
 		)
 		if err != nil {
 			return nil, 0, err
@@ -549,6 +566,7 @@ func (c *Client) connect(ctx context.Context, caller string) (client *derp.Clien
 		derp.ServerPublicKey(serverPub),
 		derp.CanAckPings(c.canAckPings),
 		derp.IsProber(c.IsProber),
+		derp.AdmitToken(c.admitToken(node)),
 	)
 	if err != nil {
 		return nil, 0, err
@@ -803,76 +821,17 @@ type res struct {
 	}
 }
 
-func firstStr(a, b string) string {
-	if a != "" {
-		return a
-	}
-	return b
-}
-
 // dialNodeUsingProxy connects to n using a CONNECT to the HTTP(s) proxy in proxyURL.
-func (c *Client) dialNodeUsingProxy(ctx context.Context, n *tailcfg.DERPNode, proxyURL *url.URL) (_ net.Conn, err error) {
-	pu := proxyURL
-	var proxyConn net.Conn
-	if pu.Scheme == "https" {
-		var d tls.Dialer
-		proxyConn, err = d.DialContext(ctx, "tcp", net.JoinHostPort(pu.Hostname(), firstStr(pu.Port(), "443")))
-	} else {
-		var d net.Dialer
-		proxyConn, err = d.DialContext(ctx, "tcp", net.JoinHostPort(pu.Hostname(), firstStr(pu.Port(), "80")))
-	}
-	defer func() {
-		if err != nil && proxyConn != nil {
-			// In a goroutine in case it's a *tls.Conn (that can block on Close)
-			// TODO(bradfitz): track the underlying tcp.Conn and just close that instead.
-			go proxyConn.Close()
-		}
-	}()
-	if err != nil {
-		return nil, err
-	}
-
-	done := make(chan struct{})
-	defer close(done)
-	go func() {
-		select {
-		case <-done:
-			return
-		case <-ctx.Done():
-			proxyConn.Close()
-		}
-	}()
-
+func (c *Client) dialNodeUsingProxy(ctx context.Context, n *tailcfg.DERPNode, proxyURL *url.URL) (net.Conn, error) {
 	target := net.JoinHostPort(n.HostName, "443")
-
-	var authHeader string
-	if v, err := tshttpproxy.GetAuthHeader(pu); err != nil {
-		c.logf("derphttp: error getting proxy auth header for %v: %v", proxyURL, err)
-	} else if v != "" {
-		authHeader = fmt.Sprintf("Proxy-Authorization: %s\r\n", v)
-	}
-
-	if _, err := fmt.Fprintf(proxyConn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n%s\r\n", target, target, authHeader); err != nil {
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-		return nil, err
-	}
-
-	br := bufio.NewReader(proxyConn)
-	res, err := http.ReadResponse(br, nil)
+	var d net.Dialer
+	conn, err := tshttpproxy.Connect(ctx, d.DialContext, proxyURL, target)
 	if err != nil {
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
 		c.logf("derphttp: CONNECT dial to %s: %v", target, err)
 		return nil, err
 	}
-	c.logf("derphttp: CONNECT dial to %s: %v", target, res.Status)
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("invalid response status from HTTP proxy %s on CONNECT to %s: %v", pu, target, res.Status)
-	}
-	return proxyConn, nil
+	c.logf("derphttp: CONNECT dial to %s: ok", target)
+	return conn, nil
 }
 
 func (c *Client) Send(dstKey key.NodePublic, b []byte) error {
@@ -65,6 +65,8 @@ func (v ShareView) As() string   { return v.ж.As }
 func (v ShareView) BookmarkData() views.ByteSlice[[]byte] {
 	return views.ByteSliceOf(v.ж.BookmarkData)
 }
+func (v ShareView) ReadOnly() bool { return v.ж.ReadOnly }
+func (v ShareView) MaxSize() int64 { return v.ж.MaxSize }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _ShareViewNeedsRegeneration = Share(struct {
@@ -72,4 +74,6 @@ func (v ShareView) BookmarkData() views.ByteSlice[[]byte] {
 	Path         string
 	As           string
 	BookmarkData []byte
+	ReadOnly     bool
+	MaxSize      int64
 }{})
@@ -133,6 +133,25 @@ func TestPermissions(t *testing.T) {
 	}
 }
 
+func TestShareLimits(t *testing.T) {
+	s := newSystem(t)
+
+	s.addRemote(remote1)
+	s.addShare(remote1, share11, drive.PermissionReadWrite)
+	s.addShare(remote1, share12, drive.PermissionReadWrite)
+
+	s.setShareLimits(remote1, share12, true, 0)
+	s.writeFile("writing file to read-only share should fail", remote1, share12, file111, "hello world", false)
+	s.write(remote1, share12, file111, "hello world")
+	s.checkFileContents(remote1, share12, file111)
+
+	s.setShareLimits(remote1, share11, false, 16)
+	s.writeFile("writing file within max size should succeed", remote1, share11, file111, "hello world", true)
+	s.writeFile("writing file beyond max size should fail", remote1, share11, file112, "hello world", false)
+	s.setShareLimits(remote1, share11, false, 0)
+	s.writeFile("writing file without max size should succeed", remote1, share11, file112, "hello world", true)
+}
+
 // TestSecretTokenAuth verifies that the fileserver running at localhost cannot
 // be accessed directly without the correct secret token. This matters because
 // if a victim can be induced to visit the localhost URL and access a malicious
@@ -373,6 +392,7 @@ type remote struct {
 	fileServer  *FileServer
 	shares      map[string]string
 	permissions map[string]drive.Permission
+	limits      map[string]drive.Share // ReadOnly and MaxSize by share name
 	mu          sync.RWMutex
 }
 
@@ -450,6 +470,7 @@ func (s *system) addRemote(name string) string {
 		fs:          NewFileSystemForRemote(log.Printf),
 		shares:      make(map[string]string),
 		permissions: make(map[string]drive.Permission),
+		limits:      make(map[string]drive.Share),
 	}
 	r.fs.SetFileServerAddr(fileServer.Addr())
 	go http.Serve(l, r)
@@ -482,12 +503,26 @@ func (s *system) addShare(remoteName, shareName string, permission drive.Permiss
 	f := s.t.TempDir()
 	r.shares[shareName] = f
 	r.permissions[shareName] = permission
+	r.setShares()
+}
+
+func (s *system) setShareLimits(remoteName, shareName string, readOnly bool, maxSize int64) {
+	r, ok := s.remotes[remoteName]
+	if !ok {
+		s.t.Fatalf("unknown remote %q", remoteName)
+	}
+	r.limits[shareName] = drive.Share{ReadOnly: readOnly, MaxSize: maxSize}
+	r.setShares()
+}
 
+func (r *remote) setShares() {
 	shares := make([]*drive.Share, 0, len(r.shares))
 	for shareName, folder := range r.shares {
 		shares = append(shares, &drive.Share{
-			Name: shareName,
-			Path: folder,
+			Name:     shareName,
+			Path:     folder,
+			ReadOnly: r.limits[shareName].ReadOnly,
+			MaxSize:  r.limits[shareName].MaxSize,
 		})
 	}
 	slices.SortFunc(shares, drive.CompareShares)
@@ -680,7 +715,7 @@ func pathTo(remote, share, name string) string {
 type noopAuthorizer struct{}
 
 func (a *noopAuthorizer) NewAuthenticator(body io.Reader) (gowebdav.Authenticator, io.Reader) {
-	return &noopAuthenticator{}, nil
+	return &noopAuthenticator{}, body
 }
 
 func (a *noopAuthorizer) AddAuthenticator(key string, fn gowebdav.AuthFactory) {
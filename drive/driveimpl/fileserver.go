@@ -10,6 +10,7 @@
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"sync"
 
 	"github.com/tailscale/xnet/webdav"
@@ -23,6 +24,7 @@ type FileServer struct {
 	l             net.Listener
 	secretToken   string
 	shareHandlers map[string]http.Handler
+	shareUsage    map[string]*shareUsage
 	sharesMu      sync.RWMutex
 }
 
@@ -58,6 +60,7 @@ func NewFileServer() (*FileServer, error) {
 		l:             l,
 		secretToken:   secretToken,
 		shareHandlers: make(map[string]http.Handler),
+		shareUsage:    make(map[string]*shareUsage),
 	}, nil
 }
 
@@ -96,6 +99,7 @@ func (s *FileServer) UnlockShares() {
 // been called first.
 func (s *FileServer) ClearSharesLocked() {
 	s.shareHandlers = make(map[string]http.Handler)
+	s.shareUsage = make(map[string]*shareUsage)
 }
 
 // AddShareLocked adds a share to the map of shares, assuming that LockShares()
@@ -105,6 +109,7 @@ func (s *FileServer) AddShareLocked(share, path string) {
 		FileSystem: &birthTimingFS{webdav.Dir(path)},
 		LockSystem: webdav.NewMemLS(),
 	}
+	s.shareUsage[share] = &shareUsage{root: path}
 }
 
 // SetShares sets the full map of shares to the new value, mapping name->path.
@@ -146,6 +151,7 @@ func (s *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	share := parts[1]
 	s.sharesMu.RLock()
 	h, found := s.shareHandlers[share]
+	usage := s.shareUsage[share]
 	s.sharesMu.RUnlock()
 	if !found {
 		w.WriteHeader(http.StatusNotFound)
@@ -154,7 +160,21 @@ func (s *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// WebDAV's locking code compares the lock resources with the request's
 	// host header, set this to empty to avoid mismatches.
 	r.Host = ""
+
+	maxSize, _ := strconv.ParseInt(r.Header.Get(maxSizeHeader), 10, 64)
+	if maxSize <= 0 || !quotaMethods[r.Method] {
+		h.ServeHTTP(w, r)
+		return
+	}
+	remaining := maxSize - usage.used()
+	if remaining <= 0 || r.ContentLength > remaining {
+		http.Error(w, "share is full", http.StatusInsufficientStorage)
+		return
+	}
+	body := &quotaReader{r: r.Body, remaining: remaining}
+	r.Body = body
 	h.ServeHTTP(w, r)
+	usage.add(body.n)
 }
 
 func (s *FileServer) Close() error {
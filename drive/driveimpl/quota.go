@@ -0,0 +1,93 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package driveimpl
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxSizeHeader is the request header with which FileSystemForRemote tells
+// the FileServer about the drive.Share.MaxSize of the share being accessed.
+// FileSystemForRemote removes it from the requests of remote nodes.
+const maxSizeHeader = "X-Taildrive-Max-Size"
+
+// quotaMethods are the methods that a FileServer refuses when a share is
+// full.
+var quotaMethods = map[string]bool{
+	"PUT":   true,
+	"COPY":  true,
+	"MKCOL": true,
+}
+
+// shareUsageTTL is how long a FileServer trusts its count of the bytes used
+// by a share before counting them again, to pick up changes made other than
+// through Taildrive.
+const shareUsageTTL = time.Minute
+
+// shareUsage tracks how many bytes the files in a share use.
+type shareUsage struct {
+	root string
+
+	mu      sync.Mutex
+	n       int64
+	counted time.Time // when n was last counted, or zero if never
+}
+
+// used returns the number of bytes used by the files under u.root, counting
+// them if they haven't been counted in the last shareUsageTTL.
+func (u *shareUsage) used() int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.counted.IsZero() && time.Since(u.counted) < shareUsageTTL {
+		return u.n
+	}
+	var n int64
+	filepath.WalkDir(u.root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil // skip what we can't read, and don't follow symlinks
+		}
+		if fi, err := d.Info(); err == nil {
+			n += fi.Size()
+		}
+		return nil
+	})
+	u.n = n
+	u.counted = time.Now()
+	return n
+}
+
+// add records that n more bytes were written to the share.
+func (u *shareUsage) add(n int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.n += n
+}
+
+var errShareFull = errors.New("share is full")
+
+// quotaReader is a request body that fails once more than remaining bytes
+// have been read from it.
+type quotaReader struct {
+	r         io.ReadCloser
+	remaining int64
+	n         int64 // bytes read so far
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.n += int64(n)
+	if q.n > q.remaining {
+		return n, errShareFull
+	}
+	return n, err
+}
+
+func (q *quotaReader) Close() error {
+	return q.r.Close()
+}
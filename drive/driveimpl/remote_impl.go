@@ -18,6 +18,7 @@
 	"os/exec"
 	"os/user"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -116,18 +117,12 @@ func (s *FileSystemForRemote) SetShares(shares []*drive.Share) {
 func (s *FileSystemForRemote) buildChild(share *drive.Share) *compositedav.Child {
 	getTokenAndAddr := func(shareName string) (string, string, error) {
 		s.mu.RLock()
-		var share *drive.Share
-		i, shareFound := slices.BinarySearchFunc(s.shares, shareName, func(s *drive.Share, name string) int {
-			return strings.Compare(s.Name, name)
-		})
-		if shareFound {
-			share = s.shares[i]
-		}
+		share := s.shareLocked(shareName)
 		userServers := s.userServers
 		fileServerTokenAndAddr := s.fileServerTokenAndAddr
 		s.mu.RUnlock()
 
-		if !shareFound {
+		if share == nil {
 			return "", "", fmt.Errorf("unknown share %v", shareName)
 		}
 
@@ -200,10 +195,21 @@ func (s *FileSystemForRemote) buildChild(share *drive.Share) *compositedav.Child
 
 // ServeHTTPWithPerms implements drive.FileSystemForRemote.
 func (s *FileSystemForRemote) ServeHTTPWithPerms(permissions drive.Permissions, w http.ResponseWriter, r *http.Request) {
+	shareName := shared.CleanAndSplit(r.URL.Path)[0]
+	s.mu.RLock()
+	childrenMap := s.children
+	share := s.shareLocked(shareName)
+	s.mu.RUnlock()
+
+	// Only we get to tell the file server how big the share may get.
+	r.Header.Del(maxSizeHeader)
+	if share != nil && share.MaxSize > 0 {
+		r.Header.Set(maxSizeHeader, strconv.FormatInt(share.MaxSize, 10))
+	}
+
 	isWrite := writeMethods[r.Method]
 	if isWrite {
-		share := shared.CleanAndSplit(r.URL.Path)[0]
-		switch permissions.For(share) {
+		switch permissions.For(shareName) {
 		case drive.PermissionNone:
 			// If we have no permissions to this share, treat it as not found
 			// to avoid leaking any information about the share's existence.
@@ -213,12 +219,12 @@ func (s *FileSystemForRemote) ServeHTTPWithPerms(permissions drive.Permissions,
 			http.Error(w, "permission denied", http.StatusForbidden)
 			return
 		}
+		if share != nil && share.ReadOnly {
+			http.Error(w, "share is read-only", http.StatusForbidden)
+			return
+		}
 	}
 
-	s.mu.RLock()
-	childrenMap := s.children
-	s.mu.RUnlock()
-
 	children := make([]*compositedav.Child, 0, len(childrenMap))
 	// filter out shares to which the connecting principal has no access
 	for name, child := range childrenMap {
@@ -236,6 +242,18 @@ func (s *FileSystemForRemote) ServeHTTPWithPerms(permissions drive.Permissions,
 	h.ServeHTTP(w, r)
 }
 
+// shareLocked returns the share with the given name, or nil if there is none.
+// s.mu must be held.
+func (s *FileSystemForRemote) shareLocked(name string) *drive.Share {
+	i, found := slices.BinarySearchFunc(s.shares, name, func(s *drive.Share, name string) int {
+		return strings.Compare(s.Name, name)
+	})
+	if !found {
+		return nil
+	}
+	return s.shares[i]
+}
+
 func (s *FileSystemForRemote) stopUserServers(userServers map[string]*userServer) {
 	for _, server := range userServers {
 		if err := server.Close(); err != nil {
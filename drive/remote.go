@@ -51,6 +51,15 @@ type Share struct {
 	// hold on to a security-scoped bookmark. That bookmark is stored here. See
 	// https://developer.apple.com/documentation/security/app_sandbox/accessing_files_from_the_macos_app_sandbox#4144043
 	BookmarkData []byte `json:"bookmarkData,omitempty"`
+
+	// ReadOnly, if true, prevents remote nodes from modifying the share,
+	// regardless of the access granted to them by ACLs.
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// MaxSize, if positive, is the maximum total size in bytes of the files
+	// in the share. Uploads that would take the share over MaxSize are
+	// rejected.
+	MaxSize int64 `json:"maxSize,omitempty"`
 }
 
 func ShareViewsEqual(a, b ShareView) bool {
@@ -60,7 +69,8 @@ func ShareViewsEqual(a, b ShareView) bool {
 	if !a.Valid() || !b.Valid() {
 		return false
 	}
-	return a.Name() == b.Name() && a.Path() == b.Path() && a.As() == b.As() && a.BookmarkData().Equal(b.ж.BookmarkData)
+	return a.Name() == b.Name() && a.Path() == b.Path() && a.As() == b.As() && a.BookmarkData().Equal(b.ж.BookmarkData) &&
+		a.ReadOnly() == b.ReadOnly() && a.MaxSize() == b.MaxSize()
 }
 
 func SharesEqual(a, b *Share) bool {
@@ -70,7 +80,8 @@ func SharesEqual(a, b *Share) bool {
 	if a == nil || b == nil {
 		return false
 	}
-	return a.Name == b.Name && a.Path == b.Path && a.As == b.As && bytes.Equal(a.BookmarkData, b.BookmarkData)
+	return a.Name == b.Name && a.Path == b.Path && a.As == b.As && bytes.Equal(a.BookmarkData, b.BookmarkData) &&
+		a.ReadOnly == b.ReadOnly && a.MaxSize == b.MaxSize
 }
 
 func CompareShares(a, b *Share) int {
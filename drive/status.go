@@ -0,0 +1,47 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package drive
+
+import "time"
+
+// AccessEvent is an audit record of a remote node accessing a share.
+type AccessEvent struct {
+	Time   time.Time
+	Share  string
+	Path   string // of the file or directory within the share, such as "/docs/a.txt"
+	Method string // the WebDAV method, such as "GET" or "PUT"
+	Status int    // HTTP status code of the response
+
+	Node string // name of the remote node
+	User string // login name of the user who owns the remote node, or its tags
+
+	BytesSent     int64 `json:",omitempty"` // to the remote node
+	BytesReceived int64 `json:",omitempty"` // from the remote node
+}
+
+// ShareStatus is the status of a share, as reported by [Status].
+type ShareStatus struct {
+	Share *Share
+
+	// Accesses is the number of audited accesses to the share since
+	// tailscaled started, and LastAccess is the time of the latest one.
+	Accesses   int64
+	LastAccess time.Time `json:",omitempty"`
+
+	BytesSent     int64 // to remote nodes
+	BytesReceived int64 // from remote nodes
+}
+
+// Status is the status of sharing files with Taildrive, as reported by
+// "tailscale drive status".
+type Status struct {
+	Shares []*ShareStatus // sorted by name
+
+	// RecentAccesses are the latest accesses to shares, oldest first.
+	RecentAccesses []AccessEvent
+
+	// AuditLogPath is the path of the file to which accesses are logged, or
+	// empty if they're only kept in memory.
+	AuditLogPath string `json:",omitempty"`
+}
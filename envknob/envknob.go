@@ -447,6 +447,17 @@ func SetNoLogsNoSupport() {
 	Setenv("TS_NO_LOGS_NO_SUPPORT", "true")
 }
 
+// LocalLogs reports whether logs should also be kept in a local on-disk
+// ring buffer, regardless of whether log uploads are enabled.
+func LocalLogs() bool {
+	return Bool("TS_LOCAL_LOGS")
+}
+
+// SetLocalLogs enables keeping logs in a local on-disk ring buffer.
+func SetLocalLogs() {
+	Setenv("TS_LOCAL_LOGS", "true")
+}
+
 // notInInit is set true the first time we've seen a non-init stack trace.
 var notInInit atomic.Bool
 
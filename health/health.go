@@ -113,6 +113,8 @@ type Tracker struct {
 	localLogConfigErr       error
 	tlsConnectionErrors     map[string]error // map[ServerName]error
 	metricHealthMessage     *metrics.MultiLabelMap[metricHealthMessageLabel]
+	metricProbeHealthy      *metrics.MultiLabelMap[metricProbeLabel]
+	probes                  map[string]*Probe // by ProbeConfig.Name
 }
 
 // Subsystem is the name of a subsystem whose health can be monitored.
@@ -138,10 +140,17 @@ type Tracker struct {
 var subsystemsWarnables = map[Subsystem]*Warnable{}
 
 func init() {
+	components := map[Subsystem]Component{
+		SysRouter:     ComponentRouter,
+		SysDNS:        ComponentDNS,
+		SysDNSManager: ComponentDNS,
+		SysTKA:        ComponentTailnetLock,
+	}
 	for _, s := range []Subsystem{SysRouter, SysDNS, SysDNSManager, SysTKA} {
 		w := Register(&Warnable{
-			Code:     WarnableCode(s),
-			Severity: SeverityMedium,
+			Code:      WarnableCode(s),
+			Severity:  SeverityMedium,
+			Component: components[s],
 			Text: func(args Args) string {
 				return args[legacyErrorArgKey]
 			},
@@ -234,6 +243,37 @@ type Warnable struct {
 	// should be surfaced as unhealthy to the user. This is used to prevent transient errors from being
 	// displayed to the user.
 	TimeToVisible time.Duration
+
+	// Component is the part of Tailscale that this Warnable is about. Monitoring can use it to
+	// group and route alerts. Empty means ComponentBackend.
+	Component Component
+
+	// RemediationURL, if non-empty, is a URL documenting how to resolve this Warnable's unhealthy
+	// state, which GUIs can link to.
+	RemediationURL string
+}
+
+// Component is the part of Tailscale that a Warnable is about.
+type Component string
+
+const (
+	ComponentBackend     Component = "backend"      // tailscaled itself and its local configuration
+	ComponentControl     Component = "control"      // the coordination server and logging in to it
+	ComponentDERP        Component = "derp"         // DERP relay servers
+	ComponentNetwork     Component = "network"      // the local network and NAT traversal
+	ComponentDNS         Component = "dns"          // DNS configuration and forwarding
+	ComponentRouter      Component = "router"       // routes, the firewall and exit nodes
+	ComponentUpdate      Component = "update"       // client updates
+	ComponentTailnetLock Component = "tailnet-lock" // tailnet lock
+	ComponentSSH         Component = "ssh"          // Tailscale SSH
+)
+
+// component returns w's Component, defaulting to ComponentBackend.
+func (w *Warnable) component() Component {
+	if w.Component == "" {
+		return ComponentBackend
+	}
+	return w.Component
 }
 
 // StaticMessage returns a function that always returns the input string, to be used in
@@ -341,6 +381,10 @@ func (t *Tracker) SetMetricsRegistry(reg *usermetric.Registry) {
 		t.updateBuiltinWarnablesLocked()
 		return int64(len(t.stringsLocked()))
 	}))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.registerProbeMetricsLocked(reg)
 }
 
 // SetUnhealthy sets a warningState for the given Warnable with the provided Args, and should be
@@ -4,6 +4,7 @@
 package health
 
 import (
+	"cmp"
 	"fmt"
 	"reflect"
 	"slices"
@@ -266,6 +267,63 @@ func TestCheckDependsOnAppearsInUnhealthyState(t *testing.T) {
 	}
 }
 
+func TestComponentAndRemediationInUnhealthyState(t *testing.T) {
+	ht := Tracker{}
+	w1 := Register(&Warnable{
+		Code:           "w1",
+		Severity:       SeverityLow,
+		Text:           StaticMessage("W1 Text"),
+		Component:      ComponentDNS,
+		RemediationURL: "https://tailscale.com/kb/1054/dns",
+	})
+	defer unregister(w1)
+	w2 := Register(&Warnable{
+		Code:     "w2",
+		Severity: SeverityHigh,
+		Text:     StaticMessage("W2 Text"),
+	})
+	defer unregister(w2)
+
+	ht.SetUnhealthy(w1, Args{})
+	ht.SetUnhealthy(w2, Args{})
+	ws := ht.CurrentState().SortedWarnings()
+	var got []WarnableCode
+	for _, w := range ws {
+		got = append(got, w.WarnableCode)
+	}
+	if want := []WarnableCode{"w2", "w1"}; !slices.Equal(got, want) {
+		t.Fatalf("SortedWarnings codes = %v; want %v", got, want)
+	}
+	if ws[0].Component != ComponentBackend || ws[0].RemediationURL != "" {
+		t.Errorf("w2: Component = %q, RemediationURL = %q; want %q, empty", ws[0].Component, ws[0].RemediationURL, ComponentBackend)
+	}
+	if ws[1].Component != ComponentDNS || ws[1].RemediationURL != w1.RemediationURL {
+		t.Errorf("w1: Component = %q, RemediationURL = %q; want %q, %q", ws[1].Component, ws[1].RemediationURL, ComponentDNS, w1.RemediationURL)
+	}
+}
+
+func TestWarnables(t *testing.T) {
+	ws := Warnables()
+	if !slices.IsSortedFunc(ws, func(a, b WarnableInfo) int { return cmp.Compare(a.Code, b.Code) }) {
+		t.Error("Warnables not sorted by code")
+	}
+	var found bool
+	for _, w := range ws {
+		if w.Component == "" {
+			t.Errorf("Warnable %q has no Component", w.Code)
+		}
+		if w.Code == updateAvailableWarnable.Code {
+			found = true
+			if w.Component != ComponentUpdate {
+				t.Errorf("Warnable %q has Component %q; want %q", w.Code, w.Component, ComponentUpdate)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Warnables missing %q", updateAvailableWarnable.Code)
+	}
+}
+
 func TestShowUpdateWarnable(t *testing.T) {
 	tests := []struct {
 		desc         string
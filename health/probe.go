@@ -0,0 +1,315 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package health
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/util/mak"
+	"tailscale.com/util/usermetric"
+)
+
+// Default values for ProbeConfig fields.
+const (
+	DefaultProbeInterval = 30 * time.Second
+	DefaultProbeTimeout  = 10 * time.Second
+)
+
+// ArgProbeName provides a probe Warnable with the user-defined name of the
+// probe that failed.
+const ArgProbeName Arg = "probe-name"
+
+// ProbeConfig configures a local health probe. A probe is a user-defined
+// check that the Tracker runs periodically; while it fails, a Warnable is
+// reported unhealthy, so e.g. a subnet router can report that its upstream
+// link is degraded.
+//
+// Exactly one of Exec or URL must be set.
+type ProbeConfig struct {
+	// Name uniquely identifies the probe. It's used in the probe's
+	// WarnableCode ("probe-" + Name) and in metric labels.
+	Name string
+
+	// Exec, if non-empty, is a command and its arguments. The probe is
+	// healthy if the command exits with status zero.
+	Exec []string
+
+	// URL, if non-empty, is an HTTP(S) URL that is fetched with GET. The
+	// probe is healthy if the response has a 2xx status code.
+	URL string
+
+	// Interval is how often the probe runs.
+	// If zero, DefaultProbeInterval is used.
+	Interval time.Duration
+
+	// Timeout is how long a single run of the probe may take before it's
+	// considered failed. If zero, DefaultProbeTimeout is used.
+	Timeout time.Duration
+
+	// Severity is the severity of the probe's Warnable.
+	// If empty, SeverityMedium is used.
+	Severity Severity
+}
+
+// ParseProbeSpec parses a probe from its command-line form, which is
+// "NAME=URL" for HTTP probes or "NAME=exec:COMMAND [ARGS...]" for command
+// probes. Arguments are separated by whitespace.
+func ParseProbeSpec(spec string) (ProbeConfig, error) {
+	name, target, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || target == "" {
+		return ProbeConfig{}, fmt.Errorf("invalid health probe %q; want NAME=URL or NAME=exec:COMMAND", spec)
+	}
+	cfg := ProbeConfig{Name: name}
+	if cmd, ok := strings.CutPrefix(target, "exec:"); ok {
+		cfg.Exec = strings.Fields(cmd)
+	} else {
+		cfg.URL = target
+	}
+	return cfg, cfg.check()
+}
+
+func (c *ProbeConfig) check() error {
+	if c.Name == "" {
+		return errors.New("health probe has no name")
+	}
+	if strings.ContainsAny(c.Name, " \t\n\"") {
+		return fmt.Errorf("invalid health probe name %q", c.Name)
+	}
+	switch {
+	case len(c.Exec) > 0 && c.URL != "":
+		return fmt.Errorf("health probe %q: only one of Exec and URL may be set", c.Name)
+	case len(c.Exec) == 0 && c.URL == "":
+		return fmt.Errorf("health probe %q: one of Exec or URL must be set", c.Name)
+	case c.URL != "" && !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://"):
+		return fmt.Errorf("health probe %q: URL %q is not http or https", c.Name, c.URL)
+	}
+	return nil
+}
+
+// Probe is a running local health probe. It's created by Tracker.AddProbe.
+type Probe struct {
+	t   *Tracker
+	cfg ProbeConfig
+	w   *Warnable
+
+	ctx    context.Context // canceled by Close
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the run loop exits
+
+	mu      sync.Mutex
+	ran     bool // whether the probe has completed at least one run
+	healthy bool
+}
+
+type metricProbeLabel struct {
+	Probe string
+}
+
+// AddProbe starts running the local health probe described by cfg. The
+// probe's failures are reported as an unhealthy Warnable on t until the
+// probe next succeeds or is closed.
+//
+// It returns an error if cfg is invalid or a probe of the same name has
+// already been added.
+func (t *Tracker) AddProbe(cfg ProbeConfig) (*Probe, error) {
+	if t.nil() {
+		return nil, errors.New("health: nil Tracker")
+	}
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultProbeInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultProbeTimeout
+	}
+	if cfg.Severity == "" {
+		cfg.Severity = SeverityMedium
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Probe{
+		t:   t,
+		cfg: cfg,
+		w: &Warnable{
+			Code:     WarnableCode("probe-" + cfg.Name),
+			Title:    "Health probe failing",
+			Severity: cfg.Severity,
+			Text: func(args Args) string {
+				return fmt.Sprintf("Health probe %q is failing: %v", args[ArgProbeName], args[ArgError])
+			},
+		},
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	t.mu.Lock()
+	if _, dup := t.probes[cfg.Name]; dup {
+		t.mu.Unlock()
+		cancel()
+		return nil, fmt.Errorf("health probe %q already exists", cfg.Name)
+	}
+	mak.Set(&t.probes, cfg.Name, p)
+	t.setProbeMetricLocked(p)
+	t.mu.Unlock()
+
+	go p.loop()
+	return p, nil
+}
+
+// Probes returns the names of the probes currently added to t.
+func (t *Tracker) Probes() []string {
+	if t.nil() {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var names []string
+	for name := range t.probes {
+		names = append(names, name)
+	}
+	return names
+}
+
+// setProbeMetricLocked exports p's state to the probe gauge, if
+// t's metrics registry has been set.
+// t.mu must be held.
+func (t *Tracker) setProbeMetricLocked(p *Probe) {
+	if t.metricProbeHealthy == nil {
+		return
+	}
+	t.metricProbeHealthy.Set(metricProbeLabel{Probe: p.cfg.Name}, expvar.Func(func() any {
+		if p.Healthy() {
+			return int64(1)
+		}
+		return int64(0)
+	}))
+}
+
+// registerProbeMetricsLocked creates the probe gauge in reg and exports any
+// probes that were added before the metrics registry was set.
+// t.mu must be held.
+func (t *Tracker) registerProbeMetricsLocked(reg *usermetric.Registry) {
+	t.metricProbeHealthy = usermetric.NewMultiLabelMapWithRegistry[metricProbeLabel](
+		reg,
+		"tailscaled_health_probe_healthy",
+		"gauge",
+		"Whether each local health probe is passing (1) or failing (0).",
+	)
+	for _, p := range t.probes {
+		t.setProbeMetricLocked(p)
+	}
+}
+
+// Name returns the probe's name.
+func (p *Probe) Name() string { return p.cfg.Name }
+
+// Warnable returns the Warnable that's unhealthy while the probe is failing.
+func (p *Probe) Warnable() *Warnable { return p.w }
+
+// Healthy reports whether the most recent run of the probe succeeded.
+// It reports false if the probe hasn't completed a run yet.
+func (p *Probe) Healthy() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ran && p.healthy
+}
+
+// Close stops the probe and clears its Warnable.
+func (p *Probe) Close() {
+	p.cancel()
+	<-p.done
+
+	t := p.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.probes[p.cfg.Name] == p {
+		delete(t.probes, p.cfg.Name)
+		if t.metricProbeHealthy != nil {
+			t.metricProbeHealthy.Delete(metricProbeLabel{Probe: p.cfg.Name})
+		}
+	}
+	t.setHealthyLocked(p.w)
+}
+
+func (p *Probe) loop() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		p.runOnce()
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce runs the probe and updates its Warnable accordingly.
+func (p *Probe) runOnce() {
+	ctx, cancel := context.WithTimeout(p.ctx, p.cfg.Timeout)
+	defer cancel()
+
+	err := p.run(ctx)
+	if p.ctx.Err() != nil {
+		// Closed while running; don't report the resulting error.
+		return
+	}
+	p.mu.Lock()
+	p.ran = true
+	p.healthy = err == nil
+	p.mu.Unlock()
+
+	if err != nil {
+		p.t.SetUnhealthy(p.w, Args{
+			ArgProbeName: p.cfg.Name,
+			ArgError:     err.Error(),
+		})
+	} else {
+		p.t.SetHealthy(p.w)
+	}
+}
+
+func (p *Probe) run(ctx context.Context) error {
+	if len(p.cfg.Exec) > 0 {
+		cmd := exec.CommandContext(ctx, p.cfg.Exec[0], p.cfg.Exec[1:]...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			if out = bytes.TrimSpace(out); len(out) > 0 {
+				const maxOut = 200
+				if len(out) > maxOut {
+					out = out[:maxOut]
+				}
+				return fmt.Errorf("%w: %s", err, out)
+			}
+			return err
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.cfg.URL, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected HTTP status %v", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tailscale.com/util/usermetric"
+)
+
+func TestParseProbeSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    ProbeConfig
+		wantErr string
+	}{
+		{
+			spec: "upstream=http://10.0.0.1/healthz",
+			want: ProbeConfig{Name: "upstream", URL: "http://10.0.0.1/healthz"},
+		},
+		{
+			spec: "disk=exec:/usr/local/bin/check-disk --min 10G",
+			want: ProbeConfig{Name: "disk", Exec: []string{"/usr/local/bin/check-disk", "--min", "10G"}},
+		},
+		{spec: "noequals", wantErr: "invalid health probe"},
+		{spec: "=http://foo", wantErr: "invalid health probe"},
+		{spec: "empty=exec:", wantErr: "one of Exec or URL must be set"},
+		{spec: "ftp=ftp://foo", wantErr: "is not http or https"},
+	}
+	for _, tt := range tests {
+		got, err := ParseProbeSpec(tt.spec)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseProbeSpec(%q) error = %v; want %q", tt.spec, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseProbeSpec(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseProbeSpec(%q) = %+v; want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	var failing atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "upstream down", http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	ht := new(Tracker)
+	ht.SetMetricsRegistry(new(usermetric.Registry))
+	p, err := ht.AddProbe(ProbeConfig{
+		Name:     "upstream",
+		URL:      ts.URL,
+		Interval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ht.AddProbe(ProbeConfig{Name: "upstream", URL: ts.URL}); err == nil {
+		t.Errorf("AddProbe with duplicate name succeeded; want error")
+	}
+
+	waitFor := func(healthy bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			_, unhealthy := ht.CurrentState().Warnings[p.Warnable().Code]
+			if p.Healthy() == healthy && unhealthy == !healthy {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("timeout waiting for probe healthy=%v", healthy)
+	}
+	metric := func() string {
+		return ht.metricProbeHealthy.Get(metricProbeLabel{Probe: "upstream"}).String()
+	}
+
+	waitFor(true)
+	if got := metric(); got != "1" {
+		t.Errorf("metric = %v; want 1", got)
+	}
+
+	failing.Store(true)
+	waitFor(false)
+	if got := metric(); got != "0" {
+		t.Errorf("metric = %v; want 0", got)
+	}
+	if got := strings.Join(ht.Strings(), "\n"); !strings.Contains(got, `Health probe "upstream" is failing: unexpected HTTP status 503`) {
+		t.Errorf("Strings() = %q; want probe failure", got)
+	}
+
+	p.Close()
+	if _, ok := ht.CurrentState().Warnings[p.Warnable().Code]; ok {
+		t.Errorf("probe Warnable still unhealthy after Close")
+	}
+	if got := ht.Probes(); len(got) != 0 {
+		t.Errorf("Probes() after Close = %q; want none", got)
+	}
+}
@@ -4,6 +4,9 @@
 package health
 
 import (
+	"cmp"
+	"maps"
+	"slices"
 	"time"
 )
 
@@ -31,6 +34,8 @@ type UnhealthyState struct {
 	Args                Args           `json:",omitempty"`
 	DependsOn           []WarnableCode `json:",omitempty"`
 	ImpactsConnectivity bool           `json:",omitempty"`
+	Component           Component      `json:",omitempty"`
+	RemediationURL      string         `json:",omitempty"`
 }
 
 // unhealthyState returns a unhealthyState of the Warnable given its current warningState.
@@ -63,9 +68,69 @@ func (w *Warnable) unhealthyState(ws *warningState) *UnhealthyState {
 		Args:                ws.Args,
 		DependsOn:           dependsOnWarnableCodes,
 		ImpactsConnectivity: w.ImpactsConnectivity,
+		Component:           w.component(),
+		RemediationURL:      w.RemediationURL,
 	}
 }
 
+// WarnableInfo describes a registered Warnable, for clients to know the
+// warnings that the backend can report before any of them occurs.
+type WarnableInfo struct {
+	Code                WarnableCode
+	Severity            Severity
+	Title               string
+	Component           Component
+	RemediationURL      string         `json:",omitempty"`
+	DependsOn           []WarnableCode `json:",omitempty"`
+	ImpactsConnectivity bool           `json:",omitempty"`
+}
+
+// Warnables returns the registered Warnables, sorted by code.
+func Warnables() []WarnableInfo {
+	var ws []WarnableInfo
+	for _, w := range registeredWarnables {
+		wi := WarnableInfo{
+			Code:                w.Code,
+			Severity:            w.Severity,
+			Title:               w.Title,
+			Component:           w.component(),
+			RemediationURL:      w.RemediationURL,
+			ImpactsConnectivity: w.ImpactsConnectivity,
+		}
+		for _, d := range w.DependsOn {
+			wi.DependsOn = append(wi.DependsOn, d.Code)
+		}
+		ws = append(ws, wi)
+	}
+	slices.SortFunc(ws, func(a, b WarnableInfo) int { return cmp.Compare(a.Code, b.Code) })
+	return ws
+}
+
+// SortedWarnings returns the unhealthy states of s, most severe first and
+// then by code.
+func (s *State) SortedWarnings() []UnhealthyState {
+	ws := slices.Collect(maps.Values(s.Warnings))
+	slices.SortFunc(ws, func(a, b UnhealthyState) int {
+		return cmp.Or(
+			cmp.Compare(severityRank(b.Severity), severityRank(a.Severity)),
+			cmp.Compare(a.WarnableCode, b.WarnableCode),
+		)
+	})
+	return ws
+}
+
+func severityRank(s Severity) int {
+	switch s {
+	case SeverityHigh:
+		return 3
+	case SeverityMedium:
+		return 2
+	case SeverityLow:
+		return 1
+	}
+	return 0
+}
+
 // CurrentState returns a snapshot of the current health status of the backend.
 // It returns a State with nil Warnings if the backend is healthy (all Warnables
 // have no issues).
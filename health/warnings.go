@@ -27,6 +27,8 @@
 			return fmt.Sprintf("An update from version %s to %s is available. Run `tailscale update` or `tailscale set --auto-update` to update now.", args[ArgCurrentVersion], args[ArgAvailableVersion])
 		}
 	},
+	Component:      ComponentUpdate,
+	RemediationURL: "https://tailscale.com/s/client-updates",
 })
 
 // securityUpdateAvailableWarnable is a Warnable that warns the user that an important security update is available.
@@ -41,15 +43,18 @@
 			return fmt.Sprintf("A security update from version %s to %s is available. Run `tailscale update` or `tailscale set --auto-update` to update now.", args[ArgCurrentVersion], args[ArgAvailableVersion])
 		}
 	},
+	Component:      ComponentUpdate,
+	RemediationURL: "https://tailscale.com/s/client-updates",
 })
 
 // unstableWarnable is a Warnable that warns the user that they are using an unstable version of Tailscale
 // so they won't be surprised by all the issues that may arise.
 var unstableWarnable = Register(&Warnable{
-	Code:     "is-using-unstable-version",
-	Title:    "Using an unstable version",
-	Severity: SeverityLow,
-	Text:     StaticMessage("This is an unstable version of Tailscale meant for testing and development purposes. Please report any issues to Tailscale."),
+	Code:      "is-using-unstable-version",
+	Title:     "Using an unstable version",
+	Severity:  SeverityLow,
+	Text:      StaticMessage("This is an unstable version of Tailscale meant for testing and development purposes. Please report any issues to Tailscale."),
+	Component: ComponentUpdate,
 })
 
 // NetworkStatusWarnable is a Warnable that warns the user that the network is down.
@@ -60,14 +65,16 @@
 	Text:                StaticMessage("Tailscale cannot connect because the network is down. Check your Internet connection."),
 	ImpactsConnectivity: true,
 	TimeToVisible:       5 * time.Second,
+	Component:           ComponentNetwork,
 })
 
 // IPNStateWarnable is a Warnable that warns the user that Tailscale is stopped.
 var IPNStateWarnable = Register(&Warnable{
-	Code:     "wantrunning-false",
-	Title:    "Tailscale off",
-	Severity: SeverityLow,
-	Text:     StaticMessage("Tailscale is stopped."),
+	Code:      "wantrunning-false",
+	Title:     "Tailscale off",
+	Severity:  SeverityLow,
+	Text:      StaticMessage("Tailscale is stopped."),
+	Component: ComponentBackend,
 })
 
 // localLogWarnable is a Warnable that warns the user that the local log is misconfigured.
@@ -78,6 +85,7 @@
 	Text: func(args Args) string {
 		return fmt.Sprintf("The local log is misconfigured: %v", args[ArgError])
 	},
+	Component: ComponentBackend,
 })
 
 // LoginStateWarnable is a Warnable that warns the user that they are logged out,
@@ -94,6 +102,7 @@
 		}
 	},
 	DependsOn: []*Warnable{IPNStateWarnable},
+	Component: ComponentControl,
 })
 
 // notInMapPollWarnable is a Warnable that warns the user that we are using a stale network map.
@@ -105,6 +114,7 @@
 	Text:      StaticMessage("Unable to connect to the Tailscale coordination server to synchronize the state of your tailnet. Peer reachability might degrade over time."),
 	// 8 minutes reflects a maximum maintenance window for the coordination server.
 	TimeToVisible: 8 * time.Minute,
+	Component:     ComponentControl,
 })
 
 // noDERPHomeWarnable is a Warnable that warns the user that Tailscale doesn't have a home DERP.
@@ -116,6 +126,8 @@
 	Text:                StaticMessage("Tailscale could not connect to any relay server. Check your Internet connection."),
 	ImpactsConnectivity: true,
 	TimeToVisible:       10 * time.Second,
+	Component:           ComponentDERP,
+	RemediationURL:      "https://tailscale.com/kb/1232/derp-servers",
 })
 
 // noDERPConnectionWarnable is a Warnable that warns the user that Tailscale couldn't connect to a specific DERP server.
@@ -143,6 +155,8 @@
 	},
 	ImpactsConnectivity: true,
 	TimeToVisible:       10 * time.Second,
+	Component:           ComponentDERP,
+	RemediationURL:      "https://tailscale.com/kb/1232/derp-servers",
 })
 
 // derpTimeoutWarnable is a Warnable that warns the user that Tailscale hasn't
@@ -163,6 +177,8 @@
 			return fmt.Sprintf("Tailscale hasn't heard from the home relay server (region ID '%v') in %v. The server might be temporarily unavailable, or your Internet connection might be down.", args[ArgDERPRegionID], args[ArgDuration])
 		}
 	},
+	Component:      ComponentDERP,
+	RemediationURL: "https://tailscale.com/kb/1232/derp-servers",
 })
 
 // derpRegionErrorWarnable is a Warnable that warns the user that a DERP region is reporting an issue.
@@ -174,6 +190,7 @@
 	Text: func(args Args) string {
 		return fmt.Sprintf("The relay server #%v is reporting an issue: %v", args[ArgDERPRegionID], args[ArgError])
 	},
+	Component: ComponentDERP,
 })
 
 // noUDP4BindWarnable is a Warnable that warns the user that Tailscale couldn't listen for incoming UDP connections.
@@ -184,6 +201,7 @@
 	DependsOn:           []*Warnable{NetworkStatusWarnable, IPNStateWarnable},
 	Text:                StaticMessage("Tailscale couldn't listen for incoming UDP connections."),
 	ImpactsConnectivity: true,
+	Component:           ComponentNetwork,
 })
 
 // mapResponseTimeoutWarnable is a Warnable that warns the user that Tailscale hasn't received a network map from the coordination server in a while.
@@ -195,6 +213,7 @@
 	Text: func(args Args) string {
 		return fmt.Sprintf("Tailscale hasn't received a network map from the coordination server in %s.", args[ArgDuration])
 	},
+	Component: ComponentControl,
 })
 
 // tlsConnectionFailedWarnable is a Warnable that warns the user that Tailscale could not establish an encrypted connection with a server.
@@ -206,6 +225,7 @@
 	Text: func(args Args) string {
 		return fmt.Sprintf("Tailscale could not establish an encrypted connection with '%q': %v", args[ArgServerName], args[ArgError])
 	},
+	Component: ComponentNetwork,
 })
 
 // magicsockReceiveFuncWarnable is a Warnable that warns the user that one of the Magicsock functions is not running.
@@ -216,6 +236,7 @@
 	Text: func(args Args) string {
 		return fmt.Sprintf("The MagicSock function %s is not running. You might experience connectivity issues.", args[ArgMagicsockFunctionName])
 	},
+	Component: ComponentNetwork,
 })
 
 // testWarnable is a Warnable that is used within this package for testing purposes only.
@@ -236,6 +257,7 @@
 	Text: func(args Args) string {
 		return fmt.Sprintf("An error occurred applying the Tailscale envknob configuration stored on disk: %v", args[ArgError])
 	},
+	Component: ComponentBackend,
 })
 
 // controlHealthWarnable is a Warnable that warns the user that the coordination server is reporting an health issue.
@@ -246,6 +268,7 @@
 	Text: func(args Args) string {
 		return fmt.Sprintf("The coordination server is reporting an health issue: %v", args[ArgError])
 	},
+	Component: ComponentControl,
 })
 
 // warmingUpWarnableDuration is the duration for which the warmingUpWarnable is reported by the backend after the user
@@ -256,8 +279,9 @@
 // warmingUpWarnableDuration. The GUIs use the presence of this Warnable to prevent showing any other warnings until
 // the backend is fully started.
 var warmingUpWarnable = Register(&Warnable{
-	Code:     "warming-up",
-	Title:    "Tailscale is starting",
-	Severity: SeverityLow,
-	Text:     StaticMessage("Tailscale is starting. Please wait."),
+	Code:      "warming-up",
+	Title:     "Tailscale is starting",
+	Severity:  SeverityLow,
+	Text:      StaticMessage("Tailscale is starting. Please wait."),
+	Component: ComponentBackend,
 })
@@ -0,0 +1,208 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AutoExitNodePrefix is the prefix of the values of the --exit-node flag of
+// the CLI that select an exit node automatically, such as "auto:any".
+const AutoExitNodePrefix = "auto:"
+
+// ExitNodeExpression is an expression specifying whether and how an exit
+// node is picked automatically. It is the part after AutoExitNodePrefix of
+// values like "auto:any" or "auto:country=SE,hours=22:00-06:00".
+//
+// The expression is either AnyExitNode or a comma-separated list of terms
+// limiting the exit nodes picked, or when one is used at all:
+//
+//   - country=CC only picks exit nodes located in the country with the
+//     ISO 3166-1 alpha-2 code CC. The term may be repeated to allow
+//     several countries.
+//   - hours=HH:MM-HH:MM only uses an exit node between the given times of
+//     day, in local time. The window may span midnight.
+//   - iface=NAME only uses an exit node while the default route is via
+//     the named network interface, such as a Wi-Fi interface used on
+//     untrusted networks. The term may be repeated.
+//
+// Among the exit nodes allowed, the one with the lowest measured latency is
+// picked, breaking ties by the priority advertised in their locations.
+type ExitNodeExpression string
+
+// AnyExitNode is the ExitNodeExpression that picks any suggested exit node.
+const AnyExitNode ExitNodeExpression = "any"
+
+// ParseAutoExitNodeString parses s as an AutoExitNodePrefix followed by an
+// ExitNodeExpression. It reports whether s has the prefix and a non-empty
+// expression; the expression is not otherwise validated.
+func ParseAutoExitNodeString(s string) (_ ExitNodeExpression, ok bool) {
+	expr, ok := strings.CutPrefix(s, AutoExitNodePrefix)
+	if !ok || expr == "" {
+		return "", false
+	}
+	return ExitNodeExpression(expr), true
+}
+
+// String returns e in the form accepted by ParseAutoExitNodeString, or the
+// empty string if e is empty.
+func (e ExitNodeExpression) String() string {
+	if e == "" {
+		return ""
+	}
+	return AutoExitNodePrefix + string(e)
+}
+
+// AutoExitNodePolicy is a parsed ExitNodeExpression.
+// The zero value picks any suggested exit node, at any time.
+type AutoExitNodePolicy struct {
+	// Countries, if non-empty, are the upper-case ISO 3166-1 alpha-2 codes
+	// of the countries exit nodes must be located in.
+	Countries []string
+
+	// Hours, if non-nil, is the daily window during which an exit node is
+	// used.
+	Hours *DailyWindow
+
+	// Interfaces, if non-empty, are the names of the network interfaces
+	// the default route must be via for an exit node to be used.
+	Interfaces []string
+}
+
+// DailyWindow is a window of time that recurs every day, in local time.
+type DailyWindow struct {
+	// Start and End are offsets from midnight. If End is before Start,
+	// the window spans midnight.
+	Start, End time.Duration
+}
+
+// Policy parses e. The empty expression parses as the zero
+// AutoExitNodePolicy.
+func (e ExitNodeExpression) Policy() (AutoExitNodePolicy, error) {
+	var pol AutoExitNodePolicy
+	if e == "" || e == AnyExitNode {
+		return pol, nil
+	}
+	for _, term := range strings.Split(string(e), ",") {
+		key, val, ok := strings.Cut(term, "=")
+		if !ok && term != string(AnyExitNode) {
+			return pol, fmt.Errorf("invalid exit node expression term %q", term)
+		}
+		switch key {
+		case string(AnyExitNode):
+		case "country":
+			if len(val) != 2 {
+				return pol, fmt.Errorf("invalid country code %q; want a two-letter ISO 3166-1 code", val)
+			}
+			pol.Countries = append(pol.Countries, strings.ToUpper(val))
+		case "hours":
+			if pol.Hours != nil {
+				return pol, errors.New("hours may only be given once")
+			}
+			w, err := parseDailyWindow(val)
+			if err != nil {
+				return pol, err
+			}
+			pol.Hours = &w
+		case "iface":
+			if val == "" {
+				return pol, errors.New("empty interface name")
+			}
+			pol.Interfaces = append(pol.Interfaces, val)
+		default:
+			return pol, fmt.Errorf("unknown exit node expression term %q", key)
+		}
+	}
+	return pol, nil
+}
+
+func parseDailyWindow(s string) (DailyWindow, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return DailyWindow{}, fmt.Errorf("invalid hours %q; want HH:MM-HH:MM", s)
+	}
+	start, err := parseTimeOfDay(from)
+	if err != nil {
+		return DailyWindow{}, err
+	}
+	end, err := parseTimeOfDay(to)
+	if err != nil {
+		return DailyWindow{}, err
+	}
+	if start == end {
+		return DailyWindow{}, fmt.Errorf("invalid hours %q: empty window", s)
+	}
+	return DailyWindow{Start: start, End: end}, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q; want HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// AllowsCountry reports whether exit nodes located in the country with the
+// ISO 3166-1 alpha-2 code cc may be picked.
+func (p AutoExitNodePolicy) AllowsCountry(cc string) bool {
+	return len(p.Countries) == 0 || slices.Contains(p.Countries, strings.ToUpper(cc))
+}
+
+// ActiveAt reports whether an exit node should be used at now, when the
+// default route is via the network interface named defaultRouteIface.
+func (p AutoExitNodePolicy) ActiveAt(now time.Time, defaultRouteIface string) bool {
+	if len(p.Interfaces) > 0 && !slices.Contains(p.Interfaces, defaultRouteIface) {
+		return false
+	}
+	if p.Hours != nil && !p.Hours.Contains(now) {
+		return false
+	}
+	return true
+}
+
+// NextChange returns the next time after now at which the result of
+// ActiveAt changes because of the time of day, and whether there is one.
+func (p AutoExitNodePolicy) NextChange(now time.Time) (time.Time, bool) {
+	if p.Hours == nil {
+		return time.Time{}, false
+	}
+	return p.Hours.next(now), true
+}
+
+// Contains reports whether t is within w.
+func (w DailyWindow) Contains(t time.Time) bool {
+	d := sinceMidnight(t)
+	if w.Start < w.End {
+		return d >= w.Start && d < w.End
+	}
+	return d >= w.Start || d < w.End
+}
+
+// next returns the next start or end of w after t.
+func (w DailyWindow) next(t time.Time) time.Time {
+	y, m, d := t.Date()
+	var next time.Time
+	for _, day := range []int{0, 1} {
+		for _, off := range []time.Duration{w.Start, w.End} {
+			// Construct the wall clock time rather than adding to
+			// midnight, to get the right time on days on which the UTC
+			// offset changes.
+			c := time.Date(y, m, d+day, int(off/time.Hour), int(off%time.Hour/time.Minute), 0, 0, t.Location())
+			if c.After(t) && (next.IsZero() || c.Before(next)) {
+				next = c
+			}
+		}
+	}
+	return next
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second + time.Duration(t.Nanosecond())
+}
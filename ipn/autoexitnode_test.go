@@ -0,0 +1,133 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseAutoExitNodeString(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   ExitNodeExpression
+		wantOK bool
+	}{
+		{"auto:any", AnyExitNode, true},
+		{"auto:country=SE", "country=SE", true},
+		{"auto:", "", false},
+		{"any", "", false},
+		{"100.64.0.1", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseAutoExitNodeString(tt.in)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParseAutoExitNodeString(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestExitNodeExpressionPolicy(t *testing.T) {
+	tests := []struct {
+		expr    ExitNodeExpression
+		want    AutoExitNodePolicy
+		wantErr bool
+	}{
+		{expr: ""},
+		{expr: AnyExitNode},
+		{
+			expr: "country=se,country=NO",
+			want: AutoExitNodePolicy{Countries: []string{"SE", "NO"}},
+		},
+		{
+			expr: "any,hours=22:00-06:30,iface=wlan0",
+			want: AutoExitNodePolicy{
+				Hours:      &DailyWindow{Start: 22 * time.Hour, End: 6*time.Hour + 30*time.Minute},
+				Interfaces: []string{"wlan0"},
+			},
+		},
+		{expr: "country=SWE", wantErr: true},
+		{expr: "hours=09:00", wantErr: true},
+		{expr: "hours=09:00-09:00", wantErr: true},
+		{expr: "hours=09:00-17:00,hours=18:00-19:00", wantErr: true},
+		{expr: "hours=9am-5pm", wantErr: true},
+		{expr: "iface=", wantErr: true},
+		{expr: "fastest", wantErr: true},
+		{expr: "ssid=cafe", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.expr.Policy()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v; want error: %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %+v; want %+v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestAutoExitNodePolicyActiveAt(t *testing.T) {
+	at := func(hh, mm int) time.Time {
+		return time.Date(2024, 3, 1, hh, mm, 0, 0, time.UTC)
+	}
+	overnight := AutoExitNodePolicy{Hours: &DailyWindow{Start: 22 * time.Hour, End: 6 * time.Hour}}
+	daytime := AutoExitNodePolicy{Hours: &DailyWindow{Start: 9 * time.Hour, End: 17 * time.Hour}}
+	wifi := AutoExitNodePolicy{Interfaces: []string{"wlan0"}}
+	tests := []struct {
+		name  string
+		pol   AutoExitNodePolicy
+		now   time.Time
+		iface string
+		want  bool
+	}{
+		{"zero", AutoExitNodePolicy{}, at(3, 0), "eth0", true},
+		{"overnight_before", overnight, at(21, 59), "eth0", false},
+		{"overnight_start", overnight, at(22, 0), "eth0", true},
+		{"overnight_after_midnight", overnight, at(5, 59), "eth0", true},
+		{"overnight_end", overnight, at(6, 0), "eth0", false},
+		{"daytime_in", daytime, at(12, 0), "eth0", true},
+		{"daytime_out", daytime, at(18, 0), "eth0", false},
+		{"iface_match", wifi, at(12, 0), "wlan0", true},
+		{"iface_mismatch", wifi, at(12, 0), "eth0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pol.ActiveAt(tt.now, tt.iface); got != tt.want {
+				t.Errorf("ActiveAt(%v, %q) = %v; want %v", tt.now, tt.iface, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoExitNodePolicyNextChange(t *testing.T) {
+	pol := AutoExitNodePolicy{Hours: &DailyWindow{Start: 22 * time.Hour, End: 6 * time.Hour}}
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{
+			now:  time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			want: time.Date(2024, 3, 1, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			now:  time.Date(2024, 3, 1, 22, 0, 0, 0, time.UTC),
+			want: time.Date(2024, 3, 2, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			now:  time.Date(2024, 3, 1, 3, 0, 0, 0, time.UTC),
+			want: time.Date(2024, 3, 1, 6, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		got, ok := pol.NextChange(tt.now)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("NextChange(%v) = %v, %v; want %v", tt.now, got, ok, tt.want)
+		}
+	}
+	if _, ok := (AutoExitNodePolicy{}).NextChange(time.Now()); ok {
+		t.Error("NextChange of policy without hours reported a change")
+	}
+}
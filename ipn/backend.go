@@ -75,8 +75,26 @@ type EngineStatus struct {
 	NotifyInitialHealthState // if set, the first Notify message (sent immediately) will contain the current health.State of the client
 
 	NotifyRateLimit // if set, rate limit spammy netmap updates to every few seconds
+
+	// NotifyWatchState, NotifyWatchPrefs, NotifyWatchNetMap, NotifyWatchHealth
+	// and NotifyWatchFiles subscribe to the corresponding kinds of Notify
+	// messages. If any of them are set, the watcher only receives those kinds
+	// of messages (plus Engine updates, if NotifyWatchEngineUpdates is set),
+	// with the fields about other kinds of events cleared, and messages with
+	// none of the requested fields are not sent at all. If none are set, all
+	// messages are sent. The first message, requested by the NotifyInitial
+	// bits, is not filtered.
+	NotifyWatchState  // State, SessionID, BrowseToURL, LoginFinished and ErrMessage
+	NotifyWatchPrefs  // Prefs
+	NotifyWatchNetMap // NetMap
+	NotifyWatchHealth // Health
+	NotifyWatchFiles  // FilesWaiting, IncomingFiles and OutgoingFiles
 )
 
+// NotifyWatchEvents is the set of NotifyWatchOpt bits that filter the kinds of
+// Notify messages sent to a watcher.
+const NotifyWatchEvents = NotifyWatchState | NotifyWatchPrefs | NotifyWatchNetMap | NotifyWatchHealth | NotifyWatchFiles
+
 // Notify is a communication from a backend (e.g. tailscaled) to a frontend
 // (cmd/tailscale, iOS, macOS, Win Tasktray).
 // In any given notification, any or all of these may be nil, meaning
@@ -92,6 +110,12 @@ type Notify struct {
 	// following notifications will not include this field.
 	SessionID string `json:",omitempty"`
 
+	// Cursor identifies this message in the stream of messages sent by the
+	// backend. A watcher that loses its connection can resume watching after
+	// the last message it received by passing its Cursor when reconnecting,
+	// as long as the backend still has the messages sent since then buffered.
+	Cursor string `json:",omitempty"`
+
 	// ErrMessage, if non-nil, contains a critical error message.
 	// For State InUseOtherUser, ErrMessage is not critical and just contains the details.
 	ErrMessage *string
@@ -0,0 +1,38 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// CertIssuer kinds, as returned by ParseCertIssuer.
+const (
+	CertIssuerLetsEncrypt = ""      // Let's Encrypt, the default
+	CertIssuerACME        = "acme"  // an ACME directory, such as of a private CA
+	CertIssuerVault       = "vault" // a HashiCorp Vault PKI secrets engine
+)
+
+// ParseCertIssuer parses the CertIssuer pref s, in the format of the
+// "tailscale set --cert-issuer" flag: empty for Let's Encrypt, "acme:"
+// followed by the URL of an ACME directory, or "vault:" followed by the URL
+// of the sign endpoint of a Vault PKI role, such as
+// "vault:https://vault.example.com/v1/pki/sign/ts-net". It returns the kind
+// of issuer and its URL.
+func ParseCertIssuer(s string) (kind, issuerURL string, err error) {
+	if s == "" {
+		return CertIssuerLetsEncrypt, "", nil
+	}
+	kind, issuerURL, ok := strings.Cut(s, ":")
+	if !ok || (kind != CertIssuerACME && kind != CertIssuerVault) {
+		return "", "", fmt.Errorf("invalid cert issuer %q; want acme:URL or vault:URL", s)
+	}
+	u, err := url.Parse(issuerURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", "", fmt.Errorf("invalid %s URL %q", kind, issuerURL)
+	}
+	return kind, issuerURL, nil
+}
@@ -0,0 +1,33 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import "testing"
+
+func TestParseCertIssuer(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantKind string
+		wantURL  string
+		wantErr  bool
+	}{
+		{in: "", wantKind: CertIssuerLetsEncrypt},
+		{in: "acme:https://ca.corp.example/acme/directory", wantKind: CertIssuerACME, wantURL: "https://ca.corp.example/acme/directory"},
+		{in: "vault:https://vault.example.com/v1/pki/sign/ts-net", wantKind: CertIssuerVault, wantURL: "https://vault.example.com/v1/pki/sign/ts-net"},
+		{in: "https://ca.corp.example/acme/directory", wantErr: true},
+		{in: "vault:", wantErr: true},
+		{in: "acme:ftp://ca.corp.example/", wantErr: true},
+		{in: "letsencrypt", wantErr: true},
+	}
+	for _, tt := range tests {
+		kind, u, err := ParseCertIssuer(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCertIssuer(%q) error = %v; want error: %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if kind != tt.wantKind || u != tt.wantURL {
+			t.Errorf("ParseCertIssuer(%q) = %q, %q; want %q, %q", tt.in, kind, u, tt.wantKind, tt.wantURL)
+		}
+	}
+}
@@ -37,12 +37,13 @@ type ConfigVAlpha struct {
 	NetfilterMode       *string  `json:",omitempty"` // "on", "off", "nodivert"
 	NoStatefulFiltering opt.Bool `json:",omitempty"`
 
-	PostureChecking opt.Bool         `json:",omitempty"`
-	RunSSHServer    opt.Bool         `json:",omitempty"` // Tailscale SSH
-	RunWebClient    opt.Bool         `json:",omitempty"`
-	ShieldsUp       opt.Bool         `json:",omitempty"`
-	AutoUpdate      *AutoUpdatePrefs `json:",omitempty"`
-	ServeConfigTemp *ServeConfig     `json:",omitempty"` // TODO(bradfitz,maisem): make separate stable type for this
+	PostureChecking  opt.Bool         `json:",omitempty"`
+	RunSSHServer     opt.Bool         `json:",omitempty"` // Tailscale SSH
+	RunWebClient     opt.Bool         `json:",omitempty"`
+	RunMetricsServer opt.Bool         `json:",omitempty"`
+	ShieldsUp        opt.Bool         `json:",omitempty"`
+	AutoUpdate       *AutoUpdatePrefs `json:",omitempty"`
+	ServeConfigTemp  *ServeConfig     `json:",omitempty"` // TODO(bradfitz,maisem): make separate stable type for this
 
 	// StaticEndpoints are additional, user-defined endpoints that this node
 	// should advertise amongst its wireguard endpoints.
@@ -131,6 +132,10 @@ func (c *ConfigVAlpha) ToPrefs() (MaskedPrefs, error) {
 		mp.RunWebClient = c.RunWebClient.EqualBool(true)
 		mp.RunWebClientSet = true
 	}
+	if c.RunMetricsServer != "" {
+		mp.RunMetricsServer = c.RunMetricsServer.EqualBool(true)
+		mp.RunMetricsServerSet = true
+	}
 	if c.ShieldsUp != "" {
 		mp.ShieldsUp = c.ShieldsUp.EqualBool(true)
 		mp.ShieldsUpSet = true
@@ -10,8 +10,12 @@
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 
 	"tailscale.com/ipn"
 )
@@ -51,23 +55,51 @@ func Load(path string) (*Config, error) {
 		// compile-time for deadcode elimination
 		return nil, fmt.Errorf("config file loading not supported on %q", runtime.GOOS)
 	}
-	if hujsonStandardize == nil {
-		// Build tags are wrong in conffile_hujson.go
-		return nil, errors.New("[unexpected] config file loading not wired up")
-	}
-	var c Config
-	c.Path = path
+	var raw []byte
 	var err error
-
 	switch path {
 	case VMUserDataPath:
-		c.Raw, err = readVMUserData()
+		raw, err = readVMUserData()
 	default:
-		c.Raw, err = os.ReadFile(path)
+		raw, err = os.ReadFile(path)
 	}
 	if err != nil {
 		return nil, err
 	}
+	return Parse(path, raw)
+}
+
+// Parse parses the contents raw of a config file, as read from path. The path
+// is only used in error messages, to populate [Config.Path], and to resolve
+// relative secret file paths.
+//
+// Any value in the config file can instead be a reference to an environment
+// variable or a file holding it, which Parse resolves to a string:
+//
+//	"AuthKey": {"fromFile": "/run/secrets/ts-auth"},
+//	"Hostname": {"fromEnv": "HOSTNAME"},
+//
+// Files are read with surrounding whitespace removed. Relative file paths
+// are relative to the config file's directory. [Config.Raw] and
+// [Config.Std] keep the references, not their values.
+//
+// It returns an error if raw is not a config file that this version of
+// Tailscale can load, such as one with an unknown version or fields.
+func Parse(path string, raw []byte) (*Config, error) {
+	switch runtime.GOOS {
+	case "ios", "android":
+		// compile-time for deadcode elimination
+		return nil, fmt.Errorf("config file loading not supported on %q", runtime.GOOS)
+	}
+	if hujsonStandardize == nil {
+		// Build tags are wrong in conffile_hujson.go
+		return nil, errors.New("[unexpected] config file loading not wired up")
+	}
+	c := Config{
+		Path: path,
+		Raw:  raw,
+	}
+	var err error
 	c.Std, err = hujsonStandardize(c.Raw)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing config file %s HuJSON/JSON: %w", path, err)
@@ -87,7 +119,11 @@ func Load(path string) (*Config, error) {
 	}
 	c.Version = ver.Version
 
-	jd := json.NewDecoder(bytes.NewReader(c.Std))
+	resolved, err := resolveRefs(path, c.Std)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	jd := json.NewDecoder(bytes.NewReader(resolved))
 	jd.DisallowUnknownFields()
 	err = jd.Decode(&c.Parsed)
 	if err != nil {
@@ -98,3 +134,84 @@ func Load(path string) (*Config, error) {
 	}
 	return &c, nil
 }
+
+// resolveRefs returns the JSON std with the environment variable and
+// file references described in [Parse] replaced by their values.
+func resolveRefs(path string, std []byte) ([]byte, error) {
+	var v any
+	d := json.NewDecoder(bytes.NewReader(std))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	dir := "."
+	if path != VMUserDataPath {
+		dir = filepath.Dir(path)
+	}
+	changed := false
+	var resolve func(where string, v any) (any, error)
+	resolve = func(where string, v any) (any, error) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok, err := resolveRef(dir, v); ok || err != nil {
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", strings.TrimPrefix(where, "."), err)
+				}
+				changed = true
+				return ref, nil
+			}
+			for _, k := range slices.Sorted(maps.Keys(v)) {
+				var err error
+				if v[k], err = resolve(where+"."+k, v[k]); err != nil {
+					return nil, err
+				}
+			}
+		case []any:
+			for i, e := range v {
+				var err error
+				if v[i], err = resolve(fmt.Sprintf("%s[%d]", where, i), e); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return v, nil
+	}
+	v, err := resolve("", v)
+	if err != nil || !changed {
+		return std, err
+	}
+	return json.Marshal(v)
+}
+
+// resolveRef returns the value of m if it's a reference to an environment
+// variable or file, and whether it is one.
+func resolveRef(dir string, m map[string]any) (_ string, ok bool, _ error) {
+	if len(m) != 1 {
+		return "", false, nil
+	}
+	for k, v := range m {
+		if k != "fromEnv" && k != "fromFile" {
+			return "", false, nil
+		}
+		name, isString := v.(string)
+		if !isString || name == "" {
+			return "", true, fmt.Errorf("%q must be a non-empty string", k)
+		}
+		if k == "fromEnv" {
+			val, ok := os.LookupEnv(name)
+			if !ok {
+				return "", true, fmt.Errorf("environment variable %q is not set", name)
+			}
+			return val, true, nil
+		}
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return "", true, fmt.Errorf("reading secret file: %w", err)
+		}
+		return strings.TrimSpace(string(b)), true, nil
+	}
+	panic("unreachable")
+}
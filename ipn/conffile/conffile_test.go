@@ -0,0 +1,62 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package conffile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRefs(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ts-auth"), []byte("tskey-auth-xyz\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_TS_HOSTNAME", "web-1")
+	path := filepath.Join(dir, "tailscaled.conf")
+
+	raw := `{
+		"version": "alpha0",
+		"AuthKey": {"fromFile": "ts-auth"}, // relative to the config file
+		"Hostname": {"fromEnv": "TEST_TS_HOSTNAME"},
+		"AdvertiseRoutes": ["10.0.0.0/8"],
+	}`
+	c, err := Parse(path, []byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := *c.Parsed.AuthKey; got != "tskey-auth-xyz" {
+		t.Errorf("AuthKey = %q", got)
+	}
+	if got := *c.Parsed.Hostname; got != "web-1" {
+		t.Errorf("Hostname = %q", got)
+	}
+	if len(c.Parsed.AdvertiseRoutes) != 1 {
+		t.Errorf("AdvertiseRoutes = %v", c.Parsed.AdvertiseRoutes)
+	}
+	if strings.Contains(string(c.Std), "tskey") {
+		t.Errorf("Std contains the secret: %s", c.Std)
+	}
+
+	errTests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{"unset-env", `{"version": "alpha0", "Hostname": {"fromEnv": "TEST_TS_UNSET"}}`, `Hostname: environment variable "TEST_TS_UNSET" is not set`},
+		{"missing-file", `{"version": "alpha0", "AuthKey": {"fromFile": "/nonexistent/ts-auth"}}`, "AuthKey: reading secret file: open /nonexistent/ts-auth"},
+		{"bad-ref", `{"version": "alpha0", "AuthKey": {"fromFile": 1}}`, `AuthKey: "fromFile" must be a non-empty string`},
+		{"not-a-ref", `{"version": "alpha0", "AuthKey": {"fromFile": "ts-auth", "x": 1}}`, "cannot unmarshal object"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(path, []byte(tt.raw))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v; want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
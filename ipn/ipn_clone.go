@@ -8,6 +8,7 @@
 import (
 	"maps"
 	"net/netip"
+	"time"
 
 	"tailscale.com/drive"
 	"tailscale.com/tailcfg"
@@ -28,6 +29,7 @@ func (src *Prefs) Clone() *Prefs {
 	dst.AdvertiseTags = append(src.AdvertiseTags[:0:0], src.AdvertiseTags...)
 	dst.AdvertiseRoutes = append(src.AdvertiseRoutes[:0:0], src.AdvertiseRoutes...)
 	dst.AdvertiseServices = append(src.AdvertiseServices[:0:0], src.AdvertiseServices...)
+	dst.KeepaliveIntervals = append(src.KeepaliveIntervals[:0:0], src.KeepaliveIntervals...)
 	if src.DriveShares != nil {
 		dst.DriveShares = make([]*drive.Share, len(src.DriveShares))
 		for i := range dst.DriveShares {
@@ -48,11 +50,14 @@ func (src *Prefs) Clone() *Prefs {
 	RouteAll               bool
 	ExitNodeID             tailcfg.StableNodeID
 	ExitNodeIP             netip.Addr
+	AutoExitNode           ExitNodeExpression
 	InternalExitNodePrior  tailcfg.StableNodeID
 	ExitNodeAllowLANAccess bool
+	ExitNodeFailClosed     bool
 	CorpDNS                bool
 	RunSSH                 bool
 	RunWebClient           bool
+	RunMetricsServer       bool
 	WantRunning            bool
 	LoggedOut              bool
 	ShieldsUp              bool
@@ -63,6 +68,7 @@ func (src *Prefs) Clone() *Prefs {
 	Egg                    bool
 	AdvertiseRoutes        []netip.Prefix
 	AdvertiseServices      []string
+	RouteJustification     string
 	NoSNAT                 bool
 	NoStatefulFiltering    opt.Bool
 	NetfilterMode          preftype.NetfilterMode
@@ -71,6 +77,10 @@ func (src *Prefs) Clone() *Prefs {
 	AutoUpdate             AutoUpdatePrefs
 	AppConnector           AppConnectorPrefs
 	PostureChecking        bool
+	KeepaliveIntervals     []tailcfg.KeepaliveIntervals
+	EphemeralIdleTimeout   time.Duration
+	LANDNSResponder        bool
+	CertIssuer             string
 	NetfilterKind          string
 	DriveShares            []*drive.Share
 	AllowSingleHosts       marshalAsTrueInJSON
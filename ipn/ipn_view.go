@@ -9,6 +9,7 @@
 	"encoding/json"
 	"errors"
 	"net/netip"
+	"time"
 
 	"tailscale.com/drive"
 	"tailscale.com/tailcfg"
@@ -69,11 +70,14 @@ func (v PrefsView) ControlURL() string                          { return v.ж.Co
 func (v PrefsView) RouteAll() bool                              { return v.ж.RouteAll }
 func (v PrefsView) ExitNodeID() tailcfg.StableNodeID            { return v.ж.ExitNodeID }
 func (v PrefsView) ExitNodeIP() netip.Addr                      { return v.ж.ExitNodeIP }
+func (v PrefsView) AutoExitNode() ExitNodeExpression            { return v.ж.AutoExitNode }
 func (v PrefsView) InternalExitNodePrior() tailcfg.StableNodeID { return v.ж.InternalExitNodePrior }
 func (v PrefsView) ExitNodeAllowLANAccess() bool                { return v.ж.ExitNodeAllowLANAccess }
+func (v PrefsView) ExitNodeFailClosed() bool                    { return v.ж.ExitNodeFailClosed }
 func (v PrefsView) CorpDNS() bool                               { return v.ж.CorpDNS }
 func (v PrefsView) RunSSH() bool                                { return v.ж.RunSSH }
 func (v PrefsView) RunWebClient() bool                          { return v.ж.RunWebClient }
+func (v PrefsView) RunMetricsServer() bool                      { return v.ж.RunMetricsServer }
 func (v PrefsView) WantRunning() bool                           { return v.ж.WantRunning }
 func (v PrefsView) LoggedOut() bool                             { return v.ж.LoggedOut }
 func (v PrefsView) ShieldsUp() bool                             { return v.ж.ShieldsUp }
@@ -88,6 +92,7 @@ func (v PrefsView) AdvertiseRoutes() views.Slice[netip.Prefix] {
 func (v PrefsView) AdvertiseServices() views.Slice[string] {
 	return views.SliceOf(v.ж.AdvertiseServices)
 }
+func (v PrefsView) RouteJustification() string            { return v.ж.RouteJustification }
 func (v PrefsView) NoSNAT() bool                          { return v.ж.NoSNAT }
 func (v PrefsView) NoStatefulFiltering() opt.Bool         { return v.ж.NoStatefulFiltering }
 func (v PrefsView) NetfilterMode() preftype.NetfilterMode { return v.ж.NetfilterMode }
@@ -96,7 +101,13 @@ func (v PrefsView) ProfileName() string                   { return v.ж.ProfileN
 func (v PrefsView) AutoUpdate() AutoUpdatePrefs           { return v.ж.AutoUpdate }
 func (v PrefsView) AppConnector() AppConnectorPrefs       { return v.ж.AppConnector }
 func (v PrefsView) PostureChecking() bool                 { return v.ж.PostureChecking }
-func (v PrefsView) NetfilterKind() string                 { return v.ж.NetfilterKind }
+func (v PrefsView) KeepaliveIntervals() views.Slice[tailcfg.KeepaliveIntervals] {
+	return views.SliceOf(v.ж.KeepaliveIntervals)
+}
+func (v PrefsView) EphemeralIdleTimeout() time.Duration { return v.ж.EphemeralIdleTimeout }
+func (v PrefsView) LANDNSResponder() bool               { return v.ж.LANDNSResponder }
+func (v PrefsView) CertIssuer() string                  { return v.ж.CertIssuer }
+func (v PrefsView) NetfilterKind() string               { return v.ж.NetfilterKind }
 func (v PrefsView) DriveShares() views.SliceView[*drive.Share, drive.ShareView] {
 	return views.SliceOfViews[*drive.Share, drive.ShareView](v.ж.DriveShares)
 }
@@ -109,11 +120,14 @@ func (v PrefsView) Persist() persist.PersistView          { return v.ж.Persist.
 	RouteAll               bool
 	ExitNodeID             tailcfg.StableNodeID
 	ExitNodeIP             netip.Addr
+	AutoExitNode           ExitNodeExpression
 	InternalExitNodePrior  tailcfg.StableNodeID
 	ExitNodeAllowLANAccess bool
+	ExitNodeFailClosed     bool
 	CorpDNS                bool
 	RunSSH                 bool
 	RunWebClient           bool
+	RunMetricsServer       bool
 	WantRunning            bool
 	LoggedOut              bool
 	ShieldsUp              bool
@@ -124,6 +138,7 @@ func (v PrefsView) Persist() persist.PersistView          { return v.ж.Persist.
 	Egg                    bool
 	AdvertiseRoutes        []netip.Prefix
 	AdvertiseServices      []string
+	RouteJustification     string
 	NoSNAT                 bool
 	NoStatefulFiltering    opt.Bool
 	NetfilterMode          preftype.NetfilterMode
@@ -132,6 +147,10 @@ func (v PrefsView) Persist() persist.PersistView          { return v.ж.Persist.
 	AutoUpdate             AutoUpdatePrefs
 	AppConnector           AppConnectorPrefs
 	PostureChecking        bool
+	KeepaliveIntervals     []tailcfg.KeepaliveIntervals
+	EphemeralIdleTimeout   time.Duration
+	LANDNSResponder        bool
+	CertIssuer             string
 	NetfilterKind          string
 	DriveShares            []*drive.Share
 	AllowSingleHosts       marshalAsTrueInJSON
@@ -46,6 +46,9 @@ type WindowsToken interface {
 	// IsElevated reports whether the receiver is currently executing as an
 	// elevated administrative user.
 	IsElevated() bool
+	// SessionID returns the ID of the Windows (Terminal Services) session
+	// that the receiver belongs to, or else an error.
+	SessionID() (uint32, error)
 	// IsLocalSystem reports whether the receiver is the built-in SYSTEM user.
 	IsLocalSystem() bool
 	// UserDir returns the special directory identified by folderID as associated
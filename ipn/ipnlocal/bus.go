@@ -5,10 +5,16 @@
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnauth"
 	"tailscale.com/tstime"
+	"tailscale.com/util/rands"
 )
 
 type rateLimitingBusSender struct {
@@ -125,6 +131,7 @@ func mergeBoringNotifies(dst, src *ipn.Notify) *ipn.Notify {
 	if dst == nil {
 		dst = &ipn.Notify{Version: src.Version}
 	}
+	dst.Cursor = src.Cursor
 	if src.NetMap != nil {
 		dst.NetMap = src.NetMap
 	}
@@ -158,3 +165,115 @@ func isNotableNotify(n *ipn.Notify) bool {
 		len(n.OutgoingFiles) > 0 ||
 		n.FilesWaiting != nil
 }
+
+// filterNotify returns a copy of n with only the fields about the kinds of
+// events selected by the [ipn.NotifyWatchEvents] bits of mask, or nil if n has
+// none of them. It returns n itself if mask has none of those bits set.
+func filterNotify(n *ipn.Notify, mask ipn.NotifyWatchOpt) *ipn.Notify {
+	if mask&ipn.NotifyWatchEvents == 0 {
+		return n
+	}
+	f := &ipn.Notify{Version: n.Version, Cursor: n.Cursor}
+	keep := false
+	if mask&ipn.NotifyWatchState != 0 && (n.State != nil || n.SessionID != "" || n.BrowseToURL != nil || n.LoginFinished != nil || n.ErrMessage != nil) {
+		f.State = n.State
+		f.SessionID = n.SessionID
+		f.BrowseToURL = n.BrowseToURL
+		f.LoginFinished = n.LoginFinished
+		f.ErrMessage = n.ErrMessage
+		keep = true
+	}
+	if mask&ipn.NotifyWatchPrefs != 0 && n.Prefs != nil {
+		f.Prefs = n.Prefs
+		keep = true
+	}
+	if mask&ipn.NotifyWatchNetMap != 0 && n.NetMap != nil {
+		f.NetMap = n.NetMap
+		keep = true
+	}
+	if mask&ipn.NotifyWatchHealth != 0 && n.Health != nil {
+		f.Health = n.Health
+		keep = true
+	}
+	// FilesWaiting is set on all notifications while files are waiting, so
+	// it alone doesn't make a notification about files.
+	if mask&ipn.NotifyWatchFiles != 0 && (n.IncomingFiles != nil || n.OutgoingFiles != nil) {
+		f.FilesWaiting = n.FilesWaiting
+		f.IncomingFiles = n.IncomingFiles
+		f.OutgoingFiles = n.OutgoingFiles
+		keep = true
+	}
+	if mask&ipn.NotifyWatchEngineUpdates != 0 && n.Engine != nil {
+		f.Engine = n.Engine
+		keep = true
+	}
+	if !keep {
+		return nil
+	}
+	return f
+}
+
+// notifyBacklogSize is the number of recently sent notifications kept by
+// a notifyBacklog. It's small, as notifications can hold large netmaps.
+const notifyBacklogSize = 16
+
+// notifyBacklog assigns the cursors of the notifications sent on the IPN bus
+// and keeps the most recent of them, so that watchers can resume after
+// reconnecting without missing any.
+//
+// The zero value is ready for use. Its methods must be called with
+// LocalBackend.mu held.
+type notifyBacklog struct {
+	epoch   string         // random prefix of cursors, to detect restarts; set on first use
+	seq     uint64         // sequence number of the last notification sent
+	entries []backlogEntry // the most recent notifications, oldest first
+}
+
+type backlogEntry struct {
+	n         *ipn.Notify
+	recipient notificationTarget
+}
+
+// errCursorExpired is returned by notifyBacklog.since if the notifications
+// sent after the cursor are no longer available.
+var errCursorExpired = errors.New("notifications after cursor are no longer available")
+
+// cursor returns the cursor of the last notification sent.
+func (bl *notifyBacklog) cursor() string {
+	if bl.epoch == "" {
+		bl.epoch = rands.HexString(8)
+	}
+	return bl.epoch + "-" + strconv.FormatUint(bl.seq, 10)
+}
+
+// add sets the cursor of n, which is about to be sent to recipient, and
+// records it. The caller must not modify n afterwards.
+func (bl *notifyBacklog) add(n *ipn.Notify, recipient notificationTarget) {
+	bl.seq++
+	n.Cursor = bl.cursor()
+	if len(bl.entries) == notifyBacklogSize {
+		copy(bl.entries, bl.entries[1:])
+		bl.entries = bl.entries[:len(bl.entries)-1]
+	}
+	bl.entries = append(bl.entries, backlogEntry{n, recipient})
+}
+
+// since returns the notifications for actor sent after the one with the
+// given cursor, oldest first.
+func (bl *notifyBacklog) since(cursor string, actor ipnauth.Actor) ([]*ipn.Notify, error) {
+	epoch, seqStr, ok := strings.Cut(cursor, "-")
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if !ok || err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	if epoch != bl.epoch || seq > bl.seq || bl.seq-seq > uint64(len(bl.entries)) {
+		return nil, errCursorExpired
+	}
+	var ns []*ipn.Notify
+	for _, e := range bl.entries[len(bl.entries)-int(bl.seq-seq):] {
+		if e.recipient.match(actor) {
+			ns = append(ns, e.n)
+		}
+	}
+	return ns, nil
+}
@@ -11,6 +11,7 @@
 	"time"
 
 	"tailscale.com/drive"
+	"tailscale.com/health"
 	"tailscale.com/ipn"
 	"tailscale.com/tstest"
 	"tailscale.com/tstime"
@@ -40,7 +41,7 @@ func TestIsNotableNotify(t *testing.T) {
 		n := &ipn.Notify{}
 		sf := rt.Field(i)
 		switch sf.Name {
-		case "_", "NetMap", "Engine", "Version":
+		case "_", "NetMap", "Engine", "Version", "Cursor":
 			// Already covered above or not applicable.
 			continue
 		case "DriveShares":
@@ -218,3 +219,113 @@ func TestRateLimitingBusSender(t *testing.T) {
 		st.s.Run(ctx, incoming)
 	})
 }
+
+func TestFilterNotify(t *testing.T) {
+	state := ipn.Running
+	n := &ipn.Notify{
+		Version: "1.2.3",
+		Cursor:  "c-1",
+		State:   &state,
+		NetMap:  new(netmap.NetworkMap),
+		Engine:  new(ipn.EngineStatus),
+	}
+	tests := []struct {
+		name string
+		mask ipn.NotifyWatchOpt
+		want *ipn.Notify
+	}{
+		{"unfiltered", ipn.NotifyRateLimit, n},
+		{"netmap", ipn.NotifyWatchNetMap, &ipn.Notify{Version: "1.2.3", Cursor: "c-1", NetMap: n.NetMap}},
+		{"state_and_engine", ipn.NotifyWatchState | ipn.NotifyWatchEngineUpdates, &ipn.Notify{Version: "1.2.3", Cursor: "c-1", State: &state, Engine: n.Engine}},
+		{"none_matching", ipn.NotifyWatchHealth | ipn.NotifyWatchPrefs, nil},
+		{"files_waiting_alone", ipn.NotifyWatchFiles, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filterNotify(n, tt.mask)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyBacklog(t *testing.T) {
+	var bl notifyBacklog
+	start := bl.cursor()
+	var sent []*ipn.Notify
+	for range notifyBacklogSize + 2 {
+		n := &ipn.Notify{}
+		bl.add(n, allClients)
+		sent = append(sent, n)
+	}
+
+	// Cursors of notifications still buffered can be resumed from.
+	for _, i := range []int{1, 5, len(sent) - 1} {
+		got, err := bl.since(sent[i].Cursor, nil)
+		if err != nil {
+			t.Fatalf("since(sent[%d]): %v", i, err)
+		}
+		if want := sent[i+1:]; !slices.Equal(got, want) {
+			t.Errorf("since(sent[%d]) = %d notifications; want %d", i, len(got), len(want))
+		}
+	}
+
+	for _, cursor := range []string{
+		start,          // no longer buffered
+		sent[0].Cursor, // no longer buffered
+		"bogus-1",      // from another process
+		bl.epoch + "-1000",
+	} {
+		if _, err := bl.since(cursor, nil); err != errCursorExpired {
+			t.Errorf("since(%q) = %v; want errCursorExpired", cursor, err)
+		}
+	}
+	if _, err := bl.since("garbage", nil); err == nil {
+		t.Error("since(garbage) succeeded")
+	}
+}
+
+func TestWatchNotificationsFrom(t *testing.T) {
+	b := newTestLocalBackend(t)
+	msg := func(s string) *string { return &s }
+
+	b.mu.Lock()
+	cursor := b.notifyBacklog.cursor()
+	b.mu.Unlock()
+	b.send(ipn.Notify{ErrMessage: msg("one")})
+	b.send(ipn.Notify{Health: new(health.State)})
+	b.send(ipn.Notify{ErrMessage: msg("two")})
+
+	watch := func(mask ipn.NotifyWatchOpt, cursor string, want int) ([]*ipn.Notify, error) {
+		t.Helper()
+		var got []*ipn.Notify
+		err := b.WatchNotificationsFrom(context.Background(), nil, mask, cursor, nil, func(n *ipn.Notify) bool {
+			got = append(got, n)
+			return len(got) < want
+		})
+		return got, err
+	}
+
+	got, err := watch(0, cursor, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || *got[0].ErrMessage != "one" || got[1].Health == nil || *got[2].ErrMessage != "two" {
+		t.Errorf("replayed %v; want the three notifications sent", got)
+	}
+
+	// Resuming from a notification replays only the ones after it, and
+	// filtering applies to the replayed ones too.
+	got, err = watch(ipn.NotifyWatchState, got[0].Cursor, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ErrMessage == nil || *got[0].ErrMessage != "two" || got[0].Health != nil {
+		t.Errorf("replayed %v; want only the second error", got)
+	}
+
+	if _, err := watch(0, "bogus-1", 1); err == nil {
+		t.Error("watch from expired cursor succeeded")
+	}
+}
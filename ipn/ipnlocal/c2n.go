@@ -4,6 +4,7 @@
 package ipnlocal
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
@@ -25,12 +26,16 @@
 	"github.com/kortschak/wol"
 	"tailscale.com/clientupdate"
 	"tailscale.com/envknob"
+	"tailscale.com/hostinfo"
 	"tailscale.com/ipn"
 	"tailscale.com/net/sockstats"
 	"tailscale.com/posture"
 	"tailscale.com/tailcfg"
+	"tailscale.com/types/logger"
 	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/goroutines"
+	"tailscale.com/util/mak"
+	"tailscale.com/util/rands"
 	"tailscale.com/util/set"
 	"tailscale.com/util/syspolicy"
 	"tailscale.com/version"
@@ -48,6 +53,8 @@
 	req("/debug/metrics"):           handleC2NDebugMetrics,
 	req("/debug/component-logging"): handleC2NDebugComponentLogging,
 	req("/debug/logheap"):           handleC2NDebugLogHeap,
+	req("/debug/netcheck"):          handleC2NDebugNetcheck,
+	req("POST /debug/bugreport"):    handleC2NDebugBugReport,
 
 	// PPROF - We only expose a subset of typical pprof endpoints for security.
 	req("/debug/pprof/heap"):   handleC2NPprof,
@@ -70,7 +77,8 @@
 	req("POST /wol"): handleC2NWoL,
 
 	// Device posture.
-	req("GET /posture/identity"): handleC2NPostureIdentityGet,
+	req("GET /posture/identity"):   handleC2NPostureIdentityGet,
+	req("GET /posture/attributes"): handleC2NPostureAttributesGet,
 
 	// App Connectors.
 	req("GET /appconnector/routes"): handleC2NAppConnectorDomainRoutesGet,
@@ -80,6 +88,9 @@
 
 	// VIP services.
 	req("GET /vip-services"): handleC2NVIPServicesGet,
+
+	// Route approval by an agent on the node.
+	req("GET /routes/approvals"): handleC2NRouteApprovalsGet,
 }
 
 type c2nHandler func(*LocalBackend, http.ResponseWriter, *http.Request)
@@ -174,6 +185,88 @@ func handleC2NDebugComponentLogging(b *LocalBackend, w http.ResponseWriter, r *h
 	writeJSON(w, res)
 }
 
+// c2nNetcheckTimeout is how long handleC2NDebugNetcheck waits for a fresh
+// netcheck report before giving up.
+const c2nNetcheckTimeout = 10 * time.Second
+
+// handleC2NDebugNetcheck returns the node's netcheck report. For a GET
+// request, the most recent cached report is returned. For a POST request, a
+// new address discovery is started and the handler waits for its report.
+func handleC2NDebugNetcheck(b *LocalBackend, w http.ResponseWriter, r *http.Request) {
+	b.logf("c2n: %s /debug/netcheck received", r.Method)
+
+	var res tailcfg.C2NDebugNetcheckResponse
+	mc := b.MagicConn()
+	report := mc.GetLastNetcheckReport(r.Context())
+	if r.Method == "POST" {
+		prev := report
+		mc.ReSTUN("c2n-netcheck")
+
+		ctx, cancel := context.WithTimeout(r.Context(), c2nNetcheckTimeout)
+		defer cancel()
+		t := time.NewTicker(100 * time.Millisecond)
+		defer t.Stop()
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				res.Error = "timeout waiting for netcheck report"
+				break wait
+			case <-t.C:
+				if report = mc.GetLastNetcheckReport(ctx); report != prev {
+					res.Fresh = true
+					break wait
+				}
+			}
+		}
+	}
+	if report != nil {
+		j, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res.Report = j
+	} else if res.Error == "" {
+		res.Error = "no netcheck report available"
+	}
+	writeJSON(w, res)
+}
+
+// handleC2NDebugBugReport writes a bug report marker to the node's logs,
+// along with the same diagnostic information as a user-initiated
+// "tailscale bugreport", and returns the marker so that an admin can find the
+// relevant logs for a remote, unattended node.
+func handleC2NDebugBugReport(b *LocalBackend, w http.ResponseWriter, r *http.Request) {
+	defer b.TryFlushLogs() // kick off upload after bugreport's done logging
+
+	marker := fmt.Sprintf("BUG-%v-%v-%v", b.backendLogID, b.clock.Now().UTC().Format("20060102150405Z"), rands.HexString(16))
+	if envknob.NoLogsNoSupport() {
+		marker = "BUG-NO-LOGS-NO-SUPPORT-this-node-has-had-its-logging-disabled"
+	}
+	b.logf("c2n bugreport: %s", marker)
+	if note := r.FormValue("note"); note != "" {
+		b.logf("c2n bugreport note: %s", note)
+	}
+	hi, _ := json.Marshal(hostinfo.New())
+	b.logf("c2n bugreport hostinfo: %s", hi)
+	if err := b.HealthTracker().OverallError(); err != nil {
+		b.logf("c2n bugreport health: %s", err.Error())
+	} else {
+		b.logf("c2n bugreport health: ok")
+	}
+	if nm := b.NetMap(); nm != nil {
+		if self := nm.SelfNode; self.Valid() {
+			b.logf("c2n bugreport node info: nodeid=%q stableid=%q expiry=%q", self.ID(), self.StableID(), self.KeyExpiry().Format(time.RFC3339))
+		}
+	} else {
+		b.logf("c2n bugreport netmap: no active netmap")
+	}
+	envknob.LogCurrent(logger.WithPrefix(b.logf, "c2n bugreport: "))
+
+	writeJSON(w, tailcfg.C2NDebugBugReportResponse{Marker: marker})
+}
+
 var c2nLogHeap func(http.ResponseWriter, *http.Request) // non-nil on most platforms (c2n_pprof.go)
 
 func handleC2NDebugLogHeap(b *LocalBackend, w http.ResponseWriter, r *http.Request) {
@@ -246,6 +339,21 @@ func handleC2NAppConnectorDomainRoutesGet(b *LocalBackend, w http.ResponseWriter
 	json.NewEncoder(w).Encode(res)
 }
 
+// handleC2NRouteApprovalsGet returns the routes advertised by the node,
+// their justification and the decisions made about them by an approval
+// agent running on the node.
+func handleC2NRouteApprovalsGet(b *LocalBackend, w http.ResponseWriter, r *http.Request) {
+	b.logf("c2n: GET /routes/approvals received")
+
+	res, err := b.RouteApprovals()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
 func handleC2NSetNetfilterKind(b *LocalBackend, w http.ResponseWriter, r *http.Request) {
 	b.logf("c2n: POST /netfilter-kind received")
 
@@ -290,36 +398,42 @@ func handleC2NUpdateGet(b *LocalBackend, w http.ResponseWriter, r *http.Request)
 
 func handleC2NUpdatePost(b *LocalBackend, w http.ResponseWriter, r *http.Request) {
 	b.logf("c2n: POST /update received")
-	res := b.newC2NUpdateResponse()
-	defer func() {
-		if res.Err != "" {
-			b.logf("c2n: POST /update failed: %s", res.Err)
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(res)
-	}()
+	// Control can set force=true query parameter to update despite active
+	// inbound SSH connections.
+	res := b.startRemoteUpdate("c2n", r.FormValue("force") == "true")
+	if res.Err != "" {
+		b.logf("c2n: POST /update failed: %s", res.Err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
 
+// startRemoteUpdate starts an update requested by control or by a peer, as
+// named by logPrefix, if the user opted in to remote updates. Unless force is
+// set, it doesn't update while there are active inbound SSH connections.
+func (b *LocalBackend) startRemoteUpdate(logPrefix string, force bool) tailcfg.C2NUpdateResponse {
+	res := b.newC2NUpdateResponse()
 	if !res.Enabled {
 		res.Err = "not enabled"
-		return
+		return res
 	}
 	if !res.Supported {
 		res.Err = "not supported"
-		return
+		return res
 	}
 
-	// Do not update if we have active inbound SSH connections. Control can set
-	// force=true query parameter to override this.
-	if r.FormValue("force") != "true" && b.sshServer != nil && b.sshServer.NumActiveConns() > 0 {
+	// Do not update if we have active inbound SSH connections.
+	if !force && b.sshServer != nil && b.sshServer.NumActiveConns() > 0 {
 		res.Err = "not updating due to active SSH connections"
-		return
+		return res
 	}
 
-	if err := b.startAutoUpdate("c2n"); err != nil {
+	if err := b.startAutoUpdate(logPrefix); err != nil {
 		res.Err = err.Error()
-		return
+		return res
 	}
 	res.Started = true
+	return res
 }
 
 func handleC2NPostureIdentityGet(b *LocalBackend, w http.ResponseWriter, r *http.Request) {
@@ -327,20 +441,8 @@ func handleC2NPostureIdentityGet(b *LocalBackend, w http.ResponseWriter, r *http
 
 	res := tailcfg.C2NPostureIdentityResponse{}
 
-	// Only collect posture identity if enabled on the client,
-	// this will first check syspolicy, MDM settings like Registry
-	// on Windows or defaults on macOS. If they are not set, it falls
-	// back to the cli-flag, `--posture-checking`.
-	choice, err := syspolicy.GetPreferenceOption(syspolicy.PostureChecking)
-	if err != nil {
-		b.logf(
-			"c2n: failed to read PostureChecking from syspolicy, returning default from CLI: %s; got error: %s",
-			b.Prefs().PostureChecking(),
-			err,
-		)
-	}
-
-	if choice.ShouldEnable(b.Prefs().PostureChecking()) {
+	if b.postureCheckingEnabled() {
+		var err error
 		res.SerialNumbers, err = posture.GetSerialNumbers(b.logf)
 		if err != nil {
 			b.logf("c2n: GetSerialNumbers returned error: %v", err)
@@ -365,6 +467,47 @@ func handleC2NPostureIdentityGet(b *LocalBackend, w http.ResponseWriter, r *http
 	json.NewEncoder(w).Encode(res)
 }
 
+func handleC2NPostureAttributesGet(b *LocalBackend, w http.ResponseWriter, r *http.Request) {
+	b.logf("c2n: GET /posture/attributes received")
+
+	res := tailcfg.C2NPostureAttributesResponse{}
+	if b.postureCheckingEnabled() {
+		var errs map[string]error
+		res.Attributes, errs = collectPostureAttributes(b.logf)
+		for name, err := range errs {
+			b.logf("c2n: collecting posture attribute %s: %v", name, err)
+			mak.Set(&res.Errors, name, err.Error())
+		}
+	} else {
+		res.PostureDisabled = true
+	}
+
+	b.logf("c2n: posture attributes disabled=%v reported %d attributes, %d errors", res.PostureDisabled, len(res.Attributes), len(res.Errors))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// collectPostureAttributes collects the device posture attributes. It is a
+// variable so tests can replace it.
+var collectPostureAttributes = posture.CollectAttributes
+
+// postureCheckingEnabled reports whether the user has consented to the
+// collection of device posture. It first checks syspolicy, i.e. MDM settings
+// like the Registry on Windows or defaults on macOS, and if that is not set,
+// falls back to the --posture-checking preference.
+func (b *LocalBackend) postureCheckingEnabled() bool {
+	choice, err := syspolicy.GetPreferenceOption(syspolicy.PostureChecking)
+	if err != nil {
+		b.logf(
+			"c2n: failed to read PostureChecking from syspolicy, returning default from CLI: %s; got error: %s",
+			b.Prefs().PostureChecking(),
+			err,
+		)
+	}
+	return choice.ShouldEnable(b.Prefs().PostureChecking())
+}
+
 func (b *LocalBackend) newC2NUpdateResponse() tailcfg.C2NUpdateResponse {
 	// If NewUpdater does not return an error, we can update the installation.
 	//
@@ -396,6 +539,7 @@ func (b *LocalBackend) trySetC2NUpdateStarted() bool {
 		return false
 	}
 	b.c2nUpdateStatus.started = true
+	b.c2nUpdateStatus.lastErr = ""
 	return true
 }
 
@@ -5,17 +5,23 @@
 
 import (
 	"cmp"
+	"context"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"tailscale.com/ipn"
 	"tailscale.com/ipn/store/mem"
+	"tailscale.com/net/netcheck"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tstest"
 	"tailscale.com/types/logger"
@@ -132,3 +138,98 @@ func TestHandleC2NTLSCertStatus(t *testing.T) {
 	}
 
 }
+
+func TestHandleC2NDebugNetcheck(t *testing.T) {
+	b := newTestLocalBackend(t)
+
+	rec := httptest.NewRecorder()
+	handleC2NDebugNetcheck(b, rec, httptest.NewRequest("GET", "/debug/netcheck", nil))
+	var got tailcfg.C2NDebugNetcheckResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("bad JSON: %v", err)
+	}
+	if got.Error == "" || got.Report != nil {
+		t.Errorf("with no report, got %v; want error", logger.AsJSON(got))
+	}
+
+	b.MagicConn().SetLastNetcheckReportForTest(context.Background(), &netcheck.Report{
+		UDP:           true,
+		PreferredDERP: 1,
+	})
+	rec = httptest.NewRecorder()
+	handleC2NDebugNetcheck(b, rec, httptest.NewRequest("GET", "/debug/netcheck", nil))
+	got = tailcfg.C2NDebugNetcheckResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("bad JSON: %v", err)
+	}
+	if got.Error != "" || got.Fresh {
+		t.Fatalf("got %v; want cached report", logger.AsJSON(got))
+	}
+	var report netcheck.Report
+	if err := json.Unmarshal(got.Report, &report); err != nil {
+		t.Fatalf("bad report JSON: %v", err)
+	}
+	if !report.UDP || report.PreferredDERP != 1 {
+		t.Errorf("report = %v; want UDP and PreferredDERP=1", logger.AsJSON(report))
+	}
+}
+
+func TestHandleC2NDebugBugReport(t *testing.T) {
+	b := newTestLocalBackend(t)
+	var logs strings.Builder
+	b.logf = func(format string, args ...any) {
+		fmt.Fprintf(&logs, format+"\n", args...)
+	}
+
+	rec := httptest.NewRecorder()
+	handleC2NDebugBugReport(b, rec, httptest.NewRequest("POST", "/debug/bugreport?note=from+admin", nil))
+	var got tailcfg.C2NDebugBugReportResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("bad JSON: %v", err)
+	}
+	if !strings.HasPrefix(got.Marker, "BUG-") {
+		t.Errorf("marker = %q; want BUG- prefix", got.Marker)
+	}
+	for _, want := range []string{"c2n bugreport: " + got.Marker, "c2n bugreport note: from admin"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs missing %q; got:\n%s", want, logs.String())
+		}
+	}
+}
+
+func TestHandleC2NPostureAttributes(t *testing.T) {
+	tstest.Replace(t, &collectPostureAttributes, func(logger.Logf) (map[string]any, map[string]error) {
+		return map[string]any{"diskEncryption": map[string]any{"Encrypted": true}},
+			map[string]error{"osUpdates": errors.New("no package manager")}
+	})
+	b := newTestLocalBackend(t)
+
+	get := func() tailcfg.C2NPostureAttributesResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handleC2NPostureAttributesGet(b, rec, httptest.NewRequest("GET", "/posture/attributes", nil))
+		var got tailcfg.C2NPostureAttributesResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("bad JSON: %v", err)
+		}
+		return got
+	}
+
+	if got := get(); !got.PostureDisabled || got.Attributes != nil {
+		t.Errorf("without consent, got %v; want posture disabled", logger.AsJSON(got))
+	}
+
+	if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+		Prefs:              ipn.Prefs{PostureChecking: true},
+		PostureCheckingSet: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := tailcfg.C2NPostureAttributesResponse{
+		Attributes: map[string]any{"diskEncryption": map[string]any{"Encrypted": true}},
+		Errors:     map[string]string{"osUpdates": "no package manager"},
+	}
+	if got := get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", logger.AsJSON(got), logger.AsJSON(want))
+	}
+}
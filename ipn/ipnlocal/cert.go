@@ -165,7 +165,18 @@ func (b *LocalBackend) shouldStartDomainRenewal(cs certStore, domain string, now
 		return now.After(renewAt), nil
 	}
 
-	renewTime, err := b.domainRenewalTimeByARI(cs, pair)
+	kind, issuerURL, _ := ipn.ParseCertIssuer(b.certIssuer())
+	if holder, _ := certHolder(); kind == ipn.CertIssuerVault || holder.IsValid() || certShareReadOnly() {
+		// There's no ACME renewal info for certs not issued via ACME by
+		// this node.
+		renewTime, err := b.domainRenewalTimeByExpiry(pair)
+		if err != nil {
+			return false, err
+		}
+		renewCertAt[domain] = renewTime
+		return now.After(renewTime), nil
+	}
+	renewTime, err := b.domainRenewalTimeByARI(cs, issuerURL, pair)
 	if err != nil {
 		// Log any ARI failure and fall back to checking for renewal by expiry.
 		b.logf("acme: ARI check failed: %v; falling back to expiry-based check", err)
@@ -205,7 +216,7 @@ func (b *LocalBackend) domainRenewalTimeByExpiry(pair *TLSCertKeyPair) (time.Tim
 	return renewAt, nil
 }
 
-func (b *LocalBackend) domainRenewalTimeByARI(cs certStore, pair *TLSCertKeyPair) (time.Time, error) {
+func (b *LocalBackend) domainRenewalTimeByARI(cs certStore, directoryURL string, pair *TLSCertKeyPair) (time.Time, error) {
 	var blocks []*pem.Block
 	rest := pair.CertPEM
 	for len(rest) > 0 {
@@ -219,7 +230,7 @@ func (b *LocalBackend) domainRenewalTimeByARI(cs certStore, pair *TLSCertKeyPair
 	if len(blocks) < 1 {
 		return time.Time{}, fmt.Errorf("could not parse certificate chain from certStore, got %d PEM block(s)", len(blocks))
 	}
-	ac, err := acmeClient(cs)
+	ac, err := acmeClient(cs, directoryURL)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -264,7 +275,29 @@ type certStore interface {
 
 var testX509Roots *x509.CertPool // set non-nil by tests
 
+// certIssuer returns the CertIssuer pref of the current profile.
+func (b *LocalBackend) certIssuer() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pm == nil {
+		return ""
+	}
+	return b.pm.CurrentPrefs().CertIssuer()
+}
+
 func (b *LocalBackend) getCertStore() (certStore, error) {
+	kind, _, _ := ipn.ParseCertIssuer(b.certIssuer())
+	holder, _ := certHolder()
+	// Certs from a cert holder may come from whichever issuer it uses.
+	privateCA := kind != ipn.CertIssuerLetsEncrypt || holder.IsValid()
+	shareMode, err := certShare()
+	if err != nil {
+		return nil, err
+	}
+	if shareMode != "" {
+		// Certs are shared with other nodes via the state store.
+		return certStateStore{StateStore: b.store, testRoots: testX509Roots, privateCA: privateCA}, nil
+	}
 	switch b.store.(type) {
 	case *store.FileStore:
 	case *mem.Store:
@@ -273,7 +306,7 @@ func (b *LocalBackend) getCertStore() (certStore, error) {
 			// We're running in Kubernetes with a custom StateStore,
 			// use that instead of the cert directory.
 			// TODO(maisem): expand this to other environments?
-			return certStateStore{StateStore: b.store}, nil
+			return certStateStore{StateStore: b.store, privateCA: privateCA}, nil
 		}
 	}
 	dir, err := b.certDir()
@@ -283,7 +316,7 @@ func (b *LocalBackend) getCertStore() (certStore, error) {
 	if testX509Roots != nil && !testenv.InTest() {
 		panic("use of test hook outside of tests")
 	}
-	return certFileStore{dir: dir, testRoots: testX509Roots}, nil
+	return certFileStore{dir: dir, testRoots: testX509Roots, privateCA: privateCA}, nil
 }
 
 // certFileStore implements certStore by storing the cert & key files in the named directory.
@@ -293,6 +326,10 @@ type certFileStore struct {
 	// This field allows a test to override the CA root(s) for certificate
 	// verification. If nil the default system pool is used.
 	testRoots *x509.CertPool
+
+	// privateCA is whether certs are issued by a private CA rather than
+	// Let's Encrypt. See validCertPEM.
+	privateCA bool
 }
 
 const acmePEMName = "acme-account.key.pem"
@@ -329,7 +366,7 @@ func (f certFileStore) Read(domain string, now time.Time) (*TLSCertKeyPair, erro
 		}
 		return nil, err
 	}
-	if !validCertPEM(domain, keyPEM, certPEM, f.testRoots, now) {
+	if !validCertPEM(domain, keyPEM, certPEM, f.testRoots, f.privateCA, now) {
 		return nil, errCertExpired
 	}
 	return &TLSCertKeyPair{CertPEM: certPEM, KeyPEM: keyPEM, Cached: true}, nil
@@ -350,6 +387,10 @@ type certStateStore struct {
 	// This field allows a test to override the CA root(s) for certificate
 	// verification. If nil the default system pool is used.
 	testRoots *x509.CertPool
+
+	// privateCA is whether certs are issued by a private CA rather than
+	// Let's Encrypt. See validCertPEM.
+	privateCA bool
 }
 
 func (s certStateStore) Read(domain string, now time.Time) (*TLSCertKeyPair, error) {
@@ -361,7 +402,7 @@ func (s certStateStore) Read(domain string, now time.Time) (*TLSCertKeyPair, err
 	if err != nil {
 		return nil, err
 	}
-	if !validCertPEM(domain, keyPEM, certPEM, s.testRoots, now) {
+	if !validCertPEM(domain, keyPEM, certPEM, s.testRoots, s.privateCA, now) {
 		return nil, errCertExpired
 	}
 	return &TLSCertKeyPair{CertPEM: certPEM, KeyPEM: keyPEM, Cached: true}, nil
@@ -435,11 +476,35 @@ func (b *LocalBackend) getCertPEM(ctx context.Context, cs certStore, logf logger
 		} else if !shouldRenew {
 			return p, nil
 		}
+		if certShareReadOnly() {
+			// Keep using the current cert until the node issuing certs
+			// renews it, and check for that again next time.
+			b.domainRenewed(domain)
+			return p, nil
+		}
 	} else if !errors.Is(err, ipn.ErrStateNotExist) && !errors.Is(err, errCertExpired) {
 		return nil, err
 	}
 
-	ac, err := acmeClient(cs)
+	if certShareReadOnly() {
+		return nil, fmt.Errorf("no valid cert for %q in the state store, and TS_CERT_SHARE_MODE is %q; it must be issued by another node", domain, certShareModeRO)
+	}
+	holder, err := certHolder()
+	if err != nil {
+		return nil, err
+	}
+	if holder.IsValid() {
+		return b.getCertPEMFromHolder(ctx, cs, logf, holder, domain)
+	}
+	kind, issuerURL, err := ipn.ParseCertIssuer(b.certIssuer())
+	if err != nil {
+		return nil, err
+	}
+	if kind == ipn.CertIssuerVault {
+		return b.getCertPEMFromVault(ctx, cs, logf, domain, issuerURL)
+	}
+
+	ac, err := acmeClient(cs, issuerURL)
 	if err != nil {
 		return nil, err
 	}
@@ -468,7 +533,7 @@ func (b *LocalBackend) getCertPEM(ctx context.Context, cs certStore, logf logger
 		return nil, fmt.Errorf("unexpected ACME account status %q", a.Status)
 	}
 
-	// Before hitting LetsEncrypt, see if this is a domain that Tailscale will do DNS challenges for.
+	// Before hitting the ACME server, see if this is a domain that Tailscale will do DNS challenges for.
 	st := b.StatusWithoutPeers()
 	if err := checkCertDomain(st, domain); err != nil {
 		return nil, err
@@ -648,17 +713,20 @@ func acmeKey(cs certStore) (crypto.Signer, error) {
 	return privKey, nil
 }
 
-func acmeClient(cs certStore) (*acme.Client, error) {
+// acmeClient returns a client of the ACME directory at directoryURL, or of
+// Let's Encrypt if it's empty.
+func acmeClient(cs certStore, directoryURL string) (*acme.Client, error) {
 	key, err := acmeKey(cs)
 	if err != nil {
 		return nil, fmt.Errorf("acmeKey: %w", err)
 	}
-	// Note: if we add support for additional ACME providers (other than
-	// LetsEncrypt), we should make sure that they support ARI extension (see
-	// shouldStartDomainRenewalARI).
+	// Note: ACME directories other than Let's Encrypt's may not support the
+	// ARI extension, in which case shouldStartDomainRenewal falls back to
+	// renewing by expiry.
 	return &acme.Client{
-		Key:       key,
-		UserAgent: "tailscaled/" + version.Long(),
+		Key:          key,
+		DirectoryURL: directoryURL,
+		UserAgent:    "tailscaled/" + version.Long(),
 	}, nil
 }
 
@@ -666,7 +734,10 @@ func acmeClient(cs certStore) (*acme.Client, error) {
 //
 // If roots != nil, it is used instead of the system root pool. This is meant
 // to support testing, and production code should pass roots == nil.
-func validCertPEM(domain string, keyPEM, certPEM []byte, roots *x509.CertPool, now time.Time) bool {
+//
+// If privateCA is set, the certificate was issued by a private CA that this
+// node needn't trust, so the CA certificates in certPEM are trusted as roots.
+func validCertPEM(domain string, keyPEM, certPEM []byte, roots *x509.CertPool, privateCA bool, now time.Time) bool {
 	if len(keyPEM) == 0 || len(certPEM) == 0 {
 		return false
 	}
@@ -691,6 +762,9 @@ func validCertPEM(domain string, keyPEM, certPEM []byte, roots *x509.CertPool, n
 	if leaf == nil {
 		return false
 	}
+	if privateCA && roots == nil {
+		roots = intermediates
+	}
 	_, err = leaf.Verify(x509.VerifyOptions{
 		DNSName:       domain,
 		CurrentTime:   now,
@@ -6,6 +6,7 @@
 import (
 	"context"
 	"errors"
+	"net/http"
 	"time"
 )
 
@@ -28,3 +29,7 @@ func getCertPEMCached(cs certStore, domain string, now time.Time) (p *TLSCertKey
 func (b *LocalBackend) getCertStore() (certStore, error) {
 	return nil, errors.New("not implemented for js/wasm")
 }
+
+func (h *peerAPIHandler) handleServeCert(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "not implemented for js/wasm", http.StatusNotImplemented)
+}
@@ -0,0 +1,144 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !js
+
+package ipnlocal
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"tailscale.com/envknob"
+	"tailscale.com/types/logger"
+	"tailscale.com/version"
+)
+
+// vaultSignRequest is the request body of the sign endpoint of a Vault PKI
+// role.
+type vaultSignRequest struct {
+	CSR        string `json:"csr"`
+	CommonName string `json:"common_name"`
+	Format     string `json:"format"`
+}
+
+// vaultSignResponse is the response body of the sign endpoint of a Vault PKI
+// role.
+type vaultSignResponse struct {
+	Data struct {
+		Certificate string   `json:"certificate"`
+		IssuingCA   string   `json:"issuing_ca"`
+		CAChain     []string `json:"ca_chain"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// getCertPEMFromVault gets a new cert for domain from the sign endpoint of a
+// Vault PKI role at signURL, authenticating with the token in tailscaled's
+// VAULT_TOKEN environment variable, and writes it to cs. The private key is
+// generated locally and never sent to Vault.
+func (b *LocalBackend) getCertPEMFromVault(ctx context.Context, cs certStore, logf logger.Logf, domain, signURL string) (*TLSCertKeyPair, error) {
+	token := envknob.String("VAULT_TOKEN")
+	if token == "" {
+		return nil, errors.New("cert issuer is Vault, but VAULT_TOKEN is not set in tailscaled's environment")
+	}
+	st := b.StatusWithoutPeers()
+	if err := checkCertDomain(st, domain); err != nil {
+		return nil, err
+	}
+
+	certPrivKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	var privPEM bytes.Buffer
+	if err := encodeECDSAKey(&privPEM, certPrivKey); err != nil {
+		return nil, err
+	}
+	csr, err := certRequest(certPrivKey, domain, nil, domain)
+	if err != nil {
+		return nil, err
+	}
+	reqBody, err := json.Marshal(vaultSignRequest{
+		CSR:        string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		CommonName: domain,
+		Format:     "pem",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logf("requesting cert from Vault...")
+	req, err := http.NewRequestWithContext(ctx, "POST", signURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tailscaled/"+version.Long())
+	req.Header.Set("X-Vault-Token", token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	var sr vaultSignResponse
+	if err := json.Unmarshal(body, &sr); err != nil && res.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("vault: decoding response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		if len(sr.Errors) > 0 {
+			return nil, fmt.Errorf("vault: %v: %s", res.Status, strings.Join(sr.Errors, "; "))
+		}
+		return nil, fmt.Errorf("vault: %v", res.Status)
+	}
+	certPEM, err := vaultCertChainPEM(&sr)
+	if err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	logf("got cert")
+
+	if err := cs.WriteKey(domain, privPEM.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := cs.WriteCert(domain, certPEM); err != nil {
+		return nil, err
+	}
+	b.domainRenewed(domain)
+	return &TLSCertKeyPair{CertPEM: certPEM, KeyPEM: privPEM.Bytes()}, nil
+}
+
+// vaultCertChainPEM returns the cert chain in sr, leaf first, as
+// concatenated PEM blocks.
+func vaultCertChainPEM(sr *vaultSignResponse) ([]byte, error) {
+	if sr.Data.Certificate == "" {
+		return nil, errors.New("no certificate in response")
+	}
+	chain := sr.Data.CAChain
+	if len(chain) == 0 && sr.Data.IssuingCA != "" {
+		chain = []string{sr.Data.IssuingCA}
+	}
+	var buf bytes.Buffer
+	for _, c := range append([]string{sr.Data.Certificate}, chain...) {
+		c = strings.TrimSpace(c)
+		if block, _ := pem.Decode([]byte(c)); block == nil || block.Type != "CERTIFICATE" {
+			return nil, errors.New("invalid certificate PEM in response")
+		}
+		buf.WriteString(c)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
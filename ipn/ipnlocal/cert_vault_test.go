@@ -0,0 +1,136 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ios && !android && !js
+
+package ipnlocal
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+)
+
+func TestGetCertPEMFromVault(t *testing.T) {
+	const domain = "foo.tail-scale.ts.net"
+
+	// A private CA, standing in for a Vault PKI secrets engine.
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Corp Private CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+
+	var gotCommonName string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/pki/sign/ts-net" || r.Header.Get("X-Vault-Token") != "s.test" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(vaultSignResponse{Errors: []string{"permission denied"}})
+			return
+		}
+		var req vaultSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+		gotCommonName = req.CommonName
+		block, _ := pem.Decode([]byte(req.CSR))
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: req.CommonName},
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, caCert, csr.PublicKey, caKey)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var res vaultSignResponse
+		res.Data.Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+		res.Data.IssuingCA = caPEM
+		res.Data.CAChain = []string{caPEM}
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+
+	b := newTestLocalBackend(t)
+	b.mu.Lock()
+	b.netMap = &netmap.NetworkMap{
+		SelfNode: (&tailcfg.Node{}).View(),
+		DNS:      tailcfg.DNSConfig{CertDomains: []string{domain}},
+	}
+	b.mu.Unlock()
+	cs := certFileStore{dir: t.TempDir(), privateCA: true}
+	ctx := context.Background()
+
+	t.Setenv("VAULT_TOKEN", "")
+	if _, err := b.getCertPEMFromVault(ctx, cs, t.Logf, domain, srv.URL+"/v1/pki/sign/ts-net"); err == nil {
+		t.Error("got cert without VAULT_TOKEN")
+	}
+	t.Setenv("VAULT_TOKEN", "s.wrong")
+	if _, err := b.getCertPEMFromVault(ctx, cs, t.Logf, domain, srv.URL+"/v1/pki/sign/ts-net"); err == nil {
+		t.Error("got cert with wrong token")
+	}
+	t.Setenv("VAULT_TOKEN", "s.test")
+	if _, err := b.getCertPEMFromVault(ctx, cs, t.Logf, "bar.example.com", srv.URL+"/v1/pki/sign/ts-net"); err == nil {
+		t.Error("got cert for domain that isn't the node's")
+	}
+	pair, err := b.getCertPEMFromVault(ctx, cs, t.Logf, domain, srv.URL+"/v1/pki/sign/ts-net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotCommonName != domain {
+		t.Errorf("Vault got common name %q; want %q", gotCommonName, domain)
+	}
+
+	// The stored cert is valid as issued by the private CA, though this
+	// node doesn't trust it.
+	got, err := cs.Read(domain, time.Now())
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(got.CertPEM) != string(pair.CertPEM) || string(got.KeyPEM) != string(pair.KeyPEM) {
+		t.Error("stored cert and key differ from returned ones")
+	}
+	cs.privateCA = false
+	if _, err := cs.Read(domain, time.Now()); err != errCertExpired {
+		t.Errorf("Read without trusting private CA: err = %v; want %v", err, errCertExpired)
+	}
+}
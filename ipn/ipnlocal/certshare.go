@@ -0,0 +1,173 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !js
+
+package ipnlocal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/logger"
+)
+
+// Nodes serving the same HTTPS name, such as the replicas of a Kubernetes
+// ProxyGroup, can share one cert rather than each issuing its own and
+// running into ACME rate limits. There are two ways to do so:
+//
+//   - Via a shared state store: one node runs with TS_CERT_SHARE_MODE=rw
+//     and issues certs into the store, and the others run with
+//     TS_CERT_SHARE_MODE=ro and only ever read certs from it.
+//   - Via a cert holder: nodes run with TS_CERT_HOLDER set to the Tailscale
+//     IP of a node that issues certs and serves them over its peerapi to
+//     peers granted the tailscale.com/cap/cert-share capability.
+var (
+	certShareMode = envknob.RegisterString("TS_CERT_SHARE_MODE")
+	certHolderIP  = envknob.RegisterString("TS_CERT_HOLDER")
+)
+
+const (
+	certShareModeRO = "ro" // read certs from the state store; never issue them
+	certShareModeRW = "rw" // issue certs into the state store for others
+)
+
+// certHolder returns the Tailscale IP of the node to get certs from, per
+// TS_CERT_HOLDER, or the zero value if certs are issued by this node.
+func certHolder() (netip.Addr, error) {
+	s := certHolderIP()
+	if s == "" {
+		return netip.Addr{}, nil
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid TS_CERT_HOLDER %q; must be a Tailscale IP", s)
+	}
+	return ip, nil
+}
+
+// certShare returns how this node shares certs via the state store, per
+// TS_CERT_SHARE_MODE: certShareModeRO, certShareModeRW, or empty if it
+// doesn't.
+func certShare() (mode string, err error) {
+	switch s := certShareMode(); s {
+	case "", certShareModeRO, certShareModeRW:
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid TS_CERT_SHARE_MODE %q; must be %q or %q", s, certShareModeRO, certShareModeRW)
+	}
+}
+
+// certShareReadOnly reports whether this node only reads certs issued by
+// another node into the shared state store.
+func certShareReadOnly() bool {
+	mode, _ := certShare()
+	return mode == certShareModeRO
+}
+
+// canShareCerts reports whether h can get this node's certs.
+func (h *peerAPIHandler) canShareCerts() bool {
+	if h.peerNode.UnsignedPeerAPIOnly() {
+		return false
+	}
+	return h.peerHasCap(tailcfg.PeerCapabilityCertShare)
+}
+
+// handleServeCert serves the cert and private key for the domain in the
+// "domain" query parameter to a peer sharing this node's certs, issuing the
+// cert first if needed.
+func (h *peerAPIHandler) handleServeCert(w http.ResponseWriter, r *http.Request) {
+	if !h.canShareCerts() {
+		http.Error(w, "denied; no cert-share access", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	b := h.ps.b
+	domain := r.FormValue("domain")
+	if err := checkCertDomain(b.StatusWithoutPeers(), domain); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pair, err := b.GetCertPEM(r.Context(), domain)
+	if err != nil {
+		h.logf("getting cert for %q shared with %v: %v", domain, h.peerNode.ComputedName(), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.logf("sharing cert for %q with %v", domain, h.peerNode.ComputedName())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pair)
+}
+
+// getCertPEMFromHolder gets the cert for domain from the peerapi of the
+// cert holder with Tailscale IP holder, and writes it to cs.
+func (b *LocalBackend) getCertPEMFromHolder(ctx context.Context, cs certStore, logf logger.Logf, holder netip.Addr, domain string) (*TLSCertKeyPair, error) {
+	// Issuing the cert on the holder can take a while.
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	nm := b.NetMap()
+	if nm == nil {
+		return nil, errors.New("no netmap")
+	}
+	peer, ok := nm.PeerByTailscaleIP(holder)
+	if !ok {
+		return nil, fmt.Errorf("cert holder %v not found", holder)
+	}
+	base := peerAPIBase(nm, peer)
+	if base == "" {
+		return nil, fmt.Errorf("no PeerAPI base found for cert holder %v", holder)
+	}
+
+	logf("requesting cert from cert holder %v...", peer.ComputedName())
+	req, err := http.NewRequestWithContext(ctx, "GET", base+"/v0/cert?domain="+url.QueryEscape(domain), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.Dialer().PeerAPIHTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cert holder: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("cert holder: %w", err)
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden, http.StatusNotFound:
+		return nil, fmt.Errorf("cert holder %v does not share certs with this node; it needs to grant %s", peer.ComputedName(), tailcfg.PeerCapabilityCertShare)
+	default:
+		return nil, fmt.Errorf("cert holder %v: %v: %s", peer.ComputedName(), res.Status, strings.TrimSpace(string(body)))
+	}
+	pair := new(TLSCertKeyPair)
+	if err := json.Unmarshal(body, pair); err != nil {
+		return nil, fmt.Errorf("cert holder %v: %w", peer.ComputedName(), err)
+	}
+	if !validCertPEM(domain, pair.KeyPEM, pair.CertPEM, nil, true, b.clock.Now()) {
+		return nil, fmt.Errorf("cert holder %v returned an invalid cert", peer.ComputedName())
+	}
+	pair.Cached = false
+	logf("got cert")
+
+	if err := cs.WriteKey(domain, pair.KeyPEM); err != nil {
+		return nil, err
+	}
+	if err := cs.WriteCert(domain, pair.CertPEM); err != nil {
+		return nil, err
+	}
+	b.domainRenewed(domain)
+	return pair, nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ios && !android && !js
+
+package ipnlocal
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+	"tailscale.com/wgengine/filter"
+)
+
+func TestCertShare(t *testing.T) {
+	const domain = "foo.tail-scale.ts.net"
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	testX509Roots = roots
+	defer func() { testX509Roots = nil }()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	var keyPEM bytes.Buffer
+	if err := encodeECDSAKey(&keyPEM, key); err != nil {
+		t.Fatal(err)
+	}
+
+	envknob.Setenv("TS_CERT_SHARE_MODE", "ro")
+	defer envknob.Setenv("TS_CERT_SHARE_MODE", "")
+
+	b := newTestLocalBackend(t)
+	b.mu.Lock()
+	b.netMap = &netmap.NetworkMap{
+		SelfNode: (&tailcfg.Node{
+			Addresses: []netip.Prefix{netip.MustParsePrefix("100.100.100.100/32")},
+		}).View(),
+		DNS: tailcfg.DNSConfig{CertDomains: []string{domain}},
+	}
+	b.mu.Unlock()
+
+	// A read-only node never issues certs itself.
+	if _, err := b.GetCertPEM(context.Background(), domain); err == nil {
+		t.Fatal("read-only node got cert before it was stored")
+	}
+	cs, err := b.getCertStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cs.(certStateStore); !ok {
+		t.Fatalf("cert store = %T; want certStateStore", cs)
+	}
+	if err := cs.WriteKey(domain, keyPEM.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.WriteCert(domain, certPEM); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetCertPEM(context.Background(), domain); err != nil {
+		t.Fatalf("read-only node: %v", err)
+	}
+
+	h := &peerAPIHandler{
+		ps:         &peerAPIServer{b: b},
+		remoteAddr: netip.MustParseAddrPort("100.100.100.101:12345"),
+		selfNode:   b.netMap.SelfNode,
+		peerNode:   (&tailcfg.Node{}).View(),
+	}
+	serve := func(domain string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.handleServeCert(rec, httptest.NewRequest("GET", "/v0/cert?domain="+domain, nil))
+		return rec
+	}
+	if rec := serve(domain); rec.Code != http.StatusForbidden {
+		t.Errorf("peer without capability: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	mm, err := filter.MatchesFromFilterRules([]tailcfg.FilterRule{{
+		SrcIPs: []string{"100.100.100.101"},
+		CapGrant: []tailcfg.CapGrant{{
+			Dsts: []netip.Prefix{netip.MustParsePrefix("100.100.100.100/32")},
+			Caps: []tailcfg.PeerCapability{tailcfg.PeerCapabilityCertShare},
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.setFilter(filter.New(mm, nil, nil, nil, nil, t.Logf))
+
+	if rec := serve("bar.example.com"); rec.Code != http.StatusBadRequest {
+		t.Errorf("other domain: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec := serve(domain)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusOK, rec.Body.Bytes())
+	}
+	var got TLSCertKeyPair
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.CertPEM, certPEM) || !bytes.Equal(got.KeyPEM, keyPEM.Bytes()) {
+		t.Error("shared cert and key differ from stored ones")
+	}
+}
+
+func TestCertShareModeInvalid(t *testing.T) {
+	envknob.Setenv("TS_CERT_SHARE_MODE", "readonly")
+	defer envknob.Setenv("TS_CERT_SHARE_MODE", "")
+
+	b := newTestLocalBackend(t)
+	if _, err := b.getCertStore(); err == nil {
+		t.Error("getCertStore succeeded with an invalid TS_CERT_SHARE_MODE")
+	}
+	if certShareReadOnly() {
+		t.Error("certShareReadOnly with an invalid TS_CERT_SHARE_MODE")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"slices"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/conffile"
+)
+
+// ValidateConfig parses raw as the contents of a config file at path and
+// reports whether it's valid, without applying it. If it is, it returns the
+// changes that applying it with [LocalBackend.ReloadConfig] would make to the
+// current prefs.
+//
+// The path is only used in error messages.
+func (b *LocalBackend) ValidateConfig(path string, raw []byte) ([]apitype.ConfigChange, error) {
+	conf, err := conffile.Parse(path, raw)
+	if err != nil {
+		return nil, err
+	}
+	mp, err := conf.Parsed.ToPrefs()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config to prefs: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := b.pm.CurrentPrefs().AsStruct()
+	p := old.Clone()
+	p.ApplyEdits(&mp)
+	if err := b.checkPrefValuesLocked(p); err != nil {
+		return nil, err
+	}
+
+	changes := diffPrefs(old, p)
+	var oldEndpoints []netip.AddrPort
+	if b.conf != nil {
+		oldEndpoints = b.conf.Parsed.StaticEndpoints
+	}
+	if !slices.Equal(oldEndpoints, conf.Parsed.StaticEndpoints) {
+		changes = append(changes, configChange("StaticEndpoints", oldEndpoints, conf.Parsed.StaticEndpoints))
+	}
+	return changes, nil
+}
+
+// diffPrefs returns the fields that differ between old and new, in the order
+// they're declared in ipn.Prefs. Persist is not compared, as config files
+// can't change it. Nil and empty slices and maps are considered equal.
+func diffPrefs(old, new *ipn.Prefs) []apitype.ConfigChange {
+	var changes []apitype.ConfigChange
+	ov, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	t := ov.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Name == "Persist" {
+			continue
+		}
+		of, nf := ov.Field(i), nv.Field(i)
+		if reflect.DeepEqual(of.Interface(), nf.Interface()) {
+			continue
+		}
+		switch of.Kind() {
+		case reflect.Slice, reflect.Map:
+			if of.Len() == 0 && nf.Len() == 0 {
+				continue
+			}
+		}
+		changes = append(changes, configChange(sf.Name, of.Interface(), nf.Interface()))
+	}
+	return changes
+}
+
+func configChange(field string, old, new any) apitype.ConfigChange {
+	return apitype.ConfigChange{
+		Field: field,
+		Old:   jsonString(old),
+		New:   jsonString(new),
+	}
+}
+
+func jsonString(v any) string {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(j)
+}
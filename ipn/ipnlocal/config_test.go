@@ -0,0 +1,88 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"reflect"
+	"testing"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/ipn"
+)
+
+func TestValidateConfig(t *testing.T) {
+	b := newTestLocalBackend(t)
+	prefs := ipn.NewPrefs()
+	prefs.RouteAll = false
+	prefs.Hostname = "foo"
+	prefs.WantRunning = true
+	if err := b.pm.SetPrefs(prefs.View(), ipn.NetworkProfile{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		conf    string
+		want    []apitype.ConfigChange
+		wantErr bool
+	}{
+		{
+			name: "no_changes",
+			conf: `{"version": "alpha0", "Hostname": "foo", "acceptRoutes": false}`,
+		},
+		{
+			name: "changes",
+			conf: `{
+				// HuJSON is accepted.
+				"version": "alpha0",
+				"Hostname": "bar",
+				"acceptRoutes": true,
+				"AdvertiseRoutes": ["10.0.0.0/24"],
+				"StaticEndpoints": ["1.2.3.4:41641"],
+			}`,
+			want: []apitype.ConfigChange{
+				{Field: "RouteAll", Old: "false", New: "true"},
+				{Field: "Hostname", Old: `"foo"`, New: `"bar"`},
+				{Field: "AdvertiseRoutes", Old: "null", New: `["10.0.0.0/24"]`},
+				{Field: "StaticEndpoints", Old: "null", New: `["1.2.3.4:41641"]`},
+			},
+		},
+		{
+			name:    "bad_version",
+			conf:    `{"version": "beta1"}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown_field",
+			conf:    `{"version": "alpha0", "NoSuchField": true}`,
+			wantErr: true,
+		},
+		{
+			name:    "bad_netfilter_mode",
+			conf:    `{"version": "alpha0", "NetfilterMode": "sometimes"}`,
+			wantErr: true,
+		},
+		{
+			name:    "bad_prefs",
+			conf:    `{"version": "alpha0", "Hostname": "badhostname.tailscale."}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.ValidateConfig("test.conf", []byte(tt.conf))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v; want error: %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changes = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Validating doesn't apply the config.
+	if got := b.Prefs().Hostname(); got != "foo" {
+		t.Errorf("Hostname = %q after validating; want %q", got, "foo")
+	}
+}
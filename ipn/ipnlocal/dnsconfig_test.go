@@ -16,6 +16,7 @@
 	"tailscale.com/tstest"
 	"tailscale.com/types/dnstype"
 	"tailscale.com/types/netmap"
+	"tailscale.com/types/ptr"
 	"tailscale.com/util/cloudenv"
 	"tailscale.com/util/dnsname"
 )
@@ -311,6 +312,67 @@ func TestDNSConfigForNetmap(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "exit_node_fail_closed_reachable",
+			nm: &netmap.NetworkMap{
+				DNS: tailcfg.DNSConfig{
+					FallbackResolvers: []*dnstype.Resolver{
+						{Addr: "8.8.4.4"},
+					},
+				},
+			},
+			peers: nodeViews([]*tailcfg.Node{
+				{
+					ID:       1,
+					StableID: "some-id",
+					Name:     "exit.net",
+					Online:   ptr.To(true),
+					Hostinfo: (&tailcfg.Hostinfo{}).View(),
+				},
+			}),
+			prefs: &ipn.Prefs{
+				CorpDNS:            true,
+				ExitNodeID:         "some-id",
+				ExitNodeFailClosed: true,
+			},
+			want: &dns.Config{
+				Hosts:  map[dnsname.FQDN][]netip.Addr{},
+				Routes: map[dnsname.FQDN][]*dnstype.Resolver{},
+				DefaultResolvers: []*dnstype.Resolver{
+					{Addr: "8.8.4.4"},
+				},
+			},
+		},
+		{
+			name: "exit_node_fail_closed_unreachable",
+			nm: &netmap.NetworkMap{
+				DNS: tailcfg.DNSConfig{
+					FallbackResolvers: []*dnstype.Resolver{
+						{Addr: "8.8.4.4"},
+					},
+				},
+			},
+			peers: nodeViews([]*tailcfg.Node{
+				{
+					ID:       1,
+					StableID: "some-id",
+					Name:     "exit.net",
+					Online:   ptr.To(false),
+					Hostinfo: (&tailcfg.Hostinfo{}).View(),
+				},
+			}),
+			prefs: &ipn.Prefs{
+				CorpDNS:            true,
+				ExitNodeID:         "some-id",
+				ExitNodeFailClosed: true,
+			},
+			want: &dns.Config{
+				Hosts: map[dnsname.FQDN][]netip.Addr{},
+				Routes: map[dnsname.FQDN][]*dnstype.Resolver{
+					".": nil,
+				},
+			},
+		},
 		{
 			name: "not_exit_node_NOT_need_fallbacks",
 			nm: &netmap.NetworkMap{
@@ -0,0 +1,130 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"tailscale.com/drive"
+	"tailscale.com/util/mak"
+	"tailscale.com/util/set"
+)
+
+// driveAuditedMethods are the WebDAV methods whose requests to shares are
+// audited. Directory listings (PROPFIND) and locking are too chatty to be
+// worth recording.
+var driveAuditedMethods = set.Of("GET", "PUT", "DELETE", "MOVE", "COPY", "MKCOL", "PROPPATCH")
+
+const (
+	// driveAuditRecent is how many accesses are kept in memory for "tailscale
+	// drive status".
+	driveAuditRecent = 100
+
+	// driveAuditLogName is the name of the audit log in the Tailscale var
+	// root, and driveAuditMaxLogSize is the size at which it's rotated.
+	driveAuditLogName    = "drive-audit.log"
+	driveAuditMaxLogSize = 10 << 20
+)
+
+// driveAudit records remote nodes' accesses to Taildrive shares.
+type driveAudit struct {
+	mu     sync.Mutex
+	recent []drive.AccessEvent           // up to driveAuditRecent, oldest first
+	shares map[string]*drive.ShareStatus // by share name; Share is unset
+}
+
+// driveAuditLogPath returns the path of the Taildrive audit log, or the empty
+// string if there's nowhere to write it.
+func (b *LocalBackend) driveAuditLogPath() string {
+	root := b.TailscaleVarRoot()
+	if root == "" {
+		return ""
+	}
+	return filepath.Join(root, driveAuditLogName)
+}
+
+// driveRecordAccess records ev in the Taildrive audit log.
+//
+// File paths aren't logged with b.logf, as they'd leave the node, so they're
+// only kept in memory and written to a local file.
+func (b *LocalBackend) driveRecordAccess(ev drive.AccessEvent) {
+	a := &b.driveAudit
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.recent) == driveAuditRecent {
+		a.recent = append(a.recent[:0], a.recent[1:]...)
+	}
+	a.recent = append(a.recent, ev)
+
+	st, ok := a.shares[ev.Share]
+	if !ok {
+		st = new(drive.ShareStatus)
+		mak.Set(&a.shares, ev.Share, st)
+	}
+	st.Accesses++
+	st.LastAccess = ev.Time
+	st.BytesSent += ev.BytesSent
+	st.BytesReceived += ev.BytesReceived
+
+	if path := b.driveAuditLogPath(); path != "" {
+		if err := appendDriveAuditLog(path, ev); err != nil {
+			b.logf("taildrive: writing audit log: %v", err)
+		}
+	}
+}
+
+// appendDriveAuditLog appends ev to the audit log at path as a line of JSON,
+// first rotating the log if it's too large.
+func appendDriveAuditLog(path string, ev drive.AccessEvent) error {
+	j, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Size() >= driveAuditMaxLogSize {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(j, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// DriveStatus returns the status of the Taildrive shares and their recent
+// accesses by remote nodes.
+func (b *LocalBackend) DriveStatus() (*drive.Status, error) {
+	if !b.DriveSharingEnabled() {
+		return nil, drive.ErrDriveNotEnabled
+	}
+	b.mu.Lock()
+	shares := b.pm.prefs.DriveShares()
+	b.mu.Unlock()
+
+	st := &drive.Status{
+		AuditLogPath: b.driveAuditLogPath(),
+	}
+	a := &b.driveAudit
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, share := range shares.All() {
+		ss := new(drive.ShareStatus)
+		if accessed, ok := a.shares[share.Name()]; ok {
+			*ss = *accessed
+		}
+		ss.Share = share.AsStruct()
+		st.Shares = append(st.Shares, ss)
+	}
+	st.RecentAccesses = append([]drive.AccessEvent(nil), a.recent...)
+	return st, nil
+}
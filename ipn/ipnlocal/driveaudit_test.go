@@ -0,0 +1,53 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tailscale.com/drive"
+)
+
+func TestAppendDriveAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), driveAuditLogName)
+	ev := drive.AccessEvent{Share: "docs", Path: "/a.txt", Method: "GET", Status: 200, BytesSent: 3}
+	for range 2 {
+		if err := appendDriveAuditLog(path, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), b)
+	}
+	var got drive.AccessEvent
+	if err := json.Unmarshal(lines[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != ev {
+		t.Errorf("got %+v, want %+v", got, ev)
+	}
+
+	// A log that's too large is rotated before appending.
+	if err := os.Truncate(path, driveAuditMaxLogSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendDriveAuditLog(path, ev); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path + ".1"); err != nil || fi.Size() != driveAuditMaxLogSize {
+		t.Errorf("rotated log: %v, %v", fi, err)
+	}
+	if b, err := os.ReadFile(path); err != nil || bytes.Count(b, []byte("\n")) != 1 {
+		t.Errorf("new log = %q, %v; want one line", b, err)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tstime"
+)
+
+const (
+	// hostIdlePollInterval is how often the control client is resumed to
+	// catch up on netmap changes while the host is idle.
+	hostIdlePollInterval = 10 * time.Minute
+
+	// hostIdlePollDuration is how long the control client stays resumed
+	// for each of those polls.
+	hostIdlePollDuration = 30 * time.Second
+)
+
+// hostIdleState is the power state of the host, as reported by the platform,
+// and what the backend does to save power while the host is idle.
+//
+// Its fields are guarded by LocalBackend.mu.
+type hostIdleState struct {
+	power ipn.PowerState
+	poll  *hostIdlePoll // non-nil while power.Idle()
+
+	// endpointsPending is whether the endpoints changed while the control
+	// client was paused between polls, and are still to be sent.
+	endpointsPending bool
+}
+
+// hostIdlePoll schedules the polls of control while the host is idle.
+type hostIdlePoll struct {
+	timer   tstime.TimerController
+	polling bool // whether the control client is resumed for a poll
+}
+
+// PowerState returns the power state of the host last set by SetPowerState.
+func (b *LocalBackend) PowerState() ipn.PowerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.hostIdle.power
+}
+
+// SetPowerState sets the power state of the host, as reported by the
+// platform's GUI or service when the host sleeps, wakes, turns off its
+// screen or enters a low-power mode.
+//
+// While the host is idle (see ipn.PowerState.Idle), the backend saves power
+// by keeping the radio quiet: once Running, its control client is paused
+// except for a short poll every hostIdlePollInterval, endpoint changes are
+// held until the next poll to be sent in one update, and magicsock stops
+// keeping paths to idle peers warm (see magicsock.Conn.SetHostIdle). Traffic
+// with peers is unaffected, and all of it is undone when the host is active
+// again.
+func (b *LocalBackend) SetPowerState(ps ipn.PowerState) {
+	b.mu.Lock()
+	if ps == b.hostIdle.power {
+		b.mu.Unlock()
+		return
+	}
+	b.logf("host power state: low-power=%v screen-off=%v", ps.LowPower, ps.ScreenOff)
+	wasIdle := b.hostIdle.power.Idle()
+	b.hostIdle.power = ps
+	idle := ps.Idle()
+	if idle == wasIdle {
+		b.mu.Unlock()
+		return
+	}
+	if idle {
+		b.startHostIdlePollLocked()
+	} else {
+		b.stopHostIdlePollLocked()
+	}
+	b.pauseOrResumeControlClientLocked()
+	b.mu.Unlock()
+
+	b.MagicConn().SetHostIdle(idle)
+}
+
+// startHostIdlePollLocked starts scheduling the polls of control while the
+// host is idle.
+//
+// b.mu must be held.
+func (b *LocalBackend) startHostIdlePollLocked() {
+	if b.shutdownCalled {
+		return
+	}
+	b.stopHostIdlePollLocked()
+	p := &hostIdlePoll{}
+	p.timer = b.clock.AfterFunc(hostIdlePollInterval, func() { b.hostIdlePollTick(p) })
+	b.hostIdle.poll = p
+}
+
+// stopHostIdlePollLocked stops scheduling the polls of control, if it was.
+//
+// b.mu must be held.
+func (b *LocalBackend) stopHostIdlePollLocked() {
+	if p := b.hostIdle.poll; p != nil {
+		p.timer.Stop()
+		b.hostIdle.poll = nil
+	}
+}
+
+// hostIdlePollTick starts or ends a poll of control while the host is idle.
+func (b *LocalBackend) hostIdlePollTick(p *hostIdlePoll) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.hostIdle.poll != p {
+		// Stopped or replaced since the timer fired.
+		return
+	}
+	p.polling = !p.polling
+	next := hostIdlePollInterval
+	if p.polling {
+		next = hostIdlePollDuration
+	}
+	p.timer.Reset(next)
+	b.pauseOrResumeControlClientLocked()
+}
+
+// hostIdleControlPausedLocked reports whether the control client should be
+// paused because the host is idle and not polling control. Only a Running
+// backend is paused, so that logging in isn't held up.
+//
+// b.mu must be held.
+func (b *LocalBackend) hostIdleControlPausedLocked() bool {
+	p := b.hostIdle.poll
+	return p != nil && !p.polling && b.state == ipn.Running
+}
+
+// flushHostIdleEndpointsLocked sends the endpoints to control if they
+// changed while the control client was paused between polls.
+//
+// b.mu must be held.
+func (b *LocalBackend) flushHostIdleEndpointsLocked() {
+	if !b.hostIdle.endpointsPending {
+		return
+	}
+	b.hostIdle.endpointsPending = false
+	if b.cc != nil {
+		b.cc.UpdateEndpoints(b.endpoints)
+	}
+}
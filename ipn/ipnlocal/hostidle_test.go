@@ -0,0 +1,101 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/control/controlclient"
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstest"
+	"tailscale.com/types/netmap"
+	"tailscale.com/wgengine"
+)
+
+func TestHostIdle(t *testing.T) {
+	b := newTestLocalBackend(t)
+	cc := newClient(t, controlclient.Options{Logf: t.Logf})
+	prefs := ipn.NewPrefs()
+	prefs.WantRunning = true
+	if err := b.pm.SetPrefs(prefs.View(), ipn.NetworkProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	b.mu.Lock()
+	b.clock = tstest.NewClock(tstest.ClockOpts{})
+	b.cc = cc
+	b.netMap = &netmap.NetworkMap{
+		SelfNode: (&tailcfg.Node{MachineAuthorized: true}).View(),
+	}
+	b.state = ipn.Running
+	b.mu.Unlock()
+
+	// tick fires the timer of the polls of control, as the test clock
+	// can't run a timer func that resets its own timer.
+	tick := func() {
+		t.Helper()
+		b.mu.Lock()
+		p := b.hostIdle.poll
+		b.mu.Unlock()
+		if p == nil {
+			t.Fatal("control isn't polled while idle")
+		}
+		b.hostIdlePollTick(p)
+	}
+	setEndpoints := func(port uint16) {
+		t.Helper()
+		b.setWgengineStatus(&wgengine.Status{
+			AsOf:       time.Now(),
+			LocalAddrs: []tailcfg.Endpoint{{Addr: netip.AddrPortFrom(netip.MustParseAddr("192.0.2.1"), port)}},
+		}, nil)
+	}
+	setEndpoints(1)
+	cc.assertCalls("UpdateEndpoints")
+
+	b.SetPowerState(ipn.PowerState{ScreenOff: true})
+	cc.assertCalls("pause")
+	if !b.MagicConn().HostIdleForTest() {
+		t.Error("magicsock not told the host is idle")
+	}
+
+	// Endpoint changes are held until the next poll.
+	setEndpoints(2)
+	setEndpoints(3)
+	cc.assertCalls()
+
+	tick()
+	cc.assertCalls("unpause", "UpdateEndpoints")
+	tick()
+	cc.assertCalls("pause")
+
+	// Going from one idle state to another keeps polling.
+	b.SetPowerState(ipn.PowerState{ScreenOff: true, LowPower: true})
+	cc.assertCalls()
+	tick()
+	cc.assertCalls("unpause")
+	tick()
+	cc.assertCalls("pause")
+
+	setEndpoints(4)
+	b.SetPowerState(ipn.PowerState{})
+	cc.assertCalls("unpause", "UpdateEndpoints")
+	if b.MagicConn().HostIdleForTest() {
+		t.Error("magicsock still thinks the host is idle")
+	}
+	if got := b.PowerState(); got != (ipn.PowerState{}) {
+		t.Errorf("PowerState = %+v; want zero", got)
+	}
+
+	// Once active, polls stop and endpoints are sent right away.
+	b.mu.Lock()
+	p := b.hostIdle.poll
+	b.mu.Unlock()
+	if p != nil {
+		t.Error("control still polled while active")
+	}
+	setEndpoints(5)
+	cc.assertCalls("UpdateEndpoints")
+}
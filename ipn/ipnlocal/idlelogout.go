@@ -0,0 +1,147 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"time"
+
+	"tailscale.com/control/controlclient"
+	"tailscale.com/ipn"
+	"tailscale.com/tstime"
+)
+
+// idleLogoutTimeout bounds how long logging out an idle ephemeral node may
+// take.
+const idleLogoutTimeout = 30 * time.Second
+
+// ephemeralLoginFlag returns the login flag that registers the node as
+// ephemeral if prefs ask for it, or else zero.
+//
+// Control only honors the flag when the node registers a new node key, so
+// it has no effect on a node that is already registered: such a node stays
+// non-ephemeral until it next registers, as after logging out or when its
+// key expires.
+func ephemeralLoginFlag(prefs ipn.PrefsView) controlclient.LoginFlags {
+	if prefs.Valid() && prefs.EphemeralIdleTimeout() > 0 {
+		return controlclient.LoginEphemeral
+	}
+	return 0
+}
+
+// idleLogoutCheckInterval returns how often a node whose
+// Prefs.EphemeralIdleTimeout is timeout checks whether it's idle.
+func idleLogoutCheckInterval(timeout time.Duration) time.Duration {
+	return max(min(timeout/4, time.Minute), time.Second)
+}
+
+// hasConsoleSession, if non-nil, reports whether a user is logged in to the
+// host other than through Tailscale SSH, such as on its console or over
+// another SSH server. It's nil on platforms where that isn't known.
+var hasConsoleSession func() bool
+
+// idleTracker tracks when an ephemeral node was last active.
+type idleTracker struct {
+	timeout    time.Duration
+	timer      tstime.TimerController
+	lastActive time.Time
+}
+
+// note records the activity of the node at now, given how long it has been
+// since a data packet was sent to or received from a peer and its number of
+// active SSH and console sessions, and returns how long it has been idle.
+func (t *idleTracker) note(now time.Time, dataIdle time.Duration, sessions int) (idle time.Duration) {
+	if sessions > 0 {
+		t.lastActive = now
+	} else if lastData := now.Add(-dataIdle); lastData.After(t.lastActive) {
+		t.lastActive = lastData
+	}
+	return now.Sub(t.lastActive)
+}
+
+// dataIdleLocked returns how long it has been since a data packet was sent
+// to or received from a peer, or since t was last active if that isn't
+// known. Unlike the WireGuard byte counters, this
+// doesn't count handshakes and keepalives, which flow even when the node is
+// otherwise unused.
+//
+// b.mu must be held.
+func (b *LocalBackend) dataIdleLocked(t *idleTracker) time.Duration {
+	if tunWrap, ok := b.sys.Tun.GetOK(); ok {
+		return tunWrap.IdleDuration()
+	}
+	return b.clock.Since(t.lastActive)
+}
+
+// updateIdleLogoutLocked starts or stops tracking whether the node is idle,
+// according to the current prefs and state.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateIdleLogoutLocked() {
+	timeout := b.pm.CurrentPrefs().EphemeralIdleTimeout()
+	if b.state != ipn.Running || timeout <= 0 || b.shutdownCalled {
+		b.stopIdleLogoutLocked()
+		return
+	}
+	if t := b.idleLogout; t != nil && t.timeout == timeout {
+		return
+	}
+	b.stopIdleLogoutLocked()
+	t := &idleTracker{
+		timeout:    timeout,
+		lastActive: b.clock.Now(),
+	}
+	t.timer = b.clock.AfterFunc(idleLogoutCheckInterval(timeout), func() { b.checkIdleLogout(t) })
+	b.idleLogout = t
+	b.logf("ephemeral: will log out after being idle for %v", timeout)
+}
+
+// stopIdleLogoutLocked stops tracking whether the node is idle, if it was.
+//
+// b.mu must be held.
+func (b *LocalBackend) stopIdleLogoutLocked() {
+	if b.idleLogout != nil {
+		b.idleLogout.timer.Stop()
+		b.idleLogout = nil
+	}
+}
+
+// checkIdleLogout is called periodically while t tracks whether the node is
+// idle. It logs the node out once it has been idle for t.timeout.
+func (b *LocalBackend) checkIdleLogout(t *idleTracker) {
+	// Checked before taking b.mu, as it may read files.
+	console := hasConsoleSession != nil && hasConsoleSession()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.idleLogout != t {
+		// Stopped or replaced since the timer fired.
+		return
+	}
+	var sessions int
+	if b.sshServer != nil {
+		sessions = b.sshServer.NumActiveConns()
+	}
+	if console {
+		sessions++
+	}
+	idle := t.note(b.clock.Now(), b.dataIdleLocked(t), sessions)
+	if idle < t.timeout {
+		t.timer.Reset(idleLogoutCheckInterval(t.timeout))
+		return
+	}
+	b.idleLogout = nil
+	b.logf("ephemeral: idle for %v; logging out", idle.Round(time.Second))
+	// Logout is called through an interface, as referring to it directly
+	// would be an initialization cycle: c2nHandlers refers to handlers that
+	// set prefs, which start the idle timer.
+	var lo interface{ Logout(context.Context) error } = b
+	go func() {
+		ctx, cancel := context.WithTimeout(b.ctx, idleLogoutTimeout)
+		defer cancel()
+		if err := lo.Logout(ctx); err != nil {
+			b.logf("ephemeral: failed to log out idle node: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,48 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/binary"
+	"os"
+	"strconv"
+)
+
+func init() {
+	hasConsoleSession = linuxHasConsoleSession
+}
+
+const (
+	utmpPath       = "/var/run/utmp"
+	utmpRecordSize = 384 // sizeof(struct utmp) in glibc
+	utmpUserProc   = 7   // USER_PROCESS
+)
+
+// linuxHasConsoleSession reports whether utmp lists a login session whose
+// process is still running. Hosts without utmp, such as most containers,
+// have no console sessions.
+func linuxHasConsoleSession() bool {
+	b, err := os.ReadFile(utmpPath)
+	if err != nil {
+		return false
+	}
+	return utmpHasSession(b, func(pid int32) bool {
+		_, err := os.Stat("/proc/" + strconv.Itoa(int(pid)))
+		return err == nil
+	})
+}
+
+// utmpHasSession reports whether the utmp records in b include a login
+// session whose process is alive. Stale records of sessions that ended
+// without being cleaned up are skipped.
+func utmpHasSession(b []byte, alive func(pid int32) bool) bool {
+	for ; len(b) >= utmpRecordSize; b = b[utmpRecordSize:] {
+		typ := int16(binary.NativeEndian.Uint16(b[0:2]))
+		pid := int32(binary.NativeEndian.Uint32(b[4:8]))
+		if typ == utmpUserProc && pid > 0 && alive(pid) {
+			return true
+		}
+	}
+	return false
+}
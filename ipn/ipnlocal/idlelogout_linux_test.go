@@ -0,0 +1,36 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestUTMPHasSession(t *testing.T) {
+	record := func(typ int16, pid int32) []byte {
+		b := make([]byte, utmpRecordSize)
+		binary.NativeEndian.PutUint16(b[0:2], uint16(typ))
+		binary.NativeEndian.PutUint32(b[4:8], uint32(pid))
+		return b
+	}
+	alive := func(pid int32) bool { return pid == 100 }
+	const bootTime = 2
+	tests := []struct {
+		name string
+		b    []byte
+		want bool
+	}{
+		{"empty", nil, false},
+		{"boot", record(bootTime, 100), false},
+		{"stale", record(utmpUserProc, 200), false},
+		{"live", append(record(bootTime, 1), record(utmpUserProc, 100)...), true},
+		{"truncated", record(utmpUserProc, 100)[:utmpRecordSize-1], false},
+	}
+	for _, tt := range tests {
+		if got := utmpHasSession(tt.b, alive); got != tt.want {
+			t.Errorf("%s: utmpHasSession = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/control/controlclient"
+	"tailscale.com/ipn"
+	"tailscale.com/tstest"
+)
+
+func TestIdleTracker(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tr := &idleTracker{timeout: 10 * time.Minute, lastActive: start}
+	steps := []struct {
+		after    time.Duration
+		dataIdle time.Duration
+		sessions int
+		wantIdle time.Duration
+	}{
+		{after: time.Minute, dataIdle: time.Hour, wantIdle: time.Minute},
+		{after: 3 * time.Minute, dataIdle: time.Minute, wantIdle: time.Minute},  // traffic
+		{after: 5 * time.Minute, dataIdle: time.Hour, sessions: 1, wantIdle: 0}, // SSH or console session
+		{after: 9 * time.Minute, dataIdle: 6 * time.Minute, wantIdle: 4 * time.Minute},
+		{after: 15 * time.Minute, dataIdle: 12 * time.Minute, wantIdle: 10 * time.Minute},
+	}
+	for _, s := range steps {
+		if got := tr.note(start.Add(s.after), s.dataIdle, s.sessions); got != s.wantIdle {
+			t.Errorf("at +%v: idle = %v, want %v", s.after, got, s.wantIdle)
+		}
+	}
+
+	for timeout, want := range map[time.Duration]time.Duration{
+		2 * time.Second: time.Second,
+		time.Minute:     15 * time.Second,
+		time.Hour:       time.Minute,
+	} {
+		if got := idleLogoutCheckInterval(timeout); got != want {
+			t.Errorf("idleLogoutCheckInterval(%v) = %v, want %v", timeout, got, want)
+		}
+	}
+}
+
+func TestUpdateIdleLogout(t *testing.T) {
+	b := newTestLocalBackend(t)
+	b.clock = tstest.NewClock(tstest.ClockOpts{Start: time.Unix(1700000000, 0)})
+	prefs := ipn.NewPrefs()
+	prefs.EphemeralIdleTimeout = 30 * time.Minute
+	if err := b.pm.SetPrefs(prefs.View(), ipn.NetworkProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ephemeralLoginFlag(b.pm.CurrentPrefs()); got != controlclient.LoginEphemeral {
+		t.Errorf("ephemeralLoginFlag = %v, want LoginEphemeral", got)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updateIdleLogoutLocked()
+	if b.idleLogout != nil {
+		t.Fatal("idle logout armed while not running")
+	}
+	b.state = ipn.Running
+	b.updateIdleLogoutLocked()
+	tr := b.idleLogout
+	if tr == nil || tr.timeout != prefs.EphemeralIdleTimeout {
+		t.Fatalf("idle logout = %+v, want armed with the pref's timeout", tr)
+	}
+	b.updateIdleLogoutLocked()
+	if b.idleLogout != tr {
+		t.Error("idle logout re-armed without a change")
+	}
+
+	prefs.EphemeralIdleTimeout = 0
+	if err := b.pm.SetPrefs(prefs.View(), ipn.NetworkProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	b.updateIdleLogoutLocked()
+	if b.idleLogout != nil {
+		t.Error("idle logout still armed after clearing the pref")
+	}
+	if got := ephemeralLoginFlag(b.pm.CurrentPrefs()); got != 0 {
+		t.Errorf("ephemeralLoginFlag = %v, want 0", got)
+	}
+}
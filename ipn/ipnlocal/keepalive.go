@@ -0,0 +1,59 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/keepalive"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+	"tailscale.com/types/netmap"
+	"tailscale.com/wgengine/wgcfg"
+)
+
+// keepaliveConfig returns the keepalive intervals by peer class set by the
+// NodeAttrKeepaliveIntervals capability of the self node in nm, overridden
+// by those set in prefs.
+func keepaliveConfig(nm *netmap.NetworkMap, prefs ipn.PrefsView, logf logger.Logf) keepalive.Config {
+	var fromControl []tailcfg.KeepaliveIntervals
+	if nm != nil && nm.SelfNode.Valid() {
+		if vals, ok := nm.SelfNode.CapMap().GetOk(tailcfg.NodeAttrKeepaliveIntervals); ok {
+			var err error
+			fromControl, err = tailcfg.UnmarshalNodeCapJSON[tailcfg.KeepaliveIntervals](tailcfg.NodeCapMap{
+				tailcfg.NodeAttrKeepaliveIntervals: vals.AsSlice(),
+			}, tailcfg.NodeAttrKeepaliveIntervals)
+			if err != nil {
+				// The defaults are safe; keep them.
+				logf("ignoring invalid keepalive intervals from control: %v", err)
+				fromControl = nil
+			}
+		}
+	}
+	return keepalive.NewConfig(fromControl, prefs.KeepaliveIntervals().AsSlice())
+}
+
+// setWireGuardKeepalives sets the WireGuard persistent keepalive interval of
+// each peer in cfg according to kc.
+func setWireGuardKeepalives(cfg *wgcfg.Config, nm *netmap.NetworkMap, kc keepalive.Config) {
+	if kc.IsZero() {
+		return
+	}
+	peers := make(map[key.NodePublic]tailcfg.NodeView, len(nm.Peers))
+	for _, p := range nm.Peers {
+		peers[p.Key()] = p
+	}
+	for i := range cfg.Peers {
+		p := &cfg.Peers[i]
+		n, ok := peers[p.PublicKey]
+		if !ok {
+			continue
+		}
+		if d := kc.ForPeer(n).WireGuardKeepalive; d > 0 {
+			p.PersistentKeepalive = uint16(min(d/time.Second, 0xffff))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/netmap"
+	"tailscale.com/util/mak"
+	"tailscale.com/wgengine/wgcfg"
+)
+
+func TestKeepaliveConfig(t *testing.T) {
+	self := &tailcfg.Node{ID: 1}
+	mak.Set(&self.CapMap, tailcfg.NodeAttrKeepaliveIntervals, []tailcfg.RawMessage{
+		`{"class":"mobile","discoHeartbeatSeconds":30,"wireGuardKeepaliveSeconds":60}`,
+		`{"class":"server","wireGuardKeepaliveSeconds":25}`,
+	})
+	phone := &tailcfg.Node{ID: 2, Key: key.NewNode().Public(), Hostinfo: (&tailcfg.Hostinfo{OS: "android"}).View()}
+	server := &tailcfg.Node{ID: 3, Key: key.NewNode().Public(), Tags: []string{"tag:server"}}
+	laptop := &tailcfg.Node{ID: 4, Key: key.NewNode().Public()}
+	nm := &netmap.NetworkMap{
+		SelfNode: self.View(),
+		Peers:    []tailcfg.NodeView{phone.View(), server.View(), laptop.View()},
+	}
+	prefs := ipn.NewPrefs()
+	prefs.KeepaliveIntervals = []tailcfg.KeepaliveIntervals{{Class: "mobile", WireGuardKeepaliveSeconds: -1}}
+
+	kc := keepaliveConfig(nm, prefs.View(), t.Logf)
+	cfg := &wgcfg.Config{Peers: []wgcfg.Peer{{PublicKey: phone.Key}, {PublicKey: server.Key}, {PublicKey: laptop.Key}}}
+	setWireGuardKeepalives(cfg, nm, kc)
+	for i, want := range []uint16{0, 25, 0} {
+		if got := cfg.Peers[i].PersistentKeepalive; got != want {
+			t.Errorf("peer %d: PersistentKeepalive = %d, want %d", i, got, want)
+		}
+	}
+	if got := kc.ForPeer(phone.View()).DiscoHeartbeat.Seconds(); got != 30 {
+		t.Errorf("phone disco heartbeat = %vs, want 30s from control", got)
+	}
+
+	mak.Set(&self.CapMap, tailcfg.NodeAttrKeepaliveIntervals, []tailcfg.RawMessage{`{"class":5}`})
+	nm.SelfNode = self.View()
+	if kc := keepaliveConfig(nm, ipn.NewPrefs().View(), t.Logf); !kc.IsZero() {
+		t.Error("invalid intervals from control were not ignored")
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+
+	"tailscale.com/ipn"
+	"tailscale.com/net/dns/lanresponder"
+	"tailscale.com/util/dnsname"
+)
+
+// updateLANResponderLocked starts, updates or stops answering mDNS and LLMNR
+// queries on the local networks for the node's name, according to the
+// current prefs, state and netmap. See Prefs.LANDNSResponder.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateLANResponderLocked() {
+	nm := b.netMap
+	if !b.pm.CurrentPrefs().LANDNSResponder() || b.state != ipn.Running || b.shutdownCalled || nm == nil {
+		b.stopLANResponderLocked()
+		return
+	}
+	if b.lanResponder == nil {
+		r, err := lanresponder.New(b.logf, b.NetMon())
+		if err != nil {
+			b.logf("starting LAN DNS responder: %v", err)
+			return
+		}
+		b.lanResponder = r
+	}
+	fqdn, err := dnsname.ToFQDN(nm.Name)
+	if err != nil {
+		fqdn = ""
+	}
+	var addrs []netip.Addr
+	for _, pfx := range nm.GetAddresses().All() {
+		if pfx.IsSingleIP() {
+			addrs = append(addrs, pfx.Addr())
+		}
+	}
+	b.lanResponder.SetName(fqdn, addrs)
+}
+
+// stopLANResponderLocked stops answering mDNS and LLMNR queries, if it was.
+//
+// b.mu must be held.
+func (b *LocalBackend) stopLANResponderLocked() {
+	if b.lanResponder == nil {
+		return
+	}
+	if err := b.lanResponder.Close(); err != nil {
+		b.logf("stopping LAN DNS responder: %v", err)
+	}
+	b.lanResponder = nil
+}
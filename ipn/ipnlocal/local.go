@@ -63,8 +63,11 @@
 	"tailscale.com/ipn/policy"
 	"tailscale.com/log/sockstatlog"
 	"tailscale.com/logpolicy"
+	"tailscale.com/logtail/redact"
 	"tailscale.com/net/captivedetection"
 	"tailscale.com/net/dns"
+	"tailscale.com/net/dns/lanresponder"
+	"tailscale.com/net/dns/resolver"
 	"tailscale.com/net/dnscache"
 	"tailscale.com/net/dnsfallback"
 	"tailscale.com/net/ipset"
@@ -84,6 +87,7 @@
 	"tailscale.com/tsd"
 	"tailscale.com/tstime"
 	"tailscale.com/types/appctype"
+	"tailscale.com/types/bools"
 	"tailscale.com/types/dnstype"
 	"tailscale.com/types/empty"
 	"tailscale.com/types/key"
@@ -97,6 +101,7 @@
 	"tailscale.com/types/views"
 	"tailscale.com/util/deephash"
 	"tailscale.com/util/dnsname"
+	"tailscale.com/util/eventbus"
 	"tailscale.com/util/httpm"
 	"tailscale.com/util/mak"
 	"tailscale.com/util/multierr"
@@ -194,21 +199,22 @@ type LocalBackend struct {
 	unregisterNetMon         func()
 	unregisterHealthWatch    func()
 	unregisterSysPolicyWatch func()
+	statePub                 *eventbus.Publisher[StateChange]
+	healthPub                *eventbus.Publisher[HealthChange]
 	portpoll                 *portlist.Poller // may be nil
 	portpollOnce             sync.Once        // guards starting readPoller
 	varRoot                  string           // or empty if SetVarRoot never called
 	logFlushFunc             func()           // or nil if SetLogFlusher wasn't called
 	em                       *expiryManager   // non-nil
-	sshAtomicBool            atomic.Bool
-	// webClientAtomicBool controls whether the web client is running. This should
-	// be true unless the disable-web-client node attribute has been set.
-	webClientAtomicBool atomic.Bool
-	// exposeRemoteWebClientAtomicBool controls whether the web client is exposed over
-	// Tailscale on port 5252.
-	exposeRemoteWebClientAtomicBool atomic.Bool
-	shutdownCalled                  bool // if Shutdown has been called
-	debugSink                       *capture.Sink
-	sockstatLogger                  *sockstatlog.Logger
+	// serviceFlags controls which of the services of this node run, and
+	// may be read without holding b.mu.
+	serviceFlags   bools.Flags[serviceFlag]
+	shutdownCalled bool // if Shutdown has been called
+	debugSink      *capture.Sink
+	sockstatLogger *sockstatlog.Logger
+	// localLogExportFunc exports logs from the local on-disk log buffer.
+	// It's nil if SetLocalLogExporter wasn't called.
+	localLogExportFunc func(io.Writer, time.Time) error
 
 	// getTCPHandlerForFunnelFlow returns a handler for an incoming TCP flow for
 	// the provided srcAddr and dstPort if one exists.
@@ -272,6 +278,7 @@ type LocalBackend struct {
 	authURL          string        // non-empty if not Running
 	authURLTime      time.Time     // when the authURL was received from the control server
 	authActor        ipnauth.Actor // an actor who called [LocalBackend.StartLoginInteractive] last, or nil
+	systemdStatus    string        // last status reported to systemd by enterStateLockedOnEntry, without health
 	egg              bool
 	prevIfState      *netmon.State
 	peerAPIServer    *peerAPIServer // or nil
@@ -279,7 +286,9 @@ type LocalBackend struct {
 	loginFlags       controlclient.LoginFlags
 	fileWaiters      set.HandleSet[context.CancelFunc] // of wake-up funcs
 	notifyWatchers   map[string]*watchSession          // by session ID
+	notifyBacklog    notifyBacklog                     // recently sent notifications, for resuming watches
 	lastStatusTime   time.Time                         // status.AsOf value of the last processed status update
+	hostIdle         hostIdleState                     // host power state and the control polling it allows
 	// directFileRoot, if non-empty, means to write received files
 	// directly to this directory, without staging them in an
 	// intermediate buffered directory for "pick-up" later. If
@@ -294,6 +303,21 @@ type LocalBackend struct {
 	// *.partial file to its final name on completion.
 	directFileRoot    string
 	componentLogUntil map[string]componentLogState
+	// idleLogout, if non-nil, tracks the activity of an ephemeral node
+	// that's to be logged out when idle. See Prefs.EphemeralIdleTimeout.
+	idleLogout *idleTracker
+	// lanResponder, if non-nil, answers mDNS and LLMNR queries on the
+	// local networks for the node's name. See Prefs.LANDNSResponder.
+	lanResponder *lanresponder.Responder
+	// usage, if non-nil, accounts the bandwidth usage of the current
+	// profile while it's running.
+	usage *usageTracker
+	// logRedactor redacts the logs of the process, per the rules set by
+	// SetLogRedactionRules. It's nil if there are none.
+	logRedactor *redact.Redactor
+	// usageCounters are the WireGuard byte counters of each peer as of
+	// the last engine status.
+	usageCounters map[key.NodePublic]ipn.ByteCounts
 	// c2nUpdateStatus is the status of c2n-triggered client update.
 	c2nUpdateStatus     updateStatus
 	currentUser         ipnauth.Actor
@@ -317,6 +341,9 @@ type LocalBackend struct {
 	webClient          webClient
 	webClientListeners map[netip.AddrPort]*localListener // listeners for local web client traffic
 
+	metricsServerListeners map[netip.AddrPort]*localListener // listeners for local metrics server traffic
+	lastNetMapUpdate       time.Time                         // when the last non-nil netmap was set
+
 	serveListeners     map[netip.AddrPort]*localListener // listeners for local serve traffic
 	serveProxyHandlers sync.Map                          // string (HTTPHandler.Proxy) => *reverseProxy
 
@@ -348,6 +375,9 @@ type LocalBackend struct {
 	// notified about.
 	lastNotifiedDriveShares *views.SliceView[*drive.Share, drive.ShareView]
 
+	// driveAudit records remote nodes' accesses to Taildrive shares.
+	driveAudit driveAudit
+
 	// outgoingFiles keeps track of Taildrop outgoing files keyed to their OutgoingFile.ID
 	outgoingFiles map[string]*ipn.OutgoingFile
 
@@ -364,6 +394,15 @@ type LocalBackend struct {
 	// refreshAutoExitNode indicates if the exit node should be recomputed when the next netcheck report is available.
 	refreshAutoExitNode bool
 
+	// autoExitNodeTimer, if non-nil, fires when the hours of the
+	// AutoExitNode pref next start or end.
+	autoExitNodeTimer tstime.TimerController
+
+	// network identifies the network the machine is currently connected
+	// to, for matching location profiles. It's updated on major link
+	// changes.
+	network ipn.LocationMatch
+
 	// captiveCtx and captiveCancel are used to control captive portal
 	// detection. They are protected by 'mu' and can be changed during the
 	// lifetime of a LocalBackend.
@@ -378,6 +417,20 @@ type LocalBackend struct {
 	// backend is healthy and captive portal detection is not required
 	// (sending false).
 	needsCaptiveDetection chan bool
+
+	// readiness are the checks that must pass before the backend goes
+	// from Starting to Running, as configured by TS_STARTUP_BARRIER, and
+	// readinessTimeout is how long they may take. They're immutable.
+	readiness        readinessChecks
+	readinessTimeout time.Duration
+	// readinessState and readinessCancel track the progress of the
+	// readiness checks. They are protected by 'mu'. readinessCancel is
+	// non-nil while the checks are running.
+	readinessState  readinessState
+	readinessCancel context.CancelFunc
+	// checkReadiness runs the readiness checks once. It's
+	// checkReadinessDefault, except in tests.
+	checkReadiness func(context.Context, readinessChecks) error
 }
 
 // HealthTracker returns the health tracker for the backend.
@@ -390,6 +443,11 @@ func (b *LocalBackend) UserMetricsRegistry() *usermetric.Registry {
 	return b.sys.UserMetricsRegistry()
 }
 
+// EventBus returns the system event bus.
+func (b *LocalBackend) EventBus() *eventbus.Bus {
+	return b.sys.EventBus()
+}
+
 // NetMon returns the network monitor for the backend.
 func (b *LocalBackend) NetMon() *netmon.Monitor {
 	return b.sys.NetMon.Get()
@@ -397,6 +455,7 @@ func (b *LocalBackend) NetMon() *netmon.Monitor {
 
 type updateStatus struct {
 	started bool
+	lastErr string // of the last update command, if it failed
 }
 
 type metrics struct {
@@ -413,6 +472,16 @@ type metrics struct {
 // It's the type used by LocalBackend.SetControlClientGetterForTesting.
 type clientGen func(controlclient.Options) (controlclient.Client, error)
 
+var stateRecoveredWarnable = health.Register(&health.Warnable{
+	Code:     "state-recovered-from-backup",
+	Title:    "State restored from backup",
+	Severity: health.SeverityMedium,
+	Text: func(args health.Args) string {
+		return fmt.Sprintf("Tailscale's saved state was corrupt (%s) and was restored from its last backup. Recent changes to preferences may have been lost.", args[health.ArgError])
+	},
+	Component: health.ComponentBackend,
+})
+
 // NewLocalBackend returns a new LocalBackend that is ready to run,
 // but is not actually running.
 //
@@ -440,6 +509,11 @@ func NewLocalBackend(logf logger.Logf, logID logid.PublicID, sys *tsd.System, lo
 	if sds, ok := store.(ipn.StateStoreDialerSetter); ok {
 		sds.SetDialer(dialer.SystemDial)
 	}
+	if r, ok := store.(ipn.StateStoreRecoverer); ok {
+		if err := r.RecoveredState(); err != nil {
+			sys.HealthTracker().SetUnhealthy(stateRecoveredWarnable, health.Args{health.ArgError: err.Error()})
+		}
+	}
 
 	envknob.LogCurrent(logf)
 	osshare.SetFileSharingEnabled(false, logf)
@@ -483,6 +557,13 @@ func NewLocalBackend(logf logger.Logf, logID logid.PublicID, sys *tsd.System, lo
 		captiveCtx:            captiveCtx,
 		captiveCancel:         nil, // so that we start checkCaptivePortalLoop when Running
 		needsCaptiveDetection: make(chan bool),
+		statePub:              eventbus.Publish[StateChange](sys.EventBus(), eventbus.Replay(1)),
+		healthPub:             eventbus.Publish[HealthChange](sys.EventBus()),
+		readinessTimeout:      cmp.Or(startupBarrierTimeout(), defaultStartupBarrierTimeout),
+	}
+	b.checkReadiness = b.checkReadinessDefault
+	if b.readiness, err = parseReadinessChecks(startupBarrier()); err != nil {
+		return nil, fmt.Errorf("TS_STARTUP_BARRIER: %w", err)
 	}
 	mConn.SetNetInfoCallback(b.setNetInfo)
 
@@ -545,6 +626,8 @@ func NewLocalBackend(logf logger.Logf, logID logid.PublicID, sys *tsd.System, lo
 		}
 	}
 
+	b.loadLogRedactionRules()
+
 	// initialize Taildrive shares from saved state
 	fs, ok := b.sys.DriveForRemote.GetOK()
 	if ok {
@@ -649,22 +732,23 @@ func (b *LocalBackend) GetDNSOSConfig() (dns.OSConfig, error) {
 }
 
 // QueryDNS performs a DNS query for name and queryType using the built-in DNS resolver, and returns
-// the raw DNS response and the resolvers that are were able to handle the query (the internal forwarder
-// may race multiple resolvers).
-func (b *LocalBackend) QueryDNS(name string, queryType dnsmessage.Type) (res []byte, resolvers []*dnstype.Resolver, err error) {
+// the raw DNS response and how the resolver routed the query: whether it answered it itself, or
+// which DNS route matched and the resolvers that are were able to handle the query (the internal
+// forwarder may race multiple resolvers).
+func (b *LocalBackend) QueryDNS(name string, queryType dnsmessage.Type) (res []byte, route resolver.QueryRoute, err error) {
 	manager, ok := b.sys.DNSManager.GetOK()
 	if !ok {
-		return nil, nil, errors.New("DNS manager not available")
+		return nil, route, errors.New("DNS manager not available")
 	}
 	fqdn, err := dnsname.ToFQDN(name)
 	if err != nil {
 		b.logf("DNSQuery: failed to parse FQDN %q: %v", name, err)
-		return nil, nil, err
+		return nil, route, err
 	}
 	n, err := dnsmessage.NewName(fqdn.WithTrailingDot())
 	if err != nil {
 		b.logf("DNSQuery: failed to parse name %q: %v", name, err)
-		return nil, nil, err
+		return nil, route, err
 	}
 	from := netip.MustParseAddrPort("127.0.0.1:0")
 	db := dnsmessage.NewBuilder(nil, dnsmessage.Header{
@@ -681,15 +765,23 @@ func (b *LocalBackend) QueryDNS(name string, queryType dnsmessage.Type) (res []b
 	q, err := db.Finish()
 	if err != nil {
 		b.logf("DNSQuery: failed to build query: %v", err)
-		return nil, nil, err
+		return nil, route, err
 	}
 	res, err = manager.Query(b.ctx, q, "tcp", from)
 	if err != nil {
 		b.logf("DNSQuery: failed to query %q: %v", name, err)
-		return nil, nil, err
+		return nil, route, err
 	}
-	rr := manager.Resolver().GetUpstreamResolvers(fqdn)
-	return res, rr, nil
+	return res, manager.Resolver().Route(fqdn, queryType), nil
+}
+
+// FlushDNSCaches flushes the DNS caches of the OS, where supported.
+func (b *LocalBackend) FlushDNSCaches() error {
+	manager, ok := b.sys.DNSManager.GetOK()
+	if !ok {
+		return errors.New("DNS manager not available")
+	}
+	return manager.FlushCaches()
 }
 
 // GetComponentDebugLogging gets the time that component's debug logging is
@@ -804,9 +896,10 @@ func (b *LocalBackend) setConfigLockedOnEntry(conf *conffile.Config, unlock unlo
 
 var assumeNetworkUpdateForTest = envknob.RegisterBool("TS_ASSUME_NETWORK_UP_FOR_TEST")
 
-// pauseOrResumeControlClientLocked pauses b.cc if there is no network available
-// or if the LocalBackend is in Stopped state with a valid NetMap. In all other
-// cases, it unpauses it. It is a no-op if b.cc is nil.
+// pauseOrResumeControlClientLocked pauses b.cc if there is no network available,
+// if the LocalBackend is in Stopped state with a valid NetMap, or if the host
+// is idle between control polls (see hostIdleState). In all other cases, it
+// unpauses it. It is a no-op if b.cc is nil.
 //
 // b.mu must be held.
 func (b *LocalBackend) pauseOrResumeControlClientLocked() {
@@ -814,7 +907,14 @@ func (b *LocalBackend) pauseOrResumeControlClientLocked() {
 		return
 	}
 	networkUp := b.prevIfState.AnyInterfaceUp()
-	b.cc.SetPaused((b.state == ipn.Stopped && b.netMap != nil) || (!networkUp && !testenv.InTest() && !assumeNetworkUpdateForTest()))
+	paused := (b.state == ipn.Stopped && b.netMap != nil) || (!networkUp && !testenv.InTest() && !assumeNetworkUpdateForTest())
+	if !paused && b.hostIdleControlPausedLocked() {
+		paused = true
+	}
+	b.cc.SetPaused(paused)
+	if !paused {
+		b.flushHostIdleEndpointsLocked()
+	}
 }
 
 // DisconnectControl shuts down control client. This can be run before node shutdown to force control to consider this ndoe
@@ -836,16 +936,29 @@ func (b *LocalBackend) DisconnectControl() {
 
 // linkChange is our network monitor callback, called whenever the network changes.
 func (b *LocalBackend) linkChange(delta *netmon.ChangeDelta) {
+	ifst := delta.New
+	// Identify the network before taking b.mu, as doing so reads files and
+	// looks up the router.
+	identifyNetwork := delta.Major || delta.Old == nil
+	var network ipn.LocationMatch
+	if identifyNetwork {
+		network = locationMatchOf(netmon.GetNetworkIdentity(ifst))
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	ifst := delta.New
 	hadPAC := b.prevIfState.HasPAC()
 	b.prevIfState = ifst
 	b.pauseOrResumeControlClientLocked()
-	if delta.Major && shouldAutoExitNode() {
+	if delta.Major && b.autoExitNodeEnabledLocked() {
 		b.refreshAutoExitNode = true
 	}
+	if identifyNetwork && network != b.network {
+		b.logf("linkChange: network identity changed")
+		b.network = network
+		go b.applyLocationProfile()
+	}
 
 	var needReconfig bool
 	// If the network changed and we're using an exit node and allowing LAN access, we may need to reconfigure.
@@ -884,6 +997,20 @@ func (b *LocalBackend) linkChange(delta *netmon.ChangeDelta) {
 	}
 }
 
+// StateChange is the event published on the system event bus when the
+// backend's state changes. The most recent one is replayed to new subscribers.
+type StateChange struct {
+	Old, New ipn.State
+}
+
+// HealthChange is the event published on the system event bus when a
+// health warning is raised or cleared.
+type HealthChange struct {
+	Code      health.WarnableCode
+	Unhealthy bool   // whether the warning was raised, rather than cleared
+	Text      string // the warning's text, if Unhealthy
+}
+
 func (b *LocalBackend) onHealthChange(w *health.Warnable, us *health.UnhealthyState) {
 	if us == nil {
 		b.logf("health(warnable=%s): ok", w.Code)
@@ -891,11 +1018,18 @@ func (b *LocalBackend) onHealthChange(w *health.Warnable, us *health.UnhealthySt
 		b.logf("health(warnable=%s): error: %s", w.Code, us.Text)
 	}
 
+	hc := HealthChange{Code: w.Code, Unhealthy: us != nil}
+	if us != nil {
+		hc.Text = us.Text
+	}
+	b.healthPub.Publish(hc)
+
 	// Whenever health changes, send the current health state to the frontend.
 	state := b.health.CurrentState()
 	b.send(ipn.Notify{
 		Health: state,
 	})
+	b.sendSystemdStatus()
 
 	isConnectivityImpacted := false
 	for _, w := range state.Warnings {
@@ -948,6 +1082,14 @@ func (b *LocalBackend) Shutdown() {
 		return
 	}
 	b.shutdownCalled = true
+	b.stopIdleLogoutLocked()
+	b.stopHostIdlePollLocked()
+	b.stopLANResponderLocked()
+	b.stopUsageTrackingLocked()
+	b.stopAutoExitNodeTimerLocked()
+	if b.appConnector != nil {
+		b.appConnector.Close()
+	}
 
 	if b.captiveCancel != nil {
 		b.logf("canceling captive portal context")
@@ -974,6 +1116,7 @@ func (b *LocalBackend) Shutdown() {
 		b.sshServer = nil
 	}
 	b.closePeerAPIListenersLocked()
+	b.closeMetricsServerListenersLocked()
 	if b.debugSink != nil {
 		b.e.InstallCaptureHook(nil)
 		b.debugSink.Close()
@@ -1062,6 +1205,7 @@ func (b *LocalBackend) UpdateStatus(sb *ipnstate.StatusBuilder) {
 			s.ClientVersion = b.lastClientVersion
 		}
 		s.Health = b.health.Strings()
+		s.HealthWarnings = b.health.CurrentState().SortedWarnings()
 		s.HaveNodeKey = b.hasNodeKeyLocked()
 
 		// TODO(bradfitz): move this health check into a health.Warnable
@@ -1288,20 +1432,9 @@ func (b *LocalBackend) WhoIs(proto string, ipp netip.AddrPort) (n tailcfg.NodeVi
 	if !ok {
 		var ip netip.Addr
 		if ipp.Port() != 0 {
-			var protos []string
-			if proto != "" {
-				protos = []string{proto}
-			} else {
-				// If the user didn't specify a protocol, try all of them
-				protos = []string{"tcp", "udp"}
-			}
-
-			for _, tryproto := range protos {
-				ip, ok = b.sys.ProxyMapper().WhoIsIPPort(tryproto, ipp)
-				if ok {
-					break
-				}
-			}
+			// If the user didn't specify a protocol, the proxy mapper
+			// tries all of them.
+			ip, ok = b.sys.ProxyMapper().WhoIsIPPort(proto, ipp)
 		}
 		if !ok {
 			return failf("no IP found in ProxyMapper for %v", ipp)
@@ -1509,6 +1642,9 @@ func (b *LocalBackend) SetControlClientStatus(c controlclient.Client, st control
 	if applySysPolicy(prefs, b.lastSuggestedExitNode) {
 		prefsChanged = true
 	}
+	if b.resolveAutoExitNodeLocked(prefs, curNetMap) {
+		prefsChanged = true
+	}
 	if setExitNodeID(prefs, curNetMap) {
 		prefsChanged = true
 	}
@@ -1538,7 +1674,7 @@ func (b *LocalBackend) SetControlClientStatus(c controlclient.Client, st control
 	// Perform all reconfiguration based on the netmap here.
 	if st.NetMap != nil {
 		b.capTailnetLock = st.NetMap.HasCap(tailcfg.CapabilityTailnetLock)
-		b.setWebClientAtomicBoolLocked(st.NetMap)
+		b.setWebClientFlagLocked(st.NetMap)
 
 		b.mu.Unlock() // respect locking rules for tkaSyncIfNeeded
 		if err := b.tkaSyncIfNeeded(st.NetMap, prefs.View()); err != nil {
@@ -1671,6 +1807,19 @@ type preferencePolicyInfo struct {
 		get: func(p ipn.PrefsView) bool { return p.AdvertisesExitNode() },
 		set: func(p *ipn.Prefs, v bool) { p.SetAdvertiseExitNode(v) },
 	},
+	{
+		key: syspolicy.EnableSSH,
+		get: func(p ipn.PrefsView) bool { return p.RunSSH() },
+		set: func(p *ipn.Prefs, v bool) { p.RunSSH = v },
+	},
+}
+
+// sysPolicyAllows reports whether the feature controlled by the policy setting
+// key, such as [syspolicy.AllowServe], may be used. It is forbidden only if the
+// policy is set to "never".
+func sysPolicyAllows(key syspolicy.Key) bool {
+	po, _ := syspolicy.GetPreferenceOption(key)
+	return !po.IsNever()
 }
 
 // applySysPolicy overwrites configured preferences with policies that may be
@@ -1766,6 +1915,15 @@ func (b *LocalBackend) sysPolicyChanged(policy *rsop.PolicyChange) {
 	if prefs, anyChange := b.applySysPolicy(); anyChange {
 		b.logf("syspolicy: changed profile prefs: %v", prefs.Pretty())
 	}
+
+	if policy.HasChanged(syspolicy.AllowServe) || policy.HasChanged(syspolicy.AllowFunnel) {
+		// Reload the serve config, which drops or restores whatever
+		// the new policy forbids or allows.
+		b.mu.Lock()
+		b.lastServeConfJSON = mem.B(nil)
+		b.setTCPPortsInterceptedFromNetmapAndPrefsLocked(b.pm.CurrentPrefs())
+		b.mu.Unlock()
+	}
 }
 
 var _ controlclient.NetmapDeltaUpdater = (*LocalBackend)(nil)
@@ -1777,10 +1935,14 @@ func (b *LocalBackend) UpdateNetmapDelta(muts []netmap.NodeMutation) (handled bo
 	}
 
 	var notify *ipn.Notify // non-nil if we need to send a Notify
+	var reconfig bool      // whether to call authReconfig after unlocking
 	defer func() {
 		if notify != nil {
 			b.send(*notify)
 		}
+		if reconfig {
+			b.authReconfig()
+		}
 	}()
 	unlock := b.lockAndGetUnlock()
 	defer unlock()
@@ -1788,10 +1950,21 @@ func (b *LocalBackend) UpdateNetmapDelta(muts []netmap.NodeMutation) (handled bo
 		return false
 	}
 
+	// If the selected exit node went offline or came back online, the
+	// data plane needs reconfiguring for ExitNodeFailClosed, and the
+	// exitNodeUnreachableWarnable updating.
+	if exitNodeID := b.pm.CurrentPrefs().ExitNodeID(); !exitNodeID.IsZero() {
+		for _, m := range muts {
+			if _, ok := m.(netmap.NodeMutationOnline); ok && b.peers[m.NodeIDBeingMutated()].StableID() == exitNodeID {
+				reconfig = true
+			}
+		}
+	}
+
 	if b.netMap != nil && mutationsAreWorthyOfTellingIPNBus(muts) {
 		nm := ptr.To(*b.netMap) // shallow clone
 		nm.Peers = make([]tailcfg.NodeView, 0, len(b.peers))
-		shouldAutoExitNode := shouldAutoExitNode()
+		shouldAutoExitNode := b.autoExitNodeEnabledLocked()
 		for _, p := range b.peers {
 			nm.Peers = append(nm.Peers, p)
 			// If the auto exit node currently set goes offline, find another auto exit node.
@@ -1918,11 +2091,17 @@ func (b *LocalBackend) setWgengineStatus(s *wgengine.Status, err error) {
 	}
 	b.lastStatusTime = s.AsOf
 	es := b.parseWgStatusLocked(s)
+	b.noteUsageLocked(s.Peers)
 	cc := b.cc
 	b.engineStatus = es
 	needUpdateEndpoints := !endpointsEqual(s.LocalAddrs, b.endpoints)
 	if needUpdateEndpoints {
 		b.endpoints = append([]tailcfg.Endpoint{}, s.LocalAddrs...)
+		if b.hostIdleControlPausedLocked() {
+			// Send them with the next control poll instead.
+			b.hostIdle.endpointsPending = true
+			needUpdateEndpoints = false
+		}
 	}
 	b.mu.Unlock()
 
@@ -2037,6 +2216,10 @@ func (b *LocalBackend) getNewControlClientFuncLocked() clientGen {
 		b.ccGen = func(opts controlclient.Options) (controlclient.Client, error) {
 			return controlclient.New(opts)
 		}
+		if staticNetmapFile() != "" {
+			b.logf("using static netmap %s; not contacting control", staticNetmapFile())
+			b.ccGen = newStaticControlClient
+		}
 	}
 	return b.ccGen
 }
@@ -2235,7 +2418,7 @@ func (b *LocalBackend) Start(opts ipn.Options) error {
 		// Without this, the state machine transitions to "NeedsLogin" implying
 		// that user interaction is required, which is not the case and can
 		// regress tsnet.Server restarts.
-		cc.Login(controlclient.LoginDefault)
+		cc.Login(controlclient.LoginDefault | ephemeralLoginFlag(prefs))
 	}
 	b.stateMachineLockedOnEntry(unlock)
 
@@ -2244,10 +2427,11 @@ func (b *LocalBackend) Start(opts ipn.Options) error {
 
 // invalidPacketFilterWarnable is a Warnable to warn the user that the control server sent an invalid packet filter.
 var invalidPacketFilterWarnable = health.Register(&health.Warnable{
-	Code:     "invalid-packet-filter",
-	Title:    "Invalid packet filter",
-	Severity: health.SeverityHigh,
-	Text:     health.StaticMessage("The coordination server sent an invalid packet filter permitting traffic to unlocked nodes; rejecting all packets for safety"),
+	Code:      "invalid-packet-filter",
+	Title:     "Invalid packet filter",
+	Severity:  health.SeverityHigh,
+	Text:      health.StaticMessage("The coordination server sent an invalid packet filter permitting traffic to unlocked nodes; rejecting all packets for safety"),
+	Component: health.ComponentRouter,
 })
 
 // updateFilterLocked updates the packet filter in wgengine based on the
@@ -2286,6 +2470,12 @@ func (b *LocalBackend) updateFilterLocked(netMap *netmap.NetworkMap, prefs ipn.P
 			b.health.SetHealthy(invalidPacketFilterWarnable)
 		}
 	}
+	postureBlock, postureReason := postureBlocksInbound(netMap, b.logf)
+	if postureBlock {
+		b.health.SetUnhealthy(postureBlockedWarnable, health.Args{health.ArgError: postureReason})
+	} else {
+		b.health.SetHealthy(postureBlockedWarnable)
+	}
 	if prefs.Valid() {
 		for _, r := range prefs.AdvertiseRoutes().All() {
 			if r.Bits() == 0 {
@@ -2342,7 +2532,7 @@ func (b *LocalBackend) updateFilterLocked(netMap *netmap.NetworkMap, prefs ipn.P
 		LogNets     []netipx.IPRange
 		ShieldsUp   bool
 		SSHPolicy   tailcfg.SSHPolicy
-	}{haveNetmap, addrs, packetFilter, localNets.Ranges(), logNets.Ranges(), shieldsUp, sshPol})
+	}{haveNetmap, addrs, packetFilter, localNets.Ranges(), logNets.Ranges(), shieldsUp || postureBlock, sshPol})
 	if !changed {
 		return
 	}
@@ -2356,8 +2546,12 @@ func (b *LocalBackend) updateFilterLocked(netMap *netmap.NetworkMap, prefs ipn.P
 	}
 
 	oldFilter := b.e.GetFilter()
-	if shieldsUp {
-		b.logf("[v1] netmap packet filter: (shields up)")
+	if shieldsUp || postureBlock {
+		if postureBlock {
+			b.logf("[v1] netmap packet filter: (blocked by device posture policy)")
+		} else {
+			b.logf("[v1] netmap packet filter: (shields up)")
+		}
 		b.setFilter(filter.NewShieldsUpFilter(localNets, logNets, oldFilter, b.logf))
 	} else {
 		b.logf("[v1] netmap packet filter: %v filters", len(packetFilter))
@@ -2380,6 +2574,7 @@ func (b *LocalBackend) updateFilterLocked(netMap *netmap.NetworkMap, prefs ipn.P
 	Severity:            health.SeverityHigh,
 	Text:                health.StaticMessage("This network requires you to log in using your web browser."),
 	ImpactsConnectivity: true,
+	Component:           health.ComponentNetwork,
 })
 
 func (b *LocalBackend) checkCaptivePortalLoop(ctx context.Context) {
@@ -2757,6 +2952,17 @@ func (b *LocalBackend) WatchNotifications(ctx context.Context, mask ipn.NotifyWa
 // as an additional parameter. If non-nil, the specified callback is invoked
 // only for notifications relevant to this actor.
 func (b *LocalBackend) WatchNotificationsAs(ctx context.Context, actor ipnauth.Actor, mask ipn.NotifyWatchOpt, onWatchAdded func(), fn func(roNotify *ipn.Notify) (keepGoing bool)) {
+	b.WatchNotificationsFrom(ctx, actor, mask, "", onWatchAdded, fn)
+}
+
+// WatchNotificationsFrom is like WatchNotificationsAs but, if cursor is
+// non-empty, first replays the notifications sent after the one with that
+// [ipn.Notify.Cursor] before any new ones.
+//
+// It returns an error without calling onWatchAdded or fn if the notifications
+// following cursor are no longer buffered, in which case the caller must start
+// a new watch (requesting the initial state it needs) instead.
+func (b *LocalBackend) WatchNotificationsFrom(ctx context.Context, actor ipnauth.Actor, mask ipn.NotifyWatchOpt, cursor string, onWatchAdded func(), fn func(roNotify *ipn.Notify) (keepGoing bool)) error {
 	ch := make(chan *ipn.Notify, 128)
 	sessionID := rands.HexString(16)
 	origFn := fn
@@ -2776,11 +2982,31 @@ func (b *LocalBackend) WatchNotificationsAs(ctx context.Context, actor ipnauth.A
 			return origFn(&n2)
 		}
 	}
+	sendInitial := fn // the initial notification isn't filtered
+	if mask&ipn.NotifyWatchEvents != 0 {
+		unfilteredFn := fn
+		fn = func(n *ipn.Notify) bool {
+			if n = filterNotify(n, mask); n == nil {
+				return true
+			}
+			return unfilteredFn(n)
+		}
+	}
 
 	var ini *ipn.Notify
+	var replay []*ipn.Notify
 
 	b.mu.Lock()
 
+	if cursor != "" {
+		var err error
+		replay, err = b.notifyBacklog.since(cursor, actor)
+		if err != nil {
+			b.mu.Unlock()
+			return err
+		}
+	}
+
 	const initialBits = ipn.NotifyInitialState | ipn.NotifyInitialPrefs | ipn.NotifyInitialNetMap | ipn.NotifyInitialDriveShares
 	if mask&initialBits != 0 {
 		ini = &ipn.Notify{Version: version.Long()}
@@ -2803,6 +3029,7 @@ func (b *LocalBackend) WatchNotificationsAs(ctx context.Context, actor ipnauth.A
 		if mask&ipn.NotifyInitialHealthState != 0 {
 			ini.Health = b.HealthTracker().CurrentState()
 		}
+		ini.Cursor = b.notifyBacklog.cursor()
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -2828,8 +3055,8 @@ func (b *LocalBackend) WatchNotificationsAs(ctx context.Context, actor ipnauth.A
 	}
 
 	if ini != nil {
-		if !fn(ini) {
-			return
+		if !sendInitial(ini) {
+			return nil
 		}
 	}
 
@@ -2858,7 +3085,13 @@ func (b *LocalBackend) WatchNotificationsAs(ctx context.Context, actor ipnauth.A
 		sender.interval = 3 * time.Second
 	}
 
+	for _, n := range replay {
+		if !sender.send(n) {
+			return nil
+		}
+	}
 	sender.Run(ctx, ch)
+	return nil
 }
 
 // pollRequestEngineStatus calls b.e.RequestStatus every 2 seconds until ctx
@@ -3012,6 +3245,7 @@ func (b *LocalBackend) sendToLocked(n ipn.Notify, recipient notificationTarget)
 	if mayDeref(apiSrv).taildrop.HasFilesWaiting() {
 		n.FilesWaiting = &empty.Message{}
 	}
+	b.notifyBacklog.add(&n, recipient)
 
 	for _, sess := range b.notifyWatchers {
 		if recipient.match(sess.owner) {
@@ -3328,12 +3562,14 @@ func (b *LocalBackend) setTCPPortsIntercepted(ports []uint16) {
 	b.shouldInterceptTCPPortAtomic.Store(f)
 }
 
-// setAtomicValuesFromPrefsLocked populates sshAtomicBool, containsViaIPFuncAtomic,
-// shouldInterceptTCPPortAtomic, and exposeRemoteWebClientAtomicBool from the prefs p,
-// which may be !Valid().
+// setAtomicValuesFromPrefsLocked populates containsViaIPFuncAtomic,
+// shouldInterceptTCPPortAtomic, and the serviceFlagRunSSH,
+// serviceFlagExposeRemoteWebClient and serviceFlagRunMetricsServer service
+// flags from the prefs p, which may be !Valid().
 func (b *LocalBackend) setAtomicValuesFromPrefsLocked(p ipn.PrefsView) {
-	b.sshAtomicBool.Store(p.Valid() && p.RunSSH() && envknob.CanSSHD())
-	b.setExposeRemoteWebClientAtomicBoolLocked(p)
+	b.serviceFlags.SetTo(serviceFlagRunSSH, p.Valid() && p.RunSSH() && envknob.CanSSHD())
+	b.setExposeRemoteWebClientFlagLocked(p)
+	b.serviceFlags.SetTo(serviceFlagRunMetricsServer, p.Valid() && p.RunMetricsServer())
 
 	if !p.Valid() {
 		b.containsViaIPFuncAtomic.Store(ipset.FalseContainsIPFunc())
@@ -3449,6 +3685,7 @@ func (b *LocalBackend) StartLoginInteractiveAs(ctx context.Context, user ipnauth
 		b.authActor = user
 	}
 	cc := b.cc
+	flags := b.loginFlags | controlclient.LoginInteractive | ephemeralLoginFlag(b.pm.CurrentPrefs())
 	b.mu.Unlock()
 
 	b.logf("StartLoginInteractiveAs(%q): url=%v", maybeUsernameOf(user), hasValidURL)
@@ -3456,7 +3693,7 @@ func (b *LocalBackend) StartLoginInteractiveAs(ctx context.Context, user ipnauth
 	if hasValidURL {
 		b.popBrowserAuthNow(url, keyExpired, user)
 	} else {
-		cc.Login(b.loginFlags | controlclient.LoginInteractive)
+		cc.Login(flags)
 	}
 	return nil
 }
@@ -3492,6 +3729,9 @@ func (b *LocalBackend) Ping(ctx context.Context, ip netip.Addr, pingType tailcfg
 	})
 	select {
 	case pr := <-ch:
+		if pingType == tailcfg.PingDisco {
+			b.addNATDiagnostics(ip, pr)
+		}
 		return pr, nil
 	case <-ctx.Done():
 		return nil, ctx.Err()
@@ -3638,6 +3878,12 @@ func (b *LocalBackend) checkPrefsLocked(p *ipn.Prefs) error {
 	if b.isConfigLocked_Locked() {
 		return errors.New("can't reconfigure tailscaled when using a config file; config file is locked")
 	}
+	return b.checkPrefValuesLocked(p)
+}
+
+// checkPrefValuesLocked reports whether p is a valid set of prefs to apply,
+// regardless of whether the config file permits changing them.
+func (b *LocalBackend) checkPrefValuesLocked(p *ipn.Prefs) error {
 	var errs []error
 	if p.Hostname == "badhostname.tailscale." {
 		// Keep this one just for testing.
@@ -3658,6 +3904,9 @@ func (b *LocalBackend) checkPrefsLocked(p *ipn.Prefs) error {
 	if err := b.checkAutoUpdatePrefsLocked(p); err != nil {
 		errs = append(errs, err)
 	}
+	if _, _, err := ipn.ParseCertIssuer(p.CertIssuer); err != nil {
+		errs = append(errs, err)
+	}
 	return multierr.New(errs...)
 }
 
@@ -3725,6 +3974,8 @@ func (b *LocalBackend) isDefaultServerLocked() bool {
 	Text: func(args health.Args) string {
 		return "Exit node misconfiguration: " + args[health.ArgError]
 	},
+	Component:      health.ComponentRouter,
+	RemediationURL: "https://tailscale.com/kb/1103/exit-nodes",
 })
 
 // updateExitNodeUsageWarning updates a warnable meant to notify users of
@@ -3745,11 +3996,76 @@ func updateExitNodeUsageWarning(p ipn.PrefsView, state *netmon.State, healthTrac
 	}
 }
 
+var exitNodeUnreachableWarnable = health.Register(&health.Warnable{
+	Code:     "exit-node-unreachable",
+	Title:    "Exit node unreachable",
+	Severity: health.SeverityHigh,
+	Text: func(args health.Args) string {
+		return args[health.ArgError]
+	},
+	ImpactsConnectivity: true,
+	Component:           health.ComponentRouter,
+	RemediationURL:      "https://tailscale.com/kb/1103/exit-nodes",
+})
+
+// exitNodeUnreachable reports whether p selects an exit node that is
+// currently unreachable and, if so, why.
+func exitNodeUnreachable(p ipn.PrefsView, peers map[tailcfg.NodeID]tailcfg.NodeView) (reason string, unreachable bool) {
+	if !p.Valid() {
+		return "", false
+	}
+	exitNodeID := p.ExitNodeID()
+	if exitNodeID.IsZero() {
+		if ip := p.ExitNodeIP(); ip.IsValid() {
+			return fmt.Sprintf("exit node %v is not in the tailnet or not visible to this device", ip), true
+		}
+		return "", false
+	}
+	for _, peer := range peers {
+		if peer.StableID() != exitNodeID {
+			continue
+		}
+		name := peer.ComputedName()
+		if name == "" {
+			name = string(exitNodeID)
+		}
+		switch {
+		case peer.Expired():
+			return fmt.Sprintf("the node key of exit node %q has expired", name), true
+		case peer.Online() != nil && !*peer.Online():
+			return fmt.Sprintf("exit node %q is offline", name), true
+		}
+		return "", false
+	}
+	return fmt.Sprintf("exit node %v is not in the tailnet or not visible to this device", exitNodeID), true
+}
+
+// updateExitNodeUnreachableWarning updates a warnable meant to notify users
+// that the exit node they selected is unreachable, and what happens to their
+// traffic in the meantime.
+func updateExitNodeUnreachableWarning(p ipn.PrefsView, peers map[tailcfg.NodeID]tailcfg.NodeView, healthTracker *health.Tracker) {
+	reason, unreachable := exitNodeUnreachable(p, peers)
+	if !unreachable {
+		healthTracker.SetHealthy(exitNodeUnreachableWarnable)
+		return
+	}
+	var msg string
+	if p.ExitNodeFailClosed() {
+		msg = fmt.Sprintf("The selected exit node is unreachable: %s. All internet traffic, DNS queries and local network access are blocked until it is reachable again. Select another exit node, or run 'tailscale set --exit-node-fail-closed=false' to allow DNS and local network access in the meantime.", reason)
+	} else {
+		msg = fmt.Sprintf("The selected exit node is unreachable: %s. Internet traffic is blocked until it is reachable again. Select another exit node or stop using one to restore internet access.", reason)
+	}
+	healthTracker.SetUnhealthy(exitNodeUnreachableWarnable, health.Args{health.ArgError: msg})
+}
+
 func (b *LocalBackend) checkExitNodePrefsLocked(p *ipn.Prefs) error {
-	tryingToUseExitNode := p.ExitNodeIP.IsValid() || p.ExitNodeID != ""
+	tryingToUseExitNode := p.ExitNodeIP.IsValid() || p.ExitNodeID != "" || p.AutoExitNode != ""
 	if !tryingToUseExitNode {
 		return nil
 	}
+	if _, err := p.AutoExitNode.Policy(); err != nil {
+		return err
+	}
 
 	if err := featureknob.CanUseExitNode(); err != nil {
 		return err
@@ -3809,6 +4125,8 @@ func (b *LocalBackend) SetUseExitNodeEnabled(v bool) (ipn.PrefsView, error) {
 	} else {
 		mp.ExitNodeIDSet = true
 		mp.ExitNodeID = ""
+		mp.AutoExitNodeSet = true
+		mp.AutoExitNode = ""
 		mp.InternalExitNodePriorSet = true
 		mp.InternalExitNodePrior = p0.ExitNodeID()
 	}
@@ -3838,6 +4156,11 @@ func (b *LocalBackend) EditPrefs(mp *ipn.MaskedPrefs) (ipn.PrefsView, error) {
 		mp.InternalExitNodePrior = ""
 		mp.InternalExitNodePriorSet = true
 	}
+	// Picking an exit node explicitly stops picking one automatically.
+	if (mp.ExitNodeIDSet || mp.ExitNodeIPSet) && !mp.AutoExitNodeSet {
+		mp.AutoExitNode = ""
+		mp.AutoExitNodeSet = true
+	}
 
 	unlock := b.lockAndGetUnlock()
 	defer unlock()
@@ -3861,6 +4184,9 @@ func (b *LocalBackend) editPrefsLockedOnEntry(mp *ipn.MaskedPrefs, unlock unlock
 		b.logf("EditPrefs check error: %v", err)
 		return ipn.PrefsView{}, err
 	}
+	if mp.AutoExitNodeSet {
+		b.resolveAutoExitNodeLocked(p1, nil)
+	}
 	if p1.RunSSH && !envknob.CanSSHD() {
 		b.logf("EditPrefs requests SSH, but disabled by envknob; returning error")
 		return ipn.PrefsView{}, errors.New("Tailscale SSH server administratively disabled.")
@@ -3975,6 +4301,8 @@ func (b *LocalBackend) setPrefsLockedOnEntry(newp *ipn.Prefs, unlock unlockOnce)
 	if err := b.pm.SetPrefs(prefs, np); err != nil {
 		b.logf("failed to save new controlclient state: %v", err)
 	}
+	b.updateIdleLogoutLocked()
+	b.updateLANResponderLocked()
 
 	if newp.AutoUpdate.Apply.EqualBool(true) {
 		if b.state != ipn.Running {
@@ -3996,7 +4324,7 @@ func (b *LocalBackend) setPrefsLockedOnEntry(newp *ipn.Prefs, unlock unlockOnce)
 
 	if !oldp.WantRunning() && newp.WantRunning {
 		b.logf("transitioning to running; doing Login...")
-		cc.Login(controlclient.LoginDefault)
+		cc.Login(controlclient.LoginDefault | ephemeralLoginFlag(prefs))
 	}
 
 	if oldp.WantRunning() != newp.WantRunning {
@@ -4093,6 +4421,9 @@ func (b *LocalBackend) TCPHandlerForDst(src, dst netip.AddrPort) (handler func(c
 	if dst.Port() == webClientPort && b.ShouldExposeRemoteWebClient() {
 		return b.handleWebClientConn, opts
 	}
+	if dst.Port() == metricsServerPort && b.ShouldRunMetricsServer() {
+		return b.handleMetricsServerConn, opts
+	}
 	if port, ok := b.GetPeerAPIPort(dst.Addr()); ok && dst.Port() == port {
 		return func(c net.Conn) error {
 			b.handlePeerAPIConn(src, dst, c)
@@ -4214,7 +4545,10 @@ func (b *LocalBackend) reconfigAppConnectorLocked(nm *netmap.NetworkMap, prefs i
 	}()
 
 	if !prefs.AppConnector().Advertise {
-		b.appConnector = nil
+		if b.appConnector != nil {
+			b.appConnector.Close()
+			b.appConnector = nil
+		}
 		return
 	}
 
@@ -4233,6 +4567,9 @@ func (b *LocalBackend) reconfigAppConnectorLocked(nm *netmap.NetworkMap, prefs i
 			}
 			storeFunc = b.storeRouteInfo
 		}
+		if b.appConnector != nil {
+			b.appConnector.Close()
+		}
 		b.appConnector = appc.NewAppConnector(b.logf, b, ri, storeFunc)
 	}
 	if nm == nil {
@@ -4258,11 +4595,22 @@ func (b *LocalBackend) reconfigAppConnectorLocked(nm *netmap.NetworkMap, prefs i
 	var (
 		domains []string
 		routes  []netip.Prefix
+		ttls    map[string]time.Duration
 	)
 	for _, attr := range attrs {
 		if slices.Contains(attr.Connectors, "*") || selfHasTag(attr.Connectors) {
 			domains = append(domains, attr.Domains...)
 			routes = append(routes, attr.Routes...)
+			if attr.RouteTTL != "" {
+				ttl, err := time.ParseDuration(attr.RouteTTL)
+				if err != nil || ttl <= 0 {
+					b.logf("[unexpected] invalid app connector route TTL %q for %q", attr.RouteTTL, attr.Name)
+					continue
+				}
+				for _, d := range attr.Domains {
+					mak.Set(&ttls, d, ttl)
+				}
+			}
 		}
 	}
 	slices.Sort(domains)
@@ -4270,6 +4618,7 @@ func (b *LocalBackend) reconfigAppConnectorLocked(nm *netmap.NetworkMap, prefs i
 	domains = slices.Compact(domains)
 	routes = slices.Compact(routes)
 	b.appConnector.UpdateDomainsAndRoutes(domains, routes)
+	b.appConnector.UpdateRouteTTLs(ttls)
 }
 
 // authReconfig pushes a new configuration into wgengine, if engine
@@ -4285,8 +4634,15 @@ func (b *LocalBackend) authReconfig() {
 	userDialUseRoutes := nm.HasCap(tailcfg.NodeAttrUserDialUseRoutes)
 	dohURL, dohURLOK := exitNodeCanProxyDNS(nm, b.peers, prefs.ExitNodeID())
 	dcfg := dnsConfigForNetmap(nm, b.peers, prefs, b.keyExpired, b.logf, version.OS())
+	_, exitUnreachable := exitNodeUnreachable(prefs, b.peers)
+	if nm != nil && prefs.WantRunning() {
+		updateExitNodeUnreachableWarning(prefs, b.peers, b.health)
+	} else {
+		b.health.SetHealthy(exitNodeUnreachableWarnable)
+	}
 	// If the current node is an app connector, ensure the app connector machine is started
 	b.reconfigAppConnectorLocked(nm, prefs)
+	b.updateForwardingMetricsLocked(nm, prefs)
 	b.mu.Unlock()
 
 	if blocked {
@@ -4327,6 +4683,17 @@ func (b *LocalBackend) authReconfig() {
 		b.logf("wgcfg: %v", err)
 		return
 	}
+	kc := keepaliveConfig(nm, prefs, b.logf)
+	b.MagicConn().SetKeepaliveConfig(kc)
+	setWireGuardKeepalives(cfg, nm, kc)
+
+	if exitUnreachable && prefs.ExitNodeFailClosed() && prefs.ExitNodeAllowLANAccess() {
+		// Fail closed: route the local network via the (unreachable)
+		// exit node too, until it's reachable again.
+		p := prefs.AsStruct()
+		p.ExitNodeAllowLANAccess = false
+		prefs = p.View()
+	}
 
 	oneCGNATRoute := shouldUseOneCGNATRoute(b.logf, b.sys.ControlKnobs(), version.OS())
 	rcfg := b.routerConfig(cfg, prefs, oneCGNATRoute)
@@ -4346,6 +4713,39 @@ func (b *LocalBackend) authReconfig() {
 	b.initPeerAPIListener()
 }
 
+// updateForwardingMetricsLocked configures the tun device's metrics of the
+// traffic forwarded for peers by route and exit node user, from the routes
+// advertised in prefs and the users of the peers in nm.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateForwardingMetricsLocked(nm *netmap.NetworkMap, prefs ipn.PrefsView) {
+	tunWrap, ok := b.sys.Tun.GetOK()
+	if !ok {
+		return
+	}
+	routes := prefs.AdvertiseRoutes()
+	if nm == nil || routes.Len() == 0 {
+		tunWrap.SetForwardingMetrics(nil, nil)
+		return
+	}
+	var peerUsers map[netip.Addr]string
+	if tsaddr.ContainsExitRoutes(routes) {
+		peerUsers = make(map[netip.Addr]string)
+		for _, p := range b.peers {
+			up, ok := nm.UserProfiles[p.User()]
+			if !ok {
+				continue
+			}
+			for _, a := range p.Addresses().All() {
+				if a.IsSingleIP() {
+					peerUsers[a.Addr()] = up.LoginName
+				}
+			}
+		}
+	}
+	tunWrap.SetForwardingMetrics(routes.AsSlice(), peerUsers)
+}
+
 // shouldUseOneCGNATRoute reports whether we should prefer to make one big
 // CGNAT /10 route rather than a /32 per peer.
 //
@@ -4499,6 +4899,18 @@ func dnsConfigForNetmap(nm *netmap.NetworkMap, peers map[tailcfg.NodeID]tailcfg.
 		dcfg.DefaultResolvers = append(dcfg.DefaultResolvers, resolvers...)
 	}
 
+	// If the exit node is unreachable and the user asked us to fail closed,
+	// don't let queries fall back to resolvers outside of the tailnet, which
+	// would reveal the names looked up to the local network. The resolver is
+	// authoritative for all names until the exit node is reachable again, so
+	// only MagicDNS names resolve.
+	if prefs.ExitNodeFailClosed() {
+		if _, unreachable := exitNodeUnreachable(prefs, peers); unreachable {
+			dcfg.Routes["."] = nil
+			return dcfg
+		}
+	}
+
 	// If we're using an exit node and that exit node is new enough (1.19.x+)
 	// to run a DoH DNS proxy, then send all our DNS traffic through it.
 	if dohURL, ok := exitNodeCanProxyDNS(nm, peers, prefs.ExitNodeID()); ok {
@@ -4599,6 +5011,24 @@ func (b *LocalBackend) TryFlushLogs() bool {
 	return true
 }
 
+// SetLocalLogExporter sets a func to be called to export logs from the
+// local on-disk log buffer.
+//
+// It should only be called before the LocalBackend is used.
+func (b *LocalBackend) SetLocalLogExporter(exportFunc func(w io.Writer, since time.Time) error) {
+	b.localLogExportFunc = exportFunc
+}
+
+// ExportLocalLogs writes to w the logs from the local on-disk log buffer
+// that were logged at or after since. If since is zero, all buffered logs
+// are written. It returns an error if local logs aren't enabled.
+func (b *LocalBackend) ExportLocalLogs(w io.Writer, since time.Time) error {
+	if b.localLogExportFunc == nil {
+		return errors.New("local logs not enabled; run tailscaled with --local-logs to enable them")
+	}
+	return b.localLogExportFunc(w, since)
+}
+
 // TailscaleVarRoot returns the root directory of Tailscale's writable
 // storage area. (e.g. "/var/lib/tailscale")
 //
@@ -5038,7 +5468,15 @@ func (b *LocalBackend) enterStateLockedOnEntry(newState ipn.State, unlock unlock
 			// in onHealthChange.
 		}
 	}
+	switch newState {
+	case ipn.NoState, ipn.NeedsLogin, ipn.NeedsMachineAuth, ipn.Stopped:
+		// Check readiness again the next time we start.
+		b.resetReadinessLocked()
+	}
 	b.pauseOrResumeControlClientLocked()
+	b.updateIdleLogoutLocked()
+	b.updateLANResponderLocked()
+	b.updateUsageTrackingLocked()
 
 	if newState == ipn.Running {
 		b.stopOfflineAutoUpdate()
@@ -5057,10 +5495,11 @@ func (b *LocalBackend) enterStateLockedOnEntry(newState ipn.State, unlock unlock
 	b.logf("Switching ipn state %v -> %v (WantRunning=%v, nm=%v)",
 		oldState, newState, prefs.WantRunning(), netMap != nil)
 	b.send(ipn.Notify{State: &newState})
+	b.statePub.Publish(StateChange{Old: oldState, New: newState})
 
 	switch newState {
 	case ipn.NeedsLogin:
-		systemd.Status("Needs login: %s", authURL)
+		b.setSystemdStatus("Needs login: " + authURL)
 		if b.seamlessRenewalEnabled() {
 			break
 		}
@@ -5073,7 +5512,7 @@ func (b *LocalBackend) enterStateLockedOnEntry(newState ipn.State, unlock unlock
 		}
 
 		if authURL == "" {
-			systemd.Status("Stopped; run 'tailscale up' to log in")
+			b.setSystemdStatus("Stopped; run 'tailscale up' to log in")
 		}
 	case ipn.Starting, ipn.NeedsMachineAuth:
 		b.authReconfig()
@@ -5085,7 +5524,7 @@ func (b *LocalBackend) enterStateLockedOnEntry(newState ipn.State, unlock unlock
 		for _, p := range addrs.All() {
 			addrStrs = append(addrStrs, p.Addr().String())
 		}
-		systemd.Status("Connected; %s; %s", activeLogin, strings.Join(addrStrs, " "))
+		b.setSystemdStatus(fmt.Sprintf("Connected; %s; %s", activeLogin, strings.Join(addrStrs, " ")))
 	case ipn.NoState:
 		// Do nothing.
 	default:
@@ -5093,6 +5532,42 @@ func (b *LocalBackend) enterStateLockedOnEntry(newState ipn.State, unlock unlock
 	}
 }
 
+// setSystemdStatus sets the status shown by systemctl for tailscaled to
+// status, followed by any health warnings.
+func (b *LocalBackend) setSystemdStatus(status string) {
+	b.mu.Lock()
+	b.systemdStatus = status
+	b.mu.Unlock()
+	b.sendSystemdStatus()
+}
+
+// sendSystemdStatus sends the last status set by setSystemdStatus, with the
+// current health warnings, to systemd.
+func (b *LocalBackend) sendSystemdStatus() {
+	b.mu.Lock()
+	status := b.systemdStatus
+	b.mu.Unlock()
+	if status == "" {
+		// Not started yet.
+		return
+	}
+	systemd.Status("%s", systemdStatusWithHealth(status, b.health.Strings()))
+}
+
+// systemdStatusWithHealth returns status with a summary of the health warnings
+// appended, keeping it to the single line that systemd shows.
+func systemdStatusWithHealth(status string, warnings []string) string {
+	if len(warnings) == 0 {
+		return status
+	}
+	slices.Sort(warnings)
+	first := strings.Join(strings.Fields(warnings[0]), " ")
+	if len(warnings) == 1 {
+		return fmt.Sprintf("%s; health: %s", status, first)
+	}
+	return fmt.Sprintf("%s; health: %s (and %d more; see 'tailscale status')", status, first, len(warnings)-1)
+}
+
 func (b *LocalBackend) hasNodeKeyLocked() bool {
 	// we can't use b.Prefs(), because it strips the keys, oops!
 	p := b.pm.CurrentPrefs()
@@ -5171,6 +5646,10 @@ func (b *LocalBackend) nextStateLocked() ipn.State {
 		return ipn.Starting
 	case state == ipn.Starting:
 		if st.NumLive > 0 || st.LiveDERPs > 0 {
+			if !b.readyForRunningLocked() {
+				// Connected, but waiting for the startup barrier.
+				return state
+			}
 			return ipn.Running
 		} else {
 			return state
@@ -5358,44 +5837,70 @@ func (b *LocalBackend) ResetForClientDisconnect() {
 	b.enterStateLockedOnEntry(ipn.Stopped, unlock)
 }
 
-func (b *LocalBackend) ShouldRunSSH() bool { return b.sshAtomicBool.Load() && envknob.CanSSHD() }
+// serviceFlag is a flag in LocalBackend.serviceFlags.
+type serviceFlag uint32
+
+const (
+	serviceFlagRunSSH                serviceFlag = 1 << iota // the RunSSH pref is set and SSH is possible
+	serviceFlagRunWebClient                                  // the disable-web-client node attribute is not set
+	serviceFlagExposeRemoteWebClient                         // the RunWebClient pref is set
+	serviceFlagRunMetricsServer                              // the RunMetricsServer pref is set
+)
+
+func (f serviceFlag) String() string {
+	switch f {
+	case serviceFlagRunSSH:
+		return "run-ssh"
+	case serviceFlagRunWebClient:
+		return "run-web-client"
+	case serviceFlagExposeRemoteWebClient:
+		return "expose-remote-web-client"
+	case serviceFlagRunMetricsServer:
+		return "run-metrics-server"
+	}
+	return bools.FormatFlags(uint32(f))
+}
+
+func (b *LocalBackend) ShouldRunSSH() bool {
+	return b.serviceFlags.Test(serviceFlagRunSSH) && envknob.CanSSHD()
+}
 
 // ShouldRunWebClient reports whether the web client is being run
 // within this tailscaled instance. ShouldRunWebClient is safe to
 // call regardless of whether b.mu is held or not.
-func (b *LocalBackend) ShouldRunWebClient() bool { return b.webClientAtomicBool.Load() }
+func (b *LocalBackend) ShouldRunWebClient() bool { return b.serviceFlags.Test(serviceFlagRunWebClient) }
 
 // ShouldExposeRemoteWebClient reports whether the web client should
 // accept connections via [tailscale IP]:5252 in addition to the default
 // behaviour of accepting local connections over 100.100.100.100.
 //
 // This function checks both the web client user pref via
-// exposeRemoteWebClientAtomicBool and the disable-web-client node attr
+// serviceFlagExposeRemoteWebClient and the disable-web-client node attr
 // via ShouldRunWebClient to determine whether the web client should be
 // exposed.
 func (b *LocalBackend) ShouldExposeRemoteWebClient() bool {
-	return b.ShouldRunWebClient() && b.exposeRemoteWebClientAtomicBool.Load()
+	return b.serviceFlags.Test(serviceFlagRunWebClient | serviceFlagExposeRemoteWebClient)
 }
 
-// setWebClientAtomicBoolLocked sets webClientAtomicBool based on whether
+// setWebClientFlagLocked sets serviceFlagRunWebClient based on whether
 // tailcfg.NodeAttrDisableWebClient has been set in the netmap.NetworkMap.
 //
 // b.mu must be held.
-func (b *LocalBackend) setWebClientAtomicBoolLocked(nm *netmap.NetworkMap) {
+func (b *LocalBackend) setWebClientFlagLocked(nm *netmap.NetworkMap) {
 	shouldRun := !nm.HasCap(tailcfg.NodeAttrDisableWebClient)
-	wasRunning := b.webClientAtomicBool.Swap(shouldRun)
+	wasRunning := b.serviceFlags.SetTo(serviceFlagRunWebClient, shouldRun)&serviceFlagRunWebClient != 0
 	if wasRunning && !shouldRun {
 		go b.webClientShutdown() // stop web client
 	}
 }
 
-// setExposeRemoteWebClientAtomicBoolLocked sets exposeRemoteWebClientAtomicBool
+// setExposeRemoteWebClientFlagLocked sets serviceFlagExposeRemoteWebClient
 // based on whether the RunWebClient pref is set.
 //
 // b.mu must be held.
-func (b *LocalBackend) setExposeRemoteWebClientAtomicBoolLocked(prefs ipn.PrefsView) {
+func (b *LocalBackend) setExposeRemoteWebClientFlagLocked(prefs ipn.PrefsView) {
 	shouldExpose := prefs.Valid() && prefs.RunWebClient()
-	b.exposeRemoteWebClientAtomicBool.Store(shouldExpose)
+	b.serviceFlags.SetTo(serviceFlagExposeRemoteWebClient, shouldExpose)
 }
 
 // ShouldHandleViaIP reports whether ip is an IPv6 address in the
@@ -5515,6 +6020,17 @@ func (b *LocalBackend) setAutoExitNodeIDLockedOnEntry(unlock unlockOnce) {
 		return
 	}
 	prefsClone := prefs.AsStruct()
+	if prefsClone.AutoExitNode != "" {
+		// Picked by editPrefsLockedOnEntry as per the policy.
+		_, err := b.editPrefsLockedOnEntry(&ipn.MaskedPrefs{
+			Prefs:           *prefsClone,
+			AutoExitNodeSet: true,
+		}, unlock)
+		if err != nil {
+			b.logf("setAutoExitNodeID: failed to apply exit node ID preference: %v", err)
+		}
+		return
+	}
 	newSuggestion, err := b.suggestExitNodeLocked(nil)
 	if err != nil {
 		b.logf("setAutoExitNodeID: %v", err)
@@ -5544,6 +6060,9 @@ func (b *LocalBackend) setNetMapLocked(nm *netmap.NetworkMap) {
 		login = cmp.Or(nm.UserProfiles[nm.User()].LoginName, "<missing-profile>")
 	}
 	b.netMap = nm
+	if nm != nil {
+		b.lastNetMapUpdate = b.clock.Now()
+	}
 	b.updatePeersFromNetmapLocked(nm)
 	if login != b.activeLogin {
 		b.logf("active login: %v", login)
@@ -5582,6 +6101,7 @@ func (b *LocalBackend) setNetMapLocked(nm *netmap.NetworkMap) {
 	netns.SetDisableBindConnToInterface(nm.HasCap(tailcfg.CapabilityDebugDisableBindConnToInterface))
 
 	b.setTCPPortsInterceptedFromNetmapAndPrefsLocked(b.pm.CurrentPrefs())
+	b.updateLANResponderLocked()
 	if nm == nil {
 		b.nodeByAddr = nil
 
@@ -5859,6 +6379,21 @@ func (b *LocalBackend) reloadServeConfigLocked(prefs ipn.PrefsView) {
 		return !ok
 	})
 
+	if !sysPolicyAllows(syspolicy.AllowServe) {
+		b.logf("serve: %v; ignoring ServeConfig", errServeForbidden)
+		b.serveConfig = ipn.ServeConfigView{}
+		return
+	}
+	if !sysPolicyAllows(syspolicy.AllowFunnel) && conf.View().HasAllowFunnel() {
+		b.logf("serve: %v; ignoring AllowFunnel", errFunnelForbidden)
+		conf.AllowFunnel = nil
+		for _, fg := range conf.Foreground {
+			if fg != nil {
+				fg.AllowFunnel = nil
+			}
+		}
+	}
+
 	b.serveConfig = conf.View()
 }
 
@@ -5880,6 +6415,13 @@ func (b *LocalBackend) setTCPPortsInterceptedFromNetmapAndPrefsLocked(prefs ipn.
 			b.updateWebClientListenersLocked()
 		}
 	}
+	if b.ShouldRunMetricsServer() {
+		handlePorts = append(handlePorts, metricsServerPort)
+	}
+	// don't listen on netmap addresses if we're in userspace mode
+	if !b.sys.IsNetstack() {
+		b.updateMetricsServerListenersLocked()
+	}
 
 	b.reloadServeConfigLocked(prefs)
 	if b.serveConfig.Valid() {
@@ -6090,6 +6632,9 @@ func (b *LocalBackend) FileTargets() ([]*apitype.FileTarget, error) {
 	if !b.capFileSharing {
 		return nil, errors.New("file sharing not enabled by Tailscale admin")
 	}
+	if !sysPolicyAllows(syspolicy.AllowTaildropSend) {
+		return nil, errors.New("sending files is disabled by system policy")
+	}
 	for _, p := range b.peers {
 		if !b.peerIsTaildropTargetLocked(p) {
 			continue
@@ -6573,10 +7118,12 @@ func (b *LocalBackend) sshServerOrInit() (_ SSHServer, err error) {
 }
 
 var warnSSHSELinuxWarnable = health.Register(&health.Warnable{
-	Code:     "ssh-unavailable-selinux-enabled",
-	Title:    "Tailscale SSH and SELinux",
-	Severity: health.SeverityLow,
-	Text:     health.StaticMessage("SELinux is enabled; Tailscale SSH may not work. See https://tailscale.com/s/ssh-selinux"),
+	Code:           "ssh-unavailable-selinux-enabled",
+	Title:          "Tailscale SSH and SELinux",
+	Severity:       health.SeverityLow,
+	Text:           health.StaticMessage("SELinux is enabled; Tailscale SSH may not work. See https://tailscale.com/s/ssh-selinux"),
+	Component:      health.ComponentSSH,
+	RemediationURL: "https://tailscale.com/s/ssh-selinux",
 })
 
 func (b *LocalBackend) updateSELinuxHealthWarning() {
@@ -6830,9 +7377,14 @@ func (b *LocalBackend) resetForProfileChangeLockedOnEntry(unlock unlockOnce) err
 	b.lastServeConfJSON = mem.B(nil)
 	b.serveConfig = ipn.ServeConfigView{}
 	b.lastSuggestedExitNode = ""
+	b.stopAutoExitNodeTimerLocked()
 	b.enterStateLockedOnEntry(ipn.NoState, unlock) // Reset state; releases b.mu
 	b.health.SetLocalLogConfigHealth(nil)
-	return b.Start(ipn.Options{})
+	if err := b.Start(ipn.Options{}); err != nil {
+		return err
+	}
+	go b.applyLocationProfile()
+	return nil
 }
 
 // DeleteProfile deletes a profile with the given ID.
@@ -6905,9 +7457,10 @@ func (b *LocalBackend) ResetAuth() error {
 	return b.resetForProfileChangeLockedOnEntry(unlock)
 }
 
-// StreamDebugCapture writes a pcap stream of packets traversing
-// tailscaled to the provided response writer.
-func (b *LocalBackend) StreamDebugCapture(ctx context.Context, w io.Writer) error {
+// StreamDebugCapture writes a capture stream of the packets traversing
+// tailscaled that match opts.Filter to the provided response writer,
+// in the format given by opts.
+func (b *LocalBackend) StreamDebugCapture(ctx context.Context, w io.Writer, opts capture.Options) error {
 	var s *capture.Sink
 
 	b.mu.Lock()
@@ -6920,7 +7473,7 @@ func (b *LocalBackend) StreamDebugCapture(ctx context.Context, w io.Writer) erro
 	}
 	b.mu.Unlock()
 
-	unregister := s.RegisterOutput(w)
+	unregister := s.RegisterOutput(w, opts)
 
 	select {
 	case <-ctx.Done():
@@ -6964,6 +7517,24 @@ func (b *LocalBackend) GetPeerEndpointChanges(ctx context.Context, ip netip.Addr
 	return chs, nil
 }
 
+// GetPeerPathStats returns the latency and loss statistics of each path to
+// the peer with the given Tailscale IP.
+func (b *LocalBackend) GetPeerPathStats(ctx context.Context, ip netip.Addr) ([]ipnstate.PathStats, error) {
+	pip, ok := b.e.PeerForIP(ip)
+	if !ok {
+		return nil, fmt.Errorf("no matching peer")
+	}
+	if pip.IsSelf {
+		return nil, fmt.Errorf("%v is local Tailscale IP", ip)
+	}
+
+	stats, err := b.MagicConn().GetPathStats(pip.Node)
+	if err != nil {
+		return nil, fmt.Errorf("getting path stats: %w", err)
+	}
+	return stats, nil
+}
+
 var breakTCPConns func() error
 
 func (b *LocalBackend) DebugBreakTCPConns() error {
@@ -6977,6 +7548,26 @@ func (b *LocalBackend) DebugBreakDERPConns() error {
 	return b.MagicConn().DebugBreakDERPConns()
 }
 
+// DebugFlows returns the flows let through by the packet filter.
+func (b *LocalBackend) DebugFlows() []filter.Flow {
+	filt := b.e.GetFilter()
+	if filt == nil {
+		return nil
+	}
+	return filt.Flows()
+}
+
+// DebugKillFlow makes the packet filter drop the packets of the flow with
+// the given ID, as returned by DebugFlows.
+func (b *LocalBackend) DebugKillFlow(id uint64) error {
+	filt := b.e.GetFilter()
+	if filt == nil || !filt.KillFlow(id) {
+		return fmt.Errorf("no flow with ID %d", id)
+	}
+	b.logf("killed flow %d", id)
+	return nil
+}
+
 func (b *LocalBackend) pushSelfUpdateProgress(up ipnstate.UpdateProgress) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -7224,6 +7815,19 @@ func (b *LocalBackend) suggestExitNodeLocked(netMap *netmap.NetworkMap) (respons
 	if netMap == nil {
 		netMap = b.netMap
 	}
+	if prefs := b.pm.CurrentPrefs(); prefs.Valid() {
+		if pol, err := prefs.AutoExitNode().Policy(); err == nil {
+			netMap = filterExitNodesByPolicy(netMap, pol)
+		}
+	}
+	return b.suggestExitNodeFromLocked(netMap)
+}
+
+// suggestExitNodeFromLocked is like suggestExitNodeLocked, but suggests one
+// of the exit nodes in netMap, without applying the AutoExitNode pref.
+//
+// b.mu.lock() must be held.
+func (b *LocalBackend) suggestExitNodeFromLocked(netMap *netmap.NetworkMap) (response apitype.ExitNodeSuggestionResponse, err error) {
 	lastReport := b.MagicConn().GetLastNetcheckReport(b.ctx)
 	prevSuggestion := b.lastSuggestedExitNode
 
@@ -7499,6 +8103,116 @@ func shouldAutoExitNode() bool {
 	return exitNodeIDStr == "auto:any"
 }
 
+// autoExitNodeEnabledLocked reports whether the exit node is picked
+// automatically, by either the auto exit node MDM policy or the
+// AutoExitNode pref.
+//
+// b.mu must be held.
+func (b *LocalBackend) autoExitNodeEnabledLocked() bool {
+	return shouldAutoExitNode() || b.pm.CurrentPrefs().AutoExitNode() != ""
+}
+
+// resolveAutoExitNodeLocked sets prefs.ExitNodeID as per prefs.AutoExitNode,
+// if set, and reports whether prefs changed. The exit node is picked from
+// netMap, or b.netMap if nil.
+//
+// If the policy doesn't currently call for an exit node, ExitNodeID is
+// cleared. If it does but no exit node can be picked yet, ExitNodeID is left
+// as is, and picked again once a netcheck report is available.
+//
+// b.mu must be held.
+func (b *LocalBackend) resolveAutoExitNodeLocked(prefs *ipn.Prefs, netMap *netmap.NetworkMap) (changed bool) {
+	b.stopAutoExitNodeTimerLocked()
+	if prefs.AutoExitNode == "" {
+		return false
+	}
+	if v, _ := syspolicy.GetString(syspolicy.ExitNodeID, ""); v != "" {
+		// The exit node is managed by the system administrator.
+		return false
+	}
+	pol, err := prefs.AutoExitNode.Policy()
+	if err != nil {
+		b.logf("AutoExitNode: %v", err)
+		return false
+	}
+	if netMap == nil {
+		netMap = b.netMap
+	}
+
+	now := b.clock.Now()
+	if next, ok := pol.NextChange(now); ok && !b.shutdownCalled {
+		expr := prefs.AutoExitNode
+		b.autoExitNodeTimer = b.clock.AfterFunc(next.Sub(now), func() {
+			// Asynchronously, as setAutoExitNodeIDLockedOnEntry stops
+			// and restarts the timer, which test clocks don't allow
+			// from within their callbacks.
+			go func() {
+				b.logf("AutoExitNode: hours of %q started or ended", expr)
+				b.setAutoExitNodeIDLockedOnEntry(b.lockAndGetUnlock())
+			}()
+		})
+	}
+
+	var exitNodeID tailcfg.StableNodeID
+	if pol.ActiveAt(now, b.prevIfState.DefaultRouteInterface) {
+		if netMap == nil {
+			return false
+		}
+		res, err := b.suggestExitNodeFromLocked(filterExitNodesByPolicy(netMap, pol))
+		if err != nil || res.ID == "" {
+			if err != nil && !errors.Is(err, ErrNoPreferredDERP) {
+				b.logf("AutoExitNode: failed to pick exit node: %v", err)
+			}
+			b.refreshAutoExitNode = true
+			return false
+		}
+		exitNodeID = res.ID
+	}
+	if prefs.ExitNodeID == exitNodeID && !prefs.ExitNodeIP.IsValid() {
+		return false
+	}
+	if exitNodeID == "" {
+		b.logf("AutoExitNode: %q: not using an exit node for now", prefs.AutoExitNode)
+	} else {
+		b.logf("AutoExitNode: %q: picked exit node %q", prefs.AutoExitNode, exitNodeID)
+	}
+	prefs.ExitNodeID = exitNodeID
+	prefs.ExitNodeIP = netip.Addr{}
+	return true
+}
+
+// stopAutoExitNodeTimerLocked stops b.autoExitNodeTimer, if running.
+//
+// b.mu must be held.
+func (b *LocalBackend) stopAutoExitNodeTimerLocked() {
+	if b.autoExitNodeTimer != nil {
+		b.autoExitNodeTimer.Stop()
+		b.autoExitNodeTimer = nil
+	}
+}
+
+// filterExitNodesByPolicy returns nm, or a shallow copy of it without the
+// peers that pol doesn't allow to be picked as exit nodes.
+func filterExitNodesByPolicy(nm *netmap.NetworkMap, pol ipn.AutoExitNodePolicy) *netmap.NetworkMap {
+	if nm == nil || len(pol.Countries) == 0 {
+		return nm
+	}
+	nm2 := ptr.To(*nm)
+	nm2.Peers = make([]tailcfg.NodeView, 0, len(nm.Peers))
+	for _, p := range nm.Peers {
+		var country string
+		if hi := p.Hostinfo(); hi.Valid() {
+			if loc := hi.Location(); loc != nil {
+				country = loc.CountryCode
+			}
+		}
+		if country != "" && pol.AllowsCountry(country) {
+			nm2.Peers = append(nm2.Peers, p)
+		}
+	}
+	return nm2
+}
+
 // startAutoUpdate triggers an auto-update attempt. The actual update happens
 // asynchronously. If another update is in progress, an error is returned.
 func (b *LocalBackend) startAutoUpdate(logPrefix string) (retErr error) {
@@ -7541,12 +8255,18 @@ func (b *LocalBackend) startAutoUpdate(logPrefix string) (retErr error) {
 	}
 
 	go func() {
-		if err := cmd.Wait(); err != nil {
+		err := cmd.Wait()
+		if err != nil {
 			b.logf("%s: update command failed: %v, output: %s", logPrefix, err, buf)
 		} else {
 			b.logf("%s: update attempt complete", logPrefix)
 		}
-		b.setC2NUpdateStarted(false)
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.c2nUpdateStatus.started = false
+		if err != nil {
+			b.c2nUpdateStatus.lastErr = fmt.Sprintf("update command failed: %v", err)
+		}
 	}()
 	return nil
 }
@@ -1161,6 +1161,67 @@ type tc struct {
 	}
 }
 
+func TestExitNodeUnreachable(t *testing.T) {
+	peers := peersMap(nodeViews([]*tailcfg.Node{
+		{ID: 1, StableID: "online", Name: "online.", ComputedName: "online", Online: ptr.To(true)},
+		{ID: 2, StableID: "offline", Name: "offline.", ComputedName: "offline", Online: ptr.To(false)},
+		{ID: 3, StableID: "expired", Name: "expired.", ComputedName: "expired", Expired: true},
+		{ID: 4, StableID: "unknown"},
+	}))
+	tests := []struct {
+		name            string
+		prefs           *ipn.Prefs
+		wantUnreachable bool
+		wantReason      string
+	}{
+		{
+			name:  "no_exit_node",
+			prefs: &ipn.Prefs{},
+		},
+		{
+			name:  "online",
+			prefs: &ipn.Prefs{ExitNodeID: "online"},
+		},
+		{
+			// Peers whose online status isn't known are assumed reachable.
+			name:  "unknown_online_status",
+			prefs: &ipn.Prefs{ExitNodeID: "unknown"},
+		},
+		{
+			name:            "offline",
+			prefs:           &ipn.Prefs{ExitNodeID: "offline"},
+			wantUnreachable: true,
+			wantReason:      `exit node "offline" is offline`,
+		},
+		{
+			name:            "expired",
+			prefs:           &ipn.Prefs{ExitNodeID: "expired"},
+			wantUnreachable: true,
+			wantReason:      `the node key of exit node "expired" has expired`,
+		},
+		{
+			name:            "not_in_netmap",
+			prefs:           &ipn.Prefs{ExitNodeID: "gone"},
+			wantUnreachable: true,
+			wantReason:      "exit node gone is not in the tailnet or not visible to this device",
+		},
+		{
+			name:            "unresolved_ip",
+			prefs:           &ipn.Prefs{ExitNodeIP: netip.MustParseAddr("100.64.0.1")},
+			wantUnreachable: true,
+			wantReason:      "exit node 100.64.0.1 is not in the tailnet or not visible to this device",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, unreachable := exitNodeUnreachable(tt.prefs.View(), peers)
+			if unreachable != tt.wantUnreachable || reason != tt.wantReason {
+				t.Errorf("exitNodeUnreachable = %q, %v; want %q, %v", reason, unreachable, tt.wantReason, tt.wantUnreachable)
+			}
+		})
+	}
+}
+
 func TestDNSConfigForNetmapForExitNodeConfigs(t *testing.T) {
 	type tc struct {
 		name                 string
@@ -1961,6 +2022,105 @@ func TestUpdateNetmapDeltaAutoExitNode(t *testing.T) {
 	}
 }
 
+func TestEditPrefsAutoExitNode(t *testing.T) {
+	se := makePeer(1, withCap(26), withSuggest(), withExitRoutes(), withDERP(1), withLocation((&tailcfg.Location{CountryCode: "SE"}).View()))
+	de := makePeer(2, withCap(26), withSuggest(), withExitRoutes(), withDERP(2), withLocation((&tailcfg.Location{CountryCode: "DE"}).View()))
+	report := &netcheck.Report{
+		RegionLatency: map[int]time.Duration{
+			1: 10 * time.Millisecond,
+			2: 5 * time.Millisecond,
+		},
+		PreferredDERP: 2,
+	}
+
+	clock := tstest.NewClock(tstest.ClockOpts{Start: time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)})
+	b := newTestLocalBackend(t)
+	b.clock = clock
+	b.netMap = &netmap.NetworkMap{
+		Peers: []tailcfg.NodeView{se, de},
+		DERPMap: &tailcfg.DERPMap{
+			Regions: map[int]*tailcfg.DERPRegion{
+				1: {RegionID: 1},
+				2: {RegionID: 2},
+			},
+		},
+	}
+	b.updatePeersFromNetmapLocked(b.netMap)
+	b.sys.MagicSock.Get().SetLastNetcheckReportForTest(b.ctx, report)
+
+	setAuto := func(expr ipn.ExitNodeExpression) {
+		t.Helper()
+		if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+			Prefs:           ipn.Prefs{AutoExitNode: expr},
+			AutoExitNodeSet: true,
+		}); err != nil {
+			t.Fatalf("EditPrefs(%q): %v", expr, err)
+		}
+	}
+	checkExitNode := func(want tailcfg.StableNodeID) {
+		t.Helper()
+		if got := b.Prefs().ExitNodeID(); got != want {
+			t.Fatalf("ExitNodeID = %q; want %q", got, want)
+		}
+	}
+
+	// The lowest latency exit node.
+	setAuto(ipn.AnyExitNode)
+	checkExitNode(de.StableID())
+
+	// Only exit nodes in the given country.
+	setAuto("country=se")
+	checkExitNode(se.StableID())
+
+	// No exit node outside of the hours, until they start.
+	setAuto("country=SE,hours=22:00-06:00")
+	checkExitNode("")
+	clock.Advance(10 * time.Hour)
+	if err := tstest.WaitFor(5*time.Second, func() error {
+		if got := b.Prefs().ExitNodeID(); got != se.StableID() {
+			return fmt.Errorf("ExitNodeID = %q; want %q", got, se.StableID())
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+		Prefs:           ipn.Prefs{AutoExitNode: "fastest"},
+		AutoExitNodeSet: true,
+	}); err == nil {
+		t.Fatal("EditPrefs accepted an invalid AutoExitNode expression")
+	}
+
+	// Picking an exit node explicitly stops picking one automatically.
+	if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+		Prefs:         ipn.Prefs{ExitNodeID: de.StableID()},
+		ExitNodeIDSet: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkExitNode(de.StableID())
+	if got := b.Prefs().AutoExitNode(); got != "" {
+		t.Errorf("AutoExitNode = %q after picking an exit node; want empty", got)
+	}
+
+	// The timer for the hours doesn't outlive the backend.
+	setAuto("hours=22:00-06:00")
+	b.mu.Lock()
+	armed := b.autoExitNodeTimer != nil
+	b.mu.Unlock()
+	if !armed {
+		t.Fatal("no timer for the hours of the policy")
+	}
+	b.Shutdown()
+	b.mu.Lock()
+	armed = b.autoExitNodeTimer != nil
+	b.mu.Unlock()
+	if armed {
+		t.Error("timer for the hours of the policy still armed after Shutdown")
+	}
+}
+
 func TestAutoExitNodeSetNetInfoCallback(t *testing.T) {
 	b := newTestLocalBackend(t)
 	hi := hostinfo.New()
@@ -4685,3 +4845,23 @@ type fieldChange struct {
 		})
 	}
 }
+
+func TestSystemdStatusWithHealth(t *testing.T) {
+	tests := []struct {
+		warnings []string
+		want     string
+	}{
+		{nil, "Connected; a@b; 100.64.0.1"},
+		{[]string{"DNS unavailable"}, "Connected; a@b; 100.64.0.1; health: DNS unavailable"},
+		{
+			[]string{"Tailscale could not\nconnect to DERP", "DNS unavailable"},
+			"Connected; a@b; 100.64.0.1; health: DNS unavailable (and 1 more; see 'tailscale status')",
+		},
+		{[]string{"multi\n  line"}, "Connected; a@b; 100.64.0.1; health: multi line"},
+	}
+	for _, tt := range tests {
+		if got := systemdStatusWithHealth("Connected; a@b; 100.64.0.1", tt.warnings); got != tt.want {
+			t.Errorf("systemdStatusWithHealth(%q) = %q, want %q", tt.warnings, got, tt.want)
+		}
+	}
+}
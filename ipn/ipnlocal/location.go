@@ -0,0 +1,192 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"tailscale.com/ipn"
+	"tailscale.com/net/netmon"
+)
+
+// locationMatchOf returns the LocationMatch that matches exactly the network
+// with the given identity.
+func locationMatchOf(id netmon.NetworkIdentity) ipn.LocationMatch {
+	return ipn.LocationMatch{
+		SSID:       id.SSID,
+		GatewayMAC: id.GatewayMAC,
+		Domain:     id.Domain,
+	}
+}
+
+// locationConfigLocked returns the location profile configuration of the
+// current profile. It returns an empty configuration if there's none, or if
+// the current profile is not logged in.
+//
+// b.mu must be held.
+func (b *LocalBackend) locationConfigLocked() (*ipn.LocationConfig, error) {
+	cfg := new(ipn.LocationConfig)
+	profileID := b.pm.CurrentProfile().ID
+	if profileID == "" {
+		return cfg, nil
+	}
+	bs, err := b.store.ReadState(ipn.LocationProfilesKey(profileID))
+	if errors.Is(err, ipn.ErrStateNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading location profiles: %w", err)
+	}
+	if err := json.Unmarshal(bs, cfg); err != nil {
+		return nil, fmt.Errorf("decoding location profiles: %w", err)
+	}
+	return cfg, nil
+}
+
+// writeLocationConfigLocked stores cfg as the location profile
+// configuration of the current profile.
+//
+// b.mu must be held.
+func (b *LocalBackend) writeLocationConfigLocked(cfg *ipn.LocationConfig) error {
+	profileID := b.pm.CurrentProfile().ID
+	if profileID == "" {
+		return errors.New("not logged in")
+	}
+	bs, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("encoding location profiles: %w", err)
+	}
+	if err := b.store.WriteState(ipn.LocationProfilesKey(profileID), bs); err != nil {
+		return fmt.Errorf("writing location profiles to StateStore: %w", err)
+	}
+	return nil
+}
+
+// LocationStatus returns the current network, and the location profiles of
+// the current profile.
+func (b *LocalBackend) LocationStatus() (*ipn.LocationStatus, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cfg, err := b.locationConfigLocked()
+	if err != nil {
+		return nil, err
+	}
+	return &ipn.LocationStatus{
+		Network:  b.network,
+		Active:   cfg.Active,
+		Profiles: cfg.Profiles,
+	}, nil
+}
+
+// SetLocationProfiles replaces the location profiles of the current profile,
+// and applies the one matching the current network, if any. The overrides of
+// a previously applied profile are undone first, even if it's still the
+// matching one, so that changes to it take effect.
+func (b *LocalBackend) SetLocationProfiles(profiles []ipn.LocationProfile) error {
+	if err := ipn.CheckLocationProfiles(profiles); err != nil {
+		return err
+	}
+	unlock := b.lockAndGetUnlock()
+	defer unlock()
+	if b.isConfigLocked_Locked() {
+		return errors.New("can't reconfigure tailscaled when using a config file; config file is locked")
+	}
+	cfg, err := b.locationConfigLocked()
+	if err != nil {
+		return err
+	}
+	cfg.Profiles = profiles
+	return b.applyLocationProfileLockedOnEntry(cfg, true, unlock)
+}
+
+// applyLocationProfile applies the location profile matching the current
+// network, if it's not already applied, and undoes the overrides of the
+// previously applied one. Errors are logged.
+func (b *LocalBackend) applyLocationProfile() {
+	unlock := b.lockAndGetUnlock()
+	defer unlock()
+	if b.isConfigLocked_Locked() {
+		return
+	}
+	cfg, err := b.locationConfigLocked()
+	if err != nil {
+		b.logf("location: %v", err)
+		return
+	}
+	if len(cfg.Profiles) == 0 && cfg.Active == "" {
+		return
+	}
+	if err := b.applyLocationProfileLockedOnEntry(cfg, false, unlock); err != nil {
+		b.logf("location: %v", err)
+	}
+}
+
+// applyLocationProfileLockedOnEntry applies the profile of cfg matching the
+// current network, and stores cfg with the result. Unless force is set,
+// nothing is done if the matching profile is already the active one.
+//
+// b.mu must be held on entry. It is released on exit.
+func (b *LocalBackend) applyLocationProfileLockedOnEntry(cfg *ipn.LocationConfig, force bool, unlock unlockOnce) error {
+	defer unlock() // for error paths
+
+	prof, ok := cfg.Match(b.network)
+	if !force && prof.Name == cfg.Active {
+		return nil
+	}
+
+	// Start by restoring the prefs overridden by the active profile, then
+	// save the values of the prefs the new one overrides from the restored
+	// prefs, so that leaving its network restores the original values
+	// rather than those of the previous profile.
+	var edits ipn.LocationPrefs
+	prefs := b.pm.CurrentPrefs()
+	if cfg.Saved != nil {
+		edits = *cfg.Saved
+		p := prefs.AsStruct()
+		p.ApplyEdits(edits.MaskedPrefs())
+		prefs = p.View()
+	}
+	if cfg.Active != "" {
+		b.logf("location: leaving %q", cfg.Active)
+	}
+	cfg.Active, cfg.Saved = "", nil
+	if ok {
+		b.logf("location: applying %q", prof.Name)
+		saved := prof.Prefs.Current(prefs)
+		cfg.Active, cfg.Saved = prof.Name, &saved
+		edits = mergeLocationPrefs(edits, prof.Prefs)
+	}
+	if err := b.writeLocationConfigLocked(cfg); err != nil {
+		return err
+	}
+	if edits.IsZero() {
+		return nil
+	}
+	_, err := b.editPrefsLockedOnEntry(edits.MaskedPrefs(), unlock)
+	return err
+}
+
+// mergeLocationPrefs returns the overrides of base and over, preferring those
+// of over where both override a pref.
+func mergeLocationPrefs(base, over ipn.LocationPrefs) ipn.LocationPrefs {
+	ret := base
+	if over.RouteAll != nil {
+		ret.RouteAll = over.RouteAll
+	}
+	if over.CorpDNS != nil {
+		ret.CorpDNS = over.CorpDNS
+	}
+	if over.ShieldsUp != nil {
+		ret.ShieldsUp = over.ShieldsUp
+	}
+	if over.ExitNodeAllowLANAccess != nil {
+		ret.ExitNodeAllowLANAccess = over.ExitNodeAllowLANAccess
+	}
+	if over.ExitNode != nil {
+		ret.ExitNode = over.ExitNode
+	}
+	return ret
+}
@@ -0,0 +1,108 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/persist"
+	"tailscale.com/types/ptr"
+)
+
+func TestLocationProfiles(t *testing.T) {
+	b := newTestLocalBackend(t)
+	if err := b.pm.SetPrefs((&ipn.Prefs{
+		RouteAll: true,
+		CorpDNS:  true,
+		Persist: &persist.Persist{
+			NodeID:      "n1",
+			UserProfile: tailcfg.UserProfile{ID: 1, LoginName: "user@example.com"},
+		},
+	}).View(), ipn.NetworkProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	if b.pm.CurrentProfile().ID == "" {
+		t.Fatal("no current profile")
+	}
+
+	office := ipn.LocationMatch{GatewayMAC: "aa:bb:cc:dd:ee:ff"}
+	cafe := ipn.LocationMatch{SSID: "cafe"}
+	profiles := []ipn.LocationProfile{
+		{
+			Name:  "office",
+			Match: office,
+			Prefs: ipn.LocationPrefs{RouteAll: ptr.To(false)},
+		},
+		{
+			Name:  "cafe",
+			Match: cafe,
+			Prefs: ipn.LocationPrefs{
+				ShieldsUp: ptr.To(true),
+				RouteAll:  ptr.To(false),
+			},
+		},
+	}
+
+	setNetwork := func(network ipn.LocationMatch) {
+		t.Helper()
+		b.mu.Lock()
+		b.network = network
+		b.mu.Unlock()
+		b.applyLocationProfile()
+	}
+	check := func(wantActive string, wantRouteAll, wantShieldsUp bool) {
+		t.Helper()
+		st, err := b.LocationStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Active != wantActive {
+			t.Errorf("Active = %q; want %q", st.Active, wantActive)
+		}
+		p := b.Prefs()
+		if p.RouteAll() != wantRouteAll || p.ShieldsUp() != wantShieldsUp {
+			t.Errorf("RouteAll, ShieldsUp = %v, %v; want %v, %v", p.RouteAll(), p.ShieldsUp(), wantRouteAll, wantShieldsUp)
+		}
+		if !p.CorpDNS() {
+			t.Error("CorpDNS was changed")
+		}
+	}
+
+	// Setting the profiles applies the matching one.
+	setNetwork(office)
+	if err := b.SetLocationProfiles(profiles); err != nil {
+		t.Fatal(err)
+	}
+	check("office", false, false)
+
+	// Moving to another location undoes the overrides of the previous one
+	// before applying its own.
+	setNetwork(cafe)
+	check("cafe", false, true)
+
+	// Leaving restores the prefs from before the first profile was applied.
+	setNetwork(ipn.LocationMatch{GatewayMAC: "00:11:22:33:44:55"})
+	check("", true, false)
+
+	// Changing the active profile takes effect immediately.
+	setNetwork(office)
+	check("office", false, false)
+	profiles[0].Prefs = ipn.LocationPrefs{ShieldsUp: ptr.To(true)}
+	if err := b.SetLocationProfiles(profiles); err != nil {
+		t.Fatal(err)
+	}
+	check("office", true, true)
+
+	// Removing it restores the prefs.
+	if err := b.SetLocationProfiles(profiles[1:]); err != nil {
+		t.Fatal(err)
+	}
+	check("", true, false)
+
+	if err := b.SetLocationProfiles([]ipn.LocationProfile{{Name: "office"}}); err == nil {
+		t.Error("SetLocationProfiles accepted a profile without a match")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"tailscale.com/ipn"
+	"tailscale.com/logtail"
+	"tailscale.com/logtail/redact"
+)
+
+// logRedactionStateKey is the state store key of the JSON-encoded log
+// redaction rules, as set by SetLogRedactionRules.
+const logRedactionStateKey = ipn.StateKey("_log-redaction-rules")
+
+// loadLogRedactionRules applies the log redaction rules saved in the state
+// store, if any.
+func (b *LocalBackend) loadLogRedactionRules() {
+	j, err := b.store.ReadState(logRedactionStateKey)
+	if errors.Is(err, ipn.ErrStateNotExist) {
+		return
+	}
+	var rules []redact.Rule
+	if err == nil {
+		err = json.Unmarshal(j, &rules)
+	}
+	var r *redact.Redactor
+	if err == nil {
+		r, err = redact.New(rules)
+	}
+	if err != nil {
+		b.logf("loading log redaction rules: %v", err)
+		return
+	}
+	b.mu.Lock()
+	b.logRedactor = r
+	b.mu.Unlock()
+	logtail.SetRedactor(r)
+}
+
+// LogRedactionRules returns the rules that redact sensitive data from logs
+// before they're written or uploaded.
+func (b *LocalBackend) LogRedactionRules() []redact.Rule {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.logRedactor.Rules()
+}
+
+// SetLogRedactionRules sets and saves the rules that redact sensitive data
+// from logs before they're written or uploaded. Empty rules redact nothing.
+func (b *LocalBackend) SetLogRedactionRules(rules []redact.Rule) error {
+	r, err := redact.New(rules)
+	if err != nil {
+		return err
+	}
+	j, err := json.Marshal(r.Rules())
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.store.WriteState(logRedactionStateKey, j); err != nil {
+		return fmt.Errorf("saving log redaction rules: %w", err)
+	}
+	b.logRedactor = r
+	logtail.SetRedactor(r)
+	b.logf("log redaction rules set: %d rules", len(rules))
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"tailscale.com/ipn/store/mem"
+	"tailscale.com/logtail"
+	"tailscale.com/logtail/redact"
+	"tailscale.com/tsd"
+)
+
+func TestLogRedactionRules(t *testing.T) {
+	t.Cleanup(func() { logtail.SetRedactor(nil) })
+	store := new(mem.Store)
+	sys := new(tsd.System)
+	sys.Set(store)
+	b := newTestLocalBackendWithSys(t, sys)
+
+	if err := b.SetLogRedactionRules([]redact.Rule{{Regexp: "("}}); err == nil {
+		t.Error("invalid rule accepted")
+	}
+	rules := []redact.Rule{
+		{Regexp: `db-\d+`},
+		{Prefix: netip.MustParsePrefix("10.0.0.0/8"), Replacement: "10.x"},
+	}
+	if err := b.SetLogRedactionRules(rules); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.LogRedactionRules(); !reflect.DeepEqual(got, rules) {
+		t.Errorf("rules = %+v; want %+v", got, rules)
+	}
+
+	// The rules are loaded from the state store on start.
+	sys2 := new(tsd.System)
+	sys2.Set(store)
+	b2 := newTestLocalBackendWithSys(t, sys2)
+	if got := b2.LogRedactionRules(); !reflect.DeepEqual(got, rules) {
+		t.Errorf("after restart, rules = %+v; want %+v", got, rules)
+	}
+
+	if err := b2.SetLogRedactionRules(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := b2.LogRedactionRules(); got != nil {
+		t.Errorf("after clearing, rules = %+v; want none", got)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/logtail/backoff"
+	"tailscale.com/net/netutil"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/mak"
+)
+
+const metricsServerPort = ipn.MetricsServerPort
+
+// ShouldRunMetricsServer reports whether the node's client metrics should be
+// served over Tailscale on port 5253, as controlled by the RunMetricsServer
+// pref. It is safe to call while holding b.mu.
+func (b *LocalBackend) ShouldRunMetricsServer() bool {
+	return b.serviceFlags.Test(serviceFlagRunMetricsServer)
+}
+
+// handleMetricsServerConn serves metrics server requests.
+func (b *LocalBackend) handleMetricsServerConn(c net.Conn) error {
+	s := http.Server{Handler: http.HandlerFunc(b.serveMetricsServer)}
+	return s.Serve(netutil.NewOneConnListener(c, nil))
+}
+
+// serveMetricsServer serves the node's client metrics in the Prometheus text
+// exposition format at /metrics.
+func (b *LocalBackend) serveMetricsServer(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/metrics" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b.UserMetricsRegistry().Handler(w, r)
+	b.writeNodeMetrics(w)
+}
+
+// writeNodeMetrics writes metrics describing this node's view of the tailnet
+// that are computed on demand rather than tracked in the usermetric registry:
+// per-peer traffic and paths, DERP usage, netmap age, and health warnings.
+//
+// Per-peer metrics are deliberately kept out of the usermetric registry
+// (which is also served over LocalAPI) because of their cardinality.
+func (b *LocalBackend) writeNodeMetrics(w io.Writer) {
+	st := b.Status()
+	now := b.clock.Now()
+
+	b.mu.Lock()
+	lastNetMap := b.lastNetMapUpdate
+	b.mu.Unlock()
+
+	if !lastNetMap.IsZero() {
+		writePromHeader(w, "tailscaled_netmap_age_seconds", "gauge", "Seconds since the last network map update from the coordination server.")
+		fmt.Fprintf(w, "tailscaled_netmap_age_seconds %v\n", now.Sub(lastNetMap).Round(time.Millisecond).Seconds())
+	}
+
+	if st.Self != nil && st.Self.Relay != "" {
+		writePromHeader(w, "tailscaled_derp_home_region", "gauge", "The DERP region this node uses as its home, as a labeled constant 1.")
+		fmt.Fprintf(w, "tailscaled_derp_home_region{region=%s} 1\n", promLabelValue(st.Self.Relay))
+	}
+
+	type peerMetrics struct {
+		name   string
+		path   string
+		rx, tx int64
+	}
+	var peers []peerMetrics
+	pathCount := map[string]int{"direct": 0, "derp": 0, "idle": 0}
+	for _, ps := range st.Peer {
+		pm := peerMetrics{
+			name: cmp.Or(strings.TrimSuffix(ps.DNSName, "."), ps.HostName),
+			rx:   ps.RxBytes,
+			tx:   ps.TxBytes,
+		}
+		switch {
+		case ps.CurAddr != "":
+			pm.path = "direct"
+		case ps.Relay != "" && ps.Active:
+			pm.path = "derp"
+		default:
+			pm.path = "idle"
+		}
+		pathCount[pm.path]++
+		peers = append(peers, pm)
+	}
+	slices.SortFunc(peers, func(a, b peerMetrics) int { return strings.Compare(a.name, b.name) })
+
+	writePromHeader(w, "tailscaled_peers", "gauge", "Number of peers broken down by the path currently used to reach them.")
+	for _, path := range []string{"direct", "derp", "idle"} {
+		fmt.Fprintf(w, "tailscaled_peers{path=%q} %d\n", path, pathCount[path])
+	}
+	if len(peers) > 0 {
+		writePromHeader(w, "tailscaled_peer_path", "gauge", "The path currently used to reach each peer, as a labeled constant 1.")
+		for _, pm := range peers {
+			fmt.Fprintf(w, "tailscaled_peer_path{peer=%s,path=%q} 1\n", promLabelValue(pm.name), pm.path)
+		}
+		writePromHeader(w, "tailscaled_peer_received_bytes_total", "counter", "Bytes received from each peer.")
+		for _, pm := range peers {
+			fmt.Fprintf(w, "tailscaled_peer_received_bytes_total{peer=%s} %d\n", promLabelValue(pm.name), pm.rx)
+		}
+		writePromHeader(w, "tailscaled_peer_sent_bytes_total", "counter", "Bytes sent to each peer.")
+		for _, pm := range peers {
+			fmt.Fprintf(w, "tailscaled_peer_sent_bytes_total{peer=%s} %d\n", promLabelValue(pm.name), pm.tx)
+		}
+	}
+
+	if warnings := b.health.CurrentState().Warnings; len(warnings) > 0 {
+		writePromHeader(w, "tailscaled_health_warning", "gauge", "Currently unhealthy health checks, as a labeled constant 1.")
+		for _, code := range slices.Sorted(maps.Keys(warnings)) {
+			fmt.Fprintf(w, "tailscaled_health_warning{code=%s,severity=%q} 1\n", promLabelValue(string(code)), warnings[code].Severity)
+		}
+	}
+}
+
+func writePromHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# TYPE %s %s\n# HELP %s %s\n", name, typ, name, help)
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabelValue returns s quoted and escaped for use as a Prometheus label
+// value.
+func promLabelValue(s string) string {
+	return `"` + promLabelEscaper.Replace(s) + `"`
+}
+
+// updateMetricsServerListenersLocked creates listeners on the metrics server
+// port (5253) for each of the local device's Tailscale IP addresses, or closes
+// them if the metrics server has been disabled. This is needed to properly
+// route local traffic when using kernel networking mode.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateMetricsServerListenersLocked() {
+	if !b.ShouldRunMetricsServer() || b.netMap == nil {
+		b.closeMetricsServerListenersLocked()
+		return
+	}
+
+	addrs := b.netMap.GetAddresses()
+	for _, pfx := range addrs.All() {
+		addrPort := netip.AddrPortFrom(pfx.Addr(), metricsServerPort)
+		if _, ok := b.metricsServerListeners[addrPort]; ok {
+			continue // already listening
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		sl := &localListener{
+			b:      b,
+			ap:     addrPort,
+			ctx:    ctx,
+			cancel: cancel,
+			logf:   logger.WithPrefix(b.logf, "metrics-server: "),
+
+			handler: b.handleMetricsServerConn,
+			bo:      backoff.NewBackoff("metrics-server-listener", b.logf, 30*time.Second),
+		}
+		mak.Set(&b.metricsServerListeners, addrPort, sl)
+
+		go sl.Run()
+	}
+}
+
+// closeMetricsServerListenersLocked closes any metrics server listeners.
+//
+// b.mu must be held.
+func (b *LocalBackend) closeMetricsServerListenersLocked() {
+	for ap, ln := range b.metricsServerListeners {
+		ln.Close()
+		delete(b.metricsServerListeners, ap)
+	}
+}
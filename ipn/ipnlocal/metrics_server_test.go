@@ -0,0 +1,78 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tailscale.com/health"
+	"tailscale.com/ipn"
+)
+
+func TestServeMetricsServer(t *testing.T) {
+	b := newTestLocalBackend(t)
+
+	w := health.Register(&health.Warnable{
+		Code:     "test-metrics-server",
+		Severity: health.SeverityHigh,
+		Text:     health.StaticMessage("test"),
+	})
+	b.health.SetUnhealthy(w, nil)
+
+	rec := httptest.NewRecorder()
+	b.serveMetricsServer(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status = %v; want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE tailscaled_peers gauge\n",
+		`tailscaled_peers{path="direct"} 0`,
+		`tailscaled_health_warning{code="test-metrics-server",severity="high"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q; got:\n%s", want, body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	b.serveMetricsServer(rec, httptest.NewRequest("GET", "/debug", nil))
+	if rec.Code != 404 {
+		t.Errorf("status for /debug = %v; want 404", rec.Code)
+	}
+}
+
+func TestMetricsServerPref(t *testing.T) {
+	b := newTestLocalBackend(t)
+	if b.ShouldRunMetricsServer() {
+		t.Fatalf("metrics server enabled by default")
+	}
+	if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+		Prefs:               ipn.Prefs{RunMetricsServer: true},
+		RunMetricsServerSet: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !b.ShouldRunMetricsServer() {
+		t.Errorf("metrics server not enabled after setting RunMetricsServer pref")
+	}
+}
+
+func TestPromLabelValue(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"foo", `"foo"`},
+		{`a"b`, `"a\"b"`},
+		{`a\b`, `"a\\b"`},
+		{"a\nb", `"a\nb"`},
+	}
+	for _, tt := range tests {
+		if got := promLabelValue(tt.in); got != tt.want {
+			t.Errorf("promLabelValue(%q) = %s; want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"net/netip"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/net/netcheck"
+	"tailscale.com/tailcfg"
+)
+
+// addNATDiagnostics sets pr.NATDiagnostics if pr is a ping via DERP of the
+// peer with Tailscale IP ip.
+func (b *LocalBackend) addNATDiagnostics(ip netip.Addr, pr *ipnstate.PingResult) {
+	if pr.DERPRegionID == 0 || pr.Err != "" {
+		return
+	}
+	pip, ok := b.e.PeerForIP(ip)
+	if !ok || pip.IsSelf {
+		return
+	}
+	paths, _ := b.MagicConn().GetPathStats(pip.Node)
+	self := b.MagicConn().GetLastNetcheckReport(context.Background())
+	pr.NATDiagnostics = natDiagnostics(self, pip.Node, paths)
+}
+
+// natDiagnostics returns the likely reasons that peer isn't reachable over a
+// direct path, given this node's last netcheck report self (or nil if there
+// is none) and the stats of the paths to the peer.
+func natDiagnostics(self *netcheck.Report, peer tailcfg.NodeView, paths []ipnstate.PathStats) []ipnstate.NATDiagnostic {
+	var ds []ipnstate.NATDiagnostic
+	add := func(code ipnstate.NATDiagnosticCode, msg string) {
+		ds = append(ds, ipnstate.NATDiagnostic{Code: code, Message: msg})
+	}
+
+	var peerNI tailcfg.NetInfoView
+	if peer.Hostinfo().Valid() {
+		peerNI = peer.Hostinfo().NetInfo()
+	}
+	selfUDP := self == nil || self.UDP
+	peerUDP := !peerNI.Valid() || !peerNI.WorkingUDP().EqualBool(false)
+	if !selfUDP {
+		add(ipnstate.NATUDPBlocked, "this node can't send UDP to the internet; a firewall is likely blocking outbound UDP")
+	}
+	if !peerUDP {
+		add(ipnstate.NATPeerUDPBlocked, "the peer can't send UDP to the internet; a firewall on its network is likely blocking outbound UDP")
+	}
+
+	if selfUDP && peerUDP {
+		selfHard := self != nil && self.MappingVariesByDestIP.EqualBool(true)
+		selfPortMap := self != nil && (self.UPnP.EqualBool(true) || self.PMP.EqualBool(true) || self.PCP.EqualBool(true))
+		peerHard := peerNI.Valid() && peerNI.MappingVariesByDestIP().EqualBool(true)
+		peerPortMap := peerNI.Valid() && (peerNI.HavePortMap() || peerNI.UPnP().EqualBool(true) || peerNI.PMP().EqualBool(true) || peerNI.PCP().EqualBool(true))
+		switch {
+		case selfHard && peerHard && !selfPortMap && !peerPortMap:
+			add(ipnstate.NATHardBoth, "both this node and the peer are behind hard NATs (their mapping varies by destination); enabling UPnP, NAT-PMP or PCP on either router, or opening a UDP port to one of them, would allow a direct connection")
+		case selfHard && !selfPortMap:
+			add(ipnstate.NATNoPortMap, "this node is behind a hard NAT (its mapping varies by destination) without port mapping; enabling UPnP, NAT-PMP or PCP on its router would help")
+		case peerHard && !peerPortMap:
+			add(ipnstate.NATNoPortMap, "the peer is behind a hard NAT (its mapping varies by destination) without port mapping; enabling UPnP, NAT-PMP or PCP on its router would help")
+		}
+	}
+
+	if peer.Endpoints().Len() == 0 {
+		add(ipnstate.NATStaleEndpoints, "the peer has no known endpoints; it may be offline or not have reported its addresses yet")
+	} else {
+		var direct, answered int
+		for _, p := range paths {
+			if p.Endpoint == "" || p.Pings == 0 {
+				continue
+			}
+			direct++
+			if p.Lost < p.Pings {
+				answered++
+			}
+		}
+		if direct > 0 && answered == 0 {
+			add(ipnstate.NATStaleEndpoints, "none of the peer's known endpoints answered recent pings; they may be stale after a network change")
+		}
+	}
+	return ds
+}
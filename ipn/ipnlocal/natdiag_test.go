@@ -0,0 +1,78 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/net/netcheck"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/opt"
+)
+
+func TestNATDiagnostics(t *testing.T) {
+	easy := &netcheck.Report{UDP: true, MappingVariesByDestIP: "false"}
+	hard := &netcheck.Report{UDP: true, MappingVariesByDestIP: "true"}
+	hardPortMap := &netcheck.Report{UDP: true, MappingVariesByDestIP: "true", UPnP: "true"}
+	noUDP := &netcheck.Report{UDP: false}
+
+	peer := func(ni *tailcfg.NetInfo, endpoints ...string) tailcfg.NodeView {
+		n := &tailcfg.Node{Hostinfo: (&tailcfg.Hostinfo{NetInfo: ni}).View()}
+		for _, ep := range endpoints {
+			n.Endpoints = append(n.Endpoints, netip.MustParseAddrPort(ep))
+		}
+		return n.View()
+	}
+	peerEasy := &tailcfg.NetInfo{WorkingUDP: "true", MappingVariesByDestIP: "false"}
+	peerHard := &tailcfg.NetInfo{WorkingUDP: "true", MappingVariesByDestIP: "true"}
+	peerHardPortMap := &tailcfg.NetInfo{WorkingUDP: "true", MappingVariesByDestIP: "true", HavePortMap: true}
+	peerNoUDP := &tailcfg.NetInfo{WorkingUDP: opt.Bool("false")}
+
+	const ep = "1.2.3.4:41641"
+	tests := []struct {
+		name  string
+		self  *netcheck.Report
+		peer  tailcfg.NodeView
+		paths []ipnstate.PathStats
+		want  []ipnstate.NATDiagnosticCode
+	}{
+		{"easy", easy, peer(peerEasy, ep), nil, nil},
+		{"no-report", nil, peer(nil, ep), nil, nil},
+		{"hard-both", hard, peer(peerHard, ep), nil, []ipnstate.NATDiagnosticCode{ipnstate.NATHardBoth}},
+		{"hard-both-self-portmap", hardPortMap, peer(peerHard, ep), nil, []ipnstate.NATDiagnosticCode{ipnstate.NATNoPortMap}},
+		{"hard-both-both-portmap", hardPortMap, peer(peerHardPortMap, ep), nil, nil},
+		{"hard-self", hard, peer(peerEasy, ep), nil, []ipnstate.NATDiagnosticCode{ipnstate.NATNoPortMap}},
+		{"hard-peer", easy, peer(peerHard, ep), nil, []ipnstate.NATDiagnosticCode{ipnstate.NATNoPortMap}},
+		{"udp-blocked", noUDP, peer(peerHard, ep), nil, []ipnstate.NATDiagnosticCode{ipnstate.NATUDPBlocked}},
+		{"peer-udp-blocked", hard, peer(peerNoUDP, ep), nil, []ipnstate.NATDiagnosticCode{ipnstate.NATPeerUDPBlocked}},
+		{"no-endpoints", easy, peer(peerEasy), nil, []ipnstate.NATDiagnosticCode{ipnstate.NATStaleEndpoints}},
+		{
+			"stale-endpoints", easy, peer(peerEasy, ep),
+			[]ipnstate.PathStats{{DERPRegionID: 1, Pings: 5}, {Endpoint: ep, Pings: 5, Lost: 5}},
+			[]ipnstate.NATDiagnosticCode{ipnstate.NATStaleEndpoints},
+		},
+		{
+			"some-endpoint-answers", easy, peer(peerEasy, ep),
+			[]ipnstate.PathStats{{Endpoint: ep, Pings: 5, Lost: 5}, {Endpoint: "[2001:db8::1]:41641", Pings: 5, Lost: 1}},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []ipnstate.NATDiagnosticCode
+			for _, d := range natDiagnostics(tt.self, tt.peer, tt.paths) {
+				if d.Message == "" {
+					t.Errorf("diagnostic %q has no message", d.Code)
+				}
+				got = append(got, d.Code)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"runtime"
+	"time"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+	"tailscale.com/version"
+)
+
+// processStartTime approximates when tailscaled started, for NodeInfo.
+var processStartTime = time.Now()
+
+// nodeInfo returns this node's self-reported state for the peer with
+// Tailscale IP requester, which is invalid if the state is for the local
+// user.
+func (b *LocalBackend) nodeInfo(ctx context.Context, requester netip.Addr) *apitype.NodeInfo {
+	b.mu.Lock()
+	ni := &apitype.NodeInfo{
+		OS:           runtime.GOOS,
+		Version:      version.Long(),
+		BackendState: b.state.String(),
+		StartTime:    processStartTime,
+		Health:       b.health.Strings(),
+	}
+	if b.hostinfo != nil {
+		ni.Hostname = b.hostinfo.Hostname
+		ni.OS = b.hostinfo.OS
+	}
+	b.mu.Unlock()
+
+	if requester.IsValid() {
+		// Not being able to describe the paths to the requester (if
+		// it isn't a peer, but this node itself) isn't an error.
+		ni.Paths, _ = b.GetPeerPathStats(ctx, requester)
+	}
+	return ni
+}
+
+// canReadNodeInfo reports whether h can read this node's NodeInfo.
+func (h *peerAPIHandler) canReadNodeInfo() bool {
+	if h.peerNode.UnsignedPeerAPIOnly() {
+		return false
+	}
+	return h.isSelf || h.peerHasCap(tailcfg.PeerCapabilityNodeInfo) || h.canDebug()
+}
+
+func (h *peerAPIHandler) handleServeNodeInfo(w http.ResponseWriter, r *http.Request) {
+	if !h.canReadNodeInfo() {
+		http.Error(w, "denied; no node-info access", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	var requester netip.Addr
+	if !h.isSelf {
+		requester = h.remoteAddr.Addr()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.ps.b.nodeInfo(r.Context(), requester))
+}
+
+// PeerNodeInfo returns the self-reported state of the peer with Tailscale IP
+// ip, as returned by the peer's peerapi. If ip is one of this node's own
+// addresses, it returns this node's state.
+func (b *LocalBackend) PeerNodeInfo(ctx context.Context, ip netip.Addr) (*apitype.NodeInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	nm := b.NetMap()
+	if nm == nil {
+		return nil, errors.New("no netmap")
+	}
+	for _, pfx := range nm.GetAddresses().All() {
+		if pfx.IsSingleIP() && pfx.Addr() == ip {
+			return b.nodeInfo(ctx, netip.Addr{}), nil
+		}
+	}
+	peer, ok := nm.PeerByTailscaleIP(ip)
+	if !ok {
+		return nil, fmt.Errorf("no peer found with Tailscale IP %v", ip)
+	}
+	if peer.Expired() {
+		return nil, errors.New("peer's node key has expired")
+	}
+	base := peerAPIBase(nm, peer)
+	if base == "" {
+		return nil, fmt.Errorf("no PeerAPI base found for peer %v (%v)", peer.ID(), ip)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", base+"/v0/node-info", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.Dialer().PeerAPIHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden, http.StatusNotFound:
+		// Old peers return 404 (or their HTML landing page; see
+		// below). Either way the peer won't tell us.
+		return nil, fmt.Errorf("peer %v does not share its node info with this node; it needs to grant %s", peer.ComputedName(), tailcfg.PeerCapabilityNodeInfo)
+	default:
+		return nil, fmt.Errorf("peer %v: %v", peer.ComputedName(), res.Status)
+	}
+	ni := new(apitype.NodeInfo)
+	if err := json.Unmarshal(body, ni); err != nil {
+		// Peers without the node-info handler serve their HTML
+		// landing page for unknown paths.
+		return nil, fmt.Errorf("peer %v does not support node info; it may need a newer version of Tailscale", peer.ComputedName())
+	}
+	return ni, nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+	"tailscale.com/version"
+)
+
+func TestHandleServeNodeInfo(t *testing.T) {
+	b := newTestLocalBackend(t)
+	h := &peerAPIHandler{
+		ps:         &peerAPIServer{b: b},
+		remoteAddr: netip.MustParseAddrPort("100.100.100.101:12345"),
+		selfNode:   (&tailcfg.Node{}).View(),
+		peerNode:   (&tailcfg.Node{}).View(),
+	}
+	serve := func(method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.handleServeNodeInfo(rec, httptest.NewRequest(method, "/v0/node-info", nil))
+		return rec
+	}
+
+	if rec := serve("GET"); rec.Code != http.StatusForbidden {
+		t.Errorf("peer without capability: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	h.isSelf = true
+	if rec := serve("POST"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+	rec := serve("GET")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("self: status = %d, want %d; body: %s", rec.Code, http.StatusOK, rec.Body.Bytes())
+	}
+	var ni apitype.NodeInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &ni); err != nil {
+		t.Fatal(err)
+	}
+	if ni.Version != version.Long() || ni.BackendState != b.State().String() || !ni.StartTime.Equal(processStartTime) {
+		t.Errorf("got %+v; want version %q, state %v, start time %v", ni, version.Long(), b.State(), processStartTime)
+	}
+
+	h.isSelf = false
+	h.peerNode = (&tailcfg.Node{UnsignedPeerAPIOnly: true}).View()
+	if h.canReadNodeInfo() {
+		t.Error("unsigned peer can read node info")
+	}
+}
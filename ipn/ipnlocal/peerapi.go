@@ -4,6 +4,7 @@
 package ipnlocal
 
 import (
+	"cmp"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -17,6 +18,7 @@
 	"net/netip"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"slices"
@@ -44,6 +46,7 @@
 	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/httphdr"
 	"tailscale.com/util/httpm"
+	"tailscale.com/util/syspolicy"
 	"tailscale.com/wgengine/filter"
 )
 
@@ -357,6 +360,15 @@ func (h *peerAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "/v0/sockstats":
 		h.handleServeSockStats(w, r)
 		return
+	case "/v0/node-info":
+		h.handleServeNodeInfo(w, r)
+		return
+	case "/v0/update":
+		h.handleServeUpdate(w, r)
+		return
+	case "/v0/cert":
+		h.handleServeCert(w, r)
+		return
 	case "/v0/ingress":
 		metricIngressCalls.Add(1)
 		h.handleServeIngress(w, r)
@@ -654,6 +666,10 @@ func (h *peerAPIHandler) handlePeerPut(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, taildrop.ErrNoTaildrop.Error(), http.StatusForbidden)
 		return
 	}
+	if !sysPolicyAllows(syspolicy.AllowTaildropReceive) {
+		http.Error(w, "receiving files is disabled by system policy", http.StatusForbidden)
+		return
+	}
 	rawPath := r.URL.EscapedPath()
 	prefix, ok := strings.CutPrefix(rawPath, "/v0/put/")
 	if !ok {
@@ -1200,6 +1216,25 @@ func (h *peerAPIHandler) handleServeDrive(w http.ResponseWriter, r *http.Request
 
 	r.URL.Path = strings.TrimPrefix(r.URL.Path, taildrivePrefix)
 	fs.ServeHTTPWithPerms(p, wr, r)
+
+	if driveAuditedMethods.Contains(r.Method) && wr.statusCode != http.StatusNotModified {
+		share, rest, _ := strings.Cut(strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/"), "/")
+		user := h.peerUser.LoginName
+		if h.peerNode.IsTagged() {
+			user = strings.Join(h.peerNode.Tags().AsSlice(), ",")
+		}
+		h.ps.b.driveRecordAccess(drive.AccessEvent{
+			Time:          h.ps.b.clock.Now(),
+			Share:         share,
+			Path:          "/" + rest,
+			Method:        r.Method,
+			Status:        cmp.Or(wr.statusCode, http.StatusOK),
+			Node:          h.peerNode.ComputedName(),
+			User:          user,
+			BytesSent:     wr.contentLength,
+			BytesReceived: bw.bytesRead,
+		})
+	}
 }
 
 // parseDriveFileExtensionForLog parses the file extension, if available.
@@ -0,0 +1,72 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"fmt"
+	"strings"
+
+	"tailscale.com/health"
+	"tailscale.com/posture"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/logger"
+	"tailscale.com/types/netmap"
+)
+
+// evalPostureCheck evaluates a posture check against the local system. It is
+// a variable so tests can replace it.
+var evalPostureCheck = posture.Evaluate
+
+// postureBlockedWarnable is set when the tailnet's device posture policy
+// blocks incoming connections because the device fails a posture check.
+var postureBlockedWarnable = health.Register(&health.Warnable{
+	Code:     "posture-enforcement-blocked",
+	Title:    "Incoming connections blocked",
+	Severity: health.SeverityMedium,
+	Text: func(args health.Args) string {
+		return "Your tailnet's device posture policy is blocking incoming connections to this device: " + args[health.ArgError]
+	},
+	Component:      health.ComponentBackend,
+	RemediationURL: "https://tailscale.com/kb/1288/device-posture",
+})
+
+// postureBlocksInbound evaluates the PostureEnforcement directives in the
+// capabilities of the self node of nm, and reports whether they block
+// incoming connections. If so, reason describes the failing checks.
+func postureBlocksInbound(nm *netmap.NetworkMap, logf logger.Logf) (block bool, reason string) {
+	if nm == nil || !nm.SelfNode.Valid() {
+		return false, ""
+	}
+	vals, ok := nm.SelfNode.CapMap().GetOk(tailcfg.NodeAttrPostureEnforcement)
+	if !ok {
+		return false, ""
+	}
+	directives, err := tailcfg.UnmarshalNodeCapJSON[tailcfg.PostureEnforcement](tailcfg.NodeCapMap{
+		tailcfg.NodeAttrPostureEnforcement: vals.AsSlice(),
+	}, tailcfg.NodeAttrPostureEnforcement)
+	if err != nil {
+		// Fail closed: the directives were meant to restrict access.
+		return true, fmt.Sprintf("invalid posture enforcement policy: %v", err)
+	}
+	var failed []string
+	results := map[string]error{}
+	for _, d := range directives {
+		if d.Block != "inbound" {
+			logf("posture: ignoring enforcement directive with unsupported block %q", d.Block)
+			continue
+		}
+		for _, check := range d.Require {
+			err, ok := results[check]
+			if !ok {
+				err = evalPostureCheck(check)
+				results[check] = err
+				if err != nil {
+					failed = append(failed, err.Error())
+				}
+			}
+			block = block || err != nil
+		}
+	}
+	return block, strings.Join(failed, "; ")
+}
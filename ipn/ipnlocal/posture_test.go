@@ -0,0 +1,114 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstest"
+	"tailscale.com/types/netmap"
+	"tailscale.com/util/mak"
+)
+
+func postureNetMap(directives ...string) *netmap.NetworkMap {
+	n := &tailcfg.Node{ID: 1}
+	for _, d := range directives {
+		mak.Set(&n.CapMap, tailcfg.NodeAttrPostureEnforcement, append(n.CapMap[tailcfg.NodeAttrPostureEnforcement], tailcfg.RawMessage(d)))
+	}
+	return &netmap.NetworkMap{SelfNode: n.View()}
+}
+
+func fakePostureChecks(t *testing.T, passing ...string) {
+	tstest.Replace(t, &evalPostureCheck, func(check string) error {
+		for _, p := range passing {
+			if p == check {
+				return nil
+			}
+		}
+		return errors.New(check + " failed")
+	})
+}
+
+func TestPostureBlocksInbound(t *testing.T) {
+	fakePostureChecks(t, "disk-encryption")
+	tests := []struct {
+		name       string
+		nm         *netmap.NetworkMap
+		wantBlock  bool
+		wantReason string
+	}{
+		{
+			name: "no-netmap",
+		},
+		{
+			name: "no-directives",
+			nm:   postureNetMap(),
+		},
+		{
+			name: "passing",
+			nm:   postureNetMap(`{"block":"inbound","require":["disk-encryption"]}`),
+		},
+		{
+			name:       "failing",
+			nm:         postureNetMap(`{"block":"inbound","require":["disk-encryption","firewall"]}`, `{"block":"inbound","require":["firewall","screen-lock"]}`),
+			wantBlock:  true,
+			wantReason: "firewall failed; screen-lock failed",
+		},
+		{
+			name: "unsupported-block",
+			nm:   postureNetMap(`{"block":"outbound","require":["firewall"]}`),
+		},
+		{
+			name:       "invalid",
+			nm:         postureNetMap(`{"block":["inbound"]}`),
+			wantBlock:  true,
+			wantReason: "invalid posture enforcement policy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, reason := postureBlocksInbound(tt.nm, t.Logf)
+			if block != tt.wantBlock || !strings.HasPrefix(reason, tt.wantReason) || (tt.wantReason == "" && reason != "") {
+				t.Errorf("postureBlocksInbound = %v, %q; want %v, %q", block, reason, tt.wantBlock, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestUpdateFilterPostureEnforcement(t *testing.T) {
+	fakePostureChecks(t)
+	b := newTestLocalBackend(t)
+	prefs := ipn.NewPrefs()
+	prefs.ShieldsUp = false
+
+	update := func(nm *netmap.NetworkMap) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.updateFilterLocked(nm, prefs.View())
+	}
+	check := func(wantBlocked bool) {
+		t.Helper()
+		if got := b.e.GetFilter().ShieldsUp(); got != wantBlocked {
+			t.Errorf("filter blocks inbound = %v, want %v", got, wantBlocked)
+		}
+		_, unhealthy := b.health.CurrentState().Warnings[postureBlockedWarnable.Code]
+		if unhealthy != wantBlocked {
+			t.Errorf("posture warning present = %v, want %v", unhealthy, wantBlocked)
+		}
+	}
+
+	update(postureNetMap())
+	check(false)
+	update(postureNetMap(`{"block":"inbound","require":["disk-encryption"]}`))
+	check(true)
+	if w := b.health.CurrentState().Warnings[postureBlockedWarnable.Code]; !strings.Contains(w.Text, "disk-encryption failed") {
+		t.Errorf("posture warning text = %q, want it to explain the failing check", w.Text)
+	}
+	update(postureNetMap())
+	check(false)
+}
@@ -0,0 +1,323 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"tailscale.com/envknob"
+	"tailscale.com/health"
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+	"tailscale.com/util/eventbus"
+)
+
+// startupBarrier is the comma-separated list of readiness checks that must
+// pass, once the backend is connected, for it to report the Running state,
+// and for tailscaled to tell systemd that it's ready. The checks are:
+//
+//   - "dns": MagicDNS resolves this node's name, using the host's resolver
+//     unless tailscaled uses userspace networking.
+//   - "routes": the exit node and subnet routers in use answer pings.
+//
+// "all" is all of the above. Empty, the default, is none.
+var startupBarrier = envknob.RegisterString("TS_STARTUP_BARRIER")
+
+// startupBarrierTimeout is how long the readiness checks may take before the
+// backend reports Running regardless. Zero means defaultStartupBarrierTimeout.
+var startupBarrierTimeout = envknob.RegisterDuration("TS_STARTUP_BARRIER_TIMEOUT")
+
+const defaultStartupBarrierTimeout = time.Minute
+
+// readinessRetryInterval is how often failed readiness checks are retried.
+const readinessRetryInterval = 500 * time.Millisecond
+
+// readinessChecks are the checks of the startup barrier.
+type readinessChecks struct {
+	dns    bool
+	routes bool
+}
+
+func (c readinessChecks) any() bool { return c.dns || c.routes }
+
+// parseReadinessChecks parses the value of TS_STARTUP_BARRIER.
+func parseReadinessChecks(s string) (readinessChecks, error) {
+	var c readinessChecks
+	for _, f := range strings.Split(s, ",") {
+		switch strings.TrimSpace(f) {
+		case "":
+		case "dns":
+			c.dns = true
+		case "routes":
+			c.routes = true
+		case "all":
+			c.dns, c.routes = true, true
+		default:
+			return readinessChecks{}, fmt.Errorf("unknown readiness check %q; want dns, routes or all", f)
+		}
+	}
+	return c, nil
+}
+
+// readinessState is the progress of the startup barrier's checks.
+type readinessState int
+
+const (
+	readinessNotStarted readinessState = iota
+	readinessChecking
+	readinessPassed // or timed out
+)
+
+// StartupBarrierTimeout reports whether the backend has a startup barrier,
+// as configured by TS_STARTUP_BARRIER, and if so, how long its checks may
+// take.
+func (b *LocalBackend) StartupBarrierTimeout() (_ time.Duration, ok bool) {
+	if !b.readiness.any() {
+		return 0, false
+	}
+	return b.readinessTimeout, true
+}
+
+// readyForRunningLocked reports whether the startup barrier, if any, has
+// passed, so that the backend may go from Starting to Running. If it hasn't,
+// it starts the readiness checks, which call the state machine again once
+// they're done.
+//
+// b.mu must be held.
+func (b *LocalBackend) readyForRunningLocked() bool {
+	switch {
+	case !b.readiness.any() || b.readinessState == readinessPassed:
+		return true
+	case b.readinessState == readinessChecking:
+		return false
+	}
+	b.readinessState = readinessChecking
+	ctx, cancel := context.WithTimeout(b.ctx, b.readinessTimeout)
+	b.readinessCancel = cancel
+	b.logf("startup barrier: waiting for readiness checks (dns=%v, routes=%v)", b.readiness.dns, b.readiness.routes)
+	go b.runReadinessChecks(ctx, cancel)
+	return false
+}
+
+// resetReadinessLocked stops the readiness checks, if running, so that they
+// run again the next time the backend would go to Running.
+//
+// b.mu must be held.
+func (b *LocalBackend) resetReadinessLocked() {
+	if b.readinessCancel != nil {
+		b.readinessCancel()
+		b.readinessCancel = nil
+	}
+	b.readinessState = readinessNotStarted
+}
+
+var startupBarrierWarnable = health.Register(&health.Warnable{
+	Code:     "startup-barrier-timeout",
+	Title:    "Startup readiness checks failed",
+	Severity: health.SeverityMedium,
+	Text: func(args health.Args) string {
+		return fmt.Sprintf("Tailscale reported that it's running before its startup readiness checks passed: %s", args[health.ArgError])
+	},
+	Component: health.ComponentDNS,
+})
+
+func (b *LocalBackend) runReadinessChecks(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+	start := b.clock.Now()
+	var err error
+	for {
+		if err = b.checkReadiness(ctx, b.readiness); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(readinessRetryInterval):
+			continue
+		}
+		break
+	}
+
+	b.mu.Lock()
+	if b.readinessCancel == nil || b.ctx.Err() != nil || errors.Is(ctx.Err(), context.Canceled) {
+		// Reset or shut down meanwhile.
+		b.mu.Unlock()
+		return
+	}
+	b.readinessCancel = nil
+	b.readinessState = readinessPassed
+	b.mu.Unlock()
+
+	if err != nil {
+		b.logf("startup barrier: readiness checks failed after %v, reporting Running anyway: %v", b.clock.Since(start).Round(time.Millisecond), err)
+		b.health.SetUnhealthy(startupBarrierWarnable, health.Args{health.ArgError: err.Error()})
+	} else {
+		b.logf("startup barrier: readiness checks passed in %v", b.clock.Since(start).Round(time.Millisecond))
+		b.health.SetHealthy(startupBarrierWarnable)
+	}
+	b.stateMachine()
+}
+
+// checkReadinessDefault runs the readiness checks once.
+func (b *LocalBackend) checkReadinessDefault(ctx context.Context, checks readinessChecks) error {
+	nm := b.NetMap()
+	if nm == nil {
+		return errors.New("no netmap")
+	}
+	prefs := b.Prefs()
+	if checks.dns && prefs.CorpDNS() && nm.DNS.Proxied {
+		if err := b.checkMagicDNS(ctx, nm); err != nil {
+			return fmt.Errorf("MagicDNS: %w", err)
+		}
+	}
+	if checks.routes {
+		for _, peer := range routingPeers(nm, prefs) {
+			if err := b.checkPeerPath(ctx, peer); err != nil {
+				return fmt.Errorf("route via %s: %w", peer.ComputedName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkMagicDNS checks that MagicDNS resolves this node's name to its
+// addresses.
+func (b *LocalBackend) checkMagicDNS(ctx context.Context, nm *netmap.NetworkMap) error {
+	name := strings.TrimSuffix(nm.Name, ".")
+	if name == "" || !nm.SelfNode.Valid() {
+		return nil
+	}
+	want := nm.GetAddresses()
+	var got []netip.Addr
+	if b.sys.IsNetstack() {
+		// The host can't reach MagicDNS, so ask it directly.
+		res, _, err := b.QueryDNS(name, dnsmessage.TypeA)
+		if err != nil {
+			return err
+		}
+		got, err = parseAAnswers(res)
+		if err != nil {
+			return err
+		}
+	} else {
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", name)
+		if err != nil {
+			return err
+		}
+		got = ips
+	}
+	for _, ip := range got {
+		if slices.ContainsFunc(want.AsSlice(), func(p netip.Prefix) bool { return p.Addr() == ip.Unmap() }) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s resolved to %v, not this node's addresses", name, got)
+}
+
+// parseAAnswers returns the addresses in the A records of the DNS response res.
+func parseAAnswers(res []byte) ([]netip.Addr, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(res)
+	if err != nil {
+		return nil, err
+	}
+	if h.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("DNS response code %v", h.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, err
+	}
+	var ret []netip.Addr
+	for {
+		ah, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ah.Type != dnsmessage.TypeA {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		r, err := p.AResource()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, netip.AddrFrom4(r.A))
+	}
+}
+
+// routingPeers returns the peers that traffic is routed through, per prefs:
+// the exit node, and the subnet routers if prefs accept routes.
+func routingPeers(nm *netmap.NetworkMap, prefs ipn.PrefsView) []tailcfg.NodeView {
+	var ret []tailcfg.NodeView
+	exitNodeID := prefs.ExitNodeID()
+	for _, p := range nm.Peers {
+		isExitNode := !exitNodeID.IsZero() && p.StableID() == exitNodeID
+		isSubnetRouter := prefs.RouteAll() && slices.ContainsFunc(p.PrimaryRoutes().AsSlice(), func(r netip.Prefix) bool {
+			return r.Bits() != 0
+		})
+		if isExitNode || isSubnetRouter {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// checkPeerPath checks that traffic to peer gets through, with a TSMP ping,
+// which takes the same path through WireGuard as routed traffic.
+func (b *LocalBackend) checkPeerPath(ctx context.Context, peer tailcfg.NodeView) error {
+	if peer.Addresses().Len() == 0 {
+		return errors.New("peer has no addresses")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	pr, err := b.Ping(ctx, peer.Addresses().At(0).Addr(), tailcfg.PingTSMP, 0)
+	if err != nil {
+		return err
+	}
+	if pr.Err != "" {
+		return errors.New(pr.Err)
+	}
+	return nil
+}
+
+// WaitStartup blocks until the backend has settled after starting: until
+// it's Running, having passed its startup barrier, if any, or needs user
+// action to get there. It returns early with an error if ctx is done.
+func (b *LocalBackend) WaitStartup(ctx context.Context) error {
+	sub := eventbus.Subscribe[StateChange](b.sys.EventBus())
+	defer sub.Close()
+	settled := func(st ipn.State) bool {
+		switch st {
+		case ipn.Running, ipn.NeedsLogin, ipn.NeedsMachineAuth, ipn.Stopped:
+			return true
+		}
+		return false
+	}
+	if settled(b.State()) {
+		return nil
+	}
+	for {
+		select {
+		case sc := <-sub.Events():
+			if settled(sc.New) {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
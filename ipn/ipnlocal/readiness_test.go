@@ -0,0 +1,131 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+)
+
+func TestParseReadinessChecks(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    readinessChecks
+		wantErr bool
+	}{
+		{in: ""},
+		{in: "dns", want: readinessChecks{dns: true}},
+		{in: "routes, dns", want: readinessChecks{dns: true, routes: true}},
+		{in: "all", want: readinessChecks{dns: true, routes: true}},
+		{in: "dns,bogus", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseReadinessChecks(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseReadinessChecks(%q) = %+v, %v; want %+v, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRoutingPeers(t *testing.T) {
+	nm := &netmap.NetworkMap{
+		Peers: []tailcfg.NodeView{
+			(&tailcfg.Node{ID: 1, StableID: "exit", PrimaryRoutes: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")}}).View(),
+			(&tailcfg.Node{ID: 2, StableID: "subnet", PrimaryRoutes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}).View(),
+			(&tailcfg.Node{ID: 3, StableID: "plain"}).View(),
+		},
+	}
+	ids := func(peers []tailcfg.NodeView) (ret []tailcfg.StableNodeID) {
+		for _, p := range peers {
+			ret = append(ret, p.StableID())
+		}
+		return ret
+	}
+	prefs := ipn.NewPrefs()
+	prefs.RouteAll = false
+	if got := ids(routingPeers(nm, prefs.View())); len(got) != 0 {
+		t.Errorf("no exit node or routes: got %v; want none", got)
+	}
+	prefs.ExitNodeID = "exit"
+	prefs.RouteAll = true
+	if got := ids(routingPeers(nm, prefs.View())); len(got) != 2 || got[0] != "exit" || got[1] != "subnet" {
+		t.Errorf("exit node and routes: got %v; want [exit subnet]", got)
+	}
+}
+
+func TestStartupBarrier(t *testing.T) {
+	b := newTestLocalBackend(t)
+	checked := make(chan bool)
+	b.readiness = readinessChecks{dns: true}
+	b.readinessTimeout = time.Minute
+	b.checkReadiness = func(ctx context.Context, _ readinessChecks) error {
+		select {
+		case ok := <-checked:
+			if ok {
+				return nil
+			}
+			return errors.New("not ready")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	prefs := ipn.NewPrefs()
+	prefs.WantRunning = true
+	if err := b.pm.SetPrefs(prefs.View(), ipn.NetworkProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	b.mu.Lock()
+	b.state = ipn.Starting
+	b.netMap = &netmap.NetworkMap{SelfNode: (&tailcfg.Node{MachineAuthorized: true}).View()}
+	b.engineStatus = ipn.EngineStatus{LiveDERPs: 1}
+	b.mu.Unlock()
+
+	waitCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	waited := make(chan error, 1)
+	go func() { waited <- b.WaitStartup(waitCtx) }()
+
+	b.stateMachine()
+	if st := b.State(); st != ipn.Starting {
+		t.Fatalf("state = %v before readiness checks passed; want Starting", st)
+	}
+	checked <- false // retried
+	b.stateMachine()
+	if st := b.State(); st != ipn.Starting {
+		t.Fatalf("state = %v after readiness checks failed; want Starting", st)
+	}
+	checked <- true
+
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for startup")
+	}
+	if st := b.State(); st != ipn.Running {
+		t.Fatalf("state = %v after readiness checks passed; want Running", st)
+	}
+
+	// Stopping resets the barrier, so that readiness is checked again.
+	b.enterStateLockedOnEntry(ipn.Stopped, b.lockAndGetUnlock())
+	b.mu.Lock()
+	if b.readinessState != readinessNotStarted {
+		t.Errorf("readinessState = %v after stopping; want readinessNotStarted", b.readinessState)
+	}
+	b.state = ipn.Starting
+	b.mu.Unlock()
+	b.stateMachine()
+	if st := b.State(); st != ipn.Starting {
+		t.Fatalf("state = %v after restarting; want Starting", st)
+	}
+}
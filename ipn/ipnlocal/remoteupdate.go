@@ -0,0 +1,127 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+	"tailscale.com/version"
+)
+
+// remoteUpdateStatus returns this node's self-update state, as reported to
+// peers updating it remotely.
+func (b *LocalBackend) remoteUpdateStatus() *apitype.UpdateStatus {
+	st := &apitype.UpdateStatus{
+		Version:           version.Long(),
+		C2NUpdateResponse: b.newC2NUpdateResponse(),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st.Started = b.c2nUpdateStatus.started
+	st.LastErr = b.c2nUpdateStatus.lastErr
+	return st
+}
+
+// canRemoteUpdate reports whether h can check and start self-updates of this
+// node.
+func (h *peerAPIHandler) canRemoteUpdate() bool {
+	if h.peerNode.UnsignedPeerAPIOnly() {
+		return false
+	}
+	return h.peerHasCap(tailcfg.PeerCapabilityRemoteUpdate)
+}
+
+func (h *peerAPIHandler) handleServeUpdate(w http.ResponseWriter, r *http.Request) {
+	if !h.canRemoteUpdate() {
+		http.Error(w, "denied; no remote-update access", http.StatusForbidden)
+		return
+	}
+	b := h.ps.b
+	switch r.Method {
+	case "GET":
+	case "POST":
+		h.logf("update requested by %v", h.peerNode.ComputedName())
+		res := b.startRemoteUpdate("peerapi", r.FormValue("force") == "true")
+		if res.Err != "" {
+			h.logf("update requested by %v failed: %s", h.peerNode.ComputedName(), res.Err)
+			st := b.remoteUpdateStatus()
+			st.Err = res.Err
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(st)
+			return
+		}
+	default:
+		http.Error(w, "GET or POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b.remoteUpdateStatus())
+}
+
+// PeerUpdate returns the self-update state of the peer with Tailscale IP ip,
+// as returned by the peer's peerapi. If start is set, it first asks the peer
+// to update itself, even while it has active SSH connections if force is set.
+// The returned state's Err reports why the peer didn't start the update.
+func (b *LocalBackend) PeerUpdate(ctx context.Context, ip netip.Addr, start, force bool) (*apitype.UpdateStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	nm := b.NetMap()
+	if nm == nil {
+		return nil, errors.New("no netmap")
+	}
+	peer, ok := nm.PeerByTailscaleIP(ip)
+	if !ok {
+		return nil, fmt.Errorf("no peer found with Tailscale IP %v", ip)
+	}
+	if peer.Expired() {
+		return nil, errors.New("peer's node key has expired")
+	}
+	base := peerAPIBase(nm, peer)
+	if base == "" {
+		return nil, fmt.Errorf("no PeerAPI base found for peer %v (%v)", peer.ID(), ip)
+	}
+	method, url := "GET", base+"/v0/update"
+	if start {
+		method = "POST"
+		if force {
+			url += "?force=true"
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.Dialer().PeerAPIHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden, http.StatusNotFound:
+		return nil, fmt.Errorf("peer %v does not allow this node to update it; it needs to grant %s", peer.ComputedName(), tailcfg.PeerCapabilityRemoteUpdate)
+	default:
+		return nil, fmt.Errorf("peer %v: %v", peer.ComputedName(), res.Status)
+	}
+	st := new(apitype.UpdateStatus)
+	if err := json.Unmarshal(body, st); err != nil {
+		// Peers without the update handler serve their HTML landing
+		// page for unknown paths.
+		return nil, fmt.Errorf("peer %v does not support remote updates; it may need a newer version of Tailscale", peer.ComputedName())
+	}
+	return st, nil
+}
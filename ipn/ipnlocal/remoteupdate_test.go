@@ -0,0 +1,92 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/netmap"
+	"tailscale.com/version"
+	"tailscale.com/wgengine/filter"
+)
+
+func TestHandleServeUpdate(t *testing.T) {
+	b := newTestLocalBackend(t)
+	h := &peerAPIHandler{
+		ps:         &peerAPIServer{b: b},
+		remoteAddr: netip.MustParseAddrPort("100.100.100.101:12345"),
+		selfNode:   (&tailcfg.Node{}).View(),
+		peerNode:   (&tailcfg.Node{}).View(),
+		isSelf:     true,
+	}
+	serve := func(method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.handleServeUpdate(rec, httptest.NewRequest(method, "/v0/update", nil))
+		return rec
+	}
+
+	// Owning the node isn't enough; the peer needs the capability.
+	if rec := serve("GET"); rec.Code != http.StatusForbidden {
+		t.Errorf("peer without capability: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	b.mu.Lock()
+	b.netMap = &netmap.NetworkMap{
+		SelfNode: (&tailcfg.Node{
+			Addresses: []netip.Prefix{netip.MustParsePrefix("100.100.100.100/32")},
+		}).View(),
+	}
+	b.mu.Unlock()
+	mm, err := filter.MatchesFromFilterRules([]tailcfg.FilterRule{{
+		SrcIPs: []string{"100.100.100.101"},
+		CapGrant: []tailcfg.CapGrant{{
+			Dsts: []netip.Prefix{netip.MustParsePrefix("100.100.100.100/32")},
+			Caps: []tailcfg.PeerCapability{tailcfg.PeerCapabilityRemoteUpdate},
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.setFilter(filter.New(mm, nil, nil, nil, nil, t.Logf))
+
+	if rec := serve("PUT"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT: status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+	decode := func(rec *httptest.ResponseRecorder) *apitype.UpdateStatus {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusOK, rec.Body.Bytes())
+		}
+		st := new(apitype.UpdateStatus)
+		if err := json.Unmarshal(rec.Body.Bytes(), st); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+	if st := decode(serve("GET")); st.Version != version.Long() || st.Enabled || st.Started || st.Err != "" {
+		t.Errorf("GET = %+v; want version %q, not enabled or started", st, version.Long())
+	}
+	// The node didn't opt in to remote updates.
+	if st := decode(serve("POST")); st.Started || st.Err != "not enabled" {
+		t.Errorf("POST = %+v; want not started, with error %q", st, "not enabled")
+	}
+
+	b.mu.Lock()
+	b.c2nUpdateStatus.lastErr = "update command failed: exit status 1"
+	b.mu.Unlock()
+	if st := decode(serve("GET")); st.LastErr != "update command failed: exit status 1" {
+		t.Errorf("GET after failed update: LastErr = %q", st.LastErr)
+	}
+
+	h.peerNode = (&tailcfg.Node{UnsignedPeerAPIOnly: true}).View()
+	if h.canRemoteUpdate() {
+		t.Error("unsigned peer can update node")
+	}
+}
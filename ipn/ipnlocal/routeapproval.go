@@ -0,0 +1,167 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/views"
+)
+
+// routeDecisionsLocked returns the route decisions of the current profile,
+// keyed by route. It returns an empty map if there are none, or if the
+// current profile is not logged in.
+//
+// b.mu must be held.
+func (b *LocalBackend) routeDecisionsLocked() (map[netip.Prefix]ipn.RouteDecision, error) {
+	ret := make(map[netip.Prefix]ipn.RouteDecision)
+	profileID := b.pm.CurrentProfile().ID
+	if profileID == "" {
+		return ret, nil
+	}
+	bs, err := b.store.ReadState(ipn.RouteDecisionsKey(profileID))
+	if errors.Is(err, ipn.ErrStateNotExist) {
+		return ret, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading route decisions: %w", err)
+	}
+	var decisions []ipn.RouteDecision
+	if err := json.Unmarshal(bs, &decisions); err != nil {
+		return nil, fmt.Errorf("decoding route decisions: %w", err)
+	}
+	for _, d := range decisions {
+		ret[d.Route] = d
+	}
+	return ret, nil
+}
+
+// writeRouteDecisionsLocked stores decisions as the route decisions of the
+// current profile.
+//
+// b.mu must be held.
+func (b *LocalBackend) writeRouteDecisionsLocked(decisions map[netip.Prefix]ipn.RouteDecision) error {
+	profileID := b.pm.CurrentProfile().ID
+	if profileID == "" {
+		return errors.New("not logged in")
+	}
+	list := make([]ipn.RouteDecision, 0, len(decisions))
+	for _, d := range decisions {
+		list = append(list, d)
+	}
+	slices.SortFunc(list, func(a, b ipn.RouteDecision) int {
+		return comparePrefixes(a.Route, b.Route)
+	})
+	bs, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("encoding route decisions: %w", err)
+	}
+	if err := b.store.WriteState(ipn.RouteDecisionsKey(profileID), bs); err != nil {
+		return fmt.Errorf("writing route decisions to StateStore: %w", err)
+	}
+	return nil
+}
+
+// RouteApprovals returns the routes advertised by the current profile, and
+// the decisions made about them with DecideRoute.
+//
+// A rejected route that has since been advertised again is pending a new
+// decision.
+func (b *LocalBackend) RouteApprovals() (*tailcfg.C2NRouteApprovalsResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	decisions, err := b.routeDecisionsLocked()
+	if err != nil {
+		return nil, err
+	}
+	prefs := b.pm.CurrentPrefs()
+	res := &tailcfg.C2NRouteApprovalsResponse{
+		Justification: prefs.RouteJustification(),
+		Routes:        []tailcfg.C2NRouteApproval{},
+	}
+	advertised := prefs.AdvertiseRoutes()
+	for _, r := range advertised.All() {
+		a := tailcfg.C2NRouteApproval{Route: r, Decision: tailcfg.RouteApprovalPending}
+		if d, ok := decisions[r]; ok && d.Accept {
+			a.Decision = tailcfg.RouteApprovalAccepted
+			a.Reason = d.Reason
+		}
+		res.Routes = append(res.Routes, a)
+	}
+	var rejected []tailcfg.C2NRouteApproval
+	for r, d := range decisions {
+		if !d.Accept && !views.SliceContains(advertised, r) {
+			rejected = append(rejected, tailcfg.C2NRouteApproval{
+				Route:    r,
+				Decision: tailcfg.RouteApprovalRejected,
+				Reason:   d.Reason,
+			})
+		}
+	}
+	slices.SortFunc(rejected, func(a, b tailcfg.C2NRouteApproval) int {
+		return comparePrefixes(a.Route, b.Route)
+	})
+	res.Routes = append(res.Routes, rejected...)
+	return res, nil
+}
+
+// DecideRoute records the decision d about a route advertised by the current
+// profile. If the route is rejected, it's no longer advertised.
+func (b *LocalBackend) DecideRoute(d ipn.RouteDecision) error {
+	// The decision is recorded and the route removed from the prefs under
+	// a single hold of b.mu, so that concurrent edits of the advertised
+	// routes aren't overwritten.
+	unlock := b.lockAndGetUnlock()
+	defer unlock()
+	advertised := b.pm.CurrentPrefs().AdvertiseRoutes()
+	if !views.SliceContains(advertised, d.Route) {
+		return fmt.Errorf("route %v is not advertised", d.Route)
+	}
+	decisions, err := b.routeDecisionsLocked()
+	if err != nil {
+		return err
+	}
+	// Forget decisions about routes that are no longer advertised, other
+	// than rejections, so that they're still reported.
+	for r, old := range decisions {
+		if old.Accept && !views.SliceContains(advertised, r) {
+			delete(decisions, r)
+		}
+	}
+	decisions[d.Route] = d
+	if err := b.writeRouteDecisionsLocked(decisions); err != nil {
+		return err
+	}
+	b.logf("route %v %s by approval agent", d.Route, decisionString(d))
+
+	if d.Accept {
+		return nil
+	}
+	routes := slices.DeleteFunc(advertised.AsSlice(), func(r netip.Prefix) bool { return r == d.Route })
+	_, err = b.editPrefsLockedOnEntry(&ipn.MaskedPrefs{
+		AdvertiseRoutesSet: true,
+		Prefs: ipn.Prefs{
+			AdvertiseRoutes: routes,
+		},
+	}, unlock)
+	return err
+}
+
+func decisionString(d ipn.RouteDecision) string {
+	if d.Accept {
+		return tailcfg.RouteApprovalAccepted
+	}
+	return tailcfg.RouteApprovalRejected
+}
+
+func comparePrefixes(a, b netip.Prefix) int {
+	return cmp.Or(a.Addr().Compare(b.Addr()), cmp.Compare(a.Bits(), b.Bits()))
+}
@@ -0,0 +1,82 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/persist"
+)
+
+func TestRouteApprovals(t *testing.T) {
+	b := newTestLocalBackend(t)
+	r1 := netip.MustParsePrefix("10.0.0.0/24")
+	r2 := netip.MustParsePrefix("10.0.1.0/24")
+	r3 := netip.MustParsePrefix("10.0.2.0/24")
+	if err := b.pm.SetPrefs((&ipn.Prefs{
+		AdvertiseRoutes:    []netip.Prefix{r1, r2, r3},
+		RouteJustification: "CHG-1234",
+		Persist: &persist.Persist{
+			NodeID:      "n1",
+			UserProfile: tailcfg.UserProfile{ID: 1, LoginName: "user@example.com"},
+		},
+	}).View(), ipn.NetworkProfile{}); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(want ...tailcfg.C2NRouteApproval) {
+		t.Helper()
+		got, err := b.RouteApprovals()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Justification != "CHG-1234" {
+			t.Errorf("Justification = %q, want CHG-1234", got.Justification)
+		}
+		if !reflect.DeepEqual(got.Routes, want) {
+			t.Errorf("Routes:\n got %+v\nwant %+v", got.Routes, want)
+		}
+	}
+	check(
+		tailcfg.C2NRouteApproval{Route: r1, Decision: tailcfg.RouteApprovalPending},
+		tailcfg.C2NRouteApproval{Route: r2, Decision: tailcfg.RouteApprovalPending},
+		tailcfg.C2NRouteApproval{Route: r3, Decision: tailcfg.RouteApprovalPending},
+	)
+
+	if err := b.DecideRoute(ipn.RouteDecision{Route: r1, Accept: true, Reason: "approved"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DecideRoute(ipn.RouteDecision{Route: r2, Reason: "denied"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.Prefs().AdvertiseRoutes().AsSlice(), []netip.Prefix{r1, r3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AdvertiseRoutes after rejection = %v, want %v", got, want)
+	}
+	check(
+		tailcfg.C2NRouteApproval{Route: r1, Decision: tailcfg.RouteApprovalAccepted, Reason: "approved"},
+		tailcfg.C2NRouteApproval{Route: r3, Decision: tailcfg.RouteApprovalPending},
+		tailcfg.C2NRouteApproval{Route: r2, Decision: tailcfg.RouteApprovalRejected, Reason: "denied"},
+	)
+
+	// Rejected routes are no longer advertised, so can't be decided again.
+	if err := b.DecideRoute(ipn.RouteDecision{Route: r2, Accept: true}); err == nil {
+		t.Error("DecideRoute of unadvertised route succeeded")
+	}
+
+	// Advertising a rejected route again makes it pending.
+	if _, err := b.EditPrefs(&ipn.MaskedPrefs{
+		AdvertiseRoutesSet: true,
+		Prefs:              ipn.Prefs{AdvertiseRoutes: []netip.Prefix{r1, r2}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	check(
+		tailcfg.C2NRouteApproval{Route: r1, Decision: tailcfg.RouteApprovalAccepted, Reason: "approved"},
+		tailcfg.C2NRouteApproval{Route: r2, Decision: tailcfg.RouteApprovalPending},
+	)
+}
@@ -38,6 +38,7 @@
 	"tailscale.com/types/logger"
 	"tailscale.com/util/ctxkey"
 	"tailscale.com/util/mak"
+	"tailscale.com/util/syspolicy"
 	"tailscale.com/version"
 )
 
@@ -51,6 +52,11 @@
 // current etag of a resource.
 var ErrETagMismatch = errors.New("etag mismatch")
 
+var (
+	errServeForbidden  = errors.New("tailscale serve is disabled by system policy")
+	errFunnelForbidden = errors.New("tailscale funnel is disabled by system policy")
+)
+
 var serveHTTPContextKey ctxkey.Key[*serveHTTPContext]
 
 type serveHTTPContext struct {
@@ -266,7 +272,20 @@ func (b *LocalBackend) SetServeConfig(config *ipn.ServeConfig, etag string) erro
 	return b.setServeConfigLocked(config, etag)
 }
 
+// serveConfigIsEmpty reports whether sc doesn't serve anything.
+func serveConfigIsEmpty(sc *ipn.ServeConfig) bool {
+	return sc == nil || len(sc.TCP) == 0 && len(sc.Web) == 0 && len(sc.Services) == 0 && len(sc.Foreground) == 0
+}
+
 func (b *LocalBackend) setServeConfigLocked(config *ipn.ServeConfig, etag string) error {
+	if !serveConfigIsEmpty(config) && !sysPolicyAllows(syspolicy.AllowServe) {
+		return errServeForbidden
+	}
+	// Foreground sessions, as started by "tailscale funnel", have their own
+	// AllowFunnel.
+	if config != nil && config.View().HasAllowFunnel() && !sysPolicyAllows(syspolicy.AllowFunnel) {
+		return errFunnelForbidden
+	}
 	prefs := b.pm.CurrentPrefs()
 	if config.IsFunnelOn() && prefs.ShieldsUp() {
 		return errors.New("Unable to turn on Funnel while shields-up is enabled")
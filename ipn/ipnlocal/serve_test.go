@@ -35,6 +35,9 @@
 	"tailscale.com/types/netmap"
 	"tailscale.com/util/mak"
 	"tailscale.com/util/must"
+	"tailscale.com/util/syspolicy"
+	"tailscale.com/util/syspolicy/setting"
+	"tailscale.com/util/syspolicy/source"
 	"tailscale.com/wgengine"
 )
 
@@ -863,3 +866,80 @@ func TestEncTailscaleHeaderValue(t *testing.T) {
 		}
 	}
 }
+
+func TestServeConfigSysPolicy(t *testing.T) {
+	syspolicy.RegisterWellKnownSettingsForTest(t)
+	setPolicy := func(serve, funnel string) {
+		policyStore := source.NewTestStoreOf(t,
+			source.TestSettingOf(syspolicy.AllowServe, serve),
+			source.TestSettingOf(syspolicy.AllowFunnel, funnel),
+		)
+		syspolicy.MustRegisterStoreForTest(t, "TestStore", setting.DeviceScope, policyStore)
+	}
+
+	b := newTestBackend(t)
+	conf := &ipn.ServeConfig{
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			"example.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+				"/": {Proxy: "http://127.0.0.1:3000"},
+			}},
+		},
+		AllowFunnel: map[ipn.HostPort]bool{"example.ts.net:443": true},
+	}
+
+	setPolicy("user-decides", "never")
+	if err := b.SetServeConfig(conf, ""); !errors.Is(err, errFunnelForbidden) {
+		t.Fatalf("SetServeConfig with Funnel = %v, want %v", err, errFunnelForbidden)
+	}
+	conf.AllowFunnel = nil
+	if err := b.SetServeConfig(conf, ""); err != nil {
+		t.Fatalf("SetServeConfig without Funnel: %v", err)
+	}
+	if !b.ServeConfig().Valid() {
+		t.Fatal("serve config not applied")
+	}
+
+	// Nor can Funnel be turned on by a foreground session.
+	fg := &ipn.ServeConfig{
+		Foreground: map[string]*ipn.ServeConfig{
+			"session": {
+				Web:         conf.Web,
+				AllowFunnel: map[ipn.HostPort]bool{"example.ts.net:443": true},
+			},
+		},
+	}
+	if err := b.SetServeConfig(fg, ""); !errors.Is(err, errFunnelForbidden) {
+		t.Fatalf("SetServeConfig with foreground Funnel = %v, want %v", err, errFunnelForbidden)
+	}
+
+	// A foreground Funnel already stored is dropped when the policy
+	// forbids it.
+	setPolicy("user-decides", "user-decides")
+	b.mu.Lock()
+	b.notifyWatchers = map[string]*watchSession{"session": {}}
+	b.mu.Unlock()
+	if err := b.SetServeConfig(fg, ""); err != nil {
+		t.Fatalf("SetServeConfig with foreground Funnel allowed: %v", err)
+	}
+	if !b.ServeConfig().HasFunnelForTarget("example.ts.net:443") {
+		t.Fatal("foreground Funnel not applied")
+	}
+	setPolicy("user-decides", "never")
+	b.mu.Lock()
+	b.reloadServeConfigLocked(b.pm.CurrentPrefs())
+	b.mu.Unlock()
+	if b.ServeConfig().HasFunnelForTarget("example.ts.net:443") {
+		t.Error("foreground Funnel still on after the policy forbade it")
+	}
+	b.mu.Lock()
+	b.notifyWatchers = nil
+	b.mu.Unlock()
+
+	setPolicy("never", "never")
+	if err := b.SetServeConfig(conf, ""); !errors.Is(err, errServeForbidden) {
+		t.Fatalf("SetServeConfig = %v, want %v", err, errServeForbidden)
+	}
+	if err := b.SetServeConfig(nil, ""); err != nil {
+		t.Fatalf("turning off serve: %v", err)
+	}
+}
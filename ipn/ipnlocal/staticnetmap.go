@@ -0,0 +1,43 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"errors"
+	"fmt"
+
+	"tailscale.com/control/controlclient"
+	"tailscale.com/control/netmapbundle"
+	"tailscale.com/envknob"
+)
+
+var (
+	// staticNetmapFile is the path of a netmap bundle to use instead of
+	// contacting the control server, for air-gapped networks. See package
+	// netmapbundle.
+	staticNetmapFile = envknob.RegisterString("TS_STATIC_NETMAP")
+
+	// staticNetmapKeyFile is the path of the PEM-encoded ed25519 public key
+	// that must have signed the bundle in staticNetmapFile.
+	staticNetmapKeyFile = envknob.RegisterString("TS_STATIC_NETMAP_KEY")
+)
+
+// newStaticControlClient returns a control client that reports the network
+// map in the bundle named by TS_STATIC_NETMAP, rather than contacting the
+// control server.
+func newStaticControlClient(opts controlclient.Options) (controlclient.Client, error) {
+	keyFile := staticNetmapKeyFile()
+	if keyFile == "" {
+		return nil, errors.New("TS_STATIC_NETMAP requires TS_STATIC_NETMAP_KEY to be set to the public key that signed it")
+	}
+	pub, err := netmapbundle.ReadPublicKey(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading static netmap key: %w", err)
+	}
+	bundle, err := netmapbundle.Read(staticNetmapFile())
+	if err != nil {
+		return nil, fmt.Errorf("reading static netmap: %w", err)
+	}
+	return controlclient.NewStatic(opts, bundle, pub)
+}
@@ -0,0 +1,313 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
+	"tailscale.com/types/key"
+	"tailscale.com/util/set"
+)
+
+const (
+	// usageSampleInterval is how often the bandwidth usage is sampled
+	// while running, in addition to whenever the engine posts its status.
+	usageSampleInterval = time.Minute
+
+	// usageSaveInterval is how often the bandwidth usage is written to the
+	// StateStore, at most.
+	usageSaveInterval = 15 * time.Minute
+
+	// usageMonthsKept is the number of months of bandwidth usage kept.
+	usageMonthsKept = 12
+
+	// usagePeersKept is the number of peers whose usage is kept per month,
+	// beyond which the peers that are no longer in the netmap are dropped,
+	// least used first. Their usage still counts towards the month's
+	// totals.
+	usagePeersKept = 500
+)
+
+// usageTracker accumulates the bandwidth usage of a profile while it's
+// running.
+type usageTracker struct {
+	profileID ipn.ProfileID
+	stats     *ipn.UsageStats
+	dirty     bool   // stats changed since lastSave
+	saved     []byte // stats as last read from or written to the StateStore
+	lastSave  time.Time
+	timer     tstime.TimerController
+}
+
+// usagePeer is a peer that traffic was exchanged with, as classified for
+// bandwidth usage accounting.
+type usagePeer struct {
+	id           tailcfg.StableNodeID
+	name         string
+	exitNode     bool // the exit node in use
+	subnetRouter bool // a subnet router whose routes are accepted
+	direct       bool // traffic is sent directly, not through DERP
+}
+
+// addUsage adds the bytes c exchanged with p to m.
+func addUsage(m *ipn.MonthUsage, p usagePeer, c ipn.ByteCounts) {
+	m.Total = m.Total.Add(c)
+	switch {
+	case p.exitNode:
+		m.ExitNode = m.ExitNode.Add(c)
+	case p.subnetRouter:
+		m.SubnetRoutes = m.SubnetRoutes.Add(c)
+	}
+	if p.direct {
+		m.Direct = m.Direct.Add(c)
+	} else {
+		m.DERP = m.DERP.Add(c)
+	}
+	pu := m.Peers[p.id]
+	if pu == nil {
+		pu = new(ipn.PeerUsage)
+		m.Peers[p.id] = pu
+	}
+	if p.name != "" {
+		pu.Name = p.name
+	}
+	pu.ByteCounts = pu.ByteCounts.Add(c)
+}
+
+// pruneUsagePeers drops the usage of peers beyond keep from m, least used
+// first, among those that exist no longer.
+func pruneUsagePeers(m *ipn.MonthUsage, exists func(tailcfg.StableNodeID) bool, keep int) {
+	if len(m.Peers) <= keep {
+		return
+	}
+	var gone []tailcfg.StableNodeID
+	for id := range m.Peers {
+		if !exists(id) {
+			gone = append(gone, id)
+		}
+	}
+	slices.SortFunc(gone, func(a, b tailcfg.StableNodeID) int {
+		return cmp.Or(cmp.Compare(m.Peers[a].Total(), m.Peers[b].Total()), cmp.Compare(a, b))
+	})
+	for _, id := range gone {
+		if len(m.Peers) <= keep {
+			break
+		}
+		delete(m.Peers, id)
+	}
+}
+
+// counterDelta returns the bytes counted by WireGuard since it counted last,
+// accounting for counters that restart from zero when a peer is reconfigured.
+func counterDelta(last, cur ipn.ByteCounts) ipn.ByteCounts {
+	if cur.RxBytes < last.RxBytes || cur.TxBytes < last.TxBytes {
+		return cur
+	}
+	return ipn.ByteCounts{RxBytes: cur.RxBytes - last.RxBytes, TxBytes: cur.TxBytes - last.TxBytes}
+}
+
+// noteUsageLocked accounts the bytes exchanged with peers since the last
+// engine status, given the WireGuard counters of peers.
+//
+// b.mu must be held.
+func (b *LocalBackend) noteUsageLocked(peers []ipnstate.PeerStatusLite) {
+	// The counters are rebuilt from each status, so that those of peers
+	// that were removed are dropped.
+	last := b.usageCounters
+	b.usageCounters = make(map[key.NodePublic]ipn.ByteCounts, len(peers))
+	deltas := map[key.NodePublic]ipn.ByteCounts{}
+	for _, p := range peers {
+		cur := ipn.ByteCounts{RxBytes: uint64(p.RxBytes), TxBytes: uint64(p.TxBytes)}
+		if d := counterDelta(last[p.NodeKey], cur); d.Total() > 0 {
+			deltas[p.NodeKey] = d
+		}
+		b.usageCounters[p.NodeKey] = cur
+	}
+	t := b.usage
+	if t == nil || len(deltas) == 0 {
+		return
+	}
+
+	prefs := b.pm.CurrentPrefs()
+	m := t.stats.Month(b.clock.Now().Format(ipn.UsageMonthFormat), usageMonthsKept)
+	mc, _ := b.sys.MagicSock.GetOK()
+	for _, n := range b.peers {
+		d, ok := deltas[n.Key()]
+		if !ok {
+			continue
+		}
+		addUsage(m, usagePeer{
+			id:           n.StableID(),
+			name:         n.Name(),
+			exitNode:     n.StableID() == prefs.ExitNodeID(),
+			subnetRouter: prefs.RouteAll() && n.PrimaryRoutes().Len() > 0,
+			direct:       mc != nil && mc.IsDirect(n.Key()),
+		}, d)
+	}
+	t.dirty = true
+}
+
+// updateUsageTrackingLocked starts or stops accounting bandwidth usage,
+// according to the current state and profile.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateUsageTrackingLocked() {
+	profileID := b.pm.CurrentProfile().ID
+	if b.state != ipn.Running || b.shutdownCalled || profileID == "" {
+		b.stopUsageTrackingLocked()
+		return
+	}
+	if t := b.usage; t != nil && t.profileID == profileID {
+		return
+	}
+	b.stopUsageTrackingLocked()
+	t := &usageTracker{
+		profileID: profileID,
+		lastSave:  b.clock.Now(),
+	}
+	var err error
+	t.stats, t.saved, err = b.readUsageLocked(profileID)
+	if err != nil {
+		b.logf("usage: %v; starting over", err)
+		t.stats = new(ipn.UsageStats)
+	}
+	t.timer = b.clock.AfterFunc(usageSampleInterval, func() { b.sampleUsage(t) })
+	b.usage = t
+}
+
+// stopUsageTrackingLocked stops accounting bandwidth usage, if it was, and
+// saves what was accounted.
+//
+// b.mu must be held.
+func (b *LocalBackend) stopUsageTrackingLocked() {
+	t := b.usage
+	if t == nil {
+		return
+	}
+	t.timer.Stop()
+	b.saveUsageLocked(t)
+	b.usage = nil
+}
+
+// sampleUsage is called periodically while t accounts bandwidth usage.
+func (b *LocalBackend) sampleUsage(t *usageTracker) {
+	// Refresh the engine status, which accounts the usage since the last
+	// one. The engine calls back into b synchronously, so b.mu must not be
+	// held.
+	b.e.RequestStatus()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.usage != t {
+		// Stopped or replaced since the timer fired.
+		return
+	}
+	if b.clock.Since(t.lastSave) >= usageSaveInterval {
+		b.saveUsageLocked(t)
+	}
+	t.timer.Reset(usageSampleInterval)
+}
+
+// readUsageLocked returns the stored bandwidth usage of the profile with the
+// given ID, and its encoding as stored.
+//
+// b.mu must be held.
+func (b *LocalBackend) readUsageLocked(profileID ipn.ProfileID) (_ *ipn.UsageStats, saved []byte, _ error) {
+	stats := new(ipn.UsageStats)
+	bs, err := b.store.ReadState(ipn.UsageKey(profileID))
+	if errors.Is(err, ipn.ErrStateNotExist) {
+		return stats, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading usage: %w", err)
+	}
+	if err := json.Unmarshal(bs, stats); err != nil {
+		return nil, nil, fmt.Errorf("decoding usage: %w", err)
+	}
+	return stats, bs, nil
+}
+
+// saveUsageLocked writes the bandwidth usage accounted by t to the
+// StateStore, if it changed, after dropping the usage of peers beyond
+// usagePeersKept that are no longer in the netmap.
+//
+// b.mu must be held.
+func (b *LocalBackend) saveUsageLocked(t *usageTracker) {
+	if !t.dirty {
+		return
+	}
+	var peers set.Set[tailcfg.StableNodeID]
+	peers.Make()
+	for _, n := range b.peers {
+		peers.Add(n.StableID())
+	}
+	for _, m := range t.stats.Months {
+		pruneUsagePeers(m, peers.Contains, usagePeersKept)
+	}
+	bs, err := json.Marshal(t.stats)
+	if err != nil {
+		b.logf("usage: encoding: %v", err)
+		return
+	}
+	if !bytes.Equal(bs, t.saved) {
+		if err := b.store.WriteState(ipn.UsageKey(t.profileID), bs); err != nil {
+			b.logf("usage: writing to StateStore: %v", err)
+			return
+		}
+		t.saved = bs
+	}
+	t.dirty = false
+	t.lastSave = b.clock.Now()
+}
+
+// UsageStats returns the bandwidth usage of the current profile.
+func (b *LocalBackend) UsageStats() (*ipn.UsageStats, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t := b.usage; t != nil {
+		// Return a copy, as t.stats keeps changing.
+		bs, err := json.Marshal(t.stats)
+		if err != nil {
+			return nil, err
+		}
+		stats := new(ipn.UsageStats)
+		return stats, json.Unmarshal(bs, stats)
+	}
+	profileID := b.pm.CurrentProfile().ID
+	if profileID == "" {
+		return new(ipn.UsageStats), nil
+	}
+	stats, _, err := b.readUsageLocked(profileID)
+	return stats, err
+}
+
+// ResetUsageStats deletes the bandwidth usage of the current profile.
+func (b *LocalBackend) ResetUsageStats() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	profileID := b.pm.CurrentProfile().ID
+	if profileID == "" {
+		return errors.New("not logged in")
+	}
+	empty := []byte("{}")
+	if err := b.store.WriteState(ipn.UsageKey(profileID), empty); err != nil {
+		return fmt.Errorf("writing usage to StateStore: %w", err)
+	}
+	if t := b.usage; t != nil {
+		t.stats = new(ipn.UsageStats)
+		t.dirty = false
+		t.saved = empty
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnlocal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		last, cur, want ipn.ByteCounts
+	}{
+		{ipn.ByteCounts{}, ipn.ByteCounts{RxBytes: 10, TxBytes: 5}, ipn.ByteCounts{RxBytes: 10, TxBytes: 5}},
+		{ipn.ByteCounts{RxBytes: 10, TxBytes: 5}, ipn.ByteCounts{RxBytes: 15, TxBytes: 5}, ipn.ByteCounts{RxBytes: 5}},
+		{ipn.ByteCounts{RxBytes: 10, TxBytes: 5}, ipn.ByteCounts{RxBytes: 3, TxBytes: 7}, ipn.ByteCounts{RxBytes: 3, TxBytes: 7}}, // reset
+	}
+	for _, tt := range tests {
+		if got := counterDelta(tt.last, tt.cur); got != tt.want {
+			t.Errorf("counterDelta(%+v, %+v) = %+v; want %+v", tt.last, tt.cur, got, tt.want)
+		}
+	}
+}
+
+func TestAddUsage(t *testing.T) {
+	stats := new(ipn.UsageStats)
+	m := stats.Month("2026-10", usageMonthsKept)
+	addUsage(m, usagePeer{id: "exit", name: "exit.ts.net.", exitNode: true, direct: true}, ipn.ByteCounts{RxBytes: 100, TxBytes: 10})
+	addUsage(m, usagePeer{id: "router", name: "router.ts.net.", subnetRouter: true}, ipn.ByteCounts{RxBytes: 50, TxBytes: 5})
+	addUsage(m, usagePeer{id: "peer", name: "peer.ts.net.", direct: true}, ipn.ByteCounts{RxBytes: 1, TxBytes: 2})
+	addUsage(m, usagePeer{id: "exit", exitNode: true}, ipn.ByteCounts{RxBytes: 100})
+
+	want := ipn.MonthUsage{
+		Total:        ipn.ByteCounts{RxBytes: 251, TxBytes: 17},
+		ExitNode:     ipn.ByteCounts{RxBytes: 200, TxBytes: 10},
+		SubnetRoutes: ipn.ByteCounts{RxBytes: 50, TxBytes: 5},
+		Direct:       ipn.ByteCounts{RxBytes: 101, TxBytes: 12},
+		DERP:         ipn.ByteCounts{RxBytes: 150, TxBytes: 5},
+	}
+	if m.Total != want.Total || m.ExitNode != want.ExitNode || m.SubnetRoutes != want.SubnetRoutes || m.Direct != want.Direct || m.DERP != want.DERP {
+		t.Errorf("month usage = %+v; want %+v", m, want)
+	}
+	if got := m.Peers["exit"]; got.Name != "exit.ts.net." || got.RxBytes != 200 {
+		t.Errorf("exit node usage = %+v; want name kept and 200 bytes received", got)
+	}
+	if got, want := fmt.Sprint(m.SortedPeers()), "[exit router peer]"; got != want {
+		t.Errorf("SortedPeers = %v; want %v", got, want)
+	}
+}
+
+func TestUsageMonths(t *testing.T) {
+	stats := new(ipn.UsageStats)
+	for _, month := range []string{"2026-08", "2026-10", "2026-09", "2026-11"} {
+		stats.Month(month, 3)
+	}
+	var got []string
+	for _, m := range stats.Months {
+		got = append(got, m.Month)
+	}
+	if fmt.Sprint(got) != "[2026-11 2026-10 2026-09]" {
+		t.Errorf("months = %v; want the 3 most recent, newest first", got)
+	}
+	if m := stats.Month("2026-10", 3); m != stats.Months[1] {
+		t.Error("Month didn't return the existing month")
+	}
+}
+
+func TestPruneUsagePeers(t *testing.T) {
+	m := &ipn.MonthUsage{Peers: map[tailcfg.StableNodeID]*ipn.PeerUsage{
+		"live-small": {ByteCounts: ipn.ByteCounts{RxBytes: 1}},
+		"gone-small": {ByteCounts: ipn.ByteCounts{RxBytes: 2}},
+		"gone-big":   {ByteCounts: ipn.ByteCounts{RxBytes: 100}},
+		"live-big":   {ByteCounts: ipn.ByteCounts{RxBytes: 200}},
+	}}
+	exists := func(id tailcfg.StableNodeID) bool { return strings.HasPrefix(string(id), "live") }
+
+	pruneUsagePeers(m, exists, 4)
+	if len(m.Peers) != 4 {
+		t.Errorf("pruned %d peers under the limit", 4-len(m.Peers))
+	}
+	pruneUsagePeers(m, exists, 3)
+	if got, want := fmt.Sprint(m.SortedPeers()), "[live-big gone-big live-small]"; got != want {
+		t.Errorf("after pruning to 3: peers = %v; want %v", got, want)
+	}
+	pruneUsagePeers(m, exists, 1)
+	if got, want := fmt.Sprint(m.SortedPeers()), "[live-big live-small]"; got != want {
+		t.Errorf("after pruning to 1: peers = %v; want %v", got, want)
+	}
+}
+
+func TestSaveUsageOnlyWhenChanged(t *testing.T) {
+	b := newTestLocalBackend(t)
+	store := new(testStateStorage)
+	b.store = store
+	tr := &usageTracker{profileID: "p", stats: new(ipn.UsageStats)}
+	m := tr.stats.Month("2026-10", usageMonthsKept)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	addUsage(m, usagePeer{id: "peer"}, ipn.ByteCounts{RxBytes: 1})
+	tr.dirty = true
+	b.saveUsageLocked(tr)
+	if !store.sawWrite() {
+		t.Fatal("changed usage not written")
+	}
+	b.saveUsageLocked(tr)
+	if store.sawWrite() {
+		t.Error("usage written again without being accounted")
+	}
+
+	// Marked dirty, but with the same usage as saved.
+	tr.dirty = true
+	b.saveUsageLocked(tr)
+	if store.sawWrite() {
+		t.Error("unchanged usage written")
+	}
+
+	addUsage(m, usagePeer{id: "peer"}, ipn.ByteCounts{TxBytes: 1})
+	tr.dirty = true
+	b.saveUsageLocked(tr)
+	if !store.sawWrite() {
+		t.Error("changed usage not written")
+	}
+}
@@ -33,6 +33,11 @@ type actor struct {
 
 	clientID      ipnauth.ClientID
 	isLocalSystem bool // whether the actor is the Windows' Local System identity.
+
+	// sessionID is the ID of the Windows session the actor belongs to,
+	// if hasSession.
+	sessionID  uint32
+	hasSession bool
 }
 
 func newActor(logf logger.Logf, c net.Conn) (*actor, error) {
@@ -55,7 +60,13 @@ func newActor(logf logger.Logf, c net.Conn) (*actor, error) {
 		// connectivity on domain-joined devices and/or be slow.
 		clientID = ipnauth.ClientIDFrom(pid)
 	}
-	return &actor{logf: logf, ci: ci, clientID: clientID, isLocalSystem: connIsLocalSystem(ci)}, nil
+	a := &actor{logf: logf, ci: ci, clientID: clientID, isLocalSystem: connIsLocalSystem(ci)}
+	if tok, err := ci.WindowsToken(); err == nil {
+		a.sessionID, err = tok.SessionID()
+		a.hasSession = err == nil
+		tok.Close()
+	}
+	return a, nil
 }
 
 // IsLocalSystem implements [ipnauth.Actor].
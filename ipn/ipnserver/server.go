@@ -18,6 +18,7 @@
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unicode"
 
 	"tailscale.com/envknob"
@@ -51,8 +52,10 @@ type Server struct {
 	mu            sync.Mutex
 	lastUserID    ipn.WindowsUserID // tracks last userid; on change, Reset state for paranoia
 	activeReqs    map[*http.Request]*actor
-	backendWaiter waiterSet // of LocalBackend waiters
-	zeroReqWaiter waiterSet // of blockUntilZeroConnections waiters
+	reqCancel     map[*http.Request]context.CancelFunc // cancels each of activeReqs
+	switchedAway  set.Set[uint32]                      // Windows sessions switched away from; see watchSessions
+	backendWaiter waiterSet                            // of LocalBackend waiters
+	zeroReqWaiter waiterSet                            // of blockUntilZeroConnections waiters
 }
 
 func (s *Server) mustBackend() *ipnlocal.LocalBackend {
@@ -181,7 +184,13 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	onDone, err := s.addActiveHTTPRequest(r, ci)
+	// Let the server cancel the request if its actor's session is switched
+	// away from; see setSwitchedAwaySessions.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	onDone, err := s.addActiveHTTPRequest(r, ci, cancel)
 	if err != nil {
 		if ou, ok := err.(inUseOtherUserError); ok && localapi.InUseOtherUserIPNStream(w, r, ou.Unwrap()) {
 			w.(http.Flusher).Flush()
@@ -231,6 +240,9 @@ func (e inUseOtherUserError) Unwrap() error { return e.error }
 //
 // s.mu must be held.
 func (s *Server) checkConnIdentityLocked(ci *actor) error {
+	if s.isSwitchedAwayLocked(ci) {
+		return inUseOtherUserError{errors.New("Tailscale is in use by the user at the console")}
+	}
 	// If clients are already connected, verify they're the same user.
 	// This mostly matters on Windows at the moment.
 	if len(s.activeReqs) > 0 {
@@ -361,7 +373,7 @@ func (a *actor) CanFetchCerts() bool {
 // The returned error may be of type [inUseOtherUserError].
 //
 // onDone must be called when the HTTP request is done.
-func (s *Server) addActiveHTTPRequest(req *http.Request, actor *actor) (onDone func(), err error) {
+func (s *Server) addActiveHTTPRequest(req *http.Request, actor *actor, cancel context.CancelFunc) (onDone func(), err error) {
 	if actor == nil {
 		return nil, errors.New("internal error: nil actor")
 	}
@@ -386,6 +398,7 @@ func (s *Server) addActiveHTTPRequest(req *http.Request, actor *actor) (onDone f
 	}
 
 	mak.Set(&s.activeReqs, req, actor)
+	mak.Set(&s.reqCancel, req, cancel)
 
 	if len(s.activeReqs) == 1 {
 		if envknob.GOOS() == "windows" && !actor.IsLocalSystem() {
@@ -408,6 +421,7 @@ func (s *Server) addActiveHTTPRequest(req *http.Request, actor *actor) (onDone f
 	onDone = func() {
 		s.mu.Lock()
 		delete(s.activeReqs, req)
+		delete(s.reqCancel, req)
 		remain := len(s.activeReqs)
 		s.mu.Unlock()
 
@@ -449,7 +463,8 @@ func New(logf logger.Logf, logID logid.PublicID, netMon *netmon.Monitor) *Server
 	}
 }
 
-// SetLocalBackend sets the server's LocalBackend.
+// SetLocalBackend sets the server's LocalBackend and signals readiness to
+// systemd.
 //
 // It should only call be called after calling lb.Start.
 func (s *Server) SetLocalBackend(lb *ipnlocal.LocalBackend) {
@@ -465,6 +480,28 @@ func (s *Server) SetLocalBackend(lb *ipnlocal.LocalBackend) {
 	s.backendWaiter.wakeAll()
 	s.mu.Unlock()
 
+	// The state has been loaded and the engine started, so tell systemd
+	// (which starts units that depend on tailscaled once we do) that
+	// we're ready. Until now, LocalAPI requests would just block.
+	//
+	// With a startup barrier (TS_STARTUP_BARRIER), wait until the backend
+	// is Running, with MagicDNS and routes verified, or can't get there
+	// without user action, so that units ordered after tailscaled can
+	// rely on the tailnet being usable.
+	if timeout, ok := lb.StartupBarrierTimeout(); ok {
+		go func() {
+			// Allow for connecting to control, on top of the checks.
+			ctx, cancel := context.WithTimeout(context.Background(), timeout+time.Minute)
+			defer cancel()
+			if err := lb.WaitStartup(ctx); err != nil {
+				s.logf("startup barrier: %v; telling systemd we're ready anyway", err)
+			}
+			systemd.Ready()
+		}()
+	} else {
+		systemd.Ready()
+	}
+
 	// TODO(bradfitz): send status update to GUI long poller waiter. See
 	// https://github.com/tailscale/tailscale/issues/6522
 }
@@ -496,8 +533,6 @@ func (s *Server) Run(ctx context.Context, ln net.Listener) error {
 		ln.Close()
 	}()
 
-	systemd.Ready()
-
 	hs := &http.Server{
 		Handler:     http.HandlerFunc(s.serveHTTP),
 		BaseContext: func(_ net.Listener) context.Context { return ctx },
@@ -506,6 +541,9 @@ func (s *Server) Run(ctx context.Context, ln net.Listener) error {
 		},
 		ErrorLog: logger.StdLogger(logger.WithPrefix(s.logf, "ipnserver: ")),
 	}
+	if switchedAwaySessions != nil {
+		go s.watchSessions(ctx)
+	}
 	if err := hs.Serve(ln); err != nil {
 		if err := ctx.Err(); err != nil {
 			return err
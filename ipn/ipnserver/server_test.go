@@ -5,8 +5,12 @@
 
 import (
 	"context"
+	"net/http"
 	"sync"
 	"testing"
+
+	"tailscale.com/util/mak"
+	"tailscale.com/util/set"
 )
 
 func TestWaiterSet(t *testing.T) {
@@ -44,3 +48,52 @@ func TestWaiterSet(t *testing.T) {
 	cleanup()
 	wantLen(0, "at end")
 }
+
+func TestSetSwitchedAwaySessions(t *testing.T) {
+	s := &Server{logf: t.Logf}
+	inSession := func(id uint32) *actor { return &actor{sessionID: id, hasSession: true} }
+	system := &actor{sessionID: 1, hasSession: true, isLocalSystem: true}
+
+	// Add active requests from sessions 1 and 2, and from SYSTEM in session 1.
+	ctxs := map[*actor]context.Context{}
+	for _, a := range []*actor{inSession(1), inSession(2), system} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req := new(http.Request)
+		mak.Set(&s.activeReqs, req, a)
+		mak.Set(&s.reqCancel, req, cancel)
+		ctxs[a] = ctx
+	}
+
+	var mu sync.Mutex
+	waiting, cleanup := s.zeroReqWaiter.add(&mu, context.Background())
+	defer cleanup()
+
+	s.setSwitchedAwaySessions(set.Of[uint32](1))
+	for a, ctx := range ctxs {
+		canceled := ctx.Err() != nil
+		if want := a.sessionID == 1 && !a.isLocalSystem; canceled != want {
+			t.Errorf("request from session %d (system=%v): canceled = %v, want %v", a.sessionID, a.isLocalSystem, canceled, want)
+		}
+	}
+	select {
+	case <-waiting:
+	default:
+		t.Errorf("waiters not woken")
+	}
+
+	if !s.isSwitchedAwayLocked(inSession(1)) {
+		t.Errorf("session 1 not switched away")
+	}
+	if s.isSwitchedAwayLocked(inSession(2)) || s.isSwitchedAwayLocked(system) || s.isSwitchedAwayLocked(&actor{}) {
+		t.Errorf("unexpected actor switched away")
+	}
+	if err := s.checkConnIdentityLocked(inSession(1)); err == nil {
+		t.Errorf("checkConnIdentityLocked allowed switched-away session")
+	}
+
+	s.setSwitchedAwaySessions(nil)
+	if s.isSwitchedAwayLocked(inSession(1)) {
+		t.Errorf("session 1 still switched away after switching back")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnserver
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"tailscale.com/util/set"
+)
+
+// switchedAwaySessions, if non-nil, returns the IDs of the Windows sessions
+// that have been switched away from: those that are disconnected while a
+// different session is active at the console, as happens to a user's session
+// when fast user switching to another user. It is nil on other platforms.
+var switchedAwaySessions func() (set.Set[uint32], error)
+
+// sessionPollInterval is how often watchSessions checks for sessions that
+// have been switched away from.
+const sessionPollInterval = 2 * time.Second
+
+// watchSessions keeps s.switchedAway up to date until ctx is done.
+func (s *Server) watchSessions(ctx context.Context) {
+	t := time.NewTicker(sessionPollInterval)
+	defer t.Stop()
+	var lastErr string
+	for {
+		ids, err := switchedAwaySessions()
+		if err != nil {
+			if err.Error() != lastErr {
+				s.logf("checking for switched-away sessions: %v", err)
+				lastErr = err.Error()
+			}
+		} else {
+			lastErr = ""
+			s.setSwitchedAwaySessions(ids)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// setSwitchedAwaySessions records that the sessions in ids are the ones that
+// have been switched away from.
+//
+// Any active requests from those sessions are canceled, so that a user who
+// switched away can't keep the backend running on their profile while another
+// user is at the console; once the last of them is done, the backend is reset
+// as for any other client disconnect. Clients waiting for the backend to be
+// free are woken up to check again, in case their session was switched back to.
+func (s *Server) setSwitchedAwaySessions(ids set.Set[uint32]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if maps.Equal(s.switchedAway, ids) {
+		return
+	}
+	s.logf("switched-away sessions: %v", slices.Sorted(maps.Keys(ids)))
+	s.switchedAway = ids
+	for req, a := range s.activeReqs {
+		if s.isSwitchedAwayLocked(a) {
+			s.logf("canceling request from switched-away session %d", a.sessionID)
+			s.reqCancel[req]()
+		}
+	}
+	s.zeroReqWaiter.wakeAll()
+}
+
+// isSwitchedAwayLocked reports whether a belongs to a session that has been
+// switched away from, and so must not use the backend. It's always false when
+// the backend is in server (unattended) mode, which keeps running regardless of
+// who's at the console.
+//
+// s.mu must be held.
+func (s *Server) isSwitchedAwayLocked(a *actor) bool {
+	if !a.hasSession || a.isLocalSystem || !s.switchedAway.Contains(a.sessionID) {
+		return false
+	}
+	lb := s.lb.Load()
+	return lb == nil || !lb.InServerMode()
+}
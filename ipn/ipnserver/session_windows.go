@@ -0,0 +1,48 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipnserver
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"tailscale.com/util/set"
+)
+
+func init() {
+	switchedAwaySessions = windowsSwitchedAwaySessions
+}
+
+func windowsSwitchedAwaySessions() (set.Set[uint32], error) {
+	var infos *windows.WTS_SESSION_INFO
+	var n uint32
+	if err := windows.WTSEnumerateSessions(0, 0, 1, &infos, &n); err != nil {
+		return nil, err
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(infos)))
+	sessions := unsafe.Slice(infos, n)
+
+	// If nobody is logged in at the console, such as when it's showing the
+	// sign-in screen while the only user is connected over RDP, then no other
+	// user can have switched to it.
+	console := windows.WTSGetActiveConsoleSessionId()
+	consoleActive := false
+	for _, si := range sessions {
+		if si.SessionID == console && si.State == windows.WTSActive {
+			consoleActive = true
+		}
+	}
+	if !consoleActive {
+		return nil, nil
+	}
+
+	var ret set.Set[uint32]
+	for _, si := range sessions {
+		if si.SessionID != console && si.State == windows.WTSDisconnected {
+			ret.Make()
+			ret.Add(si.SessionID)
+		}
+	}
+	return ret, nil
+}
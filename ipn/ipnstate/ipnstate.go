@@ -17,6 +17,7 @@
 	"strings"
 	"time"
 
+	"tailscale.com/health"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tka"
 	"tailscale.com/types/key"
@@ -58,6 +59,11 @@ type Status struct {
 	// problems are detected)
 	Health []string
 
+	// HealthWarnings are the coded forms of the health check problems
+	// in Health, most severe first, for clients to act on specific
+	// problems without matching their messages.
+	HealthWarnings []health.UnhealthyState `json:",omitempty"`
+
 	// This field is the legacy name of CurrentTailnet.MagicDNSSuffix.
 	//
 	// Deprecated: use CurrentTailnet.MagicDNSSuffix instead.
@@ -692,9 +698,82 @@ type PingResult struct {
 	// a ping to the local node.
 	IsLocalIP bool `json:",omitempty"`
 
+	// NATDiagnostics are the likely reasons that the ping went via DERP
+	// rather than a direct path, as derived from the NAT traversal state
+	// of this node and the peer. It's only set for disco pings via DERP.
+	NATDiagnostics []NATDiagnostic `json:",omitempty"`
+
 	// TODO(bradfitz): details like whether port mapping was used on either side? (Once supported)
 }
 
+// NATDiagnosticCode identifies a reason that a peer isn't reachable over a
+// direct path.
+type NATDiagnosticCode string
+
+const (
+	// NATHardBoth is when both this node and the peer are behind NATs
+	// whose mappings vary by destination ("hard NAT"), and neither has
+	// port mapping to make up for it.
+	NATHardBoth NATDiagnosticCode = "hard-nat-both"
+
+	// NATNoPortMap is when one side is behind a hard NAT without port
+	// mapping (UPnP, NAT-PMP or PCP) on its LAN.
+	NATNoPortMap NATDiagnosticCode = "no-port-map"
+
+	// NATUDPBlocked is when this node can't send UDP to the internet.
+	NATUDPBlocked NATDiagnosticCode = "udp-blocked"
+
+	// NATPeerUDPBlocked is when the peer can't send UDP to the internet.
+	NATPeerUDPBlocked NATDiagnosticCode = "peer-udp-blocked"
+
+	// NATStaleEndpoints is when none of the peer's known endpoints
+	// answer, or it has none.
+	NATStaleEndpoints NATDiagnosticCode = "stale-endpoints"
+)
+
+// NATDiagnostic is a reason that a peer isn't reachable over a direct path.
+type NATDiagnostic struct {
+	Code NATDiagnosticCode
+
+	// Message explains the reason and what can be done about it, for
+	// humans.
+	Message string
+}
+
+// PathStats are the recent latency and packet loss statistics of a network
+// path to a peer. They are measured from the disco pings that are sent to
+// discover and keep paths alive, so no extra traffic is sent to collect them.
+type PathStats struct {
+	// Endpoint is the ip:port of the path if it is a direct UDP path.
+	Endpoint string `json:",omitempty"`
+
+	// DERPRegionID and DERPRegionCode identify the DERP region of the path
+	// if it is via DERP.
+	DERPRegionID   int    `json:",omitempty"`
+	DERPRegionCode string `json:",omitempty"`
+
+	// Active is whether the path is the one currently used to send
+	// packets to the peer.
+	Active bool `json:",omitempty"`
+
+	// Pings is the number of pings in the history that the statistics are
+	// computed over, and Lost the number of those that were not answered.
+	Pings int
+	Lost  int
+
+	// MinLatencySeconds, AvgLatencySeconds and MaxLatencySeconds are the
+	// round-trip times of the answered pings. JitterSeconds is the mean
+	// difference between the round-trip times of consecutive answered pings.
+	MinLatencySeconds float64
+	AvgLatencySeconds float64
+	MaxLatencySeconds float64
+	JitterSeconds     float64
+
+	// LastPong is when the most recent ping on the path was answered, or
+	// the zero time if none was.
+	LastPong time.Time
+}
+
 func (pr *PingResult) ToPingResponse(pingType tailcfg.PingType) *tailcfg.PingResponse {
 	return &tailcfg.PingResponse{
 		Type:           pingType,
@@ -0,0 +1,97 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+// ParseKeepaliveIntervals parses keepalive intervals in the format of the
+// "tailscale set --keepalive" flag: a comma-separated list of
+// CLASS:HEARTBEAT[:WIREGUARD], where CLASS is a peer class such as "mobile",
+// and HEARTBEAT and WIREGUARD are the disco heartbeat and WireGuard
+// persistent keepalive intervals, as whole-second durations like "30s", or
+// "off" to disable them. An empty interval leaves the default in place.
+// For example, "mobile:30s:25s,idle:2m,server::off".
+func ParseKeepaliveIntervals(s string) ([]tailcfg.KeepaliveIntervals, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var kis []tailcfg.KeepaliveIntervals
+	for _, item := range strings.Split(s, ",") {
+		f := strings.Split(item, ":")
+		if len(f) < 2 || len(f) > 3 {
+			return nil, fmt.Errorf("invalid keepalive intervals %q; want CLASS:HEARTBEAT[:WIREGUARD]", item)
+		}
+		ki := tailcfg.KeepaliveIntervals{Class: f[0]}
+		switch ki.Class {
+		case tailcfg.KeepaliveClassDefault, tailcfg.KeepaliveClassMobile, tailcfg.KeepaliveClassServer, tailcfg.KeepaliveClassIdle:
+		default:
+			return nil, fmt.Errorf("unknown peer class %q; want one of default, mobile, server, idle", ki.Class)
+		}
+		var err error
+		if ki.DiscoHeartbeatSeconds, err = parseKeepaliveSeconds(f[1]); err != nil {
+			return nil, fmt.Errorf("invalid heartbeat interval for %s: %w", ki.Class, err)
+		}
+		if len(f) == 3 {
+			if ki.Class == tailcfg.KeepaliveClassIdle && f[2] != "" {
+				return nil, fmt.Errorf("WireGuard keepalive interval cannot be set for idle peers")
+			}
+			if ki.WireGuardKeepaliveSeconds, err = parseKeepaliveSeconds(f[2]); err != nil {
+				return nil, fmt.Errorf("invalid WireGuard keepalive interval for %s: %w", ki.Class, err)
+			}
+		}
+		kis = append(kis, ki)
+	}
+	return kis, nil
+}
+
+func parseKeepaliveSeconds(s string) (int, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "off":
+		return -1, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 || d%time.Second != 0 || d > 0xffff*time.Second {
+		return 0, fmt.Errorf("%v is not a positive whole number of seconds up to 65535", d)
+	}
+	return int(d / time.Second), nil
+}
+
+// FormatKeepaliveIntervals formats kis in the format accepted by
+// ParseKeepaliveIntervals.
+func FormatKeepaliveIntervals(kis []tailcfg.KeepaliveIntervals) string {
+	format := func(sec int) string {
+		switch {
+		case sec < 0:
+			return "off"
+		case sec == 0:
+			return ""
+		}
+		return (time.Duration(sec) * time.Second).String()
+	}
+	var sb strings.Builder
+	for i, ki := range kis {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(ki.Class)
+		sb.WriteByte(':')
+		sb.WriteString(format(ki.DiscoHeartbeatSeconds))
+		if ki.WireGuardKeepaliveSeconds != 0 {
+			sb.WriteByte(':')
+			sb.WriteString(format(ki.WireGuardKeepaliveSeconds))
+		}
+	}
+	return sb.String()
+}
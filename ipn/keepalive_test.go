@@ -0,0 +1,59 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"tailscale.com/tailcfg"
+)
+
+func TestParseKeepaliveIntervals(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []tailcfg.KeepaliveIntervals
+		wantErr string
+	}{
+		{in: ""},
+		{
+			in: "mobile:30s:25s,idle:2m,server::off,default:off",
+			want: []tailcfg.KeepaliveIntervals{
+				{Class: "mobile", DiscoHeartbeatSeconds: 30, WireGuardKeepaliveSeconds: 25},
+				{Class: "idle", DiscoHeartbeatSeconds: 120},
+				{Class: "server", WireGuardKeepaliveSeconds: -1},
+				{Class: "default", DiscoHeartbeatSeconds: -1},
+			},
+		},
+		{in: "mobile", wantErr: "want CLASS:HEARTBEAT"},
+		{in: "toaster:5s", wantErr: "unknown peer class"},
+		{in: "mobile:1500ms", wantErr: "whole number of seconds"},
+		{in: "server:5s:-1s", wantErr: "whole number of seconds"},
+		{in: "idle:1m:25s", wantErr: "cannot be set for idle peers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseKeepaliveIntervals(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			if s := FormatKeepaliveIntervals(got); s != tt.in {
+				back, err := ParseKeepaliveIntervals(s)
+				if err != nil || !reflect.DeepEqual(back, got) {
+					t.Errorf("FormatKeepaliveIntervals = %q, which does not round-trip: %+v, %v", s, back, err)
+				}
+			}
+		})
+	}
+}
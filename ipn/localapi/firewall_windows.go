@@ -0,0 +1,44 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package localapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/wf"
+)
+
+func init() {
+	serveDebugFirewallFunc = serveDebugFirewall
+}
+
+func serveDebugFirewall(w http.ResponseWriter, r *http.Request) {
+	rules, err := wf.Rules()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ret := make([]apitype.FirewallRule, 0, len(rules))
+	for _, rule := range rules {
+		fr := apitype.FirewallRule{
+			ID:       rule.ID.String(),
+			Name:     rule.Name,
+			Purpose:  string(rule.ProviderData),
+			Layer:    rule.Layer.String(),
+			Action:   rule.Action.String(),
+			Weight:   rule.Weight,
+			Disabled: rule.Disabled,
+		}
+		for _, c := range rule.Conditions {
+			fr.Conditions = append(fr.Conditions, c.String())
+		}
+		ret = append(ret, fr)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	enc.Encode(ret)
+}
@@ -36,12 +36,14 @@
 	"tailscale.com/clientupdate"
 	"tailscale.com/drive"
 	"tailscale.com/envknob"
+	"tailscale.com/health"
 	"tailscale.com/hostinfo"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnauth"
 	"tailscale.com/ipn/ipnlocal"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/logtail"
+	"tailscale.com/logtail/redact"
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/netutil"
 	"tailscale.com/net/portmapper"
@@ -49,6 +51,7 @@
 	"tailscale.com/taildrop"
 	"tailscale.com/tka"
 	"tailscale.com/tstime"
+	"tailscale.com/tsweb/tracing"
 	"tailscale.com/types/dnstype"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
@@ -65,6 +68,7 @@
 	"tailscale.com/util/syspolicy/rsop"
 	"tailscale.com/util/syspolicy/setting"
 	"tailscale.com/version"
+	"tailscale.com/wgengine/capture"
 	"tailscale.com/wgengine/magicsock"
 )
 
@@ -89,9 +93,13 @@
 	"check-udp-gro-forwarding":    (*Handler).serveCheckUDPGROForwarding,
 	"component-debug-logging":     (*Handler).serveComponentDebugLogging,
 	"debug":                       (*Handler).serveDebug,
+	"debug-bus-events":            (*Handler).serveDebugBusEvents,
 	"debug-capture":               (*Handler).serveDebugCapture,
 	"debug-derp-region":           (*Handler).serveDebugDERPRegion,
 	"debug-dial-types":            (*Handler).serveDebugDialTypes,
+	"debug-firewall":              (*Handler).serveDebugFirewall,
+	"debug-flows":                 (*Handler).serveDebugFlows,
+	"debug-kill-flow":             (*Handler).serveDebugKillFlow,
 	"debug-log":                   (*Handler).serveDebugLog,
 	"debug-packet-filter-matches": (*Handler).serveDebugPacketFilterMatches,
 	"debug-packet-filter-rules":   (*Handler).serveDebugPacketFilterRules,
@@ -101,24 +109,36 @@
 	"dev-set-state-store":         (*Handler).serveDevSetStateStore,
 	"dial":                        (*Handler).serveDial,
 	"disconnect-control":          (*Handler).disconnectControl,
+	"dns-flush":                   (*Handler).serveDNSFlush,
 	"dns-osconfig":                (*Handler).serveDNSOSConfig,
 	"dns-query":                   (*Handler).serveDNSQuery,
 	"drive/fileserver-address":    (*Handler).serveDriveServerAddr,
 	"drive/shares":                (*Handler).serveShares,
+	"drive/status":                (*Handler).serveDriveStatus,
 	"file-targets":                (*Handler).serveFileTargets,
 	"goroutines":                  (*Handler).serveGoroutines,
 	"handle-push-message":         (*Handler).serveHandlePushMessage,
+	"health":                      (*Handler).serveHealth,
+	"health/warnables":            (*Handler).serveHealthWarnables,
 	"id-token":                    (*Handler).serveIDToken,
+	"location-profiles":           (*Handler).serveLocationProfiles,
+	"log-redaction":               (*Handler).serveLogRedaction,
 	"login-interactive":           (*Handler).serveLoginInteractive,
 	"logout":                      (*Handler).serveLogout,
+	"logs-export":                 (*Handler).serveLogsExport,
 	"logtap":                      (*Handler).serveLogTap,
 	"metrics":                     (*Handler).serveMetrics,
+	"path-stats":                  (*Handler).servePathStats,
+	"peer-info":                   (*Handler).servePeerInfo,
+	"peer-update":                 (*Handler).servePeerUpdate,
 	"ping":                        (*Handler).servePing,
+	"power-state":                 (*Handler).servePowerState,
 	"pprof":                       (*Handler).servePprof,
 	"prefs":                       (*Handler).servePrefs,
 	"query-feature":               (*Handler).serveQueryFeature,
 	"reload-config":               (*Handler).reloadConfig,
 	"reset-auth":                  (*Handler).serveResetAuth,
+	"route-approvals":             (*Handler).serveRouteApprovals,
 	"serve-config":                (*Handler).serveServeConfig,
 	"set-dns":                     (*Handler).serveSetDNS,
 	"set-expiry-sooner":           (*Handler).serveSetExpirySooner,
@@ -146,7 +166,9 @@
 	"update/install":              (*Handler).serveUpdateInstall,
 	"update/progress":             (*Handler).serveUpdateProgress,
 	"upload-client-metrics":       (*Handler).serveUploadClientMetrics,
+	"usage":                       (*Handler).serveUsage,
 	"usermetrics":                 (*Handler).serveUserMetrics,
+	"validate-config":             (*Handler).serveValidateConfig,
 	"watch-ipn-bus":               (*Handler).serveWatchIPNBus,
 	"whois":                       (*Handler).serveWhoIs,
 }
@@ -224,12 +246,33 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if fn, ok := handlerForPath(r.URL.Path); ok {
-		fn(h, w, r)
+		if tracing.Default() == nil {
+			fn(h, w, r)
+			return
+		}
+		tracing.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fn(h, w, r)
+		}), spanName).ServeHTTP(w, r)
 	} else {
 		http.NotFound(w, r)
 	}
 }
 
+// spanName returns the tracing span name for a LocalAPI request, naming
+// prefix-matched handlers like "files/" by their prefix.
+func spanName(r *http.Request) string {
+	suff, ok := strings.CutPrefix(r.URL.Path, "/localapi/v0/")
+	if !ok {
+		return "LocalAPI"
+	}
+	if _, ok := handler[suff]; !ok {
+		if i := strings.IndexByte(suff, '/'); i != -1 {
+			suff = suff[:i+1]
+		}
+	}
+	return "LocalAPI " + suff
+}
+
 // validLocalHostForTesting allows loopback handlers without RequiredPassword for testing.
 var validLocalHostForTesting = false
 
@@ -464,6 +507,13 @@ func (h *Handler) serveWhoIsWithBackend(w http.ResponseWriter, r *http.Request,
 		u  tailcfg.UserProfile
 		ok bool
 	)
+	proto := r.FormValue("proto")
+	switch proto {
+	case "", "tcp", "udp":
+	default:
+		http.Error(w, "invalid 'proto' parameter; must be tcp or udp", http.StatusBadRequest)
+		return
+	}
 	var ipp netip.AddrPort
 	if v := r.FormValue("addr"); v != "" {
 		if strings.HasPrefix(v, "nodekey:") {
@@ -484,7 +534,7 @@ func (h *Handler) serveWhoIsWithBackend(w http.ResponseWriter, r *http.Request,
 			}
 		}
 		if ipp.IsValid() {
-			n, u, ok = b.WhoIs(r.FormValue("proto"), ipp)
+			n, u, ok = b.WhoIs(proto, ipp)
 		}
 	} else {
 		http.Error(w, "missing 'addr' parameter", http.StatusBadRequest)
@@ -562,6 +612,70 @@ func (h *Handler) serveLogTap(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// serveLogsExport writes the logs kept in tailscaled's local on-disk log
+// buffer, optionally limited to those logged in the duration given by the
+// "since" query parameter.
+func (h *Handler) serveLogsExport(w http.ResponseWriter, r *http.Request) {
+	// Require write access (~root) as the logs could contain something
+	// sensitive.
+	if !h.PermitWrite {
+		http.Error(w, "logs access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	var since time.Time
+	if v := r.FormValue("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid 'since' duration", http.StatusBadRequest)
+			return
+		}
+		since = h.clock.Now().Add(-d)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.b.ExportLocalLogs(w, since); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveLogRedaction gets (GET) or sets (POST) the rules that redact
+// sensitive data from logs, as JSON-encoded []redact.Rule.
+func (h *Handler) serveLogRedaction(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if !h.PermitRead {
+			http.Error(w, "log redaction access denied", http.StatusForbidden)
+			return
+		}
+		rules := h.b.LogRedactionRules()
+		if rules == nil {
+			rules = []redact.Rule{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+	case "POST":
+		if !h.PermitWrite {
+			http.Error(w, "log redaction access denied", http.StatusForbidden)
+			return
+		}
+		var rules []redact.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := h.b.SetLogRedactionRules(rules); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "only GET or POST allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 func (h *Handler) serveMetrics(w http.ResponseWriter, r *http.Request) {
 	metricDebugMetricsCalls.Add(1)
 	// Require write access out of paranoia that the metrics
@@ -632,6 +746,12 @@ func (h *Handler) serveDebug(w http.ResponseWriter, r *http.Request) {
 		if err == nil {
 			return
 		}
+	case "bus-topics":
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(h.b.EventBus().Stats())
+		if err == nil {
+			return
+		}
 	case "pick-new-derp":
 		err = h.b.DebugPickNewDERP()
 	case "force-prefer-derp":
@@ -654,6 +774,51 @@ func (h *Handler) serveDebug(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, "done\n")
 }
 
+// serveDebugBusEvents streams the events published on the system event bus
+// to the client, as newline-delimited JSON eventbus.DebugEvent values.
+func (h *Handler) serveDebugBusEvents(w http.ResponseWriter, r *http.Request) {
+	// Require write access (~root) as events could contain something
+	// sensitive.
+	if !h.PermitWrite {
+		http.Error(w, "debug access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := h.b.EventBus().Debug()
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-sub.Events():
+			if err := enc.Encode(ev); err != nil {
+				// Not every event type can be marshaled as JSON,
+				// so fall back to formatting it as text.
+				ev.Event = fmt.Sprintf("%+v", ev.Event)
+				if err := enc.Encode(ev); err != nil {
+					return
+				}
+			}
+			f.Flush()
+		}
+	}
+}
+
 func (h *Handler) serveDevSetStateStore(w http.ResponseWriter, r *http.Request) {
 	if !h.PermitWrite {
 		http.Error(w, "debug access denied", http.StatusForbidden)
@@ -962,6 +1127,74 @@ func (h *Handler) servePprof(w http.ResponseWriter, r *http.Request) {
 	servePprofFunc(w, r)
 }
 
+// serveDebugFirewallFunc is the implementation of Handler.serveDebugFirewall,
+// after auth, for platforms where tailscaled manages its own firewall rules.
+var serveDebugFirewallFunc func(http.ResponseWriter, *http.Request)
+
+func (h *Handler) serveDebugFirewall(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "debug access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if serveDebugFirewallFunc == nil {
+		http.Error(w, "not implemented on this platform", http.StatusServiceUnavailable)
+		return
+	}
+	serveDebugFirewallFunc(w, r)
+}
+
+func (h *Handler) serveDebugFlows(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "debug access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flows := h.b.DebugFlows()
+	ret := make([]apitype.Flow, 0, len(flows))
+	for _, fl := range flows {
+		proto, _ := fl.Tuple.Proto().MarshalText()
+		ret = append(ret, apitype.Flow{
+			ID:      fl.ID,
+			Proto:   string(proto),
+			Src:     netip.AddrPortFrom(fl.Tuple.SrcAddr(), fl.Tuple.SrcPort()),
+			Dst:     netip.AddrPortFrom(fl.Tuple.DstAddr(), fl.Tuple.DstPort()),
+			Inbound: fl.Inbound,
+			Created: fl.Created,
+			Killed:  fl.Killed,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ret)
+}
+
+func (h *Handler) serveDebugKillFlow(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "debug access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseUint(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if err := h.b.DebugKillFlow(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // disconnectControl is the handler for local API /disconnect-control endpoint that shuts down control client, so that
 // node no longer communicates with control. Doing this makes control consider this node inactive. This can be used
 // before shutting down a replica of HA subnet  router or app connector deployments to ensure that control tells the
@@ -998,6 +1231,32 @@ func (h *Handler) reloadConfig(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(&res)
 }
 
+// serveValidateConfig validates the config file in the request body, as
+// read from the path in the "path" query parameter, and reports what reloading
+// it would change, without applying it.
+func (h *Handler) serveValidateConfig(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != httpm.POST {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var res apitype.ValidateConfigResponse
+	res.Changes, err = h.b.ValidateConfig(r.FormValue("path"), raw)
+	if err != nil {
+		res.Err = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&res)
+}
+
 func (h *Handler) serveResetAuth(w http.ResponseWriter, r *http.Request) {
 	if !h.PermitWrite {
 		http.Error(w, "reset-auth modify access denied", http.StatusForbidden)
@@ -1067,6 +1326,108 @@ func (h *Handler) serveServeConfig(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *Handler) serveLocationProfiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if !h.PermitRead {
+			http.Error(w, "location profiles access denied", http.StatusForbidden)
+			return
+		}
+		st, err := h.b.LocationStatus()
+		if err != nil {
+			writeErrorJSON(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(st)
+	case "POST":
+		if !h.PermitWrite {
+			http.Error(w, "location profiles access denied", http.StatusForbidden)
+			return
+		}
+		var profiles []ipn.LocationProfile
+		if err := json.NewDecoder(r.Body).Decode(&profiles); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := h.b.SetLocationProfiles(profiles); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveUsage serves the bandwidth usage of the current profile on GET, and
+// deletes it on DELETE.
+func (h *Handler) serveUsage(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if !h.PermitRead {
+			http.Error(w, "usage access denied", http.StatusForbidden)
+			return
+		}
+		st, err := h.b.UsageStats()
+		if err != nil {
+			writeErrorJSON(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(st)
+	case "DELETE":
+		if !h.PermitWrite {
+			http.Error(w, "usage access denied", http.StatusForbidden)
+			return
+		}
+		if err := h.b.ResetUsageStats(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveRouteApprovals serves the route approvals of the current profile on
+// GET, and records the decision of an approval agent about an advertised
+// route on POST.
+func (h *Handler) serveRouteApprovals(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if !h.PermitRead {
+			http.Error(w, "route approvals access denied", http.StatusForbidden)
+			return
+		}
+		res, err := h.b.RouteApprovals()
+		if err != nil {
+			writeErrorJSON(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	case "POST":
+		if !h.PermitWrite {
+			http.Error(w, "route approvals access denied", http.StatusForbidden)
+			return
+		}
+		var d ipn.RouteDecision
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := h.b.DecideRoute(d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 func authorizeServeConfigForGOOSAndUserContext(goos string, configIn *ipn.ServeConfig, h *Handler) error {
 	switch goos {
 	case "windows", "linux", "darwin":
@@ -1195,6 +1556,89 @@ func (h *Handler) serveDebugPeerEndpointChanges(w http.ResponseWriter, r *http.R
 	e.Encode(chs)
 }
 
+// servePathStats returns the latency and loss statistics of the paths to the
+// peer with the Tailscale IP in the "ip" parameter.
+func (h *Handler) servePathStats(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "status access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "want GET", http.StatusMethodNotAllowed)
+		return
+	}
+	ip, err := netip.ParseAddr(r.FormValue("ip"))
+	if err != nil {
+		http.Error(w, "invalid or missing 'ip' parameter", http.StatusBadRequest)
+		return
+	}
+	stats, err := h.b.GetPeerPathStats(r.Context(), ip)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// servePeerInfo returns the self-reported state of the peer with the Tailscale
+// IP in the "ip" parameter, as fetched from the peer's peerapi.
+func (h *Handler) servePeerInfo(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "status access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "want GET", http.StatusMethodNotAllowed)
+		return
+	}
+	ip, err := netip.ParseAddr(r.FormValue("ip"))
+	if err != nil {
+		http.Error(w, "invalid or missing 'ip' parameter", http.StatusBadRequest)
+		return
+	}
+	ni, err := h.b.PeerNodeInfo(r.Context(), ip)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ni)
+}
+
+// servePeerUpdate returns the self-update state of the peer with the
+// Tailscale IP in the "ip" parameter, as fetched from the peer's peerapi. On
+// POST, it first asks the peer to update itself.
+func (h *Handler) servePeerUpdate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if !h.PermitRead {
+			http.Error(w, "status access denied", http.StatusForbidden)
+			return
+		}
+	case "POST":
+		if !h.PermitWrite {
+			http.Error(w, "update access denied", http.StatusForbidden)
+			return
+		}
+	default:
+		http.Error(w, "want GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+	ip, err := netip.ParseAddr(r.FormValue("ip"))
+	if err != nil {
+		http.Error(w, "invalid or missing 'ip' parameter", http.StatusBadRequest)
+		return
+	}
+	st, err := h.b.PeerUpdate(r.Context(), ip, r.Method == "POST", defBool(r.FormValue("force"), false))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
 // InUseOtherUserIPNStream reports whether r is a request for the watch-ipn-bus
 // handler. If so, it writes an ipn.Notify InUseOtherUser message to the user
 // and returns true. Otherwise it returns false, in which case it doesn't write
@@ -1250,18 +1694,32 @@ func (h *Handler) serveWatchIPNBus(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	// With a cursor, the watch resumes after the notification with that
+	// cursor. In poll mode, rather than streaming notifications, the request
+	// returns as soon as one has been sent, for clients that can't hold the
+	// connection open and instead poll with the cursor of the last one.
+	cursor := r.FormValue("cursor")
+	poll := defBool(r.FormValue("poll"), false)
+
 	ctx := r.Context()
 	enc := json.NewEncoder(w)
-	h.b.WatchNotificationsAs(ctx, h.Actor, mask, f.Flush, func(roNotify *ipn.Notify) (keepGoing bool) {
+	onWatchAdded := func() {
+		w.Header().Set("Content-Type", "application/json")
+		f.Flush()
+	}
+	err := h.b.WatchNotificationsFrom(ctx, h.Actor, mask, cursor, onWatchAdded, func(roNotify *ipn.Notify) (keepGoing bool) {
 		err := enc.Encode(roNotify)
 		if err != nil {
 			h.logf("json.Encode: %v", err)
 			return false
 		}
 		f.Flush()
-		return true
+		return !poll
 	})
+	if err != nil {
+		// The watch can't be resumed; the client needs to start a new one.
+		http.Error(w, err.Error(), http.StatusGone)
+	}
 }
 
 func (h *Handler) serveLoginInteractive(w http.ResponseWriter, r *http.Request) {
@@ -1860,6 +2318,40 @@ func (h *Handler) serveDERPMap(w http.ResponseWriter, r *http.Request) {
 	e.Encode(h.b.DERPMap())
 }
 
+// serveHealth returns the current health.State, for clients that poll
+// rather than watching the IPN bus for its Health notifications.
+func (h *Handler) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "health access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "want GET", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	e.Encode(h.b.HealthTracker().CurrentState())
+}
+
+// serveHealthWarnables returns every health.Warnable that the backend can
+// report, so clients can know their codes ahead of time.
+func (h *Handler) serveHealthWarnables(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "health access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "want GET", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	e.Encode(health.Warnables())
+}
+
 // serveSetExpirySooner sets the expiry date on the current machine, specified
 // by an `expiry` unix timestamp as POST or query param.
 func (h *Handler) serveSetExpirySooner(w http.ResponseWriter, r *http.Request) {
@@ -2104,6 +2596,30 @@ func (h *Handler) serveTKAStatus(w http.ResponseWriter, r *http.Request) {
 	w.Write(j)
 }
 
+// servePowerState gets or, with a POST of an ipn.PowerState, sets the power
+// state of the host.
+func (h *Handler) servePowerState(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case httpm.GET:
+	case httpm.POST:
+		if !h.PermitWrite {
+			http.Error(w, "access denied", http.StatusForbidden)
+			return
+		}
+		var ps ipn.PowerState
+		if err := json.NewDecoder(r.Body).Decode(&ps); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		h.b.SetPowerState(ps)
+	default:
+		http.Error(w, "use GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.b.PowerState())
+}
+
 func (h *Handler) serveSetGUIVisible(w http.ResponseWriter, r *http.Request) {
 	if r.Method != httpm.POST {
 		http.Error(w, "use POST", http.StatusMethodNotAllowed)
@@ -2670,10 +3186,20 @@ func (h *Handler) serveDebugCapture(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "POST required", http.StatusMethodNotAllowed)
 		return
 	}
+	var opts capture.Options
+	var err error
+	if opts.Filter, err = capture.ParseFilter(r.FormValue("filter")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Format, err = capture.ParseFormat(r.FormValue("format")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.(http.Flusher).Flush()
-	h.b.StreamDebugCapture(r.Context(), w)
+	h.b.StreamDebugCapture(r.Context(), w, opts)
 }
 
 func (h *Handler) serveDebugLog(w http.ResponseWriter, r *http.Request) {
@@ -2846,7 +3372,7 @@ func (h *Handler) serveDNSQuery(w http.ResponseWriter, r *http.Request) {
 		qt = t
 	}
 
-	res, rrs, err := h.b.QueryDNS(name, qt)
+	res, route, err := h.b.QueryDNS(name, qt)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -2855,10 +3381,29 @@ func (h *Handler) serveDNSQuery(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(&apitype.DNSQueryResponse{
 		Bytes:     res,
-		Resolvers: rrs,
+		Resolvers: route.Resolvers,
+		Local:     route.Local,
+		Route:     string(route.Suffix),
 	})
 }
 
+// serveDNSFlush flushes the DNS caches of the OS, where supported.
+func (h *Handler) serveDNSFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.PermitWrite {
+		http.Error(w, "dns-flush access denied", http.StatusForbidden)
+		return
+	}
+	if err := h.b.FlushDNSCaches(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // serveDriveServerAddr handles updates of the Taildrive file server address.
 func (h *Handler) serveDriveServerAddr(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "PUT" {
@@ -2876,6 +3421,31 @@ func (h *Handler) serveDriveServerAddr(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 }
 
+// serveDriveStatus reports the status of the Taildrive shares, including
+// recent accesses to them.
+func (h *Handler) serveDriveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Accesses include file paths, so require write access like dns-query.
+	if !h.PermitWrite {
+		http.Error(w, "drive status access denied", http.StatusForbidden)
+		return
+	}
+	st, err := h.b.DriveStatus()
+	if err != nil {
+		if errors.Is(err, drive.ErrDriveNotEnabled) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
 // serveShares handles the management of Taildrive shares.
 //
 // PUT - adds or updates an existing share
@@ -188,6 +188,39 @@ func TestWhoIsArgTypes(t *testing.T) {
 	}
 }
 
+func TestWhoIsProto(t *testing.T) {
+	h := &Handler{
+		PermitRead: true,
+	}
+	var gotProto string
+	b := whoIsBackend{
+		whoIs: func(proto string, ipp netip.AddrPort) (n tailcfg.NodeView, u tailcfg.UserProfile, ok bool) {
+			gotProto = proto
+			return (&tailcfg.Node{ID: 123}).View(), tailcfg.UserProfile{ID: 456}, true
+		},
+	}
+	for _, tt := range []struct {
+		proto    string
+		wantCode int
+	}{
+		{"", 200},
+		{"tcp", 200},
+		{"udp", 200},
+		{"udp4", 400},
+		{"sctp", 400},
+	} {
+		gotProto = "unset"
+		rec := httptest.NewRecorder()
+		h.serveWhoIsWithBackend(rec, httptest.NewRequest("GET", "/v0/whois?proto="+tt.proto+"&addr=127.0.0.1:123", nil), b)
+		if rec.Code != tt.wantCode {
+			t.Errorf("proto %q: response code %d, want %d", tt.proto, rec.Code, tt.wantCode)
+		}
+		if tt.wantCode == 200 && gotProto != tt.proto {
+			t.Errorf("proto %q: backend called with proto %q", tt.proto, gotProto)
+		}
+	}
+}
+
 func TestShouldDenyServeConfigForGOOSAndUserContext(t *testing.T) {
 	newHandler := func(connIsLocalAdmin bool) *Handler {
 		return &Handler{Actor: &ipnauth.TestActor{LocalAdmin: connIsLocalAdmin}, b: newTestLocalBackend(t)}
@@ -0,0 +1,220 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"tailscale.com/tailcfg"
+)
+
+// LocationProfilesKey returns the StateKey that stores the LocationConfig of
+// the profile with the given ID.
+func LocationProfilesKey(profileID ProfileID) StateKey {
+	return StateKey("_locations/" + profileID)
+}
+
+// LocationProfile is a set of pref overrides that are applied while the
+// machine is connected to a particular network, such as turning off
+// accepting routes at the office or using an exit node on public Wi-Fi.
+type LocationProfile struct {
+	// Name is the unique name of the profile, such as "office".
+	Name string
+
+	// Match identifies the networks the profile applies to.
+	Match LocationMatch
+
+	// Prefs are the pref overrides applied while on a matching network.
+	Prefs LocationPrefs
+}
+
+// LocationMatch identifies a network by its properties. A network matches
+// if all of the non-empty fields are equal to the network's; at least one
+// field must be non-empty.
+type LocationMatch struct {
+	// SSID is the SSID of the Wi-Fi network.
+	SSID string `json:",omitempty"`
+
+	// GatewayMAC is the hardware address of the default gateway, in
+	// lower-case, colon-separated form.
+	GatewayMAC string `json:",omitempty"`
+
+	// Domain is the first DNS search domain of the network.
+	Domain string `json:",omitempty"`
+}
+
+// IsZero reports whether m has no non-empty fields.
+func (m LocationMatch) IsZero() bool {
+	return m == LocationMatch{}
+}
+
+// Matches reports whether m matches the network with the properties in
+// network. A zero m never matches.
+func (m LocationMatch) Matches(network LocationMatch) bool {
+	if m.IsZero() {
+		return false
+	}
+	return (m.SSID == "" || m.SSID == network.SSID) &&
+		(m.GatewayMAC == "" || strings.EqualFold(m.GatewayMAC, network.GatewayMAC)) &&
+		(m.Domain == "" || strings.EqualFold(m.Domain, network.Domain))
+}
+
+func (m LocationMatch) String() string {
+	var terms []string
+	if m.SSID != "" {
+		terms = append(terms, fmt.Sprintf("ssid=%q", m.SSID))
+	}
+	if m.GatewayMAC != "" {
+		terms = append(terms, "gateway-mac="+m.GatewayMAC)
+	}
+	if m.Domain != "" {
+		terms = append(terms, "domain="+m.Domain)
+	}
+	return strings.Join(terms, " ")
+}
+
+// LocationPrefs are the prefs a LocationProfile overrides. Nil fields are
+// left alone.
+type LocationPrefs struct {
+	RouteAll               *bool `json:",omitempty"`
+	CorpDNS                *bool `json:",omitempty"`
+	ShieldsUp              *bool `json:",omitempty"`
+	ExitNodeAllowLANAccess *bool `json:",omitempty"`
+
+	// ExitNode, if non-nil, replaces the exit node settings. A zero
+	// LocationExitNode turns off the use of an exit node.
+	ExitNode *LocationExitNode `json:",omitempty"`
+}
+
+// LocationExitNode is the exit node selection of a LocationPrefs. At most
+// one field is set.
+type LocationExitNode struct {
+	ID   tailcfg.StableNodeID `json:",omitempty"`
+	IP   netip.Addr           `json:",omitempty"`
+	Auto ExitNodeExpression   `json:",omitempty"`
+}
+
+// IsZero reports whether p overrides no prefs.
+func (p LocationPrefs) IsZero() bool {
+	return p == LocationPrefs{}
+}
+
+// MaskedPrefs returns the edits that apply the overrides of p.
+func (p LocationPrefs) MaskedPrefs() *MaskedPrefs {
+	mp := new(MaskedPrefs)
+	if p.RouteAll != nil {
+		mp.RouteAll, mp.RouteAllSet = *p.RouteAll, true
+	}
+	if p.CorpDNS != nil {
+		mp.CorpDNS, mp.CorpDNSSet = *p.CorpDNS, true
+	}
+	if p.ShieldsUp != nil {
+		mp.ShieldsUp, mp.ShieldsUpSet = *p.ShieldsUp, true
+	}
+	if p.ExitNodeAllowLANAccess != nil {
+		mp.ExitNodeAllowLANAccess, mp.ExitNodeAllowLANAccessSet = *p.ExitNodeAllowLANAccess, true
+	}
+	if e := p.ExitNode; e != nil {
+		mp.ExitNodeID, mp.ExitNodeIDSet = e.ID, true
+		mp.ExitNodeIP, mp.ExitNodeIPSet = e.IP, true
+		mp.AutoExitNode, mp.AutoExitNodeSet = e.Auto, true
+	}
+	return mp
+}
+
+// Current returns a LocationPrefs that overrides the same prefs as p, with
+// their values in prefs. Applying it undoes the overrides of p.
+func (p LocationPrefs) Current(prefs PrefsView) LocationPrefs {
+	var cur LocationPrefs
+	if p.RouteAll != nil {
+		cur.RouteAll = boolPtr(prefs.RouteAll())
+	}
+	if p.CorpDNS != nil {
+		cur.CorpDNS = boolPtr(prefs.CorpDNS())
+	}
+	if p.ShieldsUp != nil {
+		cur.ShieldsUp = boolPtr(prefs.ShieldsUp())
+	}
+	if p.ExitNodeAllowLANAccess != nil {
+		cur.ExitNodeAllowLANAccess = boolPtr(prefs.ExitNodeAllowLANAccess())
+	}
+	if p.ExitNode != nil {
+		cur.ExitNode = &LocationExitNode{
+			ID:   prefs.ExitNodeID(),
+			IP:   prefs.ExitNodeIP(),
+			Auto: prefs.AutoExitNode(),
+		}
+	}
+	return cur
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+// LocationConfig is the location profile configuration of a login profile,
+// stored in the StateStore under LocationProfilesKey.
+type LocationConfig struct {
+	// Profiles are the location profiles, in order of preference: if a
+	// network matches several, the first one is applied.
+	Profiles []LocationProfile `json:",omitempty"`
+
+	// Active is the name of the location profile currently applied, if
+	// any.
+	Active string `json:",omitempty"`
+
+	// Saved are the values of the prefs overridden by the Active profile
+	// from before it was applied. They're restored when the machine
+	// leaves the network.
+	Saved *LocationPrefs `json:",omitempty"`
+}
+
+// Match returns the first profile matching network, if any.
+func (c *LocationConfig) Match(network LocationMatch) (_ LocationProfile, ok bool) {
+	for _, p := range c.Profiles {
+		if p.Match.Matches(network) {
+			return p, true
+		}
+	}
+	return LocationProfile{}, false
+}
+
+// CheckLocationProfiles returns an error if the profiles are not valid: if
+// any lacks a name or a match, or if several share a name.
+func CheckLocationProfiles(profiles []LocationProfile) error {
+	seen := make(map[string]bool)
+	for _, p := range profiles {
+		if p.Name == "" {
+			return errors.New("location profile without a name")
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate location profile %q", p.Name)
+		}
+		seen[p.Name] = true
+		if p.Match.IsZero() {
+			return fmt.Errorf("location profile %q does not match any network", p.Name)
+		}
+		if e := p.Prefs.ExitNode; e != nil && e.Auto != "" {
+			if _, err := e.Auto.Policy(); err != nil {
+				return fmt.Errorf("location profile %q: %w", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LocationStatus is the response of the LocalAPI location profiles endpoint.
+type LocationStatus struct {
+	// Network describes the network the machine is currently connected
+	// to, in the form of a LocationMatch matching it exactly.
+	Network LocationMatch
+
+	// Active is the name of the location profile currently applied, if
+	// any.
+	Active string `json:",omitempty"`
+
+	// Profiles are the configured location profiles.
+	Profiles []LocationProfile
+}
@@ -0,0 +1,96 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestLocationMatch(t *testing.T) {
+	network := LocationMatch{
+		SSID:       "Office",
+		GatewayMAC: "aa:bb:cc:dd:ee:ff",
+		Domain:     "corp.example.com",
+	}
+	tests := []struct {
+		name  string
+		match LocationMatch
+		want  bool
+	}{
+		{"zero", LocationMatch{}, false},
+		{"ssid", LocationMatch{SSID: "Office"}, true},
+		{"ssid_case", LocationMatch{SSID: "office"}, false},
+		{"mac_case", LocationMatch{GatewayMAC: "AA:BB:CC:DD:EE:FF"}, true},
+		{"domain", LocationMatch{Domain: "Corp.Example.com"}, true},
+		{"all", network, true},
+		{"one_mismatch", LocationMatch{SSID: "Office", Domain: "example.com"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.match.Matches(network); got != tt.want {
+				t.Errorf("Matches = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckLocationProfiles(t *testing.T) {
+	office := LocationMatch{Domain: "corp.example.com"}
+	tests := []struct {
+		name     string
+		profiles []LocationProfile
+		wantErr  bool
+	}{
+		{"none", nil, false},
+		{"ok", []LocationProfile{{Name: "office", Match: office}, {Name: "cafe", Match: LocationMatch{SSID: "cafe"}}}, false},
+		{"no_name", []LocationProfile{{Match: office}}, true},
+		{"no_match", []LocationProfile{{Name: "office"}}, true},
+		{"duplicate", []LocationProfile{{Name: "office", Match: office}, {Name: "office", Match: office}}, true},
+		{"bad_auto_exit_node", []LocationProfile{{
+			Name:  "office",
+			Match: office,
+			Prefs: LocationPrefs{ExitNode: &LocationExitNode{Auto: "fastest"}},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckLocationProfiles(tt.profiles); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v; want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocationPrefs(t *testing.T) {
+	prefs := &Prefs{
+		RouteAll:   true,
+		CorpDNS:    true,
+		ExitNodeIP: netip.MustParseAddr("100.64.0.1"),
+	}
+	over := LocationPrefs{
+		RouteAll: boolPtr(false),
+		ExitNode: &LocationExitNode{Auto: AnyExitNode},
+	}
+
+	cur := over.Current(prefs.View())
+	wantCur := LocationPrefs{
+		RouteAll: boolPtr(true),
+		ExitNode: &LocationExitNode{IP: netip.MustParseAddr("100.64.0.1")},
+	}
+	if !reflect.DeepEqual(cur, wantCur) {
+		t.Errorf("Current = %+v; want %+v", cur, wantCur)
+	}
+
+	p := prefs.Clone()
+	p.ApplyEdits(over.MaskedPrefs())
+	if p.RouteAll || !p.CorpDNS || p.ExitNodeIP.IsValid() || p.AutoExitNode != AnyExitNode {
+		t.Errorf("after applying overrides: RouteAll=%v CorpDNS=%v ExitNodeIP=%v AutoExitNode=%q", p.RouteAll, p.CorpDNS, p.ExitNodeIP, p.AutoExitNode)
+	}
+	p.ApplyEdits(cur.MaskedPrefs())
+	if !p.Equals(prefs) {
+		t.Errorf("restoring did not undo the overrides: got %v; want %v", p.Pretty(), prefs.Pretty())
+	}
+}
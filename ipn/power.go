@@ -0,0 +1,24 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+// PowerState is the power state of the host, as reported by the platform's
+// GUI or service (such as on macOS, Windows or Android) through the LocalAPI
+// power-state endpoint. The zero value is a host that is awake and on
+// normal power.
+type PowerState struct {
+	// LowPower is whether the host is in a low-power or battery saver mode.
+	LowPower bool `json:",omitempty"`
+
+	// ScreenOff is whether the host's screen is off or locked, such that
+	// the user isn't interacting with it.
+	ScreenOff bool `json:",omitempty"`
+}
+
+// Idle reports whether the host is in a state in which tailscaled should
+// save power by doing less background work, at the cost of peer and
+// endpoint changes taking longer to propagate.
+func (s PowerState) Idle() bool {
+	return s.LowPower || s.ScreenOff
+}
@@ -16,6 +16,7 @@
 	"runtime"
 	"slices"
 	"strings"
+	"time"
 
 	"tailscale.com/atomicfile"
 	"tailscale.com/drive"
@@ -93,6 +94,12 @@ type Prefs struct {
 	ExitNodeID tailcfg.StableNodeID
 	ExitNodeIP netip.Addr
 
+	// AutoExitNode, if non-empty, is an expression specifying how
+	// ipnlocal.LocalBackend picks the exit node automatically, and when to
+	// use one at all. ExitNodeID is then set by the backend as the
+	// network, the exit nodes available and the time of day change.
+	AutoExitNode ExitNodeExpression `json:",omitempty"`
+
 	// InternalExitNodePrior is the most recently used ExitNodeID in string form. It is set by
 	// the backend on transition from exit node on to off and used by the
 	// backend.
@@ -105,6 +112,14 @@ type Prefs struct {
 	// routed directly or via the exit node.
 	ExitNodeAllowLANAccess bool
 
+	// ExitNodeFailClosed indicates whether, while an exit node is selected
+	// but unreachable, all traffic other than to the tailnet should be
+	// blocked, rather than only the traffic that would have been routed via
+	// the exit node. In particular, DNS queries aren't sent to the local
+	// network's resolvers, and ExitNodeAllowLANAccess has no effect, until
+	// the exit node is reachable again or a different one is selected.
+	ExitNodeFailClosed bool
+
 	// CorpDNS specifies whether to install the Tailscale network's
 	// DNS configuration, if it exists.
 	CorpDNS bool
@@ -120,6 +135,12 @@ type Prefs struct {
 	// policies as configured by the Tailnet's admin(s).
 	RunWebClient bool
 
+	// RunMetricsServer bool is whether this node should expose
+	// its client metrics in Prometheus format over Tailscale
+	// at port 5253, permitting access to peers according to
+	// the policies as configured by the Tailnet's admin(s).
+	RunMetricsServer bool
+
 	// WantRunning indicates whether networking should be active on
 	// this node.
 	WantRunning bool
@@ -185,6 +206,13 @@ type Prefs struct {
 	// control server.
 	AdvertiseServices []string
 
+	// RouteJustification is optional, opaque metadata describing why
+	// AdvertiseRoutes are advertised, such as a change ticket ID or a
+	// JSON document. It's made available to control servers that delegate
+	// the approval of advertised routes to an agent running on the node.
+	// See ipn.RouteDecision.
+	RouteJustification string `json:",omitempty"`
+
 	// NoSNAT specifies whether to source NAT traffic going to
 	// destinations in AdvertiseRoutes. The default is to apply source
 	// NAT, which makes the traffic appear to come from the router
@@ -236,6 +264,38 @@ type Prefs struct {
 	// posture checks.
 	PostureChecking bool
 
+	// KeepaliveIntervals tune how often disco heartbeats and WireGuard
+	// keepalives are sent to each class of peers, such as to save battery
+	// on a phone or data on a metered link. They override the intervals
+	// delivered by control for the same classes.
+	KeepaliveIntervals []tailcfg.KeepaliveIntervals `json:",omitempty"`
+
+	// EphemeralIdleTimeout, if positive, makes the node ephemeral, for
+	// CI runners and short-lived containers that would otherwise leave
+	// stale devices behind: it registers with control as an ephemeral
+	// node, and once it has been idle for this long, with no data traffic
+	// to or from peers (WireGuard handshakes and keepalives don't count),
+	// no SSH sessions and no users logged in to its console, it logs out
+	// and deletes its profile.
+	//
+	// Control only marks a node ephemeral when it registers a new node key,
+	// so setting this on a node that is already registered doesn't make it
+	// ephemeral until it next registers; it's logged out when idle
+	// regardless.
+	EphemeralIdleTimeout time.Duration `json:",omitempty"`
+
+	// LANDNSResponder specifies whether to answer multicast DNS (mDNS)
+	// and LLMNR queries on the local networks for this node's MagicDNS
+	// name, with its Tailscale addresses, so that devices on those
+	// networks that aren't in the tailnet but can route to it, such as
+	// through a subnet router, can find the node by name.
+	LANDNSResponder bool `json:",omitempty"`
+
+	// CertIssuer is where the TLS certs for this node's domains, as used
+	// by "tailscale cert" and serve, are issued, in the format parsed by
+	// ParseCertIssuer. If empty, they're issued by Let's Encrypt.
+	CertIssuer string `json:",omitempty"`
+
 	// NetfilterKind specifies what netfilter implementation to use.
 	//
 	// Linux-only.
@@ -311,11 +371,14 @@ type MaskedPrefs struct {
 	RouteAllSet               bool                `json:",omitempty"`
 	ExitNodeIDSet             bool                `json:",omitempty"`
 	ExitNodeIPSet             bool                `json:",omitempty"`
+	AutoExitNodeSet           bool                `json:",omitempty"`
 	InternalExitNodePriorSet  bool                `json:",omitempty"` // Internal; can't be set by LocalAPI clients
 	ExitNodeAllowLANAccessSet bool                `json:",omitempty"`
+	ExitNodeFailClosedSet     bool                `json:",omitempty"`
 	CorpDNSSet                bool                `json:",omitempty"`
 	RunSSHSet                 bool                `json:",omitempty"`
 	RunWebClientSet           bool                `json:",omitempty"`
+	RunMetricsServerSet       bool                `json:",omitempty"`
 	WantRunningSet            bool                `json:",omitempty"`
 	LoggedOutSet              bool                `json:",omitempty"`
 	ShieldsUpSet              bool                `json:",omitempty"`
@@ -326,6 +389,7 @@ type MaskedPrefs struct {
 	EggSet                    bool                `json:",omitempty"`
 	AdvertiseRoutesSet        bool                `json:",omitempty"`
 	AdvertiseServicesSet      bool                `json:",omitempty"`
+	RouteJustificationSet     bool                `json:",omitempty"`
 	NoSNATSet                 bool                `json:",omitempty"`
 	NoStatefulFilteringSet    bool                `json:",omitempty"`
 	NetfilterModeSet          bool                `json:",omitempty"`
@@ -334,6 +398,10 @@ type MaskedPrefs struct {
 	AutoUpdateSet             AutoUpdatePrefsMask `json:",omitempty"`
 	AppConnectorSet           bool                `json:",omitempty"`
 	PostureCheckingSet        bool                `json:",omitempty"`
+	KeepaliveIntervalsSet     bool                `json:",omitempty"`
+	EphemeralIdleTimeoutSet   bool                `json:",omitempty"`
+	LANDNSResponderSet        bool                `json:",omitempty"`
+	CertIssuerSet             bool                `json:",omitempty"`
 	NetfilterKindSet          bool                `json:",omitempty"`
 	DriveSharesSet            bool                `json:",omitempty"`
 }
@@ -484,6 +552,10 @@ func (m *MaskedPrefs) Pretty() string {
 	return sb.String()
 }
 
+// MetricsServerPort is the TCP port on which a node's Tailscale IPs serve
+// its client metrics when Prefs.RunMetricsServer is set.
+const MetricsServerPort = 5253
+
 // IsEmpty reports whether p is nil or pointing to a Prefs zero value.
 func (p *Prefs) IsEmpty() bool { return p == nil || p.Equals(&Prefs{}) }
 
@@ -501,6 +573,9 @@ func (p *Prefs) pretty(goos string) string {
 	if p.RunWebClient {
 		sb.WriteString("webclient=true ")
 	}
+	if p.RunMetricsServer {
+		sb.WriteString("metricsserver=true ")
+	}
 	if p.LoggedOut {
 		sb.WriteString("loggedout=true ")
 	}
@@ -518,6 +593,12 @@ func (p *Prefs) pretty(goos string) string {
 	} else if !p.ExitNodeID.IsZero() {
 		fmt.Fprintf(&sb, "exit=%v lan=%t ", p.ExitNodeID, p.ExitNodeAllowLANAccess)
 	}
+	if p.AutoExitNode != "" {
+		fmt.Fprintf(&sb, "autoexit=%s ", string(p.AutoExitNode))
+	}
+	if p.ExitNodeFailClosed && (p.ExitNodeIP.IsValid() || !p.ExitNodeID.IsZero()) {
+		sb.WriteString("failclosed=true ")
+	}
 	if len(p.AdvertiseRoutes) > 0 || goos == "linux" {
 		fmt.Fprintf(&sb, "routes=%v ", p.AdvertiseRoutes)
 	}
@@ -537,6 +618,9 @@ func (p *Prefs) pretty(goos string) string {
 	if len(p.AdvertiseServices) > 0 {
 		fmt.Fprintf(&sb, "services=%s ", strings.Join(p.AdvertiseServices, ","))
 	}
+	if p.RouteJustification != "" {
+		fmt.Fprintf(&sb, "justification=%q ", p.RouteJustification)
+	}
 	if goos == "linux" {
 		fmt.Fprintf(&sb, "nf=%v ", p.NetfilterMode)
 	}
@@ -552,6 +636,18 @@ func (p *Prefs) pretty(goos string) string {
 	if p.NetfilterKind != "" {
 		fmt.Fprintf(&sb, "netfilterKind=%s ", p.NetfilterKind)
 	}
+	if len(p.KeepaliveIntervals) > 0 {
+		fmt.Fprintf(&sb, "keepalive=%s ", FormatKeepaliveIntervals(p.KeepaliveIntervals))
+	}
+	if p.EphemeralIdleTimeout > 0 {
+		fmt.Fprintf(&sb, "ephemeralIdle=%v ", p.EphemeralIdleTimeout)
+	}
+	if p.LANDNSResponder {
+		sb.WriteString("landns=true ")
+	}
+	if p.CertIssuer != "" {
+		fmt.Fprintf(&sb, "certIssuer=%s ", p.CertIssuer)
+	}
 	sb.WriteString(p.AutoUpdate.Pretty())
 	sb.WriteString(p.AppConnector.Pretty())
 	if p.Persist != nil {
@@ -591,11 +687,14 @@ func (p *Prefs) Equals(p2 *Prefs) bool {
 		p.RouteAll == p2.RouteAll &&
 		p.ExitNodeID == p2.ExitNodeID &&
 		p.ExitNodeIP == p2.ExitNodeIP &&
+		p.AutoExitNode == p2.AutoExitNode &&
 		p.InternalExitNodePrior == p2.InternalExitNodePrior &&
 		p.ExitNodeAllowLANAccess == p2.ExitNodeAllowLANAccess &&
+		p.ExitNodeFailClosed == p2.ExitNodeFailClosed &&
 		p.CorpDNS == p2.CorpDNS &&
 		p.RunSSH == p2.RunSSH &&
 		p.RunWebClient == p2.RunWebClient &&
+		p.RunMetricsServer == p2.RunMetricsServer &&
 		p.WantRunning == p2.WantRunning &&
 		p.LoggedOut == p2.LoggedOut &&
 		p.NotepadURLs == p2.NotepadURLs &&
@@ -609,11 +708,16 @@ func (p *Prefs) Equals(p2 *Prefs) bool {
 		compareIPNets(p.AdvertiseRoutes, p2.AdvertiseRoutes) &&
 		compareStrings(p.AdvertiseTags, p2.AdvertiseTags) &&
 		compareStrings(p.AdvertiseServices, p2.AdvertiseServices) &&
+		p.RouteJustification == p2.RouteJustification &&
 		p.Persist.Equals(p2.Persist) &&
 		p.ProfileName == p2.ProfileName &&
 		p.AutoUpdate.Equals(p2.AutoUpdate) &&
 		p.AppConnector == p2.AppConnector &&
 		p.PostureChecking == p2.PostureChecking &&
+		slices.Equal(p.KeepaliveIntervals, p2.KeepaliveIntervals) &&
+		p.EphemeralIdleTimeout == p2.EphemeralIdleTimeout &&
+		p.LANDNSResponder == p2.LANDNSResponder &&
+		p.CertIssuer == p2.CertIssuer &&
 		slices.EqualFunc(p.DriveShares, p2.DriveShares, drive.SharesEqual) &&
 		p.NetfilterKind == p2.NetfilterKind
 }
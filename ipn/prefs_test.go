@@ -40,11 +40,14 @@ func TestPrefsEqual(t *testing.T) {
 		"RouteAll",
 		"ExitNodeID",
 		"ExitNodeIP",
+		"AutoExitNode",
 		"InternalExitNodePrior",
 		"ExitNodeAllowLANAccess",
+		"ExitNodeFailClosed",
 		"CorpDNS",
 		"RunSSH",
 		"RunWebClient",
+		"RunMetricsServer",
 		"WantRunning",
 		"LoggedOut",
 		"ShieldsUp",
@@ -55,6 +58,7 @@ func TestPrefsEqual(t *testing.T) {
 		"Egg",
 		"AdvertiseRoutes",
 		"AdvertiseServices",
+		"RouteJustification",
 		"NoSNAT",
 		"NoStatefulFiltering",
 		"NetfilterMode",
@@ -63,6 +67,10 @@ func TestPrefsEqual(t *testing.T) {
 		"AutoUpdate",
 		"AppConnector",
 		"PostureChecking",
+		"KeepaliveIntervals",
+		"EphemeralIdleTimeout",
+		"LANDNSResponder",
+		"CertIssuer",
 		"NetfilterKind",
 		"DriveShares",
 		"AllowSingleHosts",
@@ -146,6 +154,17 @@ func TestPrefsEqual(t *testing.T) {
 			true,
 		},
 
+		{
+			&Prefs{},
+			&Prefs{AutoExitNode: AnyExitNode},
+			false,
+		},
+		{
+			&Prefs{AutoExitNode: AnyExitNode},
+			&Prefs{AutoExitNode: AnyExitNode},
+			true,
+		},
+
 		{
 			&Prefs{},
 			&Prefs{ExitNodeAllowLANAccess: true},
@@ -157,6 +176,17 @@ func TestPrefsEqual(t *testing.T) {
 			true,
 		},
 
+		{
+			&Prefs{},
+			&Prefs{ExitNodeFailClosed: true},
+			false,
+		},
+		{
+			&Prefs{ExitNodeFailClosed: true},
+			&Prefs{ExitNodeFailClosed: true},
+			true,
+		},
+
 		{
 			&Prefs{CorpDNS: true},
 			&Prefs{CorpDNS: false},
@@ -505,6 +535,29 @@ func TestPrefsPretty(t *testing.T) {
 			"linux",
 			`Prefs{ra=false dns=false want=false exit=myNodeABC lan=true routes=[] nf=off update=off Persist=nil}`,
 		},
+		{
+			Prefs{
+				ExitNodeID:         tailcfg.StableNodeID("myNodeABC"),
+				ExitNodeFailClosed: true,
+			},
+			"linux",
+			`Prefs{ra=false dns=false want=false exit=myNodeABC lan=false failclosed=true routes=[] nf=off update=off Persist=nil}`,
+		},
+		{
+			Prefs{
+				ExitNodeID:   tailcfg.StableNodeID("myNodeABC"),
+				AutoExitNode: "country=SE",
+			},
+			"linux",
+			`Prefs{ra=false dns=false want=false exit=myNodeABC lan=false autoexit=country=SE routes=[] nf=off update=off Persist=nil}`,
+		},
+		{
+			Prefs{
+				ExitNodeFailClosed: true,
+			},
+			"linux",
+			`Prefs{ra=false dns=false want=false routes=[] nf=off update=off Persist=nil}`,
+		},
 		{
 			Prefs{
 				ExitNodeAllowLANAccess: true,
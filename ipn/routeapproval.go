@@ -0,0 +1,32 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import "net/netip"
+
+// RouteDecisionsKey returns the StateKey that stores the RouteDecisions of
+// the profile with the given ID.
+func RouteDecisionsKey(profileID ProfileID) StateKey {
+	return StateKey("_route-decisions/" + profileID)
+}
+
+// RouteDecision is the decision of an external approval agent, such as an
+// integration with a change-management system, about a route advertised by
+// this node.
+//
+// Decisions are reported to control servers that delegate the approval of
+// advertised routes to such an agent, along with Prefs.RouteJustification,
+// via the c2n GET /routes/approvals handler. Rejecting a route also stops
+// advertising it; accepting a route has no effect locally.
+type RouteDecision struct {
+	// Route is the advertised route that the decision is about.
+	Route netip.Prefix
+
+	// Accept is whether the route was accepted, rather than rejected.
+	Accept bool
+
+	// Reason is optional, opaque metadata explaining the decision, such
+	// as the ID of the approved change.
+	Reason string `json:",omitempty"`
+}
@@ -100,6 +100,15 @@ type StateStoreDialerSetter interface {
 	SetDialer(d func(ctx context.Context, network, address string) (net.Conn, error))
 }
 
+// StateStoreRecoverer is an optional interface that StateStores can implement
+// to report that their state was corrupt when they were opened and was
+// recovered from a backup.
+type StateStoreRecoverer interface {
+	// RecoveredState returns the error that made the store use its backup,
+	// or nil if the state was not recovered.
+	RecoveredState() error
+}
+
 // ReadStoreInt reads an integer from a StateStore.
 func ReadStoreInt(store StateStore, id StateKey) (int64, error) {
 	v, err := store.ReadState(id)
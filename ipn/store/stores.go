@@ -7,6 +7,7 @@
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -107,11 +108,17 @@ func TryWindowsAppDataMigration(logf logger.Logf, path string) string {
 }
 
 // FileStore is a StateStore that uses a JSON file for persistence.
+//
+// Before each write, it saves the previous contents of the file as a backup
+// generation next to it, from which it recovers if the file is later found
+// corrupt, such as after power loss on storage that doesn't honor fsync.
 type FileStore struct {
 	path string
 
-	mu    sync.RWMutex
-	cache map[ipn.StateKey][]byte
+	mu        sync.RWMutex
+	cache     map[ipn.StateKey][]byte
+	written   []byte // last contents of path known to be good, or nil
+	recovered error  // non-nil if cache was restored from the backup
 }
 
 // Path returns the path that NewFileStore was called with.
@@ -119,46 +126,90 @@ func (s *FileStore) Path() string { return s.path }
 
 func (s *FileStore) String() string { return fmt.Sprintf("FileStore(%q)", s.path) }
 
+// backupPath returns the path of the backup generation of the state file at
+// path.
+func backupPath(path string) string { return path + ".bak" }
+
+var errEmptyStateFile = errors.New("state file is empty")
+
 // NewFileStore returns a new file store that persists to path.
+//
+// If the file at path is corrupt and its backup is not, the state is
+// recovered from the backup, the corrupt file is kept with a ".corrupt"
+// suffix, and RecoveredState reports what happened.
 func NewFileStore(logf logger.Logf, path string) (ipn.StateStore, error) {
 	// We unconditionally call this to ensure that our perms are correct
 	if err := paths.MkStateDir(filepath.Dir(path)); err != nil {
 		return nil, fmt.Errorf("creating state directory: %w", err)
 	}
 
+	ret := &FileStore{
+		path:  path,
+		cache: map[ipn.StateKey][]byte{},
+	}
 	bs, err := os.ReadFile(path)
-
-	// Treat an empty file as a missing file.
-	// (https://github.com/tailscale/tailscale/issues/895#issuecomment-723255589)
-	if err == nil && len(bs) == 0 {
-		logf("store.NewFileStore(%q): file empty; treating it like a missing file [warning]", path)
-		err = os.ErrNotExist
+	if err == nil {
+		err = ret.load(bs)
+	}
+	if err == nil {
+		ret.written = bs
+		return ret, nil
+	}
+	if os.IsNotExist(err) {
+		// No state yet, or it was deliberately deleted to start over,
+		// in which case neither should the backup be used.
+		os.Remove(backupPath(path))
+		return ret, ret.writeInitial()
+	}
+	if logf == nil {
+		logf = logger.Discard
 	}
 
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Write out an initial file, to verify that we can write
-			// to the path.
-			if err = atomicfile.WriteFile(path, []byte("{}"), 0600); err != nil {
-				return nil, err
-			}
-			return &FileStore{
-				path:  path,
-				cache: map[ipn.StateKey][]byte{},
-			}, nil
+	// The state file is corrupt. Try the previous generation.
+	if bak, berr := os.ReadFile(backupPath(path)); berr == nil && ret.load(bak) == nil {
+		logf("store.NewFileStore(%q): %v; recovering state from backup [warning]", path, err)
+		if err := os.Rename(path, path+".corrupt"); err != nil {
+			logf("store.NewFileStore(%q): keeping corrupt state file: %v", path, err)
+		}
+		if err := writeFileDurable(path, bak); err != nil {
+			return nil, err
 		}
-		return nil, err
+		ret.written = bak
+		ret.recovered = fmt.Errorf("%s: %w", path, err)
+		return ret, nil
 	}
+	if err == errEmptyStateFile {
+		// Treat an empty file as a missing file.
+		// (https://github.com/tailscale/tailscale/issues/895#issuecomment-723255589)
+		logf("store.NewFileStore(%q): file empty; treating it like a missing file [warning]", path)
+		return ret, ret.writeInitial()
+	}
+	return nil, err
+}
 
-	ret := &FileStore{
-		path:  path,
-		cache: map[ipn.StateKey][]byte{},
+// load replaces s.cache with the state in bs, the contents of a state file.
+func (s *FileStore) load(bs []byte) error {
+	if len(bs) == 0 {
+		return errEmptyStateFile
 	}
-	if err := json.Unmarshal(bs, &ret.cache); err != nil {
-		return nil, err
+	cache := map[ipn.StateKey][]byte{}
+	if err := json.Unmarshal(bs, &cache); err != nil {
+		return err
 	}
+	s.cache = cache
+	return nil
+}
 
-	return ret, nil
+// writeInitial writes out an initial, empty state file, to verify that we can
+// write to the path.
+func (s *FileStore) writeInitial() error {
+	s.written = []byte("{}")
+	return writeFileDurable(s.path, s.written)
+}
+
+// RecoveredState implements the ipn.StateStoreRecoverer interface.
+func (s *FileStore) RecoveredState() error {
+	return s.recovered
 }
 
 // ReadState implements the StateStore interface.
@@ -184,5 +235,32 @@ func (s *FileStore) WriteState(id ipn.StateKey, bs []byte) error {
 	if err != nil {
 		return err
 	}
-	return atomicfile.WriteFile(s.path, bs, 0600)
+	if s.written != nil {
+		if err := writeFileDurable(backupPath(s.path), s.written); err != nil {
+			return fmt.Errorf("writing state backup: %w", err)
+		}
+	}
+	if err := writeFileDurable(s.path, bs); err != nil {
+		return err
+	}
+	s.written = bs
+	return nil
+}
+
+// writeFileDurable atomically replaces the file at path with data and, where
+// supported, syncs the directory so that the replacement survives a crash.
+func writeFileDurable(path string, data []byte) error {
+	if err := atomicfile.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		// Directories can't be opened for syncing on Windows.
+		return nil
+	}
+	// Best effort: some filesystems don't support syncing directories.
+	if d, err := os.Open(filepath.Dir(path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
 }
@@ -4,6 +4,7 @@
 package store
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -177,3 +178,82 @@ func TestFileStore(t *testing.T) {
 		}
 	}
 }
+
+func TestFileStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tailscaled.state")
+
+	store, err := NewFileStore(t.Logf, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"gen1", "gen2"} {
+		if err := store.WriteState("key", []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := func(store ipn.StateStore) string {
+		t.Helper()
+		bs, err := store.ReadState("key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(bs)
+	}
+	recovered := func(store ipn.StateStore) error {
+		return store.(ipn.StateStoreRecoverer).RecoveredState()
+	}
+
+	// An intact state file is used as is.
+	store, err = NewFileStore(t.Logf, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(store); got != "gen2" || recovered(store) != nil {
+		t.Fatalf("intact file: got %q, recovered %v; want gen2 and not recovered", got, recovered(store))
+	}
+
+	// A corrupt state file is replaced by the previous generation.
+	for _, corrupt := range []string{`{"key": "Z2Vu`, ""} {
+		if err := os.WriteFile(path, []byte(corrupt), 0600); err != nil {
+			t.Fatal(err)
+		}
+		store, err = NewFileStore(t.Logf, path)
+		if err != nil {
+			t.Fatalf("corrupt file %q: %v", corrupt, err)
+		}
+		if got := read(store); got != "gen1" || recovered(store) == nil {
+			t.Fatalf("corrupt file %q: got %q, recovered %v; want gen1 and recovered", corrupt, got, recovered(store))
+		}
+		if bs, err := os.ReadFile(path + ".corrupt"); err != nil || string(bs) != corrupt {
+			t.Errorf("corrupt file %q was not kept: %q, %v", corrupt, bs, err)
+		}
+		if _, err := NewFileStore(t.Logf, path); err != nil {
+			t.Fatalf("recovered file is not valid: %v", err)
+		}
+	}
+
+	// Deleting the state file starts over rather than using the backup.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	store, err = NewFileStore(t.Logf, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ReadState("key"); err != ipn.ErrStateNotExist {
+		t.Errorf("after deleting state: ReadState = %v, want ErrStateNotExist", err)
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("backup of deleted state still exists: %v", err)
+	}
+
+	// Without a valid backup, a corrupt state file is an error.
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(t.Logf, path); err == nil {
+		t.Error("corrupt file without backup: got no error")
+	}
+}
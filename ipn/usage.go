@@ -0,0 +1,108 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ipn
+
+import (
+	"cmp"
+	"slices"
+
+	"tailscale.com/tailcfg"
+)
+
+// UsageKey returns the StateKey that stores the UsageStats of the profile
+// with the given ID.
+func UsageKey(profileID ProfileID) StateKey {
+	return StateKey("_usage/" + profileID)
+}
+
+// UsageMonthFormat is the time layout of MonthUsage.Month.
+const UsageMonthFormat = "2006-01"
+
+// ByteCounts are numbers of bytes received and sent.
+type ByteCounts struct {
+	RxBytes uint64
+	TxBytes uint64
+}
+
+// Add returns the sum of c and o.
+func (c ByteCounts) Add(o ByteCounts) ByteCounts {
+	return ByteCounts{RxBytes: c.RxBytes + o.RxBytes, TxBytes: c.TxBytes + o.TxBytes}
+}
+
+// Total returns the number of bytes received and sent.
+func (c ByteCounts) Total() uint64 {
+	return c.RxBytes + c.TxBytes
+}
+
+// UsageStats is the bandwidth usage of a profile, as returned by the
+// LocalAPI usage endpoint. It counts the bytes of WireGuard packets
+// exchanged with peers, including their overhead.
+type UsageStats struct {
+	// Months are the usage of the most recent calendar months, in local
+	// time, with the current month first. Months without usage are
+	// omitted.
+	Months []*MonthUsage
+}
+
+// MonthUsage is the bandwidth usage of a profile in one calendar month.
+type MonthUsage struct {
+	// Month is the month, formatted with UsageMonthFormat.
+	Month string
+
+	// Total is the usage with all peers.
+	Total ByteCounts
+
+	// ExitNode is the usage with the exit node in use at the time, if any.
+	ExitNode ByteCounts
+
+	// SubnetRoutes is the usage with other peers that were subnet routers
+	// while routes were accepted.
+	SubnetRoutes ByteCounts
+
+	// Direct and DERP are the usage with peers while the traffic to them
+	// was sent directly and through DERP relays, respectively.
+	Direct ByteCounts
+	DERP   ByteCounts
+
+	// Peers is the usage per peer. Once there are many, those of peers
+	// that are no longer in the netmap may be dropped.
+	Peers map[tailcfg.StableNodeID]*PeerUsage
+}
+
+// PeerUsage is the bandwidth usage with a peer.
+type PeerUsage struct {
+	// Name is the MagicDNS name of the peer, as of when it was last used.
+	Name string
+
+	ByteCounts
+}
+
+// Month returns the usage of month, formatted with UsageMonthFormat, adding
+// it if missing and dropping the oldest months beyond keep.
+func (s *UsageStats) Month(month string, keep int) *MonthUsage {
+	for _, m := range s.Months {
+		if m.Month == month {
+			return m
+		}
+	}
+	m := &MonthUsage{Month: month, Peers: map[tailcfg.StableNodeID]*PeerUsage{}}
+	s.Months = append(s.Months, m)
+	slices.SortFunc(s.Months, func(a, b *MonthUsage) int { return cmp.Compare(b.Month, a.Month) })
+	if len(s.Months) > keep {
+		s.Months = s.Months[:keep]
+	}
+	return m
+}
+
+// SortedPeers returns the peers of m with the highest usage first.
+func (m *MonthUsage) SortedPeers() []tailcfg.StableNodeID {
+	ids := make([]tailcfg.StableNodeID, 0, len(m.Peers))
+	for id := range m.Peers {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b tailcfg.StableNodeID) int {
+		return cmp.Or(cmp.Compare(m.Peers[b].Total(), m.Peers[a].Total()), cmp.Compare(a, b))
+	})
+	return ids
+}
@@ -0,0 +1,603 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+// Package apiproxy implements the Kubernetes API server proxy, which
+// authenticates requests from the tailnet using the Tailscale LocalAPI and
+// then proxies them to the Kubernetes API, impersonating the caller. It's run
+// by the Tailscale Kubernetes Operator and by the standalone cmd/k8s-proxy.
+package apiproxy
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+	"tailscale.com/client/tailscale"
+	"tailscale.com/client/tailscale/apitype"
+	ksr "tailscale.com/k8s-operator/sessionrecording"
+	"tailscale.com/kube/kubetypes"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tsnet"
+	"tailscale.com/tsweb/tracing"
+	"tailscale.com/util/clientmetric"
+	"tailscale.com/util/ctxkey"
+	"tailscale.com/util/set"
+)
+
+var (
+	// counterNumRequestsproxies counts the number of API server requests proxied via this proxy.
+	counterNumRequestsProxied = clientmetric.NewCounter("k8s_auth_proxy_requests_proxied")
+	// counterNumRequestsMisdirected counts the number of requests whose TLS
+	// server name didn't route to any cluster.
+	counterNumRequestsMisdirected = clientmetric.NewCounter("k8s_auth_proxy_requests_misdirected")
+	whoIsKey                      = ctxkey.New("", (*apitype.WhoIsResponse)(nil))
+)
+
+// Mode is the mode of an API server proxy.
+type Mode int
+
+func (a Mode) String() string {
+	switch a {
+	case ModeDisabled:
+		return "disabled"
+	case ModeEnabled:
+		return "auth"
+	case ModeNoAuth:
+		return "noauth"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// ModeDisabled is that the proxy is not started.
+	ModeDisabled Mode = iota
+	// ModeEnabled is that requests are impersonated using the caller's
+	// identity from the Tailscale LocalAPI.
+	ModeEnabled
+	// ModeNoAuth is that requests are not impersonated and are passed
+	// through to the Kubernetes API.
+	ModeNoAuth
+)
+
+// Cluster is a Kubernetes cluster whose API server requests are proxied to.
+type Cluster struct {
+	// Name is the name of the cluster, as used in logs.
+	Name string
+	// ServerNames are the TLS server names of requests routed to the
+	// cluster. At most one Cluster passed to Run may have none; it receives
+	// requests not routed to any other cluster.
+	ServerNames []string
+	// RestConfig is the configuration used to reach the API server.
+	RestConfig *rest.Config
+	// Cert, if non-nil, is the certificate served for ServerNames instead
+	// of the Tailscale HTTPS certificate.
+	Cert *tls.Certificate
+	// Impersonation are the rules mapping tailnet identities to Kubernetes
+	// users and groups, in addition to capability grants.
+	Impersonation []kubetypes.ImpersonationMapping
+	// AuditAnnotations is whether to add the caller's tailnet identity to
+	// the impersonated user's extra fields and tag requests with an
+	// Audit-ID.
+	AuditAnnotations bool
+}
+
+// MaybeLaunchAPIServerProxy launches the auth proxy, which is a small HTTP server
+// that authenticates requests using the Tailscale LocalAPI and then proxies
+// them to the kube-apiserver.
+func MaybeLaunchAPIServerProxy(zlog *zap.SugaredLogger, restConfig *rest.Config, s *tsnet.Server, mode Mode) {
+	if mode == ModeDisabled {
+		return
+	}
+	log := zlog.Named("apiserver-proxy")
+	go func() {
+		if err := Run(s, log, mode, []Cluster{{Name: "default", RestConfig: restConfig}}); err != nil {
+			log.Fatalf("runAPIServerProxy: %v", err)
+		}
+	}()
+}
+
+// Run runs an HTTP server that authenticates requests using the Tailscale
+// LocalAPI and then proxies them to the Kubernetes API of one of clusters,
+// chosen by the TLS server name of the request.
+// It listens on :443 and uses the Tailscale HTTPS certificate, unless a
+// cluster has its own.
+// ts will be started if it is not already running.
+//
+// It only returns on error.
+func Run(ts *tsnet.Server, log *zap.SugaredLogger, mode Mode, clusters []Cluster) error {
+	if mode == ModeDisabled {
+		return nil
+	}
+	lc, err := ts.LocalClient()
+	if err != nil {
+		return fmt.Errorf("could not get local client: %w", err)
+	}
+	ap, err := newAPIServerProxy(log, lc, ts, mode, clusters)
+	if err != nil {
+		return err
+	}
+	ln, err := ts.Listen("tcp", ":443")
+	if err != nil {
+		return fmt.Errorf("could not listen on :443: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", ap.serveDefault)
+	mux.HandleFunc("POST /api/v1/namespaces/{namespace}/pods/{pod}/exec", ap.serveExecSPDY)
+	mux.HandleFunc("GET /api/v1/namespaces/{namespace}/pods/{pod}/exec", ap.serveExecWS)
+
+	hs := &http.Server{
+		// Kubernetes uses SPDY for exec and port-forward, however SPDY is
+		// incompatible with HTTP/2; so disable HTTP/2 in the proxy.
+		TLSConfig: &tls.Config{
+			GetCertificate: ap.getCertificate,
+			NextProtos:     []string{"http/1.1"},
+		},
+		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
+		Handler: tracing.Handler(mux, func(r *http.Request) string {
+			return "apiserver-proxy " + r.Method
+		}),
+	}
+	log.Infof("API server proxy in %q mode for %d cluster(s) is listening on %s", mode, len(clusters), ln.Addr())
+	if err := hs.ServeTLS(ln, "", ""); err != nil {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	return nil
+}
+
+// apiserverProxy is an [net/http.Handler] that authenticates requests using the Tailscale
+// LocalAPI and then proxies them to the Kubernetes API.
+type apiserverProxy struct {
+	log *zap.SugaredLogger
+	lc  *tailscale.LocalClient
+
+	mode Mode
+	ts   *tsnet.Server
+
+	bySNI map[string]*upstream // keyed by lowercase server name
+	def   *upstream            // or nil if every cluster has server names
+}
+
+// upstream is the API server of a Cluster.
+type upstream struct {
+	Cluster
+	url *url.URL
+	rp  *httputil.ReverseProxy
+}
+
+// newAPIServerProxy returns an apiserverProxy for clusters, checking that the
+// routing of server names to them is unambiguous.
+func newAPIServerProxy(log *zap.SugaredLogger, lc *tailscale.LocalClient, ts *tsnet.Server, mode Mode, clusters []Cluster) (*apiserverProxy, error) {
+	if len(clusters) == 0 {
+		return nil, errors.New("no clusters to proxy to")
+	}
+	ap := &apiserverProxy{
+		log:   log,
+		lc:    lc,
+		mode:  mode,
+		ts:    ts,
+		bySNI: make(map[string]*upstream),
+	}
+	for _, c := range clusters {
+		u, err := ap.newUpstream(c)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %q: %w", c.Name, err)
+		}
+		if len(c.ServerNames) == 0 {
+			if ap.def != nil {
+				return nil, fmt.Errorf("clusters %q and %q both have no server names", ap.def.Name, c.Name)
+			}
+			ap.def = u
+			continue
+		}
+		for _, name := range c.ServerNames {
+			name = normalizeServerName(name)
+			if other, ok := ap.bySNI[name]; ok {
+				return nil, fmt.Errorf("server name %q is used by clusters %q and %q", name, other.Name, c.Name)
+			}
+			ap.bySNI[name] = u
+		}
+	}
+	return ap, nil
+}
+
+// newUpstream returns the upstream of c, whose requests are rewritten
+// according to ap's mode.
+func (ap *apiserverProxy) newUpstream(c Cluster) (*upstream, error) {
+	if c.RestConfig == nil {
+		return nil, errors.New("no rest config")
+	}
+	u, err := url.Parse(c.RestConfig.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL %w", err)
+	}
+	restConfig := c.RestConfig
+	if ap.mode == ModeNoAuth {
+		restConfig = rest.AnonymousClientConfig(restConfig)
+	}
+	cfg, err := restConfig.TransportConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not get rest.TransportConfig(): %w", err)
+	}
+
+	// Kubernetes uses SPDY for exec and port-forward, however SPDY is
+	// incompatible with HTTP/2; so disable HTTP/2 in the proxy.
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig, err = transport.TLSConfigFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not get transport.TLSConfigFor(): %w", err)
+	}
+	tr.TLSNextProto = make(map[string]func(authority string, c *tls.Conn) http.RoundTripper)
+
+	rt, err := transport.HTTPWrappersForConfig(cfg, tr)
+	if err != nil {
+		return nil, fmt.Errorf("could not get transport.HTTPWrappersForConfig(): %w", err)
+	}
+	up := &upstream{Cluster: c, url: u}
+	up.rp = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			ap.addImpersonationHeadersAsRequired(up, pr.Out)
+		},
+		Transport: tracing.Transport(rt),
+	}
+	return up, nil
+}
+
+func normalizeServerName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// upstreamFor returns the upstream that r is routed to by its TLS server
+// name, or nil if none.
+func (ap *apiserverProxy) upstreamFor(r *http.Request) *upstream {
+	if r.TLS != nil && r.TLS.ServerName != "" {
+		if u, ok := ap.bySNI[normalizeServerName(r.TLS.ServerName)]; ok {
+			return u
+		}
+	}
+	return ap.def
+}
+
+// getCertificate returns the certificate of the cluster that hi's server
+// name routes to, or the Tailscale HTTPS certificate if it has none.
+func (ap *apiserverProxy) getCertificate(hi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if u, ok := ap.bySNI[normalizeServerName(hi.ServerName)]; ok && u.Cert != nil {
+		return u.Cert, nil
+	}
+	return ap.lc.GetCertificate(hi)
+}
+
+// route returns the upstream that r is routed to and the identity of its
+// caller. If there's no upstream or the caller can't be identified, it writes
+// the error to w and reports false.
+func (ap *apiserverProxy) route(w http.ResponseWriter, r *http.Request) (*upstream, *apitype.WhoIsResponse, bool) {
+	u := ap.upstreamFor(r)
+	if u == nil {
+		counterNumRequestsMisdirected.Add(1)
+		http.Error(w, "no cluster for this server name", http.StatusMisdirectedRequest)
+		return nil, nil, false
+	}
+	who, err := ap.whoIs(r)
+	if err != nil {
+		ap.authError(w, err)
+		return nil, nil, false
+	}
+	counterNumRequestsProxied.Add(1)
+	return u, who, true
+}
+
+// serveDefault is the default handler for Kubernetes API server requests.
+func (ap *apiserverProxy) serveDefault(w http.ResponseWriter, r *http.Request) {
+	u, who, ok := ap.route(w, r)
+	if !ok {
+		return
+	}
+	u.rp.ServeHTTP(w, r.WithContext(whoIsKey.WithValue(r.Context(), who)))
+}
+
+// serveExecSPDY serves 'kubectl exec' requests for sessions streamed over SPDY,
+// optionally configuring the kubectl exec sessions to be recorded.
+func (ap *apiserverProxy) serveExecSPDY(w http.ResponseWriter, r *http.Request) {
+	ap.execForProto(w, r, ksr.SPDYProtocol)
+}
+
+// serveExecWS serves 'kubectl exec' requests for sessions streamed over WebSocket,
+// optionally configuring the kubectl exec sessions to be recorded.
+func (ap *apiserverProxy) serveExecWS(w http.ResponseWriter, r *http.Request) {
+	ap.execForProto(w, r, ksr.WSProtocol)
+}
+
+func (ap *apiserverProxy) execForProto(w http.ResponseWriter, r *http.Request, proto ksr.Protocol) {
+	const (
+		podNameKey       = "pod"
+		namespaceNameKey = "namespace"
+		upgradeHeaderKey = "Upgrade"
+	)
+
+	u, who, ok := ap.route(w, r)
+	if !ok {
+		return
+	}
+	failOpen, addrs, err := determineRecorderConfig(who)
+	if err != nil {
+		ap.log.Errorf("error trying to determine whether the 'kubectl exec' session needs to be recorded: %v", err)
+		return
+	}
+	if failOpen && len(addrs) == 0 { // will not record
+		u.rp.ServeHTTP(w, r.WithContext(whoIsKey.WithValue(r.Context(), who)))
+		return
+	}
+	ksr.CounterSessionRecordingsAttempted.Add(1) // at this point we know that users intended for this session to be recorded
+	if !failOpen && len(addrs) == 0 {
+		msg := "forbidden: 'kubectl exec' session must be recorded, but no recorders are available."
+		ap.log.Error(msg)
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+
+	wantsHeader := upgradeHeaderForProto[proto]
+	if h := r.Header.Get(upgradeHeaderKey); h != wantsHeader {
+		msg := fmt.Sprintf("[unexpected] unable to verify that streaming protocol is %s, wants Upgrade header %q, got: %q", proto, wantsHeader, h)
+		if failOpen {
+			msg = msg + "; failure mode is 'fail open'; continuing session without recording."
+			ap.log.Warn(msg)
+			u.rp.ServeHTTP(w, r.WithContext(whoIsKey.WithValue(r.Context(), who)))
+			return
+		}
+		ap.log.Error(msg)
+		msg += "; failure mode is 'fail closed'; closing connection."
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+
+	opts := ksr.HijackerOpts{
+		Req:       r,
+		W:         w,
+		Proto:     proto,
+		TS:        ap.ts,
+		Who:       who,
+		Addrs:     addrs,
+		FailOpen:  failOpen,
+		Pod:       r.PathValue(podNameKey),
+		Namespace: r.PathValue(namespaceNameKey),
+		Log:       ap.log,
+	}
+	h := ksr.New(opts)
+
+	u.rp.ServeHTTP(h, r.WithContext(whoIsKey.WithValue(r.Context(), who)))
+}
+
+func (h *apiserverProxy) addImpersonationHeadersAsRequired(u *upstream, r *http.Request) {
+	r.URL.Scheme = u.url.Scheme
+	r.URL.Host = u.url.Host
+	if h.mode == ModeNoAuth {
+		// If we are not providing authentication, then we are just
+		// proxying to the Kubernetes API, so we don't need to do
+		// anything else.
+		return
+	}
+
+	// We want to proxy to the Kubernetes API, but we want to use
+	// the caller's identity to do so. We do this by impersonating
+	// the caller using the Kubernetes User Impersonation feature:
+	// https://kubernetes.io/docs/reference/access-authn-authz/authentication/#user-impersonation
+
+	// Out of paranoia, remove all authentication headers that might
+	// have been set by the client.
+	r.Header.Del("Authorization")
+	r.Header.Del("Impersonate-Group")
+	r.Header.Del("Impersonate-User")
+	r.Header.Del("Impersonate-Uid")
+	for k := range r.Header {
+		if strings.HasPrefix(k, "Impersonate-Extra-") {
+			r.Header.Del(k)
+		}
+	}
+
+	// Now add the impersonation headers that we want.
+	log := h.log.With("cluster", u.Name)
+	if err := addImpersonationHeaders(r, u.Impersonation, log); err != nil {
+		log.Errorf("failed to add impersonation headers: %v", err)
+	}
+	if u.AuditAnnotations {
+		auditID := addAuditHeaders(r)
+		log.Infow("proxying request", "method", r.Method, "path", r.URL.Path,
+			"user", r.Header.Get("Impersonate-User"), "auditID", auditID)
+	}
+}
+
+func (ap *apiserverProxy) whoIs(r *http.Request) (*apitype.WhoIsResponse, error) {
+	return ap.lc.WhoIs(r.Context(), r.RemoteAddr)
+}
+
+func (ap *apiserverProxy) authError(w http.ResponseWriter, err error) {
+	ap.log.Errorf("failed to authenticate caller: %v", err)
+	http.Error(w, "failed to authenticate caller", http.StatusInternalServerError)
+}
+
+const (
+	// oldCapabilityName is a legacy form of
+	// tailfcg.PeerCapabilityKubernetes capability. The only capability rule
+	// that is respected for this form is group impersonation - for
+	// backwards compatibility reasons.
+	// TODO (irbekrm): determine if anyone uses this and remove if possible.
+	oldCapabilityName = "https://" + tailcfg.PeerCapabilityKubernetes
+)
+
+// addImpersonationHeaders adds the appropriate headers to r to impersonate the
+// caller when proxying to the Kubernetes API. It uses the WhoIsResponse stashed
+// in the context by the apiserverProxy, and applies the mappings whose Src
+// matches the caller after the capability grants.
+func addImpersonationHeaders(r *http.Request, mappings []kubetypes.ImpersonationMapping, log *zap.SugaredLogger) error {
+	log = log.With("remote", r.RemoteAddr)
+	who := whoIsKey.Value(r.Context())
+	rules, err := tailcfg.UnmarshalCapJSON[kubetypes.KubernetesCapRule](who.CapMap, tailcfg.PeerCapabilityKubernetes)
+	if len(rules) == 0 && err == nil {
+		// Try the old capability name for backwards compatibility.
+		rules, err = tailcfg.UnmarshalCapJSON[kubetypes.KubernetesCapRule](who.CapMap, oldCapabilityName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal capability: %v", err)
+	}
+
+	var groupsAdded set.Slice[string]
+	addGroup := func(group, why string) {
+		if groupsAdded.Contains(group) {
+			return
+		}
+		r.Header.Add("Impersonate-Group", group)
+		groupsAdded.Add(group)
+		log.Debugf("adding group impersonation header for %s %s", why, group)
+	}
+	for _, rule := range rules {
+		if rule.Impersonate == nil {
+			continue
+		}
+		for _, group := range rule.Impersonate.Groups {
+			addGroup(group, "user group")
+		}
+	}
+	var user string
+	for _, m := range mappings {
+		if !mappingMatches(m, who) {
+			continue
+		}
+		for _, group := range m.Groups {
+			addGroup(group, "mapped group")
+		}
+		if user == "" {
+			user = m.User
+		}
+	}
+	if user != "" {
+		r.Header.Set("Impersonate-User", user)
+		log.Debugf("adding user impersonation header for mapped user %s", user)
+		return nil
+	}
+
+	if !who.Node.IsTagged() {
+		r.Header.Set("Impersonate-User", who.UserProfile.LoginName)
+		log.Debugf("adding user impersonation header for user %s", who.UserProfile.LoginName)
+		return nil
+	}
+	// "Impersonate-Group" requires "Impersonate-User" to be set, so we set it
+	// to the node FQDN for tagged nodes.
+	nodeName := strings.TrimSuffix(who.Node.Name, ".")
+	r.Header.Set("Impersonate-User", nodeName)
+	log.Debugf("adding user impersonation header for node name %s", nodeName)
+
+	// For legacy behavior (before caps), set the groups to the nodes tags.
+	if groupsAdded.Slice().Len() == 0 {
+		for _, tag := range who.Node.Tags {
+			r.Header.Add("Impersonate-Group", tag)
+			log.Debugf("adding group impersonation header for node tag %s", tag)
+		}
+	}
+	return nil
+}
+
+// mappingMatches reports whether m applies to the caller who.
+func mappingMatches(m kubetypes.ImpersonationMapping, who *apitype.WhoIsResponse) bool {
+	for _, src := range m.Src {
+		switch {
+		case src == "*":
+			return true
+		case strings.HasPrefix(src, "tag:"):
+			if who.Node.IsTagged() && slices.Contains(who.Node.Tags, src) {
+				return true
+			}
+		case !who.Node.IsTagged() && who.UserProfile != nil && strings.EqualFold(src, who.UserProfile.LoginName):
+			return true
+		}
+	}
+	return false
+}
+
+// Keys of the impersonated user's extra fields set by addAuditHeaders.
+const (
+	extraNodeName  = "tailscale.com/node-name"
+	extraNodeID    = "tailscale.com/node-id"
+	extraLoginName = "tailscale.com/login-name"
+	extraTags      = "tailscale.com/tags"
+	extraTailnetIP = "tailscale.com/tailnet-ip"
+)
+
+// addAuditHeaders adds the caller's tailnet identity to r as extra fields of
+// the impersonated user, and sets r's Audit-ID to a new random ID, which it
+// returns. Both end up in the API server's audit log.
+func addAuditHeaders(r *http.Request) (auditID string) {
+	who := whoIsKey.Value(r.Context())
+	addExtra := func(key, val string) {
+		// Extra keys are percent-encoded in header names.
+		r.Header.Add("Impersonate-Extra-"+url.PathEscape(key), val)
+	}
+	addExtra(extraNodeName, strings.TrimSuffix(who.Node.Name, "."))
+	addExtra(extraNodeID, string(who.Node.StableID))
+	if who.Node.IsTagged() {
+		for _, tag := range who.Node.Tags {
+			addExtra(extraTags, tag)
+		}
+	} else if who.UserProfile != nil {
+		addExtra(extraLoginName, who.UserProfile.LoginName)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		addExtra(extraTailnetIP, host)
+	}
+
+	var b [16]byte
+	rand.Read(b[:])
+	auditID = hex.EncodeToString(b[:])
+	r.Header.Set("Audit-ID", auditID)
+	return auditID
+}
+
+// determineRecorderConfig determines recorder config from requester's peer
+// capabilities. Determines whether a 'kubectl exec' session from this requester
+// needs to be recorded and what recorders the recording should be sent to.
+func determineRecorderConfig(who *apitype.WhoIsResponse) (failOpen bool, recorderAddresses []netip.AddrPort, _ error) {
+	if who == nil {
+		return false, nil, errors.New("[unexpected] cannot determine caller")
+	}
+	failOpen = true
+	rules, err := tailcfg.UnmarshalCapJSON[kubetypes.KubernetesCapRule](who.CapMap, tailcfg.PeerCapabilityKubernetes)
+	if err != nil {
+		return failOpen, nil, fmt.Errorf("failed to unmarshal Kubernetes capability: %w", err)
+	}
+	if len(rules) == 0 {
+		return failOpen, nil, nil
+	}
+
+	for _, rule := range rules {
+		if len(rule.RecorderAddrs) != 0 {
+			// TODO (irbekrm): here or later determine if the
+			// recorders behind those addrs are online - else we
+			// spend 30s trying to reach a recorder whose tailscale
+			// status is offline.
+			recorderAddresses = append(recorderAddresses, rule.RecorderAddrs...)
+		}
+		if rule.EnforceRecorder {
+			failOpen = false
+		}
+	}
+	return failOpen, recorderAddresses, nil
+}
+
+var upgradeHeaderForProto = map[ksr.Protocol]string{
+	ksr.SPDYProtocol: "SPDY/3.1",
+	ksr.WSProtocol:   "websocket",
+}
@@ -3,9 +3,10 @@
 
 //go:build !plan9
 
-package main
+package apiproxy
 
 import (
+	"crypto/tls"
 	"net/http"
 	"net/netip"
 	"reflect"
@@ -13,7 +14,9 @@
 
 	"github.com/google/go-cmp/cmp"
 	"go.uber.org/zap"
+	"k8s.io/client-go/rest"
 	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/kube/kubetypes"
 	"tailscale.com/tailcfg"
 	"tailscale.com/util/must"
 )
@@ -121,7 +124,7 @@ func TestImpersonationHeaders(t *testing.T) {
 			},
 			CapMap: tc.capMap,
 		}))
-		addImpersonationHeaders(r, zl.Sugar())
+		addImpersonationHeaders(r, nil, zl.Sugar())
 
 		if d := cmp.Diff(tc.wantHeaders, r.Header); d != "" {
 			t.Errorf("unexpected header (-want +got):\n%s", d)
@@ -197,3 +200,142 @@ func raw(in ...string) []tailcfg.RawMessage {
 	}
 	return out
 }
+
+func TestImpersonationMappings(t *testing.T) {
+	mappings := []kubetypes.ImpersonationMapping{
+		{Src: []string{"alice@example.com"}, User: "alice", Groups: []string{"admins"}},
+		{Src: []string{"tag:ci"}, User: "ci-bot"},
+		{Src: []string{"tag:ci", "bob@example.com"}, Groups: []string{"deployers"}},
+		{Src: []string{"*"}, User: "ignored", Groups: []string{"everyone"}},
+	}
+	tests := []struct {
+		name        string
+		emailish    string
+		tags        []string
+		wantHeaders http.Header
+	}{
+		{
+			name:     "mapped-user",
+			emailish: "Alice@example.com",
+			wantHeaders: http.Header{
+				"Impersonate-User":  {"alice"},
+				"Impersonate-Group": {"admins", "everyone"},
+			},
+		},
+		{
+			name:     "mapped-tag",
+			emailish: "tagged-device",
+			tags:     []string{"tag:ci"},
+			wantHeaders: http.Header{
+				"Impersonate-User":  {"ci-bot"},
+				"Impersonate-Group": {"deployers", "everyone"},
+			},
+		},
+		{
+			name:     "wildcard-user",
+			emailish: "carol@example.com",
+			wantHeaders: http.Header{
+				"Impersonate-User":  {"ignored"},
+				"Impersonate-Group": {"everyone"},
+			},
+		},
+	}
+	zl := zap.NewNop().Sugar()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := must.Get(http.NewRequest("GET", "https://op.ts.net/api/foo", nil))
+			r = r.WithContext(whoIsKey.WithValue(r.Context(), &apitype.WhoIsResponse{
+				Node:        &tailcfg.Node{Name: "node.ts.net.", Tags: tc.tags},
+				UserProfile: &tailcfg.UserProfile{LoginName: tc.emailish},
+			}))
+			if err := addImpersonationHeaders(r, mappings, zl); err != nil {
+				t.Fatal(err)
+			}
+			if d := cmp.Diff(tc.wantHeaders, r.Header); d != "" {
+				t.Errorf("unexpected header (-want +got):\n%s", d)
+			}
+		})
+	}
+
+	// Mappings that don't match leave the legacy impersonation of tagged
+	// nodes' tags as groups alone.
+	r := must.Get(http.NewRequest("GET", "https://op.ts.net/api/foo", nil))
+	r = r.WithContext(whoIsKey.WithValue(r.Context(), &apitype.WhoIsResponse{
+		Node:        &tailcfg.Node{Name: "node.ts.net.", Tags: []string{"tag:web"}},
+		UserProfile: &tailcfg.UserProfile{LoginName: "tagged-device"},
+	}))
+	addImpersonationHeaders(r, mappings[2:3:3], zl)
+	if d := cmp.Diff(http.Header{"Impersonate-User": {"node.ts.net"}, "Impersonate-Group": {"tag:web"}}, r.Header); d != "" {
+		t.Errorf("unexpected header (-want +got):\n%s", d)
+	}
+}
+
+func TestAuditHeaders(t *testing.T) {
+	r := must.Get(http.NewRequest("GET", "https://op.ts.net/api/foo", nil))
+	r.RemoteAddr = "100.64.0.1:1234"
+	r = r.WithContext(whoIsKey.WithValue(r.Context(), &apitype.WhoIsResponse{
+		Node:        &tailcfg.Node{Name: "laptop.ts.net.", StableID: "nABC"},
+		UserProfile: &tailcfg.UserProfile{LoginName: "alice@example.com"},
+	}))
+	id := addAuditHeaders(r)
+	if len(id) != 32 {
+		t.Errorf("audit ID %q is not 32 hex digits", id)
+	}
+	want := http.Header{
+		"Audit-Id": {id},
+		"Impersonate-Extra-Tailscale.com%2fnode-Name":  {"laptop.ts.net"},
+		"Impersonate-Extra-Tailscale.com%2fnode-Id":    {"nABC"},
+		"Impersonate-Extra-Tailscale.com%2flogin-Name": {"alice@example.com"},
+		"Impersonate-Extra-Tailscale.com%2ftailnet-Ip": {"100.64.0.1"},
+	}
+	if d := cmp.Diff(want, r.Header); d != "" {
+		t.Errorf("unexpected header (-want +got):\n%s", d)
+	}
+}
+
+func TestClusterRouting(t *testing.T) {
+	cluster := func(name string, serverNames ...string) Cluster {
+		return Cluster{
+			Name:        name,
+			ServerNames: serverNames,
+			RestConfig:  &rest.Config{Host: "https://" + name + ".example.com"},
+		}
+	}
+	zl := zap.NewNop().Sugar()
+	ap, err := newAPIServerProxy(zl, nil, nil, ModeEnabled, []Cluster{
+		cluster("default"),
+		cluster("prod", "prod.example.com", "Prod-Alias.example.com."),
+		cluster("dev", "dev.example.com"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for serverName, want := range map[string]string{
+		"prod.example.com":       "prod",
+		"prod-alias.example.com": "prod",
+		"DEV.example.com.":       "dev",
+		"op.ts.net":              "default",
+		"":                       "default",
+	} {
+		r := must.Get(http.NewRequest("GET", "https://op.ts.net/api", nil))
+		r.TLS = &tls.ConnectionState{ServerName: serverName}
+		if u := ap.upstreamFor(r); u == nil || u.Name != want {
+			t.Errorf("upstreamFor(%q) = %v, want %q", serverName, u, want)
+		}
+	}
+
+	for _, clusters := range [][]Cluster{
+		nil,
+		{cluster("a"), cluster("b")},
+		{cluster("a", "x.example.com"), cluster("b", "X.example.com")},
+	} {
+		if _, err := newAPIServerProxy(zl, nil, nil, ModeEnabled, clusters); err == nil {
+			t.Errorf("newAPIServerProxy(%v) succeeded, want error", clusters)
+		}
+	}
+
+	ap = must.Get(newAPIServerProxy(zl, nil, nil, ModeEnabled, []Cluster{cluster("prod", "prod.example.com")}))
+	if u := ap.upstreamFor(must.Get(http.NewRequest("GET", "https://op.ts.net/api", nil))); u != nil {
+		t.Errorf("upstreamFor without a default cluster = %q, want nil", u.Name)
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package v1
+
+// The v1 types are the hub that the other served versions convert to and
+// from, see https://book.kubebuilder.io/multiversion-tutorial/conversion-concepts.
+
+// Hub marks Connector as a conversion hub.
+func (*Connector) Hub() {}
@@ -0,0 +1,12 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+// Package v1 contains the stable versions of the tailscale.com custom
+// resources. Resources that have graduated to v1 are stored in this version;
+// the older versions that are still served are converted to and from it by
+// the operator's conversion webhook.
+// +kubebuilder:object:generate=true
+// +groupName=tailscale.com
+package v1
@@ -0,0 +1,143 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+	tsapiv1 "tailscale.com/k8s-operator/apis/v1"
+)
+
+// Conversions between the v1alpha1 resources and their v1 hub versions. The
+// conversions must be lossless in both directions, so that objects written
+// with either version can be read back with the other.
+
+// ConvertTo converts this Connector to the hub version.
+func (src *Connector) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*tsapiv1.Connector)
+	if !ok {
+		return fmt.Errorf("unexpected conversion hub type %T", dstRaw)
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = tsapiv1.ConnectorSpec{
+		Tags:       convertSlice[Tag, tsapiv1.Tag](src.Spec.Tags),
+		Hostname:   tsapiv1.Hostname(src.Spec.Hostname),
+		ProxyClass: src.Spec.ProxyClass,
+		ExitNode:   src.Spec.ExitNode,
+	}
+	if sr := src.Spec.SubnetRouter; sr != nil {
+		dst.Spec.SubnetRouter = &tsapiv1.SubnetRouter{
+			AdvertiseRoutes: convertSlice[Route, tsapiv1.Route](sr.AdvertiseRoutes),
+		}
+		if cc := sr.AdvertiseClusterCIDRs; cc != nil {
+			dst.Spec.SubnetRouter.AdvertiseClusterCIDRs = &tsapiv1.ClusterCIDRs{
+				Pods:     cc.Pods,
+				Services: cc.Services,
+			}
+		}
+	}
+	if ac := src.Spec.AppConnector; ac != nil {
+		dst.Spec.AppConnector = &tsapiv1.AppConnector{
+			Routes: convertSlice[Route, tsapiv1.Route](ac.Routes),
+		}
+	}
+	dst.Status = tsapiv1.ConnectorStatus{
+		Conditions:     src.Status.DeepCopy().Conditions,
+		IsExitNode:     src.Status.IsExitNode,
+		IsAppConnector: src.Status.IsAppConnector,
+		TailnetIPs:     src.Status.DeepCopy().TailnetIPs,
+		Hostname:       src.Status.Hostname,
+	}
+	// v1alpha1 stores the advertised routes as a comma separated string,
+	// v1 as a list.
+	if src.Status.SubnetRoutes != "" {
+		for _, r := range strings.Split(src.Status.SubnetRoutes, ",") {
+			dst.Status.SubnetRoutes = append(dst.Status.SubnetRoutes, tsapiv1.Route(r))
+		}
+	}
+	if st := src.Status.Stats; st != nil {
+		dst.Status.Stats = &tsapiv1.ProxyStats{
+			LastUpdated:           *st.LastUpdated.DeepCopy(),
+			DERPHomeRegion:        st.DERPHomeRegion,
+			ActivePeers:           st.ActivePeers,
+			DirectPeers:           st.DirectPeers,
+			DirectConnectionRatio: st.DirectConnectionRatio,
+			LastNetmapUpdate:      st.LastNetmapUpdate.DeepCopy(),
+			RxBytes:               st.RxBytes,
+			TxBytes:               st.TxBytes,
+			MemoryBytes:           st.MemoryBytes,
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts the hub version of a Connector to this version.
+func (dst *Connector) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*tsapiv1.Connector)
+	if !ok {
+		return fmt.Errorf("unexpected conversion hub type %T", srcRaw)
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = ConnectorSpec{
+		Tags:       convertSlice[tsapiv1.Tag, Tag](src.Spec.Tags),
+		Hostname:   Hostname(src.Spec.Hostname),
+		ProxyClass: src.Spec.ProxyClass,
+		ExitNode:   src.Spec.ExitNode,
+	}
+	if sr := src.Spec.SubnetRouter; sr != nil {
+		dst.Spec.SubnetRouter = &SubnetRouter{
+			AdvertiseRoutes: convertSlice[tsapiv1.Route, Route](sr.AdvertiseRoutes),
+		}
+		if cc := sr.AdvertiseClusterCIDRs; cc != nil {
+			dst.Spec.SubnetRouter.AdvertiseClusterCIDRs = &ClusterCIDRs{
+				Pods:     cc.Pods,
+				Services: cc.Services,
+			}
+		}
+	}
+	if ac := src.Spec.AppConnector; ac != nil {
+		dst.Spec.AppConnector = &AppConnector{
+			Routes: convertSlice[tsapiv1.Route, Route](ac.Routes),
+		}
+	}
+	dst.Status = ConnectorStatus{
+		Conditions:     src.Status.DeepCopy().Conditions,
+		SubnetRoutes:   Routes(convertSlice[tsapiv1.Route, Route](src.Status.SubnetRoutes)).Stringify(),
+		IsExitNode:     src.Status.IsExitNode,
+		IsAppConnector: src.Status.IsAppConnector,
+		TailnetIPs:     src.Status.DeepCopy().TailnetIPs,
+		Hostname:       src.Status.Hostname,
+	}
+	if st := src.Status.Stats; st != nil {
+		dst.Status.Stats = &ProxyStats{
+			LastUpdated:           *st.LastUpdated.DeepCopy(),
+			DERPHomeRegion:        st.DERPHomeRegion,
+			ActivePeers:           st.ActivePeers,
+			DirectPeers:           st.DirectPeers,
+			DirectConnectionRatio: st.DirectConnectionRatio,
+			LastNetmapUpdate:      st.LastNetmapUpdate.DeepCopy(),
+			RxBytes:               st.RxBytes,
+			TxBytes:               st.TxBytes,
+			MemoryBytes:           st.MemoryBytes,
+		}
+	}
+	return nil
+}
+
+// convertSlice converts a slice of one string type to another, preserving
+// nil.
+func convertSlice[From, To ~string](s []From) []To {
+	if s == nil {
+		return nil
+	}
+	out := make([]To, len(s))
+	for i, v := range s {
+		out[i] = To(v)
+	}
+	return out
+}
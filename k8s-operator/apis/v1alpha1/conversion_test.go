@@ -0,0 +1,125 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !plan9
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	tsapiv1 "tailscale.com/k8s-operator/apis/v1"
+)
+
+func TestConnectorConversionRoundTrip(t *testing.T) {
+	now := metav1.NewTime(time.Date(2024, 10, 14, 12, 0, 0, 0, time.UTC))
+	meta := metav1.ObjectMeta{
+		Name:        "test",
+		UID:         "1234-UID",
+		Generation:  3,
+		Labels:      map[string]string{"foo": "bar"},
+		Annotations: map[string]string{"bar": "baz"},
+		Finalizers:  []string{"tailscale.com/finalizer"},
+	}
+	tests := []struct {
+		name string
+		cn   *Connector
+	}{
+		{
+			name: "empty",
+			cn:   &Connector{ObjectMeta: meta},
+		},
+		{
+			name: "subnet_router_and_exit_node",
+			cn: &Connector{
+				ObjectMeta: meta,
+				Spec: ConnectorSpec{
+					Tags:       Tags{"tag:foo", "tag:bar"},
+					Hostname:   "foo",
+					ProxyClass: "custom",
+					SubnetRouter: &SubnetRouter{
+						AdvertiseRoutes:       Routes{"10.40.0.0/14", "fd7a:115c:a1e0:b1a:0:1:a00:0/120"},
+						AdvertiseClusterCIDRs: &ClusterCIDRs{Pods: true, Services: true},
+					},
+					ExitNode: true,
+				},
+				Status: ConnectorStatus{
+					Conditions: []metav1.Condition{{
+						Type:               string(ConnectorReady),
+						Status:             metav1.ConditionTrue,
+						Reason:             "ConnectorCreated",
+						Message:            "ConnectorCreated",
+						LastTransitionTime: now,
+						ObservedGeneration: 3,
+					}},
+					SubnetRoutes: "10.40.0.0/14,fd7a:115c:a1e0:b1a:0:1:a00:0/120,10.1.0.0/23",
+					IsExitNode:   true,
+					TailnetIPs:   []string{"100.64.0.1", "fd7a:115c:a1e0::1"},
+					Hostname:     "foo.tailnetxyz.ts.net",
+					Stats: &ProxyStats{
+						LastUpdated:           now,
+						DERPHomeRegion:        "lhr",
+						ActivePeers:           4,
+						DirectPeers:           3,
+						DirectConnectionRatio: "75%",
+						LastNetmapUpdate:      &now,
+						RxBytes:               1024,
+						TxBytes:               2048,
+						MemoryBytes:           4096,
+					},
+				},
+			},
+		},
+		{
+			name: "app_connector",
+			cn: &Connector{
+				ObjectMeta: meta,
+				Spec: ConnectorSpec{
+					AppConnector: &AppConnector{Routes: Routes{"10.88.2.21/32"}},
+				},
+				Status: ConnectorStatus{
+					IsAppConnector: true,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := &tsapiv1.Connector{}
+			if err := tt.cn.DeepCopy().ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			got := &Connector{}
+			if err := got.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+			if diff := cmp.Diff(tt.cn, got); diff != "" {
+				t.Errorf("v1alpha1 -> v1 -> v1alpha1 round trip mismatch (-want +got):\n%s", diff)
+			}
+
+			// And the other way.
+			got2 := &tsapiv1.Connector{}
+			if err := got.ConvertTo(got2); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			if diff := cmp.Diff(hub, got2); diff != "" {
+				t.Errorf("v1 -> v1alpha1 -> v1 round trip mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConnectorConversionSubnetRoutes(t *testing.T) {
+	cn := &Connector{Status: ConnectorStatus{SubnetRoutes: "10.40.0.0/14,10.44.0.0/20"}}
+	hub := &tsapiv1.Connector{}
+	if err := cn.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	want := tsapiv1.Routes{"10.40.0.0/14", "10.44.0.0/20"}
+	if diff := cmp.Diff(want, hub.Status.SubnetRoutes); diff != "" {
+		t.Errorf("unexpected v1 subnet routes (-want +got):\n%s", diff)
+	}
+}
@@ -9,6 +9,7 @@
 	"fmt"
 
 	"tailscale.com/k8s-operator/apis"
+	tsapiv1 "tailscale.com/k8s-operator/apis/v1"
 
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -48,6 +49,11 @@ func init() {
 	if err := AddToScheme(GlobalScheme); err != nil {
 		panic(fmt.Sprintf("failed to add tailscale.com scheme: %s", err))
 	}
+	// Add the graduated tailscale.com types, so that the operator can
+	// convert between versions.
+	if err := tsapiv1.AddToScheme(GlobalScheme); err != nil {
+		panic(fmt.Sprintf("failed to add tailscale.com/v1 scheme: %s", err))
+	}
 	// Add apiextensions types (CustomResourceDefinitions/CustomResourceDefinitionLists)
 	if err := apiextensionsv1.AddToScheme(GlobalScheme); err != nil {
 		panic(fmt.Sprintf("failed to add apiextensions.k8s.io scheme: %s", err))
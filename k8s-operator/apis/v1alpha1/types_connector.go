@@ -20,10 +20,14 @@
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster,shortName=cn
+// +kubebuilder:deprecatedversion:warning="tailscale.com/v1alpha1 Connector is deprecated, use tailscale.com/v1 Connector"
 // +kubebuilder:printcolumn:name="SubnetRoutes",type="string",JSONPath=`.status.subnetRoutes`,description="CIDR ranges exposed to tailnet by a subnet router defined via this Connector instance."
 // +kubebuilder:printcolumn:name="IsExitNode",type="string",JSONPath=`.status.isExitNode`,description="Whether this Connector instance defines an exit node."
 // +kubebuilder:printcolumn:name="IsAppConnector",type="string",JSONPath=`.status.isAppConnector`,description="Whether this Connector instance is an app connector."
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=`.status.conditions[?(@.type == "ConnectorReady")].reason`,description="Status of the deployed Connector resources."
+// +kubebuilder:printcolumn:name="TailnetIPs",type="string",JSONPath=`.status.tailnetIPs`,description="Tailnet addresses of the Connector node.",priority=1
+// +kubebuilder:printcolumn:name="DERP",type="string",JSONPath=`.status.stats.derpHomeRegion`,description="Home DERP region of the Connector node.",priority=1
+// +kubebuilder:printcolumn:name="Direct",type="string",JSONPath=`.status.stats.directConnectionRatio`,description="Percentage of active peers that the Connector node is connected to directly.",priority=1
 
 // Connector defines a Tailscale node that will be deployed in the cluster. The
 // node can be configured to act as a Tailscale subnet router and/or a Tailscale
@@ -116,12 +120,40 @@ type ConnectorSpec struct {
 
 // SubnetRouter defines subnet routes that should be exposed to tailnet via a
 // Connector node.
+// +kubebuilder:validation:XValidation:rule="has(self.advertiseRoutes) || (has(self.advertiseClusterCIDRs) && ((has(self.advertiseClusterCIDRs.pods) && self.advertiseClusterCIDRs.pods) || (has(self.advertiseClusterCIDRs.services) && self.advertiseClusterCIDRs.services)))",message="A subnet router needs to have at least one of advertiseRoutes, advertiseClusterCIDRs.pods or advertiseClusterCIDRs.services configured."
 type SubnetRouter struct {
 	// AdvertiseRoutes refer to CIDRs that the subnet router should make
 	// available. Route values must be strings that represent a valid IPv4
 	// or IPv6 CIDR range. Values can be Tailscale 4via6 subnet routes.
 	// https://tailscale.com/kb/1201/4via6-subnets/
-	AdvertiseRoutes Routes `json:"advertiseRoutes"`
+	// +optional
+	AdvertiseRoutes Routes `json:"advertiseRoutes,omitempty"`
+	// AdvertiseClusterCIDRs configures the subnet router to also advertise
+	// the cluster's Pod and/or Service CIDRs, as discovered by the operator
+	// from the Kubernetes API. The operator keeps the advertised routes in
+	// sync with the cluster, for example as Nodes with new Pod CIDRs are
+	// added. Discovered routes are advertised in addition to any routes in
+	// advertiseRoutes.
+	// +optional
+	AdvertiseClusterCIDRs *ClusterCIDRs `json:"advertiseClusterCIDRs,omitempty"`
+}
+
+// ClusterCIDRs defines which of the cluster's CIDRs should be advertised by a
+// subnet router.
+type ClusterCIDRs struct {
+	// Pods, if set to true, advertises the Pod CIDRs of all Nodes in the
+	// cluster, as set in the Nodes' spec.podCIDRs. Adjacent Pod CIDRs are
+	// merged into larger routes where possible. This requires the cluster
+	// to allocate Pod CIDRs to Nodes, which is not the case for some CNI
+	// plugins that manage their own IP address pools.
+	// +optional
+	Pods bool `json:"pods,omitempty"`
+	// Services, if set to true, advertises the cluster's Service CIDRs. The
+	// operator discovers them from the error that the API server returns
+	// for a dry-run create of a Service with an out-of-range cluster IP,
+	// and re-checks them periodically.
+	// +optional
+	Services bool `json:"services,omitempty"`
 }
 
 // AppConnector defines a Tailscale app connector node configured via Connector.
@@ -199,6 +231,10 @@ type ConnectorStatus struct {
 	// node.
 	// +optional
 	Hostname string `json:"hostname,omitempty"`
+	// Stats are connection and resource usage stats reported by the
+	// Connector node.
+	// +optional
+	Stats *ProxyStats `json:"stats,omitempty"`
 }
 
 type ConditionType string
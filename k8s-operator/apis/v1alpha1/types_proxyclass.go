@@ -162,6 +162,7 @@ type Pod struct {
 }
 
 // +kubebuilder:validation:XValidation:rule="!(has(self.serviceMonitor) && self.serviceMonitor.enable  && !self.enable)",message="ServiceMonitor can only be enabled if metrics are enabled"
+// +kubebuilder:validation:XValidation:rule="!(has(self.podMonitor) && self.podMonitor.enable  && !self.enable)",message="PodMonitor can only be enabled if metrics are enabled"
 type Metrics struct {
 	// Setting enable to true will make the proxy serve Tailscale metrics
 	// at <pod-ip>:9002/metrics.
@@ -183,11 +184,32 @@ type Metrics struct {
 	// job: ts_<proxy type>_[<parent namespace>]_<parent_name>
 	// +optional
 	ServiceMonitor *ServiceMonitor `json:"serviceMonitor"`
+	// Enable to create a Prometheus PodMonitor for scraping the Tailscale
+	// metrics of each of the proxy's Pods directly, without going through
+	// the metrics Service. The ingested metrics will have the same labels
+	// as those ingested via a ServiceMonitor.
+	// +optional
+	PodMonitor *PodMonitor `json:"podMonitor,omitempty"`
 }
 
 type ServiceMonitor struct {
 	// If Enable is set to true, a Prometheus ServiceMonitor will be created. Enable can only be set to true if metrics are enabled.
 	Enable bool `json:"enable"`
+	// Labels to add to the ServiceMonitor, for example to match the
+	// serviceMonitorSelector of a Prometheus instance. Labels set by the
+	// operator take precedence.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type PodMonitor struct {
+	// If Enable is set to true, a Prometheus PodMonitor will be created. Enable can only be set to true if metrics are enabled.
+	Enable bool `json:"enable"`
+	// Labels to add to the PodMonitor, for example to match the
+	// podMonitorSelector of a Prometheus instance. Labels set by the
+	// operator take precedence.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 type Container struct {
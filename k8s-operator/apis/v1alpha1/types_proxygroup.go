@@ -13,6 +13,9 @@
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster,shortName=pg
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=`.status.conditions[?(@.type == "ProxyGroupReady")].reason`,description="Status of the deployed ProxyGroup resources."
+// +kubebuilder:printcolumn:name="TailnetIPs",type="string",JSONPath=`.status.devices[*].tailnetIPs[0]`,description="IPv4 tailnet addresses of the ProxyGroup's devices.",priority=1
+// +kubebuilder:printcolumn:name="DERP",type="string",JSONPath=`.status.devices[*].stats.derpHomeRegion`,description="Home DERP regions of the ProxyGroup's devices.",priority=1
+// +kubebuilder:printcolumn:name="Direct",type="string",JSONPath=`.status.devices[*].stats.directConnectionRatio`,description="Percentage of active peers that the ProxyGroup's devices are connected to directly.",priority=1
 
 type ProxyGroup struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -36,6 +39,7 @@ type ProxyGroupList struct {
 	Items []ProxyGroup `json:"items"`
 }
 
+// +kubebuilder:validation:XValidation:rule="!(has(self.hostnamePrefix) && has(self.hostnameTemplate))",message="hostnamePrefix and hostnameTemplate are mutually exclusive."
 type ProxyGroupSpec struct {
 	// Type of the ProxyGroup proxies. Currently the only supported type is egress.
 	Type ProxyGroupType `json:"type"`
@@ -62,6 +66,16 @@ type ProxyGroupSpec struct {
 	// +optional
 	HostnamePrefix HostnamePrefix `json:"hostnamePrefix,omitempty"`
 
+	// HostnameTemplate is a template for the hostnames of tailnet devices
+	// created by the ProxyGroup, such as "{{name}}-{{ordinal}}". Supported
+	// variables are {{name}}, the name of the ProxyGroup, and {{ordinal}},
+	// the integer number of the device's StatefulSet pod, which the template
+	// must include. The template must expand to a valid hostname of at most
+	// 63 characters. HostnameTemplate cannot be set together with
+	// HostnamePrefix.
+	// +optional
+	HostnameTemplate string `json:"hostnameTemplate,omitempty"`
+
 	// ProxyClass is the name of the ProxyClass custom resource that contains
 	// configuration options that should be applied to the resources created
 	// for this ProxyGroup. If unset, and there is no default ProxyClass
@@ -69,6 +83,52 @@ type ProxyGroupSpec struct {
 	// configuration.
 	// +optional
 	ProxyClass string `json:"proxyClass,omitempty"`
+
+	// UpgradeStrategy configures how the ProxyGroup's proxies are replaced
+	// when the proxy image changes. Defaults to a rolling update of the
+	// proxies.
+	// +optional
+	UpgradeStrategy *ProxyGroupUpgradeStrategy `json:"upgradeStrategy,omitempty"`
+}
+
+type ProxyGroupUpgradeStrategy struct {
+	// Type of the upgrade strategy.
+	// RollingUpdate restarts the proxies on the new image one at a time,
+	// which drops the connections going through each proxy as it restarts.
+	// BlueGreen brings up a second set of proxies on the new image next to
+	// the current ones, gradually shifts egress traffic to them, and removes
+	// the old proxies only once their traffic has drained.
+	// Defaults to RollingUpdate.
+	// +optional
+	Type ProxyGroupUpgradeStrategyType `json:"type,omitempty"`
+
+	// BlueGreen configures BlueGreen upgrades. It is only used if type is
+	// BlueGreen.
+	// +optional
+	BlueGreen *BlueGreenUpgrade `json:"blueGreen,omitempty"`
+}
+
+type BlueGreenUpgrade struct {
+	// Steps is the number of steps in which egress traffic is shifted from
+	// the old proxies to the new ones. Traffic is shifted by changing the
+	// share of the egress Services' endpoints that are new proxies, so the
+	// granularity of each step is limited by the number of replicas.
+	// Defaults to 4.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Steps *int32 `json:"steps,omitempty"`
+
+	// StepInterval is the minimum time between two traffic shifting steps.
+	// A step is only taken once all the new proxies are ready.
+	// Defaults to 1m.
+	// +optional
+	StepInterval *metav1.Duration `json:"stepInterval,omitempty"`
+
+	// DrainPeriod is how long the old proxies are kept running after all
+	// egress traffic has been shifted away from them, to let existing
+	// connections finish. Defaults to 5m.
+	// +optional
+	DrainPeriod *metav1.Duration `json:"drainPeriod,omitempty"`
 }
 
 type ProxyGroupStatus struct {
@@ -84,6 +144,32 @@ type ProxyGroupStatus struct {
 	// +listMapKey=hostname
 	// +optional
 	Devices []TailnetDevice `json:"devices,omitempty"`
+
+	// ActiveSet is the set of proxies currently serving the ProxyGroup.
+	// BlueGreen upgrades switch it between blue and green. Empty means blue.
+	// +optional
+	ActiveSet ProxyGroupSet `json:"activeSet,omitempty"`
+
+	// Upgrade is the progress of the BlueGreen upgrade underway, if any.
+	// +optional
+	Upgrade *ProxyGroupUpgradeStatus `json:"upgrade,omitempty"`
+}
+
+type ProxyGroupUpgradeStatus struct {
+	// Target is the set of proxies being brought up on the new image.
+	Target ProxyGroupSet `json:"target"`
+
+	// Image is the proxy image being upgraded to.
+	Image string `json:"image"`
+
+	// Step is the number of traffic shifting steps taken so far. All egress
+	// traffic has been shifted to the target set once it reaches the
+	// configured number of steps.
+	Step int32 `json:"step"`
+
+	// LastStepTime is when the last step was taken, or when the upgrade
+	// started if no step has been taken yet.
+	LastStepTime metav1.Time `json:"lastStepTime"`
 }
 
 type TailnetDevice struct {
@@ -96,6 +182,60 @@ type TailnetDevice struct {
 	// assigned to the device.
 	// +optional
 	TailnetIPs []string `json:"tailnetIPs,omitempty"`
+
+	// Stats are connection and resource usage stats reported by the
+	// device's proxy.
+	// +optional
+	Stats *ProxyStats `json:"stats,omitempty"`
+}
+
+// ProxyStats are stats that a proxy periodically reports about its tailnet
+// connectivity and resource usage.
+type ProxyStats struct {
+	// LastUpdated is when the proxy last reported its stats. Proxies report
+	// stats every minute, so stats that are much older than that are
+	// likely stale.
+	LastUpdated metav1.Time `json:"lastUpdated"`
+
+	// DERPHomeRegion is the region code of the proxy's home DERP server.
+	// +optional
+	DERPHomeRegion string `json:"derpHomeRegion,omitempty"`
+
+	// ActivePeers is the number of peers that the proxy currently has an
+	// active connection to.
+	// +optional
+	ActivePeers int32 `json:"activePeers,omitempty"`
+
+	// DirectPeers is the number of active peers that the proxy is connected
+	// to directly, rather than relayed via DERP.
+	// +optional
+	DirectPeers int32 `json:"directPeers,omitempty"`
+
+	// DirectConnectionRatio is the percentage of active peers that the
+	// proxy is connected to directly, e.g. "75%". Unset if there are no
+	// active peers.
+	// +optional
+	DirectConnectionRatio string `json:"directConnectionRatio,omitempty"`
+
+	// LastNetmapUpdate is when the proxy last received a network map update
+	// from the control plane.
+	// +optional
+	LastNetmapUpdate *metav1.Time `json:"lastNetmapUpdate,omitempty"`
+
+	// RxBytes is the number of bytes that the proxy has received from its
+	// current peers.
+	// +optional
+	RxBytes int64 `json:"rxBytes,omitempty"`
+
+	// TxBytes is the number of bytes that the proxy has sent to its current
+	// peers.
+	// +optional
+	TxBytes int64 `json:"txBytes,omitempty"`
+
+	// MemoryBytes is the resident memory size of the proxy's tailscaled
+	// process.
+	// +optional
+	MemoryBytes int64 `json:"memoryBytes,omitempty"`
 }
 
 // +kubebuilder:validation:Type=string
@@ -106,6 +246,27 @@ type TailnetDevice struct {
 	ProxyGroupTypeEgress ProxyGroupType = "egress"
 )
 
+// +kubebuilder:validation:Type=string
+// +kubebuilder:validation:Enum=RollingUpdate;BlueGreen
+type ProxyGroupUpgradeStrategyType string
+
+const (
+	ProxyGroupUpgradeStrategyRollingUpdate ProxyGroupUpgradeStrategyType = "RollingUpdate"
+	ProxyGroupUpgradeStrategyBlueGreen     ProxyGroupUpgradeStrategyType = "BlueGreen"
+)
+
+// ProxyGroupSet names one of the two sets of proxies of a ProxyGroup. The
+// blue set's StatefulSet is named after the ProxyGroup; the green set's has a
+// "-green" suffix, as do the hostnames of its tailnet devices.
+// +kubebuilder:validation:Type=string
+// +kubebuilder:validation:Enum=blue;green
+type ProxyGroupSet string
+
+const (
+	ProxyGroupSetBlue  ProxyGroupSet = "blue"
+	ProxyGroupSetGreen ProxyGroupSet = "green"
+)
+
 // +kubebuilder:validation:Type=string
 // +kubebuilder:validation:Pattern=`^[a-z0-9][a-z0-9-]{0,61}$`
 type HostnamePrefix string
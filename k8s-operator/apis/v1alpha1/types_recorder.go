@@ -53,8 +53,13 @@ type RecorderSpec struct {
 	// +optional
 	Tags Tags `json:"tags,omitempty"`
 
-	// TODO(tomhjp): Support a hostname or hostname prefix field, depending on
-	// the plan for multiple replicas.
+	// Replicas specifies how many replicas to create the StatefulSet with.
+	// Each replica is a separate tailnet device. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// TODO(tomhjp): Support a hostname or hostname prefix field.
 
 	// Set to true to enable the Recorder UI. The UI lists and plays recorded sessions.
 	// The UI will be served at <MagicDNS name of the recorder>:443. Defaults to false.
@@ -196,6 +201,19 @@ type S3 struct {
 	// first from the file system and then the STS API.
 	// +optional
 	Credentials S3Credentials `json:"credentials,omitempty"`
+
+	// Retention configures how long recordings are kept in the bucket. If
+	// set, the operator periodically deletes recordings that are older than
+	// the retention period, using the configured credentials, and reports
+	// the state of the bucket in the Recorder's status.
+	// +optional
+	Retention *S3Retention `json:"retention,omitempty"`
+}
+
+type S3Retention struct {
+	// Number of days after which recordings are deleted from the bucket.
+	// +kubebuilder:validation:Minimum=1
+	Days int32 `json:"days"`
 }
 
 type S3Credentials struct {
@@ -228,6 +246,32 @@ type RecorderStatus struct {
 	// +listMapKey=hostname
 	// +optional
 	Devices []RecorderTailnetDevice `json:"devices,omitempty"`
+
+	// Storage describes the recordings stored in the Recorder's S3 bucket.
+	// Only set if a retention policy is configured for S3 storage.
+	// +optional
+	Storage *RecorderStorageStatus `json:"storage,omitempty"`
+}
+
+type RecorderStorageStatus struct {
+	// Number of recordings stored in the bucket.
+	Recordings int64 `json:"recordings"`
+
+	// Total size in bytes of the recordings stored in the bucket.
+	Bytes int64 `json:"bytes"`
+
+	// Backlog is the number of recordings that are past the retention
+	// period but could not be deleted yet.
+	// +optional
+	Backlog int64 `json:"backlog,omitempty"`
+
+	// Time at which the oldest recording in the bucket was stored.
+	// +optional
+	OldestRecordingTime *metav1.Time `json:"oldestRecordingTime,omitempty"`
+
+	// Time at which the operator last enforced the retention policy.
+	// +optional
+	LastRetentionTime *metav1.Time `json:"lastRetentionTime,omitempty"`
 }
 
 type RecorderTailnetDevice struct {
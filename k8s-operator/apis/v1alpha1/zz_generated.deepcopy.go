@@ -33,6 +33,51 @@ func (in *AppConnector) DeepCopy() *AppConnector {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BlueGreenUpgrade) DeepCopyInto(out *BlueGreenUpgrade) {
+	*out = *in
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = new(int32)
+		**out = **in
+	}
+	if in.StepInterval != nil {
+		in, out := &in.StepInterval, &out.StepInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.DrainPeriod != nil {
+		in, out := &in.DrainPeriod, &out.DrainPeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BlueGreenUpgrade.
+func (in *BlueGreenUpgrade) DeepCopy() *BlueGreenUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(BlueGreenUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterCIDRs) DeepCopyInto(out *ClusterCIDRs) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterCIDRs.
+func (in *ClusterCIDRs) DeepCopy() *ClusterCIDRs {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterCIDRs)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Connector) DeepCopyInto(out *Connector) {
 	*out = *in
@@ -137,6 +182,11 @@ func (in *ConnectorStatus) DeepCopyInto(out *ConnectorStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Stats != nil {
+		in, out := &in.Stats, &out.Stats
+		*out = new(ProxyStats)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConnectorStatus.
@@ -322,7 +372,12 @@ func (in *Metrics) DeepCopyInto(out *Metrics) {
 	if in.ServiceMonitor != nil {
 		in, out := &in.ServiceMonitor, &out.ServiceMonitor
 		*out = new(ServiceMonitor)
-		**out = **in
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodMonitor != nil {
+		in, out := &in.PodMonitor, &out.PodMonitor
+		*out = new(PodMonitor)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
@@ -461,6 +516,28 @@ func (in *Pod) DeepCopy() *Pod {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodMonitor) DeepCopyInto(out *PodMonitor) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodMonitor.
+func (in *PodMonitor) DeepCopy() *PodMonitor {
+	if in == nil {
+		return nil
+	}
+	out := new(PodMonitor)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProxyClass) DeepCopyInto(out *ProxyClass) {
 	*out = *in
@@ -644,6 +721,11 @@ func (in *ProxyGroupSpec) DeepCopyInto(out *ProxyGroupSpec) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.UpgradeStrategy != nil {
+		in, out := &in.UpgradeStrategy, &out.UpgradeStrategy
+		*out = new(ProxyGroupUpgradeStrategy)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyGroupSpec.
@@ -673,6 +755,11 @@ func (in *ProxyGroupStatus) DeepCopyInto(out *ProxyGroupStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(ProxyGroupUpgradeStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyGroupStatus.
@@ -685,6 +772,62 @@ func (in *ProxyGroupStatus) DeepCopy() *ProxyGroupStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyGroupUpgradeStatus) DeepCopyInto(out *ProxyGroupUpgradeStatus) {
+	*out = *in
+	in.LastStepTime.DeepCopyInto(&out.LastStepTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyGroupUpgradeStatus.
+func (in *ProxyGroupUpgradeStatus) DeepCopy() *ProxyGroupUpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyGroupUpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyGroupUpgradeStrategy) DeepCopyInto(out *ProxyGroupUpgradeStrategy) {
+	*out = *in
+	if in.BlueGreen != nil {
+		in, out := &in.BlueGreen, &out.BlueGreen
+		*out = new(BlueGreenUpgrade)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyGroupUpgradeStrategy.
+func (in *ProxyGroupUpgradeStrategy) DeepCopy() *ProxyGroupUpgradeStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyGroupUpgradeStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyStats) DeepCopyInto(out *ProxyStats) {
+	*out = *in
+	in.LastUpdated.DeepCopyInto(&out.LastUpdated)
+	if in.LastNetmapUpdate != nil {
+		in, out := &in.LastNetmapUpdate, &out.LastNetmapUpdate
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyStats.
+func (in *ProxyStats) DeepCopy() *ProxyStats {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Recorder) DeepCopyInto(out *Recorder) {
 	*out = *in
@@ -838,6 +981,11 @@ func (in *RecorderSpec) DeepCopyInto(out *RecorderSpec) {
 		*out = make(Tags, len(*in))
 		copy(*out, *in)
 	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
 	in.Storage.DeepCopyInto(&out.Storage)
 }
 
@@ -898,6 +1046,11 @@ func (in *RecorderStatus) DeepCopyInto(out *RecorderStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(RecorderStorageStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RecorderStatus.
@@ -910,6 +1063,29 @@ func (in *RecorderStatus) DeepCopy() *RecorderStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RecorderStorageStatus) DeepCopyInto(out *RecorderStorageStatus) {
+	*out = *in
+	if in.OldestRecordingTime != nil {
+		in, out := &in.OldestRecordingTime, &out.OldestRecordingTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRetentionTime != nil {
+		in, out := &in.LastRetentionTime, &out.LastRetentionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RecorderStorageStatus.
+func (in *RecorderStorageStatus) DeepCopy() *RecorderStorageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RecorderStorageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RecorderTailnetDevice) DeepCopyInto(out *RecorderTailnetDevice) {
 	*out = *in
@@ -953,6 +1129,11 @@ func (in Routes) DeepCopy() Routes {
 func (in *S3) DeepCopyInto(out *S3) {
 	*out = *in
 	out.Credentials = in.Credentials
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(S3Retention)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3.
@@ -981,6 +1162,21 @@ func (in *S3Credentials) DeepCopy() *S3Credentials {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *S3Retention) DeepCopyInto(out *S3Retention) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3Retention.
+func (in *S3Retention) DeepCopy() *S3Retention {
+	if in == nil {
+		return nil
+	}
+	out := new(S3Retention)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *S3Secret) DeepCopyInto(out *S3Secret) {
 	*out = *in
@@ -999,6 +1195,13 @@ func (in *S3Secret) DeepCopy() *S3Secret {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServiceMonitor) DeepCopyInto(out *ServiceMonitor) {
 	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceMonitor.
@@ -1051,7 +1254,7 @@ func (in *Storage) DeepCopyInto(out *Storage) {
 	if in.S3 != nil {
 		in, out := &in.S3, &out.S3
 		*out = new(S3)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 }
 
@@ -1073,6 +1276,11 @@ func (in *SubnetRouter) DeepCopyInto(out *SubnetRouter) {
 		*out = make(Routes, len(*in))
 		copy(*out, *in)
 	}
+	if in.AdvertiseClusterCIDRs != nil {
+		in, out := &in.AdvertiseClusterCIDRs, &out.AdvertiseClusterCIDRs
+		*out = new(ClusterCIDRs)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubnetRouter.
@@ -1112,6 +1320,11 @@ func (in *TailnetDevice) DeepCopyInto(out *TailnetDevice) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Stats != nil {
+		in, out := &in.Stats, &out.Stats
+		*out = new(ProxyStats)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TailnetDevice.
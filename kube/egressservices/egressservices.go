@@ -29,8 +29,25 @@ type Config struct {
 	TailnetTarget TailnetTarget `json:"tailnetTarget"`
 	// Ports contains mappings for ports that can be accessed on the tailnet target.
 	Ports PortMaps `json:"ports"`
+	// ClientIP, if set, is how the proxy passes the address of the cluster
+	// client on to the tailnet target. The proxy then proxies the traffic in
+	// userspace instead of with firewall rules. Only TCP ports are supported.
+	ClientIP ClientIPMode `json:"clientIP,omitempty"`
 }
 
+// ClientIPMode is a way for an egress proxy to pass the address of the cluster
+// client on to the tailnet target.
+type ClientIPMode string
+
+const (
+	// ClientIPProxyProtocol prefixes each TCP connection to the tailnet
+	// target with a PROXY protocol v1 header.
+	ClientIPProxyProtocol ClientIPMode = "proxy-protocol"
+	// ClientIPHTTP proxies HTTP requests to the tailnet target, adding
+	// X-Forwarded-For headers.
+	ClientIPHTTP ClientIPMode = "http"
+)
+
 // TailnetTarget is the tailnet target to which traffic for the egress service
 // should be proxied. Exactly one of IP or FQDN should be set.
 type TailnetTarget struct {
@@ -38,6 +55,13 @@ type TailnetTarget struct {
 	IP string `json:"ip"`
 	// FQDN is the full tailnet FQDN of the target.
 	FQDN string `json:"fqdn"`
+	// ResolvePerConnection, if set, makes the proxy resolve FQDN to the
+	// target's tailnet IPs each time it proxies a new connection, instead of
+	// programming firewall rules for the IPs that FQDN resolved to when the
+	// service was configured. This keeps the egress service working when the
+	// target's IPs change, e.g. for ephemeral nodes. Such services are
+	// proxied in userspace and only TCP ports are supported.
+	ResolvePerConnection bool `json:"resolvePerConnection,omitempty"`
 }
 
 // PorMap is a mapping between match port on which proxy receives cluster
@@ -97,7 +121,12 @@ type ServiceStatus struct {
 	Ports PortMaps `json:"ports"`
 	// TailnetTargetIPs are the tailnet target IPs that were used to
 	// configure these firewall rules. For a TailnetTarget with IP set, this
-	// is the same as IP.
+	// is the same as IP. It is empty for a TailnetTarget that is resolved
+	// per connection.
 	TailnetTargetIPs []netip.Addr  `json:"tailnetTargetIPs"`
 	TailnetTarget    TailnetTarget `json:"tailnetTarget"`
+	// ClientIP is the mode in which the proxy passes on client addresses,
+	// if any. Services with a ClientIP mode are proxied in userspace, with
+	// no firewall rules.
+	ClientIP ClientIPMode `json:"clientIP,omitempty"`
 }
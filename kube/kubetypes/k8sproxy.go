@@ -0,0 +1,76 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package kubetypes
+
+// K8sProxyConfigVersion is the only supported version of K8sProxyConfig.
+const K8sProxyConfigVersion = "v1alpha1"
+
+// K8sProxyConfig is the configuration file of the standalone Kubernetes API
+// server proxy, cmd/k8s-proxy. It's read as HuJSON.
+type K8sProxyConfig struct {
+	// Version is the version of the configuration. It must be
+	// K8sProxyConfigVersion.
+	Version string `json:"version"`
+	// Hostname is the proxy's tailnet hostname. If empty, it's
+	// "k8s-proxy".
+	Hostname string `json:"hostname,omitempty"`
+	// AuthMode is "auth" (the default), in which case requests are
+	// impersonated as the caller's tailnet identity, or "noauth", in which
+	// case requests are passed through to the API servers as is.
+	AuthMode string `json:"authMode,omitempty"`
+	// Clusters are the Kubernetes clusters whose API servers requests are
+	// proxied to. There must be at least one.
+	Clusters []K8sProxyCluster `json:"clusters"`
+}
+
+// K8sProxyCluster is a Kubernetes cluster behind a k8s-proxy.
+type K8sProxyCluster struct {
+	// Name is the name of the cluster, as used in logs.
+	Name string `json:"name"`
+	// ServerNames are the TLS server names (SNI) of requests that are routed
+	// to this cluster. At most one cluster may have no ServerNames; it
+	// receives the requests that don't match any other cluster.
+	//
+	// To serve names other than the proxy's own tailnet name, CertFile and
+	// KeyFile must be set.
+	ServerNames []string `json:"serverNames,omitempty"`
+	// Kubeconfig is the path of the kubeconfig file used to reach the
+	// cluster's API server. If it and Context are empty, the in-cluster
+	// configuration of the Pod the proxy runs in is used.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Context is the kubeconfig context to use. If empty, it's the current
+	// context of Kubeconfig.
+	Context string `json:"context,omitempty"`
+	// CertFile and KeyFile, if set, are the paths of the PEM-encoded TLS
+	// certificate and key served for ServerNames, instead of the proxy's
+	// Tailscale HTTPS certificate.
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// Impersonation are rules mapping tailnet identities to Kubernetes users
+	// and groups, in addition to any granted by the
+	// tailcfg.PeerCapabilityKubernetes capability.
+	Impersonation []ImpersonationMapping `json:"impersonation,omitempty"`
+	// AuditAnnotations is whether to add the caller's tailnet identity to
+	// the impersonated user's extra fields, which the API server records in
+	// its audit log, and to tag each request with an Audit-ID that's also
+	// logged by the proxy. The proxy's RBAC must allow impersonating
+	// userextras.
+	AuditAnnotations bool `json:"auditAnnotations,omitempty"`
+}
+
+// ImpersonationMapping maps tailnet identities to the Kubernetes user and
+// groups that their requests are impersonated as.
+type ImpersonationMapping struct {
+	// Src are the tailnet identities that the mapping applies to: user login
+	// names such as "alice@example.com", tags such as "tag:ci" that match
+	// tagged nodes, or "*" for everyone.
+	Src []string `json:"src"`
+	// User, if set, is the Kubernetes user impersonated instead of the
+	// caller's login name or, for tagged nodes, node name. The first
+	// matching mapping with a User wins.
+	User string `json:"user,omitempty"`
+	// Groups are Kubernetes groups impersonated in addition to those of
+	// other matching mappings and capability grants.
+	Groups []string `json:"groups,omitempty"`
+}
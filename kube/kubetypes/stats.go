@@ -0,0 +1,33 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package kubetypes
+
+import "time"
+
+// ProxyStats is a snapshot of the state of a proxy's tailscaled, written by
+// containerboot to the proxy's state Secret so that the Kubernetes operator can
+// surface it on the status of the resource that the proxy belongs to.
+type ProxyStats struct {
+	// Time is when the stats were collected.
+	Time time.Time `json:"time"`
+	// DERPHomeRegion is the region code of the proxy's home DERP server,
+	// e.g. "nyc". Empty if the proxy does not have a home DERP server.
+	DERPHomeRegion string `json:"derpHomeRegion,omitempty"`
+	// ActivePeers is the number of peers that the proxy currently has an
+	// active connection to.
+	ActivePeers int `json:"activePeers"`
+	// DirectPeers is the number of active peers that are connected
+	// directly, rather than relayed via DERP.
+	DirectPeers int `json:"directPeers"`
+	// LastNetmapUpdate is when the proxy last received a netmap update. Nil
+	// if it has not received one yet.
+	LastNetmapUpdate *time.Time `json:"lastNetmapUpdate,omitempty"`
+	// RxBytes and TxBytes are the total number of bytes received from and
+	// sent to the proxy's current peers.
+	RxBytes int64 `json:"rxBytes"`
+	TxBytes int64 `json:"txBytes"`
+	// MemoryBytes is the resident set size of the proxy's tailscaled
+	// process. Zero if unknown.
+	MemoryBytes int64 `json:"memoryBytes,omitempty"`
+}
@@ -13,6 +13,7 @@
 	AppConnector         = "k8s-operator-connector-resource"
 	AppProxyGroupEgress  = "k8s-operator-proxygroup-egress"
 	AppProxyGroupIngress = "k8s-operator-proxygroup-ingress"
+	AppK8sProxy          = "k8s-proxy" // standalone API server proxy, cmd/k8s-proxy
 
 	// Clientmetrics for Tailscale Kubernetes Operator components
 	MetricIngressProxyCount              = "k8s_ingress_proxies"   // L3
@@ -27,6 +28,9 @@
 	MetricEgressServiceCount             = "k8s_egress_service_resources"
 	MetricProxyGroupEgressCount          = "k8s_proxygroup_egress_resources"
 	MetricProxyGroupIngressCount         = "k8s_proxygroup_ingress_resources"
+	MetricDriftedProxyCount              = "k8s_drifted_proxies"
+	MetricOrphanedResourceCount          = "k8s_orphaned_proxy_resources"
+	MetricDriftRepairCount               = "k8s_drift_repairs"
 
 	// Keys that containerboot writes to state file that can be used to determine its state.
 	// fields set in Tailscale state Secret. These are mostly used by the Tailscale Kubernetes operator to determine
@@ -41,5 +45,10 @@
 	// this device to the tailnet. This is used by the Kubernetes operator Ingress proxy to communicate to the operator
 	// that cluster workloads behind the Ingress can now be accessed via the given DNS name over HTTPS.
 	KeyHTTPSEndpoint string = "https_endpoint"
-	ValueNoHTTPS     string = "no-https"
+	// KeyHTTPSCertDomain is set to the domain of the TLS cert that this device has issued for an HTTPS endpoint
+	// exposed via Funnel. The Kubernetes operator uses it to know that the endpoint can be reached from the internet.
+	KeyHTTPSCertDomain string = "https_cert_domain"
+	// KeyProxyStats contains JSON encoded ProxyStats, periodically refreshed by the proxy.
+	KeyProxyStats string = "proxy_stats"
+	ValueNoHTTPS  string = "no-https"
 )
@@ -25,6 +25,7 @@
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -37,6 +38,8 @@
 	"tailscale.com/log/filelogger"
 	"tailscale.com/logtail"
 	"tailscale.com/logtail/filch"
+	"tailscale.com/logtail/logsink"
+	"tailscale.com/logtail/ringlog"
 	"tailscale.com/net/dnscache"
 	"tailscale.com/net/dnsfallback"
 	"tailscale.com/net/netknob"
@@ -108,6 +111,12 @@ type Policy struct {
 	PublicID logid.PublicID
 	// Logf is where to write informational messages about this Logger.
 	Logf logger.Logf
+	// LocalLog is the local on-disk ring buffer of logs,
+	// or nil if local logs aren't enabled.
+	LocalLog *ringlog.Log
+	// Sinks forwards logs to the user-configured log sinks,
+	// or is nil if there are none.
+	Sinks *logsink.Dispatcher
 }
 
 // NewConfig creates a Config with collection and a newly generated PrivateID.
@@ -503,6 +512,13 @@ type Options struct {
 	// If nil, [TransportOptions.New] is used to construct a new client
 	// with that particular transport sending logs to the default logs server.
 	HTTPC *http.Client
+
+	// LogSinks are optional specs of additional destinations to send
+	// logs to, in the format documented in package [logsink]. Specs in
+	// the whitespace-separated TS_LOG_SINKS environment variable are also
+	// used. To send logs only to these sinks, also disable log uploads
+	// with [envknob.SetNoLogsNoSupport].
+	LogSinks []string
 }
 
 // New returns a new log policy (a logger and its instance ID).
@@ -614,6 +630,21 @@ func (opts Options) New() *Policy {
 		conf.IncludeProcSequence = true
 	}
 
+	var localLog *ringlog.Log
+	if envknob.LocalLogs() && !testenv.InTest() {
+		localLog = attachLocalLog(&conf, opts.Dir, opts.CmdName, opts.Logf)
+	}
+
+	var sinks *logsink.Dispatcher
+	if specs := slices.Concat(opts.LogSinks, strings.Fields(envknob.String("TS_LOG_SINKS"))); len(specs) > 0 && !testenv.InTest() {
+		sinks, err = logsink.NewDispatcher(specs)
+		if err != nil {
+			earlyLogf("logpolicy: %v", err)
+		} else {
+			conf.Sinks = sinks
+		}
+	}
+
 	if envknob.NoLogsNoSupport() || testenv.InTest() {
 		opts.Logf("You have disabled logging. Tailscale will not be able to provide support.")
 		conf.HTTPC = &http.Client{Transport: noopPretendSuccessTransport{}}
@@ -670,6 +701,8 @@ func (opts Options) New() *Policy {
 		Logtail:  lw,
 		PublicID: newc.PublicID,
 		Logf:     opts.Logf,
+		LocalLog: localLog,
+		Sinks:    sinks,
 	}
 }
 
@@ -707,6 +740,31 @@ func attachFilchBuffer(conf *logtail.Config, dir, cmdName string, logf logger.Lo
 	}
 }
 
+// attachLocalLog creates a local on-disk ring buffer of logs using ringlog
+// and attaches it to the logtail config. Unlike the filch buffer, it's kept
+// even if log uploads are disabled. It returns nil on failure.
+func attachLocalLog(conf *logtail.Config, dir, cmdName string, logf logger.Logf) *ringlog.Log {
+	prefix := filepath.Join(dir, cmdName)
+	var ringOpts ringlog.Options
+
+	// Like the filch buffer, avoid keeping NAS disks awake.
+	if runtime.GOOS == "linux" && (distro.Get() == distro.Synology || distro.Get() == distro.QNAP) {
+		tmpfsLogs := "/tmp/tailscale-logs"
+		if err := os.MkdirAll(tmpfsLogs, 0755); err == nil {
+			prefix = filepath.Join(tmpfsLogs, cmdName)
+			ringOpts.MaxSize = 5 << 20
+		}
+	}
+
+	rl, err := ringlog.New(prefix, ringOpts)
+	if err != nil {
+		logf("local logs failed: %v", err)
+		return nil
+	}
+	conf.LocalLog = rl
+	return rl
+}
+
 // dialLog is used by NewLogtailTransport to log the happy path of its
 // own dialing.
 //
@@ -739,6 +797,12 @@ func (p *Policy) Close() {
 // Shutdown gracefully shuts down the logger, finishing any current
 // log upload if it can be done before ctx is canceled.
 func (p *Policy) Shutdown(ctx context.Context) error {
+	if p.LocalLog != nil {
+		defer p.LocalLog.Close()
+	}
+	if p.Sinks != nil {
+		defer p.Sinks.Close()
+	}
 	if p.Logtail != nil {
 		p.Logf("flushing log.")
 		return p.Logtail.Shutdown(ctx)
@@ -853,9 +917,6 @@ func (opts TransportOptions) New() http.RoundTripper {
 		tr.TLSClientConfig = opts.TLSClientConfig.Clone()
 	}
 
-	tr.Proxy = tshttpproxy.ProxyFromEnvironment
-	tshttpproxy.SetTransportGetProxyConnectHeader(tr)
-
 	// We do our own zstd compression on uploads, and responses never contain any payload,
 	// so don't send "Accept-Encoding: gzip" to save a few bytes on the wire, since there
 	// will never be any body to decompress:
@@ -866,6 +927,7 @@ func (opts TransportOptions) New() http.RoundTripper {
 		opts.Logf = log.Printf
 	}
 	tr.DialContext = MakeDialFunc(opts.NetMon, opts.Logf)
+	tshttpproxy.SetTransportProxy(tr, tshttpproxy.ProxyFromEnvironment)
 
 	// We're uploading logs ideally infrequently, with specific timing that will
 	// change over time. Try to keep the connection open, to avoid repeatedly
@@ -0,0 +1,121 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logsink
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+const (
+	defaultFileMaxSize = 10 << 20
+	defaultFileBackups = 3
+)
+
+// fileSink writes entries as JSON lines to a file, rotating it once it
+// reaches maxSize. Rotated files are named path.1 (the newest) through
+// path.N.
+type fileSink struct {
+	path    string
+	maxSize int64
+	backups int
+
+	f    *os.File // or nil if not open
+	size int64
+}
+
+func newFileSink(path string, q url.Values) (*fileSink, error) {
+	if path == "" {
+		return nil, errors.New("no file path")
+	}
+	s := &fileSink{
+		path:    path,
+		maxSize: defaultFileMaxSize,
+		backups: defaultFileBackups,
+	}
+	if v := q.Get("maxsize"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid maxsize %q", v)
+		}
+		s.maxSize = n
+	}
+	if v := q.Get("backups"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid backups %q", v)
+		}
+		s.backups = n
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, fi.Size()
+	return nil
+}
+
+// rotate closes the current file, shifts the backups, and opens a new
+// file.
+func (s *fileSink) rotate() error {
+	s.f.Close()
+	s.f = nil
+	if s.backups == 0 {
+		os.Remove(s.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", s.path, s.backups))
+		for i := s.backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+		}
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return err
+		}
+	}
+	return s.open()
+}
+
+func (s *fileSink) WriteEntries(entries []Entry) error {
+	for i := range entries {
+		if s.f == nil || s.size >= s.maxSize {
+			var err error
+			if s.f == nil {
+				err = s.open()
+			} else {
+				err = s.rotate()
+			}
+			if err != nil {
+				return err
+			}
+		}
+		line := append(entries[i].JSON[:len(entries[i].JSON):len(entries[i].JSON)], '\n')
+		n, err := s.f.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
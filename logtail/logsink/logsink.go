@@ -0,0 +1,315 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package logsink sends copies of logtail log entries to additional,
+// user-configured destinations such as syslog, Grafana Loki, or a local
+// rotating file, alongside or instead of log.tailscale.io.
+//
+// Sinks are configured with URL-like specs:
+//
+//	syslog://host:514          RFC 5424 syslog over UDP
+//	syslog+tcp://host:601      RFC 5424 syslog over TCP (octet-counted)
+//	syslog+unix:///dev/log     RFC 5424 syslog over a Unix datagram socket
+//	loki+https://host/path     Grafana Loki push API (path defaults to /loki/api/v1/push)
+//	file:///var/log/ts.json    JSON lines, rotated by size
+//
+// Each spec may also have the query parameters "level" (the maximum
+// verbosity level to send, where 0 is non-verbose), "match" (a regular
+// expression that entries must match to be sent), and "exclude" (a regular
+// expression of entries not to send). The file sink also accepts
+// "maxsize" (bytes per file, default 10 MiB) and "backups" (number of
+// rotated files to keep, default 3).
+package logsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry is a log entry, as decoded from a logtail JSON log entry.
+type Entry struct {
+	Time  time.Time // client time of the entry, or zero if unknown
+	Level int       // verbosity level; 0 is non-verbose
+	Text  string    // the text of the entry, or empty for a structured entry
+
+	// JSON is the entry in the logtail JSON format, without a trailing
+	// newline.
+	JSON []byte
+}
+
+// Message returns the entry's text, or its JSON encoding if it's a
+// structured entry without any text.
+func (e *Entry) Message() string {
+	if e.Text != "" {
+		return strings.TrimRight(e.Text, "\n")
+	}
+	return string(e.JSON)
+}
+
+// ParseEntry decodes a logtail JSON log entry.
+func ParseEntry(jsonBlob []byte) (Entry, error) {
+	var j struct {
+		Logtail struct {
+			ClientTime time.Time `json:"client_time"`
+		} `json:"logtail"`
+		Level int    `json:"v"`
+		Text  string `json:"text"`
+	}
+	b := bytes.TrimRight(jsonBlob, "\n")
+	if err := json.Unmarshal(b, &j); err != nil {
+		return Entry{}, err
+	}
+	return Entry{
+		Time:  j.Logtail.ClientTime,
+		Level: j.Level,
+		Text:  j.Text,
+		JSON:  b,
+	}, nil
+}
+
+// A Sink is a destination for log entries.
+//
+// Implementations must not log, as they're called from within the logger.
+type Sink interface {
+	// WriteEntries sends a batch of entries to the sink.
+	WriteEntries([]Entry) error
+	// Close releases the sink's resources.
+	Close() error
+}
+
+// Filter selects which entries are sent to a sink.
+type Filter struct {
+	// MaxLevel is the maximum verbosity level of entries to send.
+	// Negative means no limit.
+	MaxLevel int
+	// Match, if non-nil, is a pattern that entries must match.
+	Match *regexp.Regexp
+	// Exclude, if non-nil, is a pattern of entries not to send.
+	Exclude *regexp.Regexp
+}
+
+// Allow reports whether e passes the filter.
+func (f *Filter) Allow(e *Entry) bool {
+	if f.MaxLevel >= 0 && e.Level > f.MaxLevel {
+		return false
+	}
+	if f.Match == nil && f.Exclude == nil {
+		return true
+	}
+	msg := e.Message()
+	if f.Match != nil && !f.Match.MatchString(msg) {
+		return false
+	}
+	if f.Exclude != nil && f.Exclude.MatchString(msg) {
+		return false
+	}
+	return true
+}
+
+// Parse returns the sink and filter described by spec. See the package
+// documentation for the spec format.
+func Parse(spec string) (Sink, Filter, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, Filter{}, fmt.Errorf("invalid log sink %q: %w", spec, err)
+	}
+	q := u.Query()
+	f := Filter{MaxLevel: -1}
+	if v := q.Get("level"); v != "" {
+		if f.MaxLevel, err = strconv.Atoi(v); err != nil || f.MaxLevel < 0 {
+			return nil, Filter{}, fmt.Errorf("invalid log sink %q: invalid level %q", spec, v)
+		}
+	}
+	if v := q.Get("match"); v != "" {
+		if f.Match, err = regexp.Compile(v); err != nil {
+			return nil, Filter{}, fmt.Errorf("invalid log sink %q: %w", spec, err)
+		}
+	}
+	if v := q.Get("exclude"); v != "" {
+		if f.Exclude, err = regexp.Compile(v); err != nil {
+			return nil, Filter{}, fmt.Errorf("invalid log sink %q: %w", spec, err)
+		}
+	}
+	for _, k := range []string{"level", "match", "exclude"} {
+		q.Del(k)
+	}
+
+	var s Sink
+	switch u.Scheme {
+	case "syslog", "syslog+udp":
+		s, err = newSyslogSink("udp", u.Host)
+	case "syslog+tcp":
+		s, err = newSyslogSink("tcp", u.Host)
+	case "syslog+unix":
+		s, err = newSyslogSink("unixgram", u.Path)
+	case "loki+http", "loki+https":
+		lu := *u
+		lu.Scheme = strings.TrimPrefix(u.Scheme, "loki+")
+		lu.RawQuery = q.Encode()
+		if lu.Path == "" || lu.Path == "/" {
+			lu.Path = "/loki/api/v1/push"
+		}
+		s, err = newLokiSink(lu.String())
+	case "file":
+		s, err = newFileSink(u.Path, q)
+	default:
+		return nil, Filter{}, fmt.Errorf("invalid log sink %q: unknown scheme %q", spec, u.Scheme)
+	}
+	if err != nil {
+		return nil, Filter{}, fmt.Errorf("log sink %q: %w", spec, err)
+	}
+	return s, f, nil
+}
+
+// queueSize is the number of entries buffered per sink before new
+// entries are dropped.
+const queueSize = 1024
+
+// maxBatch is the maximum number of entries passed to a single
+// WriteEntries call.
+const maxBatch = 256
+
+// Dispatcher is an io.Writer that accepts logtail JSON log entries and
+// forwards them asynchronously to a set of filtered sinks. Writes never
+// block on a sink; if a sink falls behind, entries for it are dropped.
+type Dispatcher struct {
+	sinks []*queuedSink
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex // guards closed and sends to the sink queues
+	closed bool
+}
+
+type queuedSink struct {
+	s       Sink
+	f       Filter
+	ch      chan Entry
+	dropped atomic.Int64
+}
+
+// NewDispatcher parses specs and returns a Dispatcher that sends to the
+// resulting sinks. If any spec is invalid, the sinks that were already
+// created are closed and an error is returned.
+func NewDispatcher(specs []string) (*Dispatcher, error) {
+	d := &Dispatcher{}
+	for _, spec := range specs {
+		s, f, err := Parse(spec)
+		if err != nil {
+			for _, qs := range d.sinks {
+				qs.s.Close()
+			}
+			return nil, err
+		}
+		d.sinks = append(d.sinks, &queuedSink{s: s, f: f, ch: make(chan Entry, queueSize)})
+	}
+	for _, qs := range d.sinks {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			qs.run()
+		}()
+	}
+	return d, nil
+}
+
+// Write implements io.Writer. b must be one or more newline-terminated
+// logtail JSON log entries. It always reports success, so as to not
+// interfere with logging.
+func (d *Dispatcher) Write(b []byte) (int, error) {
+	n := len(b)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return n, nil
+	}
+	for len(b) > 0 {
+		line := b
+		if i := bytes.IndexByte(b, '\n'); i != -1 {
+			line, b = b[:i+1], b[i+1:]
+		} else {
+			b = nil
+		}
+		e, err := ParseEntry(line)
+		if err != nil {
+			continue
+		}
+		// The caller may reuse its buffer.
+		e.JSON = append([]byte(nil), e.JSON...)
+		for _, qs := range d.sinks {
+			if !qs.f.Allow(&e) {
+				continue
+			}
+			select {
+			case qs.ch <- e:
+			default:
+				qs.dropped.Add(1)
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close flushes any queued entries and closes all sinks.
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	for _, qs := range d.sinks {
+		close(qs.ch)
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+	var errs []error
+	for _, qs := range d.sinks {
+		if err := qs.s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DroppedEntries returns the total number of entries that weren't
+// delivered, either because a sink's queue was full or because the sink
+// returned an error.
+func (d *Dispatcher) DroppedEntries() int64 {
+	var n int64
+	for _, qs := range d.sinks {
+		n += qs.dropped.Load()
+	}
+	return n
+}
+
+func (qs *queuedSink) run() {
+	batch := make([]Entry, 0, maxBatch)
+	for e := range qs.ch {
+		batch = append(batch[:0], e)
+	fill:
+		for len(batch) < maxBatch {
+			select {
+			case e, ok := <-qs.ch:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, e)
+			default:
+				break fill
+			}
+		}
+		if err := qs.s.WriteEntries(batch); err != nil {
+			qs.dropped.Add(int64(len(batch)))
+		}
+	}
+}
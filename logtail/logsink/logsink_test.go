@@ -0,0 +1,172 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logsink
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func entryJSON(level int, text string) string {
+	return `{"logtail":{"client_time":"2024-05-01T12:00:00Z"},"v":` + string(rune('0'+level)) + `,"text":"` + text + `\n"}` + "\n"
+}
+
+func TestParseEntry(t *testing.T) {
+	e, err := ParseEntry([]byte(entryJSON(1, "hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Level != 1 || e.Message() != "hello" || !e.Time.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseEntry = %+v", e)
+	}
+
+	e, err = ParseEntry([]byte(`{"foo":"bar"}` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Message(); got != `{"foo":"bar"}` {
+		t.Errorf("Message of structured entry = %q", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"ftp://foo",
+		"syslog://",
+		"syslog://host-without-port",
+		"file://",
+		"file:///tmp/x?maxsize=-1",
+		"file:///tmp/x?level=verbose",
+		"file:///tmp/x?match=(",
+	} {
+		if _, _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded; want error", spec)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	_, f, err := Parse("syslog://127.0.0.1:514?level=0&match=magicsock&exclude=noisy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		e    Entry
+		want bool
+	}{
+		{Entry{Text: "magicsock: endpoint update"}, true},
+		{Entry{Text: "magicsock: noisy thing"}, false},
+		{Entry{Text: "netmap: update"}, false},
+		{Entry{Level: 1, Text: "magicsock: verbose"}, false},
+	}
+	for _, tt := range tests {
+		if got := f.Allow(&tt.e); got != tt.want {
+			t.Errorf("Allow(%q, v%d) = %v; want %v", tt.e.Text, tt.e.Level, got, tt.want)
+		}
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tailscaled.json")
+	d, err := NewDispatcher([]string{"file://" + path + "?maxsize=100&backups=1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"one", "two", "three"} {
+		d.Write([]byte(entryJSON(0, text)))
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d.Write([]byte(entryJSON(0, "after close"))) // must not panic
+
+	cur, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(cur), `"three\n"`) || !strings.Contains(string(old), `"two\n"`) {
+		t.Errorf("unexpected rotation; current = %q, backup = %q", cur, old)
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Errorf("backup beyond limit exists: %v", err)
+	}
+}
+
+func TestLokiSink(t *testing.T) {
+	got := make(chan []byte, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		b, _ := io.ReadAll(r.Body)
+		got <- b
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	d, err := NewDispatcher([]string{"loki+" + ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.Write([]byte(entryJSON(0, "hello loki")))
+
+	var req struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	select {
+	case b := <-got:
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for push")
+	}
+	if len(req.Streams) != 1 || len(req.Streams[0].Values) != 1 {
+		t.Fatalf("unexpected push: %+v", req)
+	}
+	st := req.Streams[0]
+	if st.Stream["level"] != "info" || st.Values[0][1] != "hello loki" || st.Values[0][0] != "1714564800000000000" {
+		t.Errorf("unexpected stream: %+v", st)
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	d, err := NewDispatcher([]string{"syslog://" + pc.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.Write([]byte(entryJSON(1, "hello syslog")))
+
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	const wantPrefix = "<31>1 2024-05-01T12:00:00.000000Z "
+	if !strings.HasPrefix(msg, wantPrefix) || !strings.HasSuffix(msg, " - - hello syslog") {
+		t.Errorf("syslog message = %q", msg)
+	}
+}
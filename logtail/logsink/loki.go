@@ -0,0 +1,95 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// lokiSink sends entries to the Grafana Loki push API.
+type lokiSink struct {
+	url    string
+	httpc  *http.Client
+	labels map[string]string // labels common to all streams
+}
+
+func newLokiSink(pushURL string) (*lokiSink, error) {
+	hostname, _ := os.Hostname()
+	return &lokiSink{
+		url:   pushURL,
+		httpc: &http.Client{Timeout: 10 * time.Second},
+		labels: map[string]string{
+			"job":  filepath.Base(os.Args[0]),
+			"host": hostname,
+		},
+	}, nil
+}
+
+// lokiStream is a stream in a Loki push request.
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"` // [unix nanoseconds, line]
+}
+
+func (s *lokiSink) WriteEntries(entries []Entry) error {
+	// Entries are grouped into one stream per level, so that the
+	// level can be a label.
+	var streams []*lokiStream
+	byLevel := map[string]*lokiStream{}
+	for i := range entries {
+		e := &entries[i]
+		level := "info"
+		if e.Level > 0 {
+			level = "debug"
+		}
+		st, ok := byLevel[level]
+		if !ok {
+			st = &lokiStream{Stream: map[string]string{"level": level}}
+			for k, v := range s.labels {
+				st.Stream[k] = v
+			}
+			byLevel[level] = st
+			streams = append(streams, st)
+		}
+		t := e.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(t.UnixNano(), 10), e.Message()})
+	}
+	body, err := json.Marshal(struct {
+		Streams []*lokiStream `json:"streams"`
+	}{streams})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.httpc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<10))
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("loki push: unexpected HTTP status %v", res.Status)
+	}
+	return nil
+}
+
+func (s *lokiSink) Close() error {
+	s.httpc.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logsink
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	syslogFacilityDaemon = 3
+	syslogSeverityInfo   = 6
+	syslogSeverityDebug  = 7
+)
+
+// maxSyslogDatagram is the maximum size of a syslog message sent over a
+// datagram transport. Longer messages are truncated.
+const maxSyslogDatagram = 8 << 10
+
+// syslogSink sends entries as RFC 5424 syslog messages.
+type syslogSink struct {
+	network, addr string
+	hostname      string
+	appName       string
+	pid           string
+
+	conn net.Conn // or nil if not connected
+	buf  []byte   // owned by WriteEntries for reuse
+}
+
+func newSyslogSink(network, addr string) (*syslogSink, error) {
+	if addr == "" {
+		return nil, errors.New("no syslog address")
+	}
+	if network != "unixgram" {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, err
+		}
+	}
+	hostname, _ := os.Hostname()
+	return &syslogSink{
+		network:  network,
+		addr:     addr,
+		hostname: syslogHeaderValue(hostname),
+		appName:  syslogHeaderValue(filepath.Base(os.Args[0])),
+		pid:      strconv.Itoa(os.Getpid()),
+	}, nil
+}
+
+// syslogHeaderValue returns s, or the RFC 5424 NILVALUE if s is empty.
+func syslogHeaderValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// appendMessage appends e formatted as an RFC 5424 syslog message.
+func (s *syslogSink) appendMessage(dst []byte, e *Entry) []byte {
+	sev := syslogSeverityInfo
+	if e.Level > 0 {
+		sev = syslogSeverityDebug
+	}
+	t := e.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	dst = fmt.Appendf(dst, "<%d>1 %s %s %s %s - - ",
+		syslogFacilityDaemon*8+sev,
+		t.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		s.hostname, s.appName, s.pid)
+	return append(dst, e.Message()...)
+}
+
+func (s *syslogSink) WriteEntries(entries []Entry) error {
+	if s.conn == nil {
+		c, err := net.DialTimeout(s.network, s.addr, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn = c
+	}
+	for i := range entries {
+		msg := s.appendMessage(s.buf[:0], &entries[i])
+		s.buf = msg
+		var err error
+		if s.network == "tcp" {
+			// Use octet-counting framing, per RFC 6587.
+			_, err = fmt.Fprintf(s.conn, "%d %s", len(msg), msg)
+		} else {
+			if len(msg) > maxSyslogDatagram {
+				msg = msg[:maxSyslogDatagram]
+			}
+			_, err = s.conn.Write(msg)
+		}
+		if err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
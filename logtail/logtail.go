@@ -26,6 +26,7 @@
 
 	"github.com/go-json-experiment/json/jsontext"
 	"tailscale.com/envknob"
+	"tailscale.com/logtail/redact"
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/sockstats"
 	"tailscale.com/net/tsaddr"
@@ -79,6 +80,16 @@ type Config struct {
 	Buffer         Buffer          // temp storage, if nil a MemoryBuffer
 	CompressLogs   bool            // whether to compress the log uploads
 
+	// LocalLog, if non-nil, is where a copy of every log entry is written,
+	// even if uploads are disabled. The entries are newline-terminated
+	// JSON objects. Writes to it must not log.
+	LocalLog io.Writer
+
+	// Sinks, if non-nil, is where another copy of every log entry is
+	// written, in the same format as LocalLog, for forwarding to
+	// user-configured destinations. See package logsink.
+	Sinks io.Writer
+
 	// MetricsDelta, if non-nil, is a func that returns an encoding
 	// delta in clientmetrics to upload alongside existing logs.
 	// It can return either an empty string (for nothing) or a string
@@ -163,6 +174,8 @@ func NewLogger(cfg Config, logf tslogger.Logf) *Logger {
 		flushDelayFn:   cfg.FlushDelayFn,
 		clock:          cfg.Clock,
 		metricsDelta:   cfg.MetricsDelta,
+		localLog:       cfg.LocalLog,
+		sinks:          cfg.Sinks,
 
 		procID:              procID,
 		includeProcSequence: cfg.IncludeProcSequence,
@@ -202,6 +215,8 @@ type Logger struct {
 	uploadCancel   func()
 	explainedRaw   bool
 	metricsDelta   func() string // or nil
+	localLog       io.Writer     // or nil
+	sinks          io.Writer     // or nil
 	privateID      logid.PrivateID
 	httpDoCalls    atomic.Int32
 	sockstatsLabel atomicSocktatsLabel
@@ -585,6 +600,12 @@ func (l *Logger) tryDrainWake() {
 
 func (l *Logger) sendLocked(jsonBlob []byte) (int, error) {
 	tapSend(jsonBlob)
+	if l.localLog != nil {
+		l.localLog.Write(jsonBlob) // best effort; there's nowhere to report failures
+	}
+	if l.sinks != nil {
+		l.sinks.Write(jsonBlob)
+	}
 	if logtailDisabled.Load() {
 		return len(jsonBlob), nil
 	}
@@ -830,6 +851,17 @@ func (l *Logger) Logf(format string, args ...any) {
 
 var obscureIPs = envknob.RegisterBool("TS_OBSCURE_LOGGED_IPS")
 
+// redactor redacts log entries before they're written to stderr, local logs,
+// log sinks, log taps or uploaded. Like log taps, it applies to all Loggers.
+var redactor atomic.Pointer[redact.Redactor]
+
+// SetRedactor sets the Redactor that redacts user-defined sensitive data
+// from all log entries before they're written anywhere. A nil r redacts
+// nothing.
+func SetRedactor(r *redact.Redactor) {
+	redactor.Store(r)
+}
+
 // Write logs an encoded JSON blob.
 //
 // If the []byte passed to Write is not an encoded JSON blob,
@@ -843,6 +875,7 @@ func (l *Logger) Write(buf []byte) (int, error) {
 	inLen := len(buf) // length as provided to us, before modifications to downstream writers
 
 	level, buf := parseAndRemoveLogLevel(buf)
+	buf = redactor.Load().Redact(buf)
 	if l.stderr != nil && l.stderr != io.Discard && int64(level) <= atomic.LoadInt64(&l.stderrLevel) {
 		if buf[len(buf)-1] == '\n' {
 			l.stderr.Write(buf)
@@ -16,6 +16,7 @@
 
 	"github.com/go-json-experiment/json/jsontext"
 	"tailscale.com/envknob"
+	"tailscale.com/logtail/redact"
 	"tailscale.com/tstest"
 	"tailscale.com/tstime"
 	"tailscale.com/util/must"
@@ -161,6 +162,60 @@ func TestLoggerWriteLength(t *testing.T) {
 	}
 }
 
+func TestLoggerLocalLog(t *testing.T) {
+	var local bytes.Buffer
+	lg := &Logger{
+		clock:    tstime.StdClock{},
+		buffer:   NewMemoryBuffer(1024),
+		localLog: &local,
+	}
+	lg.Write([]byte("first"))
+	lg.Write([]byte("second"))
+	lines := strings.Split(strings.TrimSuffix(local.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("local log = %q; want 2 lines", local.String())
+	}
+	for i, want := range []string{"first", "second"} {
+		var e struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &e); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if e.Text != want {
+			t.Errorf("line %d text = %q; want %q", i, e.Text, want)
+		}
+	}
+}
+
+func TestLoggerRedactor(t *testing.T) {
+	r, err := redact.New([]redact.Rule{{Regexp: `secret-\w+`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetRedactor(r)
+	defer SetRedactor(nil)
+
+	var local, stderr bytes.Buffer
+	lg := &Logger{
+		clock:       tstime.StdClock{},
+		buffer:      NewMemoryBuffer(1024),
+		localLog:    &local,
+		stderr:      &stderr,
+		stderrLevel: 1,
+	}
+	lg.Write([]byte("[v1] host secret-db is up\n"))
+	for name, got := range map[string]string{
+		"local log": local.String(),
+		"stderr":    stderr.String(),
+		"upload":    string(lg.drainPending()),
+	} {
+		if strings.Contains(got, "secret-db") || !strings.Contains(got, "host [redacted] is up") {
+			t.Errorf("%s = %q; want it redacted", name, got)
+		}
+	}
+}
+
 func TestParseAndRemoveLogLevel(t *testing.T) {
 	tests := []struct {
 		log       string
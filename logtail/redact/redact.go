@@ -0,0 +1,182 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package redact removes user-defined sensitive data, such as hostnames and
+// IP ranges, from log entries before they're written anywhere.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"slices"
+)
+
+// DefaultReplacement is what redacted data is replaced with if a Rule
+// doesn't say otherwise.
+const DefaultReplacement = "[redacted]"
+
+// Rule is a log redaction rule. Exactly one of Regexp, Prefix and Field must
+// be set.
+type Rule struct {
+	// Regexp, if non-empty, is an RE2 regular expression whose matches
+	// are redacted.
+	Regexp string `json:",omitempty"`
+
+	// Prefix, if valid, is an IP address range whose addresses are
+	// redacted.
+	Prefix netip.Prefix `json:",omitzero,omitempty"`
+
+	// Field, if non-empty, is the name of fields of structured (JSON) log
+	// entries whose values are redacted, at any depth.
+	Field string `json:",omitempty"`
+
+	// Replacement is what redacted data is replaced with. If empty,
+	// DefaultReplacement is used.
+	Replacement string `json:",omitempty"`
+}
+
+func (r Rule) replacement() []byte {
+	if r.Replacement == "" {
+		return []byte(DefaultReplacement)
+	}
+	return []byte(r.Replacement)
+}
+
+// Redactor redacts log entries according to a set of rules. A nil Redactor
+// redacts nothing.
+type Redactor struct {
+	rules  []Rule
+	res    []*regexp.Regexp // parallel to rules; nil for non-Regexp rules
+	fields map[string][]byte
+	hasIP  bool
+}
+
+// New returns a Redactor for rules. It returns nil if there are no rules.
+func New(rules []Rule) (*Redactor, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	r := &Redactor{
+		rules: slices.Clone(rules),
+		res:   make([]*regexp.Regexp, len(rules)),
+	}
+	for i, rule := range rules {
+		n := 0
+		if rule.Regexp != "" {
+			n++
+			re, err := regexp.Compile(rule.Regexp)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			r.res[i] = re
+		}
+		if rule.Prefix.IsValid() {
+			n++
+			r.hasIP = true
+		}
+		if rule.Field != "" {
+			n++
+			if r.fields == nil {
+				r.fields = map[string][]byte{}
+			}
+			r.fields[rule.Field] = rule.replacement()
+		}
+		if n != 1 {
+			return nil, fmt.Errorf("rule %d: want exactly one of Regexp, Prefix and Field", i+1)
+		}
+	}
+	return r, nil
+}
+
+// Rules returns the rules of r.
+func (r *Redactor) Rules() []Rule {
+	if r == nil {
+		return nil
+	}
+	return slices.Clone(r.rules)
+}
+
+// ipCandidate matches text that might be an IP address, to be checked with
+// netip.ParseAddr.
+var ipCandidate = regexp.MustCompile(`[0-9a-fA-F]*:[0-9a-fA-F:.]*[0-9a-fA-F]|\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}`)
+
+// Redact returns entry, a text line or JSON object, with the data matched by
+// r's rules redacted. It doesn't modify entry.
+func (r *Redactor) Redact(entry []byte) []byte {
+	if r == nil {
+		return entry
+	}
+	if len(r.fields) > 0 && len(entry) > 0 && entry[0] == '{' {
+		entry = r.redactFields(entry)
+	}
+	for i, rule := range r.rules {
+		if re := r.res[i]; re != nil {
+			entry = re.ReplaceAllLiteral(entry, rule.replacement())
+		}
+	}
+	if r.hasIP {
+		entry = ipCandidate.ReplaceAllFunc(entry, func(b []byte) []byte {
+			ip, err := netip.ParseAddr(string(b))
+			if err != nil {
+				return b
+			}
+			for _, rule := range r.rules {
+				if rule.Prefix.IsValid() && rule.Prefix.Contains(ip.Unmap()) {
+					return rule.replacement()
+				}
+			}
+			return b
+		})
+	}
+	return entry
+}
+
+// redactFields redacts the values of r's fields in the JSON object entry. It
+// returns entry unchanged if it's not a JSON object.
+func (r *Redactor) redactFields(entry []byte) []byte {
+	d := json.NewDecoder(bytes.NewReader(entry))
+	d.UseNumber()
+	var v map[string]any
+	if err := d.Decode(&v); err != nil {
+		return entry
+	}
+	if _, err := d.Token(); !errors.Is(err, io.EOF) {
+		return entry // trailing data; not a JSON object
+	}
+	changed := false
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, e := range v {
+				if repl, ok := r.fields[k]; ok {
+					v[k] = string(repl)
+					changed = true
+					continue
+				}
+				walk(e)
+			}
+		case []any:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(v)
+	if !changed {
+		return entry
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return entry
+	}
+	if entry[len(entry)-1] == '\n' {
+		out = append(out, '\n')
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package redact
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	r, err := New([]Rule{
+		{Regexp: `db-[0-9]+\.corp\.example\.com`},
+		{Prefix: netip.MustParsePrefix("10.1.0.0/16"), Replacement: "10.1.x.x"},
+		{Prefix: netip.MustParsePrefix("fd12:3456::/32")},
+		{Field: "hostname"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{
+			"dialing db-12.corp.example.com at 10.1.2.3:5432 via 10.2.0.1",
+			"dialing [redacted] at 10.1.x.x:5432 via 10.2.0.1",
+		},
+		{
+			"route [fd12:3456::1]:41641 and [fd7a:115c:a1e0::1]:41641",
+			"route [[redacted]]:41641 and [fd7a:115c:a1e0::1]:41641",
+		},
+		{
+			`{"peer":{"hostname":"laptop","addr":"10.1.0.9"},"n":1}` + "\n",
+			`{"n":1,"peer":{"addr":"10.1.x.x","hostname":"[redacted]"}}` + "\n",
+		},
+		{
+			`{"hostname":"laptop"} trailing`,
+			`{"hostname":"laptop"} trailing`,
+		},
+		{"nothing to see", "nothing to see"},
+	}
+	for _, tt := range tests {
+		if got := string(r.Redact([]byte(tt.in))); got != tt.want {
+			t.Errorf("Redact(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+		}
+	}
+
+	var nilRedactor *Redactor
+	if got := string(nilRedactor.Redact([]byte("10.1.2.3"))); got != "10.1.2.3" {
+		t.Errorf("nil Redactor redacted: %q", got)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, rules := range [][]Rule{
+		{{Regexp: "("}},
+		{{}},
+		{{Regexp: "x", Field: "y"}},
+	} {
+		if _, err := New(rules); err == nil {
+			t.Errorf("New(%+v) succeeded; want error", rules)
+		}
+	}
+	if r, err := New(nil); r != nil || err != nil {
+		t.Errorf("New(nil) = %v, %v; want nil, nil", r, err)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package ringlog is a size-capped, compressed on-disk ring buffer of log
+// entries. It keeps diagnostics locally even when log uploads are disabled.
+package ringlog
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/util/zstdframe"
+)
+
+const (
+	defaultMaxSize     = 50 << 20
+	defaultSegmentSize = 1 << 20
+)
+
+const segmentSuffix = ".zst"
+
+// Options configures a Log.
+type Options struct {
+	// MaxSize is the maximum total size in bytes of the compressed
+	// segments kept on disk. The oldest segments are deleted once it's
+	// exceeded. If zero, 50 MiB is used.
+	MaxSize int64
+
+	// SegmentSize is how many bytes of uncompressed log entries are
+	// accumulated before they're compressed into a new segment.
+	// If zero, 1 MiB is used.
+	SegmentSize int64
+}
+
+// A Log is an on-disk ring buffer of newline-delimited log entries.
+//
+// Entries are appended to an uncompressed file until it reaches the
+// configured segment size, at which point it's compressed into a new,
+// immutable segment file.
+type Log struct {
+	prefix      string // segments are prefix.<seq>.zst; the current file is prefix.cur
+	maxSize     int64
+	segmentSize int64
+
+	mu      sync.Mutex
+	cur     *os.File // or nil once closed
+	curSize int64
+	segs    []segment // oldest first
+	nextSeq uint64
+}
+
+type segment struct {
+	seq  uint64
+	size int64
+}
+
+// New opens or creates a Log whose files are named with the given path
+// prefix, reusing any segments left by a previous process.
+func New(prefix string, opts Options) (*Log, error) {
+	l := &Log{
+		prefix:      prefix + ".ring",
+		maxSize:     opts.MaxSize,
+		segmentSize: opts.SegmentSize,
+	}
+	if l.maxSize <= 0 {
+		l.maxSize = defaultMaxSize
+	}
+	if l.segmentSize <= 0 {
+		l.segmentSize = defaultSegmentSize
+	}
+
+	names, err := filepath.Glob(l.prefix + ".*" + segmentSuffix)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		seqStr := strings.TrimSuffix(strings.TrimPrefix(name, l.prefix+"."), segmentSuffix)
+		seq, err := strconv.ParseUint(seqStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		l.segs = append(l.segs, segment{seq: seq, size: fi.Size()})
+		l.nextSeq = max(l.nextSeq, seq+1)
+	}
+	slices.SortFunc(l.segs, func(a, b segment) int { return cmp.Compare(a.seq, b.seq) })
+
+	l.cur, err = os.OpenFile(l.prefix+".cur", os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := l.cur.Stat()
+	if err != nil {
+		l.cur.Close()
+		return nil, err
+	}
+	l.curSize = fi.Size()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.curSize >= l.segmentSize {
+		if err := l.sealLocked(); err != nil {
+			l.cur.Close()
+			return nil, err
+		}
+	}
+	l.pruneLocked()
+	return l, nil
+}
+
+func (l *Log) segmentName(seq uint64) string {
+	return fmt.Sprintf("%s.%020d%s", l.prefix, seq, segmentSuffix)
+}
+
+// Write appends one or more newline-terminated log entries to the log.
+//
+// Write must not log, as it's typically called from within a logger.
+func (l *Log) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cur == nil {
+		return 0, os.ErrClosed
+	}
+	n, err := l.cur.Write(b)
+	l.curSize += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if l.curSize >= l.segmentSize {
+		if err := l.sealLocked(); err != nil {
+			return n, err
+		}
+		l.pruneLocked()
+	}
+	return n, nil
+}
+
+// sealLocked compresses the current file into a new segment and
+// truncates the current file.
+//
+// l.mu must be held.
+func (l *Log) sealLocked() error {
+	raw, err := os.ReadFile(l.cur.Name())
+	if err != nil {
+		return err
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	seq := l.nextSeq
+	name := l.segmentName(seq)
+	tmp := name + ".tmp"
+	data := zstdframe.AppendEncode(nil, raw, zstdframe.FastestCompression)
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := l.cur.Truncate(0); err != nil {
+		return err
+	}
+	l.curSize = 0
+	l.nextSeq++
+	l.segs = append(l.segs, segment{seq: seq, size: int64(len(data))})
+	return nil
+}
+
+// pruneLocked deletes the oldest segments until the total size of all
+// segments is at most l.maxSize.
+//
+// l.mu must be held.
+func (l *Log) pruneLocked() {
+	var total int64
+	for _, s := range l.segs {
+		total += s.size
+	}
+	for len(l.segs) > 0 && total > l.maxSize {
+		s := l.segs[0]
+		if err := os.Remove(l.segmentName(s.seq)); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		total -= s.size
+		l.segs = l.segs[1:]
+	}
+}
+
+// Close closes the log. Subsequent writes fail.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cur == nil {
+		return nil
+	}
+	err := l.cur.Close()
+	l.cur = nil
+	return err
+}
+
+// Export writes to w, oldest first, the log entries that were logged at
+// or after since. If since is zero, all entries are written.
+//
+// Entries are expected to be JSON objects in the logtail format; an
+// entry's time is read from its logtail.client_time member. Entries
+// without a time are always included.
+func (l *Log) Export(w io.Writer, since time.Time) error {
+	l.mu.Lock()
+	if l.cur == nil {
+		l.mu.Unlock()
+		return os.ErrClosed
+	}
+	segs := slices.Clone(l.segs)
+	cur, err := os.ReadFile(l.cur.Name())
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range segs {
+		name := l.segmentName(s.seq)
+		if !since.IsZero() {
+			// A segment is written once, when its last entry is
+			// sealed, so its modification time bounds its entries.
+			if fi, err := os.Stat(name); err == nil && fi.ModTime().Before(since) {
+				continue
+			}
+		}
+		data, err := os.ReadFile(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // pruned since we looked
+		}
+		if err != nil {
+			return err
+		}
+		raw, err := zstdframe.AppendDecode(nil, data)
+		if err != nil {
+			return fmt.Errorf("decoding %s: %w", filepath.Base(name), err)
+		}
+		if err := writeEntriesSince(w, raw, since); err != nil {
+			return err
+		}
+	}
+	return writeEntriesSince(w, cur, since)
+}
+
+// writeEntriesSince writes the newline-delimited entries in b that were
+// logged at or after since.
+func writeEntriesSince(w io.Writer, b []byte, since time.Time) error {
+	if since.IsZero() {
+		_, err := w.Write(b)
+		return err
+	}
+	for len(b) > 0 {
+		line := b
+		if i := bytes.IndexByte(b, '\n'); i != -1 {
+			line, b = b[:i+1], b[i+1:]
+		} else {
+			b = nil
+		}
+		if t := entryTime(line); !t.IsZero() && t.Before(since) {
+			continue
+		}
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryTime returns the client time of a logtail JSON entry,
+// or the zero time if it can't be determined.
+func entryTime(line []byte) time.Time {
+	var e struct {
+		Logtail struct {
+			ClientTime time.Time `json:"client_time"`
+		} `json:"logtail"`
+	}
+	if json.Unmarshal(line, &e) != nil {
+		return time.Time{}
+	}
+	return e.Logtail.ClientTime
+}
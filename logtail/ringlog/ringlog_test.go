@@ -0,0 +1,114 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package ringlog
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func entry(t time.Time, text string) string {
+	return fmt.Sprintf(`{"logtail":{"client_time":%q},"text":%q}`+"\n", t.Format(time.RFC3339Nano), text)
+}
+
+func TestLog(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "tailscaled")
+	l, err := New(prefix, Options{MaxSize: 1 << 20, SegmentSize: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().Add(-time.Hour)
+	var want strings.Builder
+	for i := range 20 {
+		e := entry(base.Add(time.Duration(i)*time.Minute), fmt.Sprintf("entry %d", i))
+		want.WriteString(e)
+		if _, err := l.Write([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(l.segs) == 0 {
+		t.Fatalf("no segments sealed")
+	}
+
+	var got bytes.Buffer
+	if err := l.Export(&got, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("Export = %q; want %q", got.String(), want.String())
+	}
+
+	got.Reset()
+	if err := l.Export(&got, base.Add(15*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(got.String()), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[0], "entry 15") {
+		t.Errorf("Export since 15m = %q; want entries 15 through 19", lines)
+	}
+
+	// Reopening keeps the existing entries.
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = New(prefix, Options{MaxSize: 1 << 20, SegmentSize: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	got.Reset()
+	if err := l.Export(&got, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("Export after reopen = %q; want %q", got.String(), want.String())
+	}
+}
+
+func TestLogPrune(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "tailscaled")
+	l, err := New(prefix, Options{MaxSize: 1000, SegmentSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	now := time.Now()
+	for i := range 500 {
+		// Vary the text so that the segments don't compress away.
+		if _, err := fmt.Fprint(l, entry(now, fmt.Sprintf("entry %d %x", i, i*7919))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := filepath.Glob(prefix + ".ring.*" + segmentSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(l.segs) {
+		t.Errorf("%d segment files on disk; want %d", len(files), len(l.segs))
+	}
+	var total int64
+	for _, s := range l.segs {
+		total += s.size
+	}
+	if total > 1000 {
+		t.Errorf("total segment size = %d; want <= 1000", total)
+	}
+
+	var got bytes.Buffer
+	if err := l.Export(&got, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got.String(), `"entry 0 `) {
+		t.Errorf("oldest entry not pruned")
+	}
+	if !strings.Contains(got.String(), `"entry 499 `) {
+		t.Errorf("newest entry missing")
+	}
+}
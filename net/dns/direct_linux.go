@@ -57,10 +57,12 @@ func (m *directManager) runFileWatcher() {
 }
 
 var resolvTrampleWarnable = health.Register(&health.Warnable{
-	Code:     "resolv-conf-overwritten",
-	Severity: health.SeverityMedium,
-	Title:    "Linux DNS configuration issue",
-	Text:     health.StaticMessage("Linux DNS config not ideal. /etc/resolv.conf overwritten. See https://tailscale.com/s/dns-fight"),
+	Code:           "resolv-conf-overwritten",
+	Severity:       health.SeverityMedium,
+	Title:          "Linux DNS configuration issue",
+	Text:           health.StaticMessage("Linux DNS config not ideal. /etc/resolv.conf overwritten. See https://tailscale.com/s/dns-fight"),
+	Component:      health.ComponentDNS,
+	RemediationURL: "https://tailscale.com/s/dns-fight",
 })
 
 // checkForFileTrample checks whether /etc/resolv.conf has been trampled
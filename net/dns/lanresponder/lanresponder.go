@@ -0,0 +1,367 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package lanresponder answers multicast DNS (mDNS, RFC 6762) and LLMNR
+// (RFC 4795) queries on the local networks of a node for its MagicDNS name,
+// so that devices on those networks that aren't in the tailnet can find the
+// node by name.
+package lanresponder
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+	"tailscale.com/net/netmon"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/dnsname"
+)
+
+// protocol is a multicast name resolution protocol.
+type protocol struct {
+	name  string
+	group netip.Addr
+	port  uint16
+	// ttl is the TTL of the records in responses.
+	ttl uint32
+}
+
+var (
+	mdns  = protocol{name: "mdns", group: netip.MustParseAddr("224.0.0.251"), port: 5353, ttl: 120}
+	llmnr = protocol{name: "llmnr", group: netip.MustParseAddr("224.0.0.252"), port: 5355, ttl: 30}
+)
+
+const (
+	// classTopBit is the top bit of the class of mDNS questions and records:
+	// the unicast-response bit of questions and the cache-flush bit of
+	// records.
+	classTopBit = 1 << 15
+
+	// legacyUnicastTTL is the TTL of the records in mDNS responses to
+	// queriers that aren't full mDNS implementations. See RFC 6762,
+	// section 6.7.
+	legacyUnicastTTL = 10
+
+	// maxPacketSize is the largest query read.
+	maxPacketSize = 9000
+)
+
+// Responder answers mDNS and LLMNR queries for a name on the local
+// networks of the machine, with the Tailscale addresses of the node.
+type Responder struct {
+	logf   logger.Logf
+	netMon *netmon.Monitor
+
+	listeners  []*listener
+	unregister func() // unregisters the netMon change callback
+
+	mu     sync.Mutex
+	names  map[protocol][]string // lower-case names with trailing dots
+	addrs  []netip.Addr
+	closed bool
+}
+
+// listener is a socket that receives the queries of a protocol.
+type listener struct {
+	proto  protocol
+	pc     *ipv4.PacketConn
+	joined map[int]bool // by interface index; guarded by Responder.mu
+}
+
+// New returns a new Responder that answers queries on the local network
+// interfaces known to netMon, now and as they change. It answers nothing until
+// SetName is called.
+func New(logf logger.Logf, netMon *netmon.Monitor) (*Responder, error) {
+	if netMon == nil {
+		return nil, errors.New("nil netMon")
+	}
+	r := &Responder{
+		logf:   logger.WithPrefix(logf, "lanresponder: "),
+		netMon: netMon,
+	}
+	for _, proto := range []protocol{mdns, llmnr} {
+		c, err := net.ListenMulticastUDP("udp4", nil, &net.UDPAddr{IP: proto.group.AsSlice(), Port: int(proto.port)})
+		if err != nil {
+			r.closeListeners()
+			return nil, err
+		}
+		pc := ipv4.NewPacketConn(c)
+		if err := pc.SetControlMessage(ipv4.FlagInterface, true); err != nil {
+			r.logf("[v1] %s: no interface control messages: %v", proto.name, err)
+		}
+		pc.SetMulticastTTL(255)
+		pc.SetMulticastLoopback(false)
+		r.listeners = append(r.listeners, &listener{proto: proto, pc: pc, joined: map[int]bool{}})
+	}
+	r.joinGroups(netMon.InterfaceState())
+	r.unregister = netMon.RegisterChangeCallback(func(delta *netmon.ChangeDelta) {
+		r.joinGroups(delta.New)
+	})
+	for _, l := range r.listeners {
+		go r.serve(l)
+	}
+	return r, nil
+}
+
+// isLANInterface reports whether the queries received on the interface iface
+// with addresses pfxs are to be answered.
+func isLANInterface(iface netmon.Interface, pfxs []netip.Prefix) bool {
+	if !iface.IsUp() || iface.IsLoopback() || iface.Flags&net.FlagMulticast == 0 {
+		return false
+	}
+	if strings.HasPrefix(iface.Name, "tailscale") || iface.Name == "Tailscale" {
+		return false
+	}
+	return !slices.ContainsFunc(pfxs, func(p netip.Prefix) bool { return tsaddr.IsTailscaleIP(p.Addr()) })
+}
+
+// joinGroups joins the multicast groups of r's listeners on the local network
+// interfaces of st that they haven't yet joined.
+func (r *Responder) joinGroups(st *netmon.State) {
+	if st == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	lan := map[int]bool{}
+	for name, iface := range st.Interface {
+		if !isLANInterface(iface, st.InterfaceIPs[name]) {
+			continue
+		}
+		lan[iface.Index] = true
+		for _, l := range r.listeners {
+			if l.joined[iface.Index] {
+				continue
+			}
+			// Joining fails harmlessly on the interface that
+			// net.ListenMulticastUDP already joined.
+			if err := l.pc.JoinGroup(iface.Interface, &net.UDPAddr{IP: l.proto.group.AsSlice()}); err != nil {
+				r.logf("[v1] %s: joining group on %s: %v", l.proto.name, iface.Name, err)
+			}
+			l.joined[iface.Index] = true
+		}
+	}
+	for _, l := range r.listeners {
+		for idx := range l.joined {
+			if !lan[idx] {
+				delete(l.joined, idx)
+			}
+		}
+	}
+}
+
+// SetName sets the name to answer queries for, and the addresses to answer
+// with. Over mDNS, the first label of fqdn is also answered for in the .local
+// domain; over LLMNR, it's also answered for as a single-label name.
+//
+// An empty fqdn or no addresses stop answering queries.
+func (r *Responder) SetName(fqdn dnsname.FQDN, addrs []netip.Addr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fqdn == "" || len(addrs) == 0 {
+		r.names, r.addrs = nil, nil
+		return
+	}
+	full := strings.ToLower(string(fqdn))
+	short, _, _ := strings.Cut(full, ".")
+	r.names = map[protocol][]string{
+		mdns:  {full, short + ".local."},
+		llmnr: {full, short + "."},
+	}
+	r.addrs = slices.Clone(addrs)
+}
+
+// Close stops answering queries and releases r's sockets.
+func (r *Responder) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.mu.Unlock()
+	if r.unregister != nil {
+		r.unregister()
+	}
+	return r.closeListeners()
+}
+
+func (r *Responder) closeListeners() error {
+	var errs []error
+	for _, l := range r.listeners {
+		errs = append(errs, l.pc.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// serve answers the queries received by l until it's closed.
+func (r *Responder) serve(l *listener) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, cm, src, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			r.mu.Lock()
+			closed := r.closed
+			r.mu.Unlock()
+			if !closed {
+				r.logf("%s: read: %v", l.proto.name, err)
+			}
+			return
+		}
+		srcAddr, ok := src.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		srcAP := srcAddr.AddrPort()
+		if tsaddr.IsTailscaleIP(srcAP.Addr().Unmap()) {
+			continue
+		}
+
+		r.mu.Lock()
+		if cm != nil && !l.joined[cm.IfIndex] {
+			r.mu.Unlock()
+			continue
+		}
+		names, addrs := r.names[l.proto], r.addrs
+		r.mu.Unlock()
+
+		resp, unicast := respond(l.proto, names, addrs, buf[:n], srcAP.Port())
+		if resp == nil {
+			continue
+		}
+		dst := src
+		var wcm *ipv4.ControlMessage
+		if !unicast {
+			dst = &net.UDPAddr{IP: l.proto.group.AsSlice(), Port: int(l.proto.port)}
+			if cm != nil {
+				wcm = &ipv4.ControlMessage{IfIndex: cm.IfIndex}
+			}
+		}
+		if _, err := l.pc.WriteTo(resp, wcm, dst); err != nil {
+			r.logf("[v1] %s: write to %v: %v", l.proto.name, dst, err)
+		}
+	}
+}
+
+// respond returns the response to the query msg of proto received from source
+// port srcPort, when answering for names with addrs, and whether the response
+// is to be sent to the querier rather than to the multicast group. It returns
+// nil if there's nothing to answer.
+func respond(proto protocol, names []string, addrs []netip.Addr, msg []byte, srcPort uint16) (resp []byte, unicast bool) {
+	if len(names) == 0 {
+		return nil, false
+	}
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil || h.Response || h.OpCode != 0 {
+		return nil, false
+	}
+	qs, err := p.AllQuestions()
+	if err != nil {
+		return nil, false
+	}
+	if proto == llmnr && len(qs) != 1 {
+		// RFC 4795, section 2.1.1.
+		return nil, false
+	}
+
+	// Queries to the mDNS port from another port are from "legacy"
+	// resolvers that expect a conventional unicast DNS response. See RFC
+	// 6762, section 6.7.
+	legacy := proto == mdns && srcPort != mdns.port
+
+	var answers []dnsmessage.Resource
+	var answered []dnsmessage.Question
+	for _, q := range qs {
+		class := q.Class &^ classTopBit
+		if class != dnsmessage.ClassINET && class != dnsmessage.ClassANY {
+			continue
+		}
+		if !slices.Contains(names, strings.ToLower(q.Name.String())) {
+			continue
+		}
+		n := len(answers)
+		for _, a := range addrs {
+			rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: proto.ttl}
+			if proto == mdns {
+				if legacy {
+					rh.TTL = legacyUnicastTTL
+				} else {
+					rh.Class |= classTopBit // cache-flush; we own the name
+				}
+			}
+			switch {
+			case a.Is4() && (q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL):
+				rh.Type = dnsmessage.TypeA
+				answers = append(answers, dnsmessage.Resource{Header: rh, Body: &dnsmessage.AResource{A: a.As4()}})
+			case a.Is6() && (q.Type == dnsmessage.TypeAAAA || q.Type == dnsmessage.TypeALL):
+				rh.Type = dnsmessage.TypeAAAA
+				answers = append(answers, dnsmessage.Resource{Header: rh, Body: &dnsmessage.AAAAResource{AAAA: a.As16()}})
+			}
+		}
+		if len(answers) > n {
+			if q.Class&classTopBit != 0 {
+				unicast = true
+			}
+			q.Class = class
+			answered = append(answered, q)
+		}
+	}
+	if len(answers) == 0 {
+		return nil, false
+	}
+
+	rh := dnsmessage.Header{Response: true}
+	switch {
+	case proto == llmnr:
+		rh.ID = h.ID
+		unicast = true
+	case legacy:
+		rh.ID = h.ID
+		rh.Authoritative = true
+		unicast = true
+	default:
+		// mDNS responses have no ID and, usually, no questions.
+		rh.Authoritative = true
+		answered = nil
+	}
+	b := dnsmessage.NewBuilder(nil, rh)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, false
+	}
+	for _, q := range answered {
+		if err := b.Question(q); err != nil {
+			return nil, false
+		}
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, false
+	}
+	for _, a := range answers {
+		var err error
+		switch body := a.Body.(type) {
+		case *dnsmessage.AResource:
+			err = b.AResource(a.Header, *body)
+		case *dnsmessage.AAAAResource:
+			err = b.AAAAResource(a.Header, *body)
+		}
+		if err != nil {
+			return nil, false
+		}
+	}
+	resp, err = b.Finish()
+	if err != nil {
+		return nil, false
+	}
+	return resp, unicast
+}
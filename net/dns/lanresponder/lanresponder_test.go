@@ -0,0 +1,176 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package lanresponder
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func query(t *testing.T, id uint16, name string, typ dnsmessage.Type, class dnsmessage.Class) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id})
+	b.StartQuestions()
+	if err := b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: typ, Class: class}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestRespond(t *testing.T) {
+	addrs := []netip.Addr{netip.MustParseAddr("100.101.102.103"), netip.MustParseAddr("fd7a:115c:a1e0::1")}
+	mdnsNames := []string{"foo.tail-scale.ts.net.", "foo.local."}
+	llmnrNames := []string{"foo.tail-scale.ts.net.", "foo."}
+
+	tests := []struct {
+		name        string
+		proto       protocol
+		names       []string
+		msg         []byte
+		srcPort     uint16
+		wantNil     bool
+		wantUnicast bool
+		wantID      uint16
+		wantQs      int
+		wantTypes   []dnsmessage.Type
+		wantClass   dnsmessage.Class
+		wantTTL     uint32
+	}{
+		{
+			name:      "mdns-a",
+			proto:     mdns,
+			names:     mdnsNames,
+			msg:       query(t, 0, "Foo.local.", dnsmessage.TypeA, dnsmessage.ClassINET),
+			srcPort:   5353,
+			wantTypes: []dnsmessage.Type{dnsmessage.TypeA},
+			wantClass: dnsmessage.ClassINET | classTopBit,
+			wantTTL:   120,
+		},
+		{
+			name:        "mdns-qu-all",
+			proto:       mdns,
+			names:       mdnsNames,
+			msg:         query(t, 0, "foo.tail-scale.ts.net.", dnsmessage.TypeALL, dnsmessage.ClassINET|classTopBit),
+			srcPort:     5353,
+			wantUnicast: true,
+			wantTypes:   []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA},
+			wantClass:   dnsmessage.ClassINET | classTopBit,
+			wantTTL:     120,
+		},
+		{
+			name:        "mdns-legacy",
+			proto:       mdns,
+			names:       mdnsNames,
+			msg:         query(t, 42, "foo.local.", dnsmessage.TypeAAAA, dnsmessage.ClassINET),
+			srcPort:     40000,
+			wantUnicast: true,
+			wantID:      42,
+			wantQs:      1,
+			wantTypes:   []dnsmessage.Type{dnsmessage.TypeAAAA},
+			wantClass:   dnsmessage.ClassINET,
+			wantTTL:     legacyUnicastTTL,
+		},
+		{
+			name:    "mdns-other-name",
+			proto:   mdns,
+			names:   mdnsNames,
+			msg:     query(t, 0, "bar.local.", dnsmessage.TypeA, dnsmessage.ClassINET),
+			srcPort: 5353,
+			wantNil: true,
+		},
+		{
+			name:    "mdns-single-label",
+			proto:   mdns,
+			names:   mdnsNames,
+			msg:     query(t, 0, "foo.", dnsmessage.TypeA, dnsmessage.ClassINET),
+			srcPort: 5353,
+			wantNil: true,
+		},
+		{
+			name:    "mdns-other-type",
+			proto:   mdns,
+			names:   mdnsNames,
+			msg:     query(t, 0, "foo.local.", dnsmessage.TypeTXT, dnsmessage.ClassINET),
+			srcPort: 5353,
+			wantNil: true,
+		},
+		{
+			name:    "no-name",
+			proto:   mdns,
+			msg:     query(t, 0, "foo.local.", dnsmessage.TypeA, dnsmessage.ClassINET),
+			srcPort: 5353,
+			wantNil: true,
+		},
+		{
+			name:        "llmnr",
+			proto:       llmnr,
+			names:       llmnrNames,
+			msg:         query(t, 7, "FOO.", dnsmessage.TypeA, dnsmessage.ClassINET),
+			srcPort:     50000,
+			wantUnicast: true,
+			wantID:      7,
+			wantQs:      1,
+			wantTypes:   []dnsmessage.Type{dnsmessage.TypeA},
+			wantClass:   dnsmessage.ClassINET,
+			wantTTL:     30,
+		},
+		{
+			name:    "llmnr-local",
+			proto:   llmnr,
+			names:   llmnrNames,
+			msg:     query(t, 7, "foo.local.", dnsmessage.TypeA, dnsmessage.ClassINET),
+			srcPort: 50000,
+			wantNil: true,
+		},
+		{
+			name:    "garbage",
+			proto:   llmnr,
+			names:   llmnrNames,
+			msg:     []byte("not dns"),
+			srcPort: 50000,
+			wantNil: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, unicast := respond(tt.proto, tt.names, addrs, tt.msg, tt.srcPort)
+			if tt.wantNil {
+				if resp != nil {
+					t.Fatalf("got response, want none")
+				}
+				return
+			}
+			if resp == nil {
+				t.Fatal("got no response")
+			}
+			if unicast != tt.wantUnicast {
+				t.Errorf("unicast = %v; want %v", unicast, tt.wantUnicast)
+			}
+			var m dnsmessage.Message
+			if err := m.Unpack(resp); err != nil {
+				t.Fatal(err)
+			}
+			if !m.Response || m.ID != tt.wantID || len(m.Questions) != tt.wantQs {
+				t.Errorf("header = %+v with %d questions; want response with ID %d and %d questions", m.Header, len(m.Questions), tt.wantID, tt.wantQs)
+			}
+			var types []dnsmessage.Type
+			for _, a := range m.Answers {
+				types = append(types, a.Header.Type)
+				if a.Header.Class != tt.wantClass || a.Header.TTL != tt.wantTTL {
+					t.Errorf("answer class, TTL = %v, %v; want %v, %v", a.Header.Class, a.Header.TTL, tt.wantClass, tt.wantTTL)
+				}
+			}
+			if !slices.Equal(types, tt.wantTypes) {
+				t.Errorf("answer types = %v; want %v", types, tt.wantTypes)
+			}
+		})
+	}
+}
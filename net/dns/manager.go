@@ -226,6 +226,7 @@ func compileHostEntries(cfg Config) (hosts []*HostEntry) {
 	},
 	Severity:  health.SeverityLow,
 	DependsOn: []*health.Warnable{health.NetworkStatusWarnable},
+	Component: health.ComponentDNS,
 })
 
 var osConfigurationSetWarnable = health.Register(&health.Warnable{
@@ -236,6 +237,7 @@ func compileHostEntries(cfg Config) (hosts []*HostEntry) {
 	},
 	Severity:  health.SeverityMedium,
 	DependsOn: []*health.Warnable{health.NetworkStatusWarnable},
+	Component: health.ComponentDNS,
 })
 
 // compileConfig converts cfg into a quad-100 resolver configuration
@@ -558,10 +560,23 @@ func (m *Manager) Down() error {
 	return nil
 }
 
+// FlushCaches flushes the DNS caches of the OS, if it has any that this
+// package knows how to flush.
 func (m *Manager) FlushCaches() error {
+	if f, ok := m.os.(cacheFlusher); ok {
+		if err := f.FlushCaches(); err != nil {
+			return err
+		}
+	}
 	return flushCaches()
 }
 
+// cacheFlusher is an optional interface implemented by OSConfigurators that
+// can flush the DNS caches of the resolver they configure.
+type cacheFlusher interface {
+	FlushCaches() error
+}
+
 // CleanUp restores the system DNS configuration to its original state
 // in case the Tailscale daemon terminated without closing the router.
 // No other state needs to be instantiated before this runs.
@@ -68,6 +68,7 @@ type resolvedManager struct {
 	ifidx  int
 
 	configCR chan changeRequest // tracks OSConfigs changes and error responses
+	flushc   chan chan error    // requests to flush resolved's caches
 }
 
 func newResolvedManager(logf logger.Logf, health *health.Tracker, interfaceName string) (*resolvedManager, error) {
@@ -88,6 +89,7 @@ func newResolvedManager(logf logger.Logf, health *health.Tracker, interfaceName
 		ifidx:  iface.Index,
 
 		configCR: make(chan changeRequest),
+		flushc:   make(chan chan error),
 	}
 
 	go mgr.run(ctx)
@@ -118,6 +120,22 @@ func (m *resolvedManager) SetDNS(config OSConfig) error {
 	}
 }
 
+// FlushCaches flushes the DNS caches of systemd-resolved.
+func (m *resolvedManager) FlushCaches() error {
+	errc := make(chan error, 1) // see SetDNS
+	select {
+	case <-m.ctx.Done():
+		return m.ctx.Err()
+	case m.flushc <- errc:
+	}
+	select {
+	case <-m.ctx.Done():
+		return m.ctx.Err()
+	case err := <-errc:
+		return err
+	}
+}
+
 func (m *resolvedManager) run(ctx context.Context) {
 	var (
 		conn     *dbus.Conn
@@ -198,6 +216,12 @@ func (m *resolvedManager) run(ctx context.Context) {
 			}
 			err := m.setConfigOverDBus(ctx, rManager, configCR.config)
 			configCR.res <- err
+		case errc := <-m.flushc:
+			if rManager == nil {
+				errc <- fmt.Errorf("resolved DBus does not have a connection")
+				continue
+			}
+			errc <- rManager.CallWithContext(ctx, dbusResolvedInterface+".FlushCaches", 0).Err
 		case <-needsReconnect:
 			if err := reconnect(); err != nil {
 				m.logf("[v1] SystemBus reconnect error %T", err)
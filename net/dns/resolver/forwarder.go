@@ -193,6 +193,8 @@ func clampEDNSSize(packet []byte, maxSize uint16) {
 	Text:                health.StaticMessage("Tailscale can't reach the configured DNS servers. Internet connectivity may be affected."),
 	ImpactsConnectivity: true,
 	TimeToVisible:       15 * time.Second,
+	Component:           health.ComponentDNS,
+	RemediationURL:      "https://tailscale.com/kb/1054/dns",
 })
 
 type route struct {
@@ -844,16 +846,24 @@ func (f *forwarder) sendTCP(ctx context.Context, fq *forwardQuery, rr resolverAn
 
 // resolvers returns the resolvers to use for domain.
 func (f *forwarder) resolvers(domain dnsname.FQDN) []resolverAndDelay {
+	_, resolvers := f.route(domain)
+	return resolvers
+}
+
+// route returns the suffix of the route that matches domain and its
+// resolvers. If no route matches, suffix is empty and resolvers are the cloud
+// host fallback resolvers, if any.
+func (f *forwarder) route(domain dnsname.FQDN) (suffix dnsname.FQDN, resolvers []resolverAndDelay) {
 	f.mu.Lock()
 	routes := f.routes
 	cloudHostFallback := f.cloudHostFallback
 	f.mu.Unlock()
 	for _, route := range routes {
 		if route.Suffix == "." || route.Suffix.Contains(domain) {
-			return route.Resolvers
+			return route.Suffix, route.Resolvers
 		}
 	}
-	return cloudHostFallback // or nil if no fallback
+	return "", cloudHostFallback // or nil if no fallback
 }
 
 // GetUpstreamResolvers returns the resolvers that would be used to resolve
@@ -335,6 +335,63 @@ func (r *Resolver) GetUpstreamResolvers(name dnsname.FQDN) []*dnstype.Resolver {
 	return r.forwarder.GetUpstreamResolvers(name)
 }
 
+// QueryRoute describes how a Resolver answers a query, as returned by
+// [Resolver.Route].
+type QueryRoute struct {
+	// Local is whether queries are answered by the Resolver itself, because
+	// the name is a MagicDNS name or is in a domain that the Resolver is
+	// authoritative for. If so, the other fields are empty.
+	Local bool
+
+	// Suffix is the suffix of the DNS route that matched the name, or "."
+	// for the default route. It's empty if no route matched.
+	Suffix dnsname.FQDN
+
+	// Resolvers are the upstream resolvers to which queries are forwarded.
+	// If Suffix is empty, these are the cloud host's fallback resolvers, if
+	// any.
+	Resolvers []*dnstype.Resolver
+}
+
+// Route reports how r answers queries for name of type typ.
+func (r *Resolver) Route(name dnsname.FQDN, typ dns.Type) QueryRoute {
+	if typ == dns.TypePTR {
+		if _, rcode := r.resolveLocalReverse(name); rcode != dns.RCodeRefused {
+			return QueryRoute{Local: true}
+		}
+	} else if r.isLocalName(name) {
+		return QueryRoute{Local: true}
+	}
+	suffix, resolvers := r.forwarder.route(name)
+	ret := QueryRoute{Suffix: suffix}
+	for _, rr := range resolvers {
+		ret.Resolvers = append(ret.Resolvers, rr.name)
+	}
+	return ret
+}
+
+// isLocalName reports whether r answers forward (non-PTR) queries for name
+// itself rather than forwarding them.
+func (r *Resolver) isLocalName(name dnsname.FQDN) bool {
+	if name == dnsSymbolicFQDN || dnsname.HasSuffix(name.WithoutTrailingDot(), ".onion") {
+		return true
+	}
+	if _, ok := r.resolveViaDomain(name, dns.TypeAAAA); ok {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.hostToIP[name]; ok {
+		return true
+	}
+	for _, suffix := range r.localDomains {
+		if suffix.Contains(name) {
+			return true
+		}
+	}
+	return false
+}
+
 // parseExitNodeQuery parses a DNS request packet.
 // It returns nil if it's malformed or lacking a question.
 func parseExitNodeQuery(q []byte) *response {
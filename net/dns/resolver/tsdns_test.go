@@ -459,6 +459,49 @@ func TestResolveLocalReverse(t *testing.T) {
 	}
 }
 
+func TestRoute(t *testing.T) {
+	r := newResolver(t)
+	defer r.Close()
+
+	cfg := dnsCfg
+	cfg.Routes = map[dnsname.FQDN][]*dnstype.Resolver{
+		".":             {{Addr: "192.0.2.53"}},
+		"corp.example.": {{Addr: "10.0.0.53"}},
+	}
+	r.SetConfig(cfg)
+
+	tests := []struct {
+		name  string
+		qname dnsname.FQDN
+		qtype dns.Type
+		want  QueryRoute
+	}{
+		{"magicdns", "test1.ipn.dev.", dns.TypeA, QueryRoute{Local: true}},
+		{"authoritative", "test3.ipn.dev.", dns.TypeA, QueryRoute{Local: true}},
+		{"reverse", testipv4Arpa, dns.TypePTR, QueryRoute{Local: true}},
+		{"split", "git.corp.example.", dns.TypeA, QueryRoute{
+			Suffix:    "corp.example.",
+			Resolvers: []*dnstype.Resolver{{Addr: "10.0.0.53"}},
+		}},
+		{"default", "tailscale.com.", dns.TypeA, QueryRoute{
+			Suffix:    ".",
+			Resolvers: []*dnstype.Resolver{{Addr: "192.0.2.53"}},
+		}},
+		{"reverse_default", "4.3.2.10.in-addr.arpa.", dns.TypePTR, QueryRoute{
+			Suffix:    ".",
+			Resolvers: []*dnstype.Resolver{{Addr: "192.0.2.53"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.Route(tt.qname, tt.qtype)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Route(%q, %v) = %+v; want %+v", tt.qname, tt.qtype, got, tt.want)
+			}
+		})
+	}
+}
+
 func ipv6Works() bool {
 	c, err := net.Listen("tcp", "[::1]:0")
 	if err != nil {
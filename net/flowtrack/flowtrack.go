@@ -13,6 +13,7 @@
 	"container/list"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"net/netip"
 
 	"tailscale.com/types/ipproto"
@@ -52,8 +53,9 @@ func (t Tuple) DstAddr() netip.Addr {
 	return netip.AddrFrom16(t.dst).Unmap()
 }
 
-func (t Tuple) SrcPort() uint16 { return t.srcPort }
-func (t Tuple) DstPort() uint16 { return t.dstPort }
+func (t Tuple) SrcPort() uint16      { return t.srcPort }
+func (t Tuple) DstPort() uint16      { return t.dstPort }
+func (t Tuple) Proto() ipproto.Proto { return t.proto }
 
 func (t Tuple) String() string {
 	return fmt.Sprintf("(%v %v => %v)", t.proto,
@@ -161,5 +163,21 @@ func (c *Cache[Value]) removeElement(e *list.Element) {
 	delete(c.m, e.Value.(*entry[Value]).key)
 }
 
+// All returns an iterator over the cache's keys and values, from the most to
+// the least recently used. The cache must not be modified during iteration.
+func (c *Cache[Value]) All() iter.Seq2[Tuple, *Value] {
+	return func(yield func(Tuple, *Value) bool) {
+		if c.ll == nil {
+			return
+		}
+		for e := c.ll.Front(); e != nil; e = e.Next() {
+			ent := e.Value.(*entry[Value])
+			if !yield(ent.key, &ent.value) {
+				return
+			}
+		}
+	}
+}
+
 // Len returns the number of items in the cache.
 func (c *Cache[Value]) Len() int { return len(c.m) }
@@ -0,0 +1,343 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package memnet
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"tailscale.com/util/set"
+)
+
+// Faults are the network faults that a FaultInjector injects into the
+// connections it creates or dials.
+type Faults struct {
+	// Latency is how long data written to a connection takes to arrive at
+	// its peer. Writes don't wait for it.
+	Latency time.Duration
+
+	// DialLoss is the probability, from 0 to 1, that a dial is lost. Lost
+	// dials fail right away with a timeout error, as if the dial's packets
+	// had been dropped until it timed out.
+	DialLoss float64
+
+	// ResetAfter, if positive, is how many bytes a connection carries, in
+	// both directions combined, before it's reset. Once it's reset, reads
+	// and writes on it fail with an error wrapping syscall.ECONNRESET.
+	ResetAfter int64
+
+	// Seed seeds the choice of which dials are lost, so that the same
+	// sequence of dials is lost on every run of a test.
+	Seed uint64
+}
+
+// FaultInjector creates and dials connections with network faults injected,
+// to test how code copes with a flaky network. Its NewConn method can be
+// used as a Listener's NewConn, and WrapDial adapts dial funcs, such as
+// Listener.Dial or tsdial.Dialer.SystemDialForTest.
+//
+// The faults of a connection are those set when it was created. It is safe
+// for concurrent use.
+type FaultInjector struct {
+	mu     sync.Mutex
+	faults Faults
+	rnd    *rand.Rand
+	links  set.Set[*faultLink]
+}
+
+// NewFaultInjector returns a FaultInjector that injects faults f.
+func NewFaultInjector(f Faults) *FaultInjector {
+	fi := &FaultInjector{links: set.Set[*faultLink]{}}
+	fi.SetFaults(f)
+	return fi
+}
+
+// SetFaults sets the faults of future connections and dials to f.
+func (fi *FaultInjector) SetFaults(f Faults) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.faults = f
+	fi.rnd = rand.New(rand.NewPCG(f.Seed, f.Seed))
+}
+
+// NewConn is like the package-level NewConn, but with fi's faults injected
+// into the returned Conns. Its signature matches Listener.NewConn.
+func (fi *FaultInjector) NewConn(network, addr string, maxBuf int) (Conn, Conn) {
+	c1, c2 := NewConn(addr, maxBuf)
+	l := fi.newLink()
+	return l.wrap(c1), l.wrap(c2)
+}
+
+// WrapDial returns a dial func that dials with dial and injects fi's faults
+// into the dials and the connections it returns.
+func (fi *FaultInjector) WrapDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		fi.mu.Lock()
+		lost := fi.faults.DialLoss > 0 && fi.rnd.Float64() < fi.faults.DialLoss
+		fi.mu.Unlock()
+		if lost {
+			return nil, &net.OpError{Op: "dial", Net: network, Addr: connAddr(addr), Err: os.ErrDeadlineExceeded}
+		}
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if fc, ok := c.(*faultyConn); ok && fc.link.fi == fi {
+			return c, nil // from fi.NewConn; already faulty
+		}
+		return fi.newLink().wrap(c), nil
+	}
+}
+
+// ResetAll resets all the open connections of fi and reports how many it
+// reset. Both ends of connections from NewConn are reset; the peers of
+// connections from WrapDial see them close.
+func (fi *FaultInjector) ResetAll() int {
+	fi.mu.Lock()
+	links := fi.links.Slice()
+	fi.mu.Unlock()
+	n := 0
+	for _, l := range links {
+		if l.reset() {
+			n++
+		}
+	}
+	return n
+}
+
+// forget removes l from fi's open connections.
+func (fi *FaultInjector) forget(l *faultLink) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.links.Delete(l)
+}
+
+func (fi *FaultInjector) newLink() *faultLink {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	l := &faultLink{fi: fi, faults: fi.faults}
+	fi.links.Add(l)
+	return l
+}
+
+// faultLink is the state shared by the ends of a connection that faults
+// are injected into.
+type faultLink struct {
+	fi     *FaultInjector
+	faults Faults
+
+	mu      sync.Mutex
+	ends    []*faultyConn
+	open    int   // number of ends not closed
+	carried int64 // bytes written to either end
+	isReset bool
+}
+
+func (l *faultLink) wrap(c net.Conn) *faultyConn {
+	fc := &faultyConn{Conn: c, link: l}
+	if l.faults.Latency > 0 {
+		fc.queue = make(chan delayedWrite, 64)
+		go fc.deliver()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ends = append(l.ends, fc)
+	l.open++
+	return fc
+}
+
+// reset resets the connection, closing its ends to unblock their reads
+// and writes. It reports whether the connection wasn't already reset.
+func (l *faultLink) reset() bool {
+	l.mu.Lock()
+	if l.isReset {
+		l.mu.Unlock()
+		return false
+	}
+	l.isReset = true
+	ends := l.ends
+	l.mu.Unlock()
+	l.fi.forget(l)
+	for _, fc := range ends {
+		fc.Conn.Close()
+	}
+	return true
+}
+
+// carry records that n bytes are about to be written to the connection and
+// returns how many of them can be before it's reset, and whether it's
+// reset after they are.
+func (l *faultLink) carry(n int) (allowed int, reset bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.isReset {
+		return 0, true
+	}
+	if max := l.faults.ResetAfter; max > 0 && l.carried+int64(n) >= max {
+		allowed = int(max - l.carried)
+		l.carried = max
+		return allowed, true
+	}
+	l.carried += int64(n)
+	return n, false
+}
+
+func (l *faultLink) wasReset() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.isReset
+}
+
+func (l *faultLink) endClosed() {
+	l.mu.Lock()
+	l.open--
+	done := l.open == 0
+	l.mu.Unlock()
+	if done {
+		l.fi.forget(l)
+	}
+}
+
+// delayedWrite is data written to a faultyConn with latency, to be written
+// to the underlying Conn at a later time.
+type delayedWrite struct {
+	b  []byte
+	at time.Time
+}
+
+// faultyConn is one end of a connection that faults are injected into.
+type faultyConn struct {
+	net.Conn
+	link *faultLink
+
+	// queue is non-nil if the link has latency. It's closed by Close.
+	queue chan delayedWrite
+
+	mu     sync.Mutex // held while sending to queue
+	closed bool
+
+	errMu    sync.Mutex
+	writeErr error // from deliver
+}
+
+func (c *faultyConn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: NetworkName, Source: c.LocalAddr(), Addr: c.RemoteAddr(), Err: err}
+}
+
+func (c *faultyConn) Read(b []byte) (int, error) {
+	if c.isClosed() {
+		return 0, c.opError("read", net.ErrClosed)
+	}
+	if c.link.wasReset() {
+		return 0, c.opError("read", syscall.ECONNRESET)
+	}
+	n, err := c.Conn.Read(b)
+	if err != nil && c.link.wasReset() {
+		return 0, c.opError("read", syscall.ECONNRESET)
+	}
+	return n, err
+}
+
+func (c *faultyConn) Write(b []byte) (int, error) {
+	if c.link.wasReset() {
+		return 0, c.opError("write", syscall.ECONNRESET)
+	}
+	allowed, reset := c.link.carry(len(b))
+	n, err := c.write(b[:allowed])
+	if err == nil && reset {
+		c.link.reset()
+		err = c.opError("write", syscall.ECONNRESET)
+	}
+	return n, err
+}
+
+func (c *faultyConn) write(b []byte) (int, error) {
+	if c.queue == nil {
+		return c.Conn.Write(b)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, c.opError("write", net.ErrClosed)
+	}
+	c.errMu.Lock()
+	err := c.writeErr
+	c.errMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if len(b) > 0 {
+		c.queue <- delayedWrite{
+			b:  append([]byte(nil), b...),
+			at: time.Now().Add(c.link.faults.Latency),
+		}
+	}
+	return len(b), nil
+}
+
+// deliver writes the data queued by Write to the underlying Conn once its
+// latency has passed, and closes the Conn once Close has been called and
+// the data has been written.
+func (c *faultyConn) deliver() {
+	for w := range c.queue {
+		time.Sleep(time.Until(w.at))
+		if _, err := c.Conn.Write(w.b); err != nil {
+			c.errMu.Lock()
+			if c.writeErr == nil {
+				c.writeErr = err
+			}
+			c.errMu.Unlock()
+		}
+	}
+	c.Conn.Close()
+	c.link.endClosed()
+}
+
+// Close closes c. If c has latency, the underlying Conn is closed once the
+// data written to c has been delivered.
+func (c *faultyConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return c.opError("close", net.ErrClosed)
+	}
+	c.closed = true
+	if c.queue != nil {
+		close(c.queue)
+		return nil
+	}
+	defer c.link.endClosed()
+	if err := c.Conn.Close(); err != nil && !c.link.wasReset() {
+		return err
+	}
+	return nil
+}
+
+func (c *faultyConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+var errNotBlockable = errors.New("memnet: underlying conn can't be blocked")
+
+func (c *faultyConn) SetReadBlock(b bool) error {
+	if mc, ok := c.Conn.(Conn); ok {
+		return mc.SetReadBlock(b)
+	}
+	return errNotBlockable
+}
+
+func (c *faultyConn) SetWriteBlock(b bool) error {
+	if mc, ok := c.Conn.(Conn); ok {
+		return mc.SetWriteBlock(b)
+	}
+	return errNotBlockable
+}
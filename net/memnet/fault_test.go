@@ -0,0 +1,151 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package memnet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/net/nettest"
+)
+
+func TestFaultyConn(t *testing.T) {
+	nettest.TestConn(t, func() (c1 net.Conn, c2 net.Conn, stop func(), err error) {
+		c1, c2 = NewFaultInjector(Faults{}).NewConn("tcp", "test", bufferSize)
+		return c1, c2, func() {
+			c1.Close()
+			c2.Close()
+		}, nil
+	})
+}
+
+func TestFaultLatency(t *testing.T) {
+	const latency = 50 * time.Millisecond
+	c1, c2 := NewFaultInjector(Faults{Latency: latency}).NewConn("tcp", "test", bufferSize)
+	defer c2.Close()
+
+	start := time.Now()
+	if _, err := c1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= latency {
+		t.Errorf("Write took %v; want it not to wait for the latency", d)
+	}
+	c1.Close() // the data is still delivered
+
+	got, err := io.ReadAll(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("read %q; want %q", got, "hello")
+	}
+	if d := time.Since(start); d < latency {
+		t.Errorf("data arrived after %v; want at least %v", d, latency)
+	}
+}
+
+func TestFaultReset(t *testing.T) {
+	fi := NewFaultInjector(Faults{ResetAfter: 10})
+	c1, c2 := fi.NewConn("tcp", "test", bufferSize)
+	defer c1.Close()
+	defer c2.Close()
+
+	if _, err := c1.Write([]byte("0123")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	if n, err := c2.Read(buf); err != nil || n != 4 {
+		t.Fatalf("Read = %d, %v; want 4 bytes", n, err)
+	}
+	n, err := c2.Write([]byte("0123456789"))
+	if n != 6 || !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Write past reset = %d, %v; want 6 bytes and ECONNRESET", n, err)
+	}
+	if _, err := c1.Read(buf); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("peer Read after reset = %v; want ECONNRESET", err)
+	}
+	if _, err := c1.Write([]byte("x")); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("peer Write after reset = %v; want ECONNRESET", err)
+	}
+	if n := fi.ResetAll(); n != 0 {
+		t.Errorf("ResetAll = %d; want 0 for an already reset conn", n)
+	}
+}
+
+func TestFaultResetAll(t *testing.T) {
+	ln := Listen("srv.local")
+	defer ln.Close()
+	fi := NewFaultInjector(Faults{})
+	ln.NewConn = fi.NewConn
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(c, c)
+		}
+	}()
+
+	dial := fi.WrapDial(ln.Dial)
+	c, err := dial(context.Background(), "tcp", "srv.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, ok := c.(*faultyConn).Conn.(*connHalf); !ok {
+		t.Fatal("WrapDial wrapped a conn from fi.NewConn twice")
+	}
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := c.Read(make([]byte, 1))
+		readErr <- err
+	}()
+	if n := fi.ResetAll(); n != 1 {
+		t.Errorf("ResetAll = %d; want 1", n)
+	}
+	if err := <-readErr; !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("blocked Read = %v; want ECONNRESET", err)
+	}
+}
+
+func TestFaultDialLoss(t *testing.T) {
+	dialLosses := func(seed uint64) (lost []bool) {
+		fi := NewFaultInjector(Faults{DialLoss: 0.5, Seed: seed})
+		dial := fi.WrapDial(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			c1, c2 := NewConn(addr, bufferSize)
+			c2.Close()
+			return c1, nil
+		})
+		for range 20 {
+			c, err := dial(context.Background(), "tcp", "test")
+			if err == nil {
+				c.Close()
+			} else if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+				t.Fatalf("lost dial error %v isn't a timeout", err)
+			}
+			lost = append(lost, err != nil)
+		}
+		return lost
+	}
+	a, b := dialLosses(1), dialLosses(1)
+	var n int
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("dial losses differ with the same seed: %v, %v", a, b)
+		}
+		if a[i] {
+			n++
+		}
+	}
+	if n == 0 || n == len(a) {
+		t.Errorf("%d of %d dials lost; want some", n, len(a))
+	}
+}
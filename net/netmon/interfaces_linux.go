@@ -8,6 +8,7 @@
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"errors"
 	"fmt"
 	"io"
@@ -15,6 +16,7 @@
 	"net"
 	"net/netip"
 	"os"
+	"slices"
 	"strings"
 	"sync/atomic"
 
@@ -28,6 +30,7 @@
 
 func init() {
 	likelyHomeRouterIP = likelyHomeRouterIPLinux
+	likelyHomeRouterIPs = likelyHomeRouterIPsLinux
 }
 
 var procNetRouteErr atomic.Bool
@@ -122,6 +125,75 @@ func likelyHomeRouterIPLinux() (ret netip.Addr, myIP netip.Addr, ok bool) {
 	return netip.Addr{}, netip.Addr{}, false
 }
 
+// likelyHomeRouterIPsLinux returns the private gateways of the IPv4 routes
+// in /proc/net/route. Gateways of default routes come first, by increasing
+// metric, followed by the gateways of other routes in table order.
+func likelyHomeRouterIPsLinux() []GatewayCandidate {
+	if procNetRouteErr.Load() {
+		return nil
+	}
+	type route struct {
+		GatewayCandidate
+		isDefault bool
+		metric    uint64
+	}
+	var routes []route
+	lineNum := 0
+	var f []mem.RO
+	for lr := range lineiter.File(procNetRoutePath) {
+		line, err := lr.Value()
+		if err != nil {
+			return nil
+		}
+		lineNum++
+		if lineNum == 1 {
+			continue // header
+		}
+		if lineNum > maxProcNetRouteRead {
+			break
+		}
+		f = mem.AppendFields(f[:0], mem.B(line))
+		if len(f) < 7 {
+			continue
+		}
+		flags, err := mem.ParseUint(f[3], 16, 16)
+		if err != nil || flags&(unix.RTF_UP|unix.RTF_GATEWAY) != unix.RTF_UP|unix.RTF_GATEWAY {
+			continue
+		}
+		ipu32, err := mem.ParseUint(f[2], 16, 32)
+		if err != nil {
+			continue
+		}
+		ip := netaddr.IPv4(byte(ipu32), byte(ipu32>>8), byte(ipu32>>16), byte(ipu32>>24))
+		if !ip.IsPrivate() || slices.ContainsFunc(routes, func(r route) bool { return r.Gateway == ip }) {
+			continue
+		}
+		metric, _ := mem.ParseUint(f[6], 10, 32)
+		routes = append(routes, route{
+			GatewayCandidate: GatewayCandidate{Gateway: ip, Interface: f[0].StringCopy()},
+			isDefault:        f[1].EqualString("00000000"),
+			metric:           metric,
+		})
+	}
+	slices.SortStableFunc(routes, func(a, b route) int {
+		if a.isDefault != b.isDefault {
+			if a.isDefault {
+				return -1
+			}
+			return 1
+		}
+		if a.isDefault {
+			return cmp.Compare(a.metric, b.metric)
+		}
+		return 0
+	})
+	ret := make([]GatewayCandidate, len(routes))
+	for i, r := range routes {
+		ret[i] = r.GatewayCandidate
+	}
+	return ret
+}
+
 func defaultRoute() (d DefaultRouteDetails, err error) {
 	v, err := defaultRouteInterfaceProcNet()
 	if err == nil {
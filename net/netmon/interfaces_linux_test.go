@@ -7,8 +7,10 @@
 	"errors"
 	"fmt"
 	"io/fs"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"tailscale.com/tstest"
@@ -95,6 +97,31 @@ func TestAwsAppRunnerDefaultRouteInterface(t *testing.T) {
 	}
 }
 
+func TestLikelyHomeRouterIPsLinux(t *testing.T) {
+	dir := t.TempDir()
+	tstest.Replace(t, &procNetRoutePath, filepath.Join(dir, "route"))
+	buf := []byte("Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\tMTU\tWindow\tIRTT\n" +
+		"wlan0\t00000000\t0101A8C0\t0003\t0\t0\t600\t00000000\t0\t0\t0\n" +
+		"eth0\t0000010A\tFE00000A\t0003\t0\t0\t0\t0000FFFF\t0\t0\t0\n" + // static route to 10.1/16
+		"eth0\t00000000\t0100000A\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+		"eth1\t00000000\t0100000A\t0003\t0\t0\t200\t00000000\t0\t0\t0\n" + // duplicate gateway
+		"eth2\t00000000\t08080808\t0003\t0\t0\t0\t00000000\t0\t0\t0\n" + // not private
+		"eth3\t00000000\t0101A8C0\t0002\t0\t0\t0\t00000000\t0\t0\t0\n" + // not up
+		"eth0\t0000000A\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n") // no gateway
+	if err := os.WriteFile(procNetRoutePath, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+	got := likelyHomeRouterIPsLinux()
+	want := []GatewayCandidate{
+		{Gateway: netip.MustParseAddr("10.0.0.1"), Interface: "eth0"},
+		{Gateway: netip.MustParseAddr("192.168.1.1"), Interface: "wlan0"},
+		{Gateway: netip.MustParseAddr("10.0.0.254"), Interface: "eth0"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
 func BenchmarkDefaultRouteInterface(b *testing.B) {
 	b.ReportAllocs()
 	for range b.N {
@@ -0,0 +1,80 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netmon
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// NetworkIdentity identifies the network the machine is connected to via its
+// default route, such as a particular office or home network.
+//
+// Each field is empty if it could not be determined on this platform or
+// network.
+type NetworkIdentity struct {
+	// SSID is the SSID of the Wi-Fi network of the default route interface.
+	// It is only populated on platforms where a function to look it up was
+	// registered with RegisterSSIDGetter.
+	SSID string `json:",omitempty"`
+
+	// GatewayMAC is the hardware address of the default gateway, in the
+	// lower-case, colon-separated form returned by net.HardwareAddr.String.
+	GatewayMAC string `json:",omitempty"`
+
+	// Domain is the first DNS search domain of the network, as configured
+	// by DHCP or the administrator of the machine.
+	Domain string `json:",omitempty"`
+}
+
+// IsZero reports whether nothing about the network could be determined.
+func (id NetworkIdentity) IsZero() bool {
+	return id == NetworkIdentity{}
+}
+
+var (
+	altSSID func(ifName string) (string, error)
+
+	// gatewayHardwareAddr, if non-nil, returns the hardware address of the
+	// gateway with the given IP.
+	gatewayHardwareAddr func(gw netip.Addr) (net.HardwareAddr, error)
+
+	// networkSearchDomain, if non-nil, returns the first DNS search domain
+	// of the machine's non-Tailscale DNS configuration.
+	networkSearchDomain func() (string, error)
+)
+
+// RegisterSSIDGetter sets the function that's used to query the SSID of the
+// Wi-Fi network a network interface is connected to. The function should
+// return the empty string and no error for interfaces that aren't Wi-Fi
+// interfaces.
+func RegisterSSIDGetter(getSSID func(ifName string) (string, error)) {
+	altSSID = getSSID
+}
+
+// GetNetworkIdentity returns the identity of the network the machine is
+// connected to via the default route of st, which may be nil. Errors looking
+// up any of its parts leave the corresponding fields empty.
+func GetNetworkIdentity(st *State) NetworkIdentity {
+	var id NetworkIdentity
+	if altSSID != nil && st != nil && st.DefaultRouteInterface != "" {
+		if ssid, err := altSSID(st.DefaultRouteInterface); err == nil {
+			id.SSID = ssid
+		}
+	}
+	if gatewayHardwareAddr != nil {
+		if gw, _, ok := LikelyHomeRouterIP(); ok {
+			if mac, err := gatewayHardwareAddr(gw); err == nil && len(mac) > 0 {
+				id.GatewayMAC = mac.String()
+			}
+		}
+	}
+	if networkSearchDomain != nil {
+		if d, err := networkSearchDomain(); err == nil {
+			id.Domain = strings.ToLower(strings.TrimSuffix(d, "."))
+		}
+	}
+	return id
+}
@@ -0,0 +1,105 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !android
+
+package netmon
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+
+	"go4.org/mem"
+	"tailscale.com/util/lineiter"
+)
+
+func init() {
+	gatewayHardwareAddr = gatewayHardwareAddrLinux
+	networkSearchDomain = networkSearchDomainLinux
+}
+
+var (
+	procNetARPPath = "/proc/net/arp"
+
+	resolvConfPath = "/etc/resolv.conf"
+	// resolvConfBackupPath is where tailscaled's "direct" DNS manager keeps
+	// the original resolv.conf while it's managing /etc/resolv.conf itself.
+	resolvConfBackupPath = "/etc/resolv.pre-tailscale-backup.conf"
+)
+
+// arpFlagComplete is the ATF_COM flag of completed ARP table entries.
+const arpFlagComplete = 0x2
+
+/*
+Parse aa:bb:cc:dd:ee:ff out of:
+
+$ cat /proc/net/arp
+IP address       HW type     Flags       HW address            Mask     Device
+10.0.0.1         0x1         0x2         aa:bb:cc:dd:ee:ff     *        ens18
+*/
+func gatewayHardwareAddrLinux(gw netip.Addr) (net.HardwareAddr, error) {
+	lineNum := 0
+	var f []mem.RO
+	for lr := range lineiter.File(procNetARPPath) {
+		line, err := lr.Value()
+		if err != nil {
+			return nil, err
+		}
+		lineNum++
+		if lineNum == 1 {
+			// Skip header line.
+			continue
+		}
+		f = mem.AppendFields(f[:0], mem.B(line))
+		if len(f) < 4 {
+			continue
+		}
+		ip, err := netip.ParseAddr(f[0].StringCopy())
+		if err != nil || ip != gw {
+			continue
+		}
+		flags, err := mem.ParseUint(mem.TrimPrefix(f[2], mem.S("0x")), 16, 16)
+		if err != nil || flags&arpFlagComplete == 0 {
+			continue
+		}
+		return net.ParseMAC(f[3].StringCopy())
+	}
+	return nil, errors.New("gateway not in ARP table")
+}
+
+// networkSearchDomainLinux returns the first search domain in resolv.conf,
+// or in its backup if tailscaled has replaced it with its own.
+func networkSearchDomainLinux() (string, error) {
+	bs, err := os.ReadFile(resolvConfPath)
+	if err != nil {
+		return "", err
+	}
+	if bytes.Contains(bs, []byte("generated by tailscale")) {
+		if bs, err = os.ReadFile(resolvConfBackupPath); err != nil {
+			return "", err
+		}
+	}
+	return firstSearchDomain(bs), nil
+}
+
+// firstSearchDomain returns the first domain of the last "search" or
+// "domain" line of the resolv.conf contents bs, which is the one the
+// resolver uses, or the empty string if there's none.
+func firstSearchDomain(bs []byte) string {
+	var domain string
+	for line := range lineiter.Bytes(bs) {
+		f := strings.Fields(string(line))
+		if len(f) < 2 {
+			continue
+		}
+		switch f[0] {
+		case "search", "domain":
+			domain = f[1]
+		}
+	}
+	return domain
+}
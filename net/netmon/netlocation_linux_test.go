@@ -0,0 +1,76 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !android
+
+package netmon
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tailscale.com/tstest"
+)
+
+func TestGatewayHardwareAddrLinux(t *testing.T) {
+	dir := t.TempDir()
+	tstest.Replace(t, &procNetARPPath, filepath.Join(dir, "arp"))
+	buf := []byte("IP address       HW type     Flags       HW address            Mask     Device\n" +
+		"10.0.0.7         0x1         0x0         00:00:00:00:00:00     *        ens18\n" +
+		"10.0.0.1         0x1         0x2         AA:BB:CC:DD:EE:FF     *        ens18\n")
+	if err := os.WriteFile(procNetARPPath, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mac, err := gatewayHardwareAddrLinux(netip.MustParseAddr("10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mac.String(), "aa:bb:cc:dd:ee:ff"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Incomplete entries are skipped.
+	if mac, err := gatewayHardwareAddrLinux(netip.MustParseAddr("10.0.0.7")); err == nil {
+		t.Errorf("got %v for incomplete entry, want error", mac)
+	}
+}
+
+func TestNetworkSearchDomainLinux(t *testing.T) {
+	dir := t.TempDir()
+	tstest.Replace(t, &resolvConfPath, filepath.Join(dir, "resolv.conf"))
+	tstest.Replace(t, &resolvConfBackupPath, filepath.Join(dir, "resolv.pre-tailscale-backup.conf"))
+
+	write := func(path, s string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(want string) {
+		t.Helper()
+		got, err := networkSearchDomainLinux()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	write(resolvConfPath, "nameserver 10.0.0.1\nsearch corp.example.com example.com\n")
+	check("corp.example.com")
+
+	write(resolvConfPath, "domain old.example.com\nsearch corp.example.com\n")
+	check("corp.example.com")
+
+	write(resolvConfPath, "nameserver 10.0.0.1\n")
+	check("")
+
+	// When tailscaled manages resolv.conf itself, the original is used.
+	write(resolvConfPath, "# resolv.conf(5) file generated by tailscale\n# DO NOT EDIT THIS FILE BY HAND -- CHANGES WILL BE OVERWRITTEN\n\nnameserver 100.100.100.100\nsearch tail1234.ts.net\n")
+	write(resolvConfBackupPath, "search home.arpa\n")
+	check("home.arpa")
+}
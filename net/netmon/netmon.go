@@ -11,6 +11,7 @@
 	"errors"
 	"net/netip"
 	"runtime"
+	"slices"
 	"sync"
 	"time"
 
@@ -60,19 +61,21 @@ type Monitor struct {
 	// and not change at runtime.
 	tsIfName string // tailscale interface name, if known/set ("tailscale0", "utun3", ...)
 
-	mu         sync.Mutex // guards all following fields
-	cbs        set.HandleSet[ChangeFunc]
-	ruleDelCB  set.HandleSet[RuleDeleteCallback]
-	ifState    *State
-	gwValid    bool       // whether gw and gwSelfIP are valid
-	gw         netip.Addr // our gateway's IP
-	gwSelfIP   netip.Addr // our own IP address (that corresponds to gw)
-	started    bool
-	closed     bool
-	goroutines sync.WaitGroup
-	wallTimer  *time.Timer // nil until Started; re-armed AfterFunc per tick
-	lastWall   time.Time
-	timeJumped bool // whether we need to send a changed=true after a big time jump
+	mu           sync.Mutex // guards all following fields
+	cbs          set.HandleSet[ChangeFunc]
+	ruleDelCB    set.HandleSet[RuleDeleteCallback]
+	ifState      *State
+	gwValid      bool               // whether gw and gwSelfIP are valid
+	gw           netip.Addr         // our gateway's IP
+	gwSelfIP     netip.Addr         // our own IP address (that corresponds to gw)
+	gwCands      []GatewayCandidate // cached LikelyHomeRouterIPs; valid if gwCandsValid
+	gwCandsValid bool
+	started      bool
+	closed       bool
+	goroutines   sync.WaitGroup
+	wallTimer    *time.Timer // nil until Started; re-armed AfterFunc per tick
+	lastWall     time.Time
+	timeJumped   bool // whether we need to send a changed=true after a big time jump
 }
 
 // ChangeFunc is a callback function registered with Monitor that's called when the
@@ -201,6 +204,29 @@ func (m *Monitor) GatewayAndSelfIP() (gw, myIP netip.Addr, ok bool) {
 	return gw, myIP, ok
 }
 
+// GatewayCandidates returns the current network's candidate home routers,
+// most likely first.
+//
+// It's the same as LikelyHomeRouterIPs, but it caches the result until the
+// monitor detects a network change.
+func (m *Monitor) GatewayCandidates() []GatewayCandidate {
+	if m.static {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.gwCandsValid {
+		return m.gwCands
+	}
+	cands := LikelyHomeRouterIPs()
+	if !slices.Equal(cands, m.gwCands) {
+		m.logf("gateway candidates changed: %v", cands)
+	}
+	m.gwCands, m.gwCandsValid = cands, true
+	return cands
+}
+
 // RegisterChangeCallback adds callback to the set of parties to be
 // notified (in their own goroutine) when the network state changes.
 // To remove this callback, call unregister (or close the monitor).
@@ -441,6 +467,7 @@ func (m *Monitor) handlePotentialChange(newState *State, forceCallbacks bool) {
 	delta.Major = m.IsMajorChangeFrom(oldState, newState)
 	if delta.Major {
 		m.gwValid = false
+		m.gwCandsValid = false
 		m.ifState = newState
 
 		if s1, s2 := oldState.String(), delta.New.String(); s1 == s2 {
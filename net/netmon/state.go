@@ -611,6 +611,65 @@ func LikelyHomeRouterIP() (gateway, myIP netip.Addr, ok bool) {
 	return gateway, myIP, myIP.IsValid()
 }
 
+// GatewayCandidate is a router that may offer port mapping services, as
+// returned by LikelyHomeRouterIPs.
+type GatewayCandidate struct {
+	Gateway   netip.Addr // the router's IPv4 address, always private
+	MyIP      netip.Addr // this machine's IPv4 address on the router's network
+	Interface string     // the name of the interface to the router, or empty if unknown
+}
+
+// likelyHomeRouterIPs, if present, is a platform-specific function that
+// returns all the candidate home routers of the current system, most likely
+// first. Implementations may leave MyIP unset, in which case
+// LikelyHomeRouterIPs fills it in.
+var likelyHomeRouterIPs func() []GatewayCandidate
+
+// LikelyHomeRouterIPs returns the routers that might be the residential
+// router, most likely first. It's like LikelyHomeRouterIP, for machines with
+// multiple candidate gateways, such as a multi-homed host or one with
+// gateways of container bridges besides its real router.
+//
+// On platforms that can only determine one candidate, it returns the result
+// of LikelyHomeRouterIP, if any.
+func LikelyHomeRouterIPs() []GatewayCandidate {
+	if likelyHomeRouterIPs == nil {
+		gw, myIP, ok := LikelyHomeRouterIP()
+		if !ok {
+			return nil
+		}
+		return []GatewayCandidate{{Gateway: gw, MyIP: myIP}}
+	}
+	cands := likelyHomeRouterIPs()
+	var ret []GatewayCandidate
+	for _, c := range cands {
+		if disableLikelyHomeRouterIPSelf() {
+			c.MyIP = netip.Addr{}
+		}
+		if !c.MyIP.IsValid() {
+			c.MyIP = selfIPForGateway(c.Gateway, c.Interface)
+		}
+		if c.MyIP.IsValid() {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// selfIPForGateway returns this machine's private IPv4 address on the
+// network of gateway, on the named interface if ifName isn't empty.
+func selfIPForGateway(gateway netip.Addr, ifName string) (myIP netip.Addr) {
+	ForeachInterfaceAddress(func(i Interface, pfx netip.Prefix) {
+		if myIP.IsValid() || !i.IsUp() || (ifName != "" && i.Name != ifName) {
+			return
+		}
+		if ip := pfx.Addr(); ip.Is4() && ip.IsPrivate() && pfx.Contains(gateway) {
+			myIP = ip
+		}
+	})
+	return myIP
+}
+
 // isUsableV4 reports whether ip is a usable IPv4 address which could
 // conceivably be used to get Internet connectivity. Globally routable and
 // private IPv4 addresses are always Usable, and link local 169.254.x.x
@@ -0,0 +1,53 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build freebsd || openbsd
+
+package netns
+
+import (
+	"fmt"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"tailscale.com/net/netmon"
+	"tailscale.com/types/logger"
+)
+
+var bypassRoutingTable atomic.Int32
+
+// SetBypassRoutingTable sets the routing table (a FIB on FreeBSD, an rtable
+// on OpenBSD) that tailscaled's own sockets use, so that their packets don't
+// follow routes into Tailscale, such as an exit node's default routes.
+// The table must have the routes of the host without Tailscale. Zero, the
+// default, is the host's main routing table.
+//
+// It's only supported on FreeBSD and OpenBSD.
+func SetBypassRoutingTable(table int) {
+	bypassRoutingTable.Store(int32(table))
+}
+
+func control(logger.Logf, *netmon.Monitor) func(network, address string, c syscall.RawConn) error {
+	return controlC
+}
+
+// controlC puts c in the bypass routing table, if any, unless it's to
+// localhost, which the bypass table may have no routes for.
+func controlC(network, address string, c syscall.RawConn) error {
+	table := int(bypassRoutingTable.Load())
+	if table == 0 || isLocalhost(address) {
+		return nil
+	}
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, sockoptRoutingTable, table)
+	})
+	if err != nil {
+		return fmt.Errorf("setting routing table %d: %w", table, err)
+	}
+	if sockErr != nil {
+		return fmt.Errorf("setting routing table %d: %w", table, sockErr)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netns
+
+import "golang.org/x/sys/unix"
+
+// sockoptRoutingTable is the socket option that sets a socket's routing table.
+const sockoptRoutingTable = unix.SO_RTABLE
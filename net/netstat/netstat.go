@@ -14,7 +14,7 @@
 
 type Entry struct {
 	Local, Remote netip.AddrPort
-	Pid           int
+	Pid           int    // of the owning process, or zero if unknown, as on Linux
 	State         string // TODO: type?
 	OSMetadata    OSMetadata
 }
@@ -0,0 +1,136 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netstat
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/cpu"
+	"tailscale.com/util/lineiter"
+)
+
+// OSMetadata includes any additional OS-specific information that may be
+// obtained during the retrieval of a given Entry.
+type OSMetadata struct {
+	// UID is the user ID of the socket's owner.
+	UID uint32
+}
+
+// procNetTCPFiles are the kernel's TCP socket tables. The Pid of entries read
+// from them isn't known, and is zero.
+var procNetTCPFiles = []string{"/proc/net/tcp", "/proc/net/tcp6"}
+
+func get() (*Table, error) {
+	t := new(Table)
+	for _, name := range procNetTCPFiles {
+		if err := t.addEntries(name); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *Table) addEntries(name string) error {
+	first := true
+	for lr := range lineiter.File(name) {
+		line, err := lr.Value()
+		if err != nil {
+			return err
+		}
+		if first {
+			first = false // header
+			continue
+		}
+		e, err := parseEntry(string(line))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		t.Entries = append(t.Entries, e)
+	}
+	return nil
+}
+
+// parseEntry parses a line of /proc/net/tcp or /proc/net/tcp6, like:
+//
+//	0: 0100007F:0277 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 23456 1 ...
+func parseEntry(line string) (Entry, error) {
+	f := strings.Fields(line)
+	if len(f) < 8 {
+		return Entry{}, fmt.Errorf("short line %q", line)
+	}
+	local, err := parseAddrPort(f[1])
+	if err != nil {
+		return Entry{}, err
+	}
+	remote, err := parseAddrPort(f[2])
+	if err != nil {
+		return Entry{}, err
+	}
+	st, err := strconv.ParseUint(f[3], 16, 8)
+	if err != nil {
+		return Entry{}, fmt.Errorf("bad state %q", f[3])
+	}
+	uid, err := strconv.ParseUint(f[7], 10, 32)
+	if err != nil {
+		return Entry{}, fmt.Errorf("bad uid %q", f[7])
+	}
+	return Entry{
+		Local:      local,
+		Remote:     remote,
+		State:      state(st),
+		OSMetadata: OSMetadata{UID: uint32(uid)},
+	}, nil
+}
+
+// parseAddrPort parses an address like "0100007F:0277", whose IP is hex
+// encoded as 32-bit words in host byte order.
+func parseAddrPort(s string) (netip.AddrPort, error) {
+	ipHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("bad address %q", s)
+	}
+	ipb, err := hex.DecodeString(ipHex)
+	if err != nil || (len(ipb) != 4 && len(ipb) != 16) {
+		return netip.AddrPort{}, fmt.Errorf("bad address %q", s)
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("bad address %q", s)
+	}
+	if !cpu.IsBigEndian {
+		for w := ipb; len(w) > 0; w = w[4:] {
+			w[0], w[1], w[2], w[3] = w[3], w[2], w[1], w[0]
+		}
+	}
+	ip, _ := netip.AddrFromSlice(ipb)
+	return netip.AddrPortFrom(ip.Unmap(), uint16(port)), nil
+}
+
+// states are the names of TCP states, indexed by their value in the kernel's
+// tables, named as on Windows.
+var states = []string{
+	"",
+	"ESTABLISHED",
+	"SYN-SENT",
+	"SYN-RECEIVED",
+	"FIN-WAIT-1",
+	"FIN-WAIT-2",
+	"TIME-WAIT",
+	"CLOSED",
+	"CLOSE-WAIT",
+	"LAST-ACK",
+	"LISTEN",
+	"CLOSING",
+}
+
+func state(v uint64) string {
+	if v < uint64(len(states)) {
+		return states[v]
+	}
+	return fmt.Sprintf("unknown-state-%d", v)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netstat
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		line string
+		want Entry
+	}{
+		{
+			line: "   0: 0100007F:0277 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 23456 1 0000000000000000 100 0 0 10 0",
+			want: Entry{
+				Local:  netip.MustParseAddrPort("127.0.0.1:631"),
+				Remote: netip.MustParseAddrPort("0.0.0.0:0"),
+				State:  "LISTEN",
+			},
+		},
+		{
+			line: "   1: 0100007F:C2D4 0100007F:0438 01 00000000:00000000 00:00000000 00000000  1000        0 34567 1 0000000000000000 20 4 30 10 -1",
+			want: Entry{
+				Local:      netip.MustParseAddrPort("127.0.0.1:49876"),
+				Remote:     netip.MustParseAddrPort("127.0.0.1:1080"),
+				State:      "ESTABLISHED",
+				OSMetadata: OSMetadata{UID: 1000},
+			},
+		},
+		{
+			line: "   2: 00000000000000000000000001000000:9C40 0000000000000000FFFF00000100007F:0050 06 00000000:00000000 03:00000C7E 00000000     0        0 0 3 0000000000000000",
+			want: Entry{
+				Local:  netip.MustParseAddrPort("[::1]:40000"),
+				Remote: netip.MustParseAddrPort("127.0.0.1:80"),
+				State:  "TIME-WAIT",
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseEntry(tt.line)
+		if err != nil {
+			t.Errorf("parseEntry(%q): %v", tt.line, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseEntry(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
@@ -70,6 +70,56 @@ func UpdateDstAddr(q *packet.Parsed, dst netip.Addr) {
 	}
 }
 
+// ClampTCPMSS lowers the maximum segment size option of the TCP SYN or
+// SYN-ACK in q to mss if it is larger, and updates the TCP checksum. It
+// reports whether q was modified.
+func ClampTCPMSS(q *packet.Parsed, mss uint16) bool {
+	if q.IPProto != ipproto.TCP || q.TCPFlags&packet.TCPSyn == 0 {
+		return false
+	}
+	tr := q.Transport()
+	if len(tr) < header.TCPMinimumSize {
+		return false
+	}
+	hlen := int(tr[12]>>4) * 4
+	if hlen < header.TCPMinimumSize || hlen > len(tr) {
+		return false
+	}
+	opts := tr[header.TCPMinimumSize:hlen]
+	for len(opts) > 0 {
+		switch opts[0] {
+		case header.TCPOptionEOL:
+			return false
+		case header.TCPOptionNOP:
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || opts[1] < 2 || int(opts[1]) > len(opts) {
+			// Malformed options; leave the packet alone.
+			return false
+		}
+		if opts[0] == header.TCPOptionMSS && opts[1] == header.TCPOptionMSSLength {
+			if binary.BigEndian.Uint16(opts[2:4]) <= mss {
+				return false
+			}
+			// The checksum is updated a 16-bit word at a time, so
+			// cover the words the MSS value straddles if it is not
+			// aligned to one.
+			off := hlen - len(opts) + 2
+			start, end := off&^1, (off+3)&^1
+			var old [4]byte
+			n := copy(old[:], tr[start:end])
+			binary.BigEndian.PutUint16(tr[off:off+2], mss)
+			// Ones' complement checksum updates don't depend on
+			// the IP version.
+			updateV4Checksum(tr[16:18], old[:n], tr[start:end])
+			return true
+		}
+		opts = opts[opts[1]:]
+	}
+	return false
+}
+
 // updateV4PacketChecksums updates the checksums in the packet buffer.
 // Currently (2023-03-01) only TCP/UDP/ICMP over IPv4 is supported.
 // p is modified in place.
@@ -221,3 +221,62 @@ func TestNatChecksumsV6TCP(t *testing.T) {
 		t.Fatal("incorrect checksum after updating destination address")
 	}
 }
+
+func TestClampTCPMSS(t *testing.T) {
+	a1, a2 := randV6Addr(), randV6Addr()
+	src, dst := tcpip.AddrFrom16Slice(a1.AsSlice()), tcpip.AddrFrom16Slice(a2.AsSlice())
+
+	// Options: NOP, NOP, window scale, MSS 8940.
+	opts := []byte{
+		header.TCPOptionNOP, header.TCPOptionNOP,
+		header.TCPOptionWS, header.TCPOptionWSLength, 7,
+		header.TCPOptionMSS, header.TCPOptionMSSLength, 0x22, 0xec,
+		header.TCPOptionEOL, 0, 0,
+	}
+	tcpLen := header.TCPMinimumSize + len(opts)
+	makeSYN := func(flags header.TCPFlags) (header.TCP, []byte) {
+		b := header.IPv6(make([]byte, header.IPv6MinimumSize+tcpLen))
+		b.Encode(&header.IPv6Fields{
+			PayloadLength:     uint16(tcpLen),
+			TransportProtocol: header.TCPProtocolNumber,
+			HopLimit:          16,
+			SrcAddr:           src,
+			DstAddr:           dst,
+		})
+		tcp := header.TCP(b[header.IPv6MinimumSize:])
+		tcp.Encode(&header.TCPFields{
+			SrcPort:    42,
+			DstPort:    43,
+			SeqNum:     1,
+			DataOffset: uint8(tcpLen),
+			Flags:      flags,
+			WindowSize: 4,
+		})
+		copy(tcp[header.TCPMinimumSize:], opts)
+		xsum := header.PseudoHeaderChecksum(header.TCPProtocolNumber, src, dst, uint16(tcpLen))
+		tcp.SetChecksum(^tcp.CalculateChecksum(xsum))
+		return tcp, b
+	}
+
+	tcp, b := makeSYN(header.TCPFlagSyn)
+	var p packet.Parsed
+	p.Decode(b)
+	if ClampTCPMSS(&p, 9000) {
+		t.Error("clamped an MSS that was already small enough")
+	}
+	if !ClampTCPMSS(&p, 1200) {
+		t.Fatal("MSS not clamped")
+	}
+	if got := header.ParseSynOptions(tcp.Options(), false).MSS; got != 1200 {
+		t.Errorf("MSS = %d, want 1200", got)
+	}
+	if !tcp.IsChecksumValid(src, dst, 0, 0) {
+		t.Error("incorrect checksum after clamping MSS")
+	}
+
+	tcp, b = makeSYN(header.TCPFlagAck)
+	p.Decode(b)
+	if ClampTCPMSS(&p, 1200) {
+		t.Error("clamped the MSS of a packet that is not a SYN")
+	}
+}
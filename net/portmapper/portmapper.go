@@ -87,7 +87,7 @@ type Client struct {
 	logf         logger.Logf
 	netMon       *netmon.Monitor // optional; nil means interfaces will be looked up on-demand
 	controlKnobs *controlknobs.Knobs
-	ipAndGateway func() (gw, ip netip.Addr, ok bool)
+	gateways     func() []netmon.GatewayCandidate
 	onChange     func() // or nil
 	debug        DebugKnobs
 	testPxPPort  uint16 // if non-zero, pxpPort to use for tests
@@ -104,6 +104,11 @@ type Client struct {
 	lastGW   netip.Addr
 	closed   bool
 
+	// preferredGW is the gateway picked by selectGateway among several
+	// candidates, if any, and preferredGWTime is when it was picked.
+	preferredGW     netip.Addr
+	preferredGWTime time.Time
+
 	lastProbe time.Time
 
 	// The following PMP fields are populated during Probe
@@ -221,7 +226,7 @@ func NewClient(logf logger.Logf, netMon *netmon.Monitor, debug *DebugKnobs, cont
 	ret := &Client{
 		logf:         logf,
 		netMon:       netMon,
-		ipAndGateway: netmon.LikelyHomeRouterIP, // TODO(bradfitz): move this to method on netMon
+		gateways:     netmon.LikelyHomeRouterIPs, // TODO(bradfitz): move this to method on netMon
 		onChange:     onChange,
 		controlKnobs: controlKnobs,
 	}
@@ -233,9 +238,25 @@ func NewClient(logf logger.Logf, netMon *netmon.Monitor, debug *DebugKnobs, cont
 
 // SetGatewayLookupFunc set the func that returns the machine's default gateway IP, and
 // the primary IP address for that gateway. It must be called before the client is used.
-// If not called, interfaces.LikelyHomeRouterIP is used.
+// If not called, netmon.LikelyHomeRouterIPs is used.
+//
+// It's like SetGatewaysLookupFunc with a single candidate gateway.
 func (c *Client) SetGatewayLookupFunc(f func() (gw, myIP netip.Addr, ok bool)) {
-	c.ipAndGateway = f
+	c.gateways = func() []netmon.GatewayCandidate {
+		gw, myIP, ok := f()
+		if !ok {
+			return nil
+		}
+		return []netmon.GatewayCandidate{{Gateway: gw, MyIP: myIP}}
+	}
+}
+
+// SetGatewaysLookupFunc sets the func that returns the machine's candidate
+// gateways, most likely first, such as netmon.Monitor.GatewayCandidates. If
+// there's more than one, Probe uses the first one that answers a port mapping
+// probe. It must be called before the client is used.
+func (c *Client) SetGatewaysLookupFunc(f func() []netmon.GatewayCandidate) {
+	c.gateways = f
 }
 
 // NoteNetworkDown should be called when the network has transitioned to a down state.
@@ -246,6 +267,7 @@ func (c *Client) NoteNetworkDown() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.invalidateMappingsLocked(false)
+	c.preferredGWTime = time.Time{}
 }
 
 func (c *Client) Close() error {
@@ -274,14 +296,21 @@ func (c *Client) SetLocalPort(localPort uint16) {
 }
 
 func (c *Client) gatewayAndSelfIP() (gw, myIP netip.Addr, ok bool) {
-	gw, myIP, ok = c.ipAndGateway()
-	if !ok {
-		gw = netip.Addr{}
-		myIP = netip.Addr{}
-	}
+	cands := c.gateways()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if len(cands) > 0 {
+		gc := cands[0]
+		for _, cand := range cands {
+			if cand.Gateway == c.preferredGW {
+				gc = cand
+				break
+			}
+		}
+		gw, myIP, ok = gc.Gateway, gc.MyIP, true
+	}
+
 	if gw != c.lastGW || myIP != c.lastMyIP || !ok {
 		c.lastMyIP = myIP
 		c.lastGW = gw
@@ -290,6 +319,84 @@ func (c *Client) gatewayAndSelfIP() (gw, myIP netip.Addr, ok bool) {
 	return
 }
 
+// maxGatewayCandidates is the maximum number of candidate gateways probed by
+// selectGateway.
+const maxGatewayCandidates = 4
+
+// selectGateway picks which gateway gatewayAndSelfIP returns, when the
+// machine has more than one candidate: the most likely one among those that
+// answer a NAT-PMP, PCP or UPnP probe. The pick is trusted for
+// trustServiceStillAvailableDuration, or until the pick is no longer a
+// candidate or the network goes down.
+func (c *Client) selectGateway(ctx context.Context) {
+	cands := c.gateways()
+	if len(cands) < 2 {
+		return
+	}
+	cands = cands[:min(len(cands), maxGatewayCandidates)]
+	isPreferred := func(gc netmon.GatewayCandidate) bool { return gc.Gateway == c.preferredGW }
+	c.mu.Lock()
+	trusted := time.Since(c.preferredGWTime) < trustServiceStillAvailableDuration && slices.ContainsFunc(cands, isPreferred)
+	c.mu.Unlock()
+	if trusted {
+		return
+	}
+
+	uc, err := c.listenPacket(context.Background(), "udp4", ":0")
+	if err != nil {
+		c.logf("selectGateway: %v", err)
+		return
+	}
+	defer uc.Close()
+	ctx, cancel := context.WithTimeout(ctx, portMapServiceTimeout)
+	defer cancel()
+	defer closeCloserOnContextDone(ctx, uc)()
+
+	for _, gc := range cands {
+		pxpAddr := netip.AddrPortFrom(gc.Gateway, c.pxpPort())
+		if !c.debug.DisablePMP {
+			uc.WriteToUDPAddrPort(pmpReqExternalAddrPacket, pxpAddr)
+		}
+		if !c.debug.DisablePCP {
+			uc.WriteToUDPAddrPort(pcpAnnounceRequest(gc.MyIP), pxpAddr)
+		}
+		if !c.debug.DisableUPnP {
+			uc.WriteToUDPAddrPort(uPnPIGDPacket, netip.AddrPortFrom(gc.Gateway, c.upnpPort()))
+		}
+	}
+
+	// Wait for answers until the most likely candidate answers, as none
+	// can then beat it, or until the timeout.
+	best := len(cands)
+	buf := make([]byte, 1500)
+	for best > 0 {
+		_, src, err := uc.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			break
+		}
+		ip := src.Addr().Unmap()
+		if i := slices.IndexFunc(cands[:best], func(gc netmon.GatewayCandidate) bool { return gc.Gateway == ip }); i >= 0 {
+			best = i
+		}
+	}
+	if best == len(cands) {
+		// Nobody answered. Stick with the most likely candidate until
+		// it's time to check again.
+		best = 0
+	} else if best > 0 {
+		metricGatewayNotFirst.Add(1)
+	}
+
+	gw := cands[best].Gateway
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gw != c.preferredGW {
+		c.logf("selected gateway %v among %d candidates", gw, len(cands))
+	}
+	c.preferredGW = gw
+	c.preferredGWTime = time.Now()
+}
+
 // pxpPort returns the NAT-PMP and PCP port number.
 // It returns 5351, except for in tests where it varies by run.
 func (c *Client) pxpPort() uint16 {
@@ -806,6 +913,7 @@ func (c *Client) Probe(ctx context.Context) (res ProbeResult, err error) {
 	if c.debug.disableAll() {
 		return res, ErrPortMappingDisabled
 	}
+	c.selectGateway(ctx)
 	gw, myIP, ok := c.gatewayAndSelfIP()
 	if !ok {
 		return res, ErrGatewayRange
@@ -1164,6 +1272,13 @@ func (c *Client) maybeInvalidatePCPMappingLocked(epoch uint32) {
 	"MAN: \"ssdp:discover\"\r\n" +
 	"MX: 2\r\n\r\n")
 
+var (
+	// metricGatewayNotFirst counts the number of times selectGateway
+	// picked a candidate gateway other than the most likely one, because
+	// only a less likely one answered.
+	metricGatewayNotFirst = clientmetric.NewCounter("portmap_gateway_not_first")
+)
+
 // PCP/PMP metrics
 var (
 	// metricPXPResponse counts the number of times we received a PMP/PCP response.
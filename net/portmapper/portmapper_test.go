@@ -12,6 +12,8 @@
 	"time"
 
 	"tailscale.com/control/controlknobs"
+	"tailscale.com/net/netaddr"
+	"tailscale.com/net/netmon"
 )
 
 func TestCreateOrGetMapping(t *testing.T) {
@@ -126,6 +128,43 @@ func TestPCPIntegration(t *testing.T) {
 	}
 }
 
+func TestProbeMultipleGateways(t *testing.T) {
+	igd, err := NewTestIGD(t.Logf, TestIGDOptions{PCP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer igd.Close()
+
+	// The test IGD only listens on 127.0.0.1; nothing answers on the
+	// other candidate.
+	live := netmon.GatewayCandidate{Gateway: netaddr.IPv4(127, 0, 0, 1), MyIP: netaddr.IPv4(127, 0, 0, 1)}
+	dead := netmon.GatewayCandidate{Gateway: netaddr.IPv4(127, 0, 0, 3), MyIP: netaddr.IPv4(127, 0, 0, 1)}
+	for _, tt := range []struct {
+		name  string
+		cands []netmon.GatewayCandidate
+	}{
+		{"first", []netmon.GatewayCandidate{live, dead}},
+		{"second", []netmon.GatewayCandidate{dead, live}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, igd)
+			defer c.Close()
+			c.SetGatewaysLookupFunc(func() []netmon.GatewayCandidate { return tt.cands })
+
+			res, err := c.Probe(context.Background())
+			if err != nil {
+				t.Fatalf("Probe: %v", err)
+			}
+			if !res.PCP {
+				t.Errorf("probe did not see pcp: %+v", res)
+			}
+			if gw, _, _ := c.gatewayAndSelfIP(); gw != live.Gateway {
+				t.Errorf("gateway = %v, want %v", gw, live.Gateway)
+			}
+		})
+	}
+}
+
 // Test to ensure that metric names generated by this function do not contain
 // invalid characters.
 //
@@ -21,10 +21,14 @@
 	"io"
 	"log"
 	"net"
+	"net/netip"
+	"slices"
 	"strconv"
+	"sync"
 	"time"
 
 	"tailscale.com/types/logger"
+	"tailscale.com/util/ctxkey"
 )
 
 // Authentication METHODs described in RFC 1928, section 3.
@@ -100,6 +104,41 @@ type Server struct {
 	// Username and Password, if set, are the credential clients must provide.
 	Username string
 	Password string
+
+	// PasswordAuth, if non-nil, checks the username and password provided
+	// by clients, in place of Username and Password. It returns the
+	// client's identity, as returned by ClientIdentity, and whether the
+	// credentials are valid.
+	PasswordAuth func(username, password string) (identity string, ok bool)
+
+	// NoAuth, if non-nil, is called to accept or reject clients that don't
+	// provide a username and password, such as based on their address. It
+	// returns the client's identity, as returned by ClientIdentity, and
+	// whether to accept it. If NoAuth is nil, such clients are accepted
+	// only if no username and password are required.
+	NoAuth func(clientConn net.Conn) (identity string, ok bool)
+}
+
+// clientIdentity is the identity of the client whose request a dial is for.
+var clientIdentity = ctxkey.New("socks5.clientIdentity", "")
+
+// ClientIdentity returns the identity of the client on behalf of which
+// Server.Dialer is called with ctx: its username if it authenticated with a
+// username and password, else what Server.NoAuth returned. It's empty if
+// the client didn't need to authenticate.
+func ClientIdentity(ctx context.Context) string {
+	return clientIdentity.Value(ctx)
+}
+
+func (s *Server) needPassword() bool {
+	return s.Username != "" || s.Password != "" || s.PasswordAuth != nil
+}
+
+func (s *Server) checkPassword(username, password string) (identity string, ok bool) {
+	if s.PasswordAuth != nil {
+		return s.PasswordAuth(username, password)
+	}
+	return username, username == s.Username && password == s.Password
 }
 
 func (s *Server) dial(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -148,31 +187,40 @@ type Conn struct {
 	srv        *Server
 	clientConn net.Conn
 	request    *request
+	identity   string // of the client, for ClientIdentity
 
-	udpClientAddr  net.Addr
-	udpTargetConns map[socksAddr]net.Conn
+	// udpClientAllowed is the address that UDP datagrams to relay must come
+	// from: the IP of the client of the association, and the port that it
+	// declared in its UDP ASSOCIATE request, if any.
+	udpClientAllowed netip.AddrPort
+	udpTargetConns   map[socksAddr]net.Conn
+
+	udpClientMu   sync.Mutex
+	udpClientAddr net.Addr // where to relay responses; nil until the first request
 }
 
 // Run starts the new connection.
 func (c *Conn) Run() error {
-	needAuth := c.srv.Username != "" || c.srv.Password != ""
-	authMethod := noAuthRequired
-	if needAuth {
-		authMethod = passwordAuth
+	methods, err := parseClientGreeting(c.clientConn)
+	authMethod := noAcceptableAuth
+	if err == nil {
+		authMethod, err = c.selectAuthMethod(methods)
 	}
-
-	err := parseClientGreeting(c.clientConn, authMethod)
 	if err != nil {
 		c.clientConn.Write([]byte{socks5Version, noAcceptableAuth})
 		return err
 	}
 	c.clientConn.Write([]byte{socks5Version, authMethod})
-	if !needAuth {
+	if authMethod == noAuthRequired {
 		return c.handleRequest()
 	}
 
 	user, pwd, err := parseClientAuth(c.clientConn)
-	if err != nil || user != c.srv.Username || pwd != c.srv.Password {
+	ok := false
+	if err == nil {
+		c.identity, ok = c.srv.checkPassword(user, pwd)
+	}
+	if !ok {
 		c.clientConn.Write([]byte{1, 1}) // auth error
 		return err
 	}
@@ -181,6 +229,34 @@ func (c *Conn) Run() error {
 	return c.handleRequest()
 }
 
+// selectAuthMethod returns which of the authentication methods offered by
+// the client to use. Username and password authentication is preferred, if
+// required. Otherwise, if the client is accepted without authentication,
+// c.identity is set to its identity.
+func (c *Conn) selectAuthMethod(methods []byte) (byte, error) {
+	if c.srv.needPassword() && slices.Contains(methods, passwordAuth) {
+		return passwordAuth, nil
+	}
+	if !slices.Contains(methods, noAuthRequired) || (c.srv.needPassword() && c.srv.NoAuth == nil) {
+		return noAcceptableAuth, fmt.Errorf("no acceptable auth methods")
+	}
+	if c.srv.NoAuth != nil {
+		identity, ok := c.srv.NoAuth(c.clientConn)
+		if !ok {
+			return noAcceptableAuth, fmt.Errorf("client %v not accepted without authentication", c.clientConn.RemoteAddr())
+		}
+		c.identity = identity
+	}
+	return noAuthRequired, nil
+}
+
+func (c *Conn) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if c.identity != "" {
+		ctx = clientIdentity.WithValue(ctx, c.identity)
+	}
+	return c.srv.dial(ctx, network, addr)
+}
+
 func (c *Conn) handleRequest() error {
 	req, err := parseClientRequest(c.clientConn)
 	if err != nil {
@@ -207,7 +283,7 @@ func (c *Conn) handleRequest() error {
 func (c *Conn) handleTCP() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	srv, err := c.srv.dial(
+	srv, err := c.dial(
 		ctx,
 		"tcp",
 		c.request.destination.hostPort(),
@@ -266,8 +342,16 @@ func (c *Conn) handleUDP() error {
 	// to the association.
 	// @see Page 6, https://datatracker.ietf.org/doc/html/rfc1928.
 	//
-	// We do NOT limit the access from the client currently in this implementation.
-	_ = c.request.destination
+	// Clients usually don't know their address yet, so we only use the
+	// port, if any, and otherwise limit access to the client's IP.
+	clientAddr, err := netip.ParseAddrPort(c.clientConn.RemoteAddr().String())
+	if err != nil {
+		res := errorResponse(generalFailure)
+		buf, _ := res.marshal()
+		c.clientConn.Write(buf)
+		return fmt.Errorf("client address: %w", err)
+	}
+	c.udpClientAllowed = netip.AddrPortFrom(clientAddr.Addr().Unmap(), c.request.destination.port)
 
 	addr := c.clientConn.LocalAddr()
 	host, _, err := net.SplitHostPort(addr.String())
@@ -360,7 +444,7 @@ func (c *Conn) getOrDialTargetConn(
 	if exist {
 		return conn, nil
 	}
-	conn, err := c.srv.dial(ctx, "udp", targetAddr.hostPort())
+	conn, err := c.dial(ctx, "udp", targetAddr.hostPort())
 	if err != nil {
 		return nil, err
 	}
@@ -402,11 +486,21 @@ func (c *Conn) handleUDPRequest(
 	if err != nil {
 		return fmt.Errorf("read from client: %w", err)
 	}
-	c.udpClientAddr = addr
+	if !c.udpClientOK(addr) {
+		return fmt.Errorf("dropping datagram from %v, not the associated client %v", addr, c.udpClientAllowed)
+	}
 	req, data, err := parseUDPRequest(buf[:n])
 	if err != nil {
 		return fmt.Errorf("parse udp request: %w", err)
 	}
+	if req.frag != 0 {
+		// Fragmentation is optional, and implementations that don't
+		// support it must drop fragments. RFC 1928, section 7.
+		return fmt.Errorf("dropping fragmented datagram to %s", req.addr)
+	}
+	c.udpClientMu.Lock()
+	c.udpClientAddr = addr
+	c.udpClientMu.Unlock()
 
 	targetConn, err := c.getOrDialTargetConn(ctx, clientConn, req.addr)
 	if err != nil {
@@ -442,7 +536,10 @@ func (c *Conn) handleUDPResponse(
 	}
 	data := append(pkt, buf[:n]...)
 	// use addr from client to send back
-	nn, err := clientConn.WriteTo(data, c.udpClientAddr)
+	c.udpClientMu.Lock()
+	clientAddr := c.udpClientAddr
+	c.udpClientMu.Unlock()
+	nn, err := clientConn.WriteTo(data, clientAddr)
 	if err != nil {
 		return fmt.Errorf("write to client: %w", err)
 	}
@@ -452,6 +549,21 @@ func (c *Conn) handleUDPResponse(
 	return nil
 }
 
+// udpClientOK reports whether addr, the source of a datagram to relay, is
+// allowed to use the UDP association.
+func (c *Conn) udpClientOK(addr net.Addr) bool {
+	ua, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	ap := ua.AddrPort()
+	allowed := c.udpClientAllowed
+	if ap.Addr().Unmap() != allowed.Addr() {
+		return false
+	}
+	return allowed.Port() == 0 || ap.Port() == allowed.Port()
+}
+
 func isTimeout(err error) bool {
 	terr, ok := errors.Unwrap(err).(interface{ Timeout() bool })
 	return ok && terr.Timeout()
@@ -472,28 +584,24 @@ func splitHostPort(hostport string) (host string, port uint16, err error) {
 	return host, uint16(portInt), nil
 }
 
-// parseClientGreeting parses a request initiation packet.
-func parseClientGreeting(r io.Reader, authMethod byte) error {
+// parseClientGreeting parses a request initiation packet and returns the
+// authentication methods offered by the client.
+func parseClientGreeting(r io.Reader) (methods []byte, err error) {
 	var hdr [2]byte
-	_, err := io.ReadFull(r, hdr[:])
+	_, err = io.ReadFull(r, hdr[:])
 	if err != nil {
-		return fmt.Errorf("could not read packet header")
+		return nil, fmt.Errorf("could not read packet header")
 	}
 	if hdr[0] != socks5Version {
-		return fmt.Errorf("incompatible SOCKS version")
+		return nil, fmt.Errorf("incompatible SOCKS version")
 	}
 	count := int(hdr[1])
-	methods := make([]byte, count)
+	methods = make([]byte, count)
 	_, err = io.ReadFull(r, methods)
 	if err != nil {
-		return fmt.Errorf("could not read methods")
-	}
-	for _, m := range methods {
-		if m == authMethod {
-			return nil
-		}
+		return nil, fmt.Errorf("could not read methods")
 	}
-	return fmt.Errorf("no acceptable auth methods")
+	return methods, nil
 }
 
 func parseClientAuth(r io.Reader) (usr, pwd string, err error) {
@@ -5,10 +5,13 @@
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/netip"
+	"sync/atomic"
 	"testing"
 
 	"golang.org/x/net/proxy"
@@ -167,6 +170,64 @@ func TestReadPassword(t *testing.T) {
 	}
 }
 
+func TestAuthFuncs(t *testing.T) {
+	socks5ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		socks5ln.Close()
+	})
+	var allowNoAuth atomic.Bool
+	dials := make(chan string, 1)
+	s := &Server{
+		PasswordAuth: func(username, password string) (string, bool) {
+			return "user " + username, username == "alice" && password == "secret"
+		},
+		NoAuth: func(net.Conn) (string, bool) {
+			return "local", allowNoAuth.Load()
+		},
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials <- ClientIdentity(ctx)
+			return nil, errors.New("no backend")
+		},
+	}
+	go s.Serve(socks5ln)
+
+	tests := []struct {
+		name         string
+		auth         *proxy.Auth
+		allowNoAuth  bool
+		wantIdentity string // or empty if the client is rejected
+	}{
+		{"password", &proxy.Auth{User: "alice", Password: "secret"}, false, "user alice"},
+		{"bad-password", &proxy.Auth{User: "alice", Password: "wrong"}, true, ""},
+		{"no-auth-accepted", nil, true, "local"},
+		{"no-auth-rejected", nil, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowNoAuth.Store(tt.allowNoAuth)
+			d, err := proxy.SOCKS5("tcp", socks5ln.Addr().String(), tt.auth, proxy.Direct)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c, err := d.Dial("tcp", "127.0.0.1:1"); err == nil {
+				c.Close()
+				t.Fatal("dial unexpectedly succeeded")
+			}
+			var got string
+			select {
+			case got = <-dials:
+			default:
+			}
+			if got != tt.wantIdentity {
+				t.Errorf("dialed for %q, want %q", got, tt.wantIdentity)
+			}
+		})
+	}
+}
+
 func TestUDP(t *testing.T) {
 	// backend UDP server which we'll use SOCKS5 to connect to
 	newUDPEchoServer := func() net.PacketConn {
@@ -287,3 +348,25 @@ func TestUDP(t *testing.T) {
 		}
 	}
 }
+
+func TestUDPClientOK(t *testing.T) {
+	tests := []struct {
+		allowed string
+		from    string
+		want    bool
+	}{
+		{"127.0.0.1:0", "127.0.0.1:1234", true},
+		{"127.0.0.1:0", "[::ffff:127.0.0.1]:1234", true},
+		{"127.0.0.1:0", "127.0.0.2:1234", false},
+		{"127.0.0.1:1234", "127.0.0.1:1234", true},
+		{"127.0.0.1:1234", "127.0.0.1:1235", false},
+		{"[::1]:0", "127.0.0.1:1234", false},
+	}
+	for _, tt := range tests {
+		c := &Conn{udpClientAllowed: netip.MustParseAddrPort(tt.allowed)}
+		from := net.UDPAddrFromAddrPort(netip.MustParseAddrPort(tt.from))
+		if got := c.udpClientOK(from); got != tt.want {
+			t.Errorf("allowed %s, udpClientOK(%s) = %v; want %v", tt.allowed, tt.from, got, tt.want)
+		}
+	}
+}
@@ -26,6 +26,15 @@
 	// And servers appear to send it.
 	attrXorMappedAddressAlt = 0x8020
 
+	// NAT behavior discovery attributes, RFC 5780 Section 7.
+	attrChangeRequest  = 0x0003
+	attrResponseOrigin = 0x802b
+	attrOtherAddress   = 0x802c
+
+	// Flags of the CHANGE-REQUEST attribute.
+	changeIPFlag   = 0x4
+	changePortFlag = 0x2
+
 	software       = "tailnode" // notably: 8 bytes long, so no padding
 	bindingRequest = "\x00\x01"
 	magicCookie    = "\x21\x12\xa4\x42"
@@ -70,6 +79,41 @@ func Request(tID TxID) []byte {
 	return b
 }
 
+// RequestChange generates a binding request STUN packet like Request, with a
+// CHANGE-REQUEST attribute (RFC 5780 Section 7.2) asking the server to send
+// its response from its alternate IP address, port, or both.
+func RequestChange(tID TxID, changeIP, changePort bool) []byte {
+	const lenAttrSoftware = 4 + len(software)
+	const lenAttrChangeRequest = 4 + 4
+	b := make([]byte, 0, headerLen+lenAttrSoftware+lenAttrChangeRequest+lenFingerprint)
+	b = append(b, bindingRequest...)
+	b = appendU16(b, uint16(lenAttrSoftware+lenAttrChangeRequest+lenFingerprint))
+	b = append(b, magicCookie...)
+	b = append(b, tID[:]...)
+
+	b = appendU16(b, attrNumSoftware)
+	b = appendU16(b, uint16(len(software)))
+	b = append(b, software...)
+
+	var flags uint32
+	if changeIP {
+		flags |= changeIPFlag
+	}
+	if changePort {
+		flags |= changePortFlag
+	}
+	b = appendU16(b, attrChangeRequest)
+	b = appendU16(b, 4)
+	b = appendU32(b, flags)
+
+	fp := fingerPrint(b)
+	b = appendU16(b, attrNumFingerprint)
+	b = appendU16(b, 4)
+	b = appendU32(b, fp)
+
+	return b
+}
+
 func fingerPrint(b []byte) uint32 { return crc32.ChecksumIEEE(b) ^ 0x5354554e }
 
 func appendU16(b []byte, v uint16) []byte {
@@ -121,6 +165,72 @@ func ParseBindingRequest(b []byte) (TxID, error) {
 	return txID, nil
 }
 
+// BindingRequest is a STUN binding request, as parsed by
+// ParseAnyBindingRequest.
+type BindingRequest struct {
+	TxID TxID
+
+	// Tailscale is whether the request advertises that it came from
+	// Tailscale, such that ParseBindingRequest would accept it.
+	Tailscale bool
+
+	// ChangeIP and ChangePort are the flags of the request's CHANGE-REQUEST
+	// attribute, if any, asking for the response to be sent from the
+	// server's alternate IP address or port (RFC 5780 Section 7.2).
+	ChangeIP, ChangePort bool
+}
+
+// ParseAnyBindingRequest parses a STUN binding request from any STUN client.
+// Unlike ParseBindingRequest, it doesn't require that the request came from
+// Tailscale, but it still verifies the request's FINGERPRINT attribute if it
+// has one.
+func ParseAnyBindingRequest(b []byte) (BindingRequest, error) {
+	if !Is(b) {
+		return BindingRequest{}, ErrNotSTUN
+	}
+	if string(b[:len(bindingRequest)]) != bindingRequest {
+		return BindingRequest{}, ErrNotBindingRequest
+	}
+	var req BindingRequest
+	copy(req.TxID[:], b[8:8+len(req.TxID)])
+	var softwareOK, hasFP bool
+	var lastAttr uint16
+	var gotFP uint32
+	if err := foreachAttr(b[headerLen:], func(attrType uint16, a []byte) error {
+		lastAttr = attrType
+		switch attrType {
+		case attrNumSoftware:
+			softwareOK = string(a) == software
+		case attrNumFingerprint:
+			if len(a) != 4 {
+				return ErrMalformedAttrs
+			}
+			hasFP = true
+			gotFP = binary.BigEndian.Uint32(a)
+		case attrChangeRequest:
+			if len(a) != 4 {
+				return ErrMalformedAttrs
+			}
+			flags := binary.BigEndian.Uint32(a)
+			req.ChangeIP = flags&changeIPFlag != 0
+			req.ChangePort = flags&changePortFlag != 0
+		}
+		return nil
+	}); err != nil {
+		return BindingRequest{}, err
+	}
+	if hasFP {
+		if lastAttr != attrNumFingerprint {
+			return BindingRequest{}, ErrNoFingerprint
+		}
+		if gotFP != fingerPrint(b[:len(b)-lenFingerprint]) {
+			return BindingRequest{}, ErrWrongFingerprint
+		}
+	}
+	req.Tailscale = softwareOK && hasFP
+	return req, nil
+}
+
 var (
 	ErrNotSTUN            = errors.New("response is not a STUN packet")
 	ErrNotSuccessResponse = errors.New("STUN packet is not a response")
@@ -153,6 +263,15 @@ func foreachAttr(b []byte, fn func(attrType uint16, a []byte) error) error {
 
 // Response generates a binding response.
 func Response(txID TxID, addrPort netip.AddrPort) []byte {
+	return ResponseWithAddrs(txID, addrPort, netip.AddrPort{}, netip.AddrPort{})
+}
+
+// ResponseWithAddrs generates a binding response from a server that supports
+// NAT behavior discovery (RFC 5780). Besides the client's mapped address
+// addrPort, it has the RESPONSE-ORIGIN attribute, the address the response is
+// sent from, and the OTHER-ADDRESS attribute, the server's alternate address.
+// Either is omitted if it's the zero value.
+func ResponseWithAddrs(txID TxID, addrPort, responseOrigin, otherAddress netip.AddrPort) []byte {
 	addr := addrPort.Addr()
 
 	var fam byte
@@ -164,6 +283,11 @@ func Response(txID TxID, addrPort netip.AddrPort) []byte {
 		return nil
 	}
 	attrsLen := 8 + addr.BitLen()/8
+	for _, ap := range []netip.AddrPort{responseOrigin, otherAddress} {
+		if ap.IsValid() {
+			attrsLen += 8 + ap.Addr().BitLen()/8
+		}
+	}
 	b := make([]byte, 0, headerLen+attrsLen)
 
 	// Header
@@ -187,27 +311,70 @@ func Response(txID TxID, addrPort netip.AddrPort) []byte {
 			b = append(b, o^txID[i-len(magicCookie)])
 		}
 	}
+	if responseOrigin.IsValid() {
+		b = appendMappedAddress(b, attrResponseOrigin, responseOrigin)
+	}
+	if otherAddress.IsValid() {
+		b = appendMappedAddress(b, attrOtherAddress, otherAddress)
+	}
 	return b
 }
 
+// appendMappedAddress appends an attribute of type attrType with the format
+// of MAPPED-ADDRESS (RFC 5389 Section 15.1) holding ap.
+func appendMappedAddress(b []byte, attrType uint16, ap netip.AddrPort) []byte {
+	addr := ap.Addr()
+	fam := byte(1)
+	if addr.Is6() {
+		fam = 2
+	}
+	b = appendU16(b, attrType)
+	b = appendU16(b, uint16(4+addr.BitLen()/8))
+	b = append(b, 0, fam)
+	b = appendU16(b, ap.Port())
+	return append(b, addr.AsSlice()...)
+}
+
 // ParseResponse parses a successful binding response STUN packet.
 // The IP address is extracted from the XOR-MAPPED-ADDRESS attribute.
 func ParseResponse(b []byte) (tID TxID, addr netip.AddrPort, err error) {
+	tID, addrs, err := ParseResponseAddrs(b)
+	return tID, addrs.Mapped, err
+}
+
+// ResponseAddrs are the addresses in a binding response.
+type ResponseAddrs struct {
+	// Mapped is the client's address as seen by the server, from the
+	// XOR-MAPPED-ADDRESS or MAPPED-ADDRESS attribute.
+	Mapped netip.AddrPort
+
+	// Origin and Other are the RESPONSE-ORIGIN and OTHER-ADDRESS
+	// attributes of a server that supports NAT behavior discovery
+	// (RFC 5780 Sections 7.3 and 7.4), or the zero value if absent.
+	Origin, Other netip.AddrPort
+}
+
+// ParseResponseAddrs parses a successful binding response STUN packet like
+// ParseResponse, additionally returning the server's RESPONSE-ORIGIN and
+// OTHER-ADDRESS attributes, if present.
+func ParseResponseAddrs(b []byte) (tID TxID, addrs ResponseAddrs, err error) {
 	if !Is(b) {
-		return tID, netip.AddrPort{}, ErrNotSTUN
+		return tID, ResponseAddrs{}, ErrNotSTUN
 	}
 	copy(tID[:], b[8:8+len(tID)])
 	if b[0] != 0x01 || b[1] != 0x01 {
-		return tID, netip.AddrPort{}, ErrNotSuccessResponse
+		return tID, ResponseAddrs{}, ErrNotSuccessResponse
 	}
 	attrsLen := int(binary.BigEndian.Uint16(b[2:4]))
 	b = b[headerLen:] // remove STUN header
 	if attrsLen > len(b) {
-		return tID, netip.AddrPort{}, ErrMalformedAttrs
+		return tID, ResponseAddrs{}, ErrMalformedAttrs
 	} else if len(b) > attrsLen {
 		b = b[:attrsLen] // trim trailing packet bytes
 	}
 
+	var addr netip.AddrPort
+
 	var fallbackAddr netip.AddrPort
 
 	// Read through the attributes.
@@ -233,20 +400,34 @@ func ParseResponse(b []byte) (tID TxID, addr netip.AddrPort, err error) {
 			if ip, ok := netip.AddrFromSlice(ipSlice); ok {
 				fallbackAddr = netip.AddrPortFrom(ip.Unmap(), port)
 			}
+		case attrResponseOrigin, attrOtherAddress:
+			ipSlice, port, err := mappedAddress(attr)
+			if err != nil {
+				return ErrMalformedAttrs
+			}
+			if ip, ok := netip.AddrFromSlice(ipSlice); ok {
+				if attrType == attrResponseOrigin {
+					addrs.Origin = netip.AddrPortFrom(ip.Unmap(), port)
+				} else {
+					addrs.Other = netip.AddrPortFrom(ip.Unmap(), port)
+				}
+			}
 		}
 		return nil
 
 	}); err != nil {
-		return TxID{}, netip.AddrPort{}, err
+		return TxID{}, ResponseAddrs{}, err
 	}
 
 	if addr.IsValid() {
-		return tID, addr, nil
+		addrs.Mapped = addr
+		return tID, addrs, nil
 	}
 	if fallbackAddr.IsValid() {
-		return tID, fallbackAddr, nil
+		addrs.Mapped = fallbackAddr
+		return tID, addrs, nil
 	}
-	return tID, netip.AddrPort{}, ErrMalformedAttrs
+	return tID, ResponseAddrs{}, ErrMalformedAttrs
 }
 
 func xorMappedAddress(tID TxID, b []byte) (addr []byte, port uint16, err error) {
@@ -299,3 +299,81 @@ func TestAttrOrderForXdpDERP(t *testing.T) {
 		t.Fatal("unexpected software attr value")
 	}
 }
+
+func TestParseAnyBindingRequest(t *testing.T) {
+	tx := stun.NewTxID()
+	for _, tt := range []struct {
+		name                 string
+		req                  []byte
+		changeIP, changePort bool
+	}{
+		{name: "plain", req: stun.Request(tx)},
+		{name: "change-ip", req: stun.RequestChange(tx, true, false), changeIP: true},
+		{name: "change-port", req: stun.RequestChange(tx, false, true), changePort: true},
+		{name: "change-both", req: stun.RequestChange(tx, true, true), changeIP: true, changePort: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stun.ParseAnyBindingRequest(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := stun.BindingRequest{TxID: tx, Tailscale: true, ChangeIP: tt.changeIP, ChangePort: tt.changePort}
+			if got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+			// Requests with a CHANGE-REQUEST are still valid Tailscale requests.
+			if _, err := stun.ParseBindingRequest(tt.req); err != nil {
+				t.Errorf("ParseBindingRequest: %v", err)
+			}
+		})
+	}
+
+	// A request from another client is accepted, without fingerprint.
+	other := must.Get(hex.DecodeString("000100002112a442" + "0102030405060708090a0b0c"))
+	got, err := stun.ParseAnyBindingRequest(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Tailscale || got.TxID != (stun.TxID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}) {
+		t.Errorf("got %+v", got)
+	}
+	if _, err := stun.ParseBindingRequest(other); err == nil {
+		t.Error("ParseBindingRequest accepted a non-Tailscale request")
+	}
+
+	// A bad fingerprint is rejected.
+	bad := stun.Request(tx)
+	bad[len(bad)-1] ^= 1
+	if _, err := stun.ParseAnyBindingRequest(bad); err != stun.ErrWrongFingerprint {
+		t.Errorf("bad fingerprint: err = %v, want %v", err, stun.ErrWrongFingerprint)
+	}
+}
+
+func TestResponseWithAddrs(t *testing.T) {
+	tx := stun.NewTxID()
+	want := stun.ResponseAddrs{
+		Mapped: netip.MustParseAddrPort("1.2.3.4:5678"),
+		Origin: netip.MustParseAddrPort("10.0.0.1:3478"),
+		Other:  netip.MustParseAddrPort("10.0.0.2:3479"),
+	}
+	res := stun.ResponseWithAddrs(tx, want.Mapped, want.Origin, want.Other)
+	gotTx, got, err := stun.ParseResponseAddrs(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotTx != tx || got != want {
+		t.Errorf("got %v, %+v; want %v, %+v", gotTx, got, tx, want)
+	}
+
+	want6 := stun.ResponseAddrs{
+		Mapped: netip.MustParseAddrPort("[1::4]:5678"),
+		Other:  netip.MustParseAddrPort("[2::1]:3479"),
+	}
+	_, got, err = stun.ParseResponseAddrs(stun.ResponseWithAddrs(tx, want6.Mapped, netip.AddrPort{}, want6.Other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want6 {
+		t.Errorf("got %+v; want %+v", got, want6)
+	}
+}
@@ -9,47 +9,120 @@
 	"context"
 	"errors"
 	"expvar"
+	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/netip"
+	"sync"
 	"time"
 
 	"tailscale.com/metrics"
 	"tailscale.com/net/stun"
+	"tailscale.com/tstime/rate"
+	"tailscale.com/util/lru"
 )
 
 var (
-	stats           = new(metrics.Set)
-	stunDisposition = &metrics.LabelMap{Label: "disposition"}
-	stunAddrFamily  = &metrics.LabelMap{Label: "family"}
-	stunReadError   = stunDisposition.Get("read_error")
-	stunNotSTUN     = stunDisposition.Get("not_stun")
-	stunWriteError  = stunDisposition.Get("write_error")
-	stunSuccess     = stunDisposition.Get("success")
+	stats                 = new(metrics.Set)
+	stunDisposition       = &metrics.LabelMap{Label: "disposition"}
+	stunAddrFamily        = &metrics.LabelMap{Label: "family"}
+	stunChange            = &metrics.LabelMap{Label: "change"}
+	stunReadError         = stunDisposition.Get("read_error")
+	stunNotSTUN           = stunDisposition.Get("not_stun")
+	stunWriteError        = stunDisposition.Get("write_error")
+	stunSuccess           = stunDisposition.Get("success")
+	stunRateLimited       = stunDisposition.Get("rate_limited")
+	stunChangeUnsupported = stunDisposition.Get("change_unsupported")
 
 	stunIPv4 = stunAddrFamily.Get("ipv4")
 	stunIPv6 = stunAddrFamily.Get("ipv6")
+
+	stunChangeIP   = stunChange.Get("ip")
+	stunChangePort = stunChange.Get("port")
+	stunChangeBoth = stunChange.Get("ip_and_port")
 )
 
 func init() {
 	stats.Set("counter_requests", stunDisposition)
 	stats.Set("counter_addrfamily", stunAddrFamily)
+	stats.Set("counter_change_requests", stunChange)
 	expvar.Publish("stun", stats)
 }
 
+// maxRateLimitedClients is the maximum number of clients whose rate limiters
+// are remembered. When more clients are active, the least recently seen ones
+// start over with a full burst.
+const maxRateLimitedClients = 64 << 10
+
+// Config configures a STUNServer.
+type Config struct {
+	// RateLimit, if positive, is the maximum rate of requests per second
+	// answered for each client. Clients are identified by their IPv4
+	// address or the /64 prefix of their IPv6 address. Requests over the
+	// limit are dropped.
+	RateLimit float64
+
+	// RateBurst is the maximum burst of requests answered for each client
+	// when RateLimit is positive. If zero, it's 1.
+	RateBurst int
+
+	// AltAddr, if non-empty, is the server's alternate "ip:port" address for
+	// NAT behavior discovery (RFC 5780). Its IP and port must both differ
+	// from those of the address passed to Listen, which must then have a
+	// specific IP. Either port may be zero to pick an unused one. The server listens on all four combinations of the two
+	// IPs and ports, includes the RESPONSE-ORIGIN and OTHER-ADDRESS
+	// attributes in its responses, and honors requests' CHANGE-REQUEST
+	// attributes.
+	//
+	// Without it, requests asking for a change of IP or port are dropped.
+	AltAddr string
+
+	// AllowAnyClient is whether to answer binding requests from any STUN
+	// client. By default, only requests from Tailscale are answered.
+	AllowAnyClient bool
+}
+
 type STUNServer struct {
 	ctx context.Context // ctx signals service shutdown
-	pc  *net.UDPConn    // pc is the UDP listener
+	cfg Config
+
+	// pc is the UDP listener. With cfg.AltAddr, it's the first of
+	// altPCs, which are indexed by the bits altPortBit and altIPBit
+	// telling whether they listen on the alternate port and IP.
+	pc     *net.UDPConn
+	altPCs []*net.UDPConn
+
+	mu       sync.Mutex // protects limiters
+	limiters lru.Cache[netip.Prefix, *rate.Limiter]
 }
 
+const (
+	altPortBit = 1 << iota
+	altIPBit
+)
+
 // New creates a new STUN server. The server is shutdown when ctx is done.
 func New(ctx context.Context) *STUNServer {
-	return &STUNServer{ctx: ctx}
+	return NewWithConfig(ctx, Config{})
+}
+
+// NewWithConfig creates a new STUN server configured by cfg. The server is
+// shutdown when ctx is done.
+func NewWithConfig(ctx context.Context, cfg Config) *STUNServer {
+	if cfg.RateBurst < 1 {
+		cfg.RateBurst = 1
+	}
+	s := &STUNServer{ctx: ctx, cfg: cfg}
+	s.limiters.MaxEntries = maxRateLimitedClients
+	return s
 }
 
 // Listen binds the listen socket for the server at listenAddr.
 func (s *STUNServer) Listen(listenAddr string) error {
+	if s.cfg.AltAddr != "" {
+		return s.listenRFC5780(listenAddr)
+	}
 	uaddr, err := net.ResolveUDPAddr("udp", listenAddr)
 	if err != nil {
 		return err
@@ -67,8 +140,84 @@ func (s *STUNServer) Listen(listenAddr string) error {
 	return nil
 }
 
+// listenRFC5780 binds the four listen sockets of a server doing NAT behavior
+// discovery, on the combinations of the IPs and ports of listenAddr and
+// s.cfg.AltAddr.
+func (s *STUNServer) listenRFC5780(listenAddr string) error {
+	primary, err := netip.ParseAddrPort(listenAddr)
+	if err != nil {
+		return fmt.Errorf("STUN listen address %q with alternate address: %w", listenAddr, err)
+	}
+	alt, err := netip.ParseAddrPort(s.cfg.AltAddr)
+	if err != nil {
+		return fmt.Errorf("STUN alternate address: %w", err)
+	}
+	switch {
+	case primary.Addr().IsUnspecified() || alt.Addr().IsUnspecified():
+		return errors.New("STUN listen and alternate addresses must have specific IPs")
+	case primary.Addr().Is4() != alt.Addr().Is4():
+		return errors.New("STUN listen and alternate addresses must be of the same address family")
+	case primary.Addr() == alt.Addr() || (primary.Port() == alt.Port() && primary.Port() != 0):
+		return errors.New("STUN alternate address must differ from the listen address in both IP and port")
+	}
+
+	// The sockets on the primary IP are bound first, so that if either
+	// port is zero, the port picked for it can be reused on the
+	// alternate IP.
+	ports := [2]uint16{primary.Port(), alt.Port()}
+	s.altPCs = make([]*net.UDPConn, 4)
+	for i := range s.altPCs {
+		ip := primary.Addr()
+		if i&altIPBit != 0 {
+			ip = alt.Addr()
+		}
+		port := &ports[i&altPortBit]
+		pc, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, *port)))
+		if err != nil {
+			for _, pc := range s.altPCs[:i] {
+				pc.Close()
+			}
+			return err
+		}
+		*port = udpAddrPort(pc).Port()
+		s.altPCs[i] = pc
+	}
+	s.pc = s.altPCs[0]
+	log.Printf("STUN server listening on %v with alternate address %v", s.LocalAddr(), udpAddrPort(s.altPCs[altIPBit|altPortBit]))
+	go func() {
+		<-s.ctx.Done()
+		for _, pc := range s.altPCs {
+			pc.Close()
+		}
+	}()
+	return nil
+}
+
 // Serve starts serving responses to STUN requests. Listen must be called before Serve.
 func (s *STUNServer) Serve() error {
+	if s.altPCs == nil {
+		return s.serve(0)
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(s.altPCs))
+	for i := range s.altPCs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.serve(i)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// serve serves the requests received on s.altPCs[i], or on s.pc if the server
+// doesn't do NAT behavior discovery.
+func (s *STUNServer) serve(i int) error {
+	pc := s.pc
+	if s.altPCs != nil {
+		pc = s.altPCs[i]
+	}
 	var buf [64 << 10]byte
 	var (
 		n   int
@@ -76,7 +225,7 @@ func (s *STUNServer) Serve() error {
 		err error
 	)
 	for {
-		n, ua, err = s.pc.ReadFromUDP(buf[:])
+		n, ua, err = pc.ReadFromUDP(buf[:])
 		if err != nil {
 			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
 				return nil
@@ -91,19 +240,51 @@ func (s *STUNServer) Serve() error {
 			stunNotSTUN.Add(1)
 			continue
 		}
-		txid, err := stun.ParseBindingRequest(pkt)
-		if err != nil {
+		req, err := stun.ParseAnyBindingRequest(pkt)
+		if err != nil || (!req.Tailscale && !s.cfg.AllowAnyClient) {
 			stunNotSTUN.Add(1)
 			continue
 		}
+		addr, _ := netip.AddrFromSlice(ua.IP)
+		if !s.allow(addr.Unmap()) {
+			stunRateLimited.Add(1)
+			continue
+		}
 		if ua.IP.To4() != nil {
 			stunIPv4.Add(1)
 		} else {
 			stunIPv6.Add(1)
 		}
-		addr, _ := netip.AddrFromSlice(ua.IP)
-		res := stun.Response(txid, netip.AddrPortFrom(addr, uint16(ua.Port)))
-		_, err = s.pc.WriteTo(res, ua)
+
+		var res []byte
+		out := pc
+		switch {
+		case s.altPCs != nil:
+			switch {
+			case req.ChangeIP && req.ChangePort:
+				stunChangeBoth.Add(1)
+			case req.ChangeIP:
+				stunChangeIP.Add(1)
+			case req.ChangePort:
+				stunChangePort.Add(1)
+			}
+			j := i
+			if req.ChangeIP {
+				j ^= altIPBit
+			}
+			if req.ChangePort {
+				j ^= altPortBit
+			}
+			out = s.altPCs[j]
+			res = stun.ResponseWithAddrs(req.TxID, netip.AddrPortFrom(addr, uint16(ua.Port)),
+				udpAddrPort(out), udpAddrPort(s.altPCs[i^(altIPBit|altPortBit)]))
+		case req.ChangeIP || req.ChangePort:
+			stunChangeUnsupported.Add(1)
+			continue
+		default:
+			res = stun.Response(req.TxID, netip.AddrPortFrom(addr, uint16(ua.Port)))
+		}
+		_, err = out.WriteTo(res, ua)
 		if err != nil {
 			stunWriteError.Add(1)
 		} else {
@@ -112,6 +293,33 @@ func (s *STUNServer) Serve() error {
 	}
 }
 
+// allow reports whether a request from addr, which must be unmapped, is
+// within the rate limit.
+func (s *STUNServer) allow(addr netip.Addr) bool {
+	if s.cfg.RateLimit <= 0 {
+		return true
+	}
+	bits := 32
+	if addr.Is6() {
+		bits = 64
+	}
+	client := netip.PrefixFrom(addr, bits).Masked()
+
+	s.mu.Lock()
+	lim, ok := s.limiters.GetOk(client)
+	if !ok {
+		lim = rate.NewLimiter(rate.Limit(s.cfg.RateLimit), s.cfg.RateBurst)
+		s.limiters.Set(client, lim)
+	}
+	s.mu.Unlock()
+	return lim.Allow()
+}
+
+// udpAddrPort returns the local address of pc.
+func udpAddrPort(pc *net.UDPConn) netip.AddrPort {
+	return pc.LocalAddr().(*net.UDPAddr).AddrPort()
+}
+
 // ListenAndServe starts the STUN server on listenAddr.
 func (s *STUNServer) ListenAndServe(listenAddr string) error {
 	if err := s.Listen(listenAddr); err != nil {
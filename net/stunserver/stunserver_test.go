@@ -6,6 +6,7 @@
 import (
 	"context"
 	"net"
+	"net/netip"
 	"sync"
 	"testing"
 	"time"
@@ -58,6 +59,168 @@ func TestSTUNServer(t *testing.T) {
 	}
 }
 
+// startServer starts a server with cfg listening on listenAddr and returns it.
+func startServer(t *testing.T, cfg Config, listenAddr string) *STUNServer {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewWithConfig(ctx, cfg)
+	if err := s.Listen(listenAddr); err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Serve()
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s
+}
+
+// roundTrip sends req from c to addr and returns the parsed response, or
+// reports false if none arrives within timeout.
+func roundTrip(t *testing.T, c *net.UDPConn, addr netip.AddrPort, req []byte, timeout time.Duration) (stun.ResponseAddrs, netip.AddrPort, bool) {
+	t.Helper()
+	if _, err := c.WriteToUDPAddrPort(req, addr); err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(timeout))
+	var buf [1500]byte
+	n, from, err := c.ReadFromUDPAddrPort(buf[:])
+	if err != nil {
+		return stun.ResponseAddrs{}, netip.AddrPort{}, false
+	}
+	_, addrs, err := stun.ParseResponseAddrs(buf[:n])
+	if err != nil {
+		t.Fatalf("bad response: %v", err)
+	}
+	return addrs, from, true
+}
+
+func TestRateLimit(t *testing.T) {
+	s := startServer(t, Config{RateLimit: 0.001, RateBurst: 2}, "127.0.0.1:0")
+	addr := s.LocalAddr().(*net.UDPAddr).AddrPort()
+	c := must.Get(net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")}))
+	defer c.Close()
+
+	for i := range 2 {
+		if _, _, ok := roundTrip(t, c, addr, stun.Request(stun.NewTxID()), 5*time.Second); !ok {
+			t.Fatalf("request %d within burst got no response", i)
+		}
+	}
+	if _, _, ok := roundTrip(t, c, addr, stun.Request(stun.NewTxID()), 100*time.Millisecond); ok {
+		t.Fatal("request over the rate limit got a response")
+	}
+}
+
+func TestAllowAnyClient(t *testing.T) {
+	// A binding request without Tailscale's SOFTWARE attribute.
+	req := make([]byte, 20)
+	req[1] = 0x01
+	copy(req[4:], "\x21\x12\xa4\x42")
+
+	for _, allow := range []bool{false, true} {
+		s := startServer(t, Config{AllowAnyClient: allow}, "127.0.0.1:0")
+		c := must.Get(net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")}))
+		defer c.Close()
+		timeout := 5 * time.Second
+		if !allow {
+			timeout = 100 * time.Millisecond
+		}
+		_, _, ok := roundTrip(t, c, s.LocalAddr().(*net.UDPAddr).AddrPort(), req, timeout)
+		if ok != allow {
+			t.Errorf("AllowAnyClient=%v: got response = %v", allow, ok)
+		}
+	}
+}
+
+func TestNATBehaviorDiscovery(t *testing.T) {
+	if !canListen("127.0.0.2:0") {
+		t.Skip("no second loopback address")
+	}
+	s := startServer(t, Config{AltAddr: "127.0.0.2:0"}, "127.0.0.1:0")
+	addrOf := func(i int) netip.AddrPort { return udpAddrPort(s.altPCs[i]) }
+	primary, other := addrOf(0), addrOf(altIPBit|altPortBit)
+	if primary.Port() == other.Port() {
+		t.Fatalf("alternate port %v is the same as the primary port", other.Port())
+	}
+
+	c := must.Get(net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")}))
+	defer c.Close()
+	clientAddr := c.LocalAddr().(*net.UDPAddr).AddrPort()
+
+	for _, tt := range []struct {
+		name                 string
+		changeIP, changePort bool
+		wantFrom             netip.AddrPort
+	}{
+		{name: "no-change", wantFrom: primary},
+		{name: "change-ip", changeIP: true, wantFrom: addrOf(altIPBit)},
+		{name: "change-port", changePort: true, wantFrom: addrOf(altPortBit)},
+		{name: "change-both", changeIP: true, changePort: true, wantFrom: other},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := stun.RequestChange(stun.NewTxID(), tt.changeIP, tt.changePort)
+			got, from, ok := roundTrip(t, c, primary, req, 5*time.Second)
+			if !ok {
+				t.Fatal("no response")
+			}
+			if from != tt.wantFrom {
+				t.Errorf("response from %v, want %v", from, tt.wantFrom)
+			}
+			want := stun.ResponseAddrs{Mapped: clientAddr, Origin: tt.wantFrom, Other: other}
+			if got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	// OTHER-ADDRESS is relative to the address the request was sent to.
+	got, _, ok := roundTrip(t, c, other, stun.Request(stun.NewTxID()), 5*time.Second)
+	if !ok {
+		t.Fatal("no response from alternate address")
+	}
+	if got.Other != primary {
+		t.Errorf("OTHER-ADDRESS from alternate address = %v, want %v", got.Other, primary)
+	}
+}
+
+func TestChangeRequestUnsupported(t *testing.T) {
+	s := startServer(t, Config{}, "127.0.0.1:0")
+	c := must.Get(net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")}))
+	defer c.Close()
+	req := stun.RequestChange(stun.NewTxID(), true, false)
+	if _, _, ok := roundTrip(t, c, s.LocalAddr().(*net.UDPAddr).AddrPort(), req, 100*time.Millisecond); ok {
+		t.Fatal("got a response to a CHANGE-REQUEST without an alternate address")
+	}
+}
+
+func TestListenAltAddrErrors(t *testing.T) {
+	for _, tt := range []struct{ listen, alt string }{
+		{":3478", "127.0.0.2:3479"},
+		{"127.0.0.1:3478", "127.0.0.1:3479"},
+		{"127.0.0.1:3478", "127.0.0.2:3478"},
+		{"127.0.0.1:3478", "[::1]:3479"},
+	} {
+		s := NewWithConfig(context.Background(), Config{AltAddr: tt.alt})
+		if err := s.Listen(tt.listen); err == nil {
+			t.Errorf("Listen(%q) with AltAddr %q succeeded", tt.listen, tt.alt)
+		}
+	}
+}
+
+func canListen(addr string) bool {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return false
+	}
+	pc.Close()
+	return true
+}
+
 func BenchmarkServerSTUN(b *testing.B) {
 	b.ReportAllocs()
 	ctx, cancel := context.WithCancel(context.Background())
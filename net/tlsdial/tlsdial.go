@@ -53,6 +53,7 @@
 	},
 	Severity:            health.SeverityMedium,
 	ImpactsConnectivity: true,
+	Component:           health.ComponentNetwork,
 })
 
 // Config returns a tls.Config for connecting to a server.
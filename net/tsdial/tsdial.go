@@ -63,6 +63,17 @@ type Dialer struct {
 	// If nil, it's not used.
 	NetstackDialUDP func(context.Context, netip.AddrPort) (net.Conn, error)
 
+	// MagicDNSDialUDP, if non-nil, is used by UserDial to dial UDP to
+	// MagicDNS on the Tailscale service IP, port 53, answering queries
+	// in-process. Without it, such dials fail when using userspace
+	// networking, such as for DNS queries from SOCKS5 proxy clients.
+	MagicDNSDialUDP func(context.Context, netip.AddrPort) (net.Conn, error)
+
+	// SystemDialForTest, if non-nil, is used by SystemDial instead of
+	// the system network, such as to inject network faults with a
+	// memnet.FaultInjector in tests.
+	SystemDialForTest func(ctx context.Context, network, addr string) (net.Conn, error)
+
 	peerClientOnce sync.Once
 	peerClient     *http.Client
 
@@ -366,6 +377,9 @@ func (d *Dialer) logf(format string, args ...any) {
 // connections if the default interface changes. It is used to connect to
 // Control and (in the future, as of 2022-04-27) DERPs..
 func (d *Dialer) SystemDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.SystemDialForTest != nil {
+		return d.SystemDialForTest(ctx, network, addr)
+	}
 	d.mu.Lock()
 	if d.netMon == nil {
 		d.mu.Unlock()
@@ -407,6 +421,9 @@ func (d *Dialer) UserDial(ctx context.Context, network, addr string) (net.Conn,
 	if err != nil {
 		return nil, err
 	}
+	if d.MagicDNSDialUDP != nil && strings.HasPrefix(network, "udp") && isMagicDNS(ipp) {
+		return d.MagicDNSDialUDP(ctx, ipp)
+	}
 	if d.UseNetstackForIP != nil && d.UseNetstackForIP(ipp.Addr()) {
 		if d.NetstackDialTCP == nil || d.NetstackDialUDP == nil {
 			return nil, errors.New("Dialer not initialized correctly")
@@ -438,6 +455,12 @@ func (d *Dialer) UserDial(ctx context.Context, network, addr string) (net.Conn,
 	return stdDialer.DialContext(ctx, network, ipp.String())
 }
 
+// isMagicDNS reports whether ipp is MagicDNS's address.
+func isMagicDNS(ipp netip.AddrPort) bool {
+	a := ipp.Addr()
+	return ipp.Port() == 53 && (a == tsaddr.TailscaleServiceIP() || a == tsaddr.TailscaleServiceIPv6())
+}
+
 // dialPeerAPI connects to a Tailscale peer's peerapi over TCP.
 //
 // network must a "tcp" type, and addr must be an ip:port. Name resolution
@@ -0,0 +1,320 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tshttpproxy
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"tailscale.com/util/testenv"
+)
+
+// authSession is a connection-based proxy authentication handshake, such as
+// Negotiate or NTLM, in which the client answers challenges of the proxy on
+// the same connection until the proxy accepts it.
+type authSession interface {
+	// Step returns the token to send to the proxy in response to its
+	// challenge token, which is nil for the first step.
+	Step(challenge []byte) (token []byte, err error)
+	// Close releases the resources of the session.
+	Close()
+}
+
+// sysAuthSession, if non-nil, starts a connection-based authentication
+// handshake with the proxy u with the given scheme ("Negotiate" or "NTLM"),
+// using the credentials of the current user.
+var sysAuthSession func(u *url.URL, scheme string) (authSession, error)
+
+// SetSysAuthSessionForTest makes SetTransportProxy and Connect act as on
+// platforms supporting connection-based proxy authentication, with sessions
+// that send empty tokens, until the returned func is called. It's for tests
+// of packages using them.
+func SetSysAuthSessionForTest() (restore func()) {
+	if !testenv.InTest() {
+		panic("SetSysAuthSessionForTest called outside of tests")
+	}
+	old := sysAuthSession
+	sysAuthSession = func(*url.URL, string) (authSession, error) { return emptyAuthSession{}, nil }
+	return func() { sysAuthSession = old }
+}
+
+// emptyAuthSession is an authSession that sends empty tokens.
+type emptyAuthSession struct{}
+
+func (emptyAuthSession) Step([]byte) ([]byte, error) { return nil, nil }
+func (emptyAuthSession) Close()                      {}
+
+// maxAuthRounds is the maximum number of CONNECT requests sent on a
+// connection to complete a proxy authentication handshake.
+const maxAuthRounds = 4
+
+// Connect establishes a tunnel to target through the HTTP or HTTPS proxy
+// proxyURL with a CONNECT request, dialing the proxy with dial.
+//
+// Unlike the CONNECT requests of an http.Transport configured with
+// SetTransportGetProxyConnectHeader, Connect completes connection-based
+// authentication handshakes such as NTLM, which take several requests, on
+// platforms that support them.
+func Connect(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), proxyURL *url.URL, target string) (_ net.Conn, retErr error) {
+	conn, err := dialProxy(ctx, dial, proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			// In a goroutine in case it's a *tls.Conn (that can block on Close)
+			go conn.Close()
+		}
+	}()
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	var sess authSession
+	var scheme string
+	defer func() {
+		if sess != nil {
+			sess.Close()
+		}
+	}()
+	var auth string
+	if proxyURL.User.Username() == "" && sysAuthSession != nil && !hasFakeAuth() {
+		scheme = "Negotiate"
+		if sess, auth, err = startAuthSession(proxyURL, scheme); err != nil {
+			log.Printf("tshttpproxy: starting %s auth for %v; continuing without: %v", scheme, proxyURL, err)
+		}
+	} else if auth, err = GetAuthHeader(proxyURL); err != nil {
+		log.Printf("tshttpproxy: failed to get proxy Auth header for %v; ignoring: %v", proxyURL, err)
+	}
+
+	br := bufio.NewReader(conn)
+	for round := 1; ; round++ {
+		req := &http.Request{
+			Method: "CONNECT",
+			URL:    &url.URL{Opaque: target},
+			Host:   target,
+			Header: make(http.Header),
+		}
+		if auth != "" {
+			req.Header.Set(proxyAuthHeader, auth)
+		}
+		if err := req.Write(conn); err != nil {
+			return nil, ctxErrOr(ctx, err)
+		}
+		res, err := http.ReadResponse(br, req)
+		if err != nil {
+			return nil, ctxErrOr(ctx, err)
+		}
+		if res.StatusCode == http.StatusOK {
+			if br.Buffered() > 0 {
+				return &bufferedConn{Conn: conn, r: br}, nil
+			}
+			return conn, nil
+		}
+		io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+		res.Body.Close()
+		if res.StatusCode != http.StatusProxyAuthRequired || round == maxAuthRounds || sysAuthSession == nil {
+			return nil, fmt.Errorf("invalid response status from HTTP proxy %s on CONNECT to %s: %v", proxyURL.Redacted(), target, res.Status)
+		}
+
+		// Continue the handshake in progress if the proxy sent a challenge
+		// for it, or start one with a scheme the proxy offers.
+		offered, challenge := parseProxyAuthenticate(res.Header.Values("Proxy-Authenticate"), scheme)
+		switch {
+		case sess != nil && offered == scheme && challenge != nil:
+			if res.Close {
+				return nil, fmt.Errorf("HTTP proxy %s closed the connection during %s auth", proxyURL.Redacted(), scheme)
+			}
+			token, err := sess.Step(challenge)
+			if err != nil {
+				return nil, fmt.Errorf("%s auth to HTTP proxy %s: %w", scheme, proxyURL.Redacted(), err)
+			}
+			auth = scheme + " " + base64.StdEncoding.EncodeToString(token)
+		case offered != "" && challenge == nil && (sess == nil || offered != scheme):
+			if sess != nil {
+				sess.Close()
+				sess = nil
+			}
+			scheme = offered
+			if sess, auth, err = startAuthSession(proxyURL, scheme); err != nil {
+				return nil, fmt.Errorf("%s auth to HTTP proxy %s: %w", scheme, proxyURL.Redacted(), err)
+			}
+			if res.Close {
+				go conn.Close()
+				if conn, err = dialProxy(ctx, dial, proxyURL); err != nil {
+					return nil, err
+				}
+				br.Reset(conn)
+			}
+		default:
+			return nil, fmt.Errorf("HTTP proxy %s rejected authentication on CONNECT to %s: %v", proxyURL.Redacted(), target, res.Status)
+		}
+	}
+}
+
+func hasFakeAuth() bool {
+	return os.Getenv("TS_DEBUG_FAKE_PROXY_AUTH") != ""
+}
+
+// startAuthSession starts a connection-based authentication handshake with
+// proxyURL, returning the session and the value of the Proxy-Authorization
+// header of its first step.
+func startAuthSession(proxyURL *url.URL, scheme string) (authSession, string, error) {
+	sess, err := sysAuthSession(proxyURL, scheme)
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := sess.Step(nil)
+	if err != nil {
+		sess.Close()
+		return nil, "", err
+	}
+	return sess, scheme + " " + base64.StdEncoding.EncodeToString(token), nil
+}
+
+// parseProxyAuthenticate returns the connection-based scheme to use from the
+// Proxy-Authenticate header values of a response, preferring cur, and the
+// decoded challenge token sent with it, if any. It returns the empty scheme
+// if the proxy offers none that are supported.
+func parseProxyAuthenticate(values []string, cur string) (scheme string, challenge []byte) {
+	for _, want := range []string{cur, "Negotiate", "NTLM"} {
+		if want == "" {
+			continue
+		}
+		for _, v := range values {
+			s, tok, _ := strings.Cut(strings.TrimSpace(v), " ")
+			if !strings.EqualFold(s, want) {
+				continue
+			}
+			if tok = strings.TrimSpace(tok); tok == "" {
+				return want, nil
+			}
+			challenge, err := base64.StdEncoding.DecodeString(tok)
+			if err != nil {
+				continue
+			}
+			return want, challenge
+		}
+	}
+	return "", nil
+}
+
+func ctxErrOr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// bufferedConn is a net.Conn whose reads are first served from r, which
+// holds data read from the proxy past the CONNECT response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// SetTransportProxy sets the provided Transport's Proxy to proxy, and
+// configures it to authenticate to the proxies with
+// SetTransportGetProxyConnectHeader.
+//
+// On platforms supporting connection-based proxy authentication, such as NTLM
+// on Windows, tr instead tunnels its connections to HTTPS hosts through the
+// proxy itself with Connect, dialing the proxy with tr.DialContext. It must
+// therefore be called after tr.DialContext is set, and tr.DialTLSContext
+// must not be set.
+func SetTransportProxy(tr *http.Transport, proxy func(*http.Request) (*url.URL, error)) {
+	tr.Proxy = proxy
+	SetTransportGetProxyConnectHeader(tr)
+	if sysAuthSession == nil || proxy == nil {
+		return
+	}
+	if tr.DialTLSContext != nil {
+		panic("tshttpproxy: SetTransportProxy on Transport with DialTLSContext")
+	}
+	dial := tr.DialContext
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	tr.Proxy = func(req *http.Request) (*url.URL, error) {
+		if req.URL.Scheme == "https" {
+			// Tunneled by DialTLSContext below.
+			return nil, nil
+		}
+		return proxy(req)
+	}
+	// DialTLSContext is used for HTTPS requests for which tr.Proxy returns
+	// no proxy, which is all of them.
+	tr.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		proxyURL, err := proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}})
+		if err != nil {
+			return nil, err
+		}
+		var conn net.Conn
+		if proxyURL == nil {
+			conn, err = dial(ctx, network, addr)
+		} else {
+			conn, err = Connect(ctx, dial, proxyURL, addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		var cfg *tls.Config
+		if tr.TLSClientConfig != nil {
+			cfg = tr.TLSClientConfig.Clone()
+		} else {
+			cfg = new(tls.Config)
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = host
+		}
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+}
+
+// dialProxy dials the proxy at proxyURL with dial, over TLS if it's an
+// HTTPS proxy.
+func dialProxy(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), proxyURL *url.URL) (net.Conn, error) {
+	switch proxyURL.Scheme {
+	case "http", "":
+		return dial(ctx, "tcp", net.JoinHostPort(proxyURL.Hostname(), cmp.Or(proxyURL.Port(), "80")))
+	case "https":
+		conn, err := dial(ctx, "tcp", net.JoinHostPort(proxyURL.Hostname(), cmp.Or(proxyURL.Port(), "443")))
+		if err != nil {
+			return nil, err
+		}
+		tc := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+	return nil, errors.New("unsupported proxy scheme " + proxyURL.Scheme)
+}
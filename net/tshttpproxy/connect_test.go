@@ -0,0 +1,275 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tshttpproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"tailscale.com/tstest"
+)
+
+// fakeSession is an authSession whose first token is "hello" and whose
+// response to a challenge is the challenge reversed.
+type fakeSession struct {
+	scheme string
+	closed bool
+}
+
+func (s *fakeSession) Step(challenge []byte) ([]byte, error) {
+	if challenge == nil {
+		return []byte("hello"), nil
+	}
+	out := bytes.Clone(challenge)
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+func (s *fakeSession) Close() { s.closed = true }
+
+func b64(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+// serveFakeProxy serves CONNECT requests on ln with handle, which returns
+// the response to each request on a connection. After a 200 response, the
+// connection is tunneled to upstream if non-empty, or echoes the data it
+// receives otherwise.
+func serveFakeProxy(t *testing.T, ln net.Listener, upstream string, handle func(round int, req *http.Request) *http.Response) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer c.Close()
+			br := bufio.NewReader(c)
+			for round := 1; ; round++ {
+				req, err := http.ReadRequest(br)
+				if err != nil {
+					return
+				}
+				if req.Method != "CONNECT" || req.Host != "example.com:443" {
+					t.Errorf("got request %v %v", req.Method, req.Host)
+				}
+				res := handle(round, req)
+				res.ProtoMajor, res.ProtoMinor = 1, 1
+				res.Write(c)
+				if res.StatusCode != http.StatusOK {
+					continue
+				}
+				if upstream == "" {
+					io.Copy(c, br)
+					return
+				}
+				uc, err := net.Dial("tcp", upstream)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer uc.Close()
+				go io.Copy(uc, br)
+				io.Copy(c, uc)
+				return
+			}
+		}()
+	}
+}
+
+func proxyResponse(code int, authenticate ...string) *http.Response {
+	res := &http.Response{
+		StatusCode: code,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+	}
+	for _, v := range authenticate {
+		res.Header.Add("Proxy-Authenticate", v)
+	}
+	return res
+}
+
+func TestConnect(t *testing.T) {
+	var sessions []*fakeSession
+	tstest.Replace(t, &sysAuthSession, func(u *url.URL, scheme string) (authSession, error) {
+		s := &fakeSession{scheme: scheme}
+		sessions = append(sessions, s)
+		return s, nil
+	})
+	tests := []struct {
+		name     string
+		user     *url.Userinfo
+		handle   func(round int, req *http.Request) *http.Response
+		wantErr  bool
+		wantAuth []string // schemes of the sessions started
+	}{
+		{
+			name: "no_auth_required",
+			handle: func(round int, req *http.Request) *http.Response {
+				return proxyResponse(http.StatusOK)
+			},
+			wantAuth: []string{"Negotiate"},
+		},
+		{
+			name: "basic",
+			user: url.UserPassword("user", "pass"),
+			handle: func(round int, req *http.Request) *http.Response {
+				if got, want := req.Header.Get("Proxy-Authorization"), "Basic "+b64("user:pass"); got != want {
+					t.Errorf("Proxy-Authorization = %q; want %q", got, want)
+					return proxyResponse(http.StatusProxyAuthRequired, "Basic")
+				}
+				return proxyResponse(http.StatusOK)
+			},
+		},
+		{
+			name: "negotiate_multi_leg",
+			handle: func(round int, req *http.Request) *http.Response {
+				auth := req.Header.Get("Proxy-Authorization")
+				switch round {
+				case 1:
+					if auth != "Negotiate "+b64("hello") {
+						t.Errorf("round 1: Proxy-Authorization = %q", auth)
+					}
+					return proxyResponse(http.StatusProxyAuthRequired, "Negotiate "+b64("abc"))
+				case 2:
+					if auth != "Negotiate "+b64("cba") {
+						t.Errorf("round 2: Proxy-Authorization = %q", auth)
+					}
+				}
+				return proxyResponse(http.StatusOK)
+			},
+			wantAuth: []string{"Negotiate"},
+		},
+		{
+			name: "ntlm_only",
+			handle: func(round int, req *http.Request) *http.Response {
+				auth := req.Header.Get("Proxy-Authorization")
+				switch round {
+				case 1:
+					return proxyResponse(http.StatusProxyAuthRequired, "Basic realm=\"proxy\"", "NTLM")
+				case 2:
+					if auth != "NTLM "+b64("hello") {
+						t.Errorf("round 2: Proxy-Authorization = %q", auth)
+					}
+					return proxyResponse(http.StatusProxyAuthRequired, "NTLM "+b64("xyz"))
+				case 3:
+					if auth != "NTLM "+b64("zyx") {
+						t.Errorf("round 3: Proxy-Authorization = %q", auth)
+					}
+				}
+				return proxyResponse(http.StatusOK)
+			},
+			wantAuth: []string{"Negotiate", "NTLM"},
+		},
+		{
+			name: "rejected",
+			handle: func(round int, req *http.Request) *http.Response {
+				return proxyResponse(http.StatusProxyAuthRequired, "Negotiate")
+			},
+			wantErr:  true,
+			wantAuth: []string{"Negotiate"},
+		},
+		{
+			name: "forbidden",
+			handle: func(round int, req *http.Request) *http.Response {
+				return proxyResponse(http.StatusForbidden)
+			},
+			wantErr:  true,
+			wantAuth: []string{"Negotiate"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions = nil
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			go serveFakeProxy(t, ln, "", tt.handle)
+
+			proxyURL := &url.URL{Scheme: "http", Host: ln.Addr().String(), User: tt.user}
+			var d net.Dialer
+			conn, err := Connect(context.Background(), d.DialContext, proxyURL, "example.com:443")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Connect: err = %v; want error: %v", err, tt.wantErr)
+			}
+			if err == nil {
+				defer conn.Close()
+				fmt.Fprintf(conn, "ping")
+				buf := make([]byte, 4)
+				if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+					t.Errorf("echo through tunnel = %q, %v", buf, err)
+				}
+			}
+			var schemes []string
+			for _, s := range sessions {
+				schemes = append(schemes, s.scheme)
+				if !s.closed {
+					t.Errorf("%s session not closed", s.scheme)
+				}
+			}
+			if fmt.Sprint(schemes) != fmt.Sprint(tt.wantAuth) {
+				t.Errorf("sessions = %v; want %v", schemes, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestSetTransportProxy(t *testing.T) {
+	tstest.Replace(t, &sysAuthSession, func(u *url.URL, scheme string) (authSession, error) {
+		return &fakeSession{scheme: scheme}, nil
+	})
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var rounds int
+	go serveFakeProxy(t, ln, backend.Listener.Addr().String(), func(round int, req *http.Request) *http.Response {
+		rounds = round
+		if round == 1 {
+			return proxyResponse(http.StatusProxyAuthRequired, "Negotiate "+b64("abc"))
+		}
+		return proxyResponse(http.StatusOK)
+	})
+	proxyURL := &url.URL{Scheme: "http", Host: ln.Addr().String()}
+
+	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	SetTransportProxy(tr, func(*http.Request) (*url.URL, error) { return proxyURL, nil })
+	defer tr.CloseIdleConnections()
+
+	// The fake proxy requires the host to be example.com:443; it tunnels
+	// to the backend regardless.
+	req, err := http.NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if string(body) != "ok" {
+		t.Errorf("body = %q; want %q", body, "ok")
+	}
+	if rounds != 2 {
+		t.Errorf("proxy handled %d CONNECT requests; want 2", rounds)
+	}
+}
@@ -7,5 +7,6 @@
 
 //sys globalFree(hglobal winHGlobal) (err error) [failretval==0] = kernel32.GlobalFree
 //sys winHTTPCloseHandle(whi winHTTPInternet) (err error) [failretval==0] = winhttp.WinHttpCloseHandle
+//sys winHTTPGetIEProxyConfigForCurrentUser(config *winHTTPCurrentUserIEProxyConfig) (err error) [failretval==0] = winhttp.WinHttpGetIEProxyConfigForCurrentUser
 //sys winHTTPGetProxyForURL(whi winHTTPInternet, url *uint16, options *winHTTPAutoProxyOptions, proxyInfo *winHTTPProxyInfo) (err error) [failretval==0] = winhttp.WinHttpGetProxyForUrl
 //sys winHTTPOpen(agent *uint16, accessType uint32, proxy *uint16, proxyBypass *uint16, flags uint32) (whi winHTTPInternet, err error) [failretval==0] = winhttp.WinHttpOpen
@@ -17,7 +17,9 @@
 	"time"
 	"unsafe"
 
+	"github.com/alexbrainman/sspi"
 	"github.com/alexbrainman/sspi/negotiate"
+	"github.com/alexbrainman/sspi/ntlm"
 	"golang.org/x/sys/windows"
 	"tailscale.com/hostinfo"
 	"tailscale.com/syncs"
@@ -29,6 +31,7 @@
 func init() {
 	sysProxyFromEnv = proxyFromWinHTTPOrCache
 	sysAuthHeader = sysAuthHeaderWindows
+	sysAuthSession = sysAuthSessionWindows
 }
 
 var cachedProxy struct {
@@ -161,6 +164,7 @@ func proxyFromWinHTTP(ctx context.Context, urlStr string) (proxy *url.URL, err e
 	winHTTP_ACCESS_TYPE_AUTOMATIC_PROXY = 4
 	winHTTP_AUTOPROXY_ALLOW_AUTOCONFIG  = 0x00000100
 	winHTTP_AUTOPROXY_AUTO_DETECT       = 1
+	winHTTP_AUTOPROXY_CONFIG_URL        = 2
 	winHTTP_AUTO_DETECT_TYPE_DHCP       = 0x00000001
 	winHTTP_AUTO_DETECT_TYPE_DNS_A      = 0x00000002
 )
@@ -241,14 +245,55 @@ func (pi *winHTTPProxyInfo) free() {
 var proxyForURLOpts = &winHTTPAutoProxyOptions{
 	DwFlags:           winHTTP_AUTOPROXY_ALLOW_AUTOCONFIG | winHTTP_AUTOPROXY_AUTO_DETECT,
 	DwAutoDetectFlags: winHTTP_AUTO_DETECT_TYPE_DHCP, // | winHTTP_AUTO_DETECT_TYPE_DNS_A,
+	// Send the machine's credentials if the server hosting the PAC file
+	// requires authentication.
+	FAutoLogonIfChallenged: 1,
+}
+
+// WINHTTP_CURRENT_USER_IE_PROXY_CONFIG
+// https://learn.microsoft.com/en-us/windows/win32/api/winhttp/ns-winhttp-winhttp_current_user_ie_proxy_config
+type winHTTPCurrentUserIEProxyConfig struct {
+	FAutoDetect   int32 // BOOL
+	AutoConfigUrl *uint16
+	Proxy         *uint16
+	ProxyBypass   *uint16
+}
+
+// configuredAutoConfigURL returns the URL of the PAC file configured in the
+// Internet Options of the current user, or nil if there's none. For
+// tailscaled running as LocalSystem and machines with the "Make proxy
+// settings per-machine" Group Policy, those are the machine-wide settings
+// deployed by administrators. The returned string must be freed with
+// globalFreeUTF16Ptr.
+func configuredAutoConfigURL() *uint16 {
+	var cfg winHTTPCurrentUserIEProxyConfig
+	if err := winHTTPGetIEProxyConfigForCurrentUser(&cfg); err != nil {
+		return nil
+	}
+	if cfg.Proxy != nil {
+		globalFreeUTF16Ptr(cfg.Proxy)
+	}
+	if cfg.ProxyBypass != nil {
+		globalFreeUTF16Ptr(cfg.ProxyBypass)
+	}
+	return cfg.AutoConfigUrl
 }
 
 func (hi winHTTPInternet) GetProxyForURL(urlStr string) (string, error) {
+	// Evaluate the PAC file configured by the administrator, if any, in
+	// addition to those found by auto-detection.
+	opts := *proxyForURLOpts
+	if pac := configuredAutoConfigURL(); pac != nil {
+		defer globalFreeUTF16Ptr(pac)
+		opts.DwFlags |= winHTTP_AUTOPROXY_CONFIG_URL
+		opts.AutoConfigUrl = pac
+	}
+
 	var out winHTTPProxyInfo
 	err := winHTTPGetProxyForURL(
 		hi,
 		windows.StringToUTF16Ptr(urlStr),
-		proxyForURLOpts,
+		&opts,
 		&out,
 	)
 	if err != nil {
@@ -274,3 +319,73 @@ func sysAuthHeaderWindows(u *url.URL) (string, error) {
 
 	return "Negotiate " + base64.StdEncoding.EncodeToString(token), nil
 }
+
+func sysAuthSessionWindows(u *url.URL, scheme string) (authSession, error) {
+	switch scheme {
+	case "Negotiate":
+		creds, err := negotiate.AcquireCurrentUserCredentials()
+		if err != nil {
+			return nil, fmt.Errorf("negotiate.AcquireCurrentUserCredentials: %w", err)
+		}
+		return &negotiateSession{creds: creds, spn: "HTTP/" + u.Hostname()}, nil
+	case "NTLM":
+		creds, err := ntlm.AcquireCurrentUserCredentials()
+		if err != nil {
+			return nil, fmt.Errorf("ntlm.AcquireCurrentUserCredentials: %w", err)
+		}
+		return &ntlmSession{creds: creds}, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy auth scheme %q", scheme)
+}
+
+// negotiateSession is an authSession using the SSPI Negotiate package,
+// which picks Kerberos or NTLM.
+type negotiateSession struct {
+	creds  *sspi.Credentials
+	spn    string
+	secCtx *negotiate.ClientContext
+}
+
+func (s *negotiateSession) Step(challenge []byte) (token []byte, err error) {
+	if s.secCtx == nil {
+		s.secCtx, token, err = negotiate.NewClientContext(s.creds, s.spn)
+		if err != nil {
+			return nil, fmt.Errorf("negotiate.NewClientContext: %w", err)
+		}
+		return token, nil
+	}
+	_, token, err = s.secCtx.Update(challenge)
+	return token, err
+}
+
+func (s *negotiateSession) Close() {
+	if s.secCtx != nil {
+		s.secCtx.Release()
+	}
+	s.creds.Release()
+}
+
+// ntlmSession is an authSession using the SSPI NTLM package, for proxies
+// that offer NTLM but not Negotiate.
+type ntlmSession struct {
+	creds  *sspi.Credentials
+	secCtx *ntlm.ClientContext
+}
+
+func (s *ntlmSession) Step(challenge []byte) (token []byte, err error) {
+	if s.secCtx == nil {
+		s.secCtx, token, err = ntlm.NewClientContext(s.creds)
+		if err != nil {
+			return nil, fmt.Errorf("ntlm.NewClientContext: %w", err)
+		}
+		return token, nil
+	}
+	return s.secCtx.Update(challenge)
+}
+
+func (s *ntlmSession) Close() {
+	if s.secCtx != nil {
+		s.secCtx.Release()
+	}
+	s.creds.Release()
+}
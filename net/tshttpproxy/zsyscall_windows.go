@@ -41,10 +41,11 @@ func errnoErr(e syscall.Errno) error {
 	modkernel32 = windows.NewLazySystemDLL("kernel32.dll")
 	modwinhttp  = windows.NewLazySystemDLL("winhttp.dll")
 
-	procGlobalFree            = modkernel32.NewProc("GlobalFree")
-	procWinHttpCloseHandle    = modwinhttp.NewProc("WinHttpCloseHandle")
-	procWinHttpGetProxyForUrl = modwinhttp.NewProc("WinHttpGetProxyForUrl")
-	procWinHttpOpen           = modwinhttp.NewProc("WinHttpOpen")
+	procGlobalFree                            = modkernel32.NewProc("GlobalFree")
+	procWinHttpCloseHandle                    = modwinhttp.NewProc("WinHttpCloseHandle")
+	procWinHttpGetIEProxyConfigForCurrentUser = modwinhttp.NewProc("WinHttpGetIEProxyConfigForCurrentUser")
+	procWinHttpGetProxyForUrl                 = modwinhttp.NewProc("WinHttpGetProxyForUrl")
+	procWinHttpOpen                           = modwinhttp.NewProc("WinHttpOpen")
 )
 
 func globalFree(hglobal winHGlobal) (err error) {
@@ -63,6 +64,14 @@ func winHTTPCloseHandle(whi winHTTPInternet) (err error) {
 	return
 }
 
+func winHTTPGetIEProxyConfigForCurrentUser(config *winHTTPCurrentUserIEProxyConfig) (err error) {
+	r1, _, e1 := syscall.Syscall(procWinHttpGetIEProxyConfigForCurrentUser.Addr(), 1, uintptr(unsafe.Pointer(config)), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
 func winHTTPGetProxyForURL(whi winHTTPInternet, url *uint16, options *winHTTPAutoProxyOptions, proxyInfo *winHTTPProxyInfo) (err error) {
 	r1, _, e1 := syscall.Syscall6(procWinHttpGetProxyForUrl.Addr(), 4, uintptr(whi), uintptr(unsafe.Pointer(url)), uintptr(unsafe.Pointer(options)), uintptr(unsafe.Pointer(proxyInfo)), 0, 0)
 	if r1 == 0 {
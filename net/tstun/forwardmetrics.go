@@ -0,0 +1,99 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tstun
+
+import (
+	"net/netip"
+
+	"github.com/gaissmai/bart"
+	"tailscale.com/net/packet"
+	"tailscale.com/net/tsaddr"
+)
+
+// Traffic that a subnet router or exit node forwards between its peers and
+// the networks it advertises routes to is counted per advertised route and,
+// for exit node traffic, per user of the peer, so that their operators can
+// see who and what consumes their capacity.
+
+// Directions of forwarded traffic.
+const (
+	directionInbound  = "inbound"  // from a peer to an advertised route
+	directionOutbound = "outbound" // from an advertised route back to a peer
+)
+
+type forwardedLabel struct {
+	// Route is the advertised route that the traffic was forwarded to or
+	// from, such as 10.0.0.0/8 or 0.0.0.0/0 for exit node traffic.
+	Route string
+	// Direction is inbound or outbound.
+	Direction string
+}
+
+type exitNodeUserLabel struct {
+	// User is the login name of the user of the peer that uses this node
+	// as an exit node.
+	User string
+	// Direction is inbound or outbound.
+	Direction string
+}
+
+// forwardedRoute is an advertised route, as found by a forwardingTable.
+type forwardedRoute struct {
+	label string // the route, as a metric label
+	exit  bool   // whether it's an exit route
+}
+
+// forwardingTable is the configuration of the forwarded traffic metrics.
+type forwardingTable struct {
+	routes    bart.Table[forwardedRoute]
+	peerUsers map[netip.Addr]string // peer Tailscale IP => user login name
+}
+
+// SetForwardingMetrics sets the routes that this node advertises and the
+// users of its peers, by their Tailscale IPs, for the metrics that break
+// down forwarded traffic by route and exit node user. If routes is empty,
+// forwarded traffic isn't counted.
+//
+// The map ownership passes to the Wrapper.
+func (t *Wrapper) SetForwardingMetrics(routes []netip.Prefix, peerUsers map[netip.Addr]string) {
+	if len(routes) == 0 {
+		t.forwarding.Store(nil)
+		return
+	}
+	ft := &forwardingTable{peerUsers: peerUsers}
+	for _, r := range routes {
+		r = r.Masked()
+		ft.routes.Insert(r, forwardedRoute{
+			label: r.String(),
+			exit:  tsaddr.IsExitRoute(r),
+		})
+	}
+	t.forwarding.Store(ft)
+}
+
+// countForwarded counts p in the forwarded traffic metrics if it's forwarded
+// between the peer at peerIP and the advertised route containing routeIP.
+// Traffic to or from Tailscale IPs, including this node's own, isn't
+// forwarded, so isn't counted, except for 4via6 routes.
+func (t *Wrapper) countForwarded(p *packet.Parsed, direction string, routeIP, peerIP netip.Addr) {
+	ft := t.forwarding.Load()
+	if ft == nil {
+		return
+	}
+	if tsaddr.IsTailscaleIP(routeIP) && !tsaddr.TailscaleViaRange().Contains(routeIP) {
+		return
+	}
+	r, ok := ft.routes.Lookup(routeIP)
+	if !ok {
+		return
+	}
+	n := int64(len(p.Buffer()))
+	t.metrics.forwardedBytesTotal.Add(forwardedLabel{Route: r.label, Direction: direction}, n)
+	if !r.exit {
+		return
+	}
+	if user, ok := ft.peerUsers[peerIP]; ok {
+		t.metrics.exitNodeUserBytesTotal.Add(exitNodeUserLabel{User: user, Direction: direction}, n)
+	}
+}
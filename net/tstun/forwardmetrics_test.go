@@ -0,0 +1,92 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tstun
+
+import (
+	"expvar"
+	"net/netip"
+	"testing"
+
+	tsmetrics "tailscale.com/metrics"
+	"tailscale.com/wgengine/filter"
+)
+
+func TestForwardingMetrics(t *testing.T) {
+	chtun, tun := newChannelTUN(t.Logf, false)
+	defer tun.Close()
+	tun.disableFilter = false
+	tun.SetFilter(filter.NewAllowAllForTest(t.Logf))
+	tun.SetForwardingMetrics(nets("10.0.0.0/8", "10.1.0.0/16", "0.0.0.0/0"), map[netip.Addr]string{
+		netip.MustParseAddr("100.64.0.2"): "alice@example.com",
+	})
+
+	go func() {
+		for {
+			select {
+			case <-chtun.Inbound:
+			case <-tun.closed:
+				return
+			}
+		}
+	}()
+	in := func(data []byte) {
+		t.Helper()
+		if _, err := tun.Write([][]byte{data}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := func(data []byte) {
+		t.Helper()
+		chtun.Outbound <- data
+		buf := make([]byte, MaxPacketSize)
+		if _, err := tun.Read([][]byte{buf}, make([]int, 1), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub := udp4("100.64.0.2", "10.1.2.3", 1, 2)
+	exit := udp4("100.64.0.2", "8.8.8.8", 1, 53)
+	in(sub)
+	in(sub)
+	out(udp4("10.1.2.3", "100.64.0.2", 2, 1))
+	in(exit)
+	in(udp4("100.64.0.3", "9.9.9.9", 1, 53)) // unknown user
+	in(udp4("100.64.0.2", "100.64.0.1", 1, 2))
+	out(udp4("100.64.0.1", "100.64.0.2", 2, 1))
+
+	get := func(v expvar.Var) int64 {
+		if v == nil {
+			return 0
+		}
+		return v.(*expvar.Int).Value()
+	}
+	n := int64(len(sub))
+	for _, tt := range []struct {
+		name string
+		got  int64
+		want int64
+	}{
+		{"route-in", get(tun.metrics.forwardedBytesTotal.Get(forwardedLabel{"10.1.0.0/16", directionInbound})), 2 * n},
+		{"route-out", get(tun.metrics.forwardedBytesTotal.Get(forwardedLabel{"10.1.0.0/16", directionOutbound})), n},
+		{"less-specific-route", get(tun.metrics.forwardedBytesTotal.Get(forwardedLabel{"10.0.0.0/8", directionInbound})), 0},
+		{"exit-in", get(tun.metrics.forwardedBytesTotal.Get(forwardedLabel{"0.0.0.0/0", directionInbound})), 2 * int64(len(exit))},
+		{"exit-user-in", get(tun.metrics.exitNodeUserBytesTotal.Get(exitNodeUserLabel{"alice@example.com", directionInbound})), int64(len(exit))},
+		{"exit-user-out", get(tun.metrics.exitNodeUserBytesTotal.Get(exitNodeUserLabel{"alice@example.com", directionOutbound})), 0},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %d bytes; want %d", tt.name, tt.got, tt.want)
+		}
+	}
+
+	var labels int
+	tun.metrics.forwardedBytesTotal.Do(func(tsmetrics.KeyValue[forwardedLabel]) { labels++ })
+	if labels != 3 {
+		t.Errorf("got %d forwarded route labels; want 3 (Tailscale IPs aren't forwarded)", labels)
+	}
+
+	tun.SetForwardingMetrics(nil, nil)
+	in(sub)
+	if got := get(tun.metrics.forwardedBytesTotal.Get(forwardedLabel{"10.1.0.0/16", directionInbound})); got != 2*n {
+		t.Errorf("after disabling: got %d bytes; want %d", got, 2*n)
+	}
+}
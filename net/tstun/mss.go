@@ -0,0 +1,82 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tstun
+
+import (
+	"net/netip"
+
+	"github.com/gaissmai/bart"
+	"tailscale.com/net/packet"
+	"tailscale.com/net/packet/checksum"
+	"tailscale.com/types/ipproto"
+	"tailscale.com/types/key"
+	"tailscale.com/util/clientmetric"
+	"tailscale.com/wgengine/wgcfg"
+)
+
+// TCP connections through the TUN negotiate their maximum segment size (MSS)
+// from the MTU of the TUN, which is the same for all peers. When the path MTU
+// to a peer is known to be different (see PeerPathMTU), the MSS option of the
+// SYN and SYN-ACK to or from the peer is lowered so that full-sized segments
+// fit the path to that peer instead of being dropped by it. This lets the TUN
+// MTU be raised for peers with paths that carry larger frames without
+// blackholing TCP to peers that don't.
+
+var metricTCPMSSClamped = clientmetric.NewCounter("tstun_tcp_mss_clamped")
+
+// peerKeyTableFromWGConfig returns a table of the node keys of the peers in
+// wcfg indexed by their allowed IPs, or nil if there are none.
+func peerKeyTableFromWGConfig(wcfg *wgcfg.Config) *bart.Table[key.NodePublic] {
+	if wcfg == nil || len(wcfg.Peers) == 0 {
+		return nil
+	}
+	t := new(bart.Table[key.NodePublic])
+	for _, p := range wcfg.Peers {
+		for _, ip := range p.AllowedIPs {
+			t.Insert(ip, p.PublicKey)
+		}
+	}
+	return t
+}
+
+// mssForWireMTU returns the largest TCP MSS whose segments fit in a
+// WireGuard packet of wireMTU bytes on the wire.
+func mssForWireMTU(wireMTU WireMTU, is6 bool) uint16 {
+	hdrLen := TUNMTU(20 + 20) // IPv4 + TCP header
+	if is6 {
+		hdrLen = 40 + 20 // IPv6 + TCP header
+	}
+	tunMTU := WireToTUNMTU(wireMTU)
+	if tunMTU <= hdrLen {
+		return 0
+	}
+	return uint16(min(tunMTU-hdrLen, 0xffff))
+}
+
+// clampTCPMSS lowers the MSS of p, if it is a TCP SYN or SYN-ACK exchanged
+// with the peer that handles peerIP, to fit the path MTU to that peer.
+func (t *Wrapper) clampTCPMSS(p *packet.Parsed, peerIP netip.Addr) {
+	if p.IPProto != ipproto.TCP || p.TCPFlags&packet.TCPSyn == 0 || t.PeerPathMTU == nil {
+		return
+	}
+	keys := t.peerKeys.Load()
+	if keys == nil {
+		return
+	}
+	k, ok := keys.Lookup(peerIP)
+	if !ok {
+		return
+	}
+	wireMTU, ok := t.PeerPathMTU(k)
+	if !ok {
+		return
+	}
+	mss := mssForWireMTU(wireMTU, p.IPVersion == 6)
+	if mss == 0 {
+		return
+	}
+	if checksum.ClampTCPMSS(p, mss) {
+		metricTCPMSSClamped.Add(1)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tstun
+
+import (
+	"net/netip"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"tailscale.com/net/packet"
+	"tailscale.com/types/key"
+	"tailscale.com/wgengine/wgcfg"
+)
+
+func TestClampTCPMSS(t *testing.T) {
+	self := netip.MustParseAddr("100.64.0.1")
+	peer1, peer2 := key.NewNode().Public(), key.NewNode().Public()
+	tw := &Wrapper{}
+	tw.SetWGConfig(&wgcfg.Config{
+		Peers: []wgcfg.Peer{
+			{PublicKey: peer1, AllowedIPs: []netip.Prefix{netip.MustParsePrefix("100.64.0.2/32")}},
+			{PublicKey: peer2, AllowedIPs: []netip.Prefix{netip.MustParsePrefix("100.64.0.3/32"), netip.MustParsePrefix("192.168.0.0/24")}},
+		},
+	})
+	tw.PeerPathMTU = func(k key.NodePublic) (WireMTU, bool) {
+		if k == peer1 {
+			return 9000, true
+		}
+		return SafeWireMTU(), true
+	}
+
+	syn := func(dst string, flags header.TCPFlags, mss uint16) *packet.Parsed {
+		src, dst4 := tcpip.AddrFrom4(self.As4()), tcpip.AddrFrom4(netip.MustParseAddr(dst).As4())
+		tcpLen := header.TCPMinimumSize + header.TCPOptionMSSLength
+		b := header.IPv4(make([]byte, header.IPv4MinimumSize+tcpLen))
+		b.Encode(&header.IPv4Fields{
+			TotalLength: uint16(len(b)),
+			TTL:         64,
+			Protocol:    uint8(header.TCPProtocolNumber),
+			SrcAddr:     src,
+			DstAddr:     dst4,
+		})
+		tcp := header.TCP(b[header.IPv4MinimumSize:])
+		tcp.Encode(&header.TCPFields{
+			SrcPort:    1234,
+			DstPort:    80,
+			DataOffset: uint8(tcpLen),
+			Flags:      flags,
+			WindowSize: 65535,
+		})
+		header.EncodeMSSOption(uint32(mss), tcp[header.TCPMinimumSize:])
+		tcp.SetChecksum(^tcp.CalculateChecksum(header.PseudoHeaderChecksum(header.TCPProtocolNumber, src, dst4, uint16(tcpLen))))
+		p := new(packet.Parsed)
+		p.Decode(b)
+		return p
+	}
+	mssOf := func(p *packet.Parsed) uint16 {
+		return header.ParseSynOptions(header.TCP(p.Transport()).Options(), false).MSS
+	}
+
+	const jumboMSS = 8920 - 40
+	safeMSS := mssForWireMTU(SafeWireMTU(), false)
+	if safeMSS != 1240 {
+		t.Fatalf("MSS for the safe MTU = %d, want 1240", safeMSS)
+	}
+	tests := []struct {
+		name  string
+		dst   string
+		flags header.TCPFlags
+		mss   uint16
+		want  uint16
+	}{
+		{"jumbo-path", "100.64.0.2", header.TCPFlagSyn, 8960 - 40, jumboMSS},
+		{"jumbo-path-small-mss", "100.64.0.2", header.TCPFlagSyn, 1200, 1200},
+		{"safe-path", "100.64.0.3", header.TCPFlagSyn, jumboMSS, safeMSS},
+		{"safe-path-syn-ack", "100.64.0.3", header.TCPFlagSyn | header.TCPFlagAck, jumboMSS, safeMSS},
+		{"subnet-route", "192.168.0.7", header.TCPFlagSyn, jumboMSS, safeMSS},
+		{"not-syn", "100.64.0.3", header.TCPFlagAck, jumboMSS, jumboMSS},
+		{"unknown-peer", "100.64.0.9", header.TCPFlagSyn, jumboMSS, jumboMSS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := syn(tt.dst, tt.flags, tt.mss)
+			tw.clampTCPMSS(p, p.Dst.Addr())
+			if got := mssOf(p); got != tt.want {
+				t.Errorf("MSS = %d, want %d", got, tt.want)
+			}
+			ip := header.IPv4(p.Buffer())
+			if !header.TCP(ip.Payload()).IsChecksumValid(ip.SourceAddress(), ip.DestinationAddress(), 0, 0) {
+				t.Error("invalid TCP checksum")
+			}
+		})
+	}
+
+	tw.PeerPathMTU = func(key.NodePublic) (WireMTU, bool) { return 0, false }
+	p := syn("100.64.0.3", header.TCPFlagSyn, jumboMSS)
+	tw.clampTCPMSS(p, p.Dst.Addr())
+	if got := mssOf(p); got != jumboMSS {
+		t.Errorf("MSS = %d with unknown path MTU, want it left at %d", got, jumboMSS)
+	}
+}
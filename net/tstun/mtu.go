@@ -42,6 +42,10 @@
 //
 // Peer MTU: This is the path MTU to a peer's current best endpoint. It defaults
 // to the Safe MTU unless we have path MTU probe results that tell us otherwise.
+// When peer path MTU discovery is enabled, the MSS of TCP connections to and
+// from each peer is clamped to fit its Peer MTU, so TCP is neither held to
+// the Safe MTU on paths that carry larger frames nor blackholed on paths that
+// carry only smaller frames than the Current MTU.
 //
 // Initial MTU: This is the MTU tailscaled creates the TUN with. In order of
 // priority, it is:
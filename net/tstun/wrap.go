@@ -117,6 +117,14 @@ type Wrapper struct {
 	// peerConfig stores the current NAT configuration.
 	peerConfig atomic.Pointer[peerConfigTable]
 
+	// peerKeys stores the node keys of the current peers, indexed by
+	// their allowed IPs, for PeerPathMTU lookups.
+	peerKeys atomic.Pointer[bart.Table[key.NodePublic]]
+
+	// forwarding stores the advertised routes and peer users for the
+	// forwarded traffic metrics, or nil if they're not counted.
+	forwarding atomic.Pointer[forwardingTable]
+
 	// vectorBuffer stores the oldest unconsumed packet vector from tdev. It is
 	// allocated in wrap() and the underlying arrays should never grow.
 	vectorBuffer [][]byte
@@ -198,6 +206,11 @@ type Wrapper struct {
 	// running for the given IP address.
 	PeerAPIPort func(netip.Addr) (port uint16, ok bool)
 
+	// PeerPathMTU, if non-nil, returns the wire MTU of the current path to
+	// the peer with the given node key. If it reports true, the MSS of TCP
+	// connections to and from the peer is clamped to fit that MTU.
+	PeerPathMTU func(key.NodePublic) (mtu WireMTU, ok bool)
+
 	// disableFilter disables all filtering when set. This should only be used in tests.
 	disableFilter bool
 
@@ -215,12 +228,26 @@ type Wrapper struct {
 type metrics struct {
 	inboundDroppedPacketsTotal  *tsmetrics.MultiLabelMap[usermetric.DropLabels]
 	outboundDroppedPacketsTotal *tsmetrics.MultiLabelMap[usermetric.DropLabels]
+	forwardedBytesTotal         *tsmetrics.MultiLabelMap[forwardedLabel]
+	exitNodeUserBytesTotal      *tsmetrics.MultiLabelMap[exitNodeUserLabel]
 }
 
 func registerMetrics(reg *usermetric.Registry) *metrics {
 	return &metrics{
 		inboundDroppedPacketsTotal:  reg.DroppedPacketsInbound(),
 		outboundDroppedPacketsTotal: reg.DroppedPacketsOutbound(),
+		forwardedBytesTotal: usermetric.NewMultiLabelMapWithRegistry[forwardedLabel](
+			reg,
+			"tailscaled_forwarded_bytes_total",
+			"counter",
+			"Counts the number of bytes forwarded between peers and the routes advertised by the node",
+		),
+		exitNodeUserBytesTotal: usermetric.NewMultiLabelMapWithRegistry[exitNodeUserLabel](
+			reg,
+			"tailscaled_exit_node_user_bytes_total",
+			"counter",
+			"Counts the number of bytes forwarded for the users of peers using the node as an exit node",
+		),
 	}
 }
 
@@ -804,6 +831,7 @@ func (t *Wrapper) SetWGConfig(wcfg *wgcfg.Config) {
 			sip.SetIP(findV4(wcfg.Addresses), findV6(wcfg.Addresses))
 		}
 	}
+	t.peerKeys.Store(peerKeyTableFromWGConfig(wcfg))
 	cfg := peerConfigTableFromWGConfig(wcfg)
 	old := t.peerConfig.Swap(cfg)
 	if !reflect.DeepEqual(old, cfg) {
@@ -883,11 +911,14 @@ func (t *Wrapper) filterPacketOutboundToWireGuard(p *packet.Parsed, pc *peerConf
 		return filter.Drop, gro
 	}
 
+	t.clampTCPMSS(p, p.Dst.Addr())
+
 	if t.PostFilterPacketOutboundToWireGuard != nil {
 		if res := t.PostFilterPacketOutboundToWireGuard(p, t); res.IsDrop() {
 			return res, gro
 		}
 	}
+	t.countForwarded(p, directionOutbound, p.Src.Addr(), p.Dst.Addr())
 	return filter.Accept, gro
 }
 
@@ -1053,6 +1084,10 @@ func (t *Wrapper) injectedRead(res tunInjectedRead, outBuffs [][]byte, sizes []i
 	defer parsedPacketPool.Put(p)
 	p.Decode(pkt)
 
+	// Netstack injects the traffic that it forwards back to peers, so
+	// count it here too.
+	t.countForwarded(p, directionOutbound, p.Src.Addr(), p.Dst.Addr())
+
 	invertGSOChecksum(pkt, gso)
 	pc.snat(p)
 	invertGSOChecksum(pkt, gso)
@@ -1178,6 +1213,12 @@ func (t *Wrapper) filterPacketInboundFromWireGuard(p *packet.Parsed, captHook ca
 		return filter.Drop, gro
 	}
 
+	t.clampTCPMSS(p, p.Src.Addr())
+
+	// Count forwarded traffic before netstack, if it forwards it, takes
+	// it from the post-filter hook.
+	t.countForwarded(p, directionInbound, p.Dst.Addr(), p.Src.Addr())
+
 	if t.PostFilterPacketInboundFromWireGuard != nil {
 		var res filter.Response
 		res, gro = t.PostFilterPacketInboundFromWireGuard(p, t, gro)
@@ -0,0 +1,101 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"tailscale.com/types/logger"
+	"tailscale.com/types/opt"
+)
+
+// Names of the posture attributes collected by this package.
+const (
+	// AttrDiskEncryption is the encryption state of the system disk, as a
+	// DiskEncryption.
+	AttrDiskEncryption = "diskEncryption"
+	// AttrOSUpdates is the OS update status, as an OSUpdates.
+	AttrOSUpdates = "osUpdates"
+	// AttrEDRAgents are the names of the known endpoint detection and
+	// response (EDR) agents installed on the device, as a []string.
+	AttrEDRAgents = "edrAgents"
+)
+
+// DiskEncryption is the value of the AttrDiskEncryption attribute.
+type DiskEncryption struct {
+	// Encrypted is whether the system disk is encrypted.
+	Encrypted bool
+	// Method is the encryption technology, such as "luks", "filevault" or
+	// "bitlocker". It is empty if the disk is not encrypted.
+	Method string `json:",omitempty"`
+}
+
+// OSUpdates is the value of the AttrOSUpdates attribute. Fields that cannot
+// be determined on the device are left unset.
+type OSUpdates struct {
+	// AutomaticUpdates is whether the OS installs updates automatically.
+	AutomaticUpdates opt.Bool `json:",omitempty"`
+	// RebootRequired is whether updates were installed that only take
+	// effect after a reboot.
+	RebootRequired opt.Bool `json:",omitempty"`
+	// LastUpdated is when OS updates were last installed.
+	LastUpdated *time.Time `json:",omitempty"`
+}
+
+// A Collector collects a device posture attribute.
+type Collector struct {
+	// Name is the name of the attribute, such as AttrDiskEncryption.
+	Name string
+	// Collect returns the value of the attribute, which must be encodable
+	// as JSON. It returns an error wrapping ErrUnsupported if the attribute
+	// cannot be collected on this platform.
+	Collect func(logf logger.Logf) (any, error)
+}
+
+var (
+	attrCollectorsMu sync.Mutex
+	attrCollectors   []Collector
+)
+
+// RegisterCollector registers a collector of a posture attribute, replacing
+// any collector already registered for the same attribute. It allows
+// platforms to provide attributes that this package cannot collect by
+// itself.
+func RegisterCollector(c Collector) {
+	attrCollectorsMu.Lock()
+	defer attrCollectorsMu.Unlock()
+	for i, old := range attrCollectors {
+		if old.Name == c.Name {
+			attrCollectors[i] = c
+			return
+		}
+	}
+	attrCollectors = append(attrCollectors, c)
+}
+
+// CollectAttributes runs the registered collectors and returns the values of
+// the attributes they collected, and the errors of those that failed, by
+// attribute name. Attributes that are not supported on this platform are
+// omitted from both.
+func CollectAttributes(logf logger.Logf) (attrs map[string]any, errs map[string]error) {
+	attrCollectorsMu.Lock()
+	cs := append([]Collector(nil), attrCollectors...)
+	attrCollectorsMu.Unlock()
+
+	attrs = make(map[string]any)
+	errs = make(map[string]error)
+	for _, c := range cs {
+		v, err := c.Collect(logf)
+		switch {
+		case errors.Is(err, ErrUnsupported):
+		case err != nil:
+			errs[c.Name] = err
+		default:
+			attrs[c.Name] = v
+		}
+	}
+	return attrs, errs
+}
@@ -0,0 +1,45 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"tailscale.com/tstest"
+	"tailscale.com/types/logger"
+)
+
+func TestCollectAttributes(t *testing.T) {
+	tstest.Replace(t, &attrCollectors, nil)
+	RegisterCollector(Collector{Name: "a", Collect: func(logger.Logf) (any, error) { return "old", nil }})
+	RegisterCollector(Collector{Name: "b", Collect: func(logger.Logf) (any, error) { return nil, errors.New("broken") }})
+	RegisterCollector(Collector{Name: "c", Collect: func(logger.Logf) (any, error) { return nil, fmt.Errorf("c: %w", ErrUnsupported) }})
+	RegisterCollector(Collector{Name: "a", Collect: func(logger.Logf) (any, error) { return "new", nil }})
+
+	attrs, errs := CollectAttributes(t.Logf)
+	if want := map[string]any{"a": "new"}; !reflect.DeepEqual(attrs, want) {
+		t.Errorf("attrs = %v, want %v", attrs, want)
+	}
+	if len(errs) != 1 || errs["b"] == nil || errs["b"].Error() != "broken" {
+		t.Errorf("errs = %v, want only b's error", errs)
+	}
+}
+
+func TestInstalledEDRAgents(t *testing.T) {
+	agents := []edrAgent{
+		{"A", []string{"/opt/a"}},
+		{"B", []string{"/opt/b1", "/opt/b2"}},
+		{"C", []string{"/opt/c"}},
+	}
+	got := installedEDRAgents(agents, func(p string) bool { return p == "/opt/b2" || p == "/opt/c" })
+	if want := []string{"B", "C"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("installedEDRAgents = %v, want %v", got, want)
+	}
+	if got := installedEDRAgents(agents, func(string) bool { return false }); got == nil || len(got) != 0 {
+		t.Errorf("installedEDRAgents with none installed = %#v, want empty list", got)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Names of the posture checks that can be evaluated locally with Evaluate.
+const (
+	// CheckDiskEncryption passes if the device's system disk is encrypted.
+	CheckDiskEncryption = "disk-encryption"
+)
+
+// ErrUnsupported is returned by Evaluate for posture checks that are unknown
+// or not supported on the current platform.
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// collectors are the posture checks supported on the current platform,
+// registered by name by the platform-specific files. A collector returns nil
+// if the local system passes its check, or an error describing why it does
+// not. Collectors are run whenever the packet filter is updated, so they must
+// be cheap to run.
+var collectors = map[string]func() error{}
+
+// Evaluate evaluates the named posture check against the local system. It
+// returns nil if the system passes the check, or an error describing why it
+// does not, wrapping ErrUnsupported if the check cannot be evaluated on this
+// platform.
+func Evaluate(check string) error {
+	c, ok := collectors[check]
+	if !ok {
+		return fmt.Errorf("posture check %q: %w", check, ErrUnsupported)
+	}
+	if err := c(); err != nil {
+		return fmt.Errorf("posture check %q: %w", check, err)
+	}
+	return nil
+}
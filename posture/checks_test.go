@@ -0,0 +1,15 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvaluateUnsupported(t *testing.T) {
+	if err := Evaluate("no-such-check"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Evaluate of unknown check = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ios
+
+package posture
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"tailscale.com/types/logger"
+)
+
+func init() {
+	RegisterCollector(Collector{
+		Name: AttrDiskEncryption,
+		Collect: func(logger.Logf) (any, error) {
+			out, err := exec.Command("/usr/bin/fdesetup", "status").Output()
+			if err != nil {
+				return nil, fmt.Errorf("fdesetup status: %w", err)
+			}
+			// "FileVault is On." or "FileVault is Off.", possibly followed
+			// by the progress of an encryption or decryption in progress.
+			on := strings.HasPrefix(string(out), "FileVault is On")
+			v := DiskEncryption{Encrypted: on}
+			if on {
+				v.Method = "filevault"
+			}
+			return v, nil
+		},
+	})
+}
@@ -0,0 +1,132 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !android
+
+package posture
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"tailscale.com/types/logger"
+)
+
+func init() {
+	collectors[CheckDiskEncryption] = func() error {
+		return checkRootEncrypted("/proc/self/mountinfo", "/sys")
+	}
+	RegisterCollector(Collector{
+		Name: AttrDiskEncryption,
+		Collect: func(logger.Logf) (any, error) {
+			ok, err := rootEncrypted("/proc/self/mountinfo", "/sys")
+			if err != nil {
+				return nil, err
+			}
+			v := DiskEncryption{Encrypted: ok}
+			if ok {
+				v.Method = "luks"
+			}
+			return v, nil
+		},
+	})
+}
+
+// checkRootEncrypted returns nil if the root filesystem is on an encrypted
+// disk, as reported by rootEncrypted.
+func checkRootEncrypted(mountinfo, sysfs string) error {
+	ok, err := rootEncrypted(mountinfo, sysfs)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("the root filesystem is not on an encrypted disk")
+	}
+	return nil
+}
+
+// rootEncrypted reports whether the root filesystem, as listed in the
+// mountinfo file, is on a dm-crypt (LUKS) device according to sysfs, either
+// directly or through other device mapper or md devices.
+func rootEncrypted(mountinfo, sysfs string) (bool, error) {
+	dev, err := rootBlockDevice(mountinfo)
+	if err != nil {
+		return false, err
+	}
+	return isDMCrypt(filepath.Join(sysfs, "dev", "block", dev), 0)
+}
+
+// rootBlockDevice returns the "major:minor" number of the block device that
+// backs the root filesystem, as listed in the mountinfo file.
+func rootBlockDevice(mountinfo string) (string, error) {
+	f, err := os.Open(mountinfo)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var dev, source string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// 36 35 98:0 / / rw,noatime master:1 - ext4 /dev/root rw
+		pre, post, ok := strings.Cut(s.Text(), " - ")
+		fields, postFields := strings.Fields(pre), strings.Fields(post)
+		if !ok || len(fields) < 5 || len(postFields) < 2 || fields[4] != "/" {
+			continue
+		}
+		// Later mounts on / shadow earlier ones.
+		dev, source = fields[2], postFields[1]
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	if dev == "" {
+		return "", errors.New("root filesystem not found in mountinfo")
+	}
+	if !strings.HasPrefix(dev, "0:") {
+		return dev, nil
+	}
+	// Filesystems such as btrfs report an anonymous device number; fall
+	// back to the device they were mounted from.
+	var st unix.Stat_t
+	if !strings.HasPrefix(source, "/dev/") || unix.Stat(source, &st) != nil || st.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return "", fmt.Errorf("unable to determine the disk of the root filesystem (mounted from %q)", source)
+	}
+	return fmt.Sprintf("%d:%d", unix.Major(uint64(st.Rdev)), unix.Minor(uint64(st.Rdev))), nil
+}
+
+// isDMCrypt reports whether the block device at the sysfs directory dir is a
+// dm-crypt device, or is backed only by dm-crypt devices. depth is the number
+// of devices already traversed.
+func isDMCrypt(dir string, depth int) (bool, error) {
+	if depth > 8 {
+		return false, errors.New("too many nested block devices")
+	}
+	uuid, err := os.ReadFile(filepath.Join(dir, "dm", "uuid"))
+	if err == nil && strings.HasPrefix(string(uuid), "CRYPT-") {
+		return true, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	slaves, err := os.ReadDir(filepath.Join(dir, "slaves"))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if len(slaves) == 0 {
+		return false, nil
+	}
+	for _, s := range slaves {
+		ok, err := isDMCrypt(filepath.Join(dir, "slaves", s.Name()), depth+1)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
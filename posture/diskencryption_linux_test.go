@@ -0,0 +1,89 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !android
+
+package posture
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckRootEncrypted(t *testing.T) {
+	tests := []struct {
+		name      string
+		mountinfo string
+		files     map[string]string // sysfs files
+		wantErr   string            // empty means the check passes
+	}{
+		{
+			name:      "luks",
+			mountinfo: "22 1 253:0 / / rw,relatime shared:1 - ext4 /dev/mapper/root rw\n",
+			files:     map[string]string{"dev/block/253:0/dm/uuid": "CRYPT-LUKS2-abcd-root\n"},
+		},
+		{
+			name:      "lvm-on-luks",
+			mountinfo: "22 1 253:1 / / rw,relatime shared:1 - ext4 /dev/mapper/vg-root rw\n",
+			files: map[string]string{
+				"dev/block/253:1/dm/uuid":             "LVM-abcd\n",
+				"dev/block/253:1/slaves/dm-0/dm/uuid": "CRYPT-LUKS2-abcd-luks\n",
+			},
+		},
+		{
+			name:      "raid-partly-encrypted",
+			mountinfo: "22 1 9:0 / / rw,relatime shared:1 - ext4 /dev/md0 rw\n",
+			files: map[string]string{
+				"dev/block/9:0/slaves/dm-0/dm/uuid": "CRYPT-LUKS2-abcd-a\n",
+				"dev/block/9:0/slaves/sdb1/size":    "1024\n",
+			},
+			wantErr: "not on an encrypted disk",
+		},
+		{
+			name:      "plain-partition",
+			mountinfo: "22 1 8:2 / / rw,relatime shared:1 - ext4 /dev/sda2 rw\n",
+			files:     map[string]string{"dev/block/8:2/size": "1024\n"},
+			wantErr:   "not on an encrypted disk",
+		},
+		{
+			name: "overmounted",
+			mountinfo: "22 1 8:2 / / rw,relatime shared:1 - ext4 /dev/sda2 rw\n" +
+				"23 22 253:0 / / rw,relatime shared:1 - ext4 /dev/mapper/root rw\n" +
+				"24 23 0:21 / /proc rw,nosuid - proc proc rw\n",
+			files: map[string]string{"dev/block/253:0/dm/uuid": "CRYPT-LUKS2-abcd-root\n"},
+		},
+		{
+			name:      "no-root",
+			mountinfo: "24 23 0:21 / /proc rw,nosuid - proc proc rw\n",
+			wantErr:   "root filesystem not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			mountinfo := filepath.Join(dir, "mountinfo")
+			if err := os.WriteFile(mountinfo, []byte(tt.mountinfo), 0600); err != nil {
+				t.Fatal(err)
+			}
+			sysfs := filepath.Join(dir, "sys")
+			for name, contents := range tt.files {
+				p := filepath.Join(sysfs, name)
+				if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(contents), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := checkRootEncrypted(mountinfo, sysfs)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("checkRootEncrypted: %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("checkRootEncrypted: %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
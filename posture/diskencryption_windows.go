@@ -0,0 +1,36 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"tailscale.com/types/logger"
+)
+
+func init() {
+	RegisterCollector(Collector{
+		Name: AttrDiskEncryption,
+		Collect: func(logger.Logf) (any, error) {
+			drive := cmp.Or(os.Getenv("SystemDrive"), "C:")
+			// The output of manage-bde is localized, whereas the names
+			// of the ProtectionStatus values are not.
+			out, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command",
+				fmt.Sprintf("(Get-BitLockerVolume -MountPoint '%s').ProtectionStatus", drive)).Output()
+			if err != nil {
+				return nil, fmt.Errorf("Get-BitLockerVolume: %w", err)
+			}
+			on := strings.TrimSpace(string(out)) == "On"
+			v := DiskEncryption{Encrypted: on}
+			if on {
+				v.Method = "bitlocker"
+			}
+			return v, nil
+		},
+	})
+}
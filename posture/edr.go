@@ -0,0 +1,70 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"os"
+	"runtime"
+
+	"tailscale.com/types/logger"
+)
+
+// edrAgent is a known endpoint detection and response agent.
+type edrAgent struct {
+	name  string
+	paths []string // any of which exists if the agent is installed; expanded with os.ExpandEnv
+}
+
+// edrAgents are the known EDR agents, by GOOS.
+var edrAgents = map[string][]edrAgent{
+	"linux": {
+		{"CrowdStrike Falcon", []string{"/opt/CrowdStrike/falcond"}},
+		{"SentinelOne", []string{"/opt/sentinelone/bin/sentinelone-agent"}},
+		{"Microsoft Defender for Endpoint", []string{"/opt/microsoft/mdatp/sbin/wdavdaemon"}},
+		{"Carbon Black", []string{"/opt/carbonblack/psc/bin/cbagentd"}},
+	},
+	"darwin": {
+		{"CrowdStrike Falcon", []string{"/Applications/Falcon.app"}},
+		{"SentinelOne", []string{"/Library/Sentinel/sentinel-agent.bundle"}},
+		{"Microsoft Defender for Endpoint", []string{"/Applications/Microsoft Defender.app"}},
+		{"Carbon Black", []string{"/Applications/VMware Carbon Black Cloud"}},
+	},
+	"windows": {
+		{"CrowdStrike Falcon", []string{`${ProgramFiles}\CrowdStrike\CSFalconService.exe`}},
+		{"SentinelOne", []string{`${ProgramFiles}\SentinelOne`}},
+		{"Microsoft Defender for Endpoint", []string{`${ProgramFiles}\Windows Defender Advanced Threat Protection\MsSense.exe`}},
+		{"Carbon Black", []string{`${ProgramFiles}\Confer\RepMgr.exe`}},
+	},
+}
+
+func init() {
+	agents, ok := edrAgents[runtime.GOOS]
+	if !ok {
+		return
+	}
+	RegisterCollector(Collector{
+		Name: AttrEDRAgents,
+		Collect: func(logger.Logf) (any, error) {
+			return installedEDRAgents(agents, func(p string) bool {
+				_, err := os.Stat(os.ExpandEnv(p))
+				return err == nil
+			}), nil
+		},
+	})
+}
+
+// installedEDRAgents returns the names of the agents that are installed,
+// according to exists.
+func installedEDRAgents(agents []edrAgent, exists func(path string) bool) []string {
+	names := []string{}
+	for _, a := range agents {
+		for _, p := range a.paths {
+			if exists(p) {
+				names = append(names, a.name)
+				break
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,35 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ios
+
+package posture
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"tailscale.com/types/logger"
+)
+
+func init() {
+	RegisterCollector(Collector{
+		Name: AttrOSUpdates,
+		Collect: func(logger.Logf) (any, error) {
+			var u OSUpdates
+			out, err := exec.Command("/usr/bin/defaults", "read", "/Library/Preferences/com.apple.SoftwareUpdate", "AutomaticallyInstallMacOSUpdates").Output()
+			if err != nil {
+				// The setting is absent until it is changed, in which
+				// case macOS does not install updates automatically.
+				if _, ok := err.(*exec.ExitError); !ok {
+					return nil, fmt.Errorf("reading software update preferences: %w", err)
+				}
+				u.AutomaticUpdates.Set(false)
+				return u, nil
+			}
+			u.AutomaticUpdates.Set(strings.TrimSpace(string(out)) == "1")
+			return u, nil
+		},
+	})
+}
@@ -0,0 +1,68 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !android
+
+package posture
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"tailscale.com/types/logger"
+)
+
+func init() {
+	RegisterCollector(Collector{
+		Name: AttrOSUpdates,
+		Collect: func(logger.Logf) (any, error) {
+			return linuxOSUpdates("/"), nil
+		},
+	})
+}
+
+// aptUnattendedUpgradeRe matches the apt setting that enables unattended
+// upgrades, capturing its value.
+var aptUnattendedUpgradeRe = regexp.MustCompile(`(?m)^\s*APT::Periodic::Unattended-Upgrade\s+"(\d+)"\s*;`)
+
+// linuxOSUpdates returns the OS update status of the system whose root
+// filesystem is at root, as far as it can be determined from the
+// configuration of its package manager. It supports apt and dnf based
+// distributions.
+func linuxOSUpdates(root string) OSUpdates {
+	var u OSUpdates
+	path := func(p string) string { return filepath.Join(root, p) }
+
+	if ents, err := os.ReadDir(path("etc/apt/apt.conf.d")); err == nil {
+		// Files are read in lexical order, and later settings override
+		// earlier ones.
+		u.AutomaticUpdates.Set(false)
+		for _, e := range ents {
+			b, err := os.ReadFile(path(filepath.Join("etc/apt/apt.conf.d", e.Name())))
+			if err != nil {
+				continue
+			}
+			for _, m := range aptUnattendedUpgradeRe.FindAllSubmatch(b, -1) {
+				u.AutomaticUpdates.Set(string(m[1]) != "0")
+			}
+		}
+	} else if _, err := os.Stat(path("etc/dnf")); err == nil {
+		_, err := os.Stat(path("etc/systemd/system/timers.target.wants/dnf-automatic-install.timer"))
+		u.AutomaticUpdates.Set(err == nil)
+	}
+
+	if _, err := os.Stat(path("var/lib/dpkg")); err == nil {
+		_, err := os.Stat(path("var/run/reboot-required"))
+		u.RebootRequired.Set(err == nil)
+	}
+
+	for _, db := range []string{"var/lib/dpkg/status", "var/lib/rpm", "usr/lib/sysimage/rpm"} {
+		if fi, err := os.Stat(path(db)); err == nil {
+			t := fi.ModTime()
+			u.LastUpdated = &t
+			break
+		}
+	}
+	return u
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !android
+
+package posture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tailscale.com/types/opt"
+)
+
+func TestLinuxOSUpdates(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  OSUpdates
+	}{
+		{
+			name: "unknown",
+		},
+		{
+			name: "apt-unattended",
+			files: map[string]string{
+				"etc/apt/apt.conf.d/20auto-upgrades": "APT::Periodic::Update-Package-Lists \"1\";\nAPT::Periodic::Unattended-Upgrade \"1\";\n",
+				"var/lib/dpkg/status":                "",
+				"var/run/reboot-required":            "*** System restart required ***\n",
+			},
+			want: OSUpdates{AutomaticUpdates: opt.NewBool(true), RebootRequired: opt.NewBool(true), LastUpdated: &mtime},
+		},
+		{
+			name: "apt-overridden",
+			files: map[string]string{
+				"etc/apt/apt.conf.d/20auto-upgrades": "APT::Periodic::Unattended-Upgrade \"1\";\n",
+				"etc/apt/apt.conf.d/99local":         "APT::Periodic::Unattended-Upgrade \"0\";\n",
+				"var/lib/dpkg/status":                "",
+			},
+			want: OSUpdates{AutomaticUpdates: opt.NewBool(false), RebootRequired: opt.NewBool(false), LastUpdated: &mtime},
+		},
+		{
+			name: "dnf-automatic",
+			files: map[string]string{
+				"etc/dnf/dnf.conf": "",
+				"etc/systemd/system/timers.target.wants/dnf-automatic-install.timer": "",
+				"var/lib/rpm/rpmdb.sqlite": "",
+			},
+			want: OSUpdates{AutomaticUpdates: opt.NewBool(true), LastUpdated: &mtime},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, contents := range tt.files {
+				p := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(contents), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, db := range []string{"var/lib/dpkg/status", "var/lib/rpm"} {
+				os.Chtimes(filepath.Join(root, db), mtime, mtime)
+			}
+			got := linuxOSUpdates(root)
+			if got.AutomaticUpdates != tt.want.AutomaticUpdates || got.RebootRequired != tt.want.RebootRequired {
+				t.Errorf("linuxOSUpdates = %+v, want %+v", got, tt.want)
+			}
+			if (got.LastUpdated == nil) != (tt.want.LastUpdated == nil) || (got.LastUpdated != nil && !got.LastUpdated.Equal(*tt.want.LastUpdated)) {
+				t.Errorf("LastUpdated = %v, want %v", got.LastUpdated, tt.want.LastUpdated)
+			}
+		})
+	}
+}
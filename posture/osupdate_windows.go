@@ -0,0 +1,38 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package posture
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows/registry"
+	"tailscale.com/types/logger"
+)
+
+func init() {
+	RegisterCollector(Collector{
+		Name: AttrOSUpdates,
+		Collect: func(logger.Logf) (any, error) {
+			var u OSUpdates
+			// Windows installs updates automatically unless disabled by
+			// policy.
+			u.AutomaticUpdates.Set(true)
+			if k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Policies\Microsoft\Windows\WindowsUpdate\AU`, registry.QUERY_VALUE); err == nil {
+				if v, _, err := k.GetIntegerValue("NoAutoUpdate"); err == nil {
+					u.AutomaticUpdates.Set(v == 0)
+				}
+				k.Close()
+			}
+			k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows\CurrentVersion\WindowsUpdate\Auto Update\RebootRequired`, registry.QUERY_VALUE)
+			switch {
+			case err == nil:
+				k.Close()
+				u.RebootRequired.Set(true)
+			case errors.Is(err, registry.ErrNotExist):
+				u.RebootRequired.Set(false)
+			}
+			return u, nil
+		},
+	})
+}
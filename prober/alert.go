@@ -0,0 +1,164 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package prober
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Alert is a change in the alerting state of an SLO group.
+type Alert struct {
+	Source   string // the program sending alerts, such as "derpprobe"
+	SLO      string
+	Group    string
+	Severity string
+	Time     time.Time
+
+	// Resolved is whether the alert stopped firing. If true, Severity is
+	// the severity of the alert that was firing.
+	Resolved bool
+
+	BurnRate        float64 // long window burn rate that triggered the alert
+	Attainment      float64 // over the SLO window
+	BudgetRemaining float64 // over the SLO window
+}
+
+// DedupKey returns a key that identifies the alert's SLO group across
+// state changes.
+func (a Alert) DedupKey() string {
+	return a.Source + "/" + a.SLO + "/" + a.Group
+}
+
+// Summary returns a one-line human-readable description of the alert.
+func (a Alert) Summary() string {
+	if a.Resolved {
+		return fmt.Sprintf("[%s] %s SLO for %s recovered; %.1f%% of error budget remaining",
+			a.Source, a.SLO, a.Group, a.BudgetRemaining*100)
+	}
+	return fmt.Sprintf("[%s] %s SLO for %s is burning error budget %.1fx too fast (%s); %.3f%% attained, %.1f%% of error budget remaining",
+		a.Source, a.SLO, a.Group, a.BurnRate, a.Severity, a.Attainment*100, a.BudgetRemaining*100)
+}
+
+// AlertSink sends alerts somewhere.
+type AlertSink interface {
+	SendAlert(context.Context, Alert) error
+}
+
+// WebhookSink is an AlertSink that POSTs each Alert as JSON to URL.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client // or nil for http.DefaultClient
+}
+
+// SendAlert implements AlertSink.
+func (s *WebhookSink) SendAlert(ctx context.Context, a Alert) error {
+	return postJSON(ctx, s.Client, s.URL, a)
+}
+
+// SlackSink is an AlertSink that posts alerts to a Slack channel using an
+// incoming webhook.
+type SlackSink struct {
+	WebhookURL string
+	Client     *http.Client // or nil for http.DefaultClient
+}
+
+// SendAlert implements AlertSink.
+func (s *SlackSink) SendAlert(ctx context.Context, a Alert) error {
+	emoji := ":red_circle:"
+	switch {
+	case a.Resolved:
+		emoji = ":large_green_circle:"
+	case a.Severity != "critical":
+		emoji = ":large_yellow_circle:"
+	}
+	return postJSON(ctx, s.Client, s.WebhookURL, map[string]string{
+		"text": emoji + " " + a.Summary(),
+	})
+}
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint.
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutySink is an AlertSink that triggers and resolves PagerDuty
+// incidents using the Events API v2.
+type PagerDutySink struct {
+	RoutingKey string       // integration key of the PagerDuty service
+	Client     *http.Client // or nil for http.DefaultClient
+
+	url string // or empty for pagerDutyEventsURL; for tests
+}
+
+// SendAlert implements AlertSink.
+func (s *PagerDutySink) SendAlert(ctx context.Context, a Alert) error {
+	type payload struct {
+		Summary       string    `json:"summary"`
+		Source        string    `json:"source"`
+		Severity      string    `json:"severity"`
+		Timestamp     time.Time `json:"timestamp"`
+		Group         string    `json:"group"`
+		CustomDetails Alert     `json:"custom_details"`
+	}
+	ev := struct {
+		RoutingKey  string   `json:"routing_key"`
+		EventAction string   `json:"event_action"`
+		DedupKey    string   `json:"dedup_key"`
+		Payload     *payload `json:"payload,omitempty"`
+	}{
+		RoutingKey:  s.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    a.DedupKey(),
+	}
+	if a.Resolved {
+		ev.EventAction = "resolve"
+	} else {
+		severity := a.Severity
+		if severity != "critical" {
+			severity = "warning"
+		}
+		ev.Payload = &payload{
+			Summary:       a.Summary(),
+			Source:        a.Source,
+			Severity:      severity,
+			Timestamp:     a.Time,
+			Group:         a.Group,
+			CustomDetails: a,
+		}
+	}
+	url := s.url
+	if url == "" {
+		url = pagerDutyEventsURL
+	}
+	return postJSON(ctx, s.Client, url, ev)
+}
+
+func postJSON(ctx context.Context, hc *http.Client, url string, v any) error {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("HTTP %v: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
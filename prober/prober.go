@@ -64,6 +64,9 @@ type Prober struct {
 	// Whether to run all probes once instead of running them in a loop.
 	once bool
 
+	// slo, if non-nil, is notified of every probe result.
+	slo *SLOTracker
+
 	// Time-related functions that get faked out during tests.
 	now       func() time.Time
 	newTicker func(time.Duration) ticker
@@ -180,6 +183,16 @@ func (p *Prober) WithOnce(s bool) *Prober {
 	return p
 }
 
+// WithSLOTracker makes the prober record all probe results in t, and
+// exports t's SLO metrics. It must be called after WithMetricNamespace and
+// before any probes are run.
+func (p *Prober) WithSLOTracker(t *SLOTracker) *Prober {
+	p.slo = t
+	t.now = p.now
+	prometheus.WrapRegistererWithPrefix(p.namespace+"_", p.metrics).MustRegister(t)
+	return p
+}
+
 // WithMetricNamespace allows changing metric name prefix from the default `prober`.
 func (p *Prober) WithMetricNamespace(n string) *Prober {
 	p.namespace = n
@@ -363,6 +376,9 @@ func (p *Probe) recordEnd(err error) {
 	}
 	p.successHist.Value = p.succeeded
 	p.successHist = p.successHist.Next()
+	if p.prober.slo != nil {
+		p.prober.slo.observe(p.probeClass.Class, p.metricLabels, end, latency, p.succeeded)
+	}
 }
 
 // ProbeInfo is a snapshot of the configuration and state of a Probe.
@@ -0,0 +1,410 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package prober
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sloBucketSize is the granularity at which SLO results are recorded.
+const sloBucketSize = time.Minute
+
+// SLO defines a service level objective computed from the results of a
+// group of probes.
+type SLO struct {
+	// Name is the name of the SLO, such as "availability".
+	Name string
+
+	// GroupBy is the probe label whose values partition probes into
+	// separately tracked groups, such as "region". Probes without the
+	// label don't count towards the SLO.
+	GroupBy string
+
+	// Classes, if non-empty, restricts the SLO to probes of these classes.
+	Classes []string
+
+	// Target is the fraction of good probe results to aim for, in (0, 1).
+	Target float64
+
+	// LatencyThreshold, if non-zero, makes this a latency SLO: a probe
+	// result is good only if it succeeded within LatencyThreshold.
+	// Otherwise, every successful probe result is good.
+	LatencyThreshold time.Duration
+
+	// Window is the sliding window over which the SLO is computed.
+	Window time.Duration
+}
+
+func (s *SLO) matches(class string, labels map[string]string) (group string, ok bool) {
+	if len(s.Classes) > 0 && !slices.Contains(s.Classes, class) {
+		return "", false
+	}
+	group, ok = labels[s.GroupBy]
+	return group, ok
+}
+
+// BurnRateAlert defines when an SLO's error budget is burning fast enough
+// to alert, using the multiwindow, multi-burn-rate approach: the alert
+// fires while the burn rate over both the Long and Short windows is at
+// least Threshold. The burn rate is the ratio of the observed error rate
+// to the error rate the SLO allows.
+type BurnRateAlert struct {
+	Severity  string // "critical" or "warning"
+	Long      time.Duration
+	Short     time.Duration
+	Threshold float64
+}
+
+// DefaultBurnRateAlerts are the burn rate alerts used if none are given
+// to NewSLOTracker. With a 30 day SLO window, they correspond to spending
+// 2% of the error budget in an hour and 5% in six hours, respectively.
+var DefaultBurnRateAlerts = []BurnRateAlert{
+	{Severity: "critical", Long: time.Hour, Short: 5 * time.Minute, Threshold: 14.4},
+	{Severity: "warning", Long: 6 * time.Hour, Short: 30 * time.Minute, Threshold: 6},
+}
+
+// sloKey identifies a tracked SLO group.
+type sloKey struct {
+	slo   string
+	group string
+}
+
+// sloBucket counts the probe results within one sloBucketSize interval.
+type sloBucket struct {
+	n           int64 // interval number since the Unix epoch
+	good, total uint32
+}
+
+// sloSeries is a ring of buckets covering an SLO window.
+type sloSeries struct {
+	buckets []sloBucket
+}
+
+func (s *sloSeries) add(t time.Time, good bool) {
+	n := t.Unix() / int64(sloBucketSize/time.Second)
+	b := &s.buckets[n%int64(len(s.buckets))]
+	if b.n != n {
+		*b = sloBucket{n: n}
+	}
+	b.total++
+	if good {
+		b.good++
+	}
+}
+
+// sum returns the number of good and total results in the window d that
+// ends at now.
+func (s *sloSeries) sum(now time.Time, d time.Duration) (good, total int64) {
+	end := now.Unix() / int64(sloBucketSize/time.Second)
+	start := end - int64(d/sloBucketSize)
+	for _, b := range s.buckets {
+		if b.n > start && b.n <= end {
+			good += int64(b.good)
+			total += int64(b.total)
+		}
+	}
+	return good, total
+}
+
+// SLOTracker computes SLOs from probe results and sends alerts to a set of
+// AlertSinks when their error budgets burn too quickly.
+//
+// An SLOTracker is attached to a Prober with Prober.WithSLOTracker.
+type SLOTracker struct {
+	slos   []SLO
+	alerts []BurnRateAlert
+	sinks  []AlertSink
+	source string
+
+	now func() time.Time
+
+	mu     sync.Mutex
+	series map[sloKey]*sloSeries
+	firing map[sloKey]string // severity of the firing alert
+
+	stop    context.CancelFunc // or nil if not started
+	stopped chan struct{}
+
+	mAttainment *prometheus.Desc
+	mBudget     *prometheus.Desc
+	mBurnRate   *prometheus.Desc
+	mFiring     *prometheus.Desc
+}
+
+// NewSLOTracker returns a new SLOTracker for slos that sends alerts to
+// sinks. If alerts is empty, DefaultBurnRateAlerts is used. Alerts should
+// be ordered from most to least severe. The source names the sender of
+// alerts, such as "derpprobe".
+func NewSLOTracker(source string, slos []SLO, alerts []BurnRateAlert, sinks ...AlertSink) *SLOTracker {
+	if len(alerts) == 0 {
+		alerts = DefaultBurnRateAlerts
+	}
+	labels := []string{"slo", "group"}
+	return &SLOTracker{
+		slos:        slos,
+		alerts:      alerts,
+		sinks:       sinks,
+		source:      source,
+		now:         time.Now,
+		series:      map[sloKey]*sloSeries{},
+		firing:      map[sloKey]string{},
+		mAttainment: prometheus.NewDesc("slo_attainment_ratio", "Fraction of good probe results over the SLO window", labels, nil),
+		mBudget:     prometheus.NewDesc("slo_error_budget_remaining_ratio", "Fraction of the SLO error budget remaining over the SLO window", labels, nil),
+		mBurnRate:   prometheus.NewDesc("slo_burn_rate", "SLO error budget burn rate over an alerting window", append(labels, "window"), nil),
+		mFiring:     prometheus.NewDesc("slo_alert_firing", "Whether an SLO alert is firing (1) or not (0)", append(labels, "severity"), nil),
+	}
+}
+
+// windowFor returns the length of history needed for slo.
+func (t *SLOTracker) windowFor(slo *SLO) time.Duration {
+	w := slo.Window
+	for _, a := range t.alerts {
+		w = max(w, a.Long)
+	}
+	return w
+}
+
+// observe records a probe result.
+func (t *SLOTracker) observe(class string, labels map[string]string, end time.Time, latency time.Duration, succeeded bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.slos {
+		slo := &t.slos[i]
+		group, ok := slo.matches(class, labels)
+		if !ok {
+			continue
+		}
+		k := sloKey{slo.Name, group}
+		s, ok := t.series[k]
+		if !ok {
+			s = &sloSeries{buckets: make([]sloBucket, t.windowFor(slo)/sloBucketSize+1)}
+			t.series[k] = s
+		}
+		good := succeeded && (slo.LatencyThreshold == 0 || latency <= slo.LatencyThreshold)
+		s.add(end, good)
+	}
+}
+
+// burnRate returns the burn rate of slo's error budget given good and
+// total results.
+func burnRate(slo *SLO, good, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	errRate := 1 - float64(good)/float64(total)
+	if errRate == 0 {
+		return 0
+	}
+	return errRate / (1 - slo.Target)
+}
+
+// SLOStatus is a snapshot of the state of an SLO for one group.
+type SLOStatus struct {
+	SLO    string
+	Group  string
+	Target float64
+	Window time.Duration
+
+	Good  int64 // good results in Window
+	Total int64 // all results in Window
+
+	// Attainment is the fraction of good results in Window, or 1 if
+	// there aren't any results.
+	Attainment float64
+
+	// BudgetRemaining is the fraction of the error budget that remains
+	// in Window. It's negative if the SLO was missed.
+	BudgetRemaining float64
+
+	// BurnRates are the error budget burn rates over each alert window.
+	BurnRates map[time.Duration]float64
+
+	// Firing is the severity of the firing alert, or empty if none is.
+	Firing string
+}
+
+// Status returns the status of every tracked SLO group, sorted by SLO
+// name and group.
+func (t *SLOTracker) Status() []SLOStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.statusLocked(t.now())
+}
+
+func (t *SLOTracker) statusLocked(now time.Time) []SLOStatus {
+	var out []SLOStatus
+	for i := range t.slos {
+		slo := &t.slos[i]
+		for k, s := range t.series {
+			if k.slo != slo.Name {
+				continue
+			}
+			st := SLOStatus{
+				SLO:       slo.Name,
+				Group:     k.group,
+				Target:    slo.Target,
+				Window:    slo.Window,
+				BurnRates: map[time.Duration]float64{},
+				Firing:    t.firing[k],
+			}
+			st.Good, st.Total = s.sum(now, slo.Window)
+			st.Attainment = 1
+			if st.Total > 0 {
+				st.Attainment = float64(st.Good) / float64(st.Total)
+			}
+			st.BudgetRemaining = 1 - burnRate(slo, st.Good, st.Total)
+			for _, a := range t.alerts {
+				for _, d := range []time.Duration{a.Long, a.Short} {
+					if _, ok := st.BurnRates[d]; !ok {
+						good, total := s.sum(now, d)
+						st.BurnRates[d] = burnRate(slo, good, total)
+					}
+				}
+			}
+			out = append(out, st)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].SLO != out[j].SLO {
+			return out[i].SLO < out[j].SLO
+		}
+		return out[i].Group < out[j].Group
+	})
+	return out
+}
+
+// evaluate checks all SLO groups against the burn rate alerts and sends
+// an alert for each one whose alert state changed.
+func (t *SLOTracker) evaluate(ctx context.Context) {
+	now := t.now()
+	var pending []Alert
+	t.mu.Lock()
+	for _, st := range t.statusLocked(now) {
+		k := sloKey{st.SLO, st.Group}
+		var severity string
+		var rate float64
+		for _, a := range t.alerts {
+			long, short := st.BurnRates[a.Long], st.BurnRates[a.Short]
+			if long >= a.Threshold && short >= a.Threshold {
+				severity, rate = a.Severity, long
+				break
+			}
+		}
+		if severity == st.Firing {
+			continue
+		}
+		alert := Alert{
+			Source:          t.source,
+			SLO:             st.SLO,
+			Group:           st.Group,
+			Severity:        severity,
+			Time:            now,
+			BurnRate:        rate,
+			Attainment:      st.Attainment,
+			BudgetRemaining: st.BudgetRemaining,
+		}
+		if severity == "" {
+			alert.Resolved = true
+			alert.Severity = st.Firing
+			delete(t.firing, k)
+		} else {
+			t.firing[k] = severity
+		}
+		pending = append(pending, alert)
+	}
+	t.mu.Unlock()
+
+	for _, a := range pending {
+		log.Printf("SLO alert: %s", a.Summary())
+		for _, sink := range t.sinks {
+			sctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			if err := sink.SendAlert(sctx, a); err != nil {
+				log.Printf("sending SLO alert for %s/%s: %v", a.SLO, a.Group, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Start starts evaluating SLOs every interval in a new goroutine, until
+// Close is called.
+func (t *SLOTracker) Start(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.stop = cancel
+	t.stopped = make(chan struct{})
+	go func() {
+		defer close(t.stopped)
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				t.evaluate(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the evaluation started by Start.
+func (t *SLOTracker) Close() error {
+	if t.stop != nil {
+		t.stop()
+		<-t.stopped
+	}
+	return nil
+}
+
+// ServeHTTP writes the status of all SLOs as plain text.
+func (t *SLOTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, st := range t.Status() {
+		fmt.Fprintf(w, "%s/%s: %.3f%% of %d over %v (target %.3f%%), %.1f%% budget remaining",
+			st.SLO, st.Group, st.Attainment*100, st.Total, st.Window, st.Target*100, st.BudgetRemaining*100)
+		if st.Firing != "" {
+			fmt.Fprintf(w, ", %s alert firing", st.Firing)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (t *SLOTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.mAttainment
+	ch <- t.mBudget
+	ch <- t.mBurnRate
+	ch <- t.mFiring
+}
+
+// Collect implements prometheus.Collector.
+func (t *SLOTracker) Collect(ch chan<- prometheus.Metric) {
+	for _, st := range t.Status() {
+		ch <- prometheus.MustNewConstMetric(t.mAttainment, prometheus.GaugeValue, st.Attainment, st.SLO, st.Group)
+		ch <- prometheus.MustNewConstMetric(t.mBudget, prometheus.GaugeValue, st.BudgetRemaining, st.SLO, st.Group)
+		for d, rate := range st.BurnRates {
+			if math.IsInf(rate, 0) {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(t.mBurnRate, prometheus.GaugeValue, rate, st.SLO, st.Group, d.String())
+		}
+		for _, a := range t.alerts {
+			var v float64
+			if st.Firing == a.Severity {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(t.mFiring, prometheus.GaugeValue, v, st.SLO, st.Group, a.Severity)
+		}
+	}
+}
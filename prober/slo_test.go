@@ -0,0 +1,165 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package prober
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	alerts []Alert
+}
+
+func (s *recordingSink) SendAlert(_ context.Context, a Alert) error {
+	s.alerts = append(s.alerts, a)
+	return nil
+}
+
+func TestSLOTracker(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	sink := &recordingSink{}
+	tr := NewSLOTracker("test", []SLO{
+		{Name: "availability", GroupBy: "region", Target: 0.99, Window: 24 * time.Hour},
+		{Name: "latency", GroupBy: "region", Classes: []string{"tls"}, Target: 0.99, LatencyThreshold: 100 * time.Millisecond, Window: 24 * time.Hour},
+	}, nil, sink)
+	tr.now = func() time.Time { return now }
+
+	nyc := map[string]string{"region": "nyc"}
+	sfo := map[string]string{"region": "sfo"}
+	// Two healthy hours in both regions.
+	for range 120 {
+		tr.observe("tls", nyc, now, 10*time.Millisecond, true)
+		tr.observe("tls", sfo, now, 10*time.Millisecond, true)
+		tr.observe("derp_map", map[string]string{}, now, 0, false) // ignored: no region
+		now = now.Add(time.Minute)
+	}
+	tr.evaluate(context.Background())
+	if len(sink.alerts) != 0 {
+		t.Fatalf("unexpected alerts: %+v", sink.alerts)
+	}
+
+	// nyc fails for 10 minutes, and sfo gets slow.
+	for range 10 {
+		tr.observe("tls", nyc, now, 0, false)
+		tr.observe("tls", sfo, now, time.Second, true)
+		now = now.Add(time.Minute)
+	}
+	tr.evaluate(context.Background())
+	got := map[string]Alert{}
+	for _, a := range sink.alerts {
+		got[a.SLO+"/"+a.Group] = a
+	}
+	if len(got) != 3 {
+		t.Fatalf("got alerts %+v; want nyc availability and latency, and sfo latency", sink.alerts)
+	}
+	for _, k := range []string{"availability/nyc", "latency/nyc", "latency/sfo"} {
+		if a, ok := got[k]; !ok || a.Resolved || a.Severity != "critical" {
+			t.Errorf("alert %s = %+v; want critical", k, a)
+		}
+	}
+
+	st := tr.Status()
+	if len(st) != 4 {
+		t.Fatalf("got %d statuses; want 4", len(st))
+	}
+	if st[0].SLO != "availability" || st[0].Group != "nyc" || st[0].Total != 130 || st[0].Good != 120 || st[0].Firing != "critical" {
+		t.Errorf("availability/nyc status = %+v", st[0])
+	}
+
+	// Another evaluation without state changes sends nothing.
+	sink.alerts = nil
+	tr.evaluate(context.Background())
+	if len(sink.alerts) != 0 {
+		t.Fatalf("unexpected repeated alerts: %+v", sink.alerts)
+	}
+
+	// Recovery clears the short window, resolving the alerts.
+	for range 30 {
+		tr.observe("tls", nyc, now, 10*time.Millisecond, true)
+		tr.observe("tls", sfo, now, 10*time.Millisecond, true)
+		now = now.Add(time.Minute)
+	}
+	tr.evaluate(context.Background())
+	if len(sink.alerts) != 3 {
+		t.Fatalf("got %d alerts after recovery; want 3: %+v", len(sink.alerts), sink.alerts)
+	}
+	for _, a := range sink.alerts {
+		if !a.Resolved || a.Severity != "critical" {
+			t.Errorf("alert after recovery = %+v; want resolved critical", a)
+		}
+	}
+}
+
+func TestSLOSeriesWindow(t *testing.T) {
+	s := &sloSeries{buckets: make([]sloBucket, 61)}
+	start := time.Unix(0, 0)
+	for i := range 120 {
+		s.add(start.Add(time.Duration(i)*time.Minute), i%2 == 0)
+	}
+	now := start.Add(119 * time.Minute)
+	if good, total := s.sum(now, time.Hour); good != 30 || total != 60 {
+		t.Errorf("sum over hour = %d/%d; want 30/60", good, total)
+	}
+	if good, total := s.sum(now, 10*time.Minute); good != 5 || total != 10 {
+		t.Errorf("sum over 10m = %d/%d; want 5/10", good, total)
+	}
+	// Buckets that have been overwritten by newer ones aren't counted.
+	if good, total := s.sum(start.Add(30*time.Minute), 10*time.Minute); total != 0 {
+		t.Errorf("sum over expired buckets = %d/%d; want 0 total", good, total)
+	}
+}
+
+func TestPagerDutySink(t *testing.T) {
+	var got []map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Error(err)
+		}
+		got = append(got, ev)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	s := &PagerDutySink{RoutingKey: "key", url: ts.URL}
+	a := Alert{Source: "derpprobe", SLO: "availability", Group: "nyc", Severity: "critical", BurnRate: 20}
+	if err := s.SendAlert(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	a.Resolved = true
+	if err := s.SendAlert(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d events; want 2", len(got))
+	}
+	if got[0]["event_action"] != "trigger" || got[0]["routing_key"] != "key" || got[0]["dedup_key"] != "derpprobe/availability/nyc" {
+		t.Errorf("trigger event = %v", got[0])
+	}
+	if p, _ := got[0]["payload"].(map[string]any); p["severity"] != "critical" || p["source"] != "derpprobe" {
+		t.Errorf("trigger payload = %v", got[0]["payload"])
+	}
+	if got[1]["event_action"] != "resolve" || got[1]["dedup_key"] != got[0]["dedup_key"] || got[1]["payload"] != nil {
+		t.Errorf("resolve event = %v", got[1])
+	}
+}
+
+func TestPostJSONError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	s := &SlackSink{WebhookURL: ts.URL}
+	err := s.SendAlert(context.Background(), Alert{SLO: "availability", Group: "nyc"})
+	if err == nil || errors.Unwrap(err) != nil || err.Error() != "HTTP 403 Forbidden: nope" {
+		t.Errorf("SendAlert error = %v", err)
+	}
+}
@@ -89,17 +89,30 @@ func (m *Mapper) UnregisterIPPortIdentity(proto string, ipport netip.AddrPort) {
 
 // WhoIsIPPort looks up an IP:port in the temporary registrations,
 // and returns a matching Tailscale IP, if it exists.
+//
+// The proto is "tcp" or "udp", or empty to look up registrations for either
+// protocol, preferring TCP if both exist.
 func (m *Mapper) WhoIsIPPort(proto string, ipport netip.AddrPort) (tsIP netip.Addr, ok bool) {
+	protos := []string{proto}
+	if proto == "" {
+		protos = []string{"tcp", "udp"}
+	}
 	// We currently have a registration race,
 	// https://github.com/tailscale/tailscale/issues/1616,
 	// so loop a few times for now waiting for the registration
-	// to appear.
+	// to appear. All protocols are checked on each attempt so that a
+	// lookup of a UDP flow without a proto doesn't first wait out all the
+	// attempts for TCP.
 	// TODO(bradfitz,namansood): remove this once #1616 is fixed.
-	k := mappingKey{proto, ipport}
 	for _, d := range whoIsSleeps {
 		time.Sleep(d)
 		m.mu.Lock()
-		tsIP, ok := m.m[k]
+		for _, proto := range protos {
+			tsIP, ok = m.m[mappingKey{proto, ipport}]
+			if ok {
+				break
+			}
+		}
 		m.mu.Unlock()
 		if ok {
 			return tsIP, true
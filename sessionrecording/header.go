@@ -25,6 +25,12 @@ type CastHeader struct {
 	// Typically empty for shell sessions.
 	Command string `json:"command,omitempty"`
 
+	// RequestedCommand is the command that the client requested, if a
+	// different command was executed instead, such as the forced command
+	// of a Tailscale SSH command restriction. It's empty for shell
+	// sessions.
+	RequestedCommand string `json:"requestedCommand,omitempty"`
+
 	// SrcNode is the FQDN of the node originating the connection.
 	// It is also the MagicDNS name for the node.
 	// It does not have a trailing dot.
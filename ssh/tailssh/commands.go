@@ -0,0 +1,135 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux || (darwin && !ios) || freebsd || openbsd
+
+package tailssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+// sftpCommand is the entry of tailcfg.SSHCommandsCapRule.Commands that allows
+// the SFTP subsystem.
+const sftpCommand = "internal-sftp"
+
+// commandPolicy restricts the commands that the sessions of a conn may run,
+// as granted by the tailcfg.PeerCapabilitySSHCommands capabilities of the
+// connecting peer.
+type commandPolicy struct {
+	allowed    []string // command lines that may be run as requested
+	force      string   // command run instead of others, or empty to reject them
+	notifyURLs []string
+}
+
+// commandPolicy returns the restrictions on the commands that the sessions of
+// c may run, or nil if there are none.
+func (c *conn) commandPolicy() (*commandPolicy, error) {
+	rules, err := tailcfg.UnmarshalCapJSON[tailcfg.SSHCommandsCapRule](c.srv.lb.PeerCaps(c.info.src.Addr()), tailcfg.PeerCapabilitySSHCommands)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s grants: %w", tailcfg.PeerCapabilitySSHCommands, err)
+	}
+	return newCommandPolicy(rules, c.localUser.Username)
+}
+
+// commandsRestricted reports whether the sessions of c have their commands
+// restricted. Such connections may not forward ports, as that would give
+// access to the host without running a command.
+func (c *conn) commandsRestricted() bool {
+	p, err := c.commandPolicy()
+	if err != nil {
+		c.logf("command policy: %v; denying port forwarding", err)
+		return true
+	}
+	return p != nil
+}
+
+// newCommandPolicy combines the rules that apply to localUser. It returns nil
+// if there are none.
+func newCommandPolicy(rules []tailcfg.SSHCommandsCapRule, localUser string) (*commandPolicy, error) {
+	var p *commandPolicy
+	for _, r := range rules {
+		if len(r.Users) > 0 && !slices.Contains(r.Users, "*") && !slices.Contains(r.Users, localUser) {
+			continue
+		}
+		if p == nil {
+			p = new(commandPolicy)
+		}
+		p.allowed = append(p.allowed, r.Commands...)
+		if r.ForceCommand != "" {
+			if p.force != "" && p.force != r.ForceCommand {
+				return nil, errors.New("grants force conflicting commands")
+			}
+			p.force = r.ForceCommand
+		}
+		if r.NotifyURL != "" && !slices.Contains(p.notifyURLs, r.NotifyURL) {
+			p.notifyURLs = append(p.notifyURLs, r.NotifyURL)
+		}
+	}
+	return p, nil
+}
+
+// resolve returns the command line to run for a session that requested
+// subsystem and rawCommand, and whether it's the forced command. It reports
+// ok false if the session must be rejected.
+func (p *commandPolicy) resolve(subsystem, rawCommand string) (cmd string, forced, ok bool) {
+	if p == nil {
+		return rawCommand, false, true
+	}
+	if subsystem == "sftp" {
+		return "", false, slices.Contains(p.allowed, sftpCommand)
+	}
+	if rawCommand != "" && slices.Contains(p.allowed, rawCommand) {
+		return rawCommand, false, true
+	}
+	if p.force != "" {
+		return p.force, true, true
+	}
+	return "", false, false
+}
+
+// applyCommandPolicy checks the requested command of ss against the command
+// restrictions of the connecting peer, replacing it with the forced command if
+// needed. It returns a user-visible error if ss must be rejected.
+func (ss *sshSession) applyCommandPolicy() error {
+	p, err := ss.conn.commandPolicy()
+	if err != nil {
+		ss.logf("command policy: %v; rejecting session", err)
+		return userVisibleError{error: err, msg: "invalid SSH command restrictions for this user"}
+	}
+	cmd, forced, ok := p.resolve(ss.Subsystem(), ss.RawCommand())
+	switch {
+	case !ok:
+		ss.logf("command policy: rejecting command %q (subsystem %q)", ss.RawCommand(), ss.Subsystem())
+		ss.notifyCommandEvent(p, tailcfg.SSHSessionCommandRejected)
+		return userVisibleError{error: errors.New("command not allowed"), msg: "command not allowed for this user"}
+	case forced:
+		ss.logf("command policy: running forced command %q instead of %q", cmd, ss.RawCommand())
+		ss.notifyCommandEvent(p, tailcfg.SSHSessionCommandForced)
+		ss.rawCommand, ss.forcedCommand = cmd, true
+	}
+	return nil
+}
+
+// notifyCommandEvent sends an SSHEventNotifyRequest of type ev to the notify
+// URLs of p, in the background.
+func (ss *sshSession) notifyCommandEvent(p *commandPolicy, ev tailcfg.SSHEventType) {
+	if len(p.notifyURLs) == 0 {
+		return
+	}
+	nodeKey := ss.conn.srv.lb.NodeKey()
+	go func() {
+		// Don't use ss.ctx, as a rejected session ends right away.
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		for _, u := range p.notifyURLs {
+			ss.notifyControl(ctx, nodeKey, ev, nil, u)
+		}
+	}()
+}
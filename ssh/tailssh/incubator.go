@@ -82,7 +82,7 @@ func (ss *sshSession) newIncubatorCommand(logf logger.Logf) (cmd *exec.Cmd, err
 	case "sftp":
 		isSFTP = true
 	case "":
-		isShell = ss.RawCommand() == ""
+		isShell = ss.rawCommand == ""
 	default:
 		panic(fmt.Sprintf("unexpected subsystem: %v", ss.Subsystem()))
 	}
@@ -95,7 +95,7 @@ func (ss *sshSession) newIncubatorCommand(logf logger.Logf) (cmd *exec.Cmd, err
 		}
 
 		loginShell := ss.conn.localUser.LoginShell()
-		args := shellArgs(isShell, ss.RawCommand())
+		args := shellArgs(isShell, ss.rawCommand)
 		logf("directly running %s %q", loginShell, args)
 		return exec.CommandContext(ss.ctx, loginShell, args...), nil
 	}
@@ -152,7 +152,7 @@ func (ss *sshSession) newIncubatorCommand(logf logger.Logf) (cmd *exec.Cmd, err
 	case isShell:
 		incubatorArgs = append(incubatorArgs, "--shell")
 	default:
-		incubatorArgs = append(incubatorArgs, "--cmd="+ss.RawCommand())
+		incubatorArgs = append(incubatorArgs, "--cmd="+ss.rawCommand)
 	}
 
 	allowSendEnv := nm.HasCap(tailcfg.NodeAttrSSHEnvironmentVariables)
@@ -775,6 +775,9 @@ func (ss *sshSession) launchProcess() error {
 	if ss.agentListener != nil {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("SSH_AUTH_SOCK=%s", ss.agentListener.Addr()))
 	}
+	if ss.forcedCommand && ss.RawCommand() != "" {
+		cmd.Env = append(cmd.Env, "SSH_ORIGINAL_COMMAND="+ss.RawCommand())
+	}
 
 	ptyReq, winCh, isPty := ss.Pty()
 	if !isPty {
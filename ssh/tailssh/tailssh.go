@@ -69,6 +69,7 @@ type ipnLocalBackend interface {
 	ShouldRunSSH() bool
 	NetMap() *netmap.NetworkMap
 	WhoIs(proto string, ipp netip.AddrPort) (n tailcfg.NodeView, u tailcfg.UserProfile, ok bool)
+	PeerCaps(src netip.Addr) tailcfg.PeerCapMap
 	DoNoiseRequest(req *http.Request) (*http.Response, error)
 	Dialer() *tsdial.Dialer
 	TailscaleVarRoot() string
@@ -495,7 +496,7 @@ func (c *conn) mayReversePortForwardTo(ctx ssh.Context, destinationHost string,
 	if sshDisableForwarding() {
 		return false
 	}
-	if c.finalAction != nil && c.finalAction.AllowRemotePortForwarding {
+	if c.finalAction != nil && c.finalAction.AllowRemotePortForwarding && !c.commandsRestricted() {
 		metricRemotePortForward.Add(1)
 		return true
 	}
@@ -509,7 +510,7 @@ func (c *conn) mayForwardLocalPortTo(ctx ssh.Context, destinationHost string, de
 	if sshDisableForwarding() {
 		return false
 	}
-	if c.finalAction != nil && c.finalAction.AllowLocalPortForwarding {
+	if c.finalAction != nil && c.finalAction.AllowLocalPortForwarding && !c.commandsRestricted() {
 		metricLocalPortForward.Add(1)
 		return true
 	}
@@ -754,6 +755,14 @@ func (c *conn) handleSessionPostSSHAuth(s ssh.Session) {
 
 	ss := c.newSSHSession(s)
 	ss.logf("handling new SSH connection from %v (%v) to ssh-user %q", c.info.uprof.LoginName, c.info.src.Addr(), c.localUser.Username)
+	if err := ss.applyCommandPolicy(); err != nil {
+		var uve userVisibleError
+		if errors.As(err, &uve) {
+			fmt.Fprintf(s.Stderr(), "%s\r\n", uve.SSHTerminationMessage())
+		}
+		s.Exit(1)
+		return
+	}
 	ss.logf("access granted to %v as ssh-user %q", c.info.uprof.LoginName, c.localUser.Username)
 	ss.run()
 }
@@ -855,6 +864,12 @@ type sshSession struct {
 	conn          *conn
 	agentListener net.Listener // non-nil if agent-forwarding requested+allowed
 
+	// rawCommand is the command line to run, which is the one requested by
+	// the client unless forcedCommand is set, in which case it's the forced
+	// command of the peer's tailcfg.PeerCapabilitySSHCommands grants.
+	rawCommand    string
+	forcedCommand bool
+
 	// initialized by launchProcess:
 	cmd      *exec.Cmd
 	wrStdin  io.WriteCloser
@@ -883,12 +898,13 @@ func (c *conn) newSSHSession(s ssh.Session) *sshSession {
 	c.logf("starting session: %v", sharedID)
 	ctx, cancel := context.WithCancelCause(s.Context())
 	return &sshSession{
-		Session:   s,
-		sharedID:  sharedID,
-		ctx:       ctx,
-		cancelCtx: cancel,
-		conn:      c,
-		logf:      logger.WithPrefix(c.srv.logf, "ssh-session("+sharedID+"): "),
+		Session:    s,
+		sharedID:   sharedID,
+		rawCommand: s.RawCommand(),
+		ctx:        ctx,
+		cancelCtx:  cancel,
+		conn:       c,
+		logf:       logger.WithPrefix(c.srv.logf, "ssh-session("+sharedID+"): "),
 	}
 }
 
@@ -1557,7 +1573,7 @@ func (ss *sshSession) startNewRecording() (_ *recording, err error) {
 		Width:     w.Width,
 		Height:    w.Height,
 		Timestamp: now.Unix(),
-		Command:   strings.Join(ss.Command(), " "),
+		Command:   ss.rawCommand,
 		Env: map[string]string{
 			"TERM": term,
 			// TODO(bradfitz): anything else important?
@@ -1575,6 +1591,9 @@ func (ss *sshSession) startNewRecording() (_ *recording, err error) {
 		SrcNodeID:    ss.conn.info.node.StableID(),
 		ConnectionID: ss.conn.connID,
 	}
+	if ss.forcedCommand {
+		ch.RequestedCommand = ss.RawCommand()
+	}
 	if !ss.conn.info.node.IsTagged() {
 		ch.SrcNodeUser = ss.conn.info.uprof.LoginName
 		ch.SrcNodeUserID = ss.conn.info.node.User()
@@ -1611,6 +1630,7 @@ func (ss *sshSession) notifyControl(ctx context.Context, nodeKey key.NodePublic,
 		SSHUser:           ss.conn.info.sshUser,
 		LocalUser:         ss.conn.localUser.Username,
 		RecordingAttempts: attempts,
+		Command:           ss.RawCommand(),
 	}
 
 	body, err := json.Marshal(re)
@@ -645,6 +645,10 @@ func (tb *testBackend) WhoIs(_ string, ipp netip.AddrPort) (n tailcfg.NodeView,
 	}, true
 }
 
+func (tb *testBackend) PeerCaps(src netip.Addr) tailcfg.PeerCapMap {
+	return nil
+}
+
 func (tb *testBackend) DoNoiseRequest(req *http.Request) (*http.Response, error) {
 	return nil, nil
 }
@@ -365,6 +365,155 @@ func TestEvalSSHPolicy(t *testing.T) {
 	}
 }
 
+func TestCommandPolicy(t *testing.T) {
+	runbook := tailcfg.SSHCommandsCapRule{
+		Users:    []string{"ops"},
+		Commands: []string{"systemctl restart web", sftpCommand},
+	}
+	breakGlass := tailcfg.SSHCommandsCapRule{
+		ForceCommand: "/usr/local/bin/break-glass",
+		NotifyURL:    "https://unused/ssh-event",
+	}
+	tests := []struct {
+		name       string
+		rules      []tailcfg.SSHCommandsCapRule
+		localUser  string
+		subsystem  string
+		rawCommand string
+		wantCmd    string
+		wantForced bool
+		wantOK     bool
+	}{
+		{
+			name:       "no-rules",
+			localUser:  "ops",
+			rawCommand: "rm -rf /",
+			wantCmd:    "rm -rf /",
+			wantOK:     true,
+		},
+		{
+			name:       "other-user",
+			rules:      []tailcfg.SSHCommandsCapRule{runbook},
+			localUser:  "root",
+			rawCommand: "id",
+			wantCmd:    "id",
+			wantOK:     true,
+		},
+		{
+			name:       "allowed",
+			rules:      []tailcfg.SSHCommandsCapRule{runbook},
+			localUser:  "ops",
+			rawCommand: "systemctl restart web",
+			wantCmd:    "systemctl restart web",
+			wantOK:     true,
+		},
+		{
+			name:       "not-allowed",
+			rules:      []tailcfg.SSHCommandsCapRule{runbook},
+			localUser:  "ops",
+			rawCommand: "systemctl restart web; id",
+		},
+		{
+			name:      "shell-not-allowed",
+			rules:     []tailcfg.SSHCommandsCapRule{runbook},
+			localUser: "ops",
+		},
+		{
+			name:      "sftp",
+			rules:     []tailcfg.SSHCommandsCapRule{runbook},
+			localUser: "ops",
+			subsystem: "sftp",
+			wantOK:    true,
+		},
+		{
+			name:      "sftp-not-allowed",
+			rules:     []tailcfg.SSHCommandsCapRule{breakGlass},
+			localUser: "ops",
+			subsystem: "sftp",
+		},
+		{
+			name:       "forced",
+			rules:      []tailcfg.SSHCommandsCapRule{runbook, breakGlass},
+			localUser:  "ops",
+			rawCommand: "id",
+			wantCmd:    "/usr/local/bin/break-glass",
+			wantForced: true,
+			wantOK:     true,
+		},
+		{
+			name:       "forced-shell",
+			rules:      []tailcfg.SSHCommandsCapRule{breakGlass},
+			localUser:  "root",
+			wantCmd:    "/usr/local/bin/break-glass",
+			wantForced: true,
+			wantOK:     true,
+		},
+		{
+			name:       "allowed-despite-forced",
+			rules:      []tailcfg.SSHCommandsCapRule{runbook, breakGlass},
+			localUser:  "ops",
+			rawCommand: "systemctl restart web",
+			wantCmd:    "systemctl restart web",
+			wantOK:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newCommandPolicy(tt.rules, tt.localUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd, forced, ok := p.resolve(tt.subsystem, tt.rawCommand)
+			if ok != tt.wantOK || (ok && (cmd != tt.wantCmd || forced != tt.wantForced)) {
+				t.Errorf("resolve = (%q, %v, %v); want (%q, %v, %v)", cmd, forced, ok, tt.wantCmd, tt.wantForced, tt.wantOK)
+			}
+		})
+	}
+
+	if p, err := newCommandPolicy([]tailcfg.SSHCommandsCapRule{runbook, breakGlass, breakGlass}, "ops"); err != nil || len(p.notifyURLs) != 1 {
+		t.Errorf("newCommandPolicy with a repeated rule = %+v, %v; want one notify URL", p, err)
+	}
+	other := tailcfg.SSHCommandsCapRule{ForceCommand: "/bin/false"}
+	if _, err := newCommandPolicy([]tailcfg.SSHCommandsCapRule{breakGlass, other}, "ops"); err == nil {
+		t.Error("newCommandPolicy with conflicting forced commands succeeded")
+	}
+}
+
+func TestCommandPolicyDeniesPortForwarding(t *testing.T) {
+	lb := &localState{}
+	c := &conn{
+		srv:       &server{logf: t.Logf, lb: lb},
+		info:      &sshConnInfo{src: netip.MustParseAddrPort("100.100.100.102:1234")},
+		localUser: &userMeta{User: user.User{Username: "ops"}},
+		finalAction: &tailcfg.SSHAction{
+			Accept:                    true,
+			AllowLocalPortForwarding:  true,
+			AllowRemotePortForwarding: true,
+		},
+	}
+	if !c.mayForwardLocalPortTo(nil, "localhost", 80) || !c.mayReversePortForwardTo(nil, "localhost", 80) {
+		t.Fatal("port forwarding denied without command restrictions")
+	}
+
+	lb.peerCaps = tailcfg.PeerCapMap{
+		tailcfg.PeerCapabilitySSHCommands: {`{"commands":["uptime"]}`},
+	}
+	if c.mayForwardLocalPortTo(nil, "localhost", 80) {
+		t.Error("local port forwarding allowed with command restrictions")
+	}
+	if c.mayReversePortForwardTo(nil, "localhost", 80) {
+		t.Error("remote port forwarding allowed with command restrictions")
+	}
+
+	// Restrictions for other local users don't apply.
+	lb.peerCaps = tailcfg.PeerCapMap{
+		tailcfg.PeerCapabilitySSHCommands: {`{"users":["root"],"commands":["uptime"]}`},
+	}
+	if !c.mayForwardLocalPortTo(nil, "localhost", 80) {
+		t.Error("local port forwarding denied by another user's command restrictions")
+	}
+}
+
 // localState implements ipnLocalBackend for testing.
 type localState struct {
 	sshEnabled   bool
@@ -374,6 +523,9 @@ type localState struct {
 	// It is served for paths like https://unused/ssh-action/<action-name>.
 	// The action name is the last part of the action URL.
 	serverActions map[string]*tailcfg.SSHAction
+
+	// peerCaps are the capabilities granted to the peer.
+	peerCaps tailcfg.PeerCapMap
 }
 
 var (
@@ -437,6 +589,10 @@ func (ts *localState) WhoIs(proto string, ipp netip.AddrPort) (n tailcfg.NodeVie
 
 }
 
+func (ts *localState) PeerCaps(src netip.Addr) tailcfg.PeerCapMap {
+	return ts.peerCaps
+}
+
 func (ts *localState) DoNoiseRequest(req *http.Request) (*http.Response, error) {
 	rec := httptest.NewRecorder()
 	k, ok := strings.CutPrefix(req.URL.Path, "/ssh-action/")
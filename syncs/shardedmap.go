@@ -4,6 +4,7 @@
 package syncs
 
 import (
+	"iter"
 	"sync"
 
 	"golang.org/x/sys/cpu"
@@ -136,3 +137,30 @@ func (m *ShardedMap[K, V]) Len() int {
 	}
 	return n
 }
+
+// All iterates over all entries in m in an undefined order, one shard at a
+// time. The lock of each shard is held while iterating over its entries, so
+// the iteration does not see a consistent snapshot of the map, and the loop
+// body must not call other methods of m.
+func (m *ShardedMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for i := range m.shards {
+			if !m.shards[i].all(yield) {
+				return
+			}
+		}
+	}
+}
+
+// all calls yield for each entry of s while holding its lock, and reports
+// whether the iteration should continue.
+func (s *mapShard[K, V]) all(yield func(K, V) bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range s.m {
+		if !yield(k, v) {
+			return false
+		}
+	}
+	return true
+}
@@ -3,7 +3,11 @@
 
 package syncs
 
-import "testing"
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
 
 func TestShardedMap(t *testing.T) {
 	m := NewShardedMap[int, string](16, func(i int) int { return i % 16 })
@@ -79,3 +83,83 @@ func TestShardedMap(t *testing.T) {
 		t.Errorf("got %q; want %q", g, w)
 	}
 }
+
+func TestShardedMapAll(t *testing.T) {
+	m := NewShardedMap[int, int](4, func(i int) int { return i % 4 })
+	for i := range 10 {
+		m.Set(i, i*i)
+	}
+	got := map[int]int{}
+	for k, v := range m.All() {
+		got[k] = v
+	}
+	if len(got) != 10 {
+		t.Fatalf("All yielded %d entries; want 10", len(got))
+	}
+	for k, v := range got {
+		if v != k*k {
+			t.Errorf("All yielded %d=%d; want %d", k, v, k*k)
+		}
+	}
+
+	n := 0
+	for range m.All() {
+		n++
+		if n == 3 {
+			break
+		}
+	}
+	if n != 3 {
+		t.Errorf("iterated %d times after break; want 3", n)
+	}
+}
+
+// BenchmarkMapContention compares a Map and a ShardedMap that are read and
+// written concurrently by many goroutines, each mostly using its own keys,
+// as when tracking state per peer.
+func BenchmarkMapContention(b *testing.B) {
+	const numKeys = 1 << 12
+	for _, writePct := range []int{1, 10, 50} {
+		b.Run(fmt.Sprintf("Map/write=%d%%", writePct), func(b *testing.B) {
+			var m Map[int, int]
+			for i := range numKeys {
+				m.Store(i, i)
+			}
+			benchContention(b, writePct, func(k int, write bool) {
+				if write {
+					m.Store(k, k)
+				} else {
+					m.Load(k)
+				}
+			})
+		})
+		b.Run(fmt.Sprintf("ShardedMap/write=%d%%", writePct), func(b *testing.B) {
+			m := NewShardedMap[int, int](64, func(i int) int { return i % 64 })
+			for i := range numKeys {
+				m.Set(i, i)
+			}
+			benchContention(b, writePct, func(k int, write bool) {
+				if write {
+					m.Set(k, k)
+				} else {
+					m.Get(k)
+				}
+			})
+		})
+	}
+}
+
+// benchContention calls op from b.RunParallel, writing writePct percent of
+// the time, with each goroutine cycling through its own range of keys.
+func benchContention(b *testing.B, writePct int, op func(k int, write bool)) {
+	const keysPerG = 1 << 8
+	var nextG atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		base := int(nextG.Add(1)) * keysPerG
+		for i := 0; pb.Next(); i++ {
+			op(base+i%keysPerG, i%100 < writePct)
+		}
+	})
+}
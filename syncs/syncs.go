@@ -350,3 +350,20 @@ func (wg *WaitGroup) Go(f func()) {
 		f()
 	}()
 }
+
+// WaitContext is like Wait, but returns ctx.Err() if ctx is done before the
+// counter reaches zero, and nil otherwise. In the former case, a goroutine
+// keeps waiting in the background until the counter reaches zero.
+func (wg *WaitGroup) WaitContext(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -97,6 +97,26 @@ func TestWaitGroupChan(t *testing.T) {
 	wantDone()
 }
 
+func TestWaitGroupWaitContext(t *testing.T) {
+	var wg WaitGroup
+	if err := wg.WaitContext(context.Background()); err != nil {
+		t.Fatalf("WaitContext on idle group = %v, want nil", err)
+	}
+
+	release := make(chan struct{})
+	wg.Go(func() { <-release })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := wg.WaitContext(ctx); err != context.Canceled {
+		t.Fatalf("WaitContext with canceled context = %v, want %v", err, context.Canceled)
+	}
+
+	close(release)
+	if err := wg.WaitContext(context.Background()); err != nil {
+		t.Fatalf("WaitContext after release = %v, want nil", err)
+	}
+}
+
 func TestClosedChan(t *testing.T) {
 	ch := ClosedChan()
 	for range 2 {
@@ -5,7 +5,10 @@
 
 package tailcfg
 
-import "net/netip"
+import (
+	"encoding/json"
+	"net/netip"
+)
 
 // C2NSSHUsernamesRequest is the request for the /ssh/usernames.
 // A GET request without a request body is equivalent to the zero value of this type.
@@ -71,6 +74,24 @@ type C2NPostureIdentityResponse struct {
 	PostureDisabled bool `json:",omitempty"`
 }
 
+// C2NPostureAttributesResponse contains the device posture attributes
+// collected by the client, or a boolean flag indicating that the machine has
+// opted out of posture collection.
+type C2NPostureAttributesResponse struct {
+	// Attributes are the values of the collected posture attributes, by
+	// name, such as "diskEncryption". The attributes and the format of their
+	// values are defined by the tailscale.com/posture package.
+	Attributes map[string]any `json:",omitempty"`
+
+	// Errors are the errors that occurred collecting attributes, by
+	// attribute name.
+	Errors map[string]string `json:",omitempty"`
+
+	// PostureDisabled indicates if the machine has opted out of
+	// device posture collection.
+	PostureDisabled bool `json:",omitempty"`
+}
+
 // C2NAppConnectorDomainRoutesResponse contains a map of domains to
 // slice of addresses, indicating what IP addresses have been resolved
 // for each domain.
@@ -102,3 +123,59 @@ type C2NTLSCertInfo struct {
 	// TODO(bradfitz): add fields for whether an ACME fetch is currently in
 	// process and when it started, etc.
 }
+
+// C2NDebugNetcheckResponse is the response (from node to control) from the
+// /debug/netcheck handler.
+type C2NDebugNetcheckResponse struct {
+	// Error is the error message, if any.
+	Error string `json:",omitempty"`
+
+	// Report is the node's JSON-encoded netcheck.Report. It's
+	// opaque here to avoid a dependency from tailcfg on netcheck.
+	Report json.RawMessage `json:",omitempty"`
+
+	// Fresh is whether Report was generated in response to this request,
+	// as opposed to being the node's most recent cached report.
+	Fresh bool `json:",omitempty"`
+}
+
+// C2NDebugBugReportResponse is the response (from node to control) from the
+// /debug/bugreport handler.
+type C2NDebugBugReportResponse struct {
+	// Marker is the bug report marker that was written to the node's logs,
+	// of the same form as printed by "tailscale bugreport".
+	Marker string
+}
+
+// C2NRouteApprovalsResponse is the response (from node to control) from the
+// GET /routes/approvals handler. It's used by control servers that delegate
+// the approval of a node's advertised routes to an agent running on the node,
+// such as an integration with a change-management system.
+type C2NRouteApprovalsResponse struct {
+	// Justification is the metadata supplied by the node's user
+	// describing why its routes are advertised, if any.
+	Justification string `json:",omitempty"`
+
+	// Routes are the node's advertised routes, along with any routes
+	// that it stopped advertising because they were rejected.
+	Routes []C2NRouteApproval
+}
+
+// C2NRouteApproval is the state of the local approval of a route.
+type C2NRouteApproval struct {
+	Route netip.Prefix
+
+	// Decision is one of RouteApprovalPending, RouteApprovalAccepted or
+	// RouteApprovalRejected.
+	Decision string
+
+	// Reason is the metadata supplied with the decision, if any.
+	Reason string `json:",omitempty"`
+}
+
+// Values of C2NRouteApproval.Decision.
+const (
+	RouteApprovalPending  = "pending"  // advertised, with no decision yet
+	RouteApprovalAccepted = "accepted" // advertised and accepted
+	RouteApprovalRejected = "rejected" // rejected, and no longer advertised
+)
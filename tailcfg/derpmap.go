@@ -6,6 +6,7 @@
 import (
 	"net/netip"
 	"sort"
+	"time"
 
 	"tailscale.com/types/key"
 )
@@ -195,6 +196,11 @@ func (n *DERPNode) IsTestNode() bool {
 type DERPAdmitClientRequest struct {
 	NodePublic key.NodePublic // key to query for admission
 	Source     netip.Addr     // derp client's IP address
+
+	// Token is the admission token the client presented, if any. It's
+	// passed through as-is, even if derper itself isn't configured to
+	// verify tokens with --verify-client-token-keys.
+	Token string `json:",omitempty"`
 }
 
 // DERPAdmitClientResponse is the response to a DERPAdmitClientRequest.
@@ -203,3 +209,13 @@ type DERPAdmitClientResponse struct {
 
 	// TODO(bradfitz,maisem): bandwidth limits, etc?
 }
+
+// DERPAdmitTokenClaims are the signed contents of a DERP admission token, as
+// verified by derper's --verify-client-token-keys. See derp.SignAdmitToken.
+type DERPAdmitTokenClaims struct {
+	// NodePublic is the client key that the token admits. It's required.
+	NodePublic key.NodePublic
+
+	// Expires is when the token stops being valid. It's required.
+	Expires time.Time
+}
@@ -5,7 +5,7 @@
 // the node and the coordination server.
 package tailcfg
 
-//go:generate go run tailscale.com/cmd/viewer --type=User,Node,Hostinfo,NetInfo,Login,DNSConfig,RegisterResponse,RegisterResponseAuth,RegisterRequest,DERPHomeParams,DERPRegion,DERPMap,DERPNode,SSHRule,SSHAction,SSHPrincipal,ControlDialPlan,Location,UserProfile --clonefunc
+//go:generate go run tailscale.com/cmd/viewer --type=User,Node,Hostinfo,NetInfo,Login,DNSConfig,RegisterResponse,RegisterResponseAuth,RegisterRequest,DERPHomeParams,DERPRegion,DERPMap,DERPNode,SSHRule,SSHAction,SSHPrincipal,ControlDialPlan,Location,UserProfile --clonefunc --diff-type=Node
 
 import (
 	"bytes"
@@ -152,7 +152,12 @@
 //   - 107: 2024-10-30: add App Connector to conffile (PR #13942)
 //   - 108: 2024-11-08: Client sends ServicesHash in Hostinfo, understands c2n GET /vip-services.
 //   - 109: 2024-11-18: Client supports filtertype.Match.SrcCaps (issue #12542)
-const CurrentCapabilityVersion CapabilityVersion = 109
+//   - 110: 2026-10-14: Client enforces NodeAttrPostureEnforcement
+//   - 111: 2026-10-14: Client understands c2n GET /posture/attributes
+//   - 112: 2026-10-14: Client understands NodeAttrKeepaliveIntervals
+//   - 113: 2026-10-14: Client understands c2n GET /routes/approvals
+//   - 114: 2026-10-14: Client enforces PeerCapabilitySSHCommands in Tailscale SSH
+const CurrentCapabilityVersion CapabilityVersion = 114
 
 type StableID string
 
@@ -1457,6 +1462,33 @@ type CapGrant struct {
 	// a destination for a set of given VIP services, which is provided as the
 	// value of this key in NodeCapMap.
 	PeerCapabilityServicesDestination PeerCapability = "tailscale.com/cap/services-destination"
+
+	// PeerCapabilityNodeInfo grants a peer the ability to read this node's
+	// self-reported health, version, uptime and path metrics via its
+	// peerapi, as used by "tailscale peer info".
+	PeerCapabilityNodeInfo PeerCapability = "tailscale.com/cap/node-info"
+
+	// PeerCapabilityRemoteUpdate grants a peer the ability to check and
+	// start self-updates of this node via its peerapi, as used by
+	// "tailscale update --fleet". The node must still opt in to remote
+	// updates, as it must for updates triggered by control.
+	PeerCapabilityRemoteUpdate PeerCapability = "tailscale.com/cap/remote-update"
+
+	// PeerCapabilityCertShare grants a peer the ability to get the TLS certs
+	// and private keys of this node's HTTPS names via its peerapi, so that
+	// nodes serving the same name can share one cert. See TS_CERT_HOLDER.
+	PeerCapabilityCertShare PeerCapability = "tailscale.com/cap/cert-share"
+
+	// PeerCapabilitySSHCommands restricts the commands that a peer may run in
+	// Tailscale SSH sessions to this node. Its values are
+	// SSHCommandsCapRule. Peers without it run commands as usual.
+	PeerCapabilitySSHCommands PeerCapability = "tailscale.com/cap/ssh-commands"
+
+	// PeerCapabilityAuthProxy grants a peer groups for apps fronted by an
+	// identity-header proxy such as tailscale-auth-proxy, which passes
+	// them to the app along with the peer's user. Its values are JSON
+	// objects like {"groups": ["admins"]}.
+	PeerCapabilityAuthProxy PeerCapability = "tailscale.com/cap/auth-proxy"
 )
 
 // NodeCapMap is a map of capabilities to their optional values. It is valid for
@@ -2400,8 +2432,71 @@ type Oauth2Token struct {
 	// NodeAttrSSHEnvironmentVariables enables logic for handling environment variables sent
 	// via SendEnv in the SSH server and applying them to the SSH session.
 	NodeAttrSSHEnvironmentVariables NodeCapability = "ssh-env-vars"
+
+	// NodeAttrPostureEnforcement is a node capability whose values are
+	// PostureEnforcement directives, which the client evaluates against its
+	// local device posture and enforces in its packet filter.
+	NodeAttrPostureEnforcement NodeCapability = "tailscale.com/posture-enforcement"
+
+	// NodeAttrKeepaliveIntervals is a node capability whose values are
+	// KeepaliveIntervals that tune how often the client sends disco
+	// heartbeats and WireGuard keepalives to each class of peers.
+	NodeAttrKeepaliveIntervals NodeCapability = "tailscale.com/keepalive-intervals"
+)
+
+// Peer classes of KeepaliveIntervals.
+const (
+	// KeepaliveClassDefault is the class of the active peers that are in
+	// no other class.
+	KeepaliveClassDefault = "default"
+	// KeepaliveClassMobile is the class of active iOS and Android peers.
+	KeepaliveClassMobile = "mobile"
+	// KeepaliveClassServer is the class of active tagged peers that are not
+	// mobile.
+	KeepaliveClassServer = "server"
+	// KeepaliveClassIdle is the class of all peers with no recent traffic.
+	KeepaliveClassIdle = "idle"
 )
 
+// KeepaliveIntervals is a value of the NodeAttrKeepaliveIntervals node
+// capability. It sets the keepalive intervals for a class of peers. Zero
+// fields leave the client's default, or the value set by an earlier
+// KeepaliveIntervals for the same class, in place.
+type KeepaliveIntervals struct {
+	// Class is the class of peers the intervals apply to, one of the
+	// KeepaliveClass constants. Unknown classes are ignored.
+	Class string `json:"class"`
+
+	// DiscoHeartbeatSeconds is how often a disco ping is sent on the
+	// current direct path to keep it alive and verified. It defaults to
+	// 3 seconds for active peers. A negative value disables heartbeats.
+	// For the idle class, it defaults to not sending heartbeats at all,
+	// and a positive value keeps the path to idle peers warm.
+	DiscoHeartbeatSeconds int `json:"discoHeartbeatSeconds,omitempty"`
+
+	// WireGuardKeepaliveSeconds is the WireGuard persistent keepalive
+	// interval, which keeps NAT mappings open even while the peer is idle.
+	// It defaults to disabled. A negative value disables it. It is
+	// ignored for the idle class, as persistent keepalives are only sent
+	// while a peer is idle anyway.
+	WireGuardKeepaliveSeconds int `json:"wireGuardKeepaliveSeconds,omitempty"`
+}
+
+// PostureEnforcement is a value of the NodeAttrPostureEnforcement node
+// capability. It directs the client to block traffic unless the device passes
+// a set of local posture checks.
+type PostureEnforcement struct {
+	// Block is the traffic to block if any of the Require checks fail. The
+	// only supported value is "inbound", which blocks incoming connections
+	// from peers, as if shields up was enabled.
+	Block string `json:"block"`
+
+	// Require are the names of the posture checks that must all pass for
+	// the traffic not to be blocked, such as "disk-encryption". Checks that
+	// the client does not support fail.
+	Require []string `json:"require"`
+}
+
 // SetDNSRequest is a request to add a DNS record.
 //
 // This is used for ACME DNS-01 challenges (so people can use
@@ -2598,6 +2693,37 @@ type SSHAction struct {
 	OnRecordingFailure *SSHRecorderFailureAction `json:"onRecordingFailure,omitempty"`
 }
 
+// SSHCommandsCapRule is a value of the PeerCapabilitySSHCommands peer
+// capability. A peer's rules that apply to the local user of a session are
+// combined: the commands of all of them are allowed, and they must not force
+// different commands. Local and remote port forwarding are denied to sessions
+// that any rule applies to, as they give access to the host without running a
+// command.
+type SSHCommandsCapRule struct {
+	// Users are the local users whose sessions the rule restricts. If empty
+	// or if it contains "*", the rule applies to all local users.
+	Users []string `json:"users,omitempty"`
+
+	// Commands are the command lines that sessions may run. They must match
+	// the command requested by the client exactly, as it's run by the local
+	// user's shell. The entry "internal-sftp" allows the SFTP subsystem.
+	Commands []string `json:"commands,omitempty"`
+
+	// ForceCommand, if non-empty, is run instead of any requested command or
+	// shell that's not in Commands, like the command= option of an OpenSSH
+	// authorized_keys file. The requested command, if any, is in the
+	// SSH_ORIGINAL_COMMAND environment variable. If empty, such sessions are
+	// rejected.
+	ForceCommand string `json:"forceCommand,omitempty"`
+
+	// NotifyURL, if non-empty, is an HTTP POST URL to send an
+	// SSHEventNotifyRequest to whenever a session's command is rejected or
+	// replaced by ForceCommand. As with SSHRecorderFailureAction.NotifyURL,
+	// the host field in the URL is ignored, and it's sent to control over the
+	// Noise transport.
+	NotifyURL string `json:"notifyURL,omitempty"`
+}
+
 // SSHRecorderFailureAction is the action to take if recording fails.
 type SSHRecorderFailureAction struct {
 	// RejectSessionWithMessage, if not empty, specifies that the session should
@@ -2645,6 +2771,9 @@ type SSHEventNotifyRequest struct {
 
 	// RecordingAttempts is the list of recorders that were attempted, in order.
 	RecordingAttempts []*SSHRecordingAttempt
+
+	// Command is the command line requested by the client, if any.
+	Command string `json:",omitempty"`
 }
 
 // SSHEventType defines the event type linked to a SSH action or state.
@@ -2668,6 +2797,16 @@ type SSHEventNotifyRequest struct {
 	// the SSHRecorderFailureAction RejectSessionWithMessage
 	// or TerminateSessionWithMessage is empty.
 	SSHSessionRecordingFailed SSHEventType = 3
+	// SSHSessionCommandRejected is the event that
+	// defines when a SSH session is rejected because
+	// its command isn't allowed by the peer's
+	// PeerCapabilitySSHCommands grants.
+	SSHSessionCommandRejected SSHEventType = 4
+	// SSHSessionCommandForced is the event that
+	// defines when a SSH session runs the ForceCommand
+	// of the peer's PeerCapabilitySSHCommands grants
+	// instead of its requested command.
+	SSHSessionCommandForced SSHEventType = 5
 )
 
 // SSHRecordingAttempt is a single attempt to start a recording.
@@ -637,6 +637,51 @@ func TestNodeEqual(t *testing.T) {
 	}
 }
 
+func TestNodeViewDiff(t *testing.T) {
+	a := &Node{
+		ID:        1,
+		Name:      "a.example.ts.net.",
+		Endpoints: []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:41641")},
+		Online:    ptr.To(true),
+		CapMap:    NodeCapMap{"cap": nil},
+		Hostinfo:  (&Hostinfo{Hostname: "a"}).View(),
+	}
+	if p := a.View().Diff(a.Clone().View()); p != nil {
+		t.Fatalf("Diff of equal nodes = %+v, want nil", p)
+	}
+
+	b := a.Clone()
+	b.Endpoints = append(b.Endpoints, netip.MustParseAddrPort("198.51.100.1:41641"))
+	b.Online = nil
+	b.Tags = []string{"tag:server"}
+	b.Hostinfo = (&Hostinfo{Hostname: "b"}).View()
+	p := a.View().Diff(b.View())
+	if p == nil {
+		t.Fatal("Diff = nil")
+	}
+	if p.Endpoints == nil || p.Online == nil || *p.Online != nil || p.Tags == nil || p.Hostinfo == nil {
+		t.Errorf("Diff is missing changes: %+v", p)
+	}
+	if p.ID != nil || p.Name != nil || p.CapMap != nil {
+		t.Errorf("Diff has unchanged fields: %+v", p)
+	}
+	b.Endpoints[0] = netip.AddrPort{}
+	if (*p.Endpoints)[0] != a.Endpoints[0] {
+		t.Error("patch aliases the diffed node")
+	}
+	b.Endpoints[0] = a.Endpoints[0]
+
+	if got := a.View().ApplyPatch(p); !got.Equal(b.View()) {
+		t.Errorf("ApplyPatch = %+v, want %+v", got.AsStruct(), b)
+	}
+	if got := a.View().ApplyPatch(nil); !got.Equal(a.View()) {
+		t.Error("ApplyPatch(nil) changed the node")
+	}
+	if got := (NodeView{}).ApplyPatch(NodeView{}.Diff(b.View())); !got.Equal(b.View()) {
+		t.Errorf("ApplyPatch of a Diff from an invalid view = %+v, want %+v", got.AsStruct(), b)
+	}
+}
+
 func TestNetInfoFields(t *testing.T) {
 	handled := []string{
 		"MappingVariesByDestIP",
@@ -9,6 +9,7 @@
 	"encoding/json"
 	"errors"
 	"net/netip"
+	"slices"
 	"time"
 
 	"tailscale.com/types/dnstype"
@@ -238,6 +239,389 @@ func (v NodeView) Equal(v2 NodeView) bool { return v.ж.Equal(v2.ж) }
 	ExitNodeDNSResolvers          []*dnstype.Resolver
 }{})
 
+// NodePatch is a set of changes to the exported fields of a Node, as
+// returned by [NodeView.Diff] and applied by [NodeView.ApplyPatch].
+//
+// Each non-nil field points to the new value of the Node field of the
+// same name. Fields that are nil are unchanged.
+type NodePatch struct {
+	ID                            *NodeID                     `json:",omitempty"`
+	StableID                      *StableNodeID               `json:",omitempty"`
+	Name                          *string                     `json:",omitempty"`
+	User                          *UserID                     `json:",omitempty"`
+	Sharer                        *UserID                     `json:",omitempty"`
+	Key                           *key.NodePublic             `json:",omitempty"`
+	KeyExpiry                     *time.Time                  `json:",omitempty"`
+	KeySignature                  *tkatype.MarshaledSignature `json:",omitempty"`
+	Machine                       *key.MachinePublic          `json:",omitempty"`
+	DiscoKey                      *key.DiscoPublic            `json:",omitempty"`
+	Addresses                     *[]netip.Prefix             `json:",omitempty"`
+	AllowedIPs                    *[]netip.Prefix             `json:",omitempty"`
+	Endpoints                     *[]netip.AddrPort           `json:",omitempty"`
+	DERP                          *string                     `json:",omitempty"`
+	Hostinfo                      *HostinfoView               `json:",omitempty"`
+	Created                       *time.Time                  `json:",omitempty"`
+	Cap                           *CapabilityVersion          `json:",omitempty"`
+	Tags                          *[]string                   `json:",omitempty"`
+	PrimaryRoutes                 *[]netip.Prefix             `json:",omitempty"`
+	LastSeen                      **time.Time                 `json:",omitempty"`
+	Online                        **bool                      `json:",omitempty"`
+	MachineAuthorized             *bool                       `json:",omitempty"`
+	Capabilities                  *[]NodeCapability           `json:",omitempty"`
+	CapMap                        *NodeCapMap                 `json:",omitempty"`
+	UnsignedPeerAPIOnly           *bool                       `json:",omitempty"`
+	ComputedName                  *string                     `json:",omitempty"`
+	ComputedNameWithHost          *string                     `json:",omitempty"`
+	DataPlaneAuditLogID           *string                     `json:",omitempty"`
+	Expired                       *bool                       `json:",omitempty"`
+	SelfNodeV4MasqAddrForThisPeer **netip.Addr                `json:",omitempty"`
+	SelfNodeV6MasqAddrForThisPeer **netip.Addr                `json:",omitempty"`
+	IsWireGuardOnly               *bool                       `json:",omitempty"`
+	IsJailed                      *bool                       `json:",omitempty"`
+	ExitNodeDNSResolvers          *[]*dnstype.Resolver        `json:",omitempty"`
+}
+
+// Diff returns the changes to the exported fields of Node from v to v2,
+// or nil if there are none. An invalid view is treated as the zero Node.
+// The returned patch does not alias the memory of v2.
+func (v NodeView) Diff(v2 NodeView) *NodePatch {
+	a, b := v.ж, v2.ж
+	if a == nil {
+		a = new(Node)
+	}
+	if b == nil {
+		b = new(Node)
+	}
+	// Find the changed fields first, and only copy v2 if there are any.
+	var changed NodePatch
+	if a.ID != b.ID {
+		changed.ID = &b.ID
+	}
+	if a.StableID != b.StableID {
+		changed.StableID = &b.StableID
+	}
+	if a.Name != b.Name {
+		changed.Name = &b.Name
+	}
+	if a.User != b.User {
+		changed.User = &b.User
+	}
+	if a.Sharer != b.Sharer {
+		changed.Sharer = &b.Sharer
+	}
+	if a.Key != b.Key {
+		changed.Key = &b.Key
+	}
+	if !a.KeyExpiry.Equal(b.KeyExpiry) {
+		changed.KeyExpiry = &b.KeyExpiry
+	}
+	if !slices.Equal(a.KeySignature, b.KeySignature) {
+		changed.KeySignature = &b.KeySignature
+	}
+	if a.Machine != b.Machine {
+		changed.Machine = &b.Machine
+	}
+	if a.DiscoKey != b.DiscoKey {
+		changed.DiscoKey = &b.DiscoKey
+	}
+	if !slices.Equal(a.Addresses, b.Addresses) {
+		changed.Addresses = &b.Addresses
+	}
+	if !slices.Equal(a.AllowedIPs, b.AllowedIPs) {
+		changed.AllowedIPs = &b.AllowedIPs
+	}
+	if !slices.Equal(a.Endpoints, b.Endpoints) {
+		changed.Endpoints = &b.Endpoints
+	}
+	if a.DERP != b.DERP {
+		changed.DERP = &b.DERP
+	}
+	if !a.Hostinfo.Equal(b.Hostinfo) {
+		changed.Hostinfo = &b.Hostinfo
+	}
+	if !a.Created.Equal(b.Created) {
+		changed.Created = &b.Created
+	}
+	if a.Cap != b.Cap {
+		changed.Cap = &b.Cap
+	}
+	if !slices.Equal(a.Tags, b.Tags) {
+		changed.Tags = &b.Tags
+	}
+	if !slices.Equal(a.PrimaryRoutes, b.PrimaryRoutes) {
+		changed.PrimaryRoutes = &b.PrimaryRoutes
+	}
+	if (a.LastSeen == nil) != (b.LastSeen == nil) || a.LastSeen != nil && !a.LastSeen.Equal(*b.LastSeen) {
+		changed.LastSeen = &b.LastSeen
+	}
+	if (a.Online == nil) != (b.Online == nil) || a.Online != nil && *a.Online != *b.Online {
+		changed.Online = &b.Online
+	}
+	if a.MachineAuthorized != b.MachineAuthorized {
+		changed.MachineAuthorized = &b.MachineAuthorized
+	}
+	if !slices.Equal(a.Capabilities, b.Capabilities) {
+		changed.Capabilities = &b.Capabilities
+	}
+	if !a.CapMap.Equal(b.CapMap) {
+		changed.CapMap = &b.CapMap
+	}
+	if a.UnsignedPeerAPIOnly != b.UnsignedPeerAPIOnly {
+		changed.UnsignedPeerAPIOnly = &b.UnsignedPeerAPIOnly
+	}
+	if a.ComputedName != b.ComputedName {
+		changed.ComputedName = &b.ComputedName
+	}
+	if a.ComputedNameWithHost != b.ComputedNameWithHost {
+		changed.ComputedNameWithHost = &b.ComputedNameWithHost
+	}
+	if a.DataPlaneAuditLogID != b.DataPlaneAuditLogID {
+		changed.DataPlaneAuditLogID = &b.DataPlaneAuditLogID
+	}
+	if a.Expired != b.Expired {
+		changed.Expired = &b.Expired
+	}
+	if (a.SelfNodeV4MasqAddrForThisPeer == nil) != (b.SelfNodeV4MasqAddrForThisPeer == nil) || a.SelfNodeV4MasqAddrForThisPeer != nil && *a.SelfNodeV4MasqAddrForThisPeer != *b.SelfNodeV4MasqAddrForThisPeer {
+		changed.SelfNodeV4MasqAddrForThisPeer = &b.SelfNodeV4MasqAddrForThisPeer
+	}
+	if (a.SelfNodeV6MasqAddrForThisPeer == nil) != (b.SelfNodeV6MasqAddrForThisPeer == nil) || a.SelfNodeV6MasqAddrForThisPeer != nil && *a.SelfNodeV6MasqAddrForThisPeer != *b.SelfNodeV6MasqAddrForThisPeer {
+		changed.SelfNodeV6MasqAddrForThisPeer = &b.SelfNodeV6MasqAddrForThisPeer
+	}
+	if a.IsWireGuardOnly != b.IsWireGuardOnly {
+		changed.IsWireGuardOnly = &b.IsWireGuardOnly
+	}
+	if a.IsJailed != b.IsJailed {
+		changed.IsJailed = &b.IsJailed
+	}
+	if !slices.EqualFunc(a.ExitNodeDNSResolvers, b.ExitNodeDNSResolvers, (*dnstype.Resolver).Equal) {
+		changed.ExitNodeDNSResolvers = &b.ExitNodeDNSResolvers
+	}
+	if changed == (NodePatch{}) {
+		return nil
+	}
+	c := b.Clone()
+	p := new(NodePatch)
+	if changed.ID != nil {
+		p.ID = &c.ID
+	}
+	if changed.StableID != nil {
+		p.StableID = &c.StableID
+	}
+	if changed.Name != nil {
+		p.Name = &c.Name
+	}
+	if changed.User != nil {
+		p.User = &c.User
+	}
+	if changed.Sharer != nil {
+		p.Sharer = &c.Sharer
+	}
+	if changed.Key != nil {
+		p.Key = &c.Key
+	}
+	if changed.KeyExpiry != nil {
+		p.KeyExpiry = &c.KeyExpiry
+	}
+	if changed.KeySignature != nil {
+		p.KeySignature = &c.KeySignature
+	}
+	if changed.Machine != nil {
+		p.Machine = &c.Machine
+	}
+	if changed.DiscoKey != nil {
+		p.DiscoKey = &c.DiscoKey
+	}
+	if changed.Addresses != nil {
+		p.Addresses = &c.Addresses
+	}
+	if changed.AllowedIPs != nil {
+		p.AllowedIPs = &c.AllowedIPs
+	}
+	if changed.Endpoints != nil {
+		p.Endpoints = &c.Endpoints
+	}
+	if changed.DERP != nil {
+		p.DERP = &c.DERP
+	}
+	if changed.Hostinfo != nil {
+		p.Hostinfo = &c.Hostinfo
+	}
+	if changed.Created != nil {
+		p.Created = &c.Created
+	}
+	if changed.Cap != nil {
+		p.Cap = &c.Cap
+	}
+	if changed.Tags != nil {
+		p.Tags = &c.Tags
+	}
+	if changed.PrimaryRoutes != nil {
+		p.PrimaryRoutes = &c.PrimaryRoutes
+	}
+	if changed.LastSeen != nil {
+		p.LastSeen = &c.LastSeen
+	}
+	if changed.Online != nil {
+		p.Online = &c.Online
+	}
+	if changed.MachineAuthorized != nil {
+		p.MachineAuthorized = &c.MachineAuthorized
+	}
+	if changed.Capabilities != nil {
+		p.Capabilities = &c.Capabilities
+	}
+	if changed.CapMap != nil {
+		p.CapMap = &c.CapMap
+	}
+	if changed.UnsignedPeerAPIOnly != nil {
+		p.UnsignedPeerAPIOnly = &c.UnsignedPeerAPIOnly
+	}
+	if changed.ComputedName != nil {
+		p.ComputedName = &c.ComputedName
+	}
+	if changed.ComputedNameWithHost != nil {
+		p.ComputedNameWithHost = &c.ComputedNameWithHost
+	}
+	if changed.DataPlaneAuditLogID != nil {
+		p.DataPlaneAuditLogID = &c.DataPlaneAuditLogID
+	}
+	if changed.Expired != nil {
+		p.Expired = &c.Expired
+	}
+	if changed.SelfNodeV4MasqAddrForThisPeer != nil {
+		p.SelfNodeV4MasqAddrForThisPeer = &c.SelfNodeV4MasqAddrForThisPeer
+	}
+	if changed.SelfNodeV6MasqAddrForThisPeer != nil {
+		p.SelfNodeV6MasqAddrForThisPeer = &c.SelfNodeV6MasqAddrForThisPeer
+	}
+	if changed.IsWireGuardOnly != nil {
+		p.IsWireGuardOnly = &c.IsWireGuardOnly
+	}
+	if changed.IsJailed != nil {
+		p.IsJailed = &c.IsJailed
+	}
+	if changed.ExitNodeDNSResolvers != nil {
+		p.ExitNodeDNSResolvers = &c.ExitNodeDNSResolvers
+	}
+	return p
+}
+
+// ApplyPatch returns a view of a copy of v with the changes in p applied.
+// An invalid view is treated as the zero Node. The result may alias
+// the memory of p, which must not be modified afterwards.
+func (v NodeView) ApplyPatch(p *NodePatch) NodeView {
+	if p == nil {
+		return v
+	}
+	x := v.AsStruct()
+	if x == nil {
+		x = new(Node)
+	}
+	if p.ID != nil {
+		x.ID = *p.ID
+	}
+	if p.StableID != nil {
+		x.StableID = *p.StableID
+	}
+	if p.Name != nil {
+		x.Name = *p.Name
+	}
+	if p.User != nil {
+		x.User = *p.User
+	}
+	if p.Sharer != nil {
+		x.Sharer = *p.Sharer
+	}
+	if p.Key != nil {
+		x.Key = *p.Key
+	}
+	if p.KeyExpiry != nil {
+		x.KeyExpiry = *p.KeyExpiry
+	}
+	if p.KeySignature != nil {
+		x.KeySignature = *p.KeySignature
+	}
+	if p.Machine != nil {
+		x.Machine = *p.Machine
+	}
+	if p.DiscoKey != nil {
+		x.DiscoKey = *p.DiscoKey
+	}
+	if p.Addresses != nil {
+		x.Addresses = *p.Addresses
+	}
+	if p.AllowedIPs != nil {
+		x.AllowedIPs = *p.AllowedIPs
+	}
+	if p.Endpoints != nil {
+		x.Endpoints = *p.Endpoints
+	}
+	if p.DERP != nil {
+		x.DERP = *p.DERP
+	}
+	if p.Hostinfo != nil {
+		x.Hostinfo = *p.Hostinfo
+	}
+	if p.Created != nil {
+		x.Created = *p.Created
+	}
+	if p.Cap != nil {
+		x.Cap = *p.Cap
+	}
+	if p.Tags != nil {
+		x.Tags = *p.Tags
+	}
+	if p.PrimaryRoutes != nil {
+		x.PrimaryRoutes = *p.PrimaryRoutes
+	}
+	if p.LastSeen != nil {
+		x.LastSeen = *p.LastSeen
+	}
+	if p.Online != nil {
+		x.Online = *p.Online
+	}
+	if p.MachineAuthorized != nil {
+		x.MachineAuthorized = *p.MachineAuthorized
+	}
+	if p.Capabilities != nil {
+		x.Capabilities = *p.Capabilities
+	}
+	if p.CapMap != nil {
+		x.CapMap = *p.CapMap
+	}
+	if p.UnsignedPeerAPIOnly != nil {
+		x.UnsignedPeerAPIOnly = *p.UnsignedPeerAPIOnly
+	}
+	if p.ComputedName != nil {
+		x.ComputedName = *p.ComputedName
+	}
+	if p.ComputedNameWithHost != nil {
+		x.ComputedNameWithHost = *p.ComputedNameWithHost
+	}
+	if p.DataPlaneAuditLogID != nil {
+		x.DataPlaneAuditLogID = *p.DataPlaneAuditLogID
+	}
+	if p.Expired != nil {
+		x.Expired = *p.Expired
+	}
+	if p.SelfNodeV4MasqAddrForThisPeer != nil {
+		x.SelfNodeV4MasqAddrForThisPeer = *p.SelfNodeV4MasqAddrForThisPeer
+	}
+	if p.SelfNodeV6MasqAddrForThisPeer != nil {
+		x.SelfNodeV6MasqAddrForThisPeer = *p.SelfNodeV6MasqAddrForThisPeer
+	}
+	if p.IsWireGuardOnly != nil {
+		x.IsWireGuardOnly = *p.IsWireGuardOnly
+	}
+	if p.IsJailed != nil {
+		x.IsJailed = *p.IsJailed
+	}
+	if p.ExitNodeDNSResolvers != nil {
+		x.ExitNodeDNSResolvers = *p.ExitNodeDNSResolvers
+	}
+	return x.View()
+}
+
 // View returns a readonly view of Hostinfo.
 func (p *Hostinfo) View() HostinfoView {
 	return HostinfoView{ж: p}
@@ -32,6 +32,7 @@
 	"tailscale.com/net/tstun"
 	"tailscale.com/proxymap"
 	"tailscale.com/types/netmap"
+	"tailscale.com/util/eventbus"
 	"tailscale.com/util/usermetric"
 	"tailscale.com/wgengine"
 	"tailscale.com/wgengine/magicsock"
@@ -68,6 +69,7 @@ type System struct {
 
 	healthTracker       health.Tracker
 	userMetricsRegistry usermetric.Registry
+	eventBus            eventbus.Bus
 }
 
 // NetstackImpl is the interface that *netstack.Impl implements.
@@ -149,6 +151,11 @@ func (s *System) UserMetricsRegistry() *usermetric.Registry {
 	return &s.userMetricsRegistry
 }
 
+// EventBus returns the bus on which subsystems publish events.
+func (s *System) EventBus() *eventbus.Bus {
+	return &s.eventBus
+}
+
 // SubSystem represents some subsystem of the Tailscale node daemon.
 //
 // A subsystem can be set to a value, and then later retrieved. A subsystem
@@ -48,6 +48,7 @@
 	"tailscale.com/tsd"
 	"tailscale.com/types/logger"
 	"tailscale.com/types/logid"
+	"tailscale.com/types/netmap"
 	"tailscale.com/types/nettype"
 	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/mak"
@@ -116,11 +117,22 @@ type Server struct {
 	// its Tailscale interface on port 5252.
 	RunWebClient bool
 
+	// RunMetricsServer, if true, serves this node's client metrics in
+	// Prometheus format over its Tailscale interface at
+	// http://<tailscale-ip>:5253/metrics.
+	RunMetricsServer bool
+
 	// Port is the UDP port to listen on for WireGuard and peer-to-peer
 	// traffic. If zero, a port is automatically selected. Leave this
 	// field at zero unless you know what you are doing.
 	Port uint16
 
+	// SystemDialForTest, if non-nil, is used instead of the system
+	// network to dial connections that don't go over Tailscale, such as
+	// to the coordination server. It's intended for tests, such as to
+	// simulate a flaky network with a memnet.FaultInjector.
+	SystemDialForTest func(ctx context.Context, network, address string) (net.Conn, error)
+
 	getCertForTesting func(*tls.ClientHelloInfo) (*tls.Certificate, error)
 
 	initOnce         sync.Once
@@ -529,7 +541,7 @@ func (s *Server) start() (reterr error) {
 	}
 	closePool.add(s.netMon)
 
-	s.dialer = &tsdial.Dialer{Logf: tsLogf} // mutated below (before used)
+	s.dialer = &tsdial.Dialer{Logf: tsLogf, SystemDialForTest: s.SystemDialForTest} // mutated below (before used)
 	eng, err := wgengine.NewUserspaceEngine(tsLogf, wgengine.Config{
 		ListenPort:    s.Port,
 		NetMon:        s.netMon,
@@ -582,6 +594,7 @@ func (s *Server) start() (reterr error) {
 		}
 		return udpConn, nil
 	}
+	s.dialer.MagicDNSDialUDP = ns.DialContextMagicDNS
 
 	if s.Store == nil {
 		stateFile := filepath.Join(s.rootPath, "tailscaled.state")
@@ -614,6 +627,7 @@ func (s *Server) start() (reterr error) {
 	prefs.WantRunning = true
 	prefs.ControlURL = s.ControlURL
 	prefs.RunWebClient = s.RunWebClient
+	prefs.RunMetricsServer = s.RunMetricsServer
 	authKey := s.getAuthKey()
 	err = lb.Start(ipn.Options{
 		UpdatePrefs: prefs,
@@ -1042,6 +1056,18 @@ func (s *Server) ListenFunnel(network, addr string, opts ...FunnelOption) (net.L
 	if network != "tcp" {
 		return nil, fmt.Errorf("ListenFunnel(%q, %q): only tcp is supported", network, addr)
 	}
+	lnOn := listenOnBoth
+	for _, opt := range opts {
+		if _, ok := opt.(funnelOnly); ok {
+			lnOn = listenOnFunnel
+		}
+	}
+	return s.listenFunnel(network, addr, lnOn)
+}
+
+// listenFunnel is ListenFunnel, for a listener on lnOn, which must be
+// listenOnFunnel or listenOnBoth. The network must be tcp, tcp4 or tcp6.
+func (s *Server) listenFunnel(network, addr string, lnOn listenOn) (net.Listener, error) {
 	host, portStr, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
@@ -1091,12 +1117,6 @@ func (s *Server) ListenFunnel(network, addr string, opts ...FunnelOption) (net.L
 	}
 
 	// Start a funnel listener.
-	lnOn := listenOnBoth
-	for _, opt := range opts {
-		if _, ok := opt.(funnelOnly); ok {
-			lnOn = listenOnFunnel
-		}
-	}
 	ln, err := s.listen(network, addr, lnOn)
 	if err != nil {
 		return nil, err
@@ -1106,6 +1126,91 @@ func (s *Server) ListenFunnel(network, addr string, opts ...FunnelOption) (net.L
 	}), nil
 }
 
+// ListenOpts are options for ListenWithOpts.
+type ListenOpts struct {
+	// Host, if valid, is the address to accept connections to, such as
+	// one of the node's Tailscale IPs, instead of either of them. The host
+	// part of the addr passed to ListenWithOpts must then be empty.
+	// It can only be used with TailnetOnly.
+	Host netip.Addr
+
+	// Only4 and Only6 restrict the listener to connections over IPv4 or
+	// IPv6, respectively. At most one of them may be set.
+	Only4 bool
+	Only6 bool
+
+	// FunnelOnly and TailnetOnly restrict the listener to connections from
+	// Tailscale Funnel or from the tailnet, respectively. At most one of
+	// them may be set. Unless TailnetOnly is set, the listener is a Funnel
+	// listener, with the same requirements as ListenFunnel, and its
+	// connections are TLS connections.
+	FunnelOnly  bool
+	TailnetOnly bool
+}
+
+// ListenWithOpts announces only on the Tailscale network or Tailscale
+// Funnel, as configured by opts. Without options restricting it to the
+// tailnet, it is like ListenFunnel.
+//
+// This allows, for example, serving the public internet over Funnel on one
+// listener and admin pages only to the tailnet on another:
+//
+//	pub, _ := s.ListenWithOpts("tcp", ":443", tsnet.ListenOpts{FunnelOnly: true})
+//	admin, _ := s.ListenWithOpts("tcp", ":8080", tsnet.ListenOpts{TailnetOnly: true})
+//
+// It will start the server if it has not been started yet.
+func (s *Server) ListenWithOpts(network, addr string, opts ListenOpts) (net.Listener, error) {
+	if opts.Only4 && opts.Only6 {
+		return nil, errors.New("tsnet: ListenOpts.Only4 and Only6 are mutually exclusive")
+	}
+	if opts.FunnelOnly && opts.TailnetOnly {
+		return nil, errors.New("tsnet: ListenOpts.FunnelOnly and TailnetOnly are mutually exclusive")
+	}
+	if opts.Only4 || opts.Only6 {
+		switch network {
+		case "tcp", "udp":
+			network = networkForFamily(network, opts.Only6)
+		case "tcp4", "udp4":
+			if opts.Only6 {
+				return nil, fmt.Errorf("tsnet: ListenOpts.Only6 set for network %q", network)
+			}
+		case "tcp6", "udp6":
+			if opts.Only4 {
+				return nil, fmt.Errorf("tsnet: ListenOpts.Only4 set for network %q", network)
+			}
+		}
+	}
+	if opts.Host.IsValid() {
+		if !opts.TailnetOnly {
+			return nil, errors.New("tsnet: ListenOpts.Host requires TailnetOnly")
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("tsnet: %w", err)
+		}
+		if host != "" {
+			return nil, fmt.Errorf("tsnet: ListenOpts.Host set, but addr %q has a host", addr)
+		}
+		if (opts.Only4 && !opts.Host.Is4()) || (opts.Only6 && !opts.Host.Is6()) {
+			return nil, fmt.Errorf("tsnet: ListenOpts.Host %v is not of the requested address family", opts.Host)
+		}
+		addr = net.JoinHostPort(opts.Host.String(), port)
+	}
+	if opts.TailnetOnly {
+		return s.listen(network, addr, listenOnTailnet)
+	}
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("ListenWithOpts(%q, %q): only tcp is supported with Funnel", network, addr)
+	}
+	lnOn := listenOnBoth
+	if opts.FunnelOnly {
+		lnOn = listenOnFunnel
+	}
+	return s.listenFunnel(network, addr, lnOn)
+}
+
 type listenOn string
 
 const (
@@ -1228,6 +1333,30 @@ func (s *Server) CapturePcap(ctx context.Context, pcapFile string) error {
 	return nil
 }
 
+// WatchNetMapChanges calls fn with the changes to the network map each time
+// it changes, such as peers being added or removed or their endpoints
+// changing, until ctx is done. The first call reports the changes from no
+// network map, so it lists all peers as added. It starts the server if needed.
+//
+// fn is called from a single goroutine and must not block for long.
+func (s *Server) WatchNetMapChanges(ctx context.Context, fn func([]netmap.Change)) error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+	var last *netmap.NetworkMap
+	s.lb.WatchNotifications(ctx, ipn.NotifyInitialNetMap|ipn.NotifyNoPrivateKeys, nil, func(n *ipn.Notify) (keepGoing bool) {
+		if n.NetMap == nil {
+			return true
+		}
+		if changes := netmap.Diff(last, n.NetMap); len(changes) > 0 {
+			fn(changes)
+		}
+		last = n.NetMap
+		return true
+	})
+	return ctx.Err()
+}
+
 // Sys returns a handle to the Tailscale subsystems of this node.
 //
 // This is not a stable API, nor are the APIs of the returned subsystems.
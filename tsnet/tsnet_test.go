@@ -99,6 +99,43 @@ func TestListenerPort(t *testing.T) {
 	}
 }
 
+func TestListenWithOptsValidation(t *testing.T) {
+	errNone := errors.New("sentinel start error")
+
+	ip4 := netip.MustParseAddr("100.102.104.108")
+	tests := []struct {
+		name    string
+		network string
+		addr    string
+		opts    ListenOpts
+		wantErr bool
+	}{
+		{"tailnet", "tcp", ":80", ListenOpts{TailnetOnly: true}, false},
+		{"tailnet-udp", "udp", ":80", ListenOpts{TailnetOnly: true, Only4: true}, false},
+		{"funnel", "tcp", ":443", ListenOpts{}, false},
+		{"funnel-only", "tcp", ":443", ListenOpts{FunnelOnly: true, Only6: true}, false},
+		{"funnel-udp", "udp", ":443", ListenOpts{FunnelOnly: true}, true},
+		{"both-families", "tcp", ":80", ListenOpts{TailnetOnly: true, Only4: true, Only6: true}, true},
+		{"both-sources", "tcp", ":80", ListenOpts{TailnetOnly: true, FunnelOnly: true}, true},
+		{"family-mismatch", "tcp4", ":80", ListenOpts{TailnetOnly: true, Only6: true}, true},
+		{"host", "tcp", ":80", ListenOpts{TailnetOnly: true, Host: ip4}, false},
+		{"host-family-mismatch", "tcp", ":80", ListenOpts{TailnetOnly: true, Only6: true, Host: ip4}, true},
+		{"host-and-addr-host", "tcp", "100.1.2.3:80", ListenOpts{TailnetOnly: true, Host: ip4}, true},
+		{"host-funnel", "tcp", ":443", ListenOpts{Host: ip4}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{}
+			s.initOnce.Do(func() { s.initErr = errNone })
+			_, err := s.ListenWithOpts(tt.network, tt.addr, tt.opts)
+			gotErr := err != nil && !errors.Is(err, errNone)
+			if gotErr != tt.wantErr {
+				t.Errorf("ListenWithOpts(%q, %q, %+v) error = %v, want error %v", tt.network, tt.addr, tt.opts, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 var verboseDERP = flag.Bool("verbose-derp", false, "if set, print DERP and STUN logs")
 var verboseNodes = flag.Bool("verbose-nodes", false, "if set, print tsnet.Server logs")
 
@@ -307,6 +344,40 @@ func TestConn(t *testing.T) {
 	}
 }
 
+func TestListenWithOptsFamily(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	controlURL, _ := startControl(t)
+	s1, s1ip, _ := startServer(t, ctx, controlURL, "s1")
+	s2, _, _ := startServer(t, ctx, controlURL, "s2")
+	_, s1ip6 := s1.TailscaleIPs()
+
+	ln, err := s1.ListenWithOpts("tcp", ":8081", ListenOpts{TailnetOnly: true, Only6: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	if c, err := s2.Dial(ctx, "tcp", netip.AddrPortFrom(s1ip, 8081).String()); err == nil {
+		c.Close()
+		t.Fatal("unexpected success dialing IPv6-only listener over IPv4")
+	}
+	w, err := s2.Dial(ctx, "tcp", netip.AddrPortFrom(s1ip6, 8081).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	r, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got := r.LocalAddr().String(); got != netip.AddrPortFrom(s1ip6, 8081).String() {
+		t.Errorf("LocalAddr = %v, want %v", got, netip.AddrPortFrom(s1ip6, 8081))
+	}
+}
+
 func TestLoopbackLocalAPI(t *testing.T) {
 	flakytest.Mark(t, "https://github.com/tailscale/tailscale/issues/8557")
 	tstest.ResourceCheck(t)
@@ -803,6 +874,35 @@ func TestUDPConn(t *testing.T) {
 		t.Errorf("got from %v, want %v", from, s2ip)
 	}
 
+	// The sender of a UDP packet can be identified.
+	lc1, err := s1.LocalClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	who, err := lc1.WhoIsProto(ctx, "udp", from.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if who.Node.ComputedName != "s2" || who.Node.Addresses[0].Addr() != s2ip {
+		t.Errorf("WhoIsProto(udp, %v) = node %q %v; want s2", from, who.Node.ComputedName, who.Node.Addresses)
+	}
+
+	// So can the sender of a UDP flow that netstack forwards to a local
+	// socket, by the local address it's proxied from.
+	mapped := netip.MustParseAddrPort("127.0.0.1:45678")
+	pm := s1.Sys().ProxyMapper()
+	if err := pm.RegisterIPPortIdentity("udp", mapped, s2ip); err != nil {
+		t.Fatal(err)
+	}
+	defer pm.UnregisterIPPortIdentity("udp", mapped)
+	who, err = lc1.WhoIsProto(ctx, "udp", mapped.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if who.Node.ComputedName != "s2" || who.Node.Addresses[0].Addr() != s2ip {
+		t.Errorf("WhoIsProto(udp, %v) = node %q %v; want s2", mapped, who.Node.ComputedName, who.Node.Addresses)
+	}
+
 	// Write a response back to s2
 	if _, err := pc.WriteTo([]byte("world"), from); err != nil {
 		t.Fatal(err)
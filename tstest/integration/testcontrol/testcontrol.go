@@ -83,6 +83,10 @@ type Server struct {
 	// nodeCapMaps overrides the capability map sent down to a client.
 	nodeCapMaps map[key.NodePublic]tailcfg.NodeCapMap
 
+	// packetFilter, if non-nil, is the packet filter sent to all nodes
+	// instead of the default one allowing all traffic.
+	packetFilter []tailcfg.FilterRule
+
 	// suppressAutoMapResponses is the set of nodes that should not be sent
 	// automatic map responses from serveMap. (They should only get manually sent ones)
 	suppressAutoMapResponses set.Set[key.NodePublic]
@@ -421,6 +425,16 @@ func (s *Server) SetNodeCapMap(nodeKey key.NodePublic, capMap tailcfg.NodeCapMap
 	s.updateLocked("SetNodeCapMap", s.nodeIDsLocked(0))
 }
 
+// SetPacketFilter sets the packet filter sent to all nodes, as the tailnet's
+// ACLs would. A nil rules restores the default packet filter, which allows
+// all traffic.
+func (s *Server) SetPacketFilter(rules []tailcfg.FilterRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.packetFilter = slices.Clone(rules)
+	s.updateLocked("SetPacketFilter", s.nodeIDsLocked(0))
+}
+
 // nodeIDsLocked returns the node IDs of all nodes in the server, except
 // for the node with the given ID.
 func (s *Server) nodeIDsLocked(except tailcfg.NodeID) []tailcfg.NodeID {
@@ -936,7 +950,11 @@ func (s *Server) MapResponse(req *tailcfg.MapRequest) (res *tailcfg.MapResponse,
 
 	s.mu.Lock()
 	nodeCapMap := maps.Clone(s.nodeCapMaps[nk])
+	packetFilter := s.packetFilter
 	s.mu.Unlock()
+	if packetFilter == nil {
+		packetFilter = packetFilterWithIngressCaps()
+	}
 
 	node.CapMap = nodeCapMap
 	node.Capabilities = append(node.Capabilities, tailcfg.NodeAttrDisableUPnP)
@@ -956,7 +974,7 @@ func (s *Server) MapResponse(req *tailcfg.MapRequest) (res *tailcfg.MapResponse,
 		DERPMap:         s.DERPMap,
 		Domain:          domain,
 		CollectServices: "true",
-		PacketFilter:    packetFilterWithIngressCaps(),
+		PacketFilter:    packetFilter,
 		DNSConfig:       dns,
 		ControlTime:     &t,
 	}
@@ -0,0 +1,245 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package tsnettest runs in-process tailnets for end-to-end tests of programs
+// embedding tsnet.
+//
+// A Tailnet has its own in-memory control server and DERP server, all
+// listening on localhost, so tests need neither a real tailnet nor network
+// access. For example:
+//
+//	tn := tsnettest.New(t, nil)
+//	srv := tn.NewNode("server")
+//	ln, err := srv.Listen("tcp", ":80")
+//	...
+//	client := tn.NewNode("client")
+//	c, err := client.Dial(ctx, "tcp", srv.IPv4().String()+":80")
+//
+// Traffic between nodes is allowed by default. Use SetACL to restrict it, as
+// the tailnet's ACLs would.
+package tsnettest
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"tailscale.com/ipn/store/mem"
+	"tailscale.com/net/netns"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tsnet"
+	"tailscale.com/tstest/integration"
+	"tailscale.com/tstest/integration/testcontrol"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+)
+
+// Options configures a Tailnet.
+type Options struct {
+	// ACL, if non-nil, are the packet filter rules that restrict traffic
+	// between nodes, as in SetACL. Nil means that all traffic is allowed.
+	ACL []tailcfg.FilterRule
+
+	// MagicDNSDomain is the tailnet's MagicDNS domain. If empty,
+	// "tail-scale.ts.net" is used.
+	MagicDNSDomain string
+
+	// Verbose is whether to log the control, DERP and node logs to the
+	// test's log.
+	Verbose bool
+}
+
+// Tailnet is an in-process tailnet. It's shut down when the test that
+// created it completes.
+type Tailnet struct {
+	tb      testing.TB
+	opts    Options
+	control *testcontrol.Server
+
+	mu    sync.Mutex
+	nodes []*Node
+}
+
+// New starts a tailnet for the test tb. A nil opts is equivalent to a zero
+// Options.
+func New(tb testing.TB, opts *Options) *Tailnet {
+	tb.Helper()
+	tn := &Tailnet{tb: tb}
+	if opts != nil {
+		tn.opts = *opts
+	}
+	if tn.opts.MagicDNSDomain == "" {
+		tn.opts.MagicDNSDomain = "tail-scale.ts.net"
+	}
+
+	// Nodes only ever talk to each other and the control and DERP
+	// servers, all on localhost.
+	netns.SetEnabled(false)
+	tb.Cleanup(func() { netns.SetEnabled(true) })
+
+	derpMap := integration.RunDERPAndSTUN(tb, tn.logf(), "127.0.0.1")
+	tn.control = &testcontrol.Server{
+		Logf:    tn.logf(),
+		DERPMap: derpMap,
+		DNSConfig: &tailcfg.DNSConfig{
+			Proxied: true,
+		},
+		MagicDNSDomain: tn.opts.MagicDNSDomain,
+	}
+	if tn.opts.ACL != nil {
+		tn.control.SetPacketFilter(tn.opts.ACL)
+	}
+	tn.control.HTTPTestServer = httptest.NewUnstartedServer(tn.control)
+	tn.control.HTTPTestServer.Start()
+	tb.Cleanup(tn.control.HTTPTestServer.Close)
+	return tn
+}
+
+func (tn *Tailnet) logf() logger.Logf {
+	if tn.opts.Verbose {
+		return tn.tb.Logf
+	}
+	return logger.Discard
+}
+
+// Control returns the tailnet's control server, for tests that need to
+// configure the tailnet in ways that Tailnet doesn't support.
+func (tn *Tailnet) Control() *testcontrol.Server {
+	return tn.control
+}
+
+// ControlURL returns the URL of the tailnet's control server, for use as
+// tsnet.Server.ControlURL.
+func (tn *Tailnet) ControlURL() string {
+	return tn.control.HTTPTestServer.URL
+}
+
+// SetACL sets the packet filter rules that restrict traffic between nodes,
+// as the tailnet's ACLs would. A nil rules allows all traffic. Nodes apply
+// the new rules asynchronously, shortly after SetACL returns.
+//
+// Allow returns rules for common cases.
+func (tn *Tailnet) SetACL(rules []tailcfg.FilterRule) {
+	tn.control.SetPacketFilter(rules)
+}
+
+// Node is a node on a Tailnet.
+type Node struct {
+	*tsnet.Server
+
+	ipv4, ipv6 netip.Addr
+	nodeKey    key.NodePublic
+}
+
+// IPv4 returns the node's Tailscale IPv4 address.
+func (n *Node) IPv4() netip.Addr { return n.ipv4 }
+
+// IPv6 returns the node's Tailscale IPv6 address.
+func (n *Node) IPv6() netip.Addr { return n.ipv6 }
+
+// NodeKey returns the node's public node key, as used by the control server.
+func (n *Node) NodeKey() key.NodePublic { return n.nodeKey }
+
+// NewNode starts a node with the given hostname on the tailnet. It returns
+// once the node is up and all nodes on the tailnet know about each other.
+// The node is closed when the test completes.
+//
+// Its tsnet.Server can be configured before it starts by passing a
+// configure func.
+func (tn *Tailnet) NewNode(hostname string, configure ...func(*tsnet.Server)) *Node {
+	tn.tb.Helper()
+	dir := filepath.Join(tn.tb.TempDir(), hostname)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		tn.tb.Fatal(err)
+	}
+	s := &tsnet.Server{
+		Dir:        dir,
+		ControlURL: tn.ControlURL(),
+		Hostname:   hostname,
+		Store:      new(mem.Store),
+		Ephemeral:  true,
+	}
+	if tn.opts.Verbose {
+		s.Logf = logger.WithPrefix(tn.tb.Logf, hostname+": ")
+	}
+	for _, f := range configure {
+		f(s)
+	}
+	tn.tb.Cleanup(func() { s.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	st, err := s.Up(ctx)
+	if err != nil {
+		tn.tb.Fatalf("starting node %q: %v", hostname, err)
+	}
+	n := &Node{Server: s, nodeKey: st.Self.PublicKey}
+	for _, ip := range st.TailscaleIPs {
+		if ip.Is4() {
+			n.ipv4 = ip
+		} else {
+			n.ipv6 = ip
+		}
+	}
+
+	tn.mu.Lock()
+	tn.nodes = append(tn.nodes, n)
+	nodes := tn.nodes
+	tn.mu.Unlock()
+	if err := waitForPeers(ctx, nodes); err != nil {
+		tn.tb.Fatalf("starting node %q: %v", hostname, err)
+	}
+	return n
+}
+
+// waitForPeers waits until each of nodes has all the others as peers.
+func waitForPeers(ctx context.Context, nodes []*Node) error {
+	for _, n := range nodes {
+		lc, err := n.LocalClient()
+		if err != nil {
+			return err
+		}
+		for {
+			st, err := lc.Status(ctx)
+			if err != nil {
+				return err
+			}
+			if len(st.Peer) >= len(nodes)-1 {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("timed out waiting for %s to see %d peers; has %d", n.Hostname, len(nodes)-1, len(st.Peer))
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+	return nil
+}
+
+// Allow returns a packet filter rule allowing connections from src to the
+// given ports of dst, or to all its ports if none are given.
+func Allow(src, dst *Node, ports ...uint16) tailcfg.FilterRule {
+	r := tailcfg.FilterRule{
+		SrcIPs: []string{src.ipv4.String(), src.ipv6.String()},
+	}
+	ranges := []tailcfg.PortRange{tailcfg.PortRangeAny}
+	if len(ports) > 0 {
+		ranges = ranges[:0]
+		for _, p := range ports {
+			ranges = append(ranges, tailcfg.PortRange{First: p, Last: p})
+		}
+	}
+	for _, ip := range []netip.Addr{dst.ipv4, dst.ipv6} {
+		for _, pr := range ranges {
+			r.DstPorts = append(r.DstPorts, tailcfg.NetPortRange{IP: ip.String(), Ports: pr})
+		}
+	}
+	return r
+}
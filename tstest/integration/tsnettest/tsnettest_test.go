@@ -0,0 +1,80 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tsnettest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+func TestTailnet(t *testing.T) {
+	tn := New(t, nil)
+	srv := tn.NewNode("server")
+	client := tn.NewNode("client")
+	if !srv.IPv4().Is4() || !srv.IPv6().Is6() {
+		t.Fatalf("server IPs = %v, %v", srv.IPv4(), srv.IPv6())
+	}
+
+	serve := func(port int) {
+		ln, err := srv.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			for {
+				c, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				io.WriteString(c, "hello")
+				c.Close()
+			}
+		}()
+	}
+	serve(80)
+	serve(81)
+
+	dial := func(port uint16) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		c, err := client.Dial(ctx, "tcp", netip.AddrPortFrom(srv.IPv4(), port).String())
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		b, err := io.ReadAll(c)
+		if err != nil {
+			return err
+		}
+		if string(b) != "hello" {
+			return fmt.Errorf("got %q; want %q", b, "hello")
+		}
+		return nil
+	}
+	for _, port := range []uint16{80, 81} {
+		if err := dial(port); err != nil {
+			t.Fatalf("dial port %d with default ACL: %v", port, err)
+		}
+	}
+
+	tn.SetACL([]tailcfg.FilterRule{Allow(client, srv, 80)})
+	deadline := time.Now().Add(10 * time.Second)
+	for dial(81) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("port 81 still reachable after ACL change")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := dial(80); err != nil {
+		t.Fatalf("dial port 80 allowed by ACL: %v", err)
+	}
+}
@@ -15,6 +15,7 @@
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcapgo"
 	"tailscale.com/types/logger"
+	"tailscale.com/util/mak"
 	"tailscale.com/util/must"
 	"tailscale.com/util/set"
 )
@@ -34,6 +35,7 @@ type Config struct {
 	networks     []*Network
 	pcapFile     string
 	blendReality bool
+	derpDown     set.Set[int] // region IDs of the fake DERP servers that are down
 }
 
 // SetPCAPFile sets the filename to write a pcap file to,
@@ -54,6 +56,16 @@ func (c *Config) SetBlendReality(v bool) {
 	c.blendReality = v
 }
 
+// SetDERPRegionDown sets whether the fake DERP server for the given region ID
+// (1 or 2) is down, refusing connections and not answering STUN.
+func (c *Config) SetDERPRegionDown(regionID int, down bool) {
+	if down {
+		mak.Set(&c.derpDown, regionID, struct{}{})
+	} else {
+		delete(c.derpDown, regionID)
+	}
+}
+
 // FirstNetwork returns the first network in the config, or nil if none.
 func (c *Config) FirstNetwork() *Network {
 	if len(c.networks) == 0 {
@@ -347,6 +359,12 @@ func (n *Network) AddService(s NetworkService) {
 // there were any configuration issues.
 func (s *Server) initFromConfig(c *Config) error {
 	netOfConf := map[*Network]*network{}
+	for id := range c.derpDown {
+		if _, ok := derpMap.Regions[id]; !ok {
+			return fmt.Errorf("unknown DERP region %d", id)
+		}
+		s.derpDown.Add(id)
+	}
 	if c.pcapFile != "" {
 		pcf, err := os.OpenFile(c.pcapFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 		if err != nil {
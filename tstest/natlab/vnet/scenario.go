@@ -0,0 +1,246 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package vnet
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Scenario is a virtual network described in YAML, as used by
+// cmd/tailscale-netsim to reproduce connectivity problems. For example:
+//
+//	networks:
+//	- name: home
+//	  wan: 2.1.1.1
+//	  lan: 192.168.1.1/24
+//	  nat: easy
+//	  services: [NAT-PMP]
+//	- name: office
+//	  wan: 2.2.2.2
+//	  lan: 10.2.0.1/16
+//	  nat: hard
+//	  latency: 80ms
+//	  loss: 0.02
+//	nodes:
+//	- name: laptop
+//	  network: home
+//	- name: server
+//	  network: office
+//	  env:
+//	    TS_DEBUG_ALWAYS_USE_DERP: "true"
+//	derp:
+//	  down: [2]
+type Scenario struct {
+	// Networks are the networks, each behind its own router.
+	Networks []ScenarioNetwork `json:"networks"`
+
+	// Nodes are the nodes, each running tailscaled.
+	Nodes []ScenarioNode `json:"nodes"`
+
+	// DERP configures the fake DERP servers.
+	DERP ScenarioDERP `json:"derp,omitempty"`
+
+	// PCAPFile, if non-empty, is the file to write a pcap of all traffic to.
+	PCAPFile string `json:"pcapFile,omitempty"`
+}
+
+// ScenarioNetwork is a network in a Scenario.
+type ScenarioNetwork struct {
+	// Name is the name that nodes use to refer to the network.
+	Name string `json:"name"`
+
+	// WAN is the router's IPv4 WAN IP, if any.
+	WAN string `json:"wan,omitempty"`
+
+	// LAN is the router's IPv4 LAN IP and CIDR, such as "192.168.1.1/24".
+	// If neither LAN nor WAN6 is set, it defaults to 192.168.0.0/24.
+	LAN string `json:"lan,omitempty"`
+
+	// WAN6 is the router's IPv6 WAN IP and the CIDR delegated to the LAN,
+	// such as "2000:52::1/64", if the network has IPv6.
+	WAN6 string `json:"wan6,omitempty"`
+
+	// NAT is the type of NAT the router does: "easy" (the default),
+	// "easyaf", "hard" or "one2one".
+	NAT NAT `json:"nat,omitempty"`
+
+	// Latency is the latency added to packets sent to the network's
+	// nodes, as a Go duration such as "50ms".
+	Latency string `json:"latency,omitempty"`
+
+	// Loss is the fraction of packets sent to the network's nodes to
+	// drop, from 0 to 1.
+	Loss float64 `json:"loss,omitempty"`
+
+	// Services are the port mapping services that the router offers:
+	// "NAT-PMP", "PCP" or "UPnP".
+	Services []NetworkService `json:"services,omitempty"`
+
+	// BlackholeIPv4 is whether the router drops all IPv4 traffic to the
+	// internet.
+	BlackholeIPv4 bool `json:"blackholeIPv4,omitempty"`
+}
+
+// ScenarioNode is a node in a Scenario.
+type ScenarioNode struct {
+	// Name is the node's name, for logs.
+	Name string `json:"name"`
+
+	// Network is the name of the network the node is on.
+	Network string `json:"network"`
+
+	// Env are environment variables to set for tailscaled.
+	Env map[string]string `json:"env,omitempty"`
+
+	// HostFirewall is whether the node runs a host firewall blocking
+	// incoming connections.
+	HostFirewall bool `json:"hostFirewall,omitempty"`
+
+	// VerboseSyslog is whether the node logs verbosely to syslog.
+	VerboseSyslog bool `json:"verboseSyslog,omitempty"`
+}
+
+// ScenarioDERP configures the fake DERP servers of a Scenario.
+type ScenarioDERP struct {
+	// Down are the region IDs (1 or 2) of the DERP servers that are down.
+	Down []int `json:"down,omitempty"`
+}
+
+// ParseScenario parses a Scenario from YAML.
+func ParseScenario(b []byte) (*Scenario, error) {
+	sc := new(Scenario)
+	if err := yaml.UnmarshalStrict(b, sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// ReadScenario reads and parses the Scenario in the YAML file at path.
+func ReadScenario(path string) (*Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := ParseScenario(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// Config returns the Config for the virtual network that sc describes. The
+// nodes of the returned Config are in the same order as sc.Nodes.
+func (sc *Scenario) Config() (*Config, error) {
+	c := new(Config)
+	c.SetPCAPFile(sc.PCAPFile)
+	for _, id := range sc.DERP.Down {
+		c.SetDERPRegionDown(id, true)
+	}
+
+	nets := map[string]*Network{}
+	for i, sn := range sc.Networks {
+		if sn.Name == "" {
+			return nil, fmt.Errorf("networks[%d]: missing name", i)
+		}
+		if _, ok := nets[sn.Name]; ok {
+			return nil, fmt.Errorf("networks[%d]: duplicate name %q", i, sn.Name)
+		}
+		n, err := sn.network(c)
+		if err != nil {
+			return nil, fmt.Errorf("network %q: %w", sn.Name, err)
+		}
+		nets[sn.Name] = n
+	}
+
+	names := map[string]bool{}
+	for i, sn := range sc.Nodes {
+		if sn.Name == "" {
+			return nil, fmt.Errorf("nodes[%d]: missing name", i)
+		}
+		if names[sn.Name] {
+			return nil, fmt.Errorf("nodes[%d]: duplicate name %q", i, sn.Name)
+		}
+		names[sn.Name] = true
+		net, ok := nets[sn.Network]
+		if !ok {
+			return nil, fmt.Errorf("node %q: unknown network %q", sn.Name, sn.Network)
+		}
+		opts := []any{net}
+		for _, k := range slices.Sorted(maps.Keys(sn.Env)) {
+			opts = append(opts, TailscaledEnv{Key: k, Value: sn.Env[k]})
+		}
+		if sn.HostFirewall {
+			opts = append(opts, HostFirewall)
+		}
+		if sn.VerboseSyslog {
+			opts = append(opts, VerboseSyslog)
+		}
+		c.AddNode(opts...)
+	}
+	return c, nil
+}
+
+// network adds the network sn describes to c.
+func (sn *ScenarioNetwork) network(c *Config) (*Network, error) {
+	var opts []any
+	if sn.WAN != "" {
+		ip, err := netip.ParseAddr(sn.WAN)
+		if err != nil || !ip.Is4() {
+			return nil, fmt.Errorf("invalid wan %q; want an IPv4 address", sn.WAN)
+		}
+		opts = append(opts, sn.WAN)
+	}
+	if sn.LAN != "" {
+		p, err := netip.ParsePrefix(sn.LAN)
+		if err != nil || !p.Addr().Is4() {
+			return nil, fmt.Errorf("invalid lan %q; want an IPv4 prefix", sn.LAN)
+		}
+		opts = append(opts, sn.LAN)
+	}
+	if sn.WAN6 != "" {
+		p, err := netip.ParsePrefix(sn.WAN6)
+		if err != nil || !p.Addr().Is6() {
+			return nil, fmt.Errorf("invalid wan6 %q; want an IPv6 prefix", sn.WAN6)
+		}
+		opts = append(opts, sn.WAN6)
+	}
+	if sn.NAT != "" {
+		if _, ok := natTypes[sn.NAT]; !ok {
+			return nil, fmt.Errorf("unknown nat %q", sn.NAT)
+		}
+		opts = append(opts, sn.NAT)
+	}
+	for _, svc := range sn.Services {
+		switch svc {
+		case NATPMP, PCP, UPnP:
+		default:
+			return nil, fmt.Errorf("unknown service %q", svc)
+		}
+		opts = append(opts, svc)
+	}
+	if sn.Loss < 0 || sn.Loss > 1 {
+		return nil, fmt.Errorf("invalid loss %v; want a value from 0 to 1", sn.Loss)
+	}
+	var latency time.Duration
+	if sn.Latency != "" {
+		var err error
+		latency, err = time.ParseDuration(sn.Latency)
+		if err != nil || latency < 0 {
+			return nil, fmt.Errorf("invalid latency %q", sn.Latency)
+		}
+	}
+
+	n := c.AddNetwork(opts...)
+	n.SetLatency(latency)
+	n.SetPacketLoss(sn.Loss)
+	n.SetBlackholedIPv4(sn.BlackholeIPv4)
+	return n, nil
+}
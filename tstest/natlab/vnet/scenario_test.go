@@ -0,0 +1,131 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package vnet
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScenario(t *testing.T) {
+	const good = `
+networks:
+- name: home
+  wan: 2.1.1.1
+  lan: 192.168.1.1/24
+  nat: easy
+  services: [NAT-PMP]
+- name: office
+  wan: 2.2.2.2
+  lan: 10.2.0.1/16
+  wan6: 2000:52::1/64
+  nat: hard
+  latency: 80ms
+  loss: 0.02
+nodes:
+- name: laptop
+  network: home
+  hostFirewall: true
+- name: server
+  network: office
+  env:
+    TS_B: "2"
+    TS_A: "1"
+derp:
+  down: [2]
+`
+	sc, err := ParseScenario([]byte(good))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := sc.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.NumNodes(); got != 2 {
+		t.Fatalf("NumNodes = %d; want 2", got)
+	}
+	laptop, server := c.nodes[0], c.nodes[1]
+	if !laptop.HostFirewall() {
+		t.Errorf("laptop has no host firewall")
+	}
+	if got, want := server.Env(), []TailscaledEnv{{"TS_A", "1"}, {"TS_B", "2"}}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("server env = %v; want %v", got, want)
+	}
+	office := server.Network()
+	if office.natType != HardNAT || office.latency != 80*time.Millisecond || office.lossRate != 0.02 || !office.CanV6() {
+		t.Errorf("office network = %+v", office)
+	}
+	if !laptop.Network().svcs.Contains(NATPMP) {
+		t.Errorf("home network has no NAT-PMP")
+	}
+	s, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if !s.derpRegionDown(fakeDERP2.v4) || s.derpRegionDown(fakeDERP1.v4) {
+		t.Errorf("DERP region 2 should be down, and only it")
+	}
+
+	bad := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name:    "unknown-field",
+			yaml:    "networks:\n- name: a\n  nat: easy\n  bogus: 1\n",
+			wantErr: `unknown field "bogus"`,
+		},
+		{
+			name:    "unknown-network",
+			yaml:    "networks:\n- name: a\nnodes:\n- name: x\n  network: b\n",
+			wantErr: `node "x": unknown network "b"`,
+		},
+		{
+			name:    "duplicate-node",
+			yaml:    "networks:\n- name: a\nnodes:\n- name: x\n  network: a\n- name: x\n  network: a\n",
+			wantErr: `nodes[1]: duplicate name "x"`,
+		},
+		{
+			name:    "unknown-nat",
+			yaml:    "networks:\n- name: a\n  nat: medium\n",
+			wantErr: `network "a": unknown nat "medium"`,
+		},
+		{
+			name:    "bad-loss",
+			yaml:    "networks:\n- name: a\n  loss: 2\n",
+			wantErr: `network "a": invalid loss 2; want a value from 0 to 1`,
+		},
+		{
+			name:    "bad-latency",
+			yaml:    "networks:\n- name: a\n  latency: soon\n",
+			wantErr: `network "a": invalid latency "soon"`,
+		},
+		{
+			name:    "unknown-derp",
+			yaml:    "derp:\n  down: [7]\n",
+			wantErr: "unknown DERP region 7",
+		},
+	}
+	for _, tt := range bad {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseScenario([]byte(tt.yaml))
+			if err == nil {
+				var c *Config
+				if c, err = sc.Config(); err == nil {
+					var s *Server
+					if s, err = New(c); err == nil {
+						s.Close()
+					}
+				}
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v; want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
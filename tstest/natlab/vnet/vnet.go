@@ -340,6 +340,10 @@ func (n *network) acceptTCP(r *tcp.ForwarderRequest) {
 	}
 
 	if fakeDERP1.Match(destIP) || fakeDERP2.Match(destIP) {
+		if n.s.derpRegionDown(destIP) {
+			r.Complete(true) // sends a RST
+			return
+		}
 		if destPort == 443 {
 			ds := n.s.derps[0]
 			if fakeDERP2.Match(destIP) {
@@ -628,7 +632,8 @@ type Server struct {
 
 	optLogf func(format string, args ...any) // or nil to use log.Printf
 
-	derpIPs set.Set[netip.Addr]
+	derpIPs  set.Set[netip.Addr]
+	derpDown set.Set[int] // region IDs of the fake DERP servers that are down
 
 	nodes        []*node
 	nodeByMAC    map[MAC]*node
@@ -713,6 +718,7 @@ func New(c *Config) (*Server, error) {
 
 		blendReality: c.blendReality,
 		derpIPs:      set.Of[netip.Addr](),
+		derpDown:     set.Set[int]{},
 
 		nodeByMAC:    map[MAC]*node{},
 		networkByWAN: &bart.Table[*network]{},
@@ -938,6 +944,9 @@ func (s *Server) routeUDPPacket(up UDPPacket) {
 
 	// But certain things (like STUN) we do in-process.
 	if up.Dst.Port() == stunPort {
+		if s.derpRegionDown(up.Dst.Addr()) {
+			return
+		}
 		// TODO(bradfitz): fake latency; time.AfterFunc the response
 		if res, ok := makeSTUNReply(up); ok {
 			//log.Printf("STUN reply: %+v", res)
@@ -961,6 +970,18 @@ func (s *Server) routeUDPPacket(up UDPPacket) {
 	netw.HandleUDPPacket(up)
 }
 
+// derpRegionDown reports whether ip is the IP of a fake DERP server whose
+// region was configured to be down.
+func (s *Server) derpRegionDown(ip netip.Addr) bool {
+	switch {
+	case fakeDERP1.Match(ip):
+		return s.derpDown.Contains(1)
+	case fakeDERP2.Match(ip):
+		return s.derpDown.Contains(2)
+	}
+	return false
+}
+
 // writeEth writes a raw Ethernet frame to all (0, 1, or multiple) connected
 // clients on the network.
 //
@@ -8,6 +8,7 @@
 import (
 	"testing"
 
+	"tailscale.com/net/memnet"
 	"tailscale.com/net/netmon"
 )
 
@@ -19,3 +20,15 @@ func SkipIfNoNetwork(t testing.TB) {
 		t.Skip("skipping; test requires network but no interface is up")
 	}
 }
+
+// NewFaultyListener returns an in-memory listener at addr whose connections
+// have faults f injected, and the FaultInjector that injects them, for
+// testing code with a flaky network. Dial it with fi.WrapDial(ln.Dial) to
+// also inject dial faults. The listener is closed when t's test ends.
+func NewFaultyListener(t testing.TB, addr string, f memnet.Faults) (*memnet.Listener, *memnet.FaultInjector) {
+	fi := memnet.NewFaultInjector(f)
+	ln := memnet.Listen(addr)
+	ln.NewConn = fi.NewConn
+	t.Cleanup(func() { ln.Close() })
+	return ln, fi
+}
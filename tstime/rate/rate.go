@@ -38,10 +38,17 @@ func Every(interval time.Duration) Limit {
 // with a maximum burst size of b events.
 // Use NewLimiter to create non-zero Limiters.
 //
+// A Limiter may have a parent, created with NewChild, in which case
+// each event must also be allowed by the parent (and its parent, and so on).
+// This lets a shared budget be divided between many users, each of which is
+// additionally bounded by its own budget, such as per-client limits within a
+// per-server limit.
+//
 // [token bucket]: https://en.wikipedia.org/wiki/Token_bucket
 type Limiter struct {
 	limit  Limit
 	burst  float64
+	parent *Limiter   // or nil
 	mu     sync.Mutex // protects following fields
 	tokens float64    // number of tokens currently in bucket
 	last   mono.Time  // the last time the limiter's tokens field was updated
@@ -56,15 +63,51 @@ func NewLimiter(r Limit, b int) *Limiter {
 	return &Limiter{limit: r, burst: float64(b)}
 }
 
+// NewChild returns a new Limiter that allows events up to rate r and permits
+// bursts of at most b tokens, and that additionally only allows an event if
+// lim does. An event allowed by the child consumes a token from both the child
+// and lim; an event that either refuses consumes nothing.
+//
+// If b is zero, the child uses the burst size of lim.
+func (lim *Limiter) NewChild(r Limit, b int) *Limiter {
+	if b == 0 {
+		b = int(lim.burst)
+	}
+	child := NewLimiter(r, b)
+	child.parent = lim
+	return child
+}
+
 // Allow reports whether an event may happen now.
 func (lim *Limiter) Allow() bool {
 	return lim.allow(mono.Now())
 }
 
 func (lim *Limiter) allow(now mono.Time) bool {
-	lim.mu.Lock()
-	defer lim.mu.Unlock()
+	// Locks are always acquired from child to parent, so
+	// concurrent calls on different Limiters can't deadlock.
+	for l := lim; l != nil; l = l.parent {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	}
+
+	for l := lim; l != nil; l = l.parent {
+		if l.tokensLocked(now) < 1 {
+			return false
+		}
+	}
 
+	// Consume a token from each.
+	for l := lim; l != nil; l = l.parent {
+		l.tokens = l.tokensLocked(now) - 1
+		l.last = now
+	}
+	return true
+}
+
+// tokensLocked returns the number of tokens available in lim at now.
+// lim.mu must be held.
+func (lim *Limiter) tokensLocked(now mono.Time) float64 {
 	// If time has moved backwards, look around awkwardly and pretend nothing happened.
 	if now.Before(lim.last) {
 		lim.last = now
@@ -76,15 +119,5 @@ func (lim *Limiter) allow(now mono.Time) bool {
 	if tokens > lim.burst {
 		tokens = lim.burst
 	}
-
-	// Consume a token.
-	tokens--
-
-	// Update state.
-	ok := tokens >= 0
-	if ok {
-		lim.last = now
-		lim.tokens = tokens
-	}
-	return ok
+	return tokens
 }
@@ -103,6 +103,32 @@ func TestLimiterJumpBackwards(t *testing.T) {
 	})
 }
 
+func TestLimiterChild(t *testing.T) {
+	parent := NewLimiter(10, 3)
+	a := parent.NewChild(10, 2)
+	b := parent.NewChild(10, 0) // inherits burst of 3
+	for i, step := range []struct {
+		lim *Limiter
+		t   mono.Time
+		ok  bool
+	}{
+		{a, t0, true},
+		{a, t0, true},
+		{a, t0, false}, // a's own burst is exhausted; parent keeps its token
+		{b, t0, true},  // takes the parent's last token
+		{b, t0, false}, // parent is exhausted
+		{parent, t0, false},
+		{a, t1, true}, // one new token in each
+		{b, t1, false},
+		{b, t2, true},
+		{parent, t2, false},
+	} {
+		if ok := step.lim.allow(step.t); ok != step.ok {
+			t.Errorf("step %d: allow = %v want %v", i, ok, step.ok)
+		}
+	}
+}
+
 // Ensure that tokensFromDuration doesn't produce
 // rounding errors by truncating nanoseconds.
 // See golang.org/issues/34861.
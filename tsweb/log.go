@@ -51,6 +51,11 @@ type AccessLogRecord struct {
 	// makes it easier to correlate support requests with server logs. If a
 	// RequestID generator is not configured, RequestID will be empty.
 	RequestID RequestID `json:"request_id,omitempty"`
+	// TraceID is the W3C trace ID of the request's span, if the request was
+	// traced. It's the same trace ID that's attached as an exemplar to
+	// metrics recorded while handling the request (see
+	// tsweb/promvarz.TraceExemplar), so metrics can be correlated with logs.
+	TraceID string `json:"trace_id,omitempty"`
 }
 
 // String returns m as a JSON string.
@@ -0,0 +1,47 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package promvarz
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"tailscale.com/tsweb/tracing"
+)
+
+// TraceExemplar returns the exemplar labels linking an observation made
+// while handling ctx to its trace: the trace_id of the current span in ctx,
+// which is also logged as trace_id in tsweb's access logs. It returns nil if
+// ctx has no span.
+func TraceExemplar(ctx context.Context) prometheus.Labels {
+	sc := tracing.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": sc.TraceID.String()}
+}
+
+// AddWithExemplar adds v to c, attaching the trace of ctx as an exemplar if
+// ctx has a span and c supports exemplars.
+func AddWithExemplar(ctx context.Context, c prometheus.Counter, v float64) {
+	if ea, ok := c.(prometheus.ExemplarAdder); ok {
+		if ex := TraceExemplar(ctx); ex != nil {
+			ea.AddWithExemplar(v, ex)
+			return
+		}
+	}
+	c.Add(v)
+}
+
+// ObserveWithExemplar observes v with o, attaching the trace of ctx as an
+// exemplar if ctx has a span and o supports exemplars.
+func ObserveWithExemplar(ctx context.Context, o prometheus.Observer, v float64) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok {
+		if ex := TraceExemplar(ctx); ex != nil {
+			eo.ObserveWithExemplar(v, ex)
+			return
+		}
+	}
+	o.Observe(v)
+}
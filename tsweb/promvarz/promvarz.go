@@ -3,13 +3,25 @@
 
 // Package promvarz combines Prometheus metrics exported by our expvar converter
 // (tsweb/varz) with metrics exported by the official Prometheus client.
+//
+// [Handler] serves both in the Prometheus text format. [NewHandler] returns a
+// handler that can also serve other metrics written in the Prometheus text
+// format, such as those of util/usermetric and util/clientmetric. It
+// negotiates the OpenMetrics format with scrapers, and it can relabel
+// metrics and export exemplars.
 package promvarz
 
 import (
+	"bytes"
+	"expvar"
 	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
 	"tailscale.com/tsweb/varz"
 )
@@ -46,3 +58,119 @@ func gatherNativePrometheusMetrics(w http.ResponseWriter) error {
 	}
 	return nil
 }
+
+// Options configures a handler returned by NewHandler.
+type Options struct {
+	// Gatherers are the sources of the metrics to serve. If empty, the
+	// default Prometheus registry and the global expvars are served, as by
+	// Handler. A metric family may only come from one of them.
+	Gatherers prometheus.Gatherers
+
+	// Relabel are the relabeling rules applied to each metric before it's
+	// served, in order.
+	Relabel []RelabelConfig
+
+	// Exemplars is whether to serve the exemplars attached to metrics, such
+	// as by AddWithExemplar. Exemplars are only served in the OpenMetrics and
+	// protobuf formats. They're dropped if false.
+	Exemplars bool
+}
+
+// NewHandler returns a handler that serves the metrics gathered from the
+// sources in opts, in the format negotiated with the scraper from its Accept
+// header: OpenMetrics, the Prometheus protobuf format, or else the Prometheus
+// text format.
+//
+// Counters whose names don't end in "_total" are served with type "unknown"
+// in the OpenMetrics format, which requires that suffix. A RelabelConfig can
+// rename them if that matters.
+//
+// It returns an error if a relabeling rule is invalid.
+func NewHandler(opts Options) (http.Handler, error) {
+	rules, err := compileRelabel(opts.Relabel)
+	if err != nil {
+		return nil, err
+	}
+	g := opts.Gatherers
+	if len(g) == 0 {
+		g = prometheus.Gatherers{prometheus.DefaultGatherer, ExpvarGatherer(expvar.Do)}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mfs, err := g.Gather()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		mfs = relabel(rules, mfs)
+		if !opts.Exemplars {
+			stripExemplars(mfs)
+		}
+
+		format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+		var buf bytes.Buffer
+		enc := expfmt.NewEncoder(&buf, format)
+		for _, mf := range mfs {
+			if err := enc.Encode(mf); err != nil {
+				http.Error(w, fmt.Sprintf("could not encode metric %v: %v", mf.GetName(), err), http.StatusInternalServerError)
+				return
+			}
+		}
+		if closer, ok := enc.(expfmt.Closer); ok {
+			if err := closer.Close(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", string(format))
+		w.Write(buf.Bytes())
+	}), nil
+}
+
+// TextGatherer returns a Gatherer of the metrics that write writes in the
+// Prometheus text exposition format, such as
+// clientmetric.WritePrometheusExpositionFormat or the WritePrometheus method
+// of a usermetric.Registry.
+func TextGatherer(write func(io.Writer)) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		var buf bytes.Buffer
+		write(&buf)
+		var p expfmt.TextParser
+		m, err := p.TextToMetricFamilies(&buf)
+		if err != nil {
+			return nil, err
+		}
+		mfs := make([]*dto.MetricFamily, 0, len(m))
+		for _, mf := range m {
+			mfs = append(mfs, mf)
+		}
+		slices.SortFunc(mfs, func(a, b *dto.MetricFamily) int {
+			return strings.Compare(a.GetName(), b.GetName())
+		})
+		return mfs, nil
+	})
+}
+
+// ExpvarGatherer returns a Gatherer of the expvars visited by expvarDoFunc,
+// exported following the conventions of varz.Handler. Pass expvar.Do for the
+// global expvars.
+func ExpvarGatherer(expvarDoFunc func(f func(expvar.KeyValue))) prometheus.Gatherer {
+	return TextGatherer(func(w io.Writer) {
+		varz.WritePrometheusExpvarDo(w, expvarDoFunc)
+	})
+}
+
+// stripExemplars removes the exemplars from the metrics in mfs.
+func stripExemplars(mfs []*dto.MetricFamily) {
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			if c := m.Counter; c != nil {
+				c.Exemplar = nil
+			}
+			if h := m.Histogram; h != nil {
+				for _, b := range h.Bucket {
+					b.Exemplar = nil
+				}
+			}
+		}
+	}
+}
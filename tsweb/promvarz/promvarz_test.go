@@ -3,15 +3,19 @@
 package promvarz
 
 import (
+	"context"
 	"expvar"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	"tailscale.com/tsweb/tracing"
 )
 
 var (
@@ -36,3 +40,127 @@ func TestHandler(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestNewHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_requests_total",
+		Help: "Requests.",
+	}, []string{"code", "path"})
+	reg.MustRegister(requests)
+	requests.WithLabelValues("200", "/a").Add(2)
+	requests.WithLabelValues("500", "/a").Add(1)
+
+	ctx := tracing.ContextWithRemoteSpanContext(context.Background(), tracing.SpanContext{
+		TraceID: tracing.TraceID{1},
+		SpanID:  tracing.SpanID{2},
+		Sampled: true,
+	})
+	AddWithExemplar(ctx, requests.WithLabelValues("200", "/b"), 1)
+
+	text := TextGatherer(func(w io.Writer) {
+		io.WriteString(w, "# TYPE test_text_gauge gauge\ntest_text_gauge 7\n")
+	})
+
+	tests := []struct {
+		name   string
+		opts   Options
+		accept string
+		want   string
+	}{
+		{
+			name: "text",
+			opts: Options{Gatherers: prometheus.Gatherers{reg, text}},
+			want: `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{code="200",path="/a"} 2
+test_requests_total{code="200",path="/b"} 1
+test_requests_total{code="500",path="/a"} 1
+# TYPE test_text_gauge gauge
+test_text_gauge 7
+`,
+		},
+		{
+			name:   "openmetrics-no-exemplars",
+			opts:   Options{Gatherers: prometheus.Gatherers{reg}},
+			accept: "application/openmetrics-text;version=1.0.0",
+			want: `# HELP test_requests Requests.
+# TYPE test_requests counter
+test_requests_total{code="200",path="/a"} 2.0
+test_requests_total{code="200",path="/b"} 1.0
+test_requests_total{code="500",path="/a"} 1.0
+# EOF
+`,
+		},
+		{
+			name:   "openmetrics-exemplars",
+			opts:   Options{Gatherers: prometheus.Gatherers{reg}, Exemplars: true},
+			accept: "application/openmetrics-text;version=1.0.0",
+			want: `# HELP test_requests Requests.
+# TYPE test_requests counter
+test_requests_total{code="200",path="/a"} 2.0
+test_requests_total{code="200",path="/b"} 1.0 # {trace_id="01000000000000000000000000000000"} 1.0 <timestamp>
+test_requests_total{code="500",path="/a"} 1.0
+# EOF
+`,
+		},
+		{
+			name: "relabel",
+			opts: Options{
+				Gatherers: prometheus.Gatherers{reg, text},
+				Relabel: []RelabelConfig{
+					{SourceLabels: []string{"code"}, Regex: "5..", Action: RelabelDrop},
+					{SourceLabels: []string{"__name__"}, Regex: "test_(.*)", Replacement: ptr("ts_$1"), TargetLabel: "__name__"},
+					{Regex: "path", Action: RelabelLabelDrop},
+					{TargetLabel: "env", Replacement: ptr("prod")},
+				},
+			},
+			want: `# HELP ts_requests_total Requests.
+# TYPE ts_requests_total counter
+ts_requests_total{code="200",env="prod"} 2
+ts_requests_total{code="200",env="prod"} 1
+# TYPE ts_text_gauge gauge
+ts_text_gauge{env="prod"} 7
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHandler(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != 200 {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			got := exemplarTimestamp.ReplaceAllString(rec.Body.String(), "} $1 <timestamp>")
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHandlerInvalidRelabel(t *testing.T) {
+	for _, rc := range []RelabelConfig{
+		{Regex: "(", TargetLabel: "x"},
+		{TargetLabel: "not a label"},
+		{Action: RelabelKeep},
+		{Action: "hashmod"},
+	} {
+		if _, err := NewHandler(Options{Relabel: []RelabelConfig{rc}}); err == nil {
+			t.Errorf("NewHandler with %+v succeeded; want error", rc)
+		}
+	}
+}
+
+// exemplarTimestamp matches the value and timestamp of an exemplar.
+var exemplarTimestamp = regexp.MustCompile(`\} (\S+) \S+e\+09`)
+
+func ptr[T any](v T) *T { return &v }
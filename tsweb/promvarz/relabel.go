@@ -0,0 +1,196 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package promvarz
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// RelabelAction is the action of a RelabelConfig.
+type RelabelAction string
+
+const (
+	// RelabelReplace sets TargetLabel to Replacement, with $1 and so on
+	// replaced by the groups matched by Regex, if Regex matches the source
+	// labels. An empty result removes TargetLabel.
+	RelabelReplace RelabelAction = "replace"
+	// RelabelKeep drops the metric unless Regex matches the source labels.
+	RelabelKeep RelabelAction = "keep"
+	// RelabelDrop drops the metric if Regex matches the source labels.
+	RelabelDrop RelabelAction = "drop"
+	// RelabelLabelDrop removes the labels whose names match Regex.
+	RelabelLabelDrop RelabelAction = "labeldrop"
+	// RelabelLabelKeep removes the labels whose names don't match Regex.
+	RelabelLabelKeep RelabelAction = "labelkeep"
+)
+
+// RelabelConfig is a rule for rewriting the labels of metrics before they're
+// served. It follows the semantics of Prometheus's relabel_config, for the
+// subset of actions defined by RelabelAction, so that relabeling that would
+// otherwise be configured in the scraper can be done by the target instead.
+//
+// The metric name is the "__name__" label. For histograms and summaries, it's
+// the name of the metric family, without a "_bucket", "_sum" or "_count"
+// suffix.
+type RelabelConfig struct {
+	// SourceLabels are the labels whose values, joined by Separator, are
+	// matched against Regex by the replace, keep and drop actions.
+	SourceLabels []string `json:"source_labels,omitempty"`
+	// Separator joins the values of SourceLabels. The default is ";".
+	Separator string `json:"separator,omitempty"`
+	// Regex is the regular expression to match, which must match the whole
+	// value or label name. The default is "(.*)".
+	Regex string `json:"regex,omitempty"`
+	// TargetLabel is the label set by the replace action.
+	TargetLabel string `json:"target_label,omitempty"`
+	// Replacement is the value that the replace action sets TargetLabel to.
+	// The default is "$1".
+	Replacement *string `json:"replacement,omitempty"`
+	// Action is what to do. The default is RelabelReplace.
+	Action RelabelAction `json:"action,omitempty"`
+}
+
+// relabelRule is a compiled RelabelConfig.
+type relabelRule struct {
+	RelabelConfig
+	re *regexp.Regexp
+}
+
+// compileRelabel validates and compiles cfgs.
+func compileRelabel(cfgs []RelabelConfig) ([]relabelRule, error) {
+	rules := make([]relabelRule, 0, len(cfgs))
+	for i, c := range cfgs {
+		c.Separator = cmp.Or(c.Separator, ";")
+		c.Regex = cmp.Or(c.Regex, "(.*)")
+		c.Action = cmp.Or(c.Action, RelabelReplace)
+		if c.Replacement == nil {
+			c.Replacement = new(string)
+			*c.Replacement = "$1"
+		}
+		re, err := regexp.Compile("^(?:" + c.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: invalid regex: %w", i, err)
+		}
+		switch c.Action {
+		case RelabelReplace:
+			if !model.LabelName(c.TargetLabel).IsValid() {
+				return nil, fmt.Errorf("relabel rule %d: invalid target label %q", i, c.TargetLabel)
+			}
+		case RelabelKeep, RelabelDrop:
+			if len(c.SourceLabels) == 0 {
+				return nil, fmt.Errorf("relabel rule %d: %s requires source labels", i, c.Action)
+			}
+		case RelabelLabelDrop, RelabelLabelKeep:
+		default:
+			return nil, fmt.Errorf("relabel rule %d: unknown action %q", i, c.Action)
+		}
+		rules = append(rules, relabelRule{c, re})
+	}
+	return rules, nil
+}
+
+// apply applies r to the labels in ls. It reports false if the metric
+// should be dropped.
+func (r *relabelRule) apply(ls map[string]string) bool {
+	switch r.Action {
+	case RelabelReplace, RelabelKeep, RelabelDrop:
+		vals := make([]string, len(r.SourceLabels))
+		for i, l := range r.SourceLabels {
+			vals[i] = ls[l]
+		}
+		val := strings.Join(vals, r.Separator)
+		m := r.re.FindStringSubmatchIndex(val)
+		switch r.Action {
+		case RelabelKeep:
+			return m != nil
+		case RelabelDrop:
+			return m == nil
+		}
+		if m == nil {
+			return true
+		}
+		res := string(r.re.ExpandString(nil, *r.Replacement, val, m))
+		if res == "" {
+			delete(ls, r.TargetLabel)
+		} else {
+			ls[r.TargetLabel] = res
+		}
+	case RelabelLabelDrop, RelabelLabelKeep:
+		for l := range ls {
+			if l == model.MetricNameLabel {
+				continue
+			}
+			if r.re.MatchString(l) == (r.Action == RelabelLabelDrop) {
+				delete(ls, l)
+			}
+		}
+	}
+	return true
+}
+
+// relabel applies rules to the metrics in mfs and returns the resulting
+// metric families, sorted by name. Metrics renamed into an existing family
+// of a different type are dropped, as are metrics left with an invalid name.
+func relabel(rules []relabelRule, mfs []*dto.MetricFamily) []*dto.MetricFamily {
+	if len(rules) == 0 {
+		return mfs
+	}
+	byName := map[string]*dto.MetricFamily{}
+	ls := map[string]string{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			clear(ls)
+			ls[model.MetricNameLabel] = mf.GetName()
+			for _, lp := range m.Label {
+				ls[lp.GetName()] = lp.GetValue()
+			}
+			keep := true
+			for i := range rules {
+				if keep = rules[i].apply(ls); !keep {
+					break
+				}
+			}
+			name := ls[model.MetricNameLabel]
+			if !keep || !model.IsValidMetricName(model.LabelValue(name)) {
+				continue
+			}
+			out, ok := byName[name]
+			if !ok {
+				out = &dto.MetricFamily{
+					Name: &name,
+					Help: mf.Help,
+					Type: mf.Type,
+				}
+				byName[name] = out
+			} else if out.GetType() != mf.GetType() {
+				continue
+			}
+			m.Label = m.Label[:0]
+			for k, v := range ls {
+				if k != model.MetricNameLabel {
+					m.Label = append(m.Label, &dto.LabelPair{Name: &k, Value: &v})
+				}
+			}
+			slices.SortFunc(m.Label, func(a, b *dto.LabelPair) int {
+				return strings.Compare(a.GetName(), b.GetName())
+			})
+			out.Metric = append(out.Metric, m)
+		}
+	}
+	ret := make([]*dto.MetricFamily, 0, len(byName))
+	for _, mf := range byName {
+		ret = append(ret, mf)
+	}
+	slices.SortFunc(ret, func(a, b *dto.MetricFamily) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+	return ret
+}
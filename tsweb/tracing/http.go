@@ -0,0 +1,174 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// Extract returns a copy of ctx with the remote span context from h's
+// traceparent header, if h has a valid one.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	if sc, ok := ParseTraceparent(h.Get(TraceparentHeader)); ok {
+		return ContextWithRemoteSpanContext(ctx, sc)
+	}
+	return ctx
+}
+
+// Inject sets h's traceparent header from the current span in ctx, if
+// any.
+func Inject(ctx context.Context, h http.Header) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		h.Set(TraceparentHeader, sc.Traceparent())
+	}
+}
+
+// StartHTTPServer starts a server span named name for r, continuing the
+// trace from r's traceparent header if present. It returns r with the span
+// in its context. The caller must call EndHTTP on the returned Span.
+func (t *Tracer) StartHTTPServer(r *http.Request, name string) (*http.Request, *Span) {
+	ctx, s := t.Start(Extract(r.Context(), r.Header), name, KindServer)
+	s.SetAttr("http.request.method", r.Method)
+	s.SetAttr("url.path", r.URL.Path)
+	s.SetAttr("server.address", r.Host)
+	if ua := r.UserAgent(); ua != "" {
+		s.SetAttr("user_agent.original", ua)
+	}
+	return r.WithContext(ctx), s
+}
+
+// EndHTTP records the HTTP response status code of a span started with
+// StartHTTPServer or by Transport, marks server errors as failures, and
+// ends the span.
+func (s *Span) EndHTTP(code int, errMsg string) {
+	s.SetAttr("http.response.status_code", code)
+	switch {
+	case errMsg != "" && code >= 500:
+		s.SetError(errMsg)
+	case code >= 500:
+		s.SetError(strconv.Itoa(code) + " " + http.StatusText(code))
+	}
+	s.End()
+}
+
+// Handler returns an http.Handler that traces each request handled by h
+// in a server span. spanName returns the name of the span for a request;
+// it should have low cardinality, such as the route rather than the path.
+//
+// If the default Tracer is nil when a request arrives, the request isn't
+// traced.
+func Handler(h http.Handler, spanName func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := Default()
+		if t == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		r, s := t.StartHTTPServer(r, spanName(r))
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			code := sw.code
+			switch {
+			case sw.hijacked:
+				code = http.StatusSwitchingProtocols
+			case code == 0:
+				code = http.StatusOK
+			}
+			s.EndHTTP(code, "")
+		}()
+		h.ServeHTTP(sw, r)
+	})
+}
+
+// statusWriter is an http.ResponseWriter that records the response status.
+type statusWriter struct {
+	http.ResponseWriter
+	code     int
+	hijacked bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("ResponseWriter does not implement http.Hijacker")
+	}
+	c, brw, err := h.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return c, brw, err
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Transport returns an http.RoundTripper that traces each request made
+// with base in a client span, and propagates the trace context to the
+// server in the traceparent header. If base is nil,
+// http.DefaultTransport is used.
+//
+// If the default Tracer is nil, only any existing trace context in the
+// request's context is propagated.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripper{base}
+}
+
+type roundTripper struct {
+	base http.RoundTripper
+}
+
+func (rt roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	t := Default()
+	ctx := r.Context()
+	var s *Span
+	if t != nil {
+		ctx, s = t.Start(ctx, "HTTP "+r.Method, KindClient)
+		s.SetAttr("http.request.method", r.Method)
+		s.SetAttr("server.address", r.URL.Host)
+		s.SetAttr("url.path", r.URL.Path)
+	}
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		// RoundTrippers must not modify the request.
+		r = r.Clone(ctx)
+		r.Header.Set(TraceparentHeader, sc.Traceparent())
+	}
+	res, err := rt.base.RoundTrip(r)
+	if s != nil {
+		if err != nil {
+			s.SetError(err.Error())
+			s.End()
+		} else {
+			s.EndHTTP(res.StatusCode, "")
+		}
+	}
+	return res, err
+}
@@ -0,0 +1,246 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"tailscale.com/types/logger"
+)
+
+const (
+	exportQueueSize = 2048
+	exportBatchSize = 512
+	exportInterval  = 5 * time.Second
+	exportTimeout   = 10 * time.Second
+)
+
+// exporter batches ended spans and sends them to an OTLP/HTTP endpoint
+// using the JSON encoding.
+type exporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	logf        logger.Logf
+	httpc       *http.Client
+
+	queue     chan *Span
+	done      chan struct{} // closed when run returns
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+}
+
+func newExporter(cfg Config) *exporter {
+	e := &exporter{
+		endpoint:    cfg.Endpoint,
+		headers:     cfg.Headers,
+		serviceName: cfg.ServiceName,
+		logf:        logger.WithPrefix(cfg.Logf, "tracing: "),
+		httpc:       &http.Client{Timeout: exportTimeout},
+		queue:       make(chan *Span, exportQueueSize),
+		done:        make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *exporter) enqueue(s *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.queue <- s:
+	default:
+		e.dropped++
+	}
+}
+
+func (e *exporter) close() error {
+	e.closeOnce.Do(func() {
+		e.mu.Lock()
+		e.closed = true
+		close(e.queue)
+		e.mu.Unlock()
+	})
+	<-e.done
+	return nil
+}
+
+func (e *exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			e.logf("exporting %d spans: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s, ok := <-e.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			e.mu.Lock()
+			if e.dropped > 0 {
+				e.logf("dropped %d spans; export queue full", e.dropped)
+				e.dropped = 0
+			}
+			e.mu.Unlock()
+		}
+	}
+}
+
+// The following types are the subset of the OTLP/JSON trace data model
+// that's used by the exporter.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              Kind           `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 2 is STATUS_CODE_ERROR
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 as a decimal string, per OTLP/JSON
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func otlpAttr(key string, val any) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	switch v := val.(type) {
+	case string:
+		kv.Value.StringValue = &v
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		kv.Value.IntValue = &s
+	case float64:
+		kv.Value.DoubleValue = &v
+	case bool:
+		kv.Value.BoolValue = &v
+	}
+	return kv
+}
+
+func (s *Span) toOTLP() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := otlpSpan{
+		TraceID:           s.sc.TraceID.String(),
+		SpanID:            s.sc.SpanID.String(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	if s.parent.IsValid() {
+		out.ParentSpanID = s.parent.String()
+	}
+	for _, a := range s.attrs {
+		out.Attributes = append(out.Attributes, otlpAttr(a.key, a.val))
+	}
+	if s.errMsg != "" {
+		out.Status = &otlpStatus{Code: 2, Message: s.errMsg}
+	}
+	return out
+}
+
+func (e *exporter) export(batch []*Span) error {
+	ss := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(batch))}
+	ss.Scope.Name = "tailscale.com/tsweb/tracing"
+	for _, s := range batch {
+		ss.Spans = append(ss.Spans, s.toOTLP())
+	}
+	body, err := json.Marshal(otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource:   otlpResource{Attributes: []otlpKeyValue{otlpAttr("service.name", e.serviceName)}},
+			ScopeSpans: []otlpScopeSpans{ss},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	res, err := e.httpc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("HTTP %v: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package tracing implements lightweight OpenTelemetry-compatible
+// distributed tracing for Tailscale's HTTP servers.
+//
+// Trace context is propagated using the W3C Trace Context traceparent
+// header, and spans are exported to an OpenTelemetry collector using OTLP
+// over HTTP with JSON encoding. The default tracer is configured from the
+// standard OTEL_* environment variables; see [ConfigFromEnv].
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tailscale.com/envknob"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/ctxkey"
+)
+
+// TraceID is a W3C Trace Context trace ID.
+type TraceID [16]byte
+
+// IsValid reports whether id is non-zero.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID is a W3C Trace Context span (parent) ID.
+type SpanID [8]byte
+
+// IsValid reports whether id is non-zero.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext identifies a span and carries the state that's propagated
+// to other processes.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether sc has both a trace ID and a span ID.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// TraceparentHeader is the W3C Trace Context HTTP header.
+const TraceparentHeader = "Traceparent"
+
+// Traceparent returns sc in the W3C traceparent header format.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+// It reports false if s isn't a valid version 00 (or later) traceparent.
+func ParseTraceparent(s string) (sc SpanContext, ok bool) {
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	if len(s) < 55 || (len(s) > 55 && s[55] != '-') {
+		return SpanContext{}, false
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return SpanContext{}, false
+	}
+	version := s[:2]
+	if version == "ff" || (version == "00" && len(s) != 55) {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(s[3:35])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(s[36:52])); err != nil {
+		return SpanContext{}, false
+	}
+	flags, err := strconv.ParseUint(s[53:55], 16, 8)
+	if err != nil || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags&1 != 0
+	return sc, true
+}
+
+// Kind is the kind of a span, as defined by OpenTelemetry.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Config configures a Tracer.
+type Config struct {
+	// Endpoint is the full URL of the OTLP/HTTP traces endpoint, such as
+	// "http://localhost:4318/v1/traces". If empty, spans are created and
+	// trace context is propagated, but nothing is exported.
+	Endpoint string
+
+	// Headers are extra HTTP headers to send with exports, such as for
+	// authentication.
+	Headers map[string]string
+
+	// ServiceName is the service.name resource attribute.
+	// If empty, the program's name is used.
+	ServiceName string
+
+	// SampleRatio is the fraction of new traces that are sampled, from 0
+	// to 1. Spans with a remote parent follow the parent's decision.
+	SampleRatio float64
+
+	// Logf, if non-nil, is used to log export failures.
+	Logf logger.Logf
+}
+
+// ConfigFromEnv returns a Config from the standard OpenTelemetry
+// environment variables OTEL_EXPORTER_OTLP_TRACES_ENDPOINT,
+// OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS,
+// OTEL_SERVICE_NAME, and OTEL_TRACES_SAMPLER_ARG.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Endpoint:    envknob.String("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"),
+		ServiceName: envknob.String("OTEL_SERVICE_NAME"),
+		SampleRatio: 1,
+	}
+	if cfg.Endpoint == "" {
+		if base := envknob.String("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			cfg.Endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	for _, kv := range strings.Split(envknob.String("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			if cfg.Headers == nil {
+				cfg.Headers = map[string]string{}
+			}
+			cfg.Headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	if v := envknob.String("OTEL_TRACES_SAMPLER_ARG"); v != "" {
+		if r, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.SampleRatio = r
+		}
+	}
+	return cfg
+}
+
+// Tracer creates spans and exports the sampled ones.
+type Tracer struct {
+	sampleThreshold uint64    // sample new traces whose low trace ID bits are below this
+	exp             *exporter // or nil if not exporting
+}
+
+// New returns a new Tracer. The caller should call Close when done with
+// it to flush pending spans.
+func New(cfg Config) *Tracer {
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = filepath.Base(os.Args[0])
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = logger.Discard
+	}
+	t := &Tracer{}
+	switch r := cfg.SampleRatio; {
+	case r >= 1:
+		t.sampleThreshold = math.MaxUint64
+	case r > 0:
+		t.sampleThreshold = uint64(r * math.MaxUint64)
+	}
+	if cfg.Endpoint != "" {
+		t.exp = newExporter(cfg)
+	}
+	return t
+}
+
+// Close flushes any pending spans and stops exporting.
+func (t *Tracer) Close() error {
+	if t == nil || t.exp == nil {
+		return nil
+	}
+	return t.exp.close()
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultTracer atomic.Pointer[Tracer]
+)
+
+// Default returns the process-wide default Tracer, or nil if tracing
+// isn't enabled. Unless SetDefault has been called, the first call
+// creates it from the environment (see [ConfigFromEnv]) if an OTLP
+// endpoint is configured.
+func Default() *Tracer {
+	defaultOnce.Do(func() {
+		if cfg := ConfigFromEnv(); cfg.Endpoint != "" {
+			defaultTracer.CompareAndSwap(nil, New(cfg))
+		}
+	})
+	return defaultTracer.Load()
+}
+
+// SetDefault sets the process-wide default Tracer, overriding any
+// configuration from the environment. A nil t disables tracing.
+func SetDefault(t *Tracer) {
+	defaultOnce.Do(func() {})
+	defaultTracer.Store(t)
+}
+
+var (
+	spanCtxKey   = ctxkey.New[*Span]("tailscale.com/tsweb/tracing.span", nil)
+	remoteCtxKey = ctxkey.New[SpanContext]("tailscale.com/tsweb/tracing.remote", SpanContext{})
+)
+
+// SpanFromContext returns the current span in ctx, or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	return spanCtxKey.Value(ctx)
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx in which sc, received
+// from another process, is the parent of new spans.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return remoteCtxKey.WithValue(ctx, sc)
+}
+
+// SpanContextFromContext returns the context of the current span in ctx,
+// or of the remote parent if there's no local span.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc
+	}
+	return remoteCtxKey.Value(ctx)
+}
+
+// Start starts a new span that's a child of the current span in ctx, if
+// any, and returns a context containing it. The caller must call End on
+// the returned Span.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+	s := &Span{
+		t:     t,
+		name:  name,
+		kind:  kind,
+		start: time.Now(),
+	}
+	if parent.IsValid() {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.parent = parent.SpanID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+		s.sc.Sampled = binary.BigEndian.Uint64(s.sc.TraceID[8:]) < t.sampleThreshold || t.sampleThreshold == math.MaxUint64
+	}
+	rand.Read(s.sc.SpanID[:])
+	return spanCtxKey.WithValue(ctx, s), s
+}
+
+// Span is a single operation within a trace.
+type Span struct {
+	t      *Tracer
+	sc     SpanContext
+	parent SpanID // or zero for a root span
+	name   string
+	kind   Kind
+	start  time.Time
+
+	mu     sync.Mutex
+	ended  bool
+	end    time.Time
+	attrs  []attr
+	errMsg string // non-empty if the span failed
+}
+
+type attr struct {
+	key string
+	val any // string, int64, float64, or bool
+}
+
+// Context returns the span's SpanContext.
+func (s *Span) Context() SpanContext { return s.sc }
+
+// SetAttr sets an attribute on the span. Values other than strings,
+// integers, floats, and bools are formatted with fmt.Sprint.
+func (s *Span) SetAttr(key string, val any) {
+	switch v := val.(type) {
+	case string, int64, float64, bool:
+	case int:
+		val = int64(v)
+	default:
+		val = fmt.Sprint(v)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.attrs {
+		if s.attrs[i].key == key {
+			s.attrs[i].val = val
+			return
+		}
+	}
+	s.attrs = append(s.attrs, attr{key, val})
+}
+
+// SetError marks the span as failed with the given error message.
+func (s *Span) SetError(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errMsg = msg
+}
+
+// End ends the span and, if it's sampled, queues it for export.
+// Subsequent calls do nothing.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.sc.Sampled && s.t.exp != nil {
+		s.t.exp.enqueue(s)
+	}
+}
+
+// ConfigureDefault sets the default Tracer from the environment (see
+// [ConfigFromEnv]), with the OTLP endpoint overridden by endpoint if it's
+// non-empty, such as from a command-line flag. Export failures are logged
+// to logf. It returns the new default Tracer, which the caller should
+// close on exit, or nil if no endpoint is configured.
+func ConfigureDefault(endpoint string, logf logger.Logf) *Tracer {
+	cfg := ConfigFromEnv()
+	if endpoint != "" {
+		cfg.Endpoint = endpoint
+	}
+	cfg.Logf = logf
+	if cfg.Endpoint == "" {
+		SetDefault(nil)
+		return nil
+	}
+	t := New(cfg)
+	SetDefault(t)
+	return t
+}
@@ -0,0 +1,153 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(tp)
+	if !ok {
+		t.Fatalf("ParseTraceparent(%q) failed", tp)
+	}
+	if got := sc.TraceID.String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("TraceID = %v", got)
+	}
+	if got := sc.SpanID.String(); got != "00f067aa0ba902b7" {
+		t.Errorf("SpanID = %v", got)
+	}
+	if !sc.Sampled {
+		t.Errorf("Sampled = false")
+	}
+	if got := sc.Traceparent(); got != tp {
+		t.Errorf("Traceparent() = %q; want %q", got, tp)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("ParseTraceparent(%q) succeeded; want failure", bad)
+		}
+	}
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future"); !ok {
+		t.Errorf("ParseTraceparent of future version with extra fields failed")
+	}
+}
+
+func TestStartChild(t *testing.T) {
+	tr := New(Config{SampleRatio: 0})
+	ctx, root := tr.Start(context.Background(), "root", KindInternal)
+	if root.Context().Sampled {
+		t.Errorf("root sampled with SampleRatio 0")
+	}
+	_, child := tr.Start(ctx, "child", KindInternal)
+	if child.Context().TraceID != root.Context().TraceID {
+		t.Errorf("child has different trace ID")
+	}
+	if child.parent != root.Context().SpanID {
+		t.Errorf("child parent = %v; want %v", child.parent, root.Context().SpanID)
+	}
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, s := tr.Start(ContextWithRemoteSpanContext(context.Background(), remote), "server", KindServer)
+	if s.Context().TraceID != remote.TraceID || s.parent != remote.SpanID || !s.Context().Sampled {
+		t.Errorf("span didn't continue remote trace: %+v", s.Context())
+	}
+}
+
+func TestExportAndPropagate(t *testing.T) {
+	exported := make(chan otlpRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding export: %v", err)
+		}
+		exported <- req
+	}))
+	defer collector.Close()
+
+	tr := New(Config{Endpoint: collector.URL, ServiceName: "test", SampleRatio: 1})
+	SetDefault(tr)
+	defer SetDefault(nil)
+
+	gotTraceparent := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent <- r.Header.Get(TraceparentHeader)
+	}))
+	defer backend.Close()
+
+	hc := &http.Client{Transport: Transport(nil)}
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", backend.URL, nil)
+		res, err := hc.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		w.WriteHeader(http.StatusTeapot)
+	}), func(*http.Request) string { return "test" })
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("GET", "/foo", nil)
+	req.Header.Set(TraceparentHeader, incoming)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	outgoing, ok := ParseTraceparent(<-gotTraceparent)
+	if !ok || outgoing.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("outgoing traceparent didn't continue the trace: %+v", outgoing)
+	}
+
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var got otlpRequest
+	select {
+	case got = <-exported:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for export")
+	}
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected export: %+v", got)
+	}
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans; want 2", len(spans))
+	}
+	client, server := spans[0], spans[1]
+	if client.Kind != KindClient || server.Kind != KindServer {
+		t.Errorf("span kinds = %v, %v; want client then server", client.Kind, server.Kind)
+	}
+	if server.ParentSpanID != "00f067aa0ba902b7" || client.ParentSpanID != server.SpanID {
+		t.Errorf("unexpected parents: server=%q client=%q", server.ParentSpanID, client.ParentSpanID)
+	}
+	if client.SpanID != outgoing.SpanID.String() {
+		t.Errorf("propagated span ID %v isn't the client span %v", outgoing.SpanID, client.SpanID)
+	}
+	var status string
+	for _, a := range server.Attributes {
+		if a.Key == "http.response.status_code" && a.Value.IntValue != nil {
+			status = *a.Value.IntValue
+		}
+	}
+	if status != "418" {
+		t.Errorf("server status attribute = %q; want 418", status)
+	}
+}
@@ -31,6 +31,7 @@
 	"tailscale.com/envknob"
 	"tailscale.com/metrics"
 	"tailscale.com/net/tsaddr"
+	"tailscale.com/tsweb/tracing"
 	"tailscale.com/tsweb/varz"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/ctxkey"
@@ -502,6 +503,13 @@ func (h logHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		fn(r, msg)
 	}
 
+	var span *tracing.Span
+	if t := tracing.Default(); t != nil {
+		r, span = t.StartHTTPServer(r, r.Method)
+		ctx = r.Context()
+		msg.TraceID = span.Context().TraceID.String()
+	}
+
 	// Let errorHandler tell us what error it wrote to the client.
 	r = r.WithContext(errCallback.WithValue(ctx, func(e HTTPError) {
 		// Keep the deepest error.
@@ -539,13 +547,18 @@ func (h logHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				msg.Err += "\n\nthen " + panic2err(recovered).Error()
 			}
 		}
-		h.logRequest(r, lw, msg)
+		msg = h.logRequest(r, lw, msg)
+		if span != nil {
+			span.EndHTTP(msg.Code, msg.Err)
+		}
 	}()
 
 	h.h.ServeHTTP(lw, r)
 }
 
-func (h logHandler) logRequest(r *http.Request, lw *loggingResponseWriter, msg AccessLogRecord) {
+// logRequest completes msg from lw, logs it, and records metrics.
+// It returns the completed record.
+func (h logHandler) logRequest(r *http.Request, lw *loggingResponseWriter, msg AccessLogRecord) AccessLogRecord {
 	// Complete our access log from the loggingResponseWriter.
 	msg.Bytes = lw.bytes
 	msg.Seconds = h.opts.Now().Sub(msg.Time).Seconds()
@@ -588,6 +601,7 @@ func (h logHandler) logRequest(r *http.Request, lw *loggingResponseWriter, msg A
 	if h.opts.StatusCodeCountersFull != nil {
 		h.opts.StatusCodeCountersFull.Add(responseCodeString(msg.Code), 1)
 	}
+	return msg
 }
 
 func responseCodeString(code int) string {
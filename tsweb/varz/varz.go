@@ -288,19 +288,24 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 func ExpvarDoHandler(expvarDoFunc func(f func(expvar.KeyValue))) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain;version=0.0.4;charset=utf-8")
+		WritePrometheusExpvarDo(w, expvarDoFunc)
+	}
+}
 
-		s := sortedKVsPool.Get().(*sortedKVs)
-		defer sortedKVsPool.Put(s)
-		s.kvs = s.kvs[:0]
-		expvarDoFunc(func(kv expvar.KeyValue) {
-			s.kvs = append(s.kvs, sortedKV{kv, removeTypePrefixes(kv.Key)})
-		})
-		sort.Slice(s.kvs, func(i, j int) bool {
-			return s.kvs[i].sortKey < s.kvs[j].sortKey
-		})
-		for _, e := range s.kvs {
-			writePromExpVar(w, "", e.KeyValue)
-		}
+// WritePrometheusExpvarDo writes the expvar values visited by expvarDoFunc to
+// w in Prometheus format, following the conventions described at Handler.
+func WritePrometheusExpvarDo(w io.Writer, expvarDoFunc func(f func(expvar.KeyValue))) {
+	s := sortedKVsPool.Get().(*sortedKVs)
+	defer sortedKVsPool.Put(s)
+	s.kvs = s.kvs[:0]
+	expvarDoFunc(func(kv expvar.KeyValue) {
+		s.kvs = append(s.kvs, sortedKV{kv, removeTypePrefixes(kv.Key)})
+	})
+	sort.Slice(s.kvs, func(i, j int) bool {
+		return s.kvs[i].sortKey < s.kvs[j].sortKey
+	})
+	for _, e := range s.kvs {
+		writePromExpVar(w, "", e.KeyValue)
 	}
 }
 
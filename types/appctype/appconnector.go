@@ -64,7 +64,9 @@ type AppConnectorAttr struct {
 	// Name is the name of this collection of domains.
 	Name string `json:"name,omitempty"`
 	// Domains enumerates the domains serviced by the specified app connectors.
-	// Domains can be of the form: example.com, or *.example.com.
+	// Domains can be of the form: example.com, *.example.com, a glob such as
+	// api-*.example.com, or a regular expression between slashes such as
+	// /edge[0-9]+\.example\.com/.
 	Domains []string `json:"domains,omitempty"`
 	// Routes enumerates the predetermined routes to be advertised by the specified app connectors.
 	Routes []netip.Prefix `json:"routes,omitempty"`
@@ -72,4 +74,9 @@ type AppConnectorAttr struct {
 	// These can either be "*" to match any advertising connector, or a
 	// tag of the form tag:<tag-name>.
 	Connectors []string `json:"connectors,omitempty"`
+	// RouteTTL, if set, is a duration such as "24h" after which a route
+	// learned for one of Domains is removed, once DNS responses for the
+	// domain no longer include it. If empty, learned routes are kept for as
+	// long as the domain is configured.
+	RouteTTL string `json:"routeTTL,omitempty"`
 }
@@ -1,7 +1,8 @@
 // Copyright (c) Tailscale Inc & AUTHORS
 // SPDX-License-Identifier: BSD-3-Clause
 
-// Package bools contains the bools.Compare function.
+// Package bools contains helpers for booleans: the bools.Compare function and
+// the atomic bools.Flags set.
 package bools
 
 // Compare compares two boolean values as if false is ordered before true.
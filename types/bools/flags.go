@@ -0,0 +1,94 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package bools
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+	"sync/atomic"
+)
+
+// Flags is a set of up to 32 boolean flags that can be read and modified
+// atomically, such as a cluster of related atomic.Bool fields. Each flag is a
+// bit of a value of T, which is usually a named type with a constant for each
+// flag:
+//
+//	type myFlag uint32
+//
+//	const (
+//		flagFoo myFlag = 1 << iota
+//		flagBar
+//	)
+//
+// If T implements [fmt.Stringer], its String method is used to format the
+// names of individual flags.
+//
+// The zero value has no flags set. A Flags must not be copied after first
+// use.
+type Flags[T ~uint32] struct {
+	v atomic.Uint32
+}
+
+// Load returns the flags that are set.
+func (f *Flags[T]) Load() T {
+	return T(f.v.Load())
+}
+
+// Store sets exactly the flags in v, clearing all others.
+func (f *Flags[T]) Store(v T) {
+	f.v.Store(uint32(v))
+}
+
+// Test reports whether all the flags in mask are set.
+func (f *Flags[T]) Test(mask T) bool {
+	return T(f.v.Load())&mask == mask
+}
+
+// Set sets the flags in mask and returns the flags that were set before.
+func (f *Flags[T]) Set(mask T) (old T) {
+	return T(f.v.Or(uint32(mask)))
+}
+
+// Clear clears the flags in mask and returns the flags that were set before.
+func (f *Flags[T]) Clear(mask T) (old T) {
+	return T(f.v.And(^uint32(mask)))
+}
+
+// SetTo sets the flags in mask if on is true, or clears them otherwise, and
+// returns the flags that were set before.
+func (f *Flags[T]) SetTo(mask T, on bool) (old T) {
+	if on {
+		return f.Set(mask)
+	}
+	return f.Clear(mask)
+}
+
+// String returns the flags that are set, separated by "|", or "0" if none
+// are.
+func (f *Flags[T]) String() string {
+	return FormatFlags(f.Load())
+}
+
+// FormatFlags formats the flags set in v, separated by "|", or "0" if none
+// are. Individual flags are formatted with the String method of T, if it has
+// one, or in hexadecimal otherwise.
+func FormatFlags[T ~uint32](v T) string {
+	if v == 0 {
+		return "0"
+	}
+	var sb strings.Builder
+	for rest := uint32(v); rest != 0; rest &= rest - 1 {
+		if sb.Len() > 0 {
+			sb.WriteByte('|')
+		}
+		bit := T(1) << bits.TrailingZeros32(rest)
+		if s, ok := any(bit).(fmt.Stringer); ok {
+			sb.WriteString(s.String())
+		} else {
+			fmt.Fprintf(&sb, "%#x", uint32(bit))
+		}
+	}
+	return sb.String()
+}
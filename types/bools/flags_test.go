@@ -0,0 +1,81 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package bools
+
+import (
+	"sync"
+	"testing"
+)
+
+type testFlag uint32
+
+const (
+	flagA testFlag = 1 << iota
+	flagB
+	flagC
+)
+
+func (f testFlag) String() string {
+	switch f {
+	case flagA:
+		return "a"
+	case flagB:
+		return "b"
+	}
+	return FormatFlags(uint32(f))
+}
+
+func TestFlags(t *testing.T) {
+	var f Flags[testFlag]
+	if f.Load() != 0 || f.Test(flagA) || f.String() != "0" {
+		t.Fatalf("zero value has flags set: %v", f.String())
+	}
+	if old := f.Set(flagA | flagC); old != 0 {
+		t.Errorf("Set: old = %v, want 0", old)
+	}
+	if !f.Test(flagA) || !f.Test(flagA|flagC) || f.Test(flagA|flagB) {
+		t.Errorf("Test is wrong after Set: %v", f.String())
+	}
+	if got, want := f.String(), "a|0x4"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	if old := f.Clear(flagA | flagB); old != flagA|flagC {
+		t.Errorf("Clear: old = %v, want a|0x4", old)
+	}
+	if got := f.Load(); got != flagC {
+		t.Errorf("Load after Clear = %v, want 0x4", got)
+	}
+	if old := f.SetTo(flagB, true); old != flagC || !f.Test(flagB) {
+		t.Errorf("SetTo(true): old = %v, now %v", old, f.String())
+	}
+	if old := f.SetTo(flagB, false); old != flagB|flagC || f.Test(flagB) {
+		t.Errorf("SetTo(false): old = %v, now %v", old, f.String())
+	}
+	f.Store(flagA | flagB)
+	if got, want := f.String(), "a|b"; got != want {
+		t.Errorf("String after Store = %q, want %q", got, want)
+	}
+	if got, want := FormatFlags(uint32(0x81)), "0x1|0x80"; got != want {
+		t.Errorf("FormatFlags = %q, want %q", got, want)
+	}
+
+	// Concurrent changes to different flags don't interfere.
+	f.Store(0)
+	var wg sync.WaitGroup
+	for _, flag := range []testFlag{flagA, flagB, flagC} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				f.Set(flag)
+				f.Clear(flag)
+			}
+			f.Set(flag)
+		}()
+	}
+	wg.Wait()
+	if got := f.Load(); got != flagA|flagB|flagC {
+		t.Errorf("after concurrent changes, flags = %v, want all", got)
+	}
+}
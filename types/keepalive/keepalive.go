@@ -0,0 +1,116 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package keepalive resolves the disco heartbeat and WireGuard persistent
+// keepalive intervals to use for each peer from the intervals configured per
+// class of peers.
+package keepalive
+
+import (
+	"maps"
+	"strings"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+// Intervals are the keepalive intervals of a peer. For each field, zero
+// means the default and a negative value means disabled.
+type Intervals struct {
+	// DiscoHeartbeat is how often disco heartbeats are sent on the
+	// current direct path to the peer while it is active.
+	DiscoHeartbeat time.Duration
+
+	// IdleHeartbeat is how often disco heartbeats are sent on the current
+	// direct path to the peer while it is idle. By default, they are not.
+	IdleHeartbeat time.Duration
+
+	// WireGuardKeepalive is the WireGuard persistent keepalive interval of
+	// the peer. By default, persistent keepalives are disabled.
+	WireGuardKeepalive time.Duration
+}
+
+// Config are keepalive intervals by peer class. The zero value leaves the
+// defaults in place for all peers.
+type Config struct {
+	classes map[string]tailcfg.KeepaliveIntervals // keyed by class
+}
+
+// NewConfig returns the Config of the given layers of intervals, such as
+// those delivered by control and then those set in local prefs. The non-zero
+// fields of later intervals override those of earlier intervals for the same
+// class. Intervals of unknown classes are ignored.
+func NewConfig(layers ...[]tailcfg.KeepaliveIntervals) Config {
+	var c Config
+	for _, layer := range layers {
+		for _, ki := range layer {
+			if !validClass(ki.Class) {
+				continue
+			}
+			if c.classes == nil {
+				c.classes = make(map[string]tailcfg.KeepaliveIntervals)
+			}
+			cur := c.classes[ki.Class]
+			cur.Class = ki.Class
+			if ki.DiscoHeartbeatSeconds != 0 {
+				cur.DiscoHeartbeatSeconds = ki.DiscoHeartbeatSeconds
+			}
+			if ki.WireGuardKeepaliveSeconds != 0 {
+				cur.WireGuardKeepaliveSeconds = ki.WireGuardKeepaliveSeconds
+			}
+			c.classes[ki.Class] = cur
+		}
+	}
+	return c
+}
+
+func validClass(class string) bool {
+	switch class {
+	case tailcfg.KeepaliveClassDefault, tailcfg.KeepaliveClassMobile,
+		tailcfg.KeepaliveClassServer, tailcfg.KeepaliveClassIdle:
+		return true
+	}
+	return false
+}
+
+// IsZero reports whether c leaves the defaults in place for all peers.
+func (c Config) IsZero() bool { return len(c.classes) == 0 }
+
+// Equal reports whether c and c2 are the same configuration.
+func (c Config) Equal(c2 Config) bool { return maps.Equal(c.classes, c2.classes) }
+
+// ClassOf returns the class of peer while it is active: KeepaliveClassMobile,
+// KeepaliveClassServer or KeepaliveClassDefault.
+func ClassOf(peer tailcfg.NodeView) string {
+	var os string
+	if hi := peer.Hostinfo(); hi.Valid() {
+		os = hi.OS()
+	}
+	switch {
+	case strings.EqualFold(os, "iOS"), strings.EqualFold(os, "android"):
+		return tailcfg.KeepaliveClassMobile
+	case peer.IsTagged():
+		return tailcfg.KeepaliveClassServer
+	}
+	return tailcfg.KeepaliveClassDefault
+}
+
+// ForPeer returns the keepalive intervals of peer.
+func (c Config) ForPeer(peer tailcfg.NodeView) Intervals {
+	if c.IsZero() {
+		return Intervals{}
+	}
+	active := c.classes[ClassOf(peer)]
+	return Intervals{
+		DiscoHeartbeat:     seconds(active.DiscoHeartbeatSeconds),
+		IdleHeartbeat:      seconds(c.classes[tailcfg.KeepaliveClassIdle].DiscoHeartbeatSeconds),
+		WireGuardKeepalive: seconds(active.WireGuardKeepaliveSeconds),
+	}
+}
+
+func seconds(n int) time.Duration {
+	if n < 0 {
+		return -1
+	}
+	return time.Duration(n) * time.Second
+}
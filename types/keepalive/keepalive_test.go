@@ -0,0 +1,76 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package keepalive
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+func TestConfig(t *testing.T) {
+	control := []tailcfg.KeepaliveIntervals{
+		{Class: "mobile", DiscoHeartbeatSeconds: 30, WireGuardKeepaliveSeconds: 60},
+		{Class: "server", WireGuardKeepaliveSeconds: 25},
+		{Class: "idle", DiscoHeartbeatSeconds: 120},
+		{Class: "toaster", DiscoHeartbeatSeconds: 1},
+	}
+	local := []tailcfg.KeepaliveIntervals{
+		{Class: "mobile", WireGuardKeepaliveSeconds: -1},
+		{Class: "default", DiscoHeartbeatSeconds: -1},
+	}
+	c := NewConfig(control, local)
+	if c.IsZero() {
+		t.Fatal("config is zero")
+	}
+	if _, ok := c.classes["toaster"]; ok {
+		t.Error("unknown class was not ignored")
+	}
+
+	peer := func(os string, tags ...string) tailcfg.NodeView {
+		return (&tailcfg.Node{Hostinfo: (&tailcfg.Hostinfo{OS: os}).View(), Tags: tags}).View()
+	}
+	tests := []struct {
+		name string
+		peer tailcfg.NodeView
+		want Intervals
+	}{
+		{
+			name: "mobile",
+			peer: peer("iOS", "tag:phone"),
+			want: Intervals{DiscoHeartbeat: 30 * time.Second, IdleHeartbeat: 2 * time.Minute, WireGuardKeepalive: -1},
+		},
+		{
+			name: "server",
+			peer: peer("linux", "tag:server"),
+			want: Intervals{IdleHeartbeat: 2 * time.Minute, WireGuardKeepalive: 25 * time.Second},
+		},
+		{
+			name: "default",
+			peer: peer("windows"),
+			want: Intervals{DiscoHeartbeat: -1, IdleHeartbeat: 2 * time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.ForPeer(tt.peer); got != tt.want {
+				t.Errorf("ForPeer = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if !NewConfig(control, local).Equal(c) {
+		t.Error("identical configs are not equal")
+	}
+	if NewConfig(control).Equal(c) {
+		t.Error("different configs are equal")
+	}
+	if got := c.ForPeer((&tailcfg.Node{}).View()); got.DiscoHeartbeat != -1 {
+		t.Errorf("peer without Hostinfo: ForPeer = %+v, want the default class", got)
+	}
+	if !NewConfig().IsZero() || NewConfig().ForPeer(peer("android")) != (Intervals{}) {
+		t.Error("empty config does not leave the defaults in place")
+	}
+}
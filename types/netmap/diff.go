@@ -0,0 +1,248 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netmap
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"strings"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/views"
+)
+
+// ChangeKind is the kind of a [Change] between two NetworkMaps.
+type ChangeKind string
+
+const (
+	PeerAdded   ChangeKind = "peer-added"
+	PeerRemoved ChangeKind = "peer-removed"
+
+	// The following kinds are changes to a node, which is either a peer
+	// or, if Change.Self is set, this node.
+	NodeKeyRotated       ChangeKind = "key-rotated"
+	DiscoKeyChanged      ChangeKind = "disco-key-changed"
+	EndpointsChanged     ChangeKind = "endpoints-changed"
+	AddressesChanged     ChangeKind = "addresses-changed"
+	RoutesChanged        ChangeKind = "routes-changed" // AllowedIPs other than the addresses, or PrimaryRoutes
+	HomeDERPChanged      ChangeKind = "home-derp-changed"
+	OnlineChanged        ChangeKind = "online-changed"
+	NameChanged          ChangeKind = "name-changed"
+	TagsChanged          ChangeKind = "tags-changed"
+	KeyExpiryChanged     ChangeKind = "key-expiry-changed"
+	CapabilitiesChanged  ChangeKind = "capabilities-changed"
+	PacketFilterChanged  ChangeKind = "packet-filter-changed"
+	DNSConfigChanged     ChangeKind = "dns-changed"
+	DERPMapChanged       ChangeKind = "derp-map-changed"
+	SSHPolicyChanged     ChangeKind = "ssh-policy-changed"
+	ControlHealthChanged ChangeKind = "control-health-changed"
+)
+
+// Change is a single difference between two NetworkMaps, as returned by
+// [Diff].
+type Change struct {
+	Kind ChangeKind
+
+	// Self is whether the change is to this node rather than to a peer.
+	Self bool `json:",omitempty"`
+
+	// Node and Name identify the node that changed, if any: its ID and
+	// its DNS name (or the name of its machine, if it has none).
+	Node tailcfg.NodeID `json:",omitempty"`
+	Name string         `json:",omitempty"`
+
+	// Old and New describe the changed value before and after the change,
+	// if it can be summarized, such as a list of endpoints.
+	Old string `json:",omitempty"`
+	New string `json:",omitempty"`
+}
+
+// String returns a human-readable summary of c, such as
+// "peer foo.example.ts.net: endpoints changed from [1.2.3.4:41641] to [5.6.7.8:41641]".
+func (c Change) String() string {
+	var sb strings.Builder
+	switch {
+	case c.Self:
+		sb.WriteString("self")
+	case c.Node != 0:
+		fmt.Fprintf(&sb, "peer %s (%d)", c.Name, c.Node)
+	default:
+		sb.WriteString("netmap")
+	}
+	sb.WriteString(": ")
+	switch c.Kind {
+	case PeerAdded:
+		sb.WriteString("added")
+	case PeerRemoved:
+		sb.WriteString("removed")
+	default:
+		sb.WriteString(strings.ReplaceAll(string(c.Kind), "-", " "))
+	}
+	if c.Old != "" || c.New != "" {
+		fmt.Fprintf(&sb, " from %s to %s", orNone(c.Old), orNone(c.New))
+	}
+	return sb.String()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// Diff returns the changes from the NetworkMap old to new, either of which
+// may be nil. Changes to the netmap as a whole come first, followed by those
+// to this node, and then those to peers in order of their node IDs.
+func Diff(old, new *NetworkMap) []Change {
+	if old == nil {
+		old = &NetworkMap{}
+	}
+	if new == nil {
+		new = &NetworkMap{}
+	}
+	var changes []Change
+	add := func(c Change) { changes = append(changes, c) }
+
+	if !reflect.DeepEqual(old.PacketFilterRules.AsSlice(), new.PacketFilterRules.AsSlice()) {
+		add(Change{Kind: PacketFilterChanged})
+	}
+	if !reflect.DeepEqual(old.DNS, new.DNS) {
+		add(Change{Kind: DNSConfigChanged})
+	}
+	if !reflect.DeepEqual(old.DERPMap, new.DERPMap) {
+		add(Change{Kind: DERPMapChanged})
+	}
+	if !reflect.DeepEqual(old.SSHPolicy, new.SSHPolicy) {
+		add(Change{Kind: SSHPolicyChanged})
+	}
+	if !reflect.DeepEqual(old.ControlHealth, new.ControlHealth) {
+		add(Change{Kind: ControlHealthChanged, Old: strings.Join(old.ControlHealth, "; "), New: strings.Join(new.ControlHealth, "; ")})
+	}
+
+	if old.SelfNode.Valid() && new.SelfNode.Valid() {
+		for _, c := range diffNode(old.SelfNode, new.SelfNode) {
+			c.Self = true
+			add(c)
+		}
+	}
+
+	// Peers are sorted by node ID, so walk both lists in step.
+	i, j := 0, 0
+	for i < len(old.Peers) || j < len(new.Peers) {
+		switch {
+		case j == len(new.Peers) || i < len(old.Peers) && old.Peers[i].ID() < new.Peers[j].ID():
+			p := old.Peers[i]
+			add(Change{Kind: PeerRemoved, Node: p.ID(), Name: nodeName(p)})
+			i++
+		case i == len(old.Peers) || new.Peers[j].ID() < old.Peers[i].ID():
+			p := new.Peers[j]
+			add(Change{Kind: PeerAdded, Node: p.ID(), Name: nodeName(p)})
+			j++
+		default:
+			changes = append(changes, diffNode(old.Peers[i], new.Peers[j])...)
+			i++
+			j++
+		}
+	}
+	return changes
+}
+
+// nodeName returns the name by which to identify n in a Change.
+func nodeName(n tailcfg.NodeView) string {
+	if name := strings.TrimSuffix(n.Name(), "."); name != "" {
+		return name
+	}
+	if hi := n.Hostinfo(); hi.Valid() && hi.Hostname() != "" {
+		return hi.Hostname()
+	}
+	return string(n.StableID())
+}
+
+// diffNode returns the changes from a to b, two versions of the same node.
+func diffNode(a, b tailcfg.NodeView) []Change {
+	var changes []Change
+	id, name := b.ID(), nodeName(b)
+	add := func(kind ChangeKind, old, new string) {
+		changes = append(changes, Change{Kind: kind, Node: id, Name: name, Old: old, New: new})
+	}
+
+	if a.Key() != b.Key() {
+		add(NodeKeyRotated, a.Key().ShortString(), b.Key().ShortString())
+	}
+	if a.DiscoKey() != b.DiscoKey() {
+		add(DiscoKeyChanged, a.DiscoKey().ShortString(), b.DiscoKey().ShortString())
+	}
+	if a.KeyExpiry() != b.KeyExpiry() {
+		add(KeyExpiryChanged, formatTime(a.KeyExpiry()), formatTime(b.KeyExpiry()))
+	}
+	if a.Name() != b.Name() {
+		add(NameChanged, strings.TrimSuffix(a.Name(), "."), strings.TrimSuffix(b.Name(), "."))
+	}
+	if !views.SliceEqualAnyOrder(a.Endpoints(), b.Endpoints()) {
+		add(EndpointsChanged, formatSlice(a.Endpoints()), formatSlice(b.Endpoints()))
+	}
+	if !views.SliceEqualAnyOrder(a.Addresses(), b.Addresses()) {
+		add(AddressesChanged, formatSlice(a.Addresses()), formatSlice(b.Addresses()))
+	}
+	if ar, br := routes(a), routes(b); !views.SliceEqualAnyOrder(ar, br) ||
+		!views.SliceEqualAnyOrder(a.PrimaryRoutes(), b.PrimaryRoutes()) {
+		old, new := formatSlice(ar), formatSlice(br)
+		if old == new {
+			old = "primary " + formatSlice(a.PrimaryRoutes())
+			new = "primary " + formatSlice(b.PrimaryRoutes())
+		}
+		add(RoutesChanged, old, new)
+	}
+	if a.DERP() != b.DERP() {
+		add(HomeDERPChanged, a.DERP(), b.DERP())
+	}
+	if ao, bo := a.Online(), b.Online(); (ao == nil) != (bo == nil) || ao != nil && *ao != *bo {
+		add(OnlineChanged, formatOnline(ao), formatOnline(bo))
+	}
+	if !views.SliceEqualAnyOrder(a.Tags(), b.Tags()) {
+		add(TagsChanged, formatSlice(a.Tags()), formatSlice(b.Tags()))
+	}
+	if !views.SliceEqualAnyOrder(a.Capabilities(), b.Capabilities()) || !reflect.DeepEqual(a.CapMap().AsMap(), b.CapMap().AsMap()) {
+		add(CapabilitiesChanged, "", "")
+	}
+	return changes
+}
+
+// routes returns the AllowedIPs of n other than its own addresses.
+func routes(n tailcfg.NodeView) views.Slice[netip.Prefix] {
+	var r []netip.Prefix
+	for _, p := range n.AllowedIPs().All() {
+		if !views.SliceContains(n.Addresses(), p) {
+			r = append(r, p)
+		}
+	}
+	return views.SliceOf(r)
+}
+
+func formatSlice[T any](s views.Slice[T]) string {
+	if s.Len() == 0 {
+		return ""
+	}
+	return fmt.Sprint(s.AsSlice())
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatOnline(online *bool) string {
+	switch {
+	case online == nil:
+		return "unknown"
+	case *online:
+		return "online"
+	}
+	return "offline"
+}
@@ -0,0 +1,93 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package netmap
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/ptr"
+)
+
+func TestDiff(t *testing.T) {
+	pfx := netip.MustParsePrefix
+	peer := func(id tailcfg.NodeID, name string, mod func(*tailcfg.Node)) *tailcfg.Node {
+		n := &tailcfg.Node{
+			ID:         id,
+			Name:       name + ".example.ts.net.",
+			Key:        testNodeKey(byte(id)),
+			Addresses:  []netip.Prefix{pfx("100.64.0.1/32")},
+			AllowedIPs: []netip.Prefix{pfx("100.64.0.1/32")},
+			Endpoints:  eps("192.0.2.1:41641"),
+			DERP:       "127.3.3.40:1",
+			Online:     ptr.To(true),
+		}
+		if mod != nil {
+			mod(n)
+		}
+		return n
+	}
+	old := &NetworkMap{
+		SelfNode: peer(1, "self", nil).View(),
+		Peers: nodeViews([]*tailcfg.Node{
+			peer(2, "a", nil),
+			peer(3, "b", nil),
+			peer(5, "d", nil),
+		}),
+	}
+	new := &NetworkMap{
+		SelfNode: peer(1, "self", func(n *tailcfg.Node) {
+			n.Endpoints = eps("192.0.2.1:41641", "198.51.100.1:41641")
+		}).View(),
+		Peers: nodeViews([]*tailcfg.Node{
+			peer(3, "b", func(n *tailcfg.Node) {
+				n.Key = testNodeKey(33)
+				n.AllowedIPs = append(n.AllowedIPs, pfx("10.0.0.0/8"))
+				n.DERP = "127.3.3.40:2"
+				n.Online = ptr.To(false)
+			}),
+			peer(4, "c", nil),
+			peer(5, "d", nil),
+		}),
+		ControlHealth: []string{"bad"},
+	}
+
+	got := Diff(old, new)
+	want := []Change{
+		{Kind: ControlHealthChanged, New: "bad"},
+		{Kind: EndpointsChanged, Self: true, Node: 1, Name: "self.example.ts.net", Old: "[192.0.2.1:41641]", New: "[192.0.2.1:41641 198.51.100.1:41641]"},
+		{Kind: PeerRemoved, Node: 2, Name: "a.example.ts.net"},
+		{Kind: NodeKeyRotated, Node: 3, Name: "b.example.ts.net", Old: testNodeKey(3).ShortString(), New: testNodeKey(33).ShortString()},
+		{Kind: RoutesChanged, Node: 3, Name: "b.example.ts.net", New: "[10.0.0.0/8]"},
+		{Kind: HomeDERPChanged, Node: 3, Name: "b.example.ts.net", Old: "127.3.3.40:1", New: "127.3.3.40:2"},
+		{Kind: OnlineChanged, Node: 3, Name: "b.example.ts.net", Old: "online", New: "offline"},
+		{Kind: PeerAdded, Node: 4, Name: "c.example.ts.net"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff:\n got: %+v\nwant: %+v", got, want)
+	}
+
+	if got := Diff(new, new); len(got) != 0 {
+		t.Errorf("Diff of identical netmaps = %v, want none", got)
+	}
+	if got := Diff(nil, old); len(got) != 3 || got[0].Kind != PeerAdded {
+		t.Errorf("Diff from nil = %v, want all peers added", got)
+	}
+
+	for _, tt := range []struct {
+		c    Change
+		want string
+	}{
+		{want[0], "netmap: control health changed from none to bad"},
+		{want[1], "self: endpoints changed from [192.0.2.1:41641] to [192.0.2.1:41641 198.51.100.1:41641]"},
+		{want[2], "peer a.example.ts.net (2): removed"},
+		{want[6], "peer b.example.ts.net (3): online changed from online to offline"},
+	} {
+		if got := tt.c.String(); got != tt.want {
+			t.Errorf("String = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -299,6 +299,26 @@ func ExcludeFields[T any](fields ...string) Option {
 	return newFieldFilter[T](false, fields)
 }
 
+// ExcludeTaggedFields returns an option that modifies the hashing for T to
+// include all struct fields of T except those whose struct tag has the value
+// "-" for key, such as the fields tagged `json:"-"` for the key "json".
+//
+// T must be a struct type, and must match the type of the value passed to
+// HasherForType.
+func ExcludeTaggedFields[T any](key string) Option {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("ExcludeTaggedFields requires a struct type, not %v", t))
+	}
+	fieldSet := set.Set[string]{}
+	for i := range t.NumField() {
+		if sf := t.Field(i); sf.Tag.Get(key) == "-" {
+			fieldSet.Add(sf.Name)
+		}
+	}
+	return fieldFilterOpt{t, fieldSet, false}
+}
+
 func newFieldFilter[T any](include bool, fields []string) Option {
 	t := reflect.TypeFor[T]()
 	fieldSet := set.Set[string]{}
@@ -321,28 +341,8 @@ func newFieldFilter[T any](include bool, fields []string) Option {
 // when combined.
 func HasherForType[T any](opts ...Option) func(*T) Sum {
 	seedOnce.Do(initSeed)
-	if len(opts) > 1 {
-		panic("HasherForType only accepts one optional argument") // for now
-	}
 	t := reflect.TypeFor[T]()
-	var hash typeHasherFunc
-	for _, o := range opts {
-		switch o := o.(type) {
-		default:
-			panic(fmt.Sprintf("unknown HasherOpt %T", o))
-		case fieldFilterOpt:
-			if t.Kind() != reflect.Struct {
-				panic("HasherForStructTypeWithFieldFilter requires T of kind struct")
-			}
-			if t != o.t {
-				panic(fmt.Sprintf("field filter for type %v does not match HasherForType type %v", o.t, t))
-			}
-			hash = makeStructHasher(t, o.filterStructField)
-		}
-	}
-	if hash == nil {
-		hash = lookupTypeHasher(t)
-	}
+	hash := typeHasherWithOptions(t, opts)
 	return func(v *T) (s Sum) {
 		// This logic is identical to Hash, but pull out a few statements.
 		h := hasherPool.Get().(*hasher)
@@ -362,6 +362,29 @@ func HasherForType[T any](opts ...Option) func(*T) Sum {
 	}
 }
 
+// typeHasherWithOptions returns the hasher for t modified by opts, as
+// documented on HasherForType.
+func typeHasherWithOptions(t reflect.Type, opts []Option) typeHasherFunc {
+	if len(opts) > 1 {
+		panic("HasherForType only accepts one optional argument") // for now
+	}
+	for _, o := range opts {
+		switch o := o.(type) {
+		default:
+			panic(fmt.Sprintf("unknown HasherOpt %T", o))
+		case fieldFilterOpt:
+			if t.Kind() != reflect.Struct {
+				panic("HasherForStructTypeWithFieldFilter requires T of kind struct")
+			}
+			if t != o.t {
+				panic(fmt.Sprintf("field filter for type %v does not match HasherForType type %v", o.t, t))
+			}
+			return makeStructHasher(t, o.filterStructField)
+		}
+	}
+	return lookupTypeHasher(t)
+}
+
 // Update sets last to the hash of v and reports whether its value changed.
 func Update[T any](last *Sum, v *T) (changed bool) {
 	sum := Hash(v)
@@ -1127,6 +1127,125 @@ type T struct {
 	}
 }
 
+func TestExcludeTaggedFields(t *testing.T) {
+	type tagged struct {
+		A int
+		B int `json:"-"`
+		C int `json:"c"`
+		D int `json:"-" deephash:"-"`
+	}
+	hashJSON := HasherForType[tagged](ExcludeTaggedFields[tagged]("json"))
+	hashDeephash := HasherForType[tagged](ExcludeTaggedFields[tagged]("deephash"))
+
+	tests := []struct {
+		name  string
+		hash  func(*tagged) Sum
+		a, b  tagged
+		equal bool
+	}{
+		{"json-excluded", hashJSON, tagged{1, 0, 1, 0}, tagged{1, 1, 1, 1}, true},
+		{"json-named", hashJSON, tagged{1, 1, 1, 1}, tagged{1, 1, 0, 1}, false},
+		{"json-untagged", hashJSON, tagged{1, 1, 1, 1}, tagged{0, 1, 1, 1}, false},
+		{"other-key-excluded", hashDeephash, tagged{1, 1, 1, 0}, tagged{1, 1, 1, 1}, true},
+		{"other-key-ignores-json", hashDeephash, tagged{1, 0, 1, 1}, tagged{1, 1, 1, 1}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.hash(&tt.a) == tt.hash(&tt.b); got != tt.equal {
+			t.Errorf("%s: hash(%+v) == hash(%+v) is %v, want %v", tt.name, tt.a, tt.b, got, tt.equal)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	type T struct {
+		A int
+		B []string
+	}
+	digest := func(vs ...*T) Sum {
+		var d Digest
+		for _, v := range vs {
+			Add(&d, v)
+		}
+		return d.Sum()
+	}
+	a, b := &T{1, []string{"a"}}, &T{2, nil}
+	if digest(a, b) != digest(&T{1, []string{"a"}}, &T{2, nil}) {
+		t.Error("equal streams hash differently")
+	}
+	if digest(a, b) == digest(b, a) {
+		t.Error("reordered streams hash the same")
+	}
+	if digest(a, b) == digest(a, nil) || digest(a) == digest(a, nil) {
+		t.Error("different streams hash the same")
+	}
+
+	var d Digest
+	Add(&d, a)
+	partial := d.Sum()
+	Add(&d, b)
+	if d.Sum() != digest(a, b) || partial != digest(a) {
+		t.Error("Sum of an unfinished stream affected the hash")
+	}
+	d.Reset()
+	Add(&d, b)
+	if d.Sum() != digest(b) {
+		t.Error("Reset did not start a new stream")
+	}
+	var s string
+	Add(&d, &s)
+	if d.Sum() == digest(b) {
+		t.Error("value of a different type did not change the hash")
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	type T struct {
+		A int
+		B int `json:"-"`
+	}
+	hashOf := func(m map[int]*T) Sum {
+		inc := NewIncremental[int, T]()
+		for k, v := range m {
+			inc.Set(k, v)
+		}
+		return inc.Sum()
+	}
+	inc := NewIncremental[int, T]()
+	empty := inc.Sum()
+	if !inc.Set(1, &T{A: 1}) || !inc.Set(2, &T{A: 2}) || !inc.Set(3, nil) {
+		t.Error("Set of new keys did not change the hash")
+	}
+	if inc.Set(1, &T{A: 1}) {
+		t.Error("Set of an unchanged value changed the hash")
+	}
+	if got, want := inc.Sum(), hashOf(map[int]*T{3: nil, 2: {A: 2}, 1: {A: 1}}); got != want {
+		t.Error("hash depends on the order of Set")
+	}
+	if !inc.Set(2, &T{A: 3}) {
+		t.Error("Set of a changed value did not change the hash")
+	}
+	if got, want := inc.Sum(), hashOf(map[int]*T{1: {A: 1}, 2: {A: 3}, 3: nil}); got != want {
+		t.Error("hash after changing a value differs from that of a new collection")
+	}
+	if !inc.Delete(3) || inc.Delete(3) || inc.Len() != 2 {
+		t.Error("Delete did not delete once")
+	}
+	inc.Delete(1)
+	inc.Delete(2)
+	if inc.Sum() != empty {
+		t.Error("hash after deleting all values differs from that of an empty collection")
+	}
+	if NewIncremental[string, T]().Sum() == empty {
+		t.Error("empty collections of different types hash the same")
+	}
+
+	filtered := NewIncremental[int, T](ExcludeTaggedFields[T]("json"))
+	filtered.Set(1, &T{A: 1, B: 1})
+	if filtered.Set(1, &T{A: 1, B: 2}) {
+		t.Error("change to an excluded field changed the hash")
+	}
+}
+
 func BenchmarkAppendTo(b *testing.B) {
 	b.ReportAllocs()
 	v := getVal()
@@ -0,0 +1,136 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package deephash
+
+import (
+	"reflect"
+)
+
+// Digest computes the hash of a stream of values added to it one at a time
+// with [Add], so that a large structure can be hashed in pieces, for example
+// while iterating over it, without first assembling it into a single value.
+// The hash depends on the type, value and order of each value added.
+//
+// The zero value is ready to use. A Digest is not safe for concurrent use.
+type Digest struct {
+	h       hasher
+	started bool
+}
+
+func (d *Digest) start() {
+	if !d.started {
+		seedOnce.Do(initSeed)
+		d.h.reset()
+		d.h.HashUint64(seed)
+		d.started = true
+	}
+}
+
+// Add adds the value v to the stream of values hashed by d.
+func Add[T any](d *Digest, v *T) {
+	d.start()
+	t := reflect.TypeFor[T]()
+	d.h.hashType(t)
+	if v == nil {
+		d.h.HashUint8(0) // indicates nil
+	} else {
+		d.h.HashUint8(1) // indicates visiting pointer element
+		lookupTypeHasher(t)(&d.h, pointerOf(reflect.ValueOf(v)))
+	}
+}
+
+// Sum returns the hash of the values added to d so far. More values may be
+// added afterwards.
+func (d *Digest) Sum() Sum {
+	d.start()
+	return d.h.sum()
+}
+
+// Reset resets d to hash a new stream of values.
+func (d *Digest) Reset() {
+	d.started = false
+}
+
+// Incremental maintains the hash of a collection of values identified by
+// keys, such as the peers of a network map by node ID. Setting or deleting a
+// value only hashes that value, rather than the whole collection, so the hash
+// of a large collection that changes a little at a time is cheap to keep up to
+// date. Like the hash of a map, the hash doesn't depend on the order in which
+// values were set.
+//
+// An Incremental is not safe for concurrent use.
+type Incremental[K comparable, V any] struct {
+	hashKey, hashValue typeHasherFunc
+	sums               map[K]Sum // of each entry
+	sum                Sum       // XOR of sums
+}
+
+// NewIncremental returns a new, empty Incremental. The values are hashed in
+// the same way as by the hasher returned by HasherForType[V](opts...), and
+// the same restrictions apply to opts.
+func NewIncremental[K comparable, V any](opts ...Option) *Incremental[K, V] {
+	seedOnce.Do(initSeed)
+	return &Incremental[K, V]{
+		hashKey:   lookupTypeHasher(reflect.TypeFor[K]()),
+		hashValue: typeHasherWithOptions(reflect.TypeFor[V](), opts),
+		sums:      make(map[K]Sum),
+	}
+}
+
+// Set sets the value of k to v, which may be nil, and reports whether that
+// changed the hash.
+func (m *Incremental[K, V]) Set(k K, v *V) (changed bool) {
+	h := hasherPool.Get().(*hasher)
+	defer hasherPool.Put(h)
+	h.reset()
+	h.HashUint64(seed)
+	m.hashKey(h, pointerOf(reflect.ValueOf(&k)))
+	if v == nil {
+		h.HashUint8(0) // indicates nil
+	} else {
+		h.HashUint8(1) // indicates visiting pointer element
+		m.hashValue(h, pointerOf(reflect.ValueOf(v)))
+	}
+	sum := h.sum()
+
+	old, ok := m.sums[k]
+	if ok && old == sum {
+		return false
+	}
+	if ok {
+		m.sum.xor(old)
+	}
+	m.sum.xor(sum)
+	m.sums[k] = sum
+	return true
+}
+
+// Delete deletes the value of k, if any, and reports whether that changed
+// the hash.
+func (m *Incremental[K, V]) Delete(k K) (changed bool) {
+	old, ok := m.sums[k]
+	if !ok {
+		return false
+	}
+	m.sum.xor(old)
+	delete(m.sums, k)
+	return true
+}
+
+// Len returns the number of keys that have a value.
+func (m *Incremental[K, V]) Len() int {
+	return len(m.sums)
+}
+
+// Sum returns the hash of the collection.
+func (m *Incremental[K, V]) Sum() Sum {
+	h := hasherPool.Get().(*hasher)
+	defer hasherPool.Put(h)
+	h.reset()
+	h.HashUint64(seed)
+	h.hashType(reflect.TypeFor[map[K]V]())
+	h.HashUint64(uint64(len(m.sums)))
+	h.HashBytes(m.sum.sum[:])
+	return h.sum()
+}
@@ -0,0 +1,326 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package eventbus provides an in-process publish/subscribe bus on which
+// subsystems exchange typed events, rather than registering callbacks on each
+// other.
+//
+// Each Go type of event is a topic. Publishers of a topic never block on its
+// subscribers: every subscriber has its own unbounded queue, which is drained
+// into the channel returned by [Subscriber.Events].
+package eventbus
+
+import (
+	"cmp"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tailscale.com/util/set"
+)
+
+// Bus is an event bus. The zero value is ready to use.
+// A Bus is safe for concurrent use.
+type Bus struct {
+	mu     sync.Mutex
+	topics map[reflect.Type]topicStatser // of *topic[T] keyed by T
+	debug  *topic[DebugEvent]            // lazily created; not in topics
+}
+
+// topicStatser is the non-generic part of a *topic[T].
+type topicStatser interface {
+	stats() TopicStats
+}
+
+// TopicStats are the delivery statistics of a topic, as returned by
+// [Bus.Stats].
+type TopicStats struct {
+	Name        string // the name of the event type, such as "ipnlocal.StateChange"
+	Subscribers int    // current number of subscribers
+	Replay      int    // number of events kept for replay to new subscribers
+	Published   int64  // events published
+	Delivered   int64  // events received by subscribers, summed across them
+	Queued      int    // events waiting to be received, summed across subscribers
+}
+
+// Stats returns the delivery statistics of all topics on b that have had a
+// publisher or subscriber, sorted by name.
+func (b *Bus) Stats() []TopicStats {
+	b.mu.Lock()
+	topics := make([]topicStatser, 0, len(b.topics))
+	for _, t := range b.topics {
+		topics = append(topics, t)
+	}
+	b.mu.Unlock()
+
+	ret := make([]TopicStats, 0, len(topics))
+	for _, t := range topics {
+		ret = append(ret, t.stats())
+	}
+	slices.SortFunc(ret, func(a, b TopicStats) int { return cmp.Compare(a.Name, b.Name) })
+	return ret
+}
+
+// DebugEvent is an event published to any topic of a Bus, as received by
+// subscribers of [Bus.Debug].
+type DebugEvent struct {
+	Time  time.Time
+	Topic string // the name of the event type
+	Event any
+}
+
+// Debug returns a subscriber that receives a copy of every event subsequently
+// published on b, to any topic. It is meant for debugging and introspection,
+// such as by "tailscale debug events". The caller must close it when done.
+func (b *Bus) Debug() *Subscriber[DebugEvent] {
+	b.mu.Lock()
+	if b.debug == nil {
+		b.debug = newTopic[DebugEvent](nil)
+	}
+	t := b.debug
+	b.mu.Unlock()
+	return t.subscribe()
+}
+
+// debugTopic returns b's debug topic, or nil if nobody
+// has ever subscribed to it.
+func (b *Bus) debugTopic() *topic[DebugEvent] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.debug
+}
+
+// topicFor returns the topic of events of type T on b, creating it if needed.
+func topicFor[T any](b *Bus) *topic[T] {
+	typ := reflect.TypeFor[T]()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.topics[typ]; ok {
+		return t.(*topic[T])
+	}
+	if b.topics == nil {
+		b.topics = make(map[reflect.Type]topicStatser)
+	}
+	t := newTopic[T](b)
+	b.topics[typ] = t
+	return t
+}
+
+// topic is the state of the topic of events of type T on a Bus.
+type topic[T any] struct {
+	bus  *Bus // or nil for a Bus's debug topic
+	name string
+
+	published atomic.Int64
+	delivered atomic.Int64
+
+	mu     sync.Mutex // protects following fields
+	replay int        // max len of ring
+	ring   []T        // last events published, oldest first
+	subs   set.HandleSet[*Subscriber[T]]
+}
+
+func newTopic[T any](b *Bus) *topic[T] {
+	return &topic[T]{
+		bus:  b,
+		name: reflect.TypeFor[T]().String(),
+	}
+}
+
+func (t *topic[T]) stats() TopicStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := TopicStats{
+		Name:        t.name,
+		Subscribers: len(t.subs),
+		Replay:      t.replay,
+		Published:   t.published.Load(),
+		Delivered:   t.delivered.Load(),
+	}
+	for _, s := range t.subs {
+		st.Queued += s.queueLen()
+	}
+	return st
+}
+
+func (t *topic[T]) setReplay(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.replay = max(t.replay, n)
+}
+
+func (t *topic[T]) publish(v T) {
+	t.mu.Lock()
+	t.published.Add(1)
+	if t.replay > 0 {
+		if len(t.ring) == t.replay {
+			var zero T
+			t.ring[0] = zero
+			t.ring = t.ring[1:]
+		}
+		t.ring = append(t.ring, v)
+	}
+	for _, s := range t.subs {
+		s.enqueue(v)
+	}
+	t.mu.Unlock()
+
+	if t.bus == nil {
+		return
+	}
+	if dt := t.bus.debugTopic(); dt != nil && dt.hasSubscribers() {
+		dt.publish(DebugEvent{Time: time.Now(), Topic: t.name, Event: v})
+	}
+}
+
+func (t *topic[T]) hasSubscribers() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.subs) > 0
+}
+
+func (t *topic[T]) subscribe() *Subscriber[T] {
+	s := &Subscriber[T]{
+		t:      t,
+		events: make(chan T),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	t.mu.Lock()
+	s.queue = slices.Clone(t.ring)
+	s.h = t.subs.Add(s)
+	t.mu.Unlock()
+	go s.pump()
+	return s
+}
+
+func (t *topic[T]) unsubscribe(h set.Handle) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.subs, h)
+}
+
+// Option is an option for [Publish].
+type Option func(*publishOptions)
+
+type publishOptions struct {
+	replay int
+}
+
+// Replay returns an Option that keeps the last n events published to the
+// topic, which are delivered to each new subscriber before any subsequent
+// events. It's useful for events describing the current state of something,
+// such that a late subscriber learns of it without waiting for it to change.
+//
+// If publishers of the same topic ask for different values of n, the largest
+// is used.
+func Replay(n int) Option {
+	return func(o *publishOptions) { o.replay = n }
+}
+
+// Publisher publishes events of type T on a Bus.
+type Publisher[T any] struct {
+	t *topic[T]
+}
+
+// Publish returns a publisher of events of type T on b. There may be any
+// number of publishers of the same type.
+func Publish[T any](b *Bus, opts ...Option) *Publisher[T] {
+	var o publishOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	t := topicFor[T](b)
+	if o.replay > 0 {
+		t.setReplay(o.replay)
+	}
+	return &Publisher[T]{t: t}
+}
+
+// Publish publishes v to all current subscribers of its topic.
+// It does not block on them.
+func (p *Publisher[T]) Publish(v T) {
+	p.t.publish(v)
+}
+
+// Subscribe returns a new subscriber to events of type T on b. The caller
+// must close it when done.
+func Subscribe[T any](b *Bus) *Subscriber[T] {
+	return topicFor[T](b).subscribe()
+}
+
+// Subscriber receives the events of type T published on a Bus.
+type Subscriber[T any] struct {
+	t      *topic[T]
+	h      set.Handle
+	events chan T
+	wake   chan struct{} // 1-buffered; non-blocking send when queue grows
+	done   chan struct{} // closed by Close
+
+	closeOnce sync.Once
+
+	mu    sync.Mutex
+	queue []T // events not yet sent on events
+}
+
+// Events returns the channel on which s receives events, in the order in
+// which they were published. It's closed by [Subscriber.Close].
+func (s *Subscriber[T]) Events() <-chan T {
+	return s.events
+}
+
+// Close unsubscribes s and closes its Events channel, discarding any events
+// not yet received.
+func (s *Subscriber[T]) Close() {
+	s.closeOnce.Do(func() {
+		s.t.unsubscribe(s.h)
+		close(s.done)
+	})
+}
+
+func (s *Subscriber[T]) enqueue(v T) {
+	s.mu.Lock()
+	s.queue = append(s.queue, v)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscriber[T]) queueLen() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// pump sends the events in s.queue on s.events until s is closed.
+func (s *Subscriber[T]) pump() {
+	defer close(s.events)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		v := s.queue[0]
+		var zero T
+		s.queue[0] = zero
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.events <- v:
+			s.t.delivered.Add(1)
+		case <-s.done:
+			return
+		}
+	}
+}
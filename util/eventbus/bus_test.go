@@ -0,0 +1,148 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package eventbus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type eventA struct{ N int }
+type eventB string
+
+func recv[T any](t *testing.T, s *Subscriber[T]) T {
+	t.Helper()
+	select {
+	case v, ok := <-s.Events():
+		if !ok {
+			t.Fatal("Events closed")
+		}
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	panic("unreachable")
+}
+
+func wantNoEvent[T any](t *testing.T, s *Subscriber[T]) {
+	t.Helper()
+	select {
+	case v := <-s.Events():
+		t.Fatalf("unexpected event %v", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestBus(t *testing.T) {
+	var b Bus
+	pa := Publish[eventA](&b)
+	pb := Publish[eventB](&b)
+	s1 := Subscribe[eventA](&b)
+	defer s1.Close()
+	s2 := Subscribe[eventA](&b)
+	defer s2.Close()
+	sb := Subscribe[eventB](&b)
+	defer sb.Close()
+
+	// Publishing doesn't block, even though nobody is receiving yet.
+	for i := range 3 {
+		pa.Publish(eventA{i})
+	}
+	pb.Publish("hello")
+
+	for _, s := range []*Subscriber[eventA]{s1, s2} {
+		for i := range 3 {
+			if got := recv(t, s); got.N != i {
+				t.Errorf("got %v, want %v", got, eventA{i})
+			}
+		}
+	}
+	if got := recv(t, sb); got != "hello" {
+		t.Errorf("got %q, want hello", got)
+	}
+
+	s2.Close()
+	if _, ok := <-s2.Events(); ok {
+		t.Errorf("Events not closed after Close")
+	}
+	pa.Publish(eventA{3})
+	if got := recv(t, s1); got.N != 3 {
+		t.Errorf("got %v, want %v", got, eventA{3})
+	}
+
+	// A late subscriber without replay sees only new events.
+	s3 := Subscribe[eventA](&b)
+	defer s3.Close()
+	wantNoEvent(t, s3)
+
+	want := []TopicStats{
+		{Name: "eventbus.eventA", Subscribers: 2, Published: 4, Delivered: 7},
+		{Name: "eventbus.eventB", Subscribers: 1, Published: 1, Delivered: 1},
+	}
+	// Deliveries are counted just after the receive completes, so wait for
+	// the counts to settle.
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		got := b.Stats()
+		if reflect.DeepEqual(got, want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Stats:\n got %+v\nwant %+v", got, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var b Bus
+	p := Publish[eventA](&b, Replay(2))
+	for i := range 5 {
+		p.Publish(eventA{i})
+	}
+	s := Subscribe[eventA](&b)
+	defer s.Close()
+	for _, want := range []int{3, 4} {
+		if got := recv(t, s); got.N != want {
+			t.Errorf("got %v, want %v", got, eventA{want})
+		}
+	}
+	wantNoEvent(t, s)
+	p.Publish(eventA{5})
+	if got := recv(t, s); got.N != 5 {
+		t.Errorf("got %v, want %v", got, eventA{5})
+	}
+
+	// A second publisher can't shrink the replay buffer.
+	Publish[eventA](&b, Replay(1))
+	if got := b.Stats()[0].Replay; got != 2 {
+		t.Errorf("Replay = %d, want 2", got)
+	}
+}
+
+func TestDebug(t *testing.T) {
+	var b Bus
+	pa := Publish[eventA](&b)
+	pb := Publish[eventB](&b)
+	pa.Publish(eventA{0}) // before subscribing; not seen
+
+	d := b.Debug()
+	defer d.Close()
+	pa.Publish(eventA{1})
+	pb.Publish("x")
+
+	if got := recv(t, d); got.Topic != "eventbus.eventA" || got.Event != (eventA{1}) {
+		t.Errorf("got %+v, want eventA{1}", got)
+	}
+	if got := recv(t, d); got.Topic != "eventbus.eventB" || got.Event != eventB("x") {
+		t.Errorf("got %+v, want eventB x", got)
+	}
+	d.Close()
+	pa.Publish(eventA{2}) // doesn't block or panic
+
+	// The debug topic isn't itself a topic.
+	if got := len(b.Stats()); got != 2 {
+		t.Errorf("len(Stats) = %d, want 2", got)
+	}
+}
@@ -52,6 +52,9 @@ func detectFirewallMode(logf logger.Logf, prefHint string) FirewallMode {
 	case "nftables":
 		hostinfo.SetFirewallMode("nft-forced")
 		return FirewallModeNfTables
+	case "nftables-native":
+		hostinfo.SetFirewallMode("nft-native-forced")
+		return FirewallModeNfTablesNative
 	case "iptables":
 		hostinfo.SetFirewallMode("ipt-forced")
 	default:
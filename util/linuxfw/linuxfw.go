@@ -49,6 +49,9 @@ func (e FWModeNotSupportedError) Unwrap() error {
 const (
 	FirewallModeIPTables FirewallMode = "iptables"
 	FirewallModeNfTables FirewallMode = "nftables"
+	// FirewallModeNfTablesNative is like FirewallModeNfTables, but keeps
+	// all rules in Tailscale-owned tables. See nftables_native.go.
+	FirewallModeNfTablesNative FirewallMode = "nftables-native"
 )
 
 // The following bits are added to packet marks for Tailscale use.
@@ -0,0 +1,328 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package linuxfw
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"tailscale.com/types/logger"
+)
+
+// In the nftables-native firewall mode, rather than adding its chains to the
+// conventional "filter" and "nat" tables shared with iptables-nft, ufw and
+// others, the nftablesRunner keeps everything in tables of its own, with
+// base chains of its own hooked at the priorities below. Tailscale then owns
+// those tables outright and removes them as a whole.
+//
+// As an accept verdict only ends evaluation of the current base chain,
+// traffic accepted by Tailscale's tables is still subject to the base chains
+// of other tables on the same hooks, any of which can drop it. DetectConflicts
+// finds such chains, and AcceptInConflictingChains can insert accept rules
+// for Tailscale traffic into them.
+const (
+	nativeFilterTable = "tailscale-filter"
+	nativeNATTable    = "tailscale-nat"
+)
+
+var (
+	// nativeFilterPriority runs Tailscale's filter chains just before the
+	// conventional filter chains, so that Tailscale's drop rules apply
+	// regardless of what the other chains accept.
+	nativeFilterPriority = nftables.ChainPriorityRef(*nftables.ChainPriorityFilter - 10)
+	// nativeNATPriority runs Tailscale's postrouting chain just before the
+	// conventional source NAT chains, so that its masquerading of subnet
+	// router traffic takes effect.
+	nativeNATPriority = nftables.ChainPriorityRef(*nftables.ChainPriorityNATSource - 10)
+)
+
+// acceptRuleTag is the UserData of the rules AcceptInConflictingChains
+// inserts into other firewalls' chains, by which they are found and removed.
+var acceptRuleTag = []byte("ts-accept")
+
+// isNativeTable reports whether the named table is owned by the
+// nftables-native firewall mode.
+func isNativeTable(name string) bool {
+	return name == nativeFilterTable || name == nativeNATTable
+}
+
+// FirewallConflict is a base chain of another firewall that drops traffic by
+// default, and so may drop Tailscale traffic that Tailscale's own tables
+// accept.
+type FirewallConflict struct {
+	// Framework is the firewall the chain belongs to, such as "firewalld",
+	// "ufw" or "docker", or empty if not recognized.
+	Framework string
+	Family    nftables.TableFamily
+	Table     string
+	Chain     string
+	Hook      string // "input" or "forward"
+}
+
+func (c FirewallConflict) String() string {
+	fw := c.Framework
+	if fw == "" {
+		fw = "unknown firewall"
+	}
+	return fmt.Sprintf("%s (chain %s in table %s %s, %s hook)", fw, c.Chain, familyName(c.Family), c.Table, c.Hook)
+}
+
+// ConflictDetector is implemented by NetfilterRunners that keep their rules in
+// tables of their own, where other firewalls can still drop Tailscale traffic.
+type ConflictDetector interface {
+	// DetectConflicts returns the base chains of other firewalls that may
+	// drop traffic to or from tunname. Chains into which
+	// AcceptInConflictingChains inserted accept rules aren't reported.
+	DetectConflicts(tunname string) ([]FirewallConflict, error)
+	// AcceptInConflictingChains inserts rules accepting traffic to and
+	// from tunname at the top of each of the conflicting chains.
+	AcceptInConflictingChains(tunname string, conflicts []FirewallConflict) error
+}
+
+var _ ConflictDetector = (*nftablesRunner)(nil)
+
+// DetectConflicts implements ConflictDetector. It always returns no conflicts
+// unless the runner is in nftables-native mode.
+func (n *nftablesRunner) DetectConflicts(tunname string) ([]FirewallConflict, error) {
+	if !n.native {
+		return nil, nil
+	}
+	chains, err := n.conn.ListChains()
+	if err != nil {
+		return nil, fmt.Errorf("list chains: %w", err)
+	}
+	var conflicts []FirewallConflict
+	for _, c := range chains {
+		hook := filterHookName(c)
+		if hook == "" || isNativeTable(c.Table.Name) {
+			continue
+		}
+		switch c.Table.Family {
+		case nftables.TableFamilyIPv4, nftables.TableFamilyINet:
+		case nftables.TableFamilyIPv6:
+			if !n.HasIPV6() {
+				continue
+			}
+		default:
+			continue
+		}
+		rules, err := n.conn.GetRules(c.Table, c)
+		if err != nil {
+			return nil, fmt.Errorf("get rules of chain %s: %w", c.Name, err)
+		}
+		if !dropsByDefault(c, rules) || slices.ContainsFunc(rules, isTailscaleAcceptRule) {
+			continue
+		}
+		conflicts = append(conflicts, FirewallConflict{
+			Framework: firewallFramework(c.Table, chains),
+			Family:    c.Table.Family,
+			Table:     c.Table.Name,
+			Chain:     c.Name,
+			Hook:      hook,
+		})
+	}
+	return conflicts, nil
+}
+
+// AcceptInConflictingChains implements ConflictDetector.
+func (n *nftablesRunner) AcceptInConflictingChains(tunname string, conflicts []FirewallConflict) error {
+	for _, c := range conflicts {
+		table := &nftables.Table{Family: c.Family, Name: c.Table}
+		chain, err := getChainFromTable(n.conn, table, c.Chain)
+		if err != nil {
+			return err
+		}
+		// Rules are inserted at the top of the chain, so insert them in
+		// reverse order.
+		if c.Hook == "forward" {
+			n.conn.InsertRule(createTailscaleAcceptRule(table, chain, expr.MetaKeyOIFNAME, tunname))
+		}
+		n.conn.InsertRule(createTailscaleAcceptRule(table, chain, expr.MetaKeyIIFNAME, tunname))
+		if err := n.conn.Flush(); err != nil {
+			return fmt.Errorf("insert accept rules into %v: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// createTailscaleAcceptRule returns a rule accepting traffic whose input or
+// output interface, depending on key, is tunname.
+func createTailscaleAcceptRule(table *nftables.Table, chain *nftables.Chain, key expr.MetaKey, tunname string) *nftables.Rule {
+	return &nftables.Rule{
+		Table: table,
+		Chain: chain,
+		Exprs: []expr.Any{
+			&expr.Meta{Key: key, Register: 1},
+			&expr.Cmp{
+				Op:       expr.CmpOpEq,
+				Register: 1,
+				Data:     []byte(tunname),
+			},
+			&expr.Counter{},
+			&expr.Verdict{
+				Kind: expr.VerdictAccept,
+			},
+		},
+		UserData: acceptRuleTag,
+	}
+}
+
+func isTailscaleAcceptRule(r *nftables.Rule) bool {
+	return bytes.Equal(r.UserData, acceptRuleTag)
+}
+
+// removeTailscaleAcceptRules removes the rules inserted by
+// AcceptInConflictingChains from all chains.
+func removeTailscaleAcceptRules(conn *nftables.Conn) error {
+	chains, err := conn.ListChains()
+	if err != nil {
+		return fmt.Errorf("list chains: %w", err)
+	}
+	var found bool
+	for _, c := range chains {
+		if filterHookName(c) == "" || isNativeTable(c.Table.Name) {
+			continue
+		}
+		rules, err := conn.GetRules(c.Table, c)
+		if err != nil {
+			return fmt.Errorf("get rules of chain %s: %w", c.Name, err)
+		}
+		for _, r := range rules {
+			if isTailscaleAcceptRule(r) {
+				found = true
+				if err := conn.DelRule(r); err != nil {
+					return fmt.Errorf("delete accept rule from chain %s: %w", c.Name, err)
+				}
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	return conn.Flush()
+}
+
+// delNativeTables removes the tables owned by the nftables-native mode, and
+// any accept rules inserted into other firewalls' chains.
+func (n *nftablesRunner) delNativeTables() error {
+	if err := removeTailscaleAcceptRules(n.conn); err != nil {
+		return err
+	}
+	for _, table := range n.getTables() {
+		if err := deleteTableIfExists(n.conn, table.Proto, nativeFilterTable); err != nil {
+			return err
+		}
+		if err := deleteTableIfExists(n.conn, table.Proto, nativeNATTable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupNative removes everything installed in nftables-native mode. Errors
+// are logged to logf.
+func cleanupNative(logf logger.Logf, conn *nftables.Conn, tables []*nftables.Table) {
+	if err := removeTailscaleAcceptRules(conn); err != nil {
+		logf("cleanup: remove accept rules: %s", err)
+	}
+	for _, table := range tables {
+		if isNativeTable(table.Name) {
+			conn.DelTable(table)
+			if err := conn.Flush(); err != nil {
+				logf("cleanup: flush delete table %s: %s", table.Name, err)
+			}
+		}
+	}
+}
+
+// filterHookName returns the name of the hook of c if it is a filter base
+// chain on the input or forward hook, and the empty string otherwise.
+func filterHookName(c *nftables.Chain) string {
+	if c.Type != nftables.ChainTypeFilter || c.Hooknum == nil {
+		return ""
+	}
+	switch *c.Hooknum {
+	case *nftables.ChainHookInput:
+		return "input"
+	case *nftables.ChainHookForward:
+		return "forward"
+	}
+	return ""
+}
+
+// dropsByDefault reports whether traffic not otherwise accepted by chain c
+// with the given rules is dropped, either by the chain's policy or by an
+// unconditional drop or reject rule at its end.
+func dropsByDefault(c *nftables.Chain, rules []*nftables.Rule) bool {
+	if c.Policy != nil && *c.Policy == nftables.ChainPolicyDrop {
+		return true
+	}
+	if len(rules) == 0 {
+		return false
+	}
+	var drops bool
+	for _, e := range rules[len(rules)-1].Exprs {
+		switch e := e.(type) {
+		case *expr.Counter, *expr.Log:
+		case *expr.Reject:
+			drops = true
+		case *expr.Verdict:
+			if e.Kind != expr.VerdictDrop {
+				return false
+			}
+			drops = true
+		default:
+			// Anything else is a match, so the rule is conditional.
+			return false
+		}
+	}
+	return drops
+}
+
+// firewallFramework returns the names of the known firewall frameworks that
+// manage table, based on the names of the chains in it, or the empty string
+// if none are recognized.
+func firewallFramework(table *nftables.Table, chains []*nftables.Chain) string {
+	if table.Name == "firewalld" {
+		return "firewalld"
+	}
+	var ufw, docker bool
+	for _, c := range chains {
+		if c.Table.Name != table.Name || c.Table.Family != table.Family {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(c.Name, "ufw-"):
+			ufw = true
+		case c.Name == "DOCKER" || c.Name == "DOCKER-USER":
+			docker = true
+		}
+	}
+	var names []string
+	if ufw {
+		names = append(names, "ufw")
+	}
+	if docker {
+		names = append(names, "docker")
+	}
+	return strings.Join(names, ", ")
+}
+
+func familyName(f nftables.TableFamily) string {
+	switch f {
+	case nftables.TableFamilyIPv4:
+		return "ip"
+	case nftables.TableFamilyIPv6:
+		return "ip6"
+	case nftables.TableFamilyINet:
+		return "inet"
+	}
+	return fmt.Sprintf("family-%d", f)
+}
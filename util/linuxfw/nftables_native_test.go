@@ -0,0 +1,104 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build linux
+
+package linuxfw
+
+import (
+	"testing"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+)
+
+func TestNFTNativeTablesAndConflicts(t *testing.T) {
+	conn := newSysConn(t)
+	runner := newFakeNftablesRunnerWithConn(t, conn, false)
+	runner.native = true
+
+	// A ufw-like table whose INPUT chain drops by policy, a firewalld-like
+	// table whose forward chain ends with a reject, and a table that
+	// doesn't drop anything.
+	polDrop, polAccept := nftables.ChainPolicyDrop, nftables.ChainPolicyAccept
+	ufw := conn.AddTable(&nftables.Table{Family: nftables.TableFamilyIPv4, Name: "filter"})
+	ufwInput := conn.AddChain(&nftables.Chain{Name: "INPUT", Table: ufw, Type: nftables.ChainTypeFilter, Hooknum: nftables.ChainHookInput, Priority: nftables.ChainPriorityFilter, Policy: &polDrop})
+	conn.AddChain(&nftables.Chain{Name: "ufw-before-input", Table: ufw})
+	firewalld := conn.AddTable(&nftables.Table{Family: nftables.TableFamilyINet, Name: "firewalld"})
+	fwdForward := conn.AddChain(&nftables.Chain{Name: "filter_FORWARD", Table: firewalld, Type: nftables.ChainTypeFilter, Hooknum: nftables.ChainHookForward, Priority: nftables.ChainPriorityFilter, Policy: &polAccept})
+	conn.AddRule(&nftables.Rule{Table: firewalld, Chain: fwdForward, Exprs: []expr.Any{&expr.Reject{}}})
+	other := conn.AddTable(&nftables.Table{Family: nftables.TableFamilyIPv4, Name: "other"})
+	conn.AddChain(&nftables.Chain{Name: "input", Table: other, Type: nftables.ChainTypeFilter, Hooknum: nftables.ChainHookInput, Priority: nftables.ChainPriorityFilter, Policy: &polAccept})
+	if err := conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runner.AddChains(); err != nil {
+		t.Fatalf("AddChains() failed: %v", err)
+	}
+	if err := runner.AddHooks(); err != nil {
+		t.Fatalf("AddHooks() failed: %v", err)
+	}
+	if err := runner.AddBase("testTunn"); err != nil {
+		t.Fatalf("AddBase() failed: %v", err)
+	}
+	for _, name := range []string{nativeFilterTable, nativeNATTable} {
+		if tb, err := getTableIfExists(conn, nftables.TableFamilyIPv4, name); err != nil || tb == nil {
+			t.Fatalf("table %s missing: %v", name, err)
+		}
+	}
+	if tb, err := getTableIfExists(conn, nftables.TableFamilyIPv4, "nat"); err != nil || tb != nil {
+		t.Fatalf("conventional nat table created in native mode: %v", err)
+	}
+	input, err := getChainFromTable(conn, runner.nft4.Filter, "INPUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *input.Priority != *nativeFilterPriority {
+		t.Errorf("INPUT priority = %d; want %d", *input.Priority, *nativeFilterPriority)
+	}
+	checkChainRules(t, conn, ufwInput, 0)
+
+	conflicts, err := runner.DetectConflicts("testTunn")
+	if err != nil {
+		t.Fatalf("DetectConflicts() failed: %v", err)
+	}
+	want := map[string]FirewallConflict{
+		"INPUT":          {Framework: "ufw", Family: nftables.TableFamilyIPv4, Table: "filter", Chain: "INPUT", Hook: "input"},
+		"filter_FORWARD": {Framework: "firewalld", Family: nftables.TableFamilyINet, Table: "firewalld", Chain: "filter_FORWARD", Hook: "forward"},
+	}
+	if len(conflicts) != len(want) {
+		t.Fatalf("DetectConflicts() = %v; want %v", conflicts, want)
+	}
+	for _, c := range conflicts {
+		if c != want[c.Chain] {
+			t.Errorf("conflict %v; want %v", c, want[c.Chain])
+		}
+	}
+
+	if err := runner.AcceptInConflictingChains("testTunn", conflicts); err != nil {
+		t.Fatalf("AcceptInConflictingChains() failed: %v", err)
+	}
+	checkChainRules(t, conn, ufwInput, 1)
+	checkChainRules(t, conn, fwdForward, 3)
+	if conflicts, err := runner.DetectConflicts("testTunn"); err != nil || len(conflicts) != 0 {
+		t.Errorf("DetectConflicts() after accepting = %v, %v; want none", conflicts, err)
+	}
+
+	if err := runner.DelHooks(t.Logf); err != nil {
+		t.Fatalf("DelHooks() failed: %v", err)
+	}
+	if err := runner.DelBase(); err != nil {
+		t.Fatalf("DelBase() failed: %v", err)
+	}
+	if err := runner.DelChains(); err != nil {
+		t.Fatalf("DelChains() failed: %v", err)
+	}
+	for _, name := range []string{nativeFilterTable, nativeNATTable} {
+		if tb, err := getTableIfExists(conn, nftables.TableFamilyIPv4, name); err != nil || tb != nil {
+			t.Errorf("table %s not removed: %v", name, err)
+		}
+	}
+	checkChainRules(t, conn, ufwInput, 0)
+	checkChainRules(t, conn, fwdForward, 1)
+}
@@ -74,6 +74,10 @@ type nftablesRunner struct {
 	nft6 *nftable // IPv6 tables or nil if the system does not support IPv6
 
 	v6Available bool // whether the host supports IPv6
+
+	// native is whether the runner keeps its rules in Tailscale-owned
+	// tables rather than the conventional ones (FirewallModeNfTablesNative).
+	native bool
 }
 
 func (n *nftablesRunner) ensurePreroutingChain(dst netip.Addr) (*nftables.Table, *nftables.Chain, error) {
@@ -576,7 +580,7 @@ type NetfilterRunner interface {
 // nftables or iptables.
 // As nftables is still experimental, iptables will be used unless
 // either the TS_DEBUG_FIREWALL_MODE environment variable, or the prefHint
-// parameter, is set to one of "nftables" or "auto".
+// parameter, is set to one of "nftables", "nftables-native" or "auto".
 func New(logf logger.Logf, prefHint string) (NetfilterRunner, error) {
 	mode := detectFirewallMode(logf, prefHint)
 	switch mode {
@@ -598,6 +602,14 @@ func New(logf logger.Logf, prefHint string) (NetfilterRunner, error) {
 			return nil, err
 		}
 		return nfr, nil
+	case FirewallModeNfTablesNative:
+		nfr, err := newNfTablesRunner(logf)
+		if err != nil {
+			return nil, err
+		}
+		nfr.native = true
+		logf("nftables running in native mode, using tables %s and %s", nativeFilterTable, nativeNATTable)
+		return nfr, nil
 	default:
 		return nil, fmt.Errorf("unknown firewall mode %v", mode)
 	}
@@ -875,21 +887,28 @@ func (n *nftablesRunner) getTables() []*nftable {
 // if the ts-chain doesn't already exist.
 func (n *nftablesRunner) AddChains() error {
 	polAccept := nftables.ChainPolicyAccept
+	filterName, filterPriority := "filter", nftables.ChainPriorityFilter
+	natName, natPriority := "nat", nftables.ChainPriorityNATSource
+	if n.native {
+		filterName, filterPriority = nativeFilterTable, nativeFilterPriority
+		natName, natPriority = nativeNATTable, nativeNATPriority
+	}
 	for _, table := range n.getTables() {
 		// Create the filter table if it doesn't exist, this table name is the same
 		// as the name used by iptables-nft and ufw. We install rules into the
 		// same conventional table so that `accept` verdicts from our jump
-		// chains are conclusive.
-		filter, err := createTableIfNotExist(n.conn, table.Proto, "filter")
+		// chains are conclusive. In nftables-native mode, it is instead a
+		// table of our own.
+		filter, err := createTableIfNotExist(n.conn, table.Proto, filterName)
 		if err != nil {
 			return fmt.Errorf("create table: %w", err)
 		}
 		table.Filter = filter
 		// Adding the "conventional chains" that are used by iptables-nft and ufw.
-		if err = createChainIfNotExist(n.conn, chainInfo{filter, "FORWARD", nftables.ChainTypeFilter, nftables.ChainHookForward, nftables.ChainPriorityFilter, &polAccept}); err != nil {
+		if err = createChainIfNotExist(n.conn, chainInfo{filter, "FORWARD", nftables.ChainTypeFilter, nftables.ChainHookForward, filterPriority, &polAccept}); err != nil {
 			return fmt.Errorf("create forward chain: %w", err)
 		}
-		if err = createChainIfNotExist(n.conn, chainInfo{filter, "INPUT", nftables.ChainTypeFilter, nftables.ChainHookInput, nftables.ChainPriorityFilter, &polAccept}); err != nil {
+		if err = createChainIfNotExist(n.conn, chainInfo{filter, "INPUT", nftables.ChainTypeFilter, nftables.ChainHookInput, filterPriority, &polAccept}); err != nil {
 			return fmt.Errorf("create input chain: %w", err)
 		}
 		// Adding the tailscale chains that contain our rules.
@@ -903,14 +922,15 @@ func (n *nftablesRunner) AddChains() error {
 		// Create the nat table if it doesn't exist, this table name is the same
 		// as the name used by iptables-nft and ufw. We install rules into the
 		// same conventional table so that `accept` verdicts from our jump
-		// chains are conclusive.
-		nat, err := createTableIfNotExist(n.conn, table.Proto, "nat")
+		// chains are conclusive. In nftables-native mode, it is instead a
+		// table of our own.
+		nat, err := createTableIfNotExist(n.conn, table.Proto, natName)
 		if err != nil {
 			return fmt.Errorf("create table: %w", err)
 		}
 		table.Nat = nat
 		// Adding the "conventional chains" that are used by iptables-nft and ufw.
-		if err = createChainIfNotExist(n.conn, chainInfo{nat, "POSTROUTING", nftables.ChainTypeNAT, nftables.ChainHookPostrouting, nftables.ChainPriorityNATSource, &polAccept}); err != nil {
+		if err = createChainIfNotExist(n.conn, chainInfo{nat, "POSTROUTING", nftables.ChainTypeNAT, nftables.ChainHookPostrouting, natPriority, &polAccept}); err != nil {
 			return fmt.Errorf("create postrouting chain: %w", err)
 		}
 		// Adding the tailscale chain that contains our rules.
@@ -980,7 +1000,11 @@ func deleteChainIfExists(c *nftables.Conn, table *nftables.Table, name string) e
 }
 
 // DelChains removes the custom Tailscale chains from netfilter via nftables.
+// In nftables-native mode, it removes Tailscale's tables.
 func (n *nftablesRunner) DelChains() error {
+	if n.native {
+		return n.delNativeTables()
+	}
 	for _, table := range n.getTables() {
 		if err := deleteChainIfExists(n.conn, table.Filter, chainNameForward); err != nil {
 			return fmt.Errorf("delete chain: %w", err)
@@ -1993,6 +2017,8 @@ func NfTablesCleanUp(logf logger.Logf) {
 		logf("cleanup: list tables: %s", err)
 	}
 
+	cleanupNative(logf, conn, tables)
+
 	for _, table := range tables {
 		// These table names were used briefly in 1.48.0.
 		if table.Name == "ts-filter" || table.Name == "ts-nat" {
@@ -53,6 +53,17 @@
 	// administrator. Its name is slightly awkward because RunExitNodeVisibility
 	// predates this option but is preserved for backwards compatibility.
 	EnableRunExitNode Key = "AdvertiseExitNode"
+	// EnableSSH controls if the device runs the Tailscale SSH server.
+	EnableSSH Key = "RunSSHServer"
+	// AllowServe, AllowFunnel, AllowTaildropSend and AllowTaildropReceive
+	// control if the device may share local services with Tailscale Serve or
+	// Funnel, and send or receive files with Taildrop. As these features have
+	// to be set up by the user, "never" forbids them while "always" and
+	// "user-decides" both leave them to the user.
+	AllowServe           Key = "AllowServe"
+	AllowFunnel          Key = "AllowFunnel"
+	AllowTaildropSend    Key = "AllowTaildropSend"
+	AllowTaildropReceive Key = "AllowTaildropReceive"
 
 	// Keys with a string value that controls visibility: "show", "hide".
 	// The default is "show" unless otherwise stated. Enforcement of these
@@ -133,6 +144,10 @@
 // This includes the first time a policy needs to be read from any source.
 var implicitDefinitions = []*setting.Definition{
 	// Device policy settings (can only be configured on a per-device basis):
+	setting.NewDefinition(AllowFunnel, setting.DeviceSetting, setting.PreferenceOptionValue),
+	setting.NewDefinition(AllowServe, setting.DeviceSetting, setting.PreferenceOptionValue),
+	setting.NewDefinition(AllowTaildropReceive, setting.DeviceSetting, setting.PreferenceOptionValue),
+	setting.NewDefinition(AllowTaildropSend, setting.DeviceSetting, setting.PreferenceOptionValue),
 	setting.NewDefinition(AllowedSuggestedExitNodes, setting.DeviceSetting, setting.StringListValue),
 	setting.NewDefinition(ApplyUpdates, setting.DeviceSetting, setting.PreferenceOptionValue),
 	setting.NewDefinition(AuthKey, setting.DeviceSetting, setting.StringValue),
@@ -142,6 +157,7 @@
 	setting.NewDefinition(EnableIncomingConnections, setting.DeviceSetting, setting.PreferenceOptionValue),
 	setting.NewDefinition(EnableRunExitNode, setting.DeviceSetting, setting.PreferenceOptionValue),
 	setting.NewDefinition(EnableServerMode, setting.DeviceSetting, setting.PreferenceOptionValue),
+	setting.NewDefinition(EnableSSH, setting.DeviceSetting, setting.PreferenceOptionValue),
 	setting.NewDefinition(EnableTailscaleDNS, setting.DeviceSetting, setting.PreferenceOptionValue),
 	setting.NewDefinition(EnableTailscaleSubnets, setting.DeviceSetting, setting.PreferenceOptionValue),
 	setting.NewDefinition(ExitNodeAllowLANAccess, setting.DeviceSetting, setting.PreferenceOptionValue),
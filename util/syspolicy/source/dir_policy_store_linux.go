@@ -0,0 +1,302 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !android
+
+package source
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"tailscale.com/util/mak"
+	"tailscale.com/util/set"
+	"tailscale.com/util/syspolicy/internal/loggerx"
+	"tailscale.com/util/syspolicy/setting"
+)
+
+// DefaultPolicyDir is the directory of the device's policy fragments on Linux.
+const DefaultPolicyDir = "/etc/tailscale/policy.d"
+
+var (
+	_ Store      = (*DirPolicyStore)(nil)
+	_ Changeable = (*DirPolicyStore)(nil)
+	_ io.Closer  = (*DirPolicyStore)(nil)
+)
+
+// dirPollInterval is how often a [DirPolicyStore] checks for changes when it
+// can't watch its directory, such as while the directory doesn't exist.
+var dirPollInterval = 10 * time.Second // var for tests
+
+// DirPolicyStore is a [Store] that reads policy settings from the JSON files
+// ("fragments") in a directory, such as [DefaultPolicyDir].
+//
+// Each file with a ".json" extension holds a JSON object that maps policy
+// setting keys to their values: strings, non-negative integers, booleans or
+// arrays of strings. Fragments are applied in lexical order of their names,
+// so a setting in "50-fleet.json" overrides the same setting in
+// "10-defaults.json". Other files, including hidden ones, are ignored.
+//
+// The store watches the directory, which doesn't need to exist yet, and
+// reloads the policy settings when it changes. If a fragment can't be read or
+// parsed, such as while it is being written, the previous policy settings
+// remain in effect.
+type DirPolicyStore struct {
+	dir          string
+	pollInterval time.Duration
+
+	mu       sync.Mutex
+	settings map[setting.Key]any // string, uint64, bool or []string
+	cbs      set.HandleSet[func()]
+	watching bool          // whether the watch goroutine has been started
+	done     chan struct{} // closed by Close
+	closed   bool
+}
+
+// NewDirPolicyStore returns a new [DirPolicyStore] that reads policy settings
+// from the fragments in dir.
+func NewDirPolicyStore(dir string) *DirPolicyStore {
+	s := &DirPolicyStore{
+		dir:          dir,
+		pollInterval: dirPollInterval,
+		done:         make(chan struct{}),
+	}
+	if err := s.reload(); err != nil {
+		loggerx.Errorf("syspolicy: %v", err)
+	}
+	return s
+}
+
+// ReadString implements [Store].
+func (s *DirPolicyStore) ReadString(key setting.Key) (string, error) {
+	return readDirSetting[string](s, key)
+}
+
+// ReadUInt64 implements [Store].
+func (s *DirPolicyStore) ReadUInt64(key setting.Key) (uint64, error) {
+	return readDirSetting[uint64](s, key)
+}
+
+// ReadBoolean implements [Store].
+func (s *DirPolicyStore) ReadBoolean(key setting.Key) (bool, error) {
+	return readDirSetting[bool](s, key)
+}
+
+// ReadStringArray implements [Store].
+func (s *DirPolicyStore) ReadStringArray(key setting.Key) ([]string, error) {
+	v, err := readDirSetting[[]string](s, key)
+	return slices.Clone(v), err
+}
+
+func readDirSetting[T string | uint64 | bool | []string](s *DirPolicyStore, key setting.Key) (T, error) {
+	var zero T
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return zero, ErrStoreClosed
+	}
+	v, ok := s.settings[key]
+	if !ok {
+		return zero, setting.ErrNotConfigured
+	}
+	t, ok := v.(T)
+	if !ok {
+		return zero, fmt.Errorf("%s: %w: got %T, want %T", key, setting.ErrTypeMismatch, v, zero)
+	}
+	return t, nil
+}
+
+// RegisterChangeCallback implements [Changeable].
+func (s *DirPolicyStore) RegisterChangeCallback(callback func()) (unregister func(), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+	handle := s.cbs.Add(callback)
+	if !s.watching {
+		// Only watch the directory once there is someone to tell.
+		s.watching = true
+		go s.watch()
+	}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.cbs, handle)
+	}, nil
+}
+
+// Close implements [io.Closer].
+func (s *DirPolicyStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	return nil
+}
+
+// watch reloads the policy settings whenever the directory changes, until the
+// store is closed.
+func (s *DirPolicyStore) watch() {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		loggerx.Errorf("syspolicy: watching %s failed, polling instead: %v", s.dir, err)
+	} else {
+		defer w.Close()
+	}
+	poll := time.NewTicker(s.pollInterval)
+	defer poll.Stop()
+
+	// The directory can only be watched while it exists, so keep trying to
+	// watch it until it does, and start over if it is removed.
+	watched := false
+	for {
+		if w != nil && !watched && w.Add(s.dir) == nil {
+			// Pick up any changes made before we were watching.
+			watched = true
+			if err := s.reload(); err != nil {
+				loggerx.Errorf("syspolicy: %v", err)
+			}
+		}
+		var events <-chan fsnotify.Event
+		var errs <-chan error
+		if w != nil {
+			events, errs = w.Events, w.Errors
+		}
+		select {
+		case <-s.done:
+			return
+		case <-poll.C:
+			if watched {
+				continue
+			}
+		case ev := <-events:
+			if ev.Name == s.dir && (ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename)) {
+				watched = false
+			}
+		case err := <-errs:
+			// Events may have been lost, so reload anyway.
+			loggerx.Errorf("syspolicy: watching %s: %v", s.dir, err)
+		}
+		if err := s.reload(); err != nil {
+			loggerx.Errorf("syspolicy: %v", err)
+		}
+	}
+}
+
+// reload reads the policy settings from the fragments in the directory and
+// notifies the registered callbacks if they changed.
+func (s *DirPolicyStore) reload() error {
+	settings, err := readPolicyDir(s.dir)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.closed || reflect.DeepEqual(settings, s.settings) {
+		s.mu.Unlock()
+		return nil
+	}
+	s.settings = settings
+	cbs := slices.Collect(maps.Values(s.cbs))
+	s.mu.Unlock()
+	for _, cb := range cbs {
+		cb()
+	}
+	return nil
+}
+
+// readPolicyDir returns the policy settings of the fragments in dir, which
+// has none if it doesn't exist.
+func readPolicyDir(dir string) (map[setting.Key]any, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var settings map[setting.Key]any
+	for _, e := range entries { // sorted by name
+		name := e.Name()
+		if strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" || e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fragment, err := parsePolicyFragment(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for k, v := range fragment {
+			if v == nil {
+				// An explicit null unsets the setting of earlier fragments.
+				delete(settings, k)
+			} else {
+				mak.Set(&settings, k, v)
+			}
+		}
+	}
+	return settings, nil
+}
+
+// parsePolicyFragment parses the JSON object of policy settings in b. The
+// value of a setting that is null is nil.
+func parsePolicyFragment(b []byte) (map[setting.Key]any, error) {
+	var raw map[setting.Key]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+	settings := make(map[setting.Key]any, len(raw))
+	for k, rv := range raw {
+		dec := json.NewDecoder(bytes.NewReader(rv))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		switch v := v.(type) {
+		case string, bool:
+			settings[k] = v
+		case json.Number:
+			n, err := strconv.ParseUint(v.String(), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v is not a non-negative integer", k, v)
+			}
+			settings[k] = n
+		case []any:
+			strs := make([]string, 0, len(v))
+			for _, e := range v {
+				s, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: arrays may only contain strings", k)
+				}
+				strs = append(strs, s)
+			}
+			settings[k] = strs
+		case nil:
+			settings[k] = nil
+		default:
+			return nil, fmt.Errorf("%s: unsupported value type %T", k, v)
+		}
+	}
+	return settings, nil
+}
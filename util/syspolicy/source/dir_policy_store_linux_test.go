@@ -0,0 +1,139 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !android
+
+package source
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"tailscale.com/util/syspolicy/setting"
+)
+
+func TestDirPolicyStore(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("10-defaults.json", `{
+		"LoginURL": "https://login.example.com",
+		"AllowFunnel": "never",
+		"KeyExpirationNotice": "24h",
+		"LogSCMInteractions": true,
+		"MaxThings": 42,
+		"AllowedSuggestedExitNodes": ["n1", "n2"]
+	}`)
+	write("50-fleet.json", `{"AllowFunnel": "user-decides", "KeyExpirationNotice": null}`)
+	write("60-ignored.txt", `{"LoginURL": "https://ignored.example.com"}`)
+	write(".70-hidden.json", `{"LoginURL": "https://hidden.example.com"}`)
+
+	s := NewDirPolicyStore(dir)
+	defer s.Close()
+
+	if got, err := s.ReadString("LoginURL"); err != nil || got != "https://login.example.com" {
+		t.Errorf("LoginURL = %q, %v", got, err)
+	}
+	if got, err := s.ReadString("AllowFunnel"); err != nil || got != "user-decides" {
+		t.Errorf("AllowFunnel = %q, %v; want the later fragment to win", got, err)
+	}
+	if _, err := s.ReadString("KeyExpirationNotice"); !errors.Is(err, setting.ErrNotConfigured) {
+		t.Errorf("KeyExpirationNotice: err = %v, want ErrNotConfigured after null", err)
+	}
+	if got, err := s.ReadBoolean("LogSCMInteractions"); err != nil || !got {
+		t.Errorf("LogSCMInteractions = %v, %v", got, err)
+	}
+	if got, err := s.ReadUInt64("MaxThings"); err != nil || got != 42 {
+		t.Errorf("MaxThings = %v, %v", got, err)
+	}
+	if got, err := s.ReadStringArray("AllowedSuggestedExitNodes"); err != nil || !reflect.DeepEqual(got, []string{"n1", "n2"}) {
+		t.Errorf("AllowedSuggestedExitNodes = %q, %v", got, err)
+	}
+	if _, err := s.ReadBoolean("LoginURL"); !errors.Is(err, setting.ErrTypeMismatch) {
+		t.Errorf("reading string as bool: err = %v, want ErrTypeMismatch", err)
+	}
+	if _, err := s.ReadString("Nope"); !errors.Is(err, setting.ErrNotConfigured) {
+		t.Errorf("unknown key: err = %v, want ErrNotConfigured", err)
+	}
+
+	changed := make(chan struct{}, 10)
+	unregister, err := s.RegisterChangeCallback(func() { changed <- struct{}{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unregister()
+	waitFor := func(key setting.Key, want string) {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			if got, _ := s.ReadString(key); got == want {
+				return
+			}
+			select {
+			case <-changed:
+			case <-timeout:
+				got, err := s.ReadString(key)
+				t.Fatalf("%s = %q, %v; want %q", key, got, err, want)
+			}
+		}
+	}
+
+	// Changes are picked up, but invalid fragments leave the previous
+	// settings in place.
+	write("90-override.json", `{"LoginURL": "https://override.example.com"}`)
+	waitFor("LoginURL", "https://override.example.com")
+	write("90-override.json", `{"LoginURL": `)
+	write("95-other.json", `{"Tailnet": "example.com"}`)
+	time.Sleep(100 * time.Millisecond)
+	if got, _ := s.ReadString("Tailnet"); got != "" {
+		t.Errorf("Tailnet = %q while a fragment is invalid; want it unset", got)
+	}
+	write("90-override.json", `{}`)
+	waitFor("Tailnet", "example.com")
+	waitFor("LoginURL", "https://login.example.com")
+
+	s.Close()
+	if _, err := s.ReadString("LoginURL"); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("after Close: err = %v, want ErrStoreClosed", err)
+	}
+}
+
+func TestDirPolicyStoreMissingDir(t *testing.T) {
+	old := dirPollInterval
+	dirPollInterval = 10 * time.Millisecond
+	defer func() { dirPollInterval = old }()
+
+	dir := filepath.Join(t.TempDir(), "policy.d")
+	s := NewDirPolicyStore(dir)
+	defer s.Close()
+	if _, err := s.ReadString("Tailnet"); !errors.Is(err, setting.ErrNotConfigured) {
+		t.Fatalf("err = %v, want ErrNotConfigured", err)
+	}
+
+	changed := make(chan struct{}, 1)
+	if _, err := s.RegisterChangeCallback(func() { changed <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fleet.json"), []byte(`{"Tailnet": "example.com"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("created directory was not picked up")
+	}
+	if got, err := s.ReadString("Tailnet"); err != nil || got != "example.com" {
+		t.Errorf("Tailnet = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !android
+
+package syspolicy
+
+import (
+	"tailscale.com/util/syspolicy/internal"
+	"tailscale.com/util/syspolicy/rsop"
+	"tailscale.com/util/syspolicy/setting"
+	"tailscale.com/util/syspolicy/source"
+	"tailscale.com/util/testenv"
+)
+
+func init() {
+	// On Linux, there's no platform-provided policy store, so we read
+	// the device's policy settings from the JSON fragments in
+	// /etc/tailscale/policy.d, which configuration management tools can
+	// drop in place. The directory is watched for changes, so it need not
+	// exist when we start.
+	internal.Init.MustDefer(func() error {
+		// Do not register or use default policy stores during tests.
+		// Each test should set up its own necessary configurations.
+		if testenv.InTest() {
+			return nil
+		}
+		_, err := rsop.RegisterStore("PolicyDir", setting.DeviceScope, source.NewDirPolicyStore(source.DefaultPolicyDir))
+		return err
+	})
+}
@@ -9,7 +9,9 @@
 	"errors"
 	"log"
 	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/mdlayher/sdnotify"
 )
@@ -30,8 +32,9 @@ func (l *logOnce) logf(format string, args ...any) {
 }
 
 var (
-	readyOnce  = &logOnce{}
-	statusOnce = &logOnce{}
+	readyOnce    = &logOnce{}
+	statusOnce   = &logOnce{}
+	watchdogOnce = &logOnce{}
 )
 
 func notifier() *sdnotify.Notifier {
@@ -75,3 +78,31 @@ func Status(format string, args ...any) {
 		statusOnce.logf("systemd: error notifying: %v", err)
 	}
 }
+
+// WatchdogInterval returns the watchdog timeout that systemd enforces on this
+// process, as configured with WatchdogSec= in its unit file, or zero if the
+// watchdog is not enabled. Once enabled, Watchdog must be called more often
+// than the timeout or systemd considers the process hung and acts on it, such
+// as by restarting it.
+func WatchdogInterval() time.Duration {
+	// See sd_watchdog_enabled(3).
+	usec, err := strconv.ParseUint(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec == 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		// The watchdog is meant for a different process, such as
+		// our parent.
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Watchdog tells systemd that the process is still alive, resetting its
+// watchdog timer. See WatchdogInterval.
+func Watchdog() {
+	err := notifier().Notify("WATCHDOG=1")
+	if err != nil {
+		watchdogOnce.logf("systemd: error notifying: %v", err)
+	}
+}
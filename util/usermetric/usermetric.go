@@ -97,6 +97,12 @@ func (r *Registry) Handler(w http.ResponseWriter, req *http.Request) {
 	varz.ExpvarDoHandler(r.vars.Do)(w, req)
 }
 
+// WritePrometheus writes the metrics in the registry to w in the Prometheus
+// text exposition format, as served by Handler.
+func (r *Registry) WritePrometheus(w io.Writer) {
+	varz.WritePrometheusExpvarDo(w, r.vars.Do)
+}
+
 // String returns the string representation of all the metrics and their
 // values in the registry. It is useful for debugging.
 func (r *Registry) String() string {
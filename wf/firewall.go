@@ -7,6 +7,7 @@
 package wf
 
 import (
+	"errors"
 	"fmt"
 	"net/netip"
 	"os"
@@ -14,6 +15,33 @@
 	"github.com/tailscale/wf"
 	"golang.org/x/sys/windows"
 	"tailscale.com/net/netaddr"
+	"tailscale.com/types/logger"
+)
+
+// ProviderID is the ID of the WFP provider that owns every sublayer and
+// filter Tailscale installs. It is fixed, rather than generated per session,
+// so that Tailscale's filters can be told apart from those of other software
+// and found again after the process that installed them is gone.
+var ProviderID = wf.ProviderID{
+	Data1: 0xee262c35,
+	Data2: 0xc384,
+	Data3: 0x4acc,
+	Data4: [8]byte{0xaf, 0xce, 0x03, 0x47, 0xf8, 0xed, 0xae, 0x15},
+}
+
+// sublayerID is the ID of the sublayer holding Tailscale's filters.
+var sublayerID = wf.SublayerID{
+	Data1: 0x8044a9fc,
+	Data2: 0x39ce,
+	Data3: 0x4901,
+	Data4: [8]byte{0x8d, 0xf9, 0xd7, 0x87, 0x0e, 0x1c, 0xf8, 0x34},
+}
+
+// WFP error codes, from fwpmu.h.
+const (
+	errFilterNotFound   = windows.Errno(0x80320003) // FWP_E_FILTER_NOT_FOUND
+	errProviderNotFound = windows.Errno(0x80320005) // FWP_E_PROVIDER_NOT_FOUND
+	errSublayerNotFound = windows.Errno(0x80320007) // FWP_E_SUBLAYER_NOT_FOUND
 )
 
 // Known addresses.
@@ -83,6 +111,7 @@ func ruleName(action wf.Action, l wf.LayerID, name string) string {
 // Firewall uses the Windows Filtering Platform to implement a network firewall.
 type Firewall struct {
 	luid       uint64
+	logf       logger.Logf
 	providerID wf.ProviderID
 	sublayerID wf.SublayerID
 	session    *wf.Session
@@ -90,8 +119,12 @@ type Firewall struct {
 	permittedRoutes map[netip.Prefix][]*wf.Rule
 }
 
-// New returns a new Firewall for the provided interface ID.
-func New(luid uint64) (*Firewall, error) {
+// New returns a new Firewall for the provided interface ID. Every rule it
+// adds or removes is logged to logf.
+//
+// Any filters left behind by a previous Firewall, for instance one whose
+// process was killed before its session went away, are removed first.
+func New(luid uint64, logf logger.Logf) (*Firewall, error) {
 	session, err := wf.New(&wf.Options{
 		Name:    "Tailscale firewall",
 		Dynamic: true,
@@ -99,42 +132,112 @@ func New(luid uint64) (*Firewall, error) {
 	if err != nil {
 		return nil, err
 	}
-	wguid, err := windows.GenerateGUID()
-	if err != nil {
-		return nil, err
+	if n, err := removeAll(session); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("removing stale filters: %w", err)
+	} else if n > 0 {
+		logf("removed %d stale filters", n)
 	}
-	providerID := wf.ProviderID(wguid)
 	if err := session.AddProvider(&wf.Provider{
-		ID:   providerID,
-		Name: "Tailscale provider",
+		ID:          ProviderID,
+		Name:        "Tailscale provider",
+		Description: "Owns all filters installed by Tailscale",
 	}); err != nil {
+		session.Close()
 		return nil, err
 	}
-	wguid, err = windows.GenerateGUID()
-	if err != nil {
-		return nil, err
-	}
-	sublayerID := wf.SublayerID(wguid)
 	if err := session.AddSublayer(&wf.Sublayer{
-		ID:     sublayerID,
-		Name:   "Tailscale permissive and blocking filters",
-		Weight: 0,
+		ID:       sublayerID,
+		Name:     "Tailscale permissive and blocking filters",
+		Provider: ProviderID,
+		Weight:   0,
 	}); err != nil {
+		session.Close()
 		return nil, err
 	}
 	f := &Firewall{
 		luid:            luid,
+		logf:            logf,
 		session:         session,
-		providerID:      providerID,
+		providerID:      ProviderID,
 		sublayerID:      sublayerID,
 		permittedRoutes: make(map[netip.Prefix][]*wf.Rule),
 	}
 	if err := f.enable(); err != nil {
+		f.Close()
 		return nil, err
 	}
 	return f, nil
 }
 
+// Close removes all of the firewall's filters, its sublayer and provider,
+// and closes its WFP session.
+func (f *Firewall) Close() error {
+	n, err := removeAll(f.session)
+	f.logf("removed %d filters", n)
+	return errors.Join(err, f.session.Close())
+}
+
+// Rules returns the WFP filters currently installed by Tailscale, whether
+// by this process or another.
+func Rules() ([]*wf.Rule, error) {
+	session, err := wf.New(&wf.Options{Name: "Tailscale firewall inspection"})
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	return tailscaleRules(session)
+}
+
+// Cleanup removes all WFP filters, sublayers and providers installed by
+// Tailscale, and reports how many filters it removed. It is meant for when
+// Tailscale is uninstalled or the process owning its filters has gone.
+func Cleanup() (int, error) {
+	session, err := wf.New(&wf.Options{Name: "Tailscale firewall cleanup"})
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	return removeAll(session)
+}
+
+func tailscaleRules(session *wf.Session) ([]*wf.Rule, error) {
+	rules, err := session.Rules()
+	if err != nil {
+		return nil, err
+	}
+	var ret []*wf.Rule
+	for _, r := range rules {
+		if r.Provider == ProviderID {
+			ret = append(ret, r)
+		}
+	}
+	return ret, nil
+}
+
+// removeAll removes Tailscale's filters, sublayer and provider using
+// session, and returns the number of filters removed.
+func removeAll(session *wf.Session) (int, error) {
+	rules, err := tailscaleRules(session)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, r := range rules {
+		if err := session.DeleteRule(r.ID); err != nil && !errors.Is(err, errFilterNotFound) {
+			return n, fmt.Errorf("deleting filter %q: %w", r.Name, err)
+		}
+		n++
+	}
+	if err := session.DeleteSublayer(sublayerID); err != nil && !errors.Is(err, errSublayerNotFound) {
+		return n, fmt.Errorf("deleting sublayer: %w", err)
+	}
+	if err := session.DeleteProvider(ProviderID); err != nil && !errors.Is(err, errProviderNotFound) {
+		return n, fmt.Errorf("deleting provider: %w", err)
+	}
+	return n, nil
+}
+
 type weight uint64
 
 const (
@@ -210,6 +313,7 @@ func (f *Firewall) UpdatePermittedRoutes(newRoutes []netip.Prefix) error {
 			if err := f.session.DeleteRule(rule.ID); err != nil {
 				return err
 			}
+			f.logf("deleted filter %q", rule.Name)
 		}
 		delete(f.permittedRoutes, r)
 	}
@@ -294,14 +398,18 @@ func (f *Firewall) newRule(name string, w weight, layer wf.LayerID, conditions [
 		return nil, err
 	}
 	return &wf.Rule{
-		Name:       ruleName(action, layer, name),
-		ID:         wf.RuleID(id),
-		Provider:   f.providerID,
-		Sublayer:   f.sublayerID,
-		Layer:      layer,
-		Weight:     uint64(w),
-		Conditions: conditions,
-		Action:     action,
+		Name:        ruleName(action, layer, name),
+		Description: "Installed by Tailscale",
+		ID:          wf.RuleID(id),
+		Provider:    f.providerID,
+		// ProviderData records which part of the firewall the rule
+		// belongs to, for auditing with "tailscale debug firewall".
+		ProviderData: []byte(name),
+		Sublayer:     f.sublayerID,
+		Layer:        layer,
+		Weight:       uint64(w),
+		Conditions:   conditions,
+		Action:       action,
 	}, nil
 }
 
@@ -315,6 +423,7 @@ func (f *Firewall) addRules(name string, w weight, conditions []*wf.Match, actio
 		if err := f.session.AddRule(r); err != nil {
 			return nil, err
 		}
+		f.logf("added filter %q", r.Name)
 		rules = append(rules, r)
 	}
 	return rules, nil
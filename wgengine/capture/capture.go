@@ -8,14 +8,18 @@
 	"bytes"
 	"context"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"net/http"
+	"net/netip"
 	"sync"
 	"time"
 
 	_ "embed"
 
+	"go4.org/mem"
 	"tailscale.com/net/packet"
+	"tailscale.com/types/key"
 	"tailscale.com/util/set"
 )
 
@@ -78,6 +82,87 @@ func writePktHeader(w *bytes.Buffer, when time.Time, length int) {
 	PathDisco Path = 254
 )
 
+func (p Path) String() string {
+	switch p {
+	case FromLocal:
+		return "from local"
+	case FromPeer:
+		return "from peer"
+	case SynthesizedToLocal:
+		return "synthesized to local"
+	case SynthesizedToPeer:
+		return "synthesized to peer"
+	case PathDisco:
+		return "disco frame"
+	}
+	return fmt.Sprintf("path %d", p)
+}
+
+// discoRecordSource returns the endpoint that the disco frame described by
+// the PathDisco record data was received from and, if it was received via
+// DERP, the node key of the DERP sender. The record is formatted by
+// disco.ToPCAPFrame.
+func discoRecordSource(data []byte) (src netip.AddrPort, derpNode key.NodePublic, ok bool) {
+	// 1b flags, 32b DERP node key, 2b port, 2b address length, address.
+	const addrOff = 1 + 32 + 2 + 2
+	if len(data) < addrOff {
+		return src, derpNode, false
+	}
+	port := binary.LittleEndian.Uint16(data[addrOff-4:])
+	n := int(binary.LittleEndian.Uint16(data[addrOff-2:]))
+	if len(data) < addrOff+n {
+		return src, derpNode, false
+	}
+	addr, ok := netip.AddrFromSlice(data[addrOff : addrOff+n])
+	if !ok {
+		return src, derpNode, false
+	}
+	if data[0]&0x01 != 0 {
+		derpNode = key.NodePublicFromRaw32(mem.B(data[1:33]))
+	}
+	return netip.AddrPortFrom(addr.Unmap(), port), derpNode, true
+}
+
+// Format is the file format of a capture stream.
+type Format uint8
+
+const (
+	// FormatPcap is the libpcap file format.
+	FormatPcap Format = iota
+	// FormatPcapNG is the pcapng file format. Each packet carries a
+	// comment that describes its Tailscale metadata.
+	FormatPcapNG
+)
+
+// ParseFormat parses the name of a capture format: "pcap" or "pcapng". The
+// empty string is FormatPcap.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "", "pcap":
+		return FormatPcap, nil
+	case "pcapng":
+		return FormatPcapNG, nil
+	}
+	return 0, fmt.Errorf("unknown capture format %q; want pcap or pcapng", s)
+}
+
+func (f Format) String() string {
+	if f == FormatPcapNG {
+		return "pcapng"
+	}
+	return "pcap"
+}
+
+// Options configure a capture output.
+type Options struct {
+	// Filter selects the packets written to the output.
+	// If nil, all packets are.
+	Filter *Filter
+
+	// Format is the file format of the output.
+	Format Format
+}
+
 // New creates a new capture sink.
 func New() *Sink {
 	ctx, c := context.WithCancel(context.Background())
@@ -88,35 +173,46 @@ func New() *Sink {
 }
 
 // Type Sink handles callbacks with packets to be logged,
-// formatting them into a pcap stream which is mirrored to
+// formatting them into a capture stream which is mirrored to
 // all registered outputs.
 type Sink struct {
 	ctx       context.Context
 	ctxCancel context.CancelFunc
 
 	mu         sync.Mutex
-	outputs    set.HandleSet[io.Writer]
+	outputs    set.HandleSet[*output]
 	flushTimer *time.Timer // or nil if none running
 }
 
+// output is an output registered with a Sink.
+type output struct {
+	w    io.Writer
+	opts Options
+}
+
 // RegisterOutput connects an output to this sink, which
-// will be written to with a pcap stream as packets are logged.
+// will be written to with a capture stream in the format given by opts
+// as packets matching opts.Filter are logged.
 // A function is returned which unregisters the output when
 // called.
 //
 // If w implements io.Closer, it will be closed upon error
 // or when the sink is closed. If w implements http.Flusher,
 // it will be flushed periodically.
-func (s *Sink) RegisterOutput(w io.Writer) (unregister func()) {
+func (s *Sink) RegisterOutput(w io.Writer, opts Options) (unregister func()) {
 	select {
 	case <-s.ctx.Done():
 		return func() {}
 	default:
 	}
 
-	writePcapHeader(w)
+	if opts.Format == FormatPcapNG {
+		writePcapngHeader(w)
+	} else {
+		writePcapHeader(w)
+	}
 	s.mu.Lock()
-	hnd := s.outputs.Add(w)
+	hnd := s.outputs.Add(&output{w: w, opts: opts})
 	s.mu.Unlock()
 
 	return func() {
@@ -146,7 +242,7 @@ func (s *Sink) Close() error {
 	}
 
 	for _, o := range s.outputs {
-		if o, ok := o.(io.Closer); ok {
+		if o, ok := o.w.(io.Closer); ok {
 			o.Close()
 		}
 	}
@@ -182,42 +278,69 @@ func (s *Sink) LogPacket(path Path, when time.Time, data []byte, meta packet.Cap
 	}
 
 	extraLen := customDataLen(meta)
-	b := bufferPool.Get().(*bytes.Buffer)
-	b.Reset()
-	b.Grow(16 + extraLen + len(data)) // 16b pcap header + len(metadata) + len(payload)
-	defer bufferPool.Put(b)
-
-	writePktHeader(b, when, len(data)+extraLen)
+	rec := bufferPool.Get().(*bytes.Buffer)
+	rec.Reset()
+	rec.Grow(extraLen + len(data)) // len(metadata) + len(payload)
+	defer bufferPool.Put(rec)
 
 	// Custom tailscale debugging data
-	binary.Write(b, binary.LittleEndian, uint16(path))
+	binary.Write(rec, binary.LittleEndian, uint16(path))
 	if meta.DidSNAT {
-		binary.Write(b, binary.LittleEndian, uint8(meta.OriginalSrc.Addr().BitLen()/8))
-		b.Write(meta.OriginalSrc.Addr().AsSlice())
+		binary.Write(rec, binary.LittleEndian, uint8(meta.OriginalSrc.Addr().BitLen()/8))
+		rec.Write(meta.OriginalSrc.Addr().AsSlice())
 	} else {
-		binary.Write(b, binary.LittleEndian, uint8(0)) // SNAT addr len == 0
+		binary.Write(rec, binary.LittleEndian, uint8(0)) // SNAT addr len == 0
 	}
 	if meta.DidDNAT {
-		binary.Write(b, binary.LittleEndian, uint8(meta.OriginalDst.Addr().BitLen()/8))
-		b.Write(meta.OriginalDst.Addr().AsSlice())
+		binary.Write(rec, binary.LittleEndian, uint8(meta.OriginalDst.Addr().BitLen()/8))
+		rec.Write(meta.OriginalDst.Addr().AsSlice())
 	} else {
-		binary.Write(b, binary.LittleEndian, uint8(0)) // DNAT addr len == 0
+		binary.Write(rec, binary.LittleEndian, uint8(0)) // DNAT addr len == 0
 	}
 
-	b.Write(data)
+	rec.Write(data)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// The framed packet in each format, built on first use.
+	var framed [FormatPcapNG + 1]*bytes.Buffer
+	defer func() {
+		for _, b := range framed {
+			if b != nil {
+				bufferPool.Put(b)
+			}
+		}
+	}()
+	frame := func(f Format) []byte {
+		if b := framed[f]; b != nil {
+			return b.Bytes()
+		}
+		b := bufferPool.Get().(*bytes.Buffer)
+		b.Reset()
+		framed[f] = b
+		if f == FormatPcapNG {
+			writePcapngPacket(b, when, rec.Bytes(), recordComment(path, data, meta))
+		} else {
+			b.Grow(16 + rec.Len()) // 16b pcap header + record
+			writePktHeader(b, when, rec.Len())
+			b.Write(rec.Bytes())
+		}
+		return b.Bytes()
+	}
+
 	var hadError []set.Handle
 	for hnd, o := range s.outputs {
-		if _, err := o.Write(b.Bytes()); err != nil {
+		if !o.opts.Filter.Match(path, data) {
+			continue
+		}
+		if _, err := o.w.Write(frame(o.opts.Format)); err != nil {
 			hadError = append(hadError, hnd)
 			continue
 		}
 	}
 	for _, hnd := range hadError {
-		if o, ok := s.outputs[hnd].(io.Closer); ok {
+		if o, ok := s.outputs[hnd].w.(io.Closer); ok {
 			o.Close()
 		}
 		delete(s.outputs, hnd)
@@ -228,7 +351,7 @@ func (s *Sink) LogPacket(path Path, when time.Time, data []byte, meta packet.Cap
 			s.mu.Lock()
 			defer s.mu.Unlock()
 			for _, o := range s.outputs {
-				if f, ok := o.(http.Flusher); ok {
+				if f, ok := o.w.(http.Flusher); ok {
 					f.Flush()
 				}
 			}
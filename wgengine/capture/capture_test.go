@@ -0,0 +1,153 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/disco"
+	"tailscale.com/net/packet"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/ipproto"
+	"tailscale.com/types/key"
+)
+
+func udpPacket(src, dst string) []byte {
+	s, d := netip.MustParseAddrPort(src), netip.MustParseAddrPort(dst)
+	h := packet.UDP4Header{
+		IP4Header: packet.IP4Header{IPProto: ipproto.UDP, Src: s.Addr(), Dst: d.Addr()},
+		SrcPort:   s.Port(),
+		DstPort:   d.Port(),
+	}
+	return packet.Generate(h, []byte("hi"))
+}
+
+func TestFilter(t *testing.T) {
+	dns := udpPacket("100.64.0.1:5353", "100.100.100.100:53")
+	derpNode := key.NewNode().Public()
+	discoDirect := disco.ToPCAPFrame(netip.MustParseAddrPort("1.2.3.4:41641"), key.NodePublic{}, []byte("ping"))
+	discoDERP := disco.ToPCAPFrame(netip.AddrPortFrom(tailcfg.DerpMagicIPAddr, 7), derpNode, []byte("ping"))
+
+	tests := []struct {
+		expr string
+		path Path
+		data []byte
+		want bool
+	}{
+		{"", FromLocal, dns, true},
+		{"udp", FromLocal, dns, true},
+		{"tcp", FromLocal, dns, false},
+		{"proto 17", FromLocal, dns, true},
+		{"host 100.100.100.100", FromLocal, dns, true},
+		{"src host 100.100.100.100", FromLocal, dns, false},
+		{"dst net 100.100.0.0/16 and port 53", FromLocal, dns, true},
+		{"port 53 and not udp", FromLocal, dns, false},
+		{"tcp or (udp and dst port 53)", FromLocal, dns, true},
+		{"!(udp)", FromLocal, dns, false},
+		{"outbound", FromLocal, dns, true},
+		{"inbound", FromLocal, dns, false},
+		{"disco", FromLocal, dns, false},
+		{"disco", PathDisco, discoDirect, true},
+		{"udp", PathDisco, discoDirect, false},
+		{"disco and host 1.2.3.4 and port 41641", PathDisco, discoDirect, true},
+		{"disco and src host 1.2.3.4", PathDisco, discoDERP, false},
+		{"disco and port 7", PathDisco, discoDERP, true},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.expr, err)
+			continue
+		}
+		if f.String() != tt.expr {
+			t.Errorf("ParseFilter(%q).String() = %q", tt.expr, f.String())
+		}
+		if got := f.Match(tt.path, tt.data); got != tt.want {
+			t.Errorf("filter %q on %v: Match = %v, want %v", tt.expr, tt.path, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"host", "host foo", "port 70000", "tcp and", "(tcp", "tcp)", "src tcp", "proto nope", "bogus"} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("ParseFilter(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestSinkOutputs(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	var all, pcapng bytes.Buffer
+	tcpOnly := new(bytes.Buffer)
+	s.RegisterOutput(&all, Options{})
+	f, err := ParseFilter("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RegisterOutput(tcpOnly, Options{Filter: f})
+	s.RegisterOutput(&pcapng, Options{Format: FormatPcapNG})
+	headerLen := tcpOnly.Len()
+
+	when := time.Unix(1700000000, 0)
+	dns := udpPacket("100.64.0.1:5353", "100.100.100.100:53")
+	meta := packet.CaptureMeta{DidSNAT: true, OriginalSrc: netip.MustParseAddrPort("100.64.0.9:5353")}
+	s.LogPacket(FromLocal, when, dns, meta)
+	s.LogPacket(PathDisco, when, disco.ToPCAPFrame(netip.AddrPortFrom(tailcfg.DerpMagicIPAddr, 7), key.NewNode().Public(), []byte("ping")), packet.CaptureMeta{})
+
+	if tcpOnly.Len() != headerLen {
+		t.Errorf("filtered output got %d bytes of packets, want none", tcpOnly.Len()-headerLen)
+	}
+	recLen := 2 + 1 + 4 + 1 + len(dns) // path + SNAT address + DNAT address + packet
+	if want := headerLen + 16 + recLen; all.Len() <= want {
+		t.Errorf("pcap output is %d bytes, want more than %d", all.Len(), want)
+	}
+
+	// Walk the pcapng blocks, checking that they are well-formed and
+	// collecting the packet comments.
+	b := pcapng.Bytes()
+	var types []uint32
+	var comments []string
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("truncated block: %x", b)
+		}
+		typ, n := binary.LittleEndian.Uint32(b), int(binary.LittleEndian.Uint32(b[4:]))
+		if n%4 != 0 || n > len(b) || binary.LittleEndian.Uint32(b[n-4:]) != uint32(n) {
+			t.Fatalf("malformed block of type %#x and length %d", typ, n)
+		}
+		types = append(types, typ)
+		if typ == pcapngBlockEPB {
+			capLen := int(binary.LittleEndian.Uint32(b[20:]))
+			opts := b[28+(capLen+3)&^3 : n-4]
+			if len(opts) >= 4 && binary.LittleEndian.Uint16(opts) == pcapngOptComment {
+				comments = append(comments, string(opts[4:4+binary.LittleEndian.Uint16(opts[2:])]))
+			}
+		}
+		b = b[n:]
+	}
+	wantTypes := []uint32{pcapngBlockSHB, pcapngBlockIDB, pcapngBlockEPB, pcapngBlockEPB}
+	if len(types) != len(wantTypes) {
+		t.Fatalf("pcapng block types = %#x, want %#x", types, wantTypes)
+	}
+	for i := range types {
+		if types[i] != wantTypes[i] {
+			t.Fatalf("pcapng block types = %#x, want %#x", types, wantTypes)
+		}
+	}
+	if len(comments) != 2 {
+		t.Fatalf("got comments %q, want 2", comments)
+	}
+	if want := "from local; pre-NAT source 100.64.0.9"; comments[0] != want {
+		t.Errorf("comment = %q, want %q", comments[0], want)
+	}
+	if !strings.HasPrefix(comments[1], "disco frame via DERP region 7 from [") {
+		t.Errorf("comment = %q, want a DERP disco frame", comments[1])
+	}
+}
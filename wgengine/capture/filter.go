@@ -0,0 +1,344 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package capture
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"tailscale.com/net/packet"
+	"tailscale.com/types/ipproto"
+)
+
+// Filter selects the packets that are written to a capture output.
+//
+// Filters are parsed from expressions in a subset of the tcpdump/BPF filter
+// syntax by ParseFilter. A nil *Filter matches every packet.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// String returns the expression f was parsed from.
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+// ParseFilter parses a filter expression. The expression is made of the
+// following primitives, combined with "and" (or "&&"), "or" (or "||"),
+// "not" (or "!") and parentheses:
+//
+//   - [src|dst] host ADDR: packets from and/or to the IP address ADDR
+//   - [src|dst] net PREFIX: packets from and/or to addresses in the CIDR PREFIX
+//   - [src|dst] port N: TCP, UDP or SCTP packets from and/or to port N
+//   - proto NAME: packets of IP protocol NAME, such as "tcp" or "47"
+//   - tcp, udp, icmp, icmp6, tsmp, sctp: shorthands for proto NAME
+//   - disco: disco frames
+//   - inbound, outbound: packets to or from the local system
+//
+// For disco frames, host, net and port match the endpoint the frame was
+// received from. An empty expression matches every packet and parses to a
+// nil *Filter.
+func ParseFilter(expr string) (*Filter, error) {
+	p := &filterParser{toks: tokenizeFilter(expr)}
+	if len(p.toks) == 0 {
+		return nil, nil
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture filter %q: %w", expr, err)
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, fmt.Errorf("invalid capture filter %q: unexpected %q", expr, tok)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// Match reports whether the packet data, captured at path, is selected by f.
+func (f *Filter) Match(path Path, data []byte) bool {
+	if f == nil {
+		return true
+	}
+	var r filterRecord
+	r.decode(path, data)
+	return f.root.match(&r)
+}
+
+// filterRecord is the information about a captured packet that filters
+// match against.
+type filterRecord struct {
+	path     Path
+	proto    ipproto.Proto // or 0 for disco frames
+	src, dst netip.AddrPort
+}
+
+func (r *filterRecord) decode(path Path, data []byte) {
+	r.path = path
+	if path != PathDisco {
+		var p packet.Parsed
+		p.Decode(data)
+		if p.IPVersion == 0 {
+			return
+		}
+		r.proto, r.src, r.dst = p.IPProto, p.Src, p.Dst
+		return
+	}
+	r.src, _, _ = discoRecordSource(data)
+}
+
+type filterNode interface {
+	match(*filterRecord) bool
+}
+
+type (
+	andNode [2]filterNode
+	orNode  [2]filterNode
+	notNode struct{ filterNode }
+)
+
+func (n andNode) match(r *filterRecord) bool { return n[0].match(r) && n[1].match(r) }
+func (n orNode) match(r *filterRecord) bool  { return n[0].match(r) || n[1].match(r) }
+func (n notNode) match(r *filterRecord) bool { return !n.filterNode.match(r) }
+
+// direction is the src/dst qualifier of host, net and port primitives.
+type direction uint8
+
+const (
+	srcOrDst direction = iota
+	srcOnly
+	dstOnly
+)
+
+func (d direction) String() string {
+	switch d {
+	case srcOnly:
+		return "src"
+	case dstOnly:
+		return "dst"
+	}
+	return ""
+}
+
+func (d direction) match(r *filterRecord, f func(netip.AddrPort) bool) bool {
+	switch d {
+	case srcOnly:
+		return f(r.src)
+	case dstOnly:
+		return f(r.dst)
+	}
+	return f(r.src) || f(r.dst)
+}
+
+type netNode struct {
+	dir    direction
+	prefix netip.Prefix
+}
+
+func (n netNode) match(r *filterRecord) bool {
+	return n.dir.match(r, func(ap netip.AddrPort) bool { return ap.IsValid() && n.prefix.Contains(ap.Addr()) })
+}
+
+type portNode struct {
+	dir  direction
+	port uint16
+}
+
+func (n portNode) match(r *filterRecord) bool {
+	switch r.proto {
+	case ipproto.TCP, ipproto.UDP, ipproto.SCTP:
+	default:
+		if r.path != PathDisco {
+			return false
+		}
+	}
+	return n.dir.match(r, func(ap netip.AddrPort) bool { return ap.IsValid() && ap.Port() == n.port })
+}
+
+type protoNode ipproto.Proto
+
+func (n protoNode) match(r *filterRecord) bool {
+	return r.path != PathDisco && r.proto == ipproto.Proto(n)
+}
+
+type pathNode func(Path) bool
+
+func (n pathNode) match(r *filterRecord) bool { return n(r.path) }
+
+func tokenizeFilter(expr string) []string {
+	var toks []string
+	for _, f := range strings.Fields(expr) {
+		// Split off parentheses and "!", which need not be
+		// separated from their operands by spaces.
+		for f != "" {
+			if i := strings.IndexAny(f, "()!"); i > 0 {
+				toks = append(toks, f[:i])
+				f = f[i:]
+			} else if i == 0 {
+				toks = append(toks, f[:1])
+				f = f[1:]
+			} else {
+				toks = append(toks, f)
+				break
+			}
+		}
+	}
+	return toks
+}
+
+type filterParser struct {
+	toks []string
+}
+
+func (p *filterParser) peek() (string, bool) {
+	if len(p.toks) == 0 {
+		return "", false
+	}
+	return p.toks[0], true
+}
+
+func (p *filterParser) next() (string, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return "", fmt.Errorf("unexpected end of expression")
+	}
+	p.toks = p.toks[1:]
+	return tok, nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	n, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if tok, _ := p.peek(); tok != "or" && tok != "||" {
+			return n, nil
+		}
+		p.toks = p.toks[1:]
+		m, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		n = orNode{n, m}
+	}
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	n, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if tok, _ := p.peek(); tok != "and" && tok != "&&" {
+			return n, nil
+		}
+		p.toks = p.toks[1:]
+		m, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		n = andNode{n, m}
+	}
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case "not", "!":
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	case "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok, err := p.next(); err != nil || tok != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return n, nil
+	}
+	return p.parsePrimitive(tok)
+}
+
+func (p *filterParser) parsePrimitive(tok string) (filterNode, error) {
+	dir := srcOrDst
+	switch tok {
+	case "src", "dst":
+		dir = srcOnly
+		if tok == "dst" {
+			dir = dstOnly
+		}
+		var err error
+		if tok, err = p.next(); err != nil {
+			return nil, err
+		}
+		switch tok {
+		case "host", "net", "port":
+		default:
+			return nil, fmt.Errorf("want host, net or port after %q, got %q", dir, tok)
+		}
+	}
+	switch tok {
+	case "host", "net", "port", "proto":
+		arg, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch tok {
+		case "host":
+			ip, err := netip.ParseAddr(arg)
+			if err != nil {
+				return nil, err
+			}
+			return netNode{dir, netip.PrefixFrom(ip, ip.BitLen())}, nil
+		case "net":
+			pfx, err := netip.ParsePrefix(arg)
+			if err != nil {
+				return nil, err
+			}
+			return netNode{dir, pfx.Masked()}, nil
+		case "port":
+			port, err := strconv.ParseUint(arg, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port %q", arg)
+			}
+			return portNode{dir, uint16(port)}, nil
+		}
+		var proto ipproto.Proto
+		if err := proto.UnmarshalText([]byte(arg)); err != nil {
+			return nil, err
+		}
+		return protoNode(proto), nil
+	case "tcp":
+		return protoNode(ipproto.TCP), nil
+	case "udp":
+		return protoNode(ipproto.UDP), nil
+	case "icmp":
+		return protoNode(ipproto.ICMPv4), nil
+	case "icmp6":
+		return protoNode(ipproto.ICMPv6), nil
+	case "tsmp":
+		return protoNode(ipproto.TSMP), nil
+	case "sctp":
+		return protoNode(ipproto.SCTP), nil
+	case "disco":
+		return pathNode(func(p Path) bool { return p == PathDisco }), nil
+	case "inbound":
+		return pathNode(func(p Path) bool { return p == FromPeer || p == SynthesizedToLocal }), nil
+	case "outbound":
+		return pathNode(func(p Path) bool { return p == FromLocal || p == SynthesizedToPeer }), nil
+	}
+	return nil, fmt.Errorf("unknown primitive %q", tok)
+}
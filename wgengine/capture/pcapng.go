@@ -0,0 +1,128 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"tailscale.com/net/packet"
+	"tailscale.com/tailcfg"
+)
+
+// pcapng is described by
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-02.html.
+// Captures have a single section with a single interface, and every packet
+// is an Enhanced Packet Block with the same Tailscale debug record as in pcap
+// captures. What pcapng adds is a comment on each packet that describes the
+// metadata in the record, so it's readable without the Lua dissector.
+
+const (
+	pcapngBlockSHB = 0x0A0D0D0A // Section Header Block
+	pcapngBlockIDB = 0x00000001 // Interface Description Block
+	pcapngBlockEPB = 0x00000006 // Enhanced Packet Block
+
+	pcapngOptEnd         = 0
+	pcapngOptComment     = 1
+	pcapngOptIfName      = 2 // in IDBs
+	pcapngOptShbUserAppl = 4 // in SHBs
+)
+
+// appendPcapngOption appends the pcapng option with the given code and value
+// to b, padded to 32 bits.
+func appendPcapngOption(b []byte, code uint16, val string) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(val)))
+	b = append(b, val...)
+	return appendPadding(b, len(val))
+}
+
+func appendPadding(b []byte, n int) []byte {
+	for n%4 != 0 {
+		b = append(b, 0)
+		n++
+	}
+	return b
+}
+
+// appendPcapngBlock appends a pcapng block of type typ with the given body to
+// b.
+func appendPcapngBlock(b []byte, typ uint32, body []byte) []byte {
+	total := uint32(12 + len(body))
+	b = binary.LittleEndian.AppendUint32(b, typ)
+	b = binary.LittleEndian.AppendUint32(b, total)
+	b = append(b, body...)
+	return binary.LittleEndian.AppendUint32(b, total)
+}
+
+func writePcapngHeader(w io.Writer) {
+	var shb []byte
+	shb = binary.LittleEndian.AppendUint32(shb, 0x1A2B3C4D) // byte-order magic
+	shb = binary.LittleEndian.AppendUint16(shb, 1)          // version major
+	shb = binary.LittleEndian.AppendUint16(shb, 0)          // version minor
+	shb = binary.LittleEndian.AppendUint64(shb, ^uint64(0)) // section length: unspecified
+	shb = appendPcapngOption(shb, pcapngOptShbUserAppl, "tailscaled")
+	shb = appendPcapngOption(shb, pcapngOptEnd, "")
+
+	var idb []byte
+	idb = binary.LittleEndian.AppendUint16(idb, 147)   // link-layer ID - USER0
+	idb = binary.LittleEndian.AppendUint16(idb, 0)     // reserved
+	idb = binary.LittleEndian.AppendUint32(idb, 65535) // max packet len
+	idb = appendPcapngOption(idb, pcapngOptIfName, "tailscale")
+	idb = appendPcapngOption(idb, pcapngOptEnd, "")
+
+	w.Write(appendPcapngBlock(appendPcapngBlock(nil, pcapngBlockSHB, shb), pcapngBlockIDB, idb))
+}
+
+// writePcapngPacket writes an Enhanced Packet Block with the given record and
+// comment to w.
+func writePcapngPacket(w *bytes.Buffer, when time.Time, record []byte, comment string) {
+	us := uint64(when.UnixMicro())
+	var epb []byte
+	epb = binary.LittleEndian.AppendUint32(epb, 0) // interface ID
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(us>>32))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(us))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(record))) // length present
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(record))) // total length
+	epb = append(epb, record...)
+	epb = appendPadding(epb, len(record))
+	if comment != "" {
+		epb = appendPcapngOption(epb, pcapngOptComment, comment)
+		epb = appendPcapngOption(epb, pcapngOptEnd, "")
+	}
+	w.Write(appendPcapngBlock(nil, pcapngBlockEPB, epb))
+}
+
+// recordComment describes the Tailscale metadata of a captured packet.
+func recordComment(path Path, data []byte, meta packet.CaptureMeta) string {
+	var sb strings.Builder
+	sb.WriteString(path.String())
+	if path == PathDisco {
+		writeDiscoComment(&sb, data)
+	}
+	if meta.DidSNAT {
+		fmt.Fprintf(&sb, "; pre-NAT source %v", meta.OriginalSrc.Addr())
+	}
+	if meta.DidDNAT {
+		fmt.Fprintf(&sb, "; pre-NAT destination %v", meta.OriginalDst.Addr())
+	}
+	return sb.String()
+}
+
+// writeDiscoComment describes the source of the disco frame record data to
+// sb.
+func writeDiscoComment(sb *strings.Builder, data []byte) {
+	src, derpNode, ok := discoRecordSource(data)
+	switch {
+	case !ok:
+	case src.Addr() == tailcfg.DerpMagicIPAddr:
+		fmt.Fprintf(sb, " via DERP region %d from %v", src.Port(), derpNode.ShortString())
+	default:
+		fmt.Fprintf(sb, " from %v", src)
+	}
+}
@@ -9,6 +9,7 @@
 	"net/netip"
 	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go4.org/netipx"
@@ -71,6 +72,18 @@ type Filter struct {
 type filterState struct {
 	mu  sync.Mutex
 	lru *flowtrack.Cache[struct{}] // from flowtrack.Tuple -> struct{}
+
+	// flows are the flows let through, from the tuple of the side that
+	// started them, for Flows and KillFlow.
+	flows      *flowtrack.Cache[flow]
+	lastFlowID uint64
+
+	// killed are the flows killed by KillFlow, from the tuple of the side
+	// that started them to when to stop dropping their packets.
+	killed map[flowtrack.Tuple]time.Time
+	// anyKilled is whether killed is non-empty, to skip locking mu for
+	// every packet in the common case.
+	anyKilled atomic.Bool
 }
 
 // lruMax is the size of the LRU cache in filterState.
@@ -197,7 +210,8 @@ func New(matches []Match, capTest CapTestFunc, localNets, logIPs *netipx.IPSet,
 		state = shareStateWith.state
 	} else {
 		state = &filterState{
-			lru: &flowtrack.Cache[struct{}]{MaxEntries: lruMax},
+			lru:   &flowtrack.Cache[struct{}]{MaxEntries: lruMax},
+			flows: &flowtrack.Cache[flow]{MaxEntries: flowsMax},
 		}
 	}
 
@@ -364,7 +378,7 @@ func (f *Filter) Check(srcIP, dstIP netip.Addr, dstPort uint16, proto ipproto.Pr
 		pkt.TCPFlags = packet.TCPSyn
 	}
 
-	return f.RunIn(pkt, 0)
+	return f.runIn(pkt, 0, false)
 }
 
 // CheckTCP determines whether TCP traffic from srcIP to dstIP:dstPort
@@ -409,12 +423,22 @@ func (f *Filter) ShieldsUp() bool { return f.shieldsUp }
 // RunIn determines whether this node is allowed to receive q from a
 // Tailscale peer.
 func (f *Filter) RunIn(q *packet.Parsed, rf RunFlags) Response {
+	return f.runIn(q, rf, true)
+}
+
+// runIn implements RunIn. If track is false, q is a synthesized packet that
+// mustn't affect the filter's state.
+func (f *Filter) runIn(q *packet.Parsed, rf RunFlags, track bool) Response {
 	dir := in
 	r := f.pre(q, rf, dir)
 	if r == Accept || r == Drop {
 		// already logged
 		return r
 	}
+	if track && f.state.flowKilled(q) {
+		f.logRateLimit(rf, q, dir, Drop, "killed flow")
+		return Drop
+	}
 
 	var why string
 	switch q.IPVersion {
@@ -426,6 +450,9 @@ func (f *Filter) RunIn(q *packet.Parsed, rf RunFlags) Response {
 		r, why = Drop, "not-ip"
 	}
 	f.logRateLimit(rf, q, dir, r, why)
+	if track && r == Accept {
+		f.state.noteFlow(q, dir)
+	}
 	return r
 }
 
@@ -438,8 +465,15 @@ func (f *Filter) RunOut(q *packet.Parsed, rf RunFlags) Response {
 		// already logged
 		return r
 	}
+	if f.state.flowKilled(q) {
+		f.logRateLimit(rf, q, dir, Drop, "killed flow")
+		return Drop
+	}
 	r, why := f.runOut(q)
 	f.logRateLimit(rf, q, dir, r, why)
+	if r == Accept {
+		f.state.noteFlow(q, dir)
+	}
 	return r
 }
 
@@ -574,7 +608,7 @@ func (f *Filter) runIn6(q *packet.Parsed) (r Response, why string) {
 	return Drop, "no rules matched"
 }
 
-// runIn runs the output-specific part of the filter logic.
+// runOut runs the output-specific part of the filter logic.
 func (f *Filter) runOut(q *packet.Parsed) (r Response, why string) {
 	switch q.IPProto {
 	case ipproto.UDP, ipproto.SCTP:
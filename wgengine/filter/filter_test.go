@@ -236,6 +236,82 @@ func TestUDPState(t *testing.T) {
 	}
 }
 
+func TestKillFlow(t *testing.T) {
+	acl := newFilter(t.Logf)
+	flags := LogDrops | LogAccepts
+
+	syn := parsed(ipproto.TCP, "8.1.1.1", "1.2.3.4", 999, 22)
+	ack := syn
+	ack.TCPFlags = packet.TCPAck
+	reply := parsed(ipproto.TCP, "1.2.3.4", "8.1.1.1", 22, 999)
+	reply.TCPFlags = packet.TCPAck
+	udpOut := parsed(ipproto.UDP, "1.2.3.4", "8.8.8.8", 4242, 53)
+	udpIn := parsed(ipproto.UDP, "8.8.8.8", "1.2.3.4", 53, 4242)
+
+	for _, p := range []*packet.Parsed{&syn, &ack} {
+		if got := acl.RunIn(p, flags); got != Accept {
+			t.Fatalf("RunIn(%v) = %v; want Accept", p, got)
+		}
+	}
+	if got := acl.RunOut(&udpOut, flags); got != Accept {
+		t.Fatalf("RunOut(%v) = %v; want Accept", udpOut, got)
+	}
+	if got := acl.RunIn(&udpIn, flags); got != Accept {
+		t.Fatalf("RunIn(%v) = %v; want Accept", udpIn, got)
+	}
+	// Checking a synthesized packet doesn't count as a flow.
+	if got := acl.CheckTCP(mustIP("8.2.2.2"), mustIP("1.2.3.4"), 22); got != Accept {
+		t.Fatalf("CheckTCP = %v; want Accept", got)
+	}
+
+	flows := acl.Flows()
+	if len(flows) != 2 {
+		t.Fatalf("got %d flows; want 2: %+v", len(flows), flows)
+	}
+	udp, tcp := flows[0], flows[1]
+	if udp.Inbound || udp.Tuple != flowtrack.MakeTuple(ipproto.UDP, udpOut.Src, udpOut.Dst) {
+		t.Errorf("flows[0] = %+v; want outbound %v", udp, udpOut)
+	}
+	if !tcp.Inbound || tcp.Tuple != flowtrack.MakeTuple(ipproto.TCP, syn.Src, syn.Dst) {
+		t.Errorf("flows[1] = %+v; want inbound %v", tcp, syn)
+	}
+
+	if acl.KillFlow(12345) {
+		t.Errorf("KillFlow of unknown ID succeeded")
+	}
+	if !acl.KillFlow(tcp.ID) || !acl.KillFlow(udp.ID) {
+		t.Fatalf("KillFlow failed")
+	}
+	for _, p := range []*packet.Parsed{&ack, &udpIn} {
+		if got := acl.RunIn(p, flags); got != Drop {
+			t.Errorf("RunIn(%v) of killed flow = %v; want Drop", p, got)
+		}
+	}
+	for _, p := range []*packet.Parsed{&reply, &udpOut} {
+		if got := acl.RunOut(p, flags); got != Drop {
+			t.Errorf("RunOut(%v) of killed flow = %v; want Drop", p, got)
+		}
+	}
+	if flows := acl.Flows(); !flows[0].Killed || !flows[1].Killed {
+		t.Errorf("flows not marked killed: %+v", flows)
+	}
+
+	// A new TCP connection with the same tuple is let through again, and
+	// it's a new flow.
+	for _, p := range []*packet.Parsed{&syn, &ack} {
+		if got := acl.RunIn(p, flags); got != Accept {
+			t.Fatalf("RunIn(%v) after new SYN = %v; want Accept", p, got)
+		}
+	}
+	if flows := acl.Flows(); flows[0].ID == tcp.ID || flows[0].Killed {
+		t.Errorf("flows[0] = %+v; want new flow", flows[0])
+	}
+	// The UDP flow stays killed.
+	if got := acl.RunIn(&udpIn, flags); got != Drop {
+		t.Errorf("RunIn(%v) of killed flow = %v; want Drop", udpIn, got)
+	}
+}
+
 func TestNoAllocs(t *testing.T) {
 	acl := newFilter(t.Logf)
 
@@ -0,0 +1,175 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package filter
+
+import (
+	"cmp"
+	"net/netip"
+	"slices"
+	"time"
+
+	"tailscale.com/net/flowtrack"
+	"tailscale.com/net/packet"
+	"tailscale.com/types/ipproto"
+)
+
+// flowsMax is the number of flows tracked in filterState for Flows.
+const flowsMax = 1024
+
+// killedFlowTimeout is how long the packets of a flow killed by KillFlow are
+// dropped for.
+const killedFlowTimeout = 10 * time.Minute
+
+// Flow is a TCP, UDP or SCTP flow that the filter let through.
+type Flow struct {
+	// ID identifies the flow for KillFlow. IDs are assigned in the order
+	// flows are seen and are not reused.
+	ID uint64
+
+	// Tuple is the flow's 5-tuple as sent by the side that started it.
+	Tuple flowtrack.Tuple
+
+	// Inbound is whether the flow was started by a Tailscale peer, rather
+	// than by this node (or a host behind it, for subnet routers).
+	Inbound bool
+
+	// Created is when the filter first saw the flow.
+	Created time.Time
+
+	// Killed is whether the flow was killed by KillFlow and its packets are
+	// being dropped.
+	Killed bool
+}
+
+// flow is the value type of filterState.flows.
+type flow struct {
+	id      uint64
+	inbound bool
+	created time.Time
+	killed  bool
+}
+
+// isFlowProto reports whether proto is one whose flows are tracked.
+func isFlowProto(proto ipproto.Proto) bool {
+	switch proto {
+	case ipproto.TCP, ipproto.UDP, ipproto.SCTP:
+		return true
+	}
+	return false
+}
+
+// noteFlow records the flow of q, which the filter accepted, if it's new.
+// TCP flows are only recorded from their initial SYN.
+func (s *filterState) noteFlow(q *packet.Parsed, dir direction) {
+	if !isFlowProto(q.IPProto) || (q.IPProto == ipproto.TCP && !q.IsTCPSyn()) {
+		return
+	}
+	t := flowtrack.MakeTuple(q.IPProto, q.Src, q.Dst)
+	rt := flowtrack.MakeTuple(q.IPProto, q.Dst, q.Src)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fl, ok := s.flows.Get(t); ok && !fl.killed {
+		return
+	}
+	if _, ok := s.flows.Get(rt); ok {
+		// A reply within a flow started by the other side.
+		return
+	}
+	s.lastFlowID++
+	s.flows.Add(t, flow{
+		id:      s.lastFlowID,
+		inbound: dir == in,
+		created: time.Now(),
+	})
+}
+
+// flowKilled reports whether q belongs to a flow killed by KillFlow, in
+// either direction.
+func (s *filterState) flowKilled(q *packet.Parsed) bool {
+	if !s.anyKilled.Load() || !isFlowProto(q.IPProto) {
+		return false
+	}
+	t := flowtrack.MakeTuple(q.IPProto, q.Src, q.Dst)
+	rt := flowtrack.MakeTuple(q.IPProto, q.Dst, q.Src)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range [...]flowtrack.Tuple{t, rt} {
+		until, ok := s.killed[k]
+		if !ok {
+			continue
+		}
+		if now.After(until) || (k == t && q.IPProto == ipproto.TCP && q.IsTCPSyn()) {
+			// Expired, or the initiator is reusing the tuple for a new
+			// connection.
+			delete(s.killed, k)
+			s.anyKilled.Store(len(s.killed) > 0)
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// Flows returns the most recent flows that the filter let through, newest
+// first.
+//
+// The filter doesn't see TCP connections end, so flows are only forgotten
+// as newer ones replace them.
+func (f *Filter) Flows() []Flow {
+	s := f.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]Flow, 0, s.flows.Len())
+	for t, fl := range s.flows.All() {
+		ret = append(ret, Flow{
+			ID:      fl.id,
+			Tuple:   t,
+			Inbound: fl.inbound,
+			Created: fl.created,
+			Killed:  fl.killed,
+		})
+	}
+	slices.SortFunc(ret, func(a, b Flow) int { return cmp.Compare(b.ID, a.ID) })
+	return ret
+}
+
+// KillFlow makes the filter drop the packets of the flow with the given ID,
+// as returned by Flows, in both directions. It reports whether the flow was
+// found.
+//
+// The endpoints aren't told; their connection stalls until they time it out.
+// Packets are dropped for 10 minutes, or for TCP until the initiator starts a
+// new connection with the same tuple.
+func (f *Filter) KillFlow(id uint64) bool {
+	s := f.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t, fl := range s.flows.All() {
+		if fl.id != id {
+			continue
+		}
+		fl.killed = true
+		if s.killed == nil {
+			s.killed = make(map[flowtrack.Tuple]time.Time)
+		}
+		now := time.Now()
+		for k, until := range s.killed {
+			if now.After(until) {
+				delete(s.killed, k)
+			}
+		}
+		s.killed[t] = now.Add(killedFlowTimeout)
+		s.anyKilled.Store(true)
+
+		// Forget that replies to an outbound UDP flow are allowed.
+		s.lru.Remove(flowtrack.MakeTuple(t.Proto(),
+			netip.AddrPortFrom(t.DstAddr(), t.DstPort()),
+			netip.AddrPortFrom(t.SrcAddr(), t.SrcPort())))
+		return true
+	}
+	return false
+}
@@ -10,9 +10,11 @@
 	"maps"
 	"net"
 	"net/netip"
+	"os"
 	"reflect"
 	"runtime"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
@@ -20,6 +22,7 @@
 	"github.com/tailscale/wireguard-go/conn"
 	"tailscale.com/derp"
 	"tailscale.com/derp/derphttp"
+	"tailscale.com/envknob"
 	"tailscale.com/health"
 	"tailscale.com/logtail/backoff"
 	"tailscale.com/net/dnscache"
@@ -407,6 +410,7 @@ func (c *Conn) derpWriteChanForRegion(regionID int, peer key.NodePublic) chan<-
 	dc.NotePreferred(c.myDerp == regionID)
 	dc.SetAddressFamilySelector(derpAddrFamSelector{c})
 	dc.DNSCache = dnscache.Get()
+	dc.AdmitToken = c.derpAdmitToken
 
 	ctx, cancel := context.WithCancel(c.connCtx)
 	ch := make(chan derpWriteRequest, bufferedDerpWritesBeforeDrop())
@@ -451,6 +455,45 @@ func (c *Conn) derpWriteChanForRegion(regionID int, peer key.NodePublic) chan<-
 	return ad.writeCh
 }
 
+// derpAdmitTokenFile is the file of DERP admit tokens read by
+// derpAdmitToken.
+var derpAdmitTokenFile = envknob.RegisterString("TS_DERP_ADMIT_TOKEN_FILE")
+
+// derpAdmitToken returns the admission token to present to the DERP server
+// with the given host name, if any, for servers that admit clients by tokens
+// (see derp.SignAdmitToken). Tokens are read from the file named by
+// TS_DERP_ADMIT_TOKEN_FILE on each connect, so that they can be renewed
+// without restarting, and are only sent to the servers listed in it.
+func (c *Conn) derpAdmitToken(host string) string {
+	path := derpAdmitTokenFile()
+	if path == "" {
+		return ""
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		c.logf("magicsock: reading DERP admit tokens: %v", err)
+		return ""
+	}
+	return parseDERPAdmitToken(b, host)
+}
+
+// parseDERPAdmitToken returns the token for host in the DERP admit token file
+// contents b, or the empty string if there's none. Each line of the file is a
+// DERP server host name and the token to present to it, separated by
+// whitespace. Blank lines and lines starting with '#' are ignored.
+func parseDERPAdmitToken(b []byte, host string) string {
+	for _, line := range strings.Split(string(b), "\n") {
+		f := strings.Fields(line)
+		if len(f) != 2 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		if strings.EqualFold(f[0], host) {
+			return f[1]
+		}
+	}
+	return ""
+}
+
 // setPeerLastDerpLocked notes that peer is now being written to via
 // the provided DERP regionID, and that the peer advertises a DERP
 // home region ID of homeID.
@@ -933,7 +976,11 @@ func (c *Conn) cleanStaleDerp() {
 	}
 	c.derpCleanupTimerArmed = false
 
-	tooOld := time.Now().Add(-derpInactiveCleanupTime)
+	inactive := derpInactiveCleanupTime
+	if c.hostIdle.Load() {
+		inactive = derpInactiveCleanupTimeHostIdle
+	}
+	tooOld := time.Now().Add(-inactive)
 	dirty := false
 	someNonHomeOpen := false
 	for i, ad := range c.activeDerp {
@@ -1010,6 +1057,10 @@ func (s derpAddrFamSelector) PreferIPv6() bool {
 	// needs to be idle (last written to) before we close it.
 	derpInactiveCleanupTime = 60 * time.Second
 
+	// derpInactiveCleanupTimeHostIdle is derpInactiveCleanupTime while
+	// the host is idle (see Conn.SetHostIdle).
+	derpInactiveCleanupTimeHostIdle = 10 * time.Second
+
 	// derpCleanStaleInterval is how often cleanStaleDerp runs when there
 	// are potentially-stale DERP connections to close.
 	derpCleanStaleInterval = 15 * time.Second
@@ -14,3 +14,27 @@ func CheckDERPHeuristicTimes(t *testing.T) {
 		t.Errorf("PreferredDERPFrameTime too low; should be at least frameReceiveRecordRate")
 	}
 }
+
+func TestParseDERPAdmitToken(t *testing.T) {
+	const file = `
+# Tokens for our own relays.
+derp1.example.com  token1
+DERP2.example.com	token2
+malformed.example.com
+`
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"derp1.example.com", "token1"},
+		{"derp2.example.com", "token2"},
+		{"malformed.example.com", ""},
+		{"derp1f.tailscale.com", ""},
+		{"#", ""},
+	}
+	for _, tt := range tests {
+		if got := parseDERPAdmitToken([]byte(file), tt.host); got != tt.want {
+			t.Errorf("parseDERPAdmitToken(%q) = %q; want %q", tt.host, got, tt.want)
+		}
+	}
+}
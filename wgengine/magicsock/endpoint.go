@@ -30,6 +30,7 @@
 	"tailscale.com/net/tstun"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tstime/mono"
+	"tailscale.com/types/keepalive"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/mak"
@@ -79,10 +80,13 @@ type endpoint struct {
 	lastSendAny    mono.Time      // last time there were outgoing packets sent this peer from any trigger, internal or external to magicsock
 	lastFullPing   mono.Time      // last time we pinged all disco or wireguard only endpoints
 	derpAddr       netip.AddrPort // fallback/bootstrap path, if non-zero (non-zero for well-behaved clients)
+	derpStats      pathStats      // ping history of the DERP path; reset when derpAddr changes
 
 	bestAddr           addrQuality // best non-DERP path; zero if none; mutate via setBestAddrLocked()
 	bestAddrAt         mono.Time   // time best address re-confirmed
 	trustBestAddrUntil mono.Time   // time when bestAddr expires
+	lastMTUProbe       mono.Time   // last time the path MTU of bestAddr was re-probed
+	mtuProbesLost      int         // consecutive lost probes of the path MTU of bestAddr
 	sentPing           map[stun.TxID]sentPing
 	endpointState      map[netip.AddrPort]*endpointState
 	isCallMeMaybeEP    map[netip.AddrPort]bool
@@ -93,6 +97,8 @@ type endpoint struct {
 	heartbeatDisabled bool
 	probeUDPLifetime  *probeUDPLifetime // UDP path lifetime probing; nil if disabled
 
+	keepalive keepalive.Intervals // keepalive intervals of the peer's class; zero fields are defaults
+
 	expired         bool // whether the node has expired
 	isWireguardOnly bool // whether the endpoint is WireGuard only
 }
@@ -100,6 +106,7 @@ type endpoint struct {
 func (de *endpoint) setBestAddrLocked(v addrQuality) {
 	if v.AddrPort != de.bestAddr.AddrPort {
 		de.probeUDPLifetime.resetCycleEndpointLocked()
+		de.mtuProbesLost = 0
 	}
 	de.bestAddr = v
 }
@@ -369,6 +376,8 @@ type endpointState struct {
 	recentPongs []pongReply // ring buffer up to pongHistoryCount entries
 	recentPong  uint16      // index into recentPongs of most recent; older before, wrapped
 
+	stats pathStats // latency and loss history of pings to this endpoint
+
 	index int16 // index in nodecfg.Node.Endpoints; meaningless if lastGotPing non-zero
 }
 
@@ -481,7 +490,7 @@ func (de *endpoint) noteRecvActivity(ipp netip.AddrPort, now mono.Time) {
 		// kick off discovery disco pings every trustUDPAddrDuration and mirror
 		// to DERP.
 		de.mu.Lock()
-		if de.heartbeatDisabled && de.bestAddr.AddrPort == ipp {
+		if de.heartbeatsOffLocked() && de.bestAddr.AddrPort == ipp {
 			de.trustBestAddrUntil = now.Add(trustUDPAddrDuration)
 		}
 		de.mu.Unlock()
@@ -763,7 +772,7 @@ func (de *endpoint) heartbeatForLifetime() {
 	de.startDiscoPingLocked(de.bestAddr.AddrPort, mono.Now(), pingHeartbeatForUDPLifetime, 0, nil)
 }
 
-// heartbeat is called every heartbeatInterval to keep the best UDP path alive,
+// heartbeat is called every heartbeat interval to keep the best UDP path alive,
 // kick off discovery of other paths, or schedule the probing of UDP path
 // lifetime on the tail end of an active session.
 func (de *endpoint) heartbeat() {
@@ -776,7 +785,7 @@ func (de *endpoint) heartbeat() {
 	}
 	de.heartBeatTimer = nil
 
-	if de.heartbeatDisabled {
+	if de.heartbeatsOffLocked() {
 		// If control override to disable heartBeatTimer set, return early.
 		return
 	}
@@ -788,6 +797,16 @@ func (de *endpoint) heartbeat() {
 
 	now := mono.Now()
 	if now.Sub(de.lastSendExt) > sessionActiveTimeout {
+		if de.keepalive.IdleHeartbeat > 0 && !de.c.hostIdle.Load() {
+			// Keep the current path to the idle peer warm, if there is
+			// one, but don't look for better ones until it's active
+			// again.
+			if de.bestAddr.IsValid() {
+				de.startDiscoPingLocked(de.bestAddr.AddrPort, now, pingHeartbeat, 0, nil)
+				de.heartBeatTimer = time.AfterFunc(de.keepalive.IdleHeartbeat, de.heartbeat)
+			}
+			return
+		}
 		// Session's idle. Stop heartbeating.
 		de.c.dlogf("[v1] magicsock: disco: ending heartbeats for idle session to %v (%v)", de.publicKey.ShortString(), de.discoShort())
 		if afterInactivityFor, ok := de.maybeProbeUDPLifetimeLocked(); ok {
@@ -819,15 +838,17 @@ func (de *endpoint) heartbeat() {
 
 	udpAddr, _, _ := de.addrForSendLocked(now)
 	if udpAddr.IsValid() {
-		// We have a preferred path. Ping that every 2 seconds.
+		// We have a preferred path. Ping that every heartbeat.
 		de.startDiscoPingLocked(udpAddr, now, pingHeartbeat, 0, nil)
 	}
 
 	if de.wantFullPingLocked(now) {
 		de.sendDiscoPingsLocked(now, true)
+	} else if udpAddr.IsValid() {
+		de.maybeProbePathMTULocked(now)
 	}
 
-	de.heartBeatTimer = time.AfterFunc(heartbeatInterval, de.heartbeat)
+	de.heartBeatTimer = time.AfterFunc(de.heartbeatIntervalLocked(), de.heartbeat)
 }
 
 // setHeartbeatDisabled sets heartbeatDisabled to the provided value.
@@ -837,6 +858,40 @@ func (de *endpoint) setHeartbeatDisabled(v bool) {
 	de.heartbeatDisabled = v
 }
 
+// setKeepalive sets the keepalive intervals of the peer.
+func (de *endpoint) setKeepalive(ka keepalive.Intervals) {
+	de.mu.Lock()
+	defer de.mu.Unlock()
+	de.keepalive = ka
+}
+
+// heartbeatsOffLocked reports whether disco heartbeats to the peer are
+// disabled, either by silent disco or by the keepalive intervals of its
+// class.
+func (de *endpoint) heartbeatsOffLocked() bool {
+	return de.heartbeatDisabled || de.keepalive.DiscoHeartbeat < 0
+}
+
+// heartbeatIntervalLocked returns how often heartbeats are sent to the peer
+// while its session is active.
+func (de *endpoint) heartbeatIntervalLocked() time.Duration {
+	if de.keepalive.DiscoHeartbeat > 0 {
+		return de.keepalive.DiscoHeartbeat
+	}
+	return heartbeatInterval
+}
+
+// trustBestAddrDurationLocked returns how long a pong makes bestAddr trusted
+// as the exclusive path to the peer. With a heartbeat interval longer than
+// the default, it is extended so that the pong of the next heartbeat can
+// arrive in time.
+func (de *endpoint) trustBestAddrDurationLocked() time.Duration {
+	if hb := de.heartbeatIntervalLocked(); hb > heartbeatInterval {
+		return trustUDPAddrDuration + 2*(hb-heartbeatInterval)
+	}
+	return trustUDPAddrDuration
+}
+
 // wantFullPingLocked reports whether we should ping to all our peers looking for
 // a better path.
 //
@@ -851,6 +906,11 @@ func (de *endpoint) wantFullPingLocked(now mono.Time) bool {
 	if now.After(de.trustBestAddrUntil) {
 		return true
 	}
+	if de.bestAddr.loss >= lossyPathThreshold && now.Sub(de.lastFullPing) >= discoPingInterval {
+		// The best address is losing packets; look for a better path
+		// even if it is fast when its pongs do arrive.
+		return true
+	}
 	if de.bestAddr.latency <= goodEnoughLatency {
 		return false
 	}
@@ -861,9 +921,18 @@ func (de *endpoint) wantFullPingLocked(now mono.Time) bool {
 }
 
 func (de *endpoint) noteTxActivityExtTriggerLocked(now mono.Time) {
+	wasIdle := now.Sub(de.lastSendExt) > sessionActiveTimeout
 	de.lastSendExt = now
-	if de.heartBeatTimer == nil && !de.heartbeatDisabled {
-		de.heartBeatTimer = time.AfterFunc(heartbeatInterval, de.heartbeat)
+	if de.heartbeatsOffLocked() {
+		return
+	}
+	if de.heartBeatTimer == nil {
+		de.heartBeatTimer = time.AfterFunc(de.heartbeatIntervalLocked(), de.heartbeat)
+	} else if wasIdle && de.keepalive.IdleHeartbeat > 0 && de.heartBeatTimer.Stop() {
+		// Switch from the idle heartbeat interval back to the active one.
+		// If the timer could not be stopped, de.heartbeat is already
+		// running and will reschedule itself.
+		de.heartBeatTimer = time.AfterFunc(de.heartbeatIntervalLocked(), de.heartbeat)
 	}
 }
 
@@ -1048,6 +1117,13 @@ func (de *endpoint) discoPingTimeout(txid stun.TxID) {
 	if debugDisco() || !de.bestAddr.IsValid() || mono.Now().After(de.trustBestAddrUntil) {
 		de.c.dlogf("[v1] magicsock: disco: timeout waiting for pong %x from %v (%v, %v)", txid[:6], sp.to, de.publicKey.ShortString(), de.discoShort())
 	}
+	if sp.size == 0 {
+		// Only count pings of the default size as lost; larger MTU
+		// probes are expected to be dropped by some paths.
+		de.notePathProbeLocked(sp.to, pathProbe{at: mono.Now(), lost: true})
+	} else {
+		de.noteMTUProbeLocked(sp, true)
+	}
 	de.removeSentDiscoPingLocked(txid, sp, discoPingTimedOut)
 }
 
@@ -1295,6 +1371,11 @@ func (de *endpoint) sendWireGuardOnlyPing(ipp netip.AddrPort, now mono.Time) {
 	latency, err := p.Send(ctx, addr, nil)
 	if err != nil {
 		de.c.logf("[v2] magicsock: sendWireGuardOnlyPingLocked: %s", err)
+		if ctx.Err() != nil && de.c.connCtx.Err() == nil {
+			de.mu.Lock()
+			de.notePathProbeLocked(ipp, pathProbe{at: mono.Now(), lost: true})
+			de.mu.Unlock()
+		}
 		return
 	}
 
@@ -1305,6 +1386,7 @@ func (de *endpoint) sendWireGuardOnlyPing(ipp netip.AddrPort, now mono.Time) {
 	if !ok {
 		return
 	}
+	de.notePathProbeLocked(ipp, pathProbe{at: mono.Now(), latency: latency})
 	state.addPongReplyLocked(pongReply{
 		latency: latency,
 		pongAt:  now,
@@ -1326,7 +1408,7 @@ func (de *endpoint) setLastPing(ipp netip.AddrPort, now mono.Time) {
 
 // updateFromNode updates the endpoint based on a tailcfg.Node from a NetMap
 // update.
-func (de *endpoint) updateFromNode(n tailcfg.NodeView, heartbeatDisabled bool, probeUDPLifetimeEnabled bool) {
+func (de *endpoint) updateFromNode(n tailcfg.NodeView, heartbeatDisabled bool, probeUDPLifetimeEnabled bool, ka keepalive.Intervals) {
 	if !n.Valid() {
 		panic("nil node when updating endpoint")
 	}
@@ -1334,6 +1416,7 @@ func (de *endpoint) updateFromNode(n tailcfg.NodeView, heartbeatDisabled bool, p
 	defer de.mu.Unlock()
 
 	de.heartbeatDisabled = heartbeatDisabled
+	de.keepalive = ka
 	if probeUDPLifetimeEnabled {
 		de.setProbeUDPLifetimeConfigLocked(defaultProbeUDPLifetimeConfig)
 	} else {
@@ -1578,6 +1661,9 @@ func (de *endpoint) handlePongConnLocked(m *disco.Pong, di *discoInfo, src netip
 			// This is no longer an endpoint we care about.
 			return
 		}
+		if sp.size == 0 {
+			st.stats.addLocked(pathProbe{at: now, latency: latency})
+		}
 
 		de.c.peerMap.setNodeKeyForIPPort(src, de.publicKey)
 
@@ -1605,10 +1691,19 @@ func (de *endpoint) handlePongConnLocked(m *disco.Pong, di *discoInfo, src netip
 		go sp.resCB.cb(sp.resCB.res)
 	}
 
+	if isDerp && sp.size == 0 {
+		de.notePathProbeLocked(sp.to, pathProbe{at: now, latency: latency})
+	}
+
 	// Promote this pong response to our current best address if it's lower latency.
 	// TODO(bradfitz): decide how latency vs. preference order affects decision
 	if !isDerp {
-		thisPong := addrQuality{sp.to, latency, tstun.WireMTU(pingSizeToPktLen(sp.size, sp.to.Addr().Is6()))}
+		thisPong := addrQuality{
+			AddrPort: sp.to,
+			latency:  latency,
+			wireMTU:  tstun.WireMTU(pingSizeToPktLen(sp.size, sp.to.Addr().Is6())),
+			loss:     de.endpointState[sp.to].stats.lossLocked(),
+		}
 		if betterAddr(thisPong, de.bestAddr) {
 			de.c.logf("magicsock: disco: node %v %v now using %v mtu=%v tx=%x", de.publicKey.ShortString(), de.discoShort(), sp.to, thisPong.wireMTU, m.TxID[:6])
 			de.debugUpdates.Add(EndpointChange{
@@ -1627,18 +1722,22 @@ func (de *endpoint) handlePongConnLocked(m *disco.Pong, di *discoInfo, src netip
 				To:   thisPong,
 			})
 			de.bestAddr.latency = latency
+			de.bestAddr.loss = thisPong.loss
 			de.bestAddrAt = now
-			de.trustBestAddrUntil = now.Add(trustUDPAddrDuration)
+			de.trustBestAddrUntil = now.Add(de.trustBestAddrDurationLocked())
 		}
+		de.noteMTUProbeLocked(sp, false)
 	}
 	return
 }
 
-// addrQuality is an IPPort with an associated latency and path mtu.
+// addrQuality is an IPPort with an associated latency, path mtu and loss
+// rate.
 type addrQuality struct {
 	netip.AddrPort
 	latency time.Duration
 	wireMTU tstun.WireMTU
+	loss    float64 // fraction of recent pings lost; zero if unknown
 }
 
 func (a addrQuality) String() string {
@@ -1665,6 +1764,16 @@ func betterAddr(a, b addrQuality) bool {
 		return false
 	}
 
+	// A path that loses noticeably fewer packets wins regardless of
+	// latency: a fast path that drops pings is worse than a slow one
+	// that doesn't.
+	if a.loss+lossHysteresis <= b.loss {
+		return true
+	}
+	if b.loss+lossHysteresis <= a.loss {
+		return false
+	}
+
 	// Each address starts with a set of points (from 0 to 100) that
 	// represents how much faster they are than the highest-latency
 	// endpoint. For example, if a has latency 200ms and b has latency
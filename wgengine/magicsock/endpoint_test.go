@@ -9,6 +9,7 @@
 	"time"
 
 	"github.com/dsnet/try"
+	"tailscale.com/types/keepalive"
 	"tailscale.com/types/key"
 )
 
@@ -324,3 +325,60 @@ func(lifetime *probeUDPLifetime) time.Duration {
 		})
 	}
 }
+
+func TestEndpointKeepaliveIntervals(t *testing.T) {
+	tests := []struct {
+		name      string
+		ka        keepalive.Intervals
+		silent    bool
+		wantOff   bool
+		wantHB    time.Duration
+		wantTrust time.Duration
+	}{
+		{
+			name:      "default",
+			wantHB:    heartbeatInterval,
+			wantTrust: trustUDPAddrDuration,
+		},
+		{
+			name:      "slower",
+			ka:        keepalive.Intervals{DiscoHeartbeat: 30 * time.Second},
+			wantHB:    30 * time.Second,
+			wantTrust: 60500 * time.Millisecond,
+		},
+		{
+			name:      "faster",
+			ka:        keepalive.Intervals{DiscoHeartbeat: time.Second},
+			wantHB:    time.Second,
+			wantTrust: trustUDPAddrDuration,
+		},
+		{
+			name:      "disabled",
+			ka:        keepalive.Intervals{DiscoHeartbeat: -1},
+			wantOff:   true,
+			wantHB:    heartbeatInterval,
+			wantTrust: trustUDPAddrDuration,
+		},
+		{
+			name:      "silent-disco",
+			silent:    true,
+			wantOff:   true,
+			wantHB:    heartbeatInterval,
+			wantTrust: trustUDPAddrDuration,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			de := &endpoint{keepalive: tt.ka, heartbeatDisabled: tt.silent}
+			if got := de.heartbeatsOffLocked(); got != tt.wantOff {
+				t.Errorf("heartbeatsOffLocked = %v, want %v", got, tt.wantOff)
+			}
+			if got := de.heartbeatIntervalLocked(); got != tt.wantHB {
+				t.Errorf("heartbeatIntervalLocked = %v, want %v", got, tt.wantHB)
+			}
+			if got := de.trustBestAddrDurationLocked(); got != tt.wantTrust {
+				t.Errorf("trustBestAddrDurationLocked = %v, want %v", got, tt.wantTrust)
+			}
+		})
+	}
+}
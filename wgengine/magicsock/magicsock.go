@@ -49,6 +49,7 @@
 	"tailscale.com/tailcfg"
 	"tailscale.com/tstime"
 	"tailscale.com/tstime/mono"
+	"tailscale.com/types/keepalive"
 	"tailscale.com/types/key"
 	"tailscale.com/types/lazy"
 	"tailscale.com/types/logger"
@@ -213,6 +214,11 @@ type Conn struct {
 	// new connection that'll fail.
 	networkUp atomic.Bool
 
+	// hostIdle is whether the host is asleep or saving power, as set by
+	// SetHostIdle. While it is, background work that only keeps paths to
+	// idle peers warm is skipped.
+	hostIdle atomic.Bool
+
 	// Whether debugging logging is enabled.
 	debugLogging atomic.Bool
 
@@ -332,6 +338,7 @@ type Conn struct {
 	derpMap          *tailcfg.DERPMap              // nil (or zero regions/nodes) means DERP is disabled
 	peers            views.Slice[tailcfg.NodeView] // from last SetNetworkMap update
 	lastFlags        debugFlags                    // at time of last SetNetworkMap
+	keepaliveConfig  keepalive.Config              // keepalive intervals by peer class
 	firstAddrForTest netip.Addr                    // from last SetNetworkMap update; for tests only
 	privateKey       key.NodePrivate               // WireGuard private key for this node
 	everHadKey       bool                          // whether we ever had a non-zero private key
@@ -538,7 +545,7 @@ func NewConn(opts Options) (*Conn, error) {
 		DisableAll: func() bool { return opts.DisablePortMapper || c.onlyTCP443.Load() },
 	}
 	c.portMapper = portmapper.NewClient(logger.WithPrefix(c.logf, "portmapper: "), opts.NetMon, portMapOpts, opts.ControlKnobs, c.onPortMapChanged)
-	c.portMapper.SetGatewayLookupFunc(opts.NetMon.GatewayAndSelfIP)
+	c.portMapper.SetGatewaysLookupFunc(opts.NetMon.GatewayCandidates)
 	c.netMon = opts.NetMon
 	c.health = opts.HealthTracker
 	c.onPortUpdate = opts.OnPortUpdate
@@ -935,6 +942,21 @@ func (c *Conn) LastRecvActivityOfNodeKey(nk key.NodePublic) string {
 	return mono.Since(saw).Round(time.Second).String()
 }
 
+// IsDirect reports whether packets to the peer with node key nk are
+// currently sent directly over UDP, rather than through DERP.
+func (c *Conn) IsDirect(nk key.NodePublic) bool {
+	c.mu.Lock()
+	de, ok := c.peerMap.endpointForNodeKey(nk)
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+	de.mu.Lock()
+	defer de.mu.Unlock()
+	udpAddr, derpAddr, _ := de.addrForSendLocked(mono.Now())
+	return udpAddr.IsValid() && !derpAddr.IsValid()
+}
+
 // Ping handles a "tailscale ping" CLI query.
 func (c *Conn) Ping(peer tailcfg.NodeView, res *ipnstate.PingResult, size int, cb func(*ipnstate.PingResult)) {
 	c.mu.Lock()
@@ -994,6 +1016,28 @@ func (c *Conn) GetEndpointChanges(peer tailcfg.NodeView) ([]EndpointChange, erro
 	return ep.debugUpdates.GetAll(), nil
 }
 
+// GetPathStats returns the latency and loss statistics of the recent disco
+// pings sent on each path to peer.
+func (c *Conn) GetPathStats(peer tailcfg.NodeView) ([]ipnstate.PathStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.privateKey.IsZero() {
+		return nil, fmt.Errorf("tailscaled stopped")
+	}
+	ep, ok := c.peerMap.endpointForNodeKey(peer.Key())
+	if !ok {
+		return nil, fmt.Errorf("unknown peer")
+	}
+
+	stats := ep.summarizePathStats()
+	for i := range stats {
+		if id := stats[i].DERPRegionID; id != 0 {
+			stats[i].DERPRegionCode = c.derpRegionCodeLocked(id)
+		}
+	}
+	return stats, nil
+}
+
 // DiscoPublicKey returns the discovery public key.
 func (c *Conn) DiscoPublicKey() key.DiscoPublic {
 	return c.discoPublic
@@ -1992,6 +2036,33 @@ func (c *Conn) SetNetworkUp(up bool) {
 	}
 }
 
+// SetHostIdle sets whether the host is idle, such as because its screen is
+// off or it's saving power. While it is, c doesn't send disco heartbeats to
+// idle peers or do periodic STUN, and closes unused non-home DERP
+// connections sooner. Active peers are unaffected.
+func (c *Conn) SetHostIdle(idle bool) {
+	if c.hostIdle.Swap(idle) == idle {
+		return
+	}
+	c.logf("magicsock: SetHostIdle(%v)", idle)
+	if idle {
+		c.cleanStaleDerp()
+	} else {
+		c.ReSTUN("host-active")
+	}
+}
+
+// HostIdleForTest reports whether the host is idle, as set by SetHostIdle.
+func (c *Conn) HostIdleForTest() bool {
+	return c.hostIdle.Load()
+}
+
+// PreferredPort returns the connection's preferred local port, as set by
+// SetPreferredPort, or 0 if it has none.
+func (c *Conn) PreferredPort() uint16 {
+	return uint16(c.port.Load())
+}
+
 // SetPreferredPort sets the connection's preferred local port.
 func (c *Conn) SetPreferredPort(port uint16) {
 	if uint16(c.port.Load()) == port {
@@ -2170,6 +2241,24 @@ func (c *Conn) SetProbeUDPLifetime(v bool) {
 	})
 }
 
+// SetKeepaliveConfig sets the disco heartbeat and WireGuard persistent
+// keepalive intervals of peers by class. Only the disco heartbeats are
+// managed by magicsock; the caller is responsible for applying the WireGuard
+// keepalive intervals to the WireGuard config.
+func (c *Conn) SetKeepaliveConfig(cfg keepalive.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cfg.Equal(c.keepaliveConfig) {
+		return
+	}
+	c.keepaliveConfig = cfg
+	for _, n := range c.peers.All() {
+		if ep, ok := c.peerMap.endpointForNodeKey(n.Key()); ok {
+			ep.setKeepalive(cfg.ForPeer(n))
+		}
+	}
+}
+
 // SetNetworkMap is called when the control client gets a new network
 // map from the control server. It must always be non-nil.
 //
@@ -2252,7 +2341,7 @@ func (c *Conn) SetNetworkMap(nm *netmap.NetworkMap) {
 			if epDisco := ep.disco.Load(); epDisco != nil {
 				oldDiscoKey = epDisco.key
 			}
-			ep.updateFromNode(n, flags.heartbeatDisabled, flags.probeUDPLifetimeOn)
+			ep.updateFromNode(n, flags.heartbeatDisabled, flags.probeUDPLifetimeOn, c.keepaliveConfig.ForPeer(n))
 			c.peerMap.upsertEndpoint(ep, oldDiscoKey) // maybe update discokey mappings in peerMap
 			continue
 		}
@@ -2312,7 +2401,7 @@ func (c *Conn) SetNetworkMap(nm *netmap.NetworkMap) {
 			c.logEndpointCreated(n)
 		}
 
-		ep.updateFromNode(n, flags.heartbeatDisabled, flags.probeUDPLifetimeOn)
+		ep.updateFromNode(n, flags.heartbeatDisabled, flags.probeUDPLifetimeOn, c.keepaliveConfig.ForPeer(n))
 		c.peerMap.upsertEndpoint(ep, key.DiscoPublic{})
 	}
 
@@ -2559,6 +2648,11 @@ func (c *Conn) shouldDoPeriodicReSTUNLocked() bool {
 	if c.networkDown() || c.homeless {
 		return false
 	}
+	if c.hostIdle.Load() {
+		// Don't wake the radio just to keep NAT mappings fresh; the
+		// endpoints are discovered again once the host is active.
+		return false
+	}
 	if len(c.peerSet) == 0 || c.privateKey.IsZero() {
 		// If no peers, not worth doing.
 		// Also don't if there's no key (not running).
@@ -3150,6 +3244,10 @@ type discoInfo struct {
 	// metricMaxPeerMTUProbed is the largest peer path MTU we successfully probed.
 	metricMaxPeerMTUProbed = clientmetric.NewGauge("magicsock_max_peer_mtu_probed")
 
+	// metricPeerMTULowered is the number of times a peer path MTU was
+	// lowered because probes of it went unanswered.
+	metricPeerMTULowered = clientmetric.NewCounter("magicsock_peer_mtu_lowered")
+
 	// metricRecvDiscoPeerMTUProbesByMTU collects the number of times we
 	// received an peer MTU probe response for a given MTU size.
 	// TODO: add proper support for label maps in clientmetrics
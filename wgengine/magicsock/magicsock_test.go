@@ -1790,6 +1790,9 @@ func TestBetterAddr(t *testing.T) {
 	almtu := func(ipps string, d time.Duration, mtu tstun.WireMTU) addrQuality {
 		return addrQuality{AddrPort: netip.MustParseAddrPort(ipps), latency: d, wireMTU: mtu}
 	}
+	alloss := func(ipps string, d time.Duration, loss float64) addrQuality {
+		return addrQuality{AddrPort: netip.MustParseAddrPort(ipps), latency: d, loss: loss}
+	}
 	zero := addrQuality{}
 
 	const (
@@ -1894,6 +1897,25 @@ func TestBetterAddr(t *testing.T) {
 			b:    al("[::1]:555", 100*ms),
 			want: false,
 		},
+
+		// A path losing noticeably fewer packets is preferred even if
+		// it is slower or otherwise less preferred...
+		{
+			a:    alloss(publicV4, 100*ms, 0),
+			b:    alloss(publicV4_2, 10*ms, 0.25),
+			want: true,
+		},
+		{
+			a:    alloss(publicV4, 100*ms, 0.05),
+			b:    alloss(privateV4, 100*ms, 0.5),
+			want: true,
+		},
+		// ... but small differences in loss are ignored.
+		{
+			a:    alloss(publicV4, 100*ms, 0),
+			b:    alloss(publicV4_2, 10*ms, 0.05),
+			want: false,
+		},
 	}
 	for i, tt := range tests {
 		got := betterAddr(tt.a, tt.b)
@@ -0,0 +1,124 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"time"
+
+	"tailscale.com/net/tstun"
+	"tailscale.com/tstime/mono"
+	"tailscale.com/types/key"
+)
+
+// Active path MTU probing. Each full round of disco pings to a peer includes
+// padded pings of each of tstun.WireMTUsToProbe, and the largest one that
+// gets a pong raises the path MTU of the best address. While the peer is
+// active, the path MTU is also re-probed periodically: sizes above the current
+// one, to find paths that got better, and the current one, to find paths that
+// got worse and would otherwise silently drop full-sized packets.
+
+const (
+	// pathMTUProbeInterval is how often the path MTU of the best address
+	// of an active peer is re-probed.
+	pathMTUProbeInterval = 30 * time.Second
+
+	// mtuBlackholeProbes is how many consecutive probes of the current
+	// path MTU must go unanswered before it is lowered.
+	mtuBlackholeProbes = 2
+)
+
+// maybeProbePathMTULocked sends padded pings to de.bestAddr to re-probe its
+// path MTU, if peer path MTU discovery is enabled and it was not probed
+// within pathMTUProbeInterval.
+//
+// de.mu must be held.
+func (de *endpoint) maybeProbePathMTULocked(now mono.Time) {
+	if !de.c.PeerMTUEnabled() || !de.bestAddr.IsValid() {
+		return
+	}
+	if now.Sub(de.lastMTUProbe) < pathMTUProbeInterval {
+		return
+	}
+	de.lastMTUProbe = now
+	is6 := de.bestAddr.Addr().Is6()
+	for _, mtu := range tstun.WireMTUsToProbe {
+		// The safe MTU is assumed to work on every path.
+		if mtu < de.bestAddr.wireMTU || mtu <= tstun.SafeWireMTU() {
+			continue
+		}
+		de.startDiscoPingLocked(de.bestAddr.AddrPort, now, pingHeartbeat, pktLenToPingSize(mtu, is6), nil)
+	}
+}
+
+// noteMTUProbeLocked records the outcome of the padded ping sp. If enough
+// consecutive probes of the current path MTU of de.bestAddr are lost, the path
+// MTU is lowered to the next smaller probed size.
+//
+// de.mu must be held.
+func (de *endpoint) noteMTUProbeLocked(sp sentPing, lost bool) {
+	if sp.size == 0 || sp.to != de.bestAddr.AddrPort {
+		return
+	}
+	pktLen := pingSizeToPktLen(sp.size, sp.to.Addr().Is6())
+	if !lost {
+		if pktLen >= de.bestAddr.wireMTU {
+			de.mtuProbesLost = 0
+		}
+		return
+	}
+	if pktLen != de.bestAddr.wireMTU || pktLen <= tstun.SafeWireMTU() {
+		return
+	}
+	de.mtuProbesLost++
+	if de.mtuProbesLost < mtuBlackholeProbes {
+		return
+	}
+	de.mtuProbesLost = 0
+	lower := nextLowerProbedMTU(pktLen)
+	de.c.logf("magicsock: disco: node %v %v path MTU of %v lowered from %v to %v after %d lost probes", de.publicKey.ShortString(), de.discoShort(), sp.to, pktLen, lower, mtuBlackholeProbes)
+	metricPeerMTULowered.Add(1)
+	de.bestAddr.wireMTU = lower
+}
+
+// nextLowerProbedMTU returns the largest of tstun.WireMTUsToProbe that is
+// smaller than mtu, but no smaller than the safe wire MTU.
+func nextLowerProbedMTU(mtu tstun.WireMTU) tstun.WireMTU {
+	lower := tstun.SafeWireMTU()
+	for _, m := range tstun.WireMTUsToProbe {
+		if m < mtu && m > lower {
+			lower = m
+		}
+	}
+	return lower
+}
+
+// pathMTULocked returns the wire MTU of the path that packets to the peer
+// currently take: the probed MTU of bestAddr if it is trusted, or the safe
+// wire MTU otherwise.
+//
+// de.mu must be held.
+func (de *endpoint) pathMTULocked(now mono.Time) tstun.WireMTU {
+	if de.bestAddr.IsValid() && !now.After(de.trustBestAddrUntil) && de.bestAddr.wireMTU != 0 {
+		return de.bestAddr.wireMTU
+	}
+	return tstun.SafeWireMTU()
+}
+
+// PeerPathMTU returns the wire MTU of the current path to the peer with node
+// key k, for clamping the MSS of TCP connections to it. It reports false if
+// peer path MTU discovery is disabled or the peer is unknown.
+func (c *Conn) PeerPathMTU(k key.NodePublic) (tstun.WireMTU, bool) {
+	if !c.PeerMTUEnabled() {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ep, ok := c.peerMap.endpointForNodeKey(k)
+	if !ok {
+		return 0, false
+	}
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return ep.pathMTULocked(mono.Now()), true
+}
@@ -0,0 +1,62 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/net/tstun"
+	"tailscale.com/tstime/mono"
+)
+
+func TestNoteMTUProbeLowersBlackholedMTU(t *testing.T) {
+	addr := netip.MustParseAddrPort("1.2.3.4:5")
+	de := &endpoint{
+		c:        &Conn{logf: t.Logf},
+		bestAddr: addrQuality{AddrPort: addr, wireMTU: 9000},
+	}
+	probe := func(to netip.AddrPort, mtu tstun.WireMTU) sentPing {
+		return sentPing{to: to, size: pktLenToPingSize(mtu, false)}
+	}
+
+	// A lost probe of another size or to another address doesn't count.
+	de.noteMTUProbeLocked(probe(addr, 1500), true)
+	de.noteMTUProbeLocked(probe(netip.MustParseAddrPort("5.6.7.8:9"), 9000), true)
+	// Neither does a single lost probe that is followed by a pong.
+	de.noteMTUProbeLocked(probe(addr, 9000), true)
+	de.noteMTUProbeLocked(probe(addr, 9000), false)
+	de.noteMTUProbeLocked(probe(addr, 9000), true)
+	if de.bestAddr.wireMTU != 9000 {
+		t.Fatalf("wireMTU = %v, want 9000", de.bestAddr.wireMTU)
+	}
+
+	want := []tstun.WireMTU{8000, 1500, 1400, tstun.SafeWireMTU(), tstun.SafeWireMTU()}
+	for _, w := range want {
+		for range mtuBlackholeProbes {
+			de.noteMTUProbeLocked(probe(addr, de.bestAddr.wireMTU), true)
+		}
+		if de.bestAddr.wireMTU != w {
+			t.Fatalf("wireMTU = %v, want %v", de.bestAddr.wireMTU, w)
+		}
+	}
+}
+
+func TestPathMTU(t *testing.T) {
+	now := mono.Now()
+	de := &endpoint{
+		bestAddr:           addrQuality{AddrPort: netip.MustParseAddrPort("1.2.3.4:5"), wireMTU: 1500},
+		trustBestAddrUntil: now.Add(time.Second),
+	}
+	if got := de.pathMTULocked(now); got != 1500 {
+		t.Errorf("path MTU of trusted best address = %v, want 1500", got)
+	}
+	if got := de.pathMTULocked(now.Add(time.Minute)); got != tstun.SafeWireMTU() {
+		t.Errorf("path MTU of expired best address = %v, want the safe MTU", got)
+	}
+	if got := (&endpoint{}).pathMTULocked(now); got != tstun.SafeWireMTU() {
+		t.Errorf("path MTU over DERP = %v, want the safe MTU", got)
+	}
+}
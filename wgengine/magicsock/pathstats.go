@@ -0,0 +1,180 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"cmp"
+	"net/netip"
+	"slices"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime/mono"
+)
+
+const (
+	// pathStatsHistory is how many disco ping outcomes are kept per path.
+	pathStatsHistory = 64
+
+	// minLossSamples is the number of ping outcomes of a path required
+	// before its loss rate is taken into account for path selection.
+	minLossSamples = 8
+
+	// lossHysteresis is how much lower the loss rate of a path must be than
+	// that of another for it to be preferred regardless of latency.
+	lossHysteresis = 0.1
+
+	// lossyPathThreshold is the loss rate of the best path above which all
+	// paths are pinged again to look for a better one, as if the best path
+	// was no longer trusted.
+	lossyPathThreshold = 0.2
+)
+
+// pathProbe is the outcome of a disco ping sent on a path.
+type pathProbe struct {
+	at      mono.Time     // when the pong was received or the ping timed out
+	latency time.Duration // round-trip time, if !lost
+	lost    bool
+}
+
+// pathStats is a rolling history of the outcomes of the disco pings sent on a
+// path to a peer. All fields are guarded by endpoint.mu.
+type pathStats struct {
+	addr   netip.AddrPort // the path; only used for the DERP path, whose address can change
+	probes []pathProbe    // ring buffer of up to pathStatsHistory entries
+	next   int            // index in probes to write the next outcome to, once full
+}
+
+// addLocked records the outcome of a ping.
+func (ps *pathStats) addLocked(p pathProbe) {
+	if len(ps.probes) < pathStatsHistory {
+		ps.probes = append(ps.probes, p)
+		return
+	}
+	ps.probes[ps.next] = p
+	ps.next = (ps.next + 1) % pathStatsHistory
+}
+
+// lossLocked returns the fraction of the recorded pings that were lost, or
+// zero if too few pings were recorded for a meaningful estimate.
+func (ps *pathStats) lossLocked() float64 {
+	if len(ps.probes) < minLossSamples {
+		return 0
+	}
+	lost := 0
+	for _, p := range ps.probes {
+		if p.lost {
+			lost++
+		}
+	}
+	return float64(lost) / float64(len(ps.probes))
+}
+
+// summaryLocked summarizes the recorded pings of the path to addr.
+func (ps *pathStats) summaryLocked(addr netip.AddrPort, active bool) ipnstate.PathStats {
+	s := ipnstate.PathStats{
+		Active: active,
+		Pings:  len(ps.probes),
+	}
+	if addr.Addr() == tailcfg.DerpMagicIPAddr {
+		s.DERPRegionID = int(addr.Port())
+	} else {
+		s.Endpoint = addr.String()
+	}
+	var (
+		sum, jitter  time.Duration
+		prev         time.Duration
+		answered     int
+		lastPongTime mono.Time
+	)
+	// Walk the ring buffer from the oldest outcome to the newest, so that
+	// jitter is computed between consecutive pongs.
+	for i := range ps.probes {
+		p := ps.probes[(ps.next+i)%len(ps.probes)]
+		if p.lost {
+			s.Lost++
+			continue
+		}
+		if answered == 0 || p.latency < time.Duration(s.MinLatencySeconds*float64(time.Second)) {
+			s.MinLatencySeconds = p.latency.Seconds()
+		}
+		s.MaxLatencySeconds = max(s.MaxLatencySeconds, p.latency.Seconds())
+		if answered > 0 {
+			jitter += (p.latency - prev).Abs()
+		}
+		sum += p.latency
+		prev = p.latency
+		answered++
+		lastPongTime = p.at
+	}
+	if answered > 0 {
+		s.AvgLatencySeconds = (sum / time.Duration(answered)).Seconds()
+		s.LastPong = lastPongTime.WallTime()
+	}
+	if answered > 1 {
+		s.JitterSeconds = (jitter / time.Duration(answered-1)).Seconds()
+	}
+	return s
+}
+
+// pathStatsForLocked returns the statistics of the path to addr, or nil if
+// addr is not a path to the peer.
+func (de *endpoint) pathStatsForLocked(addr netip.AddrPort) *pathStats {
+	if addr.Addr() == tailcfg.DerpMagicIPAddr {
+		if addr != de.derpAddr {
+			// The peer moved to another DERP region since the ping
+			// was sent.
+			return nil
+		}
+		if de.derpStats.addr != addr {
+			de.derpStats = pathStats{addr: addr}
+		}
+		return &de.derpStats
+	}
+	if st, ok := de.endpointState[addr]; ok {
+		return &st.stats
+	}
+	return nil
+}
+
+// notePathProbeLocked records the outcome of a disco ping sent on the path to
+// addr, and keeps the loss rate of the best address up to date.
+func (de *endpoint) notePathProbeLocked(addr netip.AddrPort, p pathProbe) {
+	ps := de.pathStatsForLocked(addr)
+	if ps == nil {
+		return
+	}
+	ps.addLocked(p)
+	if addr == de.bestAddr.AddrPort {
+		de.bestAddr.loss = ps.lossLocked()
+	}
+}
+
+// summarizePathStats returns the statistics of the peer's paths: the direct paths
+// that were pinged, and the DERP path, if it was pinged.
+func (de *endpoint) summarizePathStats() []ipnstate.PathStats {
+	de.mu.Lock()
+	defer de.mu.Unlock()
+	// Like addrForSendLocked, but without its side effects: packets go to
+	// the best address, and also via DERP until it is trusted.
+	trusted := de.bestAddr.IsValid() && !mono.Now().After(de.trustBestAddrUntil)
+	var stats []ipnstate.PathStats
+	for addr, st := range de.endpointState {
+		if len(st.stats.probes) > 0 {
+			stats = append(stats, st.stats.summaryLocked(addr, addr == de.bestAddr.AddrPort))
+		}
+	}
+	if de.derpStats.addr == de.derpAddr && len(de.derpStats.probes) > 0 {
+		stats = append(stats, de.derpStats.summaryLocked(de.derpAddr, !trusted))
+	}
+	slices.SortFunc(stats, func(a, b ipnstate.PathStats) int {
+		// Direct paths first, then DERP.
+		if c := cmp.Compare(a.DERPRegionID, b.DERPRegionID); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Endpoint, b.Endpoint)
+	})
+	return stats
+}
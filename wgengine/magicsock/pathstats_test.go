@@ -0,0 +1,90 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package magicsock
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tstime/mono"
+)
+
+func TestPathStats(t *testing.T) {
+	const ms = time.Millisecond
+	var ps pathStats
+	now := mono.Now()
+	for _, lat := range []time.Duration{10 * ms, 30 * ms, 20 * ms} {
+		ps.addLocked(pathProbe{at: now, latency: lat})
+	}
+	ps.addLocked(pathProbe{at: now.Add(time.Second), lost: true})
+
+	if got := ps.lossLocked(); got != 0 {
+		t.Errorf("loss with too few samples = %v, want 0", got)
+	}
+	got := ps.summaryLocked(netip.MustParseAddrPort("1.2.3.4:5"), true)
+	want := ipnstate.PathStats{
+		Endpoint:          "1.2.3.4:5",
+		Active:            true,
+		Pings:             4,
+		Lost:              1,
+		MinLatencySeconds: (10 * ms).Seconds(),
+		AvgLatencySeconds: (20 * ms).Seconds(),
+		MaxLatencySeconds: (30 * ms).Seconds(),
+		JitterSeconds:     (15 * ms).Seconds(),
+		LastPong:          now.WallTime(),
+	}
+	if got != want {
+		t.Errorf("summary = %+v\nwant %+v", got, want)
+	}
+
+	// Fill the history with a mix of answered and lost pings; only the
+	// most recent pathStatsHistory outcomes count.
+	for i := range pathStatsHistory {
+		ps.addLocked(pathProbe{at: now, latency: ms, lost: i%4 == 0})
+	}
+	if len(ps.probes) != pathStatsHistory {
+		t.Fatalf("history has %d entries, want %d", len(ps.probes), pathStatsHistory)
+	}
+	if got := ps.lossLocked(); got != 0.25 {
+		t.Errorf("loss = %v, want 0.25", got)
+	}
+
+	derp := netip.AddrPortFrom(tailcfg.DerpMagicIPAddr, 7)
+	if s := ps.summaryLocked(derp, false); s.DERPRegionID != 7 || s.Endpoint != "" {
+		t.Errorf("DERP summary identifies path as %q, region %d; want region 7", s.Endpoint, s.DERPRegionID)
+	}
+}
+
+func TestNotePathProbeUpdatesBestAddrLoss(t *testing.T) {
+	addr := netip.MustParseAddrPort("1.2.3.4:5")
+	now := mono.Now()
+	de := &endpoint{
+		endpointState: map[netip.AddrPort]*endpointState{addr: {}},
+		bestAddr:      addrQuality{AddrPort: addr, latency: time.Millisecond},
+		lastFullPing:  now.Add(-discoPingInterval),
+	}
+	de.trustBestAddrUntil = now.Add(time.Hour)
+	if de.wantFullPingLocked(now) {
+		t.Fatal("wantFullPingLocked = true for a fast, trusted, lossless best address")
+	}
+	for i := range minLossSamples {
+		de.notePathProbeLocked(addr, pathProbe{at: now, latency: time.Millisecond, lost: i%2 == 0})
+	}
+	if de.bestAddr.loss != 0.5 {
+		t.Errorf("bestAddr.loss = %v, want 0.5", de.bestAddr.loss)
+	}
+	if !de.wantFullPingLocked(now) {
+		t.Error("wantFullPingLocked = false for a lossy best address")
+	}
+
+	// Pings to paths that are not known are ignored.
+	de.notePathProbeLocked(netip.MustParseAddrPort("5.6.7.8:9"), pathProbe{at: now, lost: true})
+	de.notePathProbeLocked(netip.AddrPortFrom(tailcfg.DerpMagicIPAddr, 1), pathProbe{at: now})
+	if len(de.summarizePathStats()) != 1 {
+		t.Errorf("got stats for %d paths, want 1", len(de.summarizePathStats()))
+	}
+}
@@ -14,6 +14,7 @@
 	"math"
 	"net"
 	"net/netip"
+	"os"
 	"runtime"
 	"strconv"
 	"sync"
@@ -1568,6 +1569,105 @@ func (ns *Impl) handleMagicDNSUDP(srcAddr netip.AddrPort, c *gonet.UDPConn) {
 	}
 }
 
+// DialContextMagicDNS returns a UDP "connection" to MagicDNS at dst, the
+// Tailscale service IP on port 53, for use by tsdial.Dialer.MagicDNSDialUDP.
+// Queries written to it are answered in-process, without the packets
+// reaching netstack or the host, which can't route to the service IP when
+// using userspace networking.
+func (ns *Impl) DialContextMagicDNS(ctx context.Context, dst netip.AddrPort) (net.Conn, error) {
+	if a := dst.Addr(); (a != serviceIP && a != serviceIPv6) || dst.Port() != 53 {
+		return nil, fmt.Errorf("%v is not MagicDNS", dst)
+	}
+	src := netip.AddrPortFrom(ipv4Loopback, 0)
+	if dst.Addr().Is6() {
+		src = netip.AddrPortFrom(ipv6Loopback, 0)
+	}
+	return &magicDNSConn{
+		ns:     ns,
+		src:    src,
+		dst:    dst,
+		resps:  make(chan []byte, 16),
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// magicDNSConn is a net.Conn to MagicDNS, as returned by
+// DialContextMagicDNS. Like a UDP socket, each Write is a query, each Read
+// returns a response, and responses that aren't read in time are dropped.
+type magicDNSConn struct {
+	ns       *Impl
+	src, dst netip.AddrPort
+	resps    chan []byte
+	closed   chan struct{}
+
+	closeOnce sync.Once
+
+	mu           sync.Mutex
+	readDeadline time.Time
+}
+
+func (c *magicDNSConn) Write(q []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	q = bytes.Clone(q)
+	go func() {
+		resp, err := c.ns.dns.Query(context.Background(), q, "udp", c.src)
+		if err != nil {
+			c.ns.logf("dns udp query: %v", err)
+			return
+		}
+		select {
+		case c.resps <- resp:
+		default:
+			// Reader isn't keeping up; drop it as the network would.
+		}
+	}()
+	return len(q), nil
+}
+
+func (c *magicDNSConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	deadline := c.readDeadline
+	c.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case resp := <-c.resps:
+		return copy(p, resp), nil
+	case <-c.closed:
+		return 0, net.ErrClosed
+	case <-timeout:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *magicDNSConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *magicDNSConn) LocalAddr() net.Addr  { return net.UDPAddrFromAddrPort(c.src) }
+func (c *magicDNSConn) RemoteAddr() net.Addr { return net.UDPAddrFromAddrPort(c.dst) }
+
+func (c *magicDNSConn) SetDeadline(t time.Time) error { return c.SetReadDeadline(t) }
+
+func (c *magicDNSConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline is a no-op, as writes never block.
+func (c *magicDNSConn) SetWriteDeadline(t time.Time) error { return nil }
+
 // forwardUDP proxies between client (with addr clientAddr) and dstAddr.
 //
 // dstAddr may be either a local Tailscale IP, in which we case we proxy to
@@ -1624,6 +1724,7 @@ func (ns *Impl) forwardUDP(client *gonet.UDPConn, clientAddr, dstAddr netip.Addr
 	if isLocal {
 		if err := ns.pm.RegisterIPPortIdentity("udp", backendLocalIPPort, clientAddr.Addr()); err != nil {
 			ns.logf("netstack: could not register UDP mapping %s: %v", backendLocalIPPort, err)
+			backendConn.Close()
 			return
 		}
 	}
@@ -5,14 +5,17 @@
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"maps"
 	"net"
 	"net/netip"
+	"os"
 	"runtime"
 	"testing"
 	"time"
 
+	"golang.org/x/net/dns/dnsmessage"
 	"gvisor.dev/gvisor/pkg/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -22,6 +25,7 @@
 	"tailscale.com/ipn/ipnlocal"
 	"tailscale.com/ipn/store/mem"
 	"tailscale.com/metrics"
+	"tailscale.com/net/dns"
 	"tailscale.com/net/packet"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/net/tsdial"
@@ -30,6 +34,7 @@
 	"tailscale.com/tstest"
 	"tailscale.com/types/ipproto"
 	"tailscale.com/types/logid"
+	"tailscale.com/util/dnsname"
 	"tailscale.com/wgengine"
 	"tailscale.com/wgengine/filter"
 )
@@ -1016,3 +1021,72 @@ func makeUDP6PacketBuffer(src, dst netip.AddrPort) *stack.PacketBuffer {
 
 	return pkt
 }
+
+func TestDialContextMagicDNS(t *testing.T) {
+	impl := makeNetstack(t, nil)
+	want := netip.MustParseAddr("100.101.102.103")
+	if err := impl.dns.Set(dns.Config{
+		Hosts: map[dnsname.FQDN][]netip.Addr{"foo.tail-scale.ts.net.": {want}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := impl.DialContextMagicDNS(ctx, netip.MustParseAddrPort("100.100.100.100:80")); err == nil {
+		t.Errorf("dial to port 80 succeeded; want error")
+	}
+	c, err := impl.DialContextMagicDNS(ctx, netip.AddrPortFrom(tsaddr.TailscaleServiceIP(), 53))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 1, RecursionDesired: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName("foo.tail-scale.ts.net."),
+		Type:  dnsmessage.TypeA,
+		Class: dnsmessage.ClassINET,
+	})
+	q, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write(q); err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 512)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p dnsmessage.Parser
+	if _, err := p.Start(buf[:n]); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	ans, err := p.AnswerHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := p.AResource()
+	if err != nil || ans.Type != dnsmessage.TypeA {
+		t.Fatalf("answer = %v, %v; want A record", ans, err)
+	}
+	if got := netip.AddrFrom4(r.A); got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	// With no pending query, reads time out.
+	c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := c.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("read error = %v; want deadline exceeded", err)
+	}
+	c.Close()
+	if _, err := c.Write(q); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("write after close error = %v; want net.ErrClosed", err)
+	}
+}
@@ -244,6 +244,7 @@ func interfaceFromLUID(luid winipcfg.LUID, flags winipcfg.GAAFlags) (*winipcfg.I
 		return fmt.Sprintf("Failed to set the network category to private on the Tailscale adapter. This may prevent Tailscale from working correctly. Error: %s", args[health.ArgError])
 	},
 	MapDebugFlag: "warn-network-category-unhealthy",
+	Component:    health.ComponentNetwork,
 })
 
 func configureInterface(cfg *Config, tun *tun.NativeTun, ht *health.Tracker) (retErr error) {
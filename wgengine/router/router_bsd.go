@@ -0,0 +1,464 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build freebsd || openbsd
+
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tailscale.com/envknob"
+	"tailscale.com/health"
+	"tailscale.com/net/netmon"
+	"tailscale.com/net/netns"
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/types/logger"
+	"tailscale.com/types/preftype"
+	"tailscale.com/util/multierr"
+)
+
+// pfAnchor is the pf anchor in which tailscaled keeps its firewall rules.
+// The main pf ruleset must call it, with 'anchor "tailscale"' (and, on
+// FreeBSD, 'nat-anchor "tailscale"' to masquerade subnet traffic), for the
+// rules to apply.
+const pfAnchor = "tailscale"
+
+// pfTag tags the packets that arrive on the Tailscale interface, so that
+// they can be passed and masqueraded when they're forwarded.
+const pfTag = "tailscale"
+
+// bypassRoutingTable is the routing table (a FIB on FreeBSD, an rtable on
+// OpenBSD) that tailscaled's own sockets use when it's non-zero, so that
+// their packets don't follow the default routes of exit nodes into
+// Tailscale. tailscaled keeps the host's default route in it. Exit nodes
+// can't be used without it. On FreeBSD, the table must exist; see the
+// net.fibs tunable in setfib(2).
+var bypassRoutingTable = envknob.RegisterInt("TS_BSD_BYPASS_ROUTING_TABLE")
+
+// bsdRouter wraps the router of a BSD to add what they share: management of
+// tailscaled's pf rules and of the routes of exit nodes.
+type bsdRouter struct {
+	Router
+	logf    logger.Logf
+	health  *health.Tracker
+	netMon  *netmon.Monitor
+	tunname string
+
+	// run runs a command with the given stdin, returning its combined
+	// output. It's swapped out in tests.
+	run func(stdin []byte, args ...string) ([]byte, error)
+
+	unregNetMon func()
+
+	mu       sync.Mutex
+	pfRules  []byte     // the rules last loaded into pfAnchor, or nil
+	bypassGW netip.Addr // the gateway of the default route in bypassRoutingTable, if any
+	lastCfg  *Config
+}
+
+func newBSDRouter(r Router, logf logger.Logf, netMon *netmon.Monitor, health *health.Tracker, tunname string) *bsdRouter {
+	br := &bsdRouter{
+		Router:  r,
+		logf:    logf,
+		health:  health,
+		netMon:  netMon,
+		tunname: tunname,
+		run:     runWithStdin,
+	}
+	// tailscaled's sockets, such as magicsock's, are created before any exit
+	// node is used, so they must use the bypass table from the start.
+	if table := bypassRoutingTable(); table != 0 {
+		if err := br.updateBypassRoute(); err != nil {
+			logf("not using routing table %d for tailscaled's traffic: %v", table, err)
+		} else {
+			netns.SetBypassRoutingTable(table)
+		}
+	}
+	if netMon != nil {
+		br.unregNetMon = netMon.RegisterChangeCallback(br.onLinkChange)
+	}
+	return br
+}
+
+func runWithStdin(stdin []byte, args ...string) ([]byte, error) {
+	c := cmd(args...)
+	if stdin != nil {
+		c.Stdin = bytes.NewReader(stdin)
+	}
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("running %q failed: %w\n%s", strings.Join(args, " "), err, out)
+	}
+	return out, nil
+}
+
+func (r *bsdRouter) onLinkChange(delta *netmon.ChangeDelta) {
+	if !delta.Major {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.bypassGW.IsValid() {
+		if err := r.updateBypassRoute(); err != nil {
+			r.logf("updating default route in routing table %d: %v", bypassRoutingTable(), err)
+		}
+	}
+	// Subnet routes may now be on other interfaces.
+	if r.lastCfg != nil {
+		if err := r.setPF(r.lastCfg); err != nil {
+			r.logf("updating pf rules: %v", err)
+		}
+	}
+}
+
+// Set implements Router.
+func (r *bsdRouter) Set(cfg *Config) error {
+	if cfg == nil {
+		cfg = &shutdownConfig
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastCfg = cfg
+	return multierr.New(
+		r.Router.Set(r.withExitNodeRoutes(cfg)),
+		r.setPF(cfg),
+	)
+}
+
+// Close implements Router.
+func (r *bsdRouter) Close() error {
+	if r.unregNetMon != nil {
+		r.unregNetMon()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	if r.pfRules != nil {
+		errs = append(errs, r.flushPF())
+	}
+	return multierr.New(append(errs, r.Router.Close())...)
+}
+
+var exitNodeRoutingWarnable = health.Register(&health.Warnable{
+	Code:     "bsd-exit-node-routing",
+	Title:    "Exit node unavailable",
+	Severity: health.SeverityHigh,
+	Text: func(args health.Args) string {
+		return fmt.Sprintf("Using an exit node requires a routing table for tailscaled's own traffic, so that it doesn't loop through the exit node: %s. Set TS_BSD_BYPASS_ROUTING_TABLE to the number of a spare routing table and restart tailscaled.", args[health.ArgError])
+	},
+	Component: health.ComponentRouter,
+})
+
+// withExitNodeRoutes returns cfg with its default routes, if it has any
+// because an exit node is in use, replaced with routes that the kernel
+// can install alongside the host's own default route.
+//
+// If tailscaled's traffic doesn't use a bypass routing table, the default
+// routes are dropped instead, as they would route tailscaled's traffic to
+// the exit node into Tailscale.
+func (r *bsdRouter) withExitNodeRoutes(cfg *Config) *Config {
+	if !slices.ContainsFunc(cfg.Routes, isDefaultRoute) {
+		r.health.SetHealthy(exitNodeRoutingWarnable)
+		return cfg
+	}
+	bypass := r.bypassGW.IsValid()
+	if !bypass {
+		err := "TS_BSD_BYPASS_ROUTING_TABLE isn't set"
+		if table := bypassRoutingTable(); table != 0 {
+			err = fmt.Sprintf("routing table %d couldn't be set up", table)
+		}
+		r.health.SetUnhealthy(exitNodeRoutingWarnable, health.Args{health.ArgError: err})
+	} else {
+		r.health.SetHealthy(exitNodeRoutingWarnable)
+	}
+	newCfg := *cfg
+	newCfg.Routes = splitDefaultRoutes(cfg.Routes, bypass)
+	return &newCfg
+}
+
+func isDefaultRoute(p netip.Prefix) bool {
+	return p.Bits() == 0
+}
+
+// splitDefaultRoutes returns routes with each default route replaced by the
+// two halves of the address space, which take precedence over the host's own
+// default route without replacing it, or removed if !keep.
+func splitDefaultRoutes(routes []netip.Prefix, keep bool) []netip.Prefix {
+	var ret []netip.Prefix
+	for _, p := range routes {
+		switch {
+		case !isDefaultRoute(p):
+			ret = append(ret, p)
+		case !keep:
+		case p.Addr().Is4():
+			ret = append(ret, netip.MustParsePrefix("0.0.0.0/1"), netip.MustParsePrefix("128.0.0.0/1"))
+		default:
+			ret = append(ret, netip.MustParsePrefix("::/1"), netip.MustParsePrefix("8000::/1"))
+		}
+	}
+	return ret
+}
+
+// updateBypassRoute makes the default route in bypassRoutingTable that of
+// the host. Only IPv4 is supported, so tailscaled's IPv6 traffic fails,
+// rather than loops, while an exit node is in use.
+func (r *bsdRouter) updateBypassRoute() error {
+	table := strconv.Itoa(bypassRoutingTable())
+	out, err := r.run(nil, "netstat", "-rn", "-f", "inet")
+	if err != nil {
+		return err
+	}
+	gw, ok := parseDefaultGateway(out)
+	if !ok {
+		return fmt.Errorf("no IPv4 default route")
+	}
+	if gw == r.bypassGW {
+		return nil
+	}
+	routeCmd := func(args ...string) []string {
+		if runtime.GOOS == "openbsd" {
+			return append([]string{"route", "-q", "-n", "-T", table}, args...)
+		}
+		return append([]string{"route", "-q", "-n", args[0], "-fib", table}, args[1:]...)
+	}
+	if r.bypassGW.IsValid() {
+		// Ignore errors; the route may be gone already.
+		r.run(nil, routeCmd("delete", "-inet", "default")...)
+	}
+	if _, err := r.run(nil, routeCmd("add", "-inet", "default", gw.String())...); err != nil {
+		r.bypassGW = netip.Addr{}
+		return err
+	}
+	r.logf("using default route via %v in routing table %s for tailscaled's traffic", gw, table)
+	r.bypassGW = gw
+	return nil
+}
+
+// parseDefaultGateway returns the gateway of the IPv4 default route in the
+// output of "netstat -rn -f inet".
+func parseDefaultGateway(netstatOut []byte) (gw netip.Addr, ok bool) {
+	sc := bufio.NewScanner(bytes.NewReader(netstatOut))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 2 || f[0] != "default" {
+			continue
+		}
+		if gw, err := netip.ParseAddr(f[1]); err == nil && gw.Is4() {
+			return gw, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+var pfConflictWarnable = health.Register(&health.Warnable{
+	Code:     "pf-firewall-conflict",
+	Title:    "Firewall may block Tailscale traffic",
+	Severity: health.SeverityMedium,
+	Text: func(args health.Args) string {
+		return fmt.Sprintf("Tailscale keeps its pf rules in the %q anchor, but they don't apply: %s.", pfAnchor, args[health.ArgError])
+	},
+	Component: health.ComponentRouter,
+})
+
+// setPF loads tailscaled's pf rules for cfg into pfAnchor, or removes them
+// if cfg.NetfilterMode is off, and checks that pf applies them.
+func (r *bsdRouter) setPF(cfg *Config) error {
+	if cfg.NetfilterMode == preftype.NetfilterOff || len(cfg.LocalAddrs) == 0 {
+		r.health.SetHealthy(pfConflictWarnable)
+		if r.pfRules == nil {
+			return nil
+		}
+		return r.flushPF()
+	}
+	if _, err := exec.LookPath("pfctl"); err != nil {
+		r.health.SetHealthy(pfConflictWarnable)
+		return nil
+	}
+	nat := r.pfNATs(cfg)
+	rules := pfRules(runtime.GOOS, r.tunname, nat)
+	if !bytes.Equal(rules, r.pfRules) {
+		if _, err := r.run(rules, "pfctl", "-a", pfAnchor, "-f", "-"); err != nil {
+			return fmt.Errorf("loading pf rules: %w", err)
+		}
+		r.pfRules = rules
+	}
+	r.checkPFConflicts(len(nat) > 0)
+	return nil
+}
+
+func (r *bsdRouter) flushPF() error {
+	if _, err := r.run(nil, "pfctl", "-a", pfAnchor, "-F", "all"); err != nil {
+		return fmt.Errorf("flushing pf rules: %w", err)
+	}
+	r.pfRules = nil
+	return nil
+}
+
+// pfNAT is a masquerading rule for traffic from Tailscale to Dst, out of
+// Interface.
+type pfNAT struct {
+	Interface string
+	Dst       netip.Prefix
+}
+
+// pfNATs returns the masquerading rules for the subnets that cfg advertises,
+// if cfg.SNATSubnetRoutes.
+func (r *bsdRouter) pfNATs(cfg *Config) []pfNAT {
+	if !cfg.SNATSubnetRoutes || len(cfg.SubnetRoutes) == 0 || r.netMon == nil {
+		return nil
+	}
+	st := r.netMon.InterfaceState()
+	defIf, _ := netmon.DefaultRouteInterface()
+	var ret []pfNAT
+	for _, route := range cfg.SubnetRoutes {
+		if isDefaultRoute(route) {
+			if defIf != "" {
+				ret = append(ret, pfNAT{defIf, route})
+			}
+			continue
+		}
+		// Masquerade out of the interfaces on the subnet.
+		for name, pfxs := range st.InterfaceIPs {
+			if name == r.tunname {
+				continue
+			}
+			if slices.ContainsFunc(pfxs, func(p netip.Prefix) bool { return route.Overlaps(p) }) {
+				ret = append(ret, pfNAT{name, route})
+			}
+		}
+	}
+	slices.SortFunc(ret, func(a, b pfNAT) int {
+		if c := strings.Compare(a.Interface, b.Interface); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Dst.String(), b.Dst.String())
+	})
+	return ret
+}
+
+// pfRules returns tailscaled's pf rules for goos, the Tailscale interface
+// tunname and the masquerading rules nat, in pf.conf syntax. They're the
+// equivalent of tailscaled's netfilter rules on Linux.
+func pfRules(goos, tunname string, nat []pfNAT) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Managed by tailscaled; changes are overwritten.\n")
+	cgnat, ula := tsaddr.CGNATRange(), tsaddr.TailscaleULARange()
+	inet := func(p netip.Prefix) string {
+		if p.Addr().Is4() {
+			return "inet"
+		}
+		return "inet6"
+	}
+	src := func(p netip.Prefix) netip.Prefix {
+		if p.Addr().Is4() {
+			return cgnat
+		}
+		return ula
+	}
+	// FreeBSD's pf wants translation rules before filter rules.
+	if goos == "freebsd" {
+		for _, n := range nat {
+			fmt.Fprintf(&b, "nat on %s %s from %s to %s tagged %s -> (%s:0)\n", n.Interface, inet(n.Dst), src(n.Dst), pfAddr(n.Dst), pfTag, n.Interface)
+		}
+	}
+	// Drop Tailscale addresses spoofed from other interfaces.
+	fmt.Fprintf(&b, "block in quick on ! %s inet from %s\n", tunname, cgnat)
+	fmt.Fprintf(&b, "block in quick on ! %s inet6 from %s\n", tunname, ula)
+	if goos != "freebsd" {
+		for _, n := range nat {
+			fmt.Fprintf(&b, "match out on %s %s from %s to %s tagged %s nat-to (%s:0)\n", n.Interface, inet(n.Dst), src(n.Dst), pfAddr(n.Dst), pfTag, n.Interface)
+		}
+	}
+	// Pass Tailscale traffic, which tailscaled has already filtered, and
+	// traffic forwarded from Tailscale to subnets and the internet.
+	fmt.Fprintf(&b, "pass in quick on %s tag %s\n", tunname, pfTag)
+	fmt.Fprintf(&b, "pass out quick on %s\n", tunname)
+	fmt.Fprintf(&b, "pass out quick tagged %s\n", pfTag)
+	return b.Bytes()
+}
+
+// pfAddr returns p as a pf address.
+func pfAddr(p netip.Prefix) string {
+	if p.Bits() == 0 {
+		return "any"
+	}
+	return p.String()
+}
+
+// checkPFConflicts reports, as a health warning, whether pf doesn't apply
+// the rules in pfAnchor. nat is whether the rules include masquerading rules.
+func (r *bsdRouter) checkPFConflicts(nat bool) {
+	info, err := r.run(nil, "pfctl", "-s", "info")
+	if err != nil {
+		r.logf("checking pf status: %v", err)
+		return
+	}
+	var rules, natRules []byte
+	if pfEnabled(info) {
+		rules, err = r.run(nil, "pfctl", "-s", "rules")
+		if err == nil && nat && runtime.GOOS == "freebsd" {
+			natRules, err = r.run(nil, "pfctl", "-s", "nat")
+		}
+		if err != nil {
+			r.logf("checking pf rules: %v", err)
+			return
+		}
+	}
+	problems := pfProblems(runtime.GOOS, pfEnabled(info), rules, natRules, nat)
+	if len(problems) == 0 {
+		r.health.SetHealthy(pfConflictWarnable)
+		return
+	}
+	r.health.SetUnhealthy(pfConflictWarnable, health.Args{health.ArgError: strings.Join(problems, "; ")})
+}
+
+// pfEnabled reports whether the output of "pfctl -s info" says that pf is
+// enabled.
+func pfEnabled(info []byte) bool {
+	return bytes.Contains(info, []byte("Status: Enabled"))
+}
+
+// pfProblems returns why pf doesn't apply tailscaled's rules, given
+// whether pf is enabled, the output of "pfctl -s rules" and "pfctl -s nat",
+// and whether tailscaled's rules include masquerading rules.
+func pfProblems(goos string, enabled bool, rules, natRules []byte, nat bool) []string {
+	if !enabled {
+		if nat {
+			return []string{"pf is disabled, so traffic to advertised routes isn't masqueraded; enable pf, or disable masquerading with --snat-subnet-routes=false"}
+		}
+		// Without pf, nothing blocks Tailscale traffic.
+		return nil
+	}
+	var ret []string
+	if !pfCallsAnchor(rules, "anchor") {
+		ret = append(ret, fmt.Sprintf("the main ruleset doesn't call it; add 'anchor %q' to pf.conf before rules that may block Tailscale traffic", pfAnchor))
+	}
+	if nat && goos == "freebsd" && !pfCallsAnchor(natRules, "nat-anchor") {
+		ret = append(ret, fmt.Sprintf("the main ruleset doesn't call it for translation rules, so traffic to advertised routes isn't masqueraded; add 'nat-anchor %q' to pf.conf", pfAnchor))
+	}
+	return ret
+}
+
+// pfCallsAnchor reports whether the rules, as output by pfctl, call
+// pfAnchor with the given kind of anchor rule.
+func pfCallsAnchor(rules []byte, kind string) bool {
+	want := fmt.Sprintf("%s %q", kind, pfAnchor)
+	sc := bufio.NewScanner(bytes.NewReader(rules))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == want || strings.HasPrefix(line, want+" ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build freebsd || openbsd
+
+package router
+
+import (
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"tailscale.com/health"
+)
+
+func TestSplitDefaultRoutes(t *testing.T) {
+	pfxs := func(ss ...string) (ret []netip.Prefix) {
+		for _, s := range ss {
+			ret = append(ret, netip.MustParsePrefix(s))
+		}
+		return ret
+	}
+	routes := pfxs("100.64.0.1/32", "0.0.0.0/0", "::/0", "192.168.0.0/24")
+	got := splitDefaultRoutes(routes, true)
+	want := pfxs("100.64.0.1/32", "0.0.0.0/1", "128.0.0.0/1", "::/1", "8000::/1", "192.168.0.0/24")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keep: got %v; want %v", got, want)
+	}
+	got = splitDefaultRoutes(routes, false)
+	want = pfxs("100.64.0.1/32", "192.168.0.0/24")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("drop: got %v; want %v", got, want)
+	}
+}
+
+func TestParseDefaultGateway(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want string
+	}{
+		{
+			name: "freebsd",
+			out: `Routing tables
+
+Internet:
+Destination        Gateway            Flags     Netif Expire
+0.0.0.0/1          link#3             US    tailscale0
+default            192.168.1.1        UGS         em0
+127.0.0.1          link#2             UH          lo0
+`,
+			want: "192.168.1.1",
+		},
+		{
+			name: "openbsd",
+			out: `Routing tables
+
+Internet:
+Destination        Gateway            Flags   Refs      Use   Mtu  Prio Iface
+default            10.0.2.2           UGS        5      120     -     8 vio0
+10.0.2/24          10.0.2.15          UCn        1        0     -     4 vio0
+`,
+			want: "10.0.2.2",
+		},
+		{
+			name: "none",
+			out:  "Internet:\nDestination Gateway Flags Netif Expire\n127.0.0.1 link#2 UH lo0\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseDefaultGateway([]byte(tt.out))
+			if ok != (tt.want != "") || (ok && got.String() != tt.want) {
+				t.Errorf("got %v, %v; want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestPFRules(t *testing.T) {
+	nat := []pfNAT{
+		{"em1", netip.MustParsePrefix("192.168.1.0/24")},
+		{"em0", netip.MustParsePrefix("::/0")},
+	}
+	got := string(pfRules("openbsd", "tun0", nat))
+	want := `# Managed by tailscaled; changes are overwritten.
+block in quick on ! tun0 inet from 100.64.0.0/10
+block in quick on ! tun0 inet6 from fd7a:115c:a1e0::/48
+match out on em1 inet from 100.64.0.0/10 to 192.168.1.0/24 tagged tailscale nat-to (em1:0)
+match out on em0 inet6 from fd7a:115c:a1e0::/48 to any tagged tailscale nat-to (em0:0)
+pass in quick on tun0 tag tailscale
+pass out quick on tun0
+pass out quick tagged tailscale
+`
+	if got != want {
+		t.Errorf("openbsd rules:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = string(pfRules("freebsd", "tailscale0", nat[:1]))
+	want = `# Managed by tailscaled; changes are overwritten.
+nat on em1 inet from 100.64.0.0/10 to 192.168.1.0/24 tagged tailscale -> (em1:0)
+block in quick on ! tailscale0 inet from 100.64.0.0/10
+block in quick on ! tailscale0 inet6 from fd7a:115c:a1e0::/48
+pass in quick on tailscale0 tag tailscale
+pass out quick on tailscale0
+pass out quick tagged tailscale
+`
+	if got != want {
+		t.Errorf("freebsd rules:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPFProblems(t *testing.T) {
+	const withAnchor = "block drop in all\nanchor \"tailscale\" all\npass out all flags S/SA\n"
+	const withoutAnchor = "block drop in all\npass out all flags S/SA\n"
+	const natAnchor = "nat-anchor \"tailscale\" all\n"
+	tests := []struct {
+		name     string
+		goos     string
+		enabled  bool
+		rules    string
+		natRules string
+		nat      bool
+		want     []string // substrings of the problems
+	}{
+		{name: "disabled", goos: "openbsd"},
+		{name: "disabled-nat", goos: "openbsd", nat: true, want: []string{"pf is disabled"}},
+		{name: "anchored", goos: "openbsd", enabled: true, rules: withAnchor, nat: true},
+		{name: "no-anchor", goos: "openbsd", enabled: true, rules: withoutAnchor, want: []string{`add 'anchor "tailscale"'`}},
+		{name: "freebsd-nat", goos: "freebsd", enabled: true, rules: withAnchor, natRules: natAnchor, nat: true},
+		{name: "freebsd-no-nat-anchor", goos: "freebsd", enabled: true, rules: withAnchor, nat: true, want: []string{`add 'nat-anchor "tailscale"'`}},
+		{name: "other-anchor", goos: "openbsd", enabled: true, rules: "anchor \"tailscale-other\" all\n", want: []string{"doesn't call it"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pfProblems(tt.goos, tt.enabled, []byte(tt.rules), []byte(tt.natRules), tt.nat)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q; want %d problems", got, len(tt.want))
+			}
+			for i := range got {
+				if !strings.Contains(got[i], tt.want[i]) {
+					t.Errorf("problem %d = %q; want it to contain %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBSDRouterExitNodeRoutes(t *testing.T) {
+	ht := new(health.Tracker)
+	warned := func() bool {
+		return slices.ContainsFunc(ht.Strings(), func(s string) bool {
+			return strings.Contains(s, "Using an exit node")
+		})
+	}
+	r := &bsdRouter{health: ht}
+	cfg := &Config{Routes: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")}}
+	if got := r.withExitNodeRoutes(cfg); len(got.Routes) != 0 {
+		t.Errorf("without bypass table, routes = %v; want none", got.Routes)
+	}
+	if !warned() {
+		t.Errorf("want exit node warning")
+	}
+	r.bypassGW = netip.MustParseAddr("192.168.1.1")
+	if got := r.withExitNodeRoutes(cfg); len(got.Routes) != 2 {
+		t.Errorf("with bypass table, routes = %v; want two halves", got.Routes)
+	}
+	if warned() {
+		t.Errorf("want no exit node warning")
+	}
+}
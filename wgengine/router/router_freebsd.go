@@ -16,7 +16,11 @@
 // https://svnweb.freebsd.org/base?view=revision&revision=357986
 
 func newUserspaceRouter(logf logger.Logf, tundev tun.Device, netMon *netmon.Monitor, health *health.Tracker) (Router, error) {
-	return newUserspaceBSDRouter(logf, tundev, netMon, health)
+	r, err := newUserspaceBSDRouter(logf, tundev, netMon, health)
+	if err != nil {
+		return nil, err
+	}
+	return newBSDRouter(r, logf, netMon, health, r.(*userspaceBSDRouter).tunname), nil
 }
 
 func cleanUp(logf logger.Logf, interfaceName string) {
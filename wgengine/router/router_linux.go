@@ -435,6 +435,7 @@ func (r *linuxRouter) Set(cfg *Config) error {
 	}
 	r.statefulFiltering = cfg.StatefulFiltering
 	r.updateStatefulFilteringWithDockerWarning(cfg)
+	r.updateFirewallConflicts()
 
 	// Issue 11405: enable IP forwarding on gokrazy.
 	advertisingRoutes := len(cfg.SubnetRoutes) > 0
@@ -446,10 +447,12 @@ func (r *linuxRouter) Set(cfg *Config) error {
 }
 
 var dockerStatefulFilteringWarnable = health.Register(&health.Warnable{
-	Code:     "docker-stateful-filtering",
-	Title:    "Docker with stateful filtering",
-	Severity: health.SeverityMedium,
-	Text:     health.StaticMessage("Stateful filtering is enabled and Docker was detected; this may prevent Docker containers on this host from resolving DNS and connecting to Tailscale nodes. See https://tailscale.com/s/stateful-docker"),
+	Code:           "docker-stateful-filtering",
+	Title:          "Docker with stateful filtering",
+	Severity:       health.SeverityMedium,
+	Text:           health.StaticMessage("Stateful filtering is enabled and Docker was detected; this may prevent Docker containers on this host from resolving DNS and connecting to Tailscale nodes. See https://tailscale.com/s/stateful-docker"),
+	Component:      health.ComponentRouter,
+	RemediationURL: "https://tailscale.com/s/stateful-docker",
 })
 
 func (r *linuxRouter) updateStatefulFilteringWithDockerWarning(cfg *Config) {
@@ -493,6 +496,55 @@ func (r *linuxRouter) updateStatefulFilteringWithDockerWarning(cfg *Config) {
 	r.health.SetHealthy(dockerStatefulFilteringWarnable)
 }
 
+var firewallConflictWarnable = health.Register(&health.Warnable{
+	Code:     "nftables-firewall-conflict",
+	Title:    "Firewall may block Tailscale traffic",
+	Severity: health.SeverityMedium,
+	Text: func(args health.Args) string {
+		return fmt.Sprintf("Tailscale keeps its nftables rules in tables of its own, and other firewall chains on this host may drop traffic those rules accept: %s. Allow traffic on the Tailscale interface in those firewalls, or set TS_NFTABLES_INSERT_ACCEPT_RULES=1 for tailscaled to insert accept rules into them.", args[health.ArgError])
+	},
+	Component: health.ComponentRouter,
+})
+
+// insertAcceptRules is whether, when the netfilter runner keeps its rules in
+// tables of its own, tailscaled inserts rules accepting Tailscale traffic
+// into the chains of other firewalls that would otherwise drop it.
+var insertAcceptRules = envknob.RegisterBool("TS_NFTABLES_INSERT_ACCEPT_RULES")
+
+// updateFirewallConflicts checks for the chains of other firewalls that may
+// drop Tailscale traffic, if the netfilter runner keeps its rules in tables
+// of its own, and reports them as a health warning, or inserts accept rules
+// into them if insertAcceptRules is set.
+func (r *linuxRouter) updateFirewallConflicts() {
+	cd, ok := r.nfr.(linuxfw.ConflictDetector)
+	if !ok || r.netfilterMode != netfilterOn {
+		r.health.SetHealthy(firewallConflictWarnable)
+		return
+	}
+	conflicts, err := cd.DetectConflicts(r.tunname)
+	if err != nil {
+		r.logf("detecting firewall conflicts: %v", err)
+		return
+	}
+	if len(conflicts) > 0 && insertAcceptRules() {
+		if err := cd.AcceptInConflictingChains(r.tunname, conflicts); err != nil {
+			r.logf("inserting accept rules into other firewalls: %v", err)
+		} else {
+			r.logf("inserted accept rules for %s into %v", r.tunname, conflicts)
+			conflicts = nil
+		}
+	}
+	if len(conflicts) == 0 {
+		r.health.SetHealthy(firewallConflictWarnable)
+		return
+	}
+	descs := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		descs[i] = c.String()
+	}
+	r.health.SetUnhealthy(firewallConflictWarnable, health.Args{health.ArgError: strings.Join(descs, "; ")})
+}
+
 // UpdateMagicsockPort implements the Router interface.
 func (r *linuxRouter) UpdateMagicsockPort(port uint16, network string) error {
 	if r.nfr == nil {
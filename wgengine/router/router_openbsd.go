@@ -37,11 +37,12 @@ func newUserspaceRouter(logf logger.Logf, tundev tun.Device, netMon *netmon.Moni
 		return nil, err
 	}
 
-	return &openbsdRouter{
+	r := &openbsdRouter{
 		logf:    logf,
 		netMon:  netMon,
 		tunname: tunname,
-	}, nil
+	}
+	return newBSDRouter(r, logf, netMon, health, tunname), nil
 }
 
 func cmd(args ...string) *exec.Cmd {
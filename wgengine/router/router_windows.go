@@ -27,6 +27,7 @@
 	"tailscale.com/net/dns"
 	"tailscale.com/net/netmon"
 	"tailscale.com/types/logger"
+	"tailscale.com/wf"
 )
 
 type winRouter struct {
@@ -349,6 +350,14 @@ func (ft *firewallTweaker) doSet(local []string, killswitch bool, clear bool, pr
 			ft.fwProc.Wait()
 			ft.fwProc = nil
 			ft.fwProcEncoder = nil
+			// The killswitch subprocess removes its filters as it
+			// exits, but if it crashed or was killed, make sure
+			// none are left blocking traffic.
+			if n, err := wf.Cleanup(); err != nil {
+				ft.logf("removing leftover killswitch filters: %v", err)
+			} else if n > 0 {
+				ft.logf("removed %d leftover killswitch filters", n)
+			}
 		}
 		return nil
 	}
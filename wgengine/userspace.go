@@ -123,6 +123,7 @@ type userspaceEngine struct {
 	lastCfgFull         wgcfg.Config
 	lastNMinPeers       int
 	lastRouterSig       deephash.Sum // of router.Config
+	lastDNSSig          deephash.Sum // of dns.Config
 	lastEngineSigFull   deephash.Sum // of full wireguard config
 	lastEngineSigTrim   deephash.Sum // of trimmed wireguard config
 	lastDNSConfig       *dns.Config
@@ -418,6 +419,7 @@ func NewUserspaceEngine(logf logger.Logf, conf Config) (_ Engine, reterr error)
 		e.tundev.PostFilterPacketInboundFromWireGuard = echoRespondToAll
 	}
 	e.tundev.PreFilterPacketOutboundToWireGuardEngineIntercept = e.handleLocalPackets
+	e.tundev.PeerPathMTU = e.magicConn.PeerPathMTU
 
 	if envknob.BoolDefaultTrue("TS_DEBUG_CONNECT_FAILURES") {
 		if e.tundev.PreFilterPacketInboundFromWireGuard != nil {
@@ -602,12 +604,19 @@ func (e *userspaceEngine) forceFullWireguardConfig(numPeers int) bool {
 // For implementation simplicity, we can only trim peers that have
 // only non-subnet AllowedIPs (an IPv4 /32 or IPv6 /128), which is the
 // common case for most peers. Subnet router nodes will just always be
-// created in the wireguard-go config.
+// created in the wireguard-go config, as will peers with a persistent
+// keepalive.
 func (e *userspaceEngine) isTrimmablePeer(p *wgcfg.Peer, numPeers int) bool {
 	if e.forceFullWireguardConfig(numPeers) {
 		return false
 	}
 
+	// Peers with a persistent keepalive must stay configured for
+	// wireguard-go to send their keepalives while they are idle.
+	if p.PersistentKeepalive != 0 {
+		return false
+	}
+
 	// AllowedIPs must all be single IPs, not subnets.
 	for _, aip := range p.AllowedIPs {
 		if !aip.IsSingleIP() {
@@ -902,15 +911,20 @@ func (e *userspaceEngine) Reconfig(cfg *wgcfg.Config, routerCfg *router.Config,
 	isSubnetRouterChanged := isSubnetRouter != e.lastIsSubnetRouter
 
 	engineChanged := deephash.Update(&e.lastEngineSigFull, cfg)
-	routerChanged := deephash.Update(&e.lastRouterSig, &struct {
-		RouterConfig *router.Config
-		DNSConfig    *dns.Config
-	}{routerCfg, dnsCfg})
-	listenPortChanged := listenPort != e.magicConn.LocalPort()
+	routerChanged := deephash.Update(&e.lastRouterSig, routerCfg)
+	dnsChanged := deephash.Update(&e.lastDNSSig, dnsCfg)
+	// Compare against the preferred port rather than the bound one: when
+	// any port will do, the bound port never matches.
+	listenPortChanged := listenPort != e.magicConn.PreferredPort()
 	peerMTUChanged := peerMTUEnable != e.magicConn.PeerMTUEnabled()
-	if !engineChanged && !routerChanged && !listenPortChanged && !isSubnetRouterChanged && !peerMTUChanged {
+	if !engineChanged && !routerChanged && !dnsChanged && !listenPortChanged && !isSubnetRouterChanged && !peerMTUChanged {
 		return ErrNoChanges
 	}
+	// Policy changes that leave the WireGuard peers alone (such as a new
+	// packet filter, DNS config or serve config) must not reconfigure
+	// magicsock or wireguard-go, which would needlessly disturb existing
+	// sessions.
+	wgChanged := engineChanged || listenPortChanged || peerMTUChanged
 	newLogIDs := cfg.NetworkLogging
 	oldLogIDs := e.lastCfgFull.NetworkLogging
 	netLogIDsNowValid := !newLogIDs.NodeID.IsZero() && !newLogIDs.DomainID.IsZero()
@@ -955,19 +969,21 @@ func (e *userspaceEngine) Reconfig(cfg *wgcfg.Config, routerCfg *router.Config,
 
 	e.lastCfgFull = *cfg.Clone()
 
-	// Tell magicsock about the new (or initial) private key
-	// (which is needed by DERP) before wgdev gets it, as wgdev
-	// will start trying to handshake, which we want to be able to
-	// go over DERP.
-	if err := e.magicConn.SetPrivateKey(cfg.PrivateKey); err != nil {
-		e.logf("wgengine: Reconfig: SetPrivateKey: %v", err)
-	}
-	e.magicConn.UpdatePeers(peerSet)
-	e.magicConn.SetPreferredPort(listenPort)
-	e.magicConn.UpdatePMTUD()
+	if wgChanged {
+		// Tell magicsock about the new (or initial) private key
+		// (which is needed by DERP) before wgdev gets it, as wgdev
+		// will start trying to handshake, which we want to be able to
+		// go over DERP.
+		if err := e.magicConn.SetPrivateKey(cfg.PrivateKey); err != nil {
+			e.logf("wgengine: Reconfig: SetPrivateKey: %v", err)
+		}
+		e.magicConn.UpdatePeers(peerSet)
+		e.magicConn.SetPreferredPort(listenPort)
+		e.magicConn.UpdatePMTUD()
 
-	if err := e.maybeReconfigWireguardLocked(discoChanged); err != nil {
-		return err
+		if err := e.maybeReconfigWireguardLocked(discoChanged); err != nil {
+			return err
+		}
 	}
 
 	// Shutdown the network logger because the IDs changed.
@@ -1002,11 +1018,14 @@ func (e *userspaceEngine) Reconfig(cfg *wgcfg.Config, routerCfg *router.Config,
 		if err != nil {
 			return err
 		}
-		// Keep DNS configuration after router configuration, as some
-		// DNS managers refuse to apply settings if the device has no
-		// assigned address.
+	}
+	// Keep DNS configuration after router configuration, as some
+	// DNS managers refuse to apply settings if the device has no
+	// assigned address. For the same reason, reapply it whenever
+	// the router config changes.
+	if routerChanged || dnsChanged {
 		e.logf("wgengine: Reconfig: configuring DNS")
-		err = e.dns.Set(*dnsCfg)
+		err := e.dns.Set(*dnsCfg)
 		e.health.SetDNSHealth(err)
 		if err != nil {
 			return err
@@ -25,6 +25,7 @@
 	"tailscale.com/types/key"
 	"tailscale.com/types/netmap"
 	"tailscale.com/types/opt"
+	"tailscale.com/util/dnsname"
 	"tailscale.com/util/usermetric"
 	"tailscale.com/wgengine/router"
 	"tailscale.com/wgengine/wgcfg"
@@ -160,6 +161,65 @@ func TestUserspaceEngineReconfig(t *testing.T) {
 	}
 }
 
+// Test that a Reconfig that only changes DNS or routing doesn't reconfigure
+// WireGuard.
+func TestUserspaceEngineReconfigWithoutPeerChanges(t *testing.T) {
+	ht := new(health.Tracker)
+	reg := new(usermetric.Registry)
+	e, err := NewFakeUserspaceEngine(t.Logf, 0, ht, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	ue := e.(*userspaceEngine)
+
+	cfg := &wgcfg.Config{
+		Peers: []wgcfg.Peer{
+			{
+				PublicKey: nkFromHex("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+				AllowedIPs: []netip.Prefix{
+					netip.PrefixFrom(netaddr.IPv4(100, 100, 99, 1), 32),
+				},
+			},
+		},
+	}
+	if err := e.Reconfig(cfg, &router.Config{}, &dns.Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	wgReconfigs := 0
+	ue.testMaybeReconfigHook = func() { wgReconfigs++ }
+
+	dnsCfg := &dns.Config{SearchDomains: []dnsname.FQDN{"example.com."}}
+	if err := e.Reconfig(cfg, &router.Config{}, dnsCfg); err != nil {
+		t.Fatal(err)
+	}
+	routerCfg := &router.Config{LocalAddrs: []netip.Prefix{netip.MustParsePrefix("100.100.99.2/32")}}
+	if err := e.Reconfig(cfg, routerCfg, dnsCfg); err != nil {
+		t.Fatal(err)
+	}
+	if wgReconfigs != 0 {
+		t.Errorf("got %d WireGuard reconfigs for DNS and router changes; want 0", wgReconfigs)
+	}
+	if err := e.Reconfig(cfg, routerCfg, dnsCfg); err != ErrNoChanges {
+		t.Errorf("Reconfig with same config = %v; want ErrNoChanges", err)
+	}
+
+	cfg = cfg.Clone()
+	cfg.Peers = append(cfg.Peers, wgcfg.Peer{
+		PublicKey: nkFromHex("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"),
+		AllowedIPs: []netip.Prefix{
+			netip.PrefixFrom(netaddr.IPv4(100, 100, 99, 3), 32),
+		},
+	})
+	if err := e.Reconfig(cfg, routerCfg, dnsCfg); err != nil {
+		t.Fatal(err)
+	}
+	if wgReconfigs != 1 {
+		t.Errorf("got %d WireGuard reconfigs after adding a peer; want 1", wgReconfigs)
+	}
+}
+
 func TestUserspaceEnginePortReconfig(t *testing.T) {
 	flakytest.Mark(t, "https://github.com/tailscale/tailscale/issues/2855")
 	const defaultPort = 49983
@@ -178,6 +178,38 @@ func TestDeviceConfig(t *testing.T) {
 		}
 	})
 
+	t.Run("device1 add allowed IP", func(t *testing.T) {
+		p, ok := cfg1.PeerWithKey(k2)
+		if !ok {
+			t.Fatal("failed to look up peer 2")
+		}
+		prev, err := DeviceConfig(device1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range cfg1.Peers {
+			if cfg1.Peers[i].PublicKey == k2 {
+				cfg1.Peers[i].AllowedIPs = append(p.AllowedIPs, netip.MustParsePrefix("10.1.0.0/16"))
+			}
+		}
+
+		uapi := new(strings.Builder)
+		if err := cfg1.ToUAPI(t.Logf, uapi, prev); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(uapi.String(), "replace_allowed_ips") {
+			t.Errorf("adding an allowed IP replaced them all:\n%s", uapi)
+		}
+		if strings.Contains(uapi.String(), k3.UntypedHexString()) {
+			t.Errorf("adding an allowed IP touched an unrelated peer:\n%s", uapi)
+		}
+
+		if err := ReconfigDevice(device1, cfg1, t.Logf); err != nil {
+			t.Fatal(err)
+		}
+		cmp(t, device1, cfg1)
+	})
+
 	t.Run("device1 remove peer", func(t *testing.T) {
 		removeKey := cfg1.Peers[len(cfg1.Peers)-1].PublicKey
 		cfg1.Peers = cfg1.Peers[:len(cfg1.Peers)-1]
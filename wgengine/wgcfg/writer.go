@@ -90,14 +90,20 @@ func (cfg *Config) ToUAPI(logf logger.Logf, w io.Writer, prev *Config) error {
 			set("endpoint", p.PublicKey.UntypedHexString())
 		}
 
-		// TODO: replace_allowed_ips is expensive.
-		// If p.AllowedIPs is a strict superset of oldPeer.AllowedIPs,
-		// then skip replace_allowed_ips and instead add only
-		// the new ipps with allowed_ip.
+		// replace_allowed_ips is expensive, so if p.AllowedIPs is a
+		// strict superset of oldPeer.AllowedIPs (as when a peer starts
+		// advertising another subnet), add only the new ipps with
+		// allowed_ip.
 		if willChangeIPs {
-			set("replace_allowed_ips", "true")
-			for _, ipp := range p.AllowedIPs {
-				set("allowed_ip", ipp.String())
+			if added, ok := cidrsAdded(oldPeer.AllowedIPs, p.AllowedIPs); wasPresent && ok {
+				for _, ipp := range added {
+					set("allowed_ip", ipp.String())
+				}
+			} else {
+				set("replace_allowed_ips", "true")
+				for _, ipp := range p.AllowedIPs {
+					set("allowed_ip", ipp.String())
+				}
 			}
 		}
 
@@ -152,3 +158,20 @@ func cidrsEqual(x, y []netip.Prefix) bool {
 	}
 	return true
 }
+
+// cidrsAdded reports the prefixes of y that aren't in x, and whether y
+// contains all the prefixes of x.
+func cidrsAdded(x, y []netip.Prefix) (added []netip.Prefix, ok bool) {
+	m := make(map[netip.Prefix]bool, len(x))
+	for _, v := range x {
+		m[v] = true
+	}
+	for _, v := range y {
+		if m[v] {
+			delete(m, v)
+		} else {
+			added = append(added, v)
+		}
+	}
+	return added, len(m) == 0
+}